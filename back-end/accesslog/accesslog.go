@@ -0,0 +1,370 @@
+package accesslog
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Statuses of a chain segment
+const (
+	StatusSealed   = "sealed"   // hashed, the on-chain anchor is pending or failed and will be retried
+	StatusAnchored = "anchored" // head recorded on-chain
+)
+
+// TxTypeDocumentAccessChain is the transaction type of a chain head anchor
+const TxTypeDocumentAccessChain = "DOCUMENT_ACCESS_CHAIN"
+
+// GenesisHead is the head the chain starts from
+const GenesisHead = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// maxSegmentEntries bounds the entries sealed into one segment
+const maxSegmentEntries = 10000
+
+// sealLockKey serializes sealing across instances
+const sealLockKey = 7450211
+
+// Entry is a read of, or refused access to, a document
+type Entry struct {
+	ID         int       `json:"id"`
+	DocumentID int       `json:"document_id"`
+	BatchID    int       `json:"batch_id,omitempty"`
+	AccountID  int       `json:"account_id,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	Allowed    bool      `json:"allowed"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+// Segment is a run of log entries hashed into the chain. Each entry's hash covers the previous one, starting
+// from the head of the previous segment, so the head of a segment commits to every entry logged before it
+type Segment struct {
+	ID          int        `json:"id"`
+	FirstLogID  int        `json:"first_log_id"`
+	LastLogID   int        `json:"last_log_id"`
+	Entries     int        `json:"entries"`
+	PeriodStart time.Time  `json:"period_start"`
+	PeriodEnd   time.Time  `json:"period_end"`
+	PrevHead    string     `json:"prev_head"`
+	Head        string     `json:"head"`
+	Status      string     `json:"status"`
+	AnchorTxID  string     `json:"anchor_tx_id,omitempty"`
+	AnchorError string     `json:"anchor_error,omitempty"`
+	AnchoredAt  *time.Time `json:"anchored_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Record adds an entry to the log
+func Record(e Entry) error {
+	_, err := db.DB.Exec(`
+		INSERT INTO document_access_log (document_id, batch_id, account_id, role, method, path, ip_address, allowed, accessed_at)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), NULLIF($4, ''), $5, $6, NULLIF($7, ''), $8, NOW())
+	`, e.DocumentID, e.BatchID, e.AccountID, e.Role, e.Method, e.Path, e.IPAddress, e.Allowed)
+	return err
+}
+
+// Hash chains an entry to the hash before it
+func Hash(prev string, e Entry) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		prev,
+		fmt.Sprint(e.ID),
+		fmt.Sprint(e.DocumentID),
+		fmt.Sprint(e.BatchID),
+		fmt.Sprint(e.AccountID),
+		e.Role,
+		e.Method,
+		e.Path,
+		e.IPAddress,
+		fmt.Sprint(e.Allowed),
+		e.AccessedAt.UTC().Format(time.RFC3339Nano),
+	}, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Service seals the log into chain segments and anchors their heads on a schedule
+// Entries are sealed once older than Settle, so that entries still being written are not skipped
+type Service struct {
+	Config   *config.Config
+	Interval time.Duration
+	Settle   time.Duration
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates a chain service from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		Config:   cfg,
+		Interval: time.Duration(cfg.DocumentAccessChainIntervalSeconds) * time.Second,
+		Settle:   time.Duration(cfg.DocumentAccessChainSettleSeconds) * time.Second,
+	}
+}
+
+// Default returns the process wide chain service
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Start seals and anchors on a schedule in the background
+func (s *Service) Start() {
+	go func() {
+		for {
+			time.Sleep(s.Interval)
+
+			if err := s.RunOnce(); err != nil {
+				fmt.Printf("Warning: document access chain run failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// RunOnce seals the settled entries and anchors the segments not anchored yet
+func (s *Service) RunOnce() error {
+	if db.DB == nil {
+		return nil
+	}
+	for {
+		segment, err := s.Seal()
+		if err != nil {
+			return err
+		}
+		if segment == nil || segment.Entries < maxSegmentEntries {
+			break
+		}
+	}
+
+	rows, err := db.DB.Query(`SELECT id FROM document_access_chain WHERE status = $1 ORDER BY last_log_id`, StatusSealed)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	for _, id := range ids {
+		if _, err := s.Anchor(id); err != nil {
+			fmt.Printf("Warning: failed to anchor document access chain segment %d: %v\n", id, err)
+		}
+	}
+	return nil
+}
+
+const entryColumns = `
+	id, document_id, COALESCE(batch_id, 0), COALESCE(account_id, 0), COALESCE(role, ''), method, path,
+	COALESCE(ip_address, ''), allowed, accessed_at
+`
+
+// rowScanner is a row of entryColumns or segmentColumns
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanEntry reads an entry selected with entryColumns
+func scanEntry(row rowScanner) (Entry, error) {
+	var e Entry
+	err := row.Scan(&e.ID, &e.DocumentID, &e.BatchID, &e.AccountID, &e.Role, &e.Method, &e.Path, &e.IPAddress, &e.Allowed, &e.AccessedAt)
+	return e, err
+}
+
+// Seal hashes the settled entries after the last segment into a new segment.
+// It returns nil when there is nothing to seal
+func (s *Service) Seal() (*Segment, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, sealLockKey); err != nil {
+		return nil, err
+	}
+
+	after, head := 0, GenesisHead
+	err = tx.QueryRow(`SELECT last_log_id, head_hash FROM document_access_chain ORDER BY last_log_id DESC LIMIT 1`).Scan(&after, &head)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT `+entryColumns+`
+		FROM document_access_log
+		WHERE id > $1 AND accessed_at < NOW() - ($2 * INTERVAL '1 second')
+		ORDER BY id LIMIT $3
+	`, after, int(s.Settle/time.Second), maxSegmentEntries)
+	if err != nil {
+		return nil, err
+	}
+	segment := &Segment{PrevHead: head, Head: head, Status: StatusSealed}
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if segment.Entries == 0 {
+			segment.FirstLogID = e.ID
+			segment.PeriodStart, segment.PeriodEnd = e.AccessedAt, e.AccessedAt
+		}
+		if e.AccessedAt.Before(segment.PeriodStart) {
+			segment.PeriodStart = e.AccessedAt
+		}
+		if e.AccessedAt.After(segment.PeriodEnd) {
+			segment.PeriodEnd = e.AccessedAt
+		}
+		segment.Head = Hash(segment.Head, e)
+		segment.LastLogID = e.ID
+		segment.Entries++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if segment.Entries == 0 {
+		return nil, nil
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO document_access_chain (first_log_id, last_log_id, entry_count, period_start, period_end, prev_head, head_hash, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+		RETURNING id, created_at
+	`, segment.FirstLogID, segment.LastLogID, segment.Entries, segment.PeriodStart, segment.PeriodEnd,
+		segment.PrevHead, segment.Head, segment.Status).Scan(&segment.ID, &segment.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return segment, tx.Commit()
+}
+
+// Anchor records the head of a segment on-chain
+func (s *Service) Anchor(segmentID int) (*Segment, error) {
+	segment, err := GetSegment(segmentID)
+	if err != nil {
+		return nil, err
+	}
+	if segment.Status == StatusAnchored {
+		return segment, nil
+	}
+
+	client := blockchain.NewBlockchainClient(
+		s.Config.BlockchainNodeURL,
+		s.Config.BlockchainPrivateKey,
+		s.Config.BlockchainAccount,
+		s.Config.BlockchainChainID,
+		s.Config.BlockchainConsensus,
+	)
+	txID, err := client.SubmitGenericTransaction(TxTypeDocumentAccessChain, map[string]interface{}{
+		"segment_id":   segment.ID,
+		"first_log_id": segment.FirstLogID,
+		"last_log_id":  segment.LastLogID,
+		"entries":      segment.Entries,
+		"prev_head":    segment.PrevHead,
+		"head":         segment.Head,
+		"period_start": segment.PeriodStart.UTC().Format(time.RFC3339Nano),
+		"period_end":   segment.PeriodEnd.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		if _, dbErr := db.DB.Exec("UPDATE document_access_chain SET anchor_error = $2 WHERE id = $1", segmentID, err.Error()); dbErr != nil {
+			return nil, dbErr
+		}
+		return nil, err
+	}
+
+	_, err = db.DB.Exec(`
+		UPDATE document_access_chain SET status = $2, anchor_tx_id = $3, anchor_error = NULL, anchored_at = NOW()
+		WHERE id = $1
+	`, segmentID, StatusAnchored, txID)
+	if err != nil {
+		return nil, err
+	}
+	return GetSegment(segmentID)
+}
+
+const segmentColumns = `
+	id, first_log_id, last_log_id, entry_count, period_start, period_end, prev_head, head_hash, status,
+	COALESCE(anchor_tx_id, ''), COALESCE(anchor_error, ''), anchored_at, created_at
+`
+
+// scanSegment reads a segment selected with segmentColumns
+func scanSegment(row rowScanner) (*Segment, error) {
+	var s Segment
+	var anchoredAt sql.NullTime
+	err := row.Scan(&s.ID, &s.FirstLogID, &s.LastLogID, &s.Entries, &s.PeriodStart, &s.PeriodEnd, &s.PrevHead, &s.Head,
+		&s.Status, &s.AnchorTxID, &s.AnchorError, &anchoredAt, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if anchoredAt.Valid {
+		s.AnchoredAt = &anchoredAt.Time
+	}
+	return &s, nil
+}
+
+// GetSegment loads a segment
+func GetSegment(segmentID int) (*Segment, error) {
+	return scanSegment(db.DB.QueryRow("SELECT "+segmentColumns+" FROM document_access_chain WHERE id = $1", segmentID))
+}
+
+// Segments loads the segments holding entries of a period, oldest first
+func Segments(from, to time.Time) ([]Segment, error) {
+	rows, err := db.DB.Query(`SELECT `+segmentColumns+`
+		FROM document_access_chain
+		WHERE period_end >= $1 AND period_start <= $2
+		ORDER BY last_log_id
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	segments := []Segment{}
+	for rows.Next() {
+		s, err := scanSegment(rows)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, *s)
+	}
+	return segments, rows.Err()
+}
+
+// Entries loads the entries of a period, of one document when documentID is set, oldest first
+func Entries(documentID int, from, to time.Time, limit int) ([]Entry, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	rows, err := db.DB.Query(`SELECT `+entryColumns+`
+		FROM document_access_log
+		WHERE ($1 = 0 OR document_id = $1) AND accessed_at BETWEEN $2 AND $3
+		ORDER BY id LIMIT $4
+	`, documentID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []Entry{}
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
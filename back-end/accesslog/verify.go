@@ -0,0 +1,129 @@
+package accesslog
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// SegmentCheck is the verification of a segment
+type SegmentCheck struct {
+	Segment
+	RecomputedHead    string   `json:"recomputed_head"`
+	RecomputedEntries int      `json:"recomputed_entries"`
+	Valid             bool     `json:"valid"`
+	Issues            []string `json:"issues"`
+}
+
+// Verification is the outcome of checking the chain over a period
+type Verification struct {
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	Valid     bool           `json:"valid"`    // Every segment matches the log and follows the one before it
+	Anchored  bool           `json:"anchored"` // Every segment's head is recorded on-chain
+	Segments  []SegmentCheck `json:"segments"`
+	Entries   int            `json:"entries"`  // Entries covered by the segments checked
+	Unsealed  int            `json:"unsealed"` // Entries of the period not sealed into the chain yet
+	Issues    []string       `json:"issues"`
+	CheckedAt time.Time      `json:"checked_at"`
+}
+
+// Verify recomputes the chain over the segments holding entries of a period. A segment is valid when
+// hashing the log entries after the previous segment's last entry, from its previous head, gives its head
+// and count, and its previous head is the head of the segment before it: an entry edited, deleted or
+// inserted after sealing, or a segment removed, breaks the chain from there on
+func Verify(from, to time.Time) (*Verification, error) {
+	v := &Verification{From: from, To: to, Valid: true, Anchored: true, Segments: []SegmentCheck{}, Issues: []string{}, CheckedAt: time.Now()}
+	segments, err := Segments(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	after, head := 0, GenesisHead
+	if len(segments) > 0 {
+		err := db.DB.QueryRow(`
+			SELECT last_log_id, head_hash FROM document_access_chain WHERE last_log_id < $1 ORDER BY last_log_id DESC LIMIT 1
+		`, segments[0].FirstLogID).Scan(&after, &head)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	for _, segment := range segments {
+		check, err := verifySegment(segment, after, head)
+		if err != nil {
+			return nil, err
+		}
+		if !check.Valid {
+			v.Valid = false
+		}
+		if segment.Status != StatusAnchored {
+			v.Anchored = false
+			v.Issues = append(v.Issues, fmt.Sprintf("Segment %d is not anchored on-chain yet", segment.ID))
+		}
+		v.Entries += check.RecomputedEntries
+		v.Segments = append(v.Segments, check)
+		after, head = segment.LastLogID, segment.Head
+	}
+
+	var lastSealed int
+	if err := db.DB.QueryRow(`SELECT COALESCE(MAX(last_log_id), 0) FROM document_access_chain`).Scan(&lastSealed); err != nil {
+		return nil, err
+	}
+	if err := db.DB.QueryRow(`
+		SELECT COUNT(*) FROM document_access_log WHERE id > $1 AND accessed_at BETWEEN $2 AND $3
+	`, lastSealed, from, to).Scan(&v.Unsealed); err != nil {
+		return nil, err
+	}
+	if v.Unsealed > 0 {
+		v.Issues = append(v.Issues, fmt.Sprintf("%d entries of the period are not sealed into the chain yet", v.Unsealed))
+	}
+	for _, check := range v.Segments {
+		for _, issue := range check.Issues {
+			v.Issues = append(v.Issues, fmt.Sprintf("Segment %d: %s", check.ID, issue))
+		}
+	}
+	return v, nil
+}
+
+// verifySegment recomputes a segment from the entries after the previous segment's last entry
+func verifySegment(segment Segment, after int, prevHead string) (SegmentCheck, error) {
+	check := SegmentCheck{Segment: segment, Issues: []string{}}
+	if segment.PrevHead != prevHead {
+		check.Issues = append(check.Issues, "previous head does not match the head of the segment before it")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+entryColumns+`
+		FROM document_access_log
+		WHERE id > $1 AND id <= $2
+		ORDER BY id
+	`, after, segment.LastLogID)
+	if err != nil {
+		return check, err
+	}
+	defer rows.Close()
+	head := segment.PrevHead
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return check, err
+		}
+		head = Hash(head, e)
+		check.RecomputedEntries++
+	}
+	if err := rows.Err(); err != nil {
+		return check, err
+	}
+	check.RecomputedHead = head
+
+	if check.RecomputedEntries != segment.Entries {
+		check.Issues = append(check.Issues, fmt.Sprintf("%d entries sealed, %d found in the log", segment.Entries, check.RecomputedEntries))
+	}
+	if head != segment.Head {
+		check.Issues = append(check.Issues, "entries do not hash to the sealed head: the log was changed after sealing")
+	}
+	check.Valid = len(check.Issues) == 0
+	return check, nil
+}
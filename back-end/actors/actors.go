@@ -0,0 +1,264 @@
+package actors
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Actor is an account that recorded events or transfers, with the DID it acts under
+// An identity is linked to an account by the account_id key of its metadata
+type Actor struct {
+	AccountID   int    `json:"account_id"`
+	Username    string `json:"username"`
+	Name        string `json:"name"`
+	Role        string `json:"role"`
+	Email       string `json:"-"`
+	CompanyID   int    `json:"company_id,omitempty"`
+	CompanyName string `json:"company_name,omitempty"`
+	DID         string `json:"did,omitempty"`
+	DIDStatus   string `json:"did_status,omitempty"`
+	IsActive    bool   `json:"is_active"`
+}
+
+// DisplayName is the full name of the actor, or the username when it has none
+func (a Actor) DisplayName() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return a.Username
+}
+
+// Identity is a registered DID with the account it is linked to
+type Identity struct {
+	DID        string `json:"did"`
+	EntityType string `json:"entity_type"`
+	EntityName string `json:"entity_name"`
+	Status     string `json:"status"`
+	AccountID  int    `json:"account_id,omitempty"`
+}
+
+// Service resolves accounts and DIDs in one query per call, keeping recent results in an LRU cache
+// Lookups that found nothing are cached too, so unknown actors do not hit the database on every trace
+type Service struct {
+	Size int
+	TTL  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Most recently used first
+}
+
+type entry struct {
+	key       string
+	value     interface{} // Actor, Identity or nil when not found
+	expiresAt time.Time
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates an actor resolver from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		Size: cfg.ActorCacheSize,
+		TTL:  time.Duration(cfg.ActorCacheSeconds) * time.Second,
+	}
+}
+
+// Default returns the process wide actor resolver
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+func accountKey(id int) string { return fmt.Sprintf("account:%d", id) }
+
+func didKey(did string) string { return "did:" + did }
+
+// get returns a cached value; ok is false when the key is missing or expired
+func (s *Service) get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if time.Now().After(e.expiresAt) {
+		s.order.Remove(el)
+		delete(s.entries, key)
+		return nil, false
+	}
+	s.order.MoveToFront(el)
+	return e.value, true
+}
+
+// put caches a value, evicting the least recently used entries beyond Size
+func (s *Service) put(key string, value interface{}) {
+	if s.Size <= 0 || s.TTL <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == nil {
+		s.entries = map[string]*list.Element{}
+		s.order = list.New()
+	}
+	if el, ok := s.entries[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expiresAt = value, time.Now().Add(s.TTL)
+		s.order.MoveToFront(el)
+		return
+	}
+	s.entries[key] = s.order.PushFront(&entry{key: key, value: value, expiresAt: time.Now().Add(s.TTL)})
+	for s.order.Len() > s.Size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*entry).key)
+	}
+}
+
+// Invalidate drops accounts from the cache; it is called after an account or its identity changes
+func (s *Service) Invalidate(accountIDs ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range accountIDs {
+		if el, ok := s.entries[accountKey(id)]; ok {
+			s.order.Remove(el)
+			delete(s.entries, accountKey(id))
+		}
+	}
+}
+
+// Accounts resolves accounts by ID; IDs that do not exist are left out of the result
+func (s *Service) Accounts(ids []int) (map[int]Actor, error) {
+	result := make(map[int]Actor, len(ids))
+	var missing []int
+	seen := map[int]bool{}
+	for _, id := range ids {
+		if id <= 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if value, ok := s.get(accountKey(id)); ok {
+			if actor, found := value.(Actor); found {
+				result[id] = actor
+			}
+			continue
+		}
+		missing = append(missing, id)
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT a.id, a.username, COALESCE(a.full_name, ''), COALESCE(a.role, ''), a.email,
+			COALESCE(a.company_id, 0), COALESCE(c.name, ''), COALESCE(a.is_active, false),
+			COALESCE(i.did, ''), COALESCE(i.status, '')
+		FROM account a
+		LEFT JOIN company c ON c.id = a.company_id
+		LEFT JOIN LATERAL (
+			SELECT did, status FROM identities WHERE metadata->>'account_id' = a.id::text ORDER BY created_at DESC LIMIT 1
+		) i ON true
+		WHERE a.id = ANY($1)
+	`, pq.Array(missing))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a Actor
+		if err := rows.Scan(&a.AccountID, &a.Username, &a.Name, &a.Role, &a.Email, &a.CompanyID, &a.CompanyName,
+			&a.IsActive, &a.DID, &a.DIDStatus); err != nil {
+			return nil, err
+		}
+		result[a.AccountID] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range missing {
+		if actor, ok := result[id]; ok {
+			s.put(accountKey(id), actor)
+		} else {
+			s.put(accountKey(id), nil)
+		}
+	}
+	return result, nil
+}
+
+// Account resolves a single account
+func (s *Service) Account(id int) (Actor, bool, error) {
+	resolved, err := s.Accounts([]int{id})
+	if err != nil {
+		return Actor{}, false, err
+	}
+	actor, ok := resolved[id]
+	return actor, ok, nil
+}
+
+// DIDs resolves registered DIDs; DIDs that are not registered are left out of the result
+func (s *Service) DIDs(dids []string) (map[string]Identity, error) {
+	result := make(map[string]Identity, len(dids))
+	var missing []string
+	seen := map[string]bool{}
+	for _, did := range dids {
+		if did == "" || seen[did] {
+			continue
+		}
+		seen[did] = true
+		if value, ok := s.get(didKey(did)); ok {
+			if identity, found := value.(Identity); found {
+				result[did] = identity
+			}
+			continue
+		}
+		missing = append(missing, did)
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT did, entity_type, entity_name, status,
+			CASE WHEN metadata->>'account_id' ~ '^[0-9]+$' THEN (metadata->>'account_id')::int ELSE 0 END
+		FROM identities
+		WHERE did = ANY($1)
+	`, pq.Array(missing))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.DID, &i.EntityType, &i.EntityName, &i.Status, &i.AccountID); err != nil {
+			return nil, err
+		}
+		result[i.DID] = i
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, did := range missing {
+		if identity, ok := result[did]; ok {
+			s.put(didKey(did), identity)
+		} else {
+			s.put(didKey(did), nil)
+		}
+	}
+	return result, nil
+}
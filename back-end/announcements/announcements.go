@@ -0,0 +1,319 @@
+package announcements
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Severities of an announcement, from least to most urgent
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Audiences an announcement is shown to
+const (
+	AudienceAll = "all" // every API consumer and frontend user
+	AudienceAPI = "api" // integrations calling the API
+	AudienceWeb = "web" // users of the web frontend
+)
+
+var (
+	// ErrNotFound is returned for an announcement that does not exist
+	ErrNotFound = errors.New("announcement not found")
+	// ErrInvalid is returned for an announcement with missing or inconsistent fields
+	ErrInvalid = errors.New("invalid announcement")
+)
+
+// Announcement is a banner operators show to API consumers and frontend users during its time window.
+// A maintenance announcement also carries the maintenance window, which can start after the banner is first shown
+type Announcement struct {
+	ID                  int        `json:"id"`
+	Title               string     `json:"title"`
+	Message             string     `json:"message"`
+	Severity            string     `json:"severity"` // info, warning or critical
+	Audience            string     `json:"audience"` // all, api or web
+	StartsAt            time.Time  `json:"starts_at"`
+	EndsAt              time.Time  `json:"ends_at"`
+	MaintenanceStartsAt *time.Time `json:"maintenance_starts_at,omitempty"`
+	MaintenanceEndsAt   *time.Time `json:"maintenance_ends_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// IsActive reports whether the banner is shown at a time
+func (a Announcement) IsActive(at time.Time) bool {
+	return !at.Before(a.StartsAt) && at.Before(a.EndsAt)
+}
+
+// InMaintenance reports whether the maintenance window of the announcement is open at a time
+func (a Announcement) InMaintenance(at time.Time) bool {
+	return a.MaintenanceStartsAt != nil && a.MaintenanceEndsAt != nil &&
+		!at.Before(*a.MaintenanceStartsAt) && at.Before(*a.MaintenanceEndsAt)
+}
+
+// ShownTo reports whether an audience sees the announcement; an empty audience sees every announcement
+func (a Announcement) ShownTo(audience string) bool {
+	return audience == "" || a.Audience == AudienceAll || a.Audience == audience
+}
+
+// Validate normalizes an announcement and checks its fields
+func (a *Announcement) Validate() error {
+	a.Title = strings.TrimSpace(a.Title)
+	a.Message = strings.TrimSpace(a.Message)
+	if a.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalid)
+	}
+	if a.Severity == "" {
+		a.Severity = SeverityInfo
+	}
+	switch a.Severity {
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("%w: severity must be info, warning or critical", ErrInvalid)
+	}
+	if a.Audience == "" {
+		a.Audience = AudienceAll
+	}
+	switch a.Audience {
+	case AudienceAll, AudienceAPI, AudienceWeb:
+	default:
+		return fmt.Errorf("%w: audience must be all, api or web", ErrInvalid)
+	}
+	if a.StartsAt.IsZero() {
+		a.StartsAt = time.Now()
+	}
+	if (a.MaintenanceStartsAt == nil) != (a.MaintenanceEndsAt == nil) {
+		return fmt.Errorf("%w: maintenance_starts_at and maintenance_ends_at go together", ErrInvalid)
+	}
+	if a.MaintenanceEndsAt != nil {
+		if !a.MaintenanceEndsAt.After(*a.MaintenanceStartsAt) {
+			return fmt.Errorf("%w: the maintenance window must end after it starts", ErrInvalid)
+		}
+		// A maintenance banner is shown at least until the maintenance is over
+		if a.EndsAt.IsZero() || a.EndsAt.Before(*a.MaintenanceEndsAt) {
+			a.EndsAt = *a.MaintenanceEndsAt
+		}
+		if a.StartsAt.After(*a.MaintenanceStartsAt) {
+			return fmt.Errorf("%w: the banner must start before the maintenance window", ErrInvalid)
+		}
+	}
+	if a.EndsAt.IsZero() {
+		return fmt.Errorf("%w: ends_at is required", ErrInvalid)
+	}
+	if !a.EndsAt.After(a.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalid)
+	}
+	return nil
+}
+
+const columns = `
+	id, title, COALESCE(message, ''), severity, audience, starts_at, ends_at, maintenance_starts_at, maintenance_ends_at,
+	created_at, updated_at
+`
+
+// scan reads an announcement selected with columns
+func scan(row interface{ Scan(...interface{}) error }) (Announcement, error) {
+	var a Announcement
+	var maintenanceStartsAt, maintenanceEndsAt sql.NullTime
+	err := row.Scan(&a.ID, &a.Title, &a.Message, &a.Severity, &a.Audience, &a.StartsAt, &a.EndsAt,
+		&maintenanceStartsAt, &maintenanceEndsAt, &a.CreatedAt, &a.UpdatedAt)
+	if maintenanceStartsAt.Valid {
+		a.MaintenanceStartsAt = &maintenanceStartsAt.Time
+	}
+	if maintenanceEndsAt.Valid {
+		a.MaintenanceEndsAt = &maintenanceEndsAt.Time
+	}
+	return a, err
+}
+
+// query runs a query selecting columns
+func query(q string, args ...interface{}) ([]Announcement, error) {
+	rows, err := db.DB.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	announcements := []Announcement{}
+	for rows.Next() {
+		a, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		announcements = append(announcements, a)
+	}
+	return announcements, rows.Err()
+}
+
+// List returns the announcements shown at some point of a period, latest first
+func List(from, to time.Time) ([]Announcement, error) {
+	return query(`SELECT `+columns+`
+		FROM announcement
+		WHERE starts_at <= $2 AND ends_at >= $1
+		ORDER BY starts_at DESC, id DESC
+	`, from, to)
+}
+
+// Get returns an announcement
+func Get(id int) (*Announcement, error) {
+	a, err := scan(db.DB.QueryRow(`SELECT `+columns+` FROM announcement WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// Create records an announcement; it is shown from now unless a start time is given
+func Create(a Announcement, userID int) (*Announcement, error) {
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	created, err := scan(db.DB.QueryRow(`
+		INSERT INTO announcement (title, message, severity, audience, starts_at, ends_at, maintenance_starts_at,
+			maintenance_ends_at, created_by, updated_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, 0), NULLIF($9, 0), NOW(), NOW())
+		RETURNING `+columns,
+		a.Title, a.Message, a.Severity, a.Audience, a.StartsAt, a.EndsAt, a.MaintenanceStartsAt, a.MaintenanceEndsAt, userID))
+	if err != nil {
+		return nil, err
+	}
+	Default().Invalidate()
+	return &created, nil
+}
+
+// Update replaces the fields of an announcement
+func Update(id int, a Announcement, userID int) (*Announcement, error) {
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	updated, err := scan(db.DB.QueryRow(`
+		UPDATE announcement
+		SET title = $2, message = $3, severity = $4, audience = $5, starts_at = $6, ends_at = $7,
+			maintenance_starts_at = $8, maintenance_ends_at = $9, updated_by = NULLIF($10, 0), updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+columns,
+		id, a.Title, a.Message, a.Severity, a.Audience, a.StartsAt, a.EndsAt, a.MaintenanceStartsAt, a.MaintenanceEndsAt, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	Default().Invalidate()
+	return &updated, nil
+}
+
+// Delete removes an announcement; ending it early is done by updating its ends_at
+func Delete(id int) error {
+	result, err := db.DB.Exec("DELETE FROM announcement WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	Default().Invalidate()
+	return nil
+}
+
+// Service serves the current announcements from a short-lived cache, so every API response can check for
+// maintenance without a database query
+type Service struct {
+	// CacheTTL is how long the current announcements are reused
+	CacheTTL time.Duration
+
+	mu       sync.Mutex
+	current  []Announcement
+	loadedAt time.Time
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates an announcement cache
+func NewService() *Service {
+	return &Service{CacheTTL: 30 * time.Second}
+}
+
+// Default returns the process wide announcement cache
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService()
+	})
+	return defaultService
+}
+
+// Invalidate drops the cache so changes show on the next request
+func (s *Service) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = nil
+}
+
+// load returns the announcements not yet ended, loading them again once the cache is older than CacheTTL
+func (s *Service) load() ([]Announcement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil || time.Since(s.loadedAt) > s.CacheTTL {
+		current, err := query(`SELECT ` + columns + `
+			FROM announcement
+			WHERE ends_at > NOW()
+			ORDER BY starts_at, id
+		`)
+		if err != nil {
+			return nil, err
+		}
+		s.current, s.loadedAt = current, time.Now()
+	}
+	return s.current, nil
+}
+
+// Active returns the announcements shown to an audience now, the most urgent first
+func (s *Service) Active(audience string) ([]Announcement, error) {
+	current, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	active := []Announcement{}
+	for _, a := range current {
+		if a.IsActive(now) && a.ShownTo(audience) {
+			active = append(active, a)
+		}
+	}
+	sort.SliceStable(active, func(i, j int) bool {
+		return severityRank[active[i].Severity] < severityRank[active[j].Severity]
+	})
+	return active, nil
+}
+
+// Maintenance returns the announcement whose maintenance window is open now, or nil
+func (s *Service) Maintenance() (*Announcement, error) {
+	current, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, a := range current {
+		if a.InMaintenance(now) {
+			return &a, nil
+		}
+	}
+	return nil, nil
+}
+
+// severityRank orders severities from most to least urgent
+var severityRank = map[string]int{SeverityCritical: 0, SeverityWarning: 1, SeverityInfo: 2}
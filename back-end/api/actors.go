@@ -0,0 +1,40 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/actors"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// resolveEventActors fills in the actor of each event, looking all of them up at once
+func resolveEventActors(events []models.EventWithActor) error {
+	ids := make([]int, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ActorID)
+	}
+	resolved, err := actors.Default().Accounts(ids)
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		if actor, ok := resolved[events[i].ActorID]; ok {
+			events[i].ActorName = actor.Username
+			events[i].ActorRole = actor.Role
+			events[i].ActorEmail = actor.Email
+			events[i].ActorDID = actor.DID
+		}
+	}
+	return nil
+}
+
+// actorUsername is the username of a resolved account, or a placeholder naming its ID
+func actorUsername(resolved map[int]actors.Actor, accountID int, fallback string) string {
+	if actor, ok := resolved[accountID]; ok && actor.Username != "" {
+		return actor.Username
+	}
+	if fallback != "" {
+		return fallback
+	}
+	return fmt.Sprintf("User ID: %d", accountID)
+}
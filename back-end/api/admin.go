@@ -7,6 +7,7 @@ import (
 	"time"
 	"strconv"
 	"github.com/gofiber/fiber/v2"
+	"github.com/LTPPPP/TracePost-larvaeChain/actors"
 	"github.com/LTPPPP/TracePost-larvaeChain/db"
 	"github.com/LTPPPP/TracePost-larvaeChain/models"
 )
@@ -65,6 +66,7 @@ func LockUnlockUser(c *fiber.Ctx) error {
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update user status: "+err.Error())
 	}
+	actors.Default().Invalidate(userId)
 
 	// Return response
 	statusText := "locked"
@@ -367,7 +369,7 @@ func CheckStandardCompliance(c *fiber.Ctx) error {
 	// For now, we'll simulate the check
 	var envData []models.EnvironmentData
 	// Replace GORM query with standard SQL query
-	rows, err := db.DB.Query("SELECT id, batch_id, temperature, ph, salinity, density, age, timestamp, updated_at, is_active FROM environment_data WHERE batch_id = $1", req.BatchID)
+	rows, err := db.DB.Query("SELECT id, batch_id, temperature, ph, salinity, density, age, timestamp, updated_at, is_active FROM environment_data WHERE batch_id = $1 AND COALESCE(suppressed, false) = false", req.BatchID)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to query environment data: "+err.Error())
 	}
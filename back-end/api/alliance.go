@@ -194,7 +194,7 @@ func ShareDataWithAlliance(c *fiber.Ctx) error {
 		"timestamp":    time.Now(),
 	})
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record share on blockchain: "+err.Error())
+		return blockchainFailure("Failed to record share on blockchain", err)
 	}
 	
 	// Record in database
@@ -375,7 +375,7 @@ func JoinAlliance(c *fiber.Ctx) error {
 		"status":      "pending", // New members start as pending until approved
 	})
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record join request on blockchain: "+err.Error())
+		return blockchainFailure("Failed to record join request on blockchain", err)
 	}
 	
 	// Record in database
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/announcements"
+)
+
+// AnnouncementRequest represents a request to post or update an announcement banner
+type AnnouncementRequest struct {
+	Title               string     `json:"title"`
+	Message             string     `json:"message"`
+	Severity            string     `json:"severity"`            // info, warning or critical; default info
+	Audience            string     `json:"audience"`            // all, api or web; default all
+	StartsAt            time.Time  `json:"starts_at,omitempty"` // Default now
+	EndsAt              time.Time  `json:"ends_at,omitempty"`   // Default the end of the maintenance window
+	MaintenanceStartsAt *time.Time `json:"maintenance_starts_at,omitempty"`
+	MaintenanceEndsAt   *time.Time `json:"maintenance_ends_at,omitempty"`
+}
+
+// announcement converts the request to an announcement
+func (r AnnouncementRequest) announcement() announcements.Announcement {
+	return announcements.Announcement{
+		Title:               r.Title,
+		Message:             r.Message,
+		Severity:            r.Severity,
+		Audience:            r.Audience,
+		StartsAt:            r.StartsAt,
+		EndsAt:              r.EndsAt,
+		MaintenanceStartsAt: r.MaintenanceStartsAt,
+		MaintenanceEndsAt:   r.MaintenanceEndsAt,
+	}
+}
+
+// announcementError maps an announcement error to an HTTP error
+func announcementError(err error, message string) error {
+	switch {
+	case errors.Is(err, announcements.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Announcement not found")
+	case errors.Is(err, announcements.ErrInvalid):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, message)
+}
+
+// GetActiveAnnouncements returns the banners to show now
+// @Summary Get active announcements
+// @Description Get the announcement banners shown now, the most urgent first, for API consumers (audience=api), frontend users (audience=web) or both when empty.
+// @Description While a maintenance window is open every API response also carries X-Maintenance: true and the end of the window in X-Maintenance-Ends
+// @Tags health
+// @Produce json
+// @Param audience query string false "api or web"
+// @Success 200 {object} SuccessResponse{data=[]announcements.Announcement}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /announcements/active [get]
+func GetActiveAnnouncements(c *fiber.Ctx) error {
+	audience := c.Query("audience")
+	switch audience {
+	case "", announcements.AudienceAPI, announcements.AudienceWeb:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Audience must be api or web")
+	}
+
+	active, err := announcements.Default().Active(audience)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve announcements")
+	}
+	c.Set(fiber.HeaderCacheControl, "public, max-age=30")
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Active announcements retrieved successfully",
+		Data:    active,
+	})
+}
+
+// ListAnnouncements lists announcement banners
+// @Summary List announcements
+// @Description List the announcements shown at some point of a period, latest first
+// @Tags admin
+// @Produce json
+// @Param from query string false "Start time (RFC3339), default 90 days before to"
+// @Param to query string false "End time (RFC3339), default 90 days after now"
+// @Success 200 {object} SuccessResponse{data=[]announcements.Announcement}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/announcements [get]
+func ListAnnouncements(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return err
+	}
+	// Scheduled announcements are listed too
+	if to.IsZero() {
+		to = time.Now().AddDate(0, 0, 90)
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -180)
+	}
+
+	list, err := announcements.List(from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve announcements")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Announcements retrieved successfully",
+		Data:    list,
+	})
+}
+
+// CreateAnnouncement posts an announcement banner
+// @Summary Create announcement
+// @Description Show a banner to API consumers, frontend users or both during a time window. A maintenance announcement also sets the maintenance window,
+// @Description during which every API response is flagged with the X-Maintenance header; its banner is shown at least until the maintenance ends
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body AnnouncementRequest true "Announcement"
+// @Success 201 {object} SuccessResponse{data=announcements.Announcement}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/announcements [post]
+func CreateAnnouncement(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	var req AnnouncementRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	announcement, err := announcements.Create(req.announcement(), userID)
+	if err != nil {
+		return announcementError(err, "Failed to create announcement")
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Announcement created successfully",
+		Data:    announcement,
+	})
+}
+
+// UpdateAnnouncement updates an announcement banner
+// @Summary Update announcement
+// @Description Replace the fields of an announcement, e.g. to extend a maintenance window or end a banner early
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param announcementId path int true "Announcement ID"
+// @Param request body AnnouncementRequest true "Announcement"
+// @Success 200 {object} SuccessResponse{data=announcements.Announcement}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/announcements/{announcementId} [put]
+func UpdateAnnouncement(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	announcementID, err := strconv.Atoi(c.Params("announcementId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid announcement ID format")
+	}
+	var req AnnouncementRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	announcement, err := announcements.Update(announcementID, req.announcement(), userID)
+	if err != nil {
+		return announcementError(err, "Failed to update announcement")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Announcement updated successfully",
+		Data:    announcement,
+	})
+}
+
+// DeleteAnnouncement deletes an announcement banner
+// @Summary Delete announcement
+// @Description Delete an announcement posted by mistake; end it early by updating ends_at instead to keep it in the history
+// @Tags admin
+// @Produce json
+// @Param announcementId path int true "Announcement ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/announcements/{announcementId} [delete]
+func DeleteAnnouncement(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	announcementID, err := strconv.Atoi(c.Params("announcementId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid announcement ID format")
+	}
+
+	if err := announcements.Delete(announcementID); err != nil {
+		return announcementError(err, "Failed to delete announcement")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Announcement deleted successfully",
+	})
+}
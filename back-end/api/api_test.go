@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+	"github.com/LTPPPP/TracePost-larvaeChain/usage"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestErrorHandlerKeepsPreviousEnvelope(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Delete("/batches/:id", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodDelete, "/batches/9", nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"status":       float64(404),
+		"code":         CodeNotFound,
+		"detail":       "Batch not found",
+		"success":      false,
+		"error":        "Batch not found",
+		"status_code":  float64(404),
+		"path":         "/batches/9",
+		"method":       fiber.MethodDelete,
+		"error_type":   "NotFound",
+		"error_detail": "The requested resource could not be found",
+	}
+	for member, value := range want {
+		if body[member] != value {
+			t.Errorf("%s = %v, want %v", member, body[member], value)
+		}
+	}
+}
+
+// recordedCalls keeps the calls usage metering records
+type recordedCalls []usage.Call
+
+func (r *recordedCalls) Record(call usage.Call) {
+	*r = append(*r, call)
+}
+
+func TestUsageMeteringRecordsErrorHandlerStatus(t *testing.T) {
+	var calls recordedCalls
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(middleware.UsageMetering(&calls, "/api/", ErrorStatus))
+	app.Get("/api/v1/batches/:id", func(c *fiber.Ctx) error {
+		return &APIError{Status: fiber.StatusNotFound, Code: CodeNotFound, Message: "Batch not found"}
+	})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/batches/9", nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("expected 404 response, got %d", resp.StatusCode)
+	}
+	if len(calls) != 1 || calls[0].Status != fiber.StatusNotFound {
+		t.Fatalf("expected one call recorded as 404, got %+v", calls)
+	}
+}
@@ -0,0 +1,396 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/approvals"
+)
+
+// batchRecallApproval is the payload of a recall waiting for approval
+type batchRecallApproval struct {
+	BatchID int `json:"batch_id"`
+	BatchRecallRequest
+}
+
+// ownershipTransferApproval is the payload of a sale offer waiting for approval
+type ownershipTransferApproval struct {
+	BatchID int `json:"batch_id"`
+	InitiateOwnershipTransferRequest
+}
+
+// tenantExportApproval is the payload of a snapshot export waiting for approval
+type tenantExportApproval struct {
+	CompanyID  int  `json:"company_id"`
+	DemoMirror bool `json:"demo_mirror,omitempty"` // Approved for an anonymized demo mirror, not for download
+}
+
+// ApprovalDecisionRequest represents an approver's answer
+type ApprovalDecisionRequest struct {
+	Comment string `json:"comment"`
+}
+
+// ApprovalPolicyRequest represents the settings of an approval policy
+type ApprovalPolicyRequest struct {
+	Enabled           bool   `json:"enabled"`
+	RequiredApprovals int    `json:"required_approvals"`
+	ApproverRole      string `json:"approver_role"` // admin or company
+	ExpiryHours       int    `json:"expiry_hours"`
+}
+
+func init() {
+	approvals.Register(approvals.ActionBatchRecall, "Recall a batch", func(r approvals.Request) (interface{}, error) {
+		var p batchRecallApproval
+		if err := json.Unmarshal(r.Payload, &p); err != nil {
+			return nil, err
+		}
+		return recallBatch(p.BatchID, p.BatchRecallRequest, r.RequestedBy)
+	})
+	approvals.Register(approvals.ActionOwnershipTransfer, "Offer a batch for sale to another company", func(r approvals.Request) (interface{}, error) {
+		var p ownershipTransferApproval
+		if err := json.Unmarshal(r.Payload, &p); err != nil {
+			return nil, err
+		}
+		return initiateOwnershipTransfer(p.BatchID, p.InitiateOwnershipTransferRequest, r.RequestedBy)
+	})
+	// Exports are downloaded by the requester once approved
+	approvals.Register(approvals.ActionTenantExport, "Export a snapshot of every record of a company", nil)
+}
+
+// submitForApproval submits an action for approval when its policy asks for it, answering the request with
+// the pending approval. It returns nil when the action can be carried out right away
+func submitForApproval(c *fiber.Ctx, actionType string, companyID int, targetType string, targetID int, summary string, payload interface{}) (*approvals.Request, error) {
+	policy, err := approvals.PolicyFor(actionType)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to load approval policy")
+	}
+	if !policy.Enabled {
+		return nil, nil
+	}
+	userID, _ := c.Locals("userID").(int)
+	request, err := approvals.Submit(policy, companyID, targetType, targetID, summary, payload, userID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to submit for approval")
+	}
+	return request, c.Status(fiber.StatusAccepted).JSON(SuccessResponse{
+		Success: true,
+		Message: "Submitted for approval; the action is carried out once approved",
+		Data:    request,
+	})
+}
+
+// canDecideApproval reports whether the caller is an approver of a request under its policy
+func canDecideApproval(c *fiber.Ctx, r *approvals.Request) bool {
+	role, _ := c.Locals("role").(string)
+	if role == "admin" {
+		return true
+	}
+	return r.ApproverRole == approvals.ApproverCompany && r.CompanyID != 0 && actsForCompany(c, r.CompanyID) == nil
+}
+
+// approvalError maps the errors of the approval engine to responses
+func approvalError(err error) error {
+	switch {
+	case errors.Is(err, approvals.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Approval request not found")
+	case errors.Is(err, approvals.ErrNotPending), errors.Is(err, approvals.ErrNotApproved), errors.Is(err, approvals.ErrAlreadyDecided):
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	case errors.Is(err, approvals.ErrSelfApproval), errors.Is(err, approvals.ErrNotRequester):
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	case errors.Is(err, approvals.ErrUnknownAction), errors.Is(err, approvals.ErrInvalidPolicy):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, "Failed to process approval request")
+}
+
+// loadApprovalRequest loads a request from its route parameter, visible to its requester and approvers
+func loadApprovalRequest(c *fiber.Ctx) (*approvals.Request, error) {
+	requestID, err := strconv.Atoi(c.Params("requestId"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid approval request ID format")
+	}
+	request, err := approvals.Get(requestID)
+	if err != nil {
+		return nil, approvalError(err)
+	}
+	userID, _ := c.Locals("userID").(int)
+	if request.RequestedBy != userID && !canDecideApproval(c, request) {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Approval request not found")
+	}
+	return request, nil
+}
+
+// ListPendingApprovals lists the requests the caller can approve
+// @Summary List pending approvals
+// @Description List the pending requests for sensitive actions (recalls, ownership transfers, tenant exports) the caller can approve or reject: every request for admins, the requests of their company for the others when the policy lets the company approve. Requests of the caller are left out
+// @Tags approvals
+// @Produce json
+// @Param action_type query string false "Only requests for this action type"
+// @Success 200 {object} SuccessResponse{data=[]approvals.Request}
+// @Failure 500 {object} ErrorResponse
+// @Router /approvals/pending [get]
+func ListPendingApprovals(c *fiber.Ctx) error {
+	requests, err := approvals.List(approvals.Filter{Status: approvals.StatusPending, ActionType: c.Query("action_type"), Limit: 200})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve approval requests")
+	}
+	userID, _ := c.Locals("userID").(int)
+	pending := []approvals.Request{}
+	for i := range requests {
+		if requests[i].RequestedBy != userID && canDecideApproval(c, &requests[i]) {
+			pending = append(pending, requests[i])
+		}
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Pending approvals retrieved successfully",
+		Data:    pending,
+	})
+}
+
+// ListApprovalRequests lists approval requests
+// @Summary List approval requests
+// @Description List approval requests, newest first. Admins see every request; other users the requests of their company
+// @Tags approvals
+// @Produce json
+// @Param status query string false "pending, approved, executed, failed, rejected, cancelled or expired"
+// @Param action_type query string false "Only requests for this action type"
+// @Param company_id query int false "Only requests of this company"
+// @Param limit query int false "Maximum number of requests (default 50)"
+// @Success 200 {object} SuccessResponse{data=[]approvals.Request}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /approvals [get]
+func ListApprovalRequests(c *fiber.Ctx) error {
+	companyID := c.QueryInt("company_id", 0)
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		companyID, _ = c.Locals("companyID").(int)
+		if companyID == 0 {
+			return fiber.NewError(fiber.StatusForbidden, "You can only see the requests of your company")
+		}
+	}
+
+	requests, err := approvals.List(approvals.Filter{
+		Status:     c.Query("status"),
+		ActionType: c.Query("action_type"),
+		CompanyID:  companyID,
+		Limit:      c.QueryInt("limit", 50),
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve approval requests")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Approval requests retrieved successfully",
+		Data:    requests,
+	})
+}
+
+// GetApprovalRequest gets an approval request
+// @Summary Get approval request
+// @Description Get an approval request with its decisions and, once carried out, its result
+// @Tags approvals
+// @Produce json
+// @Param requestId path int true "Approval request ID"
+// @Success 200 {object} SuccessResponse{data=approvals.Request}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /approvals/{requestId} [get]
+func GetApprovalRequest(c *fiber.Ctx) error {
+	request, err := loadApprovalRequest(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Approval request retrieved successfully",
+		Data:    request,
+	})
+}
+
+// ApproveRequest approves a pending request
+// @Summary Approve request
+// @Description Approve a pending request. The approval that reaches the quorum of the policy carries out the action as the requester; the request then ends executed, or failed with the error
+// @Tags approvals
+// @Accept json
+// @Produce json
+// @Param requestId path int true "Approval request ID"
+// @Param request body ApprovalDecisionRequest false "Optional comment"
+// @Success 200 {object} SuccessResponse{data=approvals.Request}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /approvals/{requestId}/approve [post]
+func ApproveRequest(c *fiber.Ctx) error {
+	return decideApprovalRequest(c, approvals.DecisionApprove)
+}
+
+// RejectRequest rejects a pending request
+// @Summary Reject request
+// @Description Reject a pending request; a single rejection ends it and the action is not carried out
+// @Tags approvals
+// @Accept json
+// @Produce json
+// @Param requestId path int true "Approval request ID"
+// @Param request body ApprovalDecisionRequest false "Optional reason"
+// @Success 200 {object} SuccessResponse{data=approvals.Request}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /approvals/{requestId}/reject [post]
+func RejectRequest(c *fiber.Ctx) error {
+	return decideApprovalRequest(c, approvals.DecisionReject)
+}
+
+// decideApprovalRequest records the caller's decision on a request
+func decideApprovalRequest(c *fiber.Ctx, decision string) error {
+	request, err := loadApprovalRequest(c)
+	if err != nil {
+		return err
+	}
+	if !canDecideApproval(c, request) {
+		return fiber.NewError(fiber.StatusForbidden, "You are not an approver of this request")
+	}
+	var req ApprovalDecisionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	request, err = approvals.Decide(request.ID, userID, decision, req.Comment)
+	if err != nil {
+		return approvalError(err)
+	}
+
+	message := "Decision recorded"
+	switch request.Status {
+	case approvals.StatusExecuted:
+		message = "Request approved and carried out"
+	case approvals.StatusApproved:
+		message = "Request approved; the requester can now carry it out"
+	case approvals.StatusFailed:
+		message = "Request approved but carrying it out failed"
+	case approvals.StatusRejected:
+		message = "Request rejected"
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    request,
+	})
+}
+
+// CancelApprovalRequest withdraws a pending request
+// @Summary Cancel approval request
+// @Description Withdraw a pending request as its requester
+// @Tags approvals
+// @Produce json
+// @Param requestId path int true "Approval request ID"
+// @Success 200 {object} SuccessResponse{data=approvals.Request}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /approvals/{requestId}/cancel [post]
+func CancelApprovalRequest(c *fiber.Ctx) error {
+	request, err := loadApprovalRequest(c)
+	if err != nil {
+		return err
+	}
+	userID, _ := c.Locals("userID").(int)
+	if request, err = approvals.Cancel(request.ID, userID); err != nil {
+		return approvalError(err)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Approval request cancelled",
+		Data:    request,
+	})
+}
+
+// ListApprovalPolicies lists the approval policies
+// @Summary List approval policies
+// @Description List the action types that can need approval with their policy: whether approval is needed, how many approvals, who approves and when requests expire
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]approvals.Policy}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/approval-policies [get]
+func ListApprovalPolicies(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	policies, err := approvals.ListPolicies()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve approval policies")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Approval policies retrieved successfully",
+		Data:    policies,
+	})
+}
+
+// UpdateApprovalPolicy sets the approval policy of an action type
+// @Summary Update approval policy
+// @Description Set whether an action type needs approval, how many approvers besides the requester must approve (1 is dual approval), whether admins or the users of the company approve, and after how many hours requests expire. Pending requests keep the policy they were submitted under
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param actionType path string true "Action type, e.g. batch_recall, ownership_transfer or tenant_export"
+// @Param request body ApprovalPolicyRequest true "Policy"
+// @Success 200 {object} SuccessResponse{data=approvals.Policy}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/approval-policies/{actionType} [put]
+func UpdateApprovalPolicy(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	var req ApprovalPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	policy, err := approvals.SavePolicy(approvals.Policy{
+		ActionType:        c.Params("actionType"),
+		Enabled:           req.Enabled,
+		RequiredApprovals: req.RequiredApprovals,
+		ApproverRole:      req.ApproverRole,
+		ExpiryHours:       req.ExpiryHours,
+	}, userID)
+	if err != nil {
+		return approvalError(err)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Approval policy updated successfully",
+		Data:    policy,
+	})
+}
@@ -0,0 +1,535 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// Statuses of an audit access grant
+const (
+	AuditGrantActive  = "active"
+	AuditGrantExpired = "expired"
+	AuditGrantRevoked = "revoked"
+)
+
+// AuditGrant gives an auditor time-boxed, read-only access to a hatchery's records within a date range
+type AuditGrant struct {
+	ID             int        `json:"id"`
+	AuditorID      int        `json:"auditor_id"`
+	AuditorName    string     `json:"auditor_name"`
+	HatcheryID     int        `json:"hatchery_id"`
+	HatcheryName   string     `json:"hatchery_name"`
+	ScopeStart     time.Time  `json:"scope_start"` // Records dated within the scope are visible
+	ScopeEnd       time.Time  `json:"scope_end"`
+	ExpiresAt      time.Time  `json:"expires_at"` // Access ends automatically at this time
+	Purpose        string     `json:"purpose"`
+	GrantedBy      int        `json:"granted_by"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	Status         string     `json:"status"` // active, expired or revoked
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// AuditGrantRequest represents a request to grant an auditor access
+type AuditGrantRequest struct {
+	AuditorID  int       `json:"auditor_id"`
+	HatcheryID int       `json:"hatchery_id"`
+	ScopeStart time.Time `json:"scope_start"`
+	ScopeEnd   time.Time `json:"scope_end"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Purpose    string    `json:"purpose"`
+}
+
+// AuditWorkspace is the overview of an auditor's workspace for one grant
+type AuditWorkspace struct {
+	Grant         AuditGrant `json:"grant"`
+	BatchCount    int        `json:"batch_count"`
+	DocumentCount int        `json:"document_count"`
+	LogCount      int        `json:"log_count"`
+}
+
+const auditGrantColumns = `
+	g.id, g.auditor_id, COALESCE(NULLIF(a.full_name, ''), a.username, ''), g.hatchery_id, COALESCE(h.name, ''),
+	g.scope_start, g.scope_end, g.expires_at, COALESCE(g.purpose, ''), COALESCE(g.granted_by, 0),
+	g.revoked_at, g.last_accessed_at, g.created_at
+`
+
+const auditGrantFrom = `
+	FROM audit_access_grant g
+	LEFT JOIN account a ON a.id = g.auditor_id
+	LEFT JOIN hatchery h ON h.id = g.hatchery_id
+`
+
+// auditScopeBatches selects the batches of a grant's hatchery that existed during its date range
+const auditScopeBatches = `
+	SELECT id FROM batch
+	WHERE hatchery_id = $1 AND is_active = true AND created_at <= $3 AND updated_at >= $2
+`
+
+// scanAuditGrant reads an audit grant selected with auditGrantColumns
+func scanAuditGrant(row rowScanner) (AuditGrant, error) {
+	var g AuditGrant
+	var revokedAt, lastAccessedAt sql.NullTime
+	err := row.Scan(&g.ID, &g.AuditorID, &g.AuditorName, &g.HatcheryID, &g.HatcheryName,
+		&g.ScopeStart, &g.ScopeEnd, &g.ExpiresAt, &g.Purpose, &g.GrantedBy,
+		&revokedAt, &lastAccessedAt, &g.CreatedAt)
+	g.RevokedAt = timePtr(revokedAt)
+	g.LastAccessedAt = timePtr(lastAccessedAt)
+	g.Status = auditGrantStatus(g, time.Now())
+	return g, err
+}
+
+// auditGrantStatus works out whether a grant still gives access at a point in time
+func auditGrantStatus(g AuditGrant, at time.Time) string {
+	if g.RevokedAt != nil {
+		return AuditGrantRevoked
+	}
+	if !at.Before(g.ExpiresAt) {
+		return AuditGrantExpired
+	}
+	return AuditGrantActive
+}
+
+// loadAuditGrant loads an audit grant
+func loadAuditGrant(grantID int) (AuditGrant, error) {
+	return scanAuditGrant(db.DB.QueryRow(`SELECT `+auditGrantColumns+auditGrantFrom+` WHERE g.id = $1 AND g.is_active = true`, grantID))
+}
+
+// resolveAuditWorkspace loads the grant of a workspace request and checks that it gives the caller access
+// Auditors only see their own grants and only until they expire; admins can open any grant to review it
+func resolveAuditWorkspace(c *fiber.Ctx) (AuditGrant, error) {
+	grantID, err := strconv.Atoi(c.Params("grantId"))
+	if err != nil {
+		return AuditGrant{}, fiber.NewError(fiber.StatusBadRequest, "Invalid audit grant ID format")
+	}
+	grant, err := loadAuditGrant(grantID)
+	if err == sql.ErrNoRows {
+		return grant, fiber.NewError(fiber.StatusNotFound, "Audit grant not found")
+	}
+	if err != nil {
+		return grant, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	role, _ := c.Locals("role").(string)
+	userID, _ := c.Locals("userID").(int)
+	if role == "admin" {
+		return grant, nil
+	}
+	if role != middleware.RoleAuditor || userID != grant.AuditorID {
+		return grant, fiber.NewError(fiber.StatusForbidden, "This audit workspace belongs to another auditor")
+	}
+	if grant.Status != AuditGrantActive {
+		return grant, fiber.NewError(fiber.StatusForbidden, "Audit access is "+grant.Status)
+	}
+
+	if _, err := db.DB.Exec("UPDATE audit_access_grant SET last_accessed_at = NOW() WHERE id = $1", grant.ID); err != nil {
+		return grant, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	return grant, nil
+}
+
+// CreateAuditGrant grants an auditor time-boxed access to a hatchery
+// @Summary Grant auditor access
+// @Description Give an auditor read-only access to a hatchery's batches, documents and logs within a date range until the grant expires
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Param request body AuditGrantRequest true "Audit grant"
+// @Success 201 {object} SuccessResponse{data=AuditGrant}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit/grants [post]
+func CreateAuditGrant(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	var req AuditGrantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.AuditorID <= 0 || req.HatcheryID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Auditor ID and hatchery ID are required")
+	}
+	if req.ScopeStart.IsZero() || req.ScopeEnd.IsZero() || req.ScopeEnd.Before(req.ScopeStart) {
+		return fiber.NewError(fiber.StatusBadRequest, "A scope start and an end on or after it are required")
+	}
+	if !req.ExpiresAt.After(time.Now()) {
+		return fiber.NewError(fiber.StatusBadRequest, "Expiry must be in the future")
+	}
+
+	var auditorRole string
+	err := db.DB.QueryRow("SELECT role FROM account WHERE id = $1 AND is_active = true", req.AuditorID).Scan(&auditorRole)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Auditor not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if auditorRole != middleware.RoleAuditor {
+		return fiber.NewError(fiber.StatusBadRequest, "Audit access can only be granted to auditor accounts")
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM hatchery WHERE id = $1 AND is_active = true)", req.HatcheryID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Hatchery not found")
+	}
+
+	grantedBy, _ := c.Locals("userID").(int)
+	var grantID int
+	err = db.DB.QueryRow(`
+		INSERT INTO audit_access_grant (auditor_id, hatchery_id, scope_start, scope_end, expires_at, purpose,
+			granted_by, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NOW(), NOW(), true)
+		RETURNING id
+	`, req.AuditorID, req.HatcheryID, req.ScopeStart, req.ScopeEnd, req.ExpiresAt, req.Purpose, grantedBy).Scan(&grantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save audit grant")
+	}
+
+	grant, err := loadAuditGrant(grantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Audit grant created but failed to retrieve details")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Audit access granted successfully",
+		Data:    grant,
+	})
+}
+
+// ListAuditGrants lists audit grants
+// @Summary List audit grants
+// @Description List audit access grants, optionally for one auditor or hatchery or with one status
+// @Tags audit
+// @Produce json
+// @Param auditor_id query int false "Auditor ID"
+// @Param hatchery_id query int false "Hatchery ID"
+// @Param status query string false "Status (active, expired, revoked)"
+// @Success 200 {object} SuccessResponse{data=[]AuditGrant}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit/grants [get]
+func ListAuditGrants(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+auditGrantColumns+auditGrantFrom+`
+		WHERE g.is_active = true
+			AND ($1::int = 0 OR g.auditor_id = $1)
+			AND ($2::int = 0 OR g.hatchery_id = $2)
+		ORDER BY g.created_at DESC
+	`, c.QueryInt("auditor_id", 0), c.QueryInt("hatchery_id", 0))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	status := c.Query("status")
+	grants := []AuditGrant{}
+	for rows.Next() {
+		grant, err := scanAuditGrant(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse audit grant")
+		}
+		if status == "" || grant.Status == status {
+			grants = append(grants, grant)
+		}
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Audit grants retrieved successfully",
+		Data:    grants,
+	})
+}
+
+// RevokeAuditGrant ends an audit grant before it expires
+// @Summary Revoke audit grant
+// @Description Revoke an auditor's access before the grant expires
+// @Tags audit
+// @Produce json
+// @Param grantId path int true "Audit grant ID"
+// @Success 200 {object} SuccessResponse{data=AuditGrant}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit/grants/{grantId} [delete]
+func RevokeAuditGrant(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	grantID, err := strconv.Atoi(c.Params("grantId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid audit grant ID format")
+	}
+
+	revokedBy, _ := c.Locals("userID").(int)
+	result, err := db.DB.Exec(`
+		UPDATE audit_access_grant
+		SET revoked_at = NOW(), revoked_by = NULLIF($1, 0), updated_at = NOW()
+		WHERE id = $2 AND is_active = true AND revoked_at IS NULL
+	`, revokedBy, grantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Audit grant not found or already revoked")
+	}
+
+	grant, err := loadAuditGrant(grantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Audit grant revoked but failed to retrieve details")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Audit access revoked successfully",
+		Data:    grant,
+	})
+}
+
+// GetMyAuditGrants lists the grants of the signed-in auditor that still give access
+// @Summary List my audit workspaces
+// @Description List the active audit grants of the signed-in auditor
+// @Tags audit
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]AuditGrant}
+// @Failure 500 {object} ErrorResponse
+// @Router /audit/workspace [get]
+func GetMyAuditGrants(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(int)
+
+	rows, err := db.DB.Query(`SELECT `+auditGrantColumns+auditGrantFrom+`
+		WHERE g.auditor_id = $1 AND g.is_active = true AND g.revoked_at IS NULL AND g.expires_at > NOW()
+		ORDER BY g.expires_at
+	`, userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	grants := []AuditGrant{}
+	for rows.Next() {
+		grant, err := scanAuditGrant(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse audit grant")
+		}
+		grants = append(grants, grant)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Audit workspaces retrieved successfully",
+		Data:    grants,
+	})
+}
+
+// GetAuditWorkspace gets the overview of an audit workspace
+// @Summary Get audit workspace
+// @Description Get an audit grant with the number of batches, documents and logs in its scope
+// @Tags audit
+// @Produce json
+// @Param grantId path int true "Audit grant ID"
+// @Success 200 {object} SuccessResponse{data=AuditWorkspace}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit/workspace/{grantId} [get]
+func GetAuditWorkspace(c *fiber.Ctx) error {
+	grant, err := resolveAuditWorkspace(c)
+	if err != nil {
+		return err
+	}
+
+	workspace := AuditWorkspace{Grant: grant}
+	err = db.DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM batch WHERE id IN (`+auditScopeBatches+`)),
+			(SELECT COUNT(*) FROM document WHERE is_active = true AND uploaded_at BETWEEN $2 AND $3
+				AND batch_id IN (`+auditScopeBatches+`)),
+			(SELECT COUNT(*) FROM event WHERE is_active = true AND timestamp BETWEEN $2 AND $3
+				AND batch_id IN (`+auditScopeBatches+`))
+	`, grant.HatcheryID, grant.ScopeStart, grant.ScopeEnd).Scan(&workspace.BatchCount, &workspace.DocumentCount, &workspace.LogCount)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Audit workspace retrieved successfully",
+		Data:    workspace,
+	})
+}
+
+// GetAuditWorkspaceBatches lists the batches in the scope of an audit grant
+// @Summary List audit batches
+// @Description List the batches of the audited hatchery that existed during the audit date range
+// @Tags audit
+// @Produce json
+// @Param grantId path int true "Audit grant ID"
+// @Success 200 {object} SuccessResponse{data=[]models.Batch}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit/workspace/{grantId}/batches [get]
+func GetAuditWorkspaceBatches(c *fiber.Ctx) error {
+	grant, err := resolveAuditWorkspace(c)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, hatchery_id, COALESCE(species, ''), COALESCE(quantity, 0), COALESCE(status, ''), strain_id,
+			created_at, updated_at, is_active
+		FROM batch
+		WHERE id IN (`+auditScopeBatches+`)
+		ORDER BY created_at
+	`, grant.HatcheryID, grant.ScopeStart, grant.ScopeEnd)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	batches := []models.Batch{}
+	for rows.Next() {
+		var b models.Batch
+		var strainID sql.NullInt64
+		if err := rows.Scan(&b.ID, &b.HatcheryID, &b.Species, &b.Quantity, &b.Status, &strainID,
+			&b.CreatedAt, &b.UpdatedAt, &b.IsActive); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse batch")
+		}
+		b.StrainID = intPtr(strainID)
+		batches = append(batches, b)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Audit batches retrieved successfully",
+		Data:    batches,
+	})
+}
+
+// GetAuditWorkspaceDocuments lists the documents in the scope of an audit grant
+// @Summary List audit documents
+// @Description List the documents of in-scope batches uploaded during the audit date range
+// @Tags audit
+// @Produce json
+// @Param grantId path int true "Audit grant ID"
+// @Success 200 {object} SuccessResponse{data=[]models.Document}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit/workspace/{grantId}/documents [get]
+func GetAuditWorkspaceDocuments(c *fiber.Ctx) error {
+	grant, err := resolveAuditWorkspace(c)
+	if err != nil {
+		return err
+	}
+
+	// The grant makes the caller an auditor of every batch in scope
+	docLevels, err := relationDocumentLevels(c, RelationAuditor)
+	if err != nil {
+		return err
+	}
+	rows, err := db.DB.Query(`
+		SELECT id, COALESCE(batch_id, 0), COALESCE(doc_type, ''), COALESCE(ipfs_hash, ''), COALESCE(ipfs_uri, ''),
+			COALESCE(file_name, ''), COALESCE(file_size, 0), COALESCE(uploaded_by, 0), uploaded_at, updated_at, is_active, sensitivity
+		FROM document
+		WHERE is_active = true AND uploaded_at BETWEEN $2 AND $3 AND batch_id IN (`+auditScopeBatches+`)`+documentSensitivityFilter("", 4)+`
+		ORDER BY uploaded_at
+	`, grant.HatcheryID, grant.ScopeStart, grant.ScopeEnd, docLevels)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	documents := []models.Document{}
+	for rows.Next() {
+		var d models.Document
+		if err := rows.Scan(&d.ID, &d.BatchID, &d.DocType, &d.IPFSHash, &d.IPFSURI,
+			&d.FileName, &d.FileSize, &d.UploadedBy, &d.UploadedAt, &d.UpdatedAt, &d.IsActive, &d.Sensitivity); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse document")
+		}
+		documents = append(documents, d)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Audit documents retrieved successfully",
+		Data:    documents,
+	})
+}
+
+// GetAuditWorkspaceLogs lists the event log entries in the scope of an audit grant
+// @Summary List audit logs
+// @Description List the events of in-scope batches recorded during the audit date range, oldest first
+// @Tags audit
+// @Produce json
+// @Param grantId path int true "Audit grant ID"
+// @Param event_type query string false "Event type"
+// @Success 200 {object} SuccessResponse{data=[]models.Event}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit/workspace/{grantId}/logs [get]
+func GetAuditWorkspaceLogs(c *fiber.Ctx) error {
+	grant, err := resolveAuditWorkspace(c)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, batch_id, event_type, COALESCE(actor_id, 0), COALESCE(location, ''), timestamp,
+			COALESCE(metadata, '{}'), updated_at, is_active
+		FROM event
+		WHERE is_active = true AND timestamp BETWEEN $2 AND $3 AND batch_id IN (`+auditScopeBatches+`)
+			AND ($4::text = '' OR event_type = $4)
+		ORDER BY timestamp, id
+	`, grant.HatcheryID, grant.ScopeStart, grant.ScopeEnd, c.Query("event_type"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	events := []models.Event{}
+	for rows.Next() {
+		var e models.Event
+		if err := rows.Scan(&e.ID, &e.BatchID, &e.EventType, &e.ActorID, &e.Location, &e.Timestamp,
+			&e.Metadata, &e.UpdatedAt, &e.IsActive); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse event")
+		}
+		events = append(events, e)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Audit logs retrieved successfully",
+		Data:    events,
+	})
+}
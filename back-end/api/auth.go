@@ -12,11 +12,12 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
-	"github.com/LTPPPP/TracePost-larvaeChain/components"
 	"github.com/LTPPPP/TracePost-larvaeChain/config"
 	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/mailer"
 	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
 	"github.com/LTPPPP/TracePost-larvaeChain/models"
+	"github.com/LTPPPP/TracePost-larvaeChain/signing"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -191,8 +192,8 @@ func Register(c *fiber.Ctx) error {
 		}
 	}
 
-	// Validate company_id only for non-consumer roles
-	if strings.ToLower(req.Role) != "consumer" && req.CompanyID == "" {
+	// Validate company_id only for non-consumer roles; third-party auditors belong to no company
+	if strings.ToLower(req.Role) != "consumer" && req.Role != middleware.RoleAuditor && req.CompanyID == "" {
 		return fiber.NewError(fiber.StatusBadRequest, "Company ID is required for this role")
 	}
 
@@ -270,12 +271,10 @@ func generateJWTToken(user models.User) (string, int, error) {
 	// Get configuration
 	cfg := config.GetConfig()
 	
-	// Get JWT secret with fallback
-	secretKey, err := config.GetJWTSecret()
+	// Get the active token signing key; its kid lets other services pick the key from the JWKS
+	key, err := signing.Default().Current(signing.PurposeToken)
 	if err != nil {
-		// Log error and use default
-		fmt.Printf("Error loading JWT secret: %v, using default value\n", err)
-		secretKey = cfg.JWTSecret
+		return "", 0, err
 	}
 	
 	// Set expiration time based on config (hours)
@@ -298,10 +297,10 @@ func generateJWTToken(user models.User) (string, int, error) {
 		},
 	}
 
-	// Create token with HMAC-SHA256 signing method (more secure than default)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	// Sign token with secret key from config
-	signedToken, err := token.SignedString([]byte(secretKey))
+	// Create token with RSA-SHA256 so it can be verified with the published public key
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.KID
+	signedToken, err := token.SignedString(key.Signer())
 	if err != nil {
 		return "", 0, err
 	}
@@ -715,20 +714,7 @@ func Logout(c *fiber.Ctx) error {
 	// Extract token
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		// Parse token to get claims
-	token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Get configuration
-		cfg := config.GetConfig()
-		
-		// Get JWT secret with fallback
-		secretKey, err := config.GetJWTSecret()
-		if err != nil {
-			// Log error and use default
-			fmt.Printf("Error loading JWT secret: %v, using default value\n", err)
-			secretKey = cfg.JWTSecret
-		}
-		
-		return []byte(secretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, middleware.TokenKeyFunc)
 	
 	// If token is valid, add it to blacklist
 	if err == nil && token.Valid {
@@ -761,9 +747,6 @@ func Logout(c *fiber.Ctx) error {
 // @Failure 401 {object} ErrorResponse
 // @Router /auth/refresh [post]
 func RefreshToken(c *fiber.Ctx) error {
-	// Get configuration
-	cfg := config.GetConfig()
-	
 	// Parse request body
 	var req RefreshTokenRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -776,22 +759,7 @@ func RefreshToken(c *fiber.Ctx) error {
 	}
 	
 	// Parse the token to get claims
-	token, err := jwt.ParseWithClaims(req.AccessToken, &models.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		
-			// Get JWT secret with fallback
-		secretKey, err := config.GetJWTSecret()
-		if err != nil {
-			// Log error and use default
-			fmt.Printf("Error loading JWT secret: %v, using default value\n", err)
-			secretKey = cfg.JWTSecret
-		}
-		
-		return []byte(secretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(req.AccessToken, &models.JWTClaims{}, middleware.TokenKeyFunc)
 	
 	if err != nil {
 		// Only allow refresh for expired tokens, not for invalid tokens
@@ -885,12 +853,17 @@ func ForgotPassword(c *fiber.Ctx) error {
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to store OTP")
 	}
-	// Send OTP via email
-	subject := "Your OTP for Password Reset"
-	body := fmt.Sprintf("Your OTP code is: %s\nIt expires in 10 minutes.", otp)
-	err = components.SendEmail(req.Email, subject, body)
+	// Send OTP via email, in the user's language when they saved one
+	lang := LoadPreferredLanguage(userID)
+	if lang == "" {
+		lang, _ = c.Locals("lang").(string)
+	}
+	err = mailer.Send(req.Email, mailer.TemplatePasswordReset, lang, map[string]interface{}{
+		"Code":    otp,
+		"Minutes": int(expiry.Minutes()),
+	})
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to send OTP email")
+		return dependencyUnavailable("Failed to send OTP email", nil)
 	}
 	return c.JSON(SuccessResponse{Success: true, Message: "OTP sent to email"})
 }
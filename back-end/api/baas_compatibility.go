@@ -0,0 +1,49 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+)
+
+// BaaSCompatibilityReport is the compatibility of the BaaS provider responses with the shapes the service relies on
+type BaaSCompatibilityReport struct {
+	Compatible   int                                `json:"compatible"`
+	Incompatible int                                `json:"incompatible"`
+	Untested     int                                `json:"untested"`
+	Matrix       []blockchain.ContractCompatibility `json:"matrix"`
+	Contracts    []blockchain.ResponseContract      `json:"contracts"`
+}
+
+// GetBaaSCompatibility reports the BaaS provider compatibility matrix
+// @Summary Get BaaS provider compatibility
+// @Description For each provider operation and chain family, check the recorded provider response against its contract and report the live responses that violated it since the server started
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=BaaSCompatibilityReport}
+// @Failure 403 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/baas/compatibility [get]
+func GetBaaSCompatibility(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	report := BaaSCompatibilityReport{Matrix: blockchain.CompatibilityMatrix(), Contracts: blockchain.BaaSContracts}
+	for _, cell := range report.Matrix {
+		switch cell.Status {
+		case blockchain.CompatibilityCompatible:
+			report.Compatible++
+		case blockchain.CompatibilityIncompatible:
+			report.Incompatible++
+		default:
+			report.Untested++
+		}
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "BaaS compatibility retrieved successfully",
+		Data:    report,
+	})
+}
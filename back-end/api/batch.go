@@ -5,13 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/skip2/go-qrcode"
+	"github.com/LTPPPP/TracePost-larvaeChain/actors"
 	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/chainsync"
+	"github.com/LTPPPP/TracePost-larvaeChain/datamigration"
 	"github.com/LTPPPP/TracePost-larvaeChain/db"
 	"github.com/LTPPPP/TracePost-larvaeChain/dto"
+	"github.com/LTPPPP/TracePost-larvaeChain/eventbus"
 	"github.com/LTPPPP/TracePost-larvaeChain/models"
 )
 
@@ -20,6 +25,7 @@ type CreateBatchRequest struct {
 	HatcheryID int    `json:"hatchery_id"`
 	Species    string `json:"species"`
 	Quantity   int    `json:"quantity"`
+	StrainID   int    `json:"strain_id"` // Optional genetic strain
 }
 
 // UpdateBatchStatusRequest represents a request to update a batch status
@@ -29,14 +35,36 @@ type UpdateBatchStatusRequest struct {
 
 // GetAllBatches returns all batches
 // @Summary Get all batches
-// @Description Retrieve all shrimp larvae batches
+// @Description Retrieve all shrimp larvae batches, optionally filtered directly or by a saved view. Filters given with a view override those of the view
 // @Tags batches
 // @Accept json
 // @Produce json
+// @Param view query int false "Saved batch view ID"
+// @Param status query string false "Comma-separated statuses"
+// @Param species query string false "Species"
+// @Param hatchery_id query int false "Hatchery ID"
+// @Param company_id query int false "Company ID"
+// @Param created_from query string false "Created on or after (YYYY-MM-DD)"
+// @Param created_to query string false "Created on or before (YYYY-MM-DD)"
+// @Param has_certificate query string false "Has a valid certificate of this type"
+// @Param missing_certificate query string false "Has no valid certificate of this type"
 // @Success 200 {object} SuccessResponse{data=[]models.Batch}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /batches [get]
 func GetAllBatches(c *fiber.Ctx) error {
+	params, err := batchListParams(c)
+	if err != nil {
+		return err
+	}
+	filter, err := parseBatchListFilter(params)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	args := []interface{}{}
+	conditions := filter.where(&args)
+
 	// Query batches from database with hatchery and company information
 	rows, err := db.DB.Query(`
 		SELECT 
@@ -46,9 +74,9 @@ func GetAllBatches(c *fiber.Ctx) error {
 		FROM batch b
 		INNER JOIN hatchery h ON b.hatchery_id = h.id AND h.is_active = true
 		INNER JOIN company c ON h.company_id = c.id AND c.is_active = true 
-		WHERE b.is_active = true
+		WHERE b.is_active = true`+conditions+`
 		ORDER BY b.created_at DESC
-	`)
+	`, args...)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
 	}
@@ -93,6 +121,7 @@ func GetAllBatches(c *fiber.Ctx) error {
 		batch.Hatchery = hatchery
 		batches = append(batches, batch)
 	}
+	attachCompleteness(batches)
 
 	// Return success response
 	return c.JSON(SuccessResponse{
@@ -129,9 +158,10 @@ func GetBatchByID(c *fiber.Ctx) error {
 	var batch models.Batch
 	var hatchery models.Hatchery
 	var company models.Company
+	var strainID sql.NullInt64
 	query := `
 		SELECT 
-			b.id, b.hatchery_id, b.species, b.quantity, b.status, b.created_at, b.updated_at, b.is_active,
+			b.id, b.hatchery_id, b.species, b.quantity, b.status, b.strain_id, b.created_at, b.updated_at, b.is_active,
 			h.id, h.name, h.company_id, h.created_at, h.updated_at, h.is_active,
 			c.id, c.name, c.type, c.location, c.contact_info, c.created_at, c.updated_at, c.is_active
 		FROM batch b
@@ -145,6 +175,7 @@ func GetBatchByID(c *fiber.Ctx) error {
 		&batch.Species,
 		&batch.Quantity,
 		&batch.Status,
+		&strainID,
 		&batch.CreatedAt,
 		&batch.UpdatedAt,
 		&batch.IsActive,
@@ -173,6 +204,7 @@ func GetBatchByID(c *fiber.Ctx) error {
 	// Set relationships
 	hatchery.Company = company
 	batch.Hatchery = hatchery
+	batch.StrainID = intPtr(strainID)
 
 	// Return success response
 	return c.JSON(SuccessResponse{
@@ -189,6 +221,7 @@ func GetBatchByID(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param request body CreateBatchRequest true "Batch creation details"
+// @Param dry_run query bool false "Only validate and describe what would happen, without writing to the database, IPFS or the chain"
 // @Success 201 {object} SuccessResponse{data=models.Batch}
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -214,6 +247,11 @@ func CreateBatch(c *fiber.Ctx) error {
 	if !exists {
 		return fiber.NewError(fiber.StatusBadRequest, "Hatchery not found")
 	}
+	if req.StrainID > 0 {
+		if _, err := loadStrain(req.StrainID); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Strain not found")
+		}
+	}
 
 	// Initialize blockchain client with more robust configuration
 	blockchainClient := blockchain.NewBlockchainClient(
@@ -255,6 +293,30 @@ func CreateBatch(c *fiber.Ctx) error {
 	}
 	hatchery.Company = company
 
+	if isDryRun(c) {
+		preview := models.Batch{
+			HatcheryID: req.HatcheryID,
+			Species:    req.Species,
+			Quantity:   req.Quantity,
+			Status:     "created",
+			IsActive:   true,
+			Hatchery:   hatchery,
+		}
+		if req.StrainID > 0 {
+			preview.StrainID = &req.StrainID
+		}
+		return dryRunResponse(c, "Dry run: the batch would be created", DryRunResult{
+			Action: "create_batch",
+			Record: preview,
+			Effects: []string{
+				"Insert the batch with status created",
+				"Submit CREATE_BATCH and BATCH_DATA_EXTENDED transactions to the blockchain",
+				"Record a batch_created event",
+				"Publish a batch created domain event",
+			},
+		})
+	}
+
 	// Begin database transaction to ensure data consistency
 	tx, err := db.DB.Begin()
 	if err != nil {
@@ -268,8 +330,8 @@ func CreateBatch(c *fiber.Ctx) error {
 
 	// Insert batch into database
 	query := `
-		INSERT INTO batch (hatchery_id, species, quantity, status, created_at, updated_at, is_active)
-		VALUES ($1, $2, $3, $4, NOW(), NOW(), true)
+		INSERT INTO batch (hatchery_id, species, quantity, status, strain_id, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), NOW(), NOW(), true)
 		RETURNING id, created_at, updated_at
 	`
 	var batch models.Batch
@@ -277,6 +339,9 @@ func CreateBatch(c *fiber.Ctx) error {
 	batch.Species = req.Species
 	batch.Quantity = req.Quantity
 	batch.Status = "created"
+	if req.StrainID > 0 {
+		batch.StrainID = &req.StrainID
+	}
 	batch.IsActive = true
 	batch.Hatchery = hatchery
 
@@ -286,6 +351,7 @@ func CreateBatch(c *fiber.Ctx) error {
 		batch.Species,
 		batch.Quantity,
 		batch.Status,
+		req.StrainID,
 	).Scan(&batch.ID, &batch.CreatedAt, &batch.UpdatedAt)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save batch to database")
@@ -377,11 +443,24 @@ func CreateBatch(c *fiber.Ctx) error {
 		fmt.Printf("Warning: Failed to record batch creation event: %v\n", err)
 	}
 
+	// Keep the quantity ledger in step while it is being rolled out
+	datamigration.DualWrite(tx, datamigration.BatchQuantityLedger, batch.ID)
+
 	// Commit transaction
 	if err = tx.Commit(); err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit database transaction")
 	}
 
+	if !blockchainSuccess {
+		notifyAnchoringFailed(hatchery.CompanyID, "batch", batch.ID, batch.ID, strings.Join(blockchainErrors, "; "))
+	}
+	publishDomainEvent(eventbus.BatchCreated, hatchery.CompanyID, batch.ID, map[string]interface{}{
+		"hatchery_id": batch.HatcheryID,
+		"species":     batch.Species,
+		"quantity":    batch.Quantity,
+		"status":      batch.Status,
+	})
+
 	// Return success response
 	responseData := map[string]interface{}{
 		"batch": batch,
@@ -619,6 +698,13 @@ func UpdateBatchStatus(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit database transaction")
 	}
 
+	// Push the status change to chains the batch was shared with
+	chainsync.NotifyBatch(batchID)
+	publishBatchStatusChanged(batchID, batch.Status, req.Status, "batch_status_update")
+	if !blockchainSuccess {
+		notifyAnchoringFailed(company.ID, "batch_status", batchID, batchID, strings.Join(blockchainErrors, "; "))
+	}
+
 	// Prepare response
 	responseData := map[string]interface{}{
 		"batch_id":      batchID,
@@ -709,7 +795,17 @@ func GenerateBatchQRCode(c *fiber.Ctx) error {
 	case "trace":
 		// Create a web-friendly traceability URL
 		// This should point to the frontend app that will display the traceability data
-		baseURL := c.Query("baseURL", "https://trace.viechain.com")
+		// Companies with a verified white-label domain get it by default
+		defaultBaseURL := "https://trace.viechain.com"
+		var companyID int
+		if err := db.DB.QueryRow(`
+			SELECT h.company_id FROM batch b JOIN hatchery h ON b.hatchery_id = h.id WHERE b.id = $1
+		`, batchID).Scan(&companyID); err == nil {
+			if traceURL := companyTraceBaseURL(companyID); traceURL != "" {
+				defaultBaseURL = traceURL
+			}
+		}
+		baseURL := c.Query("baseURL", defaultBaseURL)
 		qrData = fmt.Sprintf("%s/trace/%d", baseURL, batchID)
 	}
 
@@ -730,12 +826,12 @@ func GenerateBatchQRCode(c *fiber.Ctx) error {
 
 // GetBatchEvents returns all events for a batch
 // @Summary Get batch events
-// @Description Retrieve all events for a shrimp larvae batch
+// @Description Retrieve all events for a shrimp larvae batch with the name, role and DID of their actors
 // @Tags batches
 // @Accept json
 // @Produce json
 // @Param batchId path string true "Batch ID"
-// @Success 200 {object} SuccessResponse{data=[]models.Event}
+// @Success 200 {object} SuccessResponse{data=[]models.EventWithActor}
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -764,7 +860,8 @@ func GetBatchEvents(c *fiber.Ctx) error {
 
 	// Query events from database
 	rows, err := db.DB.Query(`
-		SELECT id, batch_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active
+		SELECT id, batch_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active,
+			supersedes_event_id, superseded_by_event_id, COALESCE(correction_reason, ''), corrected_at
 		FROM event
 		WHERE batch_id = $1 AND is_active = true
 		ORDER BY timestamp DESC
@@ -775,9 +872,11 @@ func GetBatchEvents(c *fiber.Ctx) error {
 	defer rows.Close()
 
 	// Parse events
-	var events []models.Event
+	var events []models.EventWithActor
 	for rows.Next() {
-		var event models.Event
+		var event models.EventWithActor
+		var supersedes, supersededBy sql.NullInt64
+		var correctedAt sql.NullTime
 		err := rows.Scan(
 			&event.ID,
 			&event.BatchID,
@@ -788,12 +887,23 @@ func GetBatchEvents(c *fiber.Ctx) error {
 			&event.Metadata,
 			&event.UpdatedAt,
 			&event.IsActive,
+			&supersedes,
+			&supersededBy,
+			&event.CorrectionReason,
+			&correctedAt,
 		)
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse event data")
 		}
+		event.SupersedesEventID = intPtr(supersedes)
+		event.SupersededByEventID = intPtr(supersededBy)
+		event.Corrected = supersededBy.Valid
+		event.CorrectedAt = timePtr(correctedAt)
 		events = append(events, event)
 	}
+	if err := resolveEventActors(events); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to resolve event actors")
+	}
 
 	// Return success response
 	return c.JSON(SuccessResponse{
@@ -805,7 +915,7 @@ func GetBatchEvents(c *fiber.Ctx) error {
 
 // GetBatchDocuments returns all documents for a batch
 // @Summary Get batch documents
-// @Description Retrieve all documents for a shrimp larvae batch
+// @Description Retrieve all documents for a shrimp larvae batch, including translated versions linked to their original through translation_of
 // @Tags batches
 // @Accept json
 // @Produce json
@@ -837,13 +947,19 @@ func GetBatchDocuments(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
 	}
 
+	// Only documents whose sensitivity the caller's relationship to the batch allows
+	levels, err := visibleBatchDocumentLevels(c, batchID)
+	if err != nil {
+		return err
+	}
+
 	// Query documents from database
 	rows, err := db.DB.Query(`
-		SELECT id, batch_id, doc_type, ipfs_hash, uploaded_by, uploaded_at, updated_at, is_active
+		SELECT id, batch_id, doc_type, ipfs_hash, COALESCE(uploaded_by, 0), COALESCE(language, ''), translation_of, uploaded_at, updated_at, is_active, sensitivity
 		FROM document
-		WHERE batch_id = $1 AND is_active = true
+		WHERE batch_id = $1 AND is_active = true`+documentSensitivityFilter("", 2)+`
 		ORDER BY uploaded_at DESC
-	`, batchID)
+	`, batchID, levels)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
 	}
@@ -853,19 +969,24 @@ func GetBatchDocuments(c *fiber.Ctx) error {
 	var documents []models.Document
 	for rows.Next() {
 		var doc models.Document
+		var translationOf sql.NullInt64
 		err := rows.Scan(
 			&doc.ID,
 			&doc.BatchID,
 			&doc.DocType,
 			&doc.IPFSHash,
 			&doc.UploadedBy,
+			&doc.Language,
+			&translationOf,
 			&doc.UploadedAt,
 			&doc.UpdatedAt,
 			&doc.IsActive,
+			&doc.Sensitivity,
 		)
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse document data")
 		}
+		doc.TranslationOf = intPtr(translationOf)
 		documents = append(documents, doc)
 	}
 
@@ -914,7 +1035,8 @@ func GetBatchEnvironmentData(c *fiber.Ctx) error {
 	// Query environment data from database with related information
 	rows, err := db.DB.Query(`
 		SELECT 
-			e.id, e.batch_id, e.temperature, e.pH, e.salinity, e.density, e.age, e.timestamp, e.updated_at, e.is_active,
+			e.id, e.batch_id, e.temperature, e.pH, e.salinity, e.density, e.age, COALESCE(e.custom_parameters, '{}'),
+			e.device_id, COALESCE(e.low_confidence, false), e.timestamp, e.updated_at, e.is_active,
 			b.species, b.quantity, b.status,
 			h.name AS hatchery_name, 
 			c.name AS company_name, c.location AS company_location,
@@ -935,6 +1057,13 @@ func GetBatchEnvironmentData(c *fiber.Ctx) error {
 	}
 	defer rows.Close()
 
+	// Optimal ranges to place each value in
+	catalog, err := environmentCatalog()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment parameters")
+	}
+	var profiles []EnvironmentProfile
+
 	// Parse environment data
 	var envDataList []map[string]interface{}
 	for rows.Next() {
@@ -943,6 +1072,8 @@ func GetBatchEnvironmentData(c *fiber.Ctx) error {
 			species, status, hatcheryName, companyName, companyLocation, recordedBy string
 			blockchainTxID, blockchainMetadata sql.NullString
 			quantity int
+			customParameters []byte
+			deviceID sql.NullInt64
 		)
 		err := rows.Scan(
 			&envData.ID,
@@ -952,6 +1083,9 @@ func GetBatchEnvironmentData(c *fiber.Ctx) error {
 			&envData.Salinity,
 			&envData.Density,
 			&envData.Age,
+			&customParameters,
+			&deviceID,
+			&envData.LowConfidence,
 			&envData.Timestamp,
 			&envData.UpdatedAt,
 			&envData.IsActive,
@@ -978,6 +1112,9 @@ func GetBatchEnvironmentData(c *fiber.Ctx) error {
 				"salinity":   envData.Salinity,
 				"density":    envData.Density,
 				"age":        envData.Age,
+				"parameters": decodeEnvironmentParameters(customParameters),
+				"device_id":      intPtr(deviceID),
+				"low_confidence": envData.LowConfidence,
 				"timestamp":  envData.Timestamp,
 				"updated_at": envData.UpdatedAt,
 				"is_active":  envData.IsActive,
@@ -998,6 +1135,16 @@ func GetBatchEnvironmentData(c *fiber.Ctx) error {
 			},
 		}
 
+		// Every reading is of the same batch, so the profiles of its species are loaded once
+		if profiles == nil {
+			if profiles, err = loadEnvironmentProfiles(species); err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment profiles")
+			}
+		}
+		envData.Parameters = decodeEnvironmentParameters(customParameters)
+		annotateEnvironmentRanges(&envData, species, catalog, profiles)
+		addEnvironmentRangeFields(envDataEntry["environment_data"].(map[string]interface{}), envData)
+
 		// Add blockchain verification if available
 		if blockchainTxID.Valid {
 			envDataEntry["blockchain_verification"] = map[string]interface{}{
@@ -1070,6 +1217,7 @@ func GetBatchHistory(c *fiber.Ctx) error {
 	// Get blockchain records from database
 	rows, err := db.DB.Query(`
 		SELECT br.id, br.tx_id, br.metadata_hash, br.created_at,
+		       COALESCE(br.confirmation_status, 'pending'), COALESCE(br.confirmations, 0), br.block_number,
 		       CASE 
 		           WHEN e.id IS NOT NULL THEN json_build_object('event_id', e.id, 'event_type', e.event_type, 'timestamp', e.timestamp)
 		           ELSE NULL
@@ -1097,8 +1245,10 @@ func GetBatchHistory(c *fiber.Ctx) error {
 		var txID, metadataHash string
 		var createdAt time.Time
 		var eventData sql.NullString
+		var confirmation BlockchainConfirmation
 		
-		if err := rows.Scan(&id, &txID, &metadataHash, &createdAt, &eventData); err != nil {
+		if err := rows.Scan(&id, &txID, &metadataHash, &createdAt,
+			&confirmation.Status, &confirmation.Confirmations, &confirmation.BlockNumber, &eventData); err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse blockchain record")
 		}
 		
@@ -1107,6 +1257,7 @@ func GetBatchHistory(c *fiber.Ctx) error {
 			"tx_id":         txID,
 			"metadata_hash": metadataHash,
 			"created_at":    createdAt,
+			"confirmation":  confirmation.toMap(),
 		}
 		
 		if eventData.Valid && eventData.String != "null" {
@@ -1277,6 +1428,7 @@ func GetBatchQRCode(c *fiber.Ctx) error {
 		defer rows.Close()
 		
 		var transfers []map[string]interface{}
+		var parties [][2]int
 		for rows.Next() {
 			var transferID string
 			var senderID, receiverID int
@@ -1294,29 +1446,27 @@ func GetBatchQRCode(c *fiber.Ctx) error {
 			)
 			
 			if err == nil {
-				// Get sender and receiver names if possible
-				var senderName, receiverName string
-				_ = db.DB.QueryRow("SELECT username FROM account WHERE id = $1", senderID).Scan(&senderName)
-				_ = db.DB.QueryRow("SELECT username FROM account WHERE id = $1", receiverID).Scan(&receiverName)
-				
-				if senderName == "" {
-					senderName = fmt.Sprintf("User ID: %d", senderID)
-				}
-				if receiverName == "" {
-					receiverName = fmt.Sprintf("User ID: %d", receiverID)
-				}
-				
 				transfers = append(transfers, map[string]interface{}{
 					"transfer_id":       transferID,
-					"source":            senderName,
-					"destination":       receiverName,
 					"transferred_at":    transferredAt.Format(time.RFC3339),
 					"status":            status,
 					"blockchain_verified": blockchainTxID.Valid,
 				})
+				parties = append(parties, [2]int{senderID, receiverID})
 			}
 		}
 		
+		// Get sender and receiver names of all transfers at once, if possible
+		var accountIDs []int
+		for _, p := range parties {
+			accountIDs = append(accountIDs, p[0], p[1])
+		}
+		resolvedActors, _ := actors.Default().Accounts(accountIDs)
+		for i, transfer := range transfers {
+			transfer["source"] = actorUsername(resolvedActors, parties[i][0], "")
+			transfer["destination"] = actorUsername(resolvedActors, parties[i][1], "")
+		}
+		
 		if len(transfers) > 0 {
 			qrData["transfer_history"] = transfers
 		}
@@ -1424,7 +1574,7 @@ func GetBatchBlockchainData(c *fiber.Ctx) error {
 	// Get blockchain data for the batch
 	blockchainData, err := blockchainClient.GetBatchBlockchainData(batchIDStr)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Failed to retrieve blockchain data: %v", err))
+		return blockchainFailure("Failed to retrieve blockchain data", err)
 	}
 	
 	// Extract transactions from blockchain data
@@ -1666,7 +1816,7 @@ func GetBatchFromBlockchain(c *fiber.Ctx) error {
 	// Get batch data from the blockchain
 	blockchainData, err := blockchainClient.GetBatchBlockchainData(batchIDStr)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Failed to get blockchain data: %v", err))
+		return blockchainFailure("Failed to get blockchain data", err)
 	}
 	
 	// Get extra verification information
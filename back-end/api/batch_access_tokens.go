@@ -0,0 +1,881 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/eventbus"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+)
+
+// Operations a batch access token can be scoped to. Tokens to upload a requested document are only issued
+// with a document request
+const (
+	BatchAccessUploadHealthCert        = "upload_health_cert"
+	BatchAccessConfirmReceipt          = "confirm_receipt"
+	BatchAccessUploadRequestedDocument = "upload_requested_document"
+)
+
+// Operations recorded in the audit trail of a batch access token besides its scopes
+const (
+	batchAccessIssue        = "issue"
+	batchAccessRevoke       = "revoke"
+	batchAccessAuthenticate = "authenticate"
+	batchAccessViewBatch    = "view_batch"
+)
+
+// Outcomes of an audited batch access token operation
+const (
+	BatchAccessAllowed = "allowed"
+	BatchAccessDenied  = "denied"
+	BatchAccessFailed  = "failed"
+)
+
+// EventTypeReceiptConfirmed is the batch event recorded when a supplier confirms receipt through an access token
+const EventTypeReceiptConfirmed = "receipt_confirmed"
+
+// Lifetime of batch access tokens: the default when no expiry is given and the longest allowed
+const (
+	defaultBatchAccessLifetime = 7 * 24 * time.Hour
+	maxBatchAccessLifetime     = 30 * 24 * time.Hour
+)
+
+// BatchAccessToken lets a supplier without an account perform a few operations on one batch
+type BatchAccessToken struct {
+	ID            int        `json:"id"`
+	BatchID       int        `json:"batch_id"`
+	CompanyID     *int       `json:"company_id,omitempty"` // Batch owner that issued the token
+	SupplierName  string     `json:"supplier_name"`
+	SupplierEmail string     `json:"supplier_email,omitempty"`
+	Scopes        []string   `json:"scopes"`
+	TokenPrefix   string     `json:"token_prefix"`    // First characters of the token, to tell tokens apart
+	Token         string     `json:"token,omitempty"` // Only returned when the token is issued
+	ExpiresAt     time.Time  `json:"expires_at"`
+	MaxUses       *int       `json:"max_uses,omitempty"` // Operations the token can perform, unlimited when empty
+	UseCount      int        `json:"use_count"`
+	Status        string     `json:"status"` // active, expired, used_up or revoked
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy     *int       `json:"revoked_by,omitempty"`
+	CreatedBy     *int       `json:"created_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// BatchAccessTokenRequest represents a request to issue a batch access token to a supplier
+type BatchAccessTokenRequest struct {
+	SupplierName  string     `json:"supplier_name"`
+	SupplierEmail string     `json:"supplier_email"`
+	Scopes        []string   `json:"scopes"`     // upload_health_cert and/or confirm_receipt
+	ExpiresAt     *time.Time `json:"expires_at"` // At most 30 days ahead; 7 days when empty
+	MaxUses       int        `json:"max_uses"`   // 0 for unlimited
+}
+
+// BatchAccessTokenAudit is one operation attempted with a batch access token or on it
+type BatchAccessTokenAudit struct {
+	ID         int       `json:"id"`
+	TokenID    int       `json:"token_id"`
+	BatchID    int       `json:"batch_id"`
+	Operation  string    `json:"operation"`
+	Outcome    string    `json:"outcome"`              // allowed, denied or failed
+	AccountID  *int      `json:"account_id,omitempty"` // Owner account issuing or revoking the token
+	Detail     string    `json:"detail,omitempty"`
+	DocumentID *int      `json:"document_id,omitempty"`
+	EventID    *int      `json:"event_id,omitempty"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SupplierBatchAccess is what a supplier sees of the batch its token gives access to
+type SupplierBatchAccess struct {
+	BatchID       int       `json:"batch_id"`
+	Species       string    `json:"species"`
+	Quantity      int       `json:"quantity"`
+	Status        string    `json:"status"`
+	HatcheryName  string    `json:"hatchery_name"`
+	SupplierName  string    `json:"supplier_name"`
+	Scopes        []string  `json:"scopes"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	RemainingUses *int      `json:"remaining_uses,omitempty"`
+}
+
+// SupplierReceiptRequest represents a supplier confirming it received a batch
+type SupplierReceiptRequest struct {
+	ReceivedAt *time.Time `json:"received_at"` // Now when empty
+	Quantity   *int       `json:"quantity"`    // Quantity received, when counted
+	Condition  string     `json:"condition"`   // e.g. good, damaged, mortalities
+	Location   string     `json:"location"`
+	Notes      string     `json:"notes"`
+}
+
+const batchAccessTokenColumns = `
+	id, batch_id, company_id, supplier_name, COALESCE(supplier_email, ''), scopes, token_prefix, expires_at,
+	max_uses, use_count, last_used_at, revoked_at, revoked_by, created_by, created_at
+`
+
+// scanBatchAccessToken reads a token selected with batchAccessTokenColumns
+func scanBatchAccessToken(row rowScanner) (BatchAccessToken, error) {
+	var t BatchAccessToken
+	var companyID, maxUses, revokedBy, createdBy sql.NullInt64
+	var lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.BatchID, &companyID, &t.SupplierName, &t.SupplierEmail, pq.Array(&t.Scopes), &t.TokenPrefix, &t.ExpiresAt,
+		&maxUses, &t.UseCount, &lastUsedAt, &revokedAt, &revokedBy, &createdBy, &t.CreatedAt)
+	t.CompanyID = intPtr(companyID)
+	t.MaxUses = intPtr(maxUses)
+	t.LastUsedAt = timePtr(lastUsedAt)
+	t.RevokedAt = timePtr(revokedAt)
+	t.RevokedBy = intPtr(revokedBy)
+	t.CreatedBy = intPtr(createdBy)
+	t.Status = t.status(time.Now())
+	return t, err
+}
+
+// status tells whether the token can still be used, and why not otherwise
+func (t BatchAccessToken) status(now time.Time) string {
+	switch {
+	case t.RevokedAt != nil:
+		return "revoked"
+	case !t.ExpiresAt.After(now):
+		return "expired"
+	case t.MaxUses != nil && t.UseCount >= *t.MaxUses:
+		return "used_up"
+	}
+	return "active"
+}
+
+// hasScope reports whether the token allows an operation
+func (t BatchAccessToken) hasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+const batchAccessTokenAuditColumns = `
+	id, token_id, batch_id, operation, outcome, account_id, COALESCE(detail, ''), document_id, event_id,
+	COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at
+`
+
+// scanBatchAccessTokenAudit reads an audit entry selected with batchAccessTokenAuditColumns
+func scanBatchAccessTokenAudit(row rowScanner) (BatchAccessTokenAudit, error) {
+	var a BatchAccessTokenAudit
+	var accountID, documentID, eventID sql.NullInt64
+	err := row.Scan(&a.ID, &a.TokenID, &a.BatchID, &a.Operation, &a.Outcome, &accountID, &a.Detail, &documentID, &eventID,
+		&a.IPAddress, &a.UserAgent, &a.CreatedAt)
+	a.AccountID = intPtr(accountID)
+	a.DocumentID = intPtr(documentID)
+	a.EventID = intPtr(eventID)
+	return a, err
+}
+
+// auditBatchAccess records an operation attempted with or on a batch access token.
+// The trail is the only record of what a supplier without an account did, so failing to write it fails the request
+func auditBatchAccess(c *fiber.Ctx, token BatchAccessToken, operation, outcome, detail string, accountID int, documentID, eventID *int) error {
+	_, err := db.DB.Exec(`
+		INSERT INTO batch_access_token_audit (token_id, batch_id, operation, outcome, account_id, detail, document_id, event_id, ip_address, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), NULLIF($6, ''), $7, $8, $9, $10, NOW())
+	`, token.ID, token.BatchID, operation, outcome, accountID, detail, documentID, eventID, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		fmt.Printf("Warning: failed to audit batch access token %d: %v\n", token.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record access")
+	}
+	return nil
+}
+
+// denyBatchAccess audits a refused operation and returns the error to send the supplier
+func denyBatchAccess(c *fiber.Ctx, token BatchAccessToken, operation string, status int, reason string) error {
+	if err := auditBatchAccess(c, token, operation, BatchAccessDenied, reason, 0, nil, nil); err != nil {
+		return err
+	}
+	return fiber.NewError(status, reason)
+}
+
+// batchAccessTokenAuth authenticates a supplier by its batch access token, sent as a bearer token or in the link it was emailed.
+// Attempts with a known token that is revoked, expired or used up are audited before being refused
+func batchAccessTokenAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		secret := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+		if secret == c.Get("Authorization") {
+			// Emailed links carry the token in the query string
+			secret = c.Query("token")
+		}
+		if secret == "" {
+			return fiber.NewError(fiber.StatusUnauthorized, "A batch access token is required as 'Bearer your-token' or as the token query parameter")
+		}
+
+		token, err := scanBatchAccessToken(db.DB.QueryRow(`
+			SELECT `+batchAccessTokenColumns+` FROM batch_access_token WHERE token_hash = $1 AND is_active = true
+		`, hashLIMSToken(secret)))
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusUnauthorized, "Invalid batch access token")
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if token.Status != "active" {
+			return denyBatchAccess(c, token, batchAccessAuthenticate, fiber.StatusUnauthorized, "Batch access token is "+strings.ReplaceAll(token.Status, "_", " "))
+		}
+
+		var batchActive bool
+		err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = $1 AND is_active = true)", token.BatchID).Scan(&batchActive)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if !batchActive {
+			return denyBatchAccess(c, token, batchAccessAuthenticate, fiber.StatusNotFound, "Batch not found or inactive")
+		}
+
+		if _, err := db.DB.Exec("UPDATE batch_access_token SET last_used_at = NOW() WHERE id = $1", token.ID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		c.Locals("batchAccessToken", token)
+		c.Locals("apiKey", fmt.Sprintf("batch_token:%d", token.ID))
+		return c.Next()
+	}
+}
+
+// requireBatchAccessScope refuses, and audits, operations the supplier's token is not scoped to.
+// Operations that change the batch are also refused while the batch is under legal hold
+func requireBatchAccessScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, _ := c.Locals("batchAccessToken").(BatchAccessToken)
+		if !token.hasScope(scope) {
+			return denyBatchAccess(c, token, scope, fiber.StatusForbidden, "This token does not allow "+strings.ReplaceAll(scope, "_", " "))
+		}
+		holds, err := activeLegalHolds(LegalHoldBatch, token.BatchID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check legal holds")
+		}
+		if len(holds) > 0 {
+			return denyBatchAccess(c, token, scope, fiber.StatusLocked, fmt.Sprintf("This batch is under legal hold and cannot be changed (hold %d)", holds[0].ID))
+		}
+		return c.Next()
+	}
+}
+
+// claimBatchAccessUse counts an operation against the token's use limit, reporting false when it is used up
+func claimBatchAccessUse(tokenID int) (bool, error) {
+	result, err := db.DB.Exec(`
+		UPDATE batch_access_token SET use_count = use_count + 1
+		WHERE id = $1 AND (max_uses IS NULL OR use_count < max_uses)
+	`, tokenID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// releaseBatchAccessUse gives back the use claimed by an operation that failed
+func releaseBatchAccessUse(tokenID int) {
+	if _, err := db.DB.Exec("UPDATE batch_access_token SET use_count = GREATEST(use_count - 1, 0) WHERE id = $1", tokenID); err != nil {
+		fmt.Printf("Warning: failed to release use of batch access token %d: %v\n", tokenID, err)
+	}
+}
+
+// batchOwner returns the company owning an active batch, authorizing the caller to act for it
+func batchOwner(c *fiber.Ctx, batchID int) (int, error) {
+	var companyID sql.NullInt64
+	err := db.DB.QueryRow(`
+		SELECT `+batchOwnerCompany+` FROM batch b LEFT JOIN hatchery h ON h.id = b.hatchery_id WHERE b.id = $1 AND b.is_active = true
+	`, batchID).Scan(&companyID)
+	if err == sql.ErrNoRows {
+		return 0, fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if err := actsForCompany(c, int(companyID.Int64)); err != nil {
+		return 0, err
+	}
+	return int(companyID.Int64), nil
+}
+
+// notifyBatchOwner sends the owner of a batch a webhook about supplier activity
+func notifyBatchOwner(token BatchAccessToken, event string, data map[string]interface{}) {
+	if token.CompanyID == nil {
+		return
+	}
+	data["batch_id"] = token.BatchID
+	data["access_token_id"] = token.ID
+	data["supplier_name"] = token.SupplierName
+	if err := webhooks.Dispatch(*token.CompanyID, event, data); err != nil {
+		fmt.Printf("Warning: failed to dispatch %s webhook: %v\n", event, err)
+	}
+}
+
+// issueBatchAccessToken saves and audits a new token with the batch, supplier, scopes, expiry and use limit
+// of the given one, returning it with its secret
+func issueBatchAccessToken(c *fiber.Ctx, t BatchAccessToken, userID int) (BatchAccessToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return t, fiber.NewError(fiber.StatusInternalServerError, "Failed to generate token")
+	}
+	secret := "bat_" + hex.EncodeToString(raw)
+
+	var companyID, maxUses int
+	if t.CompanyID != nil {
+		companyID = *t.CompanyID
+	}
+	if t.MaxUses != nil {
+		maxUses = *t.MaxUses
+	}
+	token, err := scanBatchAccessToken(db.DB.QueryRow(`
+		INSERT INTO batch_access_token (batch_id, company_id, supplier_name, supplier_email, scopes, token_prefix, token_hash,
+			expires_at, max_uses, created_by, created_at, is_active)
+		VALUES ($1, NULLIF($2, 0), $3, NULLIF($4, ''), $5, $6, $7, $8, NULLIF($9, 0), NULLIF($10, 0), NOW(), true)
+		RETURNING `+batchAccessTokenColumns,
+		t.BatchID, companyID, t.SupplierName, t.SupplierEmail, pq.Array(t.Scopes), secret[:12], hashLIMSToken(secret),
+		t.ExpiresAt, maxUses, userID))
+	if err != nil {
+		return token, fiber.NewError(fiber.StatusInternalServerError, "Failed to save token")
+	}
+	if err := auditBatchAccess(c, token, batchAccessIssue, BatchAccessAllowed, "Scopes: "+strings.Join(token.Scopes, ", "), userID, nil, nil); err != nil {
+		return token, err
+	}
+	token.Token = secret
+	return token, nil
+}
+
+// IssueBatchAccessToken issues a batch access token to a supplier
+// @Summary Issue batch access token
+// @Description Issue an expiring token that lets a supplier without an account upload a health certificate and/or confirm receipt for one batch.
+// @Description Only the batch owner can issue tokens; the token is only shown in this response and every use of it is audited
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param request body BatchAccessTokenRequest true "Token"
+// @Success 201 {object} SuccessResponse{data=BatchAccessToken}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/access-tokens [post]
+func IssueBatchAccessToken(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	var req BatchAccessTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.SupplierName = strings.TrimSpace(req.SupplierName)
+	if req.SupplierName == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Supplier name is required")
+	}
+	if len(req.Scopes) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one scope is required")
+	}
+	for _, scope := range req.Scopes {
+		if scope != BatchAccessUploadHealthCert && scope != BatchAccessConfirmReceipt {
+			return fiber.NewError(fiber.StatusBadRequest, "Scopes must be upload_health_cert or confirm_receipt")
+		}
+	}
+	now := time.Now()
+	expiresAt := now.Add(defaultBatchAccessLifetime)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	if !expiresAt.After(now) || expiresAt.After(now.Add(maxBatchAccessLifetime)) {
+		return fiber.NewError(fiber.StatusBadRequest, "Expiry must be in the future and at most 30 days ahead")
+	}
+	if req.MaxUses < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Max uses cannot be negative")
+	}
+
+	companyID, err := batchOwner(c, batchID)
+	if err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	token, err := issueBatchAccessToken(c, BatchAccessToken{
+		BatchID:       batchID,
+		CompanyID:     &companyID,
+		SupplierName:  req.SupplierName,
+		SupplierEmail: strings.TrimSpace(req.SupplierEmail),
+		Scopes:        req.Scopes,
+		ExpiresAt:     expiresAt,
+		MaxUses:       &req.MaxUses,
+	}, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch access token issued successfully",
+		Data:    token,
+	})
+}
+
+// ListBatchAccessTokens lists the access tokens issued for a batch
+// @Summary List batch access tokens
+// @Description List the access tokens issued to suppliers for a batch, without the secrets
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]BatchAccessToken}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/access-tokens [get]
+func ListBatchAccessTokens(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	if _, err := batchOwner(c, batchID); err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query(`SELECT `+batchAccessTokenColumns+` FROM batch_access_token WHERE batch_id = $1 AND is_active = true ORDER BY created_at DESC`, batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	tokens := []BatchAccessToken{}
+	for rows.Next() {
+		token, err := scanBatchAccessToken(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse token")
+		}
+		tokens = append(tokens, token)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch access tokens retrieved successfully",
+		Data:    tokens,
+	})
+}
+
+// loadBatchAccessToken loads a token of a batch for its owner
+func loadBatchAccessToken(c *fiber.Ctx) (BatchAccessToken, error) {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return BatchAccessToken{}, fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	tokenID, err := strconv.Atoi(c.Params("tokenId"))
+	if err != nil {
+		return BatchAccessToken{}, fiber.NewError(fiber.StatusBadRequest, "Invalid token ID format")
+	}
+	if _, err := batchOwner(c, batchID); err != nil {
+		return BatchAccessToken{}, err
+	}
+
+	token, err := scanBatchAccessToken(db.DB.QueryRow(`
+		SELECT `+batchAccessTokenColumns+` FROM batch_access_token WHERE id = $1 AND batch_id = $2 AND is_active = true
+	`, tokenID, batchID))
+	if err == sql.ErrNoRows {
+		return token, fiber.NewError(fiber.StatusNotFound, "Token not found")
+	}
+	if err != nil {
+		return token, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	return token, nil
+}
+
+// revokeBatchAccessToken revokes and audits a token
+func revokeBatchAccessToken(c *fiber.Ctx, token BatchAccessToken, userID int, reason string) (BatchAccessToken, error) {
+	revoked, err := scanBatchAccessToken(db.DB.QueryRow(`
+		UPDATE batch_access_token SET revoked_at = COALESCE(revoked_at, NOW()), revoked_by = COALESCE(revoked_by, NULLIF($2, 0))
+		WHERE id = $1
+		RETURNING `+batchAccessTokenColumns,
+		token.ID, userID))
+	if err != nil {
+		return token, fiber.NewError(fiber.StatusInternalServerError, "Failed to revoke token")
+	}
+	if err := auditBatchAccess(c, revoked, batchAccessRevoke, BatchAccessAllowed, reason, userID, nil, nil); err != nil {
+		return revoked, err
+	}
+	return revoked, nil
+}
+
+// RevokeBatchAccessToken revokes a batch access token
+// @Summary Revoke batch access token
+// @Description Revoke a supplier's batch access token so it can no longer be used
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param tokenId path int true "Token ID"
+// @Success 200 {object} SuccessResponse{data=BatchAccessToken}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/access-tokens/{tokenId} [delete]
+func RevokeBatchAccessToken(c *fiber.Ctx) error {
+	token, err := loadBatchAccessToken(c)
+	if err != nil {
+		return err
+	}
+	if token.RevokedAt != nil {
+		return fiber.NewError(fiber.StatusConflict, "Token is already revoked")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	token, err = revokeBatchAccessToken(c, token, userID, "")
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch access token revoked successfully",
+		Data:    token,
+	})
+}
+
+// GetBatchAccessTokenAudit lists the audit trail of a batch access token
+// @Summary Get batch access token audit trail
+// @Description List every operation attempted with a batch access token, allowed or not, and its issue and revocation, newest first
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param tokenId path int true "Token ID"
+// @Success 200 {object} SuccessResponse{data=[]BatchAccessTokenAudit}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/access-tokens/{tokenId}/audit [get]
+func GetBatchAccessTokenAudit(c *fiber.Ctx) error {
+	token, err := loadBatchAccessToken(c)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query(`SELECT `+batchAccessTokenAuditColumns+` FROM batch_access_token_audit WHERE token_id = $1 ORDER BY created_at DESC, id DESC`, token.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	entries := []BatchAccessTokenAudit{}
+	for rows.Next() {
+		entry, err := scanBatchAccessTokenAudit(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse audit entry")
+		}
+		entries = append(entries, entry)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch access token audit trail retrieved successfully",
+		Data:    entries,
+	})
+}
+
+// GetSupplierBatch shows a supplier the batch its token gives access to
+// @Summary Get supplier batch
+// @Description Show the batch a batch access token gives access to and what the token allows
+// @Tags supplier
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} SuccessResponse{data=SupplierBatchAccess}
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /supplier/batch [get]
+func GetSupplierBatch(c *fiber.Ctx) error {
+	token, _ := c.Locals("batchAccessToken").(BatchAccessToken)
+
+	access := SupplierBatchAccess{
+		BatchID:      token.BatchID,
+		SupplierName: token.SupplierName,
+		Scopes:       token.Scopes,
+		ExpiresAt:    token.ExpiresAt,
+	}
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(b.species, ''), COALESCE(b.quantity, 0), COALESCE(b.status, ''), COALESCE(h.name, '')
+		FROM batch b LEFT JOIN hatchery h ON h.id = b.hatchery_id
+		WHERE b.id = $1
+	`, token.BatchID).Scan(&access.Species, &access.Quantity, &access.Status, &access.HatcheryName)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if token.MaxUses != nil {
+		remaining := *token.MaxUses - token.UseCount
+		access.RemainingUses = &remaining
+	}
+	if err := auditBatchAccess(c, token, batchAccessViewBatch, BatchAccessAllowed, "", 0, nil, nil); err != nil {
+		return err
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch retrieved successfully",
+		Data:    access,
+	})
+}
+
+// UploadSupplierHealthCertificate lets a supplier upload a health certificate for the batch of its token
+// @Summary Upload health certificate with batch access token
+// @Description Upload a health certificate for the batch a batch access token gives access to. The file is stored on IPFS, recorded on the blockchain
+// @Description and attached to the batch as a health_certificate document; the batch owner is notified through the supplier_document webhook
+// @Tags supplier
+// @Accept multipart/form-data
+// @Produce json
+// @Security Bearer
+// @Param file formData file true "Health certificate"
+// @Success 201 {object} SuccessResponse{data=SupplierDocument}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 423 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /supplier/health-certificates [post]
+func UploadSupplierHealthCertificate(c *fiber.Ctx) error {
+	token, _ := c.Locals("batchAccessToken").(BatchAccessToken)
+
+	doc, err := storeSupplierDocument(c, token, BatchAccessUploadHealthCert, "health_certificate")
+	if err != nil {
+		return err
+	}
+	notifyBatchOwner(token, "supplier_document", doc.webhookData())
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Health certificate uploaded successfully",
+		Data:    doc,
+	})
+}
+
+// SupplierDocument is a document a supplier uploaded with a batch access token
+type SupplierDocument struct {
+	ID         int       `json:"id"`
+	BatchID    int       `json:"batch_id"`
+	DocType    string    `json:"doc_type"`
+	IPFSHash   string    `json:"ipfs_hash"`
+	IPFSURI    string    `json:"ipfs_uri"`
+	FileName   string    `json:"file_name"`
+	FileSize   int64     `json:"file_size"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// webhookData describes the document to the batch owner
+func (d SupplierDocument) webhookData() map[string]interface{} {
+	return map[string]interface{}{
+		"document_id": d.ID,
+		"doc_type":    d.DocType,
+		"file_name":   d.FileName,
+		"ipfs_hash":   d.IPFSHash,
+		"ipfs_uri":    d.IPFSURI,
+	}
+}
+
+// storeSupplierDocument stores the file of a supplier's upload on IPFS, records it on the blockchain and attaches it
+// to the batch of the token. The upload counts as a use of the token and is audited as the operation, whatever its outcome
+func storeSupplierDocument(c *fiber.Ctx, token BatchAccessToken, operation, docType string) (SupplierDocument, error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return SupplierDocument{}, denyBatchAccess(c, token, operation, fiber.StatusBadRequest, "File is required")
+	}
+	if file.Size > 10*1024*1024 {
+		return SupplierDocument{}, denyBatchAccess(c, token, operation, fiber.StatusBadRequest, "File size exceeds 10MB limit")
+	}
+	claimed, err := claimBatchAccessUse(token.ID)
+	if err != nil {
+		return SupplierDocument{}, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !claimed {
+		return SupplierDocument{}, denyBatchAccess(c, token, operation, fiber.StatusUnauthorized, "Batch access token is used up")
+	}
+
+	// Gives back the use and audits the failure of a step after the use was claimed
+	fail := func(message string, cause error) error {
+		releaseBatchAccessUse(token.ID)
+		if err := auditBatchAccess(c, token, operation, BatchAccessFailed, fmt.Sprintf("%s: %v", message, cause), 0, nil, nil); err != nil {
+			return err
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, message)
+	}
+
+	fileHandle, err := file.Open()
+	if err != nil {
+		return SupplierDocument{}, fail("Failed to open file", err)
+	}
+	defer fileHandle.Close()
+
+	upload, placement, err := uploadDocumentFile(companyOfDocumentBatch(token.BatchID), fileHandle, file.Filename, map[string]string{
+		"batch_id":        strconv.Itoa(token.BatchID),
+		"document_type":   docType,
+		"access_token_id": strconv.Itoa(token.ID),
+		"supplier":        token.SupplierName,
+		"app":             "TracePost-larvaeChain",
+		"timestamp":       time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		failErr := fail("Failed to upload file", err)
+		if isRequestError(err) {
+			return SupplierDocument{}, err
+		}
+		return SupplierDocument{}, failErr
+	}
+	doc := SupplierDocument{
+		BatchID:  token.BatchID,
+		DocType:  docType,
+		IPFSHash: upload.CID,
+		IPFSURI:  upload.IPFSUri,
+		FileName: upload.Name,
+		FileSize: upload.Size,
+	}
+	if upload.PinataSuccess && upload.PinataUri != "" {
+		doc.IPFSURI = upload.PinataUri
+	}
+
+	err = db.DB.QueryRow(`
+		INSERT INTO document (batch_id, doc_type, ipfs_hash, ipfs_uri, file_name, file_size, sensitivity, storage_region, storage_backend, region_locked, uploaded_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW(), true)
+		RETURNING id, uploaded_at
+	`, doc.BatchID, doc.DocType, doc.IPFSHash, doc.IPFSURI, doc.FileName, doc.FileSize, defaultDocumentSensitivity(doc.DocType),
+		placement.Region, placement.Backend, placement.Locked).Scan(&doc.ID, &doc.UploadedAt)
+	if err != nil {
+		return SupplierDocument{}, fail("Failed to save document", err)
+	}
+
+	blockchainClient := blockchain.NewBlockchainClient(
+		os.Getenv("BLOCKCHAIN_NODE_URL"),
+		os.Getenv("BLOCKCHAIN_PRIVATE_KEY"),
+		os.Getenv("BLOCKCHAIN_ACCOUNT"),
+		os.Getenv("BLOCKCHAIN_CHAIN_ID"),
+		os.Getenv("BLOCKCHAIN_CONSENSUS"),
+	)
+	txID, err := blockchainClient.RecordDocument(strconv.Itoa(doc.BatchID), docType, doc.IPFSHash, fmt.Sprintf("batch_token:%d", token.ID))
+	if err != nil {
+		// Log error but continue - blockchain is secondary to database
+		fmt.Printf("Warning: Failed to record document on blockchain: %v\n", err)
+	}
+	if txID != "" {
+		metadataHash, _ := blockchainClient.HashData(map[string]interface{}{
+			"document_id":     doc.ID,
+			"batch_id":        doc.BatchID,
+			"doc_type":        docType,
+			"ipfs_hash":       doc.IPFSHash,
+			"access_token_id": token.ID,
+			"uploaded_at":     doc.UploadedAt,
+		})
+		_, err = db.DB.Exec(`
+			INSERT INTO blockchain_record (related_table, related_id, tx_id, metadata_hash, created_at, updated_at, is_active)
+			VALUES ($1, $2, $3, $4, NOW(), NOW(), true)
+		`, "document", doc.ID, txID, metadataHash)
+		if err != nil {
+			fmt.Printf("Warning: Failed to save blockchain record: %v\n", err)
+		}
+	}
+
+	if err := auditBatchAccess(c, token, operation, BatchAccessAllowed, doc.FileName, 0, &doc.ID, nil); err != nil {
+		return SupplierDocument{}, err
+	}
+	data := doc.webhookData()
+	data["access_token_id"] = token.ID
+	publishDomainEvent(eventbus.DocumentUploaded, 0, doc.BatchID, data)
+	return doc, nil
+}
+
+// ConfirmSupplierReceipt lets a supplier confirm it received the batch of its token
+// @Summary Confirm receipt with batch access token
+// @Description Confirm receipt of the batch a batch access token gives access to. A receipt_confirmed event is recorded on the batch
+// @Description and the batch owner is notified through the supplier_receipt webhook
+// @Tags supplier
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body SupplierReceiptRequest false "Receipt"
+// @Success 201 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 423 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /supplier/receipt [post]
+func ConfirmSupplierReceipt(c *fiber.Ctx) error {
+	token, _ := c.Locals("batchAccessToken").(BatchAccessToken)
+
+	var req SupplierReceiptRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return denyBatchAccess(c, token, BatchAccessConfirmReceipt, fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	receivedAt := time.Now()
+	if req.ReceivedAt != nil {
+		if req.ReceivedAt.After(receivedAt.Add(5 * time.Minute)) {
+			return denyBatchAccess(c, token, BatchAccessConfirmReceipt, fiber.StatusBadRequest, "Receipt time must not be in the future")
+		}
+		receivedAt = *req.ReceivedAt
+	}
+	if req.Quantity != nil && *req.Quantity < 0 {
+		return denyBatchAccess(c, token, BatchAccessConfirmReceipt, fiber.StatusBadRequest, "Quantity cannot be negative")
+	}
+	claimed, err := claimBatchAccessUse(token.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !claimed {
+		return denyBatchAccess(c, token, BatchAccessConfirmReceipt, fiber.StatusUnauthorized, "Batch access token is used up")
+	}
+
+	data := map[string]interface{}{
+		"access_token_id": token.ID,
+		"supplier_name":   token.SupplierName,
+		"condition":       req.Condition,
+		"notes":           req.Notes,
+	}
+	if req.Quantity != nil {
+		data["quantity"] = *req.Quantity
+	}
+	metadata, _ := json.Marshal(data)
+	location := req.Location
+	if location == "" {
+		location = token.SupplierName
+	}
+	var eventID int
+	err = db.DB.QueryRow(`
+		INSERT INTO event (batch_id, event_type, location, timestamp, metadata, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, NOW(), true)
+		RETURNING id
+	`, token.BatchID, EventTypeReceiptConfirmed, location, receivedAt, metadata).Scan(&eventID)
+	if err != nil {
+		releaseBatchAccessUse(token.ID)
+		if err := auditBatchAccess(c, token, BatchAccessConfirmReceipt, BatchAccessFailed, err.Error(), 0, nil, nil); err != nil {
+			return err
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create event record")
+	}
+	if err := auditBatchAccess(c, token, BatchAccessConfirmReceipt, BatchAccessAllowed, "", 0, nil, &eventID); err != nil {
+		return err
+	}
+
+	data["event_id"] = eventID
+	data["received_at"] = receivedAt
+	data["location"] = location
+	notifyBatchOwner(token, "supplier_receipt", data)
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Receipt confirmed successfully",
+		Data:    data,
+	})
+}
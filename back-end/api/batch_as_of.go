@@ -0,0 +1,329 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// BatchStateAt is the state of a batch at one moment
+type BatchStateAt struct {
+	Status         string     `json:"status"`
+	OwnerCompanyID *int       `json:"owner_company_id,omitempty"`
+	Species        string     `json:"species"`
+	Quantity       int        `json:"quantity"`
+	StrainID       *int       `json:"strain_id,omitempty"`
+	RecallID       *int       `json:"recall_id,omitempty"` // Recall in force at that moment
+	Recalled       bool       `json:"recalled"`
+	DocumentCount  int        `json:"document_count"`
+	EventCount     int        `json:"event_count"`
+	LastEventAt    *time.Time `json:"last_event_at,omitempty"`
+}
+
+// AsOfDocument is a document of a batch as it stood at one moment
+type AsOfDocument struct {
+	ID         int        `json:"id"`
+	DocType    string     `json:"doc_type"`
+	FileName   string     `json:"file_name"`
+	IPFSHash   string     `json:"ipfs_hash"`
+	UploadedAt time.Time  `json:"uploaded_at"`
+	ExpiryDate *time.Time `json:"expiry_date,omitempty"`
+	Expired    bool       `json:"expired"` // Past its expiry date at that moment
+	RemovedAt  *time.Time `json:"removed_at,omitempty"`
+}
+
+// AsOfEvent is an event of a batch as it was recorded at one moment
+type AsOfEvent struct {
+	ID                int       `json:"id"`
+	EventType         string    `json:"event_type"`
+	Location          string    `json:"location"`
+	Timestamp         time.Time `json:"timestamp"`
+	SupersedesEventID *int      `json:"supersedes_event_id,omitempty"`
+	CorrectedLater    bool      `json:"corrected_later"` // Superseded by a correction made after that moment
+}
+
+// BatchStateDifference is a field of a batch that changed since the moment asked for
+type BatchStateDifference struct {
+	Field string      `json:"field"`
+	Then  interface{} `json:"then"`
+	Now   interface{} `json:"now"`
+}
+
+// BatchAsOf is a batch reconstructed at a point in time, next to its current state
+type BatchAsOf struct {
+	BatchID               int                    `json:"batch_id"`
+	AsOf                  time.Time              `json:"as_of"`
+	CreatedAt             time.Time              `json:"created_at"`
+	Then                  BatchStateAt           `json:"then"`
+	Now                   BatchStateAt           `json:"now"`
+	Differences           []BatchStateDifference `json:"differences"`
+	Documents             []AsOfDocument         `json:"documents"`
+	DocumentsAddedSince   []AsOfDocument         `json:"documents_added_since"`
+	DocumentsRemovedSince []AsOfDocument         `json:"documents_removed_since"`
+	Events                []AsOfEvent            `json:"events"`
+	Caveats               []string               `json:"caveats"`
+}
+
+// parseAsOfTimestamp reads an RFC 3339 timestamp or a date, taken as the end of that day
+func parseAsOfTimestamp(value string) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339, value); err == nil {
+		return ts.UTC(), nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.Add(24*time.Hour - time.Second), nil
+}
+
+// GetBatchAsOf reconstructs a batch at a point in time
+// @Summary Get batch as of a point in time
+// @Description Reconstruct a batch, its documents and its status as they stood at a moment from the event log and document history,
+// @Description with the differences from its current state. A date without a time is taken as the end of that day (UTC).
+// @Description Species, quantity and strain are not versioned and are reported as they are now
+// @Tags batches
+// @Produce json
+// @Param batchId path string true "Batch ID"
+// @Param timestamp query string true "RFC 3339 timestamp or date (YYYY-MM-DD)"
+// @Success 200 {object} SuccessResponse{data=BatchAsOf}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batches/{batchId}/as-of [get]
+func GetBatchAsOf(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	value := strings.TrimSpace(c.Query("timestamp"))
+	if value == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "timestamp is required")
+	}
+	asOf, err := parseAsOfTimestamp(value)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "timestamp must be an RFC 3339 timestamp or a date (YYYY-MM-DD)")
+	}
+	if asOf.After(time.Now()) {
+		return fiber.NewError(fiber.StatusBadRequest, "timestamp cannot be in the future")
+	}
+
+	result := BatchAsOf{BatchID: batchID, AsOf: asOf, Caveats: []string{
+		"species, quantity and strain are not versioned and are shown as they are now",
+		"status is reconstructed from status_changed events; status changes made by shipments are not in the log",
+	}}
+	var hatcheryCompanyID, ownerCompanyID, strainID sql.NullInt64
+	err = db.DB.QueryRow(`
+		SELECT b.status, COALESCE(b.species, ''), COALESCE(b.quantity, 0), b.strain_id, b.owner_company_id, h.company_id, b.created_at
+		FROM batch b
+		LEFT JOIN hatchery h ON h.id = b.hatchery_id
+		WHERE b.id = $1 AND b.is_active = true
+	`, batchID).Scan(&result.Now.Status, &result.Now.Species, &result.Now.Quantity, &strainID, &ownerCompanyID,
+		&hatcheryCompanyID, &result.CreatedAt)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if asOf.Before(result.CreatedAt) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("The batch was created at %s, after the timestamp", result.CreatedAt.Format(time.RFC3339)))
+	}
+	result.Now.StrainID = intPtr(strainID)
+	if ownerCompanyID.Valid {
+		result.Now.OwnerCompanyID = intPtr(ownerCompanyID)
+	} else {
+		result.Now.OwnerCompanyID = intPtr(hatcheryCompanyID)
+	}
+	result.Then.Species = result.Now.Species
+	result.Then.Quantity = result.Now.Quantity
+	result.Then.StrainID = result.Now.StrainID
+
+	// Status: the last change at or before the moment, otherwise what the first later change moved away from
+	var status sql.NullString
+	err = db.DB.QueryRow(`
+		SELECT metadata->>'new_status' FROM event
+		WHERE batch_id = $1 AND event_type = 'status_changed' AND timestamp <= $2
+		ORDER BY timestamp DESC, id DESC LIMIT 1
+	`, batchID, asOf).Scan(&status)
+	if err == sql.ErrNoRows {
+		err = db.DB.QueryRow(`
+			SELECT metadata->>'old_status' FROM event
+			WHERE batch_id = $1 AND event_type = 'status_changed' AND timestamp > $2
+			ORDER BY timestamp, id LIMIT 1
+		`, batchID, asOf).Scan(&status)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to reconstruct batch status")
+	}
+	result.Then.Status = result.Now.Status
+	if status.Valid && status.String != "" {
+		result.Then.Status = status.String
+	}
+
+	// Owner: the buyer of the last transfer accepted by then, otherwise the hatchery's company
+	result.Then.OwnerCompanyID = intPtr(hatcheryCompanyID)
+	var buyerCompanyID sql.NullInt64
+	err = db.DB.QueryRow(`
+		SELECT buyer_company_id FROM batch_ownership_transfer
+		WHERE batch_id = $1 AND status = 'accepted' AND responded_at <= $2
+		ORDER BY responded_at DESC, id DESC LIMIT 1
+	`, batchID, asOf).Scan(&buyerCompanyID)
+	if err != nil && err != sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to reconstruct batch owner")
+	}
+	if buyerCompanyID.Valid {
+		result.Then.OwnerCompanyID = intPtr(buyerCompanyID)
+	}
+
+	// Recalls in force then and now
+	for _, state := range []struct {
+		at    time.Time
+		state *BatchStateAt
+	}{{asOf, &result.Then}, {time.Now(), &result.Now}} {
+		var recallID sql.NullInt64
+		err = db.DB.QueryRow(`
+			SELECT id FROM batch_recall
+			WHERE batch_id = $1 AND initiated_at <= $2 AND (lifted_at IS NULL OR lifted_at > $2)
+			ORDER BY initiated_at DESC LIMIT 1
+		`, batchID, state.at).Scan(&recallID)
+		if err != nil && err != sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to reconstruct batch recalls")
+		}
+		state.state.RecallID = intPtr(recallID)
+		state.state.Recalled = recallID.Valid
+	}
+
+	// Documents uploaded by then and not removed by then, against the documents active now,
+	// limited to the sensitivity levels the caller may see
+	docLevels, err := visibleBatchDocumentLevels(c, batchID)
+	if err != nil {
+		return err
+	}
+	rows, err := db.DB.Query(`
+		SELECT id, COALESCE(doc_type, ''), COALESCE(file_name, ''), COALESCE(ipfs_hash, ''), uploaded_at, expiry_date,
+		       is_active, updated_at
+		FROM document
+		WHERE batch_id = $1 AND (is_active = true OR uploaded_at <= $2)`+documentSensitivityFilter("", 3)+`
+		ORDER BY uploaded_at, id
+	`, batchID, asOf, docLevels)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load batch documents")
+	}
+	defer rows.Close()
+	result.Documents = []AsOfDocument{}
+	result.DocumentsAddedSince = []AsOfDocument{}
+	result.DocumentsRemovedSince = []AsOfDocument{}
+	for rows.Next() {
+		var doc AsOfDocument
+		var expiryDate sql.NullTime
+		var isActive bool
+		var updatedAt time.Time
+		if err := rows.Scan(&doc.ID, &doc.DocType, &doc.FileName, &doc.IPFSHash, &doc.UploadedAt, &expiryDate,
+			&isActive, &updatedAt); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse batch document")
+		}
+		doc.ExpiryDate = timePtr(expiryDate)
+		if !isActive {
+			// Removal is not logged separately; the last update of a removed document is taken as its removal
+			doc.RemovedAt = &updatedAt
+		}
+		existedThen := !doc.UploadedAt.After(asOf) && (isActive || updatedAt.After(asOf))
+		if existedThen {
+			doc.Expired = doc.ExpiryDate != nil && !doc.ExpiryDate.After(asOf)
+			result.Documents = append(result.Documents, doc)
+			if !isActive {
+				result.DocumentsRemovedSince = append(result.DocumentsRemovedSince, doc)
+			}
+		} else if isActive {
+			result.DocumentsAddedSince = append(result.DocumentsAddedSince, doc)
+		}
+		if isActive {
+			result.Now.DocumentCount++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load batch documents")
+	}
+	result.Then.DocumentCount = len(result.Documents)
+
+	// Events recorded by then, in the version that was current then
+	eventRows, err := db.DB.Query(`
+		SELECT e.id, COALESCE(e.event_type, ''), COALESCE(e.location, ''), e.timestamp, e.supersedes_event_id,
+		       (e.superseded_by_event_id IS NOT NULL)
+		FROM event e
+		LEFT JOIN event correction ON correction.id = e.superseded_by_event_id
+		WHERE e.batch_id = $1 AND e.is_active = true AND e.timestamp <= $2
+		  AND (e.corrected_at IS NULL OR e.corrected_at <= $2)
+		  AND (correction.id IS NULL OR correction.corrected_at > $2)
+		ORDER BY e.timestamp, e.id
+	`, batchID, asOf)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load batch events")
+	}
+	defer eventRows.Close()
+	result.Events = []AsOfEvent{}
+	for eventRows.Next() {
+		var event AsOfEvent
+		var supersedes sql.NullInt64
+		if err := eventRows.Scan(&event.ID, &event.EventType, &event.Location, &event.Timestamp, &supersedes,
+			&event.CorrectedLater); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse batch event")
+		}
+		event.SupersedesEventID = intPtr(supersedes)
+		result.Events = append(result.Events, event)
+	}
+	if err := eventRows.Err(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load batch events")
+	}
+	result.Then.EventCount = len(result.Events)
+	if len(result.Events) > 0 {
+		result.Then.LastEventAt = &result.Events[len(result.Events)-1].Timestamp
+	}
+
+	var lastEventAt sql.NullTime
+	err = db.DB.QueryRow(`
+		SELECT COUNT(*), MAX(timestamp) FROM event
+		WHERE batch_id = $1 AND is_active = true AND superseded_by_event_id IS NULL
+	`, batchID).Scan(&result.Now.EventCount, &lastEventAt)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to count batch events")
+	}
+	result.Now.LastEventAt = timePtr(lastEventAt)
+
+	result.Differences = batchStateDifferences(result.Then, result.Now)
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch reconstructed successfully",
+		Data:    result,
+	})
+}
+
+// batchStateDifferences lists the fields that differ between two states of a batch
+func batchStateDifferences(then, now BatchStateAt) []BatchStateDifference {
+	differences := []BatchStateDifference{}
+	add := func(field string, a, b interface{}) {
+		if fmt.Sprint(a) != fmt.Sprint(b) {
+			differences = append(differences, BatchStateDifference{Field: field, Then: a, Now: b})
+		}
+	}
+	deref := func(v *int) interface{} {
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+	add("status", then.Status, now.Status)
+	add("owner_company_id", deref(then.OwnerCompanyID), deref(now.OwnerCompanyID))
+	add("recalled", then.Recalled, now.Recalled)
+	add("recall_id", deref(then.RecallID), deref(now.RecallID))
+	add("document_count", then.DocumentCount, now.DocumentCount)
+	add("event_count", then.EventCount, now.EventCount)
+	return differences
+}
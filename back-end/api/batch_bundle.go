@@ -0,0 +1,272 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/actors"
+	"github.com/LTPPPP/TracePost-larvaeChain/bundle"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+	"github.com/LTPPPP/TracePost-larvaeChain/signing"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ExportBatchBundle exports the history of a batch as a signed bundle for offline verification
+// @Summary Export signed batch bundle
+// @Description Export the batch, its events, custody transfers, document hashes and blockchain anchors as a self-contained bundle with Merkle inclusion proofs and a platform signature. The format and the verification steps are specified in the bundle package; the verify-bundle command checks a bundle without network access
+// @Tags batches
+// @Produce json
+// @Param batchId path string true "Batch ID"
+// @Success 200 {object} bundle.Bundle
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/bundle [get]
+func ExportBatchBundle(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	docLevels, err := visibleBatchDocumentLevels(c, batchID)
+	if err != nil {
+		return err
+	}
+	records, err := collectBundleRecords(batchID, docLevels)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load batch history: "+err.Error())
+	}
+
+	published, err := signing.Default().JWKS()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load signing keys: "+err.Error())
+	}
+	keys := bundle.JWKS{Keys: make([]bundle.JWK, 0, len(published.Keys))}
+	for _, key := range published.Keys {
+		keys.Keys = append(keys.Keys, bundle.JWK(key))
+	}
+
+	b, err := bundle.Build(config.GetConfig().BaseURL, batchID, time.Now(), records, signing.Default().Sign, keys)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build bundle: "+err.Error())
+	}
+
+	return sendBundle(c, batchID, b)
+}
+
+// sendBundle sends a bundle as a download, kept out of response formatting so its hashes and signature still verify
+func sendBundle(c *fiber.Ctx, batchID int, b *bundle.Bundle) error {
+	middleware.SkipFormatting(c)
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=batch-%d-bundle.json", batchID))
+	return c.JSON(b)
+}
+
+// collectBundleRecords loads the records of a batch bundle: the batch, its events, transfers,
+// documents the caller may see and the blockchain anchors of those records
+func collectBundleRecords(batchID int, docLevels interface{}) ([]bundle.Record, error) {
+	var batch struct {
+		ID           int       `json:"id"`
+		HatcheryID   int       `json:"hatchery_id"`
+		HatcheryName string    `json:"hatchery_name"`
+		CompanyName  string    `json:"company_name"`
+		Species      string    `json:"species"`
+		Quantity     int       `json:"quantity"`
+		Status       string    `json:"status"`
+		CreatedAt    time.Time `json:"created_at"`
+	}
+	err := db.DB.QueryRow(`
+		SELECT b.id, COALESCE(b.hatchery_id, 0), COALESCE(h.name, ''), COALESCE(co.name, ''),
+			COALESCE(b.species, ''), COALESCE(b.quantity, 0), COALESCE(b.status, ''), b.created_at
+		FROM batch b
+		LEFT JOIN hatchery h ON b.hatchery_id = h.id
+		LEFT JOIN company co ON h.company_id = co.id
+		WHERE b.id = $1 AND b.is_active = true
+	`, batchID).Scan(&batch.ID, &batch.HatcheryID, &batch.HatcheryName, &batch.CompanyName,
+		&batch.Species, &batch.Quantity, &batch.Status, &batch.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	record, err := bundle.NewRecord(bundle.RecordBatch, strconv.Itoa(batchID), batch)
+	if err != nil {
+		return nil, err
+	}
+	records := []bundle.Record{record}
+	included := map[string]bool{provenanceAnchorKey("batch", batchID): true}
+
+	// Events, with the username of the account that recorded them
+	type bundleEvent struct {
+		ID        int             `json:"id"`
+		EventType string          `json:"event_type"`
+		ActorID   int             `json:"actor_id"`
+		Actor     string          `json:"actor"`
+		Location  string          `json:"location"`
+		Timestamp time.Time       `json:"timestamp"`
+		Metadata  json.RawMessage `json:"metadata"`
+	}
+	rows, err := db.DB.Query(`
+		SELECT id, COALESCE(event_type, ''), COALESCE(actor_id, 0), COALESCE(location, ''), timestamp, COALESCE(metadata, '{}'::jsonb)
+		FROM event
+		WHERE batch_id = $1 AND is_active = true
+		ORDER BY timestamp, id
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	events := []bundleEvent{}
+	for rows.Next() {
+		var event bundleEvent
+		var metadata []byte
+		if err := rows.Scan(&event.ID, &event.EventType, &event.ActorID, &event.Location, &event.Timestamp, &metadata); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		event.Metadata = metadata
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	actorIDs := make([]int, 0, len(events))
+	for _, event := range events {
+		actorIDs = append(actorIDs, event.ActorID)
+	}
+	resolved, err := actors.Default().Accounts(actorIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		event.Actor = actorUsername(resolved, event.ActorID, "")
+		if record, err = bundle.NewRecord(bundle.RecordEvent, strconv.Itoa(event.ID), event); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+		included[provenanceAnchorKey("event", event.ID)] = true
+	}
+
+	// Custody transfers
+	rows, err = db.DB.Query(`
+		SELECT id, COALESCE(sender_id, 0), COALESCE(receiver_id, 0), transfer_time, COALESCE(status, '')
+		FROM shipment_transfer
+		WHERE batch_id = $1 AND is_active = true
+		ORDER BY transfer_time, id
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var transfer struct {
+			ID           int       `json:"id"`
+			SenderID     int       `json:"sender_id"`
+			ReceiverID   int       `json:"receiver_id"`
+			TransferTime time.Time `json:"transfer_time"`
+			Status       string    `json:"status"`
+		}
+		if err := rows.Scan(&transfer.ID, &transfer.SenderID, &transfer.ReceiverID, &transfer.TransferTime, &transfer.Status); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if record, err = bundle.NewRecord(bundle.RecordTransfer, strconv.Itoa(transfer.ID), transfer); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		records = append(records, record)
+		included[provenanceAnchorKey("shipment_transfer", transfer.ID)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Documents, by the content hash of the file
+	rows, err = db.DB.Query(`
+		SELECT id, COALESCE(doc_type, ''), COALESCE(file_name, ''), COALESCE(file_size, 0),
+			COALESCE(ipfs_hash, ''), COALESCE(ipfs_uri, ''), uploaded_at
+		FROM document
+		WHERE batch_id = $1 AND is_active = true`+documentSensitivityFilter("", 2)+`
+		ORDER BY uploaded_at, id
+	`, batchID, docLevels)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var document struct {
+			ID         int       `json:"id"`
+			DocType    string    `json:"doc_type"`
+			FileName   string    `json:"file_name"`
+			FileSize   int64     `json:"file_size"`
+			IPFSHash   string    `json:"ipfs_hash"`
+			IPFSURI    string    `json:"ipfs_uri"`
+			UploadedAt time.Time `json:"uploaded_at"`
+		}
+		if err := rows.Scan(&document.ID, &document.DocType, &document.FileName, &document.FileSize,
+			&document.IPFSHash, &document.IPFSURI, &document.UploadedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if record, err = bundle.NewRecord(bundle.RecordDocument, strconv.Itoa(document.ID), document); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		records = append(records, record)
+		included[provenanceAnchorKey("document", document.ID)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Water sources and treatment steps of the batch period
+	water, err := loadBatchWaterProvenance(batchID)
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range water.Sources {
+		if record, err = bundle.NewRecord(bundle.RecordWater, strconv.Itoa(source.ID), source); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	// Blockchain anchors of the records above; anchors of records the caller may not see are left out
+	rows, err = db.DB.Query(`
+		SELECT id, related_table, related_id, COALESCE(tx_id, ''), COALESCE(metadata_hash, ''),
+			COALESCE(network_id, ''), COALESCE(chain_type, ''), COALESCE(block_number, 0), COALESCE(confirmation_status, '')
+		FROM blockchain_record
+		WHERE is_active = true AND (
+			(related_table = 'batch' AND related_id = $1)
+			OR (related_table = 'event' AND related_id IN (SELECT id FROM event WHERE batch_id = $1))
+			OR (related_table = 'shipment_transfer' AND related_id IN (SELECT id FROM shipment_transfer WHERE batch_id = $1))
+			OR (related_table = 'document' AND related_id IN (SELECT id FROM document WHERE batch_id = $1))
+		)
+		ORDER BY created_at, id
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var anchor bundle.Anchor
+		if err := rows.Scan(&id, &anchor.RelatedTable, &anchor.RelatedID, &anchor.TxID, &anchor.MetadataHash,
+			&anchor.NetworkID, &anchor.ChainType, &anchor.BlockNumber, &anchor.ConfirmationStatus); err != nil {
+			return nil, err
+		}
+		if !included[provenanceAnchorKey(anchor.RelatedTable, anchor.RelatedID)] {
+			continue
+		}
+		if record, err = bundle.NewRecord(bundle.RecordAnchor, strconv.Itoa(id), anchor); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
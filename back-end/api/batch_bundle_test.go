@@ -0,0 +1,79 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/bundle"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+// testBundleSigner signs like the platform's payload keys: ES256 detached compact JWS
+func testBundleSigner(t *testing.T) (bundle.Signer, bundle.JWKS) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := make([]byte, 64)
+	private.X.FillBytes(point[:32])
+	private.Y.FillBytes(point[32:])
+	keys := bundle.JWKS{Keys: []bundle.JWK{{
+		Kty: "EC", Crv: "P-256", Kid: "test-key", Use: "sig", Alg: "ES256",
+		X: base64.RawURLEncoding.EncodeToString(point[:32]),
+		Y: base64.RawURLEncoding.EncodeToString(point[32:]),
+	}}}
+	sign := func(payload []byte) (string, error) {
+		protected := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","kid":"test-key","typ":"JOSE"}`))
+		digest := sha256.Sum256([]byte(protected + "." + base64.RawURLEncoding.EncodeToString(payload)))
+		r, s, err := ecdsa.Sign(rand.Reader, private, digest[:])
+		if err != nil {
+			return "", err
+		}
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return protected + ".." + base64.RawURLEncoding.EncodeToString(signature), nil
+	}
+	return sign, keys
+}
+
+func TestBatchBundleSurvivesResponseFormatting(t *testing.T) {
+	sign, keys := testBundleSigner(t)
+	batch, _ := bundle.NewRecord(bundle.RecordBatch, "7", map[string]interface{}{"id": 7, "quantity": 100000, "created_at": "2025-03-01T12:00:00Z"})
+	event, _ := bundle.NewRecord(bundle.RecordEvent, "11", map[string]interface{}{"event_type": "transport", "distance_km": 42.5, "temperature": 28.5})
+	b, err := bundle.Build("https://trace.example", 7, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), []bundle.Record{batch, event}, sign, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(middleware.ResponseFormatting(nil))
+	app.Get("/batches/7/bundle", func(c *fiber.Ctx) error {
+		return sendBundle(c, 7, b)
+	})
+
+	req := httptest.NewRequest(fiber.MethodGet, "/batches/7/bundle", nil)
+	req.Header.Set("X-Unit-System", "imperial")
+	req.Header.Set("X-Timezone", "Asia/Ho_Chi_Minh")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+
+	decoded, err := bundle.Decode(raw)
+	if err != nil {
+		t.Fatalf("failed to decode bundle: %v", err)
+	}
+	if report := bundle.Verify(decoded, &keys); !report.Valid {
+		t.Fatalf("bundle no longer verifies after formatting: %v", report.Errors)
+	}
+}
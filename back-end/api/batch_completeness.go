@@ -0,0 +1,213 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/completeness"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// BatchCompletenessReport is the completeness of a batch with the profile it is scored against
+type BatchCompletenessReport struct {
+	BatchID      int                       `json:"batch_id"`
+	Completeness *models.BatchCompleteness `json:"completeness"`
+	Profile      completeness.Profile      `json:"profile"`
+	Nudges       []completeness.Nudge      `json:"nudges"`
+}
+
+// CompletenessProfileRequest replaces the completeness profile of a company
+type CompletenessProfileRequest struct {
+	RequiredDocuments    []string             `json:"required_documents"`
+	ReadingIntervalHours int                  `json:"reading_interval_hours"` // 1 to 720
+	Stages               []completeness.Stage `json:"stages"`
+	NudgeThreshold       int                  `json:"nudge_threshold"` // 0 to 100, 0 disables nudges
+}
+
+// attachCompleteness sets the completeness of listed batches; lists are still returned when scoring fails
+func attachCompleteness(batches []models.Batch) {
+	if len(batches) == 0 {
+		return
+	}
+	ids := make([]int, len(batches))
+	for i, batch := range batches {
+		ids[i] = batch.ID
+	}
+	scores, err := completeness.ScoreBatches(ids)
+	if err != nil {
+		fmt.Printf("Warning: failed to score batch completeness: %v\n", err)
+		return
+	}
+	for i := range batches {
+		batches[i].Completeness = scores[batches[i].ID]
+	}
+}
+
+// GetBatchCompleteness returns how complete the data of a batch is
+// @Summary Get batch completeness
+// @Description Score the documents, environment reading frequency and stage event coverage of a batch against the completeness
+// @Description profile of its owner, with the nudges sent to the users shipping it
+// @Tags batches
+// @Produce json
+// @Param batchId path string true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=BatchCompletenessReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batches/{batchId}/completeness [get]
+func GetBatchCompleteness(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	companyID, err := batchOwner(c, batchID)
+	if err != nil {
+		return err
+	}
+
+	report := BatchCompletenessReport{BatchID: batchID}
+	report.Completeness, err = completeness.ScoreBatch(batchID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to score batch completeness")
+	}
+	if report.Profile, err = completeness.LoadProfile(companyID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load completeness profile")
+	}
+	if report.Nudges, err = completeness.ListNudges(batchID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load completeness nudges")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch completeness retrieved successfully",
+		Data:    report,
+	})
+}
+
+// GetCompletenessProfile returns the completeness profile of a company
+// @Summary Get completeness profile
+// @Description Get what a company expects of the data of its batches: required documents, reading interval, stages and nudge threshold.
+// @Description Companies without a profile of their own use the default profile
+// @Tags companies
+// @Produce json
+// @Param companyId path string true "Company ID"
+// @Success 200 {object} SuccessResponse{data=completeness.Profile}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/completeness-profile [get]
+func GetCompletenessProfile(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+
+	profile, err := completeness.LoadProfile(companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load completeness profile")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Completeness profile retrieved successfully",
+		Data:    profile,
+	})
+}
+
+// UpdateCompletenessProfile replaces the completeness profile of a company
+// @Summary Update completeness profile
+// @Description Replace the completeness profile batches of a company are scored against
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param companyId path string true "Company ID"
+// @Param request body CompletenessProfileRequest true "Profile"
+// @Success 200 {object} SuccessResponse{data=completeness.Profile}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/completeness-profile [put]
+func UpdateCompletenessProfile(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+	var req CompletenessProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.ReadingIntervalHours < 1 || req.ReadingIntervalHours > 720 {
+		return fiber.NewError(fiber.StatusBadRequest, "reading_interval_hours must be between 1 and 720")
+	}
+	if req.NudgeThreshold < 0 || req.NudgeThreshold > 100 {
+		return fiber.NewError(fiber.StatusBadRequest, "nudge_threshold must be between 0 and 100")
+	}
+	for _, stage := range req.Stages {
+		if len(stage.EventTypes) == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "Every stage needs at least one event type")
+		}
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	profile, err := completeness.SaveProfile(completeness.Profile{
+		CompanyID:            companyID,
+		RequiredDocuments:    req.RequiredDocuments,
+		ReadingIntervalHours: req.ReadingIntervalHours,
+		Stages:               req.Stages,
+		NudgeThreshold:       req.NudgeThreshold,
+	}, userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save completeness profile")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Completeness profile updated successfully",
+		Data:    profile,
+	})
+}
+
+// ResetCompletenessProfile deletes the completeness profile of a company
+// @Summary Reset completeness profile
+// @Description Delete the completeness profile of a company, whose batches are then scored against the default profile
+// @Tags companies
+// @Produce json
+// @Param companyId path string true "Company ID"
+// @Success 200 {object} SuccessResponse{data=completeness.Profile}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/completeness-profile [delete]
+func ResetCompletenessProfile(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+
+	if err := completeness.ResetProfile(companyID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to reset completeness profile")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Completeness profile reset to the default",
+		Data:    completeness.DefaultProfile(companyID),
+	})
+}
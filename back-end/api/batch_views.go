@@ -0,0 +1,544 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// batchListFilterKeys are the query parameters of the batch list that a view can save
+var batchListFilterKeys = []string{
+	"status", "species", "hatchery_id", "company_id", "created_from", "created_to", "has_certificate", "missing_certificate",
+}
+
+// BatchListFilter narrows the batch list
+type BatchListFilter struct {
+	Statuses           []string
+	Species            string
+	HatcheryID         int
+	CompanyID          int
+	CreatedFrom        *time.Time
+	CreatedTo          *time.Time
+	HasCertificate     string
+	MissingCertificate string
+}
+
+// parseBatchListFilter reads filter parameters; unknown parameters are an error
+func parseBatchListFilter(params map[string]string) (BatchListFilter, error) {
+	var filter BatchListFilter
+	for key, value := range params {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		switch key {
+		case "status":
+			for _, status := range strings.Split(value, ",") {
+				if status = strings.TrimSpace(status); status != "" {
+					filter.Statuses = append(filter.Statuses, status)
+				}
+			}
+		case "species":
+			filter.Species = value
+		case "hatchery_id", "company_id":
+			id, err := strconv.Atoi(value)
+			if err != nil || id <= 0 {
+				return filter, fmt.Errorf("%s must be a positive number", key)
+			}
+			if key == "hatchery_id" {
+				filter.HatcheryID = id
+			} else {
+				filter.CompanyID = id
+			}
+		case "created_from", "created_to":
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be a date (YYYY-MM-DD)", key)
+			}
+			if key == "created_from" {
+				filter.CreatedFrom = &date
+			} else {
+				date = date.AddDate(0, 0, 1)
+				filter.CreatedTo = &date
+			}
+		case "has_certificate":
+			filter.HasCertificate = value
+		case "missing_certificate":
+			filter.MissingCertificate = value
+		default:
+			return filter, fmt.Errorf("unknown filter %q", key)
+		}
+	}
+	return filter, nil
+}
+
+// where returns the conditions of the filter on batch b, appending their arguments
+func (f BatchListFilter) where(args *[]interface{}) string {
+	var conditions []string
+	add := func(condition string, value interface{}) {
+		*args = append(*args, value)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(*args))))
+	}
+	if len(f.Statuses) > 0 {
+		add("b.status = ANY(string_to_array(?::text, ','))", strings.Join(f.Statuses, ","))
+	}
+	if f.Species != "" {
+		add("LOWER(b.species) = LOWER(?::text)", f.Species)
+	}
+	if f.HatcheryID != 0 {
+		add("b.hatchery_id = ?::int", f.HatcheryID)
+	}
+	if f.CompanyID != 0 {
+		add(batchOwnerCompany+" = ?::int", f.CompanyID)
+	}
+	if f.CreatedFrom != nil {
+		add("b.created_at >= ?::timestamp", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		add("b.created_at < ?::timestamp", *f.CreatedTo)
+	}
+	validCertificate := `SELECT 1 FROM certificates ct
+		WHERE ct.batch_id = b.id AND LOWER(ct.certificate_type) = LOWER(?::text) AND ct.status = 'valid'
+			AND ct.is_active = true AND (ct.expiry_date IS NULL OR ct.expiry_date > NOW())`
+	if f.HasCertificate != "" {
+		add("EXISTS ("+validCertificate+")", f.HasCertificate)
+	}
+	if f.MissingCertificate != "" {
+		add("NOT EXISTS ("+validCertificate+")", f.MissingCertificate)
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " AND " + strings.Join(conditions, " AND ")
+}
+
+// batchListParams collects the filter parameters of the batch list request, applied over a saved view
+func batchListParams(c *fiber.Ctx) (map[string]string, error) {
+	params := map[string]string{}
+	if raw := c.Query("view"); raw != "" {
+		viewID, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid view ID format")
+		}
+		view, err := loadBatchView(c, viewID)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range view.Filters {
+			params[key] = value
+		}
+	}
+	for _, key := range batchListFilterKeys {
+		if value, ok := c.Queries()[key]; ok {
+			params[key] = value
+		}
+	}
+	return params, nil
+}
+
+// BatchView is a saved filter of the batch list
+type BatchView struct {
+	ID        int               `json:"id"`
+	Name      string            `json:"name"`
+	CompanyID *int              `json:"company_id,omitempty"`
+	OwnerID   *int              `json:"owner_id,omitempty"`
+	Filters   map[string]string `json:"filters"`
+	IsShared  bool              `json:"is_shared"`  // Visible to everyone in the owner's company
+	IsDefault bool              `json:"is_default"` // Default view of the requesting user
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// SaveBatchViewRequest creates or replaces a saved view
+type SaveBatchViewRequest struct {
+	Name      string            `json:"name"`
+	Filters   map[string]string `json:"filters"` // Query parameters of GET /batches, e.g. {"status": "active", "missing_certificate": "health"}
+	IsShared  bool              `json:"is_shared"`
+	IsDefault bool              `json:"is_default"`
+}
+
+// batchViewColumns selects a view for the user in $1
+const batchViewColumns = `
+	v.id, v.name, v.company_id, v.owner_id, v.filters, v.is_shared,
+	EXISTS(SELECT 1 FROM batch_view_default d WHERE d.user_id = $1 AND d.view_id = v.id),
+	v.created_at, v.updated_at
+`
+
+// batchViewVisible limits views to those the user in $1 owns or that are shared with company $2
+const batchViewVisible = `v.is_active = true AND (v.owner_id = $1 OR (v.is_shared = true AND v.company_id = $2))`
+
+// scanBatchView reads a row selected with batchViewColumns
+func scanBatchView(row rowScanner) (BatchView, error) {
+	var view BatchView
+	var companyID, ownerID sql.NullInt64
+	var filters []byte
+	err := row.Scan(&view.ID, &view.Name, &companyID, &ownerID, &filters, &view.IsShared, &view.IsDefault,
+		&view.CreatedAt, &view.UpdatedAt)
+	if err != nil {
+		return view, err
+	}
+	view.CompanyID = intPtr(companyID)
+	view.OwnerID = intPtr(ownerID)
+	view.Filters = map[string]string{}
+	json.Unmarshal(filters, &view.Filters)
+	return view, nil
+}
+
+// loadBatchView loads a view visible to the current user
+func loadBatchView(c *fiber.Ctx, viewID int) (BatchView, error) {
+	userID, _ := c.Locals("userID").(int)
+	companyID, _ := c.Locals("companyID").(int)
+	view, err := scanBatchView(db.DB.QueryRow(`
+		SELECT `+batchViewColumns+`
+		FROM batch_view v
+		WHERE v.id = $3 AND `+batchViewVisible, userID, companyID, viewID))
+	if err == sql.ErrNoRows {
+		return view, fiber.NewError(fiber.StatusNotFound, "Batch view not found")
+	}
+	if err != nil {
+		return view, fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve batch view")
+	}
+	return view, nil
+}
+
+// loadOwnBatchView loads a view the current user may change: their own, or a shared one for admins
+func loadOwnBatchView(c *fiber.Ctx) (BatchView, int, error) {
+	viewID, err := strconv.Atoi(c.Params("viewId"))
+	if err != nil {
+		return BatchView{}, 0, fiber.NewError(fiber.StatusBadRequest, "Invalid view ID format")
+	}
+	userID, err := currentUserID(c)
+	if err != nil {
+		return BatchView{}, 0, err
+	}
+	view, err := loadBatchView(c, viewID)
+	if err != nil {
+		return view, userID, err
+	}
+	role, _ := c.Locals("role").(string)
+	if (view.OwnerID == nil || *view.OwnerID != userID) && role != "admin" {
+		return view, userID, fiber.NewError(fiber.StatusForbidden, "Only the owner can change this batch view")
+	}
+	return view, userID, nil
+}
+
+// validateBatchViewRequest checks a view before it is saved
+func validateBatchViewRequest(req *SaveBatchViewRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Name is required")
+	}
+	if len(req.Name) > 100 {
+		return fiber.NewError(fiber.StatusBadRequest, "Name must be at most 100 characters")
+	}
+	if req.Filters == nil {
+		req.Filters = map[string]string{}
+	}
+	if _, err := parseBatchListFilter(req.Filters); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid filters: "+err.Error())
+	}
+	return nil
+}
+
+// setDefaultBatchView makes a view the user's default, or clears the default when it was this view
+func setDefaultBatchView(tx *sql.Tx, userID, viewID int, isDefault bool) error {
+	if isDefault {
+		_, err := tx.Exec(`
+			INSERT INTO batch_view_default (user_id, view_id, updated_at) VALUES ($1, $2, NOW())
+			ON CONFLICT (user_id) DO UPDATE SET view_id = EXCLUDED.view_id, updated_at = NOW()
+		`, userID, viewID)
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM batch_view_default WHERE user_id = $1 AND view_id = $2", userID, viewID)
+	return err
+}
+
+// ListBatchViews lists the saved batch views of the current user
+// @Summary List batch views
+// @Description List the saved batch list filters of the current user and those shared within their company. The user's default view is marked with is_default
+// @Tags batches
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]BatchView}
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batch-views [get]
+func ListBatchViews(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(int)
+	companyID, _ := c.Locals("companyID").(int)
+
+	rows, err := db.DB.Query(`
+		SELECT `+batchViewColumns+`
+		FROM batch_view v
+		WHERE `+batchViewVisible+`
+		ORDER BY v.name, v.id
+	`, userID, companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	views := []BatchView{}
+	for rows.Next() {
+		view, err := scanBatchView(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse batch view data")
+		}
+		views = append(views, view)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch views retrieved successfully",
+		Data:    views,
+	})
+}
+
+// GetBatchView gets a saved batch view
+// @Summary Get batch view
+// @Description Get a saved batch list filter. Apply it with GET /batches?view={viewId}
+// @Tags batches
+// @Produce json
+// @Param viewId path string true "View ID"
+// @Success 200 {object} SuccessResponse{data=BatchView}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batch-views/{viewId} [get]
+func GetBatchView(c *fiber.Ctx) error {
+	viewID, err := strconv.Atoi(c.Params("viewId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid view ID format")
+	}
+	view, err := loadBatchView(c, viewID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch view retrieved successfully",
+		Data:    view,
+	})
+}
+
+// CreateBatchView saves a batch view
+// @Summary Create batch view
+// @Description Save a named filter of the batch list, optionally shared with the company and as the user's default view
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param request body SaveBatchViewRequest true "Batch view"
+// @Success 201 {object} SuccessResponse{data=BatchView}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batch-views [post]
+func CreateBatchView(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	companyID, _ := c.Locals("companyID").(int)
+
+	var req SaveBatchViewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateBatchViewRequest(&req); err != nil {
+		return err
+	}
+	filters, _ := json.Marshal(req.Filters)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer tx.Rollback()
+
+	var viewID int
+	err = tx.QueryRow(`
+		INSERT INTO batch_view (name, company_id, owner_id, filters, is_shared, created_at, updated_at, is_active)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, NOW(), NOW(), true)
+		RETURNING id
+	`, req.Name, companyID, userID, string(filters), req.IsShared).Scan(&viewID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save batch view")
+	}
+	if req.IsDefault {
+		if err := setDefaultBatchView(tx, userID, viewID, true); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to set default batch view")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save batch view")
+	}
+
+	view, err := loadBatchView(c, viewID)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch view saved successfully",
+		Data:    view,
+	})
+}
+
+// UpdateBatchView replaces a saved batch view
+// @Summary Update batch view
+// @Description Rename a saved view, change its filters or sharing, or make it the user's default. Only the owner or an admin can change a view
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param viewId path string true "View ID"
+// @Param request body SaveBatchViewRequest true "Batch view"
+// @Success 200 {object} SuccessResponse{data=BatchView}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batch-views/{viewId} [put]
+func UpdateBatchView(c *fiber.Ctx) error {
+	view, userID, err := loadOwnBatchView(c)
+	if err != nil {
+		return err
+	}
+
+	var req SaveBatchViewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateBatchViewRequest(&req); err != nil {
+		return err
+	}
+	filters, _ := json.Marshal(req.Filters)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE batch_view SET name = $2, filters = $3, is_shared = $4, updated_at = NOW() WHERE id = $1
+	`, view.ID, req.Name, string(filters), req.IsShared); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update batch view")
+	}
+	if err := setDefaultBatchView(tx, userID, view.ID, req.IsDefault); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to set default batch view")
+	}
+	if !req.IsShared {
+		// Other users lose access to a view that is no longer shared
+		if _, err := tx.Exec("DELETE FROM batch_view_default WHERE view_id = $1 AND user_id <> $2", view.ID, userID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update batch view")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update batch view")
+	}
+
+	view, err = loadBatchView(c, view.ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch view updated successfully",
+		Data:    view,
+	})
+}
+
+// SetDefaultBatchView makes a view the default batch view of the current user
+// @Summary Set default batch view
+// @Description Make a saved view, including one shared within the company, the default batch view of the current user
+// @Tags batches
+// @Produce json
+// @Param viewId path string true "View ID"
+// @Success 200 {object} SuccessResponse{data=BatchView}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batch-views/{viewId}/default [post]
+func SetDefaultBatchView(c *fiber.Ctx) error {
+	viewID, err := strconv.Atoi(c.Params("viewId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid view ID format")
+	}
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	if _, err := loadBatchView(c, viewID); err != nil {
+		return err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer tx.Rollback()
+	if err := setDefaultBatchView(tx, userID, viewID, true); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to set default batch view")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to set default batch view")
+	}
+
+	view, err := loadBatchView(c, viewID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Default batch view set successfully",
+		Data:    view,
+	})
+}
+
+// DeleteBatchView deletes a saved batch view
+// @Summary Delete batch view
+// @Description Delete a saved view. Only the owner or an admin can delete a view
+// @Tags batches
+// @Produce json
+// @Param viewId path string true "View ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batch-views/{viewId} [delete]
+func DeleteBatchView(c *fiber.Ctx) error {
+	view, _, err := loadOwnBatchView(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.DB.Exec("DELETE FROM batch_view_default WHERE view_id = $1", view.ID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete batch view")
+	}
+	result, err := db.DB.Exec("UPDATE batch_view SET is_active = false, updated_at = NOW() WHERE id = $1 AND is_active = true", view.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete batch view")
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Batch view not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch view deleted successfully",
+	})
+}
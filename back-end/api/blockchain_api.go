@@ -1,6 +1,7 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -25,6 +26,26 @@ type SearchBlockchainRecordsRequest struct {
 	Limit         int    `json:"limit"`
 }
 
+// BlockchainConfirmation is the finality state of an anchored record as tracked by the indexer
+type BlockchainConfirmation struct {
+	Status        string
+	Confirmations int64
+	BlockNumber   sql.NullInt64
+}
+
+// toMap renders the confirmation state for record responses
+func (c BlockchainConfirmation) toMap() map[string]interface{} {
+	result := map[string]interface{}{
+		"status":        c.Status,
+		"confirmations": c.Confirmations,
+		"is_final":      c.Status == blockchain.ConfirmationFinalized,
+	}
+	if c.BlockNumber.Valid {
+		result["block_number"] = c.BlockNumber.Int64
+	}
+	return result
+}
+
 // SearchBlockchainRecords searches blockchain records based on criteria
 // @Summary Search blockchain records
 // @Description Search for blockchain records based on specified criteria
@@ -53,7 +74,8 @@ func SearchBlockchainRecords(c *fiber.Ctx) error {
 	// Build query parameters
 	var params []interface{}
 	query := `
-		SELECT br.id, br.related_table, br.related_id, br.tx_id, br.metadata_hash, br.created_at 
+		SELECT br.id, br.related_table, br.related_id, br.tx_id, br.metadata_hash, br.created_at,
+		       COALESCE(br.confirmation_status, 'pending'), COALESCE(br.confirmations, 0), br.block_number
 		FROM blockchain_record br
 		WHERE br.is_active = true
 	`
@@ -111,8 +133,10 @@ func SearchBlockchainRecords(c *fiber.Ctx) error {
 		var id, relatedID int
 		var relatedTable, txID, metadataHash string
 		var createdAt time.Time
+		var confirmation BlockchainConfirmation
 
-		if err := rows.Scan(&id, &relatedTable, &relatedID, &txID, &metadataHash, &createdAt); err != nil {
+		if err := rows.Scan(&id, &relatedTable, &relatedID, &txID, &metadataHash, &createdAt,
+			&confirmation.Status, &confirmation.Confirmations, &confirmation.BlockNumber); err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse blockchain record")
 		}
 
@@ -123,6 +147,7 @@ func SearchBlockchainRecords(c *fiber.Ctx) error {
 			"tx_id":         txID,
 			"metadata_hash": metadataHash,
 			"created_at":    createdAt,
+			"confirmation":  confirmation.toMap(),
 		}
 
 		// For batch-related records, include additional batch info
@@ -230,7 +255,8 @@ func GetBlockchainVerification(c *fiber.Ctx) error {
 
 	// Get all blockchain records for this batch
 	rows, err := db.DB.Query(`
-		SELECT id, related_table, related_id, tx_id, metadata_hash, created_at
+		SELECT id, related_table, related_id, tx_id, metadata_hash, created_at,
+		       COALESCE(confirmation_status, 'pending'), COALESCE(confirmations, 0), block_number
 		FROM blockchain_record
 		WHERE (related_table = 'batch' OR related_table = 'batch_extended' OR related_table = 'batch_status_extended')
 		  AND related_id = $1
@@ -248,8 +274,10 @@ func GetBlockchainVerification(c *fiber.Ctx) error {
 		var id, relatedID int
 		var relatedTable, txID, metadataHash string
 		var createdAt time.Time
+		var confirmation BlockchainConfirmation
 
-		if err := rows.Scan(&id, &relatedTable, &relatedID, &txID, &metadataHash, &createdAt); err != nil {
+		if err := rows.Scan(&id, &relatedTable, &relatedID, &txID, &metadataHash, &createdAt,
+			&confirmation.Status, &confirmation.Confirmations, &confirmation.BlockNumber); err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse blockchain record")
 		}
 
@@ -259,6 +287,7 @@ func GetBlockchainVerification(c *fiber.Ctx) error {
 			"tx_id":         txID,
 			"metadata_hash": metadataHash,
 			"created_at":    createdAt,
+			"confirmation":  confirmation.toMap(),
 		})
 	}
 
@@ -341,7 +370,7 @@ func BatchBlockchainAudit(c *fiber.Ctx) error {
 	// Get blockchain data
 	blockchainData, err := blockchainClient.GetBatchBlockchainData(batchIDStr)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Failed to get blockchain data: %v", err))
+		return blockchainFailure("Failed to get blockchain data", err)
 	}
 
 	// Get blockchain transactions
@@ -494,7 +523,7 @@ func DeployLogisticsTraceabilityContract(c *fiber.Ctx) error {
 		req.InitArgs,
 	)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to deploy contract: "+err.Error())
+		return blockchainFailure("Failed to deploy contract", err)
 	}
 
 	// Return the contract address
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/nodehealth"
+)
+
+// BlockchainNodeHealth is the state of the blockchain nodes with the latest switches and alerts
+type BlockchainNodeHealth struct {
+	nodehealth.Status
+	Events []nodehealth.Event `json:"events"`
+}
+
+// GetBlockchainNodeHealth gets the health of the configured blockchain nodes
+// @Summary Get blockchain node health
+// @Description Get the latest probe of each configured blockchain node, the node clients are sent to, and the latest switches and alerts
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=BlockchainNodeHealth}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/blockchain-nodes [get]
+func GetBlockchainNodeHealth(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	events, err := nodehealth.Events(20)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load blockchain node events")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Blockchain node health retrieved successfully",
+		Data:    BlockchainNodeHealth{Status: nodehealth.Default().Status(), Events: events},
+	})
+}
+
+// GetBlockchainNodeHistory lists recent probes of the blockchain nodes
+// @Summary Get blockchain node probe history
+// @Description List recent probes of the blockchain nodes with latency, block height, sync status and peer count
+// @Tags admin
+// @Produce json
+// @Param node query string false "Only probes of this node URL"
+// @Param limit query int false "Number of probes, 1 to 1000" default(100)
+// @Success 200 {object} SuccessResponse{data=[]nodehealth.Probe}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/blockchain-nodes/history [get]
+func GetBlockchainNodeHistory(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		return fiber.NewError(fiber.StatusBadRequest, "Limit must be between 1 and 1000")
+	}
+
+	probes, err := nodehealth.History(c.Query("node"), limit)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load blockchain node probes")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Blockchain node probes retrieved successfully",
+		Data:    probes,
+	})
+}
+
+// ProbeBlockchainNodes probes the blockchain nodes now
+// @Summary Probe blockchain nodes
+// @Description Probe every configured blockchain node right away, switching clients to a healthy node if needed
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=nodehealth.Status}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/blockchain-nodes/probe [post]
+func ProbeBlockchainNodes(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	prober := nodehealth.Default()
+	if err := prober.RunOnce(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to probe blockchain nodes: "+err.Error())
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Blockchain nodes probed successfully",
+		Data:    prober.Status(),
+	})
+}
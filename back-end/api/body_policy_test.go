@@ -0,0 +1,76 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+// newBodyPolicyTestApp mounts a handler behind the body policies of the API with strict content types
+func newBodyPolicyTestApp(method, path string, handler fiber.Handler) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	api := app.Group("/api/v1")
+	api.Use(bodyPolicies(&config.Config{JSONBodyLimitKB: 1024, UploadBodyLimitMB: 10, StrictContentType: true}).Handler())
+	api.Use(func(c *fiber.Ctx) error {
+		c.Locals("role", "admin")
+		return c.Next()
+	})
+	api.Add(method, path, handler)
+	return app
+}
+
+// multipartRequest builds a multipart request carrying one file field
+func multipartRequest(t *testing.T, method, target, field, filename string, content []byte) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatalf("failed to create form file: %v", err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest(method, target, &body)
+	req.Header.Set(fiber.HeaderContentType, writer.FormDataContentType())
+	return req
+}
+
+// expectErrorResponse sends a request and checks the status and the message of the error response
+func expectErrorResponse(t *testing.T, app *fiber.App, req *http.Request, status int, message string) {
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != status || !strings.Contains(string(body), message) {
+		t.Fatalf("expected %d with %q, got %d: %s", status, message, resp.StatusCode, body)
+	}
+}
+
+func TestQRBrandingLogoUploadAcceptsMultipart(t *testing.T) {
+	app := newBodyPolicyTestApp(fiber.MethodPut, "/companies/:companyId/qr-branding/logo", UploadQRBrandingLogo)
+
+	// The upload reaches the handler, which rejects the file for not being an image
+	req := multipartRequest(t, fiber.MethodPut, "/api/v1/companies/1/qr-branding/logo", "logo", "logo.png", []byte("not an image"))
+	expectErrorResponse(t, app, req, fiber.StatusBadRequest, "logo must be a PNG or JPEG image")
+
+	// JSON bodies are still refused on the upload route
+	req = httptest.NewRequest(fiber.MethodPut, "/api/v1/companies/1/qr-branding/logo", strings.NewReader(`{}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	expectErrorResponse(t, app, req, fiber.StatusUnsupportedMediaType, "multipart/form-data")
+}
+
+func TestEnergyImportAcceptsMultipart(t *testing.T) {
+	app := newBodyPolicyTestApp(fiber.MethodPost, "/hatcheries/:hatcheryId/energy/import", ImportEnergyReadings)
+
+	// The CSV reaches the handler, which rejects it for having no data rows
+	req := multipartRequest(t, fiber.MethodPost, "/api/v1/hatcheries/1/energy/import", "file", "energy.csv", []byte("month,category,kwh\n"))
+	expectErrorResponse(t, app, req, fiber.StatusBadRequest, "File needs a header row and at least one data row")
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/botguard"
+)
+
+// BotProtectionRouteRequest represents a request to protect a public route or stop protecting it
+type BotProtectionRouteRequest struct {
+	Route   string `json:"route"` // trace, feedback or scan
+	Enabled bool   `json:"enabled"`
+}
+
+// IssueBotChallenge issues a challenge to the calling client
+// @Summary Get bot challenge
+// @Description Get a challenge to solve ahead of time, e.g. when a page loads, instead of waiting to be challenged by a protected route.
+// @Description Solve the CAPTCHA with the provider's widget, or the proof-of-work puzzle: find a solution such that SHA-256(challenge + solution) starts with difficulty zero bits.
+// @Tags challenge
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=botguard.ChallengeSpec}
+// @Router /challenge [get]
+func IssueBotChallenge(c *fiber.Ctx) error {
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Challenge issued successfully",
+		Data:    botguard.Default().Issue(botguard.ClientKey(c.IP())),
+	})
+}
+
+// VerifyBotChallenge exchanges a solved challenge for a pass
+// @Summary Verify bot challenge
+// @Description Send a CAPTCHA response token, or a proof-of-work solution with its challenge, and get a pass to send in the X-Bot-Pass header of protected public routes
+// @Tags challenge
+// @Accept json
+// @Produce json
+// @Param request body botguard.Solution true "Solved challenge"
+// @Success 200 {object} SuccessResponse{data=botguard.Pass}
+// @Failure 400 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /challenge/verify [post]
+func VerifyBotChallenge(c *fiber.Ctx) error {
+	var req botguard.Solution
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.CaptchaToken == "" && (req.Challenge == "" || req.Solution == "") {
+		return fiber.NewError(fiber.StatusBadRequest, "Send a captcha token, or a challenge and its solution")
+	}
+
+	pass, err := botguard.Default().Solve(botguard.ClientKey(c.IP()), c.IP(), req)
+	if errors.Is(err, botguard.ErrInvalidChallenge) {
+		return fiber.NewError(fiber.StatusBadRequest, "The challenge is invalid, expired or already solved")
+	}
+	if errors.Is(err, botguard.ErrInvalidSolution) {
+		return fiber.NewError(fiber.StatusBadRequest, "The solution does not solve the challenge")
+	}
+	if err != nil {
+		return dependencyUnavailable("CAPTCHA verification unavailable, solve the proof-of-work challenge instead", err)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Challenge solved successfully",
+		Data:    pass,
+	})
+}
+
+// GetBotProtection gets the state of bot protection on public routes
+// @Summary Get bot protection status
+// @Description Get which public routes challenge bots, with the number of clients challenged, passed and caught by the honeypot
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=botguard.Status}
+// @Failure 403 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/bot-protection [get]
+func GetBotProtection(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Bot protection status retrieved successfully",
+		Data:    botguard.Default().Status(),
+	})
+}
+
+// UpdateBotProtection protects a public route or stops protecting it
+// @Summary Set bot protection of a route
+// @Description Turn bot challenges on or off for a public route (trace, feedback or scan) until the next restart, e.g. during a scraping wave
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body BotProtectionRouteRequest true "Route"
+// @Success 200 {object} SuccessResponse{data=botguard.Status}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/bot-protection [put]
+func UpdateBotProtection(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	var req BotProtectionRouteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	guard := botguard.Default()
+	if err := guard.SetEnabled(req.Route, req.Enabled); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Route must be trace, feedback or scan")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Bot protection updated successfully",
+		Data:    guard.Status(),
+	})
+}
@@ -0,0 +1,926 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// Quarantine statuses of broodstock
+const (
+	QuarantinePending  = "pending"
+	QuarantineActive   = "in_quarantine"
+	QuarantineReleased = "released"
+	QuarantineRejected = "rejected"
+)
+
+// BroodstockEventQuarantine is the broodstock event type that moves an animal through quarantine
+const BroodstockEventQuarantine = "quarantine_status"
+
+// quarantineTransitions lists the statuses each quarantine status can move to
+var quarantineTransitions = map[string][]string{
+	QuarantinePending: {QuarantineActive, QuarantineRejected},
+	QuarantineActive:  {QuarantineReleased, QuarantineRejected},
+}
+
+// BroodstockRequest represents a request to register or update broodstock
+type BroodstockRequest struct {
+	HatcheryID         int        `json:"hatchery_id"`
+	TagCode            string     `json:"tag_code"`
+	Species            string     `json:"species"`
+	Sex                string     `json:"sex"` // male, female, unknown (default)
+	OriginCountry      string     `json:"origin_country"`
+	Supplier           string     `json:"supplier"`
+	GeneticLine        string     `json:"genetic_line"`
+	Generation         int        `json:"generation"`
+	SPFStatus          string     `json:"spf_status"`
+	ImportPermitNumber string     `json:"import_permit_number"`
+	ImportPermitExpiry *time.Time `json:"import_permit_expiry"`
+	AcquiredAt         *time.Time `json:"acquired_at"`
+	Notes              string     `json:"notes"`
+	RegisteredBy       int        `json:"registered_by"` // Account recorded as actor of the registration event
+}
+
+// BroodstockEventRequest represents a request to record a broodstock event
+type BroodstockEventRequest struct {
+	EventType string                 `json:"event_type"`
+	ActorID   int                    `json:"actor_id"`
+	Location  string                 `json:"location"`
+	Metadata  map[string]interface{} `json:"metadata"` // quarantine_status events carry new_status
+}
+
+// LinkBroodstockRequest represents a request to record the broodstock a batch was produced from
+type LinkBroodstockRequest struct {
+	BroodstockIDs []int  `json:"broodstock_ids"`
+	Role          string `json:"role"` // dam, sire or parent (default)
+}
+
+// BroodstockDetail is a broodstock record with its documents, events and batches
+type BroodstockDetail struct {
+	models.Broodstock
+	Documents []models.Document        `json:"documents"`
+	Events    []models.BroodstockEvent `json:"events"`
+	BatchIDs  []int                    `json:"batch_ids"`
+}
+
+// BatchParent is a broodstock record linked to a batch
+type BatchParent struct {
+	models.Broodstock
+	Role string `json:"role"`
+}
+
+const broodstockColumns = `
+	id, COALESCE(hatchery_id, 0), tag_code, COALESCE(species, ''), COALESCE(sex, 'unknown'),
+	COALESCE(origin_country, ''), COALESCE(supplier, ''), COALESCE(genetic_line, ''), COALESCE(generation, 0),
+	COALESCE(spf_status, ''), COALESCE(import_permit_number, ''), import_permit_expiry,
+	COALESCE(quarantine_status, 'pending'), quarantine_started_at, quarantine_released_at, acquired_at,
+	COALESCE(notes, ''), created_at, updated_at, is_active
+`
+
+// scanBroodstock reads a broodstock record selected with broodstockColumns
+func scanBroodstock(row rowScanner) (models.Broodstock, error) {
+	var b models.Broodstock
+	var permitExpiry, quarantineStarted, quarantineReleased, acquiredAt sql.NullTime
+	err := row.Scan(&b.ID, &b.HatcheryID, &b.TagCode, &b.Species, &b.Sex,
+		&b.OriginCountry, &b.Supplier, &b.GeneticLine, &b.Generation,
+		&b.SPFStatus, &b.ImportPermitNumber, &permitExpiry,
+		&b.QuarantineStatus, &quarantineStarted, &quarantineReleased, &acquiredAt,
+		&b.Notes, &b.CreatedAt, &b.UpdatedAt, &b.IsActive)
+	b.ImportPermitExpiry = timePtr(permitExpiry)
+	b.QuarantineStartedAt = timePtr(quarantineStarted)
+	b.QuarantineReleasedAt = timePtr(quarantineReleased)
+	b.AcquiredAt = timePtr(acquiredAt)
+	return b, err
+}
+
+// loadBroodstock loads an active broodstock record
+func loadBroodstock(broodstockID int) (models.Broodstock, error) {
+	return scanBroodstock(db.DB.QueryRow(`SELECT `+broodstockColumns+` FROM broodstock WHERE id = $1 AND is_active = true`, broodstockID))
+}
+
+// validateBroodstockRequest checks the fields of a broodstock request
+func validateBroodstockRequest(req *BroodstockRequest) error {
+	req.TagCode = strings.TrimSpace(req.TagCode)
+	if req.HatcheryID <= 0 || req.TagCode == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Hatchery ID and tag code are required")
+	}
+	if req.Sex == "" {
+		req.Sex = "unknown"
+	}
+	if req.Sex != "male" && req.Sex != "female" && req.Sex != "unknown" {
+		return fiber.NewError(fiber.StatusBadRequest, "Sex must be male, female or unknown")
+	}
+	if req.Generation < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Generation must not be negative")
+	}
+	return nil
+}
+
+// recordBroodstockEvent saves a broodstock event and anchors it on the blockchain
+func recordBroodstockEvent(broodstockID int, req BroodstockEventRequest) (models.BroodstockEvent, error) {
+	if req.Metadata == nil {
+		req.Metadata = map[string]interface{}{}
+	}
+	metadataJSON, err := json.Marshal(req.Metadata)
+	if err != nil {
+		return models.BroodstockEvent{}, err
+	}
+
+	event := models.BroodstockEvent{
+		BroodstockID: broodstockID,
+		EventType:    req.EventType,
+		ActorID:      req.ActorID,
+		Location:     req.Location,
+		Metadata:     models.JSONB(metadataJSON),
+		IsActive:     true,
+	}
+	err = db.DB.QueryRow(`
+		INSERT INTO broodstock_event (broodstock_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active)
+		VALUES ($1, $2, NULLIF($3, 0), $4, NOW(), $5, NOW(), true)
+		RETURNING id, timestamp, updated_at
+	`, broodstockID, event.EventType, event.ActorID, event.Location, event.Metadata).Scan(&event.ID, &event.Timestamp, &event.UpdatedAt)
+	if err != nil {
+		return event, err
+	}
+
+	cfg := config.GetConfig()
+	blockchainClient := blockchain.NewBlockchainClient(
+		cfg.BlockchainNodeURL,
+		cfg.BlockchainPrivateKey,
+		cfg.BlockchainAccount,
+		cfg.BlockchainChainID,
+		cfg.BlockchainConsensus,
+	)
+
+	// The blockchain is secondary to the database, so failures are only logged
+	txID, err := blockchainClient.RecordEvent(
+		"broodstock-"+strconv.Itoa(broodstockID),
+		event.EventType,
+		event.Location,
+		strconv.Itoa(event.ActorID),
+		req.Metadata,
+	)
+	if err != nil {
+		fmt.Printf("Warning: Failed to record broodstock event on blockchain: %v\n", err)
+		return event, nil
+	}
+	metadataHash, err := blockchainClient.HashData(map[string]interface{}{
+		"event_id":      event.ID,
+		"broodstock_id": broodstockID,
+		"event_type":    event.EventType,
+		"location":      event.Location,
+		"actor_id":      event.ActorID,
+		"metadata":      req.Metadata,
+		"timestamp":     event.Timestamp,
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to generate metadata hash: %v\n", err)
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO blockchain_record (related_table, related_id, tx_id, metadata_hash, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NOW(), NOW(), true)
+	`, "broodstock_event", event.ID, txID, metadataHash)
+	if err != nil {
+		fmt.Printf("Warning: Failed to save blockchain record: %v\n", err)
+	}
+	return event, nil
+}
+
+// RegisterBroodstock registers a broodstock animal at a hatchery
+// @Summary Register broodstock
+// @Description Register a broodstock animal with its origin, genetics and import permit. New broodstock starts in pending quarantine
+// @Tags broodstock
+// @Accept json
+// @Produce json
+// @Param request body BroodstockRequest true "Broodstock details"
+// @Success 201 {object} SuccessResponse{data=models.Broodstock}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /broodstock [post]
+func RegisterBroodstock(c *fiber.Ctx) error {
+	var req BroodstockRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateBroodstockRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM hatchery WHERE id = $1 AND is_active = true)", req.HatcheryID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Hatchery not found")
+	}
+
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM broodstock WHERE hatchery_id = $1 AND tag_code = $2)", req.HatcheryID, req.TagCode).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "Broodstock with this tag code is already registered at the hatchery")
+	}
+
+	broodstock, err := scanBroodstock(db.DB.QueryRow(`
+		INSERT INTO broodstock (
+			hatchery_id, tag_code, species, sex, origin_country, supplier, genetic_line, generation, spf_status,
+			import_permit_number, import_permit_expiry, quarantine_status, acquired_at, notes, created_at, updated_at, is_active
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NOW(), NOW(), true)
+		RETURNING `+broodstockColumns,
+		req.HatcheryID, req.TagCode, req.Species, req.Sex, req.OriginCountry, req.Supplier, req.GeneticLine, req.Generation, req.SPFStatus,
+		req.ImportPermitNumber, req.ImportPermitExpiry, QuarantinePending, req.AcquiredAt, req.Notes))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to register broodstock")
+	}
+
+	_, err = recordBroodstockEvent(broodstock.ID, BroodstockEventRequest{
+		EventType: "registered",
+		ActorID:   req.RegisteredBy,
+		Metadata: map[string]interface{}{
+			"tag_code":             broodstock.TagCode,
+			"origin_country":       broodstock.OriginCountry,
+			"genetic_line":         broodstock.GeneticLine,
+			"import_permit_number": broodstock.ImportPermitNumber,
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to record broodstock registration event: %v\n", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Broodstock registered successfully",
+		Data:    broodstock,
+	})
+}
+
+// GetAllBroodstock lists broodstock
+// @Summary Get all broodstock
+// @Description List broodstock, optionally filtered by hatchery and quarantine status
+// @Tags broodstock
+// @Produce json
+// @Param hatchery_id query int false "Hatchery ID"
+// @Param quarantine_status query string false "Quarantine status (pending, in_quarantine, released, rejected)"
+// @Success 200 {object} SuccessResponse{data=[]models.Broodstock}
+// @Failure 500 {object} ErrorResponse
+// @Router /broodstock [get]
+func GetAllBroodstock(c *fiber.Ctx) error {
+	rows, err := db.DB.Query(`SELECT `+broodstockColumns+`
+		FROM broodstock
+		WHERE is_active = true
+			AND ($1::int = 0 OR hatchery_id = $1)
+			AND ($2::text = '' OR quarantine_status = $2)
+		ORDER BY created_at DESC
+	`, c.QueryInt("hatchery_id", 0), c.Query("quarantine_status"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	broodstock := []models.Broodstock{}
+	for rows.Next() {
+		b, err := scanBroodstock(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse broodstock data")
+		}
+		broodstock = append(broodstock, b)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Broodstock retrieved successfully",
+		Data:    broodstock,
+	})
+}
+
+// GetBroodstockByID gets a broodstock record with its documents, events and batches
+// @Summary Get broodstock by ID
+// @Description Get a broodstock record with its documents, events and the batches it produced
+// @Tags broodstock
+// @Produce json
+// @Param broodstockId path int true "Broodstock ID"
+// @Success 200 {object} SuccessResponse{data=BroodstockDetail}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /broodstock/{broodstockId} [get]
+func GetBroodstockByID(c *fiber.Ctx) error {
+	broodstockID, err := strconv.Atoi(c.Params("broodstockId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid broodstock ID format")
+	}
+
+	broodstock, err := loadBroodstock(broodstockID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Broodstock not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	detail := BroodstockDetail{Broodstock: broodstock, BatchIDs: []int{}}
+	docLevels, err := visibleBroodstockDocumentLevels(c, broodstockID)
+	if err != nil {
+		return err
+	}
+	if detail.Documents, err = loadBroodstockDocuments(broodstockID, docLevels); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve broodstock documents")
+	}
+	if detail.Events, err = loadBroodstockEvents(broodstockID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve broodstock events")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT bb.batch_id
+		FROM batch_broodstock bb
+		JOIN batch b ON b.id = bb.batch_id
+		WHERE bb.broodstock_id = $1 AND b.is_active = true
+		ORDER BY bb.batch_id
+	`, broodstockID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve broodstock batches")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var batchID int
+		if err := rows.Scan(&batchID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse broodstock batches")
+		}
+		detail.BatchIDs = append(detail.BatchIDs, batchID)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Broodstock retrieved successfully",
+		Data:    detail,
+	})
+}
+
+// UpdateBroodstock updates the origin, genetics and permit of a broodstock record
+// @Summary Update broodstock
+// @Description Update a broodstock record. The hatchery and quarantine status cannot be changed here; quarantine moves through events
+// @Tags broodstock
+// @Accept json
+// @Produce json
+// @Param broodstockId path int true "Broodstock ID"
+// @Param request body BroodstockRequest true "Broodstock details"
+// @Success 200 {object} SuccessResponse{data=models.Broodstock}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /broodstock/{broodstockId} [put]
+func UpdateBroodstock(c *fiber.Ctx) error {
+	broodstockID, err := strconv.Atoi(c.Params("broodstockId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid broodstock ID format")
+	}
+
+	current, err := loadBroodstock(broodstockID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Broodstock not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	var req BroodstockRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.HatcheryID = current.HatcheryID
+	if err := validateBroodstockRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM broodstock WHERE hatchery_id = $1 AND tag_code = $2 AND id <> $3)",
+		current.HatcheryID, req.TagCode, broodstockID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "Broodstock with this tag code is already registered at the hatchery")
+	}
+
+	broodstock, err := scanBroodstock(db.DB.QueryRow(`
+		UPDATE broodstock
+		SET tag_code = $2, species = $3, sex = $4, origin_country = $5, supplier = $6, genetic_line = $7,
+			generation = $8, spf_status = $9, import_permit_number = $10, import_permit_expiry = $11,
+			acquired_at = $12, notes = $13, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+broodstockColumns,
+		broodstockID, req.TagCode, req.Species, req.Sex, req.OriginCountry, req.Supplier, req.GeneticLine,
+		req.Generation, req.SPFStatus, req.ImportPermitNumber, req.ImportPermitExpiry, req.AcquiredAt, req.Notes))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update broodstock")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Broodstock updated successfully",
+		Data:    broodstock,
+	})
+}
+
+// DeleteBroodstock soft deletes a broodstock record
+// @Summary Delete broodstock
+// @Description Soft delete a broodstock record. Links to the batches it produced are kept
+// @Tags broodstock
+// @Produce json
+// @Param broodstockId path int true "Broodstock ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /broodstock/{broodstockId} [delete]
+func DeleteBroodstock(c *fiber.Ctx) error {
+	broodstockID, err := strconv.Atoi(c.Params("broodstockId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid broodstock ID format")
+	}
+
+	result, err := db.DB.Exec("UPDATE broodstock SET is_active = false, updated_at = NOW() WHERE id = $1 AND is_active = true", broodstockID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete broodstock")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Broodstock not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Broodstock deleted successfully",
+	})
+}
+
+// loadBroodstockEvents loads the events of a broodstock record, oldest first
+func loadBroodstockEvents(broodstockID int) ([]models.BroodstockEvent, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, broodstock_id, COALESCE(event_type, ''), COALESCE(actor_id, 0), COALESCE(location, ''),
+			timestamp, COALESCE(metadata, '{}'), updated_at, is_active
+		FROM broodstock_event
+		WHERE broodstock_id = $1 AND is_active = true
+		ORDER BY timestamp
+	`, broodstockID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.BroodstockEvent{}
+	for rows.Next() {
+		var e models.BroodstockEvent
+		if err := rows.Scan(&e.ID, &e.BroodstockID, &e.EventType, &e.ActorID, &e.Location,
+			&e.Timestamp, &e.Metadata, &e.UpdatedAt, &e.IsActive); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// GetBroodstockEvents gets the events of a broodstock record
+// @Summary Get broodstock events
+// @Description Get the events of a broodstock record, oldest first
+// @Tags broodstock
+// @Produce json
+// @Param broodstockId path int true "Broodstock ID"
+// @Success 200 {object} SuccessResponse{data=[]models.BroodstockEvent}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /broodstock/{broodstockId}/events [get]
+func GetBroodstockEvents(c *fiber.Ctx) error {
+	broodstockID, err := strconv.Atoi(c.Params("broodstockId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid broodstock ID format")
+	}
+
+	events, err := loadBroodstockEvents(broodstockID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve broodstock events")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Broodstock events retrieved successfully",
+		Data:    events,
+	})
+}
+
+// CreateBroodstockEvent records an event of a broodstock record
+// @Summary Create broodstock event
+// @Description Record an event of a broodstock record (e.g. health check, spawning). quarantine_status events with metadata.new_status move the animal through quarantine
+// @Tags broodstock
+// @Accept json
+// @Produce json
+// @Param broodstockId path int true "Broodstock ID"
+// @Param request body BroodstockEventRequest true "Event details"
+// @Success 201 {object} SuccessResponse{data=models.BroodstockEvent}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /broodstock/{broodstockId}/events [post]
+func CreateBroodstockEvent(c *fiber.Ctx) error {
+	broodstockID, err := strconv.Atoi(c.Params("broodstockId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid broodstock ID format")
+	}
+
+	var req BroodstockEventRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.EventType == "" || req.Location == "" || req.ActorID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Event type, location, and actor ID are required")
+	}
+
+	broodstock, err := loadBroodstock(broodstockID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Broodstock not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM account WHERE id = $1 AND is_active = true)", req.ActorID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Actor not found")
+	}
+
+	// Check the quarantine move before anything is recorded
+	newStatus := ""
+	if req.EventType == BroodstockEventQuarantine {
+		newStatus, _ = req.Metadata["new_status"].(string)
+		allowed := false
+		for _, next := range quarantineTransitions[broodstock.QuarantineStatus] {
+			allowed = allowed || next == newStatus
+		}
+		if !allowed {
+			return fiber.NewError(fiber.StatusBadRequest,
+				fmt.Sprintf("Broodstock in quarantine status %s cannot move to %q", broodstock.QuarantineStatus, newStatus))
+		}
+		req.Metadata["previous_status"] = broodstock.QuarantineStatus
+	}
+
+	event, err := recordBroodstockEvent(broodstockID, req)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save broodstock event")
+	}
+
+	if newStatus != "" {
+		_, err = db.DB.Exec(`
+			UPDATE broodstock
+			SET quarantine_status = $2,
+				quarantine_started_at = CASE WHEN $2 = 'in_quarantine' THEN $3 ELSE quarantine_started_at END,
+				quarantine_released_at = CASE WHEN $2 = 'released' THEN $3 ELSE quarantine_released_at END,
+				updated_at = NOW()
+			WHERE id = $1
+		`, broodstockID, newStatus, event.Timestamp)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update quarantine status")
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Broodstock event recorded successfully",
+		Data:    event,
+	})
+}
+
+// loadBroodstockDocuments loads the documents of a broodstock record of the sensitivity levels in docLevels
+func loadBroodstockDocuments(broodstockID int, docLevels interface{}) ([]models.Document, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, COALESCE(doc_type, ''), COALESCE(ipfs_hash, ''), COALESCE(ipfs_uri, ''), COALESCE(file_name, ''),
+			COALESCE(file_size, 0), COALESCE(uploaded_by, 0), uploaded_at, updated_at, is_active, sensitivity
+		FROM document
+		WHERE broodstock_id = $1 AND is_active = true`+documentSensitivityFilter("", 2)+`
+		ORDER BY uploaded_at DESC
+	`, broodstockID, docLevels)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []models.Document{}
+	for rows.Next() {
+		var d models.Document
+		if err := rows.Scan(&d.ID, &d.DocType, &d.IPFSHash, &d.IPFSURI, &d.FileName,
+			&d.FileSize, &d.UploadedBy, &d.UploadedAt, &d.UpdatedAt, &d.IsActive, &d.Sensitivity); err != nil {
+			return nil, err
+		}
+		documents = append(documents, d)
+	}
+	return documents, rows.Err()
+}
+
+// GetBroodstockDocuments gets the documents of a broodstock record
+// @Summary Get broodstock documents
+// @Description Get the import permits, health certificates and other documents of a broodstock record
+// @Tags broodstock
+// @Produce json
+// @Param broodstockId path int true "Broodstock ID"
+// @Success 200 {object} SuccessResponse{data=[]models.Document}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /broodstock/{broodstockId}/documents [get]
+func GetBroodstockDocuments(c *fiber.Ctx) error {
+	broodstockID, err := strconv.Atoi(c.Params("broodstockId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid broodstock ID format")
+	}
+
+	docLevels, err := visibleBroodstockDocumentLevels(c, broodstockID)
+	if err != nil {
+		return err
+	}
+	documents, err := loadBroodstockDocuments(broodstockID, docLevels)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve broodstock documents")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Broodstock documents retrieved successfully",
+		Data:    documents,
+	})
+}
+
+// UploadBroodstockDocument uploads a document of a broodstock record to IPFS
+// @Summary Upload broodstock document
+// @Description Upload an import permit, health certificate or other document of a broodstock record to IPFS
+// @Tags broodstock
+// @Accept multipart/form-data
+// @Produce json
+// @Param broodstockId path int true "Broodstock ID"
+// @Param doc_type formData string true "Document type (e.g. import_permit, health_certificate, genetic_certificate)"
+// @Param uploaded_by formData int false "Uploader account ID"
+// @Param file formData file true "Document file"
+// @Success 201 {object} SuccessResponse{data=models.Document}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /broodstock/{broodstockId}/documents [post]
+func UploadBroodstockDocument(c *fiber.Ctx) error {
+	broodstockID, err := strconv.Atoi(c.Params("broodstockId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid broodstock ID format")
+	}
+
+	broodstock, err := loadBroodstock(broodstockID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Broodstock not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	docType := c.FormValue("doc_type")
+	if docType == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Document type is required")
+	}
+	uploaderID := 0
+	if v := c.FormValue("uploaded_by"); v != "" {
+		if uploaderID, err = strconv.Atoi(v); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid uploader ID format")
+		}
+	}
+
+	sensitivity, err := uploadedDocumentSensitivity(c.FormValue("sensitivity"), docType)
+	if err != nil {
+		return err
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "File is required")
+	}
+	if file.Size > 10*1024*1024 {
+		return fiber.NewError(fiber.StatusBadRequest, "File size exceeds 10MB limit")
+	}
+	fileHandle, err := file.Open()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to open file")
+	}
+	defer fileHandle.Close()
+
+	result, placement, err := uploadDocumentFile(companyOfHatchery(broodstock.HatcheryID), fileHandle, file.Filename, map[string]string{
+		"broodstock_id": strconv.Itoa(broodstockID),
+		"tag_code":      broodstock.TagCode,
+		"document_type": docType,
+		"app":           "TracePost-larvaeChain",
+		"timestamp":     time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		if isRequestError(err) {
+			return err
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to upload document: "+err.Error())
+	}
+	uri := result.IPFSUri
+	if result.PinataSuccess && result.PinataUri != "" {
+		uri = result.PinataUri
+	}
+
+	document := models.Document{
+		DocType:    docType,
+		IPFSHash:   result.CID,
+		IPFSURI:    uri,
+		FileName:   result.Name,
+		FileSize:   result.Size,
+		UploadedBy:  uploaderID,
+		Sensitivity: sensitivity,
+		StorageRegion:  placement.Region,
+		StorageBackend: placement.Backend,
+		RegionLocked:   placement.Locked,
+		IsActive:    true,
+	}
+	err = db.DB.QueryRow(`
+		INSERT INTO document (broodstock_id, doc_type, ipfs_hash, ipfs_uri, file_name, file_size, uploaded_by, sensitivity, storage_region, storage_backend, region_locked, uploaded_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), $8, $9, $10, $11, NOW(), NOW(), true)
+		RETURNING id, uploaded_at, updated_at
+	`, broodstockID, docType, document.IPFSHash, document.IPFSURI, document.FileName, document.FileSize, uploaderID, sensitivity,
+		placement.Region, placement.Backend, placement.Locked).
+		Scan(&document.ID, &document.UploadedAt, &document.UpdatedAt)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save document")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Broodstock document uploaded successfully",
+		Data:    document,
+	})
+}
+
+// loadBatchParents loads the broodstock a batch was produced from
+func loadBatchParents(batchID int) ([]BatchParent, error) {
+	rows, err := db.DB.Query(`SELECT `+broodstockColumns+`,
+			COALESCE((SELECT role FROM batch_broodstock WHERE batch_id = $1 AND broodstock_id = broodstock.id), 'parent')
+		FROM broodstock
+		WHERE id IN (SELECT broodstock_id FROM batch_broodstock WHERE batch_id = $1)
+		ORDER BY tag_code
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := []BatchParent{}
+	for rows.Next() {
+		var p BatchParent
+		if p.Broodstock, err = scanBroodstock(withExtraColumns{rows, []interface{}{&p.Role}}); err != nil {
+			return nil, err
+		}
+		parents = append(parents, p)
+	}
+	return parents, rows.Err()
+}
+
+// withExtraColumns scans columns selected after a shared column list
+type withExtraColumns struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (w withExtraColumns) Scan(dest ...interface{}) error {
+	return w.row.Scan(append(dest, w.extra...)...)
+}
+
+// GetBatchBroodstock gets the broodstock a batch was produced from
+// @Summary Get batch broodstock
+// @Description Get the broodstock a batch was produced from, one generation upstream
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]BatchParent}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/broodstock [get]
+func GetBatchBroodstock(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	parents, err := loadBatchParents(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve batch broodstock")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch broodstock retrieved successfully",
+		Data:    parents,
+	})
+}
+
+// LinkBatchBroodstock records the broodstock a batch was produced from
+// @Summary Link broodstock to batch
+// @Description Record the broodstock a batch was produced from. Broodstock must belong to the batch's hatchery and be released from quarantine
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param request body LinkBroodstockRequest true "Broodstock to link"
+// @Success 201 {object} SuccessResponse{data=[]BatchParent}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/broodstock [post]
+func LinkBatchBroodstock(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	var req LinkBroodstockRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if len(req.BroodstockIDs) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one broodstock ID is required")
+	}
+	if req.Role == "" {
+		req.Role = "parent"
+	}
+	if req.Role != "dam" && req.Role != "sire" && req.Role != "parent" {
+		return fiber.NewError(fiber.StatusBadRequest, "Role must be dam, sire or parent")
+	}
+
+	var hatcheryID int
+	err = db.DB.QueryRow("SELECT COALESCE(hatchery_id, 0) FROM batch WHERE id = $1 AND is_active = true", batchID).Scan(&hatcheryID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	for _, broodstockID := range req.BroodstockIDs {
+		broodstock, err := loadBroodstock(broodstockID)
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Broodstock %d not found", broodstockID))
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if broodstock.HatcheryID != hatcheryID {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Broodstock %s belongs to another hatchery", broodstock.TagCode))
+		}
+		if broodstock.QuarantineStatus != QuarantineReleased {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Broodstock %s has not been released from quarantine", broodstock.TagCode))
+		}
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	for _, broodstockID := range req.BroodstockIDs {
+		_, err = tx.Exec(`
+			INSERT INTO batch_broodstock (batch_id, broodstock_id, role, created_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (batch_id, broodstock_id) DO UPDATE SET role = EXCLUDED.role
+		`, batchID, broodstockID, req.Role)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to link broodstock")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit broodstock links")
+	}
+
+	parents, err := loadBatchParents(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve batch broodstock")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Broodstock linked to batch successfully",
+		Data:    parents,
+	})
+}
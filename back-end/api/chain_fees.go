@@ -0,0 +1,415 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/fees"
+)
+
+// ChainBudgetRequest represents a request to set a company's monthly on-chain budget
+type ChainBudgetRequest struct {
+	MonthlyLimit          float64 `json:"monthly_limit"`
+	Currency              string  `json:"currency"`
+	AlertThresholdPercent int     `json:"alert_threshold_percent"`
+	Enforce               *bool   `json:"enforce"`
+}
+
+// ChainBudgetStatus is a company's budget together with its spending in the current period
+type ChainBudgetStatus struct {
+	Budget      *fees.Budget       `json:"budget"`
+	Period      string             `json:"period"`
+	Spent       float64            `json:"spent"`
+	Remaining   float64            `json:"remaining"`
+	PercentUsed float64            `json:"percent_used"`
+	Alerts      []ChainBudgetAlert `json:"alerts"`
+}
+
+// ChainBudgetAlert is an alert raised when a company approaches or exceeds its budget
+type ChainBudgetAlert struct {
+	ID           int       `json:"id"`
+	CompanyID    int       `json:"company_id"`
+	Period       string    `json:"period"`
+	AlertType    string    `json:"alert_type"`
+	Spent        float64   `json:"spent"`
+	MonthlyLimit float64   `json:"monthly_limit"`
+	Currency     string    `json:"currency"`
+	Message      string    `json:"message"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TransactionFeeRecord is the recorded cost of a single on-chain operation
+type TransactionFeeRecord struct {
+	ID           int       `json:"id"`
+	TxID         string    `json:"tx_id"`
+	TxType       string    `json:"tx_type"`
+	CompanyID    *int      `json:"company_id,omitempty"`
+	ChainType    string    `json:"chain_type"`
+	GasUsed      int64     `json:"gas_used"`
+	GasPriceGwei float64   `json:"gas_price_gwei"`
+	Fee          float64   `json:"fee"`
+	Currency     string    `json:"currency"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// FeeReportLine aggregates the fees of one group in a cost report
+type FeeReportLine struct {
+	Key              string  `json:"key"`
+	Currency         string  `json:"currency"`
+	TransactionCount int     `json:"transaction_count"`
+	GasUsed          int64   `json:"gas_used"`
+	TotalFee         float64 `json:"total_fee"`
+}
+
+// FeeReport is the on-chain cost report for a period
+type FeeReport struct {
+	Period    string          `json:"period"`
+	CompanyID int             `json:"company_id,omitempty"`
+	Totals    []FeeReportLine `json:"totals"` // keyed by currency
+	ByTxType  []FeeReportLine `json:"by_tx_type"`
+	ByCompany []FeeReportLine `json:"by_company"`
+}
+
+// GetChainBudget returns a company's on-chain budget and current spending
+// @Summary Get on-chain budget
+// @Description Get the monthly on-chain budget of a company with its spending and alerts for the current month
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param companyId path string true "Company ID"
+// @Success 200 {object} SuccessResponse{data=ChainBudgetStatus}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/chain-budget [get]
+func GetChainBudget(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	budget, err := fees.LoadBudget(companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if budget == nil {
+		return fiber.NewError(fiber.StatusNotFound, "No on-chain budget configured for this company")
+	}
+
+	now := time.Now()
+	spent, err := fees.MonthlySpend(companyID, budget.Currency, now)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to compute spending")
+	}
+
+	status := ChainBudgetStatus{
+		Budget:    budget,
+		Period:    fees.Period(now),
+		Spent:     spent,
+		Remaining: budget.MonthlyLimit - spent,
+	}
+	if status.Remaining < 0 {
+		status.Remaining = 0
+	}
+	if budget.MonthlyLimit > 0 {
+		status.PercentUsed = spent / budget.MonthlyLimit * 100
+	}
+	status.Alerts, err = loadChainBudgetAlerts(companyID, status.Period)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load budget alerts")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "On-chain budget retrieved successfully",
+		Data:    status,
+	})
+}
+
+// SetChainBudget creates or replaces a company's on-chain budget
+// @Summary Set on-chain budget
+// @Description Set the monthly limit on fees a company may spend on on-chain operations
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param companyId path string true "Company ID"
+// @Param request body ChainBudgetRequest true "Budget details"
+// @Success 200 {object} SuccessResponse{data=fees.Budget}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/chain-budget [put]
+func SetChainBudget(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	var req ChainBudgetRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.MonthlyLimit <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "monthly_limit must be positive")
+	}
+	if req.Currency == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "currency is required")
+	}
+	if req.AlertThresholdPercent == 0 {
+		req.AlertThresholdPercent = 80
+	}
+	if req.AlertThresholdPercent < 1 || req.AlertThresholdPercent > 100 {
+		return fiber.NewError(fiber.StatusBadRequest, "alert_threshold_percent must be between 1 and 100")
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", companyID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+
+	budget := fees.Budget{
+		CompanyID:             companyID,
+		MonthlyLimit:          req.MonthlyLimit,
+		Currency:              strings.ToUpper(req.Currency),
+		AlertThresholdPercent: req.AlertThresholdPercent,
+		Enforce:               req.Enforce == nil || *req.Enforce,
+	}
+
+	_, err = db.DB.Exec(`
+		INSERT INTO chain_budget (company_id, monthly_limit, currency, alert_threshold_percent, enforce, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), true)
+		ON CONFLICT (company_id) DO UPDATE
+		SET monthly_limit = EXCLUDED.monthly_limit,
+		    currency = EXCLUDED.currency,
+		    alert_threshold_percent = EXCLUDED.alert_threshold_percent,
+		    enforce = EXCLUDED.enforce,
+		    updated_at = NOW(),
+		    is_active = true
+	`, budget.CompanyID, budget.MonthlyLimit, budget.Currency, budget.AlertThresholdPercent, budget.Enforce)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save on-chain budget")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "On-chain budget saved successfully",
+		Data:    budget,
+	})
+}
+
+// ListTransactionFees lists the recorded fees of on-chain operations
+// @Summary List transaction fees
+// @Description List the gas and fees recorded for on-chain operations, newest first
+// @Tags blockchain
+// @Accept json
+// @Produce json
+// @Param company_id query int false "Filter by company"
+// @Param tx_type query string false "Filter by transaction type"
+// @Param limit query int false "Maximum number of records (default 100, max 1000)"
+// @Success 200 {object} SuccessResponse{data=[]TransactionFeeRecord}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /blockchain/fees [get]
+func ListTransactionFees(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 100)
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	query := `
+		SELECT id, COALESCE(tx_id, ''), COALESCE(tx_type, ''), company_id, COALESCE(chain_type, ''),
+		       COALESCE(gas_used, 0), COALESCE(gas_price_gwei, 0), COALESCE(fee, 0), COALESCE(currency, ''), created_at
+		FROM blockchain_fee
+		WHERE 1 = 1
+	`
+	var params []interface{}
+	if companyID := c.Query("company_id"); companyID != "" {
+		id, err := strconv.Atoi(companyID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid company_id")
+		}
+		params = append(params, id)
+		query += fmt.Sprintf(" AND company_id = $%d", len(params))
+	}
+	if txType := c.Query("tx_type"); txType != "" {
+		params = append(params, txType)
+		query += fmt.Sprintf(" AND tx_type = $%d", len(params))
+	}
+	params = append(params, limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d", len(params))
+
+	rows, err := db.DB.Query(query, params...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	records := []TransactionFeeRecord{}
+	for rows.Next() {
+		var r TransactionFeeRecord
+		var companyID sql.NullInt64
+		if err := rows.Scan(&r.ID, &r.TxID, &r.TxType, &companyID, &r.ChainType,
+			&r.GasUsed, &r.GasPriceGwei, &r.Fee, &r.Currency, &r.CreatedAt); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse fee record")
+		}
+		if companyID.Valid {
+			id := int(companyID.Int64)
+			r.CompanyID = &id
+		}
+		records = append(records, r)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Transaction fees retrieved successfully",
+		Data:    records,
+	})
+}
+
+// GetFeeReport returns the on-chain cost report for a month
+// @Summary Get on-chain cost report
+// @Description Aggregate the fees of on-chain operations for a month by currency, transaction type and company
+// @Tags blockchain
+// @Accept json
+// @Produce json
+// @Param period query string false "Month as YYYY-MM (default current month)"
+// @Param company_id query int false "Restrict the report to a company"
+// @Success 200 {object} SuccessResponse{data=FeeReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /blockchain/fees/report [get]
+func GetFeeReport(c *fiber.Ctx) error {
+	start := time.Now()
+	if period := c.Query("period"); period != "" {
+		parsed, err := time.Parse("2006-01", period)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid period format. Expected YYYY-MM.")
+		}
+		start = parsed
+	}
+	start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.Local)
+
+	report := FeeReport{Period: fees.Period(start)}
+	where := "created_at >= $1 AND created_at < $2"
+	params := []interface{}{start, start.AddDate(0, 1, 0)}
+	if companyID := c.Query("company_id"); companyID != "" {
+		id, err := strconv.Atoi(companyID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid company_id")
+		}
+		report.CompanyID = id
+		params = append(params, id)
+		where += " AND company_id = $3"
+	}
+
+	var err error
+	if report.Totals, err = loadFeeReportLines("COALESCE(currency, '')", where, params); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build cost report")
+	}
+	if report.ByTxType, err = loadFeeReportLines("tx_type", where, params); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build cost report")
+	}
+	if report.ByCompany, err = loadFeeReportLines("COALESCE(company_id::text, 'unattributed')", where, params); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build cost report")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Cost report generated successfully",
+		Data:    report,
+	})
+}
+
+// ListChainBudgetAlerts lists budget alerts
+// @Summary List on-chain budget alerts
+// @Description List the alerts raised when companies approach or exceed their on-chain budget
+// @Tags blockchain
+// @Accept json
+// @Produce json
+// @Param company_id query int false "Filter by company"
+// @Param period query string false "Filter by month (YYYY-MM)"
+// @Success 200 {object} SuccessResponse{data=[]ChainBudgetAlert}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /blockchain/fees/alerts [get]
+func ListChainBudgetAlerts(c *fiber.Ctx) error {
+	companyID := 0
+	if raw := c.Query("company_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid company_id")
+		}
+		companyID = id
+	}
+
+	alerts, err := loadChainBudgetAlerts(companyID, c.Query("period"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Budget alerts retrieved successfully",
+		Data:    alerts,
+	})
+}
+
+// loadFeeReportLines aggregates fees grouped by an SQL expression and currency
+func loadFeeReportLines(groupExpr, where string, params []interface{}) ([]FeeReportLine, error) {
+	rows, err := db.DB.Query(fmt.Sprintf(`
+		SELECT %[1]s, COALESCE(currency, ''), COUNT(*), COALESCE(SUM(gas_used), 0), COALESCE(SUM(fee), 0)
+		FROM blockchain_fee
+		WHERE %[2]s
+		GROUP BY %[1]s, COALESCE(currency, '')
+		ORDER BY 5 DESC
+	`, groupExpr, where), params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []FeeReportLine{}
+	for rows.Next() {
+		var line FeeReportLine
+		if err := rows.Scan(&line.Key, &line.Currency, &line.TransactionCount, &line.GasUsed, &line.TotalFee); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+// loadChainBudgetAlerts loads budget alerts, optionally filtered by company (0 for all) and period
+func loadChainBudgetAlerts(companyID int, period string) ([]ChainBudgetAlert, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, company_id, period, alert_type, COALESCE(spent, 0), COALESCE(monthly_limit, 0),
+		       COALESCE(currency, ''), COALESCE(message, ''), created_at
+		FROM chain_budget_alert
+		WHERE ($1::int = 0 OR company_id = $1::int) AND ($2::text = '' OR period = $2::text)
+		ORDER BY created_at DESC
+	`, companyID, period)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []ChainBudgetAlert{}
+	for rows.Next() {
+		var a ChainBudgetAlert
+		if err := rows.Scan(&a.ID, &a.CompanyID, &a.Period, &a.AlertType, &a.Spent, &a.MonthlyLimit,
+			&a.Currency, &a.Message, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/chains"
+)
+
+// ListExternalChains lists external blockchain networks available for interoperability
+// @Summary List external blockchain networks
+// @Description Get the registered external blockchain networks and their probed capabilities
+// @Tags interoperability
+// @Accept json
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]chains.Chain}
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /interop/chains [get]
+func ListExternalChains(c *fiber.Ctx) error {
+	registered, err := chains.List()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "External chains retrieved successfully",
+		Data:    registered,
+	})
+}
+
+// GetRegisteredChain gets a chain from the registry
+// @Summary Get registered chain
+// @Description Get a registered chain with its capabilities (NFTs, IBC, XCM, smart contracts, finality time)
+// @Tags interoperability
+// @Produce json
+// @Param chainId path string true "Chain ID"
+// @Success 200 {object} SuccessResponse{data=chains.Chain}
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /interop/chains/{chainId} [get]
+func GetRegisteredChain(c *fiber.Ctx) error {
+	chain, err := chains.Get(c.Params("chainId"))
+	if errors.Is(err, chains.ErrChainNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Chain not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Chain retrieved successfully",
+		Data:    chain,
+	})
+}
+
+// ProbeRegisteredChain probes a registered chain again and refreshes its capabilities
+// @Summary Probe registered chain
+// @Description Query a registered chain through its adapter and update its capabilities in the registry
+// @Tags interoperability
+// @Produce json
+// @Param chainId path string true "Chain ID"
+// @Success 200 {object} SuccessResponse{data=chains.Chain}
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /interop/chains/{chainId}/probe [post]
+func ProbeRegisteredChain(c *fiber.Ctx) error {
+	chain, err := chains.Probe(c.Params("chainId"))
+	if errors.Is(err, chains.ErrChainNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Chain not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to probe chain: "+err.Error())
+	}
+
+	message := "Chain probed successfully"
+	if !chain.Reachable {
+		message = "Chain could not be reached, capabilities are based on its type"
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    chain,
+	})
+}
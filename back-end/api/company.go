@@ -565,7 +565,7 @@ func GetCompanyStats(c *fiber.Ctx) error {
 		SELECT COUNT(b.id) 
 		FROM batch b 
 		JOIN hatchery h ON b.hatchery_id = h.id 
-		WHERE h.company_id = $1 AND b.is_active = true AND h.is_active = true
+		WHERE COALESCE(b.owner_company_id, h.company_id) = $1 AND b.is_active = true AND h.is_active = true
 	`, companyID).Scan(&stats.TotalBatches)
 	if err != nil {
 		stats.TotalBatches = 0
@@ -577,7 +577,7 @@ func GetCompanyStats(c *fiber.Ctx) error {
 		FROM event e 
 		JOIN batch b ON e.batch_id = b.id 
 		JOIN hatchery h ON b.hatchery_id = h.id 
-		WHERE h.company_id = $1 AND e.is_active = true AND b.is_active = true AND h.is_active = true
+		WHERE COALESCE(b.owner_company_id, h.company_id) = $1 AND e.is_active = true AND b.is_active = true AND h.is_active = true
 	`, companyID).Scan(&stats.TotalEvents)
 	if err != nil {
 		stats.TotalEvents = 0
@@ -0,0 +1,351 @@
+package api
+
+import (
+	"database/sql"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/verification"
+)
+
+// DNSChallenge is the TXT record that proves ownership of a domain
+type DNSChallenge struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// newDNSChallenge describes the TXT record of a verification token
+func newDNSChallenge(domain, token string) *DNSChallenge {
+	return &DNSChallenge{Type: "TXT", Name: verification.RecordName(domain), Value: verification.RecordValue(token)}
+}
+
+// CompanyDomainRequest represents a request to register a domain owned by a company
+type CompanyDomainRequest struct {
+	Domain      string `json:"domain"`
+	TraceDomain bool   `json:"trace_domain"` // serve the company's public trace pages and label QR codes on this domain once verified
+}
+
+// CompanyDomain is a domain a company claims, verified with a DNS TXT challenge
+type CompanyDomain struct {
+	ID            int           `json:"id"`
+	CompanyID     int           `json:"company_id"`
+	Domain        string        `json:"domain"`
+	TraceDomain   bool          `json:"trace_domain"`
+	Status        string        `json:"status"`
+	LastError     string        `json:"last_error,omitempty"`
+	LastCheckedAt *time.Time    `json:"last_checked_at,omitempty"`
+	VerifiedAt    *time.Time    `json:"verified_at,omitempty"`
+	DNSChallenge  *DNSChallenge `json:"dns_challenge"`
+	CreatedAt     time.Time     `json:"created_at"`
+
+	token string
+}
+
+const companyDomainColumns = `
+	id, company_id, domain, trace_domain, status, COALESCE(last_error, ''), last_checked_at, verified_at, verification_token, created_at`
+
+// scanCompanyDomain reads a domain selected with companyDomainColumns
+func scanCompanyDomain(row rowScanner) (CompanyDomain, error) {
+	var d CompanyDomain
+	var lastCheckedAt, verifiedAt sql.NullTime
+	err := row.Scan(&d.ID, &d.CompanyID, &d.Domain, &d.TraceDomain, &d.Status, &d.LastError, &lastCheckedAt, &verifiedAt, &d.token, &d.CreatedAt)
+	d.LastCheckedAt = timePtr(lastCheckedAt)
+	d.VerifiedAt = timePtr(verifiedAt)
+	d.DNSChallenge = newDNSChallenge(d.Domain, d.token)
+	return d, err
+}
+
+// companyDomainCovers reports whether a host is under a domain the company verified
+func companyDomainCovers(companyID int, host string) bool {
+	rows, err := db.DB.Query(`
+		SELECT domain FROM company_domain WHERE company_id = $1 AND status = $2 AND is_active = true
+	`, companyID, verification.StatusVerified)
+	if err != nil {
+		return false
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err == nil && verification.CoveredBy(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// companyTraceBaseURL returns the base URL of a company's verified trace domain, or "" when it has none
+func companyTraceBaseURL(companyID int) string {
+	var domain string
+	err := db.DB.QueryRow(`
+		SELECT domain FROM company_domain
+		WHERE company_id = $1 AND trace_domain = true AND status = $2 AND is_active = true
+		ORDER BY verified_at DESC
+		LIMIT 1
+	`, companyID, verification.StatusVerified).Scan(&domain)
+	if err != nil {
+		return ""
+	}
+	return "https://" + domain
+}
+
+// CreateCompanyDomain registers a domain for a company and returns its DNS challenge
+// @Summary Register company domain
+// @Description Register a domain owned by a company. Publish the returned TXT record, then call the verify endpoint.
+// @Description Verified domains can serve white-label trace pages and make webhook endpoints under them verified
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param request body CompanyDomainRequest true "Domain"
+// @Success 201 {object} SuccessResponse{data=CompanyDomain}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/domains [post]
+func CreateCompanyDomain(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	var req CompanyDomainRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	domain, err := verification.NormalizeDomain(req.Domain)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", companyID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+	// A verified domain belongs to one company; unverified claims do not block others
+	err = db.DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM company_domain
+			WHERE domain = $1 AND is_active = true AND (company_id = $2 OR status = $3)
+		)
+	`, domain, companyID, verification.StatusVerified).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "Domain is already registered")
+	}
+
+	token, err := verification.GenerateToken()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate verification token")
+	}
+	userID, _ := c.Locals("userID").(int)
+	companyDomain, err := scanCompanyDomain(db.DB.QueryRow(`
+		INSERT INTO company_domain (company_id, domain, trace_domain, verification_token, status, created_by, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NOW(), NOW(), true)
+		RETURNING `+companyDomainColumns,
+		companyID, domain, req.TraceDomain, token, verification.StatusPending, userID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to register domain: "+err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Domain registered; publish the TXT record and verify it",
+		Data:    companyDomain,
+	})
+}
+
+// ListCompanyDomains lists the domains of a company
+// @Summary List company domains
+// @Description List the domains of a company with their verification status and DNS challenge
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=[]CompanyDomain}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/domains [get]
+func ListCompanyDomains(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT `+companyDomainColumns+` FROM company_domain WHERE company_id = $1 AND is_active = true ORDER BY id
+	`, companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	domains := []CompanyDomain{}
+	for rows.Next() {
+		d, err := scanCompanyDomain(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse company domain")
+		}
+		domains = append(domains, d)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Company domains retrieved successfully",
+		Data:    domains,
+	})
+}
+
+// VerifyCompanyDomain checks the DNS challenge of a company domain
+// @Summary Verify company domain
+// @Description Look up the TXT record of a domain and record whether ownership is proven
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param domainId path int true "Domain ID"
+// @Success 200 {object} SuccessResponse{data=CompanyDomain}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/domains/{domainId}/verify [post]
+func VerifyCompanyDomain(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	domainID, err := strconv.Atoi(c.Params("domainId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid domain ID format")
+	}
+
+	current, err := scanCompanyDomain(db.DB.QueryRow(`
+		SELECT `+companyDomainColumns+` FROM company_domain WHERE id = $1 AND company_id = $2 AND is_active = true
+	`, domainID, companyID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Domain not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	var taken bool
+	err = db.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM company_domain WHERE domain = $1 AND company_id <> $2 AND status = $3 AND is_active = true)
+	`, current.Domain, companyID, verification.StatusVerified).Scan(&taken)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if taken {
+		return fiber.NewError(fiber.StatusConflict, "Domain is verified by another company")
+	}
+
+	verifyErr := verification.CheckDNS(current.Domain, current.token)
+	status, lastError := verification.StatusVerified, ""
+	if verifyErr != nil {
+		status, lastError = verification.StatusFailed, verifyErr.Error()
+	}
+	updated, err := scanCompanyDomain(db.DB.QueryRow(`
+		UPDATE company_domain
+		SET status = $2::text, last_error = NULLIF($3, ''), last_checked_at = NOW(),
+			verified_at = CASE WHEN $2::text = 'verified' THEN NOW() ELSE NULL END, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+companyDomainColumns,
+		domainID, status, lastError))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save verification status")
+	}
+	if verifyErr != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "Domain verification failed: "+lastError)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Domain verified successfully",
+		Data:    updated,
+	})
+}
+
+// DeleteCompanyDomain removes a company domain
+// @Summary Delete company domain
+// @Description Remove a domain. Webhook endpoints verified through it must be verified again before they receive events
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param domainId path int true "Domain ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/domains/{domainId} [delete]
+func DeleteCompanyDomain(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	domainID, err := strconv.Atoi(c.Params("domainId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid domain ID format")
+	}
+
+	var domain string
+	err = db.DB.QueryRow(`
+		UPDATE company_domain SET is_active = false, updated_at = NOW()
+		WHERE id = $1 AND company_id = $2 AND is_active = true
+		RETURNING domain
+	`, domainID, companyID).Scan(&domain)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Domain not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	// Endpoints that relied on the domain fall back to pending unless another verified domain still covers them
+	rows, err := db.DB.Query(`
+		SELECT id, url FROM webhook_subscription
+		WHERE company_id = $1 AND is_active = true AND verification_method = $2
+	`, companyID, verification.MethodCompanyDomain)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	var revoked []int
+	for rows.Next() {
+		var id int
+		var endpointURL string
+		if err := rows.Scan(&id, &endpointURL); err != nil {
+			continue
+		}
+		if endpoint, err := url.Parse(endpointURL); err == nil && !companyDomainCovers(companyID, endpoint.Hostname()) {
+			revoked = append(revoked, id)
+		}
+	}
+	rows.Close()
+	if len(revoked) > 0 {
+		_, err = db.DB.Exec(`
+			UPDATE webhook_subscription
+			SET verification_status = $2, verified_at = NULL, verification_error = $3, updated_at = NOW()
+			WHERE id = ANY($1)
+		`, pq.Array(revoked), verification.StatusPending, "company domain "+domain+" was removed")
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Domain deleted successfully",
+		Data:    fiber.Map{"webhooks_unverified": len(revoked)},
+	})
+}
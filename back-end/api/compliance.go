@@ -5,6 +5,7 @@ import (
 	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
 	"github.com/LTPPPP/TracePost-larvaeChain/config"
 	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"strconv"
 	"time"
 )
 
@@ -138,6 +139,16 @@ func CheckBatchCompliance(c *fiber.Ctx) error {
 	// Perform compliance check
 	result := performComplianceCheck(batchID, standard, batchData)
 	
+	// Include the results of on-site inspections and the plausibility of the recorded larval stages
+	if id, err := strconv.Atoi(batchID); err == nil {
+		if err := applyInspectionResults(&result, id, standard.ID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load inspection results: "+err.Error())
+		}
+		if err := applyStageProgression(&result, id); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load batch stages: "+err.Error())
+		}
+	}
+	
 	// Save compliance check result to database
 	_, err = db.DB.Exec(`
 		INSERT INTO compliance_checks (batch_id, standard_id, is_compliant, compliance_score, checked_at, issues, requirements_met)
@@ -250,6 +261,14 @@ func GenerateComplianceReport(c *fiber.Ctx) error {
 	}
 	
 	report.Standards = standards
+
+	// Importers ask for the provenance of the water the batch was raised in
+	if id, err := strconv.Atoi(batchID); err == nil {
+		if water, err := loadBatchWaterProvenance(id); err == nil {
+			report.Details["water_provenance"] = water
+		}
+	}
+
 	if overallCompliant {
 		report.OverallStatus = "compliant"
 	} else {
@@ -401,6 +420,16 @@ func ValidateAgainstStandard(c *fiber.Ctx) error {
 	// Perform compliance check
 	result := performComplianceCheck(req.BatchID, standard, batchData)
 	
+	// Include the results of on-site inspections and the plausibility of the recorded larval stages
+	if id, err := strconv.Atoi(req.BatchID); err == nil {
+		if err := applyInspectionResults(&result, id, standard.ID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load inspection results: "+err.Error())
+		}
+		if err := applyStageProgression(&result, id); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load batch stages: "+err.Error())
+		}
+	}
+	
 	// Save compliance check result to database
 	_, err = db.DB.Exec(`
 		INSERT INTO compliance_checks (batch_id, standard_id, is_compliant, compliance_score, checked_at, issues, requirements_met)
@@ -582,6 +611,13 @@ func performComplianceCheck(batchID string, standard ComplianceStandard, batchDa
 		}
 	}
 	
+	scoreCompliance(&result)
+	
+	return result
+}
+
+// scoreCompliance calculates the compliance score and overall compliance from the requirements met
+func scoreCompliance(result *ComplianceCheckResult) {
 	// Calculate compliance score
 	totalRequirements := len(result.RequirementsMet)
 	if totalRequirements > 0 {
@@ -596,6 +632,4 @@ func performComplianceCheck(batchID string, standard ComplianceStandard, batchDa
 	
 	// Determine overall compliance
 	result.IsCompliant = len(result.Issues) == 0
-	
-	return result
 }
\ No newline at end of file
@@ -0,0 +1,399 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/moderation"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+)
+
+// Consumer feedback statuses
+const (
+	FeedbackPublished     = "published"      // shown to the company
+	FeedbackPendingReview = "pending_review" // waiting in the moderation queue
+	FeedbackRejected      = "rejected"
+)
+
+const (
+	maxFeedbackLength        = 2000
+	maxFeedbackPerClientHour = 5 // per batch, from one client address
+)
+
+// ConsumerFeedback is a rating or comment a consumer left on the trace page of a batch.
+// Comments are stored after moderation, with blocked terms masked and personal data redacted
+type ConsumerFeedback struct {
+	ID         int                  `json:"id"`
+	BatchID    int                  `json:"batch_id"`
+	CompanyID  *int                 `json:"company_id,omitempty"`
+	Rating     *int                 `json:"rating,omitempty"`
+	Comment    string               `json:"comment,omitempty"`
+	Language   string               `json:"language,omitempty"`
+	Status     string               `json:"status"`
+	Findings   []moderation.Finding `json:"moderation_findings"`
+	ReviewedBy *int                 `json:"reviewed_by,omitempty"`
+	ReviewNote string               `json:"review_note,omitempty"`
+	ReviewedAt *time.Time           `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+}
+
+// ConsumerFeedbackRequest represents feedback submitted from the consumer trace page
+type ConsumerFeedbackRequest struct {
+	Rating   int    `json:"rating"` // 1 to 5; 0 leaves a comment only
+	Comment  string `json:"comment"`
+	Language string `json:"language"`
+}
+
+// FeedbackReviewRequest represents a moderator's decision on feedback
+type FeedbackReviewRequest struct {
+	Note string `json:"note"`
+}
+
+const consumerFeedbackColumns = `
+	id, batch_id, company_id, rating, COALESCE(comment, ''), COALESCE(language, ''), status, moderation_findings,
+	reviewed_by, COALESCE(review_note, ''), reviewed_at, created_at
+`
+
+// scanConsumerFeedback reads feedback selected with consumerFeedbackColumns
+func scanConsumerFeedback(row rowScanner) (ConsumerFeedback, error) {
+	var f ConsumerFeedback
+	var companyID, rating, reviewedBy sql.NullInt64
+	var reviewedAt sql.NullTime
+	var findings []byte
+	err := row.Scan(&f.ID, &f.BatchID, &companyID, &rating, &f.Comment, &f.Language, &f.Status, &findings,
+		&reviewedBy, &f.ReviewNote, &reviewedAt, &f.CreatedAt)
+	if err != nil {
+		return f, err
+	}
+	f.CompanyID = intPtr(companyID)
+	f.Rating = intPtr(rating)
+	f.ReviewedBy = intPtr(reviewedBy)
+	f.ReviewedAt = timePtr(reviewedAt)
+	f.Findings = []moderation.Finding{}
+	if len(findings) > 0 {
+		err = json.Unmarshal(findings, &f.Findings)
+	}
+	return f, err
+}
+
+// queryConsumerFeedback runs a feedback query and collects the results
+func queryConsumerFeedback(query string, args ...interface{}) ([]ConsumerFeedback, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feedback := []ConsumerFeedback{}
+	for rows.Next() {
+		f, err := scanConsumerFeedback(rows)
+		if err != nil {
+			return nil, err
+		}
+		feedback = append(feedback, f)
+	}
+	return feedback, rows.Err()
+}
+
+// feedbackClientHash identifies the client submitting feedback for throttling.
+// The address is hashed with the day, so the stored value cannot follow a consumer from one day to the next
+func feedbackClientHash(c *fiber.Ctx) string {
+	return hashLIMSToken(c.IP() + "|" + time.Now().UTC().Format("2006-01-02"))
+}
+
+// dispatchFeedbackPublished tells the company about feedback shown to it
+func dispatchFeedbackPublished(f ConsumerFeedback) {
+	if f.CompanyID == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"feedback_id": f.ID,
+		"batch_id":    f.BatchID,
+		"rating":      f.Rating,
+		"comment":     f.Comment,
+	}
+	if err := webhooks.Dispatch(*f.CompanyID, "consumer_feedback", data); err != nil {
+		fmt.Printf("Warning: failed to dispatch consumer_feedback webhook: %v\n", err)
+	}
+}
+
+// SubmitConsumerFeedback submits consumer feedback on a batch
+// @Summary Submit consumer feedback
+// @Description Leave a rating and/or comment on the trace page of a batch. The comment is moderated before it is stored:
+// @Description blocked terms are masked, personal data (e-mail, phone, ID and card numbers) is redacted, and doubtful feedback waits in the moderation queue before the company sees it.
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param request body ConsumerFeedbackRequest true "Feedback"
+// @Success 201 {object} SuccessResponse{data=ConsumerFeedback}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/feedback [post]
+func SubmitConsumerFeedback(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	var req ConsumerFeedbackRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.Rating < 0 || req.Rating > 5 {
+		return fiber.NewError(fiber.StatusBadRequest, "Rating must be between 1 and 5")
+	}
+	if utf8.RuneCountInString(req.Comment) > maxFeedbackLength {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Comment must be at most %d characters", maxFeedbackLength))
+	}
+	language := ""
+	if req.Language != "" {
+		var ok bool
+		if language, ok = normalizeLanguageTag(req.Language); !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "Language must be a language tag such as vi or en")
+		}
+	}
+
+	var companyID sql.NullInt64
+	err = db.DB.QueryRow(`
+		SELECT `+batchOwnerCompany+` FROM batch b JOIN hatchery h ON h.id = b.hatchery_id WHERE b.id = $1 AND b.is_active = true
+	`, batchID).Scan(&companyID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	clientHash := feedbackClientHash(c)
+	var recent int
+	err = db.DB.QueryRow(`
+		SELECT COUNT(*) FROM consumer_feedback
+		WHERE batch_id = $1 AND client_hash = $2 AND created_at > NOW() - INTERVAL '1 hour'
+	`, batchID, clientHash).Scan(&recent)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if recent >= maxFeedbackPerClientHour {
+		return fiber.NewError(fiber.StatusTooManyRequests, "Too much feedback sent for this batch, try again later")
+	}
+
+	result := moderation.Default().Check(req.Comment)
+	if req.Rating == 0 && result.Text == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Feedback needs a rating or a comment")
+	}
+	status := FeedbackPublished
+	switch result.Verdict {
+	case moderation.VerdictReview:
+		status = FeedbackPendingReview
+	case moderation.VerdictRejected:
+		status = FeedbackRejected
+	}
+	findings, _ := json.Marshal(result.Findings)
+
+	// Rejected feedback is kept, already scrubbed, so moderators can check the filters for false positives
+	f, err := scanConsumerFeedback(db.DB.QueryRow(`
+		INSERT INTO consumer_feedback (batch_id, company_id, rating, comment, language, status, moderation_findings, client_hash)
+		VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8)
+		RETURNING `+consumerFeedbackColumns,
+		batchID, companyID, req.Rating, result.Text, language, status, findings, clientHash))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save feedback")
+	}
+
+	switch f.Status {
+	case FeedbackRejected:
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "Feedback was not accepted by moderation")
+	case FeedbackPublished:
+		dispatchFeedbackPublished(f)
+	}
+
+	message := "Feedback submitted successfully"
+	if f.Status == FeedbackPendingReview {
+		message = "Feedback submitted and waiting for moderation"
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    f,
+	})
+}
+
+// ListCompanyFeedback lists the consumer feedback on a company's batches
+// @Summary List consumer feedback
+// @Description List the published consumer feedback on the batches a company owns. Admins may list other statuses.
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param batch_id query int false "Batch ID"
+// @Param status query string false "Status (published, pending_review, rejected); admins only"
+// @Success 200 {object} SuccessResponse{data=[]ConsumerFeedback}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/feedback [get]
+func ListCompanyFeedback(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+	status := FeedbackPublished
+	if role, _ := c.Locals("role").(string); role == "admin" && c.Query("status") != "" {
+		status = c.Query("status")
+	}
+
+	feedback, err := queryConsumerFeedback(`SELECT `+consumerFeedbackColumns+`
+		FROM consumer_feedback
+		WHERE company_id = $1 AND status = $2 AND ($3::int = 0 OR batch_id = $3)
+		ORDER BY created_at DESC, id DESC
+	`, companyID, status, c.QueryInt("batch_id", 0))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve feedback")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Feedback retrieved successfully",
+		Data:    feedback,
+	})
+}
+
+// ListModerationQueue lists consumer feedback by moderation status
+// @Summary List moderation queue
+// @Description List consumer feedback waiting for a moderator, oldest first; other statuses can be listed to check the filters
+// @Tags admin
+// @Produce json
+// @Param status query string false "Status (default pending_review)"
+// @Param company_id query int false "Company ID"
+// @Success 200 {object} SuccessResponse{data=[]ConsumerFeedback}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/moderation/feedback [get]
+func ListModerationQueue(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	feedback, err := queryConsumerFeedback(`SELECT `+consumerFeedbackColumns+`
+		FROM consumer_feedback
+		WHERE status = $1 AND ($2::int = 0 OR company_id = $2)
+		ORDER BY created_at, id
+	`, c.Query("status", FeedbackPendingReview), c.QueryInt("company_id", 0))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve moderation queue")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Moderation queue retrieved successfully",
+		Data:    feedback,
+	})
+}
+
+// reviewConsumerFeedback records a moderator's decision, moving feedback to a status
+func reviewConsumerFeedback(c *fiber.Ctx, status string) (ConsumerFeedback, error) {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return ConsumerFeedback{}, fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	feedbackID, err := strconv.Atoi(c.Params("feedbackId"))
+	if err != nil {
+		return ConsumerFeedback{}, fiber.NewError(fiber.StatusBadRequest, "Invalid feedback ID format")
+	}
+	var req FeedbackReviewRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return ConsumerFeedback{}, fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	userID, _ := c.Locals("userID").(int)
+
+	f, err := scanConsumerFeedback(db.DB.QueryRow(`
+		UPDATE consumer_feedback
+		SET status = $1, reviewed_by = NULLIF($2, 0), review_note = NULLIF($3, ''), reviewed_at = NOW(), updated_at = NOW()
+		WHERE id = $4 AND status <> $1
+		RETURNING `+consumerFeedbackColumns,
+		status, userID, req.Note, feedbackID))
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM consumer_feedback WHERE id = $1)", feedbackID).Scan(&exists); err == nil && !exists {
+			return f, fiber.NewError(fiber.StatusNotFound, "Feedback not found")
+		}
+		return f, fiber.NewError(fiber.StatusConflict, "The feedback is already "+status)
+	}
+	if err != nil {
+		return f, fiber.NewError(fiber.StatusInternalServerError, "Failed to review feedback")
+	}
+	return f, nil
+}
+
+// ApproveFeedback publishes consumer feedback
+// @Summary Approve feedback
+// @Description Publish feedback from the moderation queue, or restore rejected feedback, so the company sees it
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param feedbackId path int true "Feedback ID"
+// @Param request body FeedbackReviewRequest false "Review note"
+// @Success 200 {object} SuccessResponse{data=ConsumerFeedback}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/moderation/feedback/{feedbackId}/approve [post]
+func ApproveFeedback(c *fiber.Ctx) error {
+	f, err := reviewConsumerFeedback(c, FeedbackPublished)
+	if err != nil {
+		return err
+	}
+	dispatchFeedbackPublished(f)
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Feedback approved successfully",
+		Data:    f,
+	})
+}
+
+// RejectFeedback rejects consumer feedback
+// @Summary Reject feedback
+// @Description Reject feedback from the moderation queue, or take down published feedback
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param feedbackId path int true "Feedback ID"
+// @Param request body FeedbackReviewRequest false "Review note"
+// @Success 200 {object} SuccessResponse{data=ConsumerFeedback}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/moderation/feedback/{feedbackId}/reject [post]
+func RejectFeedback(c *fiber.Ctx) error {
+	f, err := reviewConsumerFeedback(c, FeedbackRejected)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Feedback rejected successfully",
+		Data:    f,
+	})
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Content block types of the consumer trace page
+const (
+	BlockTypeFarmStory           = "farm_story"
+	BlockTypeSustainabilityBadge = "sustainability_badge"
+	BlockTypeRecipe              = "recipe"
+	BlockTypeCustom              = "custom"
+)
+
+// ContentBlock is a story block shown on the consumer trace page of a company's batches
+type ContentBlock struct {
+	ID          int             `json:"id"`
+	CompanyID   int             `json:"company_id"`
+	Species     string          `json:"species"` // Batch type the block applies to; empty for all batches
+	BlockType   string          `json:"block_type"`
+	Title       string          `json:"title"`
+	Body        string          `json:"body"`
+	ImageURL    string          `json:"image_url"`
+	LinkURL     string          `json:"link_url"`
+	Data        json.RawMessage `json:"data,omitempty" swaggertype:"object"` // Block specific fields, e.g. recipe ingredients
+	Position    int             `json:"position"`
+	IsPublished bool            `json:"is_published"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ContentBlockRequest represents a request to create or update a content block
+type ContentBlockRequest struct {
+	Species     string          `json:"species"`
+	BlockType   string          `json:"block_type"`
+	Title       string          `json:"title"`
+	Body        string          `json:"body"`
+	ImageURL    string          `json:"image_url"`
+	LinkURL     string          `json:"link_url"`
+	Data        json.RawMessage `json:"data,omitempty" swaggertype:"object"`
+	Position    int             `json:"position"`
+	IsPublished bool            `json:"is_published"`
+}
+
+const contentBlockColumns = `
+	id, company_id, COALESCE(species, ''), block_type, COALESCE(title, ''), COALESCE(body, ''),
+	COALESCE(image_url, ''), COALESCE(link_url, ''), COALESCE(data, '{}'), position, is_published, created_at, updated_at
+`
+
+// scanContentBlock reads a content block selected with contentBlockColumns
+func scanContentBlock(row rowScanner) (ContentBlock, error) {
+	var b ContentBlock
+	var data []byte
+	err := row.Scan(&b.ID, &b.CompanyID, &b.Species, &b.BlockType, &b.Title, &b.Body,
+		&b.ImageURL, &b.LinkURL, &data, &b.Position, &b.IsPublished, &b.CreatedAt, &b.UpdatedAt)
+	b.Data = data
+	return b, err
+}
+
+// validateContentBlockRequest checks the fields of a content block request
+func validateContentBlockRequest(req *ContentBlockRequest) error {
+	switch req.BlockType {
+	case BlockTypeFarmStory, BlockTypeSustainabilityBadge, BlockTypeRecipe, BlockTypeCustom:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Block type must be farm_story, sustainability_badge, recipe or custom")
+	}
+	if req.Title == "" && req.Body == "" && req.ImageURL == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "A content block needs a title, body or image")
+	}
+	if len(req.Data) == 0 {
+		req.Data = json.RawMessage("{}")
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(req.Data, &data); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Data must be a JSON object")
+	}
+	return nil
+}
+
+// loadTraceContentBlocks loads the published content blocks of the consumer trace page of a batch
+// Blocks of the batch's company apply when they target the batch's species or all batches
+func loadTraceContentBlocks(batchID int) ([]ContentBlock, error) {
+	rows, err := db.DB.Query(`SELECT `+contentBlockColumns+`
+		FROM content_block
+		WHERE is_active = true AND is_published = true
+			AND company_id = (
+				SELECT h.company_id FROM batch b JOIN hatchery h ON h.id = b.hatchery_id WHERE b.id = $1
+			)
+			AND (COALESCE(species, '') = '' OR species = (SELECT species FROM batch WHERE id = $1))
+		ORDER BY position, id
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := []ContentBlock{}
+	for rows.Next() {
+		block, err := scanContentBlock(rows)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, rows.Err()
+}
+
+// ListContentBlocks lists the content blocks of a company
+// @Summary List content blocks
+// @Description List the consumer trace page content blocks of a company, including unpublished drafts
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param species query string false "Batch type (species)"
+// @Param block_type query string false "Block type (farm_story, sustainability_badge, recipe, custom)"
+// @Success 200 {object} SuccessResponse{data=[]ContentBlock}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/content-blocks [get]
+func ListContentBlocks(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+contentBlockColumns+`
+		FROM content_block
+		WHERE company_id = $1 AND is_active = true
+			AND ($2::text = '' OR species = $2)
+			AND ($3::text = '' OR block_type = $3)
+		ORDER BY position, id
+	`, companyID, c.Query("species"), c.Query("block_type"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	blocks := []ContentBlock{}
+	for rows.Next() {
+		block, err := scanContentBlock(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse content block")
+		}
+		blocks = append(blocks, block)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Content blocks retrieved successfully",
+		Data:    blocks,
+	})
+}
+
+// CreateContentBlock creates a content block for a company
+// @Summary Create content block
+// @Description Create a consumer trace page content block for a company, for all its batches or one batch type (species)
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param request body ContentBlockRequest true "Content block"
+// @Success 201 {object} SuccessResponse{data=ContentBlock}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/content-blocks [post]
+func CreateContentBlock(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	var req ContentBlockRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateContentBlockRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", companyID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+
+	block, err := scanContentBlock(db.DB.QueryRow(`
+		INSERT INTO content_block (company_id, species, block_type, title, body, image_url, link_url, data,
+			position, is_published, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW(), true)
+		RETURNING `+contentBlockColumns,
+		companyID, req.Species, req.BlockType, req.Title, req.Body, req.ImageURL, req.LinkURL, string(req.Data),
+		req.Position, req.IsPublished))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save content block")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Content block created successfully",
+		Data:    block,
+	})
+}
+
+// UpdateContentBlock updates a content block
+// @Summary Update content block
+// @Description Update a consumer trace page content block, including its position and whether it is published
+// @Tags content
+// @Accept json
+// @Produce json
+// @Param blockId path int true "Content block ID"
+// @Param request body ContentBlockRequest true "Content block"
+// @Success 200 {object} SuccessResponse{data=ContentBlock}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /content-blocks/{blockId} [put]
+func UpdateContentBlock(c *fiber.Ctx) error {
+	blockID, err := strconv.Atoi(c.Params("blockId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid content block ID format")
+	}
+
+	var req ContentBlockRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateContentBlockRequest(&req); err != nil {
+		return err
+	}
+
+	block, err := scanContentBlock(db.DB.QueryRow(`
+		UPDATE content_block
+		SET species = $2, block_type = $3, title = $4, body = $5, image_url = $6, link_url = $7, data = $8,
+			position = $9, is_published = $10, updated_at = NOW()
+		WHERE id = $1 AND is_active = true
+		RETURNING `+contentBlockColumns,
+		blockID, req.Species, req.BlockType, req.Title, req.Body, req.ImageURL, req.LinkURL, string(req.Data),
+		req.Position, req.IsPublished))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Content block not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update content block")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Content block updated successfully",
+		Data:    block,
+	})
+}
+
+// DeleteContentBlock deletes a content block
+// @Summary Delete content block
+// @Description Remove a content block from the consumer trace page
+// @Tags content
+// @Produce json
+// @Param blockId path int true "Content block ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /content-blocks/{blockId} [delete]
+func DeleteContentBlock(c *fiber.Ctx) error {
+	blockID, err := strconv.Atoi(c.Params("blockId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid content block ID format")
+	}
+
+	result, err := db.DB.Exec("UPDATE content_block SET is_active = false, updated_at = NOW() WHERE id = $1 AND is_active = true", blockID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete content block")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Content block not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Content block deleted successfully",
+	})
+}
+
+// GetBatchContentBlocks gets the content blocks of the consumer trace page of a batch
+// @Summary Get batch trace page content
+// @Description Get the published content blocks shown on the consumer trace page of a batch, in display order
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]ContentBlock}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/content-blocks [get]
+func GetBatchContentBlocks(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	blocks, err := loadTraceContentBlocks(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve content blocks")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Content blocks retrieved successfully",
+		Data:    blocks,
+	})
+}
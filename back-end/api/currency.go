@@ -0,0 +1,307 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/currency"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// ExchangeRateRequest represents a rate recorded by hand, e.g. the rate on a bank statement
+type ExchangeRateRequest struct {
+	Base  string  `json:"base"`
+	Quote string  `json:"quote"`
+	Date  string  `json:"date"` // YYYY-MM-DD
+	Rate  float64 `json:"rate"` // Amount of the quote currency worth one unit of the base currency
+}
+
+// CompanyCurrencyRequest represents the choice of a company's reporting currency
+type CompanyCurrencyRequest struct {
+	BaseCurrency string `json:"base_currency"`
+}
+
+// CompanyCurrency is the currency a company's commercial reports are normalized to
+type CompanyCurrency struct {
+	CompanyID    int    `json:"company_id"`
+	BaseCurrency string `json:"base_currency"`
+	IsDefault    bool   `json:"is_default"` // The company did not choose a currency and gets the platform default
+	RateProvider string `json:"rate_provider"`
+}
+
+// loadCompanyCurrency loads the base currency of a company
+func loadCompanyCurrency(companyID int) (CompanyCurrency, error) {
+	settings := CompanyCurrency{CompanyID: companyID, RateProvider: currency.Default().ProviderName()}
+	var baseCurrency sql.NullString
+	err := db.DB.QueryRow("SELECT base_currency FROM company WHERE id = $1 AND is_active = true", companyID).Scan(&baseCurrency)
+	if err != nil {
+		return settings, err
+	}
+	settings.BaseCurrency = baseCurrency.String
+	if settings.BaseCurrency == "" {
+		settings.BaseCurrency = currency.Default().BaseCurrency
+		settings.IsDefault = true
+	}
+	return settings, nil
+}
+
+// exchangeRateError maps a rate lookup failure to an API error
+func exchangeRateError(err error) error {
+	if errors.Is(err, currency.ErrRateUnavailable) {
+		return dependencyUnavailable("Exchange rate unavailable", err)
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+}
+
+// GetExchangeRate returns the exchange rate between two currencies on a day
+// @Summary Get exchange rate
+// @Description Get the rate between two currencies on a day. Stored rates are used first; otherwise the configured provider is asked and its rates are stored for that day.
+// @Tags currency
+// @Produce json
+// @Param base query string true "Base currency (ISO 4217)"
+// @Param quote query string true "Quote currency (ISO 4217)"
+// @Param date query string false "Day of the rate (YYYY-MM-DD, default today)"
+// @Success 200 {object} SuccessResponse{data=currency.Rate}
+// @Failure 400 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /currency/rates [get]
+func GetExchangeRate(c *fiber.Ctx) error {
+	base, quote := currency.Normalize(c.Query("base")), currency.Normalize(c.Query("quote"))
+	if !currency.Valid(base) || !currency.Valid(quote) {
+		return fiber.NewError(fiber.StatusBadRequest, "Base and quote must be 3-letter ISO 4217 codes")
+	}
+	date := time.Now()
+	if raw := c.Query("date"); raw != "" {
+		var err error
+		if date, err = time.Parse("2006-01-02", raw); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid date, use YYYY-MM-DD")
+		}
+	}
+
+	rate, err := currency.Default().Rate(base, quote, date)
+	if err != nil {
+		return exchangeRateError(err)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Exchange rate retrieved successfully",
+		Data:    rate,
+	})
+}
+
+// RecordExchangeRate records an exchange rate by hand
+// @Summary Record exchange rate
+// @Description Record the rate between two currencies on a day, replacing the stored rate of that day. Reports already converted at the previous rate change when run again.
+// @Tags currency
+// @Accept json
+// @Produce json
+// @Param request body ExchangeRateRequest true "Exchange rate"
+// @Success 201 {object} SuccessResponse{data=currency.Rate}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /currency/rates [post]
+func RecordExchangeRate(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	var req ExchangeRateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	rate := currency.Rate{Base: currency.Normalize(req.Base), Quote: currency.Normalize(req.Quote), Rate: req.Rate, Source: currency.ProviderManual}
+	if !currency.Valid(rate.Base) || !currency.Valid(rate.Quote) || rate.Base == rate.Quote {
+		return fiber.NewError(fiber.StatusBadRequest, "Base and quote must be different 3-letter ISO 4217 codes")
+	}
+	if rate.Rate <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Rate must be positive")
+	}
+	var err error
+	if rate.Date, err = time.Parse("2006-01-02", req.Date); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid date, use YYYY-MM-DD")
+	}
+
+	if err := currency.Default().Record(rate); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save exchange rate")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Exchange rate recorded successfully",
+		Data:    rate,
+	})
+}
+
+// GetCompanyCurrency returns the reporting currency of a company
+// @Summary Get company currency
+// @Description Get the base currency commercial reports of a company are normalized to
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=CompanyCurrency}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/currency [get]
+func GetCompanyCurrency(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	settings, err := loadCompanyCurrency(companyID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Company currency retrieved successfully",
+		Data:    settings,
+	})
+}
+
+// SetCompanyCurrency sets the reporting currency of a company
+// @Summary Set company currency
+// @Description Set the base currency commercial reports of a company are normalized to; an empty currency restores the platform default
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param request body CompanyCurrencyRequest true "Base currency"
+// @Success 200 {object} SuccessResponse{data=CompanyCurrency}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/currency [put]
+func SetCompanyCurrency(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+
+	var req CompanyCurrencyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.BaseCurrency = currency.Normalize(req.BaseCurrency)
+	if req.BaseCurrency != "" && !currency.Valid(req.BaseCurrency) {
+		return fiber.NewError(fiber.StatusBadRequest, "Base currency must be a 3-letter ISO 4217 code")
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE company SET base_currency = NULLIF($1, ''), updated_at = NOW() WHERE id = $2 AND is_active = true
+	`, req.BaseCurrency, companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update company currency")
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+	settings, err := loadCompanyCurrency(companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Company currency updated but failed to retrieve details")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Company currency updated successfully",
+		Data:    settings,
+	})
+}
+
+// normalizedTransferPriceReport reports transfer prices per species in the base currency of a company,
+// converting each price at the rate of its transfer date
+func normalizedTransferPriceReport(c *fiber.Ctx, companyID int, direction string, from, to time.Time) error {
+	settings, err := loadCompanyCurrency(companyID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT COALESCE(b.species, ''), COALESCE(t.currency, ''), t.unit_price, COALESCE(t.quantity, b.quantity, 0), st.transfer_time
+		`+transferPriceReportFrom+`
+		ORDER BY st.transfer_time
+	`, companyID, direction, nullTime(from), nullTime(to))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build transfer price report")
+	}
+	defer rows.Close()
+
+	rates := currency.Default()
+	bySpecies := map[string]*TransferPriceReport{}
+	weighted := map[string]float64{}
+	priced := map[string]int64{}
+	for rows.Next() {
+		var species, code string
+		var unitPrice sql.NullFloat64
+		var quantity int64
+		var transferTime time.Time
+		if err := rows.Scan(&species, &code, &unitPrice, &quantity, &transferTime); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse transfer price report")
+		}
+		r := bySpecies[species]
+		if r == nil {
+			r = &TransferPriceReport{Species: species, Currency: settings.BaseCurrency}
+			bySpecies[species] = r
+		}
+		r.Transfers++
+		r.TotalQuantity += quantity
+		if !unitPrice.Valid {
+			continue
+		}
+		price, _, err := rates.Convert(unitPrice.Float64, code, settings.BaseCurrency, transferTime)
+		if err != nil {
+			if !errors.Is(err, currency.ErrRateUnavailable) {
+				return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+			}
+			r.Unconverted++
+			continue
+		}
+		weighted[species] += price * float64(quantity)
+		priced[species] += quantity
+		if r.MinUnitPrice == nil || price < *r.MinUnitPrice {
+			r.MinUnitPrice = &price
+		}
+		if r.MaxUnitPrice == nil || price > *r.MaxUnitPrice {
+			r.MaxUnitPrice = &price
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build transfer price report")
+	}
+
+	report := make([]TransferPriceReport, 0, len(bySpecies))
+	for species, r := range bySpecies {
+		if priced[species] > 0 {
+			average := weighted[species] / float64(priced[species])
+			r.AverageUnitPrice = &average
+		}
+		report = append(report, *r)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Species < report[j].Species })
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Transfer price report generated in " + settings.BaseCurrency,
+		Data:    report,
+	})
+}
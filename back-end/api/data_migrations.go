@@ -0,0 +1,239 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/datamigration"
+)
+
+// DataMigrationDetail is a migration with its verification history
+type DataMigrationDetail struct {
+	datamigration.State
+	Verifications []datamigration.Verification `json:"verifications"`
+}
+
+// dataMigrationError maps errors of the migration framework to responses
+func dataMigrationError(err error, action string) error {
+	switch {
+	case errors.Is(err, datamigration.ErrUnknownMigration):
+		return fiber.NewError(fiber.StatusNotFound, "Data migration not found")
+	case errors.Is(err, datamigration.ErrInvalidTransition):
+		return fiber.NewError(fiber.StatusConflict, "Cannot "+action+" the data migration in its current status")
+	case errors.Is(err, datamigration.ErrNotInParity):
+		return fiber.NewError(fiber.StatusConflict, "Verification found rows that differ between the schemas; cutover was not done")
+	default:
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to "+action+" the data migration")
+	}
+}
+
+// dataMigrationAction runs a state change of a migration for an admin
+func dataMigrationAction(c *fiber.Ctx, action, message string, run func(name string) (datamigration.State, error)) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	state, err := run(c.Params("name"))
+	if err != nil {
+		return dataMigrationError(err, action)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    state,
+	})
+}
+
+// ListDataMigrations lists the registered data migrations
+// @Summary List data migrations
+// @Description List the registered schema migrations with their rollout status, backfill progress and last verification
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]datamigration.State}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/migrations [get]
+func ListDataMigrations(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	states := []datamigration.State{}
+	for _, name := range datamigration.Names() {
+		state, err := datamigration.GetState(name)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load data migration")
+		}
+		states = append(states, state)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Data migrations retrieved successfully",
+		Data:    states,
+	})
+}
+
+// GetDataMigration gets a data migration
+// @Summary Get data migration
+// @Description Get the rollout status of a schema migration with its verification history
+// @Tags admin
+// @Produce json
+// @Param name path string true "Migration name"
+// @Success 200 {object} SuccessResponse{data=DataMigrationDetail}
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/migrations/{name} [get]
+func GetDataMigration(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	name := c.Params("name")
+	state, err := datamigration.GetState(name)
+	if err != nil {
+		return dataMigrationError(err, "load")
+	}
+	verifications, err := datamigration.ListVerifications(name, 20)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load verifications")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Data migration retrieved successfully",
+		Data:    DataMigrationDetail{State: state, Verifications: verifications},
+	})
+}
+
+// StartDataMigration starts dual writes and the backfill of a migration
+// @Summary Start data migration
+// @Description Write new rows to both schemas and copy historical rows in the background. Starting a backfilled migration again copies every row anew
+// @Tags admin
+// @Produce json
+// @Param name path string true "Migration name"
+// @Success 200 {object} SuccessResponse{data=datamigration.State}
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/migrations/{name}/start [post]
+func StartDataMigration(c *fiber.Ctx) error {
+	return dataMigrationAction(c, "start", "Data migration started successfully", datamigration.Start)
+}
+
+// PauseDataMigration pauses the backfill of a migration
+// @Summary Pause data migration
+// @Description Stop copying historical rows; new rows are still written to both schemas
+// @Tags admin
+// @Produce json
+// @Param name path string true "Migration name"
+// @Success 200 {object} SuccessResponse{data=datamigration.State}
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/migrations/{name}/pause [post]
+func PauseDataMigration(c *fiber.Ctx) error {
+	return dataMigrationAction(c, "pause", "Data migration paused successfully", datamigration.Pause)
+}
+
+// ResumeDataMigration resumes a paused or failed backfill
+// @Summary Resume data migration
+// @Description Continue copying historical rows after the last copied row
+// @Tags admin
+// @Produce json
+// @Param name path string true "Migration name"
+// @Success 200 {object} SuccessResponse{data=datamigration.State}
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/migrations/{name}/resume [post]
+func ResumeDataMigration(c *fiber.Ctx) error {
+	return dataMigrationAction(c, "resume", "Data migration resumed successfully", datamigration.Resume)
+}
+
+// VerifyDataMigration compares the old and new schema of a migration
+// @Summary Verify data migration
+// @Description Compare every source row with the new schema and record a parity report. A backfilled migration that passes can be cut over
+// @Tags admin
+// @Produce json
+// @Param name path string true "Migration name"
+// @Success 200 {object} SuccessResponse{data=datamigration.Verification}
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/migrations/{name}/verify [post]
+func VerifyDataMigration(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	verification, err := datamigration.RunVerification(c.Params("name"), userID)
+	if err != nil {
+		return dataMigrationError(err, "verify")
+	}
+
+	message := "Schemas are in parity"
+	if !verification.Passed {
+		message = "Verification found rows that differ between the schemas"
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    verification,
+	})
+}
+
+// CutOverDataMigration points readers at the new schema
+// @Summary Cut over data migration
+// @Description Re-verify a verified migration and, when the schemas are in parity, point readers at the new schema. Dual writes continue so the cutover can be rolled back
+// @Tags admin
+// @Produce json
+// @Param name path string true "Migration name"
+// @Success 200 {object} SuccessResponse{data=datamigration.State}
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/migrations/{name}/cutover [post]
+func CutOverDataMigration(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(int)
+	return dataMigrationAction(c, "cut over", "Data migration cut over successfully", func(name string) (datamigration.State, error) {
+		return datamigration.CutOver(name, userID)
+	})
+}
+
+// RollbackDataMigration points readers back at the old schema
+// @Summary Roll back data migration
+// @Description Point readers back at the old schema after a cutover
+// @Tags admin
+// @Produce json
+// @Param name path string true "Migration name"
+// @Success 200 {object} SuccessResponse{data=datamigration.State}
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/migrations/{name}/rollback [post]
+func RollbackDataMigration(c *fiber.Ctx) error {
+	return dataMigrationAction(c, "roll back", "Data migration rolled back successfully", datamigration.Rollback)
+}
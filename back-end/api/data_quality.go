@@ -0,0 +1,169 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+	"github.com/LTPPPP/TracePost-larvaeChain/quality"
+)
+
+// batchAttributes are recorded with readings but describe the batch rather than a measurement, so they are not scored
+var batchAttributes = map[string]bool{"age": true, "density": true}
+
+// DeviceQualityDay is the data quality of a device's readings on one day
+type DeviceQualityDay struct {
+	Date         string         `json:"date"`
+	Readings     int            `json:"readings"`
+	AverageScore float64        `json:"average_score"`
+	Suppressed   int            `json:"suppressed"`
+	Flags        map[string]int `json:"flags"`
+}
+
+// DeviceQualityReport is the health trend of a device
+type DeviceQualityReport struct {
+	DeviceID           int                `json:"device_id"`
+	SerialNumber       string             `json:"serial_number"`
+	CalibrationOverdue bool               `json:"calibration_overdue"`
+	Days               int                `json:"days"`
+	Readings           int                `json:"readings"`
+	AverageScore       float64            `json:"average_score"`
+	Suppressed         int                `json:"suppressed"`
+	Flags              map[string]int     `json:"flags"`
+	Trend              []DeviceQualityDay `json:"trend"`
+}
+
+// assessReading scores a sensor reading against the physical limits of its parameters and the previous readings of its device
+func assessReading(envData models.EnvironmentData, catalog map[string]EnvironmentParameter) (quality.Assessment, error) {
+	values := sensorValues(envData)
+	ranges := map[string]quality.Range{}
+	for code := range values {
+		if p, ok := catalog[code]; ok {
+			ranges[code] = quality.Range{Min: p.MinValue, Max: p.MaxValue}
+		}
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT COALESCE(temperature, 0), COALESCE(ph, 0), COALESCE(salinity, 0), COALESCE(custom_parameters, '{}')
+		FROM environment_data
+		WHERE device_id = $1 AND is_active = true
+		ORDER BY timestamp DESC
+		LIMIT $2
+	`, *envData.DeviceID, quality.SpikeWindow)
+	if err != nil {
+		return quality.Assessment{}, err
+	}
+	defer rows.Close()
+
+	history := []map[string]float64{}
+	for rows.Next() {
+		var previous models.EnvironmentData
+		var custom []byte
+		if err := rows.Scan(&previous.Temperature, &previous.PH, &previous.Salinity, &custom); err != nil {
+			return quality.Assessment{}, err
+		}
+		previous.Parameters = decodeEnvironmentParameters(custom)
+		history = append(history, sensorValues(previous))
+	}
+
+	return quality.Assess(values, history, ranges, !envData.LowConfidence), rows.Err()
+}
+
+// sensorValues returns the measured values of a reading
+func sensorValues(envData models.EnvironmentData) map[string]float64 {
+	values := environmentValues(envData)
+	for code := range batchAttributes {
+		delete(values, code)
+	}
+	return values
+}
+
+// GetDeviceQuality reports the data quality trend of a device
+// @Summary Get device data quality
+// @Description Get the daily quality scores of a device's readings, with suppressed readings and stuck, spike and out-of-range flags
+// @Tags devices
+// @Produce json
+// @Param deviceId path int true "Device ID"
+// @Param days query int false "Number of days (default: 30)"
+// @Success 200 {object} SuccessResponse{data=DeviceQualityReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /devices/{deviceId}/quality [get]
+func GetDeviceQuality(c *fiber.Ctx) error {
+	deviceID, err := strconv.Atoi(c.Params("deviceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid device ID format")
+	}
+	days := c.QueryInt("days", 30)
+	if days <= 0 || days > 365 {
+		days = 30
+	}
+
+	device, err := loadDevice(deviceID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Device not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	report := DeviceQualityReport{
+		DeviceID:           device.ID,
+		SerialNumber:       device.SerialNumber,
+		CalibrationOverdue: device.CalibrationOverdue,
+		Days:               days,
+		Flags:              map[string]int{},
+		Trend:              []DeviceQualityDay{},
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	rows, err := db.DB.Query(`
+		SELECT TO_CHAR(DATE_TRUNC('day', timestamp), 'YYYY-MM-DD'), COUNT(*),
+			COALESCE(AVG(quality_score), 0), COUNT(*) FILTER (WHERE suppressed),
+			COALESCE(STRING_AGG(NULLIF(ARRAY_TO_STRING(quality_flags, ' '), ''), ' '), '')
+		FROM environment_data
+		WHERE device_id = $1 AND is_active = true AND timestamp >= $2
+		GROUP BY 1
+		ORDER BY 1
+	`, deviceID, since)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	var scoreTotal float64
+	for rows.Next() {
+		day := DeviceQualityDay{Flags: map[string]int{}}
+		var flags string
+		if err := rows.Scan(&day.Date, &day.Readings, &day.AverageScore, &day.Suppressed, &flags); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse device quality")
+		}
+		for _, flag := range strings.Fields(flags) {
+			// Flags are counted by type across parameters
+			if i := strings.LastIndex(flag, ":"); i >= 0 {
+				flag = flag[i+1:]
+			}
+			day.Flags[flag]++
+			report.Flags[flag]++
+		}
+		report.Readings += day.Readings
+		report.Suppressed += day.Suppressed
+		scoreTotal += day.AverageScore * float64(day.Readings)
+		report.Trend = append(report.Trend, day)
+	}
+	if report.Readings > 0 {
+		report.AverageScore = scoreTotal / float64(report.Readings)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Device quality retrieved successfully",
+		Data:    report,
+	})
+}
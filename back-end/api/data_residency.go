@@ -0,0 +1,296 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"mime/multipart"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/ipfs"
+	"github.com/LTPPPP/TracePost-larvaeChain/region"
+	"github.com/LTPPPP/TracePost-larvaeChain/residency"
+)
+
+// ResidencyPolicyRequest sets the region the documents of a company are stored and served in
+type ResidencyPolicyRequest struct {
+	Region string `json:"region"` // Region code, e.g. vn1
+	Notes  string `json:"notes"`  // e.g. the contract or regulation requiring it
+}
+
+// ResidencyOverview lists the residency policies and the regional backends of this deployment
+type ResidencyOverview struct {
+	Region   string              `json:"region"` // Region this instance serves
+	Backends []residency.Backend `json:"backends"`
+	Policies []residency.Policy  `json:"policies"`
+}
+
+// documentPlacement is where an uploaded document file was stored
+type documentPlacement struct {
+	Region  string
+	Backend string
+	Locked  bool
+}
+
+// residencyError refuses to handle data of another region here, pointing to the instance of that region
+func residencyError(regionCode, message string) error {
+	if endpoint := region.Default().Endpoints[regionCode]; endpoint != "" {
+		message += ", use " + endpoint
+	}
+	return NewAPIError(fiber.StatusMisdirectedRequest, CodeDataResidency, message)
+}
+
+// companyOfDocumentBatch returns the company owning a batch, 0 when unknown
+func companyOfDocumentBatch(batchID int) int {
+	var companyID sql.NullInt64
+	db.DB.QueryRow(`
+		SELECT `+batchOwnerCompany+` FROM batch b LEFT JOIN hatchery h ON h.id = b.hatchery_id WHERE b.id = $1
+	`, batchID).Scan(&companyID)
+	return int(companyID.Int64)
+}
+
+// companyOfHatchery returns the company running a hatchery, 0 when unknown
+func companyOfHatchery(hatcheryID int) int {
+	var companyID sql.NullInt64
+	db.DB.QueryRow("SELECT company_id FROM hatchery WHERE id = $1", hatcheryID).Scan(&companyID)
+	return int(companyID.Int64)
+}
+
+// companyOfBroodstock returns the company running the hatchery of a broodstock, 0 when unknown
+func companyOfBroodstock(broodstockID int) int {
+	var companyID sql.NullInt64
+	db.DB.QueryRow(`
+		SELECT h.company_id FROM broodstock bs JOIN hatchery h ON h.id = bs.hatchery_id WHERE bs.id = $1
+	`, broodstockID).Scan(&companyID)
+	return int(companyID.Int64)
+}
+
+// isRequestError reports whether an error already carries its HTTP status, as residency refusals do
+func isRequestError(err error) bool {
+	var apiErr *APIError
+	var fiberErr *fiber.Error
+	return errors.As(err, &apiErr) || errors.As(err, &fiberErr)
+}
+
+// uploadDocumentFile stores a document file of a company. Files of companies with a residency policy go to
+// the backend of the policy's region without being pinned on Pinata, and can only be uploaded through an
+// instance of that region; other files go to IPFS and Pinata
+func uploadDocumentFile(companyID int, file multipart.File, filename string, metadata map[string]string) (*ipfs.IPFSPinataResult, documentPlacement, error) {
+	placement := documentPlacement{Region: region.Default().Current, Backend: residency.BackendIPFS}
+	policy, err := residency.PolicyFor(companyID)
+	if err != nil {
+		return nil, placement, fiber.NewError(fiber.StatusInternalServerError, "Failed to load residency policy")
+	}
+	if policy == nil {
+		result, err := ipfs.NewIPFSPinataService().UploadFile(file, filename, metadata, true)
+		return result, placement, err
+	}
+
+	if policy.Region != region.Default().Current {
+		return nil, placement, residencyError(policy.Region, "Documents of this company must be uploaded in the "+policy.Region+" region")
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, placement, fiber.NewError(fiber.StatusBadRequest, "Failed to read file")
+	}
+	stored, err := residency.Default().Store(policy.Region, content, filename)
+	if errors.Is(err, residency.ErrNoBackend) {
+		return nil, placement, dependencyUnavailable("No storage is configured for the "+policy.Region+" region", err)
+	}
+	if err != nil {
+		return nil, placement, err
+	}
+	placement = documentPlacement{Region: stored.Region, Backend: stored.Backend, Locked: true}
+	return &ipfs.IPFSPinataResult{CID: stored.Ref, Name: filename, Size: stored.Size, IPFSUri: stored.URI}, placement, nil
+}
+
+// checkDocumentRegion refuses to serve a region-locked document from an instance of another region,
+// which would copy it out of its region
+func checkDocumentRegion(documentID int) error {
+	var storageRegion string
+	var locked bool
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(storage_region, ''), region_locked FROM document WHERE id = $1
+	`, documentID).Scan(&storageRegion, &locked)
+	if err != nil && err != sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if locked && storageRegion != region.Default().Current {
+		return residencyError(storageRegion, "This document is stored in the "+storageRegion+" region and can only be retrieved there")
+	}
+	return nil
+}
+
+// refuseRegionLockedTransfer refuses to send a region-locked document to a service outside the platform
+func refuseRegionLockedTransfer(documentID int, destination string) error {
+	var locked bool
+	if err := db.DB.QueryRow("SELECT region_locked FROM document WHERE id = $1", documentID).Scan(&locked); err != nil && err != sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if locked {
+		return NewAPIError(fiber.StatusConflict, CodeDataResidency, "This document must stay in its residency region and cannot be sent to the "+destination)
+	}
+	return nil
+}
+
+// GetResidencyPolicy returns the residency policy of a company
+// @Summary Get residency policy
+// @Description Get the region the documents of a company must be stored and served in. Companies without a policy store documents on IPFS and Pinata
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=residency.Policy}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/residency-policy [get]
+func GetResidencyPolicy(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+
+	policy, err := residency.PolicyFor(companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load residency policy")
+	}
+	if policy == nil {
+		return fiber.NewError(fiber.StatusNotFound, "The company has no residency policy")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Residency policy retrieved successfully",
+		Data:    policy,
+	})
+}
+
+// SetResidencyPolicy sets the residency policy of a company
+// @Summary Set residency policy
+// @Description Require new documents of a company to be stored in the backend of a region and served only there. Documents stored before keep where they are
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param request body ResidencyPolicyRequest true "Region"
+// @Success 200 {object} SuccessResponse{data=residency.Policy}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/residency-policy [put]
+func SetResidencyPolicy(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	var req ResidencyPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if strings.TrimSpace(req.Region) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Region is required")
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", companyID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	policy, err := residency.Default().SavePolicy(residency.Policy{CompanyID: companyID, Region: req.Region, Notes: req.Notes}, userID)
+	if errors.Is(err, residency.ErrInvalidRegion) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save residency policy")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Residency policy saved successfully",
+		Data:    policy,
+	})
+}
+
+// DeleteResidencyPolicy lifts the residency policy of a company
+// @Summary Delete residency policy
+// @Description Let new documents of a company be stored on IPFS and Pinata again. Documents stored under the policy stay locked to their region
+// @Tags admin
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/residency-policy [delete]
+func DeleteResidencyPolicy(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	deleted, err := residency.DeletePolicy(companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete residency policy")
+	}
+	if !deleted {
+		return fiber.NewError(fiber.StatusNotFound, "The company has no residency policy")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Residency policy deleted successfully",
+	})
+}
+
+// GetResidencyOverview lists the residency policies and regional storage backends
+// @Summary List residency policies
+// @Description List the residency policies of all companies and the regional storage backends this deployment can route documents to
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=ResidencyOverview}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/residency-policies [get]
+func GetResidencyOverview(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	policies, err := residency.ListPolicies()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load residency policies")
+	}
+	overview := ResidencyOverview{Region: region.Default().Current, Backends: []residency.Backend{}, Policies: policies}
+	for _, backend := range residency.Default().Backends {
+		overview.Backends = append(overview.Backends, backend)
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Residency policies retrieved successfully",
+		Data:    overview,
+	})
+}
@@ -0,0 +1,561 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/ipfs"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// DocTypeCalibrationCertificate is the document type of device calibration certificates
+const DocTypeCalibrationCertificate = "calibration_certificate"
+
+// calibrationDueSoon is how far ahead a calibration counts as due soon
+const calibrationDueSoon = 30 * 24 * time.Hour
+
+// DeviceRequest represents a request to register or update a device
+type DeviceRequest struct {
+	SerialNumber            string     `json:"serial_number"`
+	DeviceType              string     `json:"device_type"`
+	Manufacturer            string     `json:"manufacturer"`
+	Model                   string     `json:"model"`
+	HatcheryID              int        `json:"hatchery_id"`
+	CalibrationIntervalDays int        `json:"calibration_interval_days"`
+	LastCalibratedAt        *time.Time `json:"last_calibrated_at"`
+	CalibrationDueAt        *time.Time `json:"calibration_due_at"`
+	Notes                   string     `json:"notes"`
+}
+
+const deviceColumns = `
+	id, serial_number, device_type, COALESCE(manufacturer, ''), COALESCE(model, ''), COALESCE(hatchery_id, 0),
+	COALESCE(calibration_interval_days, 0), last_calibrated_at, calibration_due_at,
+	(calibration_due_at IS NOT NULL AND calibration_due_at < NOW()),
+	COALESCE(notes, ''), created_at, updated_at, is_active
+`
+
+// scanDevice reads a device selected with deviceColumns
+func scanDevice(row rowScanner) (models.Device, error) {
+	var d models.Device
+	var lastCalibratedAt, calibrationDueAt sql.NullTime
+	err := row.Scan(&d.ID, &d.SerialNumber, &d.DeviceType, &d.Manufacturer, &d.Model, &d.HatcheryID,
+		&d.CalibrationIntervalDays, &lastCalibratedAt, &calibrationDueAt, &d.CalibrationOverdue,
+		&d.Notes, &d.CreatedAt, &d.UpdatedAt, &d.IsActive)
+	if lastCalibratedAt.Valid {
+		d.LastCalibratedAt = &lastCalibratedAt.Time
+	}
+	if calibrationDueAt.Valid {
+		d.CalibrationDueAt = &calibrationDueAt.Time
+	}
+	return d, err
+}
+
+// loadDevice loads an active device
+func loadDevice(deviceID int) (models.Device, error) {
+	return scanDevice(db.DB.QueryRow(`SELECT `+deviceColumns+` FROM device WHERE id = $1 AND is_active = true`, deviceID))
+}
+
+// intPtr converts a nullable column to an optional value
+func intPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
+
+// timePtr converts a nullable timestamp column to an optional value
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// readingDevice checks the device of an environment reading of a batch
+// The device must be registered to the facility of the batch
+func readingDevice(deviceID, batchID int) (models.Device, error) {
+	device, err := loadDevice(deviceID)
+	if err == sql.ErrNoRows {
+		return device, fiber.NewError(fiber.StatusNotFound, "Device not found")
+	}
+	if err != nil {
+		return device, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	if device.HatcheryID != 0 {
+		var hatcheryID int
+		err := db.DB.QueryRow("SELECT COALESCE(hatchery_id, 0) FROM batch WHERE id = $1", batchID).Scan(&hatcheryID)
+		if err != nil {
+			return device, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if hatcheryID != device.HatcheryID {
+			return device, fiber.NewError(fiber.StatusBadRequest, "Device is registered to another facility")
+		}
+	}
+	return device, nil
+}
+
+// nextCalibrationDue returns when a device calibrated at the given time is due again
+func nextCalibrationDue(calibratedAt time.Time, intervalDays int) *time.Time {
+	if intervalDays <= 0 {
+		return nil
+	}
+	due := calibratedAt.AddDate(0, 0, intervalDays)
+	return &due
+}
+
+// validateDeviceRequest checks the fields of a device request
+func validateDeviceRequest(req *DeviceRequest) error {
+	req.SerialNumber = strings.TrimSpace(req.SerialNumber)
+	if req.SerialNumber == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Serial number is required")
+	}
+	if req.DeviceType == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Device type is required")
+	}
+	if req.CalibrationIntervalDays < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Calibration interval must not be negative")
+	}
+	if req.HatcheryID != 0 {
+		var exists bool
+		err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM hatchery WHERE id = $1 AND is_active = true)", req.HatcheryID).Scan(&exists)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if !exists {
+			return fiber.NewError(fiber.StatusNotFound, "Hatchery not found")
+		}
+	}
+	if req.CalibrationDueAt == nil && req.LastCalibratedAt != nil {
+		req.CalibrationDueAt = nextCalibrationDue(*req.LastCalibratedAt, req.CalibrationIntervalDays)
+	}
+	return nil
+}
+
+// RegisterDevice registers a sensor or meter
+// @Summary Register device
+// @Description Register a sensor or meter of a facility with its calibration schedule
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param request body DeviceRequest true "Device details"
+// @Success 201 {object} SuccessResponse{data=models.Device}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /devices [post]
+func RegisterDevice(c *fiber.Ctx) error {
+	var req DeviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateDeviceRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM device WHERE serial_number = $1)", req.SerialNumber).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A device with this serial number is already registered")
+	}
+
+	device, err := scanDevice(db.DB.QueryRow(`
+		INSERT INTO device (serial_number, device_type, manufacturer, model, hatchery_id, calibration_interval_days,
+			last_calibrated_at, calibration_due_at, notes, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, $7, $8, $9, NOW(), NOW(), true)
+		RETURNING `+deviceColumns,
+		req.SerialNumber, req.DeviceType, req.Manufacturer, req.Model, req.HatcheryID, req.CalibrationIntervalDays,
+		req.LastCalibratedAt, req.CalibrationDueAt, req.Notes))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to register device")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Device registered successfully",
+		Data:    device,
+	})
+}
+
+// GetAllDevices lists registered devices
+// @Summary List devices
+// @Description List registered devices, optionally filtered by facility, type or calibration status
+// @Tags devices
+// @Produce json
+// @Param hatchery_id query int false "Hatchery ID"
+// @Param device_type query string false "Device type"
+// @Param calibration query string false "Calibration status (overdue, due_soon, ok)"
+// @Success 200 {object} SuccessResponse{data=[]models.Device}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /devices [get]
+func GetAllDevices(c *fiber.Ctx) error {
+	calibration := c.Query("calibration")
+	if calibration != "" && calibration != "overdue" && calibration != "due_soon" && calibration != "ok" {
+		return fiber.NewError(fiber.StatusBadRequest, "Calibration status must be overdue, due_soon or ok")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+deviceColumns+`
+		FROM device
+		WHERE is_active = true
+			AND ($1::int = 0 OR hatchery_id = $1)
+			AND ($2::text = '' OR device_type = $2)
+			AND ($3::text = ''
+				OR ($3 = 'overdue' AND calibration_due_at < NOW())
+				OR ($3 = 'due_soon' AND calibration_due_at >= NOW() AND calibration_due_at < $4)
+				OR ($3 = 'ok' AND (calibration_due_at IS NULL OR calibration_due_at >= $4)))
+		ORDER BY calibration_due_at NULLS LAST, serial_number
+	`, c.QueryInt("hatchery_id", 0), c.Query("device_type"), calibration, time.Now().Add(calibrationDueSoon))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	devices := []models.Device{}
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse device")
+		}
+		devices = append(devices, device)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Devices retrieved successfully",
+		Data:    devices,
+	})
+}
+
+// GetDeviceByID gets a device with its calibration history
+// @Summary Get device
+// @Description Get a registered device with its calibration history
+// @Tags devices
+// @Produce json
+// @Param deviceId path int true "Device ID"
+// @Success 200 {object} SuccessResponse{data=models.Device}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /devices/{deviceId} [get]
+func GetDeviceByID(c *fiber.Ctx) error {
+	deviceID, err := strconv.Atoi(c.Params("deviceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid device ID format")
+	}
+
+	device, err := loadDevice(deviceID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Device not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	device.Calibrations, err = loadDeviceCalibrations(deviceID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve calibrations")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Device retrieved successfully",
+		Data:    device,
+	})
+}
+
+// UpdateDevice updates a registered device
+// @Summary Update device
+// @Description Update the details and calibration schedule of a registered device
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param deviceId path int true "Device ID"
+// @Param request body DeviceRequest true "Device details"
+// @Success 200 {object} SuccessResponse{data=models.Device}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /devices/{deviceId} [put]
+func UpdateDevice(c *fiber.Ctx) error {
+	deviceID, err := strconv.Atoi(c.Params("deviceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid device ID format")
+	}
+
+	var req DeviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateDeviceRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM device WHERE serial_number = $1 AND id <> $2)", req.SerialNumber, deviceID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A device with this serial number is already registered")
+	}
+
+	device, err := scanDevice(db.DB.QueryRow(`
+		UPDATE device
+		SET serial_number = $2, device_type = $3, manufacturer = $4, model = $5, hatchery_id = NULLIF($6, 0),
+			calibration_interval_days = $7,
+			last_calibrated_at = COALESCE($8, last_calibrated_at),
+			calibration_due_at = COALESCE($9, calibration_due_at),
+			notes = $10, updated_at = NOW()
+		WHERE id = $1 AND is_active = true
+		RETURNING `+deviceColumns,
+		deviceID, req.SerialNumber, req.DeviceType, req.Manufacturer, req.Model, req.HatcheryID,
+		req.CalibrationIntervalDays, req.LastCalibratedAt, req.CalibrationDueAt, req.Notes))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Device not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update device")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Device updated successfully",
+		Data:    device,
+	})
+}
+
+// DeleteDevice soft deletes a device
+// @Summary Delete device
+// @Description Soft delete a device (sets is_active to false). Readings it took are kept
+// @Tags devices
+// @Produce json
+// @Param deviceId path int true "Device ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /devices/{deviceId} [delete]
+func DeleteDevice(c *fiber.Ctx) error {
+	deviceID, err := strconv.Atoi(c.Params("deviceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid device ID format")
+	}
+
+	result, err := db.DB.Exec("UPDATE device SET is_active = false, updated_at = NOW() WHERE id = $1 AND is_active = true", deviceID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete device")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Device not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Device deleted successfully",
+	})
+}
+
+// loadDeviceCalibrations returns the calibrations of a device, latest first
+func loadDeviceCalibrations(deviceID int) ([]models.DeviceCalibration, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, device_id, calibrated_at, COALESCE(calibrated_by, ''), due_at, document_id, COALESCE(notes, ''), created_at
+		FROM device_calibration
+		WHERE device_id = $1
+		ORDER BY calibrated_at DESC
+	`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	calibrations := []models.DeviceCalibration{}
+	for rows.Next() {
+		var cal models.DeviceCalibration
+		var dueAt sql.NullTime
+		var documentID sql.NullInt64
+		if err := rows.Scan(&cal.ID, &cal.DeviceID, &cal.CalibratedAt, &cal.CalibratedBy, &dueAt, &documentID, &cal.Notes, &cal.CreatedAt); err != nil {
+			return nil, err
+		}
+		if dueAt.Valid {
+			cal.DueAt = &dueAt.Time
+		}
+		cal.DocumentID = intPtr(documentID)
+		calibrations = append(calibrations, cal)
+	}
+	return calibrations, rows.Err()
+}
+
+// GetDeviceCalibrations lists the calibrations of a device
+// @Summary List device calibrations
+// @Description List the calibration history of a device, latest first
+// @Tags devices
+// @Produce json
+// @Param deviceId path int true "Device ID"
+// @Success 200 {object} SuccessResponse{data=[]models.DeviceCalibration}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /devices/{deviceId}/calibrations [get]
+func GetDeviceCalibrations(c *fiber.Ctx) error {
+	deviceID, err := strconv.Atoi(c.Params("deviceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid device ID format")
+	}
+
+	calibrations, err := loadDeviceCalibrations(deviceID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve calibrations")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Calibrations retrieved successfully",
+		Data:    calibrations,
+	})
+}
+
+// RecordDeviceCalibration records a calibration of a device and attaches its certificate
+// @Summary Record device calibration
+// @Description Record a calibration of a device and move its next due date. The calibration certificate is stored on IPFS as a document
+// @Tags devices
+// @Accept multipart/form-data
+// @Produce json
+// @Param deviceId path int true "Device ID"
+// @Param calibrated_at formData string false "Calibration time (RFC3339, default: now)"
+// @Param calibrated_by formData string false "Calibration lab or technician"
+// @Param due_at formData string false "Next calibration due (RFC3339, default: calibration time plus the device interval)"
+// @Param uploaded_by formData int false "Uploader account ID"
+// @Param notes formData string false "Notes"
+// @Param file formData file false "Calibration certificate"
+// @Success 201 {object} SuccessResponse{data=models.DeviceCalibration}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /devices/{deviceId}/calibrations [post]
+func RecordDeviceCalibration(c *fiber.Ctx) error {
+	deviceID, err := strconv.Atoi(c.Params("deviceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid device ID format")
+	}
+
+	device, err := loadDevice(deviceID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Device not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	calibration := models.DeviceCalibration{
+		DeviceID:     deviceID,
+		CalibratedAt: time.Now(),
+		CalibratedBy: c.FormValue("calibrated_by"),
+		Notes:        c.FormValue("notes"),
+	}
+	if v := c.FormValue("calibrated_at"); v != "" {
+		if calibration.CalibratedAt, err = time.Parse(time.RFC3339, v); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid calibrated_at time, use RFC3339")
+		}
+	}
+	if v := c.FormValue("due_at"); v != "" {
+		dueAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid due_at time, use RFC3339")
+		}
+		calibration.DueAt = &dueAt
+	} else {
+		calibration.DueAt = nextCalibrationDue(calibration.CalibratedAt, device.CalibrationIntervalDays)
+	}
+	uploaderID := 0
+	if v := c.FormValue("uploaded_by"); v != "" {
+		if uploaderID, err = strconv.Atoi(v); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid uploader ID format")
+		}
+	}
+
+	// Store the certificate on IPFS before touching the database
+	var certificate *ipfs.IPFSPinataResult
+	if file, err := c.FormFile("file"); err == nil {
+		if file.Size > 10*1024*1024 {
+			return fiber.NewError(fiber.StatusBadRequest, "File size exceeds 10MB limit")
+		}
+		fileHandle, err := file.Open()
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to open file")
+		}
+		defer fileHandle.Close()
+
+		certificate, err = ipfs.NewIPFSPinataService().UploadFile(fileHandle, file.Filename, map[string]string{
+			"device_id":     strconv.Itoa(deviceID),
+			"serial_number": device.SerialNumber,
+			"document_type": DocTypeCalibrationCertificate,
+			"app":           "TracePost-larvaeChain",
+			"timestamp":     time.Now().Format(time.RFC3339),
+		}, true)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to upload certificate: "+err.Error())
+		}
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	if certificate != nil {
+		uri := certificate.IPFSUri
+		if certificate.PinataSuccess && certificate.PinataUri != "" {
+			uri = certificate.PinataUri
+		}
+		var documentID int
+		err = tx.QueryRow(`
+			INSERT INTO document (device_id, doc_type, ipfs_hash, ipfs_uri, file_name, file_size, uploaded_by, uploaded_at, updated_at, is_active)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NOW(), NOW(), true)
+			RETURNING id
+		`, deviceID, DocTypeCalibrationCertificate, certificate.CID, uri, certificate.Name, certificate.Size, uploaderID).Scan(&documentID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to save certificate")
+		}
+		calibration.DocumentID = &documentID
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO device_calibration (device_id, calibrated_at, calibrated_by, due_at, document_id, notes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, created_at
+	`, deviceID, calibration.CalibratedAt, calibration.CalibratedBy, calibration.DueAt, calibration.DocumentID, calibration.Notes).Scan(&calibration.ID, &calibration.CreatedAt)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save calibration")
+	}
+
+	// An older calibration entered late does not move the schedule back
+	_, err = tx.Exec(`
+		UPDATE device
+		SET last_calibrated_at = $2, calibration_due_at = $3, updated_at = NOW()
+		WHERE id = $1 AND (last_calibrated_at IS NULL OR last_calibrated_at <= $2)
+	`, deviceID, calibration.CalibratedAt, calibration.DueAt)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update device")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit calibration")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Calibration recorded successfully",
+		Data:    calibration,
+	})
+}
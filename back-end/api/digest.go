@@ -0,0 +1,78 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/digest"
+	"github.com/LTPPPP/TracePost-larvaeChain/mailer"
+)
+
+// DigestPreview is the digest a user would receive for the last complete period
+type DigestPreview struct {
+	Subject string         `json:"subject"`
+	Body    string         `json:"body"`
+	HTML    string         `json:"html"`
+	Summary digest.Summary `json:"summary"`
+}
+
+// PreviewDigest renders the current user's digest for the last complete period
+// @Summary Preview digest email
+// @Description Render the daily or weekly digest of the current user's company for the last complete period, in the user's language.
+// @Description Digests summarize new batches, status changes, upcoming certificate expiries and open alerts; users opt in with digest_frequency in their preferences
+// @Tags users
+// @Produce json
+// @Param frequency query string false "daily or weekly (defaults to the saved frequency, or daily)"
+// @Success 200 {object} SuccessResponse{data=DigestPreview}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/me/digest/preview [get]
+func PreviewDigest(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	prefs, err := loadUserPreferences(userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load preferences")
+	}
+
+	frequency := c.Query("frequency", prefs.DigestFrequency)
+	if frequency == "" {
+		frequency = digest.FrequencyDaily
+	}
+	if !digest.IsFrequency(frequency) {
+		return fiber.NewError(fiber.StatusBadRequest, "Frequency must be daily or weekly")
+	}
+
+	var companyID int
+	var name string
+	err = db.DB.QueryRow(`
+		SELECT COALESCE(company_id, 0), COALESCE(NULLIF(full_name, ''), username) FROM account WHERE id = $1 AND is_active = true
+	`, userID).Scan(&companyID, &name)
+	if err != nil || companyID == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "User is not a member of a company")
+	}
+
+	service := digest.Default()
+	start, end := service.Period(frequency, time.Now())
+	summary, err := service.Summarize(companyID, frequency, start, end)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to summarize company activity")
+	}
+	subject, body := service.Render(summary, name, prefs.Language)
+	message, err := mailer.Default().Render(mailer.TemplateDigest, prefs.Language, mailer.TextData(subject, body))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to render digest email")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Digest preview rendered successfully",
+		Data:    DigestPreview{Subject: subject, Body: body, HTML: message.HTML, Summary: summary},
+	})
+}
@@ -0,0 +1,568 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/accesslog"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+)
+
+// Document sensitivity levels, from least to most sensitive
+const (
+	SensitivityPublic       = "public"       // Shown on consumer traces, e.g. health certificates
+	SensitivityInternal     = "internal"     // Companies handling the batch and their auditors
+	SensitivityConfidential = "confidential" // The owner and its auditors, e.g. commercial invoices
+	SensitivityRestricted   = "restricted"   // The owner only
+)
+
+// documentSensitivities lists the levels in order
+var documentSensitivities = []string{SensitivityPublic, SensitivityInternal, SensitivityConfidential, SensitivityRestricted}
+
+// Relationships of a caller to the batch a document belongs to
+const (
+	RelationOwner        = "owner"        // The caller's company owns the batch
+	RelationCounterparty = "counterparty" // The caller's company sent, received, sold or bought the batch
+	RelationAuditor      = "auditor"      // The caller holds an active audit grant on the batch's hatchery
+	RelationOther        = "other"        // Any other signed in caller
+	RelationAnonymous    = "anonymous"    // Callers without an account, such as consumers scanning a QR code
+)
+
+// documentRelations lists the relationships policies can name
+var documentRelations = []string{RelationOwner, RelationCounterparty, RelationAuditor, RelationOther, RelationAnonymous}
+
+// DocumentAccessPolicy allows callers with one of the roles and relationships to see documents of a sensitivity
+// Empty roles or relationships match any; platform admins see every document
+type DocumentAccessPolicy struct {
+	ID            int      `json:"id,omitempty"`
+	Sensitivity   string   `json:"sensitivity"`
+	Roles         []string `json:"roles"`
+	Relationships []string `json:"relationships"`
+	Description   string   `json:"description,omitempty"`
+}
+
+// DocumentAccessPoliciesRequest replaces the document access policies
+type DocumentAccessPoliciesRequest struct {
+	Policies []DocumentAccessPolicy `json:"policies"`
+}
+
+// DocumentSensitivityRequest reclassifies a document
+type DocumentSensitivityRequest struct {
+	Sensitivity string `json:"sensitivity"` // public, internal, confidential or restricted
+}
+
+// defaultDocumentAccessPolicies apply until an admin saves policies of their own
+func defaultDocumentAccessPolicies() []DocumentAccessPolicy {
+	return []DocumentAccessPolicy{
+		{Sensitivity: SensitivityPublic, Roles: []string{}, Relationships: []string{}, Description: "Anyone, including consumers"},
+		{Sensitivity: SensitivityInternal, Roles: []string{}, Relationships: []string{RelationOwner, RelationCounterparty, RelationAuditor}, Description: "Companies handling the batch and their auditors"},
+		{Sensitivity: SensitivityConfidential, Roles: []string{}, Relationships: []string{RelationOwner, RelationAuditor}, Description: "The owner and its auditors"},
+		{Sensitivity: SensitivityRestricted, Roles: []string{}, Relationships: []string{RelationOwner}, Description: "The owner only"},
+	}
+}
+
+// defaultDocumentSensitivity classifies a new document from its type when the uploader does not
+func defaultDocumentSensitivity(docType string) string {
+	docType = strings.ToLower(docType)
+	for _, commercial := range db.CommercialDocumentTypes {
+		if strings.Contains(docType, commercial) {
+			return SensitivityConfidential
+		}
+	}
+	return SensitivityPublic
+}
+
+// uploadedDocumentSensitivity resolves the level of an uploaded document, classified from its type when not given
+func uploadedDocumentSensitivity(value, docType string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return defaultDocumentSensitivity(docType), nil
+	}
+	if !validDocumentSensitivity(value) {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Sensitivity must be public, internal, confidential or restricted")
+	}
+	return value, nil
+}
+
+// validDocumentSensitivity reports whether a level is known
+func validDocumentSensitivity(sensitivity string) bool {
+	for _, s := range documentSensitivities {
+		if s == sensitivity {
+			return true
+		}
+	}
+	return false
+}
+
+// loadDocumentAccessPolicies loads the saved policies, or the defaults when none were saved
+func loadDocumentAccessPolicies() ([]DocumentAccessPolicy, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, sensitivity, roles, relationships, COALESCE(description, '')
+		FROM document_access_policy ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	policies := []DocumentAccessPolicy{}
+	for rows.Next() {
+		var p DocumentAccessPolicy
+		if err := rows.Scan(&p.ID, &p.Sensitivity, pq.Array(&p.Roles), pq.Array(&p.Relationships), &p.Description); err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return defaultDocumentAccessPolicies(), nil
+	}
+	return policies, nil
+}
+
+// documentViewer is the caller of a request reading documents, with the policies that apply
+type documentViewer struct {
+	role      string
+	userID    int
+	companyID int
+	policies  []DocumentAccessPolicy
+	relations map[string]string // Relationship per batch or hatchery, resolved once per request
+}
+
+// newDocumentViewer resolves the attributes of the caller
+func newDocumentViewer(c *fiber.Ctx) (*documentViewer, error) {
+	v := &documentViewer{relations: map[string]string{}}
+	v.role, _ = c.Locals("role").(string)
+	v.userID, _ = c.Locals("userID").(int)
+	v.companyID, _ = c.Locals("companyID").(int)
+	if v.role == "admin" {
+		return v, nil
+	}
+	policies, err := loadDocumentAccessPolicies()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to load document access policies")
+	}
+	v.policies = policies
+	return v, nil
+}
+
+// relationship resolves how the caller relates to a batch
+func (v *documentViewer) relationship(batchID int) (string, error) {
+	return v.resolve("batch:"+strconv.Itoa(batchID), `
+		SELECT CASE
+			WHEN `+batchOwnerCompany+` = $2 THEN 'owner'
+			WHEN EXISTS(
+				SELECT 1 FROM shipment_transfer st
+				LEFT JOIN account sa ON sa.id = st.sender_id
+				LEFT JOIN account ra ON ra.id = st.receiver_id
+				WHERE st.batch_id = b.id AND st.is_active = true AND $2 IN (sa.company_id, ra.company_id)
+			) OR EXISTS(
+				SELECT 1 FROM batch_ownership_transfer ot
+				WHERE ot.batch_id = b.id AND $2 IN (ot.seller_company_id, ot.buyer_company_id)
+			) THEN 'counterparty'
+			WHEN $4 = $5 AND EXISTS(
+				SELECT 1 FROM audit_access_grant g
+				WHERE g.auditor_id = $3 AND g.hatchery_id = b.hatchery_id AND g.is_active = true
+					AND g.revoked_at IS NULL AND g.expires_at > NOW()
+			) THEN 'auditor'
+			ELSE 'other'
+		END
+		FROM batch b JOIN hatchery h ON h.id = b.hatchery_id
+		WHERE b.id = $1
+	`, batchID)
+}
+
+// hatcheryRelationship resolves how the caller relates to a hatchery, for documents of its broodstock
+func (v *documentViewer) hatcheryRelationship(hatcheryID int) (string, error) {
+	return v.resolve("hatchery:"+strconv.Itoa(hatcheryID), `
+		SELECT CASE
+			WHEN h.company_id = $2 THEN 'owner'
+			WHEN $4 = $5 AND EXISTS(
+				SELECT 1 FROM audit_access_grant g
+				WHERE g.auditor_id = $3 AND g.hatchery_id = h.id AND g.is_active = true
+					AND g.revoked_at IS NULL AND g.expires_at > NOW()
+			) THEN 'auditor'
+			ELSE 'other'
+		END
+		FROM hatchery h
+		WHERE h.id = $1
+	`, hatcheryID)
+}
+
+// resolve runs a relationship query taking the target as $1 and the caller's company, user, role and
+// the auditor role as $2 to $5
+func (v *documentViewer) resolve(key, query string, targetID int) (string, error) {
+	if v.userID == 0 {
+		return RelationAnonymous, nil
+	}
+	if relation, ok := v.relations[key]; ok {
+		return relation, nil
+	}
+	var relation string
+	err := db.DB.QueryRow(query, targetID, v.companyID, v.userID, v.role, middleware.RoleAuditor).Scan(&relation)
+	if err == sql.ErrNoRows {
+		relation = RelationOther
+	} else if err != nil {
+		return "", err
+	}
+	v.relations[key] = relation
+	return relation, nil
+}
+
+// allows reports whether a policy covers the caller
+func (p DocumentAccessPolicy) allows(role, relation string) bool {
+	return (len(p.Roles) == 0 || containsString(p.Roles, role)) &&
+		(len(p.Relationships) == 0 || containsString(p.Relationships, relation))
+}
+
+// sensitivitiesFor lists the levels a caller with a relationship may see
+func (v *documentViewer) sensitivitiesFor(relation string) []string {
+	if v.role == "admin" {
+		return documentSensitivities
+	}
+	levels := []string{}
+	for _, level := range documentSensitivities {
+		for _, p := range v.policies {
+			if p.Sensitivity == level && p.allows(v.role, relation) {
+				levels = append(levels, level)
+				break
+			}
+		}
+	}
+	return levels
+}
+
+// visibleSensitivities lists the levels of documents of a batch the caller may see
+func (v *documentViewer) visibleSensitivities(batchID int) ([]string, error) {
+	if v.role == "admin" {
+		return documentSensitivities, nil
+	}
+	relation, err := v.relationship(batchID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to resolve document access")
+	}
+	return v.sensitivitiesFor(relation), nil
+}
+
+// visibleHatcherySensitivities lists the levels of documents of a hatchery's broodstock the caller may see
+func (v *documentViewer) visibleHatcherySensitivities(hatcheryID int) ([]string, error) {
+	if v.role == "admin" {
+		return documentSensitivities, nil
+	}
+	relation, err := v.hatcheryRelationship(hatcheryID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to resolve document access")
+	}
+	return v.sensitivitiesFor(relation), nil
+}
+
+// documentSensitivityFilter is the condition limiting document rows to the levels bound to $n
+func documentSensitivityFilter(alias string, n int) string {
+	if alias != "" {
+		alias += "."
+	}
+	return " AND COALESCE(" + alias + "sensitivity, '" + SensitivityPublic + "') = ANY($" + strconv.Itoa(n) + ")"
+}
+
+// visibleBatchDocumentLevels resolves the levels of a batch's documents the caller of a request may see,
+// ready to bind to documentSensitivityFilter
+func visibleBatchDocumentLevels(c *fiber.Ctx, batchID int) (interface{}, error) {
+	viewer, err := newDocumentViewer(c)
+	if err != nil {
+		return nil, err
+	}
+	levels, err := viewer.visibleSensitivities(batchID)
+	if err != nil {
+		return nil, err
+	}
+	return pq.Array(levels), nil
+}
+
+// visibleBroodstockDocumentLevels resolves the levels of a broodstock record's documents the caller may see
+func visibleBroodstockDocumentLevels(c *fiber.Ctx, broodstockID int) (interface{}, error) {
+	viewer, err := newDocumentViewer(c)
+	if err != nil {
+		return nil, err
+	}
+	var hatcheryID int
+	if err := db.DB.QueryRow("SELECT hatchery_id FROM broodstock WHERE id = $1", broodstockID).Scan(&hatcheryID); err != nil && err != sql.ErrNoRows {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to resolve document access")
+	}
+	levels, err := viewer.visibleHatcherySensitivities(hatcheryID)
+	if err != nil {
+		return nil, err
+	}
+	return pq.Array(levels), nil
+}
+
+// relationDocumentLevels lists the levels a caller holding a known relationship may see
+func relationDocumentLevels(c *fiber.Ctx, relation string) (interface{}, error) {
+	viewer, err := newDocumentViewer(c)
+	if err != nil {
+		return nil, err
+	}
+	return pq.Array(viewer.sensitivitiesFor(relation)), nil
+}
+
+// authorizeDocument rejects callers that may not see a document
+func authorizeDocument(c *fiber.Ctx, documentID int) error {
+	var batchID, hatcheryID sql.NullInt64
+	var sensitivity string
+	err := db.DB.QueryRow(`
+		SELECT d.batch_id, bs.hatchery_id, COALESCE(d.sensitivity, $2)
+		FROM document d
+		LEFT JOIN broodstock bs ON bs.id = d.broodstock_id
+		WHERE d.id = $1
+	`, documentID, SensitivityPublic).Scan(&batchID, &hatcheryID, &sensitivity)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Document not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	viewer, err := newDocumentViewer(c)
+	if err != nil {
+		return err
+	}
+	var levels []string
+	if !batchID.Valid && hatcheryID.Valid {
+		levels, err = viewer.visibleHatcherySensitivities(int(hatcheryID.Int64))
+	} else {
+		levels, err = viewer.visibleSensitivities(int(batchID.Int64))
+	}
+	if err != nil {
+		return err
+	}
+	allowed := containsString(levels, sensitivity)
+	logDocumentAccess(c, documentID, int(batchID.Int64), allowed)
+	if !allowed {
+		return fiber.NewError(fiber.StatusForbidden, "You are not allowed to see this document")
+	}
+	return checkDocumentRegion(documentID)
+}
+
+// logDocumentAccess adds a read of, or refused access to, a document to the hash-chained access log
+func logDocumentAccess(c *fiber.Ctx, documentID, batchID int, allowed bool) {
+	userID, _ := c.Locals("userID").(int)
+	role, _ := c.Locals("role").(string)
+	err := accesslog.Record(accesslog.Entry{
+		DocumentID: documentID,
+		BatchID:    batchID,
+		AccountID:  userID,
+		Role:       role,
+		Method:     c.Method(),
+		Path:       c.Path(),
+		IPAddress:  c.IP(),
+		Allowed:    allowed,
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to log access to document %d: %v\n", documentID, err)
+	}
+}
+
+// UpdateDocumentSensitivity reclassifies a document and its translations
+// @Summary Update document sensitivity
+// @Description Reclassify a document as public, internal, confidential or restricted; its translations follow. Only the company owning the document's batch or broodstock, or an admin, may do this
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param documentId path string true "Document ID"
+// @Param request body DocumentSensitivityRequest true "New sensitivity"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /documents/{documentId}/sensitivity [put]
+func UpdateDocumentSensitivity(c *fiber.Ctx) error {
+	documentID, err := strconv.Atoi(c.Params("documentId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid document ID format")
+	}
+	var req DocumentSensitivityRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.Sensitivity = strings.ToLower(strings.TrimSpace(req.Sensitivity))
+	if !validDocumentSensitivity(req.Sensitivity) {
+		return fiber.NewError(fiber.StatusBadRequest, "Sensitivity must be public, internal, confidential or restricted")
+	}
+
+	var batchID sql.NullInt64
+	var hatcheryCompanyID sql.NullInt64
+	err = db.DB.QueryRow(`
+		SELECT d.batch_id, h.company_id
+		FROM document d
+		LEFT JOIN broodstock bs ON bs.id = d.broodstock_id
+		LEFT JOIN hatchery h ON h.id = bs.hatchery_id
+		WHERE d.id = $1 AND d.translation_of IS NULL
+	`, documentID).Scan(&batchID, &hatcheryCompanyID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Document not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	// Only the owner of what the document describes may reclassify it
+	role, _ := c.Locals("role").(string)
+	switch {
+	case batchID.Valid:
+		if _, err := batchOwner(c, int(batchID.Int64)); err != nil {
+			return err
+		}
+	case hatcheryCompanyID.Valid:
+		if err := actsForCompany(c, int(hatcheryCompanyID.Int64)); err != nil {
+			return err
+		}
+	case role != "admin":
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	if _, err := db.DB.Exec(`
+		UPDATE document SET sensitivity = $2, updated_at = NOW() WHERE id = $1 OR translation_of = $1
+	`, documentID, req.Sensitivity); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update document sensitivity")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Document sensitivity updated successfully",
+		Data:    fiber.Map{"document_id": documentID, "sensitivity": req.Sensitivity},
+	})
+}
+
+// ListDocumentAccessPolicies lists the policies deciding who sees documents of each sensitivity
+// @Summary List document access policies
+// @Description List the policies combining role and relationship to a batch that allow seeing documents of each sensitivity; the defaults are returned until policies are saved
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]DocumentAccessPolicy}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/document-access-policies [get]
+func ListDocumentAccessPolicies(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	policies, err := loadDocumentAccessPolicies()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load document access policies")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Document access policies retrieved successfully",
+		Data:    policies,
+	})
+}
+
+// ReplaceDocumentAccessPolicies replaces every document access policy
+// @Summary Replace document access policies
+// @Description Replace the document access policies. A policy allows callers with one of its roles and one of its relationships (owner, counterparty, auditor, other or anonymous) to see documents of its sensitivity; empty lists match any
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body DocumentAccessPoliciesRequest true "Policies"
+// @Success 200 {object} SuccessResponse{data=[]DocumentAccessPolicy}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/document-access-policies [put]
+func ReplaceDocumentAccessPolicies(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	var req DocumentAccessPoliciesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if len(req.Policies) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one policy is required; delete the policies to restore the defaults")
+	}
+	for i := range req.Policies {
+		p := &req.Policies[i]
+		p.Sensitivity = strings.ToLower(strings.TrimSpace(p.Sensitivity))
+		if !validDocumentSensitivity(p.Sensitivity) {
+			return fiber.NewError(fiber.StatusBadRequest, "Sensitivity must be public, internal, confidential or restricted")
+		}
+		for _, relation := range p.Relationships {
+			if !containsString(documentRelations, relation) {
+				return fiber.NewError(fiber.StatusBadRequest, "Unknown relationship: "+relation)
+			}
+		}
+		if p.Roles == nil {
+			p.Roles = []string{}
+		}
+		if p.Relationships == nil {
+			p.Relationships = []string{}
+		}
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM document_access_policy"); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to replace document access policies")
+	}
+	for i := range req.Policies {
+		p := &req.Policies[i]
+		if err := tx.QueryRow(`
+			INSERT INTO document_access_policy (sensitivity, roles, relationships, description, created_by)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, 0))
+			RETURNING id
+		`, p.Sensitivity, pq.Array(p.Roles), pq.Array(p.Relationships), p.Description, userID).Scan(&p.ID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to replace document access policies")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to replace document access policies")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Document access policies replaced successfully",
+		Data:    req.Policies,
+	})
+}
+
+// ResetDocumentAccessPolicies deletes the saved policies so the defaults apply again
+// @Summary Reset document access policies
+// @Description Delete the saved document access policies and restore the defaults
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]DocumentAccessPolicy}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/document-access-policies [delete]
+func ResetDocumentAccessPolicies(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	if _, err := db.DB.Exec("DELETE FROM document_access_policy"); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to reset document access policies")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Document access policies reset to the defaults",
+		Data:    defaultDocumentAccessPolicies(),
+	})
+}
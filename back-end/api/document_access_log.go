@@ -0,0 +1,141 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/accesslog"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+)
+
+// documentAccessPeriod reads the period of a document access log request, by default the last 30 days
+func documentAccessPeriod(c *fiber.Ctx) (time.Time, time.Time, error) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return from, to, err
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -30)
+	}
+	if from.After(to) {
+		return from, to, fiber.NewError(fiber.StatusBadRequest, "from must be before to")
+	}
+	return from, to, nil
+}
+
+// canReviewDocumentAccess reports whether the caller may see the document access chain: admins and auditors
+func canReviewDocumentAccess(c *fiber.Ctx) bool {
+	role, _ := c.Locals("role").(string)
+	return role == "admin" || role == middleware.RoleAuditor
+}
+
+// ListDocumentAccessLog lists document access log entries
+// @Summary List document access log
+// @Description List reads of and refused access to single documents, oldest first
+// @Tags audit
+// @Produce json
+// @Param document_id query int false "Only entries of this document"
+// @Param from query string false "Start time (RFC3339), default 30 days before to"
+// @Param to query string false "End time (RFC3339), default now"
+// @Param limit query int false "Maximum number of entries (default 100, at most 1000)"
+// @Success 200 {object} SuccessResponse{data=[]accesslog.Entry}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit/document-access [get]
+func ListDocumentAccessLog(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	from, to, err := documentAccessPeriod(c)
+	if err != nil {
+		return err
+	}
+
+	entries, err := accesslog.Entries(c.QueryInt("document_id", 0), from, to, c.QueryInt("limit", 100))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve document access log")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Document access log retrieved successfully",
+		Data:    entries,
+	})
+}
+
+// ListDocumentAccessChain lists the sealed segments of the document access log
+// @Summary List document access chain segments
+// @Description List the segments the document access log is sealed into, with their hash chain heads and the transactions anchoring them on-chain. Segments are sealed and anchored on a schedule
+// @Tags audit
+// @Produce json
+// @Param from query string false "Start time (RFC3339), default 30 days before to"
+// @Param to query string false "End time (RFC3339), default now"
+// @Success 200 {object} SuccessResponse{data=[]accesslog.Segment}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit/document-access/chain [get]
+func ListDocumentAccessChain(c *fiber.Ctx) error {
+	if !canReviewDocumentAccess(c) {
+		return fiber.NewError(fiber.StatusForbidden, "Only admins and auditors can review the document access chain")
+	}
+	from, to, err := documentAccessPeriod(c)
+	if err != nil {
+		return err
+	}
+
+	segments, err := accesslog.Segments(from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve document access chain")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Document access chain retrieved successfully",
+		Data:    segments,
+	})
+}
+
+// VerifyDocumentAccessChain verifies the continuity of the document access log over a period
+// @Summary Verify document access chain
+// @Description Recompute the hash chain of the document access log over the segments holding entries of a period and compare it with the sealed heads, each segment having to follow the one before it.
+// @Description An entry edited, deleted or inserted after sealing, or a removed segment, makes the chain invalid. Segments not anchored yet and entries not sealed yet are reported; compare the heads with the anchoring transactions for on-chain evidence
+// @Tags audit
+// @Produce json
+// @Param from query string false "Start time (RFC3339), default 30 days before to"
+// @Param to query string false "End time (RFC3339), default now"
+// @Success 200 {object} SuccessResponse{data=accesslog.Verification}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit/document-access/verify [get]
+func VerifyDocumentAccessChain(c *fiber.Ctx) error {
+	if !canReviewDocumentAccess(c) {
+		return fiber.NewError(fiber.StatusForbidden, "Only admins and auditors can review the document access chain")
+	}
+	from, to, err := documentAccessPeriod(c)
+	if err != nil {
+		return err
+	}
+
+	verification, err := accesslog.Verify(from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify document access chain")
+	}
+
+	message := "Document access chain is intact"
+	if !verification.Valid {
+		message = "Document access chain is broken"
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    verification,
+	})
+}
@@ -0,0 +1,581 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/mailer"
+)
+
+// Statuses of a document request. Overdue is not stored: it is a pending request past its due date
+const (
+	DocumentRequestPending   = "pending"
+	DocumentRequestOverdue   = "overdue"
+	DocumentRequestFulfilled = "fulfilled"
+	DocumentRequestCancelled = "cancelled"
+)
+
+// documentRequestGrace is how long the upload link of a request keeps working after its due date
+const documentRequestGrace = 7 * 24 * time.Hour
+
+// DocumentRequest asks a counterparty without an account to upload a document for a batch through an emailed link
+type DocumentRequest struct {
+	ID             int        `json:"id"`
+	BatchID        int        `json:"batch_id"`
+	CompanyID      *int       `json:"company_id,omitempty"` // Batch owner requesting the document
+	DocType        string     `json:"doc_type"`
+	Message        string     `json:"message,omitempty"`
+	RecipientName  string     `json:"recipient_name"`
+	RecipientEmail string     `json:"recipient_email"`
+	DueAt          time.Time  `json:"due_at"`
+	Status         string     `json:"status"` // pending, overdue, fulfilled or cancelled
+	TokenID        *int       `json:"token_id,omitempty"`
+	DocumentID     *int       `json:"document_id,omitempty"` // Uploaded document once fulfilled
+	EmailSentAt    *time.Time `json:"email_sent_at,omitempty"`
+	EmailError     string     `json:"email_error,omitempty"` // Why the last email could not be sent
+	Link           string     `json:"link,omitempty"`        // Upload link, only returned when the request is sent
+	RequestedBy    *int       `json:"requested_by,omitempty"`
+	FulfilledAt    *time.Time `json:"fulfilled_at,omitempty"`
+	CancelledAt    *time.Time `json:"cancelled_at,omitempty"`
+	CancelledBy    *int       `json:"cancelled_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// DocumentRequestRequest represents a request for a document from a counterparty
+type DocumentRequestRequest struct {
+	DocType        string    `json:"doc_type"` // e.g. health_certificate, import_permit
+	RecipientName  string    `json:"recipient_name"`
+	RecipientEmail string    `json:"recipient_email"`
+	Message        string    `json:"message"`
+	DueAt          time.Time `json:"due_at"` // At most 30 days ahead
+}
+
+// DocumentRequestResendRequest represents sending a document request again, optionally with a new due date
+type DocumentRequestResendRequest struct {
+	DueAt *time.Time `json:"due_at"`
+}
+
+// SupplierDocumentRequest is what a counterparty sees of the request its link was sent for
+type SupplierDocumentRequest struct {
+	ID            int       `json:"id"`
+	BatchID       int       `json:"batch_id"`
+	Species       string    `json:"species"`
+	CompanyName   string    `json:"company_name"`
+	DocType       string    `json:"doc_type"`
+	Message       string    `json:"message,omitempty"`
+	RecipientName string    `json:"recipient_name"`
+	DueAt         time.Time `json:"due_at"`
+	Status        string    `json:"status"`
+	ExpiresAt     time.Time `json:"expires_at"` // When the upload link stops working
+}
+
+// documentRequestStatus reports pending requests past their due date as overdue
+const documentRequestStatus = `CASE WHEN status = 'pending' AND due_at < NOW() THEN 'overdue' ELSE status END`
+
+const documentRequestColumns = `
+	id, batch_id, company_id, doc_type, COALESCE(message, ''), recipient_name, recipient_email, due_at,
+	` + documentRequestStatus + `, token_id, document_id, email_sent_at, COALESCE(email_error, ''), requested_by,
+	fulfilled_at, cancelled_at, cancelled_by, created_at, updated_at
+`
+
+// scanDocumentRequest reads a request selected with documentRequestColumns
+func scanDocumentRequest(row rowScanner) (DocumentRequest, error) {
+	var r DocumentRequest
+	var companyID, tokenID, documentID, requestedBy, cancelledBy sql.NullInt64
+	var emailSentAt, fulfilledAt, cancelledAt sql.NullTime
+	err := row.Scan(&r.ID, &r.BatchID, &companyID, &r.DocType, &r.Message, &r.RecipientName, &r.RecipientEmail, &r.DueAt,
+		&r.Status, &tokenID, &documentID, &emailSentAt, &r.EmailError, &requestedBy,
+		&fulfilledAt, &cancelledAt, &cancelledBy, &r.CreatedAt, &r.UpdatedAt)
+	r.CompanyID = intPtr(companyID)
+	r.TokenID = intPtr(tokenID)
+	r.DocumentID = intPtr(documentID)
+	r.EmailSentAt = timePtr(emailSentAt)
+	r.RequestedBy = intPtr(requestedBy)
+	r.FulfilledAt = timePtr(fulfilledAt)
+	r.CancelledAt = timePtr(cancelledAt)
+	r.CancelledBy = intPtr(cancelledBy)
+	return r, err
+}
+
+// documentRequestLink builds the upload link emailed to the counterparty
+func documentRequestLink(secret string) string {
+	cfg := config.GetConfig()
+	link := cfg.SupplierPortalURL
+	if link == "" {
+		link = strings.TrimSuffix(cfg.BaseURL, "/") + "/api/v1/supplier/document-request"
+	}
+	separator := "?"
+	if strings.Contains(link, "?") {
+		separator = "&"
+	}
+	return link + separator + "token=" + url.QueryEscape(secret)
+}
+
+// sendDocumentRequest issues the single-use upload token of a request, emails the link to the counterparty
+// and records the outcome. A failed email does not fail the request: the link is returned for the owner to share
+func sendDocumentRequest(c *fiber.Ctx, req *DocumentRequest, userID int) error {
+	expiresAt := req.DueAt.Add(documentRequestGrace)
+	if latest := time.Now().Add(maxBatchAccessLifetime); expiresAt.After(latest) {
+		expiresAt = latest
+	}
+	maxUses := 1
+	token, err := issueBatchAccessToken(c, BatchAccessToken{
+		BatchID:       req.BatchID,
+		CompanyID:     req.CompanyID,
+		SupplierName:  req.RecipientName,
+		SupplierEmail: req.RecipientEmail,
+		Scopes:        []string{BatchAccessUploadRequestedDocument},
+		ExpiresAt:     expiresAt,
+		MaxUses:       &maxUses,
+	}, userID)
+	if err != nil {
+		return err
+	}
+	link := documentRequestLink(token.Token)
+
+	var companyName string
+	if req.CompanyID != nil {
+		db.DB.QueryRow("SELECT COALESCE(name, '') FROM company WHERE id = $1", *req.CompanyID).Scan(&companyName)
+	}
+	if companyName == "" {
+		companyName = "A TracePost member"
+	}
+	// The recipient may not have an account, so the email is in the requester's language
+	lang, _ := c.Locals("lang").(string)
+	emailError := ""
+	if err := mailer.Send(req.RecipientEmail, mailer.TemplateDocumentRequest, lang, map[string]interface{}{
+		"Name":      req.RecipientName,
+		"Company":   companyName,
+		"DocType":   strings.ReplaceAll(req.DocType, "_", " "),
+		"BatchID":   req.BatchID,
+		"DueDate":   req.DueAt.Format("2006-01-02"),
+		"Message":   req.Message,
+		"Link":      link,
+		"ExpiresAt": expiresAt.Format("2006-01-02 15:04 MST"),
+	}); err != nil {
+		fmt.Printf("Failed to send document request %d email to %s: %v\n", req.ID, req.RecipientEmail, err)
+		emailError = err.Error()
+	}
+	updated, err := scanDocumentRequest(db.DB.QueryRow(`
+		UPDATE document_request
+		SET token_id = $2, email_error = NULLIF($3, ''), email_sent_at = CASE WHEN $3 = '' THEN NOW() ELSE email_sent_at END, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+documentRequestColumns,
+		req.ID, token.ID, emailError))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update document request")
+	}
+	*req = updated
+	req.Link = link
+	return nil
+}
+
+// CreateDocumentRequest requests a document for a batch from a counterparty
+// @Summary Request document
+// @Description Request a document of a given type for a batch from a counterparty without an account. The counterparty is emailed a link with a single-use
+// @Description batch access token to upload it; the link keeps working for 7 days after the due date. The request is pending until the document is uploaded and overdue after its due date.
+// @Description The link is also returned in this response, so it can be shared when the email cannot be sent
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param request body DocumentRequestRequest true "Document request"
+// @Success 201 {object} SuccessResponse{data=DocumentRequest}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/document-requests [post]
+func CreateDocumentRequest(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	var req DocumentRequestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.DocType = strings.TrimSpace(req.DocType)
+	req.RecipientName = strings.TrimSpace(req.RecipientName)
+	req.RecipientEmail = strings.TrimSpace(req.RecipientEmail)
+	switch {
+	case req.DocType == "" || len(req.DocType) > 100:
+		return fiber.NewError(fiber.StatusBadRequest, "Document type is required and at most 100 characters")
+	case req.RecipientName == "":
+		return fiber.NewError(fiber.StatusBadRequest, "Recipient name is required")
+	case !strings.Contains(req.RecipientEmail, "@"):
+		return fiber.NewError(fiber.StatusBadRequest, "A valid recipient email is required")
+	case !req.DueAt.After(time.Now()) || req.DueAt.After(time.Now().Add(maxBatchAccessLifetime)):
+		return fiber.NewError(fiber.StatusBadRequest, "Due date must be in the future and at most 30 days ahead")
+	}
+
+	companyID, err := batchOwner(c, batchID)
+	if err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	request, err := scanDocumentRequest(db.DB.QueryRow(`
+		INSERT INTO document_request (batch_id, company_id, doc_type, message, recipient_name, recipient_email, due_at, status,
+			requested_by, created_at, updated_at)
+		VALUES ($1, NULLIF($2, 0), $3, NULLIF($4, ''), $5, $6, $7, $8, NULLIF($9, 0), NOW(), NOW())
+		RETURNING `+documentRequestColumns,
+		batchID, companyID, req.DocType, strings.TrimSpace(req.Message), req.RecipientName, req.RecipientEmail, req.DueAt,
+		DocumentRequestPending, userID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save document request")
+	}
+	if err := sendDocumentRequest(c, &request, userID); err != nil {
+		return err
+	}
+
+	message := "Document request sent successfully"
+	if request.EmailError != "" {
+		message = "Document request created, but the email could not be sent; share the link with the recipient"
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    request,
+	})
+}
+
+// ListBatchDocumentRequests lists the document requests of a batch
+// @Summary List batch document requests
+// @Description List the documents requested from counterparties for a batch, newest first
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param status query string false "pending, overdue, fulfilled or cancelled"
+// @Success 200 {object} SuccessResponse{data=[]DocumentRequest}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/document-requests [get]
+func ListBatchDocumentRequests(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	if _, err := batchOwner(c, batchID); err != nil {
+		return err
+	}
+	return listDocumentRequests(c, "batch_id = $1", batchID)
+}
+
+// ListCompanyDocumentRequests lists the document requests of a company's batches
+// @Summary List document requests
+// @Description List the documents a company requested from counterparties across its batches, newest first, e.g. to follow up overdue requests
+// @Tags batches
+// @Produce json
+// @Param company_id query int false "Company ID (default the caller's company)"
+// @Param status query string false "pending, overdue, fulfilled or cancelled"
+// @Success 200 {object} SuccessResponse{data=[]DocumentRequest}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /document-requests [get]
+func ListCompanyDocumentRequests(c *fiber.Ctx) error {
+	callerCompanyID, _ := c.Locals("companyID").(int)
+	companyID := c.QueryInt("company_id", callerCompanyID)
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+	return listDocumentRequests(c, "company_id = $1", companyID)
+}
+
+// listDocumentRequests responds with the requests matching a condition on $1 and the status query parameter
+func listDocumentRequests(c *fiber.Ctx, condition string, arg int) error {
+	status := c.Query("status")
+	switch status {
+	case "", DocumentRequestPending, DocumentRequestOverdue, DocumentRequestFulfilled, DocumentRequestCancelled:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Status must be pending, overdue, fulfilled or cancelled")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT `+documentRequestColumns+` FROM document_request
+		WHERE `+condition+` AND ($2 = '' OR `+documentRequestStatus+` = $2)
+		ORDER BY created_at DESC, id DESC
+	`, arg, status)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	requests := []DocumentRequest{}
+	for rows.Next() {
+		request, err := scanDocumentRequest(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse document request")
+		}
+		requests = append(requests, request)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Document requests retrieved successfully",
+		Data:    requests,
+	})
+}
+
+// loadOpenDocumentRequest loads a pending or overdue request of a batch for its owner
+func loadOpenDocumentRequest(c *fiber.Ctx) (DocumentRequest, error) {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return DocumentRequest{}, fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	requestID, err := strconv.Atoi(c.Params("requestId"))
+	if err != nil {
+		return DocumentRequest{}, fiber.NewError(fiber.StatusBadRequest, "Invalid document request ID format")
+	}
+	if _, err := batchOwner(c, batchID); err != nil {
+		return DocumentRequest{}, err
+	}
+
+	request, err := scanDocumentRequest(db.DB.QueryRow(`
+		SELECT `+documentRequestColumns+` FROM document_request WHERE id = $1 AND batch_id = $2
+	`, requestID, batchID))
+	if err == sql.ErrNoRows {
+		return request, fiber.NewError(fiber.StatusNotFound, "Document request not found")
+	}
+	if err != nil {
+		return request, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if request.Status != DocumentRequestPending && request.Status != DocumentRequestOverdue {
+		return request, fiber.NewError(fiber.StatusConflict, "Document request is already "+request.Status)
+	}
+	return request, nil
+}
+
+// revokeDocumentRequestToken revokes the upload token of a request, if it still has one
+func revokeDocumentRequestToken(c *fiber.Ctx, request DocumentRequest, userID int, reason string) error {
+	if request.TokenID == nil {
+		return nil
+	}
+	token, err := scanBatchAccessToken(db.DB.QueryRow(`SELECT `+batchAccessTokenColumns+` FROM batch_access_token WHERE id = $1`, *request.TokenID))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	_, err = revokeBatchAccessToken(c, token, userID, reason)
+	return err
+}
+
+// ResendDocumentRequest sends a document request again with a new link
+// @Summary Resend document request
+// @Description Email a pending or overdue request again with a new upload link, optionally with a new due date. The previous link stops working
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param requestId path int true "Document request ID"
+// @Param request body DocumentRequestResendRequest false "New due date"
+// @Success 200 {object} SuccessResponse{data=DocumentRequest}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/document-requests/{requestId}/resend [post]
+func ResendDocumentRequest(c *fiber.Ctx) error {
+	var req DocumentRequestResendRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	if req.DueAt != nil && (!req.DueAt.After(time.Now()) || req.DueAt.After(time.Now().Add(maxBatchAccessLifetime))) {
+		return fiber.NewError(fiber.StatusBadRequest, "Due date must be in the future and at most 30 days ahead")
+	}
+	request, err := loadOpenDocumentRequest(c)
+	if err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	if err := revokeDocumentRequestToken(c, request, userID, fmt.Sprintf("Document request %d resent", request.ID)); err != nil {
+		return err
+	}
+	if req.DueAt != nil {
+		if _, err := db.DB.Exec("UPDATE document_request SET due_at = $2, updated_at = NOW() WHERE id = $1", request.ID, *req.DueAt); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update document request")
+		}
+		request.DueAt = *req.DueAt
+	}
+	if err := sendDocumentRequest(c, &request, userID); err != nil {
+		return err
+	}
+
+	message := "Document request resent successfully"
+	if request.EmailError != "" {
+		message = "New link created, but the email could not be sent; share the link with the recipient"
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    request,
+	})
+}
+
+// CancelDocumentRequest cancels a document request
+// @Summary Cancel document request
+// @Description Cancel a pending or overdue document request; its upload link stops working
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param requestId path int true "Document request ID"
+// @Success 200 {object} SuccessResponse{data=DocumentRequest}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/document-requests/{requestId}/cancel [post]
+func CancelDocumentRequest(c *fiber.Ctx) error {
+	request, err := loadOpenDocumentRequest(c)
+	if err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	if err := revokeDocumentRequestToken(c, request, userID, fmt.Sprintf("Document request %d cancelled", request.ID)); err != nil {
+		return err
+	}
+	request, err = scanDocumentRequest(db.DB.QueryRow(`
+		UPDATE document_request SET status = $2, cancelled_at = NOW(), cancelled_by = NULLIF($3, 0), updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+documentRequestColumns,
+		request.ID, DocumentRequestCancelled, userID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to cancel document request")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Document request cancelled successfully",
+		Data:    request,
+	})
+}
+
+// loadSupplierDocumentRequest loads the open request the supplier's token was issued for
+func loadSupplierDocumentRequest(token BatchAccessToken) (DocumentRequest, error) {
+	request, err := scanDocumentRequest(db.DB.QueryRow(`
+		SELECT `+documentRequestColumns+` FROM document_request WHERE token_id = $1 AND status = $2
+	`, token.ID, DocumentRequestPending))
+	if err == sql.ErrNoRows {
+		return request, fiber.NewError(fiber.StatusNotFound, "No open document request for this link")
+	}
+	if err != nil {
+		return request, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	return request, nil
+}
+
+// GetSupplierDocumentRequest shows a counterparty the document requested from it
+// @Summary Get requested document
+// @Description Show the document request an emailed link was sent for: the batch, the document type, the message and the due date
+// @Tags supplier
+// @Produce json
+// @Param token query string false "Token from the emailed link, when not sent as a bearer token"
+// @Success 200 {object} SuccessResponse{data=SupplierDocumentRequest}
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /supplier/document-request [get]
+func GetSupplierDocumentRequest(c *fiber.Ctx) error {
+	token, _ := c.Locals("batchAccessToken").(BatchAccessToken)
+	request, err := loadSupplierDocumentRequest(token)
+	if err != nil {
+		return denyBatchAccess(c, token, batchAccessViewBatch, fiber.StatusNotFound, "No open document request for this link")
+	}
+
+	view := SupplierDocumentRequest{
+		ID:            request.ID,
+		BatchID:       request.BatchID,
+		DocType:       request.DocType,
+		Message:       request.Message,
+		RecipientName: request.RecipientName,
+		DueAt:         request.DueAt,
+		Status:        request.Status,
+		ExpiresAt:     token.ExpiresAt,
+	}
+	err = db.DB.QueryRow(`
+		SELECT COALESCE(b.species, ''), COALESCE(co.name, '')
+		FROM batch b LEFT JOIN company co ON co.id = $2
+		WHERE b.id = $1
+	`, request.BatchID, request.CompanyID).Scan(&view.Species, &view.CompanyName)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if err := auditBatchAccess(c, token, batchAccessViewBatch, BatchAccessAllowed, fmt.Sprintf("Document request %d", request.ID), 0, nil, nil); err != nil {
+		return err
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Document request retrieved successfully",
+		Data:    view,
+	})
+}
+
+// FulfillSupplierDocumentRequest lets a counterparty upload the document requested from it
+// @Summary Upload requested document
+// @Description Upload the document an emailed link was sent for. The file is stored on IPFS, recorded on the blockchain and attached to the batch
+// @Description with the requested type; the request is fulfilled, the link stops working and the batch owner is notified through the document_request_fulfilled webhook
+// @Tags supplier
+// @Accept multipart/form-data
+// @Produce json
+// @Param token query string false "Token from the emailed link, when not sent as a bearer token"
+// @Param file formData file true "Requested document"
+// @Success 201 {object} SuccessResponse{data=SupplierDocument}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 423 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /supplier/document-request [post]
+func FulfillSupplierDocumentRequest(c *fiber.Ctx) error {
+	token, _ := c.Locals("batchAccessToken").(BatchAccessToken)
+	request, err := loadSupplierDocumentRequest(token)
+	if err != nil {
+		return denyBatchAccess(c, token, BatchAccessUploadRequestedDocument, fiber.StatusNotFound, "No open document request for this link")
+	}
+
+	doc, err := storeSupplierDocument(c, token, BatchAccessUploadRequestedDocument, request.DocType)
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec(`
+		UPDATE document_request SET status = $2, document_id = $3, fulfilled_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = $4
+	`, request.ID, DocumentRequestFulfilled, doc.ID, DocumentRequestPending)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Document uploaded but failed to fulfill the request")
+	}
+
+	data := doc.webhookData()
+	data["document_request_id"] = request.ID
+	data["due_at"] = request.DueAt
+	data["overdue"] = request.Status == DocumentRequestOverdue
+	notifyBatchOwner(token, "document_request_fulfilled", data)
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Document uploaded successfully, thank you",
+		Data:    doc,
+	})
+}
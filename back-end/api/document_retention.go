@@ -0,0 +1,268 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+	"github.com/LTPPPP/TracePost-larvaeChain/retention"
+)
+
+// RetentionPolicyRequest sets how long documents of a type are kept before they are destroyed
+type RetentionPolicyRequest struct {
+	Name       string `json:"name"` // e.g. the regulation requiring it
+	DocType    string `json:"doc_type"`
+	RetainDays int    `json:"retain_days"`
+	Active     *bool  `json:"active"` // Default true
+}
+
+// retentionError maps a retention error to an HTTP error
+func retentionError(err error, notFound, message string) error {
+	switch {
+	case errors.Is(err, retention.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, notFound)
+	case errors.Is(err, retention.ErrInvalidPolicy):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, retention.ErrHeld):
+		return fiber.NewError(fiber.StatusLocked, "The document is under legal hold and cannot be destroyed")
+	case errors.Is(err, retention.ErrNotDue):
+		return fiber.NewError(fiber.StatusConflict, "The document is still within its retention period")
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, message)
+}
+
+// DocumentUnderLegalHold reports whether a document is frozen by a hold on it, its batch or its company;
+// the retention service checks it before destroying a document
+func DocumentUnderLegalHold(documentID int) (bool, error) {
+	holds, err := activeLegalHolds(LegalHoldDocument, documentID)
+	return len(holds) > 0, err
+}
+
+// ListRetentionPolicies lists the document retention policies
+// @Summary List retention policies
+// @Description List how long documents of each type are kept before they are destroyed
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]retention.Policy}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/retention-policies [get]
+func ListRetentionPolicies(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	policies, err := retention.ListPolicies()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve retention policies")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Retention policies retrieved successfully",
+		Data:    policies,
+	})
+}
+
+// SaveRetentionPolicy creates or replaces the retention policy of a document type
+// @Summary Save retention policy
+// @Description Destroy documents of a type once they are older than the retention period. Each destruction is logged in a record signed by the platform and anchored on-chain; documents under legal hold are kept until the hold is released
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body RetentionPolicyRequest true "Retention policy"
+// @Success 200 {object} SuccessResponse{data=retention.Policy}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/retention-policies [put]
+func SaveRetentionPolicy(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	var req RetentionPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	active := req.Active == nil || *req.Active
+
+	userID, _ := c.Locals("userID").(int)
+	policy, err := retention.SavePolicy(retention.Policy{Name: req.Name, DocType: req.DocType, RetainDays: req.RetainDays, Active: active}, userID)
+	if err != nil {
+		return retentionError(err, "Retention policy not found", "Failed to save retention policy")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Retention policy saved successfully",
+		Data:    policy,
+	})
+}
+
+// DeactivateRetentionPolicy stops a retention policy
+// @Summary Deactivate retention policy
+// @Description Stop destroying documents under a policy. The policy is kept for the destruction records naming it
+// @Tags admin
+// @Produce json
+// @Param policyId path int true "Retention policy ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/retention-policies/{policyId} [delete]
+func DeactivateRetentionPolicy(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	policyID, err := strconv.Atoi(c.Params("policyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid policy ID format")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	if err := retention.DeactivatePolicy(policyID, userID); err != nil {
+		return retentionError(err, "Retention policy not found", "Failed to deactivate retention policy")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Retention policy deactivated successfully",
+	})
+}
+
+// RunDocumentRetention destroys the documents past their retention period now
+// @Summary Run document retention
+// @Description Destroy the documents past the retention period of their policy without waiting for the schedule, and retry the on-chain anchors of earlier destruction records. With dry_run the due documents are listed and nothing is destroyed
+// @Tags admin
+// @Produce json
+// @Param dry_run query bool false "Only list the due documents"
+// @Success 200 {object} SuccessResponse{data=retention.RunResult}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/document-retention/run [post]
+func RunDocumentRetention(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	service := retention.Default()
+	if isDryRun(c) {
+		due, err := service.DueDocuments(service.BatchSize * 10)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list due documents")
+		}
+		result := DryRunResult{
+			Action: "destroy documents past their retention period",
+			Record: due,
+			Effects: []string{
+				"Unpin the files of the due documents not under legal hold",
+				"Mark the documents purged and drop their IPFS references",
+				"Insert a signed destruction record per document and anchor its hash on-chain",
+			},
+		}
+		for _, d := range due {
+			if d.Held {
+				result.Warnings = append(result.Warnings, "Document "+strconv.Itoa(d.DocumentID)+" is under legal hold and will be kept")
+			}
+		}
+		return dryRunResponse(c, "Document retention validated successfully", result)
+	}
+
+	result, err := service.RunOnce()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to run document retention")
+	}
+	return sendDestructions(c, "Document retention run completed", result)
+}
+
+// ListDocumentDestructions lists the document destruction log
+// @Summary List document destructions
+// @Description List the signed records of documents destroyed under a retention policy, latest first, with the transactions anchoring them on-chain
+// @Tags admin
+// @Produce json
+// @Param from query string false "Start time (RFC3339)"
+// @Param to query string false "End time (RFC3339)"
+// @Param policy_id query int false "Only destructions under this policy"
+// @Param document_id query int false "Only the destruction of this document"
+// @Param company_id query int false "Only documents of this company"
+// @Param doc_type query string false "Only documents of this type"
+// @Param limit query int false "Maximum number of records (default 100, at most 1000)"
+// @Success 200 {object} SuccessResponse{data=[]retention.Destruction}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/document-destructions [get]
+func ListDocumentDestructions(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return err
+	}
+
+	destructions, err := retention.List(retention.Filter{
+		From:       from,
+		To:         to,
+		PolicyID:   c.QueryInt("policy_id", 0),
+		DocumentID: c.QueryInt("document_id", 0),
+		CompanyID:  c.QueryInt("company_id", 0),
+		DocType:    c.Query("doc_type"),
+		Limit:      c.QueryInt("limit", 100),
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve document destructions")
+	}
+	return sendDestructions(c, "Document destructions retrieved successfully", destructions)
+}
+
+// GetDocumentDestruction returns the certificate of a document destruction
+// @Summary Get document destruction certificate
+// @Description Get the record of a destroyed document: what was destroyed, when and under which policy. The record is kept as the exact bytes signed;
+// @Description verify the detached JWS signature against /.well-known/jwks.json and the SHA-256 record hash against the anchoring transaction
+// @Tags admin
+// @Produce json
+// @Param destructionId path int true "Destruction ID"
+// @Success 200 {object} SuccessResponse{data=retention.Destruction}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/document-destructions/{destructionId} [get]
+func GetDocumentDestruction(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	destructionID, err := strconv.Atoi(c.Params("destructionId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid destruction ID format")
+	}
+
+	destruction, err := retention.Get(destructionID)
+	if err != nil {
+		return retentionError(err, "Document destruction not found", "Failed to retrieve document destruction")
+	}
+	return sendDestructions(c, "Document destruction retrieved successfully", destruction)
+}
+
+// sendDestructions sends destruction records as they were signed: they are kept out of response formatting,
+// which would move their timestamps to another time zone and break record_hash and the signature
+func sendDestructions(c *fiber.Ctx, message string, data interface{}) error {
+	middleware.SkipFormatting(c)
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
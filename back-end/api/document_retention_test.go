@@ -0,0 +1,68 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+	"github.com/LTPPPP/TracePost-larvaeChain/retention"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDocumentDestructionSurvivesResponseFormatting(t *testing.T) {
+	destroyedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	raw, err := json.Marshal(retention.Record{
+		DocumentID:     3,
+		DocType:        "invoice",
+		FileName:       "invoice.pdf",
+		FileSize:       2048,
+		StorageBackend: "ipfs",
+		UploadedAt:     destroyedAt.AddDate(-7, 0, 0),
+		PolicyID:       1,
+		PolicyName:     "Tax records",
+		RetainDays:     2555,
+		DestroyedAt:    destroyedAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(raw)
+	destruction := &retention.Destruction{
+		ID: 1, DocumentID: 3, PolicyID: 1, DocType: "invoice",
+		Record: raw, RecordHash: hex.EncodeToString(sum[:]),
+		Status: retention.StatusSigned, DestroyedAt: destroyedAt,
+	}
+
+	app := fiber.New()
+	app.Use(middleware.ResponseFormatting(nil))
+	app.Get("/admin/document-destructions/1", func(c *fiber.Ctx) error {
+		return sendDestructions(c, "Document destruction retrieved successfully", destruction)
+	})
+
+	req := httptest.NewRequest(fiber.MethodGet, "/admin/document-destructions/1", nil)
+	req.Header.Set("X-Timezone", "America/New_York")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	var out struct {
+		Data struct {
+			Record     json.RawMessage `json:"record"`
+			RecordHash string          `json:"record_hash"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	got := sha256.Sum256(out.Data.Record)
+	if hex.EncodeToString(got[:]) != out.Data.RecordHash {
+		t.Fatalf("record no longer matches record_hash after formatting: %s", out.Data.Record)
+	}
+}
@@ -0,0 +1,645 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/eventbus"
+	"github.com/LTPPPP/TracePost-larvaeChain/translation"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+)
+
+// Translation request statuses
+const (
+	TranslationRequested = "requested" // waiting for a translator or the translation service
+	TranslationAssigned  = "assigned"  // a translator account works on it
+	TranslationSubmitted = "submitted" // sent to the translation service
+	TranslationCompleted = "completed"
+	TranslationCancelled = "cancelled"
+	TranslationFailed    = "failed" // the translation service rejected the job
+)
+
+// Who a translation is assigned to
+const (
+	TranslationAssigneeTranslator = "translator"
+	TranslationAssigneeAPI        = "api"
+)
+
+// languageTagPattern matches BCP 47 language tags such as vi, en, zh-Hans or pt-BR
+var languageTagPattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// DocumentTranslation is a request to translate a document into one language.
+// The translated version is a document of its own, linked to the original through translation_of
+type DocumentTranslation struct {
+	ID                   int        `json:"id"`
+	DocumentID           int        `json:"document_id"`
+	SourceLanguage       string     `json:"source_language,omitempty"`
+	TargetLanguage       string     `json:"target_language"`
+	Status               string     `json:"status"`
+	Certified            bool       `json:"certified"` // A certified (sworn) translation is required
+	AssigneeType         string     `json:"assignee_type,omitempty"`
+	TranslatorID         *int       `json:"translator_id,omitempty"`
+	ExternalJobID        string     `json:"external_job_id,omitempty"`
+	TranslatedDocumentID *int       `json:"translated_document_id,omitempty"`
+	DueDate              *time.Time `json:"due_date,omitempty"`
+	Notes                string     `json:"notes,omitempty"`
+	Error                string     `json:"error,omitempty"`
+	RequestedBy          *int       `json:"requested_by,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	AssignedAt           *time.Time `json:"assigned_at,omitempty"`
+	CompletedAt          *time.Time `json:"completed_at,omitempty"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// TranslationAssignment names who translates: a translator account, or the translation service
+type TranslationAssignment struct {
+	TranslatorID int  `json:"translator_id"`
+	UseAPI       bool `json:"use_api"`
+}
+
+// DocumentTranslationRequest represents a request to translate a document into target languages
+type DocumentTranslationRequest struct {
+	TargetLanguages []string   `json:"target_languages"`
+	SourceLanguage  string     `json:"source_language"`
+	Certified       bool       `json:"certified"`
+	DueDate         *time.Time `json:"due_date"`
+	Notes           string     `json:"notes"`
+	TranslationAssignment
+}
+
+const documentTranslationColumns = `
+	id, document_id, COALESCE(source_language, ''), target_language, status, certified, COALESCE(assignee_type, ''),
+	translator_id, COALESCE(external_job_id, ''), translated_document_id, due_date, COALESCE(notes, ''), COALESCE(error, ''),
+	requested_by, created_at, assigned_at, completed_at, updated_at
+`
+
+// scanDocumentTranslation reads a translation request selected with documentTranslationColumns
+func scanDocumentTranslation(row rowScanner) (DocumentTranslation, error) {
+	var t DocumentTranslation
+	var translatorID, translatedDocumentID, requestedBy sql.NullInt64
+	var dueDate, assignedAt, completedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.DocumentID, &t.SourceLanguage, &t.TargetLanguage, &t.Status, &t.Certified, &t.AssigneeType,
+		&translatorID, &t.ExternalJobID, &translatedDocumentID, &dueDate, &t.Notes, &t.Error,
+		&requestedBy, &t.CreatedAt, &assignedAt, &completedAt, &t.UpdatedAt)
+	t.TranslatorID = intPtr(translatorID)
+	t.TranslatedDocumentID = intPtr(translatedDocumentID)
+	t.RequestedBy = intPtr(requestedBy)
+	t.DueDate = timePtr(dueDate)
+	t.AssignedAt = timePtr(assignedAt)
+	t.CompletedAt = timePtr(completedAt)
+	return t, err
+}
+
+// queryDocumentTranslations runs a translation request query and collects the results
+func queryDocumentTranslations(query string, args ...interface{}) ([]DocumentTranslation, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []DocumentTranslation{}
+	for rows.Next() {
+		t, err := scanDocumentTranslation(rows)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, t)
+	}
+	return translations, rows.Err()
+}
+
+// loadDocumentTranslation loads a translation request from its route parameter
+func loadDocumentTranslation(c *fiber.Ctx) (DocumentTranslation, error) {
+	translationID, err := strconv.Atoi(c.Params("translationId"))
+	if err != nil {
+		return DocumentTranslation{}, fiber.NewError(fiber.StatusBadRequest, "Invalid translation ID format")
+	}
+	t, err := scanDocumentTranslation(db.DB.QueryRow(`SELECT `+documentTranslationColumns+` FROM document_translation WHERE id = $1`, translationID))
+	if err == sql.ErrNoRows {
+		return t, fiber.NewError(fiber.StatusNotFound, "Translation request not found")
+	}
+	if err != nil {
+		return t, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	return t, nil
+}
+
+// normalizeLanguageTag lower-cases the language subtag of a BCP 47 tag, reporting false for an invalid tag
+func normalizeLanguageTag(tag string) (string, bool) {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if tag == "" {
+		return "", false
+	}
+	parts := strings.SplitN(tag, "-", 2)
+	parts[0] = strings.ToLower(parts[0])
+	tag = strings.Join(parts, "-")
+	return tag, languageTagPattern.MatchString(tag)
+}
+
+// translationCompany returns the company owning the batch of a document, 0 when it has none
+func translationCompany(documentID int) int {
+	var companyID int
+	db.DB.QueryRow(`
+		SELECT COALESCE(`+batchOwnerCompany+`, 0)
+		FROM document d JOIN batch b ON b.id = d.batch_id JOIN hatchery h ON h.id = b.hatchery_id
+		WHERE d.id = $1
+	`, documentID).Scan(&companyID)
+	return companyID
+}
+
+// assignTranslation hands a translation request to a translator account or submits it to the translation service
+func assignTranslation(t DocumentTranslation, assignment TranslationAssignment) (DocumentTranslation, error) {
+	if assignment.UseAPI {
+		return submitTranslationJob(t)
+	}
+
+	var exists bool
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM account WHERE id = $1 AND is_active = true)", assignment.TranslatorID).Scan(&exists)
+	if err != nil {
+		return t, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return t, fiber.NewError(fiber.StatusNotFound, "Translator account not found")
+	}
+	t, err = scanDocumentTranslation(db.DB.QueryRow(`
+		UPDATE document_translation
+		SET status = $1, assignee_type = $2, translator_id = $3, external_job_id = NULL, callback_token_hash = NULL,
+			error = NULL, assigned_at = NOW(), updated_at = NOW()
+		WHERE id = $4
+		RETURNING `+documentTranslationColumns,
+		TranslationAssigned, TranslationAssigneeTranslator, assignment.TranslatorID, t.ID))
+	if err != nil {
+		return t, fiber.NewError(fiber.StatusInternalServerError, "Failed to assign translation")
+	}
+	return t, nil
+}
+
+// submitTranslationJob sends a translation request to the translation service with a callback to deliver the result.
+// The callback token is only kept hashed, like LIMS tokens
+func submitTranslationJob(t DocumentTranslation) (DocumentTranslation, error) {
+	cfg := config.GetConfig()
+	client := translation.NewClient(cfg)
+	if !client.Enabled() {
+		return t, fiber.NewError(fiber.StatusBadRequest, "No translation service is configured")
+	}
+	if err := refuseRegionLockedTransfer(t.DocumentID, "translation service"); err != nil {
+		return t, err
+	}
+
+	var job translation.Job
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(ipfs_uri, ''), COALESCE(file_name, ''), COALESCE(doc_type, '') FROM document WHERE id = $1
+	`, t.DocumentID).Scan(&job.DocumentURI, &job.FileName, &job.DocType)
+	if err != nil {
+		return t, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return t, fiber.NewError(fiber.StatusInternalServerError, "Failed to generate callback token")
+	}
+	token := hex.EncodeToString(raw)
+	job.Reference = strconv.Itoa(t.ID)
+	job.SourceLanguage = t.SourceLanguage
+	job.TargetLanguage = t.TargetLanguage
+	job.Certified = t.Certified
+	job.DueDate = t.DueDate
+	job.Notes = t.Notes
+	job.CallbackURL = fmt.Sprintf("%s/api/v1/translations/%d/deliver?token=%s", strings.TrimSuffix(cfg.BaseURL, "/"), t.ID, token)
+
+	externalID, submitErr := client.Submit(job)
+	status, errorText := TranslationSubmitted, ""
+	if submitErr != nil {
+		status, errorText = TranslationFailed, submitErr.Error()
+	}
+	t, err = scanDocumentTranslation(db.DB.QueryRow(`
+		UPDATE document_translation
+		SET status = $1, assignee_type = $2, translator_id = NULL, external_job_id = NULLIF($3, ''), callback_token_hash = $4,
+			error = NULLIF($5, ''), assigned_at = NOW(), updated_at = NOW()
+		WHERE id = $6
+		RETURNING `+documentTranslationColumns,
+		status, TranslationAssigneeAPI, externalID, hashLIMSToken(token), errorText, t.ID))
+	if err != nil {
+		return t, fiber.NewError(fiber.StatusInternalServerError, "Failed to save translation job")
+	}
+	if submitErr != nil {
+		return t, dependencyUnavailable("Translation service rejected the job", submitErr)
+	}
+	return t, nil
+}
+
+// RequestDocumentTranslation marks a document for translation into target languages
+// @Summary Request document translation
+// @Description Create one translation request per target language, optionally assigning it straight away to a translator account or to the translation service. A language can only have one open request per document.
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param documentId path int true "Document ID"
+// @Param request body DocumentTranslationRequest true "Target languages and assignment"
+// @Success 201 {object} SuccessResponse{data=[]DocumentTranslation}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /documents/{documentId}/translations [post]
+func RequestDocumentTranslation(c *fiber.Ctx) error {
+	documentID, err := strconv.Atoi(c.Params("documentId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid document ID format")
+	}
+	if err := authorizeDocument(c, documentID); err != nil {
+		return err
+	}
+
+	var req DocumentTranslationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if len(req.TargetLanguages) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one target language is required")
+	}
+	var ok bool
+	if req.SourceLanguage != "" {
+		if req.SourceLanguage, ok = normalizeLanguageTag(req.SourceLanguage); !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "Source language must be a language tag such as vi or en")
+		}
+	}
+	languages := []string{}
+	seen := map[string]bool{}
+	for _, language := range req.TargetLanguages {
+		if language, ok = normalizeLanguageTag(language); !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "Target languages must be language tags such as en, zh-Hans or pt-BR")
+		}
+		if language == req.SourceLanguage {
+			return fiber.NewError(fiber.StatusBadRequest, "A target language cannot be the source language")
+		}
+		if !seen[language] {
+			seen[language] = true
+			languages = append(languages, language)
+		}
+	}
+	if req.UseAPI && req.TranslatorID != 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Assign either a translator or the translation service, not both")
+	}
+
+	var translationOf sql.NullInt64
+	err = db.DB.QueryRow("SELECT translation_of FROM document WHERE id = $1 AND is_active = true", documentID).Scan(&translationOf)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Document not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if translationOf.Valid {
+		return fiber.NewError(fiber.StatusBadRequest, "Request translations of the original document, not of a translation")
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	userID, _ := c.Locals("userID").(int)
+	translations := []DocumentTranslation{}
+	for _, language := range languages {
+		t, err := scanDocumentTranslation(tx.QueryRow(`
+			INSERT INTO document_translation (document_id, source_language, target_language, status, certified, due_date, notes, requested_by, created_at, updated_at)
+			VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, 0), NOW(), NOW())
+			ON CONFLICT DO NOTHING
+			RETURNING `+documentTranslationColumns,
+			documentID, req.SourceLanguage, language, TranslationRequested, req.Certified, req.DueDate, req.Notes, userID))
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusConflict, "A translation into "+language+" is already open for this document")
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to save translation request")
+		}
+		translations = append(translations, t)
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+
+	if req.UseAPI || req.TranslatorID != 0 {
+		for i, t := range translations {
+			if translations[i], err = assignTranslation(t, req.TranslationAssignment); err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Translation requested successfully",
+		Data:    translations,
+	})
+}
+
+// ListDocumentTranslations lists the translation requests of a document
+// @Summary List document translations
+// @Description List the translation requests of a document with their status and, once completed, the translated document
+// @Tags documents
+// @Produce json
+// @Param documentId path int true "Document ID"
+// @Success 200 {object} SuccessResponse{data=[]DocumentTranslation}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /documents/{documentId}/translations [get]
+func ListDocumentTranslations(c *fiber.Ctx) error {
+	documentID, err := strconv.Atoi(c.Params("documentId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid document ID format")
+	}
+	if err := authorizeDocument(c, documentID); err != nil {
+		return err
+	}
+
+	translations, err := queryDocumentTranslations(`SELECT `+documentTranslationColumns+`
+		FROM document_translation WHERE document_id = $1 ORDER BY target_language, created_at DESC
+	`, documentID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve translations")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Translations retrieved successfully",
+		Data:    translations,
+	})
+}
+
+// ListTranslations lists translation requests, e.g. the work queue of a translator
+// @Summary List translation requests
+// @Description List translation requests, oldest due first. Callers other than admins only see the requests assigned to them.
+// @Tags documents
+// @Produce json
+// @Param status query string false "Filter by status (requested, assigned, submitted, completed, cancelled, failed)"
+// @Param translator_id query int false "Filter by translator account"
+// @Param language query string false "Filter by target language"
+// @Success 200 {object} SuccessResponse{data=[]DocumentTranslation}
+// @Failure 500 {object} ErrorResponse
+// @Router /translations [get]
+func ListTranslations(c *fiber.Ctx) error {
+	translatorID := c.QueryInt("translator_id", 0)
+	if role, _ := c.Locals("role").(string); role != "admin" {
+		translatorID, _ = c.Locals("userID").(int)
+	}
+	language, _ := normalizeLanguageTag(c.Query("language"))
+
+	translations, err := queryDocumentTranslations(`SELECT `+documentTranslationColumns+`
+		FROM document_translation
+		WHERE ($1::text = '' OR status = $1) AND ($2::int = 0 OR translator_id = $2) AND ($3::text = '' OR target_language = $3)
+		ORDER BY due_date NULLS LAST, created_at, id
+	`, c.Query("status"), translatorID, language)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve translations")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Translations retrieved successfully",
+		Data:    translations,
+	})
+}
+
+// AssignTranslationRequest assigns a translation request
+// @Summary Assign translation
+// @Description Assign an open translation request to a translator account, or submit it to the translation service. A failed request can be assigned again.
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param translationId path int true "Translation request ID"
+// @Param request body TranslationAssignment true "Assignment"
+// @Success 200 {object} SuccessResponse{data=DocumentTranslation}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /translations/{translationId}/assign [post]
+func AssignTranslationRequest(c *fiber.Ctx) error {
+	t, err := loadDocumentTranslation(c)
+	if err != nil {
+		return err
+	}
+	var req TranslationAssignment
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.UseAPI == (req.TranslatorID != 0) {
+		return fiber.NewError(fiber.StatusBadRequest, "Assign either a translator or the translation service")
+	}
+	switch t.Status {
+	case TranslationCompleted, TranslationCancelled:
+		return fiber.NewError(fiber.StatusConflict, "The translation is already "+t.Status)
+	}
+
+	if t, err = assignTranslation(t, req); err != nil {
+		return err
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Translation assigned successfully",
+		Data:    t,
+	})
+}
+
+// DeliverTranslation uploads the translated version of a document
+// @Summary Deliver translation
+// @Description Upload the translated file. It is stored as a new document of the same batch and type, in the target language and linked to the original, so it is listed with the batch documents. The assigned translator, an admin, or the translation service with the token of its callback URL can deliver.
+// @Tags documents
+// @Accept multipart/form-data
+// @Produce json
+// @Param translationId path int true "Translation request ID"
+// @Param token query string false "Callback token of the translation service"
+// @Param file formData file true "Translated file"
+// @Success 200 {object} SuccessResponse{data=DocumentTranslation}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /translations/{translationId}/deliver [post]
+func DeliverTranslation(c *fiber.Ctx) error {
+	t, err := loadDocumentTranslation(c)
+	if err != nil {
+		return err
+	}
+
+	role, _ := c.Locals("role").(string)
+	userID, _ := c.Locals("userID").(int)
+	switch {
+	case t.Status == TranslationSubmitted && c.Query("token") != "":
+		var tokenHash string
+		db.DB.QueryRow("SELECT COALESCE(callback_token_hash, '') FROM document_translation WHERE id = $1", t.ID).Scan(&tokenHash)
+		if subtle.ConstantTimeCompare([]byte(tokenHash), []byte(hashLIMSToken(c.Query("token")))) != 1 {
+			return fiber.NewError(fiber.StatusForbidden, "Invalid callback token")
+		}
+		userID = 0
+	case t.Status == TranslationAssigned || t.Status == TranslationSubmitted:
+		if role != "admin" && (t.TranslatorID == nil || *t.TranslatorID != userID) {
+			return fiber.NewError(fiber.StatusForbidden, "Only the assigned translator can deliver this translation")
+		}
+	default:
+		return fiber.NewError(fiber.StatusConflict, "The translation is "+t.Status+", not awaiting delivery")
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "File is required")
+	}
+	if file.Size > 10*1024*1024 {
+		return fiber.NewError(fiber.StatusBadRequest, "File size exceeds 10MB limit")
+	}
+	fileHandle, err := file.Open()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to open file")
+	}
+	defer fileHandle.Close()
+
+	var batchID, broodstockID sql.NullInt64
+	var docType, sensitivity string
+	err = db.DB.QueryRow(`
+		SELECT batch_id, broodstock_id, COALESCE(doc_type, ''), sensitivity FROM document WHERE id = $1
+	`, t.DocumentID).Scan(&batchID, &broodstockID, &docType, &sensitivity)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	// The translation is stored where the original is, under the residency policy of the same company
+	companyID := companyOfDocumentBatch(int(batchID.Int64))
+	if !batchID.Valid && broodstockID.Valid {
+		companyID = companyOfBroodstock(int(broodstockID.Int64))
+	}
+	result, placement, err := uploadDocumentFile(companyID, fileHandle, file.Filename, map[string]string{
+		"translation_of":  strconv.Itoa(t.DocumentID),
+		"target_language": t.TargetLanguage,
+		"document_type":   docType,
+		"app":             "TracePost-larvaeChain",
+		"timestamp":       time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		if isRequestError(err) {
+			return err
+		}
+		return dependencyUnavailable("Failed to store translated file", err)
+	}
+	uri := result.IPFSUri
+	if result.PinataSuccess && result.PinataUri != "" {
+		uri = result.PinataUri
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	var documentID int
+	err = tx.QueryRow(`
+		INSERT INTO document (batch_id, broodstock_id, doc_type, ipfs_hash, ipfs_uri, file_name, file_size, uploaded_by, language, translation_of, sensitivity,
+			storage_region, storage_backend, region_locked, uploaded_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9, $10, $11, $12, $13, $14, NOW(), NOW(), true)
+		RETURNING id
+	`, batchID, broodstockID, docType, result.CID, uri, result.Name, result.Size, userID, t.TargetLanguage, t.DocumentID, sensitivity,
+		placement.Region, placement.Backend, placement.Locked).Scan(&documentID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save translated document")
+	}
+	t, err = scanDocumentTranslation(tx.QueryRow(`
+		UPDATE document_translation
+		SET status = $1, translated_document_id = $2, callback_token_hash = NULL, completed_at = NOW(), updated_at = NOW()
+		WHERE id = $3 AND status IN ('assigned', 'submitted')
+		RETURNING `+documentTranslationColumns,
+		TranslationCompleted, documentID, t.ID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusConflict, "The translation is no longer awaiting delivery")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to complete translation")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+
+	data := map[string]interface{}{
+		"translation_id":         t.ID,
+		"document_id":            t.DocumentID,
+		"translated_document_id": documentID,
+		"target_language":        t.TargetLanguage,
+		"certified":              t.Certified,
+	}
+	if batchID.Valid {
+		publishDomainEvent(eventbus.DocumentUploaded, 0, int(batchID.Int64), map[string]interface{}{
+			"document_id":    documentID,
+			"doc_type":       docType,
+			"file_name":      result.Name,
+			"ipfs_hash":      result.CID,
+			"ipfs_uri":       uri,
+			"language":       t.TargetLanguage,
+			"translation_of": t.DocumentID,
+		})
+	}
+	if companyID := translationCompany(t.DocumentID); companyID != 0 {
+		if err := webhooks.Dispatch(companyID, "document_translated", data); err != nil {
+			fmt.Printf("Warning: failed to dispatch document_translated webhook: %v\n", err)
+		}
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Translation delivered successfully",
+		Data:    t,
+	})
+}
+
+// CancelTranslation cancels an open translation request
+// @Summary Cancel translation
+// @Description Cancel a translation request that has not been delivered
+// @Tags documents
+// @Produce json
+// @Param translationId path int true "Translation request ID"
+// @Success 200 {object} SuccessResponse{data=DocumentTranslation}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /translations/{translationId}/cancel [post]
+func CancelTranslation(c *fiber.Ctx) error {
+	t, err := loadDocumentTranslation(c)
+	if err != nil {
+		return err
+	}
+
+	t, err = scanDocumentTranslation(db.DB.QueryRow(`
+		UPDATE document_translation SET status = $1, callback_token_hash = NULL, updated_at = NOW()
+		WHERE id = $2 AND status NOT IN ('completed', 'cancelled')
+		RETURNING `+documentTranslationColumns,
+		TranslationCancelled, t.ID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusConflict, "The translation is already completed or cancelled")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to cancel translation")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Translation cancelled successfully",
+		Data:    t,
+	})
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// DryRunResult describes what a mutating request would have done had it not been a dry run
+type DryRunResult struct {
+	DryRun   bool        `json:"dry_run"`
+	Action   string      `json:"action"`
+	Record   interface{} `json:"record"`             // The record as it would be created or changed, without generated IDs
+	Effects  []string    `json:"effects"`            // Writes the request would make to the database, IPFS and the chain
+	Warnings []string    `json:"warnings,omitempty"` // Conditions that would not reject the request but may surprise the caller
+}
+
+// isDryRun reports whether a request only validates, set with ?dry_run=true
+func isDryRun(c *fiber.Ctx) bool {
+	return c.QueryBool("dry_run")
+}
+
+// dryRunResponse answers a dry run once every validation of the request has passed
+func dryRunResponse(c *fiber.Ctx, message string, result DryRunResult) error {
+	result.DryRun = true
+	c.Set("X-Dry-Run", "true")
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    result,
+	})
+}
+
+// batchDryRunWarnings lists conditions of a batch a dry run should point out
+func batchDryRunWarnings(batchID int) []string {
+	var warnings []string
+	var recalled bool
+	if err := db.DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM batch_recall WHERE batch_id = $1 AND lifted_at IS NULL)", batchID,
+	).Scan(&recalled); err == nil && recalled {
+		warnings = append(warnings, "The batch is under an active recall")
+	}
+	return warnings
+}
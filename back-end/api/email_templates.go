@@ -0,0 +1,270 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/mailer"
+)
+
+// EmailTemplateSummary is a template emails are rendered from with the version in use
+type EmailTemplateSummary struct {
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	ActiveVersion int    `json:"active_version"` // 0 when the built-in template is used
+	Format        string `json:"format"`
+}
+
+// SaveEmailTemplateRequest is a new version of an email template
+type SaveEmailTemplateRequest struct {
+	Format   string `json:"format"` // html (default) or mjml
+	Subject  string `json:"subject"`
+	HTML     string `json:"html"`
+	Source   string `json:"source"` // MJML source, for the mjml format
+	Text     string `json:"text"`
+	Notes    string `json:"notes"`
+	Activate bool   `json:"activate"`
+}
+
+// PreviewEmailTemplateRequest selects the version, language and data a template is previewed with
+type PreviewEmailTemplateRequest struct {
+	Version  *int                   `json:"version"` // A saved version, 0 being the built-in one; the active one when omitted
+	Language string                 `json:"language"`
+	Data     map[string]interface{} `json:"data"` // Sample data of the template when omitted
+	// An unsaved draft to preview instead of a saved version
+	Format  string `json:"format"`
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Source  string `json:"source"`
+	Text    string `json:"text"`
+}
+
+// emailTemplateError maps errors of the mailer to responses
+func emailTemplateError(err error, action string) error {
+	if errors.Is(err, mailer.ErrTemplateNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Email template not found")
+	}
+	return fiber.NewError(fiber.StatusBadRequest, action+": "+err.Error())
+}
+
+// ListEmailTemplates lists the email templates with the version in use
+// @Summary List email templates
+// @Description List the email templates, layout and partials with the version emails are rendered from
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]EmailTemplateSummary}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/email-templates [get]
+func ListEmailTemplates(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	templates := []EmailTemplateSummary{}
+	for _, name := range mailer.Names() {
+		active, err := mailer.Active(name)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load email templates")
+		}
+		builtIn, _ := mailer.Version(name, 0)
+		templates = append(templates, EmailTemplateSummary{
+			Name:          name,
+			Description:   builtIn.Description,
+			ActiveVersion: active.Version,
+			Format:        active.Format,
+		})
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Email templates retrieved successfully",
+		Data:    templates,
+	})
+}
+
+// ListEmailTemplateVersions lists the versions of an email template
+// @Summary List email template versions
+// @Description List the saved versions of an email template, newest first, followed by the built-in one
+// @Tags admin
+// @Produce json
+// @Param name path string true "Template name"
+// @Success 200 {object} SuccessResponse{data=[]mailer.Template}
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/email-templates/{name}/versions [get]
+func ListEmailTemplateVersions(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	name := c.Params("name")
+	if !mailer.IsKnown(name) {
+		return fiber.NewError(fiber.StatusNotFound, "Email template not found")
+	}
+
+	versions, err := mailer.Versions(name)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load email template versions")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Email template versions retrieved successfully",
+		Data:    versions,
+	})
+}
+
+// CreateEmailTemplateVersion saves a new version of an email template
+// @Summary Create email template version
+// @Description Save a new version of an email template, written in HTML or MJML. The version is rendered with the template's sample data before it is stored, and can be activated right away.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Template name"
+// @Param request body SaveEmailTemplateRequest true "Template version"
+// @Success 201 {object} SuccessResponse{data=mailer.Template}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/email-templates/{name}/versions [post]
+func CreateEmailTemplateVersion(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	var req SaveEmailTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.HTML == "" && req.Source == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "html or source is required")
+	}
+	userID, _ := c.Locals("userID").(int)
+
+	saved, err := mailer.Default().SaveVersion(mailer.Template{
+		Name:      c.Params("name"),
+		Format:    req.Format,
+		Subject:   req.Subject,
+		HTML:      req.HTML,
+		Source:    req.Source,
+		Text:      req.Text,
+		Notes:     req.Notes,
+		CreatedBy: userID,
+	}, req.Activate)
+	if err != nil {
+		return emailTemplateError(err, "Failed to save email template")
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Email template version saved successfully",
+		Data:    saved,
+	})
+}
+
+// ActivateEmailTemplateVersion makes a version of an email template the one emails are rendered from
+// @Summary Activate email template version
+// @Description Render emails from a saved version of a template; version 0 goes back to the built-in template
+// @Tags admin
+// @Produce json
+// @Param name path string true "Template name"
+// @Param version path int true "Template version"
+// @Success 200 {object} SuccessResponse{data=mailer.Template}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/email-templates/{name}/versions/{version}/activate [put]
+func ActivateEmailTemplateVersion(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	version, err := c.ParamsInt("version")
+	if err != nil || version < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid template version")
+	}
+
+	active, err := mailer.Activate(c.Params("name"), version)
+	if err != nil {
+		return emailTemplateError(err, "Failed to activate email template")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Email template version activated successfully",
+		Data:    active,
+	})
+}
+
+// PreviewEmailTemplate renders an email template in a language
+// @Summary Preview email template
+// @Description Render a saved version of an email template, or an unsaved draft, in a language with sample or given data. With format=html the rendered HTML email is returned as is.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Produce html
+// @Param name path string true "Template name"
+// @Param format query string false "html to get the rendered HTML page"
+// @Param request body PreviewEmailTemplateRequest false "Version, language and data"
+// @Success 200 {object} SuccessResponse{data=mailer.Message}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/email-templates/{name}/preview [post]
+func PreviewEmailTemplate(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	var req PreviewEmailTemplateRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	name := c.Params("name")
+	if !mailer.IsKnown(name) {
+		return fiber.NewError(fiber.StatusNotFound, "Email template not found")
+	}
+
+	var t mailer.Template
+	var err error
+	switch {
+	case req.HTML != "" || req.Source != "":
+		t = mailer.Template{Name: name, Format: req.Format, Subject: req.Subject, HTML: req.HTML, Source: req.Source, Text: req.Text}
+	case req.Version != nil:
+		t, err = mailer.Version(name, *req.Version)
+	default:
+		t, err = mailer.Active(name)
+	}
+	if err != nil {
+		return emailTemplateError(err, "Failed to load email template")
+	}
+	data := req.Data
+	if data == nil {
+		data = mailer.SampleData(name)
+	}
+	lang := req.Language
+	if lang == "" {
+		lang, _ = c.Locals("lang").(string)
+	}
+
+	message, err := mailer.Default().Preview(t, lang, data)
+	if err != nil {
+		return emailTemplateError(err, "Failed to render email template")
+	}
+	if c.Query("format") == "html" {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString(message.HTML)
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Email template rendered successfully",
+		Data:    message,
+	})
+}
@@ -0,0 +1,457 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// energyCategories are the equipment categories energy is metered by
+var energyCategories = []string{"aeration", "pumps", "chillers", "heating", "lighting", "other"}
+
+// energyMonthLayout is the format of a reading month
+const energyMonthLayout = "2006-01"
+
+// EnergyReadingInput is the energy of one equipment category
+type EnergyReadingInput struct {
+	Category string  `json:"category"` // aeration, pumps, chillers, heating, lighting or other
+	KWh      float64 `json:"kwh"`
+	Notes    string  `json:"notes"`
+}
+
+// EnergyReadingsRequest represents a request to record the meter readings of a month
+type EnergyReadingsRequest struct {
+	Month    string               `json:"month"` // YYYY-MM
+	Readings []EnergyReadingInput `json:"readings"`
+}
+
+// EnergyImportResult is the report of an energy reading import
+type EnergyImportResult struct {
+	DryRun   bool                   `json:"dry_run"`
+	Rows     int                    `json:"rows"`
+	Imported int                    `json:"imported"`
+	Errors   []EventImportRowError  `json:"errors"`
+	Readings []models.EnergyReading `json:"readings"`
+}
+
+// energyReading is a validated reading waiting to be saved
+type energyReading struct {
+	month time.Time
+	EnergyReadingInput
+}
+
+const energyReadingColumns = `
+	id, COALESCE(hatchery_id, 0), TO_CHAR(month, 'YYYY-MM'), category, kwh, source, COALESCE(notes, ''),
+	COALESCE(recorded_by, 0), created_at, updated_at
+`
+
+// scanEnergyReading reads a reading selected with energyReadingColumns
+func scanEnergyReading(row rowScanner) (models.EnergyReading, error) {
+	var r models.EnergyReading
+	err := row.Scan(&r.ID, &r.HatcheryID, &r.Month, &r.Category, &r.KWh, &r.Source, &r.Notes,
+		&r.RecordedBy, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+// parseEnergyMonth reads a YYYY-MM month; readings of months that have not started are refused
+func parseEnergyMonth(value string) (time.Time, error) {
+	month, err := time.Parse(energyMonthLayout, strings.TrimSpace(value))
+	if err != nil {
+		return month, fmt.Errorf("month must be formatted as YYYY-MM")
+	}
+	if month.After(time.Now()) {
+		return month, fmt.Errorf("month must not be in the future")
+	}
+	return month, nil
+}
+
+// validateEnergyReading checks the category and energy of a reading
+func validateEnergyReading(input *EnergyReadingInput) error {
+	input.Category = strings.ToLower(strings.TrimSpace(input.Category))
+	if !containsString(energyCategories, input.Category) {
+		return fmt.Errorf("category must be one of %s", strings.Join(energyCategories, ", "))
+	}
+	if input.KWh < 0 {
+		return fmt.Errorf("energy must not be negative")
+	}
+	return nil
+}
+
+// hatcheryExists reports whether an active hatchery exists
+func hatcheryExists(hatcheryID int) (bool, error) {
+	var exists bool
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM hatchery WHERE id = $1 AND is_active = true)", hatcheryID).Scan(&exists)
+	return exists, err
+}
+
+// saveEnergyReadings records readings of a hatchery in one transaction; a reading replaces the one of
+// the same month and category
+func saveEnergyReadings(hatcheryID int, readings []energyReading, source string, userID int) ([]models.EnergyReading, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	saved := make([]models.EnergyReading, 0, len(readings))
+	for _, r := range readings {
+		reading, err := scanEnergyReading(tx.QueryRow(`
+			INSERT INTO energy_reading (hatchery_id, month, category, kwh, source, notes, recorded_by, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NOW(), NOW())
+			ON CONFLICT (hatchery_id, month, category) DO UPDATE
+			SET kwh = EXCLUDED.kwh, source = EXCLUDED.source, notes = EXCLUDED.notes,
+				recorded_by = EXCLUDED.recorded_by, updated_at = NOW()
+			RETURNING `+energyReadingColumns,
+			hatcheryID, r.month, r.Category, r.KWh, source, r.Notes, userID))
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, reading)
+	}
+	return saved, tx.Commit()
+}
+
+// RecordEnergyReadings records the energy meter readings of a facility for a month
+// @Summary Record energy readings
+// @Description Record the energy a hatchery used in a month per equipment category. A reading replaces the earlier one of the same month and category
+// @Tags hatcheries
+// @Accept json
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param request body EnergyReadingsRequest true "Month and readings"
+// @Success 200 {object} SuccessResponse{data=[]models.EnergyReading}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/energy [put]
+func RecordEnergyReadings(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+
+	var req EnergyReadingsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	month, err := parseEnergyMonth(req.Month)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid month: "+err.Error())
+	}
+	if len(req.Readings) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one reading is required")
+	}
+	readings := make([]energyReading, 0, len(req.Readings))
+	seen := map[string]bool{}
+	for _, input := range req.Readings {
+		if err := validateEnergyReading(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid reading: "+err.Error())
+		}
+		if seen[input.Category] {
+			return fiber.NewError(fiber.StatusBadRequest, "Category "+input.Category+" is listed twice")
+		}
+		seen[input.Category] = true
+		readings = append(readings, energyReading{month: month, EnergyReadingInput: input})
+	}
+
+	exists, err := hatcheryExists(hatcheryID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Hatchery not found")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	saved, err := saveEnergyReadings(hatcheryID, readings, "manual", userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save energy readings")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Energy readings recorded successfully",
+		Data:    saved,
+	})
+}
+
+// GetEnergyReadings lists the energy meter readings of a facility
+// @Summary List energy readings
+// @Description List the monthly energy readings of a hatchery per equipment category, oldest month first
+// @Tags hatcheries
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param from query string false "First month (YYYY-MM)"
+// @Param to query string false "Last month (YYYY-MM)"
+// @Param category query string false "Equipment category"
+// @Success 200 {object} SuccessResponse{data=[]models.EnergyReading}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/energy [get]
+func GetEnergyReadings(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+	from, to, err := parseMonthRange(c)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query(`SELECT `+energyReadingColumns+`
+		FROM energy_reading
+		WHERE hatchery_id = $1 AND month BETWEEN $2 AND $3 AND ($4 = '' OR category = $4)
+		ORDER BY month, category
+	`, hatcheryID, from, to, c.Query("category"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	readings := []models.EnergyReading{}
+	for rows.Next() {
+		reading, err := scanEnergyReading(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse energy reading")
+		}
+		readings = append(readings, reading)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Energy readings retrieved successfully",
+		Data:    readings,
+	})
+}
+
+// ImportEnergyReadings imports the energy meter readings of a facility from a CSV or XLSX file
+// @Summary Import energy readings
+// @Description Import monthly energy readings of a hatchery from a CSV or XLSX file with the columns month (YYYY-MM), category, kwh and optionally notes. Nothing is saved when a row is invalid; readings replace earlier ones of the same month and category
+// @Tags hatcheries
+// @Accept multipart/form-data
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param file formData file true "CSV or XLSX file"
+// @Param dry_run formData bool false "Validate without saving"
+// @Success 200 {object} SuccessResponse{data=EnergyImportResult}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} SuccessResponse{data=EnergyImportResult} "Rows failed validation"
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/energy/import [post]
+func ImportEnergyReadings(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "File is required")
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), ".")
+	if format != "csv" && format != "xlsx" {
+		return fiber.NewError(fiber.StatusBadRequest, "File must be a .csv or .xlsx file")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Failed to read file")
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Failed to read file")
+	}
+	dryRun, _ := strconv.ParseBool(c.FormValue("dry_run", "false"))
+
+	records, err := readEventImportFile(format, data)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if len(records) < 2 {
+		return fiber.NewError(fiber.StatusBadRequest, "File needs a header row and at least one data row")
+	}
+	columns := map[string]int{"notes": -1}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"month", "category", "kwh"} {
+		if _, ok := columns[name]; !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "Missing column "+name)
+		}
+	}
+
+	exists, err := hatcheryExists(hatcheryID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Hatchery not found")
+	}
+
+	result := EnergyImportResult{DryRun: dryRun, Rows: len(records) - 1, Errors: []EventImportRowError{}, Readings: []models.EnergyReading{}}
+	readings := []energyReading{}
+	seen := map[string]int{}
+	for i, row := range records[1:] {
+		rowNumber := i + 2
+		cell := func(name string) string {
+			if position := columns[name]; position >= 0 && position < len(row) {
+				return strings.TrimSpace(row[position])
+			}
+			return ""
+		}
+		fail := func(column, message string) {
+			result.Errors = append(result.Errors, EventImportRowError{Row: rowNumber, Column: column, Message: message})
+		}
+
+		month, err := parseEnergyMonth(cell("month"))
+		if err != nil {
+			fail("month", err.Error())
+			continue
+		}
+		kwh, err := strconv.ParseFloat(cell("kwh"), 64)
+		if err != nil {
+			fail("kwh", "energy must be a number")
+			continue
+		}
+		input := EnergyReadingInput{Category: cell("category"), KWh: kwh, Notes: cell("notes")}
+		if err := validateEnergyReading(&input); err != nil {
+			fail("category", err.Error())
+			continue
+		}
+		key := month.Format(energyMonthLayout) + "/" + input.Category
+		if first, ok := seen[key]; ok {
+			fail("category", fmt.Sprintf("duplicates row %d", first))
+			continue
+		}
+		seen[key] = rowNumber
+		readings = append(readings, energyReading{month: month, EnergyReadingInput: input})
+	}
+
+	if len(result.Errors) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(SuccessResponse{
+			Success: false,
+			Message: "Energy readings failed validation",
+			Data:    result,
+		})
+	}
+	if !dryRun {
+		userID, _ := c.Locals("userID").(int)
+		if result.Readings, err = saveEnergyReadings(hatcheryID, readings, "import", userID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to save energy readings")
+		}
+		result.Imported = len(result.Readings)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d energy readings imported", result.Imported),
+		Data:    result,
+	})
+}
+
+// DeleteEnergyReading deletes an energy reading recorded by mistake
+// @Summary Delete energy reading
+// @Description Delete an energy reading of a hatchery recorded by mistake
+// @Tags hatcheries
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param readingId path int true "Energy reading ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/energy/{readingId} [delete]
+func DeleteEnergyReading(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+	readingID, err := strconv.Atoi(c.Params("readingId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid energy reading ID format")
+	}
+
+	result, err := db.DB.Exec("DELETE FROM energy_reading WHERE id = $1 AND hatchery_id = $2", readingID, hatcheryID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete energy reading")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Energy reading not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Energy reading deleted successfully",
+	})
+}
+
+// parseMonthRange reads the optional from and to months (YYYY-MM) of a report; by default the last 12
+// months up to the current one. to is the first day of the last month
+func parseMonthRange(c *fiber.Ctx) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, -11, 0)
+	var err error
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(energyMonthLayout, v); err != nil {
+			return from, to, fiber.NewError(fiber.StatusBadRequest, "Invalid to month, use YYYY-MM")
+		}
+		if c.Query("from") == "" {
+			from = to.AddDate(0, -11, 0)
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(energyMonthLayout, v); err != nil {
+			return from, to, fiber.NewError(fiber.StatusBadRequest, "Invalid from month, use YYYY-MM")
+		}
+	}
+	if to.Before(from) {
+		return from, to, fiber.NewError(fiber.StatusBadRequest, "The to month must not be before the from month")
+	}
+	return from, to, nil
+}
+
+// loadEnergyTotals sums the energy readings of hatcheries per hatchery, month and category
+func loadEnergyTotals(hatcheryIDs []int, from, to time.Time) (map[int]map[string]map[string]float64, error) {
+	totals := map[int]map[string]map[string]float64{}
+	if len(hatcheryIDs) == 0 {
+		return totals, nil
+	}
+	rows, err := db.DB.Query(`
+		SELECT hatchery_id, TO_CHAR(month, 'YYYY-MM'), category, SUM(kwh)
+		FROM energy_reading
+		WHERE hatchery_id = ANY($1) AND month BETWEEN $2 AND $3
+		GROUP BY 1, 2, 3
+	`, pq.Array(hatcheryIDs), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hatcheryID int
+		var month, category string
+		var kwh sql.NullFloat64
+		if err := rows.Scan(&hatcheryID, &month, &category, &kwh); err != nil {
+			return nil, err
+		}
+		if totals[hatcheryID] == nil {
+			totals[hatcheryID] = map[string]map[string]float64{}
+		}
+		if totals[hatcheryID][month] == nil {
+			totals[hatcheryID][month] = map[string]float64{}
+		}
+		totals[hatcheryID][month][category] += kwh.Float64
+	}
+	return totals, rows.Err()
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
 	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
 	"github.com/LTPPPP/TracePost-larvaeChain/db"
 	"github.com/LTPPPP/TracePost-larvaeChain/models"
@@ -20,6 +21,9 @@ type UpdateEnvironmentDataRequest struct {
 	Salinity    float64 `json:"salinity"`
 	Density     float64 `json:"density"`
 	Age         int     `json:"age"`
+
+	// Custom parameters replace the stored ones when present
+	Parameters map[string]float64 `json:"parameters"`
 }
 
 // GetAllEnvironmentData retrieves all environment data records
@@ -58,6 +62,7 @@ func GetAllEnvironmentData(c *fiber.Ctx) error {
 	query := `
 		SELECT 
 			e.id, e.batch_id, e.temperature, e.ph, e.salinity, e.density, e.age, 
+			COALESCE(e.custom_parameters, '{}'), e.device_id, COALESCE(e.low_confidence, false),
 			e.timestamp, e.updated_at, e.is_active,
 			b.species, b.quantity, b.status,
 			h.name AS hatchery_name,
@@ -94,12 +99,24 @@ func GetAllEnvironmentData(c *fiber.Ctx) error {
 	}
 	defer rows.Close()
 
+	// Optimal ranges to place each value in
+	catalog, err := environmentCatalog()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment parameters")
+	}
+	profiles, err := loadEnvironmentProfiles("")
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment profiles")
+	}
+
 	// Parse results
 	var environmentDataList []map[string]interface{}
 	for rows.Next() {
 		var envData models.EnvironmentData
 		var species, status, hatcheryName, companyName string
 		var quantity int
+		var customParameters []byte
+		var deviceID sql.NullInt64
 
 		err := rows.Scan(
 			&envData.ID,
@@ -109,6 +126,9 @@ func GetAllEnvironmentData(c *fiber.Ctx) error {
 			&envData.Salinity,
 			&envData.Density,
 			&envData.Age,
+			&customParameters,
+			&deviceID,
+			&envData.LowConfidence,
 			&envData.Timestamp,
 			&envData.UpdatedAt,
 			&envData.IsActive,
@@ -131,6 +151,9 @@ func GetAllEnvironmentData(c *fiber.Ctx) error {
 			"salinity":    envData.Salinity,
 			"density":     envData.Density,
 			"age":         envData.Age,
+			"parameters":  decodeEnvironmentParameters(customParameters),
+			"device_id":      intPtr(deviceID),
+			"low_confidence": envData.LowConfidence,
 			"timestamp":   envData.Timestamp,
 			"updated_at":  envData.UpdatedAt,
 			"is_active":   envData.IsActive,
@@ -145,6 +168,10 @@ func GetAllEnvironmentData(c *fiber.Ctx) error {
 			},
 		}
 
+		envData.Parameters = decodeEnvironmentParameters(customParameters)
+		annotateEnvironmentRanges(&envData, species, catalog, profiles)
+		addEnvironmentRangeFields(envDataEntry, envData)
+
 		environmentDataList = append(environmentDataList, envDataEntry)
 	}
 
@@ -183,6 +210,8 @@ func GetEnvironmentDataByID(c *fiber.Ctx) error {
 	query := `
 		SELECT 
 			e.id, e.batch_id, e.temperature, e.ph, e.salinity, e.density, e.age, 
+			COALESCE(e.custom_parameters, '{}'), e.device_id, COALESCE(e.low_confidence, false),
+			e.quality_score, COALESCE(e.quality_flags, '{}'), COALESCE(e.suppressed, false),
 			e.timestamp, e.updated_at, e.is_active,
 			b.species, b.quantity, b.status,
 			h.name AS hatchery_name,
@@ -200,6 +229,9 @@ func GetEnvironmentDataByID(c *fiber.Ctx) error {
 	var envData models.EnvironmentData
 	var species, status, hatcheryName, companyName, companyLocation string
 	var quantity int
+	var customParameters []byte
+	var deviceID sql.NullInt64
+	var qualityScore sql.NullFloat64
 	var blockchainTxID, blockchainMetadata sql.NullString
 
 	err = db.DB.QueryRow(query, envID).Scan(
@@ -210,6 +242,12 @@ func GetEnvironmentDataByID(c *fiber.Ctx) error {
 		&envData.Salinity,
 		&envData.Density,
 		&envData.Age,
+		&customParameters,
+		&deviceID,
+		&envData.LowConfidence,
+		&qualityScore,
+		pq.Array(&envData.QualityFlags),
+		&envData.Suppressed,
 		&envData.Timestamp,
 		&envData.UpdatedAt,
 		&envData.IsActive,
@@ -238,6 +276,12 @@ func GetEnvironmentDataByID(c *fiber.Ctx) error {
 		"salinity":    envData.Salinity,
 		"density":     envData.Density,
 		"age":         envData.Age,
+		"parameters":  decodeEnvironmentParameters(customParameters),
+		"device_id":      intPtr(deviceID),
+		"low_confidence": envData.LowConfidence,
+		"quality_score":  floatPtr(qualityScore),
+		"quality_flags":  envData.QualityFlags,
+		"suppressed":     envData.Suppressed,
 		"timestamp":   envData.Timestamp,
 		"updated_at":  envData.UpdatedAt,
 		"is_active":   envData.IsActive,
@@ -253,6 +297,19 @@ func GetEnvironmentDataByID(c *fiber.Ctx) error {
 		},
 	}
 
+	// Place each value in the optimal range of the batch species at the reading's age
+	envData.Parameters = decodeEnvironmentParameters(customParameters)
+	catalog, err := environmentCatalog()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment parameters")
+	}
+	profiles, err := loadEnvironmentProfiles(species)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment profiles")
+	}
+	annotateEnvironmentRanges(&envData, species, catalog, profiles)
+	addEnvironmentRangeFields(response, envData)
+
 	// Add blockchain verification if available
 	if blockchainTxID.Valid {
 		response["blockchain_verification"] = map[string]interface{}{
@@ -311,6 +368,27 @@ func UpdateEnvironmentData(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusNotFound, "Environment data not found")
 	}
 
+	// Validate values against the parameter catalog
+	catalog, err := environmentCatalog()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment parameters")
+	}
+	err = validateEnvironmentData(models.EnvironmentData{
+		Temperature: req.Temperature,
+		PH:          req.PH,
+		Salinity:    req.Salinity,
+		Density:     req.Density,
+		Age:         req.Age,
+		Parameters:  req.Parameters,
+	}, catalog)
+	if err != nil {
+		return err
+	}
+	var customParameters interface{}
+	if req.Parameters != nil {
+		customParameters = encodeEnvironmentParameters(req.Parameters)
+	}
+
 	// Initialize blockchain client
 	blockchainClient := blockchain.NewBlockchainClient(
 		os.Getenv("BLOCKCHAIN_NODE_URL"),
@@ -329,6 +407,7 @@ func UpdateEnvironmentData(c *fiber.Ctx) error {
 		"salinity":       req.Salinity,
 		"density":        req.Density,
 		"age":            req.Age,
+		"parameters":     req.Parameters,
 		"updated_at":     time.Now(),
 	}
 	txID, err := blockchainClient.RecordEvent(
@@ -345,12 +424,16 @@ func UpdateEnvironmentData(c *fiber.Ctx) error {
 	// Update environment data in database
 	query := `
 		UPDATE environment_data 
-		SET temperature = $1, ph = $2, salinity = $3, density = $4, age = $5, updated_at = NOW()
+		SET temperature = $1, ph = $2, salinity = $3, density = $4, age = $5,
+			custom_parameters = COALESCE($7::jsonb, custom_parameters), updated_at = NOW()
 		WHERE id = $6
-		RETURNING id, batch_id, temperature, ph, salinity, density, age, timestamp, updated_at, is_active
+		RETURNING id, batch_id, temperature, ph, salinity, density, age, COALESCE(custom_parameters, '{}'),
+			device_id, COALESCE(low_confidence, false), timestamp, updated_at, is_active
 	`
 
 	var envData models.EnvironmentData
+	var storedParameters []byte
+	var deviceID sql.NullInt64
 	err = db.DB.QueryRow(
 		query,
 		req.Temperature,
@@ -359,6 +442,7 @@ func UpdateEnvironmentData(c *fiber.Ctx) error {
 		req.Density,
 		req.Age,
 		envID,
+		customParameters,
 	).Scan(
 		&envData.ID,
 		&envData.BatchID,
@@ -367,6 +451,9 @@ func UpdateEnvironmentData(c *fiber.Ctx) error {
 		&envData.Salinity,
 		&envData.Density,
 		&envData.Age,
+		&storedParameters,
+		&deviceID,
+		&envData.LowConfidence,
 		&envData.Timestamp,
 		&envData.UpdatedAt,
 		&envData.IsActive,
@@ -374,6 +461,8 @@ func UpdateEnvironmentData(c *fiber.Ctx) error {
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update environment data")
 	}
+	envData.Parameters = decodeEnvironmentParameters(storedParameters)
+	envData.DeviceID = intPtr(deviceID)
 
 	// Record blockchain transaction if successful
 	if txID != "" {
@@ -391,9 +480,15 @@ func UpdateEnvironmentData(c *fiber.Ctx) error {
 		}
 	}
 
+	// Raise alerts for values outside their optimal range
+	message := "Environment data updated successfully"
+	if alerts := raiseEnvironmentAlerts(&envData, catalog); len(alerts) > 0 {
+		message = fmt.Sprintf("Environment data updated with %d alert(s)", len(alerts))
+	}
+
 	return c.JSON(SuccessResponse{
 		Success: true,
-		Message: "Environment data updated successfully",
+		Message: message,
 		Data:    envData,
 	})
 }
@@ -0,0 +1,735 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+	"github.com/LTPPPP/TracePost-larvaeChain/notify"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+)
+
+// Data types of environment parameters
+const (
+	ParameterTypeNumber  = "number"
+	ParameterTypeInteger = "integer"
+)
+
+// EnvironmentParameter is a parameter of the environment parameter catalog
+// MinValue and MaxValue bound the values that are accepted, AlertMin and AlertMax bound the optimal range
+type EnvironmentParameter struct {
+	ID          int       `json:"id"`
+	Code        string    `json:"code"`
+	Name        string    `json:"name"`
+	Unit        string    `json:"unit"`
+	DataType    string    `json:"data_type"`
+	MinValue    *float64  `json:"min_value,omitempty"`
+	MaxValue    *float64  `json:"max_value,omitempty"`
+	AlertMin    *float64  `json:"alert_min,omitempty"`
+	AlertMax    *float64  `json:"alert_max,omitempty"`
+	Description string    `json:"description,omitempty"`
+	BuiltIn     bool      `json:"builtin"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// EnvironmentParameterRequest represents a request to add or change a catalog parameter
+type EnvironmentParameterRequest struct {
+	Code        string   `json:"code"`
+	Name        string   `json:"name"`
+	Unit        string   `json:"unit"`
+	DataType    string   `json:"data_type"`
+	MinValue    *float64 `json:"min_value"`
+	MaxValue    *float64 `json:"max_value"`
+	AlertMin    *float64 `json:"alert_min"`
+	AlertMax    *float64 `json:"alert_max"`
+	Description string   `json:"description"`
+}
+
+// EnvironmentAlert is raised when a recorded value is outside the optimal range of its parameter
+type EnvironmentAlert struct {
+	ID                int       `json:"id"`
+	EnvironmentDataID int       `json:"environment_data_id"`
+	BatchID           int       `json:"batch_id"`
+	ParameterCode     string    `json:"parameter_code"`
+	Value             float64   `json:"value"`
+	AlertMin          *float64  `json:"alert_min,omitempty"`
+	AlertMax          *float64  `json:"alert_max,omitempty"`
+	Direction         string    `json:"direction"`            // "low" or "high"
+	ProfileID         *int      `json:"profile_id,omitempty"` // Reference profile the range was taken from
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// EnvironmentSeriesPoint is one reading of a chart series
+type EnvironmentSeriesPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Status    string    `json:"status,omitempty"` // Position in the optimal range at the reading's age
+}
+
+// EnvironmentSeries is the chart series of one parameter of a batch
+type EnvironmentSeries struct {
+	Code     string                   `json:"code"`
+	Name     string                   `json:"name"`
+	Unit     string                   `json:"unit"`
+	AlertMin *float64                 `json:"alert_min,omitempty"`
+	AlertMax *float64                 `json:"alert_max,omitempty"`
+	Points   []EnvironmentSeriesPoint `json:"points"`
+}
+
+var parameterCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+const environmentParameterColumns = `
+	id, code, name, COALESCE(unit, ''), COALESCE(data_type, 'number'),
+	min_value, max_value, alert_min, alert_max, COALESCE(description, ''), is_builtin, created_at
+`
+
+// scanEnvironmentParameter reads a parameter selected with environmentParameterColumns
+func scanEnvironmentParameter(row rowScanner) (EnvironmentParameter, error) {
+	var p EnvironmentParameter
+	var minValue, maxValue, alertMin, alertMax sql.NullFloat64
+	err := row.Scan(&p.ID, &p.Code, &p.Name, &p.Unit, &p.DataType,
+		&minValue, &maxValue, &alertMin, &alertMax, &p.Description, &p.BuiltIn, &p.CreatedAt)
+	p.MinValue = floatPtr(minValue)
+	p.MaxValue = floatPtr(maxValue)
+	p.AlertMin = floatPtr(alertMin)
+	p.AlertMax = floatPtr(alertMax)
+	return p, err
+}
+
+// floatPtr converts a nullable column to an optional value
+func floatPtr(n sql.NullFloat64) *float64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Float64
+}
+
+// loadEnvironmentParameters returns the active parameters of the catalog, built-in parameters first
+func loadEnvironmentParameters() ([]EnvironmentParameter, error) {
+	rows, err := db.DB.Query(`SELECT ` + environmentParameterColumns + `
+		FROM environment_parameter
+		WHERE is_active = true
+		ORDER BY is_builtin DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parameters := []EnvironmentParameter{}
+	for rows.Next() {
+		p, err := scanEnvironmentParameter(rows)
+		if err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, p)
+	}
+	return parameters, rows.Err()
+}
+
+// environmentCatalog indexes the catalog by parameter code
+func environmentCatalog() (map[string]EnvironmentParameter, error) {
+	parameters, err := loadEnvironmentParameters()
+	if err != nil {
+		return nil, err
+	}
+	catalog := make(map[string]EnvironmentParameter, len(parameters))
+	for _, p := range parameters {
+		catalog[p.Code] = p
+	}
+	return catalog, nil
+}
+
+// environmentValues returns every value of a reading, built-in and custom, keyed by parameter code
+func environmentValues(envData models.EnvironmentData) map[string]float64 {
+	values := map[string]float64{
+		"temperature": envData.Temperature,
+		"ph":          envData.PH,
+		"salinity":    envData.Salinity,
+		"density":     envData.Density,
+		"age":         float64(envData.Age),
+	}
+	for code, value := range envData.Parameters {
+		values[code] = value
+	}
+	return values
+}
+
+// decodeEnvironmentParameters reads the custom_parameters column
+func decodeEnvironmentParameters(raw []byte) map[string]float64 {
+	parameters := map[string]float64{}
+	if len(raw) > 0 {
+		json.Unmarshal(raw, &parameters)
+	}
+	return parameters
+}
+
+// encodeEnvironmentParameters writes custom parameters for the custom_parameters column
+func encodeEnvironmentParameters(parameters map[string]float64) string {
+	if len(parameters) == 0 {
+		return "{}"
+	}
+	raw, _ := json.Marshal(parameters)
+	return string(raw)
+}
+
+// validateEnvironmentData checks a reading against the parameter catalog
+// Custom parameters must be in the catalog and every value must be within its parameter's limits.
+// Sensor readings outside the limits are accepted so that data quality scoring can flag them
+func validateEnvironmentData(envData models.EnvironmentData, catalog map[string]EnvironmentParameter) error {
+	for code := range envData.Parameters {
+		p, ok := catalog[code]
+		if !ok {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Unknown environment parameter: %s", code))
+		}
+		if p.BuiltIn {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Parameter %s must be sent in its own field", code))
+		}
+	}
+
+	for code, value := range environmentValues(envData) {
+		p, ok := catalog[code]
+		if !ok {
+			continue
+		}
+		if p.DataType == ParameterTypeInteger && value != math.Trunc(value) {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Parameter %s must be an integer", code))
+		}
+		if envData.DeviceID != nil {
+			continue
+		}
+		if p.MinValue != nil && value < *p.MinValue {
+			return fiber.NewError(fiber.StatusBadRequest, strings.TrimSpace(fmt.Sprintf("Parameter %s must be at least %g %s", code, *p.MinValue, p.Unit)))
+		}
+		if p.MaxValue != nil && value > *p.MaxValue {
+			return fiber.NewError(fiber.StatusBadRequest, strings.TrimSpace(fmt.Sprintf("Parameter %s must be at most %g %s", code, *p.MaxValue, p.Unit)))
+		}
+	}
+	return nil
+}
+
+// raiseEnvironmentAlerts records an alert for every value of a reading outside its optimal range
+// and notifies the company owning the batch. Optimal ranges come from the reference profile of the
+// batch species at the reading's age, falling back to the catalog; the reading is annotated with them
+func raiseEnvironmentAlerts(envData *models.EnvironmentData, catalog map[string]EnvironmentParameter) []EnvironmentAlert {
+	thresholds := annotateBatchReading(envData, catalog)
+	if envData.Suppressed {
+		return []EnvironmentAlert{}
+	}
+	values := environmentValues(*envData)
+	codes := make([]string, 0, len(values))
+	for code := range values {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	alerts := []EnvironmentAlert{}
+	for _, code := range codes {
+		p, ok := thresholds[code]
+		if !ok {
+			continue
+		}
+		value := values[code]
+		alert := EnvironmentAlert{
+			EnvironmentDataID: envData.ID,
+			BatchID:           envData.BatchID,
+			ParameterCode:     code,
+			Value:             value,
+			AlertMin:          p.AlertMin,
+			AlertMax:          p.AlertMax,
+			ProfileID:         envData.ReferenceProfileID,
+		}
+		switch {
+		case p.AlertMin != nil && value < *p.AlertMin:
+			alert.Direction = "low"
+		case p.AlertMax != nil && value > *p.AlertMax:
+			alert.Direction = "high"
+		default:
+			continue
+		}
+
+		err := db.DB.QueryRow(`
+			INSERT INTO environment_alert (environment_data_id, batch_id, parameter_code, value, alert_min, alert_max, direction, profile_id, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+			RETURNING id, created_at
+		`, alert.EnvironmentDataID, alert.BatchID, alert.ParameterCode, alert.Value, alert.AlertMin, alert.AlertMax, alert.Direction,
+			alert.ProfileID).Scan(&alert.ID, &alert.CreatedAt)
+		if err != nil {
+			fmt.Printf("Warning: Failed to record environment alert: %v\n", err)
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+
+	if len(alerts) > 0 {
+		var companyID int
+		err := db.DB.QueryRow(`
+			SELECT h.company_id
+			FROM batch b
+			JOIN hatchery h ON b.hatchery_id = h.id
+			WHERE b.id = $1 AND h.company_id IS NOT NULL
+		`, envData.BatchID).Scan(&companyID)
+		if err == nil {
+			data := map[string]interface{}{
+				"batch_id":            envData.BatchID,
+				"environment_data_id": envData.ID,
+				"alerts":              alerts,
+			}
+			if err := webhooks.Dispatch(companyID, "environment_alert", data); err != nil {
+				fmt.Printf("Warning: failed to dispatch environment_alert webhook: %v\n", err)
+			}
+			if err := notify.Notify(companyID, notify.AlertEnvironment, data); err != nil {
+				fmt.Printf("Warning: failed to send environment_alert notification: %v\n", err)
+			}
+		}
+	}
+	return alerts
+}
+
+// validateParameterRanges checks that the limits of a parameter request are consistent
+func validateParameterRanges(req EnvironmentParameterRequest) error {
+	if req.DataType != ParameterTypeNumber && req.DataType != ParameterTypeInteger {
+		return fiber.NewError(fiber.StatusBadRequest, "Data type must be number or integer")
+	}
+	if req.MinValue != nil && req.MaxValue != nil && *req.MinValue > *req.MaxValue {
+		return fiber.NewError(fiber.StatusBadRequest, "Minimum value must not exceed maximum value")
+	}
+	if req.AlertMin != nil && req.AlertMax != nil && *req.AlertMin > *req.AlertMax {
+		return fiber.NewError(fiber.StatusBadRequest, "Alert minimum must not exceed alert maximum")
+	}
+	return nil
+}
+
+// ListEnvironmentParameters lists the environment parameter catalog
+// @Summary List environment parameters
+// @Description List the parameters that can be recorded as environment data, with their units, validation limits and optimal ranges
+// @Tags environment
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]EnvironmentParameter}
+// @Failure 500 {object} ErrorResponse
+// @Router /environment/parameters [get]
+func ListEnvironmentParameters(c *fiber.Ctx) error {
+	parameters, err := loadEnvironmentParameters()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment parameters")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Environment parameters retrieved successfully",
+		Data:    parameters,
+	})
+}
+
+// CreateEnvironmentParameter adds a custom parameter to the catalog
+// @Summary Create environment parameter
+// @Description Add a custom parameter (e.g. dissolved oxygen, ammonia) that can be recorded with environment data
+// @Tags environment
+// @Accept json
+// @Produce json
+// @Param request body EnvironmentParameterRequest true "Parameter details"
+// @Success 201 {object} SuccessResponse{data=EnvironmentParameter}
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /environment/parameters [post]
+func CreateEnvironmentParameter(c *fiber.Ctx) error {
+	var req EnvironmentParameterRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	req.Code = strings.ToLower(strings.TrimSpace(req.Code))
+	if !parameterCodePattern.MatchString(req.Code) {
+		return fiber.NewError(fiber.StatusBadRequest, "Code must be 2-50 lowercase letters, digits or underscores, starting with a letter")
+	}
+	if req.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Name is required")
+	}
+	if req.DataType == "" {
+		req.DataType = ParameterTypeNumber
+	}
+	if err := validateParameterRanges(req); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM environment_parameter WHERE code = $1)", req.Code).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "Environment parameter already exists")
+	}
+
+	parameter, err := scanEnvironmentParameter(db.DB.QueryRow(`
+		INSERT INTO environment_parameter (code, name, unit, data_type, min_value, max_value, alert_min, alert_max, description, is_builtin, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, false, NOW(), NOW(), true)
+		RETURNING `+environmentParameterColumns,
+		req.Code, req.Name, req.Unit, req.DataType, req.MinValue, req.MaxValue, req.AlertMin, req.AlertMax, req.Description))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create environment parameter")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Environment parameter created successfully",
+		Data:    parameter,
+	})
+}
+
+// UpdateEnvironmentParameter changes the name, unit and ranges of a catalog parameter
+// @Summary Update environment parameter
+// @Description Change the name, unit, validation limits and optimal range of a parameter. The data type of built-in parameters is fixed
+// @Tags environment
+// @Accept json
+// @Produce json
+// @Param code path string true "Parameter code"
+// @Param request body EnvironmentParameterRequest true "Parameter details"
+// @Success 200 {object} SuccessResponse{data=EnvironmentParameter}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /environment/parameters/{code} [put]
+func UpdateEnvironmentParameter(c *fiber.Ctx) error {
+	code := c.Params("code")
+
+	var req EnvironmentParameterRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	current, err := scanEnvironmentParameter(db.DB.QueryRow(`SELECT `+environmentParameterColumns+`
+		FROM environment_parameter WHERE code = $1 AND is_active = true`, code))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Environment parameter not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	if req.Name == "" {
+		req.Name = current.Name
+	}
+	if req.DataType == "" {
+		req.DataType = current.DataType
+	}
+	if current.BuiltIn && req.DataType != current.DataType {
+		return fiber.NewError(fiber.StatusBadRequest, "The data type of a built-in parameter cannot be changed")
+	}
+	if err := validateParameterRanges(req); err != nil {
+		return err
+	}
+
+	parameter, err := scanEnvironmentParameter(db.DB.QueryRow(`
+		UPDATE environment_parameter
+		SET name = $2, unit = $3, data_type = $4, min_value = $5, max_value = $6,
+			alert_min = $7, alert_max = $8, description = $9, updated_at = NOW()
+		WHERE code = $1
+		RETURNING `+environmentParameterColumns,
+		code, req.Name, req.Unit, req.DataType, req.MinValue, req.MaxValue, req.AlertMin, req.AlertMax, req.Description))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update environment parameter")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Environment parameter updated successfully",
+		Data:    parameter,
+	})
+}
+
+// ListEnvironmentAlerts lists the alerts raised by environment readings
+// @Summary List environment alerts
+// @Description List readings that were outside the optimal range of their parameter
+// @Tags environment
+// @Produce json
+// @Param batch_id query int false "Batch ID"
+// @Param parameter query string false "Parameter code"
+// @Param limit query int false "Limit number of results (default: 50)"
+// @Success 200 {object} SuccessResponse{data=[]EnvironmentAlert}
+// @Failure 500 {object} ErrorResponse
+// @Router /environment/alerts [get]
+func ListEnvironmentAlerts(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, environment_data_id, batch_id, parameter_code, value, alert_min, alert_max, direction, profile_id, created_at
+		FROM environment_alert
+		WHERE ($1::int = 0 OR batch_id = $1)
+			AND ($2::text = '' OR parameter_code = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, c.QueryInt("batch_id", 0), c.Query("parameter"), limit)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	alerts := []EnvironmentAlert{}
+	for rows.Next() {
+		var a EnvironmentAlert
+		var alertMin, alertMax sql.NullFloat64
+		var profileID sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.EnvironmentDataID, &a.BatchID, &a.ParameterCode, &a.Value,
+			&alertMin, &alertMax, &a.Direction, &profileID, &a.CreatedAt); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse environment alert")
+		}
+		a.AlertMin = floatPtr(alertMin)
+		a.AlertMax = floatPtr(alertMax)
+		a.ProfileID = intPtr(profileID)
+		alerts = append(alerts, a)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Environment alerts retrieved successfully",
+		Data:    alerts,
+	})
+}
+
+// loadBatchEnvironmentReadings returns the readings of a batch in chronological order
+func loadBatchEnvironmentReadings(batchID int, from, to time.Time) ([]models.EnvironmentData, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, batch_id, COALESCE(temperature, 0), COALESCE(ph, 0), COALESCE(salinity, 0), COALESCE(density, 0),
+			COALESCE(age, 0), COALESCE(custom_parameters, '{}'), device_id, COALESCE(low_confidence, false),
+			quality_score, COALESCE(quality_flags, '{}'), COALESCE(suppressed, false), timestamp, updated_at, is_active
+		FROM environment_data
+		WHERE batch_id = $1 AND is_active = true
+			AND ($2::timestamp IS NULL OR timestamp >= $2)
+			AND ($3::timestamp IS NULL OR timestamp <= $3)
+		ORDER BY timestamp
+	`, batchID, nullTime(from), nullTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := []models.EnvironmentData{}
+	for rows.Next() {
+		var e models.EnvironmentData
+		var custom []byte
+		var deviceID sql.NullInt64
+		var qualityScore sql.NullFloat64
+		if err := rows.Scan(&e.ID, &e.BatchID, &e.Temperature, &e.PH, &e.Salinity, &e.Density,
+			&e.Age, &custom, &deviceID, &e.LowConfidence, &qualityScore, pq.Array(&e.QualityFlags), &e.Suppressed,
+			&e.Timestamp, &e.UpdatedAt, &e.IsActive); err != nil {
+			return nil, err
+		}
+		e.Parameters = decodeEnvironmentParameters(custom)
+		e.DeviceID = intPtr(deviceID)
+		e.QualityScore = floatPtr(qualityScore)
+		readings = append(readings, e)
+	}
+	return readings, rows.Err()
+}
+
+// nullTime leaves a zero time unset so that it does not filter
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// parseTimeRange reads the optional from and to query parameters
+func parseTimeRange(c *fiber.Ctx) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, fiber.NewError(fiber.StatusBadRequest, "Invalid from time, use RFC3339")
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, fiber.NewError(fiber.StatusBadRequest, "Invalid to time, use RFC3339")
+		}
+	}
+	return from, to, nil
+}
+
+// GetBatchEnvironmentSeries returns chart series of the environment parameters of a batch
+// @Summary Get batch environment chart series
+// @Description Get one time series per environment parameter of a batch, built-in and custom, with the optimal range of each parameter. Each point has its position in the optimal range of the batch species at the reading's age
+// @Tags batches
+// @Produce json
+// @Param batchId path string true "Batch ID"
+// @Param parameters query string false "Comma separated parameter codes (default: every parameter with readings)"
+// @Param from query string false "Start time (RFC3339)"
+// @Param to query string false "End time (RFC3339)"
+// @Param include_suppressed query bool false "Include readings suppressed by data quality scoring"
+// @Success 200 {object} SuccessResponse{data=[]EnvironmentSeries}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/environment/series [get]
+func GetBatchEnvironmentSeries(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return err
+	}
+
+	parameters, err := loadEnvironmentParameters()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment parameters")
+	}
+	readings, err := loadBatchEnvironmentReadings(batchID, from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment data")
+	}
+	var species string
+	db.DB.QueryRow(`SELECT COALESCE(species, '') FROM batch WHERE id = $1`, batchID).Scan(&species)
+	profiles, err := loadEnvironmentProfiles(species)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment profiles")
+	}
+	catalog := make(map[string]EnvironmentParameter, len(parameters))
+	for _, p := range parameters {
+		catalog[p.Code] = p
+	}
+	for i := range readings {
+		annotateEnvironmentRanges(&readings[i], species, catalog, profiles)
+	}
+
+	requested := map[string]bool{}
+	for _, code := range strings.Split(c.Query("parameters"), ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			requested[code] = true
+		}
+	}
+
+	series := []EnvironmentSeries{}
+	for _, p := range parameters {
+		if len(requested) > 0 && !requested[p.Code] {
+			continue
+		}
+		s := EnvironmentSeries{Code: p.Code, Name: p.Name, Unit: p.Unit, AlertMin: p.AlertMin, AlertMax: p.AlertMax, Points: []EnvironmentSeriesPoint{}}
+		for _, reading := range readings {
+			if reading.Suppressed && !c.QueryBool("include_suppressed") {
+				continue
+			}
+			if value, ok := environmentValues(reading)[p.Code]; ok {
+				s.Points = append(s.Points, EnvironmentSeriesPoint{Timestamp: reading.Timestamp, Value: value, Status: reading.RangeStatus[p.Code]})
+			}
+		}
+		if len(s.Points) > 0 || requested[p.Code] {
+			series = append(series, s)
+		}
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Environment series retrieved successfully",
+		Data:    series,
+	})
+}
+
+// ExportBatchEnvironmentData exports the environment readings of a batch with every parameter
+// @Summary Export batch environment data
+// @Description Export the environment readings of a batch, with one column per built-in and custom parameter, as JSON or CSV
+// @Tags batches
+// @Produce json,text/csv
+// @Param batchId path string true "Batch ID"
+// @Param format query string false "Output format (json or csv)" default(json)
+// @Param from query string false "Start time (RFC3339)"
+// @Param to query string false "End time (RFC3339)"
+// @Success 200 {object} SuccessResponse{data=[]models.EnvironmentData}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/environment/export [get]
+func ExportBatchEnvironmentData(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	format := c.Query("format", "json")
+	if format != "json" && format != "csv" {
+		return fiber.NewError(fiber.StatusBadRequest, "Format must be json or csv")
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return err
+	}
+
+	readings, err := loadBatchEnvironmentReadings(batchID, from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment data")
+	}
+
+	if format == "csv" {
+		parameters, err := loadEnvironmentParameters()
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment parameters")
+		}
+
+		// Custom parameters that are no longer in the catalog are still exported
+		codes := []string{}
+		seen := map[string]bool{}
+		for _, p := range parameters {
+			codes = append(codes, p.Code)
+			seen[p.Code] = true
+		}
+		extra := []string{}
+		for _, reading := range readings {
+			for code := range reading.Parameters {
+				if !seen[code] {
+					extra = append(extra, code)
+					seen[code] = true
+				}
+			}
+		}
+		sort.Strings(extra)
+		codes = append(codes, extra...)
+
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write(append([]string{"id", "timestamp", "device_id", "low_confidence", "quality_score", "quality_flags", "suppressed"}, codes...))
+		for _, reading := range readings {
+			values := environmentValues(reading)
+			deviceID := ""
+			if reading.DeviceID != nil {
+				deviceID = strconv.Itoa(*reading.DeviceID)
+			}
+			qualityScore := ""
+			if reading.QualityScore != nil {
+				qualityScore = strconv.FormatFloat(*reading.QualityScore, 'f', -1, 64)
+			}
+			record := []string{strconv.Itoa(reading.ID), reading.Timestamp.Format(time.RFC3339), deviceID, strconv.FormatBool(reading.LowConfidence),
+				qualityScore, strings.Join(reading.QualityFlags, " "), strconv.FormatBool(reading.Suppressed)}
+			for _, code := range codes {
+				if value, ok := values[code]; ok {
+					record = append(record, strconv.FormatFloat(value, 'f', -1, 64))
+				} else {
+					record = append(record, "")
+				}
+			}
+			w.Write(record)
+		}
+		w.Flush()
+
+		c.Set("Content-Type", "text/csv")
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=batch-%d-environment.csv", batchID))
+		return c.Send(buf.Bytes())
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Environment data exported successfully",
+		Data:    readings,
+	})
+}
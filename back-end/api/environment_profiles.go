@@ -0,0 +1,425 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// Positions of a value relative to the optimal range of its parameter
+const (
+	RangeWithin = "within"
+	RangeBelow  = "below"
+	RangeAbove  = "above"
+)
+
+// EnvironmentRange is the optimal range of a parameter; an unset bound is open
+type EnvironmentRange struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// EnvironmentProfile holds the optimal ranges of a species at a stage, e.g. P. vannamei PL5
+// A reading uses the profile of its batch species whose age window contains the reading's age;
+// parameters without a range in the profile keep the optimal range of the catalog
+type EnvironmentProfile struct {
+	ID          int                         `json:"id"`
+	Species     string                      `json:"species"`
+	Stage       string                      `json:"stage"`
+	MinAge      *int                        `json:"min_age,omitempty"` // Days, as recorded in the age of readings
+	MaxAge      *int                        `json:"max_age,omitempty"`
+	Ranges      map[string]EnvironmentRange `json:"ranges"`
+	Description string                      `json:"description,omitempty"`
+	CreatedAt   time.Time                   `json:"created_at"`
+	UpdatedAt   time.Time                   `json:"updated_at"`
+}
+
+// EnvironmentProfileRequest represents a request to add or change a reference profile
+type EnvironmentProfileRequest struct {
+	Species     string                      `json:"species"`
+	Stage       string                      `json:"stage"`
+	MinAge      *int                        `json:"min_age"`
+	MaxAge      *int                        `json:"max_age"`
+	Ranges      map[string]EnvironmentRange `json:"ranges"`
+	Description string                      `json:"description"`
+}
+
+const environmentProfileColumns = `
+	id, species, stage, min_age, max_age, COALESCE(ranges, '{}'), COALESCE(description, ''), created_at, updated_at
+`
+
+// scanEnvironmentProfile reads a profile selected with environmentProfileColumns
+func scanEnvironmentProfile(row rowScanner) (EnvironmentProfile, error) {
+	var p EnvironmentProfile
+	var minAge, maxAge sql.NullInt64
+	var ranges []byte
+	if err := row.Scan(&p.ID, &p.Species, &p.Stage, &minAge, &maxAge, &ranges, &p.Description, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return p, err
+	}
+	p.MinAge = intPtr(minAge)
+	p.MaxAge = intPtr(maxAge)
+	p.Ranges = map[string]EnvironmentRange{}
+	json.Unmarshal(ranges, &p.Ranges)
+	return p, nil
+}
+
+// loadEnvironmentProfiles returns the active reference profiles, optionally of one species
+func loadEnvironmentProfiles(species string) ([]EnvironmentProfile, error) {
+	rows, err := db.DB.Query(`SELECT `+environmentProfileColumns+`
+		FROM environment_profile
+		WHERE is_active = true AND ($1 = '' OR LOWER(species) = LOWER($1))
+		ORDER BY species, min_age NULLS FIRST, id`, strings.TrimSpace(species))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []EnvironmentProfile{}
+	for rows.Next() {
+		p, err := scanEnvironmentProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// matchEnvironmentProfile picks the profile of a species for a reading age
+// When several age windows contain the age the narrowest wins; profiles without a window cover every age
+func matchEnvironmentProfile(profiles []EnvironmentProfile, species string, age int) *EnvironmentProfile {
+	var best *EnvironmentProfile
+	bestWidth := 0
+	for i := range profiles {
+		p := &profiles[i]
+		if !strings.EqualFold(strings.TrimSpace(p.Species), strings.TrimSpace(species)) {
+			continue
+		}
+		if (p.MinAge != nil && age < *p.MinAge) || (p.MaxAge != nil && age > *p.MaxAge) {
+			continue
+		}
+		width := int(^uint(0) >> 1)
+		if p.MinAge != nil && p.MaxAge != nil {
+			width = *p.MaxAge - *p.MinAge
+		}
+		if best == nil || width < bestWidth {
+			best, bestWidth = p, width
+		}
+	}
+	return best
+}
+
+// profileThresholds overlays the ranges of a profile on the optimal ranges of the catalog
+func profileThresholds(catalog map[string]EnvironmentParameter, profile *EnvironmentProfile) map[string]EnvironmentParameter {
+	if profile == nil || len(profile.Ranges) == 0 {
+		return catalog
+	}
+	thresholds := make(map[string]EnvironmentParameter, len(catalog))
+	for code, p := range catalog {
+		if r, ok := profile.Ranges[code]; ok {
+			p.AlertMin, p.AlertMax = r.Min, r.Max
+		}
+		thresholds[code] = p
+	}
+	return thresholds
+}
+
+// rangeStatus places a value relative to the optimal range of a parameter; it is empty without a range
+func rangeStatus(p EnvironmentParameter, value float64) string {
+	switch {
+	case p.AlertMin == nil && p.AlertMax == nil:
+		return ""
+	case p.AlertMin != nil && value < *p.AlertMin:
+		return RangeBelow
+	case p.AlertMax != nil && value > *p.AlertMax:
+		return RangeAbove
+	}
+	return RangeWithin
+}
+
+// annotateEnvironmentRanges sets the range status of every value of a reading and the profile it was
+// judged by, and returns the optimal ranges that apply to the reading
+func annotateEnvironmentRanges(envData *models.EnvironmentData, species string, catalog map[string]EnvironmentParameter, profiles []EnvironmentProfile) map[string]EnvironmentParameter {
+	profile := matchEnvironmentProfile(profiles, species, envData.Age)
+	thresholds := profileThresholds(catalog, profile)
+
+	envData.RangeStatus = map[string]string{}
+	for code, value := range environmentValues(*envData) {
+		if p, ok := thresholds[code]; ok {
+			if status := rangeStatus(p, value); status != "" {
+				envData.RangeStatus[code] = status
+			}
+		}
+	}
+	envData.ReferenceProfileID, envData.ReferenceProfile = nil, ""
+	if profile != nil {
+		id := profile.ID
+		envData.ReferenceProfileID, envData.ReferenceProfile = &id, profile.Stage
+	}
+	return thresholds
+}
+
+// annotateBatchReading annotates a reading with the profiles of its batch species
+func annotateBatchReading(envData *models.EnvironmentData, catalog map[string]EnvironmentParameter) map[string]EnvironmentParameter {
+	var species string
+	if err := db.DB.QueryRow(`SELECT COALESCE(species, '') FROM batch WHERE id = $1`, envData.BatchID).Scan(&species); err != nil {
+		return annotateEnvironmentRanges(envData, "", catalog, nil)
+	}
+	profiles, err := loadEnvironmentProfiles(species)
+	if err != nil {
+		fmt.Printf("Warning: Failed to load environment profiles: %v\n", err)
+	}
+	return annotateEnvironmentRanges(envData, species, catalog, profiles)
+}
+
+// addEnvironmentRangeFields copies the range annotations of a reading into a response entry
+func addEnvironmentRangeFields(entry map[string]interface{}, envData models.EnvironmentData) {
+	entry["range_status"] = envData.RangeStatus
+	if envData.ReferenceProfileID != nil {
+		entry["reference_profile_id"] = *envData.ReferenceProfileID
+		entry["reference_profile"] = envData.ReferenceProfile
+	}
+}
+
+// validateEnvironmentProfile checks a profile request against the parameter catalog
+func validateEnvironmentProfile(req *EnvironmentProfileRequest) error {
+	req.Species = strings.TrimSpace(req.Species)
+	req.Stage = strings.TrimSpace(req.Stage)
+	if req.Species == "" || req.Stage == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Species and stage are required")
+	}
+	if (req.MinAge != nil && *req.MinAge < 0) || (req.MaxAge != nil && *req.MaxAge < 0) {
+		return fiber.NewError(fiber.StatusBadRequest, "Ages must not be negative")
+	}
+	if req.MinAge != nil && req.MaxAge != nil && *req.MinAge > *req.MaxAge {
+		return fiber.NewError(fiber.StatusBadRequest, "Minimum age must not exceed maximum age")
+	}
+	if len(req.Ranges) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one parameter range is required")
+	}
+
+	catalog, err := environmentCatalog()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment parameters")
+	}
+	for code, r := range req.Ranges {
+		if _, ok := catalog[code]; !ok {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Unknown environment parameter: %s", code))
+		}
+		if r.Min == nil && r.Max == nil {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Range of %s needs a minimum or a maximum", code))
+		}
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Minimum of %s must not exceed its maximum", code))
+		}
+	}
+	return nil
+}
+
+// environmentProfileExists reports whether another active profile has the species and stage
+func environmentProfileExists(species, stage string, exceptID int) (bool, error) {
+	var exists bool
+	err := db.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM environment_profile
+			WHERE is_active = true AND LOWER(species) = LOWER($1) AND LOWER(stage) = LOWER($2) AND id <> $3)
+	`, species, stage, exceptID).Scan(&exists)
+	return exists, err
+}
+
+// ListEnvironmentProfiles lists the reference profiles
+// @Summary List environment reference profiles
+// @Description List the optimal environment ranges per species and stage that readings and alerts are judged by
+// @Tags environment
+// @Produce json
+// @Param species query string false "Species"
+// @Success 200 {object} SuccessResponse{data=[]EnvironmentProfile}
+// @Failure 500 {object} ErrorResponse
+// @Router /environment/profiles [get]
+func ListEnvironmentProfiles(c *fiber.Ctx) error {
+	profiles, err := loadEnvironmentProfiles(c.Query("species"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment profiles")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Environment profiles retrieved successfully",
+		Data:    profiles,
+	})
+}
+
+// GetEnvironmentProfile returns a reference profile
+// @Summary Get environment reference profile
+// @Description Get the optimal environment ranges of a species at a stage
+// @Tags environment
+// @Produce json
+// @Param profileId path int true "Profile ID"
+// @Success 200 {object} SuccessResponse{data=EnvironmentProfile}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /environment/profiles/{profileId} [get]
+func GetEnvironmentProfile(c *fiber.Ctx) error {
+	profileID, err := strconv.Atoi(c.Params("profileId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid profile ID format")
+	}
+
+	profile, err := scanEnvironmentProfile(db.DB.QueryRow(`SELECT `+environmentProfileColumns+`
+		FROM environment_profile WHERE id = $1 AND is_active = true`, profileID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Environment profile not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Environment profile retrieved successfully",
+		Data:    profile,
+	})
+}
+
+// CreateEnvironmentProfile adds a reference profile
+// @Summary Create environment reference profile
+// @Description Add the optimal ranges of a species at a stage, e.g. temperature, pH and salinity for P. vannamei PL5. The profile is used for alert thresholds and range status of readings of batches of the species within the age window
+// @Tags environment
+// @Accept json
+// @Produce json
+// @Param request body EnvironmentProfileRequest true "Profile details"
+// @Success 201 {object} SuccessResponse{data=EnvironmentProfile}
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /environment/profiles [post]
+func CreateEnvironmentProfile(c *fiber.Ctx) error {
+	var req EnvironmentProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateEnvironmentProfile(&req); err != nil {
+		return err
+	}
+
+	exists, err := environmentProfileExists(req.Species, req.Stage, 0)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A profile of this species and stage already exists")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	ranges, _ := json.Marshal(req.Ranges)
+	profile, err := scanEnvironmentProfile(db.DB.QueryRow(`
+		INSERT INTO environment_profile (species, stage, min_age, max_age, ranges, description, created_by, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NOW(), NOW(), true)
+		RETURNING `+environmentProfileColumns,
+		req.Species, req.Stage, req.MinAge, req.MaxAge, string(ranges), req.Description, userID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create environment profile")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Environment profile created successfully",
+		Data:    profile,
+	})
+}
+
+// UpdateEnvironmentProfile replaces the stage, age window and ranges of a reference profile
+// @Summary Update environment reference profile
+// @Description Replace the species, stage, age window and optimal ranges of a profile. Alerts already raised keep the ranges they were raised with
+// @Tags environment
+// @Accept json
+// @Produce json
+// @Param profileId path int true "Profile ID"
+// @Param request body EnvironmentProfileRequest true "Profile details"
+// @Success 200 {object} SuccessResponse{data=EnvironmentProfile}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /environment/profiles/{profileId} [put]
+func UpdateEnvironmentProfile(c *fiber.Ctx) error {
+	profileID, err := strconv.Atoi(c.Params("profileId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid profile ID format")
+	}
+
+	var req EnvironmentProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateEnvironmentProfile(&req); err != nil {
+		return err
+	}
+
+	exists, err := environmentProfileExists(req.Species, req.Stage, profileID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A profile of this species and stage already exists")
+	}
+
+	ranges, _ := json.Marshal(req.Ranges)
+	profile, err := scanEnvironmentProfile(db.DB.QueryRow(`
+		UPDATE environment_profile
+		SET species = $2, stage = $3, min_age = $4, max_age = $5, ranges = $6, description = $7, updated_at = NOW()
+		WHERE id = $1 AND is_active = true
+		RETURNING `+environmentProfileColumns,
+		profileID, req.Species, req.Stage, req.MinAge, req.MaxAge, string(ranges), req.Description))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Environment profile not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update environment profile")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Environment profile updated successfully",
+		Data:    profile,
+	})
+}
+
+// DeleteEnvironmentProfile deactivates a reference profile
+// @Summary Delete environment reference profile
+// @Description Deactivate a profile; readings of its species and stage fall back to the optimal ranges of the parameter catalog
+// @Tags environment
+// @Produce json
+// @Param profileId path int true "Profile ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /environment/profiles/{profileId} [delete]
+func DeleteEnvironmentProfile(c *fiber.Ctx) error {
+	profileID, err := strconv.Atoi(c.Params("profileId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid profile ID format")
+	}
+
+	result, err := db.DB.Exec(`UPDATE environment_profile SET is_active = false, updated_at = NOW() WHERE id = $1 AND is_active = true`, profileID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete environment profile")
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Environment profile not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Environment profile deleted successfully",
+	})
+}
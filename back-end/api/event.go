@@ -58,6 +58,7 @@ func GetAllEvents(c *fiber.Ctx) error {
 		SELECT 
 			e.id, e.batch_id, e.event_type, e.location, 
 			e.timestamp, e.updated_at, e.is_active, e.metadata,
+			e.supersedes_event_id, e.superseded_by_event_id,
 			b.species, b.quantity, b.status,
 			h.name AS hatchery_name,
 			c.name AS company_name
@@ -107,6 +108,7 @@ func GetAllEvents(c *fiber.Ctx) error {
 		var species, status, hatcheryName, companyName string
 		var quantity int
 		var metadata sql.NullString
+		var supersedes, supersededBy sql.NullInt64
 		err := rows.Scan(
 			&event.ID,
 			&event.BatchID,
@@ -116,6 +118,8 @@ func GetAllEvents(c *fiber.Ctx) error {
 			&event.UpdatedAt,
 			&event.IsActive,
 			&metadata,
+			&supersedes,
+			&supersededBy,
 			&species,
 			&quantity,
 			&status,
@@ -152,6 +156,7 @@ func GetAllEvents(c *fiber.Ctx) error {
 				"company_name":  companyName,
 			},
 		}
+		addCorrectionMarkers(eventEntry, supersedes, supersededBy)
 
 		eventList = append(eventList, eventEntry)
 	}
@@ -191,6 +196,7 @@ func GetEventByID(c *fiber.Ctx) error {
 		SELECT 
 			e.id, e.batch_id, e.event_type, e.location, 
 			e.timestamp, e.updated_at, e.is_active, e.metadata,
+			e.supersedes_event_id, e.superseded_by_event_id,
 			b.species, b.quantity, b.status,
 			h.name AS hatchery_name,
 			c.name AS company_name, c.location AS company_location,
@@ -208,6 +214,7 @@ func GetEventByID(c *fiber.Ctx) error {
 	var species, status, hatcheryName, companyName, companyLocation string
 	var quantity int
 	var metadata, blockchainTxID, blockchainMetadata sql.NullString
+	var supersedes, supersededBy sql.NullInt64
 	err = db.DB.QueryRow(query, eventID).Scan(
 		&event.ID,
 		&event.BatchID,
@@ -217,6 +224,8 @@ func GetEventByID(c *fiber.Ctx) error {
 		&event.UpdatedAt,
 		&event.IsActive,
 		&metadata,
+		&supersedes,
+		&supersededBy,
 		&species,
 		&quantity,
 		&status,
@@ -260,6 +269,7 @@ func GetEventByID(c *fiber.Ctx) error {
 			"company_location": companyLocation,
 		},
 	}
+	addCorrectionMarkers(response, supersedes, supersededBy)
 
 	// Add blockchain verification if available
 	if blockchainTxID.Valid {
@@ -288,6 +298,8 @@ func GetEventByID(c *fiber.Ctx) error {
 // @Success 200 {object} SuccessResponse{data=models.Event}
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Event was corrected"
+// @Failure 422 {object} ErrorResponse "Metadata does not match the event type schema"
 // @Failure 500 {object} ErrorResponse
 // @Router /events/{id} [put]
 func UpdateEvent(c *fiber.Ctx) error {
@@ -307,6 +319,9 @@ func UpdateEvent(c *fiber.Ctx) error {
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
 	}
+	if err := validateEventMetadata(req.EventType, req.Metadata); err != nil {
+		return err
+	}
 
 	// Check if event exists
 	var exists bool
@@ -319,6 +334,25 @@ func UpdateEvent(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusNotFound, "Event not found")
 	}
 
+	// A corrected event is part of the correction history and cannot change anymore
+	var corrected bool
+	err = db.DB.QueryRow("SELECT superseded_by_event_id IS NOT NULL FROM event WHERE id = $1", eventID).Scan(&corrected)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if corrected {
+		return fiber.NewError(fiber.StatusConflict, "Event was corrected; record changes as a correction of its latest version")
+	}
+	if req.EventType == stageEventType {
+		var timestamp time.Time
+		if err := db.DB.QueryRow("SELECT timestamp FROM event WHERE id = $1", eventID).Scan(&timestamp); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if err := validateStageProgression(batchID, req.Metadata, timestamp, eventID); err != nil {
+			return err
+		}
+	}
+
 	// Initialize blockchain client
 	blockchainClient := blockchain.NewBlockchainClient(
 		os.Getenv("BLOCKCHAIN_NODE_URL"),
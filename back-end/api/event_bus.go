@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/eventbus"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// publishDomainEvent publishes a domain event on the event bus; failures are logged and do not fail the request
+func publishDomainEvent(eventType string, companyID, batchID int, data map[string]interface{}) {
+	if err := eventbus.Publish(eventType, companyID, batchID, data); err != nil {
+		fmt.Printf("Warning: Failed to publish %s event: %v\n", eventType, err)
+	}
+}
+
+// publishBatchStatusChanged publishes a batch status change; oldStatus is empty when it is not known
+func publishBatchStatusChanged(batchID int, oldStatus, newStatus, cause string) {
+	data := map[string]interface{}{
+		"new_status": newStatus,
+		"cause":      cause,
+	}
+	if oldStatus != "" {
+		data["old_status"] = oldStatus
+	}
+	publishDomainEvent(eventbus.StatusChanged, 0, batchID, data)
+}
+
+// publishShipmentCustody publishes the status changes of the batches of a shipment, and their completed transfers
+func publishShipmentCustody(shipment models.Shipment, transferStatus, batchStatus string) {
+	done := map[int]bool{}
+	for _, item := range shipment.Items {
+		if done[item.BatchID] {
+			continue
+		}
+		done[item.BatchID] = true
+
+		publishBatchStatusChanged(item.BatchID, "", batchStatus, "shipment_"+transferStatus)
+		if transferStatus == "completed" && item.TransferID != 0 {
+			publishDomainEvent(eventbus.TransferCompleted, 0, item.BatchID, map[string]interface{}{
+				"transfer_id":   item.TransferID,
+				"shipment_id":   shipment.ID,
+				"shipment_code": shipment.ShipmentCode,
+				"sender_id":     shipment.SenderID,
+				"receiver_id":   shipment.ReceiverID,
+			})
+		}
+	}
+}
+
+// GetEventBusStatus reports the state of the domain event bus
+// @Summary Get event bus status
+// @Description Report the configured broker and the number of domain events pending, failed and published.
+// @Description Events are published to {prefix}.batch.created, {prefix}.batch.status_changed, {prefix}.document.uploaded, {prefix}.transfer.completed and {prefix}.batch.ownership_transferred
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=eventbus.Stats}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/event-bus [get]
+func GetEventBusStatus(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	stats, err := eventbus.Default().GetStats()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve event bus status")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Event bus status retrieved successfully",
+		Data:    stats,
+	})
+}
+
+// RetryFailedDomainEvents queues failed domain events for publishing again
+// @Summary Retry failed domain events
+// @Description Queue domain events that exhausted their attempts for another round, for example after a broker outage
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/event-bus/retry [post]
+func RetryFailedDomainEvents(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	count, err := eventbus.Default().RetryFailed()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to queue domain events")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d domain events queued for publishing", count),
+		Data:    fiber.Map{"queued": count},
+	})
+}
@@ -0,0 +1,364 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/chainsync"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// EventCorrectionRequest represents a request to correct an event
+type EventCorrectionRequest struct {
+	Location string                 `json:"location"` // Defaults to the location of the corrected event
+	Metadata map[string]interface{} `json:"metadata"` // Replaces the metadata; defaults to the metadata of the corrected event
+	Reason   string                 `json:"reason"`
+}
+
+// EventVersion is one version of an event in its correction history
+type EventVersion struct {
+	models.Event
+	TxID string `json:"tx_id,omitempty"` // On-chain anchor of the version
+}
+
+// CreateEventCorrection corrects an event with a superseding event
+// @Summary Correct event
+// @Description Record a correction of an event as a new event that supersedes it. The corrected event is kept and marked as corrected,
+// @Description both versions are anchored on-chain and trace responses show the latest version with its correction history
+// @Tags events
+// @Accept json
+// @Produce json
+// @Param id path string true "Event ID"
+// @Param request body EventCorrectionRequest true "Correction"
+// @Success 201 {object} SuccessResponse{data=models.Event}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Event was already corrected"
+// @Failure 422 {object} ErrorResponse "Metadata does not match the event type schema"
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /events/{id}/corrections [post]
+func CreateEventCorrection(c *fiber.Ctx) error {
+	eventID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid event ID format")
+	}
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req EventCorrectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Reason is required")
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer tx.Rollback()
+
+	var original models.Event
+	var supersededBy sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT id, batch_id, COALESCE(event_type, ''), COALESCE(actor_id, 0), COALESCE(location, ''),
+			COALESCE(timestamp, updated_at), metadata, superseded_by_event_id
+		FROM event
+		WHERE id = $1 AND is_active = true
+		FOR UPDATE
+	`, eventID).Scan(&original.ID, &original.BatchID, &original.EventType, &original.ActorID, &original.Location,
+		&original.Timestamp, &original.Metadata, &supersededBy)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Event not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve event")
+	}
+	if supersededBy.Valid {
+		return fiber.NewError(fiber.StatusConflict,
+			fmt.Sprintf("Event was already corrected by event %d; correct the latest version instead", supersededBy.Int64))
+	}
+
+	correction := models.Event{
+		BatchID:           original.BatchID,
+		EventType:         original.EventType,
+		ActorID:           userID,
+		Location:          original.Location,
+		Timestamp:         original.Timestamp, // The correction describes the same occurrence
+		Metadata:          original.Metadata,
+		IsActive:          true,
+		SupersedesEventID: &original.ID,
+		CorrectionReason:  req.Reason,
+	}
+	if strings.TrimSpace(req.Location) != "" {
+		correction.Location = strings.TrimSpace(req.Location)
+	}
+	var originalMetadata map[string]interface{}
+	if len(original.Metadata) > 0 {
+		if err := json.Unmarshal(original.Metadata, &originalMetadata); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to read event metadata")
+		}
+	}
+	metadata := req.Metadata
+	if metadata == nil {
+		metadata = originalMetadata
+	} else {
+		encoded, err := json.Marshal(metadata)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid metadata")
+		}
+		correction.Metadata = encoded
+	}
+	if err := validateEventMetadata(correction.EventType, metadata); err != nil {
+		return err
+	}
+	if correction.EventType == stageEventType {
+		if err := validateStageProgression(correction.BatchID, metadata, correction.Timestamp, original.ID); err != nil {
+			return err
+		}
+	}
+
+	var correctedAt time.Time
+	err = tx.QueryRow(`
+		INSERT INTO event (batch_id, event_type, actor_id, location, timestamp, metadata,
+			supersedes_event_id, correction_reason, corrected_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW(), true)
+		RETURNING id, corrected_at, updated_at
+	`, correction.BatchID, correction.EventType, correction.ActorID, correction.Location, correction.Timestamp,
+		correction.Metadata, original.ID, correction.CorrectionReason).Scan(&correction.ID, &correctedAt, &correction.UpdatedAt)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save correction")
+	}
+	correction.CorrectedAt = &correctedAt
+
+	if _, err := tx.Exec(`
+		UPDATE event SET superseded_by_event_id = $2, updated_at = NOW() WHERE id = $1
+	`, original.ID, correction.ID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to mark event as corrected")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save correction")
+	}
+
+	// Anchor the correction, and the original if its anchor is missing, so both versions can be verified
+	blockchainClient := blockchain.NewBlockchainClient(
+		os.Getenv("BLOCKCHAIN_NODE_URL"),
+		os.Getenv("BLOCKCHAIN_PRIVATE_KEY"),
+		os.Getenv("BLOCKCHAIN_ACCOUNT"),
+		os.Getenv("BLOCKCHAIN_CHAIN_ID"),
+		os.Getenv("BLOCKCHAIN_CONSENSUS"),
+	)
+	var anchored bool
+	if err := db.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM blockchain_record WHERE related_table = 'event' AND related_id = $1 AND is_active = true)
+	`, original.ID).Scan(&anchored); err == nil && !anchored {
+		anchorEventVersion(blockchainClient, original, originalMetadata)
+	}
+	correctionMetadata := map[string]interface{}{}
+	for k, v := range metadata {
+		correctionMetadata[k] = v
+	}
+	correctionMetadata["supersedes_event_id"] = original.ID
+	correctionMetadata["correction_reason"] = correction.CorrectionReason
+	anchorEventVersion(blockchainClient, correction, correctionMetadata)
+
+	// Push the correction to chains the batch was shared with
+	chainsync.NotifyBatch(correction.BatchID)
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Event corrected successfully",
+		Data:    correction,
+	})
+}
+
+// anchorEventVersion records an event on-chain and saves its blockchain record
+// Failures are logged; the event stays valid without its anchor
+func anchorEventVersion(blockchainClient *blockchain.BlockchainClient, event models.Event, metadata map[string]interface{}) {
+	txID, err := blockchainClient.RecordEvent(
+		strconv.Itoa(event.BatchID),
+		event.EventType,
+		event.Location,
+		strconv.Itoa(event.ActorID),
+		metadata,
+	)
+	if err != nil {
+		fmt.Printf("Warning: Failed to record event %d on blockchain: %v\n", event.ID, err)
+		notifyAnchoringFailed(0, "event", event.ID, event.BatchID, err.Error())
+		return
+	}
+
+	metadataHash, err := blockchainClient.HashData(map[string]interface{}{
+		"event_id":   event.ID,
+		"batch_id":   event.BatchID,
+		"event_type": event.EventType,
+		"location":   event.Location,
+		"actor_id":   event.ActorID,
+		"metadata":   metadata,
+		"timestamp":  event.Timestamp,
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to generate metadata hash: %v\n", err)
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO blockchain_record (related_table, related_id, tx_id, metadata_hash, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NOW(), NOW(), true)
+	`, "event", event.ID, txID, metadataHash)
+	if err != nil {
+		fmt.Printf("Warning: Failed to save blockchain record: %v\n", err)
+	}
+}
+
+// GetEventCorrections lists every version of an event
+// @Summary Get event correction history
+// @Description List every version of an event, from the original to the latest correction, with the reason and on-chain anchor of each
+// @Tags events
+// @Produce json
+// @Param id path string true "Event ID (any version)"
+// @Success 200 {object} SuccessResponse{data=[]EventVersion}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /events/{id}/corrections [get]
+func GetEventCorrections(c *fiber.Ctx) error {
+	eventID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid event ID format")
+	}
+
+	rows, err := db.DB.Query(`
+		WITH RECURSIVE earlier AS (
+			SELECT id, supersedes_event_id FROM event WHERE id = $1 AND is_active = true
+			UNION ALL
+			SELECT e.id, e.supersedes_event_id FROM event e JOIN earlier ON e.id = earlier.supersedes_event_id
+		), versions AS (
+			SELECT id FROM earlier WHERE supersedes_event_id IS NULL
+			UNION ALL
+			SELECT e.id FROM event e JOIN versions ON e.supersedes_event_id = versions.id
+		)
+		SELECT e.id, e.batch_id, COALESCE(e.event_type, ''), COALESCE(e.actor_id, 0), COALESCE(e.location, ''),
+			COALESCE(e.timestamp, e.updated_at), e.metadata, e.updated_at, e.is_active,
+			e.supersedes_event_id, e.superseded_by_event_id, COALESCE(e.correction_reason, ''), e.corrected_at,
+			COALESCE((SELECT tx_id FROM blockchain_record br
+				WHERE br.related_table = 'event' AND br.related_id = e.id AND br.is_active = true
+				ORDER BY br.created_at DESC LIMIT 1), '')
+		FROM event e
+		WHERE e.id IN (SELECT id FROM versions)
+		ORDER BY e.id
+	`, eventID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve event versions")
+	}
+	defer rows.Close()
+
+	versions := []EventVersion{}
+	for rows.Next() {
+		var v EventVersion
+		var supersedes, supersededBy sql.NullInt64
+		var correctedAt sql.NullTime
+		if err := rows.Scan(&v.ID, &v.BatchID, &v.EventType, &v.ActorID, &v.Location, &v.Timestamp, &v.Metadata,
+			&v.UpdatedAt, &v.IsActive, &supersedes, &supersededBy, &v.CorrectionReason, &correctedAt, &v.TxID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse event version")
+		}
+		v.SupersedesEventID = intPtr(supersedes)
+		v.SupersededByEventID = intPtr(supersededBy)
+		v.Corrected = supersededBy.Valid
+		v.CorrectedAt = timePtr(correctedAt)
+		versions = append(versions, v)
+	}
+	if len(versions) == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Event not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Event versions retrieved successfully",
+		Data:    versions,
+	})
+}
+
+// addCorrectionMarkers adds the correction links of an event to its response
+func addCorrectionMarkers(entry map[string]interface{}, supersedes, supersededBy sql.NullInt64) {
+	entry["corrected"] = supersededBy.Valid
+	if supersededBy.Valid {
+		entry["superseded_by_event_id"] = supersededBy.Int64
+	}
+	if supersedes.Valid {
+		entry["supersedes_event_id"] = supersedes.Int64
+	}
+}
+
+// loadEventCorrections loads the earlier versions of the corrected events of a batch
+// The result is keyed by the latest version, with earlier versions newest first
+func loadEventCorrections(batchID int) (map[int][]models.EventCorrection, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, COALESCE(location, ''), metadata, COALESCE(actor_id, 0), supersedes_event_id, superseded_by_event_id,
+			COALESCE(correction_reason, ''), COALESCE(corrected_at, updated_at)
+		FROM event
+		WHERE batch_id = $1 AND is_active = true
+			AND (supersedes_event_id IS NOT NULL OR superseded_by_event_id IS NOT NULL)
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type version struct {
+		id, actorID              int
+		location, reason         string
+		metadata                 models.JSONB
+		supersedes, supersededBy sql.NullInt64
+		correctedAt              time.Time
+	}
+	byID := map[int]*version{}
+	for rows.Next() {
+		v := &version{}
+		if err := rows.Scan(&v.id, &v.location, &v.metadata, &v.actorID, &v.supersedes, &v.supersededBy,
+			&v.reason, &v.correctedAt); err != nil {
+			return nil, err
+		}
+		byID[v.id] = v
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	corrections := map[int][]models.EventCorrection{}
+	for _, latest := range byID {
+		if latest.supersededBy.Valid || !latest.supersedes.Valid {
+			continue
+		}
+		current := latest
+		for i := 0; i < len(byID) && current.supersedes.Valid; i++ {
+			earlier, ok := byID[int(current.supersedes.Int64)]
+			if !ok {
+				break
+			}
+			corrections[latest.id] = append(corrections[latest.id], models.EventCorrection{
+				EventID:            earlier.id,
+				Location:           earlier.location,
+				Metadata:           earlier.metadata,
+				CorrectedByEventID: current.id,
+				CorrectionReason:   current.reason,
+				CorrectedBy:        current.actorID,
+				CorrectedAt:        current.correctedAt,
+			})
+			current = earlier
+		}
+	}
+	return corrections, nil
+}
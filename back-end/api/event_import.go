@@ -0,0 +1,673 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/chainsync"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+	"github.com/LTPPPP/TracePost-larvaeChain/stages"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+)
+
+// Statuses of an event import
+const (
+	EventImportValidated = "validated" // dry run, nothing was imported
+	EventImportRejected  = "rejected"  // rows failed validation, nothing was imported
+	EventImportQueued    = "queued"    // waiting for background processing
+	EventImportRunning   = "running"
+	EventImportCompleted = "completed"
+	EventImportFailed    = "failed"
+)
+
+// maxStoredImportErrors bounds the row errors kept with an import; ErrorCount has the full count
+const maxStoredImportErrors = 1000
+
+// EventImportMapping maps the columns of an import file to event fields
+// Column names are matched case-insensitively against the header row
+type EventImportMapping struct {
+	BatchID   string            `json:"batch_id"`   // Default "batch_id"
+	EventType string            `json:"event_type"` // Default "event_type"
+	Timestamp string            `json:"timestamp"`  // Default "timestamp"; without the column events get the import time
+	Location  string            `json:"location"`   // Default "location"
+	ActorID   string            `json:"actor_id"`   // Default "actor_id"; without the column the importing user is the actor
+	Metadata  map[string]string `json:"metadata"`   // Metadata field to column; by default every unmapped column
+}
+
+// EventImportRowError is a validation error of one row
+type EventImportRowError struct {
+	Row     int    `json:"row"` // Row number in the file, the header is row 1
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// EventImportJob is the report of an event import
+type EventImportJob struct {
+	ID            int                   `json:"id"`
+	FileName      string                `json:"file_name"`
+	Format        string                `json:"format"`
+	Status        string                `json:"status"`
+	DryRun        bool                  `json:"dry_run"`
+	SkipInvalid   bool                  `json:"skip_invalid"`
+	Mapping       EventImportMapping    `json:"mapping"`
+	TotalRows     int                   `json:"total_rows"`
+	ValidRows     int                   `json:"valid_rows"`
+	ImportedRows  int                   `json:"imported_rows"`
+	ErrorCount    int                   `json:"error_count"`
+	Errors        []EventImportRowError `json:"errors"`
+	FailureReason string                `json:"failure_reason,omitempty"`
+	CreatedBy     *int                  `json:"created_by,omitempty"`
+	CreatedAt     time.Time             `json:"created_at"`
+	StartedAt     *time.Time            `json:"started_at,omitempty"`
+	FinishedAt    *time.Time            `json:"finished_at,omitempty"`
+}
+
+// importedEvent is a validated row
+type importedEvent struct {
+	Row       int
+	BatchID   int
+	EventType string
+	ActorID   int
+	Location  string
+	Timestamp time.Time
+	Metadata  map[string]interface{}
+}
+
+// eventImportColumns are the resolved column positions of a mapping; -1 when the file has no such column
+type eventImportColumns struct {
+	batchID, eventType, timestamp, location, actorID int
+	metadata                                         map[string]int
+}
+
+const eventImportJobColumns = `
+	id, COALESCE(file_name, ''), file_format, status, dry_run, skip_invalid, column_mapping,
+	total_rows, valid_rows, imported_rows, error_count, errors, COALESCE(failure_reason, ''),
+	created_by, created_at, started_at, finished_at
+`
+
+// scanEventImportJob reads a row selected with eventImportJobColumns
+func scanEventImportJob(row rowScanner) (EventImportJob, error) {
+	var job EventImportJob
+	var mapping, errs []byte
+	var createdBy sql.NullInt64
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.FileName, &job.Format, &job.Status, &job.DryRun, &job.SkipInvalid, &mapping,
+		&job.TotalRows, &job.ValidRows, &job.ImportedRows, &job.ErrorCount, &errs, &job.FailureReason,
+		&createdBy, &job.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return job, err
+	}
+	json.Unmarshal(mapping, &job.Mapping)
+	job.Errors = []EventImportRowError{}
+	json.Unmarshal(errs, &job.Errors)
+	job.CreatedBy = intPtr(createdBy)
+	job.StartedAt = timePtr(startedAt)
+	job.FinishedAt = timePtr(finishedAt)
+	return job, nil
+}
+
+// readEventImportFile reads the rows of an uploaded CSV or XLSX file
+func readEventImportFile(format string, data []byte) ([][]string, error) {
+	if format == "xlsx" {
+		return utils.ReadXLSXRows(data)
+	}
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("file is not valid CSV: %v", err)
+	}
+	return records, nil
+}
+
+// resolveEventImportColumns finds the mapped columns in the header row
+func resolveEventImportColumns(header []string, mapping *EventImportMapping) (eventImportColumns, error) {
+	positions := map[string]int{}
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, seen := positions[key]; !seen && key != "" {
+			positions[key] = i
+		}
+	}
+
+	used := map[int]bool{}
+	find := func(column *string, defaultName string, required bool) (int, error) {
+		explicit := *column != ""
+		if !explicit {
+			*column = defaultName
+		}
+		position, ok := positions[strings.ToLower(strings.TrimSpace(*column))]
+		if !ok {
+			if required || explicit {
+				return -1, fmt.Errorf("column %q is not in the file", *column)
+			}
+			*column = ""
+			return -1, nil
+		}
+		used[position] = true
+		return position, nil
+	}
+
+	var cols eventImportColumns
+	var err error
+	if cols.batchID, err = find(&mapping.BatchID, "batch_id", true); err != nil {
+		return cols, err
+	}
+	if cols.eventType, err = find(&mapping.EventType, "event_type", true); err != nil {
+		return cols, err
+	}
+	if cols.location, err = find(&mapping.Location, "location", true); err != nil {
+		return cols, err
+	}
+	if cols.timestamp, err = find(&mapping.Timestamp, "timestamp", false); err != nil {
+		return cols, err
+	}
+	if cols.actorID, err = find(&mapping.ActorID, "actor_id", false); err != nil {
+		return cols, err
+	}
+
+	cols.metadata = map[string]int{}
+	if mapping.Metadata == nil {
+		mapping.Metadata = map[string]string{}
+		for i, name := range header {
+			name = strings.TrimSpace(name)
+			if !used[i] && name != "" {
+				mapping.Metadata[name] = name
+				cols.metadata[name] = i
+			}
+		}
+		return cols, nil
+	}
+	for field, column := range mapping.Metadata {
+		position, ok := positions[strings.ToLower(strings.TrimSpace(column))]
+		if !ok {
+			return cols, fmt.Errorf("column %q mapped to metadata field %q is not in the file", column, field)
+		}
+		cols.metadata[field] = position
+	}
+	return cols, nil
+}
+
+// parseImportTimestamp reads the timestamp formats accepted in import files
+func parseImportTimestamp(value, format string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	if format == "xlsx" {
+		if t, err := utils.ParseExcelSerialDate(value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("timestamp %q is not a date (use RFC 3339 or YYYY-MM-DD HH:MM:SS)", value)
+}
+
+// importMetadataValue converts a cell to the type the event type schema expects for the field
+func importMetadataValue(schema *utils.JSONSchema, field, value string) (interface{}, error) {
+	if schema == nil || schema.Properties[field] == nil {
+		return value, nil
+	}
+	switch schema.Properties[field].Type {
+	case "number", "integer":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number", field)
+		}
+		return number, nil
+	case "boolean":
+		b, err := strconv.ParseBool(strings.ToLower(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false", field)
+		}
+		return b, nil
+	case "object", "array":
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return nil, fmt.Errorf("%s must be JSON", field)
+		}
+		return v, nil
+	}
+	return value, nil
+}
+
+// eventImportValidator checks rows, caching lookups shared by rows
+type eventImportValidator struct {
+	format  string
+	userID  int
+	batches map[int]bool
+	actors  map[int]bool
+	schemas map[string]*utils.JSONSchema
+	stages  map[int][]stages.Observation // Stages of each batch, with those of the rows validated so far
+}
+
+// validate converts a row to an event or lists its problems
+func (v *eventImportValidator) validate(rowNumber int, row []string, cols eventImportColumns, mapping EventImportMapping) (importedEvent, []EventImportRowError) {
+	cell := func(position int) string {
+		if position < 0 || position >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[position])
+	}
+	event := importedEvent{Row: rowNumber, ActorID: v.userID, Timestamp: time.Now().UTC(), Metadata: map[string]interface{}{}}
+	var problems []EventImportRowError
+	fail := func(column, message string) {
+		problems = append(problems, EventImportRowError{Row: rowNumber, Column: column, Message: message})
+	}
+
+	batchID, err := strconv.Atoi(cell(cols.batchID))
+	if err != nil || batchID <= 0 {
+		fail(mapping.BatchID, "batch ID must be a number")
+	} else {
+		exists, checked := v.batches[batchID]
+		if !checked {
+			if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = $1 AND is_active = true)", batchID).Scan(&exists); err != nil {
+				return event, []EventImportRowError{{Row: rowNumber, Message: "database error"}}
+			}
+			v.batches[batchID] = exists
+		}
+		if !exists {
+			fail(mapping.BatchID, fmt.Sprintf("batch %d not found", batchID))
+		}
+		event.BatchID = batchID
+	}
+
+	event.EventType = cell(cols.eventType)
+	if event.EventType == "" {
+		fail(mapping.EventType, "event type is required")
+	}
+	event.Location = cell(cols.location)
+	if event.Location == "" {
+		fail(mapping.Location, "location is required")
+	}
+
+	if cols.timestamp >= 0 {
+		value := cell(cols.timestamp)
+		if value == "" {
+			fail(mapping.Timestamp, "timestamp is required")
+		} else if t, err := parseImportTimestamp(value, v.format); err != nil {
+			fail(mapping.Timestamp, err.Error())
+		} else if t.After(time.Now().Add(5 * time.Minute)) {
+			fail(mapping.Timestamp, "timestamp must not be in the future")
+		} else {
+			event.Timestamp = t
+		}
+	}
+
+	if value := cell(cols.actorID); value != "" {
+		actorID, err := strconv.Atoi(value)
+		if err != nil {
+			fail(mapping.ActorID, "actor ID must be a number")
+		} else {
+			exists, checked := v.actors[actorID]
+			if !checked {
+				if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM account WHERE id = $1 AND is_active = true)", actorID).Scan(&exists); err != nil {
+					return event, []EventImportRowError{{Row: rowNumber, Message: "database error"}}
+				}
+				v.actors[actorID] = exists
+			}
+			if !exists {
+				fail(mapping.ActorID, fmt.Sprintf("actor %d not found", actorID))
+			}
+			event.ActorID = actorID
+		}
+	}
+
+	if event.EventType == "" {
+		return event, problems
+	}
+	schema, checked := v.schemas[event.EventType]
+	if !checked {
+		if schema, err = loadEventTypeSchema(event.EventType); err != nil {
+			return event, []EventImportRowError{{Row: rowNumber, Message: "failed to load event type schema"}}
+		}
+		v.schemas[event.EventType] = schema
+	}
+	for field, position := range cols.metadata {
+		value := cell(position)
+		if value == "" {
+			continue
+		}
+		converted, err := importMetadataValue(schema, field, value)
+		if err != nil {
+			fail(mapping.Metadata[field], err.Error())
+			continue
+		}
+		event.Metadata[field] = converted
+	}
+	schemaProblems, err := eventMetadataProblems(schema, event.Metadata)
+	if err != nil {
+		fail("", "invalid metadata")
+	}
+	for _, problem := range schemaProblems {
+		fail("", problem)
+	}
+	if event.EventType == stageEventType && len(problems) == 0 {
+		if err := v.checkImportedStage(event); err != nil {
+			fail(mapping.Metadata["stage"], err.Error())
+		}
+	}
+	return event, problems
+}
+
+// ImportEvents imports events from a CSV or XLSX file
+// @Summary Import events
+// @Description Import events from a CSV or XLSX file (first worksheet) whose first row names the columns. Every row is validated, including its metadata against the event type schema,
+// @Description and errors are reported per row. Nothing is imported when a row fails, unless skip_invalid is set. Large files are imported in the background; poll the returned import
+// @Tags events
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "CSV or XLSX file"
+// @Param mapping formData string false "Column mapping as JSON, e.g. {\"batch_id\":\"Batch\",\"event_type\":\"Type\",\"metadata\":{\"to_location\":\"Destination\"}}"
+// @Param dry_run formData bool false "Validate without importing"
+// @Param skip_invalid formData bool false "Import the valid rows when some rows fail"
+// @Success 200 {object} SuccessResponse{data=EventImportJob} "Dry run report"
+// @Success 201 {object} SuccessResponse{data=EventImportJob} "Events imported"
+// @Success 202 {object} SuccessResponse{data=EventImportJob} "Import queued"
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} SuccessResponse{data=EventImportJob} "Rows failed validation"
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /events/import [post]
+func ImportEvents(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "File is required")
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), ".")
+	if format != "csv" && format != "xlsx" {
+		return fiber.NewError(fiber.StatusBadRequest, "File must be a .csv or .xlsx file")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Failed to read file")
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Failed to read file")
+	}
+
+	var mapping EventImportMapping
+	if raw := strings.TrimSpace(c.FormValue("mapping")); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Mapping must be a JSON object")
+		}
+	}
+	dryRun, _ := strconv.ParseBool(c.FormValue("dry_run", "false"))
+	skipInvalid, _ := strconv.ParseBool(c.FormValue("skip_invalid", "false"))
+
+	records, err := readEventImportFile(format, data)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if len(records) < 2 {
+		return fiber.NewError(fiber.StatusBadRequest, "File needs a header row and at least one data row")
+	}
+	cols, err := resolveEventImportColumns(records[0], &mapping)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	cfg := config.GetConfig()
+	job := EventImportJob{
+		FileName:    fileHeader.Filename,
+		Format:      format,
+		DryRun:      dryRun,
+		SkipInvalid: skipInvalid,
+		Mapping:     mapping,
+		Errors:      []EventImportRowError{},
+	}
+	validator := &eventImportValidator{
+		format:  format,
+		userID:  userID,
+		batches: map[int]bool{},
+		actors:  map[int]bool{},
+		schemas: map[string]*utils.JSONSchema{},
+		stages:  map[int][]stages.Observation{},
+	}
+	var events []importedEvent
+	for i, row := range records[1:] {
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		job.TotalRows++
+		if job.TotalRows > cfg.EventImportMaxRows {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("File has more than %d rows; split it into smaller files", cfg.EventImportMaxRows))
+		}
+		event, problems := validator.validate(i+2, row, cols, mapping)
+		if len(problems) > 0 {
+			job.ErrorCount += len(problems)
+			for _, p := range problems {
+				if len(job.Errors) < maxStoredImportErrors {
+					job.Errors = append(job.Errors, p)
+				}
+			}
+			continue
+		}
+		events = append(events, event)
+	}
+	job.ValidRows = len(events)
+
+	switch {
+	case dryRun:
+		job.Status = EventImportValidated
+	case job.ErrorCount > 0 && !skipInvalid:
+		job.Status = EventImportRejected
+	case len(events) > cfg.EventImportSyncRows:
+		job.Status = EventImportQueued
+	default:
+		job.Status = EventImportRunning
+	}
+	mappingJSON, _ := json.Marshal(job.Mapping)
+	errorsJSON, _ := json.Marshal(job.Errors)
+	err = db.DB.QueryRow(`
+		INSERT INTO event_import_job (file_name, file_format, status, dry_run, skip_invalid, column_mapping,
+			total_rows, valid_rows, error_count, errors, created_by, created_at, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, 0), NOW(),
+			CASE WHEN $3 = 'running' THEN NOW() END,
+			CASE WHEN $3 IN ('validated', 'rejected') THEN NOW() END)
+		RETURNING id, created_at
+	`, job.FileName, job.Format, job.Status, job.DryRun, job.SkipInvalid, string(mappingJSON),
+		job.TotalRows, job.ValidRows, job.ErrorCount, string(errorsJSON), userID).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record import")
+	}
+	if userID != 0 {
+		job.CreatedBy = &userID
+	}
+
+	switch job.Status {
+	case EventImportValidated:
+		return c.JSON(SuccessResponse{
+			Success: true,
+			Message: fmt.Sprintf("Dry run: %d of %d rows are valid", job.ValidRows, job.TotalRows),
+			Data:    job,
+		})
+	case EventImportRejected:
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(SuccessResponse{
+			Success: false,
+			Message: fmt.Sprintf("No events were imported: %d validation errors", job.ErrorCount),
+			Data:    job,
+		})
+	case EventImportQueued:
+		go func() {
+			imported, err := runEventImport(job.ID, events)
+			if err != nil {
+				fmt.Printf("Warning: event import %d failed: %v\n", job.ID, err)
+				return
+			}
+			anchorImportedEvents(imported)
+		}()
+		return c.Status(fiber.StatusAccepted).JSON(SuccessResponse{
+			Success: true,
+			Message: fmt.Sprintf("Importing %d events in the background", job.ValidRows),
+			Data:    job,
+		})
+	}
+
+	imported, err := runEventImport(job.ID, events)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to import events: "+err.Error())
+	}
+	go anchorImportedEvents(imported)
+
+	job, err = scanEventImportJob(db.DB.QueryRow("SELECT "+eventImportJobColumns+" FROM event_import_job WHERE id = $1", job.ID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load import")
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d events imported successfully", job.ImportedRows),
+		Data:    job,
+	})
+}
+
+// runEventImport inserts the validated events of an import in one transaction
+func runEventImport(jobID int, events []importedEvent) ([]models.Event, error) {
+	fail := func(err error) ([]models.Event, error) {
+		db.DB.Exec(`
+			UPDATE event_import_job SET status = $2, failure_reason = $3, finished_at = NOW() WHERE id = $1
+		`, jobID, EventImportFailed, err.Error())
+		return nil, err
+	}
+
+	if _, err := db.DB.Exec(`
+		UPDATE event_import_job SET status = $2, started_at = COALESCE(started_at, NOW()) WHERE id = $1
+	`, jobID, EventImportRunning); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	imported := make([]models.Event, 0, len(events))
+	for _, e := range events {
+		metadata, err := json.Marshal(e.Metadata)
+		if err != nil {
+			return fail(fmt.Errorf("row %d: %v", e.Row, err))
+		}
+		event := models.Event{
+			BatchID:   e.BatchID,
+			EventType: e.EventType,
+			ActorID:   e.ActorID,
+			Location:  e.Location,
+			Timestamp: e.Timestamp,
+			Metadata:  metadata,
+			IsActive:  true,
+		}
+		err = tx.QueryRow(`
+			INSERT INTO event (batch_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active)
+			VALUES ($1, $2, $3, $4, $5, $6, NOW(), true)
+			RETURNING id, updated_at
+		`, event.BatchID, event.EventType, event.ActorID, event.Location, event.Timestamp, event.Metadata).Scan(&event.ID, &event.UpdatedAt)
+		if err != nil {
+			return fail(fmt.Errorf("row %d: %v", e.Row, err))
+		}
+
+		// Status changes move the batch, as when the event is created through the API
+		if newStatus, ok := e.Metadata["new_status"].(string); ok && e.EventType == "status_change" && newStatus != "" {
+			if _, err := tx.Exec("UPDATE batch SET status = $1, updated_at = NOW() WHERE id = $2", newStatus, e.BatchID); err != nil {
+				return fail(fmt.Errorf("row %d: %v", e.Row, err))
+			}
+		}
+		imported = append(imported, event)
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE event_import_job SET status = $2, imported_rows = $3, finished_at = NOW() WHERE id = $1
+	`, jobID, EventImportCompleted, len(imported)); err != nil {
+		return fail(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+	return imported, nil
+}
+
+// anchorImportedEvents records imported events on-chain, notifies chains their batches were shared with
+// and publishes the status changes they made
+func anchorImportedEvents(events []models.Event) {
+	blockchainClient := blockchain.NewBlockchainClient(
+		os.Getenv("BLOCKCHAIN_NODE_URL"),
+		os.Getenv("BLOCKCHAIN_PRIVATE_KEY"),
+		os.Getenv("BLOCKCHAIN_ACCOUNT"),
+		os.Getenv("BLOCKCHAIN_CHAIN_ID"),
+		os.Getenv("BLOCKCHAIN_CONSENSUS"),
+	)
+	batches := map[int]bool{}
+	for _, event := range events {
+		var metadata map[string]interface{}
+		json.Unmarshal(event.Metadata, &metadata)
+		anchorEventVersion(blockchainClient, event, metadata)
+		batches[event.BatchID] = true
+		if newStatus, ok := metadata["new_status"].(string); ok && event.EventType == "status_change" && newStatus != "" {
+			publishBatchStatusChanged(event.BatchID, "", newStatus, "event_import")
+		}
+	}
+	for batchID := range batches {
+		chainsync.NotifyBatch(batchID)
+	}
+}
+
+// GetEventImport gets the report of an event import
+// @Summary Get event import
+// @Description Get the status and row-level report of an event import
+// @Tags events
+// @Produce json
+// @Param importId path string true "Import ID"
+// @Success 200 {object} SuccessResponse{data=EventImportJob}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /events/import/{importId} [get]
+func GetEventImport(c *fiber.Ctx) error {
+	importID, err := strconv.Atoi(c.Params("importId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid import ID format")
+	}
+	userID, _ := c.Locals("userID").(int)
+	role, _ := c.Locals("role").(string)
+
+	job, err := scanEventImportJob(db.DB.QueryRow(`
+		SELECT `+eventImportJobColumns+`
+		FROM event_import_job
+		WHERE id = $1 AND ($2::text = 'admin' OR created_by = $3)
+	`, importID, role, userID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Import not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve import")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Import retrieved successfully",
+		Data:    job,
+	})
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+)
+
+// eventTypePattern restricts event type names to snake case
+var eventTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,99}$`)
+
+// EventTypeSchema is the metadata schema registered for an event type
+type EventTypeSchema struct {
+	ID          int             `json:"id"`
+	EventType   string          `json:"event_type"`
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema" swaggertype:"object"` // JSON Schema (draft-07 subset)
+	Version     int             `json:"version"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// EventTypeSchemaRequest represents a request to register or replace the schema of an event type
+type EventTypeSchemaRequest struct {
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema" swaggertype:"object"`
+}
+
+const eventTypeSchemaColumns = `id, event_type, COALESCE(description, ''), schema, version, updated_at`
+
+// scanEventTypeSchema reads a row selected with eventTypeSchemaColumns
+func scanEventTypeSchema(row rowScanner) (EventTypeSchema, error) {
+	var s EventTypeSchema
+	var schema []byte
+	err := row.Scan(&s.ID, &s.EventType, &s.Description, &schema, &s.Version, &s.UpdatedAt)
+	s.Schema = schema
+	return s, err
+}
+
+// loadEventTypeSchema loads the metadata schema registered for an event type; it is nil when there is none
+func loadEventTypeSchema(eventType string) (*utils.JSONSchema, error) {
+	var raw []byte
+	err := db.DB.QueryRow(`
+		SELECT schema FROM event_type_schema WHERE event_type = $1 AND is_active = true
+	`, eventType).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to load event type schema")
+	}
+
+	schema, err := utils.ParseJSONSchema(raw)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Event type schema of "+eventType+" is invalid")
+	}
+	return schema, nil
+}
+
+// eventMetadataProblems lists the violations of metadata against an event type schema
+func eventMetadataProblems(schema *utils.JSONSchema, metadata map[string]interface{}) ([]string, error) {
+	if schema == nil {
+		return nil, nil
+	}
+	// The metadata map is decoded JSON, so it is compared as such
+	var value interface{} = map[string]interface{}{}
+	if metadata != nil {
+		encoded, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(encoded, &value); err != nil {
+			return nil, err
+		}
+	}
+	return schema.Validate(value, "metadata"), nil
+}
+
+// validateEventMetadata checks event metadata against the schema registered for the event type
+// Event types without a schema accept any metadata
+func validateEventMetadata(eventType string, metadata map[string]interface{}) error {
+	schema, err := loadEventTypeSchema(eventType)
+	if err != nil {
+		return err
+	}
+	problems, err := eventMetadataProblems(schema, metadata)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid metadata")
+	}
+	if len(problems) > 0 {
+		return fiber.NewError(fiber.StatusUnprocessableEntity,
+			"Metadata does not match the "+eventType+" event schema: "+strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ListEventTypes lists the event types with a metadata schema
+// @Summary List event types
+// @Description List the event types with their metadata JSON Schema, so clients can build event forms dynamically
+// @Tags meta
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]EventTypeSchema}
+// @Failure 500 {object} ErrorResponse
+// @Router /meta/event-types [get]
+func ListEventTypes(c *fiber.Ctx) error {
+	rows, err := db.DB.Query(`
+		SELECT ` + eventTypeSchemaColumns + `
+		FROM event_type_schema
+		WHERE is_active = true
+		ORDER BY event_type
+	`)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve event types")
+	}
+	defer rows.Close()
+
+	eventTypes := []EventTypeSchema{}
+	for rows.Next() {
+		s, err := scanEventTypeSchema(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse event type")
+		}
+		eventTypes = append(eventTypes, s)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Event types retrieved successfully",
+		Data:    eventTypes,
+	})
+}
+
+// GetEventType gets the metadata schema of an event type
+// @Summary Get event type
+// @Description Get the metadata JSON Schema of an event type
+// @Tags meta
+// @Produce json
+// @Param eventType path string true "Event type"
+// @Success 200 {object} SuccessResponse{data=EventTypeSchema}
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /meta/event-types/{eventType} [get]
+func GetEventType(c *fiber.Ctx) error {
+	s, err := scanEventTypeSchema(db.DB.QueryRow(`
+		SELECT `+eventTypeSchemaColumns+`
+		FROM event_type_schema
+		WHERE event_type = $1 AND is_active = true
+	`, c.Params("eventType")))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Event type not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve event type")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Event type retrieved successfully",
+		Data:    s,
+	})
+}
+
+// PutEventType registers or replaces the metadata schema of an event type
+// @Summary Register event type schema
+// @Description Register the metadata JSON Schema of an event type, or replace it with a new version. New and updated events of the type are validated against it.
+// @Description Supported keywords: type, properties, required, additionalProperties, items, enum, format (date-time, date), pattern, minLength, maxLength, minimum, maximum
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param eventType path string true "Event type"
+// @Param request body EventTypeSchemaRequest true "Schema"
+// @Success 200 {object} SuccessResponse{data=EventTypeSchema}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/event-types/{eventType} [put]
+func PutEventType(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	eventType := c.Params("eventType")
+	if !eventTypePattern.MatchString(eventType) {
+		return fiber.NewError(fiber.StatusBadRequest, "Event type must be lowercase letters, digits and underscores")
+	}
+	var req EventTypeSchemaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if len(req.Schema) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Schema is required")
+	}
+	schema, err := utils.ParseJSONSchema(req.Schema)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if schema.Type != "object" {
+		return fiber.NewError(fiber.StatusBadRequest, "Event metadata schemas must be of type object")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	s, err := scanEventTypeSchema(db.DB.QueryRow(`
+		INSERT INTO event_type_schema (event_type, description, schema, version, updated_by, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, 1, NULLIF($4, 0), NOW(), NOW(), true)
+		ON CONFLICT (event_type) DO UPDATE SET
+			description = EXCLUDED.description,
+			schema = EXCLUDED.schema,
+			version = event_type_schema.version + 1,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW(),
+			is_active = true
+		RETURNING `+eventTypeSchemaColumns,
+		eventType, req.Description, string(req.Schema), userID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save event type schema")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Event type schema saved successfully",
+		Data:    s,
+	})
+}
+
+// DeleteEventType removes the metadata schema of an event type
+// @Summary Remove event type schema
+// @Description Remove the metadata schema of an event type; its events are no longer validated
+// @Tags admin
+// @Produce json
+// @Param eventType path string true "Event type"
+// @Success 200 {object} SuccessResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/event-types/{eventType} [delete]
+func DeleteEventType(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	res, err := db.DB.Exec(`
+		UPDATE event_type_schema SET is_active = false, updated_at = NOW()
+		WHERE event_type = $1 AND is_active = true
+	`, c.Params("eventType"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to remove event type schema")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Event type not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Event type schema removed successfully",
+	})
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/faults"
+)
+
+// ListFaultRules lists the fault injection rules
+// @Summary List fault injection rules
+// @Description List the rules injecting latency and errors into DB, IPFS and blockchain calls, with the calls each slowed down or failed.
+// @Description Only available when fault injection is enabled, by the faults build tag or FAULT_INJECTION_ENABLED outside production
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]faults.Rule}
+// @Failure 403 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/faults [get]
+func ListFaultRules(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Fault rules retrieved successfully",
+		Data:    faults.Default().Rules(),
+	})
+}
+
+// AddFaultRule adds a fault injection rule
+// @Summary Add fault injection rule
+// @Description Slow down or fail the calls to a target (db, ipfs or blockchain), of every request and background job or only while a request to a route is served.
+// @Description Routes are paths, optionally preceded by a method; ":name" segments match any segment and a trailing "*" the rest of the path
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body faults.Rule true "Rule"
+// @Success 201 {object} SuccessResponse{data=faults.Rule}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/faults [post]
+func AddFaultRule(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	var req faults.Rule
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	rule, err := faults.Default().Add(req)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Fault rule added successfully",
+		Data:    rule,
+	})
+}
+
+// DeleteFaultRule removes a fault injection rule
+// @Summary Remove fault injection rule
+// @Description Stop injecting the faults of a rule
+// @Tags admin
+// @Produce json
+// @Param ruleId path string true "Rule ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/faults/{ruleId} [delete]
+func DeleteFaultRule(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	if !faults.Default().Remove(c.Params("ruleId")) {
+		return fiber.NewError(fiber.StatusNotFound, "Fault rule not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Fault rule removed successfully",
+	})
+}
+
+// ResetFaultRules removes every fault injection rule
+// @Summary Remove all fault injection rules
+// @Description Stop injecting faults, typically between resilience tests
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse
+// @Failure 403 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/faults [delete]
+func ResetFaultRules(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	faults.Default().Reset()
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Fault rules removed successfully",
+	})
+}
@@ -0,0 +1,384 @@
+package api
+
+import (
+	"database/sql"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/features"
+)
+
+var featureFlagKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,99}$`)
+
+// FeatureFlagRequest represents a request to create a feature flag
+type FeatureFlagRequest struct {
+	Key            string `json:"key"`
+	Description    string `json:"description"`
+	Enabled        bool   `json:"enabled"`
+	RolloutPercent *int   `json:"rollout_percent"` // Defaults to 100
+}
+
+// UpdateFeatureFlagRequest represents a request to change a feature flag; omitted fields are kept
+type UpdateFeatureFlagRequest struct {
+	Description    *string `json:"description"`
+	Enabled        *bool   `json:"enabled"`
+	RolloutPercent *int    `json:"rollout_percent"`
+}
+
+// FeatureFlagOverrideRequest represents a request to turn a flag on or off for one company
+type FeatureFlagOverrideRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// FeatureFlagEvaluation is the state of every flag for one company
+type FeatureFlagEvaluation struct {
+	CompanyID int             `json:"company_id"`
+	Flags     map[string]bool `json:"flags"`
+}
+
+// loadFeatureFlag reads one flag fresh from the database
+func loadFeatureFlag(key string) (features.Flag, error) {
+	features.Default().Invalidate()
+	flag, ok := features.Default().Flags()[key]
+	if !ok {
+		return flag, sql.ErrNoRows
+	}
+	return flag, nil
+}
+
+// ListFeatureFlags lists the feature flags
+// @Summary List feature flags
+// @Description List the feature flags with their rollout percentage and company overrides
+// @Tags feature-flags
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]features.Flag}
+// @Failure 403 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/feature-flags [get]
+func ListFeatureFlags(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	features.Default().Invalidate()
+	flags := []features.Flag{}
+	for _, flag := range features.Default().Flags() {
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Key < flags[j].Key })
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Feature flags retrieved successfully",
+		Data:    flags,
+	})
+}
+
+// CreateFeatureFlag creates a feature flag
+// @Summary Create feature flag
+// @Description Create a feature flag that handlers and middleware can check per company
+// @Tags feature-flags
+// @Accept json
+// @Produce json
+// @Param request body FeatureFlagRequest true "Feature flag"
+// @Success 201 {object} SuccessResponse{data=features.Flag}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/feature-flags [post]
+func CreateFeatureFlag(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	var req FeatureFlagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.Key = strings.TrimSpace(req.Key)
+	if !featureFlagKeyPattern.MatchString(req.Key) {
+		return fiber.NewError(fiber.StatusBadRequest, "Flag key must be lowercase letters, digits and underscores")
+	}
+	rollout := 100
+	if req.RolloutPercent != nil {
+		rollout = *req.RolloutPercent
+	}
+	if rollout < 0 || rollout > 100 {
+		return fiber.NewError(fiber.StatusBadRequest, "Rollout percent must be between 0 and 100")
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM feature_flag WHERE key = $1 AND is_active = true)", req.Key).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A feature flag with this key already exists")
+	}
+
+	// Deleted flags are revived with a clean slate
+	_, err := db.DB.Exec(`
+		INSERT INTO feature_flag (key, description, enabled, rollout_percent, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NOW(), NOW(), true)
+		ON CONFLICT (key) DO UPDATE SET
+			description = EXCLUDED.description, enabled = EXCLUDED.enabled, rollout_percent = EXCLUDED.rollout_percent,
+			updated_at = NOW(), is_active = true
+	`, req.Key, req.Description, req.Enabled, rollout)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create feature flag")
+	}
+	if _, err := db.DB.Exec(`
+		DELETE FROM feature_flag_company WHERE flag_id = (SELECT id FROM feature_flag WHERE key = $1)
+	`, req.Key); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create feature flag")
+	}
+
+	flag, err := loadFeatureFlag(req.Key)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feature flag")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Feature flag created successfully",
+		Data:    flag,
+	})
+}
+
+// UpdateFeatureFlag changes a feature flag
+// @Summary Update feature flag
+// @Description Turn a flag on or off or change its rollout percentage. Changes apply to every instance within the flag cache time
+// @Tags feature-flags
+// @Accept json
+// @Produce json
+// @Param key path string true "Flag key"
+// @Param request body UpdateFeatureFlagRequest true "Changes"
+// @Success 200 {object} SuccessResponse{data=features.Flag}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/feature-flags/{key} [put]
+func UpdateFeatureFlag(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	key := c.Params("key")
+	var req UpdateFeatureFlagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.RolloutPercent != nil && (*req.RolloutPercent < 0 || *req.RolloutPercent > 100) {
+		return fiber.NewError(fiber.StatusBadRequest, "Rollout percent must be between 0 and 100")
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE feature_flag
+		SET description = COALESCE($1, description), enabled = COALESCE($2, enabled),
+			rollout_percent = COALESCE($3, rollout_percent), updated_at = NOW()
+		WHERE key = $4 AND is_active = true
+	`, req.Description, req.Enabled, req.RolloutPercent, key)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update feature flag")
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Feature flag not found")
+	}
+
+	flag, err := loadFeatureFlag(key)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feature flag")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Feature flag updated successfully",
+		Data:    flag,
+	})
+}
+
+// DeleteFeatureFlag deactivates a feature flag
+// @Summary Delete feature flag
+// @Description Remove a feature flag. Checks of a removed flag evaluate to off
+// @Tags feature-flags
+// @Produce json
+// @Param key path string true "Flag key"
+// @Success 200 {object} SuccessResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/feature-flags/{key} [delete]
+func DeleteFeatureFlag(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE feature_flag SET is_active = false, updated_at = NOW()
+		WHERE key = $1 AND is_active = true
+	`, c.Params("key"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete feature flag")
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Feature flag not found")
+	}
+	features.Default().Invalidate()
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Feature flag deleted successfully",
+	})
+}
+
+// SetFeatureFlagOverride turns a flag on or off for one company
+// @Summary Set company feature flag override
+// @Description Turn a flag on or off for one company regardless of the rollout, e.g. for pilot customers
+// @Tags feature-flags
+// @Accept json
+// @Produce json
+// @Param key path string true "Flag key"
+// @Param companyId path int true "Company ID"
+// @Param request body FeatureFlagOverrideRequest true "Override"
+// @Success 200 {object} SuccessResponse{data=features.Flag}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/feature-flags/{key}/companies/{companyId} [put]
+func SetFeatureFlagOverride(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	key := c.Params("key")
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	var req FeatureFlagOverrideRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	var flagID int
+	err = db.DB.QueryRow("SELECT id FROM feature_flag WHERE key = $1 AND is_active = true", key).Scan(&flagID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Feature flag not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", companyID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+
+	_, err = db.DB.Exec(`
+		INSERT INTO feature_flag_company (flag_id, company_id, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT (flag_id, company_id) DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = NOW()
+	`, flagID, companyID, req.Enabled)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to set feature flag override")
+	}
+
+	flag, err := loadFeatureFlag(key)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feature flag")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Feature flag override set successfully",
+		Data:    flag,
+	})
+}
+
+// ClearFeatureFlagOverride returns a company to the flag's rollout
+// @Summary Clear company feature flag override
+// @Description Remove the override of a company so the flag's rollout decides again
+// @Tags feature-flags
+// @Produce json
+// @Param key path string true "Flag key"
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=features.Flag}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/feature-flags/{key}/companies/{companyId} [delete]
+func ClearFeatureFlagOverride(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	key := c.Params("key")
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	result, err := db.DB.Exec(`
+		DELETE FROM feature_flag_company
+		WHERE company_id = $1 AND flag_id = (SELECT id FROM feature_flag WHERE key = $2 AND is_active = true)
+	`, companyID, key)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to clear feature flag override")
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Feature flag override not found")
+	}
+
+	flag, err := loadFeatureFlag(key)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feature flag")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Feature flag override cleared successfully",
+		Data:    flag,
+	})
+}
+
+// GetMyFeatureFlags evaluates every flag for the current user's company
+// @Summary Get my feature flags
+// @Description Get which features are enabled for the current user's company, e.g. to show or hide UI
+// @Tags users
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=FeatureFlagEvaluation}
+// @Security Bearer
+// @Router /users/me/features [get]
+func GetMyFeatureFlags(c *fiber.Ctx) error {
+	companyID, _ := c.Locals("companyID").(int)
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Feature flags evaluated successfully",
+		Data: FeatureFlagEvaluation{
+			CompanyID: companyID,
+			Flags:     features.Default().Evaluate(companyID),
+		},
+	})
+}
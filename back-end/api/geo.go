@@ -136,7 +136,7 @@ func RecordGeoLocation(c *fiber.Ctx) error {
 		"timestamp":      now,
 	})
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record location on blockchain: "+err.Error())
+		return blockchainFailure("Failed to record location on blockchain", err)
 	}
 	
 	// Return response
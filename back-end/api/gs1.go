@@ -0,0 +1,520 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GS1Prefix represents a GS1 company prefix registered by a company
+type GS1Prefix struct {
+	ID          int       `json:"id"`
+	CompanyID   int       `json:"company_id"`
+	Prefix      string    `json:"prefix"`
+	Description string    `json:"description"`
+	NextGTINRef int64     `json:"next_gtin_ref"`
+	NextGLNRef  int64     `json:"next_gln_ref"`
+	NextSSCCRef int64     `json:"next_sscc_ref"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GS1Identifier represents an allocated GTIN, GLN or SSCC
+type GS1Identifier struct {
+	ID          int       `json:"id"`
+	CompanyID   int       `json:"company_id"`
+	PrefixID    int       `json:"prefix_id"`
+	Type        string    `json:"type"`
+	Value       string    `json:"value"`
+	EPCURI      string    `json:"epc_uri"`
+	EntityType  string    `json:"entity_type"`
+	EntityID    int       `json:"entity_id,omitempty"`
+	EntityRef   string    `json:"entity_ref,omitempty"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RegisterGS1PrefixRequest represents a request to register a GS1 company prefix
+type RegisterGS1PrefixRequest struct {
+	CompanyID   int    `json:"company_id"`
+	Prefix      string `json:"prefix"`
+	Description string `json:"description"`
+}
+
+// AllocateGS1IdentifierRequest represents a request to allocate a GS1 identifier
+type AllocateGS1IdentifierRequest struct {
+	CompanyID   int    `json:"company_id"`
+	Type        string `json:"type"`        // GTIN, GLN or SSCC
+	EntityType  string `json:"entity_type"` // product, hatchery, company, shipment_transfer
+	EntityID    int    `json:"entity_id,omitempty"`
+	EntityRef   string `json:"entity_ref,omitempty"` // e.g. species name for products
+	Prefix      string `json:"prefix,omitempty"`     // optional, defaults to the company's first prefix
+	Extension   int    `json:"extension,omitempty"`  // SSCC extension digit
+	Description string `json:"description,omitempty"`
+}
+
+// gs1EntityTypes lists the entity types each identifier type can be allocated for
+var gs1EntityTypes = map[string][]string{
+	utils.GS1TypeGTIN: {"product"},
+	utils.GS1TypeGLN:  {"hatchery", "company", "facility"},
+	utils.GS1TypeSSCC: {"shipment_transfer", "shipment"},
+}
+
+// RegisterGS1Prefix registers a GS1 company prefix for a company
+// @Summary Register GS1 company prefix
+// @Description Register a GS1 company prefix licensed to a company so identifiers can be allocated from it
+// @Tags gs1
+// @Accept json
+// @Produce json
+// @Param request body RegisterGS1PrefixRequest true "Prefix details"
+// @Success 201 {object} SuccessResponse{data=GS1Prefix}
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /gs1/prefixes [post]
+func RegisterGS1Prefix(c *fiber.Ctx) error {
+	var req RegisterGS1PrefixRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.CompanyID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Company ID is required")
+	}
+	if err := utils.ValidateGS1CompanyPrefix(req.Prefix); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	// Check if company exists
+	var exists bool
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", req.CompanyID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+
+	// Prefixes are globally unique
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM gs1_prefix WHERE prefix = $1)", req.Prefix).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "GS1 prefix is already registered")
+	}
+
+	prefix := GS1Prefix{
+		CompanyID:   req.CompanyID,
+		Prefix:      req.Prefix,
+		Description: req.Description,
+	}
+	err = db.DB.QueryRow(`
+		INSERT INTO gs1_prefix (company_id, prefix, description)
+		VALUES ($1, $2, $3)
+		RETURNING id, next_gtin_ref, next_gln_ref, next_sscc_ref, created_at, updated_at
+	`, req.CompanyID, req.Prefix, req.Description).Scan(
+		&prefix.ID, &prefix.NextGTINRef, &prefix.NextGLNRef, &prefix.NextSSCCRef, &prefix.CreatedAt, &prefix.UpdatedAt,
+	)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to register GS1 prefix")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "GS1 prefix registered successfully",
+		Data:    prefix,
+	})
+}
+
+// ListGS1Prefixes lists registered GS1 company prefixes
+// @Summary List GS1 company prefixes
+// @Description List GS1 company prefixes, optionally filtered by company
+// @Tags gs1
+// @Accept json
+// @Produce json
+// @Param company_id query int false "Company ID"
+// @Success 200 {object} SuccessResponse{data=[]GS1Prefix}
+// @Failure 500 {object} ErrorResponse
+// @Router /gs1/prefixes [get]
+func ListGS1Prefixes(c *fiber.Ctx) error {
+	query := `
+		SELECT id, company_id, prefix, COALESCE(description, ''), next_gtin_ref, next_gln_ref, next_sscc_ref, created_at, updated_at
+		FROM gs1_prefix
+		WHERE is_active = true
+	`
+	args := []interface{}{}
+	if companyID := c.QueryInt("company_id", 0); companyID > 0 {
+		query += " AND company_id = $1"
+		args = append(args, companyID)
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	prefixes := []GS1Prefix{}
+	for rows.Next() {
+		var p GS1Prefix
+		if err := rows.Scan(&p.ID, &p.CompanyID, &p.Prefix, &p.Description, &p.NextGTINRef, &p.NextGLNRef, &p.NextSSCCRef, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse GS1 prefix")
+		}
+		prefixes = append(prefixes, p)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "GS1 prefixes retrieved successfully",
+		Data:    prefixes,
+	})
+}
+
+// AllocateGS1Identifier allocates a GTIN, GLN or SSCC from a company prefix
+// @Summary Allocate GS1 identifier
+// @Description Allocate a GTIN for a product, a GLN for a facility or an SSCC for a shipment. Identifiers are reused if already allocated for the same entity.
+// @Tags gs1
+// @Accept json
+// @Produce json
+// @Param request body AllocateGS1IdentifierRequest true "Allocation details"
+// @Success 201 {object} SuccessResponse{data=GS1Identifier}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /gs1/identifiers [post]
+func AllocateGS1Identifier(c *fiber.Ctx) error {
+	var req AllocateGS1IdentifierRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.Type = strings.ToUpper(req.Type)
+
+	// Validate request
+	allowedEntities, ok := gs1EntityTypes[req.Type]
+	if !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "Type must be GTIN, GLN or SSCC")
+	}
+	if req.CompanyID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Company ID is required")
+	}
+	if !containsString(allowedEntities, req.EntityType) {
+		return fiber.NewError(fiber.StatusBadRequest, req.Type+" can only be allocated for: "+strings.Join(allowedEntities, ", "))
+	}
+	if req.EntityID <= 0 && req.EntityRef == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Entity ID or entity reference is required")
+	}
+
+	// Return the existing identifier if one was already allocated for this entity
+	existing, err := findGS1Identifier(req.CompanyID, req.Type, req.EntityType, req.EntityID, req.EntityRef)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if existing != nil {
+		return c.JSON(SuccessResponse{
+			Success: true,
+			Message: "GS1 identifier already allocated",
+			Data:    existing,
+		})
+	}
+
+	identifier, err := allocateGS1Identifier(req)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "GS1 identifier allocated successfully",
+		Data:    identifier,
+	})
+}
+
+// allocateGS1Identifier reserves the next reference of a prefix and persists the identifier
+func allocateGS1Identifier(req AllocateGS1IdentifierRequest) (*GS1Identifier, error) {
+	counterColumn := map[string]string{
+		utils.GS1TypeGTIN: "next_gtin_ref",
+		utils.GS1TypeGLN:  "next_gln_ref",
+		utils.GS1TypeSSCC: "next_sscc_ref",
+	}[req.Type]
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to start database transaction")
+	}
+	defer tx.Rollback()
+
+	// Lock the prefix row so concurrent allocations never share a reference
+	query := "SELECT id, prefix, " + counterColumn + " FROM gs1_prefix WHERE company_id = $1 AND is_active = true"
+	args := []interface{}{req.CompanyID}
+	if req.Prefix != "" {
+		query += " AND prefix = $2"
+		args = append(args, req.Prefix)
+	}
+	query += " ORDER BY id LIMIT 1 FOR UPDATE"
+
+	var prefixID int
+	var prefix string
+	var nextRef int64
+	err = tx.QueryRow(query, args...).Scan(&prefixID, &prefix, &nextRef)
+	if err == sql.ErrNoRows {
+		return nil, fiber.NewError(fiber.StatusNotFound, "No GS1 prefix registered for this company")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	if nextRef >= utils.GS1Capacity(req.Type, prefix) {
+		return nil, fiber.NewError(fiber.StatusConflict, "GS1 prefix "+prefix+" has no "+req.Type+" references left")
+	}
+
+	key, err := utils.BuildGS1Key(req.Type, prefix, nextRef, req.Extension)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	epcURI, err := utils.GS1EPCURI(req.Type, key, prefix, "*", false)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to build EPC URI")
+	}
+
+	identifier := &GS1Identifier{
+		CompanyID:   req.CompanyID,
+		PrefixID:    prefixID,
+		Type:        req.Type,
+		Value:       key,
+		EPCURI:      epcURI,
+		EntityType:  req.EntityType,
+		EntityID:    req.EntityID,
+		EntityRef:   req.EntityRef,
+		Description: req.Description,
+	}
+	err = tx.QueryRow(`
+		INSERT INTO gs1_identifier (company_id, prefix_id, id_type, value, epc_uri, entity_type, entity_id, entity_ref, description)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), $8, $9)
+		RETURNING id, created_at
+	`, req.CompanyID, prefixID, req.Type, key, epcURI, req.EntityType, req.EntityID, req.EntityRef, req.Description,
+	).Scan(&identifier.ID, &identifier.CreatedAt)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to save GS1 identifier")
+	}
+
+	if _, err := tx.Exec("UPDATE gs1_prefix SET "+counterColumn+" = "+counterColumn+" + 1, updated_at = NOW() WHERE id = $1", prefixID); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to update GS1 prefix counter")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to commit database transaction")
+	}
+	return identifier, nil
+}
+
+// findGS1Identifier looks up an active identifier allocated for an entity
+func findGS1Identifier(companyID int, idType, entityType string, entityID int, entityRef string) (*GS1Identifier, error) {
+	var identifier GS1Identifier
+	var dbEntityID sql.NullInt64
+	err := db.DB.QueryRow(`
+		SELECT id, company_id, prefix_id, id_type, value, COALESCE(epc_uri, ''), entity_type, entity_id,
+		       COALESCE(entity_ref, ''), COALESCE(description, ''), created_at
+		FROM gs1_identifier
+		WHERE company_id = $1 AND id_type = $2 AND entity_type = $3
+		  AND COALESCE(entity_id, 0) = $4 AND COALESCE(entity_ref, '') = $5 AND is_active = true
+		ORDER BY id LIMIT 1
+	`, companyID, idType, entityType, entityID, entityRef).Scan(
+		&identifier.ID, &identifier.CompanyID, &identifier.PrefixID, &identifier.Type, &identifier.Value,
+		&identifier.EPCURI, &identifier.EntityType, &dbEntityID, &identifier.EntityRef, &identifier.Description,
+		&identifier.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	identifier.EntityID = int(dbEntityID.Int64)
+	return &identifier, nil
+}
+
+// ListGS1Identifiers lists allocated GS1 identifiers
+// @Summary List GS1 identifiers
+// @Description List allocated GS1 identifiers, optionally filtered by company and type
+// @Tags gs1
+// @Accept json
+// @Produce json
+// @Param company_id query int false "Company ID"
+// @Param type query string false "Identifier type: GTIN, GLN or SSCC"
+// @Success 200 {object} SuccessResponse{data=[]GS1Identifier}
+// @Failure 500 {object} ErrorResponse
+// @Router /gs1/identifiers [get]
+func ListGS1Identifiers(c *fiber.Ctx) error {
+	query := `
+		SELECT id, company_id, prefix_id, id_type, value, COALESCE(epc_uri, ''), entity_type, COALESCE(entity_id, 0),
+		       COALESCE(entity_ref, ''), COALESCE(description, ''), created_at
+		FROM gs1_identifier
+		WHERE is_active = true
+	`
+	args := []interface{}{}
+	if companyID := c.QueryInt("company_id", 0); companyID > 0 {
+		args = append(args, companyID)
+		query += " AND company_id = $" + strconv.Itoa(len(args))
+	}
+	if idType := strings.ToUpper(c.Query("type")); idType != "" {
+		args = append(args, idType)
+		query += " AND id_type = $" + strconv.Itoa(len(args))
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	identifiers := []GS1Identifier{}
+	for rows.Next() {
+		var i GS1Identifier
+		if err := rows.Scan(&i.ID, &i.CompanyID, &i.PrefixID, &i.Type, &i.Value, &i.EPCURI, &i.EntityType,
+			&i.EntityID, &i.EntityRef, &i.Description, &i.CreatedAt); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse GS1 identifier")
+		}
+		identifiers = append(identifiers, i)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "GS1 identifiers retrieved successfully",
+		Data:    identifiers,
+	})
+}
+
+// ResolveGS1Identifier resolves a GS1 key to the entity it was allocated for
+// @Summary Resolve GS1 identifier
+// @Description Resolve a GTIN, GLN or SSCC to its allocation record
+// @Tags gs1
+// @Accept json
+// @Produce json
+// @Param value path string true "GS1 key"
+// @Success 200 {object} SuccessResponse{data=GS1Identifier}
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /gs1/identifiers/{value} [get]
+func ResolveGS1Identifier(c *fiber.Ctx) error {
+	value := c.Params("value")
+
+	i, err := findGS1IdentifierByValue(value)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "GS1 identifier not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "GS1 identifier resolved successfully",
+		Data:    i,
+	})
+}
+
+// findGS1IdentifierByValue looks up an allocated identifier by its key
+func findGS1IdentifierByValue(value string) (GS1Identifier, error) {
+	// GTINs may be supplied as GTIN-13, which is stored as GTIN-14 with a leading zero
+	alternate := value
+	if len(value) == 13 {
+		alternate = "0" + value
+	}
+
+	var i GS1Identifier
+	err := db.DB.QueryRow(`
+		SELECT id, company_id, prefix_id, id_type, value, COALESCE(epc_uri, ''), entity_type, COALESCE(entity_id, 0),
+		       COALESCE(entity_ref, ''), COALESCE(description, ''), created_at
+		FROM gs1_identifier
+		WHERE (value = $1 OR value = $2) AND is_active = true
+		ORDER BY id LIMIT 1
+	`, value, alternate).Scan(&i.ID, &i.CompanyID, &i.PrefixID, &i.Type, &i.Value, &i.EPCURI, &i.EntityType,
+		&i.EntityID, &i.EntityRef, &i.Description, &i.CreatedAt)
+	return i, err
+}
+
+// BatchGS1Identifiers holds the GS1 keys that apply to a batch
+type BatchGS1Identifiers struct {
+	GTIN       string
+	GTINPrefix string
+	GLN        string
+	GLNPrefix  string
+}
+
+// lookupBatchGS1Identifiers returns the product GTIN and hatchery GLN allocated for a batch, if any
+func lookupBatchGS1Identifiers(batchID int) (BatchGS1Identifiers, error) {
+	var ids BatchGS1Identifiers
+	var companyID, hatcheryID int
+	var species string
+	err := db.DB.QueryRow(`
+		SELECT h.company_id, h.id, b.species
+		FROM batch b
+		JOIN hatchery h ON b.hatchery_id = h.id
+		WHERE b.id = $1
+	`, batchID).Scan(&companyID, &hatcheryID, &species)
+	if err != nil {
+		return ids, err
+	}
+
+	lookup := `
+		SELECT gi.value, gp.prefix
+		FROM gs1_identifier gi
+		JOIN gs1_prefix gp ON gi.prefix_id = gp.id
+		WHERE gi.company_id = $1 AND gi.id_type = $2 AND gi.entity_type = $3
+		  AND COALESCE(gi.entity_id, 0) = $4 AND COALESCE(gi.entity_ref, '') = $5 AND gi.is_active = true
+		ORDER BY gi.id LIMIT 1
+	`
+	err = db.DB.QueryRow(lookup, companyID, utils.GS1TypeGTIN, "product", 0, species).Scan(&ids.GTIN, &ids.GTINPrefix)
+	if err != nil && err != sql.ErrNoRows {
+		return ids, err
+	}
+	err = db.DB.QueryRow(lookup, companyID, utils.GS1TypeGLN, "hatchery", hatcheryID, "").Scan(&ids.GLN, &ids.GLNPrefix)
+	if err != nil && err != sql.ErrNoRows {
+		return ids, err
+	}
+	return ids, nil
+}
+
+// containsString reports whether a slice contains the given string
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// applyGS1IdentifiersToEPCIS replaces placeholder EPCs in the events of an exported EPCIS document with allocated GS1 keys
+func applyGS1IdentifiersToEPCIS(epcisData map[string]interface{}, ids BatchGS1Identifiers, lot string) {
+	body, _ := epcisData["epcisBody"].(map[string]interface{})
+	events, _ := body["eventList"].([]map[string]interface{})
+
+	for _, event := range events {
+		if ids.GTIN != "" {
+			if uri, err := utils.GS1EPCURI(utils.GS1TypeGTIN, ids.GTIN, ids.GTINPrefix, lot, true); err == nil {
+				event["epcList"] = []string{}
+				event["quantityList"] = []map[string]interface{}{
+					{"epcClass": uri},
+				}
+			}
+		}
+		if ids.GLN != "" {
+			if uri, err := utils.GS1EPCURI(utils.GS1TypeGLN, ids.GLN, ids.GLNPrefix, "", false); err == nil {
+				event["readPoint"] = map[string]interface{}{"id": uri}
+				event["bizLocation"] = map[string]interface{}{"id": uri}
+			}
+		}
+	}
+	if ids.GTIN != "" {
+		epcisData["gtin"] = ids.GTIN
+	}
+}
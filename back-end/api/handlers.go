@@ -13,11 +13,16 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
 	"github.com/skip2/go-qrcode"
+	"github.com/LTPPPP/TracePost-larvaeChain/actors"
 	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/chainsync"
 	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/eventbus"
 	"github.com/LTPPPP/TracePost-larvaeChain/ipfs"
 	"github.com/LTPPPP/TracePost-larvaeChain/models"
+	"github.com/LTPPPP/TracePost-larvaeChain/stages"
 )
 
 // CreateEventRequest represents a request to create a new event
@@ -37,6 +42,12 @@ type RecordEnvironmentDataRequest struct {
 	Salinity    float64 `json:"salinity"`
 	Density     float64 `json:"density"`
 	Age         int     `json:"age"`
+
+	// Custom parameters from the environment parameter catalog, e.g. {"dissolved_oxygen": 6.2}
+	Parameters map[string]float64 `json:"parameters"`
+
+	// Optional device that took the reading
+	DeviceID int `json:"device_id"`
 }
 
 // UploadDocumentRequest represents a request to upload a document
@@ -55,6 +66,7 @@ type TraceByQRCodeResponse struct {
 	EnvironmentData []models.EnvironmentData  `json:"environment_data"`
 	LogisticsChain  []models.LogisticsEvent   `json:"logistics_chain"`
 	BlockchainInfo  []models.BlockchainRecord `json:"blockchain_info"`
+	StageTimeline   stages.Timeline           `json:"stage_timeline"`
 }
 
 // CreateEvent creates a new event for a batch
@@ -64,9 +76,11 @@ type TraceByQRCodeResponse struct {
 // @Accept json
 // @Produce json
 // @Param request body CreateEventRequest true "Event creation details"
+// @Param dry_run query bool false "Only validate and describe what would happen, without writing to the database, IPFS or the chain"
 // @Success 201 {object} SuccessResponse{data=models.Event}
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse "Metadata does not match the event type schema"
 // @Failure 500 {object} ErrorResponse
 // @Router /events [post]
 func CreateEvent(c *fiber.Ctx) error {
@@ -80,6 +94,9 @@ func CreateEvent(c *fiber.Ctx) error {
 	if req.BatchID <= 0 || req.EventType == "" || req.Location == "" || req.ActorID <= 0 {
 		return fiber.NewError(fiber.StatusBadRequest, "Batch ID, event type, location, and actor ID are required")
 	}
+	if err := validateEventMetadata(req.EventType, req.Metadata); err != nil {
+		return err
+	}
 
 	// Check if batch exists
 	var exists bool
@@ -100,6 +117,13 @@ func CreateEvent(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusNotFound, "Actor not found")
 	}
 
+	// A new larval stage must plausibly follow the stages already recorded
+	if req.EventType == stageEventType {
+		if err := validateStageProgression(req.BatchID, req.Metadata, time.Now(), 0); err != nil {
+			return err
+		}
+	}
+
 	// Initialize blockchain client
 	blockchainClient := blockchain.NewBlockchainClient(
 		os.Getenv("BLOCKCHAIN_NODE_URL"),
@@ -120,6 +144,30 @@ func CreateEvent(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to convert metadata to JSONB")
 	}
 
+	if isDryRun(c) {
+		effects := []string{
+			"Submit a RECORD_EVENT transaction to the blockchain",
+			"Insert the event",
+		}
+		if newStatus, ok := req.Metadata["new_status"].(string); ok && newStatus != "" && req.EventType == "status_change" {
+			effects = append(effects, "Change the batch status to "+newStatus)
+		}
+		effects = append(effects, "Push the event to chains the batch is shared with")
+		return dryRunResponse(c, "Dry run: the event would be created", DryRunResult{
+			Action: "create_event",
+			Record: models.Event{
+				BatchID:   req.BatchID,
+				EventType: req.EventType,
+				ActorID:   req.ActorID,
+				Location:  req.Location,
+				Metadata:  metadataJSONB,
+				IsActive:  true,
+			},
+			Effects:  effects,
+			Warnings: batchDryRunWarnings(req.BatchID),
+		})
+	}
+
 	// Record event on blockchain
 	txID, err := blockchainClient.RecordEvent(
 		strconv.Itoa(req.BatchID),
@@ -128,6 +176,7 @@ func CreateEvent(c *fiber.Ctx) error {
 		strconv.Itoa(req.ActorID),
 		req.Metadata,
 	)
+	anchorErr := err
 	if err != nil {
 		// Log error but continue - blockchain is secondary to database
 		fmt.Printf("Warning: Failed to record event on blockchain: %v\n", err)
@@ -158,6 +207,9 @@ func CreateEvent(c *fiber.Ctx) error {
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save event to database")
 	}
+	if anchorErr != nil {
+		notifyAnchoringFailed(0, "event", event.ID, event.BatchID, anchorErr.Error())
+	}
 
 	// Record blockchain transaction
 	if txID != "" {
@@ -200,10 +252,15 @@ func CreateEvent(c *fiber.Ctx) error {
 			if err != nil {
 				// Log error but don't fail the request
 				fmt.Printf("Warning: Failed to update batch status: %v\n", err)
+			} else {
+				publishBatchStatusChanged(event.BatchID, "", newStatus, "status_change_event")
 			}
 		}
 	}
 
+	// Push the new event to chains the batch was shared with
+	chainsync.NotifyBatch(event.BatchID)
+
 	// Return success response
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
 		Success: true,
@@ -246,6 +303,46 @@ func RecordEnvironmentData(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
 	}
 
+	var envData models.EnvironmentData
+	envData.BatchID = req.BatchID
+	envData.Temperature = req.Temperature
+	envData.PH = req.PH
+	envData.Salinity = req.Salinity
+	envData.Density = req.Density
+	envData.Age = req.Age
+	envData.Parameters = req.Parameters
+	envData.IsActive = true
+
+	// Readings of a device overdue for calibration are kept but flagged as low confidence
+	if req.DeviceID != 0 {
+		device, err := readingDevice(req.DeviceID, req.BatchID)
+		if err != nil {
+			return err
+		}
+		envData.DeviceID = &device.ID
+		envData.LowConfidence = device.CalibrationOverdue
+	}
+
+	// Validate values against the parameter catalog
+	catalog, err := environmentCatalog()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment parameters")
+	}
+	if err := validateEnvironmentData(envData, catalog); err != nil {
+		return err
+	}
+
+	// Score sensor readings; low-quality points are stored but suppressed from charts and alerts
+	if envData.DeviceID != nil {
+		assessment, err := assessReading(envData, catalog)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to score reading quality")
+		}
+		envData.QualityScore = &assessment.Score
+		envData.QualityFlags = assessment.Flags
+		envData.Suppressed = assessment.Suppressed
+	}
+
 	// Initialize blockchain client
 	blockchainClient := blockchain.NewBlockchainClient(
 		os.Getenv("BLOCKCHAIN_NODE_URL"),
@@ -260,6 +357,9 @@ func RecordEnvironmentData(c *fiber.Ctx) error {
 		"density": req.Density,
 		"age":    req.Age,
 	}
+	for code, value := range req.Parameters {
+		otherParams[code] = value
+	}
 	txID, err := blockchainClient.RecordEnvironmentData(
 		strconv.Itoa(req.BatchID),
 		req.Temperature,
@@ -275,19 +375,11 @@ func RecordEnvironmentData(c *fiber.Ctx) error {
 
 	// Insert environment data into database
 	query := `
-		INSERT INTO environment_data (batch_id, temperature, ph, salinity, density, age, timestamp, updated_at, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW(), true)
+		INSERT INTO environment_data (batch_id, temperature, ph, salinity, density, age, custom_parameters, device_id, low_confidence,
+			quality_score, quality_flags, suppressed, timestamp, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW(), NOW(), true)
 		RETURNING id, timestamp
 	`
-	var envData models.EnvironmentData
-	envData.BatchID = req.BatchID
-	envData.Temperature = req.Temperature
-	envData.PH = req.PH
-	envData.Salinity = req.Salinity
-	envData.Density = req.Density
-	envData.Age = req.Age
-	envData.IsActive = true
-
 	err = db.DB.QueryRow(
 		query,
 		envData.BatchID,
@@ -296,6 +388,12 @@ func RecordEnvironmentData(c *fiber.Ctx) error {
 		envData.Salinity,
 		envData.Density,
 		envData.Age,
+		encodeEnvironmentParameters(envData.Parameters),
+		envData.DeviceID,
+		envData.LowConfidence,
+		envData.QualityScore,
+		pq.Array(envData.QualityFlags),
+		envData.Suppressed,
 	).Scan(&envData.ID, &envData.Timestamp)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save environment data to database")
@@ -312,6 +410,10 @@ func RecordEnvironmentData(c *fiber.Ctx) error {
 			"salinity":     req.Salinity,
 			"density":      req.Density,
 			"age":          req.Age,
+			"parameters":   req.Parameters,
+			"device_id":    envData.DeviceID,
+			"low_confidence": envData.LowConfidence,
+			"quality_score": envData.QualityScore,
 			"timestamp":    envData.Timestamp,
 		}
 		metadataHash, err := blockchainClient.HashData(metadataForHash)
@@ -329,10 +431,16 @@ func RecordEnvironmentData(c *fiber.Ctx) error {
 		}
 	}
 
+	// Raise alerts for values outside their optimal range
+	message := "Environment data recorded successfully"
+	if alerts := raiseEnvironmentAlerts(&envData, catalog); len(alerts) > 0 {
+		message = fmt.Sprintf("Environment data recorded with %d alert(s)", len(alerts))
+	}
+
 	// Return success response
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
 		Success: true,
-		Message: "Environment data recorded successfully",
+		Message: message,
 		Data:    envData,
 	})
 }
@@ -347,6 +455,8 @@ func RecordEnvironmentData(c *fiber.Ctx) error {
 // @Param doc_type formData string true "Document type"
 // @Param uploaded_by formData int true "Uploader ID"
 // @Param file formData file true "Document file"
+// @Param sensitivity formData string false "public, internal, confidential or restricted; classified from the document type when omitted"
+// @Param dry_run query bool false "Only validate and describe what would happen, without writing to the database, IPFS or the chain"
 // @Success 201 {object} SuccessResponse{data=models.Document}
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
@@ -403,6 +513,15 @@ func UploadDocument(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusNotFound, "Uploader not found or inactive")
 	}
 
+	// Classify the document; who may see it depends on its sensitivity
+	var sensitivity string
+	if values := form.Value["sensitivity"]; len(values) > 0 {
+		sensitivity = values[0]
+	}
+	if sensitivity, err = uploadedDocumentSensitivity(sensitivity, docType); err != nil {
+		return err
+	}
+
 	// Get file
 	files := form.File["file"]
 	if len(files) == 0 {
@@ -415,6 +534,27 @@ func UploadDocument(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "File size exceeds 10MB limit")
 	}
 
+	if isDryRun(c) {
+		return dryRunResponse(c, "Dry run: the document would be uploaded", DryRunResult{
+			Action: "upload_document",
+			Record: models.Document{
+				BatchID:    batchID,
+				DocType:    docType,
+				FileName:   file.Filename,
+				FileSize:   file.Size,
+				UploadedBy:  uploaderID,
+				Sensitivity: sensitivity,
+				IsActive:    true,
+			},
+			Effects: []string{
+				"Upload the file to IPFS and pin it on Pinata",
+				"Submit a RECORD_DOCUMENT transaction to the blockchain",
+				"Insert the document",
+			},
+			Warnings: batchDryRunWarnings(batchID),
+		})
+	}
+
 	// Open file
 	fileHandle, err := file.Open()
 	if err != nil {
@@ -422,9 +562,6 @@ func UploadDocument(c *fiber.Ctx) error {
 	}
 	defer fileHandle.Close()
 
-	// Initialize IPFS+Pinata service with connection pooling
-	ipfsPinataService := ipfs.NewIPFSPinataService()
-
 	// Define metadata for Pinata
 	metadata := map[string]string{
 		"batch_id":     batchIDStr,
@@ -434,9 +571,12 @@ func UploadDocument(c *fiber.Ctx) error {
 		"timestamp":     time.Now().Format(time.RFC3339),
 	}
 
-	// Upload file to IPFS and pin to Pinata with retries and timeouts
-	ipfsResult, err := ipfsPinataService.UploadFile(fileHandle, file.Filename, metadata, true)
+	// Upload file to IPFS and pin to Pinata with retries and timeouts, or to the residency region of the batch owner
+	ipfsResult, placement, err := uploadDocumentFile(companyOfDocumentBatch(batchID), fileHandle, file.Filename, metadata)
 	if err != nil {
+		if isRequestError(err) {
+			return err
+		}
 		return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Failed to upload file: %v", err))
 	}
 
@@ -458,8 +598,8 @@ func UploadDocument(c *fiber.Ctx) error {
 
 	// Insert document into database
 	query := `
-		INSERT INTO document (batch_id, doc_type, ipfs_hash, ipfs_uri, file_name, file_size, uploaded_by, uploaded_at, updated_at, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW(), true)
+		INSERT INTO document (batch_id, doc_type, ipfs_hash, ipfs_uri, file_name, file_size, uploaded_by, sensitivity, storage_region, storage_backend, region_locked, uploaded_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), NOW(), true)
 		RETURNING id, uploaded_at
 	`
 	var doc models.Document
@@ -477,6 +617,10 @@ func UploadDocument(c *fiber.Ctx) error {
 	doc.FileName = ipfsResult.Name
 	doc.FileSize = ipfsResult.Size
 	doc.UploadedBy = uploaderID
+	doc.Sensitivity = sensitivity
+	doc.StorageRegion = placement.Region
+	doc.StorageBackend = placement.Backend
+	doc.RegionLocked = placement.Locked
 	doc.IsActive = true
 
 	// Debugging: Log the query and parameters before execution
@@ -494,12 +638,24 @@ func UploadDocument(c *fiber.Ctx) error {
 		doc.FileName,
 		doc.FileSize,
 		doc.UploadedBy,
+		doc.Sensitivity,
+		doc.StorageRegion,
+		doc.StorageBackend,
+		doc.RegionLocked,
 	).Scan(&doc.ID, &doc.UploadedAt)
 	if err != nil {
 		// Log the error for debugging
 		fmt.Printf("Database error: %v\n", err)
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save document to database")
 	}
+	publishDomainEvent(eventbus.DocumentUploaded, 0, batchID, map[string]interface{}{
+		"document_id": doc.ID,
+		"doc_type":    docType,
+		"file_name":   doc.FileName,
+		"ipfs_hash":   doc.IPFSHash,
+		"ipfs_uri":    doc.IPFSURI,
+		"uploaded_by": uploaderID,
+	})
 
 	// Record blockchain transaction
 	if txID != "" {
@@ -660,11 +816,17 @@ func GetDocumentByID(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid document ID format")
 	}
 
+	// The viewer's relationship to the batch must allow the document's sensitivity
+	if err := authorizeDocument(c, documentID); err != nil {
+		return err
+	}
+
 	// Query document from database with all necessary fields
 	var doc models.Document
 	query := `
-		SELECT d.id, d.batch_id, d.doc_type, d.ipfs_hash, d.file_name, d.file_size, 
-		       d.uploaded_by, d.uploaded_at, d.updated_at, d.is_active
+		SELECT d.id, COALESCE(d.batch_id, 0), d.doc_type, d.ipfs_hash, d.file_name, d.file_size, 
+		       COALESCE(d.uploaded_by, 0), d.uploaded_at, d.updated_at, d.is_active, d.sensitivity,
+		       COALESCE(d.ipfs_uri, ''), COALESCE(d.storage_region, ''), COALESCE(d.storage_backend, ''), d.region_locked
 		FROM document d
 		WHERE d.id = $1 AND d.is_active = true
 	`
@@ -679,6 +841,11 @@ func GetDocumentByID(c *fiber.Ctx) error {
 		&doc.UploadedAt,
 		&doc.UpdatedAt,
 		&doc.IsActive,
+		&doc.Sensitivity,
+		&doc.IPFSURI,
+		&doc.StorageRegion,
+		&doc.StorageBackend,
+		&doc.RegionLocked,
 	)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
@@ -693,9 +860,11 @@ func GetDocumentByID(c *fiber.Ctx) error {
 		ipfsGatewayURL = "https://ipfs.io/ipfs"
 	}
 	
-	// Create IPFS URI
-	ipfsClient := ipfs.NewIPFSClient(os.Getenv("IPFS_NODE_URL"))
-	doc.IPFSURI = ipfsClient.CreateIPFSURL(doc.IPFSHash, ipfsGatewayURL)
+	// Create IPFS URI; region-locked files keep the URI of their regional backend rather than a public gateway
+	if !doc.RegionLocked {
+		ipfsClient := ipfs.NewIPFSClient(os.Getenv("IPFS_NODE_URL"))
+		doc.IPFSURI = ipfsClient.CreateIPFSURL(doc.IPFSHash, ipfsGatewayURL)
+	}
 	
 	// Get uploader information
 	var uploader models.Account
@@ -852,13 +1021,11 @@ func TraceByQRCode(c *fiber.Ctx) error {
         return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve batch data")
     }
 
-    // Get events with actor information
+    // Get events; their actors are resolved together below
     rows, err := db.DB.Query(`
-        SELECT e.id, e.batch_id, e.event_type, e.actor_id, e.location, e.timestamp, e.metadata, e.updated_at, e.is_active,
-               a.username, a.role, a.email
+        SELECT e.id, e.batch_id, e.event_type, e.actor_id, e.location, e.timestamp, e.metadata, e.updated_at, e.is_active
         FROM event e
-        JOIN account a ON e.actor_id = a.id
-        WHERE e.batch_id = $1 AND e.is_active = true
+        WHERE e.batch_id = $1 AND e.is_active = true AND e.superseded_by_event_id IS NULL
         ORDER BY e.timestamp DESC
     `, batchID)
     if err != nil {
@@ -879,23 +1046,40 @@ func TraceByQRCode(c *fiber.Ctx) error {
             &event.Metadata,
             &event.UpdatedAt,
             &event.IsActive,
-            &event.ActorName,
-            &event.ActorRole,
-            &event.ActorEmail,
         )
         if err != nil {
             return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse event data")
         }
         eventsWithActor = append(eventsWithActor, event)
     }
+    if err := resolveEventActors(eventsWithActor); err != nil {
+        return fiber.NewError(fiber.StatusInternalServerError, "Failed to resolve event actors")
+    }
 
-    // Get documents
+    // Corrected events show their latest values, with the earlier versions as correction history
+    corrections, err := loadEventCorrections(batchID)
+    if err != nil {
+        return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve event corrections")
+    }
+    for i := range eventsWithActor {
+        if history, ok := corrections[eventsWithActor[i].ID]; ok {
+            eventsWithActor[i].Corrections = history
+            eventsWithActor[i].SupersedesEventID = &history[0].EventID
+            eventsWithActor[i].CorrectionReason = history[0].CorrectionReason
+        }
+    }
+
+    // Get documents the caller may see; consumers scanning the code only see public ones
+    docLevels, err := visibleBatchDocumentLevels(c, batchID)
+    if err != nil {
+        return err
+    }
     docRows, err := db.DB.Query(`
-        SELECT id, batch_id, doc_type, ipfs_hash, uploaded_by, uploaded_at, updated_at, is_active
+        SELECT id, batch_id, doc_type, ipfs_hash, uploaded_by, uploaded_at, updated_at, is_active, sensitivity
         FROM document
-        WHERE batch_id = $1 AND is_active = true
+        WHERE batch_id = $1 AND is_active = true`+documentSensitivityFilter("", 2)+`
         ORDER BY uploaded_at DESC
-    `, batchID)
+    `, batchID, docLevels)
     if err != nil {
         return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve documents")
     }
@@ -913,6 +1097,7 @@ func TraceByQRCode(c *fiber.Ctx) error {
             &doc.UploadedAt,
             &doc.UpdatedAt,
             &doc.IsActive,
+            &doc.Sensitivity,
         )
         if err != nil {
             return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse document data")
@@ -1062,6 +1247,12 @@ func TraceByQRCode(c *fiber.Ctx) error {
         blockchainRecords = append(blockchainRecords, record)
     }
 
+    // Larval stages the batch went through
+    stageTimeline, err := loadStageTimeline(batchID)
+    if err != nil {
+        return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve stage timeline")
+    }
+
     // Create response with all data
     response := TraceByQRCodeResponse{
         Batch:           batchWithHatchery,
@@ -1070,6 +1261,7 @@ func TraceByQRCode(c *fiber.Ctx) error {
         EnvironmentData: envDataList,
         LogisticsChain:  logisticsChain,
         BlockchainInfo:  blockchainRecords,
+        StageTimeline:   stageTimeline,
     }
 
     // Return success response
@@ -1217,14 +1409,20 @@ func GetCurrentUser(c *fiber.Ctx) error {
 	}
 	
 	completionPercentage := int((float64(completionFields) / float64(totalFields)) * 100)
+
+	preferences, err := loadUserPreferences(claims.UserID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load preferences")
+	}
 	
-	// Return success response with user data and profile completion
+	// Return success response with user data, profile completion and preferences
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "User retrieved successfully",
 		Data: map[string]interface{}{
 			"user": user,
 			"profile_completion": completionPercentage,
+			"preferences": preferences,
 		},
 	})
 }
@@ -1363,6 +1561,7 @@ func UpdateCurrentUser(c *fiber.Ctx) error {
 		fmt.Printf("Error updating user profile: %v\n", err)
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update profile")
 	}
+	actors.Default().Invalidate(claims.UserID)
 	
 	// Get updated user data to return in the response
 	var user models.User
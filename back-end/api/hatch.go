@@ -579,6 +579,7 @@ func GetHatcheryBatches(c *fiber.Ctx) error {
 		}
 		batches = append(batches, batch)
 	}
+	attachCompleteness(batches)
 
 	// Return success response
 	return c.JSON(SuccessResponse{
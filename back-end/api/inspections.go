@@ -0,0 +1,1331 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/ipfs"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+)
+
+// Field types of an inspection checklist
+const (
+	InspectionFieldText    = "text"
+	InspectionFieldNumber  = "number"
+	InspectionFieldBoolean = "boolean"
+	InspectionFieldChoice  = "choice"
+	InspectionFieldDate    = "date"
+	InspectionFieldPhoto   = "photo"
+)
+
+// What an inspection form is filled in for
+const (
+	InspectionTargetBatch    = "batch"
+	InspectionTargetHatchery = "hatchery"
+)
+
+// Statuses of an inspection submission
+const (
+	InspectionStatusDraft     = "draft"
+	InspectionStatusCompleted = "completed"
+)
+
+// EventTypeInspectionCompleted is the batch event recorded when an inspection is completed
+const EventTypeInspectionCompleted = "inspection_completed"
+
+// InspectionFieldOption is an answer of a choice field and the share of the field's weight it earns
+type InspectionFieldOption struct {
+	Value string  `json:"value"`
+	Score float64 `json:"score"` // 0 to 1
+}
+
+// InspectionField is a question of an inspection checklist
+type InspectionField struct {
+	Key            string                  `json:"key"`
+	Label          string                  `json:"label"`
+	Type           string                  `json:"type"` // text, number, boolean, choice, date, photo
+	Required       bool                    `json:"required"`
+	Options        []InspectionFieldOption `json:"options,omitempty"` // choice fields only
+	Min            *float64                `json:"min,omitempty"`     // Accepted range of number fields
+	Max            *float64                `json:"max,omitempty"`
+	Weight         float64                 `json:"weight"`          // Points of boolean, number and choice fields
+	PhotosRequired int                     `json:"photos_required"` // Photos that must be attached to the field
+	Critical       bool                    `json:"critical"`        // A failed critical field fails the whole inspection
+}
+
+// InspectionForm is a company's inspection checklist definition
+type InspectionForm struct {
+	ID          int               `json:"id"`
+	CompanyID   int               `json:"company_id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	TargetType  string            `json:"target_type"` // batch or hatchery
+	Fields      []InspectionField `json:"fields"`
+	PassScore   float64           `json:"pass_score"` // Minimum score percentage to pass
+	Standards   []string          `json:"standards"`  // Compliance standards that require this inspection
+	Version     int               `json:"version"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// InspectionFormRequest represents a request to create or update an inspection form
+type InspectionFormRequest struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	TargetType  string            `json:"target_type"`
+	Fields      []InspectionField `json:"fields"`
+	PassScore   float64           `json:"pass_score"`
+	Standards   []string          `json:"standards"`
+}
+
+// InspectionPhoto is a photo attached to a field of an inspection submission
+type InspectionPhoto struct {
+	ID           int       `json:"id"`
+	SubmissionID int       `json:"submission_id"`
+	FieldKey     string    `json:"field_key"`
+	IPFSHash     string    `json:"ipfs_hash"`
+	IPFSURI      string    `json:"ipfs_uri"`
+	FileName     string    `json:"file_name"`
+	FileSize     int64     `json:"file_size"`
+	UploadedAt   time.Time `json:"uploaded_at"`
+}
+
+// InspectionSubmission is an inspector's response to an inspection form
+type InspectionSubmission struct {
+	ID           int                    `json:"id"`
+	FormID       int                    `json:"form_id"`
+	FormVersion  int                    `json:"form_version"`
+	BatchID      *int                   `json:"batch_id,omitempty"`
+	HatcheryID   *int                   `json:"hatchery_id,omitempty"`
+	InspectorID  int                    `json:"inspector_id"`
+	Answers      map[string]interface{} `json:"answers"`
+	Location     string                 `json:"location"`
+	Notes        string                 `json:"notes"`
+	Status       string                 `json:"status"`
+	Score        float64                `json:"score"`
+	MaxScore     float64                `json:"max_score"`
+	ScorePercent float64                `json:"score_percent"`
+	Passed       bool                   `json:"passed"`
+	SubmittedAt  *time.Time             `json:"submitted_at,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	Photos       []InspectionPhoto      `json:"photos"`
+}
+
+// InspectionSubmissionRequest represents a request to start or update an inspection submission
+type InspectionSubmissionRequest struct {
+	BatchID     int                    `json:"batch_id"`    // Required for batch forms
+	HatcheryID  int                    `json:"hatchery_id"` // Required for hatchery forms
+	InspectorID int                    `json:"inspector_id"`
+	Answers     map[string]interface{} `json:"answers"`
+	Location    string                 `json:"location"`
+	Notes       string                 `json:"notes"`
+}
+
+// InspectionResult is the scoring of a submission against its form
+type InspectionResult struct {
+	Score          float64  `json:"score"`
+	MaxScore       float64  `json:"max_score"`
+	ScorePercent   float64  `json:"score_percent"`
+	Passed         bool     `json:"passed"`
+	Missing        []string `json:"missing"`         // Required answers or photos not provided
+	FailedCritical []string `json:"failed_critical"` // Critical fields that earned no points
+}
+
+// InspectionCompletion is the response of completing an inspection
+type InspectionCompletion struct {
+	Submission InspectionSubmission `json:"submission"`
+	Result     InspectionResult     `json:"result"`
+}
+
+const inspectionFormColumns = `
+	id, COALESCE(company_id, 0), name, COALESCE(description, ''), COALESCE(target_type, 'batch'), fields,
+	COALESCE(pass_score, 0), COALESCE(standards, '{}'), COALESCE(version, 1), created_at, updated_at
+`
+
+// scanInspectionForm reads an inspection form selected with inspectionFormColumns
+func scanInspectionForm(row rowScanner) (InspectionForm, error) {
+	var f InspectionForm
+	var fields []byte
+	err := row.Scan(&f.ID, &f.CompanyID, &f.Name, &f.Description, &f.TargetType, &fields,
+		&f.PassScore, pq.Array(&f.Standards), &f.Version, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return f, err
+	}
+	if f.Standards == nil {
+		f.Standards = []string{}
+	}
+	return f, json.Unmarshal(fields, &f.Fields)
+}
+
+// loadInspectionForm loads an active inspection form
+func loadInspectionForm(formID int) (InspectionForm, error) {
+	return scanInspectionForm(db.DB.QueryRow(`SELECT `+inspectionFormColumns+` FROM inspection_form WHERE id = $1 AND is_active = true`, formID))
+}
+
+const inspectionSubmissionColumns = `
+	id, form_id, COALESCE(form_version, 1), batch_id, hatchery_id, COALESCE(inspector_id, 0), answers,
+	COALESCE(location, ''), COALESCE(notes, ''), COALESCE(status, 'draft'), COALESCE(score, 0), COALESCE(max_score, 0),
+	COALESCE(score_percent, 0), COALESCE(passed, false), submitted_at, created_at, updated_at
+`
+
+// scanInspectionSubmission reads a submission selected with inspectionSubmissionColumns
+func scanInspectionSubmission(row rowScanner) (InspectionSubmission, error) {
+	var s InspectionSubmission
+	var batchID, hatcheryID sql.NullInt64
+	var submittedAt sql.NullTime
+	var answers []byte
+	err := row.Scan(&s.ID, &s.FormID, &s.FormVersion, &batchID, &hatcheryID, &s.InspectorID, &answers,
+		&s.Location, &s.Notes, &s.Status, &s.Score, &s.MaxScore,
+		&s.ScorePercent, &s.Passed, &submittedAt, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return s, err
+	}
+	s.BatchID = intPtr(batchID)
+	s.HatcheryID = intPtr(hatcheryID)
+	s.SubmittedAt = timePtr(submittedAt)
+	s.Photos = []InspectionPhoto{}
+	return s, json.Unmarshal(answers, &s.Answers)
+}
+
+// loadInspectionSubmission loads an active submission with its photos
+func loadInspectionSubmission(submissionID int) (InspectionSubmission, error) {
+	submission, err := scanInspectionSubmission(db.DB.QueryRow(`SELECT `+inspectionSubmissionColumns+`
+		FROM inspection_submission WHERE id = $1 AND is_active = true`, submissionID))
+	if err != nil {
+		return submission, err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, submission_id, field_key, COALESCE(ipfs_hash, ''), COALESCE(ipfs_uri, ''),
+			COALESCE(file_name, ''), COALESCE(file_size, 0), uploaded_at
+		FROM inspection_photo
+		WHERE submission_id = $1 AND is_active = true
+		ORDER BY uploaded_at, id
+	`, submissionID)
+	if err != nil {
+		return submission, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p InspectionPhoto
+		if err := rows.Scan(&p.ID, &p.SubmissionID, &p.FieldKey, &p.IPFSHash, &p.IPFSURI,
+			&p.FileName, &p.FileSize, &p.UploadedAt); err != nil {
+			return submission, err
+		}
+		submission.Photos = append(submission.Photos, p)
+	}
+	return submission, rows.Err()
+}
+
+// validateInspectionFormRequest checks the fields of an inspection form request
+func validateInspectionFormRequest(req *InspectionFormRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Form name is required")
+	}
+	if req.TargetType == "" {
+		req.TargetType = InspectionTargetBatch
+	}
+	if req.TargetType != InspectionTargetBatch && req.TargetType != InspectionTargetHatchery {
+		return fiber.NewError(fiber.StatusBadRequest, "Target type must be batch or hatchery")
+	}
+	if req.PassScore < 0 || req.PassScore > 100 {
+		return fiber.NewError(fiber.StatusBadRequest, "Pass score must be between 0 and 100")
+	}
+	if req.Standards == nil {
+		req.Standards = []string{}
+	}
+	if len(req.Fields) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "A form needs at least one field")
+	}
+
+	keys := map[string]bool{}
+	for i := range req.Fields {
+		f := &req.Fields[i]
+		f.Key = strings.TrimSpace(f.Key)
+		if f.Key == "" {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Field %d needs a key", i+1))
+		}
+		if keys[f.Key] {
+			return fiber.NewError(fiber.StatusBadRequest, "Duplicate field key: "+f.Key)
+		}
+		keys[f.Key] = true
+		if f.Label == "" {
+			f.Label = f.Key
+		}
+		if f.Weight < 0 || f.PhotosRequired < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "Weight and required photos of field "+f.Key+" must not be negative")
+		}
+
+		switch f.Type {
+		case InspectionFieldBoolean:
+		case InspectionFieldNumber:
+			if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+				return fiber.NewError(fiber.StatusBadRequest, "Minimum of field "+f.Key+" is above its maximum")
+			}
+		case InspectionFieldChoice:
+			if len(f.Options) == 0 {
+				return fiber.NewError(fiber.StatusBadRequest, "Choice field "+f.Key+" needs options")
+			}
+			values := map[string]bool{}
+			for _, o := range f.Options {
+				if o.Value == "" || values[o.Value] {
+					return fiber.NewError(fiber.StatusBadRequest, "Options of field "+f.Key+" must be unique and not empty")
+				}
+				if o.Score < 0 || o.Score > 1 {
+					return fiber.NewError(fiber.StatusBadRequest, "Option scores of field "+f.Key+" must be between 0 and 1")
+				}
+				values[o.Value] = true
+			}
+		case InspectionFieldText, InspectionFieldDate, InspectionFieldPhoto:
+			if f.Weight != 0 {
+				return fiber.NewError(fiber.StatusBadRequest, "Only boolean, number and choice fields can be scored")
+			}
+			if f.Type == InspectionFieldPhoto && f.Required && f.PhotosRequired == 0 {
+				f.PhotosRequired = 1
+			}
+		default:
+			return fiber.NewError(fiber.StatusBadRequest, "Field type must be text, number, boolean, choice, date or photo")
+		}
+	}
+	return nil
+}
+
+// validateInspectionAnswers checks that answers belong to the form's fields and have the right types
+func validateInspectionAnswers(form InspectionForm, answers map[string]interface{}) error {
+	fields := map[string]InspectionField{}
+	for _, f := range form.Fields {
+		fields[f.Key] = f
+	}
+	for key, value := range answers {
+		f, ok := fields[key]
+		if !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "Unknown field: "+key)
+		}
+		if value == nil {
+			continue
+		}
+		valid := true
+		switch f.Type {
+		case InspectionFieldBoolean:
+			_, valid = value.(bool)
+		case InspectionFieldNumber:
+			_, valid = value.(float64)
+		case InspectionFieldChoice:
+			s, isString := value.(string)
+			valid = false
+			for _, o := range f.Options {
+				if isString && o.Value == s {
+					valid = true
+				}
+			}
+		case InspectionFieldDate:
+			s, isString := value.(string)
+			_, err := time.Parse("2006-01-02", s)
+			valid = isString && err == nil
+		case InspectionFieldText:
+			_, valid = value.(string)
+		case InspectionFieldPhoto:
+			valid = false
+		}
+		if !valid {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid answer for "+f.Type+" field "+key)
+		}
+	}
+	return nil
+}
+
+// scoreInspection scores answers and attached photos against the fields of a form
+func scoreInspection(form InspectionForm, answers map[string]interface{}, photoCounts map[string]int) InspectionResult {
+	result := InspectionResult{Missing: []string{}, FailedCritical: []string{}}
+	for _, f := range form.Fields {
+		if photoCounts[f.Key] < f.PhotosRequired {
+			result.Missing = append(result.Missing, fmt.Sprintf("%s: %d photo(s) required", f.Label, f.PhotosRequired))
+		}
+
+		value, answered := answers[f.Key]
+		if s, ok := value.(string); value == nil || ok && strings.TrimSpace(s) == "" {
+			answered = false
+		}
+		if !answered && f.Required && f.Type != InspectionFieldPhoto {
+			result.Missing = append(result.Missing, f.Label)
+		}
+
+		// A field fails when it earns none of its points, which critical fields do not allow
+		earned, failed := 0.0, true
+		switch f.Type {
+		case InspectionFieldBoolean:
+			if v, ok := value.(bool); ok && v {
+				earned, failed = f.Weight, false
+			}
+		case InspectionFieldNumber:
+			if v, ok := value.(float64); ok && (f.Min == nil || v >= *f.Min) && (f.Max == nil || v <= *f.Max) {
+				earned, failed = f.Weight, false
+			}
+		case InspectionFieldChoice:
+			for _, o := range f.Options {
+				if v, ok := value.(string); ok && v == o.Value {
+					earned, failed = f.Weight*o.Score, o.Score == 0
+				}
+			}
+		default:
+			continue
+		}
+		result.Score += earned
+		result.MaxScore += f.Weight
+		if f.Critical && failed {
+			result.FailedCritical = append(result.FailedCritical, f.Label)
+		}
+	}
+
+	result.ScorePercent = 100
+	if result.MaxScore > 0 {
+		result.ScorePercent = result.Score / result.MaxScore * 100
+	}
+	result.Passed = len(result.Missing) == 0 && len(result.FailedCritical) == 0 && result.ScorePercent >= form.PassScore
+	return result
+}
+
+// inspectionPhotoCounts counts the photos attached to each field of a submission
+func inspectionPhotoCounts(photos []InspectionPhoto) map[string]int {
+	counts := map[string]int{}
+	for _, p := range photos {
+		counts[p.FieldKey]++
+	}
+	return counts
+}
+
+// parseInspectionSubmissionID parses the submission ID path parameter and loads the submission
+func parseInspectionSubmissionID(c *fiber.Ctx) (InspectionSubmission, error) {
+	submissionID, err := strconv.Atoi(c.Params("submissionId"))
+	if err != nil {
+		return InspectionSubmission{}, fiber.NewError(fiber.StatusBadRequest, "Invalid inspection ID format")
+	}
+	submission, err := loadInspectionSubmission(submissionID)
+	if err == sql.ErrNoRows {
+		return submission, fiber.NewError(fiber.StatusNotFound, "Inspection not found")
+	}
+	if err != nil {
+		return submission, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	return submission, nil
+}
+
+// ListInspectionForms lists the inspection forms of a company
+// @Summary List inspection forms
+// @Description List the on-site inspection checklists defined by a company
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param target_type query string false "Target type (batch, hatchery)"
+// @Success 200 {object} SuccessResponse{data=[]InspectionForm}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/inspection-forms [get]
+func ListInspectionForms(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+inspectionFormColumns+`
+		FROM inspection_form
+		WHERE company_id = $1 AND is_active = true AND ($2::text = '' OR target_type = $2)
+		ORDER BY name, id
+	`, companyID, c.Query("target_type"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	forms := []InspectionForm{}
+	for rows.Next() {
+		form, err := scanInspectionForm(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse inspection form")
+		}
+		forms = append(forms, form)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Inspection forms retrieved successfully",
+		Data:    forms,
+	})
+}
+
+// CreateInspectionForm creates an inspection form for a company
+// @Summary Create inspection form
+// @Description Define an on-site inspection checklist with field types, required photos and scoring
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param request body InspectionFormRequest true "Inspection form"
+// @Success 201 {object} SuccessResponse{data=InspectionForm}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/inspection-forms [post]
+func CreateInspectionForm(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	var req InspectionFormRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateInspectionFormRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", companyID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+
+	fields, err := json.Marshal(req.Fields)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to encode form fields")
+	}
+	form, err := scanInspectionForm(db.DB.QueryRow(`
+		INSERT INTO inspection_form (company_id, name, description, target_type, fields, pass_score, standards,
+			version, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, 1, NOW(), NOW(), true)
+		RETURNING `+inspectionFormColumns,
+		companyID, req.Name, req.Description, req.TargetType, string(fields), req.PassScore, pq.Array(req.Standards)))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save inspection form")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Inspection form created successfully",
+		Data:    form,
+	})
+}
+
+// GetInspectionForm retrieves an inspection form
+// @Summary Get inspection form
+// @Description Retrieve an inspection checklist definition
+// @Tags inspections
+// @Produce json
+// @Param formId path int true "Inspection form ID"
+// @Success 200 {object} SuccessResponse{data=InspectionForm}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /inspection-forms/{formId} [get]
+func GetInspectionForm(c *fiber.Ctx) error {
+	formID, err := strconv.Atoi(c.Params("formId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid inspection form ID format")
+	}
+
+	form, err := loadInspectionForm(formID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Inspection form not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Inspection form retrieved successfully",
+		Data:    form,
+	})
+}
+
+// UpdateInspectionForm updates an inspection form
+// @Summary Update inspection form
+// @Description Update an inspection checklist. The form version is increased so submissions record which version they answered
+// @Tags inspections
+// @Accept json
+// @Produce json
+// @Param formId path int true "Inspection form ID"
+// @Param request body InspectionFormRequest true "Inspection form"
+// @Success 200 {object} SuccessResponse{data=InspectionForm}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /inspection-forms/{formId} [put]
+func UpdateInspectionForm(c *fiber.Ctx) error {
+	formID, err := strconv.Atoi(c.Params("formId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid inspection form ID format")
+	}
+
+	var req InspectionFormRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateInspectionFormRequest(&req); err != nil {
+		return err
+	}
+
+	fields, err := json.Marshal(req.Fields)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to encode form fields")
+	}
+	form, err := scanInspectionForm(db.DB.QueryRow(`
+		UPDATE inspection_form
+		SET name = $1, description = $2, target_type = $3, fields = $4, pass_score = $5, standards = $6,
+			version = COALESCE(version, 1) + 1, updated_at = NOW()
+		WHERE id = $7 AND is_active = true
+		RETURNING `+inspectionFormColumns,
+		req.Name, req.Description, req.TargetType, string(fields), req.PassScore, pq.Array(req.Standards), formID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Inspection form not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update inspection form")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Inspection form updated successfully",
+		Data:    form,
+	})
+}
+
+// DeleteInspectionForm deletes an inspection form
+// @Summary Delete inspection form
+// @Description Soft delete an inspection checklist. Existing submissions are kept
+// @Tags inspections
+// @Produce json
+// @Param formId path int true "Inspection form ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /inspection-forms/{formId} [delete]
+func DeleteInspectionForm(c *fiber.Ctx) error {
+	formID, err := strconv.Atoi(c.Params("formId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid inspection form ID format")
+	}
+
+	result, err := db.DB.Exec("UPDATE inspection_form SET is_active = false, updated_at = NOW() WHERE id = $1 AND is_active = true", formID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Inspection form not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Inspection form deleted successfully",
+	})
+}
+
+// ListFormSubmissions lists the submissions of an inspection form
+// @Summary List inspection submissions
+// @Description List the submissions of an inspection form, newest first
+// @Tags inspections
+// @Produce json
+// @Param formId path int true "Inspection form ID"
+// @Param status query string false "Status (draft, completed)"
+// @Success 200 {object} SuccessResponse{data=[]InspectionSubmission}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /inspection-forms/{formId}/submissions [get]
+func ListFormSubmissions(c *fiber.Ctx) error {
+	formID, err := strconv.Atoi(c.Params("formId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid inspection form ID format")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+inspectionSubmissionColumns+`
+		FROM inspection_submission
+		WHERE form_id = $1 AND is_active = true AND ($2::text = '' OR status = $2)
+		ORDER BY created_at DESC, id DESC
+	`, formID, c.Query("status"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	submissions := []InspectionSubmission{}
+	for rows.Next() {
+		submission, err := scanInspectionSubmission(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse inspection")
+		}
+		submissions = append(submissions, submission)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Inspections retrieved successfully",
+		Data:    submissions,
+	})
+}
+
+// StartInspection starts a submission of an inspection form
+// @Summary Start inspection
+// @Description Start a draft response to an inspection form for a batch or hatchery, depending on the form's target type
+// @Tags inspections
+// @Accept json
+// @Produce json
+// @Param formId path int true "Inspection form ID"
+// @Param request body InspectionSubmissionRequest true "Inspection answers"
+// @Success 201 {object} SuccessResponse{data=InspectionSubmission}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /inspection-forms/{formId}/submissions [post]
+func StartInspection(c *fiber.Ctx) error {
+	formID, err := strconv.Atoi(c.Params("formId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid inspection form ID format")
+	}
+
+	var req InspectionSubmissionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.InspectorID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Inspector ID is required")
+	}
+	if req.Answers == nil {
+		req.Answers = map[string]interface{}{}
+	}
+
+	form, err := loadInspectionForm(formID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Inspection form not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if err := validateInspectionAnswers(form, req.Answers); err != nil {
+		return err
+	}
+
+	// The inspected batch or hatchery must belong to the company that owns the form
+	var exists bool
+	switch form.TargetType {
+	case InspectionTargetHatchery:
+		if req.HatcheryID <= 0 || req.BatchID != 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "This form is filled in for a hatchery; provide hatchery_id only")
+		}
+		err = db.DB.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM hatchery WHERE id = $1 AND company_id = $2 AND is_active = true)
+		`, req.HatcheryID, form.CompanyID).Scan(&exists)
+	default:
+		if req.BatchID <= 0 || req.HatcheryID != 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "This form is filled in for a batch; provide batch_id only")
+		}
+		err = db.DB.QueryRow(`
+			SELECT EXISTS(
+				SELECT 1 FROM batch b JOIN hatchery h ON h.id = b.hatchery_id
+				WHERE b.id = $1 AND COALESCE(b.owner_company_id, h.company_id) = $2 AND b.is_active = true
+			)
+		`, req.BatchID, form.CompanyID).Scan(&exists)
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Inspected "+form.TargetType+" not found for the form's company")
+	}
+
+	answers, err := json.Marshal(req.Answers)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to encode answers")
+	}
+	result := scoreInspection(form, req.Answers, nil)
+	submission, err := scanInspectionSubmission(db.DB.QueryRow(`
+		INSERT INTO inspection_submission (form_id, form_version, batch_id, hatchery_id, inspector_id, answers,
+			location, notes, status, score, max_score, score_percent, passed, created_at, updated_at, is_active)
+		VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), $5, $6, $7, $8, 'draft', $9, $10, $11, false, NOW(), NOW(), true)
+		RETURNING `+inspectionSubmissionColumns,
+		form.ID, form.Version, req.BatchID, req.HatcheryID, req.InspectorID, string(answers),
+		req.Location, req.Notes, result.Score, result.MaxScore, result.ScorePercent))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save inspection")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Inspection started successfully",
+		Data:    submission,
+	})
+}
+
+// GetInspection retrieves an inspection submission
+// @Summary Get inspection
+// @Description Retrieve an inspection submission with its answers, photos and score
+// @Tags inspections
+// @Produce json
+// @Param submissionId path int true "Inspection ID"
+// @Success 200 {object} SuccessResponse{data=InspectionSubmission}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /inspections/{submissionId} [get]
+func GetInspection(c *fiber.Ctx) error {
+	submission, err := parseInspectionSubmissionID(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Inspection retrieved successfully",
+		Data:    submission,
+	})
+}
+
+// UpdateInspection updates the answers of a draft inspection
+// @Summary Update inspection
+// @Description Merge answers into a draft inspection and update its location and notes. A null answer clears the field
+// @Tags inspections
+// @Accept json
+// @Produce json
+// @Param submissionId path int true "Inspection ID"
+// @Param request body InspectionSubmissionRequest true "Inspection answers"
+// @Success 200 {object} SuccessResponse{data=InspectionSubmission}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /inspections/{submissionId} [put]
+func UpdateInspection(c *fiber.Ctx) error {
+	submission, err := parseInspectionSubmissionID(c)
+	if err != nil {
+		return err
+	}
+	if submission.Status != InspectionStatusDraft {
+		return fiber.NewError(fiber.StatusConflict, "Completed inspections cannot be changed")
+	}
+
+	var req InspectionSubmissionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	form, err := loadInspectionForm(submission.FormID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Inspection form not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if err := validateInspectionAnswers(form, req.Answers); err != nil {
+		return err
+	}
+
+	if submission.Answers == nil {
+		submission.Answers = map[string]interface{}{}
+	}
+	for key, value := range req.Answers {
+		if value == nil {
+			delete(submission.Answers, key)
+			continue
+		}
+		submission.Answers[key] = value
+	}
+	if req.Location == "" {
+		req.Location = submission.Location
+	}
+	if req.Notes == "" {
+		req.Notes = submission.Notes
+	}
+
+	answers, err := json.Marshal(submission.Answers)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to encode answers")
+	}
+	result := scoreInspection(form, submission.Answers, inspectionPhotoCounts(submission.Photos))
+	_, err = db.DB.Exec(`
+		UPDATE inspection_submission
+		SET answers = $1, location = $2, notes = $3, form_version = $4, score = $5, max_score = $6, score_percent = $7,
+			updated_at = NOW()
+		WHERE id = $8
+	`, string(answers), req.Location, req.Notes, form.Version, result.Score, result.MaxScore, result.ScorePercent, submission.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update inspection")
+	}
+
+	updated, err := loadInspectionSubmission(submission.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Inspection updated but failed to retrieve details")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Inspection updated successfully",
+		Data:    updated,
+	})
+}
+
+// UploadInspectionPhoto attaches a photo to a field of a draft inspection
+// @Summary Upload inspection photo
+// @Description Upload a photo for a field of a draft inspection to IPFS
+// @Tags inspections
+// @Accept multipart/form-data
+// @Produce json
+// @Param submissionId path int true "Inspection ID"
+// @Param field_key formData string true "Key of the form field the photo belongs to"
+// @Param file formData file true "Photo"
+// @Success 201 {object} SuccessResponse{data=InspectionPhoto}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /inspections/{submissionId}/photos [post]
+func UploadInspectionPhoto(c *fiber.Ctx) error {
+	submission, err := parseInspectionSubmissionID(c)
+	if err != nil {
+		return err
+	}
+	if submission.Status != InspectionStatusDraft {
+		return fiber.NewError(fiber.StatusConflict, "Completed inspections cannot be changed")
+	}
+
+	form, err := loadInspectionForm(submission.FormID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Inspection form not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	fieldKey := c.FormValue("field_key")
+	known := false
+	for _, f := range form.Fields {
+		if f.Key == fieldKey {
+			known = true
+		}
+	}
+	if !known {
+		return fiber.NewError(fiber.StatusBadRequest, "Unknown field: "+fieldKey)
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "File is required")
+	}
+	if file.Size > 10*1024*1024 {
+		return fiber.NewError(fiber.StatusBadRequest, "File size exceeds 10MB limit")
+	}
+	fileHandle, err := file.Open()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to open file")
+	}
+	defer fileHandle.Close()
+
+	result, err := ipfs.NewIPFSPinataService().UploadFile(fileHandle, file.Filename, map[string]string{
+		"inspection_id": strconv.Itoa(submission.ID),
+		"form_id":       strconv.Itoa(submission.FormID),
+		"field_key":     fieldKey,
+		"app":           "TracePost-larvaeChain",
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}, true)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to upload photo: "+err.Error())
+	}
+	uri := result.IPFSUri
+	if result.PinataSuccess && result.PinataUri != "" {
+		uri = result.PinataUri
+	}
+
+	photo := InspectionPhoto{
+		SubmissionID: submission.ID,
+		FieldKey:     fieldKey,
+		IPFSHash:     result.CID,
+		IPFSURI:      uri,
+		FileName:     result.Name,
+		FileSize:     result.Size,
+	}
+	err = db.DB.QueryRow(`
+		INSERT INTO inspection_photo (submission_id, field_key, ipfs_hash, ipfs_uri, file_name, file_size, uploaded_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), true)
+		RETURNING id, uploaded_at
+	`, submission.ID, fieldKey, photo.IPFSHash, photo.IPFSURI, photo.FileName, photo.FileSize).Scan(&photo.ID, &photo.UploadedAt)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save photo")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Inspection photo uploaded successfully",
+		Data:    photo,
+	})
+}
+
+// CompleteInspection scores and completes a draft inspection
+// @Summary Complete inspection
+// @Description Score a draft inspection and mark it completed. Every required answer and photo must be present.
+// @Description Completion records an inspection_completed event on the inspected batch, or on each active batch of the inspected hatchery, and anchors the result on the blockchain
+// @Tags inspections
+// @Produce json
+// @Param submissionId path int true "Inspection ID"
+// @Success 200 {object} SuccessResponse{data=InspectionCompletion}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /inspections/{submissionId}/complete [post]
+func CompleteInspection(c *fiber.Ctx) error {
+	submission, err := parseInspectionSubmissionID(c)
+	if err != nil {
+		return err
+	}
+	if submission.Status != InspectionStatusDraft {
+		return fiber.NewError(fiber.StatusConflict, "Inspection is already completed")
+	}
+
+	form, err := loadInspectionForm(submission.FormID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Inspection form not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	result := scoreInspection(form, submission.Answers, inspectionPhotoCounts(submission.Photos))
+	if len(result.Missing) > 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Inspection is incomplete: "+strings.Join(result.Missing, ", "))
+	}
+
+	metadata := map[string]interface{}{
+		"inspection_id":   submission.ID,
+		"form_id":         form.ID,
+		"form_name":       form.Name,
+		"form_version":    form.Version,
+		"score":           result.Score,
+		"max_score":       result.MaxScore,
+		"score_percent":   result.ScorePercent,
+		"passed":          result.Passed,
+		"failed_critical": result.FailedCritical,
+	}
+	eventMetadata, err := json.Marshal(metadata)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to encode event metadata")
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE inspection_submission
+		SET status = 'completed', form_version = $1, score = $2, max_score = $3, score_percent = $4, passed = $5,
+			submitted_at = $6, updated_at = $6
+		WHERE id = $7
+	`, form.Version, result.Score, result.MaxScore, result.ScorePercent, result.Passed, now, submission.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to complete inspection")
+	}
+
+	// Facility inspections apply to every batch currently in the hatchery
+	_, err = tx.Exec(`
+		INSERT INTO event (batch_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active)
+		SELECT id, $1, NULLIF($2, 0), $3, $4, $5, $4, true
+		FROM batch
+		WHERE is_active = true AND (id = $6 OR hatchery_id = $7)
+	`, EventTypeInspectionCompleted, submission.InspectorID, submission.Location, now, string(eventMetadata),
+		submission.BatchID, submission.HatcheryID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create event record")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+
+	anchorInspection(submission, metadata)
+
+	completed, err := loadInspectionSubmission(submission.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Inspection completed but failed to retrieve details")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Inspection completed successfully",
+		Data:    InspectionCompletion{Submission: completed, Result: result},
+	})
+}
+
+// anchorInspection records a completed inspection on the blockchain
+// The blockchain is secondary to the database, so failures are only logged
+func anchorInspection(submission InspectionSubmission, metadata map[string]interface{}) {
+	cfg := config.GetConfig()
+	blockchainClient := blockchain.NewBlockchainClient(
+		cfg.BlockchainNodeURL,
+		cfg.BlockchainPrivateKey,
+		cfg.BlockchainAccount,
+		cfg.BlockchainChainID,
+		cfg.BlockchainConsensus,
+	)
+
+	txID, err := blockchainClient.RecordEvent(
+		"inspection-"+strconv.Itoa(submission.ID),
+		EventTypeInspectionCompleted,
+		submission.Location,
+		strconv.Itoa(submission.InspectorID),
+		metadata,
+	)
+	if err != nil {
+		fmt.Printf("Warning: Failed to record inspection on blockchain: %v\n", err)
+		return
+	}
+	metadataHash, err := blockchainClient.HashData(map[string]interface{}{
+		"inspection_id": submission.ID,
+		"batch_id":      submission.BatchID,
+		"hatchery_id":   submission.HatcheryID,
+		"answers":       submission.Answers,
+		"photos":        submission.Photos,
+		"metadata":      metadata,
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to generate metadata hash: %v\n", err)
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO blockchain_record (related_table, related_id, tx_id, metadata_hash, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NOW(), NOW(), true)
+	`, "inspection_submission", submission.ID, txID, metadataHash)
+	if err != nil {
+		fmt.Printf("Warning: Failed to save blockchain record: %v\n", err)
+	}
+}
+
+// formatInspectionAnswer renders an answer for the PDF export
+func formatInspectionAnswer(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case bool:
+		if v {
+			return "Yes"
+		}
+		return "No"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ExportInspectionPDF exports a completed inspection as a PDF document
+// @Summary Export inspection PDF
+// @Description Export a completed inspection with its answers, score and photo links as a PDF document
+// @Tags inspections
+// @Produce application/pdf
+// @Param submissionId path int true "Inspection ID"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /inspections/{submissionId}/pdf [get]
+func ExportInspectionPDF(c *fiber.Ctx) error {
+	submission, err := parseInspectionSubmissionID(c)
+	if err != nil {
+		return err
+	}
+	if submission.Status != InspectionStatusCompleted {
+		return fiber.NewError(fiber.StatusConflict, "Only completed inspections can be exported")
+	}
+
+	// Deleted forms are still exported so past inspections stay printable
+	form, err := scanInspectionForm(db.DB.QueryRow(`SELECT `+inspectionFormColumns+` FROM inspection_form WHERE id = $1`, submission.FormID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Inspection form not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	inspector := strconv.Itoa(submission.InspectorID)
+	err = db.DB.QueryRow("SELECT COALESCE(NULLIF(full_name, ''), username) FROM account WHERE id = $1", submission.InspectorID).Scan(&inspector)
+	if err != nil && err != sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	subject := ""
+	if submission.BatchID != nil {
+		subject = fmt.Sprintf("Batch #%d", *submission.BatchID)
+	}
+	if submission.HatcheryID != nil {
+		subject = fmt.Sprintf("Hatchery #%d", *submission.HatcheryID)
+	}
+	outcome := "FAIL"
+	if submission.Passed {
+		outcome = "PASS"
+	}
+	summary := utils.PDFSection{Lines: []string{
+		fmt.Sprintf("Form: %s (version %d)", form.Name, submission.FormVersion),
+		"Subject: " + subject,
+		"Inspector: " + inspector,
+		"Location: " + submission.Location,
+		"Completed: " + submission.SubmittedAt.Format("2006-01-02 15:04 MST"),
+		fmt.Sprintf("Score: %.1f / %.1f (%.1f%%, pass mark %.1f%%)", submission.Score, submission.MaxScore, submission.ScorePercent, form.PassScore),
+		"Result: " + outcome,
+	}}
+
+	photoCounts := inspectionPhotoCounts(submission.Photos)
+	responses := utils.PDFSection{Heading: "Responses"}
+	for _, f := range form.Fields {
+		line := f.Label + ": "
+		if f.Type != InspectionFieldPhoto {
+			line += formatInspectionAnswer(submission.Answers[f.Key])
+		}
+		if photoCounts[f.Key] > 0 {
+			line += fmt.Sprintf(" [%d photo(s)]", photoCounts[f.Key])
+		}
+		responses.Lines = append(responses.Lines, line)
+	}
+
+	sections := []utils.PDFSection{summary, responses}
+	if len(submission.Photos) > 0 {
+		photos := utils.PDFSection{Heading: "Photos"}
+		sort.SliceStable(submission.Photos, func(i, j int) bool { return submission.Photos[i].FieldKey < submission.Photos[j].FieldKey })
+		for _, p := range submission.Photos {
+			photos.Lines = append(photos.Lines, p.FieldKey+": "+p.IPFSURI)
+		}
+		sections = append(sections, photos)
+	}
+	if submission.Notes != "" {
+		sections = append(sections, utils.PDFSection{Heading: "Notes", Lines: strings.Split(submission.Notes, "\n")})
+	}
+
+	pdf := utils.RenderTextPDF("Inspection Report #"+strconv.Itoa(submission.ID), sections)
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", fmt.Sprintf("inline; filename=inspection-%d.pdf", submission.ID))
+	return c.Send(pdf)
+}
+
+// GetBatchInspections lists the inspections that apply to a batch
+// @Summary Get batch inspections
+// @Description List the inspections of a batch, including inspections of the hatchery it is raised in
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]InspectionSubmission}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/inspections [get]
+func GetBatchInspections(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+inspectionSubmissionColumns+`
+		FROM inspection_submission
+		WHERE is_active = true
+			AND (batch_id = $1 OR hatchery_id = (SELECT hatchery_id FROM batch WHERE id = $1))
+		ORDER BY created_at DESC, id DESC
+	`, batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	submissions := []InspectionSubmission{}
+	for rows.Next() {
+		submission, err := scanInspectionSubmission(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse inspection")
+		}
+		submissions = append(submissions, submission)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch inspections retrieved successfully",
+		Data:    submissions,
+	})
+}
+
+// applyInspectionResults folds the latest completed inspections of a batch into a compliance check
+// Forms that list the standard are required; other forms count only once an inspection was completed
+func applyInspectionResults(result *ComplianceCheckResult, batchID int, standardID string) error {
+	rows, err := db.DB.Query(`
+		SELECT f.id, f.name, $2 = ANY(COALESCE(f.standards, '{}')), s.passed, s.score_percent
+		FROM batch b
+		JOIN hatchery h ON h.id = b.hatchery_id
+		JOIN inspection_form f ON f.company_id = h.company_id AND f.is_active = true
+		LEFT JOIN LATERAL (
+			SELECT passed, score_percent
+			FROM inspection_submission
+			WHERE form_id = f.id AND is_active = true AND status = 'completed'
+				AND (f.target_type = 'hatchery' AND hatchery_id = b.hatchery_id
+					OR f.target_type <> 'hatchery' AND batch_id = b.id)
+			ORDER BY submitted_at DESC
+			LIMIT 1
+		) s ON true
+		WHERE b.id = $1
+		ORDER BY f.id
+	`, batchID, standardID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var formID int
+		var name string
+		var required bool
+		var passed sql.NullBool
+		var percent sql.NullFloat64
+		if err := rows.Scan(&formID, &name, &required, &passed, &percent); err != nil {
+			return err
+		}
+		key := fmt.Sprintf("inspection_%d", formID)
+		switch {
+		case !passed.Valid && required:
+			result.RequirementsMet[key] = false
+			result.Issues = append(result.Issues, ComplianceIssue{
+				Requirement:    name,
+				Description:    "No completed " + name + " inspection found",
+				Severity:       "major",
+				Recommendation: "Complete the " + name + " inspection",
+			})
+		case !passed.Valid:
+		case passed.Bool:
+			result.RequirementsMet[key] = true
+		default:
+			result.RequirementsMet[key] = false
+			result.Issues = append(result.Issues, ComplianceIssue{
+				Requirement:    name,
+				Description:    fmt.Sprintf("The latest %s inspection failed with a score of %.1f%%", name, percent.Float64),
+				Severity:       "major",
+				Recommendation: "Address the inspection findings and re-inspect",
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	scoreCompliance(result)
+	return nil
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/inbound"
+)
+
+// InboundMessageRecord is a stored inbound cross-chain message
+type InboundMessageRecord struct {
+	ID            int                    `json:"id"`
+	Protocol      string                 `json:"protocol"`
+	SourceChainID string                 `json:"source_chain_id"`
+	MessageID     string                 `json:"message_id"`
+	MessageType   string                 `json:"message_type"`
+	Payload       map[string]interface{} `json:"payload"`
+	Status        string                 `json:"status"`
+	Error         string                 `json:"error,omitempty"`
+	BatchID       *int                   `json:"batch_id,omitempty"`
+	EventID       *int                   `json:"event_id,omitempty"`
+	ReceivedAt    time.Time              `json:"received_at"`
+	ProcessedAt   *time.Time             `json:"processed_at,omitempty"`
+}
+
+// ReceiveInboundMessage processes a cross-chain message relayed to this chain
+// @Summary Receive inbound cross-chain message
+// @Description Verify the proof of an IBC, XCM or bridge message addressed to this chain, record the mapped batch event and notify webhooks. Redelivered messages return the stored result
+// @Tags interoperability
+// @Accept json
+// @Produce json
+// @Param request body blockchain.InboundMessage true "Inbound message"
+// @Success 200 {object} SuccessResponse{data=inbound.Result}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /interop/inbound [post]
+func ReceiveInboundMessage(c *fiber.Ctx) error {
+	cfg := config.GetConfig()
+
+	// Check if interoperability is enabled
+	if !cfg.InteropEnabled {
+		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
+	}
+
+	var msg blockchain.InboundMessage
+	if err := c.BodyParser(&msg); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
+	}
+
+	blockchainClient := blockchain.NewBlockchainClient(
+		cfg.BlockchainNodeURL,
+		"", // Private key is not needed for now
+		cfg.BlockchainAccount,
+		cfg.BlockchainChainID,
+		cfg.BlockchainConsensus,
+	)
+
+	result, err := inbound.Process(blockchainClient, &msg)
+	if errors.Is(err, inbound.ErrInvalidMessage) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to process inbound message: "+err.Error())
+	}
+
+	message := "Inbound message processed successfully"
+	if result.Duplicate {
+		message = "Inbound message was already received"
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    result,
+	})
+}
+
+// ListInboundMessages lists received cross-chain messages
+// @Summary List inbound cross-chain messages
+// @Description List the most recent inbound messages, optionally filtered by status, source chain or batch
+// @Tags interoperability
+// @Produce json
+// @Param status query string false "Status (processed, unmapped, failed)"
+// @Param source_chain_id query string false "Source chain ID"
+// @Param batch_id query int false "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]InboundMessageRecord}
+// @Failure 500 {object} ErrorResponse
+// @Router /interop/inbound [get]
+func ListInboundMessages(c *fiber.Ctx) error {
+	rows, err := db.DB.Query(`
+		SELECT id, protocol, source_chain_id, message_id, message_type, payload, status,
+			COALESCE(error, ''), batch_id, event_id, received_at, processed_at
+		FROM inbound_message
+		WHERE ($1::text = '' OR status = $1)
+			AND ($2::text = '' OR source_chain_id = $2)
+			AND ($3::int = 0 OR batch_id = $3)
+		ORDER BY received_at DESC
+		LIMIT 100
+	`, c.Query("status"), c.Query("source_chain_id"), c.QueryInt("batch_id", 0))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	messages := []InboundMessageRecord{}
+	for rows.Next() {
+		var m InboundMessageRecord
+		var payload []byte
+		var batchID, eventID sql.NullInt64
+		var processedAt sql.NullTime
+		if err := rows.Scan(&m.ID, &m.Protocol, &m.SourceChainID, &m.MessageID, &m.MessageType, &payload, &m.Status,
+			&m.Error, &batchID, &eventID, &m.ReceivedAt, &processedAt); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse inbound message")
+		}
+		json.Unmarshal(payload, &m.Payload)
+		if batchID.Valid {
+			id := int(batchID.Int64)
+			m.BatchID = &id
+		}
+		if eventID.Valid {
+			id := int(eventID.Int64)
+			m.EventID = &id
+		}
+		if processedAt.Valid {
+			m.ProcessedAt = &processedAt.Time
+		}
+		messages = append(messages, m)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Inbound messages retrieved successfully",
+		Data:    messages,
+	})
+}
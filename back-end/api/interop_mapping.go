@@ -0,0 +1,324 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain/standards"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Mapping profile target types
+const (
+	MappingTargetChain   = "chain"
+	MappingTargetPartner = "partner"
+)
+
+// DataMappingRequest represents a request to select the data standard for a destination chain or partner
+type DataMappingRequest struct {
+	DataStandard string          `json:"data_standard"`
+	CustomSchema json.RawMessage `json:"custom_schema,omitempty" swaggertype:"object"`
+}
+
+// DataMapping is the data standard used when sharing with a destination chain or partner
+type DataMapping struct {
+	ID           int             `json:"id"`
+	TargetType   string          `json:"target_type"`
+	TargetID     string          `json:"target_id"`
+	DataStandard string          `json:"data_standard"`
+	CustomSchema json.RawMessage `json:"custom_schema,omitempty" swaggertype:"object"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// MappingDryRunRequest represents a request to preview a mapped batch without sharing it
+// The standard is taken from data_standard, or from the profile of dest_chain_id or partner_id
+type MappingDryRunRequest struct {
+	BatchID      string                 `json:"batch_id"`
+	Data         map[string]interface{} `json:"data"`
+	DataStandard string                 `json:"data_standard"`
+	CustomSchema json.RawMessage        `json:"custom_schema,omitempty" swaggertype:"object"`
+	DestChainID  string                 `json:"dest_chain_id"`
+	PartnerID    string                 `json:"partner_id"`
+}
+
+// MappingDryRunResponse is the document a batch would be shared as
+type MappingDryRunResponse struct {
+	DataStandard string                 `json:"data_standard"`
+	Source       map[string]interface{} `json:"source"`
+	Output       map[string]interface{} `json:"output"`
+}
+
+// ListDataStandards lists the data standards batches can be mapped to
+// @Summary List data standards
+// @Description List the built-in data standards available for cross-chain sharing
+// @Tags interoperability
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]string}
+// @Router /interop/standards [get]
+func ListDataStandards(c *fiber.Ctx) error {
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Data standards retrieved successfully",
+		Data:    append(standards.Default().Standards(), standards.CustomJSON),
+	})
+}
+
+// ListDataMappings lists the data standard selected for each destination chain and partner
+// @Summary List data mapping profiles
+// @Description List the data standard selected for each destination chain and partner
+// @Tags interoperability
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]DataMapping}
+// @Failure 500 {object} ErrorResponse
+// @Router /interop/mappings [get]
+func ListDataMappings(c *fiber.Ctx) error {
+	rows, err := db.DB.Query(`
+		SELECT id, target_type, target_id, data_standard, custom_schema, updated_at
+		FROM interop_data_mapping
+		WHERE is_active = true
+		ORDER BY target_type, target_id
+	`)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	mappings := []DataMapping{}
+	for rows.Next() {
+		var mapping DataMapping
+		var schema []byte
+		if err := rows.Scan(&mapping.ID, &mapping.TargetType, &mapping.TargetID, &mapping.DataStandard, &schema, &mapping.UpdatedAt); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse data mapping")
+		}
+		mapping.CustomSchema = schema
+		mappings = append(mappings, mapping)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Data mappings retrieved successfully",
+		Data:    mappings,
+	})
+}
+
+// SetDataMapping selects the data standard for a destination chain or partner
+// @Summary Set data mapping profile
+// @Description Select a built-in data standard or a custom JSON schema for a destination chain or partner
+// @Tags interoperability
+// @Accept json
+// @Produce json
+// @Param targetType path string true "Target type (chain or partner)"
+// @Param targetId path string true "Chain ID or partner ID"
+// @Param request body DataMappingRequest true "Data mapping"
+// @Success 200 {object} SuccessResponse{data=DataMapping}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /interop/mappings/{targetType}/{targetId} [put]
+func SetDataMapping(c *fiber.Ctx) error {
+	targetType := c.Params("targetType")
+	targetID := c.Params("targetId")
+	if targetType != MappingTargetChain && targetType != MappingTargetPartner {
+		return fiber.NewError(fiber.StatusBadRequest, "Target type must be chain or partner")
+	}
+
+	var req DataMappingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
+	}
+
+	var schema interface{}
+	if req.DataStandard == standards.CustomJSON {
+		if _, err := standards.NewCustomJSONTransformer(req.CustomSchema); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		schema = string(req.CustomSchema)
+	} else if _, ok := standards.Default().Get(req.DataStandard); !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "Unsupported data standard: "+req.DataStandard)
+	}
+
+	mapping := DataMapping{TargetType: targetType, TargetID: targetID, DataStandard: req.DataStandard}
+	err := db.DB.QueryRow(`
+		INSERT INTO interop_data_mapping (target_type, target_id, data_standard, custom_schema, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NOW(), NOW(), true)
+		ON CONFLICT (target_type, target_id) DO UPDATE
+		SET data_standard = EXCLUDED.data_standard, custom_schema = EXCLUDED.custom_schema,
+			updated_at = NOW(), is_active = true
+		RETURNING id, updated_at
+	`, targetType, targetID, req.DataStandard, schema).Scan(&mapping.ID, &mapping.UpdatedAt)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save data mapping: "+err.Error())
+	}
+	if schema != nil {
+		mapping.CustomSchema = req.CustomSchema
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Data mapping saved successfully",
+		Data:    mapping,
+	})
+}
+
+// DryRunDataMapping maps a batch to a data standard and returns the result without sharing it
+// @Summary Preview a data mapping
+// @Description Map a stored batch, or sample data, to a data standard without sending anything to another chain
+// @Tags interoperability
+// @Accept json
+// @Produce json
+// @Param request body MappingDryRunRequest true "Dry run details"
+// @Success 200 {object} SuccessResponse{data=MappingDryRunResponse}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /interop/mappings/dry-run [post]
+func DryRunDataMapping(c *fiber.Ctx) error {
+	var req MappingDryRunRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
+	}
+
+	var transformer standards.Transformer
+	var err error
+	switch {
+	case req.DataStandard == standards.CustomJSON:
+		transformer, err = standards.NewCustomJSONTransformer(req.CustomSchema)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	case req.DataStandard != "":
+		var ok bool
+		if transformer, ok = standards.Default().Get(req.DataStandard); !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "Unsupported data standard: "+req.DataStandard)
+		}
+	case req.DestChainID != "":
+		transformer, err = resolveDataMapping(MappingTargetChain, req.DestChainID)
+	case req.PartnerID != "":
+		transformer, err = resolveDataMapping(MappingTargetPartner, req.PartnerID)
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "data_standard, dest_chain_id or partner_id is required")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load data mapping: "+err.Error())
+	}
+	if transformer == nil {
+		return fiber.NewError(fiber.StatusNotFound, "No data mapping configured for this destination")
+	}
+
+	source := req.Data
+	if req.BatchID != "" {
+		source, err = loadBatchMappingSource(req.BatchID)
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load batch: "+err.Error())
+		}
+	}
+	if source == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "batch_id or data is required")
+	}
+	if _, ok := source["batch_id"]; !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "Source data has no batch_id")
+	}
+
+	output, err := transformer.Transform(source)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Mapping failed: "+err.Error())
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Dry run completed, nothing was shared",
+		Data: MappingDryRunResponse{
+			DataStandard: transformer.Standard(),
+			Source:       source,
+			Output:       output,
+		},
+	})
+}
+
+// resolveDataMapping returns the transformer configured for a destination, or nil if it has no profile
+func resolveDataMapping(targetType, targetID string) (standards.Transformer, error) {
+	var dataStandard string
+	var schema []byte
+	err := db.DB.QueryRow(`
+		SELECT data_standard, custom_schema
+		FROM interop_data_mapping
+		WHERE target_type = $1 AND target_id = $2 AND is_active = true
+	`, targetType, targetID).Scan(&dataStandard, &schema)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if dataStandard == standards.CustomJSON {
+		return standards.NewCustomJSONTransformer(schema)
+	}
+	transformer, ok := standards.Default().Get(dataStandard)
+	if !ok {
+		return nil, fmt.Errorf("data standard %s is no longer supported", dataStandard)
+	}
+	return transformer, nil
+}
+
+// loadBatchMappingSource builds the internal batch model that transformers map from
+func loadBatchMappingSource(batchID string) (map[string]interface{}, error) {
+	var id, quantity int
+	var species, status, hatchery string
+	var company, location sql.NullString
+	var createdAt time.Time
+	err := db.DB.QueryRow(`
+		SELECT b.id, COALESCE(b.species, ''), COALESCE(b.quantity, 0), COALESCE(b.status, ''), b.created_at,
+			COALESCE(h.name, ''), c.name, c.location
+		FROM batch b
+		LEFT JOIN hatchery h ON b.hatchery_id = h.id
+		LEFT JOIN company c ON h.company_id = c.id
+		WHERE b.id::text = $1 AND b.is_active = true
+	`, batchID).Scan(&id, &species, &quantity, &status, &createdAt, &hatchery, &company, &location)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT COALESCE(event_type, ''), COALESCE(location, ''), timestamp
+		FROM event
+		WHERE batch_id = $1 AND is_active = true
+		ORDER BY timestamp
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []map[string]interface{}{}
+	for rows.Next() {
+		var eventType, eventLocation string
+		var timestamp sql.NullTime
+		if err := rows.Scan(&eventType, &eventLocation, &timestamp); err != nil {
+			return nil, err
+		}
+		event := map[string]interface{}{"event_type": eventType, "location": eventLocation}
+		if timestamp.Valid {
+			event["timestamp"] = timestamp.Time
+		}
+		events = append(events, event)
+	}
+
+	return map[string]interface{}{
+		"batch_id":   fmt.Sprint(id),
+		"species":    species,
+		"quantity":   quantity,
+		"status":     status,
+		"location":   location.String,
+		"hatchery":   hatchery,
+		"company":    company.String,
+		"event_time": createdAt,
+		"events":     events,
+	}, nil
+}
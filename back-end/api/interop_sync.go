@@ -0,0 +1,193 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/chainsync"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// BatchShareRecord is a batch shared with an external chain and its sync state
+type BatchShareRecord struct {
+	ID             int        `json:"id"`
+	BatchID        int        `json:"batch_id"`
+	DestChainID    string     `json:"dest_chain_id"`
+	DataStandard   string     `json:"data_standard,omitempty"`
+	Encrypted      bool       `json:"encrypted"`
+	SyncStatus     string     `json:"sync_status"`
+	SyncedStatus   string     `json:"synced_status,omitempty"`
+	SyncCount      int        `json:"sync_count"`
+	FailureCount   int        `json:"failure_count"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastSyncTxID   string     `json:"last_sync_tx_id,omitempty"`
+	LastSyncedAt   *time.Time `json:"last_synced_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	PendingChanges bool       `json:"pending_changes"`
+}
+
+// ChainSyncSummary reports the sync state of every batch shared with one destination chain
+type ChainSyncSummary struct {
+	DestChainID  string     `json:"dest_chain_id"`
+	Shares       int        `json:"shares"`
+	InSync       int        `json:"in_sync"`
+	Pending      int        `json:"pending"`
+	Failed       int        `json:"failed"`
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// trackBatchShare starts syncing a batch that was shared with an external chain
+func trackBatchShare(req InteroperabilityShareBatchRequest, destTxID string, encrypted bool) {
+	batchID, err := strconv.Atoi(req.BatchID)
+	if err != nil {
+		return
+	}
+	if err := chainsync.Track(batchID, req.DestChainID, req.DataStandard, destTxID, encrypted); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// ListBatchShares lists shared batches and their sync state
+// @Summary List shared batches
+// @Description List batches shared with external chains, with the sync status of the updates pushed after sharing
+// @Tags interoperability
+// @Produce json
+// @Param dest_chain_id query string false "Destination chain ID"
+// @Param batch_id query int false "Batch ID"
+// @Param sync_status query string false "Sync status (in_sync, pending, failed)"
+// @Success 200 {object} SuccessResponse{data=[]BatchShareRecord}
+// @Failure 500 {object} ErrorResponse
+// @Router /interop/sync/shares [get]
+func ListBatchShares(c *fiber.Ctx) error {
+	rows, err := db.DB.Query(`
+		SELECT s.id, s.batch_id, s.dest_chain_id, COALESCE(s.data_standard, ''), s.encrypted, s.sync_status,
+			COALESCE(s.synced_status, ''), s.sync_count, s.failure_count, COALESCE(s.last_error, ''),
+			COALESCE(s.last_sync_tx_id, ''), s.last_synced_at, s.created_at,
+			(b.status IS DISTINCT FROM s.synced_status
+				OR EXISTS (SELECT 1 FROM event e WHERE e.batch_id = s.batch_id AND e.id > s.synced_event_id AND e.is_active = true)
+				OR EXISTS (SELECT 1 FROM certificates ct WHERE ct.batch_id = s.batch_id AND ct.id > s.synced_certificate_id AND ct.is_active = true))
+		FROM batch_share s
+		JOIN batch b ON b.id = s.batch_id
+		WHERE s.is_active = true
+			AND ($1::text = '' OR s.dest_chain_id = $1)
+			AND ($2::int = 0 OR s.batch_id = $2)
+			AND ($3::text = '' OR s.sync_status = $3)
+		ORDER BY s.updated_at DESC
+		LIMIT 100
+	`, c.Query("dest_chain_id"), c.QueryInt("batch_id", 0), c.Query("sync_status"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	shares := []BatchShareRecord{}
+	for rows.Next() {
+		var s BatchShareRecord
+		var lastSyncedAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.BatchID, &s.DestChainID, &s.DataStandard, &s.Encrypted, &s.SyncStatus,
+			&s.SyncedStatus, &s.SyncCount, &s.FailureCount, &s.LastError,
+			&s.LastSyncTxID, &lastSyncedAt, &s.CreatedAt, &s.PendingChanges); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse batch share")
+		}
+		if lastSyncedAt.Valid {
+			s.LastSyncedAt = &lastSyncedAt.Time
+		}
+		shares = append(shares, s)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Shared batches retrieved successfully",
+		Data:    shares,
+	})
+}
+
+// GetChainSyncStatus reports the sync state per destination chain
+// @Summary Get cross-chain sync status
+// @Description Summarize for each destination chain how many shared batches are in sync, pending or failed
+// @Tags interoperability
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]ChainSyncSummary}
+// @Failure 500 {object} ErrorResponse
+// @Router /interop/sync/chains [get]
+func GetChainSyncStatus(c *fiber.Ctx) error {
+	rows, err := db.DB.Query(`
+		SELECT dest_chain_id, COUNT(*),
+			COUNT(*) FILTER (WHERE sync_status = $1),
+			COUNT(*) FILTER (WHERE sync_status = $2),
+			COUNT(*) FILTER (WHERE sync_status = $3),
+			MAX(last_synced_at),
+			COALESCE((ARRAY_AGG(last_error ORDER BY updated_at DESC) FILTER (WHERE last_error IS NOT NULL))[1], '')
+		FROM batch_share
+		WHERE is_active = true
+		GROUP BY dest_chain_id
+		ORDER BY dest_chain_id
+	`, chainsync.StatusInSync, chainsync.StatusPending, chainsync.StatusFailed)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	summaries := []ChainSyncSummary{}
+	for rows.Next() {
+		var s ChainSyncSummary
+		var lastSyncedAt sql.NullTime
+		if err := rows.Scan(&s.DestChainID, &s.Shares, &s.InSync, &s.Pending, &s.Failed, &lastSyncedAt, &s.LastError); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse sync status")
+		}
+		if lastSyncedAt.Valid {
+			s.LastSyncedAt = &lastSyncedAt.Time
+		}
+		summaries = append(summaries, s)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Cross-chain sync status retrieved successfully",
+		Data:    summaries,
+	})
+}
+
+// SyncBatchShare pushes the pending changes of a shared batch immediately
+// @Summary Sync shared batch
+// @Description Push the changes of a shared batch to its destination chain now. Failed shares are retried
+// @Tags interoperability
+// @Produce json
+// @Param shareId path int true "Batch share ID"
+// @Success 200 {object} SuccessResponse{data=chainsync.Result}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /interop/sync/shares/{shareId} [post]
+func SyncBatchShare(c *fiber.Ctx) error {
+	shareID, err := strconv.Atoi(c.Params("shareId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid share ID format")
+	}
+
+	result, err := chainsync.Default().Retry(shareID)
+	if errors.Is(err, chainsync.ErrShareNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Batch share not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to sync batch share: "+err.Error())
+	}
+
+	message := "Shared batch synced successfully"
+	if result.Error != "" {
+		message = "Shared batch could not be synced"
+	} else if result.Changes == 0 {
+		message = "Shared batch is already in sync"
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    result,
+	})
+}
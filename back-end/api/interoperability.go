@@ -1,21 +1,23 @@
 package api
 
 import (
+	"database/sql"
+	"errors"
 	"strconv"
 	"time"
-	"fmt"
-	"strings"
 	
 	"github.com/gofiber/fiber/v2"
 	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
-	"github.com/LTPPPP/TracePost-larvaeChain/blockchain/bridges"
+	"github.com/LTPPPP/TracePost-larvaeChain/chains"
 	"github.com/LTPPPP/TracePost-larvaeChain/config"
 	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/interop"
 )
 
 // InteroperabilityRegisterChainRequest represents a request to register an external blockchain
 type InteroperabilityRegisterChainRequest struct {
 	ChainID   string `json:"chain_id"`
+	Name      string `json:"name"`
 	ChainType string `json:"chain_type"`
 	Endpoint  string `json:"endpoint"`
 }
@@ -25,6 +27,10 @@ type InteroperabilityShareBatchRequest struct {
 	BatchID      string `json:"batch_id"`
 	DestChainID  string `json:"dest_chain_id"`
 	DataStandard string `json:"data_standard"`
+	// Encrypt the shared data to the recipient's DID key instead of sending it in the clear
+	Encrypt        bool     `json:"encrypt"`
+	RecipientDID   string   `json:"recipient_did"`
+	AuthorizedDIDs []string `json:"authorized_dids"` // Additional parties allowed to decrypt later, e.g. the sender
 }
 
 // CrossChainTransactionResponse represents a response for a cross-chain transaction
@@ -36,6 +42,15 @@ type CrossChainTransactionResponse struct {
 	Status          string                 `json:"status"`
 	Timestamp       string                 `json:"timestamp"`
 	Payload         map[string]interface{} `json:"payload,omitempty"`
+	Encryption      *SharedPayloadInfo     `json:"encryption,omitempty"`
+}
+
+// SharedPayloadInfo describes how an encrypted share can be decrypted
+type SharedPayloadInfo struct {
+	PayloadID   int      `json:"payload_id"`
+	Algorithm   string   `json:"algorithm"`
+	PayloadHash string   `json:"payload_hash"`
+	Recipients  []string `json:"recipients"`
 }
 
 // PolkadotBridgeRequest represents a request to create a Polkadot bridge
@@ -90,9 +105,31 @@ type VerifyTransactionRequest struct {
 	DestChainID   string `json:"dest_chain_id"`
 }
 
+// interopService returns the interoperability service for the current config
+func interopService() *interop.Service {
+	return interop.NewService(config.GetConfig())
+}
+
+// interopError maps an interoperability service error to its HTTP status and error code
+func interopError(err error) error {
+	switch interop.KindOf(err) {
+	case interop.KindDisabled, interop.KindInvalid:
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case interop.KindNotFound:
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case interop.KindInternal:
+		// Database errors are not shown to the caller
+		var serviceErr *interop.Error
+		errors.As(err, &serviceErr)
+		return fiber.NewError(fiber.StatusInternalServerError, serviceErr.Message)
+	default:
+		return blockchainFailure(err.Error(), err)
+	}
+}
+
 // RegisterExternalChain registers an external blockchain for interoperability
 // @Summary Register an external blockchain
-// @Description Register an external blockchain for cross-chain communication
+// @Description Register an external blockchain for cross-chain communication. The chain is probed and its capabilities are stored in the chain registry
 // @Tags interoperability
 // @Accept json
 // @Produce json
@@ -102,44 +139,24 @@ type VerifyTransactionRequest struct {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/chains [post]
 func RegisterExternalChain(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Parse request
 	var req InteroperabilityRegisterChainRequest
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
 	}
 	
-	// Validate request
-	if req.ChainID == "" || req.ChainType == "" || req.Endpoint == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing required fields")
-	}
-	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
-	// Register chain
-	connectionID, err := blockchainClient.InteropClient.RegisterChain(req.ChainID, req.ChainType, req.Endpoint)
+	// Register the chain and probe its capabilities into the registry
+	connectionID, chain, err := interopService().RegisterChain(req.ChainID, req.Name, req.ChainType, req.Endpoint)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to register chain: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
 		Success: true,
 		Message: "Chain registered successfully",
-		Data: map[string]string{
+		Data: map[string]interface{}{
 			"connection_id": connectionID,
+			"chain":         chain,
 		},
 	})
 }
@@ -158,10 +175,9 @@ func RegisterExternalChain(c *fiber.Ctx) error {
 // @Router /interop/share-batch [post]
 func ShareBatchWithExternalChain(c *fiber.Ctx) error {
 	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
+	svc := interop.NewService(cfg)
+	if err := svc.CheckEnabled(); err != nil {
+		return interopError(err)
 	}
 	
 	// Parse request
@@ -175,23 +191,26 @@ func ShareBatchWithExternalChain(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Missing required fields")
 	}
 	
-	// Use default data standard if not specified
+	// Initialize blockchain client
+	blockchainClient := svc.NewClient()
+	
+	// Use the destination chain's mapping profile, then the default data standard
 	if req.DataStandard == "" {
-		req.DataStandard = cfg.InteropDefaultStandard
+		transformer, err := resolveDataMapping(MappingTargetChain, req.DestChainID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load data mapping: "+err.Error())
+		}
+		if transformer != nil {
+			blockchainClient.InteropClient.RegisterTransformer(transformer)
+			req.DataStandard = transformer.Standard()
+		} else {
+			req.DataStandard = cfg.InteropDefaultStandard
+		}
 	}
 	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
 	// Check if batch exists
 	var exists bool
-	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batches WHERE batch_id = $1)", req.BatchID).Scan(&exists)
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id::text = $1 AND is_active = true)", req.BatchID).Scan(&exists)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
 	}
@@ -199,11 +218,21 @@ func ShareBatchWithExternalChain(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
 	}
 	
+	// Route to the destination through its registry entry when it has one
+	if err := chains.Connect(blockchainClient.InteropClient, req.DestChainID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to connect to destination chain: "+err.Error())
+	}
+	
+	if req.Encrypt {
+		return shareEncryptedBatch(c, blockchainClient, req)
+	}
+	
 	// Share batch with external chain
 	destTxID, err := blockchainClient.ShareBatchWithExternalChain(req.BatchID, req.DestChainID, req.DataStandard)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to share batch: "+err.Error())
 	}
+	trackBatchShare(req, destTxID, false)
 	
 	// Construct response
 	return c.JSON(SuccessResponse{
@@ -220,6 +249,160 @@ func ShareBatchWithExternalChain(c *fiber.Ctx) error {
 	})
 }
 
+// shareEncryptedBatch shares a batch encrypted to the recipient and records the wrapped keys
+func shareEncryptedBatch(c *fiber.Ctx, blockchainClient *blockchain.BlockchainClient, req InteroperabilityShareBatchRequest) error {
+	cfg := config.GetConfig()
+	
+	if req.RecipientDID == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "recipient_did is required for encrypted sharing")
+	}
+	
+	// Resolve the public key of every party that may decrypt the data
+	dids := append([]string{req.RecipientDID}, req.AuthorizedDIDs...)
+	seen := make(map[string]bool)
+	var recipients []blockchain.PayloadRecipient
+	for _, did := range dids {
+		if did == "" || seen[did] {
+			continue
+		}
+		seen[did] = true
+		
+		var publicKey, status string
+		err := db.DB.QueryRow("SELECT public_key, status FROM identities WHERE did = $1", did).Scan(&publicKey, &status)
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusNotFound, "DID not found: "+did)
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if status != "active" {
+			return fiber.NewError(fiber.StatusBadRequest, "DID is not active: "+did)
+		}
+		recipients = append(recipients, blockchain.PayloadRecipient{DID: did, PublicKey: publicKey})
+	}
+	
+	destTxID, encrypted, err := blockchainClient.ShareEncryptedBatchWithExternalChain(req.BatchID, req.DestChainID, req.DataStandard, recipients)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to share batch: "+err.Error())
+	}
+	
+	// Keep the envelope and key wraps so authorized parties can fetch and decrypt it later
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+	
+	var payloadID int
+	err = tx.QueryRow(`
+		INSERT INTO shared_payload (batch_id, dest_chain_id, dest_tx_id, algorithm, nonce, ciphertext, payload_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		RETURNING id
+	`, req.BatchID, req.DestChainID, destTxID, encrypted.Algorithm, encrypted.Nonce, encrypted.Ciphertext, encrypted.PayloadHash).Scan(&payloadID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record shared payload: "+err.Error())
+	}
+	
+	recipientDIDs := make([]string, 0, len(encrypted.Recipients))
+	for _, wrapped := range encrypted.Recipients {
+		_, err = tx.Exec(`
+			INSERT INTO shared_payload_key (payload_id, recipient_did, algorithm, ephemeral_public_key, nonce, wrapped_key, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		`, payloadID, wrapped.RecipientDID, wrapped.Algorithm, wrapped.EphemeralPublicKey, wrapped.Nonce, wrapped.WrappedKey)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to record key wrap: "+err.Error())
+		}
+		recipientDIDs = append(recipientDIDs, wrapped.RecipientDID)
+	}
+	
+	if err = tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+	trackBatchShare(req, destTxID, true)
+	
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch shared successfully with encrypted payload",
+		Data: CrossChainTransactionResponse{
+			SourceTxID:      "local-tx-" + destTxID[:8], // Simplified for example
+			DestinationTxID: destTxID,
+			SourceChainID:   cfg.BlockchainChainID,
+			DestChainID:     req.DestChainID,
+			Status:          "completed",
+			Timestamp:       time.Now().Format(time.RFC3339),
+			Encryption: &SharedPayloadInfo{
+				PayloadID:   payloadID,
+				Algorithm:   encrypted.Algorithm + "/" + blockchain.PayloadKeyAlgorithm,
+				PayloadHash: encrypted.PayloadHash,
+				Recipients:  recipientDIDs,
+			},
+		},
+	})
+}
+
+// GetSharedPayload returns an encrypted batch share with the key wraps of its recipients
+// @Summary Get encrypted shared payload
+// @Description Get the ciphertext and key wraps of an encrypted cross-chain share. Pass a DID to only return that recipient's key wrap
+// @Tags interoperability
+// @Accept json
+// @Produce json
+// @Param payloadId path int true "Shared payload ID"
+// @Param did query string false "Recipient DID"
+// @Success 200 {object} SuccessResponse{data=blockchain.EncryptedPayload}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /interop/shared-payloads/{payloadId} [get]
+func GetSharedPayload(c *fiber.Ctx) error {
+	payloadID, err := strconv.Atoi(c.Params("payloadId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid payload ID format")
+	}
+	did := c.Query("did")
+	
+	var payload blockchain.EncryptedPayload
+	err = db.DB.QueryRow(`
+		SELECT algorithm, nonce, ciphertext, payload_hash
+		FROM shared_payload
+		WHERE id = $1
+	`, payloadID).Scan(&payload.Algorithm, &payload.Nonce, &payload.Ciphertext, &payload.PayloadHash)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Shared payload not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	
+	rows, err := db.DB.Query(`
+		SELECT recipient_did, algorithm, ephemeral_public_key, nonce, wrapped_key
+		FROM shared_payload_key
+		WHERE payload_id = $1 AND ($2::text = '' OR recipient_did = $2)
+		ORDER BY id
+	`, payloadID, did)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+	
+	payload.Recipients = []blockchain.WrappedKey{}
+	for rows.Next() {
+		var wrapped blockchain.WrappedKey
+		if err := rows.Scan(&wrapped.RecipientDID, &wrapped.Algorithm, &wrapped.EphemeralPublicKey, &wrapped.Nonce, &wrapped.WrappedKey); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse key wrap")
+		}
+		payload.Recipients = append(payload.Recipients, wrapped)
+	}
+	if did != "" && len(payload.Recipients) == 0 {
+		return fiber.NewError(fiber.StatusForbidden, "Payload is not encrypted to "+did)
+	}
+	
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Shared payload retrieved successfully",
+		Data:    payload,
+	})
+}
+
 // ExportBatchToGS1EPCIS exports a batch to GS1 EPCIS format
 // @Summary Export batch to GS1 EPCIS
 // @Description Export a batch to GS1 EPCIS format for interoperability
@@ -234,10 +417,9 @@ func ShareBatchWithExternalChain(c *fiber.Ctx) error {
 // @Router /interop/export/{batchId} [get]
 func ExportBatchToGS1EPCIS(c *fiber.Ctx) error {
 	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
+	svc := interop.NewService(cfg)
+	if err := svc.CheckEnabled(); err != nil {
+		return interopError(err)
 	}
 	
 	// Get batch ID from path
@@ -248,7 +430,7 @@ func ExportBatchToGS1EPCIS(c *fiber.Ctx) error {
 	
 	// Check if batch exists
 	var exists bool
-	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batches WHERE batch_id = $1)", batchID).Scan(&exists)
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id::text = $1 AND is_active = true)", batchID).Scan(&exists)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
 	}
@@ -257,13 +439,7 @@ func ExportBatchToGS1EPCIS(c *fiber.Ctx) error {
 	}
 	
 	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
+	blockchainClient := svc.NewClient()
 	
 	// Export batch to GS1 EPCIS
 	epcisData, err := blockchainClient.ExportBatchToGS1EPCIS(batchID)
@@ -271,6 +447,13 @@ func ExportBatchToGS1EPCIS(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to export batch: "+err.Error())
 	}
 	
+	// Use the company's allocated GS1 identifiers instead of placeholder keys
+	if id, convErr := strconv.Atoi(batchID); convErr == nil {
+		if ids, lookupErr := lookupBatchGS1Identifiers(id); lookupErr == nil {
+			applyGS1IdentifiersToEPCIS(epcisData, ids, batchID)
+		}
+	}
+	
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "Batch exported successfully",
@@ -291,92 +474,20 @@ func ExportBatchToGS1EPCIS(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/blockchain/batch/{batchId} [get]
 func GetInteropBatchFromBlockchain(c *fiber.Ctx) error {
-	// Get batch ID from params
-	batchIDStr := c.Params("batchId")
-	if batchIDStr == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Batch ID is required")
-	}
-	
-	batchID, err := strconv.Atoi(batchIDStr)
+	batchID, err := strconv.Atoi(c.Params("batchId"))
 	if err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
 	}
 
-	// Check if batch exists
-	var exists bool
-	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = $1)", batchID).Scan(&exists)
+	anchored, err := interopService().BatchRecords(batchID)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
-	}
-	if !exists {
-		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
-	}
-
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		"http://localhost:26657",
-		"private-key",
-		"account-address",
-		"tracepost-chain",
-		"poa",
-	)
-
-	// Get batch transactions from blockchain
-	blockchainTxs, err := blockchainClient.GetBatchTransactions(strconv.Itoa(batchID))
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve batch data from blockchain")
+		return interopError(err)
 	}
 
-	// Get blockchain records from database
-	rows, err := db.DB.Query(`
-		SELECT tx_id, metadata_hash, created_at
-		FROM blockchain_record
-		WHERE related_table = 'batch' AND related_id = $1
-		ORDER BY created_at ASC
-	`, batchID)
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
-	}
-	defer rows.Close()
-
-	// Parse blockchain records
-	type BlockchainTxRecord struct {
-		TxID         string    `json:"tx_id"`
-		MetadataHash string    `json:"metadata_hash"`
-		Timestamp    string    `json:"timestamp"`
-		BlockchainTx interface{} `json:"blockchain_tx,omitempty"`
-	}
-
-	var records []BlockchainTxRecord
-	for rows.Next() {
-		var record BlockchainTxRecord
-		var created string
-		err := rows.Scan(
-			&record.TxID,
-			&record.MetadataHash,
-			&created,
-		)
-		if err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse blockchain record data")
-		}
-		record.Timestamp = created
-
-		// Find matching transaction from blockchain
-		for _, tx := range blockchainTxs {
-			if tx.TxID == record.TxID {
-				record.BlockchainTx = tx
-				break
-			}
-		}
-
-		records = append(records, record)
-	}
-
-	// Return success response
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "Batch blockchain data retrieved successfully",
-		Data:    records,
+		Data:    anchored.Records,
 	})
 }
 
@@ -393,102 +504,23 @@ func GetInteropBatchFromBlockchain(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /blockchain/event/{eventId} [get]
 func GetEventFromBlockchain(c *fiber.Ctx) error {
-	// Get event ID from params
-	eventIDStr := c.Params("eventId")
-	if eventIDStr == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Event ID is required")
-	}
-	
-	eventID, err := strconv.Atoi(eventIDStr)
+	eventID, err := strconv.Atoi(c.Params("eventId"))
 	if err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid event ID format")
 	}
 
-	// Check if event exists
-	var exists bool
-	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM event WHERE id = $1)", eventID).Scan(&exists)
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
-	}
-	if !exists {
-		return fiber.NewError(fiber.StatusNotFound, "Event not found")
-	}
-
-	// Get event data from database
-	var batchID int
-	err = db.DB.QueryRow("SELECT batch_id FROM event WHERE id = $1", eventID).Scan(&batchID)
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
-	}
-
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		"http://localhost:26657",
-		"private-key",
-		"account-address",
-		"tracepost-chain",
-		"poa",
-	)
-
-	// Get event transactions from blockchain
-	blockchainTxs, err := blockchainClient.GetEventTransactions(strconv.Itoa(eventID))
+	anchored, err := interopService().EventRecords(eventID)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve event data from blockchain")
-	}
-
-	// Get blockchain records from database
-	rows, err := db.DB.Query(`
-		SELECT tx_id, metadata_hash, created_at
-		FROM blockchain_record
-		WHERE related_table = 'event' AND related_id = $1
-		ORDER BY created_at ASC
-	`, eventID)
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
-	}
-	defer rows.Close()
-
-	// Parse blockchain records
-	type BlockchainTxRecord struct {
-		TxID         string    `json:"tx_id"`
-		MetadataHash string    `json:"metadata_hash"`
-		Timestamp    string    `json:"timestamp"`
-		BlockchainTx interface{} `json:"blockchain_tx,omitempty"`
+		return interopError(err)
 	}
 
-	var records []BlockchainTxRecord
-	for rows.Next() {
-		var record BlockchainTxRecord
-		var created string
-		err := rows.Scan(
-			&record.TxID,
-			&record.MetadataHash,
-			&created,
-		)
-		if err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse blockchain record data")
-		}
-		record.Timestamp = created
-
-		// Find matching transaction from blockchain
-		for _, tx := range blockchainTxs {
-			if tx.TxID == record.TxID {
-				record.BlockchainTx = tx
-				break
-			}
-		}
-
-		records = append(records, record)
-	}
-
-	// Return success response with additional context
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "Event blockchain data retrieved successfully",
 		Data: map[string]interface{}{
 			"event_id": eventID,
-			"batch_id": batchID,
-			"records":  records,
+			"batch_id": anchored.BatchID,
+			"records":  anchored.Records,
 		},
 	})
 }
@@ -506,104 +538,29 @@ func GetEventFromBlockchain(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /blockchain/document/{docId} [get]
 func GetDocumentFromBlockchain(c *fiber.Ctx) error {
-	// Get document ID from params
-	docIDStr := c.Params("docId")
-	if docIDStr == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Document ID is required")
-	}
-	
-	docID, err := strconv.Atoi(docIDStr)
+	docID, err := strconv.Atoi(c.Params("docId"))
 	if err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid document ID format")
 	}
 
-	// Check if document exists
-	var exists bool
-	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM document WHERE id = $1)", docID).Scan(&exists)
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
-	}
-	if !exists {
-		return fiber.NewError(fiber.StatusNotFound, "Document not found")
+	// Check if document exists and the caller may see it
+	if err := authorizeDocument(c, docID); err != nil {
+		return err
 	}
 
-	// Get document data from database
-	var batchID int
-	var ipfsHash string
-	err = db.DB.QueryRow("SELECT batch_id, ipfs_hash FROM document WHERE id = $1", docID).Scan(&batchID, &ipfsHash)
+	anchored, err := interopService().DocumentRecords(docID)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
-	}
-
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		"http://localhost:26657",
-		"private-key",
-		"account-address",
-		"tracepost-chain",
-		"poa",
-	)
-
-	// Get document transactions from blockchain
-	blockchainTxs, err := blockchainClient.GetDocumentTransactions(strconv.Itoa(docID))
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve document data from blockchain")
-	}
-
-	// Get blockchain records from database
-	rows, err := db.DB.Query(`
-		SELECT tx_id, metadata_hash, created_at
-		FROM blockchain_record
-		WHERE related_table = 'document' AND related_id = $1
-		ORDER BY created_at ASC
-	`, docID)
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
-	}
-	defer rows.Close()
-
-	// Parse blockchain records
-	type BlockchainTxRecord struct {
-		TxID         string    `json:"tx_id"`
-		MetadataHash string    `json:"metadata_hash"`
-		Timestamp    string    `json:"timestamp"`
-		BlockchainTx interface{} `json:"blockchain_tx,omitempty"`
-	}
-
-	var records []BlockchainTxRecord
-	for rows.Next() {
-		var record BlockchainTxRecord
-		var created string
-		err := rows.Scan(
-			&record.TxID,
-			&record.MetadataHash,
-			&created,
-		)
-		if err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse blockchain record data")
-		}
-		record.Timestamp = created
-
-		// Find matching transaction from blockchain
-		for _, tx := range blockchainTxs {
-			if tx.TxID == record.TxID {
-				record.BlockchainTx = tx
-				break
-			}
-		}
-
-		records = append(records, record)
+		return interopError(err)
 	}
 
-	// Return success response with additional context
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "Document blockchain data retrieved successfully",
 		Data: map[string]interface{}{
 			"document_id": docID,
-			"batch_id":    batchID,
-			"ipfs_hash":   ipfsHash,
-			"records":     records,
+			"batch_id":    anchored.BatchID,
+			"ipfs_hash":   anchored.IPFSHash,
+			"records":     anchored.Records,
 		},
 	})
 }
@@ -621,102 +578,23 @@ func GetDocumentFromBlockchain(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /blockchain/environment/{envId} [get]
 func GetEnvironmentDataFromBlockchain(c *fiber.Ctx) error {
-	// Get environment data ID from params
-	envIDStr := c.Params("envId")
-	if envIDStr == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Environment data ID is required")
-	}
-	
-	envID, err := strconv.Atoi(envIDStr)
+	envID, err := strconv.Atoi(c.Params("envId"))
 	if err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid environment data ID format")
 	}
 
-	// Check if environment data exists
-	var exists bool
-	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM environment WHERE id = $1)", envID).Scan(&exists)
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
-	}
-	if !exists {
-		return fiber.NewError(fiber.StatusNotFound, "Environment data not found")
-	}
-
-	// Get environment data from database
-	var batchID int
-	err = db.DB.QueryRow("SELECT batch_id FROM environment WHERE id = $1", envID).Scan(&batchID)
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
-	}
-
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		"http://localhost:26657",
-		"private-key",
-		"account-address",
-		"tracepost-chain",
-		"poa",
-	)
-
-	// Get environment data transactions from blockchain
-	blockchainTxs, err := blockchainClient.GetEnvironmentDataTransactions(strconv.Itoa(envID))
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve environment data from blockchain")
-	}
-
-	// Get blockchain records from database
-	rows, err := db.DB.Query(`
-		SELECT tx_id, metadata_hash, created_at
-		FROM blockchain_record
-		WHERE related_table = 'environment' AND related_id = $1
-		ORDER BY created_at ASC
-	`, envID)
+	anchored, err := interopService().EnvironmentRecords(envID)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
-	}
-	defer rows.Close()
-
-	// Parse blockchain records
-	type BlockchainTxRecord struct {
-		TxID         string    `json:"tx_id"`
-		MetadataHash string    `json:"metadata_hash"`
-		Timestamp    string    `json:"timestamp"`
-		BlockchainTx interface{} `json:"blockchain_tx,omitempty"`
+		return interopError(err)
 	}
 
-	var records []BlockchainTxRecord
-	for rows.Next() {
-		var record BlockchainTxRecord
-		var created string
-		err := rows.Scan(
-			&record.TxID,
-			&record.MetadataHash,
-			&created,
-		)
-		if err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse blockchain record data")
-		}
-		record.Timestamp = created
-
-		// Find matching transaction from blockchain
-		for _, tx := range blockchainTxs {
-			if tx.TxID == record.TxID {
-				record.BlockchainTx = tx
-				break
-			}
-		}
-
-		records = append(records, record)
-	}
-
-	// Return success response with additional context
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "Environment data blockchain records retrieved successfully",
 		Data: map[string]interface{}{
 			"environment_id": envID,
-			"batch_id":       batchID,
-			"records":        records,
+			"batch_id":       anchored.BatchID,
+			"records":        anchored.Records,
 		},
 	})
 }
@@ -733,51 +611,24 @@ func GetEnvironmentDataFromBlockchain(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/bridges/polkadot [post]
 func CreatePolkadotBridge(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Parse request
 	var req PolkadotBridgeRequest
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
 	}
 	
-	// Validate request
-	if req.ChainID == "" || req.RelayEndpoint == "" || req.RelayChainID == "" || req.ParachainID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing required fields")
-	}
-	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
 	// Create the Polkadot bridge
-	err := blockchainClient.InteropClient.CreatePolkadotBridge(
-		req.ChainID, 
-		req.RelayEndpoint, 
-		req.RelayChainID, 
-		req.ParachainID, 
-		req.APIKey,
-	)
+	err := interopService().CreatePolkadotBridge(req.ChainID, req.RelayEndpoint, req.RelayChainID, req.ParachainID, req.APIKey)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create Polkadot bridge: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
 		Success: true,
 		Message: "Polkadot bridge created successfully",
 		Data: map[string]string{
-			"chain_id":      req.ChainID,
-			"parachain_id":  req.ParachainID,
+			"chain_id":       req.ChainID,
+			"parachain_id":   req.ParachainID,
 			"relay_chain_id": req.RelayChainID,
 		},
 	})
@@ -795,42 +646,16 @@ func CreatePolkadotBridge(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/bridges/cosmos [post]
 func CreateCosmosBridge(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Parse request
 	var req CosmosBridgeRequest
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
 	}
 	
-	// Validate request
-	if req.ChainID == "" || req.NodeEndpoint == "" || req.AccountAddress == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing required fields")
-	}
-	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
 	// Create the Cosmos bridge
-	err := blockchainClient.InteropClient.CreateCosmosBridge(
-		req.ChainID,
-		req.NodeEndpoint,
-		req.APIKey,
-		req.AccountAddress,
-	)
+	err := interopService().CreateCosmosBridge(req.ChainID, req.NodeEndpoint, req.APIKey, req.AccountAddress)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create Cosmos bridge: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
@@ -856,49 +681,19 @@ func CreateCosmosBridge(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/bridges/cosmos/channels [post]
 func AddIBCChannel(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Parse request
 	var req IBCChannelRequest
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
 	}
 	
-	// Validate request
-	if req.ChainID == "" || req.ChannelID == "" || req.PortID == "" || 
-	   req.CounterpartyChannelID == "" || req.CounterpartyPortID == "" || req.ConnectionID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing required fields")
-	}
-	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
-	// Check if a Cosmos bridge exists for the chain
-	cosmosBridge, exists := blockchainClient.InteropClient.CosmosBridges[req.ChainID]
-	if !exists {
-		return fiber.NewError(fiber.StatusBadRequest, "No Cosmos bridge found for the specified chain ID")
+	// Add the IBC channel to the chain's Cosmos bridge
+	err := interopService().AddIBCChannel(req.ChainID, req.ChannelID, req.PortID,
+		req.CounterpartyChannelID, req.CounterpartyPortID, req.ConnectionID)
+	if err != nil {
+		return interopError(err)
 	}
 	
-	// Add the IBC channel
-	cosmosBridge.AddIBCChannel(
-		req.ChannelID,
-		req.PortID,
-		req.CounterpartyChannelID,
-		req.CounterpartyPortID,
-		req.ConnectionID,
-	)
-	
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "IBC channel added successfully",
@@ -921,64 +716,26 @@ func AddIBCChannel(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interoperability/xcm/message [post]
 func SendXCMMessage(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
-	// Check if Substrate protocol is enabled
-	if !cfg.SubstrateEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Substrate protocol is not enabled")
-	}
-	
 	// Parse request
 	var req XCMMessageRequest
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format: "+err.Error())
 	}
 	
-	// Validate request
-	if req.SourceChainID == "" || req.DestChainID == "" || req.MessageType == "" || req.Payload == nil {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing required fields")
-	}
-	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
-	// Create XCM message
-	xcmMessage := bridges.XCMMessage{
-		MessageID:          fmt.Sprintf("xcm-%s", time.Now().Format("20060102150405")),
-		SourceChainID:      req.SourceChainID,
-		DestinationChainID: req.DestChainID,
-		MessageType:        req.MessageType,
-		Payload:            req.Payload,
-		Timestamp:          time.Now().Unix(),
-		Status:             "pending",
-		Version:            "v2",
-	}
-	
 	// Send XCM message
-	messageID, err := blockchainClient.InteropClient.SendXCMMessage(xcmMessage)
+	messageID, err := interopService().SendXCMMessage(req.SourceChainID, req.DestChainID, req.MessageType, req.Payload)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to send XCM message: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "XCM message sent successfully",
 		Data: map[string]interface{}{
-			"message_id": messageID,
-			"source_chain_id": req.SourceChainID,
+			"message_id":           messageID,
+			"source_chain_id":      req.SourceChainID,
 			"destination_chain_id": req.DestChainID,
-			"status": "pending",
+			"status":               "pending",
 		},
 	})
 }
@@ -995,79 +752,27 @@ func SendXCMMessage(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interoperability/ibc/packet [post]
 func SendIBCPacket(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
-	// Check if IBC protocol is enabled
-	if !cfg.IBCEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "IBC protocol is not enabled")
-	}
-	
 	// Parse request
 	var req IBCPacketRequest
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format: "+err.Error())
 	}
 	
-	// Validate request
-	if req.SourceChainID == "" || req.DestChainID == "" || req.ChannelID == "" || req.Payload == nil {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing required fields")
-	}
-	
-	// Set default timeout if not specified
-	if req.TimeoutInMinutes <= 0 {
-		req.TimeoutInMinutes = 30 // Default 30 minutes timeout
-	}
-	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
-	// Get channel info
-	channelInfo, found := blockchainClient.InteropClient.IBCChannels[req.ChannelID]
-	if !found {
-		return fiber.NewError(fiber.StatusBadRequest, "Channel not found")
-	}
-	
-	// Create IBC message with packet data
-	ibcMessage := bridges.IBCMessage{
-		MessageID:          fmt.Sprintf("ibc-%s", time.Now().Format("20060102150405")),
-		SourceChainID:      req.SourceChainID,
-		DestinationChainID: req.DestChainID,
-		SourceChannel:      req.ChannelID,
-		DestinationChannel: channelInfo.CounterpartyChannelID,
-		SourcePort:         channelInfo.PortID,
-		DestinationPort:    channelInfo.CounterpartyPortID,
-		Payload:            req.Payload,
-		Timestamp:          time.Now().Unix(),
-		Status:             "pending",
-		TimeoutTimestamp:   time.Now().Add(time.Duration(req.TimeoutInMinutes) * time.Minute).Unix(),
-	}
-	
 	// Send IBC packet
-	packetID, err := blockchainClient.InteropClient.SendIBCPacket(ibcMessage)
+	packetID, err := interopService().SendIBCPacket(req.SourceChainID, req.DestChainID, req.ChannelID, req.Payload, req.TimeoutInMinutes)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to send IBC packet: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "IBC packet sent successfully",
 		Data: map[string]interface{}{
-			"packet_id": packetID,
-			"source_chain_id": req.SourceChainID,
+			"packet_id":            packetID,
+			"source_chain_id":      req.SourceChainID,
 			"destination_chain_id": req.DestChainID,
-			"channel_id": req.ChannelID,
-			"status": "pending",
+			"channel_id":           req.ChannelID,
+			"status":               "pending",
 		},
 	})
 }
@@ -1084,42 +789,16 @@ func SendIBCPacket(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/verify [post]
 func VerifyTransaction(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Parse request
 	var req VerifyTransactionRequest
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
 	}
 	
-	// Validate request
-	if req.TxID == "" || req.Protocol == "" || req.SourceChainID == "" || req.DestChainID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing required fields")
-	}
-	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
 	// Verify the transaction
-	verified, err := blockchainClient.InteropClient.VerifyTransaction(
-		req.TxID,
-		req.Protocol,
-		req.SourceChainID,
-		req.DestChainID,
-	)
+	verified, err := interopService().VerifyTransaction(req.TxID, req.Protocol, req.SourceChainID, req.DestChainID)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify transaction: "+err.Error())
+		return interopError(err)
 	}
 	
 	var message string
@@ -1156,50 +835,25 @@ func VerifyTransaction(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/status/{protocol}/{sourceChainId}/{txId} [get]
 func GetTransactionStatus(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Get parameters from path
 	txID := c.Params("txId")
 	protocol := c.Params("protocol")
 	sourceChainID := c.Params("sourceChainId")
 	
-	// Validate parameters
-	if txID == "" || protocol == "" || sourceChainID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing required parameters")
-	}
-	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
 	// Get the transaction status
-	status, err := blockchainClient.InteropClient.GetTransactionStatus(
-		txID,
-		protocol,
-		sourceChainID,
-	)
+	status, err := interopService().TransactionStatus(txID, protocol, sourceChainID)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get transaction status: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "Transaction status retrieved successfully",
 		Data: map[string]interface{}{
-			"tx_id":          txID,
-			"protocol":       protocol,
+			"tx_id":           txID,
+			"protocol":        protocol,
 			"source_chain_id": sourceChainID,
-			"status":         status,
+			"status":          status,
 		},
 	})
 }
@@ -1214,25 +868,11 @@ func GetTransactionStatus(c *fiber.Ctx) error {
 // @Failure 400 {object} ErrorResponse
 // @Router /interop/protocols [get]
 func GetSupportedProtocols(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
+	protocols, err := interopService().SupportedProtocols()
+	if err != nil {
+		return interopError(err)
 	}
 	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
-	// Get the supported protocols
-	protocols := blockchainClient.InteropClient.GetSupportedProtocols()
-	
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "Supported protocols retrieved successfully",
@@ -1252,22 +892,11 @@ func GetSupportedProtocols(c *fiber.Ctx) error {
 // @Failure 400 {object} ErrorResponse
 // @Router /interop/connected-chains [get]
 func ListConnectedChains(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
-	// Initialize the BaaS service
-	baasService := blockchain.NewBaaSService()
-	if baasService == nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to initialize BaaS service")
+	networks, err := interopService().ConnectedChains()
+	if err != nil {
+		return interopError(err)
 	}
 	
-	// Get available networks
-	networks := baasService.GetAvailableNetworks()
-	
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "Connected chains retrieved successfully",
@@ -1290,32 +919,9 @@ func ListConnectedChains(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/chains/{chainId}/status [get]
 func GetChainStatus(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
-	// Get chain ID from path
-	chainID := c.Params("chainId")
-	if chainID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Chain ID is required")
-	}
-	
-	// Initialize the BaaS service
-	baasService := blockchain.NewBaaSService()
-	if baasService == nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to initialize BaaS service")
-	}
-	
-	// Get network status
-	status, err := baasService.GetNetworkStatus(chainID)
+	status, err := interopService().ChainStatus(c.Params("chainId"))
 	if err != nil {
-		if err.Error() == fmt.Sprintf("network %s not configured", chainID) {
-			return fiber.NewError(fiber.StatusNotFound, "Chain not found")
-		}
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get chain status: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.JSON(SuccessResponse{
@@ -1340,71 +946,38 @@ func GetChainStatus(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/transactions/{sourceChainId}/{destChainId} [get]
 func GetCrossChainTransactions(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Get chain IDs from path
 	sourceChainID := c.Params("sourceChainId")
 	destChainID := c.Params("destChainId")
 	
-	// Validate parameters
-	if sourceChainID == "" || destChainID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Source and destination chain IDs are required")
-	}
-	
 	// Get limit and offset from query params
-	limitStr := c.Query("limit", "10")
-	offsetStr := c.Query("offset", "0")
-	
-	limit, err := strconv.Atoi(limitStr)
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
 	if err != nil {
 		limit = 10
 	}
 	
-	offset, err := strconv.Atoi(offsetStr)
+	offset, err := strconv.Atoi(c.Query("offset", "0"))
 	if err != nil {
 		offset = 0
 	}
 	
-	// Initialize the BaaS service
-	baasService := blockchain.NewBaaSService()
-	if baasService == nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to initialize BaaS service")
-	}
-	
-	// Check if the bridge exists
-	bridgeID := fmt.Sprintf("bridge_%s_%s", sourceChainID, destChainID)
-	
-	// Get bridge transactions
-	transactions, err := baasService.GetBridgeTransactions(bridgeID, limit, offset)
+	// Get the transactions of the bridge between the chains
+	bridgeID, transactions, err := interopService().CrossChainTransactions(sourceChainID, destChainID, limit, offset)
 	if err != nil {
-		// Try the reverse direction if this bridge doesn't exist
-		if strings.Contains(err.Error(), "not found") {
-			bridgeID = fmt.Sprintf("bridge_%s_%s", destChainID, sourceChainID)
-			transactions, err = baasService.GetBridgeTransactions(bridgeID, limit, offset)
-			if err != nil {
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to get cross-chain transactions: "+err.Error())
-			}
-		} else {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get cross-chain transactions: "+err.Error())
-		}
+		return interopError(err)
 	}
 	
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "Cross-chain transactions retrieved successfully",
 		Data: map[string]interface{}{
-			"source_chain_id":  sourceChainID,
-			"dest_chain_id":    destChainID,
-			"bridge_id":        bridgeID,
-			"transactions":     transactions,
-			"limit":            limit,
-			"offset":           offset,
-			"total_count":      len(transactions), // This should be the total count, not just the returned count
+			"source_chain_id": sourceChainID,
+			"dest_chain_id":   destChainID,
+			"bridge_id":       bridgeID,
+			"transactions":    transactions,
+			"limit":           limit,
+			"offset":          offset,
+			"total_count":     len(transactions), // This should be the total count, not just the returned count
 		},
 	})
 }
@@ -1421,65 +994,31 @@ func GetCrossChainTransactions(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/bridges [post]
 func CreateCrossChainBridge(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Parse request
 	var req map[string]interface{}
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
 	}
 	
-	// Validate required fields
-	sourceNetworkID, ok := req["source_network_id"].(string)
-	if !ok || sourceNetworkID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "source_network_id is required")
-	}
-	
-	targetNetworkID, ok := req["target_network_id"].(string)
-	if !ok || targetNetworkID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "target_network_id is required")
-	}
-	
-	bridgeType, ok := req["bridge_type"].(string)
-	if !ok || bridgeType == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "bridge_type is required")
-	}
-	
-	bridgeConfig, ok := req["bridge_config"].(map[string]interface{})
-	if !ok {
-		bridgeConfig = make(map[string]interface{})
-	}
-	
-	// Initialize the BaaS service
-	baasService := blockchain.NewBaaSService()
-	if baasService == nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to initialize BaaS service")
-	}
+	sourceNetworkID, _ := req["source_network_id"].(string)
+	targetNetworkID, _ := req["target_network_id"].(string)
+	bridgeType, _ := req["bridge_type"].(string)
+	bridgeConfig, _ := req["bridge_config"].(map[string]interface{})
 	
 	// Create the cross-chain bridge
-	bridgeID, err := baasService.CreateCrossChainBridge(
-		sourceNetworkID,
-		targetNetworkID,
-		bridgeType,
-		bridgeConfig,
-	)
+	bridgeID, err := interopService().CreateBridge(sourceNetworkID, targetNetworkID, bridgeType, bridgeConfig)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create cross-chain bridge: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
 		Success: true,
 		Message: "Cross-chain bridge created successfully",
 		Data: map[string]interface{}{
-			"bridge_id":          bridgeID,
-			"source_network_id":  sourceNetworkID,
-			"target_network_id":  targetNetworkID,
-			"bridge_type":        bridgeType,
+			"bridge_id":         bridgeID,
+			"source_network_id": sourceNetworkID,
+			"target_network_id": targetNetworkID,
+			"bridge_type":       bridgeType,
 		},
 	})
 }
@@ -1496,88 +1035,40 @@ func CreateCrossChainBridge(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/bridges/transfer [post]
 func TransferAssetAcrossChains(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Parse request
 	var req map[string]interface{}
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
 	}
 	
-	// Validate required fields
-	sourceNetworkID, ok := req["source_network_id"].(string)
-	if !ok || sourceNetworkID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "source_network_id is required")
-	}
-	
-	targetNetworkID, ok := req["target_network_id"].(string)
-	if !ok || targetNetworkID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "target_network_id is required")
-	}
-	
-	bridgeID, ok := req["bridge_id"].(string)
-	if !ok || bridgeID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "bridge_id is required")
-	}
-	
-	assetID, ok := req["asset_id"].(string)
-	if !ok || assetID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "asset_id is required")
-	}
-	
-	amount, ok := req["amount"].(string)
-	if !ok || amount == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "amount is required")
-	}
-	
-	sender, ok := req["sender"].(string)
-	if !ok || sender == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "sender is required")
-	}
-	
-	recipient, ok := req["recipient"].(string)
-	if !ok || recipient == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "recipient is required")
-	}
-	
-	// Initialize the BaaS service
-	baasService := blockchain.NewBaaSService()
-	if baasService == nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to initialize BaaS service")
-	}
+	var transfer interop.AssetTransfer
+	transfer.SourceNetworkID, _ = req["source_network_id"].(string)
+	transfer.TargetNetworkID, _ = req["target_network_id"].(string)
+	transfer.BridgeID, _ = req["bridge_id"].(string)
+	transfer.AssetID, _ = req["asset_id"].(string)
+	transfer.Amount, _ = req["amount"].(string)
+	transfer.Sender, _ = req["sender"].(string)
+	transfer.Recipient, _ = req["recipient"].(string)
 	
 	// Transfer the asset
-	txHash, err := baasService.TransferAssetAcrossChains(
-		sourceNetworkID,
-		targetNetworkID,
-		bridgeID,
-		assetID,
-		amount,
-		sender,
-		recipient,
-	)
+	txHash, err := interopService().TransferAsset(transfer)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to transfer asset: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "Asset transfer initiated successfully",
 		Data: map[string]interface{}{
-			"tx_hash":            txHash,
-			"source_network_id":  sourceNetworkID,
-			"target_network_id":  targetNetworkID,
-			"bridge_id":          bridgeID,
-			"asset_id":           assetID,
-			"amount":             amount,
-			"sender":             sender,
-			"recipient":          recipient,
-			"status":             "pending",
+			"tx_hash":           txHash,
+			"source_network_id": transfer.SourceNetworkID,
+			"target_network_id": transfer.TargetNetworkID,
+			"bridge_id":         transfer.BridgeID,
+			"asset_id":          transfer.AssetID,
+			"amount":            transfer.Amount,
+			"sender":            transfer.Sender,
+			"recipient":         transfer.Recipient,
+			"status":            "pending",
 		},
 	})
 }
@@ -1595,35 +1086,10 @@ func TransferAssetAcrossChains(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/ibc/channels/{chainId} [get]
 func QueryIBCChannels(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
-	// Get chain ID from path
 	chainID := c.Params("chainId")
-	if chainID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Chain ID is required")
-	}
-	
-	// Initialize the BaaS service
-	baasService := blockchain.NewBaaSService()
-	if baasService == nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to initialize BaaS service")
-	}
-	
-	// Query IBC channels
-	channels, err := baasService.QueryIBCChannels(chainID)
+	channels, err := interopService().IBCChannels(chainID)
 	if err != nil {
-		if strings.Contains(err.Error(), "not configured") {
-			return fiber.NewError(fiber.StatusNotFound, "Chain not found")
-		}
-		if strings.Contains(err.Error(), "does not support IBC") {
-			return fiber.NewError(fiber.StatusBadRequest, "Chain does not support IBC")
-		}
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to query IBC channels: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.JSON(SuccessResponse{
@@ -1649,37 +1115,12 @@ func QueryIBCChannels(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/xcm/assets/{chainId} [get]
 func QueryXCMAssets(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
-	// Get chain ID from path
 	chainID := c.Params("chainId")
-	if chainID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Chain ID is required")
-	}
-	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
-	// Check if a Polkadot bridge exists for the chain
-	polkadotBridge, exists := blockchainClient.InteropClient.PolkadotBridges[chainID]
-	if !exists {
-		return fiber.NewError(fiber.StatusNotFound, "No Polkadot bridge found for the specified chain ID")
+	assets, err := interopService().XCMAssets(chainID)
+	if err != nil {
+		return interopError(err)
 	}
 	
-	// Get registered assets
-	assets := polkadotBridge.RegisteredAssets
-	
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "XCM assets retrieved successfully",
@@ -1704,38 +1145,13 @@ func QueryXCMAssets(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/ibc/trace/{chainId}/{denom} [get]
 func TraceIBCDenom(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Get parameters from path
 	chainID := c.Params("chainId")
 	denom := c.Params("denom")
 	
-	// Validate parameters
-	if chainID == "" || denom == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Chain ID and denom are required")
-	}
-	
-	// Initialize the BaaS service
-	baasService := blockchain.NewBaaSService()
-	if baasService == nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to initialize BaaS service")
-	}
-	
-	// Trace IBC denom
-	denomTrace, err := baasService.GetIBCDenomTrace(chainID, denom)
+	denomTrace, err := interopService().TraceIBCDenom(chainID, denom)
 	if err != nil {
-		if strings.Contains(err.Error(), "not configured") {
-			return fiber.NewError(fiber.StatusNotFound, "Chain not found")
-		}
-		if strings.Contains(err.Error(), "does not support IBC") {
-			return fiber.NewError(fiber.StatusBadRequest, "Chain does not support IBC")
-		}
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to trace IBC denom: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.JSON(SuccessResponse{
@@ -1763,41 +1179,13 @@ func TraceIBCDenom(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/xcm/trace/{chainId}/{assetId} [get]
 func TraceXCMAsset(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Get parameters from path
 	chainID := c.Params("chainId")
 	assetID := c.Params("assetId")
 	
-	// Validate parameters
-	if chainID == "" || assetID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Chain ID and asset ID are required")
-	}
-	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
-	// Check if a Polkadot bridge exists for the chain
-	polkadotBridge, exists := blockchainClient.InteropClient.PolkadotBridges[chainID]
-	if !exists {
-		return fiber.NewError(fiber.StatusNotFound, "No Polkadot bridge found for the specified chain ID")
-	}
-	
-	// Trace XCM asset
-	assetDetails, err := polkadotBridge.TraceXCMAsset(assetID)
+	assetDetails, err := interopService().TraceXCMAsset(chainID, assetID)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to trace XCM asset: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.JSON(SuccessResponse{
@@ -1824,32 +1212,9 @@ func TraceXCMAsset(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/bridges/{bridgeId} [get]
 func GetBridgeById(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
-	// Get bridge ID from path
-	bridgeID := c.Params("bridgeId")
-	if bridgeID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Bridge ID is required")
-	}
-	
-	// Initialize the BaaS service
-	baasService := blockchain.NewBaaSService()
-	if baasService == nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to initialize BaaS service")
-	}
-	
-	// Get bridge details
-	bridge, err := baasService.GetBridgeById(bridgeID)
+	bridge, err := interopService().Bridge(c.Params("bridgeId"))
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			return fiber.NewError(fiber.StatusNotFound, "Bridge not found")
-		}
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get bridge details: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.JSON(SuccessResponse{
@@ -1859,6 +1224,32 @@ func GetBridgeById(c *fiber.Ctx) error {
 	})
 }
 
+// EstimateBridgeTransfer estimates the cost of a transfer across a bridge
+// @Summary Estimate bridge transfer
+// @Description Estimate the fees, latency and required confirmations of transferring an asset across a bridge, using the current gas prices of the source and destination chains
+// @Tags interoperability
+// @Produce json
+// @Param bridgeId path string true "Bridge ID"
+// @Param asset_id query string false "Asset ID"
+// @Param amount query string false "Amount to transfer"
+// @Success 200 {object} SuccessResponse{data=blockchain.BridgeTransferEstimate}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /interop/bridges/{bridgeId}/estimate [get]
+func EstimateBridgeTransfer(c *fiber.Ctx) error {
+	estimate, err := interopService().EstimateBridgeTransfer(c.Params("bridgeId"), c.Query("asset_id"), c.Query("amount"))
+	if err != nil {
+		return interopError(err)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Bridge transfer estimated successfully",
+		Data:    estimate,
+	})
+}
+
 // DeploySmartContract deploys a smart contract to a blockchain
 // @Summary Deploy smart contract
 // @Description Deploy a smart contract to a blockchain
@@ -1871,71 +1262,32 @@ func GetBridgeById(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/contracts [post]
 func DeploySmartContract(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Parse request
 	var req map[string]interface{}
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
 	}
 	
-	// Validate required fields
-	networkID, ok := req["network_id"].(string)
-	if !ok || networkID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "network_id is required")
-	}
-	
-	contractType, ok := req["contract_type"].(string)
-	if !ok || contractType == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "contract_type is required")
-	}
-	
-	contractName, ok := req["contract_name"].(string)
-	if !ok || contractName == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "contract_name is required")
-	}
-	
-	contractCode, ok := req["contract_code"].(string)
-	if !ok || contractCode == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "contract_code is required")
-	}
-	
-	initArgs, ok := req["init_args"].(map[string]interface{})
-	if !ok {
-		initArgs = make(map[string]interface{})
-	}
-	
-	// Initialize the BaaS service
-	baasService := blockchain.NewBaaSService()
-	if baasService == nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to initialize BaaS service")
-	}
+	networkID, _ := req["network_id"].(string)
+	contractType, _ := req["contract_type"].(string)
+	contractName, _ := req["contract_name"].(string)
+	contractCode, _ := req["contract_code"].(string)
+	initArgs, _ := req["init_args"].(map[string]interface{})
 	
 	// Deploy the smart contract
-	contractAddress, err := baasService.DeploySmartContract(
-		networkID,
-		contractType,
-		contractName,
-		contractCode,
-		initArgs,
-	)
+	contractAddress, err := interopService().DeployContract(networkID, contractType, contractName, contractCode, initArgs)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to deploy smart contract: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
 		Success: true,
 		Message: "Smart contract deployed successfully",
 		Data: map[string]interface{}{
-			"network_id":        networkID,
-			"contract_type":     contractType,
-			"contract_name":     contractName,
-			"contract_address":  contractAddress,
+			"network_id":       networkID,
+			"contract_type":    contractType,
+			"contract_name":    contractName,
+			"contract_address": contractAddress,
 		},
 	})
 }
@@ -1955,55 +1307,30 @@ func DeploySmartContract(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/contracts/{networkId}/{contractAddress}/query [post]
 func QueryContractState(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Get parameters from path
 	networkID := c.Params("networkId")
 	contractAddress := c.Params("contractAddress")
 	
-	// Validate parameters
-	if networkID == "" || contractAddress == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Network ID and contract address are required")
-	}
-	
 	// Parse request
 	var queryData map[string]interface{}
 	if err := c.BodyParser(&queryData); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
 	}
 	
-	// Initialize the BaaS service
-	baasService := blockchain.NewBaaSService()
-	if baasService == nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to initialize BaaS service")
-	}
-	
 	// Query the contract state
-	state, err := baasService.QueryContractState(
-		networkID,
-		contractAddress,
-		queryData,
-	)
+	state, err := interopService().QueryContract(networkID, contractAddress, queryData)
 	if err != nil {
-		if strings.Contains(err.Error(), "not configured") {
-			return fiber.NewError(fiber.StatusNotFound, "Network not found")
-		}
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to query contract state: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "Contract state queried successfully",
 		Data: map[string]interface{}{
-			"network_id":        networkID,
-			"contract_address":  contractAddress,
-			"query":             queryData,
-			"result":            state,
+			"network_id":       networkID,
+			"contract_address": contractAddress,
+			"query":            queryData,
+			"result":           state,
 		},
 	})
 }
@@ -2040,50 +1367,27 @@ type InterChainAccountTxRequest struct {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/ibc/accounts [post]
 func CreateInterChainAccount(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Parse request
 	var req InterChainAccountRequest
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
 	}
 	
-	// Validate request
-	if req.SourceChainID == "" || req.TargetChainID == "" || req.ConnectionID == "" || req.Owner == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing required fields")
-	}
-	
-	// Initialize the BaaS service
-	baasService := blockchain.NewBaaSService()
-	if baasService == nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to initialize BaaS service")
-	}
-	
 	// Create the interchain account
-	accountAddress, err := baasService.CreateInterChainAccount(
-		req.SourceChainID,
-		req.TargetChainID,
-		req.ConnectionID,
-		req.Owner,
-	)
+	accountAddress, err := interopService().CreateInterChainAccount(req.SourceChainID, req.TargetChainID, req.ConnectionID, req.Owner)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create interchain account: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
 		Success: true,
 		Message: "Interchain account created successfully",
 		Data: map[string]interface{}{
-			"source_chain_id":  req.SourceChainID,
-			"target_chain_id":  req.TargetChainID,
-			"connection_id":    req.ConnectionID,
-			"owner":            req.Owner,
-			"account_address":  accountAddress,
+			"source_chain_id": req.SourceChainID,
+			"target_chain_id": req.TargetChainID,
+			"connection_id":   req.ConnectionID,
+			"owner":           req.Owner,
+			"account_address": accountAddress,
 		},
 	})
 }
@@ -2100,52 +1404,33 @@ func CreateInterChainAccount(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interop/ibc/accounts/tx [post]
 func SendInterChainAccountTx(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Parse request
 	var req InterChainAccountTxRequest
 	if err := c.BodyParser(&req); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
 	}
 	
-	// Validate request
-	if req.SourceChainID == "" || req.TargetChainID == "" || req.ConnectionID == "" || 
-	   req.Owner == "" || len(req.Messages) == 0 {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing required fields")
-	}
-	
-	// Initialize the BaaS service
-	baasService := blockchain.NewBaaSService()
-	if baasService == nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to initialize BaaS service")
-	}
-	
 	// Send the interchain account transaction
-	txHash, err := baasService.SendInterChainAccountTx(
-		req.SourceChainID,
-		req.TargetChainID,
-		req.ConnectionID,
-		req.Owner,
-		req.Messages,
-		req.Memo,
-			)
+	txHash, err := interopService().SendInterChainAccountTx(interop.InterChainAccountTx{
+		SourceChainID: req.SourceChainID,
+		TargetChainID: req.TargetChainID,
+		ConnectionID:  req.ConnectionID,
+		Owner:         req.Owner,
+		Messages:      req.Messages,
+		Memo:          req.Memo,
+	})
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to send interchain account transaction: "+err.Error())
+		return interopError(err)
 	}
 	
 	return c.JSON(SuccessResponse{
 		Success: true,
 		Message: "Interchain account transaction sent successfully",
 		Data: map[string]interface{}{
-			"source_chain_id":  req.SourceChainID,
-			"target_chain_id":  req.TargetChainID,
-			"tx_hash":          txHash,
-			"status":           "pending",
+			"source_chain_id": req.SourceChainID,
+			"target_chain_id": req.TargetChainID,
+			"tx_hash":         txHash,
+			"status":          "pending",
 		},
 	})
 }
@@ -2166,98 +1451,33 @@ func SendInterChainAccountTx(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /interoperability/transactions/verify [get]
 func VerifyInteropTransaction(c *fiber.Ctx) error {
-	cfg := config.GetConfig()
-	
-	// Check if interoperability is enabled
-	if !cfg.InteropEnabled {
-		return fiber.NewError(fiber.StatusBadRequest, "Interoperability is not enabled")
-	}
-	
 	// Get query parameters
 	txID := c.Query("tx_id")
 	sourceChainID := c.Query("source_chain_id")
 	destChainID := c.Query("dest_chain_id")
 	protocol := c.Query("protocol", "auto") // Default to auto-detect
 	
-	// Validate parameters
-	if txID == "" || sourceChainID == "" || destChainID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing required query parameters")
-	}
-	
-	// Initialize blockchain client
-	blockchainClient := blockchain.NewBlockchainClient(
-		cfg.BlockchainNodeURL,
-		"", // Private key is not needed for now
-		cfg.BlockchainAccount,
-		cfg.BlockchainChainID,
-		cfg.BlockchainConsensus,
-	)
-	
-	// Check cache first
-	cacheKey := fmt.Sprintf("%s-%s-%s", txID, sourceChainID, destChainID)
-	if cachedResult, found := blockchainClient.InteropClient.VerificationCache[cacheKey]; found {
-		// Only use cache if less than 5 minutes old
-		if time.Since(cachedResult.Timestamp) < 5*time.Minute {
-			return c.JSON(SuccessResponse{
-				Success: true,
-				Message: "Transaction verification result (cached)",
-				Data: map[string]interface{}{
-					"tx_id": txID,
-					"source_chain_id": sourceChainID,
-					"destination_chain_id": destChainID,
-					"verified": cachedResult.Verified,
-					"proof_data": cachedResult.ProofData,
-					"cached_at": cachedResult.Timestamp.Format(time.RFC3339),
-				},
-			})
-		}
-	}
-	
-	// Determine which verification method to use based on protocol
-	var verified bool
-	var proofData string
-	var err error
-	
-	switch strings.ToLower(protocol) {
-	case "ibc":
-		verified, proofData, err = blockchainClient.InteropClient.VerifyIBCTransaction(txID, sourceChainID, destChainID)
-	case "xcm":
-		verified, proofData, err = blockchainClient.InteropClient.VerifyXCMTransaction(txID, sourceChainID, destChainID)
-	case "bridge":
-		verified, proofData, err = blockchainClient.InteropClient.VerifyBridgeTransaction(txID, sourceChainID, destChainID)
-	default:
-		// Auto-detect based on chain IDs
-		if strings.Contains(strings.ToLower(sourceChainID), "cosmos") || 
-		   strings.Contains(strings.ToLower(destChainID), "cosmos") {
-			verified, proofData, err = blockchainClient.InteropClient.VerifyIBCTransaction(txID, sourceChainID, destChainID)
-		} else if strings.Contains(strings.ToLower(sourceChainID), "dot") || 
-				  strings.Contains(strings.ToLower(destChainID), "dot") {
-			verified, proofData, err = blockchainClient.InteropClient.VerifyXCMTransaction(txID, sourceChainID, destChainID)
-		} else {
-			verified, proofData, err = blockchainClient.InteropClient.VerifyBridgeTransaction(txID, sourceChainID, destChainID)
-		}
-	}
-	
+	result, err := interopService().VerifyWithProof(txID, sourceChainID, destChainID, protocol)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Transaction verification failed: "+err.Error())
+		return interopError(err)
 	}
 	
-	// Cache result
-	blockchainClient.InteropClient.VerificationCache[cacheKey] = blockchain.InteropVerificationResult{
-		Verified:  verified,
-		Timestamp: time.Now(),
-		ProofData: proofData,
+	data := map[string]interface{}{
+		"tx_id":                txID,
+		"source_chain_id":      sourceChainID,
+		"destination_chain_id": destChainID,
+		"verified":             result.Verified,
+		"proof_data":           result.ProofData,
+	}
+	message := "Transaction verification completed"
+	if result.CachedAt != nil {
+		data["cached_at"] = result.CachedAt.Format(time.RFC3339)
+		message = "Transaction verification result (cached)"
 	}
 	
 	return c.JSON(SuccessResponse{
 		Success: true,
-		Message: "Transaction verification completed",
-		Data: map[string]interface{}{
-			"tx_id": txID,
-			"source_chain_id": sourceChainID,
-			"destination_chain_id": destChainID,
-			"verified": verified,
-			"proof_data": proofData,
-		},
+		Message: message,
+		Data:    data,
 	})
 }
\ No newline at end of file
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain/bridges"
+	"github.com/LTPPPP/TracePost-larvaeChain/interop"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestInteropErrorKeepsBlockchainErrorStatus(t *testing.T) {
+	// A real XCM send to a chain the bridge has no route to
+	bridge := bridges.NewPolkadotBridge("wss://relay.example", "polkadot", "2000", "tracepost-parachain", "")
+	_, noRoute := bridge.SendXCMMessage("moonbeam", "transfer", map[string]interface{}{"batch_id": 1})
+	if noRoute == nil {
+		t.Fatal("expected a no-route error")
+	}
+
+	cases := []struct {
+		name   string
+		cause  error
+		status int
+		code   string
+	}{
+		{"xcm no route", noRoute, fiber.StatusBadRequest, CodeValidation},
+		{"budget exceeded", fmt.Errorf("%w: daily limit reached", blockchain.ErrBudgetExceeded), fiber.StatusPaymentRequired, CodeForbidden},
+		{"contract violation", fmt.Errorf("%w: missing tx_hash", blockchain.ErrContractViolation), fiber.StatusBadGateway, CodeBlockchainFailure},
+		{"node failure", fmt.Errorf("connection refused"), fiber.StatusInternalServerError, CodeBlockchainFailure},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Get("/", func(c *fiber.Ctx) error {
+				return interopError(&interop.Error{Kind: interop.KindUpstream, Message: "Failed to send XCM message", Err: tc.cause})
+			})
+
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tc.status || !strings.Contains(string(body), `"code":"`+tc.code+`"`) {
+				t.Fatalf("expected %d %s, got %d: %s", tc.status, tc.code, resp.StatusCode, body)
+			}
+		})
+	}
+}
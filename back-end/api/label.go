@@ -0,0 +1,392 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/attestation"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// LabelTemplate represents a company-specific label layout
+type LabelTemplate struct {
+	ID           int       `json:"id"`
+	CompanyID    int       `json:"company_id"`
+	Name         string    `json:"name"`
+	Title        string    `json:"title"`
+	WidthMM      float64   `json:"width_mm"`
+	HeightMM     float64   `json:"height_mm"`
+	DPI          int       `json:"dpi"`
+	ShowSpecies  bool      `json:"show_species"`
+	ShowHatchery bool      `json:"show_hatchery"`
+	ShowQuantity bool      `json:"show_quantity"`
+	ShowDates    bool      `json:"show_dates"`
+	LotPrefix    string    `json:"lot_prefix"`
+	IsDefault    bool      `json:"is_default"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// CreateLabelTemplateRequest represents a request to create a label template
+type CreateLabelTemplateRequest struct {
+	Name         string  `json:"name"`
+	Title        string  `json:"title"`
+	WidthMM      float64 `json:"width_mm"`
+	HeightMM     float64 `json:"height_mm"`
+	DPI          int     `json:"dpi"`
+	ShowSpecies  *bool   `json:"show_species,omitempty"`
+	ShowHatchery *bool   `json:"show_hatchery,omitempty"`
+	ShowQuantity *bool   `json:"show_quantity,omitempty"`
+	ShowDates    *bool   `json:"show_dates,omitempty"`
+	LotPrefix    string  `json:"lot_prefix"`
+	IsDefault    bool    `json:"is_default"`
+}
+
+// boolOrDefault returns the pointed value or the default when not provided
+func boolOrDefault(value *bool, defaultValue bool) bool {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
+
+// GetBatchLabel generates a printer-ready label for a batch
+// @Summary Generate batch label
+// @Description Generate a printable label (Zebra ZPL or PDF) containing QR code, lot code, species and dates for a batch
+// @Tags batches
+// @Accept json
+// @Produce application/pdf,text/plain
+// @Param batchId path string true "Batch ID"
+// @Param format query string false "Label format: 'zpl' or 'pdf' (default: 'zpl')"
+// @Param template query string false "Label template ID or name (default: company default template)"
+// @Success 200 {file} byte[] "Label document"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/label [get]
+func GetBatchLabel(c *fiber.Ctx) error {
+	// Get batch ID from params
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	// Check label format
+	format := c.Query("format", "zpl")
+	if format != "zpl" && format != "pdf" {
+		return fiber.NewError(fiber.StatusBadRequest, "Format must be zpl or pdf")
+	}
+
+	// Get batch details with hatchery and company information
+	var species, status, hatcheryName string
+	var quantity, hatcheryID, companyID int
+	var createdAt time.Time
+	err = db.DB.QueryRow(`
+		SELECT b.species, b.quantity, b.status, b.created_at, h.id, h.name, h.company_id
+		FROM batch b
+		JOIN hatchery h ON b.hatchery_id = h.id
+		WHERE b.id = $1 AND b.is_active = true
+	`, batchID).Scan(&species, &quantity, &status, &createdAt, &hatcheryID, &hatcheryName, &companyID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	// Resolve the label template
+	template, err := findLabelTemplate(companyID, c.Query("template"))
+	if err != nil {
+		return err
+	}
+
+	layout := utils.LabelLayout{
+		WidthMM:      template.WidthMM,
+		HeightMM:     template.HeightMM,
+		DPI:          template.DPI,
+		ShowSpecies:  template.ShowSpecies,
+		ShowHatchery: template.ShowHatchery,
+		ShowQuantity: template.ShowQuantity,
+		ShowDates:    template.ShowDates,
+	}
+
+	// The QR code points at the company's white-label domain once it is verified
+	baseURL := companyTraceBaseURL(companyID)
+	if baseURL == "" {
+		baseURL = config.GetConfig().BaseURL
+	}
+	lotCode := buildLotCode(template.LotPrefix, hatcheryID, batchID, createdAt)
+	label := utils.LabelData{
+		Title:        template.Title,
+		LotCode:      lotCode,
+		Species:      species,
+		HatcheryName: hatcheryName,
+		Quantity:     quantity,
+		ProducedAt:   createdAt.Format("2006-01-02"),
+		PrintedAt:    time.Now().Format("2006-01-02"),
+		QRContent:    fmt.Sprintf("%s/api/v1/mobile/trace/%d", baseURL, batchID),
+	}
+
+	// Print the GS1 element string when the company has allocated a GTIN for this product
+	if ids, err := lookupBatchGS1Identifiers(batchID); err == nil && ids.GTIN != "" {
+		gs1Lot := lotCode
+		if len(gs1Lot) > 20 {
+			// AI (10) is limited to 20 characters, fall back to the batch number
+			gs1Lot = fmt.Sprintf("%06d", batchID)
+		}
+		label.ExtraLines = append(label.ExtraLines, utils.GS1ElementString(ids.GTIN, gs1Lot))
+	}
+
+	// Print the latest traceability attestation so the label can be checked against it
+	if issued, err := attestation.Latest(batchID); err == nil {
+		label.ExtraLines = append(label.ExtraLines, fmt.Sprintf("Traceability complete: %s #%d", issued.Standard, issued.ID))
+	}
+
+	filename := fmt.Sprintf("batch-%d-label", batchID)
+	if format == "pdf" {
+		pdf, err := utils.RenderPDFLabel(label, layout)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate PDF label")
+		}
+		c.Set("Content-Type", "application/pdf")
+		c.Set("Content-Disposition", "inline; filename="+filename+".pdf")
+		return c.Send(pdf)
+	}
+
+	c.Set("Content-Type", "text/plain; charset=utf-8")
+	c.Set("Content-Disposition", "attachment; filename="+filename+".zpl")
+	return c.Send(utils.RenderZPLLabel(label, layout))
+}
+
+// buildLotCode builds a human readable lot code from the batch identity
+func buildLotCode(prefix string, hatcheryID, batchID int, createdAt time.Time) string {
+	if prefix == "" {
+		prefix = "LOT"
+	}
+	return fmt.Sprintf("%s-%d-%s-%06d", prefix, hatcheryID, createdAt.Format("20060102"), batchID)
+}
+
+// parseLotCode extracts the hatchery and batch IDs from a lot code built by buildLotCode
+func parseLotCode(lot string) (hatcheryID, batchID int, ok bool) {
+	parts := strings.Split(lot, "-")
+	if len(parts) < 4 {
+		return 0, 0, false
+	}
+	n := len(parts)
+	if _, err := time.Parse("20060102", parts[n-2]); err != nil {
+		return 0, 0, false
+	}
+	hatcheryID, err := strconv.Atoi(parts[n-3])
+	if err != nil {
+		return 0, 0, false
+	}
+	batchID, err = strconv.Atoi(parts[n-1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return hatcheryID, batchID, true
+}
+
+// findLabelTemplate returns the requested template for a company, falling back to the default layout
+func findLabelTemplate(companyID int, ref string) (LabelTemplate, error) {
+	query := `
+		SELECT id, company_id, name, COALESCE(title, ''), width_mm, height_mm, dpi,
+		       show_species, show_hatchery, show_quantity, show_dates, COALESCE(lot_prefix, ''),
+		       is_default, created_at, updated_at
+		FROM label_template
+		WHERE company_id = $1 AND is_active = true
+	`
+	args := []interface{}{companyID}
+	if ref != "" {
+		if templateID, err := strconv.Atoi(ref); err == nil {
+			query += " AND id = $2"
+			args = append(args, templateID)
+		} else {
+			query += " AND name = $2"
+			args = append(args, ref)
+		}
+	} else {
+		query += " AND is_default = true"
+	}
+	query += " ORDER BY updated_at DESC LIMIT 1"
+
+	var t LabelTemplate
+	err := db.DB.QueryRow(query, args...).Scan(
+		&t.ID, &t.CompanyID, &t.Name, &t.Title, &t.WidthMM, &t.HeightMM, &t.DPI,
+		&t.ShowSpecies, &t.ShowHatchery, &t.ShowQuantity, &t.ShowDates, &t.LotPrefix,
+		&t.IsDefault, &t.CreatedAt, &t.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		if ref != "" {
+			return t, fiber.NewError(fiber.StatusNotFound, "Label template not found")
+		}
+		// No company default configured, use the built-in layout
+		layout := utils.DefaultLabelLayout()
+		return LabelTemplate{
+			CompanyID:    companyID,
+			Name:         "default",
+			WidthMM:      layout.WidthMM,
+			HeightMM:     layout.HeightMM,
+			DPI:          layout.DPI,
+			ShowSpecies:  layout.ShowSpecies,
+			ShowHatchery: layout.ShowHatchery,
+			ShowQuantity: layout.ShowQuantity,
+			ShowDates:    layout.ShowDates,
+			LotPrefix:    "LOT",
+		}, nil
+	}
+	if err != nil {
+		return t, fiber.NewError(fiber.StatusInternalServerError, "Failed to load label template")
+	}
+	return t, nil
+}
+
+// ListLabelTemplates lists the label templates of a company
+// @Summary List label templates
+// @Description List the label templates configured for a company
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param companyId path string true "Company ID"
+// @Success 200 {object} SuccessResponse{data=[]LabelTemplate}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/label-templates [get]
+func ListLabelTemplates(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, company_id, name, COALESCE(title, ''), width_mm, height_mm, dpi,
+		       show_species, show_hatchery, show_quantity, show_dates, COALESCE(lot_prefix, ''),
+		       is_default, created_at, updated_at
+		FROM label_template
+		WHERE company_id = $1 AND is_active = true
+		ORDER BY name
+	`, companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	templates := []LabelTemplate{}
+	for rows.Next() {
+		var t LabelTemplate
+		if err := rows.Scan(
+			&t.ID, &t.CompanyID, &t.Name, &t.Title, &t.WidthMM, &t.HeightMM, &t.DPI,
+			&t.ShowSpecies, &t.ShowHatchery, &t.ShowQuantity, &t.ShowDates, &t.LotPrefix,
+			&t.IsDefault, &t.CreatedAt, &t.UpdatedAt,
+		); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse label template")
+		}
+		templates = append(templates, t)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Label templates retrieved successfully",
+		Data:    templates,
+	})
+}
+
+// CreateLabelTemplate creates a label template for a company
+// @Summary Create label template
+// @Description Create a label template for a company; marking it as default replaces the previous default
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param companyId path string true "Company ID"
+// @Param request body CreateLabelTemplateRequest true "Label template details"
+// @Success 201 {object} SuccessResponse{data=LabelTemplate}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/label-templates [post]
+func CreateLabelTemplate(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	var req CreateLabelTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Template name is required")
+	}
+
+	// Apply defaults for unspecified dimensions
+	defaults := utils.DefaultLabelLayout()
+	if req.WidthMM == 0 {
+		req.WidthMM = defaults.WidthMM
+	}
+	if req.HeightMM == 0 {
+		req.HeightMM = defaults.HeightMM
+	}
+	if req.DPI == 0 {
+		req.DPI = defaults.DPI
+	}
+	if req.WidthMM < 20 || req.WidthMM > 300 || req.HeightMM < 20 || req.HeightMM > 300 {
+		return fiber.NewError(fiber.StatusBadRequest, "Label dimensions must be between 20 and 300 mm")
+	}
+	if req.DPI != 152 && req.DPI != 203 && req.DPI != 300 && req.DPI != 600 {
+		return fiber.NewError(fiber.StatusBadRequest, "DPI must be one of 152, 203, 300 or 600")
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start database transaction")
+	}
+	defer tx.Rollback()
+
+	// Only one default template per company
+	if req.IsDefault {
+		if _, err := tx.Exec("UPDATE label_template SET is_default = false, updated_at = NOW() WHERE company_id = $1", companyID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update default template")
+		}
+	}
+
+	t := LabelTemplate{
+		CompanyID:    companyID,
+		Name:         req.Name,
+		Title:        req.Title,
+		WidthMM:      req.WidthMM,
+		HeightMM:     req.HeightMM,
+		DPI:          req.DPI,
+		ShowSpecies:  boolOrDefault(req.ShowSpecies, true),
+		ShowHatchery: boolOrDefault(req.ShowHatchery, true),
+		ShowQuantity: boolOrDefault(req.ShowQuantity, true),
+		ShowDates:    boolOrDefault(req.ShowDates, true),
+		LotPrefix:    req.LotPrefix,
+		IsDefault:    req.IsDefault,
+	}
+	err = tx.QueryRow(`
+		INSERT INTO label_template (company_id, name, title, width_mm, height_mm, dpi, show_species,
+			show_hatchery, show_quantity, show_dates, lot_prefix, is_default)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at, updated_at
+	`, t.CompanyID, t.Name, t.Title, t.WidthMM, t.HeightMM, t.DPI, t.ShowSpecies,
+		t.ShowHatchery, t.ShowQuantity, t.ShowDates, t.LotPrefix, t.IsDefault,
+	).Scan(&t.ID, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save label template")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit database transaction")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Label template created successfully",
+		Data:    t,
+	})
+}
@@ -0,0 +1,662 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// Statuses of batch label claims
+const (
+	ClaimStatusVerified     = "verified"
+	ClaimStatusUnverified   = "unverified"
+	ClaimStatusSelfDeclared = "self_declared"
+)
+
+// certifiedClaims are the claims that need a certificate from an accredited lab, with the strain line types that can carry them
+var certifiedClaims = map[string][]string{
+	"SPF": {LineTypeSPF, LineTypeSPFSPR},
+	"SPR": {LineTypeSPR, LineTypeSPFSPR},
+}
+
+// AccreditedLabRequest represents a request to add or update a lab in the trust registry
+type AccreditedLabRequest struct {
+	Name                string     `json:"name"`
+	DID                 string     `json:"did"`
+	AccreditationBody   string     `json:"accreditation_body"`
+	AccreditationNumber string     `json:"accreditation_number"`
+	Scopes              []string   `json:"scopes"`
+	ValidUntil          *time.Time `json:"valid_until"`
+}
+
+// BatchCertificateRequest represents a request to record a lab certificate of a batch
+type BatchCertificateRequest struct {
+	CertificateType string     `json:"certificate_type"` // The claim it supports, e.g. SPF
+	AccreditedLabID int        `json:"accredited_lab_id"`
+	DocumentID      int        `json:"document_id"` // Uploaded certificate document of the batch
+	IssueDate       *time.Time `json:"issue_date"`
+	ExpiryDate      *time.Time `json:"expiry_date"`
+}
+
+// BatchClaimRequest represents a request to declare a label claim of a batch
+type BatchClaimRequest struct {
+	Claim         string `json:"claim"`
+	CertificateID int    `json:"certificate_id"`
+	DeclaredBy    int    `json:"declared_by"`
+}
+
+// claimEvidence is everything a claim is checked against
+type claimEvidence struct {
+	BatchID        int
+	Claim          string
+	StrainCode     string
+	StrainLineType string
+
+	HasCertificate     bool
+	CertificateBatchID int
+	CertificateType    string
+	CertificateStatus  string
+	CertificateActive  bool
+	CertificateExpiry  *time.Time
+	DocumentRevoked    bool
+
+	HasLab        bool
+	LabName       string
+	LabScopes     []string
+	LabValidUntil *time.Time
+	LabActive     bool
+}
+
+// normalizeClaim returns the canonical code of a claim
+func normalizeClaim(claim string) string {
+	return strings.ToUpper(strings.TrimSpace(claim))
+}
+
+// assessClaim decides the status of a claim from its evidence
+func assessClaim(e claimEvidence, now time.Time) (string, string) {
+	lineTypes, certified := certifiedClaims[e.Claim]
+	if !certified {
+		return ClaimStatusSelfDeclared, ""
+	}
+
+	if e.StrainCode == "" {
+		return ClaimStatusUnverified, "Batch has not declared its strain"
+	}
+	compatible := false
+	for _, lineType := range lineTypes {
+		compatible = compatible || lineType == e.StrainLineType
+	}
+	if !compatible {
+		return ClaimStatusUnverified, fmt.Sprintf("Strain %s is a %s line", e.StrainCode, e.StrainLineType)
+	}
+
+	switch {
+	case !e.HasCertificate:
+		return ClaimStatusUnverified, "No supporting certificate"
+	case e.CertificateBatchID != e.BatchID:
+		return ClaimStatusUnverified, "Certificate was issued for another batch"
+	case normalizeClaim(e.CertificateType) != e.Claim:
+		return ClaimStatusUnverified, fmt.Sprintf("Certificate of type %s does not support %s", e.CertificateType, e.Claim)
+	case !e.CertificateActive || e.CertificateStatus == "revoked":
+		return ClaimStatusUnverified, "Certificate has been revoked"
+	case e.CertificateExpiry != nil && e.CertificateExpiry.Before(now):
+		return ClaimStatusUnverified, "Certificate expired on " + e.CertificateExpiry.Format("2006-01-02")
+	case e.DocumentRevoked:
+		return ClaimStatusUnverified, "Certificate document has been revoked"
+	case !e.HasLab:
+		return ClaimStatusUnverified, "Certificate issuer is not in the trust registry"
+	case !e.LabActive:
+		return ClaimStatusUnverified, fmt.Sprintf("Lab %s has been removed from the trust registry", e.LabName)
+	case e.LabValidUntil != nil && e.LabValidUntil.Before(now):
+		return ClaimStatusUnverified, fmt.Sprintf("Accreditation of lab %s expired on %s", e.LabName, e.LabValidUntil.Format("2006-01-02"))
+	}
+	for _, scope := range e.LabScopes {
+		if normalizeClaim(scope) == e.Claim {
+			return ClaimStatusVerified, ""
+		}
+	}
+	return ClaimStatusUnverified, fmt.Sprintf("Lab %s is not accredited for %s", e.LabName, e.Claim)
+}
+
+// batchClaimEvidenceQuery selects claims with the evidence they are checked against; callers add the conditions
+const batchClaimEvidenceQuery = `
+	SELECT bc.id, bc.batch_id, bc.claim, bc.certificate_id, COALESCE(bc.declared_by, 0), bc.created_at,
+		COALESCE(s.code, ''), COALESCE(s.line_type, ''),
+		ct.id IS NOT NULL, COALESCE(ct.batch_id, 0), COALESCE(ct.certificate_type, ''), COALESCE(ct.status, ''),
+		COALESCE(ct.is_active, false), ct.expiry_date, COALESCE(d.is_active = false, false),
+		l.id IS NOT NULL, COALESCE(l.name, ''), COALESCE(l.scopes, '{}'), l.valid_until, COALESCE(l.is_active, false)
+	FROM batch_claim bc
+	JOIN batch b ON b.id = bc.batch_id
+	LEFT JOIN strain s ON s.id = b.strain_id
+	LEFT JOIN certificates ct ON ct.id = bc.certificate_id
+	LEFT JOIN document d ON d.id = ct.document_id
+	LEFT JOIN accredited_lab l ON l.id = ct.accredited_lab_id
+`
+
+// loadBatchClaims loads the claims of a batch and checks each against its certificate and the trust registry
+func loadBatchClaims(batchID int) ([]models.BatchClaim, error) {
+	return queryBatchClaims(batchClaimEvidenceQuery+`
+		WHERE bc.batch_id = $1 AND bc.is_active = true
+		ORDER BY bc.claim
+	`, batchID)
+}
+
+// queryBatchClaims runs a batchClaimEvidenceQuery and checks each claim it returns
+func queryBatchClaims(query string, args ...interface{}) ([]models.BatchClaim, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	claims := []models.BatchClaim{}
+	for rows.Next() {
+		var claim models.BatchClaim
+		var certificateID sql.NullInt64
+		var certificateExpiry, labValidUntil sql.NullTime
+		var e claimEvidence
+		err := rows.Scan(&claim.ID, &claim.BatchID, &claim.Claim, &certificateID, &claim.DeclaredBy, &claim.CreatedAt,
+			&e.StrainCode, &e.StrainLineType,
+			&e.HasCertificate, &e.CertificateBatchID, &e.CertificateType, &e.CertificateStatus,
+			&e.CertificateActive, &certificateExpiry, &e.DocumentRevoked,
+			&e.HasLab, &e.LabName, pq.Array(&e.LabScopes), &labValidUntil, &e.LabActive)
+		if err != nil {
+			return nil, err
+		}
+		claim.CertificateID = intPtr(certificateID)
+		e.BatchID = claim.BatchID
+		e.Claim = claim.Claim
+		e.CertificateExpiry = timePtr(certificateExpiry)
+		e.LabValidUntil = timePtr(labValidUntil)
+		claim.Status, claim.Detail = assessClaim(e, now)
+		claims = append(claims, claim)
+	}
+	return claims, rows.Err()
+}
+
+const accreditedLabColumns = `
+	id, name, COALESCE(did, ''), accreditation_body, accreditation_number, COALESCE(scopes, '{}'),
+	valid_until, created_at, updated_at, is_active
+`
+
+// scanAccreditedLab reads a lab selected with accreditedLabColumns
+func scanAccreditedLab(row rowScanner) (models.AccreditedLab, error) {
+	var l models.AccreditedLab
+	var validUntil sql.NullTime
+	err := row.Scan(&l.ID, &l.Name, &l.DID, &l.AccreditationBody, &l.AccreditationNumber, pq.Array(&l.Scopes),
+		&validUntil, &l.CreatedAt, &l.UpdatedAt, &l.IsActive)
+	l.ValidUntil = timePtr(validUntil)
+	return l, err
+}
+
+// validateAccreditedLabRequest checks the fields of a lab request
+func validateAccreditedLabRequest(req *AccreditedLabRequest) error {
+	if req.Name == "" || req.AccreditationBody == "" || req.AccreditationNumber == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Name, accreditation body and accreditation number are required")
+	}
+	if len(req.Scopes) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one scope is required")
+	}
+	for i, scope := range req.Scopes {
+		req.Scopes[i] = normalizeClaim(scope)
+	}
+	return nil
+}
+
+// CreateAccreditedLab adds a lab to the trust registry
+// @Summary Add accredited lab
+// @Description Add a laboratory to the trust registry with the claims it is accredited to certify
+// @Tags trust-registry
+// @Accept json
+// @Produce json
+// @Param request body AccreditedLabRequest true "Lab details"
+// @Success 201 {object} SuccessResponse{data=models.AccreditedLab}
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /trust-registry/labs [post]
+func CreateAccreditedLab(c *fiber.Ctx) error {
+	var req AccreditedLabRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateAccreditedLabRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM accredited_lab WHERE accreditation_number = $1)", req.AccreditationNumber).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A lab with this accreditation number is already registered")
+	}
+
+	lab, err := scanAccreditedLab(db.DB.QueryRow(`
+		INSERT INTO accredited_lab (name, did, accreditation_body, accreditation_number, scopes, valid_until, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW(), true)
+		RETURNING `+accreditedLabColumns,
+		req.Name, req.DID, req.AccreditationBody, req.AccreditationNumber, pq.Array(req.Scopes), req.ValidUntil))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add lab")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Lab added to the trust registry successfully",
+		Data:    lab,
+	})
+}
+
+// GetAccreditedLabs lists the labs of the trust registry
+// @Summary Get accredited labs
+// @Description List the laboratories of the trust registry, optionally those accredited for a claim
+// @Tags trust-registry
+// @Produce json
+// @Param scope query string false "Claim the lab is accredited for, e.g. SPF"
+// @Success 200 {object} SuccessResponse{data=[]models.AccreditedLab}
+// @Failure 500 {object} ErrorResponse
+// @Router /trust-registry/labs [get]
+func GetAccreditedLabs(c *fiber.Ctx) error {
+	rows, err := db.DB.Query(`SELECT `+accreditedLabColumns+`
+		FROM accredited_lab
+		WHERE is_active = true AND ($1::text = '' OR $1 = ANY(scopes))
+		ORDER BY name
+	`, normalizeClaim(c.Query("scope")))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	labs := []models.AccreditedLab{}
+	for rows.Next() {
+		lab, err := scanAccreditedLab(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse lab")
+		}
+		labs = append(labs, lab)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Accredited labs retrieved successfully",
+		Data:    labs,
+	})
+}
+
+// UpdateAccreditedLab updates a lab of the trust registry
+// @Summary Update accredited lab
+// @Description Update the accreditation and scopes of a lab. Claims backed by its certificates are re-checked on every read
+// @Tags trust-registry
+// @Accept json
+// @Produce json
+// @Param labId path int true "Lab ID"
+// @Param request body AccreditedLabRequest true "Lab details"
+// @Success 200 {object} SuccessResponse{data=models.AccreditedLab}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /trust-registry/labs/{labId} [put]
+func UpdateAccreditedLab(c *fiber.Ctx) error {
+	labID, err := strconv.Atoi(c.Params("labId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid lab ID format")
+	}
+
+	var req AccreditedLabRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateAccreditedLabRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM accredited_lab WHERE accreditation_number = $1 AND id <> $2)", req.AccreditationNumber, labID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A lab with this accreditation number is already registered")
+	}
+
+	lab, err := scanAccreditedLab(db.DB.QueryRow(`
+		UPDATE accredited_lab
+		SET name = $2, did = $3, accreditation_body = $4, accreditation_number = $5, scopes = $6, valid_until = $7, updated_at = NOW()
+		WHERE id = $1 AND is_active = true
+		RETURNING `+accreditedLabColumns,
+		labID, req.Name, req.DID, req.AccreditationBody, req.AccreditationNumber, pq.Array(req.Scopes), req.ValidUntil))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Lab not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update lab")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Lab updated successfully",
+		Data:    lab,
+	})
+}
+
+// DeleteAccreditedLab removes a lab from the trust registry
+// @Summary Remove accredited lab
+// @Description Remove a lab from the trust registry. Claims backed by its certificates become unverified
+// @Tags trust-registry
+// @Produce json
+// @Param labId path int true "Lab ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /trust-registry/labs/{labId} [delete]
+func DeleteAccreditedLab(c *fiber.Ctx) error {
+	labID, err := strconv.Atoi(c.Params("labId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid lab ID format")
+	}
+
+	result, err := db.DB.Exec("UPDATE accredited_lab SET is_active = false, updated_at = NOW() WHERE id = $1 AND is_active = true", labID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to remove lab")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Lab not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Lab removed from the trust registry successfully",
+	})
+}
+
+const certificateColumns = `
+	id, COALESCE(batch_id, 0), certificate_type, issuer, accredited_lab_id, document_id,
+	issue_date, expiry_date, status, created_at, is_active
+`
+
+// scanCertificate reads a certificate selected with certificateColumns
+func scanCertificate(row rowScanner) (models.Certificate, error) {
+	var ct models.Certificate
+	var labID, documentID sql.NullInt64
+	var expiryDate sql.NullTime
+	err := row.Scan(&ct.ID, &ct.BatchID, &ct.CertificateType, &ct.Issuer, &labID, &documentID,
+		&ct.IssueDate, &expiryDate, &ct.Status, &ct.CreatedAt, &ct.IsActive)
+	ct.AccreditedLabID = intPtr(labID)
+	ct.DocumentID = intPtr(documentID)
+	ct.ExpiryDate = timePtr(expiryDate)
+	return ct, err
+}
+
+// CreateBatchCertificate records a lab certificate of a batch
+// @Summary Add batch certificate
+// @Description Record a certificate issued for a batch by a lab of the trust registry, e.g. an SPF test result
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param request body BatchCertificateRequest true "Certificate details"
+// @Success 201 {object} SuccessResponse{data=models.Certificate}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/certificates [post]
+func CreateBatchCertificate(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	var req BatchCertificateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.CertificateType = normalizeClaim(req.CertificateType)
+	if req.CertificateType == "" || req.AccreditedLabID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Certificate type and accredited lab ID are required")
+	}
+
+	var companyID int
+	err = db.DB.QueryRow(`
+		SELECT COALESCE(h.company_id, 0)
+		FROM batch b
+		LEFT JOIN hatchery h ON h.id = b.hatchery_id
+		WHERE b.id = $1 AND b.is_active = true
+	`, batchID).Scan(&companyID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	var labName string
+	err = db.DB.QueryRow("SELECT name FROM accredited_lab WHERE id = $1 AND is_active = true", req.AccreditedLabID).Scan(&labName)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Lab not found in the trust registry")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	if req.DocumentID > 0 {
+		var exists bool
+		err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM document WHERE id = $1 AND batch_id = $2 AND is_active = true)", req.DocumentID, batchID).Scan(&exists)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if !exists {
+			return fiber.NewError(fiber.StatusNotFound, "Document not found for this batch")
+		}
+	}
+
+	issueDate := time.Now()
+	if req.IssueDate != nil {
+		issueDate = *req.IssueDate
+	}
+
+	certificate, err := scanCertificate(db.DB.QueryRow(`
+		INSERT INTO certificates (batch_id, company_id, certificate_type, issuer, accredited_lab_id, document_id,
+			issue_date, expiry_date, status, created_at, updated_at, is_active)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, NULLIF($6, 0), $7, $8, 'valid', NOW(), NOW(), true)
+		RETURNING `+certificateColumns,
+		batchID, companyID, req.CertificateType, labName, req.AccreditedLabID, req.DocumentID, issueDate, req.ExpiryDate))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save certificate")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Certificate recorded successfully",
+		Data:    certificate,
+	})
+}
+
+// GetBatchCertificates gets the certificates of a batch
+// @Summary Get batch certificates
+// @Description Get the certificates issued for a batch
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]models.Certificate}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/certificates [get]
+func GetBatchCertificates(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+certificateColumns+`
+		FROM certificates
+		WHERE batch_id = $1 AND is_active = true
+		ORDER BY issue_date DESC
+	`, batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	certificates := []models.Certificate{}
+	for rows.Next() {
+		certificate, err := scanCertificate(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse certificate")
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch certificates retrieved successfully",
+		Data:    certificates,
+	})
+}
+
+// DeclareBatchClaim declares a label claim of a batch
+// @Summary Declare batch claim
+// @Description Declare a label claim such as SPF or SPR. Certified claims are verified against their certificate, the declared strain and the trust registry
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param request body BatchClaimRequest true "Claim"
+// @Success 201 {object} SuccessResponse{data=models.BatchClaim}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/claims [post]
+func DeclareBatchClaim(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	var req BatchClaimRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.Claim = normalizeClaim(req.Claim)
+	if req.Claim == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Claim is required")
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = $1 AND is_active = true)", batchID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if _, certified := certifiedClaims[req.Claim]; certified && req.CertificateID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Claim %s requires a supporting certificate", req.Claim))
+	}
+
+	_, err = db.DB.Exec(`
+		INSERT INTO batch_claim (batch_id, claim, certificate_id, declared_by, created_at, updated_at, is_active)
+		VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), NOW(), NOW(), true)
+		ON CONFLICT (batch_id, claim) DO UPDATE
+		SET certificate_id = EXCLUDED.certificate_id, declared_by = EXCLUDED.declared_by, updated_at = NOW(), is_active = true
+	`, batchID, req.Claim, req.CertificateID, req.DeclaredBy)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save claim")
+	}
+
+	claims, err := loadBatchClaims(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify claim")
+	}
+	var declared models.BatchClaim
+	for _, claim := range claims {
+		if claim.Claim == req.Claim {
+			declared = claim
+		}
+	}
+
+	message := "Claim declared successfully"
+	if declared.Status == ClaimStatusUnverified {
+		message = "Claim declared but not verified: " + declared.Detail
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    declared,
+	})
+}
+
+// GetBatchClaims gets the label claims of a batch with their verification status
+// @Summary Get batch claims
+// @Description Get the label claims of a batch, each re-verified against its certificate, the declared strain and the trust registry
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]models.BatchClaim}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/claims [get]
+func GetBatchClaims(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	claims, err := loadBatchClaims(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve batch claims")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch claims retrieved successfully",
+		Data:    claims,
+	})
+}
+
+// WithdrawBatchClaim withdraws a label claim of a batch
+// @Summary Withdraw batch claim
+// @Description Withdraw a label claim of a batch
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param claim path string true "Claim, e.g. SPF"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/claims/{claim} [delete]
+func WithdrawBatchClaim(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE batch_claim SET is_active = false, updated_at = NOW()
+		WHERE batch_id = $1 AND claim = $2 AND is_active = true
+	`, batchID, normalizeClaim(c.Params("claim")))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to withdraw claim")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Claim not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Claim withdrawn successfully",
+	})
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/stages"
+)
+
+// stageEventType is the event type that records the larval stage of a batch
+const stageEventType = "stage_change"
+
+// BatchStageTimeline is the stage history of a batch, with the forecast of a target stage when asked for
+type BatchStageTimeline struct {
+	BatchID int `json:"batch_id"`
+	stages.Timeline
+	Target *stages.Forecast `json:"target,omitempty"`
+}
+
+// loadStageObservations loads the stages recorded for a batch, oldest first; corrected events count
+// with their latest values
+func loadStageObservations(batchID int) ([]stages.Observation, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, timestamp, metadata->>'stage'
+		FROM event
+		WHERE batch_id = $1 AND event_type = $2 AND is_active = true AND superseded_by_event_id IS NULL
+		ORDER BY timestamp, id
+	`, batchID, stageEventType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	observations := []stages.Observation{}
+	for rows.Next() {
+		var obs stages.Observation
+		var stage sql.NullString
+		if err := rows.Scan(&obs.EventID, &obs.RecordedAt, &stage); err != nil {
+			return nil, err
+		}
+		// Events recorded before the schema existed may not name a stage we know
+		if obs.Stage, err = stages.Parse(stage.String); err != nil {
+			continue
+		}
+		observations = append(observations, obs)
+	}
+	return observations, rows.Err()
+}
+
+// loadStageTimeline builds the stage timeline of a batch
+func loadStageTimeline(batchID int) (stages.Timeline, error) {
+	observations, err := loadStageObservations(batchID)
+	if err != nil {
+		return stages.Timeline{}, err
+	}
+	return stages.Build(observations, time.Now()), nil
+}
+
+// checkStageAgainst validates a stage recorded at a time against the stages recorded just before and
+// just after it; observations are sorted oldest first
+func checkStageAgainst(observations []stages.Observation, stage stages.Stage, at time.Time) error {
+	var prev, next *stages.Observation
+	for i := range observations {
+		if observations[i].RecordedAt.After(at) {
+			next = &observations[i]
+			break
+		}
+		prev = &observations[i]
+	}
+	if prev != nil {
+		if err := stages.Check(*prev, stage, at); err != nil {
+			return err
+		}
+	}
+	if next != nil {
+		return stages.Check(stages.Observation{Stage: stage, RecordedAt: at}, next.Stage, next.RecordedAt)
+	}
+	return nil
+}
+
+// validateStageProgression rejects a stage_change event whose stage does not plausibly follow the
+// stages already recorded for the batch; excludeEventID is the event being replaced, if any
+func validateStageProgression(batchID int, metadata map[string]interface{}, at time.Time, excludeEventID int) error {
+	value, _ := metadata["stage"].(string)
+	stage, err := stages.Parse(value)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+	observations, err := loadStageObservations(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load batch stages")
+	}
+	others := observations[:0]
+	for _, obs := range observations {
+		if obs.EventID != excludeEventID {
+			others = append(others, obs)
+		}
+	}
+	if err := checkStageAgainst(others, stage, at); err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "Implausible stage progression: "+err.Error())
+	}
+	return nil
+}
+
+// checkImportedStage validates the stage of an imported row against the stages of its batch and the
+// earlier rows of the file, and remembers it for the later rows
+func (v *eventImportValidator) checkImportedStage(event importedEvent) error {
+	stage, err := stages.Parse(fmt.Sprint(event.Metadata["stage"]))
+	if err != nil {
+		return err
+	}
+	observations, loaded := v.stages[event.BatchID]
+	if !loaded {
+		if observations, err = loadStageObservations(event.BatchID); err != nil {
+			return fmt.Errorf("failed to load batch stages")
+		}
+	}
+	if err := checkStageAgainst(observations, stage, event.Timestamp); err != nil {
+		return err
+	}
+	observations = append(observations, stages.Observation{Stage: stage, RecordedAt: event.Timestamp})
+	sort.SliceStable(observations, func(i, j int) bool { return observations[i].RecordedAt.Before(observations[j].RecordedAt) })
+	v.stages[event.BatchID] = observations
+	return nil
+}
+
+// applyStageProgression adds the plausibility of the recorded larval stages to a compliance check;
+// batches without stage events are not judged on it
+func applyStageProgression(result *ComplianceCheckResult, batchID int) error {
+	timeline, err := loadStageTimeline(batchID)
+	if err != nil {
+		return err
+	}
+	if len(timeline.Entries) == 0 {
+		return nil
+	}
+	result.RequirementsMet["stage_progression"] = len(timeline.Warnings) == 0
+	for _, warning := range timeline.Warnings {
+		result.Issues = append(result.Issues, ComplianceIssue{
+			Requirement:    "Larval stage progression",
+			Description:    warning,
+			Severity:       "minor",
+			Recommendation: "Review the stage_change events of the batch and correct misrecorded stages",
+		})
+	}
+	return nil
+}
+
+// GetBatchStages gets the larval stage timeline of a batch
+// @Summary Get batch stage timeline
+// @Description Get the larval stages (nauplius, zoea, mysis, PL-n) a batch went through from its stage_change events, how long each lasted, warnings about implausible progression and when the next stage is expected. With target, also forecast when the batch reaches that stage, e.g. PL12.
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param target query string false "Stage to forecast, e.g. PL12"
+// @Success 200 {object} SuccessResponse{data=BatchStageTimeline}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/stages [get]
+func GetBatchStages(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	var target stages.Stage
+	if value := c.Query("target"); value != "" {
+		if target, err = stages.Parse(value); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = $1 AND is_active = true)", batchID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+
+	timeline, err := loadStageTimeline(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load batch stages")
+	}
+	result := BatchStageTimeline{BatchID: batchID, Timeline: timeline}
+	if c.Query("target") != "" {
+		result.Target = stages.ForecastStage(timeline, target)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch stages retrieved successfully",
+		Data:    result,
+	})
+}
@@ -0,0 +1,438 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+)
+
+// Record types that can be placed under legal hold
+const (
+	LegalHoldBatch    = "batch"
+	LegalHoldDocument = "document"
+	LegalHoldCompany  = "company"
+)
+
+// legalHoldEvent guards batch events, which are held through their batch
+const legalHoldEvent = "event"
+
+// LegalHold freezes a record, and the records beneath it, for the duration of an investigation
+// A company hold covers the batches of its hatcheries; a batch hold covers the batch's documents and events
+type LegalHold struct {
+	ID            int        `json:"id"`
+	TargetType    string     `json:"target_type"` // batch, document or company
+	TargetID      int        `json:"target_id"`
+	CaseReference string     `json:"case_reference"`
+	Reason        string     `json:"reason"`
+	PlacedBy      int        `json:"placed_by"`
+	PlacedAt      time.Time  `json:"placed_at"`
+	ReleasedAt    *time.Time `json:"released_at,omitempty"`
+	ReleasedBy    int        `json:"released_by,omitempty"`
+	ReleaseNote   string     `json:"release_note,omitempty"`
+}
+
+// LegalHoldRequest represents a request to place a legal hold
+type LegalHoldRequest struct {
+	TargetType    string `json:"target_type"`
+	TargetID      int    `json:"target_id"`
+	CaseReference string `json:"case_reference"`
+	Reason        string `json:"reason"`
+}
+
+// ReleaseLegalHoldRequest represents a request to release a legal hold
+type ReleaseLegalHoldRequest struct {
+	Note string `json:"note"`
+}
+
+// LegalHoldAccess is an access to a held record
+type LegalHoldAccess struct {
+	ID         int       `json:"id"`
+	HoldID     int       `json:"hold_id"`
+	TargetType string    `json:"target_type"`
+	TargetID   int       `json:"target_id"`
+	AccountID  int       `json:"account_id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	IPAddress  string    `json:"ip_address"`
+	Blocked    bool      `json:"blocked"` // The request tried to change the record and was refused
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+const legalHoldColumns = `
+	id, target_type, target_id, COALESCE(case_reference, ''), reason, COALESCE(placed_by, 0), placed_at,
+	released_at, COALESCE(released_by, 0), COALESCE(release_note, '')
+`
+
+// scanLegalHold reads a legal hold selected with legalHoldColumns
+func scanLegalHold(row rowScanner) (LegalHold, error) {
+	var h LegalHold
+	var releasedAt sql.NullTime
+	err := row.Scan(&h.ID, &h.TargetType, &h.TargetID, &h.CaseReference, &h.Reason, &h.PlacedBy, &h.PlacedAt,
+		&releasedAt, &h.ReleasedBy, &h.ReleaseNote)
+	h.ReleasedAt = timePtr(releasedAt)
+	return h, err
+}
+
+// legalHoldKeys lists the records whose hold would freeze the given record, as type:id keys
+func legalHoldKeys(targetType string, targetID int) ([]string, error) {
+	keys := []string{}
+	batchID := 0
+	switch targetType {
+	case LegalHoldCompany:
+		return []string{LegalHoldCompany + ":" + strconv.Itoa(targetID)}, nil
+	case LegalHoldBatch:
+		batchID = targetID
+	case LegalHoldDocument:
+		keys = append(keys, LegalHoldDocument+":"+strconv.Itoa(targetID))
+		var id sql.NullInt64
+		err := db.DB.QueryRow("SELECT batch_id FROM document WHERE id = $1", targetID).Scan(&id)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		batchID = int(id.Int64)
+	case legalHoldEvent:
+		var id sql.NullInt64
+		err := db.DB.QueryRow("SELECT batch_id FROM event WHERE id = $1", targetID).Scan(&id)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		batchID = int(id.Int64)
+	default:
+		return nil, fmt.Errorf("unknown legal hold target type %q", targetType)
+	}
+	if batchID == 0 {
+		return keys, nil
+	}
+
+	keys = append(keys, LegalHoldBatch+":"+strconv.Itoa(batchID))
+	var companyID sql.NullInt64
+	err := db.DB.QueryRow(`
+		SELECT h.company_id FROM batch b JOIN hatchery h ON h.id = b.hatchery_id WHERE b.id = $1
+	`, batchID).Scan(&companyID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if companyID.Valid {
+		keys = append(keys, LegalHoldCompany+":"+strconv.Itoa(int(companyID.Int64)))
+	}
+	return keys, nil
+}
+
+// activeLegalHolds loads the active holds that freeze a record, directly or through a record above it
+// Anything that modifies or purges records must check this first
+func activeLegalHolds(targetType string, targetID int) ([]LegalHold, error) {
+	keys, err := legalHoldKeys(targetType, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.DB.Query(`SELECT `+legalHoldColumns+`
+		FROM legal_hold
+		WHERE is_active = true AND released_at IS NULL AND target_type || ':' || target_id = ANY($1)
+		ORDER BY placed_at
+	`, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := []LegalHold{}
+	for rows.Next() {
+		hold, err := scanLegalHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+// legalHoldGuard protects the record named by a route parameter while it is under legal hold
+// Reads are let through and logged; anything else is logged and refused
+func legalHoldGuard(targetType, param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		targetID, err := strconv.Atoi(c.Params(param))
+		if err != nil {
+			// Leave reporting the malformed ID to the handler
+			return c.Next()
+		}
+		holds, err := activeLegalHolds(targetType, targetID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check legal holds")
+		}
+		if len(holds) == 0 {
+			return c.Next()
+		}
+
+		blocked := !middleware.IsReadOnlyMethod(c.Method())
+		accountID, _ := c.Locals("userID").(int)
+		for _, hold := range holds {
+			_, err := db.DB.Exec(`
+				INSERT INTO legal_hold_access_log (hold_id, target_type, target_id, account_id, method, path, ip_address, blocked, accessed_at)
+				VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, $7, $8, NOW())
+			`, hold.ID, targetType, targetID, accountID, c.Method(), c.Path(), c.IP(), blocked)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to log access to held record")
+			}
+		}
+
+		if blocked {
+			return fiber.NewError(fiber.StatusLocked, fmt.Sprintf("This %s is under legal hold and cannot be changed or deleted (hold %d)", targetType, holds[0].ID))
+		}
+		return c.Next()
+	}
+}
+
+// PlaceLegalHold places a legal hold on a record
+// @Summary Place legal hold
+// @Description Freeze a batch, document or company for an investigation. Held records cannot be edited or deleted and every access is logged until the hold is released
+// @Tags legal-holds
+// @Accept json
+// @Produce json
+// @Param request body LegalHoldRequest true "Legal hold"
+// @Success 201 {object} SuccessResponse{data=LegalHold}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /legal-holds [post]
+func PlaceLegalHold(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	var req LegalHoldRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.TargetID <= 0 || req.Reason == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Target ID and reason are required")
+	}
+
+	var table string
+	switch req.TargetType {
+	case LegalHoldBatch:
+		table = "batch"
+	case LegalHoldDocument:
+		table = "document"
+	case LegalHoldCompany:
+		table = "company"
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Target type must be batch, document or company")
+	}
+
+	// Soft deleted records can be held too, so they are not purged during the investigation
+	var exists bool
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM "+table+" WHERE id = $1)", req.TargetID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Held record not found")
+	}
+
+	err = db.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM legal_hold WHERE target_type = $1 AND target_id = $2 AND is_active = true AND released_at IS NULL)
+	`, req.TargetType, req.TargetID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "This record is already under legal hold")
+	}
+
+	placedBy, _ := c.Locals("userID").(int)
+	hold, err := scanLegalHold(db.DB.QueryRow(`
+		INSERT INTO legal_hold (target_type, target_id, case_reference, reason, placed_by, placed_at, is_active)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), NOW(), true)
+		RETURNING `+legalHoldColumns,
+		req.TargetType, req.TargetID, req.CaseReference, req.Reason, placedBy))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save legal hold")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Legal hold placed successfully",
+		Data:    hold,
+	})
+}
+
+// ListLegalHolds lists legal holds
+// @Summary List legal holds
+// @Description List legal holds, optionally only active or released ones or those on one type of record
+// @Tags legal-holds
+// @Produce json
+// @Param status query string false "Status (active, released)"
+// @Param target_type query string false "Target type (batch, document, company)"
+// @Success 200 {object} SuccessResponse{data=[]LegalHold}
+// @Failure 500 {object} ErrorResponse
+// @Router /legal-holds [get]
+func ListLegalHolds(c *fiber.Ctx) error {
+	rows, err := db.DB.Query(`SELECT `+legalHoldColumns+`
+		FROM legal_hold
+		WHERE is_active = true
+			AND ($1::text = '' OR ($1 = 'active') = (released_at IS NULL))
+			AND ($2::text = '' OR target_type = $2)
+		ORDER BY placed_at DESC
+	`, c.Query("status"), c.Query("target_type"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	holds := []LegalHold{}
+	for rows.Next() {
+		hold, err := scanLegalHold(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse legal hold")
+		}
+		holds = append(holds, hold)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Legal holds retrieved successfully",
+		Data:    holds,
+	})
+}
+
+// GetLegalHold retrieves a legal hold
+// @Summary Get legal hold
+// @Description Retrieve a legal hold
+// @Tags legal-holds
+// @Produce json
+// @Param holdId path int true "Legal hold ID"
+// @Success 200 {object} SuccessResponse{data=LegalHold}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /legal-holds/{holdId} [get]
+func GetLegalHold(c *fiber.Ctx) error {
+	holdID, err := strconv.Atoi(c.Params("holdId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid legal hold ID format")
+	}
+
+	hold, err := scanLegalHold(db.DB.QueryRow(`SELECT `+legalHoldColumns+` FROM legal_hold WHERE id = $1 AND is_active = true`, holdID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Legal hold not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Legal hold retrieved successfully",
+		Data:    hold,
+	})
+}
+
+// ReleaseLegalHold releases a legal hold
+// @Summary Release legal hold
+// @Description Release a legal hold once the investigation is over. The hold and its access log are kept
+// @Tags legal-holds
+// @Accept json
+// @Produce json
+// @Param holdId path int true "Legal hold ID"
+// @Param request body ReleaseLegalHoldRequest false "Release note"
+// @Success 200 {object} SuccessResponse{data=LegalHold}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /legal-holds/{holdId}/release [post]
+func ReleaseLegalHold(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	holdID, err := strconv.Atoi(c.Params("holdId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid legal hold ID format")
+	}
+	var req ReleaseLegalHoldRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	releasedBy, _ := c.Locals("userID").(int)
+	hold, err := scanLegalHold(db.DB.QueryRow(`
+		UPDATE legal_hold
+		SET released_at = NOW(), released_by = NULLIF($1, 0), release_note = $2
+		WHERE id = $3 AND is_active = true AND released_at IS NULL
+		RETURNING `+legalHoldColumns,
+		releasedBy, req.Note, holdID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Legal hold not found or already released")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to release legal hold")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Legal hold released successfully",
+		Data:    hold,
+	})
+}
+
+// GetLegalHoldAccessLog lists the accesses to records covered by a legal hold
+// @Summary Get legal hold access log
+// @Description List every read of and refused change to records covered by a legal hold while it was active
+// @Tags legal-holds
+// @Produce json
+// @Param holdId path int true "Legal hold ID"
+// @Success 200 {object} SuccessResponse{data=[]LegalHoldAccess}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /legal-holds/{holdId}/access-log [get]
+func GetLegalHoldAccessLog(c *fiber.Ctx) error {
+	holdID, err := strconv.Atoi(c.Params("holdId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid legal hold ID format")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, hold_id, target_type, target_id, COALESCE(account_id, 0), method, path,
+			COALESCE(ip_address, ''), blocked, accessed_at
+		FROM legal_hold_access_log
+		WHERE hold_id = $1
+		ORDER BY accessed_at DESC, id DESC
+	`, holdID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	entries := []LegalHoldAccess{}
+	for rows.Next() {
+		var e LegalHoldAccess
+		if err := rows.Scan(&e.ID, &e.HoldID, &e.TargetType, &e.TargetID, &e.AccountID, &e.Method, &e.Path,
+			&e.IPAddress, &e.Blocked, &e.AccessedAt); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse access log")
+		}
+		entries = append(entries, e)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Legal hold access log retrieved successfully",
+		Data:    entries,
+	})
+}
@@ -0,0 +1,694 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/eventbus"
+	"github.com/LTPPPP/TracePost-larvaeChain/ipfs"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+)
+
+// Test types accepted from lab systems
+const (
+	LIMSTestPathogenScreening = "pathogen_screening"
+	LIMSTestWaterQuality      = "water_quality"
+	LIMSTestFeedAnalysis      = "feed_analysis"
+	LIMSTestOther             = "other"
+)
+
+// Outcomes of a lab result and of its analytes
+const (
+	LIMSResultPass         = "pass"
+	LIMSResultFail         = "fail"
+	LIMSResultInconclusive = "inconclusive"
+	LIMSResultDetected     = "detected"
+	LIMSResultNotDetected  = "not_detected"
+)
+
+// EventTypeLabResultReceived is the batch event recorded when a lab pushes a result
+const EventTypeLabResultReceived = "lab_result_received"
+
+// LIMSToken is an API token a lab's LIMS uses to push results
+type LIMSToken struct {
+	ID          int        `json:"id"`
+	LabID       int        `json:"lab_id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"token_prefix"`    // First characters of the token, to tell tokens apart
+	Token       string     `json:"token,omitempty"` // Only returned when the token is created
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// LIMSTokenRequest represents a request to issue a LIMS token to a lab
+type LIMSTokenRequest struct {
+	Name      string     `json:"name"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// LIMSAnalyte is one measured parameter of a lab result
+type LIMSAnalyte struct {
+	Name             string   `json:"name"`   // e.g. WSSV, EHP, ammonia
+	Method           string   `json:"method"` // e.g. qPCR, PCR, spectrophotometry
+	Value            *float64 `json:"value,omitempty"`
+	Unit             string   `json:"unit,omitempty"`
+	LimitOfDetection *float64 `json:"limit_of_detection,omitempty"`
+	Result           string   `json:"result"` // detected, not_detected, pass, fail or inconclusive
+}
+
+// LIMSResultRequest is the schema of a result pushed by a lab system
+type LIMSResultRequest struct {
+	ExternalID      string        `json:"external_id"`      // The lab's own result ID; a result is accepted once per lab
+	BatchID         int           `json:"batch_id"`         // May be omitted when sample_reference is a registered sample code
+	SampleReference string        `json:"sample_reference"` // Code from the sample's QR label
+	TestType        string        `json:"test_type"`        // pathogen_screening, water_quality, feed_analysis or other
+	SampledAt       *time.Time    `json:"sampled_at"`
+	AnalyzedAt      time.Time     `json:"analyzed_at"`
+	OverallResult   string        `json:"overall_result"` // pass, fail or inconclusive
+	Analytes        []LIMSAnalyte `json:"analytes"`
+	Analyst         string        `json:"analyst"`
+	Notes           string        `json:"notes"`
+}
+
+// LIMSResult is a lab result received from a lab system
+type LIMSResult struct {
+	ID              int           `json:"id"`
+	LabID           int           `json:"lab_id"`
+	LabName         string        `json:"lab_name"`
+	BatchID         int           `json:"batch_id"`
+	ExternalID      string        `json:"external_id"`
+	SampleReference string        `json:"sample_reference"`
+	SampleID        *int          `json:"sample_id,omitempty"` // Registered sample the result was measured on
+	TestType        string        `json:"test_type"`
+	SampledAt       *time.Time    `json:"sampled_at,omitempty"`
+	AnalyzedAt      time.Time     `json:"analyzed_at"`
+	OverallResult   string        `json:"overall_result"`
+	Analytes        []LIMSAnalyte `json:"analytes"`
+	Analyst         string        `json:"analyst"`
+	Notes           string        `json:"notes"`
+	DocumentID      *int          `json:"document_id,omitempty"` // Generated result document
+	ReceivedAt      time.Time     `json:"received_at"`
+}
+
+const limsTokenColumns = `
+	id, lab_id, COALESCE(name, ''), token_prefix, expires_at, last_used_at, revoked_at, created_at
+`
+
+// scanLIMSToken reads a token selected with limsTokenColumns
+func scanLIMSToken(row rowScanner) (LIMSToken, error) {
+	var t LIMSToken
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.LabID, &t.Name, &t.TokenPrefix, &expiresAt, &lastUsedAt, &revokedAt, &t.CreatedAt)
+	t.ExpiresAt = timePtr(expiresAt)
+	t.LastUsedAt = timePtr(lastUsedAt)
+	t.RevokedAt = timePtr(revokedAt)
+	return t, err
+}
+
+const limsResultColumns = `
+	r.id, r.lab_id, COALESCE(l.name, ''), r.batch_id, r.external_id, COALESCE(r.sample_reference, ''), r.test_type,
+	r.sampled_at, r.analyzed_at, r.overall_result, r.analytes, COALESCE(r.analyst, ''), COALESCE(r.notes, ''),
+	r.document_id, r.received_at, r.sample_id
+`
+
+const limsResultFrom = `
+	FROM lims_result r
+	LEFT JOIN accredited_lab l ON l.id = r.lab_id
+`
+
+// scanLIMSResult reads a result selected with limsResultColumns
+func scanLIMSResult(row rowScanner) (LIMSResult, error) {
+	var r LIMSResult
+	var sampledAt sql.NullTime
+	var documentID, sampleID sql.NullInt64
+	var analytes []byte
+	err := row.Scan(&r.ID, &r.LabID, &r.LabName, &r.BatchID, &r.ExternalID, &r.SampleReference, &r.TestType,
+		&sampledAt, &r.AnalyzedAt, &r.OverallResult, &analytes, &r.Analyst, &r.Notes,
+		&documentID, &r.ReceivedAt, &sampleID)
+	if err != nil {
+		return r, err
+	}
+	r.SampledAt = timePtr(sampledAt)
+	r.DocumentID = intPtr(documentID)
+	r.SampleID = intPtr(sampleID)
+	return r, json.Unmarshal(analytes, &r.Analytes)
+}
+
+// hashLIMSToken hashes a token for storage; only the hash is kept
+func hashLIMSToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// limsTokenAuth authenticates a lab system by its bearer token
+func limsTokenAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+		if token == "" || token == c.Get("Authorization") {
+			return fiber.NewError(fiber.StatusUnauthorized, "A LIMS token is required as 'Bearer your-token'")
+		}
+
+		var tokenID, labID int
+		err := db.DB.QueryRow(`
+			SELECT t.id, t.lab_id
+			FROM lims_token t
+			JOIN accredited_lab l ON l.id = t.lab_id
+			WHERE t.token_hash = $1 AND t.is_active = true AND t.revoked_at IS NULL
+				AND (t.expires_at IS NULL OR t.expires_at > NOW())
+				AND l.is_active = true
+		`, hashLIMSToken(token)).Scan(&tokenID, &labID)
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusUnauthorized, "Invalid, expired or revoked LIMS token")
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+
+		if _, err := db.DB.Exec("UPDATE lims_token SET last_used_at = NOW() WHERE id = $1", tokenID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		c.Locals("limsTokenID", tokenID)
+		c.Locals("limsLabID", labID)
+		c.Locals("apiKey", fmt.Sprintf("lims_token:%d", tokenID))
+		return c.Next()
+	}
+}
+
+// validateLIMSResult checks a pushed result against the LIMS result schema and lists every violation
+func validateLIMSResult(req *LIMSResultRequest) []string {
+	var problems []string
+	req.ExternalID = strings.TrimSpace(req.ExternalID)
+	if req.ExternalID == "" {
+		problems = append(problems, "external_id is required")
+	}
+	if req.BatchID <= 0 {
+		problems = append(problems, "batch_id is required unless sample_reference is a registered sample code")
+	}
+	switch req.TestType {
+	case LIMSTestPathogenScreening, LIMSTestWaterQuality, LIMSTestFeedAnalysis, LIMSTestOther:
+	default:
+		problems = append(problems, "test_type must be pathogen_screening, water_quality, feed_analysis or other")
+	}
+	switch req.OverallResult {
+	case LIMSResultPass, LIMSResultFail, LIMSResultInconclusive:
+	default:
+		problems = append(problems, "overall_result must be pass, fail or inconclusive")
+	}
+	if req.AnalyzedAt.IsZero() {
+		problems = append(problems, "analyzed_at is required")
+	} else if req.AnalyzedAt.After(time.Now().Add(5 * time.Minute)) {
+		problems = append(problems, "analyzed_at must not be in the future")
+	}
+	if req.SampledAt != nil && !req.AnalyzedAt.IsZero() && req.SampledAt.After(req.AnalyzedAt) {
+		problems = append(problems, "sampled_at must not be after analyzed_at")
+	}
+
+	if len(req.Analytes) == 0 {
+		problems = append(problems, "at least one analyte is required")
+	}
+	for i, a := range req.Analytes {
+		field := fmt.Sprintf("analytes[%d]", i)
+		if strings.TrimSpace(a.Name) == "" {
+			problems = append(problems, field+".name is required")
+		}
+		switch a.Result {
+		case LIMSResultDetected, LIMSResultNotDetected, LIMSResultPass, LIMSResultFail, LIMSResultInconclusive:
+		default:
+			problems = append(problems, field+".result must be detected, not_detected, pass, fail or inconclusive")
+		}
+		if a.Value != nil && a.Unit == "" {
+			problems = append(problems, field+".unit is required with a value")
+		}
+		if a.LimitOfDetection != nil && *a.LimitOfDetection < 0 {
+			problems = append(problems, field+".limit_of_detection must not be negative")
+		}
+	}
+	return problems
+}
+
+// renderLIMSResultPDF renders the document generated for a lab result
+func renderLIMSResultPDF(result LIMSResult) []byte {
+	summary := utils.PDFSection{Lines: []string{
+		"Laboratory: " + result.LabName,
+		"Lab result ID: " + result.ExternalID,
+		fmt.Sprintf("Batch: #%d", result.BatchID),
+		"Sample reference: " + result.SampleReference,
+		"Test type: " + result.TestType,
+		"Analyzed: " + result.AnalyzedAt.Format("2006-01-02 15:04 MST"),
+		"Analyst: " + result.Analyst,
+		"Overall result: " + strings.ToUpper(result.OverallResult),
+	}}
+	if result.SampledAt != nil {
+		summary.Lines = append(summary.Lines, "Sampled: "+result.SampledAt.Format("2006-01-02 15:04 MST"))
+	}
+
+	analytes := utils.PDFSection{Heading: "Analytes"}
+	for _, a := range result.Analytes {
+		line := a.Name
+		if a.Method != "" {
+			line += " (" + a.Method + ")"
+		}
+		line += ": " + a.Result
+		if a.Value != nil {
+			line += fmt.Sprintf(", %s %s", strconv.FormatFloat(*a.Value, 'f', -1, 64), a.Unit)
+		}
+		if a.LimitOfDetection != nil {
+			line += fmt.Sprintf(", LOD %s", strconv.FormatFloat(*a.LimitOfDetection, 'f', -1, 64))
+		}
+		analytes.Lines = append(analytes.Lines, line)
+	}
+
+	sections := []utils.PDFSection{summary, analytes}
+	if result.Notes != "" {
+		sections = append(sections, utils.PDFSection{Heading: "Notes", Lines: strings.Split(result.Notes, "\n")})
+	}
+	sections = append(sections, utils.PDFSection{Lines: []string{
+		"Received from the laboratory information system on " + result.ReceivedAt.Format("2006-01-02 15:04 MST"),
+	}})
+	return utils.RenderTextPDF("Laboratory Result "+result.ExternalID, sections)
+}
+
+// attachLIMSResultDocument generates the result document, stores it on IPFS and attaches it to the batch
+func attachLIMSResultDocument(result *LIMSResult) error {
+	pdf := renderLIMSResultPDF(*result)
+	filename := fmt.Sprintf("lab-result-%d.pdf", result.ID)
+	upload, err := ipfs.NewIPFSPinataService().UploadBytes(pdf, filename, map[string]string{
+		"batch_id":      strconv.Itoa(result.BatchID),
+		"lab_id":        strconv.Itoa(result.LabID),
+		"document_type": "lab_result",
+		"app":           "TracePost-larvaeChain",
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}, true)
+	if err != nil {
+		return err
+	}
+	uri := upload.IPFSUri
+	if upload.PinataSuccess && upload.PinataUri != "" {
+		uri = upload.PinataUri
+	}
+
+	var documentID int
+	err = db.DB.QueryRow(`
+		INSERT INTO document (batch_id, doc_type, ipfs_hash, ipfs_uri, file_name, file_size, uploaded_at, updated_at, is_active)
+		VALUES ($1, 'lab_result', $2, $3, $4, $5, NOW(), NOW(), true)
+		RETURNING id
+	`, result.BatchID, upload.CID, uri, filename, upload.Size).Scan(&documentID)
+	if err != nil {
+		return err
+	}
+	if _, err := db.DB.Exec("UPDATE lims_result SET document_id = $1 WHERE id = $2", documentID, result.ID); err != nil {
+		return err
+	}
+	result.DocumentID = &documentID
+	publishDomainEvent(eventbus.DocumentUploaded, 0, result.BatchID, map[string]interface{}{
+		"document_id": documentID,
+		"doc_type":    "lab_result",
+		"file_name":   filename,
+		"ipfs_hash":   upload.CID,
+		"ipfs_uri":    uri,
+	})
+	return nil
+}
+
+// SubmitLIMSResult receives a structured result pushed by a lab system
+// @Summary Push LIMS result
+// @Description Push a structured lab result against a batch, authenticated with a LIMS token. The result is validated against the LIMS result schema,
+// @Description a result document is generated and attached to the batch, a lab_result_received event is recorded and the batch owner is notified through the lab_result webhook
+// @Tags lims
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body LIMSResultRequest true "Lab result"
+// @Success 201 {object} SuccessResponse{data=LIMSResult}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /lims/results [post]
+func SubmitLIMSResult(c *fiber.Ctx) error {
+	labID, _ := c.Locals("limsLabID").(int)
+	tokenID, _ := c.Locals("limsTokenID").(int)
+
+	var req LIMSResultRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	// A sample reference naming a registered sample links the result back to the physical sample
+	var sample *Sample
+	if ref := strings.TrimSpace(req.SampleReference); ref != "" {
+		registered, err := loadSampleByCode(ref)
+		if err != nil && err != sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if err == nil {
+			sample = &registered
+			if req.BatchID == 0 {
+				req.BatchID = sample.BatchID
+			}
+			if req.SampledAt == nil {
+				req.SampledAt = &sample.CollectedAt
+			}
+		}
+	}
+	if problems := validateLIMSResult(&req); len(problems) > 0 {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "Result does not match the LIMS result schema: "+strings.Join(problems, "; "))
+	}
+	var sampleID *int
+	if sample != nil {
+		if sample.BatchID != req.BatchID {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("Sample %s was drawn from batch #%d, not batch #%d", sample.SampleCode, sample.BatchID, req.BatchID))
+		}
+		if sample.LabID != nil && *sample.LabID != labID {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("Sample %s was sent to a different lab", sample.SampleCode))
+		}
+		sampleID = &sample.ID
+	}
+
+	var companyID sql.NullInt64
+	err := db.DB.QueryRow(`
+		SELECT h.company_id FROM batch b LEFT JOIN hatchery h ON h.id = b.hatchery_id WHERE b.id = $1 AND b.is_active = true
+	`, req.BatchID).Scan(&companyID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM lims_result WHERE lab_id = $1 AND external_id = $2)", labID, req.ExternalID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A result with this external ID was already received from the lab")
+	}
+
+	analytes, err := json.Marshal(req.Analytes)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to encode analytes")
+	}
+	var resultID int
+	err = db.DB.QueryRow(`
+		INSERT INTO lims_result (lab_id, token_id, batch_id, external_id, sample_reference, test_type, sampled_at,
+			analyzed_at, overall_result, analytes, analyst, notes, sample_id, received_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NOW())
+		RETURNING id
+	`, labID, tokenID, req.BatchID, req.ExternalID, req.SampleReference, req.TestType, req.SampledAt,
+		req.AnalyzedAt, req.OverallResult, string(analytes), req.Analyst, req.Notes, sampleID).Scan(&resultID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save lab result")
+	}
+	if sample != nil {
+		_, err = db.DB.Exec(`
+			UPDATE sample SET status = $1, lab_id = COALESCE(lab_id, $2), updated_at = NOW() WHERE id = $3
+		`, SampleStatusTested, labID, sample.ID)
+		if err != nil {
+			fmt.Printf("Warning: Failed to mark sample %s as tested: %v\n", sample.SampleCode, err)
+		}
+	}
+	result, err := scanLIMSResult(db.DB.QueryRow(`SELECT `+limsResultColumns+limsResultFrom+` WHERE r.id = $1`, resultID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Lab result saved but failed to retrieve details")
+	}
+
+	// The result is stored either way; a missing document can be generated again later
+	if err := attachLIMSResultDocument(&result); err != nil {
+		fmt.Printf("Warning: Failed to generate lab result document: %v\n", err)
+	}
+
+	eventData := map[string]interface{}{
+		"lims_result_id":   result.ID,
+		"lab_id":           result.LabID,
+		"lab_name":         result.LabName,
+		"external_id":      result.ExternalID,
+		"sample_reference": result.SampleReference,
+		"sample_id":        result.SampleID,
+		"test_type":        result.TestType,
+		"overall_result":   result.OverallResult,
+	}
+	if result.DocumentID != nil {
+		eventData["document_id"] = *result.DocumentID
+	}
+	metadata, _ := json.Marshal(eventData)
+	_, err = db.DB.Exec(`
+		INSERT INTO event (batch_id, event_type, location, timestamp, metadata, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, NOW(), true)
+	`, result.BatchID, EventTypeLabResultReceived, result.LabName, result.AnalyzedAt, metadata)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create event record")
+	}
+
+	if companyID.Valid {
+		eventData["batch_id"] = result.BatchID
+		eventData["analytes"] = result.Analytes
+		if err := webhooks.Dispatch(int(companyID.Int64), "lab_result", eventData); err != nil {
+			fmt.Printf("Warning: failed to dispatch lab_result webhook: %v\n", err)
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Lab result received successfully",
+		Data:    result,
+	})
+}
+
+// GetLIMSResult retrieves a result the calling lab pushed
+// @Summary Get pushed LIMS result
+// @Description Retrieve a result the authenticated lab pushed earlier, including the generated document
+// @Tags lims
+// @Produce json
+// @Security Bearer
+// @Param resultId path int true "Lab result ID"
+// @Success 200 {object} SuccessResponse{data=LIMSResult}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /lims/results/{resultId} [get]
+func GetLIMSResult(c *fiber.Ctx) error {
+	labID, _ := c.Locals("limsLabID").(int)
+	resultID, err := strconv.Atoi(c.Params("resultId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid lab result ID format")
+	}
+
+	result, err := scanLIMSResult(db.DB.QueryRow(`SELECT `+limsResultColumns+limsResultFrom+` WHERE r.id = $1 AND r.lab_id = $2`, resultID, labID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Lab result not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Lab result retrieved successfully",
+		Data:    result,
+	})
+}
+
+// GetBatchLabResults lists the lab results received for a batch
+// @Summary Get batch lab results
+// @Description List the results pushed by lab systems for a batch, newest first
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]LIMSResult}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/lab-results [get]
+func GetBatchLabResults(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+limsResultColumns+limsResultFrom+` WHERE r.batch_id = $1 ORDER BY r.analyzed_at DESC, r.id DESC`, batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	results := []LIMSResult{}
+	for rows.Next() {
+		result, err := scanLIMSResult(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse lab result")
+		}
+		results = append(results, result)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Lab results retrieved successfully",
+		Data:    results,
+	})
+}
+
+// CreateLIMSToken issues a LIMS token to an accredited lab
+// @Summary Issue LIMS token
+// @Description Issue an API token a lab's LIMS uses to push results. The token is only shown in this response
+// @Tags trust-registry
+// @Accept json
+// @Produce json
+// @Param labId path int true "Lab ID"
+// @Param request body LIMSTokenRequest false "Token"
+// @Success 201 {object} SuccessResponse{data=LIMSToken}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /trust-registry/labs/{labId}/lims-tokens [post]
+func CreateLIMSToken(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	labID, err := strconv.Atoi(c.Params("labId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid lab ID format")
+	}
+	var req LIMSTokenRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return fiber.NewError(fiber.StatusBadRequest, "Expiry must be in the future")
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM accredited_lab WHERE id = $1 AND is_active = true)", labID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Lab not found")
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate token")
+	}
+	secret := "lims_" + hex.EncodeToString(raw)
+
+	token, err := scanLIMSToken(db.DB.QueryRow(`
+		INSERT INTO lims_token (lab_id, name, token_prefix, token_hash, expires_at, created_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, NOW(), true)
+		RETURNING `+limsTokenColumns,
+		labID, req.Name, secret[:12], hashLIMSToken(secret), req.ExpiresAt))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save token")
+	}
+	token.Token = secret
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "LIMS token issued successfully",
+		Data:    token,
+	})
+}
+
+// ListLIMSTokens lists the LIMS tokens of a lab
+// @Summary List LIMS tokens
+// @Description List the LIMS tokens issued to a lab, without the secrets
+// @Tags trust-registry
+// @Produce json
+// @Param labId path int true "Lab ID"
+// @Success 200 {object} SuccessResponse{data=[]LIMSToken}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /trust-registry/labs/{labId}/lims-tokens [get]
+func ListLIMSTokens(c *fiber.Ctx) error {
+	labID, err := strconv.Atoi(c.Params("labId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid lab ID format")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+limsTokenColumns+` FROM lims_token WHERE lab_id = $1 AND is_active = true ORDER BY created_at DESC`, labID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	tokens := []LIMSToken{}
+	for rows.Next() {
+		token, err := scanLIMSToken(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse token")
+		}
+		tokens = append(tokens, token)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "LIMS tokens retrieved successfully",
+		Data:    tokens,
+	})
+}
+
+// RevokeLIMSToken revokes a LIMS token
+// @Summary Revoke LIMS token
+// @Description Revoke a LIMS token so the lab system can no longer push results with it
+// @Tags trust-registry
+// @Produce json
+// @Param labId path int true "Lab ID"
+// @Param tokenId path int true "Token ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /trust-registry/labs/{labId}/lims-tokens/{tokenId} [delete]
+func RevokeLIMSToken(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	labID, err := strconv.Atoi(c.Params("labId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid lab ID format")
+	}
+	tokenID, err := strconv.Atoi(c.Params("tokenId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid token ID format")
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE lims_token SET revoked_at = NOW()
+		WHERE id = $1 AND lab_id = $2 AND is_active = true AND revoked_at IS NULL
+	`, tokenID, labID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Token not found or already revoked")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "LIMS token revoked successfully",
+	})
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/loadshed"
+)
+
+// LoadSheddingModeRequest represents a request to override the load shedding controller
+type LoadSheddingModeRequest struct {
+	Mode string `json:"mode"` // auto, on or off
+}
+
+// GetLoadShedding gets the state of load shedding on public trace endpoints
+// @Summary Get load shedding status
+// @Description Get whether public trace endpoints are degraded, with the latency and queue depth signals that drive it
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=loadshed.Status}
+// @Failure 403 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/load-shedding [get]
+func GetLoadShedding(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Load shedding status retrieved successfully",
+		Data:    loadshed.Default().Status(),
+	})
+}
+
+// UpdateLoadShedding overrides the load shedding controller
+// @Summary Set load shedding mode
+// @Description Force public trace endpoints into degraded mode ahead of a campaign ("on"), keep them at full detail ("off"), or let latency and queue depth decide ("auto")
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body LoadSheddingModeRequest true "Mode"
+// @Success 200 {object} SuccessResponse{data=loadshed.Status}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/load-shedding [put]
+func UpdateLoadShedding(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	var req LoadSheddingModeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	ctrl := loadshed.Default()
+	if err := ctrl.SetMode(req.Mode); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Mode must be auto, on or off")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Load shedding mode updated successfully",
+		Data:    ctrl.Status(),
+	})
+}
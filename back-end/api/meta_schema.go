@@ -0,0 +1,353 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/eventbus"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// apiSchemaVersion is the version of the API the schema describes
+const apiSchemaVersion = "v1"
+
+// APISchema is the machine-readable description of the API for SDK generators and form builders
+type APISchema struct {
+	APIVersion string            `json:"api_version"`
+	Revision   string            `json:"revision"` // Changes whenever anything in the schema changes; also sent as the ETag
+	Resources  []ResourceSchema  `json:"resources"`
+	Requests   []RequestSchema   `json:"requests"`
+	Enums      []EnumSchema      `json:"enums"`
+	EventTypes []EventTypeSchema `json:"event_types"` // Metadata schemas registered for event types
+}
+
+// ResourceSchema describes the fields of a resource returned by the API
+type ResourceSchema struct {
+	Name   string        `json:"name"`
+	Path   string        `json:"path"`
+	Fields []FieldSchema `json:"fields"`
+}
+
+// RequestSchema describes the body of a write request and its validation rules
+type RequestSchema struct {
+	Name   string        `json:"name"`
+	Method string        `json:"method"`
+	Path   string        `json:"path"`
+	Fields []FieldSchema `json:"fields"`
+}
+
+// FieldSchema describes a field and the rules the API validates it against
+type FieldSchema struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`             // string, integer, number, boolean, object or array
+	Format    string   `json:"format,omitempty"` // date-time for timestamps
+	Items     string   `json:"items,omitempty"`  // Type of the elements of an array
+	Ref       string   `json:"ref,omitempty"`    // Resource an object field or its array elements are
+	Nullable  bool     `json:"nullable,omitempty"`
+	Required  bool     `json:"required,omitempty"`
+	Enum      string   `json:"enum,omitempty"` // Name of the enum the value belongs to
+	Pattern   string   `json:"pattern,omitempty"`
+	MinLength int      `json:"min_length,omitempty"`
+	MaxLength int      `json:"max_length,omitempty"`
+	Minimum   *float64 `json:"minimum,omitempty"`
+}
+
+// EnumSchema lists the values of an enumerated field
+type EnumSchema struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Values      []string `json:"values"`
+	Open        bool     `json:"open,omitempty"` // Other values are accepted; the list holds the ones the platform itself uses
+}
+
+// fieldRule holds the validation rules of a request field
+type fieldRule struct {
+	Required  bool
+	Enum      string
+	Pattern   string
+	MinLength int
+	MaxLength int
+	Minimum   *float64
+}
+
+// schemaResource is a resource described in the schema
+type schemaResource struct {
+	name  string
+	path  string
+	model interface{}
+}
+
+// schemaRequest is a request body described in the schema, with the rules its handler enforces
+type schemaRequest struct {
+	name   string
+	method string
+	path   string
+	model  interface{}
+	rules  map[string]fieldRule
+}
+
+var zero = 0.0
+
+// schemaResources are the resources described in the schema
+var schemaResources = []schemaResource{
+	{"batch", "/batches", models.Batch{}},
+	{"event", "/events", models.Event{}},
+	{"document", "/documents", models.Document{}},
+	{"shipment_transfer", "/shipments/transfers", models.ShipmentTransfer{}},
+	{"transfer_commercial_terms", "/shipments/transfers/{id}/commercial", models.TransferCommercialTerms{}},
+	{"origin_claim", "/origin-claims", OriginClaim{}},
+	{"ownership_transfer", "/ownership-transfers", BatchOwnershipTransfer{}},
+	{"document_translation", "/translations", DocumentTranslation{}},
+	{"consumer_feedback", "/companies/{companyId}/feedback", ConsumerFeedback{}},
+}
+
+// schemaRequests are the write requests described in the schema
+var schemaRequests = []schemaRequest{
+	{"create_batch", fiber.MethodPost, "/batches", CreateBatchRequest{}, map[string]fieldRule{
+		"hatchery_id": {Required: true},
+		"species":     {Required: true, MinLength: 1},
+		"quantity":    {Required: true, Minimum: &zero},
+	}},
+	{"update_batch_status", fiber.MethodPut, "/batches/{batchId}/status", UpdateBatchStatusRequest{}, map[string]fieldRule{
+		"status": {Required: true, MinLength: 1},
+	}},
+	{"create_event", fiber.MethodPost, "/events", CreateEventRequest{}, map[string]fieldRule{
+		"batch_id":   {Required: true},
+		"event_type": {Required: true, Enum: "event_type", Pattern: eventTypePattern.String()},
+	}},
+	{"create_shipment_transfer", fiber.MethodPost, "/shipments/transfers", CreateShipmentTransferRequest{}, map[string]fieldRule{
+		"batch_id":    {Required: true},
+		"sender_id":   {Required: true},
+		"receiver_id": {Required: true},
+	}},
+	{"set_transfer_commercial_terms", fiber.MethodPut, "/shipments/transfers/{id}/commercial", TransferCommercialTermsRequest{}, map[string]fieldRule{
+		"unit_price": {Minimum: &zero},
+		"currency":   {Pattern: "^[A-Z]{3}$"},
+		"incoterms":  {Enum: "incoterms"},
+		"quantity":   {Minimum: &zero},
+	}},
+	{"create_origin_claim", fiber.MethodPost, "/origin-claims", OriginClaimRequest{}, map[string]fieldRule{
+		"company_id":        {Required: true},
+		"batch_id":          {Required: true},
+		"identifier_scheme": {Required: true, Enum: "lot_identifier_scheme"},
+		"lot_identifier":    {Required: true, MinLength: 1},
+	}},
+	{"initiate_ownership_transfer", fiber.MethodPost, "/batches/{batchId}/ownership-transfers", InitiateOwnershipTransferRequest{}, map[string]fieldRule{
+		"seller_company_id": {Required: true},
+		"buyer_company_id":  {Required: true},
+		"price":             {Minimum: &zero},
+		"currency":          {Pattern: "^[A-Z]{3}$"},
+	}},
+	{"request_document_translation", fiber.MethodPost, "/documents/{documentId}/translations", DocumentTranslationRequest{}, map[string]fieldRule{
+		"target_languages": {Required: true, MinLength: 1, Pattern: languageTagPattern.String()},
+		"source_language":  {Pattern: languageTagPattern.String()},
+	}},
+	{"submit_consumer_feedback", fiber.MethodPost, "/batches/{batchId}/feedback", ConsumerFeedbackRequest{}, map[string]fieldRule{
+		"rating":   {Minimum: &zero},
+		"comment":  {MaxLength: maxFeedbackLength},
+		"language": {Pattern: languageTagPattern.String()},
+	}},
+}
+
+// schemaEnums are the enumerations described in the schema
+var schemaEnums = []EnumSchema{
+	{Name: "error_code", Description: "Code of an error response",
+		Values: []string{CodeValidation, CodeUnauthorized, CodeForbidden, CodeNotFound, CodeConflict, CodeRateLimited, CodeDependencyUnavailable, CodeBlockchainFailure, CodeInternal}},
+	{Name: "event_type", Description: "Types of batch events recorded by the platform; companies may record their own",
+		Values: []string{EventTypeInspectionCompleted, EventTypeLabResultReceived, EventTypeOriginDisputed, EventTypeOriginDisputeResolved,
+			EventTypeOwnershipTransferInitiated, EventTypeOwnershipTransferred, EventTypeProcessingRun, EventTypeBatchRecalled,
+			EventTypeBatchRecallLifted, EventTypeSampleCollected, EventTypeSampleCustodyTransfer}, Open: true},
+	{Name: "domain_event", Description: "Domain events published on the event bus",
+		Values: []string{eventbus.BatchCreated, eventbus.StatusChanged, eventbus.DocumentUploaded, eventbus.TransferCompleted, eventbus.OwnershipTransferred}},
+	{Name: "doc_type", Description: "Document types used by the platform; uploads may use others",
+		Values: []string{"health_certificate", "lab_result", DocTypeCalibrationCertificate}, Open: true},
+	{Name: "shipment_transfer_status", Description: "Statuses of a shipment transfer", Values: []string{"pending", "completed", "canceled"}},
+	{Name: "shipment_status", Description: "Statuses of a shipment", Values: []string{"draft", "in_transit", "received", "cancelled"}},
+	{Name: "incoterms", Description: "Incoterms 2020 rules accepted on transfers", Values: []string{"EXW", "FCA", "CPT", "CIP", "DAP", "DPU", "DDP", "FAS", "FOB", "CFR", "CIF"}},
+	{Name: "lot_identifier_scheme", Description: "Schemes of external lot identifiers", Values: []string{LotSchemeGS1, LotSchemeSupplier, LotSchemeCertificate, LotSchemeOther}},
+	{Name: "origin_claim_status", Description: "Statuses of an origin claim",
+		Values: []string{OriginClaimActive, OriginClaimDisputed, OriginClaimUpheld, OriginClaimRejected, OriginClaimWithdrawn}},
+	{Name: "ownership_transfer_status", Description: "Statuses of a batch ownership transfer",
+		Values: []string{OwnershipTransferPending, OwnershipTransferAccepted, OwnershipTransferRejected, OwnershipTransferCancelled}},
+	{Name: "translation_status", Description: "Statuses of a document translation request",
+		Values: []string{TranslationRequested, TranslationAssigned, TranslationSubmitted, TranslationCompleted, TranslationCancelled, TranslationFailed}},
+	{Name: "feedback_status", Description: "Moderation statuses of consumer feedback",
+		Values: []string{FeedbackPublished, FeedbackPendingReview, FeedbackRejected}},
+	{Name: "quarantine_status", Description: "Quarantine statuses of broodstock",
+		Values: []string{QuarantinePending, QuarantineActive, QuarantineReleased, QuarantineRejected}},
+	{Name: "sample_type", Description: "Kinds of physical samples", Values: []string{SampleTypeLarvae, SampleTypeTissue, SampleTypeWater, SampleTypeFeed, SampleTypeOther}},
+	{Name: "sample_status", Description: "Statuses of a sample", Values: []string{SampleStatusCollected, SampleStatusInTransit, SampleStatusReceived, SampleStatusTested}},
+	{Name: "lab_test_type", Description: "Test types accepted from lab systems", Values: []string{LIMSTestPathogenScreening, LIMSTestWaterQuality, LIMSTestFeedAnalysis, LIMSTestOther}},
+	{Name: "lab_outcome", Description: "Outcomes of a lab result and of its analytes",
+		Values: []string{LIMSResultPass, LIMSResultFail, LIMSResultInconclusive, LIMSResultDetected, LIMSResultNotDetected}},
+	{Name: "recall_severity", Description: "Severities of a batch recall", Values: []string{RecallSeverityHigh, RecallSeverityMedium, RecallSeverityLow}},
+	{Name: "product_status", Description: "Statuses of a product", Values: []string{ProductStatusActive, ProductStatusExpired, ProductStatusRecalled}},
+	{Name: "process_type", Description: "Processing steps", Values: []string{ProcessTypePeeling, ProcessTypeCooking, ProcessTypeFreezing, ProcessTypeDrying, ProcessTypeFeedMilling, ProcessTypeOther}},
+	{Name: "inspection_field_type", Description: "Field types of an inspection checklist",
+		Values: []string{InspectionFieldText, InspectionFieldNumber, InspectionFieldBoolean, InspectionFieldChoice, InspectionFieldDate, InspectionFieldPhoto}},
+	{Name: "strain_line_type", Description: "Line types of genetic strains", Values: []string{LineTypeSPF, LineTypeSPR, LineTypeSPFSPR, LineTypeConventional}},
+	{Name: "notification_channel", Description: "Channels a user can receive notifications on",
+		Values: []string{NotificationChannelEmail, NotificationChannelSMS, NotificationChannelPush, NotificationChannelInApp}},
+	{Name: "content_block_type", Description: "Content block types of the consumer trace page",
+		Values: []string{BlockTypeFarmStory, BlockTypeSustainabilityBadge, BlockTypeRecipe, BlockTypeCustom}},
+}
+
+var (
+	staticSchema     APISchema
+	staticSchemaOnce sync.Once
+)
+
+// describeFields lists the JSON fields of a struct, following embedded structs
+func describeFields(t reflect.Type, resources map[reflect.Type]string) []FieldSchema {
+	fields := []FieldSchema{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" {
+			fields = append(fields, describeFields(f.Type, resources)...)
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		field := FieldSchema{Name: name}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			field.Nullable = true
+			ft = ft.Elem()
+		}
+		field.Type, field.Format = schemaType(ft)
+		switch {
+		case field.Type == "array":
+			elem := ft.Elem()
+			if elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+			field.Items, _ = schemaType(elem)
+			field.Ref = resources[elem]
+		case field.Type == "object":
+			field.Ref = resources[ft]
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// schemaType maps a Go type to its JSON type and format
+func schemaType(t reflect.Type) (string, string) {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return "string", "date-time"
+	case t == reflect.TypeOf(json.RawMessage{}), t == reflect.TypeOf(models.JSONB{}):
+		return "object", ""
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string", ""
+	case reflect.Bool:
+		return "boolean", ""
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer", ""
+	case reflect.Float32, reflect.Float64:
+		return "number", ""
+	case reflect.Slice, reflect.Array:
+		return "array", ""
+	}
+	return "object", ""
+}
+
+// buildStaticSchema describes the resources, requests and enums, which only change with the code
+func buildStaticSchema() APISchema {
+	resources := map[reflect.Type]string{}
+	for _, r := range schemaResources {
+		resources[reflect.TypeOf(r.model)] = r.name
+	}
+
+	schema := APISchema{APIVersion: apiSchemaVersion, Enums: schemaEnums}
+	for _, r := range schemaResources {
+		schema.Resources = append(schema.Resources, ResourceSchema{
+			Name:   r.name,
+			Path:   r.path,
+			Fields: describeFields(reflect.TypeOf(r.model), resources),
+		})
+	}
+	for _, r := range schemaRequests {
+		fields := describeFields(reflect.TypeOf(r.model), resources)
+		for i, f := range fields {
+			rule := r.rules[f.Name]
+			fields[i].Required = rule.Required
+			fields[i].Enum = rule.Enum
+			fields[i].Pattern = rule.Pattern
+			fields[i].MinLength = rule.MinLength
+			fields[i].MaxLength = rule.MaxLength
+			fields[i].Minimum = rule.Minimum
+		}
+		schema.Requests = append(schema.Requests, RequestSchema{Name: r.name, Method: r.method, Path: r.path, Fields: fields})
+	}
+	return schema
+}
+
+// GetAPISchema returns the machine-readable description of the API
+// @Summary Get API schema
+// @Description Describe the resources, the write requests with their validation rules, the enums (statuses, event types, document types, error codes) and the registered event metadata schemas,
+// @Description so client SDK generators and form builders can stay in sync. The revision changes whenever the schema does and is sent as the ETag; If-None-Match gets 304 while it is unchanged.
+// @Tags meta
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=APISchema}
+// @Success 304 "Schema unchanged"
+// @Failure 500 {object} ErrorResponse
+// @Router /meta/schema [get]
+func GetAPISchema(c *fiber.Ctx) error {
+	staticSchemaOnce.Do(func() {
+		staticSchema = buildStaticSchema()
+	})
+	schema := staticSchema
+
+	rows, err := db.DB.Query(`SELECT ` + eventTypeSchemaColumns + ` FROM event_type_schema WHERE is_active = true ORDER BY event_type`)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve event types")
+	}
+	defer rows.Close()
+	schema.EventTypes = []EventTypeSchema{}
+	for rows.Next() {
+		s, err := scanEventTypeSchema(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse event type")
+		}
+		schema.EventTypes = append(schema.EventTypes, s)
+	}
+
+	encoded, err := json.Marshal(schema)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to encode schema")
+	}
+	sum := sha256.Sum256(encoded)
+	schema.Revision = hex.EncodeToString(sum[:8])
+
+	etag := `"` + schema.Revision + `"`
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "API schema retrieved successfully",
+		Data:    schema,
+	})
+}
@@ -147,7 +147,7 @@ func DeployNFTContract(c *fiber.Ctx) error {
 	)
 	
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to deploy NFT contract: "+err.Error())
+		return blockchainFailure("Failed to deploy NFT contract", err)
 	}
 	
 	// Record contract deployment in the database
@@ -341,7 +341,7 @@ func TokenizeBatch(c *fiber.Ctx) error {
 	)
 	
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate token URI: " + err.Error())
+		return blockchainFailure("Failed to generate token URI", err)
 	}
 	
 	tokenURI, ok := tokenURIResult["result"].(string)
@@ -365,7 +365,7 @@ func TokenizeBatch(c *fiber.Ctx) error {
 	)
 	
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to tokenize batch: "+err.Error())
+		return blockchainFailure("Failed to tokenize batch", err)
 	}
 	
 	// Get the token ID from the result
@@ -629,7 +629,7 @@ func GetNFTDetails(c *fiber.Ctx) error {
 	)
 	
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to query token owner: "+err.Error())
+		return blockchainFailure("Failed to query token owner", err)
 	}
 	
 	owner, ok := ownerResult["result"].(string)
@@ -794,7 +794,7 @@ func TransferNFT(c *fiber.Ctx) error {
 		)
 		
 		if err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to query token owner: "+err.Error())
+			return blockchainFailure("Failed to query token owner", err)
 		}
 		
 		owner, ok := ownerResult["result"].(string)
@@ -839,7 +839,7 @@ func TransferNFT(c *fiber.Ctx) error {
 	)
 	
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to transfer NFT: "+err.Error())
+		return blockchainFailure("Failed to transfer NFT", err)
 	}
 	
 	// Record the transfer in the database
@@ -1007,7 +1007,7 @@ func TokenizeTransaction(c *fiber.Ctx) error {
 	ipfsService := ipfs.NewIPFSService()
 	metadataJSON, err := ipfsService.StoreJSON(metadata)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to store metadata on IPFS: "+err.Error())
+		return dependencyUnavailable("Failed to store metadata on IPFS", err)
 	}
 	
 	// Generate a unique token ID using batch ID and transfer ID
@@ -1034,7 +1034,7 @@ func TokenizeTransaction(c *fiber.Ctx) error {
 	)
 	
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to mint transaction NFT: "+err.Error())
+		return blockchainFailure("Failed to mint transaction NFT", err)
 	}
 	
 	// Extract token ID from result
@@ -1530,7 +1530,7 @@ func InteractWithLogisticsNFTContract(c *fiber.Ctx) error {
 		req.Args,
 	)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to interact with contract: "+err.Error())
+		return blockchainFailure("Failed to interact with contract", err)
 	}
 
 	// Return the result
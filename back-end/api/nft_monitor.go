@@ -0,0 +1,117 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// NFTMonitorIntervalRequest changes the time between NFT monitor passes
+type NFTMonitorIntervalRequest struct {
+	CheckIntervalSeconds int `json:"check_interval_seconds"` // 5 to 86400
+}
+
+// GetNFTMonitorStatus gets the state of the NFT monitor
+// @Summary Get NFT monitor status
+// @Description Get whether the background NFT integrity monitor is running, its checkpoint, the chain head and how far behind it is
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=db.NFTMonitorStatus}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/nft-monitor [get]
+func GetNFTMonitorStatus(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	status, err := db.DefaultNFTMonitor().Status()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get NFT monitor status")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "NFT monitor status retrieved successfully",
+		Data:    status,
+	})
+}
+
+// PauseNFTMonitor pauses the NFT monitor
+// @Summary Pause NFT monitor
+// @Description Stop NFT integrity passes until the monitor is resumed; the pause is kept across restarts
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=db.NFTMonitorStatus}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/nft-monitor/pause [post]
+func PauseNFTMonitor(c *fiber.Ctx) error {
+	return nftMonitorAction(c, "pause", "NFT monitor paused successfully", db.DefaultNFTMonitor().Pause)
+}
+
+// ResumeNFTMonitor resumes the NFT monitor
+// @Summary Resume NFT monitor
+// @Description Resume NFT integrity passes from the saved checkpoint, starting a pass right away
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=db.NFTMonitorStatus}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/nft-monitor/resume [post]
+func ResumeNFTMonitor(c *fiber.Ctx) error {
+	return nftMonitorAction(c, "resume", "NFT monitor resumed successfully", db.DefaultNFTMonitor().Resume)
+}
+
+// UpdateNFTMonitorInterval changes the polling interval of the NFT monitor
+// @Summary Set NFT monitor interval
+// @Description Change the time between NFT integrity passes without a restart
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body NFTMonitorIntervalRequest true "Interval"
+// @Success 200 {object} SuccessResponse{data=db.NFTMonitorStatus}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/nft-monitor/interval [put]
+func UpdateNFTMonitorInterval(c *fiber.Ctx) error {
+	var req NFTMonitorIntervalRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.CheckIntervalSeconds < 5 || req.CheckIntervalSeconds > 86400 {
+		return fiber.NewError(fiber.StatusBadRequest, "check_interval_seconds must be between 5 and 86400")
+	}
+	return nftMonitorAction(c, "update", "NFT monitor interval updated successfully", func(userID int) error {
+		return db.DefaultNFTMonitor().SetCheckInterval(time.Duration(req.CheckIntervalSeconds)*time.Second, userID)
+	})
+}
+
+// nftMonitorAction applies an admin change to the NFT monitor and returns its status
+func nftMonitorAction(c *fiber.Ctx, action, message string, run func(userID int) error) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	if err := run(userID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to "+action+" the NFT monitor")
+	}
+	status, err := db.DefaultNFTMonitor().Status()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get NFT monitor status")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    status,
+	})
+}
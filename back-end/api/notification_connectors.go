@@ -0,0 +1,464 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/notify"
+)
+
+// NotificationConnectorRequest represents a request to post a company's operational alerts to Slack or Teams
+type NotificationConnectorRequest struct {
+	Provider         string   `json:"provider"` // slack or teams
+	Name             string   `json:"name"`
+	WebhookURL       string   `json:"webhook_url"`
+	Channel          string   `json:"channel"`     // Slack only, overrides the channel of the incoming webhook
+	AlertTypes       []string `json:"alert_types"` // empty subscribes to every alert
+	Template         string   `json:"template"`    // text/template over the alert data, empty uses the default template
+	RateLimitPerHour int      `json:"rate_limit_per_hour"`
+}
+
+// NotificationConnector posts a company's operational alerts to a Slack or Teams channel
+type NotificationConnector struct {
+	ID               int       `json:"id"`
+	CompanyID        int       `json:"company_id"`
+	Provider         string    `json:"provider"`
+	Name             string    `json:"name"`
+	WebhookURL       string    `json:"webhook_url"`
+	Channel          string    `json:"channel,omitempty"`
+	AlertTypes       []string  `json:"alert_types"`
+	Template         string    `json:"template,omitempty"`
+	RateLimitPerHour *int      `json:"rate_limit_per_hour,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// NotificationMessage is one alert rendered for a connector
+type NotificationMessage struct {
+	ID           int        `json:"id"`
+	ConnectorID  int        `json:"connector_id"`
+	AlertType    string     `json:"alert_type"`
+	Text         string     `json:"text"`
+	Status       string     `json:"status"`
+	ResponseCode *int       `json:"response_code,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	SentAt       *time.Time `json:"sent_at,omitempty"`
+}
+
+const notificationConnectorColumns = `
+	id, company_id, provider, name, webhook_url, COALESCE(channel, ''), alert_types,
+	COALESCE(template, ''), rate_limit_per_hour, created_at, updated_at`
+
+// scanNotificationConnector reads a connector selected with notificationConnectorColumns
+func scanNotificationConnector(row rowScanner) (NotificationConnector, error) {
+	var n NotificationConnector
+	var rateLimit sql.NullInt64
+	err := row.Scan(&n.ID, &n.CompanyID, &n.Provider, &n.Name, &n.WebhookURL, &n.Channel, pq.Array(&n.AlertTypes),
+		&n.Template, &rateLimit, &n.CreatedAt, &n.UpdatedAt)
+	n.RateLimitPerHour = intPtr(rateLimit)
+	if n.AlertTypes == nil {
+		n.AlertTypes = []string{}
+	}
+	return n, err
+}
+
+// validateNotificationConnector checks a connector request
+func validateNotificationConnector(req *NotificationConnectorRequest) error {
+	if req.Provider != notify.ProviderSlack && req.Provider != notify.ProviderTeams {
+		return fiber.NewError(fiber.StatusBadRequest, "provider must be slack or teams")
+	}
+	if req.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "name is required")
+	}
+	endpoint, err := url.Parse(req.WebhookURL)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "webhook_url must be an absolute https URL")
+	}
+	if !notify.IsProviderHost(req.Provider, endpoint.Hostname()) {
+		return fiber.NewError(fiber.StatusBadRequest, "webhook_url must be an incoming webhook URL of "+req.Provider)
+	}
+	if req.Channel != "" && req.Provider != notify.ProviderSlack {
+		return fiber.NewError(fiber.StatusBadRequest, "channel is only supported by slack connectors")
+	}
+	if req.AlertTypes == nil {
+		req.AlertTypes = []string{}
+	}
+	for _, alertType := range req.AlertTypes {
+		if !notify.IsAlertType(alertType) {
+			return fiber.NewError(fiber.StatusBadRequest, "Unknown alert type: "+alertType)
+		}
+	}
+	if req.Template != "" {
+		if err := notify.ValidateTemplate(req.Template); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid template: "+err.Error())
+		}
+	}
+	if req.RateLimitPerHour < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "rate_limit_per_hour must not be negative")
+	}
+	return nil
+}
+
+// CreateNotificationConnector connects a Slack or Teams channel to a company's operational alerts
+// @Summary Create notification connector
+// @Description Post a company's operational alerts (environment_alert, anchoring_failed, dispute_opened) to a Slack or Microsoft Teams incoming webhook.
+// @Description Messages are rendered with a text/template over the alert data and limited to rate_limit_per_hour per connector
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param request body NotificationConnectorRequest true "Connector details"
+// @Success 201 {object} SuccessResponse{data=NotificationConnector}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/notification-connectors [post]
+func CreateNotificationConnector(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	var req NotificationConnectorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateNotificationConnector(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", companyID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	connector, err := scanNotificationConnector(db.DB.QueryRow(`
+		INSERT INTO notification_connector (company_id, provider, name, webhook_url, channel, alert_types, template, rate_limit_per_hour,
+			created_by, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, NULLIF($7, ''), NULLIF($8, 0), NULLIF($9, 0), NOW(), NOW(), true)
+		RETURNING `+notificationConnectorColumns,
+		companyID, req.Provider, req.Name, req.WebhookURL, req.Channel, pq.Array(req.AlertTypes), req.Template, req.RateLimitPerHour, userID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create notification connector: "+err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Notification connector created successfully",
+		Data:    connector,
+	})
+}
+
+// ListNotificationConnectors lists the active notification connectors of a company
+// @Summary List notification connectors
+// @Description List the Slack and Teams connectors of a company
+// @Tags notifications
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=[]NotificationConnector}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/notification-connectors [get]
+func ListNotificationConnectors(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT `+notificationConnectorColumns+`
+		FROM notification_connector
+		WHERE company_id = $1 AND is_active = true
+		ORDER BY id
+	`, companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	connectors := []NotificationConnector{}
+	for rows.Next() {
+		connector, err := scanNotificationConnector(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse notification connector")
+		}
+		connectors = append(connectors, connector)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Notification connectors retrieved successfully",
+		Data:    connectors,
+	})
+}
+
+// UpdateNotificationConnector replaces the settings of a notification connector
+// @Summary Update notification connector
+// @Description Replace the provider, webhook, alert types, template and rate limit of a connector
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param connectorId path int true "Connector ID"
+// @Param request body NotificationConnectorRequest true "Connector details"
+// @Success 200 {object} SuccessResponse{data=NotificationConnector}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/notification-connectors/{connectorId} [put]
+func UpdateNotificationConnector(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	connectorID, err := strconv.Atoi(c.Params("connectorId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid connector ID format")
+	}
+
+	var req NotificationConnectorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateNotificationConnector(&req); err != nil {
+		return err
+	}
+
+	connector, err := scanNotificationConnector(db.DB.QueryRow(`
+		UPDATE notification_connector
+		SET provider = $3, name = $4, webhook_url = $5, channel = NULLIF($6, ''), alert_types = $7,
+			template = NULLIF($8, ''), rate_limit_per_hour = NULLIF($9, 0), updated_at = NOW()
+		WHERE id = $1 AND company_id = $2 AND is_active = true
+		RETURNING `+notificationConnectorColumns,
+		connectorID, companyID, req.Provider, req.Name, req.WebhookURL, req.Channel, pq.Array(req.AlertTypes), req.Template, req.RateLimitPerHour))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Notification connector not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update notification connector: "+err.Error())
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Notification connector updated successfully",
+		Data:    connector,
+	})
+}
+
+// DeleteNotificationConnector deactivates a notification connector
+// @Summary Delete notification connector
+// @Description Stop posting alerts to a Slack or Teams channel
+// @Tags notifications
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param connectorId path int true "Connector ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/notification-connectors/{connectorId} [delete]
+func DeleteNotificationConnector(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	connectorID, err := strconv.Atoi(c.Params("connectorId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid connector ID format")
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE notification_connector SET is_active = false, updated_at = NOW()
+		WHERE id = $1 AND company_id = $2 AND is_active = true
+	`, connectorID, companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Notification connector not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Notification connector deleted successfully",
+	})
+}
+
+// TestNotificationConnector posts a sample alert to a connector
+// @Summary Test notification connector
+// @Description Render a sample alert with the connector's template and post it, reporting the response of Slack or Teams.
+// @Description Test messages do not count towards the rate limit
+// @Tags notifications
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param connectorId path int true "Connector ID"
+// @Param alert_type query string false "Alert type to render (default environment_alert)"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /companies/{companyId}/notification-connectors/{connectorId}/test [post]
+func TestNotificationConnector(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	connectorID, err := strconv.Atoi(c.Params("connectorId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid connector ID format")
+	}
+	alertType := c.Query("alert_type", notify.AlertEnvironment)
+	if !notify.IsAlertType(alertType) {
+		return fiber.NewError(fiber.StatusBadRequest, "Unknown alert type: "+alertType)
+	}
+
+	stored, err := scanNotificationConnector(db.DB.QueryRow(`
+		SELECT `+notificationConnectorColumns+` FROM notification_connector WHERE id = $1 AND company_id = $2 AND is_active = true
+	`, connectorID, companyID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Notification connector not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	text, err := notify.Render(stored.Template, alertType, sampleAlertData[alertType])
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Failed to render template: "+err.Error())
+	}
+	connector := notify.Connector{
+		ID:         stored.ID,
+		CompanyID:  stored.CompanyID,
+		Provider:   stored.Provider,
+		WebhookURL: stored.WebhookURL,
+		Channel:    stored.Channel,
+	}
+	statusCode, err := notify.Default().Send(connector, alertType, "[Test] "+text)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, "Failed to post test message: "+err.Error())
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Test message posted successfully",
+		Data:    fiber.Map{"text": text, "response_code": statusCode},
+	})
+}
+
+// sampleAlertData is the alert data of test messages
+var sampleAlertData = map[string]map[string]interface{}{
+	notify.AlertEnvironment: {
+		"batch_id":            1,
+		"environment_data_id": 1,
+		"alerts": []map[string]interface{}{
+			{"parameter_code": "temperature", "value": 33.5, "direction": "high"},
+		},
+	},
+	notify.AlertAnchoringFailed: {
+		"record_type": "event",
+		"record_id":   1,
+		"batch_id":    1,
+		"error":       "connection refused",
+	},
+	notify.AlertDisputeOpened: {
+		"dispute_id":        1,
+		"identifier_scheme": "gs1_lot",
+		"lot_identifier":    "LOT-0001",
+		"claim_ids":         []int{1, 2},
+	},
+	notify.AlertSLABreached: {
+		"sla_id":       1,
+		"sla_name":     "Acknowledge transfers within 24 hours",
+		"metric":       "transfer_acknowledged",
+		"target_hours": 24,
+		"transfer_id":  1,
+		"due_at":       "2024-01-02T08:00:00Z",
+		"responsible":  "buyer",
+	},
+}
+
+// ListNotificationMessages lists the recent messages of a notification connector
+// @Summary List notification messages
+// @Description List the most recent alerts rendered for a connector, optionally filtered by status (pending, sent, failed, rate_limited)
+// @Tags notifications
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param connectorId path int true "Connector ID"
+// @Param status query string false "Message status"
+// @Success 200 {object} SuccessResponse{data=[]NotificationMessage}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/notification-connectors/{connectorId}/messages [get]
+func ListNotificationMessages(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	connectorID, err := strconv.Atoi(c.Params("connectorId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid connector ID format")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT m.id, m.connector_id, m.alert_type, m.text, m.status, m.response_code, COALESCE(m.last_error, ''), m.created_at, m.sent_at
+		FROM notification_message m
+		JOIN notification_connector n ON m.connector_id = n.id
+		WHERE n.id = $1 AND n.company_id = $2 AND ($3::text = '' OR m.status = $3)
+		ORDER BY m.created_at DESC
+		LIMIT 100
+	`, connectorID, companyID, c.Query("status"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	messages := []NotificationMessage{}
+	for rows.Next() {
+		var m NotificationMessage
+		var responseCode sql.NullInt64
+		var sentAt sql.NullTime
+		if err := rows.Scan(&m.ID, &m.ConnectorID, &m.AlertType, &m.Text, &m.Status, &responseCode, &m.LastError, &m.CreatedAt, &sentAt); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse notification message")
+		}
+		m.ResponseCode = intPtr(responseCode)
+		m.SentAt = timePtr(sentAt)
+		messages = append(messages, m)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Notification messages retrieved successfully",
+		Data:    messages,
+	})
+}
+
+// notifyAnchoringFailed alerts the company of a batch that a record could not be anchored on the blockchain
+// A zero companyID is resolved from the batch
+func notifyAnchoringFailed(companyID int, recordType string, recordID, batchID int, cause string) {
+	if companyID == 0 && batchID != 0 {
+		db.DB.QueryRow(`
+			SELECT COALESCE(b.owner_company_id, h.company_id) FROM batch b JOIN hatchery h ON b.hatchery_id = h.id WHERE b.id = $1
+		`, batchID).Scan(&companyID)
+	}
+	data := map[string]interface{}{
+		"record_type": recordType,
+		"record_id":   recordID,
+		"batch_id":    batchID,
+		"error":       cause,
+	}
+	if err := notify.Notify(companyID, notify.AlertAnchoringFailed, data); err != nil {
+		fmt.Printf("Warning: failed to send %s notification: %v\n", notify.AlertAnchoringFailed, err)
+	}
+}
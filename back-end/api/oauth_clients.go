@@ -0,0 +1,309 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/oauth"
+)
+
+// OAuthClientRequest registers an API client for a machine integration
+type OAuthClientRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// OAuthScope is a scope API clients can be granted
+type OAuthScope struct {
+	Scope       string `json:"scope"`
+	Description string `json:"description"`
+}
+
+// OAuthTokenRequest is a client_credentials token request; the client may authenticate with HTTP Basic instead
+type OAuthTokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type"`
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+	Scope        string `json:"scope" form:"scope"` // Space separated subset of the client's scopes
+}
+
+// OAuthError is an error response of the token endpoint, as defined by RFC 6749
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// oauthClientError maps an API client error to an HTTP error
+func oauthClientError(err error, message string) error {
+	switch {
+	case errors.Is(err, oauth.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "API client not found")
+	case errors.Is(err, oauth.ErrInvalidScope), errors.Is(err, oauth.ErrInvalidRequest):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, message)
+}
+
+// companyOAuthClientIDs parses the company and client of the path and checks the caller manages the company
+func companyOAuthClientIDs(c *fiber.Ctx) (int, int, error) {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return 0, 0, fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	clientID, err := strconv.Atoi(c.Params("clientId"))
+	if err != nil {
+		return 0, 0, fiber.NewError(fiber.StatusBadRequest, "Invalid client ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return 0, 0, err
+	}
+	return companyID, clientID, nil
+}
+
+// ListOAuthScopes lists the scopes API clients can be granted
+// @Summary List API client scopes
+// @Description List the scopes of the integration API that API clients can be granted
+// @Tags oauth
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]OAuthScope}
+// @Router /oauth/scopes [get]
+func ListOAuthScopes(c *fiber.Ctx) error {
+	scopes := []OAuthScope{}
+	for scope, description := range oauth.Scopes {
+		scopes = append(scopes, OAuthScope{Scope: scope, Description: description})
+	}
+	sort.Slice(scopes, func(i, j int) bool { return scopes[i].Scope < scopes[j].Scope })
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Scopes retrieved successfully",
+		Data:    scopes,
+	})
+}
+
+// ListOAuthClients lists the API clients of a company
+// @Summary List API clients
+// @Description List the API clients a company registered for machine integrations, revoked ones included, without their secrets.
+// @Description Calls made with a client's tokens appear in the usage reports under the oauth_client:<client_id> key
+// @Tags oauth
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=[]oauth.Client}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/oauth-clients [get]
+func ListOAuthClients(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+
+	clients, err := oauth.List(companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve API clients")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "API clients retrieved successfully",
+		Data:    clients,
+	})
+}
+
+// CreateOAuthClient registers an API client for a company
+// @Summary Create API client
+// @Description Register a confidential client for a machine integration. It exchanges its ID and secret for short-lived access tokens
+// @Description at /oauth/token with the client_credentials grant, and calls the /integrations routes its scopes allow.
+// @Description The secret is only returned in this response
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param request body OAuthClientRequest true "API client"
+// @Success 201 {object} SuccessResponse{data=oauth.Client}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/oauth-clients [post]
+func CreateOAuthClient(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+	var req OAuthClientRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", companyID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	client, err := oauth.Create(companyID, req.Name, req.Scopes, userID)
+	if err != nil {
+		return oauthClientError(err, "Failed to create API client")
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "API client created successfully",
+		Data:    client,
+	})
+}
+
+// RotateOAuthClientSecret replaces the secret of an API client
+// @Summary Rotate API client secret
+// @Description Generate a new secret for an API client; the old secret stops working at once, the tokens issued with it keep working until they expire.
+// @Description The secret is only returned in this response
+// @Tags oauth
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param clientId path int true "API client ID"
+// @Success 200 {object} SuccessResponse{data=oauth.Client}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/oauth-clients/{clientId}/secret [post]
+func RotateOAuthClientSecret(c *fiber.Ctx) error {
+	companyID, clientID, err := companyOAuthClientIDs(c)
+	if err != nil {
+		return err
+	}
+
+	client, err := oauth.RotateSecret(companyID, clientID)
+	if err != nil {
+		return oauthClientError(err, "Failed to rotate API client secret")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "API client secret rotated successfully",
+		Data:    client,
+	})
+}
+
+// RevokeOAuthClient revokes an API client
+// @Summary Revoke API client
+// @Description Revoke an API client. It can no longer get tokens, and the tokens already issued to it are refused at once
+// @Tags oauth
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param clientId path int true "API client ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/oauth-clients/{clientId} [delete]
+func RevokeOAuthClient(c *fiber.Ctx) error {
+	companyID, clientID, err := companyOAuthClientIDs(c)
+	if err != nil {
+		return err
+	}
+
+	if err := oauth.Revoke(companyID, clientID); err != nil {
+		return oauthClientError(err, "Failed to revoke API client")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "API client revoked successfully",
+	})
+}
+
+// oauthError writes a token endpoint error as defined by RFC 6749
+func oauthError(c *fiber.Ctx, status int, code, description string) error {
+	if status == fiber.StatusUnauthorized {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(status).JSON(OAuthError{Error: code, ErrorDescription: description})
+}
+
+// basicClientCredentials reads client credentials sent with HTTP Basic authentication
+func basicClientCredentials(c *fiber.Ctx) (string, string, bool) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(header, "Basic ") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+	id, secret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+	// RFC 6749 form-encodes both values before encoding them for Basic authentication
+	if unescaped, err := url.QueryUnescape(id); err == nil {
+		id = unescaped
+	}
+	if unescaped, err := url.QueryUnescape(secret); err == nil {
+		secret = unescaped
+	}
+	return id, secret, true
+}
+
+// IssueOAuthToken issues an access token to an API client
+// @Summary Get client access token
+// @Description OAuth 2.0 token endpoint for the client_credentials grant. The client authenticates with HTTP Basic or with client_id and client_secret in the body,
+// @Description and may narrow the token to some of its scopes. Tokens are RS256 JWTs verifiable against /.well-known/jwks.json and expire after a few minutes.
+// @Description Errors follow RFC 6749 rather than the usual error response
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Param request body OAuthTokenRequest true "Token request"
+// @Success 200 {object} oauth.Token
+// @Failure 400 {object} OAuthError
+// @Failure 401 {object} OAuthError
+// @Failure 500 {object} OAuthError
+// @Router /oauth/token [post]
+func IssueOAuthToken(c *fiber.Ctx) error {
+	var req OAuthTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "The request body could not be parsed")
+	}
+	if req.GrantType != oauth.GrantClientCredentials {
+		return oauthError(c, fiber.StatusBadRequest, "unsupported_grant_type", "Only the client_credentials grant is supported")
+	}
+	if id, secret, ok := basicClientCredentials(c); ok {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+	if req.ClientID == "" || req.ClientSecret == "" {
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "Client credentials are required")
+	}
+
+	client, err := oauth.Authenticate(req.ClientID, req.ClientSecret)
+	if errors.Is(err, oauth.ErrInvalidClient) {
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "Unknown or revoked client, or wrong secret")
+	}
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Failed to authenticate the client")
+	}
+	token, err := oauth.Issue(client, strings.Fields(req.Scope))
+	if errors.Is(err, oauth.ErrInvalidScope) {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_scope", err.Error())
+	}
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Failed to issue the access token")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(token)
+}
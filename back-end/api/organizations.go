@@ -0,0 +1,528 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/orgs"
+)
+
+// OrganizationRequest represents a request to create or update an organization
+type OrganizationRequest struct {
+	ParentID      int    `json:"parent_id"` // Parent organization, 0 for a top level group
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	HeadCompanyID int    `json:"head_company_id"` // Company the inheritance is granted to
+	Inheritance   string `json:"inheritance"`     // none, read or manage; default none
+}
+
+// organization converts the request to an organization
+func (r OrganizationRequest) organization() orgs.Organization {
+	return orgs.Organization{
+		ParentID:      r.ParentID,
+		Name:          r.Name,
+		Description:   r.Description,
+		HeadCompanyID: r.HeadCompanyID,
+		Inheritance:   r.Inheritance,
+	}
+}
+
+// SubsidiaryRollup is the KPIs of one company below an organization
+type SubsidiaryRollup struct {
+	CompanyID      int               `json:"company_id"`
+	CompanyName    string            `json:"company_name"`
+	OrganizationID int               `json:"organization_id"` // Organization the company is directly in
+	Hatcheries     int               `json:"hatcheries"`
+	Production     VarianceFigures   `json:"production"`
+	Scorecard      SupplierScorecard `json:"scorecard"`
+}
+
+// OrganizationRollup aggregates the KPIs of every company in an organization and the organizations below it
+type OrganizationRollup struct {
+	OrganizationID int             `json:"organization_id"`
+	Name           string          `json:"name"`
+	From           string          `json:"from"` // First month, YYYY-MM
+	To             string          `json:"to"`   // Last month, YYYY-MM
+	GraceHours     int             `json:"grace_hours"`
+	GeneratedAt    time.Time       `json:"generated_at"`
+	Organizations  int             `json:"organizations"` // The organization and those below it
+	Companies      int             `json:"companies"`
+	Hatcheries     int             `json:"hatcheries"`
+	Production     VarianceFigures `json:"production"`
+	// Scorecard combines the subsidiaries' scorecards; rates are recomputed from the summed counts
+	Scorecard    SupplierScorecard  `json:"scorecard"`
+	Subsidiaries []SubsidiaryRollup `json:"subsidiaries"`
+}
+
+// organizationError maps an organization error to an HTTP error
+func organizationError(err error, message string) error {
+	switch {
+	case errors.Is(err, orgs.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Organization not found")
+	case errors.Is(err, orgs.ErrCompanyNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Company not found in the organization")
+	case errors.Is(err, orgs.ErrInvalid):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, orgs.ErrNotEmpty):
+		return fiber.NewError(fiber.StatusConflict, "Move the child organizations and companies out of the organization first")
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, message)
+}
+
+// readsForOrganization rejects callers other than admins and the head companies of the organization or an
+// organization above it with read or manage inheritance
+func readsForOrganization(c *fiber.Ctx, orgID int) error {
+	role, _ := c.Locals("role").(string)
+	if role == "admin" {
+		return nil
+	}
+	callerCompanyID, _ := c.Locals("companyID").(int)
+	access, err := orgs.OrganizationAccess(callerCompanyID, orgID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to check organization permissions")
+	}
+	if !orgs.Allows(access, orgs.InheritRead) {
+		return fiber.NewError(fiber.StatusForbidden, "You can only read the reports of organizations your company heads")
+	}
+	return nil
+}
+
+// combineScorecards sums the counts of scorecards and recomputes their rates and score
+func combineScorecards(combined *SupplierScorecard, cards []SupplierScorecard) {
+	var documents float64
+	for _, card := range cards {
+		combined.Transfers.Total += card.Transfers.Total
+		combined.Transfers.Completed += card.Transfers.Completed
+		combined.Transfers.OnTime += card.Transfers.OnTime
+		combined.Transfers.Late += card.Transfers.Late
+		combined.Transfers.Overdue += card.Transfers.Overdue
+		combined.Batches += card.Batches
+		combined.RecalledBatches += card.RecalledBatches
+		combined.DisputedBatches += card.DisputedBatches
+		combined.LabResults += card.LabResults
+		combined.LabFailures += card.LabFailures
+		if card.DocumentCompletenessPct != nil {
+			documents += *card.DocumentCompletenessPct * float64(card.Batches)
+		}
+	}
+	combined.Transfers.OnTimeRatePct = ratePct(combined.Transfers.OnTime, combined.Transfers.Completed+combined.Transfers.Overdue)
+	if combined.Batches > 0 {
+		pct := math.Round(documents/float64(combined.Batches)*100) / 100
+		combined.DocumentCompletenessPct = &pct
+	}
+	combined.RecallRatePct = ratePct(combined.RecalledBatches, combined.Batches)
+	combined.DisputeRatePct = ratePct(combined.DisputedBatches, combined.Batches)
+	combined.LabFailureRatePct = ratePct(combined.LabFailures, combined.LabResults)
+	combined.Score = scorecardScore(combined)
+}
+
+// ListOrganizations lists the organization hierarchy
+// @Summary List organizations
+// @Description List the organizations as trees below their top level groups, with the companies directly in each
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]orgs.Node}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /organizations [get]
+func ListOrganizations(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	tree, err := orgs.Tree()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve organizations")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Organizations retrieved successfully",
+		Data:    tree,
+	})
+}
+
+// GetOrganization returns an organization
+// @Summary Get organization
+// @Description Get an organization with the companies directly in it. Admins and the head companies of the organization or an organization above it with read or manage inheritance may read it
+// @Tags organizations
+// @Produce json
+// @Param orgId path int true "Organization ID"
+// @Success 200 {object} SuccessResponse{data=orgs.Organization}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /organizations/{orgId} [get]
+func GetOrganization(c *fiber.Ctx) error {
+	orgID, err := strconv.Atoi(c.Params("orgId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid organization ID format")
+	}
+	if err := readsForOrganization(c, orgID); err != nil {
+		return err
+	}
+	organization, err := orgs.Get(orgID)
+	if err != nil {
+		return organizationError(err, "Failed to retrieve organization")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Organization retrieved successfully",
+		Data:    organization,
+	})
+}
+
+// CreateOrganization creates an organization
+// @Summary Create organization
+// @Description Create a group of companies, optionally below a parent organization. With read inheritance the head company reads the reports of every company below the organization, with manage inheritance it also acts for them
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body OrganizationRequest true "Organization"
+// @Success 201 {object} SuccessResponse{data=orgs.Organization}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /organizations [post]
+func CreateOrganization(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	var req OrganizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	organization, err := orgs.Create(req.organization(), userID)
+	if err != nil {
+		return organizationError(err, "Failed to create organization")
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Organization created successfully",
+		Data:    organization,
+	})
+}
+
+// UpdateOrganization updates an organization
+// @Summary Update organization
+// @Description Replace the parent, name, head company and inheritance of an organization. An organization cannot be moved below itself or one of its descendants
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param orgId path int true "Organization ID"
+// @Param request body OrganizationRequest true "Organization"
+// @Success 200 {object} SuccessResponse{data=orgs.Organization}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /organizations/{orgId} [put]
+func UpdateOrganization(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	orgID, err := strconv.Atoi(c.Params("orgId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid organization ID format")
+	}
+	var req OrganizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	organization, err := orgs.Update(orgID, req.organization(), userID)
+	if err != nil {
+		return organizationError(err, "Failed to update organization")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Organization updated successfully",
+		Data:    organization,
+	})
+}
+
+// DeleteOrganization deletes an empty organization
+// @Summary Delete organization
+// @Description Delete an organization without child organizations or companies
+// @Tags admin
+// @Produce json
+// @Param orgId path int true "Organization ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /organizations/{orgId} [delete]
+func DeleteOrganization(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	orgID, err := strconv.Atoi(c.Params("orgId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid organization ID format")
+	}
+	if err := orgs.Delete(orgID); err != nil {
+		return organizationError(err, "Failed to delete organization")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Organization deleted successfully",
+	})
+}
+
+// AssignOrganizationCompany places a company in an organization
+// @Summary Add company to organization
+// @Description Place a company in an organization, moving it out of the organization it was in
+// @Tags admin
+// @Produce json
+// @Param orgId path int true "Organization ID"
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=orgs.Organization}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /organizations/{orgId}/companies/{companyId} [put]
+func AssignOrganizationCompany(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	orgID, err := strconv.Atoi(c.Params("orgId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid organization ID format")
+	}
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	if err := orgs.AssignCompany(orgID, companyID); err != nil {
+		return organizationError(err, "Failed to add company to organization")
+	}
+	organization, err := orgs.Get(orgID)
+	if err != nil {
+		return organizationError(err, "Failed to retrieve organization")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Company added to organization successfully",
+		Data:    organization,
+	})
+}
+
+// RemoveOrganizationCompany takes a company out of an organization
+// @Summary Remove company from organization
+// @Description Take a company out of an organization; the head companies above it lose their inherited access
+// @Tags admin
+// @Produce json
+// @Param orgId path int true "Organization ID"
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /organizations/{orgId}/companies/{companyId} [delete]
+func RemoveOrganizationCompany(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	orgID, err := strconv.Atoi(c.Params("orgId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid organization ID format")
+	}
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	if err := orgs.RemoveCompany(orgID, companyID); err != nil {
+		return organizationError(err, "Failed to remove company from organization")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Company removed from organization successfully",
+	})
+}
+
+// GetOrganizationRollup aggregates the KPIs of the subsidiaries of an organization
+// @Summary Get organization roll-up
+// @Description Aggregate the production against plan and the supplier scorecard of every company in an organization and the organizations below it, with a breakdown per company.
+// @Description Production counts batches in the month they were started in; the scorecard covers the same months, with its rates recomputed from the summed counts rather than averaged
+// @Tags organizations
+// @Produce json
+// @Param orgId path int true "Organization ID"
+// @Param from query string false "First month (YYYY-MM), default 11 months before to"
+// @Param to query string false "Last month (YYYY-MM), default the current month"
+// @Param grace_hours query int false "Hours after the transfer time a transfer may complete and still be on time (default 24)"
+// @Success 200 {object} SuccessResponse{data=OrganizationRollup}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /organizations/{orgId}/rollup [get]
+func GetOrganizationRollup(c *fiber.Ctx) error {
+	orgID, err := strconv.Atoi(c.Params("orgId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid organization ID format")
+	}
+	from, to, err := parseMonthRange(c)
+	if err != nil {
+		return err
+	}
+	graceHours, err := parseGraceHours(c)
+	if err != nil {
+		return err
+	}
+	if err := readsForOrganization(c, orgID); err != nil {
+		return err
+	}
+
+	organization, err := orgs.Get(orgID)
+	if err != nil {
+		return organizationError(err, "Failed to retrieve organization")
+	}
+	subtree, err := orgs.Subtree(orgID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load organization hierarchy")
+	}
+	companyOrgs, err := orgs.Subsidiaries(orgID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load subsidiaries")
+	}
+	companyIDs := make([]int, 0, len(companyOrgs))
+	for companyID := range companyOrgs {
+		companyIDs = append(companyIDs, companyID)
+	}
+
+	names := map[int]string{}
+	rows, err := db.DB.Query("SELECT id, name FROM company WHERE id = ANY($1)", pq.Array(companyIDs))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse company")
+		}
+		names[id] = name
+	}
+	rows.Close()
+
+	hatcheryCompany := map[int]int{}
+	hatcheryIDs := []int{}
+	hatcheries := map[int]int{}
+	rows, err = db.DB.Query("SELECT id, company_id FROM hatchery WHERE company_id = ANY($1) AND is_active = true", pq.Array(companyIDs))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	for rows.Next() {
+		var id, companyID int
+		if err := rows.Scan(&id, &companyID); err != nil {
+			rows.Close()
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse hatchery")
+		}
+		hatcheryCompany[id] = companyID
+		hatcheryIDs = append(hatcheryIDs, id)
+		hatcheries[companyID]++
+	}
+	rows.Close()
+
+	production := map[int]*VarianceFigures{}
+	if len(hatcheryIDs) > 0 {
+		figures, _, _, err := loadVarianceFigures(hatcheryIDs, "", from, to)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to build production variance")
+		}
+		for key, f := range figures {
+			companyID := hatcheryCompany[key.hatcheryID]
+			if production[companyID] == nil {
+				production[companyID] = &VarianceFigures{}
+			}
+			production[companyID].add(*f)
+		}
+	}
+
+	cards, err := scoreSuppliers(companyIDs, names, from, to.AddDate(0, 1, 0), graceHours)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build supplier scorecards")
+	}
+
+	now := time.Now()
+	report := OrganizationRollup{
+		OrganizationID: organization.ID,
+		Name:           organization.Name,
+		From:           from.Format(energyMonthLayout),
+		To:             to.Format(energyMonthLayout),
+		GraceHours:     graceHours,
+		GeneratedAt:    now,
+		Organizations:  len(subtree),
+		Companies:      len(companyIDs),
+		Hatcheries:     len(hatcheryIDs),
+		Subsidiaries:   []SubsidiaryRollup{},
+	}
+	scorecards := []SupplierScorecard{}
+	for _, companyID := range companyIDs {
+		subsidiary := SubsidiaryRollup{
+			CompanyID:      companyID,
+			CompanyName:    names[companyID],
+			OrganizationID: companyOrgs[companyID],
+			Hatcheries:     hatcheries[companyID],
+			Scorecard:      *cards[companyID],
+		}
+		if f := production[companyID]; f != nil {
+			subsidiary.Production = *f
+		}
+		subsidiary.Production.derive()
+		report.Production.add(subsidiary.Production)
+		scorecards = append(scorecards, subsidiary.Scorecard)
+		report.Subsidiaries = append(report.Subsidiaries, subsidiary)
+	}
+	report.Production.derive()
+	report.Scorecard = SupplierScorecard{
+		CompanyName: organization.Name,
+		WindowDays:  int(to.AddDate(0, 1, 0).Sub(from).Hours() / 24),
+		From:        from,
+		To:          to.AddDate(0, 1, 0),
+		GeneratedAt: now,
+	}
+	combineScorecards(&report.Scorecard, scorecards)
+	sort.Slice(report.Subsidiaries, func(i, j int) bool {
+		if report.Subsidiaries[i].CompanyName != report.Subsidiaries[j].CompanyName {
+			return report.Subsidiaries[i].CompanyName < report.Subsidiaries[j].CompanyName
+		}
+		return report.Subsidiaries[i].CompanyID < report.Subsidiaries[j].CompanyID
+	})
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Organization roll-up generated successfully",
+		Data:    report,
+	})
+}
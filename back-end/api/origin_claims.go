@@ -0,0 +1,776 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/notify"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+)
+
+// Schemes of the external lot identifiers companies can claim
+const (
+	LotSchemeGS1         = "gs1_lot"      // GS1 batch/lot number (AI 10) printed on the physical lot
+	LotSchemeSupplier    = "supplier_lot" // Lot number assigned by the broodstock or larvae supplier
+	LotSchemeCertificate = "certificate"  // Health or origin certificate number
+	LotSchemeOther       = "other"
+)
+
+// Origin claim statuses
+const (
+	OriginClaimActive    = "active"
+	OriginClaimDisputed  = "disputed"
+	OriginClaimUpheld    = "upheld"
+	OriginClaimRejected  = "rejected"
+	OriginClaimWithdrawn = "withdrawn"
+)
+
+// Origin dispute statuses
+const (
+	OriginDisputeOpen     = "open"
+	OriginDisputeResolved = "resolved"
+)
+
+// Batch events recorded for origin disputes
+const (
+	EventTypeOriginDisputed        = "origin_disputed"
+	EventTypeOriginDisputeResolved = "origin_dispute_resolved"
+)
+
+// OriginClaim is a company's claim that one of its batches is a physical lot known by an external identifier
+type OriginClaim struct {
+	ID               int       `json:"id"`
+	CompanyID        int       `json:"company_id"`
+	BatchID          int       `json:"batch_id"`
+	IdentifierScheme string    `json:"identifier_scheme"`
+	LotIdentifier    string    `json:"lot_identifier"`
+	Evidence         string    `json:"evidence"`
+	Status           string    `json:"status"`
+	DisputeID        *int      `json:"dispute_id,omitempty"`
+	ClaimedBy        *int      `json:"claimed_by,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// OriginClaimRequest represents a request to claim an external lot identifier for a batch
+type OriginClaimRequest struct {
+	CompanyID        int    `json:"company_id"`
+	BatchID          int    `json:"batch_id"`
+	IdentifierScheme string `json:"identifier_scheme"` // gs1_lot, supplier_lot, certificate or other
+	LotIdentifier    string `json:"lot_identifier"`
+	Evidence         string `json:"evidence"`
+}
+
+// OriginDispute groups conflicting claims over the same lot identifier until it is arbitrated
+type OriginDispute struct {
+	ID               int                     `json:"id"`
+	IdentifierScheme string                  `json:"identifier_scheme"`
+	LotIdentifier    string                  `json:"lot_identifier"`
+	Status           string                  `json:"status"`
+	OpenedAt         time.Time               `json:"opened_at"`
+	WinningClaimID   *int                    `json:"winning_claim_id,omitempty"`
+	Resolution       string                  `json:"resolution"`
+	ResolvedBy       *int                    `json:"resolved_by,omitempty"`
+	ResolvedAt       *time.Time              `json:"resolved_at,omitempty"`
+	TxID             string                  `json:"tx_id,omitempty"` // Blockchain transaction recording the resolution
+	Claims           []OriginClaim           `json:"claims,omitempty"`
+	Evidence         []OriginDisputeEvidence `json:"evidence,omitempty"`
+}
+
+// OriginDisputeEvidence is a statement a party submits to the arbitration
+type OriginDisputeEvidence struct {
+	ID          int       `json:"id"`
+	DisputeID   int       `json:"dispute_id"`
+	ClaimID     int       `json:"claim_id"`
+	Statement   string    `json:"statement"`
+	DocumentIDs []int64   `json:"document_ids"`
+	SubmittedBy *int      `json:"submitted_by,omitempty"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// OriginDisputeEvidenceRequest represents a statement submitted for one of the disputed claims
+type OriginDisputeEvidenceRequest struct {
+	ClaimID     int     `json:"claim_id"`
+	Statement   string  `json:"statement"`
+	DocumentIDs []int64 `json:"document_ids"`
+}
+
+// ResolveOriginDisputeRequest records the arbitration decision; no winning claim rejects every claim
+type ResolveOriginDisputeRequest struct {
+	WinningClaimID int    `json:"winning_claim_id"`
+	Resolution     string `json:"resolution"`
+}
+
+const originClaimColumns = `
+	id, company_id, batch_id, identifier_scheme, lot_identifier, COALESCE(evidence, ''), status, dispute_id,
+	claimed_by, created_at, updated_at
+`
+
+// scanOriginClaim reads a claim selected with originClaimColumns
+func scanOriginClaim(row rowScanner) (OriginClaim, error) {
+	var o OriginClaim
+	var disputeID, claimedBy sql.NullInt64
+	err := row.Scan(&o.ID, &o.CompanyID, &o.BatchID, &o.IdentifierScheme, &o.LotIdentifier, &o.Evidence, &o.Status, &disputeID,
+		&claimedBy, &o.CreatedAt, &o.UpdatedAt)
+	o.DisputeID = intPtr(disputeID)
+	o.ClaimedBy = intPtr(claimedBy)
+	return o, err
+}
+
+// queryOriginClaims runs a claim query and collects the results
+func queryOriginClaims(query string, args ...interface{}) ([]OriginClaim, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claims := []OriginClaim{}
+	for rows.Next() {
+		claim, err := scanOriginClaim(rows)
+		if err != nil {
+			return nil, err
+		}
+		claims = append(claims, claim)
+	}
+	return claims, rows.Err()
+}
+
+const originDisputeColumns = `
+	id, identifier_scheme, lot_identifier, status, opened_at, winning_claim_id, COALESCE(resolution, ''),
+	resolved_by, resolved_at, COALESCE(tx_id, '')
+`
+
+// scanOriginDispute reads a dispute selected with originDisputeColumns
+func scanOriginDispute(row rowScanner) (OriginDispute, error) {
+	var d OriginDispute
+	var winningClaimID, resolvedBy sql.NullInt64
+	var resolvedAt sql.NullTime
+	err := row.Scan(&d.ID, &d.IdentifierScheme, &d.LotIdentifier, &d.Status, &d.OpenedAt, &winningClaimID, &d.Resolution,
+		&resolvedBy, &resolvedAt, &d.TxID)
+	d.WinningClaimID = intPtr(winningClaimID)
+	d.ResolvedBy = intPtr(resolvedBy)
+	d.ResolvedAt = timePtr(resolvedAt)
+	return d, err
+}
+
+// normalizeLotIdentifier makes identifiers printed with different spacing or case compare equal
+func normalizeLotIdentifier(identifier string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(identifier), ""))
+}
+
+// loadOriginDispute loads a dispute with its claims and submitted evidence
+func loadOriginDispute(disputeID int) (OriginDispute, error) {
+	dispute, err := scanOriginDispute(db.DB.QueryRow(`SELECT `+originDisputeColumns+` FROM origin_dispute WHERE id = $1`, disputeID))
+	if err != nil {
+		return dispute, err
+	}
+	if dispute.Claims, err = queryOriginClaims(`SELECT `+originClaimColumns+` FROM origin_claim WHERE dispute_id = $1 ORDER BY created_at, id`, disputeID); err != nil {
+		return dispute, err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, dispute_id, claim_id, statement, COALESCE(document_ids, '{}'), submitted_by, submitted_at
+		FROM origin_dispute_evidence WHERE dispute_id = $1 ORDER BY submitted_at, id
+	`, disputeID)
+	if err != nil {
+		return dispute, err
+	}
+	defer rows.Close()
+	dispute.Evidence = []OriginDisputeEvidence{}
+	for rows.Next() {
+		var e OriginDisputeEvidence
+		var submittedBy sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.DisputeID, &e.ClaimID, &e.Statement, pq.Array(&e.DocumentIDs), &submittedBy, &e.SubmittedAt); err != nil {
+			return dispute, err
+		}
+		e.SubmittedBy = intPtr(submittedBy)
+		dispute.Evidence = append(dispute.Evidence, e)
+	}
+	return dispute, rows.Err()
+}
+
+// notifyOriginDispute records an event on every disputed batch and notifies each claimant company
+func notifyOriginDispute(dispute OriginDispute, eventType, webhookEvent string, actorID int) {
+	claimIDs := make([]int, len(dispute.Claims))
+	for i, claim := range dispute.Claims {
+		claimIDs[i] = claim.ID
+	}
+	notified := map[int]bool{}
+	for _, claim := range dispute.Claims {
+		data := map[string]interface{}{
+			"dispute_id":        dispute.ID,
+			"identifier_scheme": dispute.IdentifierScheme,
+			"lot_identifier":    dispute.LotIdentifier,
+			"status":            dispute.Status,
+			"claim_id":          claim.ID,
+			"claim_status":      claim.Status,
+			"claim_ids":         claimIDs,
+		}
+		if dispute.Status == OriginDisputeResolved {
+			data["winning_claim_id"] = dispute.WinningClaimID
+			data["resolution"] = dispute.Resolution
+			data["tx_id"] = dispute.TxID
+		}
+
+		metadata, _ := json.Marshal(data)
+		_, err := db.DB.Exec(`
+			INSERT INTO event (batch_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active)
+			VALUES ($1, $2, NULLIF($3, 0), '', NOW(), $4, NOW(), true)
+		`, claim.BatchID, eventType, actorID, metadata)
+		if err != nil {
+			fmt.Printf("Warning: Failed to record %s event for batch %d: %v\n", eventType, claim.BatchID, err)
+		}
+
+		if notified[claim.CompanyID] {
+			continue
+		}
+		notified[claim.CompanyID] = true
+		if err := webhooks.Dispatch(claim.CompanyID, webhookEvent, data); err != nil {
+			fmt.Printf("Warning: failed to dispatch %s webhook: %v\n", webhookEvent, err)
+		}
+		if eventType == EventTypeOriginDisputed {
+			if err := notify.Notify(claim.CompanyID, notify.AlertDisputeOpened, data); err != nil {
+				fmt.Printf("Warning: failed to send %s notification: %v\n", notify.AlertDisputeOpened, err)
+			}
+		}
+	}
+}
+
+// anchorOriginDispute records the arbitration decision on the blockchain and returns the transaction ID
+func anchorOriginDispute(dispute OriginDispute) string {
+	cfg := config.GetConfig()
+	blockchainClient := blockchain.NewBlockchainClient(
+		cfg.BlockchainNodeURL,
+		cfg.BlockchainPrivateKey,
+		cfg.BlockchainAccount,
+		cfg.BlockchainChainID,
+		cfg.BlockchainConsensus,
+	)
+
+	claims := make([]map[string]interface{}, len(dispute.Claims))
+	for i, claim := range dispute.Claims {
+		claims[i] = map[string]interface{}{
+			"claim_id":   claim.ID,
+			"company_id": claim.CompanyID,
+			"batch_id":   claim.BatchID,
+			"status":     claim.Status,
+		}
+	}
+	metadata := map[string]interface{}{
+		"identifier_scheme": dispute.IdentifierScheme,
+		"lot_identifier":    dispute.LotIdentifier,
+		"winning_claim_id":  dispute.WinningClaimID,
+		"resolution":        dispute.Resolution,
+		"claims":            claims,
+	}
+	actor := ""
+	if dispute.ResolvedBy != nil {
+		actor = strconv.Itoa(*dispute.ResolvedBy)
+	}
+	txID, err := blockchainClient.RecordEvent(
+		"origin-dispute-"+strconv.Itoa(dispute.ID),
+		EventTypeOriginDisputeResolved,
+		"",
+		actor,
+		metadata,
+	)
+	if err != nil {
+		fmt.Printf("Warning: Failed to record origin dispute resolution on blockchain: %v\n", err)
+		return ""
+	}
+	metadataHash, err := blockchainClient.HashData(map[string]interface{}{
+		"dispute_id":  dispute.ID,
+		"resolved_at": dispute.ResolvedAt,
+		"metadata":    metadata,
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to generate metadata hash: %v\n", err)
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO blockchain_record (related_table, related_id, tx_id, metadata_hash, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NOW(), NOW(), true)
+	`, "origin_dispute", dispute.ID, txID, metadataHash)
+	if err != nil {
+		fmt.Printf("Warning: Failed to save blockchain record: %v\n", err)
+	}
+	return txID
+}
+
+// CreateOriginClaim claims an external lot identifier for a batch
+// @Summary Claim lot origin
+// @Description Claim that a batch is the physical lot known by an external identifier. If another company already claims the same identifier, a dispute is opened and every claimant is notified.
+// @Tags origin-claims
+// @Accept json
+// @Produce json
+// @Param request body OriginClaimRequest true "Origin claim"
+// @Success 201 {object} SuccessResponse{data=OriginClaim}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /origin-claims [post]
+func CreateOriginClaim(c *fiber.Ctx) error {
+	var req OriginClaimRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.CompanyID <= 0 || req.BatchID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Company ID and batch ID are required")
+	}
+	switch req.IdentifierScheme {
+	case LotSchemeGS1, LotSchemeSupplier, LotSchemeCertificate, LotSchemeOther:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Identifier scheme must be gs1_lot, supplier_lot, certificate or other")
+	}
+	identifier := normalizeLotIdentifier(req.LotIdentifier)
+	if identifier == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Lot identifier is required")
+	}
+
+	var exists bool
+	err := db.DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM batch b JOIN hatchery h ON h.id = b.hatchery_id
+			WHERE b.id = $1 AND `+batchOwnerCompany+` = $2 AND b.is_active = true
+		)
+	`, req.BatchID, req.CompanyID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found for the company")
+	}
+	err = db.DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM origin_claim
+			WHERE company_id = $1 AND identifier_scheme = $2 AND lot_identifier = $3 AND status IN ('active', 'disputed', 'upheld')
+		)
+	`, req.CompanyID, req.IdentifierScheme, identifier).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "The company already claims this lot identifier")
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	userID, _ := c.Locals("userID").(int)
+	var claimID int
+	err = tx.QueryRow(`
+		INSERT INTO origin_claim (company_id, batch_id, identifier_scheme, lot_identifier, evidence, status, claimed_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NOW(), NOW())
+		RETURNING id
+	`, req.CompanyID, req.BatchID, req.IdentifierScheme, identifier, req.Evidence, OriginClaimActive, userID).Scan(&claimID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save origin claim")
+	}
+
+	// A lot already claimed by another company is disputed; later claimants join the open dispute.
+	// A lot whose dispute was resolved in someone's favour is disputed afresh.
+	var conflicting int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM origin_claim
+		WHERE identifier_scheme = $1 AND lot_identifier = $2 AND company_id <> $3 AND status IN ('active', 'disputed', 'upheld')
+	`, req.IdentifierScheme, identifier, req.CompanyID).Scan(&conflicting)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	disputeID := 0
+	if conflicting > 0 {
+		err = tx.QueryRow(`
+			SELECT id FROM origin_dispute WHERE identifier_scheme = $1 AND lot_identifier = $2 AND status = $3
+		`, req.IdentifierScheme, identifier, OriginDisputeOpen).Scan(&disputeID)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRow(`
+				INSERT INTO origin_dispute (identifier_scheme, lot_identifier, status, opened_at)
+				VALUES ($1, $2, $3, NOW())
+				RETURNING id
+			`, req.IdentifierScheme, identifier, OriginDisputeOpen).Scan(&disputeID)
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to open origin dispute")
+		}
+		_, err = tx.Exec(`
+			UPDATE origin_claim SET status = $1, dispute_id = $2, updated_at = NOW()
+			WHERE identifier_scheme = $3 AND lot_identifier = $4 AND status IN ('active', 'disputed', 'upheld')
+		`, OriginClaimDisputed, disputeID, req.IdentifierScheme, identifier)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to mark claims as disputed")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+
+	claim, err := scanOriginClaim(db.DB.QueryRow(`SELECT `+originClaimColumns+` FROM origin_claim WHERE id = $1`, claimID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Origin claim saved but failed to retrieve details")
+	}
+	message := "Origin claim registered successfully"
+	if disputeID != 0 {
+		message = "Origin claim registered; the lot is claimed by another company and is now disputed"
+		if dispute, err := loadOriginDispute(disputeID); err != nil {
+			fmt.Printf("Warning: Failed to load origin dispute %d for notification: %v\n", disputeID, err)
+		} else {
+			notifyOriginDispute(dispute, EventTypeOriginDisputed, "origin_dispute_opened", userID)
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    claim,
+	})
+}
+
+// ListOriginClaims lists origin claims
+// @Summary List origin claims
+// @Description List origin claims, optionally filtered by company, batch, status or lot identifier
+// @Tags origin-claims
+// @Produce json
+// @Param company_id query int false "Filter by company ID"
+// @Param batch_id query int false "Filter by batch ID"
+// @Param status query string false "Filter by status (active, disputed, upheld, rejected, withdrawn)"
+// @Param lot_identifier query string false "Filter by lot identifier"
+// @Success 200 {object} SuccessResponse{data=[]OriginClaim}
+// @Failure 500 {object} ErrorResponse
+// @Router /origin-claims [get]
+func ListOriginClaims(c *fiber.Ctx) error {
+	claims, err := queryOriginClaims(`SELECT `+originClaimColumns+`
+		FROM origin_claim
+		WHERE ($1::int = 0 OR company_id = $1) AND ($2::int = 0 OR batch_id = $2)
+			AND ($3::text = '' OR status = $3) AND ($4::text = '' OR lot_identifier = $4)
+		ORDER BY created_at DESC, id DESC
+	`, c.QueryInt("company_id", 0), c.QueryInt("batch_id", 0), c.Query("status"), normalizeLotIdentifier(c.Query("lot_identifier")))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve origin claims")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Origin claims retrieved successfully",
+		Data:    claims,
+	})
+}
+
+// GetOriginClaim retrieves an origin claim
+// @Summary Get origin claim
+// @Description Retrieve an origin claim
+// @Tags origin-claims
+// @Produce json
+// @Param claimId path int true "Origin claim ID"
+// @Success 200 {object} SuccessResponse{data=OriginClaim}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /origin-claims/{claimId} [get]
+func GetOriginClaim(c *fiber.Ctx) error {
+	claimID, err := strconv.Atoi(c.Params("claimId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid origin claim ID format")
+	}
+
+	claim, err := scanOriginClaim(db.DB.QueryRow(`SELECT `+originClaimColumns+` FROM origin_claim WHERE id = $1`, claimID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Origin claim not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Origin claim retrieved successfully",
+		Data:    claim,
+	})
+}
+
+// WithdrawOriginClaim withdraws an origin claim
+// @Summary Withdraw origin claim
+// @Description Withdraw an active or disputed origin claim. A withdrawn claim drops out of its dispute, which still needs an arbitration decision.
+// @Tags origin-claims
+// @Produce json
+// @Param claimId path int true "Origin claim ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /origin-claims/{claimId} [delete]
+func WithdrawOriginClaim(c *fiber.Ctx) error {
+	claimID, err := strconv.Atoi(c.Params("claimId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid origin claim ID format")
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE origin_claim SET status = $1, updated_at = NOW() WHERE id = $2 AND status IN ('active', 'disputed')
+	`, OriginClaimWithdrawn, claimID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to withdraw origin claim")
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Active origin claim not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Origin claim withdrawn successfully",
+	})
+}
+
+// ListOriginDisputes lists origin disputes
+// @Summary List origin disputes
+// @Description List origin disputes, newest first
+// @Tags origin-claims
+// @Produce json
+// @Param status query string false "Filter by status (open, resolved)"
+// @Success 200 {object} SuccessResponse{data=[]OriginDispute}
+// @Failure 500 {object} ErrorResponse
+// @Router /origin-disputes [get]
+func ListOriginDisputes(c *fiber.Ctx) error {
+	rows, err := db.DB.Query(`SELECT `+originDisputeColumns+`
+		FROM origin_dispute
+		WHERE $1::text = '' OR status = $1
+		ORDER BY opened_at DESC, id DESC
+	`, c.Query("status"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	disputes := []OriginDispute{}
+	for rows.Next() {
+		dispute, err := scanOriginDispute(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse origin dispute")
+		}
+		disputes = append(disputes, dispute)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Origin disputes retrieved successfully",
+		Data:    disputes,
+	})
+}
+
+// GetOriginDispute retrieves an origin dispute
+// @Summary Get origin dispute
+// @Description Retrieve an origin dispute with the conflicting claims and the evidence submitted by each party
+// @Tags origin-claims
+// @Produce json
+// @Param disputeId path int true "Origin dispute ID"
+// @Success 200 {object} SuccessResponse{data=OriginDispute}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /origin-disputes/{disputeId} [get]
+func GetOriginDispute(c *fiber.Ctx) error {
+	disputeID, err := strconv.Atoi(c.Params("disputeId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid origin dispute ID format")
+	}
+
+	dispute, err := loadOriginDispute(disputeID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Origin dispute not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Origin dispute retrieved successfully",
+		Data:    dispute,
+	})
+}
+
+// SubmitOriginDisputeEvidence adds a party's statement to an open dispute
+// @Summary Submit dispute evidence
+// @Description Submit a statement, optionally referencing uploaded documents, in support of one of the disputed claims
+// @Tags origin-claims
+// @Accept json
+// @Produce json
+// @Param disputeId path int true "Origin dispute ID"
+// @Param request body OriginDisputeEvidenceRequest true "Statement"
+// @Success 201 {object} SuccessResponse{data=OriginDisputeEvidence}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /origin-disputes/{disputeId}/evidence [post]
+func SubmitOriginDisputeEvidence(c *fiber.Ctx) error {
+	disputeID, err := strconv.Atoi(c.Params("disputeId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid origin dispute ID format")
+	}
+
+	var req OriginDisputeEvidenceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.ClaimID <= 0 || strings.TrimSpace(req.Statement) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Claim ID and statement are required")
+	}
+	if req.DocumentIDs == nil {
+		req.DocumentIDs = []int64{}
+	}
+
+	var status string
+	err = db.DB.QueryRow("SELECT status FROM origin_dispute WHERE id = $1", disputeID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Origin dispute not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if status != OriginDisputeOpen {
+		return fiber.NewError(fiber.StatusConflict, "The dispute has already been resolved")
+	}
+	var exists bool
+	err = db.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM origin_claim WHERE id = $1 AND dispute_id = $2 AND status = $3)
+	`, req.ClaimID, disputeID, OriginClaimDisputed).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Claim is not part of this dispute")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	var e OriginDisputeEvidence
+	var submittedBy sql.NullInt64
+	err = db.DB.QueryRow(`
+		INSERT INTO origin_dispute_evidence (dispute_id, claim_id, statement, document_ids, submitted_by, submitted_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), NOW())
+		RETURNING id, dispute_id, claim_id, statement, document_ids, submitted_by, submitted_at
+	`, disputeID, req.ClaimID, req.Statement, pq.Array(req.DocumentIDs), userID).Scan(
+		&e.ID, &e.DisputeID, &e.ClaimID, &e.Statement, pq.Array(&e.DocumentIDs), &submittedBy, &e.SubmittedAt)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save evidence")
+	}
+	e.SubmittedBy = intPtr(submittedBy)
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Evidence submitted successfully",
+		Data:    e,
+	})
+}
+
+// ResolveOriginDispute records the arbitration decision of a dispute
+// @Summary Resolve origin dispute
+// @Description Arbitrate an open dispute: the winning claim is upheld and the others rejected, or every claim is rejected when no winner is given. The decision is recorded on the blockchain and all parties are notified.
+// @Tags origin-claims
+// @Accept json
+// @Produce json
+// @Param disputeId path int true "Origin dispute ID"
+// @Param request body ResolveOriginDisputeRequest true "Arbitration decision"
+// @Success 200 {object} SuccessResponse{data=OriginDispute}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /origin-disputes/{disputeId}/resolve [post]
+func ResolveOriginDispute(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	disputeID, err := strconv.Atoi(c.Params("disputeId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid origin dispute ID format")
+	}
+
+	var req ResolveOriginDisputeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if strings.TrimSpace(req.Resolution) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Resolution is required")
+	}
+
+	dispute, err := loadOriginDispute(disputeID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Origin dispute not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if dispute.Status != OriginDisputeOpen {
+		return fiber.NewError(fiber.StatusConflict, "The dispute has already been resolved")
+	}
+	if req.WinningClaimID != 0 {
+		found := false
+		for _, claim := range dispute.Claims {
+			if claim.ID == req.WinningClaimID && claim.Status == OriginClaimDisputed {
+				found = true
+			}
+		}
+		if !found {
+			return fiber.NewError(fiber.StatusBadRequest, "Winning claim must be one of the disputed claims")
+		}
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	userID, _ := c.Locals("userID").(int)
+	_, err = tx.Exec(`
+		UPDATE origin_claim SET status = CASE WHEN id = $1 THEN $2 ELSE $3 END, updated_at = NOW()
+		WHERE dispute_id = $4 AND status = $5
+	`, req.WinningClaimID, OriginClaimUpheld, OriginClaimRejected, disputeID, OriginClaimDisputed)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update claims")
+	}
+	_, err = tx.Exec(`
+		UPDATE origin_dispute SET status = $1, winning_claim_id = NULLIF($2, 0), resolution = $3, resolved_by = NULLIF($4, 0), resolved_at = NOW()
+		WHERE id = $5
+	`, OriginDisputeResolved, req.WinningClaimID, req.Resolution, userID, disputeID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to resolve dispute")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+
+	if dispute, err = loadOriginDispute(disputeID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Dispute resolved but failed to retrieve details")
+	}
+	if txID := anchorOriginDispute(dispute); txID != "" {
+		dispute.TxID = txID
+		if _, err := db.DB.Exec("UPDATE origin_dispute SET tx_id = $1 WHERE id = $2", txID, disputeID); err != nil {
+			fmt.Printf("Warning: Failed to save origin dispute transaction ID: %v\n", err)
+		}
+	}
+	notifyOriginDispute(dispute, EventTypeOriginDisputeResolved, "origin_dispute_resolved", userID)
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Origin dispute resolved successfully",
+		Data:    dispute,
+	})
+}
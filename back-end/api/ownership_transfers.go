@@ -0,0 +1,680 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/approvals"
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/eventbus"
+	"github.com/LTPPPP/TracePost-larvaeChain/orgs"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+)
+
+// Ownership transfer statuses
+const (
+	OwnershipTransferPending   = "pending"
+	OwnershipTransferAccepted  = "accepted"
+	OwnershipTransferRejected  = "rejected"
+	OwnershipTransferCancelled = "cancelled"
+)
+
+// Batch events recorded for ownership transfers
+const (
+	EventTypeOwnershipTransferInitiated = "ownership_transfer_initiated"
+	EventTypeOwnershipTransferred       = "ownership_transferred"
+)
+
+// BatchOwnershipTransfer is the commercial sale of a batch from one company to another.
+// The batch keeps its hatchery; ownership, and the visibility of the data recorded after the sale, move to the buyer
+type BatchOwnershipTransfer struct {
+	ID              int        `json:"id"`
+	BatchID         int        `json:"batch_id"`
+	SellerCompanyID int        `json:"seller_company_id"`
+	BuyerCompanyID  int        `json:"buyer_company_id"`
+	Status          string     `json:"status"`
+	Price           *float64   `json:"price,omitempty"`
+	Currency        string     `json:"currency,omitempty"`
+	Terms           string     `json:"terms,omitempty"`
+	InitiatedBy     *int       `json:"initiated_by,omitempty"`
+	RespondedBy     *int       `json:"responded_by,omitempty"`
+	ResponseNote    string     `json:"response_note,omitempty"`
+	TxID            string     `json:"tx_id,omitempty"` // Blockchain transaction recording the accepted transfer
+	CreatedAt       time.Time  `json:"created_at"`
+	RespondedAt     *time.Time `json:"responded_at,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// InitiateOwnershipTransferRequest represents a sale offered by the owner of a batch to another company
+type InitiateOwnershipTransferRequest struct {
+	SellerCompanyID int      `json:"seller_company_id"`
+	BuyerCompanyID  int      `json:"buyer_company_id"`
+	Price           *float64 `json:"price"`
+	Currency        string   `json:"currency"` // ISO 4217 code, e.g. VND or USD
+	Terms           string   `json:"terms"`
+}
+
+// OwnershipTransferResponseRequest represents the answer of a party to a pending transfer
+type OwnershipTransferResponseRequest struct {
+	CompanyID int    `json:"company_id"`
+	Note      string `json:"note"`
+}
+
+// batchOwnerCompany selects the company owning a batch joined as b with its hatchery as h;
+// batches never sold belong to the company of their hatchery
+const batchOwnerCompany = `COALESCE(b.owner_company_id, h.company_id)`
+
+const batchOwnershipTransferColumns = `
+	id, batch_id, seller_company_id, buyer_company_id, status, price, COALESCE(currency, ''), COALESCE(terms, ''),
+	initiated_by, responded_by, COALESCE(response_note, ''), COALESCE(tx_id, ''), created_at, responded_at, updated_at
+`
+
+// scanBatchOwnershipTransfer reads a transfer selected with batchOwnershipTransferColumns
+func scanBatchOwnershipTransfer(row rowScanner) (BatchOwnershipTransfer, error) {
+	var t BatchOwnershipTransfer
+	var price sql.NullFloat64
+	var initiatedBy, respondedBy sql.NullInt64
+	var respondedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.BatchID, &t.SellerCompanyID, &t.BuyerCompanyID, &t.Status, &price, &t.Currency, &t.Terms,
+		&initiatedBy, &respondedBy, &t.ResponseNote, &t.TxID, &t.CreatedAt, &respondedAt, &t.UpdatedAt)
+	t.Price = floatPtr(price)
+	t.InitiatedBy = intPtr(initiatedBy)
+	t.RespondedBy = intPtr(respondedBy)
+	t.RespondedAt = timePtr(respondedAt)
+	return t, err
+}
+
+// queryBatchOwnershipTransfers runs a transfer query and collects the results
+func queryBatchOwnershipTransfers(query string, args ...interface{}) ([]BatchOwnershipTransfer, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []BatchOwnershipTransfer{}
+	for rows.Next() {
+		transfer, err := scanBatchOwnershipTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, rows.Err()
+}
+
+// actsForCompany rejects callers acting for a company other than their own; admins act for any company, and the
+// head company of an organization with manage inheritance for the companies below it
+func actsForCompany(c *fiber.Ctx, companyID int) error {
+	return companyAccess(c, companyID, orgs.InheritManage, "You can only act for your own company")
+}
+
+// readsForCompany rejects callers reading the reports of a company other than their own, unless they head an
+// organization above it with read or manage inheritance
+func readsForCompany(c *fiber.Ctx, companyID int) error {
+	return companyAccess(c, companyID, orgs.InheritRead, "You can only read the reports of your own company")
+}
+
+// companyAccess rejects callers of another company unless an organization above the company grants their
+// company at least the wanted inheritance
+func companyAccess(c *fiber.Ctx, companyID int, wanted, message string) error {
+	role, _ := c.Locals("role").(string)
+	if role == "admin" {
+		return nil
+	}
+	callerCompanyID, _ := c.Locals("companyID").(int)
+	if callerCompanyID == companyID {
+		return nil
+	}
+	access, err := orgs.Access(callerCompanyID, companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to check organization permissions")
+	}
+	if !orgs.Allows(access, wanted) {
+		return fiber.NewError(fiber.StatusForbidden, message)
+	}
+	return nil
+}
+
+// recordOwnershipTransferEvent records a batch event for a transfer and notifies both parties
+func recordOwnershipTransferEvent(transfer BatchOwnershipTransfer, eventType, webhookEvent string, actorID int) {
+	data := map[string]interface{}{
+		"transfer_id":       transfer.ID,
+		"batch_id":          transfer.BatchID,
+		"seller_company_id": transfer.SellerCompanyID,
+		"buyer_company_id":  transfer.BuyerCompanyID,
+		"status":            transfer.Status,
+	}
+	if transfer.TxID != "" {
+		data["tx_id"] = transfer.TxID
+	}
+
+	if eventType != "" {
+		metadata, _ := json.Marshal(data)
+		_, err := db.DB.Exec(`
+			INSERT INTO event (batch_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active)
+			VALUES ($1, $2, NULLIF($3, 0), '', NOW(), $4, NOW(), true)
+		`, transfer.BatchID, eventType, actorID, metadata)
+		if err != nil {
+			fmt.Printf("Warning: Failed to record %s event for batch %d: %v\n", eventType, transfer.BatchID, err)
+		}
+	}
+
+	for _, companyID := range []int{transfer.SellerCompanyID, transfer.BuyerCompanyID} {
+		if err := webhooks.Dispatch(companyID, webhookEvent, data); err != nil {
+			fmt.Printf("Warning: failed to dispatch %s webhook: %v\n", webhookEvent, err)
+		}
+	}
+}
+
+// anchorOwnershipTransfer records an accepted transfer on the blockchain and returns the transaction ID
+func anchorOwnershipTransfer(transfer BatchOwnershipTransfer) string {
+	cfg := config.GetConfig()
+	blockchainClient := blockchain.NewBlockchainClient(
+		cfg.BlockchainNodeURL,
+		cfg.BlockchainPrivateKey,
+		cfg.BlockchainAccount,
+		cfg.BlockchainChainID,
+		cfg.BlockchainConsensus,
+	)
+
+	metadata := map[string]interface{}{
+		"transfer_id":       transfer.ID,
+		"seller_company_id": transfer.SellerCompanyID,
+		"buyer_company_id":  transfer.BuyerCompanyID,
+		"price":             transfer.Price,
+		"currency":          transfer.Currency,
+	}
+	actor := ""
+	if transfer.RespondedBy != nil {
+		actor = strconv.Itoa(*transfer.RespondedBy)
+	}
+	txID, err := blockchainClient.RecordEvent(
+		strconv.Itoa(transfer.BatchID),
+		EventTypeOwnershipTransferred,
+		"",
+		actor,
+		metadata,
+	)
+	if err != nil {
+		fmt.Printf("Warning: Failed to record ownership transfer on blockchain: %v\n", err)
+		return ""
+	}
+	metadataHash, err := blockchainClient.HashData(map[string]interface{}{
+		"batch_id":     transfer.BatchID,
+		"responded_at": transfer.RespondedAt,
+		"metadata":     metadata,
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to generate metadata hash: %v\n", err)
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO blockchain_record (related_table, related_id, tx_id, metadata_hash, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NOW(), NOW(), true)
+	`, "batch_ownership_transfer", transfer.ID, txID, metadataHash)
+	if err != nil {
+		fmt.Printf("Warning: Failed to save blockchain record: %v\n", err)
+	}
+	return txID
+}
+
+// loadBatchOwnershipTransfer loads a transfer from its route parameter
+func loadBatchOwnershipTransfer(c *fiber.Ctx) (BatchOwnershipTransfer, error) {
+	transferID, err := strconv.Atoi(c.Params("transferId"))
+	if err != nil {
+		return BatchOwnershipTransfer{}, fiber.NewError(fiber.StatusBadRequest, "Invalid ownership transfer ID format")
+	}
+	transfer, err := scanBatchOwnershipTransfer(db.DB.QueryRow(`SELECT `+batchOwnershipTransferColumns+` FROM batch_ownership_transfer WHERE id = $1`, transferID))
+	if err == sql.ErrNoRows {
+		return transfer, fiber.NewError(fiber.StatusNotFound, "Ownership transfer not found")
+	}
+	if err != nil {
+		return transfer, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	return transfer, nil
+}
+
+// checkOwnershipTransfer checks that the seller owns the batch, the buyer exists and the batch has no pending transfer
+func checkOwnershipTransfer(batchID int, req InitiateOwnershipTransferRequest) error {
+	var ownerCompanyID sql.NullInt64
+	err := db.DB.QueryRow(`
+		SELECT `+batchOwnerCompany+` FROM batch b JOIN hatchery h ON h.id = b.hatchery_id
+		WHERE b.id = $1 AND b.is_active = true
+	`, batchID).Scan(&ownerCompanyID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if int(ownerCompanyID.Int64) != req.SellerCompanyID {
+		return fiber.NewError(fiber.StatusForbidden, "Only the company owning the batch can sell it")
+	}
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", req.BuyerCompanyID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Buyer company not found")
+	}
+	err = db.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM batch_ownership_transfer WHERE batch_id = $1 AND status = $2)
+	`, batchID, OwnershipTransferPending).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "The batch already has a pending ownership transfer")
+	}
+	return nil
+}
+
+// initiateOwnershipTransfer saves a pending transfer and notifies the buyer
+func initiateOwnershipTransfer(batchID int, req InitiateOwnershipTransferRequest, userID int) (BatchOwnershipTransfer, error) {
+	if err := checkOwnershipTransfer(batchID, req); err != nil {
+		return BatchOwnershipTransfer{}, err
+	}
+	transfer, err := scanBatchOwnershipTransfer(db.DB.QueryRow(`
+		INSERT INTO batch_ownership_transfer (batch_id, seller_company_id, buyer_company_id, status, price, currency, terms, initiated_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, NULLIF($8, 0), NOW(), NOW())
+		RETURNING `+batchOwnershipTransferColumns,
+		batchID, req.SellerCompanyID, req.BuyerCompanyID, OwnershipTransferPending, req.Price, req.Currency, req.Terms, userID))
+	if err != nil {
+		return transfer, fiber.NewError(fiber.StatusInternalServerError, "Failed to save ownership transfer")
+	}
+	recordOwnershipTransferEvent(transfer, EventTypeOwnershipTransferInitiated, "ownership_transfer_initiated", userID)
+	return transfer, nil
+}
+
+// InitiateOwnershipTransfer offers a batch for sale to another company
+// @Summary Initiate batch ownership transfer
+// @Description Offer a batch to another company. The seller must own the batch; ownership moves only once the buyer accepts. A batch has at most one pending transfer.
+// @Description When the ownership_transfer approval policy is enabled, the offer is submitted for approval by the seller's company instead and made once approved
+// @Tags ownership-transfers
+// @Accept json
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param request body InitiateOwnershipTransferRequest true "Sale terms"
+// @Param dry_run query bool false "Only validate and describe what would happen, without writing to the database, IPFS or the chain"
+// @Success 201 {object} SuccessResponse{data=BatchOwnershipTransfer}
+// @Success 202 {object} SuccessResponse{data=approvals.Request}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/ownership-transfers [post]
+func InitiateOwnershipTransfer(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	var req InitiateOwnershipTransferRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.SellerCompanyID <= 0 || req.BuyerCompanyID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Seller and buyer company IDs are required")
+	}
+	if req.SellerCompanyID == req.BuyerCompanyID {
+		return fiber.NewError(fiber.StatusBadRequest, "The buyer must be a different company")
+	}
+	if req.Price != nil && *req.Price < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Price cannot be negative")
+	}
+	req.Currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+	if req.Currency != "" && len(req.Currency) != 3 {
+		return fiber.NewError(fiber.StatusBadRequest, "Currency must be a 3-letter ISO 4217 code")
+	}
+	if err := actsForCompany(c, req.SellerCompanyID); err != nil {
+		return err
+	}
+
+	if err := checkOwnershipTransfer(batchID, req); err != nil {
+		return err
+	}
+
+	if isDryRun(c) {
+		return dryRunResponse(c, "Dry run: the ownership transfer would be initiated", DryRunResult{
+			Action: "initiate_ownership_transfer",
+			Record: BatchOwnershipTransfer{
+				BatchID:         batchID,
+				SellerCompanyID: req.SellerCompanyID,
+				BuyerCompanyID:  req.BuyerCompanyID,
+				Status:          OwnershipTransferPending,
+				Price:           req.Price,
+				Currency:        req.Currency,
+				Terms:           req.Terms,
+			},
+			Effects: []string{
+				"Insert the ownership transfer as pending",
+				"Record an " + EventTypeOwnershipTransferInitiated + " event and notify the buyer",
+			},
+			Warnings: batchDryRunWarnings(batchID),
+		})
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	if request, err := submitForApproval(c, approvals.ActionOwnershipTransfer, req.SellerCompanyID, "batch", batchID,
+		fmt.Sprintf("Offer batch %d to company %d", batchID, req.BuyerCompanyID),
+		ownershipTransferApproval{BatchID: batchID, InitiateOwnershipTransferRequest: req}); request != nil || err != nil {
+		return err
+	}
+	transfer, err := initiateOwnershipTransfer(batchID, req, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Ownership transfer initiated; waiting for the buyer to accept",
+		Data:    transfer,
+	})
+}
+
+// ListBatchOwnershipTransfers lists the ownership transfers of a batch
+// @Summary List batch ownership transfers
+// @Description List every ownership transfer of a batch, oldest first, giving its chain of owners
+// @Tags ownership-transfers
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]BatchOwnershipTransfer}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/ownership-transfers [get]
+func ListBatchOwnershipTransfers(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	transfers, err := queryBatchOwnershipTransfers(`SELECT `+batchOwnershipTransferColumns+`
+		FROM batch_ownership_transfer WHERE batch_id = $1 ORDER BY created_at, id
+	`, batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve ownership transfers")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Ownership transfers retrieved successfully",
+		Data:    transfers,
+	})
+}
+
+// ListOwnershipTransfers lists the ownership transfers of a company
+// @Summary List ownership transfers
+// @Description List the ownership transfers a company sold or bought, newest first. Both parties keep the record of a transfer.
+// @Tags ownership-transfers
+// @Produce json
+// @Param company_id query int true "Company ID"
+// @Param direction query string false "incoming (bought), outgoing (sold) or both when empty"
+// @Param status query string false "Filter by status (pending, accepted, rejected, cancelled)"
+// @Success 200 {object} SuccessResponse{data=[]BatchOwnershipTransfer}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /ownership-transfers [get]
+func ListOwnershipTransfers(c *fiber.Ctx) error {
+	companyID := c.QueryInt("company_id", 0)
+	if companyID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Company ID is required")
+	}
+	direction := c.Query("direction")
+	switch direction {
+	case "", "incoming", "outgoing":
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Direction must be incoming or outgoing")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+
+	transfers, err := queryBatchOwnershipTransfers(`SELECT `+batchOwnershipTransferColumns+`
+		FROM batch_ownership_transfer
+		WHERE (($2::text IN ('', 'outgoing') AND seller_company_id = $1) OR ($2::text IN ('', 'incoming') AND buyer_company_id = $1))
+			AND ($3::text = '' OR status = $3)
+		ORDER BY created_at DESC, id DESC
+	`, companyID, direction, c.Query("status"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve ownership transfers")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Ownership transfers retrieved successfully",
+		Data:    transfers,
+	})
+}
+
+// GetOwnershipTransfer retrieves an ownership transfer
+// @Summary Get ownership transfer
+// @Description Retrieve an ownership transfer
+// @Tags ownership-transfers
+// @Produce json
+// @Param transferId path int true "Ownership transfer ID"
+// @Success 200 {object} SuccessResponse{data=BatchOwnershipTransfer}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /ownership-transfers/{transferId} [get]
+func GetOwnershipTransfer(c *fiber.Ctx) error {
+	transfer, err := loadBatchOwnershipTransfer(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Ownership transfer retrieved successfully",
+		Data:    transfer,
+	})
+}
+
+// AcceptOwnershipTransfer completes a sale
+// @Summary Accept ownership transfer
+// @Description Accept a pending transfer as the buyer. The batch and the data recorded from now on belong to the buyer; earlier records stay visible to the seller. The transfer is recorded on the blockchain and both parties are notified.
+// @Tags ownership-transfers
+// @Accept json
+// @Produce json
+// @Param transferId path int true "Ownership transfer ID"
+// @Param request body OwnershipTransferResponseRequest true "Buyer company and optional note"
+// @Param dry_run query bool false "Only validate and describe what would happen, without writing to the database, IPFS or the chain"
+// @Success 200 {object} SuccessResponse{data=BatchOwnershipTransfer}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /ownership-transfers/{transferId}/accept [post]
+func AcceptOwnershipTransfer(c *fiber.Ctx) error {
+	transfer, req, err := respondToOwnershipTransfer(c, func(t BatchOwnershipTransfer) int { return t.BuyerCompanyID }, "Only the buying company can accept the transfer")
+	if err != nil {
+		return err
+	}
+
+	if isDryRun(c) {
+		var sellerOwns bool
+		err := db.DB.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM batch b JOIN hatchery h ON h.id = b.hatchery_id WHERE b.id = $1 AND `+batchOwnerCompany+` = $2)
+		`, transfer.BatchID, transfer.SellerCompanyID).Scan(&sellerOwns)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if !sellerOwns {
+			return fiber.NewError(fiber.StatusConflict, "The seller no longer owns the batch")
+		}
+		transfer.Status = OwnershipTransferAccepted
+		transfer.ResponseNote = req.Note
+		return dryRunResponse(c, "Dry run: the ownership transfer would be accepted", DryRunResult{
+			Action: "accept_ownership_transfer",
+			Record: transfer,
+			Effects: []string{
+				"Make the buying company the owner of the batch",
+				"Mark the ownership transfer as accepted",
+				"Submit the transfer to the blockchain",
+				"Record an " + EventTypeOwnershipTransferred + " event, notify both parties and publish an ownership transferred domain event",
+			},
+			Warnings: batchDryRunWarnings(transfer.BatchID),
+		})
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	// The seller may have sold or lost the batch since the offer was made
+	userID, _ := c.Locals("userID").(int)
+	result, err := tx.Exec(`
+		UPDATE batch b SET owner_company_id = $1, updated_at = NOW()
+		FROM hatchery h
+		WHERE h.id = b.hatchery_id AND b.id = $2 AND `+batchOwnerCompany+` = $3
+	`, transfer.BuyerCompanyID, transfer.BatchID, transfer.SellerCompanyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to transfer batch ownership")
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusConflict, "The seller no longer owns the batch")
+	}
+	transfer, err = scanBatchOwnershipTransfer(tx.QueryRow(`
+		UPDATE batch_ownership_transfer
+		SET status = $1, responded_by = NULLIF($2, 0), response_note = $3, responded_at = NOW(), updated_at = NOW()
+		WHERE id = $4 AND status = $5
+		RETURNING `+batchOwnershipTransferColumns,
+		OwnershipTransferAccepted, userID, req.Note, transfer.ID, OwnershipTransferPending))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusConflict, "The transfer is no longer pending")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to accept ownership transfer")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+
+	if txID := anchorOwnershipTransfer(transfer); txID != "" {
+		transfer.TxID = txID
+		if _, err := db.DB.Exec("UPDATE batch_ownership_transfer SET tx_id = $1 WHERE id = $2", txID, transfer.ID); err != nil {
+			fmt.Printf("Warning: Failed to save ownership transfer transaction ID: %v\n", err)
+		}
+	}
+	recordOwnershipTransferEvent(transfer, EventTypeOwnershipTransferred, "ownership_transfer_accepted", userID)
+	publishDomainEvent(eventbus.OwnershipTransferred, transfer.BuyerCompanyID, transfer.BatchID, map[string]interface{}{
+		"transfer_id":       transfer.ID,
+		"seller_company_id": transfer.SellerCompanyID,
+		"buyer_company_id":  transfer.BuyerCompanyID,
+		"tx_id":             transfer.TxID,
+	})
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Ownership transfer accepted; the batch now belongs to the buyer",
+		Data:    transfer,
+	})
+}
+
+// RejectOwnershipTransfer declines a sale
+// @Summary Reject ownership transfer
+// @Description Reject a pending transfer as the buyer; the seller keeps the batch
+// @Tags ownership-transfers
+// @Accept json
+// @Produce json
+// @Param transferId path int true "Ownership transfer ID"
+// @Param request body OwnershipTransferResponseRequest true "Buyer company and optional reason"
+// @Success 200 {object} SuccessResponse{data=BatchOwnershipTransfer}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /ownership-transfers/{transferId}/reject [post]
+func RejectOwnershipTransfer(c *fiber.Ctx) error {
+	return closeOwnershipTransfer(c, OwnershipTransferRejected,
+		func(t BatchOwnershipTransfer) int { return t.BuyerCompanyID }, "Only the buying company can reject the transfer")
+}
+
+// CancelOwnershipTransfer withdraws a sale offer
+// @Summary Cancel ownership transfer
+// @Description Cancel a pending transfer as the seller
+// @Tags ownership-transfers
+// @Accept json
+// @Produce json
+// @Param transferId path int true "Ownership transfer ID"
+// @Param request body OwnershipTransferResponseRequest true "Seller company and optional reason"
+// @Success 200 {object} SuccessResponse{data=BatchOwnershipTransfer}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /ownership-transfers/{transferId}/cancel [post]
+func CancelOwnershipTransfer(c *fiber.Ctx) error {
+	return closeOwnershipTransfer(c, OwnershipTransferCancelled,
+		func(t BatchOwnershipTransfer) int { return t.SellerCompanyID }, "Only the selling company can cancel the transfer")
+}
+
+// respondToOwnershipTransfer loads a pending transfer and checks that the caller answers for the given party
+func respondToOwnershipTransfer(c *fiber.Ctx, party func(BatchOwnershipTransfer) int, forbidden string) (BatchOwnershipTransfer, OwnershipTransferResponseRequest, error) {
+	var req OwnershipTransferResponseRequest
+	transfer, err := loadBatchOwnershipTransfer(c)
+	if err != nil {
+		return transfer, req, err
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return transfer, req, fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.CompanyID <= 0 {
+		return transfer, req, fiber.NewError(fiber.StatusBadRequest, "Company ID is required")
+	}
+	if req.CompanyID != party(transfer) {
+		return transfer, req, fiber.NewError(fiber.StatusForbidden, forbidden)
+	}
+	if err := actsForCompany(c, req.CompanyID); err != nil {
+		return transfer, req, err
+	}
+	if transfer.Status != OwnershipTransferPending {
+		return transfer, req, fiber.NewError(fiber.StatusConflict, "The transfer is no longer pending")
+	}
+	return transfer, req, nil
+}
+
+// closeOwnershipTransfer ends a pending transfer without moving ownership
+func closeOwnershipTransfer(c *fiber.Ctx, status string, party func(BatchOwnershipTransfer) int, forbidden string) error {
+	transfer, req, err := respondToOwnershipTransfer(c, party, forbidden)
+	if err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	transfer, err = scanBatchOwnershipTransfer(db.DB.QueryRow(`
+		UPDATE batch_ownership_transfer
+		SET status = $1, responded_by = NULLIF($2, 0), response_note = $3, responded_at = NOW(), updated_at = NOW()
+		WHERE id = $4 AND status = $5
+		RETURNING `+batchOwnershipTransferColumns,
+		status, userID, req.Note, transfer.ID, OwnershipTransferPending))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusConflict, "The transfer is no longer pending")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update ownership transfer")
+	}
+	recordOwnershipTransferEvent(transfer, "", "ownership_transfer_"+status, userID)
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Ownership transfer " + status,
+		Data:    transfer,
+	})
+}
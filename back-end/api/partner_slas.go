@@ -0,0 +1,290 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/sla"
+)
+
+// PartnerSLARequest is a service level agreed between a supplier and a buyer
+type PartnerSLARequest struct {
+	SupplierCompanyID int    `json:"supplier_company_id"` // Ignored on update
+	BuyerCompanyID    int    `json:"buyer_company_id"`    // Ignored on update
+	Name              string `json:"name"`
+	Metric            string `json:"metric"` // transfer_acknowledged, transfer_completed or document_uploaded
+	TargetHours       int    `json:"target_hours"`
+	DocType           string `json:"doc_type"` // Required for document_uploaded
+	Active            *bool  `json:"active"`   // Default true
+}
+
+// PartnerSLAReport is the SLA compliance of a partnership over a period
+type PartnerSLAReport struct {
+	CompanyID   int              `json:"company_id"`
+	PartnerID   int              `json:"partner_id"`
+	PartnerName string           `json:"partner_name"`
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	SLAs        []sla.Compliance `json:"slas"`
+	GeneratedAt time.Time        `json:"generated_at"`
+}
+
+// slaError maps an SLA error to an HTTP error
+func slaError(err error, message string) error {
+	switch {
+	case errors.Is(err, sla.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "SLA not found")
+	case errors.Is(err, sla.ErrInvalid):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, message)
+}
+
+// companySLA loads an SLA the company in the path is party to
+func companySLA(c *fiber.Ctx) (*sla.Definition, error) {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	slaID, err := strconv.Atoi(c.Params("slaId"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid SLA ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return nil, err
+	}
+	definition, err := sla.Get(slaID)
+	if err != nil {
+		return nil, slaError(err, "Failed to retrieve SLA")
+	}
+	if definition.SupplierCompanyID != companyID && definition.BuyerCompanyID != companyID {
+		return nil, fiber.NewError(fiber.StatusNotFound, "SLA not found")
+	}
+	return definition, nil
+}
+
+// ListPartnerSLAs lists the SLAs a company is party to
+// @Summary List partner SLAs
+// @Description List the service levels a company agreed with its trading partners, as supplier or buyer
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=[]sla.Definition}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/slas [get]
+func ListPartnerSLAs(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := readsForCompany(c, companyID); err != nil {
+		return err
+	}
+
+	definitions, err := sla.List(companyID, false)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve SLAs")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "SLAs retrieved successfully",
+		Data:    definitions,
+	})
+}
+
+// CreatePartnerSLA records a service level agreed with a trading partner
+// @Summary Create partner SLA
+// @Description Agree a service level with a trading partner, measured on every transfer from the supplier to the buyer from the time it is created:
+// @Description transfer_acknowledged binds the buyer to change the transfer status, transfer_completed binds the supplier to complete it,
+// @Description and document_uploaded binds the supplier to upload a document of doc_type for the batch, each within target_hours.
+// @Description Breaches are notified to both companies through their notification connectors and the sla_breached webhook event
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID, the supplier or the buyer"
+// @Param request body PartnerSLARequest true "SLA"
+// @Success 201 {object} SuccessResponse{data=sla.Definition}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/slas [post]
+func CreatePartnerSLA(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+	var req PartnerSLARequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.SupplierCompanyID != companyID && req.BuyerCompanyID != companyID {
+		return fiber.NewError(fiber.StatusBadRequest, "The company must be the supplier or the buyer of the SLA")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	definition, err := sla.Create(sla.Definition{
+		SupplierCompanyID: req.SupplierCompanyID,
+		BuyerCompanyID:    req.BuyerCompanyID,
+		Name:              req.Name,
+		Metric:            req.Metric,
+		TargetHours:       req.TargetHours,
+		DocType:           req.DocType,
+		Active:            req.Active == nil || *req.Active,
+	}, userID)
+	if err != nil {
+		return slaError(err, "Failed to create SLA")
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "SLA created successfully",
+		Data:    definition,
+	})
+}
+
+// UpdatePartnerSLA changes the terms of a partner SLA
+// @Summary Update partner SLA
+// @Description Change the name, metric, target or document type of an SLA, or pause it. The partners it binds cannot change
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID, the supplier or the buyer"
+// @Param slaId path int true "SLA ID"
+// @Param request body PartnerSLARequest true "SLA"
+// @Success 200 {object} SuccessResponse{data=sla.Definition}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/slas/{slaId} [put]
+func UpdatePartnerSLA(c *fiber.Ctx) error {
+	definition, err := companySLA(c)
+	if err != nil {
+		return err
+	}
+	var req PartnerSLARequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	definition.Name = req.Name
+	definition.Metric = req.Metric
+	definition.TargetHours = req.TargetHours
+	definition.DocType = req.DocType
+	definition.Active = req.Active == nil || *req.Active
+
+	userID, _ := c.Locals("userID").(int)
+	updated, err := sla.Update(*definition, userID)
+	if err != nil {
+		return slaError(err, "Failed to update SLA")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "SLA updated successfully",
+		Data:    updated,
+	})
+}
+
+// DeactivatePartnerSLA stops measuring a partner SLA
+// @Summary Deactivate partner SLA
+// @Description Stop measuring an SLA. It is kept for the breaches recorded against it
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID, the supplier or the buyer"
+// @Param slaId path int true "SLA ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/slas/{slaId} [delete]
+func DeactivatePartnerSLA(c *fiber.Ctx) error {
+	definition, err := companySLA(c)
+	if err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	if err := sla.Deactivate(definition.ID, userID); err != nil {
+		return slaError(err, "Failed to deactivate SLA")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "SLA deactivated successfully",
+	})
+}
+
+// GetPartnerSLAReport reports how a partnership met its SLAs
+// @Summary Get partner SLA compliance report
+// @Description Measure every SLA between a company and a partner on the transfers created in a period, defaulting to the last 30 days:
+// @Description the met, breached and pending transfers, the compliance rate over the decided ones, the time to fulfilment and each breach
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param partnerId path int true "Partner company ID"
+// @Param from query string false "Start time (RFC3339)"
+// @Param to query string false "End time (RFC3339)"
+// @Success 200 {object} SuccessResponse{data=PartnerSLAReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/partners/{partnerId}/sla-report [get]
+func GetPartnerSLAReport(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	partnerID, err := strconv.Atoi(c.Params("partnerId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid partner ID format")
+	}
+	if partnerID == companyID {
+		return fiber.NewError(fiber.StatusBadRequest, "The partner must be another company")
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return err
+	}
+	if err := readsForCompany(c, companyID); err != nil {
+		return err
+	}
+
+	report := PartnerSLAReport{CompanyID: companyID, PartnerID: partnerID, GeneratedAt: time.Now()}
+	if err := db.DB.QueryRow(`SELECT name FROM company WHERE id = $1`, partnerID).Scan(&report.PartnerName); err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Partner company not found")
+	}
+	if to.IsZero() {
+		to = report.GeneratedAt
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -30)
+	}
+	report.From, report.To = from, to
+
+	definitions, err := sla.Between(companyID, partnerID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve SLAs")
+	}
+	report.SLAs = []sla.Compliance{}
+	for _, definition := range definitions {
+		measurements, err := sla.Measure(definition, from, to, report.GeneratedAt)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to measure SLAs")
+		}
+		report.SLAs = append(report.SLAs, sla.Summarize(definition, measurements))
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "SLA compliance report generated successfully",
+		Data:    report,
+	})
+}
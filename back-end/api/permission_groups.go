@@ -0,0 +1,709 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+)
+
+// Permissions a permission group can grant
+const (
+	PermissionBatchEdit = "batch:edit"
+	PermissionTankEdit  = "tank:edit"
+)
+
+var validPermissions = map[string]bool{
+	PermissionBatchEdit: true,
+	PermissionTankEdit:  true,
+}
+
+// PermissionGroup is a team within a company, e.g. "Tank A team", that may only change the
+// batches and tanks of the hatcheries and tanks in its scope.
+// A group without hatcheries or tanks covers the whole company.
+type PermissionGroup struct {
+	ID          int                     `json:"id"`
+	CompanyID   int                     `json:"company_id"`
+	Name        string                  `json:"name"`
+	Description string                  `json:"description"`
+	Permissions []string                `json:"permissions"`
+	HatcheryIDs []int                   `json:"hatchery_ids"`
+	TankIDs     []int                   `json:"tank_ids"`
+	Members     []PermissionGroupMember `json:"members"`
+	CreatedBy   int                     `json:"created_by,omitempty"`
+	CreatedAt   time.Time               `json:"created_at"`
+	UpdatedAt   time.Time               `json:"updated_at"`
+}
+
+// PermissionGroupMember is a user in a permission group
+type PermissionGroupMember struct {
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	FullName string    `json:"full_name"`
+	Role     string    `json:"role"`
+	AddedBy  int       `json:"added_by,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// PermissionGroupRequest represents a request to create or update a permission group
+type PermissionGroupRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	HatcheryIDs []int    `json:"hatchery_ids"`
+	TankIDs     []int    `json:"tank_ids"`
+}
+
+// AddGroupMemberRequest represents a request to add a user to a permission group
+type AddGroupMemberRequest struct {
+	UserID int `json:"user_id"`
+}
+
+// requireGroupPermission restricts write requests on the resource named by the route parameter
+// to users whose permission groups grant the permission on it
+func requireGroupPermission(permission, param string) fiber.Handler {
+	return middleware.PermissionMiddleware(permission, param, checkGroupPermission)
+}
+
+// checkGroupPermission reports whether a user may use a permission on a batch or tank.
+// Admins and users outside every permission group keep the access of their role; members
+// are limited to the hatcheries and tanks their groups granting the permission cover.
+func checkGroupPermission(userID int, role, permission string, resourceID int) (bool, error) {
+	if role == "admin" || userID == 0 {
+		return true, nil
+	}
+
+	var grouped bool
+	err := db.DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM permission_group_member m
+			JOIN permission_group g ON g.id = m.group_id
+			WHERE m.account_id = $1 AND g.is_active = true
+		)
+	`, userID).Scan(&grouped)
+	if err != nil || !grouped {
+		return !grouped, err
+	}
+
+	// Resolve the hatchery and the tanks of the resource; unknown resources are left to the handler's 404
+	var hatcheryID, companyID sql.NullInt64
+	var tankIDs []int64
+	switch permission {
+	case PermissionTankEdit:
+		err = db.DB.QueryRow(`
+			SELECT t.hatchery_id, h.company_id, ARRAY[t.id]
+			FROM tank t LEFT JOIN hatchery h ON h.id = t.hatchery_id
+			WHERE t.id = $1
+		`, resourceID).Scan(&hatcheryID, &companyID, pq.Array(&tankIDs))
+	default:
+		err = db.DB.QueryRow(`
+			SELECT b.hatchery_id, h.company_id,
+				ARRAY(SELECT tank_id FROM tank_assignment WHERE batch_id = b.id AND released_at IS NULL)
+			FROM batch b LEFT JOIN hatchery h ON h.id = b.hatchery_id
+			WHERE b.id = $1
+		`, resourceID).Scan(&hatcheryID, &companyID, pq.Array(&tankIDs))
+	}
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var allowed bool
+	err = db.DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM permission_group g
+			JOIN permission_group_member m ON m.group_id = g.id
+			WHERE m.account_id = $1 AND g.is_active = true AND $2 = ANY(g.permissions) AND g.company_id = $3
+				AND (
+					NOT EXISTS(SELECT 1 FROM permission_group_scope s WHERE s.group_id = g.id)
+					OR EXISTS(
+						SELECT 1 FROM permission_group_scope s
+						WHERE s.group_id = g.id AND (s.hatchery_id = $4 OR s.tank_id = ANY($5))
+					)
+				)
+		)
+	`, userID, permission, companyID, hatcheryID, pq.Array(tankIDs)).Scan(&allowed)
+	return allowed, err
+}
+
+// loadPermissionGroup loads an active permission group with its scope and members
+func loadPermissionGroup(groupID int) (PermissionGroup, error) {
+	var g PermissionGroup
+	err := db.DB.QueryRow(`
+		SELECT id, company_id, name, COALESCE(description, ''), permissions, COALESCE(created_by, 0), created_at, updated_at
+		FROM permission_group
+		WHERE id = $1 AND is_active = true
+	`, groupID).Scan(&g.ID, &g.CompanyID, &g.Name, &g.Description, pq.Array(&g.Permissions), &g.CreatedBy, &g.CreatedAt, &g.UpdatedAt)
+	if err != nil {
+		return g, err
+	}
+
+	g.HatcheryIDs, g.TankIDs = []int{}, []int{}
+	rows, err := db.DB.Query(`
+		SELECT COALESCE(hatchery_id, 0), COALESCE(tank_id, 0)
+		FROM permission_group_scope
+		WHERE group_id = $1
+		ORDER BY id
+	`, groupID)
+	if err != nil {
+		return g, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hatcheryID, tankID int
+		if err := rows.Scan(&hatcheryID, &tankID); err != nil {
+			return g, err
+		}
+		if hatcheryID != 0 {
+			g.HatcheryIDs = append(g.HatcheryIDs, hatcheryID)
+		}
+		if tankID != 0 {
+			g.TankIDs = append(g.TankIDs, tankID)
+		}
+	}
+
+	g.Members, err = loadGroupMembers(groupID)
+	return g, err
+}
+
+// loadGroupMembers lists the users in a permission group
+func loadGroupMembers(groupID int) ([]PermissionGroupMember, error) {
+	rows, err := db.DB.Query(`
+		SELECT a.id, a.username, COALESCE(a.full_name, ''), a.role, COALESCE(m.added_by, 0), m.added_at
+		FROM permission_group_member m
+		JOIN account a ON a.id = m.account_id
+		WHERE m.group_id = $1
+		ORDER BY a.username
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []PermissionGroupMember{}
+	for rows.Next() {
+		var m PermissionGroupMember
+		if err := rows.Scan(&m.UserID, &m.Username, &m.FullName, &m.Role, &m.AddedBy, &m.AddedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// validatePermissionGroupRequest normalizes a group request and checks that its scope belongs to the company
+func validatePermissionGroupRequest(req *PermissionGroupRequest, companyID int) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Group name is required")
+	}
+	if len(req.Permissions) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one permission is required")
+	}
+	for _, permission := range req.Permissions {
+		if !validPermissions[permission] {
+			return fiber.NewError(fiber.StatusBadRequest, "Unknown permission: "+permission+" (expected batch:edit or tank:edit)")
+		}
+	}
+
+	if len(req.HatcheryIDs) > 0 {
+		var count int
+		if err := db.DB.QueryRow(`
+			SELECT COUNT(*) FROM hatchery WHERE id = ANY($1) AND company_id = $2 AND is_active = true
+		`, pq.Array(req.HatcheryIDs), companyID).Scan(&count); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if count != len(uniqueInts(req.HatcheryIDs)) {
+			return fiber.NewError(fiber.StatusBadRequest, "Every hatchery must belong to the company")
+		}
+	}
+	if len(req.TankIDs) > 0 {
+		var count int
+		if err := db.DB.QueryRow(`
+			SELECT COUNT(*) FROM tank t JOIN hatchery h ON h.id = t.hatchery_id
+			WHERE t.id = ANY($1) AND h.company_id = $2 AND t.is_active = true
+		`, pq.Array(req.TankIDs), companyID).Scan(&count); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if count != len(uniqueInts(req.TankIDs)) {
+			return fiber.NewError(fiber.StatusBadRequest, "Every tank must belong to a hatchery of the company")
+		}
+	}
+	return nil
+}
+
+// uniqueInts drops repeated values, keeping the first occurrence
+func uniqueInts(values []int) []int {
+	seen := make(map[int]bool, len(values))
+	out := make([]int, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// replaceGroupScope swaps the hatcheries and tanks a group covers
+func replaceGroupScope(tx *sql.Tx, groupID int, hatcheryIDs, tankIDs []int) error {
+	if _, err := tx.Exec("DELETE FROM permission_group_scope WHERE group_id = $1", groupID); err != nil {
+		return err
+	}
+	for _, hatcheryID := range uniqueInts(hatcheryIDs) {
+		if _, err := tx.Exec("INSERT INTO permission_group_scope (group_id, hatchery_id) VALUES ($1, $2)", groupID, hatcheryID); err != nil {
+			return err
+		}
+	}
+	for _, tankID := range uniqueInts(tankIDs) {
+		if _, err := tx.Exec("INSERT INTO permission_group_scope (group_id, tank_id) VALUES ($1, $2)", groupID, tankID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListPermissionGroups lists the permission groups of a company
+// @Summary List permission groups
+// @Description List the teams of a company with the permissions, hatcheries, tanks and members of each
+// @Tags permission-groups
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=[]PermissionGroup}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/permission-groups [get]
+func ListPermissionGroups(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id FROM permission_group
+		WHERE company_id = $1 AND is_active = true
+		ORDER BY name
+	`, companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	var groupIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse permission group")
+		}
+		groupIDs = append(groupIDs, id)
+	}
+	rows.Close()
+
+	groups := []PermissionGroup{}
+	for _, id := range groupIDs {
+		group, err := loadPermissionGroup(id)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load permission group")
+		}
+		groups = append(groups, group)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Permission groups retrieved successfully",
+		Data:    groups,
+	})
+}
+
+// CreatePermissionGroup creates a permission group in a company
+// @Summary Create permission group
+// @Description Create a team whose members may only change batches and tanks in the listed hatcheries and tanks. Leave both lists empty to cover the whole company
+// @Tags permission-groups
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param request body PermissionGroupRequest true "Permission group"
+// @Success 201 {object} SuccessResponse{data=PermissionGroup}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/permission-groups [post]
+func CreatePermissionGroup(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	var req PermissionGroupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", companyID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+	if err := validatePermissionGroupRequest(&req, companyID); err != nil {
+		return err
+	}
+
+	if err := db.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM permission_group WHERE company_id = $1 AND LOWER(name) = LOWER($2) AND is_active = true)
+	`, companyID, req.Name).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A permission group with this name already exists")
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	userID, _ := c.Locals("userID").(int)
+	var groupID int
+	err = tx.QueryRow(`
+		INSERT INTO permission_group (company_id, name, description, permissions, created_by, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), NOW(), NOW(), true)
+		RETURNING id
+	`, companyID, req.Name, req.Description, pq.Array(uniqueStrings(req.Permissions)), userID).Scan(&groupID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create permission group")
+	}
+	if err := replaceGroupScope(tx, groupID, req.HatcheryIDs, req.TankIDs); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save permission group scope")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+
+	group, err := loadPermissionGroup(groupID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load permission group")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Permission group created successfully",
+		Data:    group,
+	})
+}
+
+// uniqueStrings drops repeated values, keeping the first occurrence
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// GetPermissionGroup gets a permission group
+// @Summary Get permission group
+// @Description Get a permission group with its permissions, scope and members
+// @Tags permission-groups
+// @Produce json
+// @Param groupId path int true "Permission group ID"
+// @Success 200 {object} SuccessResponse{data=PermissionGroup}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /permission-groups/{groupId} [get]
+func GetPermissionGroup(c *fiber.Ctx) error {
+	groupID, err := strconv.Atoi(c.Params("groupId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid permission group ID format")
+	}
+
+	group, err := loadPermissionGroup(groupID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Permission group not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Permission group retrieved successfully",
+		Data:    group,
+	})
+}
+
+// UpdatePermissionGroup updates a permission group
+// @Summary Update permission group
+// @Description Replace the name, permissions and scope of a permission group; members are kept
+// @Tags permission-groups
+// @Accept json
+// @Produce json
+// @Param groupId path int true "Permission group ID"
+// @Param request body PermissionGroupRequest true "Permission group"
+// @Success 200 {object} SuccessResponse{data=PermissionGroup}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /permission-groups/{groupId} [put]
+func UpdatePermissionGroup(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	groupID, err := strconv.Atoi(c.Params("groupId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid permission group ID format")
+	}
+
+	var req PermissionGroupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	var companyID int
+	err = db.DB.QueryRow("SELECT company_id FROM permission_group WHERE id = $1 AND is_active = true", groupID).Scan(&companyID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Permission group not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if err := validatePermissionGroupRequest(&req, companyID); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM permission_group WHERE company_id = $1 AND LOWER(name) = LOWER($2) AND id <> $3 AND is_active = true)
+	`, companyID, req.Name, groupID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A permission group with this name already exists")
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE permission_group
+		SET name = $1, description = $2, permissions = $3, updated_at = NOW()
+		WHERE id = $4
+	`, req.Name, req.Description, pq.Array(uniqueStrings(req.Permissions)), groupID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update permission group")
+	}
+	if err := replaceGroupScope(tx, groupID, req.HatcheryIDs, req.TankIDs); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save permission group scope")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+
+	group, err := loadPermissionGroup(groupID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load permission group")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Permission group updated successfully",
+		Data:    group,
+	})
+}
+
+// DeletePermissionGroup deactivates a permission group
+// @Summary Delete permission group
+// @Description Deactivate a permission group. Members that are in no other group get back the access of their role
+// @Tags permission-groups
+// @Produce json
+// @Param groupId path int true "Permission group ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /permission-groups/{groupId} [delete]
+func DeletePermissionGroup(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	groupID, err := strconv.Atoi(c.Params("groupId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid permission group ID format")
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE permission_group SET is_active = false, updated_at = NOW()
+		WHERE id = $1 AND is_active = true
+	`, groupID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete permission group")
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Permission group not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Permission group deleted successfully",
+	})
+}
+
+// AddPermissionGroupMember adds a user to a permission group
+// @Summary Add permission group member
+// @Description Add a user of the group's company to a permission group. From then on the user may only change batches and tanks covered by their groups
+// @Tags permission-groups
+// @Accept json
+// @Produce json
+// @Param groupId path int true "Permission group ID"
+// @Param request body AddGroupMemberRequest true "Member"
+// @Success 201 {object} SuccessResponse{data=[]PermissionGroupMember}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /permission-groups/{groupId}/members [post]
+func AddPermissionGroupMember(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	groupID, err := strconv.Atoi(c.Params("groupId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid permission group ID format")
+	}
+
+	var req AddGroupMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.UserID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "User ID is required")
+	}
+
+	var groupCompanyID int
+	err = db.DB.QueryRow("SELECT company_id FROM permission_group WHERE id = $1 AND is_active = true", groupID).Scan(&groupCompanyID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Permission group not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	var userCompanyID sql.NullInt64
+	err = db.DB.QueryRow("SELECT company_id FROM account WHERE id = $1 AND is_active = true", req.UserID).Scan(&userCompanyID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "User not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if int(userCompanyID.Int64) != groupCompanyID {
+		return fiber.NewError(fiber.StatusBadRequest, "User does not belong to the group's company")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	result, err := db.DB.Exec(`
+		INSERT INTO permission_group_member (group_id, account_id, added_by, added_at)
+		VALUES ($1, $2, NULLIF($3, 0), NOW())
+		ON CONFLICT (group_id, account_id) DO NOTHING
+	`, groupID, req.UserID, userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add member")
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusConflict, "User is already a member of this group")
+	}
+
+	members, err := loadGroupMembers(groupID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load members")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Member added successfully",
+		Data:    members,
+	})
+}
+
+// RemovePermissionGroupMember removes a user from a permission group
+// @Summary Remove permission group member
+// @Description Remove a user from a permission group
+// @Tags permission-groups
+// @Produce json
+// @Param groupId path int true "Permission group ID"
+// @Param userId path int true "User ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /permission-groups/{groupId}/members/{userId} [delete]
+func RemovePermissionGroupMember(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	groupID, err := strconv.Atoi(c.Params("groupId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid permission group ID format")
+	}
+	memberID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID format")
+	}
+
+	result, err := db.DB.Exec("DELETE FROM permission_group_member WHERE group_id = $1 AND account_id = $2", groupID, memberID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to remove member")
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "User is not a member of this group")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Member removed successfully",
+	})
+}
@@ -0,0 +1,402 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/components"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/digest"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+)
+
+// Channels a user can receive notifications on
+const (
+	NotificationChannelEmail = "email"
+	NotificationChannelSMS   = "sms"
+	NotificationChannelPush  = "push"
+	NotificationChannelInApp = "in_app"
+)
+
+// TableLayout is the saved column layout of a table view in the web app
+type TableLayout struct {
+	Columns  []string `json:"columns"`
+	SortBy   string   `json:"sort_by,omitempty"`
+	SortDesc bool     `json:"sort_desc,omitempty"`
+	PageSize int      `json:"page_size,omitempty"`
+}
+
+// UserPreferences are a user's saved settings
+type UserPreferences struct {
+	Language             string                        `json:"language"` // UI language, used for translated messages
+	Display              middleware.DisplayPreferences `json:"display"`  // Response formatting defaults
+	NotificationChannels map[string]bool               `json:"notification_channels"`
+	DefaultHatcheryID    *int                          `json:"default_hatchery_id,omitempty"`
+	TableLayouts         map[string]TableLayout        `json:"table_layouts"`    // Keyed by view name, e.g. batches, shipments
+	DigestFrequency      string                        `json:"digest_frequency"` // daily, weekly or empty when not subscribed
+	UpdatedAt            *time.Time                    `json:"updated_at,omitempty"`
+}
+
+// UpdatePreferencesRequest updates the given settings and leaves the others as they are
+type UpdatePreferencesRequest struct {
+	Language             *string                        `json:"language"`
+	Display              *middleware.DisplayPreferences `json:"display"`
+	NotificationChannels map[string]bool                `json:"notification_channels"` // Merged into the saved channels
+	DefaultHatcheryID    *int                           `json:"default_hatchery_id"`   // 0 clears the default
+	DigestFrequency      *string                        `json:"digest_frequency"`      // daily, weekly or "" to unsubscribe
+}
+
+// defaultNotificationChannels apply until the user changes them
+var defaultNotificationChannels = map[string]bool{
+	NotificationChannelEmail: true,
+	NotificationChannelSMS:   false,
+	NotificationChannelPush:  false,
+	NotificationChannelInApp: true,
+}
+
+// loadUserPreferences reads a user's preferences, falling back to the defaults for anything not saved
+func loadUserPreferences(userID int) (UserPreferences, error) {
+	prefs := UserPreferences{
+		Language:             middleware.LangEN,
+		Display:              middleware.DisplayPreferences{UnitSystem: utils.UnitSystemMetric},
+		NotificationChannels: map[string]bool{},
+		TableLayouts:         map[string]TableLayout{},
+	}
+	for channel, enabled := range defaultNotificationChannels {
+		prefs.NotificationChannels[channel] = enabled
+	}
+
+	var language, locale, unitSystem, timezone, digestFrequency sql.NullString
+	var localized sql.NullBool
+	var channels, layouts []byte
+	var defaultHatcheryID sql.NullInt64
+	var updatedAt time.Time
+	err := db.DB.QueryRow(`
+		SELECT language, locale, unit_system, timezone, localized_display, notification_channels,
+			default_hatchery_id, table_layouts, digest_frequency, updated_at
+		FROM user_preference WHERE account_id = $1
+	`, userID).Scan(&language, &locale, &unitSystem, &timezone, &localized, &channels,
+		&defaultHatcheryID, &layouts, &digestFrequency, &updatedAt)
+	if err == sql.ErrNoRows {
+		return prefs, nil
+	}
+	if err != nil {
+		return prefs, err
+	}
+
+	if language.String != "" {
+		prefs.Language = language.String
+	}
+	prefs.Display.Locale = locale.String
+	if unitSystem.String != "" {
+		prefs.Display.UnitSystem = unitSystem.String
+	}
+	prefs.Display.Timezone = timezone.String
+	prefs.Display.Localized = localized.Bool
+	if err := json.Unmarshal(channels, &prefs.NotificationChannels); err != nil {
+		return prefs, err
+	}
+	if err := json.Unmarshal(layouts, &prefs.TableLayouts); err != nil {
+		return prefs, err
+	}
+	prefs.DefaultHatcheryID = intPtr(defaultHatcheryID)
+	prefs.DigestFrequency = digestFrequency.String
+	prefs.UpdatedAt = &updatedAt
+	return prefs, nil
+}
+
+// LoadDisplayPreferences reads a user's response formatting preferences for the formatting middleware
+func LoadDisplayPreferences(userID int) (middleware.DisplayPreferences, bool) {
+	var prefs middleware.DisplayPreferences
+	var language, locale, unitSystem, timezone sql.NullString
+	var localized sql.NullBool
+	err := db.DB.QueryRow(`
+		SELECT language, locale, unit_system, timezone, localized_display FROM user_preference WHERE account_id = $1
+	`, userID).Scan(&language, &locale, &unitSystem, &timezone, &localized)
+	if err != nil {
+		return prefs, false
+	}
+	// Numbers and dates follow the UI language unless a display locale is set
+	prefs.Locale = locale.String
+	if prefs.Locale == "" {
+		prefs.Locale = language.String
+	}
+	prefs.UnitSystem = unitSystem.String
+	prefs.Timezone = timezone.String
+	prefs.Localized = localized.Bool
+	return prefs, true
+}
+
+// LoadPreferredLanguage reads a user's UI language for the i18n middleware
+func LoadPreferredLanguage(userID int) string {
+	var language sql.NullString
+	if err := db.DB.QueryRow("SELECT language FROM user_preference WHERE account_id = $1", userID).Scan(&language); err != nil {
+		return ""
+	}
+	return language.String
+}
+
+// currentUserID reads the authenticated user from the context
+func currentUserID(c *fiber.Ctx) (int, error) {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return 0, fiber.NewError(fiber.StatusUnauthorized, "Invalid token")
+	}
+	return userID, nil
+}
+
+// GetUserPreferences returns the current user's preferences
+// @Summary Get preferences
+// @Description Get the current user's language, display formatting defaults, notification channels, default hatchery, table layouts and digest email frequency. Display request headers (Accept-Language, X-Unit-System, X-Timezone, X-Localized-Display) override the display defaults per request.
+// @Tags users
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=UserPreferences}
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/me/preferences [get]
+func GetUserPreferences(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	prefs, err := loadUserPreferences(userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load preferences")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Preferences retrieved successfully",
+		Data:    prefs,
+	})
+}
+
+// UpdateUserPreferences saves the current user's preferences
+// @Summary Update preferences
+// @Description Update the current user's preferences; settings left out of the request keep their saved values. A new language is also remembered by the language selector.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body UpdatePreferencesRequest true "Preferences to change"
+// @Success 200 {object} SuccessResponse{data=UserPreferences}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/me/preferences [put]
+func UpdateUserPreferences(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req UpdatePreferencesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	prefs, err := loadUserPreferences(userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load preferences")
+	}
+
+	if req.Language != nil {
+		if !middleware.IsSupportedLanguage(*req.Language) {
+			return fiber.NewError(fiber.StatusBadRequest, "Unsupported language")
+		}
+		prefs.Language = *req.Language
+	}
+	if req.Display != nil {
+		display := *req.Display
+		if display.UnitSystem == "" {
+			display.UnitSystem = utils.UnitSystemMetric
+		}
+		if display.UnitSystem != utils.UnitSystemMetric && display.UnitSystem != utils.UnitSystemImperial {
+			return fiber.NewError(fiber.StatusBadRequest, "Unit system must be metric or imperial")
+		}
+		if display.Locale != "" && !utils.SupportedLocale(display.Locale) {
+			return fiber.NewError(fiber.StatusBadRequest, "Unsupported locale")
+		}
+		if display.Timezone != "" {
+			if _, err := time.LoadLocation(display.Timezone); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "Unknown time zone, expected an IANA name such as Asia/Ho_Chi_Minh")
+			}
+		}
+		prefs.Display = display
+	}
+	for channel, enabled := range req.NotificationChannels {
+		if _, ok := defaultNotificationChannels[channel]; !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "Notification channel must be email, sms, push or in_app")
+		}
+		prefs.NotificationChannels[channel] = enabled
+	}
+	if req.DefaultHatcheryID != nil {
+		prefs.DefaultHatcheryID = nil
+		if *req.DefaultHatcheryID != 0 {
+			// Users of a company can only default to one of its hatcheries
+			var exists bool
+			err := db.DB.QueryRow(`
+				SELECT EXISTS(
+					SELECT 1 FROM hatchery h JOIN account a ON a.id = $2
+					WHERE h.id = $1 AND h.is_active = true AND (a.company_id IS NULL OR a.role = 'admin' OR h.company_id = a.company_id)
+				)
+			`, *req.DefaultHatcheryID, userID).Scan(&exists)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+			}
+			if !exists {
+				return fiber.NewError(fiber.StatusNotFound, "Hatchery not found")
+			}
+			prefs.DefaultHatcheryID = req.DefaultHatcheryID
+		}
+	}
+	if req.DigestFrequency != nil {
+		if *req.DigestFrequency != "" && !digest.IsFrequency(*req.DigestFrequency) {
+			return fiber.NewError(fiber.StatusBadRequest, "Digest frequency must be daily, weekly or empty")
+		}
+		prefs.DigestFrequency = *req.DigestFrequency
+	}
+
+	if err := saveUserPreferences(userID, &prefs); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save preferences")
+	}
+	if req.Language != nil {
+		c.Cookie(&fiber.Cookie{
+			Name:     components.LanguageCookieName,
+			Value:    prefs.Language,
+			MaxAge:   30 * 24 * 60 * 60,
+			Path:     "/",
+			HTTPOnly: true,
+			SameSite: "Lax",
+		})
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Preferences updated successfully",
+		Data:    prefs,
+	})
+}
+
+// saveUserPreferences writes every setting of a user's preferences
+func saveUserPreferences(userID int, prefs *UserPreferences) error {
+	channels, err := json.Marshal(prefs.NotificationChannels)
+	if err != nil {
+		return err
+	}
+	layouts, err := json.Marshal(prefs.TableLayouts)
+	if err != nil {
+		return err
+	}
+
+	var updatedAt time.Time
+	err = db.DB.QueryRow(`
+		INSERT INTO user_preference (account_id, language, locale, unit_system, timezone, localized_display,
+			notification_channels, default_hatchery_id, table_layouts, digest_frequency, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), $6, $7, $8, $9, NULLIF($10, ''), NOW())
+		ON CONFLICT (account_id) DO UPDATE SET
+			language = EXCLUDED.language, locale = EXCLUDED.locale, unit_system = EXCLUDED.unit_system,
+			timezone = EXCLUDED.timezone, localized_display = EXCLUDED.localized_display,
+			notification_channels = EXCLUDED.notification_channels, default_hatchery_id = EXCLUDED.default_hatchery_id,
+			table_layouts = EXCLUDED.table_layouts, digest_frequency = EXCLUDED.digest_frequency, updated_at = NOW()
+		RETURNING updated_at
+	`, userID, prefs.Language, prefs.Display.Locale, prefs.Display.UnitSystem, prefs.Display.Timezone, prefs.Display.Localized,
+		string(channels), prefs.DefaultHatcheryID, string(layouts), prefs.DigestFrequency).Scan(&updatedAt)
+	if err != nil {
+		return err
+	}
+	prefs.UpdatedAt = &updatedAt
+	return nil
+}
+
+// SaveTableLayout saves the column layout of one table view
+// @Summary Save table layout
+// @Description Save the columns, sort order and page size the current user wants for a table view
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param view path string true "View name, e.g. batches"
+// @Param request body TableLayout true "Table layout"
+// @Success 200 {object} SuccessResponse{data=UserPreferences}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/me/preferences/layouts/{view} [put]
+func SaveTableLayout(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	view := c.Params("view")
+	if view == "" || len(view) > 64 {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid view name")
+	}
+
+	var layout TableLayout
+	if err := c.BodyParser(&layout); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if len(layout.Columns) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one column is required")
+	}
+	if layout.PageSize < 0 || layout.PageSize > 500 {
+		return fiber.NewError(fiber.StatusBadRequest, "Page size cannot exceed 500")
+	}
+
+	prefs, err := loadUserPreferences(userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load preferences")
+	}
+	prefs.TableLayouts[view] = layout
+	if err := saveUserPreferences(userID, &prefs); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save preferences")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Table layout saved successfully",
+		Data:    prefs,
+	})
+}
+
+// ResetTableLayout removes the saved layout of a table view
+// @Summary Reset table layout
+// @Description Remove the current user's saved layout of a table view so the app default applies
+// @Tags users
+// @Produce json
+// @Param view path string true "View name, e.g. batches"
+// @Success 200 {object} SuccessResponse{data=UserPreferences}
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/me/preferences/layouts/{view} [delete]
+func ResetTableLayout(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	view := c.Params("view")
+
+	prefs, err := loadUserPreferences(userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load preferences")
+	}
+	if _, ok := prefs.TableLayouts[view]; !ok {
+		return fiber.NewError(fiber.StatusNotFound, "No saved layout for this view")
+	}
+	delete(prefs.TableLayouts, view)
+	if err := saveUserPreferences(userID, &prefs); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save preferences")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Table layout reset successfully",
+		Data:    prefs,
+	})
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Machine-readable error codes returned in the code member of every error response.
+// They are part of the API contract: clients switch on them, so existing codes never change
+const (
+	CodeValidation            = "validation"             // the request is malformed or fails validation
+	CodeUnauthorized          = "unauthorized"           // authentication is missing or invalid
+	CodeForbidden             = "forbidden"              // the caller may not perform the action
+	CodeNotFound              = "not_found"              // the resource does not exist
+	CodeConflict              = "conflict"               // the request conflicts with the current state of the resource
+	CodeRateLimited           = "rate_limited"           // the caller sent too many requests
+	CodeDependencyUnavailable = "dependency_unavailable" // a database, storage or external service is unavailable
+	CodeBlockchainFailure     = "blockchain_failure"     // the blockchain node or an external chain failed
+	CodeDataResidency         = "data_residency"         // the data must be stored and served in another region
+	CodeInternal              = "internal"               // an unexpected server error
+)
+
+// problemTypeBase prefixes the code to build the RFC 7807 type URI of a problem
+const problemTypeBase = "https://api.tracepost.vn/problems/"
+
+// problemTitles are the short human-readable summaries of each code
+var problemTitles = map[string]string{
+	CodeValidation:            "The request is invalid",
+	CodeUnauthorized:          "Authentication is required",
+	CodeForbidden:             "Access is denied",
+	CodeNotFound:              "The resource was not found",
+	CodeConflict:              "The request conflicts with the current state of the resource",
+	CodeRateLimited:           "Too many requests",
+	CodeDependencyUnavailable: "A dependency is unavailable",
+	CodeBlockchainFailure:     "The blockchain operation failed",
+	CodeDataResidency:         "The data must stay in its residency region",
+	CodeInternal:              "An unexpected error occurred",
+}
+
+// APIError is an error with an explicit code; handlers return it when the HTTP status alone
+// does not say what went wrong, e.g. a 500 caused by the blockchain rather than a bug
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Err     error
+}
+
+// Error returns the message followed by the cause, if any
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the cause of the error
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// NewAPIError creates an error with an explicit status and code
+func NewAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+// blockchainErrors maps the domain errors of the blockchain layer to the status and code they are reported with
+var blockchainErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{blockchain.ErrNetworkNotConfigured, fiber.StatusNotFound, CodeNotFound},
+	{blockchain.ErrTxNotFound, fiber.StatusNotFound, CodeNotFound},
+	{blockchain.ErrBridgeMissing, fiber.StatusNotFound, CodeNotFound},
+	{blockchain.ErrChannelNotFound, fiber.StatusNotFound, CodeNotFound},
+	{blockchain.ErrMessageNotFound, fiber.StatusNotFound, CodeNotFound},
+	{blockchain.ErrDIDNotFound, fiber.StatusNotFound, CodeNotFound},
+	{blockchain.ErrKeyNotFound, fiber.StatusNotFound, CodeNotFound},
+	{blockchain.ErrValidatorNotFound, fiber.StatusNotFound, CodeNotFound},
+	{blockchain.ErrAssetNotRegistered, fiber.StatusNotFound, CodeNotFound},
+	{blockchain.ErrNoRoute, fiber.StatusBadRequest, CodeValidation},
+	{blockchain.ErrCapabilityUnsupported, fiber.StatusBadRequest, CodeValidation},
+	{blockchain.ErrBudgetExceeded, fiber.StatusPaymentRequired, CodeForbidden},
+	{blockchain.ErrContractViolation, fiber.StatusBadGateway, CodeBlockchainFailure},
+}
+
+// classifyBlockchainError returns the status and code of a blockchain domain error
+func classifyBlockchainError(err error) (int, string, bool) {
+	for _, known := range blockchainErrors {
+		if errors.Is(err, known.err) {
+			return known.status, known.code, true
+		}
+	}
+	return 0, "", false
+}
+
+// blockchainFailure reports a failed call to the blockchain node or an external chain. Domain errors of the
+// blockchain layer keep their own status, e.g. an unknown network is a 404 rather than a failure
+func blockchainFailure(message string, err error) error {
+	if status, code, ok := classifyBlockchainError(err); ok {
+		return &APIError{Status: status, Code: code, Message: message, Err: err}
+	}
+	return &APIError{Status: fiber.StatusInternalServerError, Code: CodeBlockchainFailure, Message: message, Err: err}
+}
+
+// dependencyUnavailable reports a database, storage or external service that cannot be reached
+func dependencyUnavailable(message string, err error) error {
+	return &APIError{Status: fiber.StatusServiceUnavailable, Code: CodeDependencyUnavailable, Message: message, Err: err}
+}
+
+// codeForStatus returns the code of an error that only carries an HTTP status
+func codeForStatus(status int) string {
+	switch status {
+	case fiber.StatusBadRequest, fiber.StatusUnprocessableEntity, fiber.StatusRequestEntityTooLarge,
+		fiber.StatusUnsupportedMediaType, fiber.StatusMethodNotAllowed:
+		return CodeValidation
+	case fiber.StatusUnauthorized:
+		return CodeUnauthorized
+	case fiber.StatusForbidden, fiber.StatusPaymentRequired:
+		return CodeForbidden
+	case fiber.StatusNotFound, fiber.StatusGone:
+		return CodeNotFound
+	case fiber.StatusConflict, fiber.StatusPreconditionFailed:
+		return CodeConflict
+	case fiber.StatusTooManyRequests:
+		return CodeRateLimited
+	case fiber.StatusBadGateway, fiber.StatusServiceUnavailable, fiber.StatusGatewayTimeout:
+		return CodeDependencyUnavailable
+	}
+	return CodeInternal
+}
+
+// classifyError returns the status, code and detail of any error returned by a handler
+func classifyError(err error) (int, string, string) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status, apiErr.Code, apiErr.Error()
+	}
+	var misdirected *db.NotHomeRegionError
+	if errors.As(err, &misdirected) {
+		return fiber.StatusMisdirectedRequest, CodeConflict, "The record can only be changed in its home region " + misdirected.Home
+	}
+	if status, code, ok := classifyBlockchainError(err); ok {
+		return status, code, err.Error()
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code, codeForStatus(fiberErr.Code), fiberErr.Message
+	}
+	return fiber.StatusInternalServerError, CodeInternal, err.Error()
+}
+
+// ErrorStatus returns the status the error handler responds to an error with, for middleware recording it before the handler runs
+func ErrorStatus(err error) int {
+	status, _, _ := classifyError(err)
+	return status
+}
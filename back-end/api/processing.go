@@ -0,0 +1,578 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Processing steps a processor can record
+const (
+	ProcessTypePeeling     = "peeling"
+	ProcessTypeCooking     = "cooking"
+	ProcessTypeFreezing    = "freezing"
+	ProcessTypeDrying      = "drying"
+	ProcessTypeFeedMilling = "feed_milling"
+	ProcessTypeOther       = "other"
+)
+
+// Flags raised on processing runs with suspicious yields
+const (
+	YieldFlagBelowExpected   = "yield_below_expected"
+	YieldFlagAboveExpected   = "yield_above_expected"
+	YieldFlagOutputOverInput = "output_exceeds_input" // Within tolerance, but more came out than went in
+)
+
+// EventTypeProcessingRun is the batch event recorded when a batch is used as processing input
+const EventTypeProcessingRun = "processing_run"
+
+// Mass balance tolerance, as a percentage of the input weight
+const (
+	defaultYieldTolerancePercent = 2.0
+	maxYieldTolerancePercent     = 10.0
+)
+
+// yieldRange is the expected output/input percentage of a processing step
+type yieldRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// expectedYields are typical yields per processing step; runs outside the range are flagged for review
+var expectedYields = map[string]yieldRange{
+	ProcessTypePeeling:     {Min: 55, Max: 75},
+	ProcessTypeCooking:     {Min: 80, Max: 95},
+	ProcessTypeFreezing:    {Min: 95, Max: 102},
+	ProcessTypeDrying:      {Min: 15, Max: 35},
+	ProcessTypeFeedMilling: {Min: 85, Max: 100},
+}
+
+// ProcessingRun records input batches turned into output lots by a processing step
+type ProcessingRun struct {
+	ID               int                `json:"id"`
+	CompanyID        int                `json:"company_id"`
+	ProcessType      string             `json:"process_type"`
+	ProcessedAt      time.Time          `json:"processed_at"`
+	Location         string             `json:"location"`
+	InputKg          float64            `json:"input_kg"`
+	OutputKg         float64            `json:"output_kg"`
+	YieldPercent     float64            `json:"yield_percent"`
+	TolerancePercent float64            `json:"tolerance_percent"`
+	Flags            []string           `json:"flags"`
+	Notes            string             `json:"notes"`
+	RecordedBy       *int               `json:"recorded_by,omitempty"`
+	CreatedAt        time.Time          `json:"created_at"`
+	Inputs           []ProcessingInput  `json:"inputs,omitempty"`
+	Outputs          []ProcessingOutput `json:"outputs,omitempty"`
+}
+
+// ProcessingInput is a batch consumed by a processing run
+type ProcessingInput struct {
+	BatchID    int     `json:"batch_id"`
+	QuantityKg float64 `json:"quantity_kg"`
+}
+
+// ProcessingOutput is an output lot of a processing run, recorded as a derived product
+type ProcessingOutput struct {
+	ProductID  int     `json:"product_id"`
+	LotNumber  string  `json:"lot_number"`
+	QuantityKg float64 `json:"quantity_kg"`
+}
+
+// ProcessingOutputRequest describes an output lot; it becomes a derived product made from the input batches
+type ProcessingOutputRequest struct {
+	ProductName       string    `json:"product_name"`
+	ProductType       string    `json:"product_type"`
+	LotNumber         string    `json:"lot_number"`
+	QuantityKg        float64   `json:"quantity_kg"`
+	ExpiryDate        time.Time `json:"expiry_date"`
+	StorageConditions string    `json:"storage_conditions"`
+}
+
+// ProcessingRunRequest represents a request to record a processing run
+type ProcessingRunRequest struct {
+	CompanyID        int                       `json:"company_id"`
+	ProcessType      string                    `json:"process_type"`
+	ProcessedAt      *time.Time                `json:"processed_at"` // Defaults to now
+	Location         string                    `json:"location"`
+	TolerancePercent *float64                  `json:"tolerance_percent"` // Defaults to 2%
+	Inputs           []ProcessingInput         `json:"inputs"`
+	Outputs          []ProcessingOutputRequest `json:"outputs"`
+	Notes            string                    `json:"notes"`
+}
+
+// YieldSummary aggregates the runs of one processing step
+type YieldSummary struct {
+	ProcessType         string      `json:"process_type"`
+	Runs                int         `json:"runs"`
+	InputKg             float64     `json:"input_kg"`
+	OutputKg            float64     `json:"output_kg"`
+	AverageYieldPercent float64     `json:"average_yield_percent"` // Weighted by input
+	ExpectedRange       *yieldRange `json:"expected_range,omitempty"`
+	FlaggedRuns         int         `json:"flagged_runs"`
+}
+
+// YieldReport summarises processing yields and lists the runs flagged as suspicious
+type YieldReport struct {
+	From        *time.Time      `json:"from,omitempty"`
+	To          *time.Time      `json:"to,omitempty"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Summary     []YieldSummary  `json:"summary"`
+	FlaggedRuns []ProcessingRun `json:"flagged_runs"`
+}
+
+const processingRunColumns = `
+	id, company_id, process_type, processed_at, COALESCE(location, ''), input_kg, output_kg, yield_percent,
+	tolerance_percent, COALESCE(flags, '{}'), COALESCE(notes, ''), recorded_by, created_at
+`
+
+// scanProcessingRun reads a run selected with processingRunColumns
+func scanProcessingRun(row rowScanner) (ProcessingRun, error) {
+	var r ProcessingRun
+	var recordedBy sql.NullInt64
+	err := row.Scan(&r.ID, &r.CompanyID, &r.ProcessType, &r.ProcessedAt, &r.Location, &r.InputKg, &r.OutputKg, &r.YieldPercent,
+		&r.TolerancePercent, pq.Array(&r.Flags), &r.Notes, &recordedBy, &r.CreatedAt)
+	r.RecordedBy = intPtr(recordedBy)
+	return r, err
+}
+
+// queryProcessingRuns runs a processing run query and collects the results
+func queryProcessingRuns(query string, args ...interface{}) ([]ProcessingRun, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []ProcessingRun{}
+	for rows.Next() {
+		run, err := scanProcessingRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// loadProcessingLines fills in the input batches and output lots of a run
+func loadProcessingLines(run *ProcessingRun) error {
+	rows, err := db.DB.Query(`SELECT batch_id, quantity_kg FROM processing_input WHERE run_id = $1 ORDER BY id`, run.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	run.Inputs = []ProcessingInput{}
+	for rows.Next() {
+		var input ProcessingInput
+		if err := rows.Scan(&input.BatchID, &input.QuantityKg); err != nil {
+			return err
+		}
+		run.Inputs = append(run.Inputs, input)
+	}
+
+	outputRows, err := db.DB.Query(`
+		SELECT o.product_id, COALESCE(p.lot_number, ''), o.quantity_kg
+		FROM processing_output o JOIN derived_product p ON p.id = o.product_id
+		WHERE o.run_id = $1 ORDER BY o.id
+	`, run.ID)
+	if err != nil {
+		return err
+	}
+	defer outputRows.Close()
+	run.Outputs = []ProcessingOutput{}
+	for outputRows.Next() {
+		var output ProcessingOutput
+		if err := outputRows.Scan(&output.ProductID, &output.LotNumber, &output.QuantityKg); err != nil {
+			return err
+		}
+		run.Outputs = append(run.Outputs, output)
+	}
+	return nil
+}
+
+// checkMassBalance computes the yield of a run, rejects outputs that exceed the inputs beyond the
+// tolerance and flags yields outside the range expected for the processing step
+func checkMassBalance(processType string, inputKg, outputKg, tolerancePercent float64) (float64, []string, error) {
+	if inputKg <= 0 {
+		return 0, nil, fmt.Errorf("input weight must be positive")
+	}
+	yield := math.Round(outputKg/inputKg*10000) / 100
+	limit := inputKg * (1 + tolerancePercent/100)
+	if outputKg > limit {
+		return yield, nil, fmt.Errorf("outputs of %.2f kg exceed inputs of %.2f kg beyond the %.1f%% tolerance", outputKg, inputKg, tolerancePercent)
+	}
+
+	flags := []string{}
+	if outputKg > inputKg {
+		flags = append(flags, YieldFlagOutputOverInput)
+	}
+	if expected, ok := expectedYields[processType]; ok {
+		if yield < expected.Min {
+			flags = append(flags, YieldFlagBelowExpected)
+		} else if yield > expected.Max {
+			flags = append(flags, YieldFlagAboveExpected)
+		}
+	}
+	return yield, flags, nil
+}
+
+// CreateProcessingRun records a processing run
+// @Summary Record processing run
+// @Description Record input batches processed into output lots. Outputs are checked against inputs (mass balance), each output lot is recorded as a derived product made from the input batches, and yields outside the range expected for the step are flagged.
+// @Tags processing
+// @Accept json
+// @Produce json
+// @Param request body ProcessingRunRequest true "Processing run"
+// @Success 201 {object} SuccessResponse{data=ProcessingRun}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /processing/runs [post]
+func CreateProcessingRun(c *fiber.Ctx) error {
+	var req ProcessingRunRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.CompanyID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Company ID is required")
+	}
+	switch req.ProcessType {
+	case ProcessTypePeeling, ProcessTypeCooking, ProcessTypeFreezing, ProcessTypeDrying, ProcessTypeFeedMilling, ProcessTypeOther:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Process type must be peeling, cooking, freezing, drying, feed_milling or other")
+	}
+	if len(req.Inputs) == 0 || len(req.Outputs) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one input batch and one output lot are required")
+	}
+	tolerance := defaultYieldTolerancePercent
+	if req.TolerancePercent != nil {
+		tolerance = *req.TolerancePercent
+	}
+	if tolerance < 0 || tolerance > maxYieldTolerancePercent {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Tolerance must be between 0 and %.0f percent", maxYieldTolerancePercent))
+	}
+	processedAt := time.Now()
+	if req.ProcessedAt != nil {
+		processedAt = *req.ProcessedAt
+	}
+
+	var exists bool
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", req.CompanyID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+
+	var inputKg, outputKg float64
+	seen := map[int]bool{}
+	for _, input := range req.Inputs {
+		if input.BatchID <= 0 || seen[input.BatchID] {
+			return fiber.NewError(fiber.StatusBadRequest, "Input batches must be distinct valid batch IDs")
+		}
+		seen[input.BatchID] = true
+		if input.QuantityKg <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "Input quantities must be positive")
+		}
+		inputKg += input.QuantityKg
+
+		var recalled bool
+		err := db.DB.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM batch_recall WHERE batch_id = b.id AND lifted_at IS NULL)
+			FROM batch b WHERE b.id = $1 AND b.is_active = true
+		`, input.BatchID).Scan(&recalled)
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Input batch #%d not found", input.BatchID))
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if recalled {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Input batch #%d is under recall", input.BatchID))
+		}
+	}
+	for _, output := range req.Outputs {
+		if output.ProductName == "" || output.ProductType == "" || output.LotNumber == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Output lots need a product name, product type and lot number")
+		}
+		if output.QuantityKg <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "Output quantities must be positive")
+		}
+		if !output.ExpiryDate.After(processedAt) {
+			return fiber.NewError(fiber.StatusBadRequest, "Output expiry dates must be after the processing date")
+		}
+		outputKg += output.QuantityKg
+	}
+
+	yield, flags, err := checkMassBalance(req.ProcessType, inputKg, outputKg, tolerance)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "Mass balance check failed: "+err.Error())
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	userID, _ := c.Locals("userID").(int)
+	var runID int
+	err = tx.QueryRow(`
+		INSERT INTO processing_run (company_id, process_type, processed_at, location, input_kg, output_kg, yield_percent,
+			tolerance_percent, flags, notes, recorded_by, created_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, 0), NOW(), true)
+		RETURNING id
+	`, req.CompanyID, req.ProcessType, processedAt, req.Location, inputKg, outputKg, yield,
+		tolerance, pq.Array(flags), req.Notes, userID).Scan(&runID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record processing run")
+	}
+	for _, input := range req.Inputs {
+		_, err = tx.Exec(`INSERT INTO processing_input (run_id, batch_id, quantity_kg) VALUES ($1, $2, $3)`, runID, input.BatchID, input.QuantityKg)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to record processing input")
+		}
+	}
+	for _, output := range req.Outputs {
+		var productID int
+		err = tx.QueryRow(`
+			INSERT INTO derived_product (company_id, product_name, product_type, lot_number, quantity, unit,
+				production_date, expiry_date, storage_conditions, created_by, created_at, updated_at, is_active)
+			VALUES ($1, $2, $3, $4, $5, 'kg', $6, $7, $8, NULLIF($9, 0), NOW(), NOW(), true)
+			RETURNING id
+		`, req.CompanyID, output.ProductName, output.ProductType, output.LotNumber, output.QuantityKg,
+			processedAt, output.ExpiryDate, output.StorageConditions, userID).Scan(&productID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to record output lot")
+		}
+		// Each input batch contributes to each lot in proportion to the lot's share of the output
+		for _, input := range req.Inputs {
+			_, err = tx.Exec(`
+				INSERT INTO derived_product_source (product_id, batch_id, quantity_used) VALUES ($1, $2, $3)
+			`, productID, input.BatchID, input.QuantityKg*output.QuantityKg/outputKg)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to link output lot to input batch")
+			}
+		}
+		_, err = tx.Exec(`INSERT INTO processing_output (run_id, product_id, quantity_kg) VALUES ($1, $2, $3)`, runID, productID, output.QuantityKg)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to record processing output")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+
+	run, err := scanProcessingRun(db.DB.QueryRow(`SELECT `+processingRunColumns+` FROM processing_run WHERE id = $1`, runID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Processing run recorded but failed to retrieve details")
+	}
+	if err := loadProcessingLines(&run); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load processing inputs and outputs")
+	}
+
+	for _, input := range run.Inputs {
+		metadata, _ := json.Marshal(map[string]interface{}{
+			"processing_run_id": run.ID,
+			"process_type":      run.ProcessType,
+			"input_kg":          input.QuantityKg,
+			"run_input_kg":      run.InputKg,
+			"run_output_kg":     run.OutputKg,
+			"yield_percent":     run.YieldPercent,
+			"outputs":           run.Outputs,
+			"flags":             run.Flags,
+		})
+		_, err = db.DB.Exec(`
+			INSERT INTO event (batch_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active)
+			VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, NOW(), true)
+		`, input.BatchID, EventTypeProcessingRun, userID, run.Location, run.ProcessedAt, metadata)
+		if err != nil {
+			fmt.Printf("Warning: Failed to record processing event for batch %d: %v\n", input.BatchID, err)
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Processing run recorded successfully",
+		Data:    run,
+	})
+}
+
+// ListProcessingRuns lists processing runs
+// @Summary List processing runs
+// @Description List processing runs, newest first, optionally filtered by company, process type or flagged yields
+// @Tags processing
+// @Produce json
+// @Param company_id query int false "Filter by company ID"
+// @Param process_type query string false "Filter by process type"
+// @Param flagged query bool false "Only runs with suspicious yields"
+// @Success 200 {object} SuccessResponse{data=[]ProcessingRun}
+// @Failure 500 {object} ErrorResponse
+// @Router /processing/runs [get]
+func ListProcessingRuns(c *fiber.Ctx) error {
+	runs, err := queryProcessingRuns(`SELECT `+processingRunColumns+`
+		FROM processing_run
+		WHERE is_active = true AND ($1::int = 0 OR company_id = $1) AND ($2::text = '' OR process_type = $2)
+			AND (NOT $3::bool OR cardinality(flags) > 0)
+		ORDER BY processed_at DESC, id DESC
+	`, c.QueryInt("company_id", 0), c.Query("process_type"), c.QueryBool("flagged", false))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve processing runs")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Processing runs retrieved successfully",
+		Data:    runs,
+	})
+}
+
+// GetProcessingRun retrieves a processing run with its inputs and outputs
+// @Summary Get processing run
+// @Description Retrieve a processing run with its input batches and output lots
+// @Tags processing
+// @Produce json
+// @Param runId path int true "Processing run ID"
+// @Success 200 {object} SuccessResponse{data=ProcessingRun}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /processing/runs/{runId} [get]
+func GetProcessingRun(c *fiber.Ctx) error {
+	runID, err := strconv.Atoi(c.Params("runId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid processing run ID format")
+	}
+
+	run, err := scanProcessingRun(db.DB.QueryRow(`SELECT `+processingRunColumns+` FROM processing_run WHERE id = $1 AND is_active = true`, runID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Processing run not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if err := loadProcessingLines(&run); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load processing inputs and outputs")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Processing run retrieved successfully",
+		Data:    run,
+	})
+}
+
+// GetYieldReport summarises processing yields and flags suspicious runs
+// @Summary Processing yield report
+// @Description Summarise yields per processing step against the expected ranges and list runs flagged as suspicious
+// @Tags processing
+// @Produce json
+// @Param company_id query int false "Filter by company ID"
+// @Param from query string false "Start of the period (RFC3339)"
+// @Param to query string false "End of the period (RFC3339)"
+// @Success 200 {object} SuccessResponse{data=YieldReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /processing/yield-report [get]
+func GetYieldReport(c *fiber.Ctx) error {
+	report := YieldReport{GeneratedAt: time.Now(), Summary: []YieldSummary{}, FlaggedRuns: []ProcessingRun{}}
+	for param, target := range map[string]**time.Time{"from": &report.From, "to": &report.To} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "Invalid "+param+" date, expected RFC3339")
+			}
+			*target = &t
+		}
+	}
+
+	runs, err := queryProcessingRuns(`SELECT `+processingRunColumns+`
+		FROM processing_run
+		WHERE is_active = true AND ($1::int = 0 OR company_id = $1)
+			AND ($2::timestamp IS NULL OR processed_at >= $2) AND ($3::timestamp IS NULL OR processed_at <= $3)
+		ORDER BY processed_at DESC, id DESC
+	`, c.QueryInt("company_id", 0), report.From, report.To)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve processing runs")
+	}
+
+	summaries := map[string]*YieldSummary{}
+	for _, run := range runs {
+		summary, ok := summaries[run.ProcessType]
+		if !ok {
+			summary = &YieldSummary{ProcessType: run.ProcessType}
+			if expected, ok := expectedYields[run.ProcessType]; ok {
+				summary.ExpectedRange = &expected
+			}
+			summaries[run.ProcessType] = summary
+		}
+		summary.Runs++
+		summary.InputKg += run.InputKg
+		summary.OutputKg += run.OutputKg
+		if len(run.Flags) > 0 {
+			summary.FlaggedRuns++
+			report.FlaggedRuns = append(report.FlaggedRuns, run)
+		}
+	}
+	for _, processType := range []string{ProcessTypePeeling, ProcessTypeCooking, ProcessTypeFreezing, ProcessTypeDrying, ProcessTypeFeedMilling, ProcessTypeOther} {
+		if summary, ok := summaries[processType]; ok {
+			summary.AverageYieldPercent = math.Round(summary.OutputKg/summary.InputKg*10000) / 100
+			report.Summary = append(report.Summary, *summary)
+		}
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Yield report generated successfully",
+		Data:    report,
+	})
+}
+
+// GetBatchProcessingRuns lists the processing runs that used a batch as input
+// @Summary Get batch processing runs
+// @Description List the processing runs that consumed a batch, newest first
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]ProcessingRun}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/processing [get]
+func GetBatchProcessingRuns(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	runs, err := queryProcessingRuns(`SELECT `+processingRunColumns+`
+		FROM processing_run
+		WHERE is_active = true AND id IN (SELECT run_id FROM processing_input WHERE batch_id = $1)
+		ORDER BY processed_at DESC, id DESC
+	`, batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve processing runs")
+	}
+	for i := range runs {
+		if err := loadProcessingLines(&runs[i]); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load processing inputs and outputs")
+		}
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch processing runs retrieved successfully",
+		Data:    runs,
+	})
+}
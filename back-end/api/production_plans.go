@@ -0,0 +1,223 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// ProductionPlanInput is the planned production of one species
+type ProductionPlanInput struct {
+	Species         string `json:"species"`
+	PlannedBatches  int    `json:"planned_batches"`
+	PlannedQuantity int64  `json:"planned_quantity"` // Postlarvae
+	Notes           string `json:"notes"`
+}
+
+// ProductionPlansRequest represents a request to plan the production of a month
+type ProductionPlansRequest struct {
+	Month string                `json:"month"` // YYYY-MM
+	Plans []ProductionPlanInput `json:"plans"`
+}
+
+const productionPlanColumns = `
+	id, COALESCE(hatchery_id, 0), TO_CHAR(month, 'YYYY-MM'), species, planned_batches, planned_quantity,
+	COALESCE(notes, ''), COALESCE(created_by, 0), created_at, updated_at
+`
+
+// scanProductionPlan reads a plan selected with productionPlanColumns
+func scanProductionPlan(row rowScanner) (models.ProductionPlan, error) {
+	var p models.ProductionPlan
+	err := row.Scan(&p.ID, &p.HatcheryID, &p.Month, &p.Species, &p.PlannedBatches, &p.PlannedQuantity,
+		&p.Notes, &p.CreatedBy, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// validateProductionPlan checks the species and planned figures of a plan
+func validateProductionPlan(input *ProductionPlanInput) error {
+	input.Species = strings.TrimSpace(input.Species)
+	if input.Species == "" {
+		return fmt.Errorf("species is required")
+	}
+	if input.PlannedBatches < 0 || input.PlannedQuantity < 0 {
+		return fmt.Errorf("planned batches and quantity must not be negative")
+	}
+	if input.PlannedBatches == 0 && input.PlannedQuantity == 0 {
+		return fmt.Errorf("planned batches or quantity is required")
+	}
+	return nil
+}
+
+// SaveProductionPlans plans the production of a hatchery for a month
+// @Summary Plan production
+// @Description Record the batches and postlarvae a hatchery expects to start in a month per species. A plan replaces the earlier one of the same month and species
+// @Tags hatcheries
+// @Accept json
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param request body ProductionPlansRequest true "Month and plans"
+// @Success 200 {object} SuccessResponse{data=[]models.ProductionPlan}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/production-plans [put]
+func SaveProductionPlans(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+
+	var req ProductionPlansRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	month, err := time.Parse(energyMonthLayout, strings.TrimSpace(req.Month))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid month, use YYYY-MM")
+	}
+	if len(req.Plans) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one plan is required")
+	}
+	seen := map[string]bool{}
+	for i := range req.Plans {
+		if err := validateProductionPlan(&req.Plans[i]); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid plan: "+err.Error())
+		}
+		key := strings.ToLower(req.Plans[i].Species)
+		if seen[key] {
+			return fiber.NewError(fiber.StatusBadRequest, "Species "+req.Plans[i].Species+" is listed twice")
+		}
+		seen[key] = true
+	}
+
+	exists, err := hatcheryExists(hatcheryID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Hatchery not found")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer tx.Rollback()
+
+	saved := make([]models.ProductionPlan, 0, len(req.Plans))
+	for _, input := range req.Plans {
+		plan, err := scanProductionPlan(tx.QueryRow(`
+			INSERT INTO production_plan (hatchery_id, month, species, planned_batches, planned_quantity, notes, created_by, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NOW(), NOW())
+			ON CONFLICT (hatchery_id, month, LOWER(species)) DO UPDATE
+			SET species = EXCLUDED.species, planned_batches = EXCLUDED.planned_batches,
+				planned_quantity = EXCLUDED.planned_quantity, notes = EXCLUDED.notes, updated_at = NOW()
+			RETURNING `+productionPlanColumns,
+			hatcheryID, month, input.Species, input.PlannedBatches, input.PlannedQuantity, input.Notes, userID))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to save production plans")
+		}
+		saved = append(saved, plan)
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save production plans")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Production plans saved successfully",
+		Data:    saved,
+	})
+}
+
+// GetProductionPlans lists the production plans of a hatchery
+// @Summary List production plans
+// @Description List the planned production of a hatchery per month and species, oldest month first
+// @Tags hatcheries
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param from query string false "First month (YYYY-MM), default 11 months before to"
+// @Param to query string false "Last month (YYYY-MM), default the current month"
+// @Param species query string false "Species"
+// @Success 200 {object} SuccessResponse{data=[]models.ProductionPlan}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/production-plans [get]
+func GetProductionPlans(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+	from, to, err := parseMonthRange(c)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query(`SELECT `+productionPlanColumns+`
+		FROM production_plan
+		WHERE hatchery_id = $1 AND month BETWEEN $2 AND $3 AND ($4 = '' OR LOWER(species) = LOWER($4))
+		ORDER BY month, species
+	`, hatcheryID, from, to, strings.TrimSpace(c.Query("species")))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	plans := []models.ProductionPlan{}
+	for rows.Next() {
+		plan, err := scanProductionPlan(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse production plan")
+		}
+		plans = append(plans, plan)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Production plans retrieved successfully",
+		Data:    plans,
+	})
+}
+
+// DeleteProductionPlan deletes a production plan
+// @Summary Delete production plan
+// @Description Delete a production plan of a hatchery, e.g. when a species is dropped from the plan
+// @Tags hatcheries
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param planId path int true "Production plan ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/production-plans/{planId} [delete]
+func DeleteProductionPlan(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+	planID, err := strconv.Atoi(c.Params("planId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid production plan ID format")
+	}
+
+	result, err := db.DB.Exec("DELETE FROM production_plan WHERE id = $1 AND hatchery_id = $2", planID, hatcheryID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete production plan")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Production plan not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Production plan deleted successfully",
+	})
+}
@@ -0,0 +1,351 @@
+package api
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// harvestedBatchStatuses are the statuses of a batch that reached harvest
+var harvestedBatchStatuses = []string{"harvested", "completed", "sold", "delivered"}
+
+// VarianceFigures compares planned with actual production
+type VarianceFigures struct {
+	PlannedBatches      int      `json:"planned_batches"`
+	ActualBatches       int      `json:"actual_batches"` // Batches started
+	BatchVariance       int      `json:"batch_variance"` // Actual minus planned
+	PlannedQuantity     int64    `json:"planned_quantity"`
+	ActualQuantity      int64    `json:"actual_quantity"`
+	QuantityVariance    int64    `json:"quantity_variance"`
+	QuantityVariancePct *float64 `json:"quantity_variance_pct,omitempty"` // Empty without a planned quantity
+	HarvestedBatches    int      `json:"harvested_batches"`               // Batches started that reached harvest
+	HarvestedQuantity   int64    `json:"harvested_quantity"`
+	HarvestRatePct      *float64 `json:"harvest_rate_pct,omitempty"` // Harvested of started batches, empty without batches
+}
+
+// add adds the figures of other, without the derived ones
+func (v *VarianceFigures) add(other VarianceFigures) {
+	v.PlannedBatches += other.PlannedBatches
+	v.ActualBatches += other.ActualBatches
+	v.PlannedQuantity += other.PlannedQuantity
+	v.ActualQuantity += other.ActualQuantity
+	v.HarvestedBatches += other.HarvestedBatches
+	v.HarvestedQuantity += other.HarvestedQuantity
+}
+
+// derive computes the variances and rates from the planned and actual figures
+func (v *VarianceFigures) derive() {
+	v.BatchVariance = v.ActualBatches - v.PlannedBatches
+	v.QuantityVariance = v.ActualQuantity - v.PlannedQuantity
+	v.QuantityVariancePct = nil
+	if v.PlannedQuantity > 0 {
+		pct := math.Round(float64(v.QuantityVariance)/float64(v.PlannedQuantity)*10000) / 100
+		v.QuantityVariancePct = &pct
+	}
+	v.HarvestRatePct = nil
+	if v.ActualBatches > 0 {
+		pct := math.Round(float64(v.HarvestedBatches)/float64(v.ActualBatches)*10000) / 100
+		v.HarvestRatePct = &pct
+	}
+}
+
+// VarianceMonth is the variance of one month
+type VarianceMonth struct {
+	Month string `json:"month"` // YYYY-MM
+	VarianceFigures
+}
+
+// SpeciesVariance is the variance of one species at a hatchery
+type SpeciesVariance struct {
+	Species string `json:"species"`
+	Planned bool   `json:"planned"` // False when batches were started without any plan in the period
+	VarianceFigures
+	Months []VarianceMonth `json:"months"`
+}
+
+// HatcheryVariance is the variance of a hatchery, with a drill-down per species
+type HatcheryVariance struct {
+	HatcheryID   int       `json:"hatchery_id"`
+	HatcheryName string    `json:"hatchery_name"`
+	From         string    `json:"from"` // First month, YYYY-MM
+	To           string    `json:"to"`   // Last month, YYYY-MM
+	GeneratedAt  time.Time `json:"generated_at"`
+	VarianceFigures
+	Species []SpeciesVariance `json:"species"`
+}
+
+// ProductionVarianceReport is the variance of a company, with a drill-down per hatchery and species
+type ProductionVarianceReport struct {
+	CompanyID   int       `json:"company_id"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	GeneratedAt time.Time `json:"generated_at"`
+	VarianceFigures
+	Hatcheries []HatcheryVariance `json:"hatcheries"`
+}
+
+// varianceKey identifies the figures of a hatchery, species and month; species are matched case-insensitively
+type varianceKey struct {
+	hatcheryID int
+	species    string
+	month      string
+}
+
+// loadVarianceFigures collects the planned and actual production of hatcheries per species and month.
+// Batches count in the month they were started in; names maps a species key to the name it is shown with
+func loadVarianceFigures(hatcheryIDs []int, species string, from, to time.Time) (map[varianceKey]*VarianceFigures, map[varianceKey]bool, map[string]string, error) {
+	figures := map[varianceKey]*VarianceFigures{}
+	planned := map[varianceKey]bool{}
+	names := map[string]string{}
+	get := func(key varianceKey, name string) *VarianceFigures {
+		if names[key.species] == "" {
+			names[key.species] = name
+		}
+		if figures[key] == nil {
+			figures[key] = &VarianceFigures{}
+		}
+		return figures[key]
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT hatchery_id, LOWER(TRIM(species)), species, TO_CHAR(month, 'YYYY-MM'), planned_batches, planned_quantity
+		FROM production_plan
+		WHERE hatchery_id = ANY($1) AND month BETWEEN $2 AND $3 AND ($4 = '' OR LOWER(TRIM(species)) = LOWER($4))
+	`, pq.Array(hatcheryIDs), from, to, species)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for rows.Next() {
+		var key varianceKey
+		var name string
+		var batches int
+		var quantity int64
+		if err := rows.Scan(&key.hatcheryID, &key.species, &name, &key.month, &batches, &quantity); err != nil {
+			rows.Close()
+			return nil, nil, nil, err
+		}
+		f := get(key, name)
+		f.PlannedBatches += batches
+		f.PlannedQuantity += quantity
+		planned[varianceKey{hatcheryID: key.hatcheryID, species: key.species}] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	rows, err = db.DB.Query(`
+		SELECT hatchery_id, LOWER(TRIM(COALESCE(species, ''))), MIN(COALESCE(species, '')), TO_CHAR(created_at, 'YYYY-MM'),
+			COUNT(*), SUM(COALESCE(quantity, 0)),
+			COUNT(*) FILTER (WHERE status = ANY($5)), COALESCE(SUM(COALESCE(quantity, 0)) FILTER (WHERE status = ANY($5)), 0)
+		FROM batch
+		WHERE hatchery_id = ANY($1) AND is_active = true AND created_at >= $2 AND created_at < $3
+			AND ($4 = '' OR LOWER(TRIM(species)) = LOWER($4))
+		GROUP BY 1, 2, 4
+	`, pq.Array(hatcheryIDs), from, to.AddDate(0, 1, 0), species, pq.Array(harvestedBatchStatuses))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key varianceKey
+		var name string
+		var batches, harvested int
+		var quantity, harvestedQuantity sql.NullInt64
+		if err := rows.Scan(&key.hatcheryID, &key.species, &name, &key.month, &batches, &quantity, &harvested, &harvestedQuantity); err != nil {
+			return nil, nil, nil, err
+		}
+		f := get(key, name)
+		f.ActualBatches += batches
+		f.ActualQuantity += quantity.Int64
+		f.HarvestedBatches += harvested
+		f.HarvestedQuantity += harvestedQuantity.Int64
+	}
+	return figures, planned, names, rows.Err()
+}
+
+// buildVarianceReports builds the variance of hatcheries for the months from from to to, both the first
+// day of a month; species limits the report to one species
+func buildVarianceReports(hatcheryIDs []int, hatcheryNames map[int]string, species string, from, to time.Time) ([]HatcheryVariance, error) {
+	reports := []HatcheryVariance{}
+	if len(hatcheryIDs) == 0 {
+		return reports, nil
+	}
+	figures, planned, names, err := loadVarianceFigures(hatcheryIDs, strings.TrimSpace(species), from, to)
+	if err != nil {
+		return nil, err
+	}
+	speciesOf := map[int]map[string]bool{}
+	for key := range figures {
+		if speciesOf[key.hatcheryID] == nil {
+			speciesOf[key.hatcheryID] = map[string]bool{}
+		}
+		speciesOf[key.hatcheryID][key.species] = true
+	}
+
+	now := time.Now()
+	for _, hatcheryID := range hatcheryIDs {
+		report := HatcheryVariance{
+			HatcheryID:   hatcheryID,
+			HatcheryName: hatcheryNames[hatcheryID],
+			From:         from.Format(energyMonthLayout),
+			To:           to.Format(energyMonthLayout),
+			GeneratedAt:  now,
+			Species:      []SpeciesVariance{},
+		}
+		keys := make([]string, 0, len(speciesOf[hatcheryID]))
+		for key := range speciesOf[hatcheryID] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sv := SpeciesVariance{
+				Species: names[key],
+				Planned: planned[varianceKey{hatcheryID: hatcheryID, species: key}],
+				Months:  []VarianceMonth{},
+			}
+			for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+				m := VarianceMonth{Month: month.Format(energyMonthLayout)}
+				if f := figures[varianceKey{hatcheryID: hatcheryID, species: key, month: m.Month}]; f != nil {
+					m.VarianceFigures = *f
+				}
+				m.derive()
+				sv.add(m.VarianceFigures)
+				sv.Months = append(sv.Months, m)
+			}
+			sv.derive()
+			report.add(sv.VarianceFigures)
+			report.Species = append(report.Species, sv)
+		}
+		report.derive()
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// GetHatcheryProductionVariance builds the production variance report of a facility
+// @Summary Get facility production variance
+// @Description Compare the production a hatchery planned with the batches it started and harvested, per species and month. Batches count in the month they were started in; species started without a plan are reported as unplanned
+// @Tags hatcheries
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param from query string false "First month (YYYY-MM), default 11 months before to"
+// @Param to query string false "Last month (YYYY-MM), default the current month"
+// @Param species query string false "Only this species"
+// @Success 200 {object} SuccessResponse{data=HatcheryVariance}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/reports/production-variance [get]
+func GetHatcheryProductionVariance(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+	from, to, err := parseMonthRange(c)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	err = db.DB.QueryRow("SELECT name FROM hatchery WHERE id = $1 AND is_active = true", hatcheryID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Hatchery not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	reports, err := buildVarianceReports([]int{hatcheryID}, map[int]string{hatcheryID: name}, c.Query("species"), from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build production variance report")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Production variance report generated successfully",
+		Data:    reports[0],
+	})
+}
+
+// GetProductionVarianceReport builds the production variance report of a company
+// @Summary Get company production variance
+// @Description Compare the production the facilities of a company planned with the batches they started and harvested, for the company as a whole and drilled down per hatchery, species and month
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param from query string false "First month (YYYY-MM), default 11 months before to"
+// @Param to query string false "Last month (YYYY-MM), default the current month"
+// @Param hatchery_id query int false "Only this hatchery"
+// @Param species query string false "Only this species"
+// @Success 200 {object} SuccessResponse{data=ProductionVarianceReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/reports/production-variance [get]
+func GetProductionVarianceReport(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	from, to, err := parseMonthRange(c)
+	if err != nil {
+		return err
+	}
+	if err := readsForCompany(c, companyID); err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, name FROM hatchery
+		WHERE company_id = $1 AND is_active = true AND ($2 = 0 OR id = $2)
+		ORDER BY name, id
+	`, companyID, c.QueryInt("hatchery_id", 0))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	hatcheryIDs := []int{}
+	names := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse hatchery")
+		}
+		hatcheryIDs = append(hatcheryIDs, id)
+		names[id] = name
+	}
+	rows.Close()
+
+	hatcheries, err := buildVarianceReports(hatcheryIDs, names, c.Query("species"), from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build production variance report")
+	}
+
+	report := ProductionVarianceReport{
+		CompanyID:   companyID,
+		From:        from.Format(energyMonthLayout),
+		To:          to.Format(energyMonthLayout),
+		GeneratedAt: time.Now(),
+		Hatcheries:  hatcheries,
+	}
+	for _, hatchery := range hatcheries {
+		report.add(hatchery.VarianceFigures)
+	}
+	report.derive()
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Production variance report generated successfully",
+		Data:    report,
+	})
+}
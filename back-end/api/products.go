@@ -0,0 +1,807 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/approvals"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+)
+
+// Product statuses, computed from the expiry date and the recalls of the source batches
+const (
+	ProductStatusActive   = "active"
+	ProductStatusExpired  = "expired"
+	ProductStatusRecalled = "recalled"
+)
+
+// Recall severities
+const (
+	RecallSeverityHigh   = "high"
+	RecallSeverityMedium = "medium"
+	RecallSeverityLow    = "low"
+)
+
+// Batch events recorded for recalls
+const (
+	EventTypeBatchRecalled     = "batch_recalled"
+	EventTypeBatchRecallLifted = "batch_recall_lifted"
+)
+
+// DerivedProduct is a processed product made from one or more batches
+type DerivedProduct struct {
+	ID                int                    `json:"id"`
+	CompanyID         int                    `json:"company_id"` // Company that made the product
+	ProductName       string                 `json:"product_name"`
+	ProductType       string                 `json:"product_type"` // e.g. frozen, dried, feed
+	LotNumber         string                 `json:"lot_number"`
+	Quantity          *float64               `json:"quantity,omitempty"`
+	Unit              string                 `json:"unit"`
+	ProductionDate    time.Time              `json:"production_date"`
+	ExpiryDate        time.Time              `json:"expiry_date"`
+	DaysToExpiry      int                    `json:"days_to_expiry"` // Negative once expired
+	StorageConditions string                 `json:"storage_conditions"`
+	Status            string                 `json:"status"` // active, expired or recalled
+	CreatedAt         time.Time              `json:"created_at"`
+	UpdatedAt         time.Time              `json:"updated_at"`
+	Sources           []DerivedProductSource `json:"sources,omitempty"`
+}
+
+// DerivedProductSource links a product to a batch it was made from
+type DerivedProductSource struct {
+	BatchID      int      `json:"batch_id"`
+	QuantityUsed *float64 `json:"quantity_used,omitempty"`
+	Recalled     bool     `json:"recalled"` // The batch is under an active recall
+}
+
+// DerivedProductRequest represents a request to record or update a derived product
+type DerivedProductRequest struct {
+	CompanyID         int                    `json:"company_id"`
+	ProductName       string                 `json:"product_name"`
+	ProductType       string                 `json:"product_type"`
+	LotNumber         string                 `json:"lot_number"`
+	Quantity          *float64               `json:"quantity"`
+	Unit              string                 `json:"unit"`
+	ProductionDate    time.Time              `json:"production_date"`
+	ExpiryDate        time.Time              `json:"expiry_date"`
+	StorageConditions string                 `json:"storage_conditions"`
+	Sources           []DerivedProductSource `json:"sources"` // Only used when the product is created
+}
+
+// BatchRecall is a recall of a batch, which propagates to every product made from it
+type BatchRecall struct {
+	ID               int              `json:"id"`
+	BatchID          int              `json:"batch_id"`
+	Reason           string           `json:"reason"`
+	Severity         string           `json:"severity"`
+	InitiatedBy      *int             `json:"initiated_by,omitempty"`
+	InitiatedAt      time.Time        `json:"initiated_at"`
+	LiftedAt         *time.Time       `json:"lifted_at,omitempty"`
+	LiftedBy         *int             `json:"lifted_by,omitempty"`
+	LiftReason       string           `json:"lift_reason"`
+	AffectedProducts []DerivedProduct `json:"affected_products,omitempty"`
+}
+
+// BatchRecallRequest represents a request to recall a batch
+type BatchRecallRequest struct {
+	Reason   string `json:"reason"`
+	Severity string `json:"severity"` // high, medium or low
+}
+
+// LiftRecallRequest represents a request to lift a recall
+type LiftRecallRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ExpiringProductsReport lists products whose expiry date falls within a window
+type ExpiringProductsReport struct {
+	Days        int              `json:"days"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Count       int              `json:"count"`
+	Products    []DerivedProduct `json:"products"`
+}
+
+const derivedProductColumns = `
+	p.id, p.company_id, p.product_name, p.product_type, COALESCE(p.lot_number, ''), p.quantity, COALESCE(p.unit, ''),
+	p.production_date, p.expiry_date, COALESCE(p.storage_conditions, ''),
+	CASE
+		WHEN EXISTS(
+			SELECT 1 FROM derived_product_source s
+			JOIN batch_recall r ON r.batch_id = s.batch_id AND r.lifted_at IS NULL
+			WHERE s.product_id = p.id
+		) THEN 'recalled'
+		WHEN p.expiry_date <= NOW() THEN 'expired'
+		ELSE 'active'
+	END AS status,
+	p.created_at, p.updated_at
+`
+
+// scanDerivedProduct reads a product selected with derivedProductColumns
+func scanDerivedProduct(row rowScanner) (DerivedProduct, error) {
+	var p DerivedProduct
+	var quantity sql.NullFloat64
+	err := row.Scan(&p.ID, &p.CompanyID, &p.ProductName, &p.ProductType, &p.LotNumber, &quantity, &p.Unit,
+		&p.ProductionDate, &p.ExpiryDate, &p.StorageConditions, &p.Status, &p.CreatedAt, &p.UpdatedAt)
+	p.Quantity = floatPtr(quantity)
+	p.DaysToExpiry = int(math.Floor(time.Until(p.ExpiryDate).Hours() / 24))
+	return p, err
+}
+
+// queryDerivedProducts runs a product query and collects the results
+func queryDerivedProducts(query string, args ...interface{}) ([]DerivedProduct, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []DerivedProduct{}
+	for rows.Next() {
+		product, err := scanDerivedProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, rows.Err()
+}
+
+// loadDerivedProductSources lists the batches a product was made from
+func loadDerivedProductSources(productID int) ([]DerivedProductSource, error) {
+	rows, err := db.DB.Query(`
+		SELECT s.batch_id, s.quantity_used,
+			EXISTS(SELECT 1 FROM batch_recall r WHERE r.batch_id = s.batch_id AND r.lifted_at IS NULL)
+		FROM derived_product_source s
+		WHERE s.product_id = $1
+		ORDER BY s.batch_id
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := []DerivedProductSource{}
+	for rows.Next() {
+		var source DerivedProductSource
+		var quantityUsed sql.NullFloat64
+		if err := rows.Scan(&source.BatchID, &quantityUsed, &source.Recalled); err != nil {
+			return nil, err
+		}
+		source.QuantityUsed = floatPtr(quantityUsed)
+		sources = append(sources, source)
+	}
+	return sources, rows.Err()
+}
+
+// validateDerivedProductRequest checks the fields shared by create and update
+func validateDerivedProductRequest(req *DerivedProductRequest) error {
+	if req.ProductName == "" || req.ProductType == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Product name and type are required")
+	}
+	if req.ProductionDate.IsZero() || req.ExpiryDate.IsZero() {
+		return fiber.NewError(fiber.StatusBadRequest, "Production and expiry dates are required")
+	}
+	if !req.ExpiryDate.After(req.ProductionDate) {
+		return fiber.NewError(fiber.StatusBadRequest, "Expiry date must be after the production date")
+	}
+	if req.Quantity != nil && *req.Quantity <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Quantity must be positive")
+	}
+	return nil
+}
+
+// parseDerivedProductID loads the active product named by the productId route parameter
+func parseDerivedProductID(c *fiber.Ctx) (DerivedProduct, error) {
+	productID, err := strconv.Atoi(c.Params("productId"))
+	if err != nil {
+		return DerivedProduct{}, fiber.NewError(fiber.StatusBadRequest, "Invalid product ID format")
+	}
+	product, err := scanDerivedProduct(db.DB.QueryRow(`SELECT `+derivedProductColumns+` FROM derived_product p WHERE p.id = $1 AND p.is_active = true`, productID))
+	if err == sql.ErrNoRows {
+		return product, fiber.NewError(fiber.StatusNotFound, "Product not found")
+	}
+	if err != nil {
+		return product, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	return product, nil
+}
+
+// CreateDerivedProduct records a processed product made from batches
+// @Summary Create derived product
+// @Description Record a processed product with its production and expiry dates and the batches it was made from. Products cannot be made from batches under recall.
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param request body DerivedProductRequest true "Product details"
+// @Success 201 {object} SuccessResponse{data=DerivedProduct}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /products [post]
+func CreateDerivedProduct(c *fiber.Ctx) error {
+	var req DerivedProductRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.CompanyID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Company ID is required")
+	}
+	if err := validateDerivedProductRequest(&req); err != nil {
+		return err
+	}
+	if len(req.Sources) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one source batch is required")
+	}
+
+	var exists bool
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", req.CompanyID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+
+	seen := map[int]bool{}
+	for _, source := range req.Sources {
+		if source.BatchID <= 0 || seen[source.BatchID] {
+			return fiber.NewError(fiber.StatusBadRequest, "Source batches must be distinct valid batch IDs")
+		}
+		seen[source.BatchID] = true
+		if source.QuantityUsed != nil && *source.QuantityUsed <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "Quantity used must be positive")
+		}
+
+		var recalled bool
+		err := db.DB.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM batch_recall WHERE batch_id = b.id AND lifted_at IS NULL)
+			FROM batch b WHERE b.id = $1 AND b.is_active = true
+		`, source.BatchID).Scan(&recalled)
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Source batch #%d not found", source.BatchID))
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if recalled {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Source batch #%d is under recall", source.BatchID))
+		}
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	userID, _ := c.Locals("userID").(int)
+	var productID int
+	err = tx.QueryRow(`
+		INSERT INTO derived_product (company_id, product_name, product_type, lot_number, quantity, unit,
+			production_date, expiry_date, storage_conditions, created_by, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, 0), NOW(), NOW(), true)
+		RETURNING id
+	`, req.CompanyID, req.ProductName, req.ProductType, req.LotNumber, req.Quantity, req.Unit,
+		req.ProductionDate, req.ExpiryDate, req.StorageConditions, userID).Scan(&productID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create product")
+	}
+	for _, source := range req.Sources {
+		_, err = tx.Exec(`
+			INSERT INTO derived_product_source (product_id, batch_id, quantity_used) VALUES ($1, $2, $3)
+		`, productID, source.BatchID, source.QuantityUsed)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to link source batch")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+
+	product, err := scanDerivedProduct(db.DB.QueryRow(`SELECT `+derivedProductColumns+` FROM derived_product p WHERE p.id = $1`, productID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Product created but failed to retrieve details")
+	}
+	if product.Sources, err = loadDerivedProductSources(productID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load source batches")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Product created successfully",
+		Data:    product,
+	})
+}
+
+// ListDerivedProducts lists derived products
+// @Summary List derived products
+// @Description List derived products, optionally filtered by company and status
+// @Tags products
+// @Produce json
+// @Param company_id query int false "Filter by company ID"
+// @Param status query string false "Filter by status (active, expired, recalled)"
+// @Success 200 {object} SuccessResponse{data=[]DerivedProduct}
+// @Failure 500 {object} ErrorResponse
+// @Router /products [get]
+func ListDerivedProducts(c *fiber.Ctx) error {
+	products, err := queryDerivedProducts(`
+		SELECT * FROM (SELECT `+derivedProductColumns+` FROM derived_product p
+			WHERE p.is_active = true AND ($1::int = 0 OR p.company_id = $1)) products
+		WHERE $2::text = '' OR status = $2
+		ORDER BY expiry_date, id
+	`, c.QueryInt("company_id", 0), c.Query("status"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve products")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Products retrieved successfully",
+		Data:    products,
+	})
+}
+
+// GetExpiringProducts reports products approaching their expiry date
+// @Summary Expiring products report
+// @Description List products that are not recalled and expire within the given number of days, soonest first
+// @Tags products
+// @Produce json
+// @Param days query int false "Window in days" default(30)
+// @Param company_id query int false "Filter by company ID"
+// @Success 200 {object} SuccessResponse{data=ExpiringProductsReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /products/expiring [get]
+func GetExpiringProducts(c *fiber.Ctx) error {
+	days := c.QueryInt("days", 30)
+	if days <= 0 || days > 365 {
+		return fiber.NewError(fiber.StatusBadRequest, "Days must be between 1 and 365")
+	}
+
+	products, err := queryDerivedProducts(`
+		SELECT * FROM (SELECT `+derivedProductColumns+` FROM derived_product p
+			WHERE p.is_active = true AND ($1::int = 0 OR p.company_id = $1)
+				AND p.expiry_date > NOW() AND p.expiry_date <= NOW() + make_interval(days => $2)) products
+		WHERE status = 'active'
+		ORDER BY expiry_date, id
+	`, c.QueryInt("company_id", 0), days)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve expiring products")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Expiring products retrieved successfully",
+		Data: ExpiringProductsReport{
+			Days:        days,
+			GeneratedAt: time.Now(),
+			Count:       len(products),
+			Products:    products,
+		},
+	})
+}
+
+// GetDerivedProduct retrieves a derived product with its source batches
+// @Summary Get derived product
+// @Description Retrieve a derived product with its source batches and their recall state
+// @Tags products
+// @Produce json
+// @Param productId path int true "Product ID"
+// @Success 200 {object} SuccessResponse{data=DerivedProduct}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /products/{productId} [get]
+func GetDerivedProduct(c *fiber.Ctx) error {
+	product, err := parseDerivedProductID(c)
+	if err != nil {
+		return err
+	}
+	if product.Sources, err = loadDerivedProductSources(product.ID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load source batches")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Product retrieved successfully",
+		Data:    product,
+	})
+}
+
+// UpdateDerivedProduct updates a derived product
+// @Summary Update derived product
+// @Description Update a derived product's details and dates; source batches cannot be changed
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param productId path int true "Product ID"
+// @Param request body DerivedProductRequest true "Product details"
+// @Success 200 {object} SuccessResponse{data=DerivedProduct}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /products/{productId} [put]
+func UpdateDerivedProduct(c *fiber.Ctx) error {
+	product, err := parseDerivedProductID(c)
+	if err != nil {
+		return err
+	}
+
+	var req DerivedProductRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateDerivedProductRequest(&req); err != nil {
+		return err
+	}
+
+	product, err = scanDerivedProduct(db.DB.QueryRow(`
+		UPDATE derived_product p SET product_name = $1, product_type = $2, lot_number = $3, quantity = $4, unit = $5,
+			production_date = $6, expiry_date = $7, storage_conditions = $8, updated_at = NOW()
+		WHERE p.id = $9
+		RETURNING `+derivedProductColumns,
+		req.ProductName, req.ProductType, req.LotNumber, req.Quantity, req.Unit,
+		req.ProductionDate, req.ExpiryDate, req.StorageConditions, product.ID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update product")
+	}
+	if product.Sources, err = loadDerivedProductSources(product.ID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load source batches")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Product updated successfully",
+		Data:    product,
+	})
+}
+
+// DeleteDerivedProduct deletes a derived product
+// @Summary Delete derived product
+// @Description Soft delete a derived product
+// @Tags products
+// @Produce json
+// @Param productId path int true "Product ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /products/{productId} [delete]
+func DeleteDerivedProduct(c *fiber.Ctx) error {
+	productID, err := strconv.Atoi(c.Params("productId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid product ID format")
+	}
+
+	result, err := db.DB.Exec("UPDATE derived_product SET is_active = false, updated_at = NOW() WHERE id = $1 AND is_active = true", productID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete product")
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Product not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Product deleted successfully",
+	})
+}
+
+// GetBatchProducts lists the products made from a batch
+// @Summary Get batch derived products
+// @Description List the derived products made from a batch
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]DerivedProduct}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/products [get]
+func GetBatchProducts(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	products, err := batchDerivedProducts(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve products")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch products retrieved successfully",
+		Data:    products,
+	})
+}
+
+// batchDerivedProducts lists the active products made from a batch
+func batchDerivedProducts(batchID int) ([]DerivedProduct, error) {
+	return queryDerivedProducts(`SELECT `+derivedProductColumns+`
+		FROM derived_product p
+		WHERE p.is_active = true AND p.id IN (SELECT product_id FROM derived_product_source WHERE batch_id = $1)
+		ORDER BY p.expiry_date, p.id
+	`, batchID)
+}
+
+const batchRecallColumns = `
+	id, batch_id, reason, severity, initiated_by, initiated_at, lifted_at, lifted_by, COALESCE(lift_reason, '')
+`
+
+// scanBatchRecall reads a recall selected with batchRecallColumns
+func scanBatchRecall(row rowScanner) (BatchRecall, error) {
+	var r BatchRecall
+	var initiatedBy, liftedBy sql.NullInt64
+	var liftedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.BatchID, &r.Reason, &r.Severity, &initiatedBy, &r.InitiatedAt, &liftedAt, &liftedBy, &r.LiftReason)
+	r.InitiatedBy = intPtr(initiatedBy)
+	r.LiftedAt = timePtr(liftedAt)
+	r.LiftedBy = intPtr(liftedBy)
+	return r, err
+}
+
+// notifyRecall records a recall event on the batch and tells the batch owner and every product maker
+func notifyRecall(recall BatchRecall, eventType, webhookEvent string, actorID int, products []DerivedProduct) {
+	productIDs := make([]int64, len(products))
+	for i, product := range products {
+		productIDs[i] = int64(product.ID)
+	}
+	data := map[string]interface{}{
+		"recall_id":            recall.ID,
+		"batch_id":             recall.BatchID,
+		"reason":               recall.Reason,
+		"severity":             recall.Severity,
+		"affected_product_ids": productIDs,
+	}
+	if recall.LiftedAt != nil {
+		data["lift_reason"] = recall.LiftReason
+	}
+
+	metadata, _ := json.Marshal(data)
+	_, err := db.DB.Exec(`
+		INSERT INTO event (batch_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active)
+		VALUES ($1, $2, NULLIF($3, 0), '', NOW(), $4, NOW(), true)
+	`, recall.BatchID, eventType, actorID, metadata)
+	if err != nil {
+		fmt.Printf("Warning: Failed to record %s event: %v\n", eventType, err)
+	}
+
+	// The batch owner and the makers of affected products each get one notification
+	rows, err := db.DB.Query(`
+		SELECT h.company_id FROM batch b JOIN hatchery h ON h.id = b.hatchery_id WHERE b.id = $1
+		UNION
+		SELECT company_id FROM derived_product WHERE id = ANY($2)
+	`, recall.BatchID, pq.Array(productIDs))
+	if err != nil {
+		fmt.Printf("Warning: Failed to look up companies to notify of recall: %v\n", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var companyID int
+		if err := rows.Scan(&companyID); err != nil {
+			continue
+		}
+		if err := webhooks.Dispatch(companyID, webhookEvent, data); err != nil {
+			fmt.Printf("Warning: failed to dispatch %s webhook: %v\n", webhookEvent, err)
+		}
+	}
+}
+
+// checkBatchRecall checks that a batch can be recalled
+func checkBatchRecall(batchID int) error {
+	var exists bool
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = $1 AND is_active = true)", batchID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch_recall WHERE batch_id = $1 AND lifted_at IS NULL)", batchID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "Batch is already under recall")
+	}
+	return nil
+}
+
+// recallBatch places a batch under recall and notifies the companies concerned
+func recallBatch(batchID int, req BatchRecallRequest, userID int) (BatchRecall, error) {
+	if err := checkBatchRecall(batchID); err != nil {
+		return BatchRecall{}, err
+	}
+	recall, err := scanBatchRecall(db.DB.QueryRow(`
+		INSERT INTO batch_recall (batch_id, reason, severity, initiated_by, initiated_at)
+		VALUES ($1, $2, $3, NULLIF($4, 0), NOW())
+		RETURNING `+batchRecallColumns,
+		batchID, req.Reason, req.Severity, userID))
+	if err != nil {
+		return recall, fiber.NewError(fiber.StatusInternalServerError, "Failed to create recall")
+	}
+
+	// Product status is derived from the source batches, so the products are recalled from here on
+	if recall.AffectedProducts, err = batchDerivedProducts(batchID); err != nil {
+		return recall, fiber.NewError(fiber.StatusInternalServerError, "Recall created but failed to load affected products")
+	}
+	notifyRecall(recall, EventTypeBatchRecalled, "batch_recalled", userID, recall.AffectedProducts)
+	return recall, nil
+}
+
+// RecallBatch places a batch under recall
+// @Summary Recall batch
+// @Description Recall a batch. Every product made from the batch becomes recalled, the recall is added to the batch events and the batch owner and product makers are notified through webhooks.
+// @Description When the batch_recall approval policy is enabled, the recall is submitted for approval instead and carried out once approved
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param request body BatchRecallRequest true "Recall details"
+// @Success 201 {object} SuccessResponse{data=BatchRecall}
+// @Success 202 {object} SuccessResponse{data=approvals.Request}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/recalls [post]
+func RecallBatch(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	var req BatchRecallRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.Reason == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Recall reason is required")
+	}
+	switch req.Severity {
+	case RecallSeverityHigh, RecallSeverityMedium, RecallSeverityLow:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Severity must be high, medium or low")
+	}
+
+	companyID, err := batchOwner(c, batchID)
+	if err != nil {
+		return err
+	}
+	if err := checkBatchRecall(batchID); err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	if request, err := submitForApproval(c, approvals.ActionBatchRecall, companyID, "batch", batchID,
+		fmt.Sprintf("Recall batch %d (%s severity): %s", batchID, req.Severity, req.Reason),
+		batchRecallApproval{BatchID: batchID, BatchRecallRequest: req}); request != nil || err != nil {
+		return err
+	}
+	recall, err := recallBatch(batchID, req, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch recalled successfully",
+		Data:    recall,
+	})
+}
+
+// GetBatchRecalls lists the recalls of a batch
+// @Summary Get batch recalls
+// @Description List current and lifted recalls of a batch, newest first
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]BatchRecall}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/recalls [get]
+func GetBatchRecalls(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+batchRecallColumns+` FROM batch_recall WHERE batch_id = $1 ORDER BY initiated_at DESC, id DESC`, batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	recalls := []BatchRecall{}
+	for rows.Next() {
+		recall, err := scanBatchRecall(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse recall")
+		}
+		recalls = append(recalls, recall)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch recalls retrieved successfully",
+		Data:    recalls,
+	})
+}
+
+// LiftBatchRecall lifts a recall
+// @Summary Lift batch recall
+// @Description Lift an active recall; products made from the batch are no longer recalled unless another source batch is
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param recallId path int true "Recall ID"
+// @Param request body LiftRecallRequest true "Reason for lifting"
+// @Success 200 {object} SuccessResponse{data=BatchRecall}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/recalls/{recallId}/lift [post]
+func LiftBatchRecall(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	recallID, err := strconv.Atoi(c.Params("recallId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid recall ID format")
+	}
+
+	var req LiftRecallRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.Reason == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Reason for lifting the recall is required")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	recall, err := scanBatchRecall(db.DB.QueryRow(`
+		UPDATE batch_recall SET lifted_at = NOW(), lifted_by = NULLIF($1, 0), lift_reason = $2
+		WHERE id = $3 AND batch_id = $4 AND lifted_at IS NULL
+		RETURNING `+batchRecallColumns,
+		userID, req.Reason, recallID, batchID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Active recall not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to lift recall")
+	}
+
+	if recall.AffectedProducts, err = batchDerivedProducts(batchID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Recall lifted but failed to load affected products")
+	}
+	notifyRecall(recall, EventTypeBatchRecallLifted, "batch_recall_lifted", userID, recall.AffectedProducts)
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch recall lifted successfully",
+		Data:    recall,
+	})
+}
@@ -0,0 +1,418 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/actors"
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Per-hop provenance verdicts
+const (
+	HopVerified          = "verified"
+	HopMissingAnchor     = "missing_anchor"
+	HopMissingSignature  = "missing_signature"
+	HopSignatureMismatch = "signature_mismatch"
+)
+
+// ProvenanceHop is one step of a batch's lineage or custody chain
+type ProvenanceHop struct {
+	Sequence     int       `json:"sequence"`
+	HopType      string    `json:"hop_type"` // batch_created, event, custody_transfer, shipment, document, broodstock_event, broodstock_document
+	RecordTable  string    `json:"record_table"`
+	RecordID     int       `json:"record_id"`
+	Description  string    `json:"description"`
+	ActorID      int       `json:"actor_id,omitempty"`
+	FromActorID  int       `json:"from_actor_id,omitempty"`
+	ToActorID    int       `json:"to_actor_id,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+	TxID         string    `json:"tx_id,omitempty"`
+	MetadataHash string    `json:"metadata_hash,omitempty"`
+	Verdict      string    `json:"verdict"`
+	Detail       string    `json:"detail,omitempty"`
+}
+
+// ProvenanceReport is the structured verdict of a batch provenance verification
+type ProvenanceReport struct {
+	BatchID           int                  `json:"batch_id"`
+	Species           string               `json:"species"`
+	HatcheryName      string               `json:"hatchery_name"`
+	CompanyName       string               `json:"company_name"`
+	Verdict           string               `json:"verdict"` // verified, partially_verified, failed
+	TotalHops         int                  `json:"total_hops"`
+	VerifiedHops      int                  `json:"verified_hops"`
+	VerdictCounts     map[string]int       `json:"verdict_counts"`
+	CustodyContinuous bool                 `json:"custody_continuous"`
+	CustodyGaps       []string             `json:"custody_gaps"`
+	Hops              []ProvenanceHop      `json:"hops"`
+	Actors            map[int]actors.Actor `json:"actors"` // Accounts of the hops by ID
+	Strain            *models.Strain       `json:"strain,omitempty"`
+	Claims            []models.BatchClaim  `json:"claims"`
+	VerifiedAt        time.Time            `json:"verified_at"`
+}
+
+// blockchainAnchor is a blockchain_record row anchoring an off-chain record
+type blockchainAnchor struct {
+	TxID         string
+	MetadataHash string
+}
+
+// VerifyBatchProvenance walks the lineage and custody chain of a batch and re-verifies every hop
+// @Summary Verify batch provenance
+// @Description Walk the full lineage and custody chain of a batch, independently re-verify each hop's blockchain anchor and signature, and return a verdict per hop for buyer due diligence
+// @Tags verification
+// @Accept json
+// @Produce json
+// @Param batchId path string true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=ProvenanceReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /verify/provenance/{batchId} [get]
+func VerifyBatchProvenance(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	report := ProvenanceReport{
+		BatchID:       batchID,
+		VerdictCounts: map[string]int{},
+		CustodyGaps:   []string{},
+		VerifiedAt:    time.Now(),
+	}
+
+	var hatcheryID int
+	var strainID sql.NullInt64
+	var batchCreatedAt time.Time
+	err = db.DB.QueryRow(`
+		SELECT b.hatchery_id, b.strain_id, COALESCE(b.species, ''), b.created_at, COALESCE(h.name, ''), COALESCE(co.name, '')
+		FROM batch b
+		LEFT JOIN hatchery h ON b.hatchery_id = h.id
+		LEFT JOIN company co ON h.company_id = co.id
+		WHERE b.id = $1 AND b.is_active = true
+	`, batchID).Scan(&hatcheryID, &strainID, &report.Species, &batchCreatedAt, &report.HatcheryName, &report.CompanyName)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	hops := []ProvenanceHop{{
+		HopType:     "batch_created",
+		RecordTable: "batch",
+		RecordID:    batchID,
+		Description: fmt.Sprintf("Batch created at hatchery %d", hatcheryID),
+		Timestamp:   batchCreatedAt,
+	}}
+
+	docLevels, err := visibleBatchDocumentLevels(c, batchID)
+	if err != nil {
+		return err
+	}
+	collected, err := collectProvenanceHops(batchID, docLevels)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load batch history: "+err.Error())
+	}
+	hops = append(hops, collected...)
+	sort.SliceStable(hops, func(i, j int) bool { return hops[i].Timestamp.Before(hops[j].Timestamp) })
+
+	anchors, err := loadProvenanceAnchors(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load blockchain anchors: "+err.Error())
+	}
+
+	cfg := config.GetConfig()
+	blockchainClient := blockchain.NewBlockchainClient(
+		cfg.BlockchainNodeURL,
+		cfg.BlockchainPrivateKey,
+		cfg.BlockchainAccount,
+		cfg.BlockchainChainID,
+		cfg.BlockchainConsensus,
+	)
+
+	// Re-verify every hop against the chain
+	for i := range hops {
+		hop := &hops[i]
+		hop.Sequence = i + 1
+
+		anchor, ok := anchors[provenanceAnchorKey(hop.RecordTable, hop.RecordID)]
+		if !ok || anchor.TxID == "" {
+			hop.Verdict = HopMissingAnchor
+			hop.Detail = "no blockchain transaction recorded for this hop"
+		} else {
+			hop.TxID = anchor.TxID
+			hop.MetadataHash = anchor.MetadataHash
+			hop.Verdict, hop.Detail = verifyProvenanceAnchor(blockchainClient, anchor)
+		}
+
+		report.VerdictCounts[hop.Verdict]++
+		if hop.Verdict == HopVerified {
+			report.VerifiedHops++
+		}
+	}
+
+	// Custody must pass from the receiver of one transfer to the sender of the next
+	lastReceiver := 0
+	for _, hop := range hops {
+		if hop.HopType != "custody_transfer" {
+			continue
+		}
+		if lastReceiver != 0 && hop.FromActorID != lastReceiver {
+			report.CustodyGaps = append(report.CustodyGaps, fmt.Sprintf(
+				"transfer %d was sent by account %d but custody was last handed to account %d",
+				hop.RecordID, hop.FromActorID, lastReceiver))
+		}
+		lastReceiver = hop.ToActorID
+	}
+	report.CustodyContinuous = len(report.CustodyGaps) == 0
+
+	if strainID.Valid {
+		if strain, err := loadStrain(int(strainID.Int64)); err == nil {
+			report.Strain = &strain
+		}
+	}
+	if report.Claims, err = loadBatchClaims(batchID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify batch claims: "+err.Error())
+	}
+
+	// Accounts appearing in the hops are resolved in one lookup
+	var actorIDs []int
+	for _, hop := range hops {
+		actorIDs = append(actorIDs, hop.ActorID, hop.FromActorID, hop.ToActorID)
+	}
+	if report.Actors, err = actors.Default().Accounts(actorIDs); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to resolve provenance actors")
+	}
+
+	report.Hops = hops
+	report.TotalHops = len(hops)
+	switch {
+	case report.VerdictCounts[HopSignatureMismatch] > 0 || !report.CustodyContinuous:
+		report.Verdict = "failed"
+	case report.VerifiedHops == report.TotalHops:
+		report.Verdict = "verified"
+	default:
+		report.Verdict = "partially_verified"
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch provenance verified",
+		Data:    report,
+	})
+}
+
+// verifyProvenanceAnchor re-checks an anchor on chain and maps the result to a hop verdict
+func verifyProvenanceAnchor(client *blockchain.BlockchainClient, anchor blockchainAnchor) (string, string) {
+	result, err := client.VerifyAnchoredTransaction(anchor.TxID, anchor.MetadataHash)
+	if err != nil {
+		return HopMissingAnchor, "failed to query blockchain: " + err.Error()
+	}
+	if !result.Found {
+		return HopMissingAnchor, result.Detail
+	}
+	if anchor.MetadataHash == "" {
+		return HopMissingSignature, result.Detail
+	}
+	if !result.SignatureValid {
+		return HopSignatureMismatch, result.Detail
+	}
+	return HopVerified, ""
+}
+
+// collectProvenanceHops loads events, custody transfers, shipments and documents of a batch and of its broodstock;
+// only documents of the sensitivity levels in docLevels are included
+func collectProvenanceHops(batchID int, docLevels interface{}) ([]ProvenanceHop, error) {
+	hops := []ProvenanceHop{}
+
+	rows, err := db.DB.Query(`
+		SELECT id, COALESCE(event_type, ''), COALESCE(actor_id, 0), COALESCE(location, ''), COALESCE(timestamp, updated_at)
+		FROM event
+		WHERE batch_id = $1 AND is_active = true
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		hop := ProvenanceHop{HopType: "event", RecordTable: "event"}
+		var eventType, location string
+		if err := rows.Scan(&hop.RecordID, &eventType, &hop.ActorID, &location, &hop.Timestamp); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hop.Description = eventType
+		if location != "" {
+			hop.Description += " at " + location
+		}
+		hops = append(hops, hop)
+	}
+	rows.Close()
+
+	rows, err = db.DB.Query(`
+		SELECT id, COALESCE(sender_id, 0), COALESCE(receiver_id, 0), COALESCE(status, ''), transfer_time
+		FROM shipment_transfer
+		WHERE batch_id = $1 AND is_active = true
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		hop := ProvenanceHop{HopType: "custody_transfer", RecordTable: "shipment_transfer"}
+		var status string
+		if err := rows.Scan(&hop.RecordID, &hop.FromActorID, &hop.ToActorID, &status, &hop.Timestamp); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hop.ActorID = hop.FromActorID
+		hop.Description = fmt.Sprintf("Custody transfer from account %d to account %d (%s)", hop.FromActorID, hop.ToActorID, status)
+		hops = append(hops, hop)
+	}
+	rows.Close()
+
+	rows, err = db.DB.Query(`
+		SELECT DISTINCT s.id, s.shipment_code, s.status, COALESCE(s.sender_id, 0), COALESCE(s.departure_time, s.created_at)
+		FROM shipment s
+		JOIN shipment_item si ON si.shipment_id = s.id AND si.is_active = true
+		WHERE si.batch_id = $1 AND s.is_active = true
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		hop := ProvenanceHop{HopType: "shipment", RecordTable: "shipment"}
+		var code, status string
+		if err := rows.Scan(&hop.RecordID, &code, &status, &hop.ActorID, &hop.Timestamp); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hop.Description = fmt.Sprintf("Shipment %s (%s)", code, status)
+		hops = append(hops, hop)
+	}
+	rows.Close()
+
+	rows, err = db.DB.Query(`
+		SELECT id, COALESCE(doc_type, ''), COALESCE(uploaded_by, 0), uploaded_at
+		FROM document
+		WHERE batch_id = $1 AND is_active = true`+documentSensitivityFilter("", 2)+`
+	`, batchID, docLevels)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		hop := ProvenanceHop{HopType: "document", RecordTable: "document"}
+		var docType string
+		if err := rows.Scan(&hop.RecordID, &docType, &hop.ActorID, &hop.Timestamp); err != nil {
+			return nil, err
+		}
+		hop.Description = "Document uploaded: " + docType
+		hops = append(hops, hop)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	parentHops, err := collectBroodstockHops(batchID, docLevels)
+	if err != nil {
+		return nil, err
+	}
+	return append(hops, parentHops...), nil
+}
+
+// collectBroodstockHops loads the events and documents of the broodstock a batch was produced from
+func collectBroodstockHops(batchID int, docLevels interface{}) ([]ProvenanceHop, error) {
+	hops := []ProvenanceHop{}
+
+	rows, err := db.DB.Query(`
+		SELECT e.id, b.tag_code, COALESCE(e.event_type, ''), COALESCE(e.actor_id, 0), COALESCE(e.timestamp, e.updated_at)
+		FROM broodstock_event e
+		JOIN broodstock b ON b.id = e.broodstock_id
+		WHERE e.is_active = true AND e.broodstock_id IN (SELECT broodstock_id FROM batch_broodstock WHERE batch_id = $1)
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		hop := ProvenanceHop{HopType: "broodstock_event", RecordTable: "broodstock_event"}
+		var tagCode, eventType string
+		if err := rows.Scan(&hop.RecordID, &tagCode, &eventType, &hop.ActorID, &hop.Timestamp); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hop.Description = fmt.Sprintf("Broodstock %s: %s", tagCode, eventType)
+		hops = append(hops, hop)
+	}
+	rows.Close()
+
+	rows, err = db.DB.Query(`
+		SELECT d.id, b.tag_code, COALESCE(d.doc_type, ''), COALESCE(d.uploaded_by, 0), d.uploaded_at
+		FROM document d
+		JOIN broodstock b ON b.id = d.broodstock_id
+		WHERE d.is_active = true AND d.broodstock_id IN (SELECT broodstock_id FROM batch_broodstock WHERE batch_id = $1)`+documentSensitivityFilter("d", 2)+`
+	`, batchID, docLevels)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		hop := ProvenanceHop{HopType: "broodstock_document", RecordTable: "document"}
+		var tagCode, docType string
+		if err := rows.Scan(&hop.RecordID, &tagCode, &docType, &hop.ActorID, &hop.Timestamp); err != nil {
+			return nil, err
+		}
+		hop.Description = fmt.Sprintf("Broodstock %s document uploaded: %s", tagCode, docType)
+		hops = append(hops, hop)
+	}
+	return hops, rows.Err()
+}
+
+// loadProvenanceAnchors loads the latest blockchain anchor of every record related to a batch
+func loadProvenanceAnchors(batchID int) (map[string]blockchainAnchor, error) {
+	rows, err := db.DB.Query(`
+		SELECT related_table, related_id, COALESCE(tx_id, ''), COALESCE(metadata_hash, '')
+		FROM blockchain_record
+		WHERE is_active = true AND (
+			(related_table = 'batch' AND related_id = $1)
+			OR (related_table = 'event' AND related_id IN (SELECT id FROM event WHERE batch_id = $1))
+			OR (related_table = 'shipment_transfer' AND related_id IN (SELECT id FROM shipment_transfer WHERE batch_id = $1))
+			OR (related_table = 'shipment' AND related_id IN (SELECT shipment_id FROM shipment_item WHERE batch_id = $1))
+			OR (related_table = 'document' AND related_id IN (SELECT id FROM document WHERE batch_id = $1
+				OR broodstock_id IN (SELECT broodstock_id FROM batch_broodstock WHERE batch_id = $1)))
+			OR (related_table = 'broodstock_event' AND related_id IN (SELECT id FROM broodstock_event
+				WHERE broodstock_id IN (SELECT broodstock_id FROM batch_broodstock WHERE batch_id = $1)))
+		)
+		ORDER BY created_at
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anchors := map[string]blockchainAnchor{}
+	for rows.Next() {
+		var table string
+		var id int
+		var anchor blockchainAnchor
+		if err := rows.Scan(&table, &id, &anchor.TxID, &anchor.MetadataHash); err != nil {
+			return nil, err
+		}
+		// Later anchors supersede earlier ones for the same record
+		anchors[provenanceAnchorKey(table, id)] = anchor
+	}
+	return anchors, rows.Err()
+}
+
+// provenanceAnchorKey builds the lookup key of an anchored record
+func provenanceAnchorKey(table string, id int) string {
+	return table + ":" + strconv.Itoa(id)
+}
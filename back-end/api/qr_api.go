@@ -6,6 +6,8 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/skip2/go-qrcode"
 	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/features"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
 	"os"
 	"strconv"
 	"time"
@@ -16,13 +18,18 @@ import (
 // @Description Generate a QR code with configuration information about a batch
 // @Tags qr
 // @Accept json
-// @Produce image/png,application/json
+// @Produce image/png,image/svg+xml,application/json
 // @Param batchId path string true "Batch ID"
-// @Param format query string false "Format: 'png' or 'json' (default: 'png')"
+// @Param format query string false "Format: 'png', 'svg' or 'json' (default: 'png')"
 // @Param size query int false "QR code size in pixels (default: 512)"
+// @Param ecc query string false "Error correction level: L, M, Q or H (default: the company's, or chosen by data size)"
+// @Param fg query string false "Foreground color as #RRGGBB (default: the company's)"
+// @Param bg query string false "Background color as #RRGGBB (default: the company's)"
+// @Param logo query bool false "Overlay the company logo when it has one (default: true)"
 // @Success 200 {file} byte[] "QR code image or JSON data"
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /qr/config/{batchId} [get]
 func ConfigQRCode(c *fiber.Ctx) error {
@@ -37,10 +44,10 @@ func ConfigQRCode(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
 	}
 	
-	// Check format (png or json)
+	// Check format (png, svg or json)
 	format := c.Query("format", "png")
-	if format != "png" && format != "json" {
-		return fiber.NewError(fiber.StatusBadRequest, "Format must be png or json")
+	if format != "png" && format != "svg" && format != "json" {
+		return fiber.NewError(fiber.StatusBadRequest, "Format must be png, svg or json")
 	}
 	
 	// Get QR code size if provided
@@ -93,7 +100,7 @@ func ConfigQRCode(c *fiber.Ctx) error {
 
 	// 2. Get environment data for configuration details
 	rows, err := db.DB.Query(`
-		SELECT id, temperature, ph, salinity, density, age, timestamp
+		SELECT id, temperature, ph, salinity, density, age, COALESCE(custom_parameters, '{}'), timestamp
 		FROM environment_data
 		WHERE batch_id = $1 AND is_active = true
 		ORDER BY timestamp DESC
@@ -109,6 +116,7 @@ func ConfigQRCode(c *fiber.Ctx) error {
 		var id int
 		var temperature, ph, salinity, density float64
 		var age int
+		var customParameters []byte
 		var timestamp time.Time
 		
 		err := rows.Scan(
@@ -118,6 +126,7 @@ func ConfigQRCode(c *fiber.Ctx) error {
 			&salinity,
 			&density,
 			&age,
+			&customParameters,
 			&timestamp,
 		)
 				
@@ -129,6 +138,7 @@ func ConfigQRCode(c *fiber.Ctx) error {
 				"salinity":    salinity,
 				"density":     density,
 				"age":         age,
+				"parameters":  decodeEnvironmentParameters(customParameters),
 				"timestamp":   timestamp.Format(time.RFC3339),
 			}
 		}
@@ -161,7 +171,7 @@ func ConfigQRCode(c *fiber.Ctx) error {
 		return c.JSON(configResponse)
 	}
 
-	// For PNG format, generate QR code
+	// For image formats, generate QR code
 	jsonData, err := json.Marshal(configResponse)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate QR data")
@@ -179,23 +189,12 @@ func ConfigQRCode(c *fiber.Ctx) error {
 		qrLevel = qrcode.High
 	}
 	
-	qr, err := qrcode.New(string(jsonData), qrLevel)
+	// Draw the QR code with the company's branding and the requested options
+	style, err := batchQRStyle(c, batchID, qrLevel)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate QR code")
+		return err
 	}
-	
-	// Set QR code options
-	qr.DisableBorder = false
-	
-	// Create PNG image with requested size
-	png, err := qr.PNG(size)
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate QR image")
-	}
-	
-	// Set content type and return image
-	c.Set("Content-Type", "image/png")
-	return c.Send(png)
+	return sendQRCode(c, string(jsonData), size, style, format)
 }
 
 // BlockchainQRCode generates a QR code containing blockchain traceability information
@@ -203,13 +202,18 @@ func ConfigQRCode(c *fiber.Ctx) error {
 // @Description Generate a QR code with blockchain traceability information about a batch
 // @Tags qr
 // @Accept json
-// @Produce image/png,application/json
+// @Produce image/png,image/svg+xml,application/json
 // @Param batchId path string true "Batch ID"
-// @Param format query string false "Format: 'png' or 'json' (default: 'png')"
+// @Param format query string false "Format: 'png', 'svg' or 'json' (default: 'png')"
 // @Param size query int false "QR code size in pixels (default: 512)"
+// @Param ecc query string false "Error correction level: L, M, Q or H (default: the company's, or chosen by data size)"
+// @Param fg query string false "Foreground color as #RRGGBB (default: the company's)"
+// @Param bg query string false "Background color as #RRGGBB (default: the company's)"
+// @Param logo query bool false "Overlay the company logo when it has one (default: true)"
 // @Success 200 {file} byte[] "QR code image or JSON data"
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /qr/blockchain/{batchId} [get]
 func BlockchainQRCode(c *fiber.Ctx) error {
@@ -224,10 +228,10 @@ func BlockchainQRCode(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
 	}
 	
-	// Check format (png or json)
+	// Check format (png, svg or json)
 	format := c.Query("format", "png")
-	if format != "png" && format != "json" {
-		return fiber.NewError(fiber.StatusBadRequest, "Format must be png or json")
+	if format != "png" && format != "svg" && format != "json" {
+		return fiber.NewError(fiber.StatusBadRequest, "Format must be png, svg or json")
 	}
 	
 	// Get QR code size if provided
@@ -254,11 +258,12 @@ func BlockchainQRCode(c *fiber.Ctx) error {
 		Species      string    `json:"species"`
 		Status       string    `json:"status"`
 		HatcheryName string    `json:"hatchery_name"`
+		CompanyID    int       `json:"-"`
 		CreatedAt    time.Time `json:"created_at"`
 	}
 	
 	err = db.DB.QueryRow(`
-		SELECT b.id, b.species, b.status, h.name, b.created_at
+		SELECT b.id, b.species, b.status, h.name, COALESCE(h.company_id, 0), b.created_at
 		FROM batch b
 		JOIN hatchery h ON b.hatchery_id = h.id
 		WHERE b.id = $1 AND b.is_active = true
@@ -267,6 +272,7 @@ func BlockchainQRCode(c *fiber.Ctx) error {
 		&batchInfo.Species,
 		&batchInfo.Status,
 		&batchInfo.HatcheryName,
+		&batchInfo.CompanyID,
 		&batchInfo.CreatedAt,
 	)
 	if err != nil {
@@ -274,31 +280,37 @@ func BlockchainQRCode(c *fiber.Ctx) error {
 	}
 
 	// 2. Get blockchain verification records
-	blockchainRecords, err := getBlockchainRecordsForBatch(batchID)
-	if err != nil {
-		fmt.Printf("Warning: Failed to retrieve blockchain records: %v\n", err)
+	// Under load the blockchain records and the transfer chain are skipped; the verification link still works
+	degraded := middleware.IsDegraded(c)
+	var blockchainRecords []map[string]interface{}
+	if !degraded {
+		blockchainRecords, err = getBlockchainRecordsForBatch(batchID)
+		if err != nil {
+			fmt.Printf("Warning: Failed to retrieve blockchain records: %v\n", err)
+		}
 	}
 
 	// Determine current location from transfers if available
-	var currentLocation string
-	err = db.DB.QueryRow(`
-		SELECT CASE 
-			WHEN t.status = 'completed' THEN t.receiver_id
-			ELSE c.location
-		END as current_location
-		FROM batch b
-		JOIN hatchery h ON b.hatchery_id = h.id
-		JOIN company c ON h.company_id = c.id
-		LEFT JOIN (
-			SELECT * FROM shipment_transfer 
-			WHERE batch_id = $1 AND is_active = true 
-			ORDER BY transfer_time DESC LIMIT 1
-		) t ON true
-		WHERE b.id = $1
-	`, batchID).Scan(&currentLocation)
-	
-	if err != nil {
-		currentLocation = "Unknown"
+	currentLocation := "Unavailable"
+	if !degraded {
+		err = db.DB.QueryRow(`
+			SELECT CASE 
+				WHEN t.status = 'completed' THEN t.receiver_id
+				ELSE c.location
+			END as current_location
+			FROM batch b
+			JOIN hatchery h ON b.hatchery_id = h.id
+			JOIN company c ON h.company_id = c.id
+			LEFT JOIN (
+				SELECT * FROM shipment_transfer 
+				WHERE batch_id = $1 AND is_active = true 
+				ORDER BY transfer_time DESC LIMIT 1
+			) t ON true
+			WHERE b.id = $1
+		`, batchID).Scan(&currentLocation)
+		if err != nil {
+			currentLocation = "Unknown"
+		}
 	}
 
 	// Get server base URL from environment or use a default
@@ -323,9 +335,52 @@ func BlockchainQRCode(c *fiber.Ctx) error {
 		"blockchain":   blockchainRecords,
 		"verification": fmt.Sprintf("%s/api/v1/batches/%d/verify", baseURL, batchID),
 	}
+	if degraded {
+		blockchainResponse["degraded"] = true
+	}
+
+	// The latest IPFS snapshot resolves even when this API is down
+	var snapshotURI string
+	err = db.DB.QueryRow(`
+		SELECT json_uri FROM trace_snapshot WHERE batch_id = $1 ORDER BY version DESC LIMIT 1
+	`, batchID).Scan(&snapshotURI)
+	if err == nil {
+		blockchainResponse["snapshot"] = snapshotURI
+	}
+
+	// Genetics and label claims, with the verification status of each claim
+	var strainCode, strainLineType, strainSupplier string
+	err = db.DB.QueryRow(`
+		SELECT s.code, COALESCE(s.line_type, ''), COALESCE(s.supplier, '')
+		FROM batch b
+		JOIN strain s ON s.id = b.strain_id
+		WHERE b.id = $1
+	`, batchID).Scan(&strainCode, &strainLineType, &strainSupplier)
+	if err == nil {
+		blockchainResponse["strain"] = map[string]interface{}{
+			"code":      strainCode,
+			"line_type": strainLineType,
+			"supplier":  strainSupplier,
+		}
+	}
+	claims, err := loadBatchClaims(batchID)
+	if err != nil {
+		fmt.Printf("Warning: Failed to verify batch claims: %v\n", err)
+	}
+	claimStatuses := map[string]string{}
+	for _, claim := range claims {
+		claimStatuses[claim.Claim] = claim.Status
+	}
+	blockchainResponse["claims"] = claimStatuses
 
 	// If JSON format is requested, return data directly
 	if format == "json" {
+		// Consumer page content is only returned to frontends, it would not fit in the QR code
+		contentBlocks, err := loadTraceContentBlocks(batchID)
+		if err != nil {
+			fmt.Printf("Warning: Failed to retrieve content blocks: %v\n", err)
+		}
+		blockchainResponse["content_blocks"] = contentBlocks
 		return c.JSON(blockchainResponse)
 	}
 
@@ -334,6 +389,11 @@ func BlockchainQRCode(c *fiber.Ctx) error {
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate QR data")
 	}
+
+	// Companies on the compact format get a short verification link, which scans faster than JSON
+	if features.Default().Enabled(features.QRCompactLink, batchInfo.CompanyID) {
+		jsonData = []byte(fmt.Sprintf("%s/api/v1/batches/%d/verify", baseURL, batchID))
+	}
 	
 	// Check data size and adjust if necessary
 	dataSize := len(jsonData)
@@ -345,8 +405,12 @@ func BlockchainQRCode(c *fiber.Ctx) error {
 			"status":       batchInfo.Status,
 			"origin":       batchInfo.HatcheryName,
 			"location":     currentLocation,
+			"claims":       claimStatuses,
 			"verification": fmt.Sprintf("%s/api/v1/batches/%d/verify", baseURL, batchID),
 		}
+		if snapshotURI != "" {
+			simplifiedData["snapshot"] = snapshotURI
+		}
 		
 		if len(blockchainRecords) > 0 {
 			simplifiedData["latest_tx"] = blockchainRecords[0]["tx_id"]
@@ -368,23 +432,12 @@ func BlockchainQRCode(c *fiber.Ctx) error {
 		qrLevel = qrcode.High
 	}
 	
-	qr, err := qrcode.New(string(jsonData), qrLevel)
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate QR code")
-	}
-	
-	// Set QR code options
-	qr.DisableBorder = false
-	
-	// Create PNG image with requested size
-	png, err := qr.PNG(size)
+	// Draw the QR code with the company's branding and the requested options
+	style, err := batchQRStyle(c, batchID, qrLevel)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate QR image")
+		return err
 	}
-	
-	// Set content type and return image
-	c.Set("Content-Type", "image/png")
-	return c.Send(png)
+	return sendQRCode(c, string(jsonData), size, style, format)
 }
 
 // DocumentQRCode generates a QR code containing IPFS document links for a batch
@@ -392,13 +445,18 @@ func BlockchainQRCode(c *fiber.Ctx) error {
 // @Description Generate a QR code with document IPFS links for a batch
 // @Tags qr
 // @Accept json
-// @Produce image/png,application/json
+// @Produce image/png,image/svg+xml,application/json
 // @Param batchId path string true "Batch ID"
-// @Param format query string false "Format: 'png' or 'json' (default: 'png')"
+// @Param format query string false "Format: 'png', 'svg' or 'json' (default: 'png')"
 // @Param size query int false "QR code size in pixels (default: 512)"
+// @Param ecc query string false "Error correction level: L, M, Q or H (default: the company's, or chosen by data size)"
+// @Param fg query string false "Foreground color as #RRGGBB (default: the company's)"
+// @Param bg query string false "Background color as #RRGGBB (default: the company's)"
+// @Param logo query bool false "Overlay the company logo when it has one (default: true)"
 // @Success 200 {file} byte[] "QR code image or JSON data"
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /qr/document/{batchId} [get]
 func DocumentQRCode(c *fiber.Ctx) error {
@@ -413,10 +471,10 @@ func DocumentQRCode(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
 	}
 	
-	// Check format (png or json)
+	// Check format (png, svg or json)
 	format := c.Query("format", "png")
-	if format != "png" && format != "json" {
-		return fiber.NewError(fiber.StatusBadRequest, "Format must be png or json")
+	if format != "png" && format != "svg" && format != "json" {
+		return fiber.NewError(fiber.StatusBadRequest, "Format must be png, svg or json")
 	}
 	
 	// Get QR code size if provided
@@ -437,14 +495,18 @@ func DocumentQRCode(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
 	}
 
-	// Get documents for this batch to find the most recent IPFS hash
+	// Get documents for this batch to find the most recent IPFS hash the caller may see
+	docLevels, err := visibleBatchDocumentLevels(c, batchID)
+	if err != nil {
+		return err
+	}
 	rows, err := db.DB.Query(`
 		SELECT ipfs_hash
 		FROM document
-		WHERE batch_id = $1 AND is_active = true
+		WHERE batch_id = $1 AND is_active = true`+documentSensitivityFilter("", 2)+`
 		ORDER BY uploaded_at DESC
 		LIMIT 1
-	`, batchID)
+	`, batchID, docLevels)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve documents")
 	}
@@ -480,22 +542,10 @@ func DocumentQRCode(c *fiber.Ctx) error {
 		return c.JSON(map[string]string{"ipfs_uri": ipfsUri})
 	}
 
-	// For PNG format, generate QR code with just the IPFS URI
-	qr, err := qrcode.New(ipfsUri, qrcode.Medium)
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate QR code")
-	}
-	
-	// Set QR code options
-	qr.DisableBorder = false
-	
-	// Create PNG image with requested size
-	png, err := qr.PNG(size)
+	// For image formats, generate QR code with just the IPFS URI
+	style, err := batchQRStyle(c, batchID, qrcode.Medium)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate QR image")
+		return err
 	}
-	
-	// Set content type and return image
-	c.Set("Content-Type", "image/png")
-	return c.Send(png)
+	return sendQRCode(c, ipfsUri, size, style, format)
 }
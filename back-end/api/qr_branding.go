@@ -0,0 +1,489 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+)
+
+// maxQRSheetBatches is the most batches printed on one label sheet request
+const maxQRSheetBatches = 200
+
+// QRBranding is how a company's QR codes are drawn
+type QRBranding struct {
+	CompanyID       int        `json:"company_id"`
+	ErrorCorrection string     `json:"error_correction"` // L, M, Q or H
+	Foreground      string     `json:"foreground"`
+	Background      string     `json:"background"`
+	HasLogo         bool       `json:"has_logo"`
+	LogoContentType string     `json:"logo_content_type,omitempty"`
+	LogoScale       float64    `json:"logo_scale"` // Width of the logo as a share of the QR code
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+}
+
+// QRBrandingRequest updates how a company's QR codes are drawn
+type QRBrandingRequest struct {
+	ErrorCorrection string   `json:"error_correction"`
+	Foreground      string   `json:"foreground"`
+	Background      string   `json:"background"`
+	LogoScale       *float64 `json:"logo_scale,omitempty"`
+}
+
+// loadQRBranding loads a company's QR branding and the style it draws, the defaults when it has none
+func loadQRBranding(companyID int) (QRBranding, utils.QRStyle, error) {
+	style := utils.DefaultQRStyle()
+	branding := QRBranding{
+		CompanyID:       companyID,
+		ErrorCorrection: utils.RecoveryLevelName(style.Level),
+		Foreground:      utils.HexColor(style.Foreground),
+		Background:      utils.HexColor(style.Background),
+		LogoScale:       style.LogoScale,
+	}
+	var logo []byte
+	var contentType sql.NullString
+	var updatedAt time.Time
+	err := db.DB.QueryRow(`
+		SELECT error_correction, foreground, background, logo, logo_content_type, logo_scale, updated_at
+		FROM company_qr_branding WHERE company_id = $1
+	`, companyID).Scan(&branding.ErrorCorrection, &branding.Foreground, &branding.Background, &logo, &contentType, &branding.LogoScale, &updatedAt)
+	if err == sql.ErrNoRows {
+		return branding, style, nil
+	}
+	if err != nil {
+		return branding, style, err
+	}
+	branding.UpdatedAt = &updatedAt
+	branding.LogoContentType = contentType.String
+
+	if level, err := utils.ParseRecoveryLevel(branding.ErrorCorrection); err == nil {
+		style.Level = level
+	}
+	if fg, err := utils.ParseHexColor(branding.Foreground); err == nil {
+		style.Foreground = fg
+	}
+	if bg, err := utils.ParseHexColor(branding.Background); err == nil {
+		style.Background = bg
+	}
+	style.LogoScale = branding.LogoScale
+	if len(logo) > 0 {
+		if style.Logo, _, err = utils.DecodeLogo(logo); err != nil {
+			fmt.Printf("Warning: failed to decode QR logo of company %d: %v\n", companyID, err)
+		}
+		branding.HasLogo = style.Logo != nil
+	}
+	return branding, style, nil
+}
+
+// qrStyleForRequest builds the style of a company's QR code, letting the query override the branding:
+// ecc sets the error correction, fg and bg the colors, and logo=false leaves the logo out
+func qrStyleForRequest(c *fiber.Ctx, companyID int, defaultLevel qrcode.RecoveryLevel) (utils.QRStyle, error) {
+	style := utils.DefaultQRStyle()
+	style.Level = defaultLevel
+	if companyID != 0 {
+		branding, branded, err := loadQRBranding(companyID)
+		if err != nil {
+			return style, fiber.NewError(fiber.StatusInternalServerError, "Failed to load QR branding")
+		}
+		if branding.UpdatedAt != nil {
+			// An explicit company level wins unless the content needs more correction
+			if branded.Level < defaultLevel {
+				branded.Level = defaultLevel
+			}
+			style = branded
+		}
+	}
+
+	if fg := c.Query("fg"); fg != "" {
+		color, err := utils.ParseHexColor(fg)
+		if err != nil {
+			return style, fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		style.Foreground = color
+	}
+	if bg := c.Query("bg"); bg != "" {
+		color, err := utils.ParseHexColor(bg)
+		if err != nil {
+			return style, fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		style.Background = color
+	}
+	if !c.QueryBool("logo", true) {
+		style.Logo = nil
+	}
+	if ecc := c.Query("ecc"); ecc != "" {
+		level, err := utils.ParseRecoveryLevel(ecc)
+		if err != nil {
+			return style, fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		style.Level = level
+	} else if style.Logo != nil && style.Level < qrcode.High {
+		// The logo hides modules, so the code needs enough correction to recover them
+		style.Level = qrcode.High
+	}
+
+	if err := style.Validate(); err != nil {
+		return style, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return style, nil
+}
+
+// batchQRStyle builds the QR style of the company owning a batch
+func batchQRStyle(c *fiber.Ctx, batchID int, defaultLevel qrcode.RecoveryLevel) (utils.QRStyle, error) {
+	var companyID sql.NullInt64
+	err := db.DB.QueryRow(`
+		SELECT `+batchOwnerCompany+` FROM batch b LEFT JOIN hatchery h ON h.id = b.hatchery_id WHERE b.id = $1
+	`, batchID).Scan(&companyID)
+	if err != nil && err != sql.ErrNoRows {
+		return utils.QRStyle{}, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	return qrStyleForRequest(c, int(companyID.Int64), defaultLevel)
+}
+
+// sendQRCode responds with a styled QR code as a PNG or SVG image
+func sendQRCode(c *fiber.Ctx, content string, size int, style utils.QRStyle, format string) error {
+	if format == "svg" {
+		svg, err := utils.RenderQRSVG(content, size, style)
+		if err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("Failed to generate QR code at error correction %s: %v", utils.RecoveryLevelName(style.Level), err))
+		}
+		c.Set("Content-Type", "image/svg+xml")
+		return c.Send(svg)
+	}
+	png, err := utils.RenderQRPNG(content, size, style)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("Failed to generate QR code at error correction %s: %v", utils.RecoveryLevelName(style.Level), err))
+	}
+	c.Set("Content-Type", "image/png")
+	return c.Send(png)
+}
+
+// GetQRBranding gets how a company's QR codes are drawn
+// @Summary Get QR branding
+// @Description Get the error correction, colors and logo a company's QR codes are drawn with
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=QRBranding}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/qr-branding [get]
+func GetQRBranding(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	branding, _, err := loadQRBranding(companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load QR branding")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "QR branding retrieved successfully",
+		Data:    branding,
+	})
+}
+
+// UpdateQRBranding sets how a company's QR codes are drawn
+// @Summary Update QR branding
+// @Description Set the error correction level and colors of a company's QR codes. The foreground must be darker than the background with a contrast of at least 4.5:1, and a logo needs error correction Q or H.
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param request body QRBrandingRequest true "QR branding"
+// @Success 200 {object} SuccessResponse{data=QRBranding}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/qr-branding [put]
+func UpdateQRBranding(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+	var req QRBrandingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	branding, style, err := loadQRBranding(companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load QR branding")
+	}
+	if req.ErrorCorrection != "" {
+		if style.Level, err = utils.ParseRecoveryLevel(req.ErrorCorrection); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+	if req.Foreground != "" {
+		if style.Foreground, err = utils.ParseHexColor(req.Foreground); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+	if req.Background != "" {
+		if style.Background, err = utils.ParseHexColor(req.Background); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+	if req.LogoScale != nil {
+		style.LogoScale = *req.LogoScale
+	}
+	if err := style.Validate(); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	if _, err := db.DB.Exec(`
+		INSERT INTO company_qr_branding (company_id, error_correction, foreground, background, logo_scale, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NOW())
+		ON CONFLICT (company_id) DO UPDATE SET error_correction = EXCLUDED.error_correction, foreground = EXCLUDED.foreground,
+			background = EXCLUDED.background, logo_scale = EXCLUDED.logo_scale, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+	`, companyID, utils.RecoveryLevelName(style.Level), utils.HexColor(style.Foreground), utils.HexColor(style.Background), style.LogoScale, userID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update QR branding")
+	}
+
+	if branding, _, err = loadQRBranding(companyID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load QR branding")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "QR branding updated successfully",
+		Data:    branding,
+	})
+}
+
+// UploadQRBrandingLogo sets the logo overlaid on a company's QR codes
+// @Summary Upload QR logo
+// @Description Upload the PNG or JPEG logo overlaid at the center of a company's QR codes. Error correction is raised to Q when it is lower.
+// @Tags companies
+// @Accept multipart/form-data
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param logo formData file true "Logo image, at most 1MB"
+// @Success 200 {object} SuccessResponse{data=QRBranding}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/qr-branding/logo [put]
+func UploadQRBrandingLogo(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+	file, err := c.FormFile("logo")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Logo file is required")
+	}
+	if file.Size > 1024*1024 {
+		return fiber.NewError(fiber.StatusBadRequest, "Logo size exceeds 1MB limit")
+	}
+	fileHandle, err := file.Open()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to open file")
+	}
+	defer fileHandle.Close()
+	data, err := io.ReadAll(fileHandle)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to read file")
+	}
+	_, contentType, err := utils.DecodeLogo(data)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	if _, err := db.DB.Exec(`
+		INSERT INTO company_qr_branding (company_id, error_correction, logo, logo_content_type, updated_by, updated_at)
+		VALUES ($1, 'Q', $2, $3, NULLIF($4, 0), NOW())
+		ON CONFLICT (company_id) DO UPDATE SET logo = EXCLUDED.logo, logo_content_type = EXCLUDED.logo_content_type,
+			error_correction = CASE WHEN company_qr_branding.error_correction IN ('L', 'M') THEN 'Q' ELSE company_qr_branding.error_correction END,
+			logo_scale = LEAST(company_qr_branding.logo_scale, 0.25), updated_by = EXCLUDED.updated_by, updated_at = NOW()
+	`, companyID, data, contentType, userID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save QR logo")
+	}
+
+	branding, _, err := loadQRBranding(companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load QR branding")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "QR logo uploaded successfully",
+		Data:    branding,
+	})
+}
+
+// GetQRBrandingLogo gets the logo overlaid on a company's QR codes
+// @Summary Get QR logo
+// @Description Get the logo overlaid at the center of a company's QR codes
+// @Tags companies
+// @Produce image/png,image/jpeg
+// @Param companyId path int true "Company ID"
+// @Success 200 {file} byte[] "Logo image"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/qr-branding/logo [get]
+func GetQRBrandingLogo(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	var logo []byte
+	var contentType sql.NullString
+	err = db.DB.QueryRow("SELECT logo, logo_content_type FROM company_qr_branding WHERE company_id = $1", companyID).Scan(&logo, &contentType)
+	if err != nil && err != sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if len(logo) == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Company has no QR logo")
+	}
+	c.Set("Content-Type", contentType.String)
+	return c.Send(logo)
+}
+
+// DeleteQRBrandingLogo removes the logo overlaid on a company's QR codes
+// @Summary Delete QR logo
+// @Description Stop overlaying a logo on a company's QR codes
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=QRBranding}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/qr-branding/logo [delete]
+func DeleteQRBrandingLogo(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	if err := actsForCompany(c, companyID); err != nil {
+		return err
+	}
+
+	if _, err := db.DB.Exec(`
+		UPDATE company_qr_branding SET logo = NULL, logo_content_type = NULL, updated_at = NOW() WHERE company_id = $1
+	`, companyID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete QR logo")
+	}
+
+	branding, _, err := loadQRBranding(companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load QR branding")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "QR logo deleted successfully",
+		Data:    branding,
+	})
+}
+
+// QRLabelSheet renders the trace QR codes of several batches on printable label sheets
+// @Summary QR label sheet
+// @Description Render the trace QR codes of up to 200 batches in a grid on A4 sheets, each drawn with its company's QR branding and captioned with the batch ID and species
+// @Tags qr
+// @Produce application/pdf
+// @Param batch_ids query string true "Comma separated batch IDs"
+// @Param columns query int false "Labels per row (default: 3)"
+// @Param rows query int false "Rows of labels per sheet (default: 8)"
+// @Param ecc query string false "Error correction level: L, M, Q or H (default: the company's)"
+// @Param fg query string false "Foreground color as #RRGGBB (default: the company's)"
+// @Param bg query string false "Background color as #RRGGBB (default: the company's)"
+// @Param logo query bool false "Overlay the company logo when it has one (default: true)"
+// @Success 200 {file} byte[] "PDF label sheets"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /qr/labels [get]
+func QRLabelSheet(c *fiber.Ctx) error {
+	var batchIDs []int
+	for _, part := range strings.Split(c.Query("batch_ids"), ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		batchID, err := strconv.Atoi(part)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format: "+part)
+		}
+		batchIDs = append(batchIDs, batchID)
+	}
+	if len(batchIDs) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "batch_ids is required")
+	}
+	if len(batchIDs) > maxQRSheetBatches {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("At most %d batches fit in one request", maxQRSheetBatches))
+	}
+	layout := utils.DefaultQRSheetLayout()
+	layout.Columns = c.QueryInt("columns", layout.Columns)
+	layout.Rows = c.QueryInt("rows", layout.Rows)
+	if layout.Columns < 1 || layout.Columns > 10 || layout.Rows < 1 || layout.Rows > 20 {
+		return fiber.NewError(fiber.StatusBadRequest, "Columns must be between 1 and 10 and rows between 1 and 20")
+	}
+
+	styles := map[int]utils.QRStyle{}
+	items := make([]utils.QRSheetItem, 0, len(batchIDs))
+	for _, batchID := range batchIDs {
+		var species string
+		var companyID sql.NullInt64
+		err := db.DB.QueryRow(`
+			SELECT b.species, `+batchOwnerCompany+` FROM batch b LEFT JOIN hatchery h ON h.id = b.hatchery_id
+			WHERE b.id = $1 AND b.is_active = true
+		`, batchID).Scan(&species, &companyID)
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Batch %d not found", batchID))
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+
+		company := int(companyID.Int64)
+		style, ok := styles[company]
+		if !ok {
+			if style, err = qrStyleForRequest(c, company, qrcode.Medium); err != nil {
+				return err
+			}
+			styles[company] = style
+		}
+		// The QR code points at the company's white-label domain once it is verified
+		baseURL := companyTraceBaseURL(company)
+		if baseURL == "" {
+			baseURL = config.GetConfig().BaseURL
+		}
+		items = append(items, utils.QRSheetItem{
+			Content: fmt.Sprintf("%s/api/v1/mobile/trace/%d", baseURL, batchID),
+			Caption: []string{fmt.Sprintf("Batch #%d", batchID), species},
+			Style:   style,
+		})
+	}
+
+	pdf, err := utils.RenderQRSheetPDF(items, layout)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "Failed to generate label sheet: "+err.Error())
+	}
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", "inline; filename=qr-labels.pdf")
+	return c.Send(pdf)
+}
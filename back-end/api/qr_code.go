@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/skip2/go-qrcode"
+	"github.com/LTPPPP/TracePost-larvaeChain/actors"
 	"github.com/LTPPPP/TracePost-larvaeChain/db"
 	"os"
 	"strconv"
@@ -106,13 +107,11 @@ func UnifiedTraceByQRCode(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Failed to retrieve batch data: %v", err))
 	}
 
-	// 2. Get all events with actor information
+	// 2. Get all events; their actors are resolved together once read
 	rows, err := db.DB.Query(`
-		SELECT e.id, e.event_type, e.actor_id, e.location, e.timestamp, e.metadata,
-			   a.username, a.role
+		SELECT e.id, e.event_type, e.actor_id, e.location, e.timestamp, e.metadata
 		FROM event e
-		JOIN account a ON e.actor_id = a.id
-		WHERE e.batch_id = $1 AND e.is_active = true
+		WHERE e.batch_id = $1 AND e.is_active = true AND e.superseded_by_event_id IS NULL
 		ORDER BY e.timestamp
 	`, batchID)
 	if err != nil {
@@ -120,11 +119,18 @@ func UnifiedTraceByQRCode(c *fiber.Ctx) error {
 	}
 	defer rows.Close()
 
+	// Corrected events show their latest values, with the earlier versions as correction history
+	corrections, err := loadEventCorrections(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve event corrections")
+	}
+
 	var events []map[string]interface{}
+	var actorIDs []int
 	for rows.Next() {
 		event := map[string]interface{}{}
 		var id int
-		var eventType, location, actorName, actorRole string
+		var eventType, location string
 		var actorID int
 		var timestamp time.Time
 		var metadata []byte
@@ -136,8 +142,6 @@ func UnifiedTraceByQRCode(c *fiber.Ctx) error {
 			&location,
 			&timestamp,
 			&metadata,
-			&actorName,
-			&actorRole,
 		)
 		if err != nil {
 			continue
@@ -148,8 +152,7 @@ func UnifiedTraceByQRCode(c *fiber.Ctx) error {
 		event["actor_id"] = actorID
 		event["location"] = location
 		event["timestamp"] = timestamp.Format(time.RFC3339)
-		event["actor_name"] = actorName
-		event["actor_role"] = actorRole
+		actorIDs = append(actorIDs, actorID)
 
 		// Parse metadata if available
 		if len(metadata) > 0 {
@@ -158,9 +161,24 @@ func UnifiedTraceByQRCode(c *fiber.Ctx) error {
 				event["details"] = metadataMap
 			}
 		}
+		if history, ok := corrections[id]; ok {
+			event["corrections"] = history
+		}
 
 		events = append(events, event)
 	}
+	resolvedActors, err := actors.Default().Accounts(actorIDs)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to resolve event actors")
+	}
+	for i, event := range events {
+		actor := resolvedActors[actorIDs[i]]
+		event["actor_name"] = actor.Username
+		event["actor_role"] = actor.Role
+		if actor.DID != "" {
+			event["actor_did"] = actor.DID
+		}
+	}
 	// 3. Get transfer history (logistics chain)
 	rows, err = db.DB.Query(`
 		SELECT id, sender_id, receiver_id, transfer_time, 
@@ -246,13 +264,17 @@ func UnifiedTraceByQRCode(c *fiber.Ctx) error {
 		fmt.Printf("Warning: Failed to retrieve blockchain records: %v\n", err)
 	}
 
-	// 6. Get documents
+	// 6. Get documents the caller may see
+	docLevels, err := visibleBatchDocumentLevels(c, batchID)
+	if err != nil {
+		return err
+	}
 	rows, err = db.DB.Query(`
 		SELECT id, doc_type, ipfs_hash, uploaded_by, uploaded_at
 		FROM document
-		WHERE batch_id = $1 AND is_active = true
+		WHERE batch_id = $1 AND is_active = true`+documentSensitivityFilter("", 2)+`
 		ORDER BY uploaded_at DESC
-	`, batchID)
+	`, batchID, docLevels)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve documents")
 	}
@@ -290,6 +312,12 @@ func UnifiedTraceByQRCode(c *fiber.Ctx) error {
 			})
 		}
 	}
+	// 7. Get the larval stage timeline
+	stageTimeline, err := loadStageTimeline(batchID)
+	if err != nil {
+		fmt.Printf("Warning: Failed to load stage timeline: %v\n", err)
+	}
+
 	// Determine current location from transfers if available
 	var currentLocation string
 	if len(transfers) > 0 {
@@ -328,6 +356,9 @@ func UnifiedTraceByQRCode(c *fiber.Ctx) error {
 		if currentLocation != "" {
 			response["location"] = currentLocation
 		}
+		if stageTimeline.Current != "" {
+			response["stage"] = stageTimeline.Current
+		}
 	} else {
 		// Create the complete response object
 		response = map[string]interface{}{
@@ -348,6 +379,7 @@ func UnifiedTraceByQRCode(c *fiber.Ctx) error {
 			"logistics":       transfers,
 			"environment":     environmentData,
 			"documents":       documents,
+			"stage_timeline":  stageTimeline,
 			"blockchain":      blockchainRecords,
 			"verification_url": fmt.Sprintf("%s/api/v1/batches/%d/verify", baseURL, batchID),
 		}
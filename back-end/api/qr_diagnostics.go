@@ -82,8 +82,12 @@ func QRCodeDiagnostics(c *fiber.Ctx) error {
 	blockchainSize := len(blockchainJSON)
 	blockchainScannable := blockchainSize < 2500 // Blockchain QR should work up to around 2.5KB
 	
-	// 3. Document QR
-	documentResponse, err := getDocumentQRData(batchID, baseURL)
+	// 3. Document QR, limited to the documents the caller may see
+	docLevels, err := visibleBatchDocumentLevels(c, batchID)
+	if err != nil {
+		return err
+	}
+	documentResponse, err := getDocumentQRData(batchID, baseURL, docLevels)
 	if err != nil {
 		fmt.Printf("Error getting document QR data: %v\n", err)
 		documentResponse = map[string]interface{}{
@@ -369,7 +373,7 @@ func getBlockchainQRData(batchID int, baseURL string) (map[string]interface{}, e
 }
 
 // Helper function to get document QR data
-func getDocumentQRData(batchID int, baseURL string) (map[string]interface{}, error) {
+func getDocumentQRData(batchID int, baseURL string, docLevels interface{}) (map[string]interface{}, error) {
 	// Get basic batch info
 	var batchInfo struct {
 		ID      int    
@@ -391,9 +395,9 @@ func getDocumentQRData(batchID int, baseURL string) (map[string]interface{}, err
 	rows, err := db.DB.Query(`
 		SELECT id, doc_type, ipfs_hash, uploaded_by, uploaded_at
 		FROM document
-		WHERE batch_id = $1 AND is_active = true
+		WHERE batch_id = $1 AND is_active = true`+documentSensitivityFilter("", 2)+`
 		ORDER BY uploaded_at DESC
-	`, batchID)
+	`, batchID, docLevels)
 	
 	if err == nil {
 		defer rows.Close()
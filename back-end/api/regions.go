@@ -0,0 +1,272 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/refdata"
+	"github.com/LTPPPP/TracePost-larvaeChain/region"
+)
+
+// globalIDTables are the tables whose records carry a region-aware global_id, by entity name
+var globalIDTables = []struct{ entity, table string }{
+	{"company", "company"},
+	{"hatchery", "hatchery"},
+	{"batch", "batch"},
+	{"event", "event"},
+	{"document", "document"},
+	{"shipment_transfer", "shipment_transfer"},
+}
+
+// RegionInfo describes the region serving a request and the replication of reference data from the others
+type RegionInfo struct {
+	Region    string               `json:"region"`
+	Endpoints map[string]string    `json:"endpoints"`
+	ReadLocal bool                 `json:"read_local"` // Reads are served by a replica in this region
+	Peers     []refdata.PeerStatus `json:"peers"`
+}
+
+// ResolvedID is a region-aware ID with where to read and write its record
+type ResolvedID struct {
+	GlobalID  string      `json:"global_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Entity    string      `json:"entity,omitempty"` // Empty when the record has not reached this region yet
+	ID        int         `json:"id,omitempty"`     // ID of the record in this region's database
+	Read      region.Hint `json:"read"`
+	Write     region.Hint `json:"write"`
+}
+
+// ReferenceDataRequest represents the value of a reference data entry
+type ReferenceDataRequest struct {
+	Value json.RawMessage `json:"value" swaggertype:"object"`
+}
+
+// GetRegions describes the region serving the request
+// @Summary Get regions
+// @Description Get the region serving the request, the API endpoints of every region and the replication of reference data from the other regions
+// @Tags regions
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=RegionInfo}
+// @Failure 500 {object} ErrorResponse
+// @Router /regions [get]
+func GetRegions(c *fiber.Ctx) error {
+	regions := region.Default()
+	peers, err := refdata.Default().Peers()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve replication status")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Regions retrieved successfully",
+		Data: RegionInfo{
+			Region:    regions.Current,
+			Endpoints: regions.Endpoints,
+			ReadLocal: db.ReadDB != nil,
+			Peers:     peers,
+		},
+	})
+}
+
+// ResolveGlobalID resolves a region-aware ID
+// @Summary Resolve global ID
+// @Description Find the record of a region-aware ID in this region and tell where to read it (this region) and write it (its home region, the one it was created in)
+// @Tags regions
+// @Produce json
+// @Param globalId path string true "Region-aware ID, e.g. vn1_01J9Z3M7XK8Q4W2YB5N6TDRF0C"
+// @Success 200 {object} SuccessResponse{data=ResolvedID}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /regions/ids/{globalId} [get]
+func ResolveGlobalID(c *fiber.Ctx) error {
+	globalID := c.Params("globalId")
+	regions := region.Default()
+	read, err := regions.Route(globalID, false)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid global ID, expected a region code and a ULID such as vn1_01J9Z3M7XK8Q4W2YB5N6TDRF0C")
+	}
+	write, _ := regions.Route(globalID, true)
+	createdAt, _ := region.CreatedAt(globalID)
+
+	resolved := ResolvedID{GlobalID: globalID, CreatedAt: createdAt.UTC(), Read: read, Write: write}
+	for _, t := range globalIDTables {
+		var id int
+		err := db.Reader().QueryRow(`SELECT id FROM `+t.table+` WHERE global_id = $1`, globalID).Scan(&id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		resolved.Entity, resolved.ID = t.entity, id
+		break
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Global ID resolved successfully",
+		Data:    resolved,
+	})
+}
+
+// GetReplicationChanges returns the reference data changed in this region, for other regions to pull
+// @Summary Get reference data changes
+// @Description Get the reference data entries changed in this region after a cursor, tombstones included. Called by other regions with the replication token.
+// @Tags regions
+// @Produce json
+// @Param X-Replication-Token header string true "Replication token"
+// @Param since query int false "Cursor: seq of the last entry pulled"
+// @Param limit query int false "Maximum number of entries"
+// @Success 200 {object} SuccessResponse{data=[]refdata.Entry}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /regions/replication/changes [get]
+func GetReplicationChanges(c *fiber.Ctx) error {
+	store := refdata.Default()
+	token := c.Get(refdata.TokenHeader)
+	if store.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(store.Token)) != 1 {
+		return fiber.NewError(fiber.StatusForbidden, "Invalid replication token")
+	}
+	since, err := strconv.ParseInt(c.Query("since", "0"), 10, 64)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid cursor")
+	}
+
+	entries, err := store.Changes(since, c.QueryInt("limit", 0))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve changes")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Changes retrieved successfully",
+		Data:    entries,
+	})
+}
+
+// ListReferenceData lists the entries of a kind of reference data
+// @Summary List reference data
+// @Description List the entries of the species catalog or the rule sets shared by every region
+// @Tags reference-data
+// @Produce json
+// @Param kind path string true "Kind (species, rule_set)"
+// @Success 200 {object} SuccessResponse{data=[]refdata.Entry}
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reference-data/{kind} [get]
+func ListReferenceData(c *fiber.Ctx) error {
+	kind := c.Params("kind")
+	if !refdata.ValidKind(kind) {
+		return fiber.NewError(fiber.StatusNotFound, "Unknown reference data kind")
+	}
+
+	entries, err := refdata.Default().List(kind)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve reference data")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Reference data retrieved successfully",
+		Data:    entries,
+	})
+}
+
+// PutReferenceData creates or replaces a reference data entry
+// @Summary Set reference data entry
+// @Description Create or replace an entry of the species catalog or the rule sets. Any region may write it; the other regions pull the change, and concurrent writes settle on the latest.
+// @Tags reference-data
+// @Accept json
+// @Produce json
+// @Param kind path string true "Kind (species, rule_set)"
+// @Param key path string true "Key, e.g. a species code"
+// @Param request body ReferenceDataRequest true "Value"
+// @Success 200 {object} SuccessResponse{data=refdata.Entry}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reference-data/{kind}/{key} [put]
+func PutReferenceData(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	kind, key := c.Params("kind"), refdata.NormalizeKey(c.Params("key"))
+	if !refdata.ValidKind(kind) {
+		return fiber.NewError(fiber.StatusNotFound, "Unknown reference data kind")
+	}
+	if key == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Key is required")
+	}
+
+	var req ReferenceDataRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	var value map[string]interface{}
+	if err := json.Unmarshal(req.Value, &value); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Value must be a JSON object")
+	}
+	userID, _ := c.Locals("userID").(int)
+
+	entry, err := refdata.Default().Put(kind, key, req.Value, userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save reference data")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Reference data saved successfully",
+		Data:    entry,
+	})
+}
+
+// DeleteReferenceData deletes a reference data entry
+// @Summary Delete reference data entry
+// @Description Delete an entry of the species catalog or the rule sets in every region
+// @Tags reference-data
+// @Produce json
+// @Param kind path string true "Kind (species, rule_set)"
+// @Param key path string true "Key"
+// @Success 200 {object} SuccessResponse{data=refdata.Entry}
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reference-data/{kind}/{key} [delete]
+func DeleteReferenceData(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	kind, key := c.Params("kind"), refdata.NormalizeKey(c.Params("key"))
+	if !refdata.ValidKind(kind) {
+		return fiber.NewError(fiber.StatusNotFound, "Unknown reference data kind")
+	}
+	store := refdata.Default()
+	existing, err := store.Get(kind, key)
+	if err == sql.ErrNoRows || (err == nil && existing.Deleted) {
+		return fiber.NewError(fiber.StatusNotFound, "Reference data entry not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	userID, _ := c.Locals("userID").(int)
+
+	entry, err := store.Delete(kind, key, userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete reference data")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Reference data deleted successfully",
+		Data:    entry,
+	})
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/runbook"
+	"github.com/LTPPPP/TracePost-larvaeChain/tracesnapshot"
+)
+
+// RunbookRequest represents a request to run a recovery operation
+type RunbookRequest struct {
+	Reason string         `json:"reason"`  // Why the operation is run, e.g. an incident reference
+	DryRun bool           `json:"dry_run"` // Report what would be done without doing it
+	Params runbook.Params `json:"params"`
+}
+
+// ListRunbookOperations lists the recovery operations
+// @Summary List runbook operations
+// @Description List the recovery operations admins can run with the parameters each takes
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]runbook.Operation}
+// @Failure 403 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/runbooks [get]
+func ListRunbookOperations(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Runbook operations retrieved successfully",
+		Data:    runbook.Operations(),
+	})
+}
+
+// RunRunbookOperation runs a recovery operation
+// @Summary Run runbook operation
+// @Description Run a recovery operation: repin-cids, reanchor-batch, rebuild-trace, replay-webhooks or resync-share. Every run needs a reason and is recorded with its parameters,
+// @Description the steps it took and their outcome. An operation cannot run twice on the same target at once, and its scope is bounded; dry_run reports the steps without taking them
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param operation path string true "Operation"
+// @Param request body RunbookRequest true "Run"
+// @Success 200 {object} SuccessResponse{data=runbook.Run}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/runbooks/{operation} [post]
+func RunRunbookOperation(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	var req RunbookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	run, err := runbook.Execute(runbook.Request{
+		Operation: c.Params("operation"),
+		Params:    req.Params,
+		Reason:    req.Reason,
+		DryRun:    req.DryRun,
+		UserID:    userID,
+	})
+	switch {
+	case errors.Is(err, runbook.ErrUnknownOperation), errors.Is(err, runbook.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, runbook.ErrInvalidParams), errors.Is(err, runbook.ErrReasonRequired):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, runbook.ErrAlreadyRunning):
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	case errors.Is(err, tracesnapshot.ErrNoRenderer):
+		return dependencyUnavailable("Trace rendering is not available", nil)
+	case err != nil:
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to run operation: "+err.Error())
+	}
+
+	message := "Operation completed: " + run.Status
+	if run.DryRun {
+		message = "Operation checked, nothing was done"
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    run,
+	})
+}
+
+// ListRunbookRuns lists recovery operation runs
+// @Summary List runbook runs
+// @Description List the latest runs of recovery operations, with who ran them, why, and what they did
+// @Tags admin
+// @Produce json
+// @Param operation query string false "Only runs of this operation"
+// @Param limit query int false "Maximum number of runs (default 50)"
+// @Success 200 {object} SuccessResponse{data=[]runbook.Run}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/runbooks/runs [get]
+func ListRunbookRuns(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	runs, err := runbook.List(c.Query("operation"), c.QueryInt("limit", 50))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve runbook runs")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Runbook runs retrieved successfully",
+		Data:    runs,
+	})
+}
+
+// GetRunbookRun retrieves a recovery operation run
+// @Summary Get runbook run
+// @Description Retrieve a run of a recovery operation with every step it took
+// @Tags admin
+// @Produce json
+// @Param runId path int true "Run ID"
+// @Success 200 {object} SuccessResponse{data=runbook.Run}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/runbooks/runs/{runId} [get]
+func GetRunbookRun(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	runID, err := strconv.Atoi(c.Params("runId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid run ID format")
+	}
+
+	run, err := runbook.Get(runID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Run not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Runbook run retrieved successfully",
+		Data:    run,
+	})
+}
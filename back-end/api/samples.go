@@ -0,0 +1,622 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Kinds of physical samples drawn from a batch
+const (
+	SampleTypeLarvae = "larvae"
+	SampleTypeTissue = "tissue"
+	SampleTypeWater  = "water"
+	SampleTypeFeed   = "feed"
+	SampleTypeOther  = "other"
+)
+
+// Sample statuses; the status follows the custody chain until a lab result arrives
+const (
+	SampleStatusCollected = "collected"
+	SampleStatusInTransit = "in_transit"
+	SampleStatusReceived  = "received"
+	SampleStatusTested    = "tested"
+)
+
+// Parties that can hold a sample
+const (
+	CustodianHatchery = "hatchery"
+	CustodianCourier  = "courier"
+	CustodianLab      = "lab"
+)
+
+// Batch events recorded along a sample's chain of custody
+const (
+	EventTypeSampleCollected       = "sample_collected"
+	EventTypeSampleCustodyTransfer = "sample_custody_transfer"
+)
+
+// Sample is a physical sample drawn from a batch for lab testing
+type Sample struct {
+	ID                 int             `json:"id"`
+	SampleCode         string          `json:"sample_code"` // Printed on the sample's QR label and quoted by the lab as sample_reference
+	BatchID            int             `json:"batch_id"`
+	SampleType         string          `json:"sample_type"`
+	Quantity           *float64        `json:"quantity,omitempty"`
+	Unit               string          `json:"unit"`
+	CollectedBy        *int            `json:"collected_by,omitempty"`
+	CollectedAt        time.Time       `json:"collected_at"`
+	CollectionLocation string          `json:"collection_location"`
+	LabID              *int            `json:"lab_id,omitempty"` // Lab the sample is sent to
+	Status             string          `json:"status"`
+	CustodianType      string          `json:"custodian_type"` // Who holds the sample now: hatchery, courier or lab
+	CustodianName      string          `json:"custodian_name"`
+	Notes              string          `json:"notes"`
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+	Custody            []SampleCustody `json:"custody,omitempty"`
+	LabResults         []LIMSResult    `json:"lab_results,omitempty"`
+}
+
+// SampleRequest represents a request to register a sample drawn from a batch
+type SampleRequest struct {
+	SampleType         string     `json:"sample_type"`
+	Quantity           *float64   `json:"quantity"`
+	Unit               string     `json:"unit"`
+	CollectedAt        *time.Time `json:"collected_at"` // Defaults to now
+	CollectionLocation string     `json:"collection_location"`
+	LabID              int        `json:"lab_id"`
+	CustodianName      string     `json:"custodian_name"` // Person at the hatchery holding the sample
+	Notes              string     `json:"notes"`
+}
+
+// SampleCustody is one hand-over in a sample's chain of custody
+type SampleCustody struct {
+	ID            int       `json:"id"`
+	SampleID      int       `json:"sample_id"`
+	FromType      string    `json:"from_type"`
+	FromName      string    `json:"from_name"`
+	ToType        string    `json:"to_type"`
+	ToName        string    `json:"to_name"`
+	HandedOverBy  *int      `json:"handed_over_by,omitempty"`
+	TransferredAt time.Time `json:"transferred_at"`
+	Location      string    `json:"location"`
+	SealNumber    string    `json:"seal_number"`
+	SealIntact    bool      `json:"seal_intact"`
+	Temperature   *float64  `json:"temperature,omitempty"` // Degrees Celsius at hand-over
+	Notes         string    `json:"notes"`
+}
+
+// SampleCustodyRequest represents a request to hand a sample over to the next party
+type SampleCustodyRequest struct {
+	ToType        string     `json:"to_type"` // hatchery, courier or lab
+	ToName        string     `json:"to_name"`
+	LabID         int        `json:"lab_id"` // Receiving lab, when handing over to a lab
+	TransferredAt *time.Time `json:"transferred_at"`
+	Location      string     `json:"location"`
+	SealNumber    string     `json:"seal_number"`
+	SealIntact    *bool      `json:"seal_intact"`
+	Temperature   *float64   `json:"temperature"`
+	Notes         string     `json:"notes"`
+}
+
+const sampleColumns = `
+	id, sample_code, batch_id, sample_type, quantity, COALESCE(unit, ''), collected_by, collected_at,
+	COALESCE(collection_location, ''), lab_id, status, custodian_type, COALESCE(custodian_name, ''),
+	COALESCE(notes, ''), created_at, updated_at
+`
+
+// scanSample reads a sample selected with sampleColumns
+func scanSample(row rowScanner) (Sample, error) {
+	var s Sample
+	var quantity sql.NullFloat64
+	var collectedBy, labID sql.NullInt64
+	err := row.Scan(&s.ID, &s.SampleCode, &s.BatchID, &s.SampleType, &quantity, &s.Unit, &collectedBy, &s.CollectedAt,
+		&s.CollectionLocation, &labID, &s.Status, &s.CustodianType, &s.CustodianName,
+		&s.Notes, &s.CreatedAt, &s.UpdatedAt)
+	s.Quantity = floatPtr(quantity)
+	s.CollectedBy = intPtr(collectedBy)
+	s.LabID = intPtr(labID)
+	return s, err
+}
+
+const sampleCustodyColumns = `
+	id, sample_id, from_type, COALESCE(from_name, ''), to_type, to_name, handed_over_by, transferred_at,
+	COALESCE(location, ''), COALESCE(seal_number, ''), COALESCE(seal_intact, true), temperature, COALESCE(notes, '')
+`
+
+// scanSampleCustody reads a hand-over selected with sampleCustodyColumns
+func scanSampleCustody(row rowScanner) (SampleCustody, error) {
+	var t SampleCustody
+	var handedOverBy sql.NullInt64
+	var temperature sql.NullFloat64
+	err := row.Scan(&t.ID, &t.SampleID, &t.FromType, &t.FromName, &t.ToType, &t.ToName, &handedOverBy, &t.TransferredAt,
+		&t.Location, &t.SealNumber, &t.SealIntact, &temperature, &t.Notes)
+	t.HandedOverBy = intPtr(handedOverBy)
+	t.Temperature = floatPtr(temperature)
+	return t, err
+}
+
+// loadSampleByCode looks up an active sample by the code on its label
+func loadSampleByCode(code string) (Sample, error) {
+	return scanSample(db.DB.QueryRow(`SELECT `+sampleColumns+` FROM sample WHERE sample_code = $1 AND is_active = true`, code))
+}
+
+// parseSampleID loads the active sample named by the sampleId route parameter
+func parseSampleID(c *fiber.Ctx) (Sample, error) {
+	sampleID, err := strconv.Atoi(c.Params("sampleId"))
+	if err != nil {
+		return Sample{}, fiber.NewError(fiber.StatusBadRequest, "Invalid sample ID format")
+	}
+	sample, err := scanSample(db.DB.QueryRow(`SELECT `+sampleColumns+` FROM sample WHERE id = $1 AND is_active = true`, sampleID))
+	if err == sql.ErrNoRows {
+		return sample, fiber.NewError(fiber.StatusNotFound, "Sample not found")
+	}
+	if err != nil {
+		return sample, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	return sample, nil
+}
+
+// newSampleCode generates the code printed on a sample label, e.g. SMP-42-9F3A1C
+func newSampleCode(batchID int) (string, error) {
+	buf := make([]byte, 3)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("SMP-%d-%s", batchID, strings.ToUpper(hex.EncodeToString(buf))), nil
+}
+
+// loadSampleHistory fills in the custody chain and the lab results linked to a sample
+func loadSampleHistory(sample *Sample) error {
+	rows, err := db.DB.Query(`SELECT `+sampleCustodyColumns+` FROM sample_custody WHERE sample_id = $1 ORDER BY transferred_at, id`, sample.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	sample.Custody = []SampleCustody{}
+	for rows.Next() {
+		transfer, err := scanSampleCustody(rows)
+		if err != nil {
+			return err
+		}
+		sample.Custody = append(sample.Custody, transfer)
+	}
+
+	resultRows, err := db.DB.Query(`SELECT `+limsResultColumns+limsResultFrom+` WHERE r.sample_id = $1 ORDER BY r.analyzed_at DESC, r.id DESC`, sample.ID)
+	if err != nil {
+		return err
+	}
+	defer resultRows.Close()
+	sample.LabResults = []LIMSResult{}
+	for resultRows.Next() {
+		result, err := scanLIMSResult(resultRows)
+		if err != nil {
+			return err
+		}
+		sample.LabResults = append(sample.LabResults, result)
+	}
+	return nil
+}
+
+// recordSampleEvent adds a chain-of-custody event to the sample's batch
+func recordSampleEvent(sample Sample, eventType string, actorID int, location string, at time.Time, data map[string]interface{}) error {
+	data["sample_id"] = sample.ID
+	data["sample_code"] = sample.SampleCode
+	metadata, _ := json.Marshal(data)
+	_, err := db.DB.Exec(`
+		INSERT INTO event (batch_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active)
+		VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, NOW(), true)
+	`, sample.BatchID, eventType, actorID, location, at, metadata)
+	return err
+}
+
+// anchorSampleCustody records a hand-over on the blockchain so the custody chain cannot be rewritten
+func anchorSampleCustody(sample Sample, transfer SampleCustody) {
+	cfg := config.GetConfig()
+	blockchainClient := blockchain.NewBlockchainClient(
+		cfg.BlockchainNodeURL,
+		cfg.BlockchainPrivateKey,
+		cfg.BlockchainAccount,
+		cfg.BlockchainChainID,
+		cfg.BlockchainConsensus,
+	)
+
+	metadata := map[string]interface{}{
+		"sample_code": sample.SampleCode,
+		"from_type":   transfer.FromType,
+		"from_name":   transfer.FromName,
+		"to_type":     transfer.ToType,
+		"to_name":     transfer.ToName,
+		"seal_number": transfer.SealNumber,
+		"seal_intact": transfer.SealIntact,
+	}
+	actor := ""
+	if transfer.HandedOverBy != nil {
+		actor = strconv.Itoa(*transfer.HandedOverBy)
+	}
+	txID, err := blockchainClient.RecordEvent(
+		strconv.Itoa(sample.BatchID),
+		EventTypeSampleCustodyTransfer,
+		transfer.Location,
+		actor,
+		metadata,
+	)
+	if err != nil {
+		fmt.Printf("Warning: Failed to record sample custody transfer on blockchain: %v\n", err)
+		return
+	}
+	metadataHash, err := blockchainClient.HashData(map[string]interface{}{
+		"sample_custody_id": transfer.ID,
+		"sample_id":         sample.ID,
+		"batch_id":          sample.BatchID,
+		"transferred_at":    transfer.TransferredAt,
+		"temperature":       transfer.Temperature,
+		"metadata":          metadata,
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to generate metadata hash: %v\n", err)
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO blockchain_record (related_table, related_id, tx_id, metadata_hash, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NOW(), NOW(), true)
+	`, "sample_custody", transfer.ID, txID, metadataHash)
+	if err != nil {
+		fmt.Printf("Warning: Failed to save blockchain record: %v\n", err)
+	}
+}
+
+// CreateBatchSample registers a sample drawn from a batch
+// @Summary Register batch sample
+// @Description Register a physical sample drawn from a batch; the sample gets a code for its QR label and starts its chain of custody at the hatchery
+// @Tags samples
+// @Accept json
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param request body SampleRequest true "Sample details"
+// @Success 201 {object} SuccessResponse{data=Sample}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/samples [post]
+func CreateBatchSample(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	var req SampleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	switch req.SampleType {
+	case SampleTypeLarvae, SampleTypeTissue, SampleTypeWater, SampleTypeFeed, SampleTypeOther:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Sample type must be larvae, tissue, water, feed or other")
+	}
+	if req.Quantity != nil && *req.Quantity <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Quantity must be positive")
+	}
+	collectedAt := time.Now()
+	if req.CollectedAt != nil {
+		if req.CollectedAt.After(time.Now()) {
+			return fiber.NewError(fiber.StatusBadRequest, "Collection time cannot be in the future")
+		}
+		collectedAt = *req.CollectedAt
+	}
+
+	var hatcheryName string
+	err = db.DB.QueryRow(`
+		SELECT COALESCE(h.name, '') FROM batch b LEFT JOIN hatchery h ON h.id = b.hatchery_id WHERE b.id = $1 AND b.is_active = true
+	`, batchID).Scan(&hatcheryName)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if req.LabID != 0 {
+		var exists bool
+		err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM accredited_lab WHERE id = $1 AND is_active = true)", req.LabID).Scan(&exists)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if !exists {
+			return fiber.NewError(fiber.StatusNotFound, "Accredited lab not found")
+		}
+	}
+	custodianName := req.CustodianName
+	if custodianName == "" {
+		custodianName = hatcheryName
+	}
+
+	code, err := newSampleCode(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate sample code")
+	}
+	userID, _ := c.Locals("userID").(int)
+	sample, err := scanSample(db.DB.QueryRow(`
+		INSERT INTO sample (sample_code, batch_id, sample_type, quantity, unit, collected_by, collected_at,
+			collection_location, lab_id, status, custodian_type, custodian_name, notes, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, $8, NULLIF($9, 0), $10, $11, $12, $13, NOW(), NOW(), true)
+		RETURNING `+sampleColumns,
+		code, batchID, req.SampleType, req.Quantity, req.Unit, userID, collectedAt,
+		req.CollectionLocation, req.LabID, SampleStatusCollected, CustodianHatchery, custodianName, req.Notes))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to register sample")
+	}
+
+	err = recordSampleEvent(sample, EventTypeSampleCollected, userID, sample.CollectionLocation, sample.CollectedAt, map[string]interface{}{
+		"sample_type": sample.SampleType,
+		"quantity":    sample.Quantity,
+		"unit":        sample.Unit,
+		"lab_id":      sample.LabID,
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create event record")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Sample registered successfully",
+		Data:    sample,
+	})
+}
+
+// GetBatchSamples lists the samples drawn from a batch
+// @Summary Get batch samples
+// @Description List the samples drawn from a batch, newest first
+// @Tags samples
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param status query string false "Filter by status (collected, in_transit, received, tested)"
+// @Success 200 {object} SuccessResponse{data=[]Sample}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/samples [get]
+func GetBatchSamples(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+sampleColumns+`
+		FROM sample
+		WHERE batch_id = $1 AND is_active = true AND ($2::text = '' OR status = $2)
+		ORDER BY collected_at DESC, id DESC
+	`, batchID, c.Query("status"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	samples := []Sample{}
+	for rows.Next() {
+		sample, err := scanSample(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse sample")
+		}
+		samples = append(samples, sample)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch samples retrieved successfully",
+		Data:    samples,
+	})
+}
+
+// GetSample retrieves a sample with its chain of custody and lab results
+// @Summary Get sample
+// @Description Retrieve a sample with every custody hand-over and the lab results reported against it
+// @Tags samples
+// @Produce json
+// @Param sampleId path int true "Sample ID"
+// @Success 200 {object} SuccessResponse{data=Sample}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /samples/{sampleId} [get]
+func GetSample(c *fiber.Ctx) error {
+	sample, err := parseSampleID(c)
+	if err != nil {
+		return err
+	}
+	if err := loadSampleHistory(&sample); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load sample history")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Sample retrieved successfully",
+		Data:    sample,
+	})
+}
+
+// GetSampleByCode looks up a sample by the code scanned from its label
+// @Summary Get sample by code
+// @Description Look up a sample by the code on its QR label, with its chain of custody and lab results
+// @Tags samples
+// @Produce json
+// @Param code path string true "Sample code"
+// @Success 200 {object} SuccessResponse{data=Sample}
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /samples/code/{code} [get]
+func GetSampleByCode(c *fiber.Ctx) error {
+	sample, err := loadSampleByCode(c.Params("code"))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Sample not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if err := loadSampleHistory(&sample); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load sample history")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Sample retrieved successfully",
+		Data:    sample,
+	})
+}
+
+// GetSampleQRCode generates the QR label of a sample
+// @Summary Get sample QR code
+// @Description Generate a QR code PNG encoding the sample code, for labelling the sample container
+// @Tags samples
+// @Produce image/png
+// @Param sampleId path int true "Sample ID"
+// @Param size query int false "Image size in pixels (128-1024)" default(256)
+// @Success 200 {file} binary
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /samples/{sampleId}/qr [get]
+func GetSampleQRCode(c *fiber.Ctx) error {
+	sample, err := parseSampleID(c)
+	if err != nil {
+		return err
+	}
+	size := c.QueryInt("size", 256)
+	if size < 128 || size > 1024 {
+		size = 256
+	}
+
+	qr, err := qrcode.Encode(sample.SampleCode, qrcode.Medium, size)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate QR code")
+	}
+
+	c.Set("Content-Type", "image/png")
+	c.Set("Content-Disposition", fmt.Sprintf("inline; filename=%s.png", sample.SampleCode))
+	return c.Send(qr)
+}
+
+// TransferSampleCustody records a sample changing hands
+// @Summary Transfer sample custody
+// @Description Record a hand-over of a sample, e.g. hatchery to courier or courier to lab; the transfer is added to the batch events and anchored on the blockchain
+// @Tags samples
+// @Accept json
+// @Produce json
+// @Param sampleId path int true "Sample ID"
+// @Param request body SampleCustodyRequest true "Hand-over details"
+// @Success 201 {object} SuccessResponse{data=SampleCustody}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /samples/{sampleId}/custody [post]
+func TransferSampleCustody(c *fiber.Ctx) error {
+	sample, err := parseSampleID(c)
+	if err != nil {
+		return err
+	}
+
+	var req SampleCustodyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.ToName == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Receiving party name is required")
+	}
+	status := sample.Status
+	switch req.ToType {
+	case CustodianHatchery:
+	case CustodianCourier:
+		status = SampleStatusInTransit
+	case CustodianLab:
+		status = SampleStatusReceived
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Receiving party must be hatchery, courier or lab")
+	}
+	if sample.Status == SampleStatusTested {
+		// A tested sample may still move, e.g. back for retention, but it stays tested
+		status = SampleStatusTested
+	}
+	if req.ToType == sample.CustodianType && req.ToName == sample.CustodianName {
+		return fiber.NewError(fiber.StatusConflict, "The sample is already held by this party")
+	}
+	transferredAt := time.Now()
+	if req.TransferredAt != nil {
+		transferredAt = *req.TransferredAt
+	}
+	if transferredAt.Before(sample.CollectedAt) || transferredAt.After(time.Now()) {
+		return fiber.NewError(fiber.StatusBadRequest, "Transfer time must be between collection and now")
+	}
+	labID := 0
+	if sample.LabID != nil {
+		labID = *sample.LabID
+	}
+	if req.ToType == CustodianLab && req.LabID != 0 {
+		if labID != 0 && labID != req.LabID {
+			return fiber.NewError(fiber.StatusConflict, "The sample is assigned to a different lab")
+		}
+		var exists bool
+		err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM accredited_lab WHERE id = $1 AND is_active = true)", req.LabID).Scan(&exists)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if !exists {
+			return fiber.NewError(fiber.StatusNotFound, "Accredited lab not found")
+		}
+		labID = req.LabID
+	}
+	sealIntact := true
+	if req.SealIntact != nil {
+		sealIntact = *req.SealIntact
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	transfer, err := scanSampleCustody(db.DB.QueryRow(`
+		INSERT INTO sample_custody (sample_id, from_type, from_name, to_type, to_name, handed_over_by, transferred_at,
+			location, seal_number, seal_intact, temperature, notes, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, $8, $9, $10, $11, $12, NOW())
+		RETURNING `+sampleCustodyColumns,
+		sample.ID, sample.CustodianType, sample.CustodianName, req.ToType, req.ToName, userID, transferredAt,
+		req.Location, req.SealNumber, sealIntact, req.Temperature, req.Notes))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record custody transfer")
+	}
+	_, err = db.DB.Exec(`
+		UPDATE sample SET status = $1, custodian_type = $2, custodian_name = $3, lab_id = NULLIF($4, 0), updated_at = NOW()
+		WHERE id = $5
+	`, status, req.ToType, req.ToName, labID, sample.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update sample")
+	}
+
+	err = recordSampleEvent(sample, EventTypeSampleCustodyTransfer, userID, transfer.Location, transfer.TransferredAt, map[string]interface{}{
+		"sample_custody_id": transfer.ID,
+		"from_type":         transfer.FromType,
+		"from_name":         transfer.FromName,
+		"to_type":           transfer.ToType,
+		"to_name":           transfer.ToName,
+		"seal_number":       transfer.SealNumber,
+		"seal_intact":       transfer.SealIntact,
+		"temperature":       transfer.Temperature,
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create event record")
+	}
+	anchorSampleCustody(sample, transfer)
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Sample custody transferred successfully",
+		Data:    transfer,
+	})
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxScanCodesPerRequest limits how many codes can be decoded in one call
+const maxScanCodesPerRequest = 100
+
+// ScanDecodeRequest represents a request to decode one or more scanned barcodes
+type ScanDecodeRequest struct {
+	Code  string   `json:"code"`
+	Codes []string `json:"codes"`
+}
+
+// DecodedScan represents the decoded content of a scanned barcode and the internal records it refers to
+type DecodedScan struct {
+	Raw         string               `json:"raw"`
+	Decoded     *utils.GS1ScanResult `json:"decoded,omitempty"`
+	BatchID     int                  `json:"batch_id,omitempty"`
+	ShipmentID  int                  `json:"shipment_id,omitempty"`
+	Identifiers []GS1Identifier      `json:"identifiers,omitempty"`
+	Resolved    bool                 `json:"resolved"`
+	Error       string               `json:"error,omitempty"`
+}
+
+// DecodeScan decodes scanned barcodes and resolves them to batches and shipments
+// @Summary Decode scanned barcodes
+// @Description Parse GS1 application identifiers (GTIN, lot, expiry, SSCC) from GS1-128, DataMatrix, QR or Digital Link scans and resolve them to internal batches and shipments
+// @Tags scan
+// @Accept json
+// @Produce json
+// @Param request body ScanDecodeRequest true "Scanned codes"
+// @Success 200 {object} SuccessResponse{data=[]DecodedScan}
+// @Failure 400 {object} ErrorResponse
+// @Router /scan/decode [post]
+func DecodeScan(c *fiber.Ctx) error {
+	var req ScanDecodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	codes := req.Codes
+	if req.Code != "" {
+		codes = append([]string{req.Code}, codes...)
+	}
+	if len(codes) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one scanned code is required")
+	}
+	if len(codes) > maxScanCodesPerRequest {
+		return fiber.NewError(fiber.StatusBadRequest, "Too many codes in one request")
+	}
+
+	results := make([]DecodedScan, 0, len(codes))
+	for _, code := range codes {
+		scan, err := decodeScannedCode(code)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		results = append(results, scan)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Codes decoded successfully",
+		Data:    results,
+	})
+}
+
+// decodeScannedCode decodes a single code; only database failures are returned as errors
+func decodeScannedCode(code string) (DecodedScan, error) {
+	scan := DecodedScan{Raw: code}
+
+	// QR codes generated by the platform carry the batch ID directly
+	if batchID, ok := parseInternalBatchCode(code); ok {
+		exists, err := activeBatchExists(batchID)
+		if err != nil {
+			return scan, err
+		}
+		if exists {
+			scan.BatchID = batchID
+			scan.Resolved = true
+		}
+		return scan, nil
+	}
+
+	decoded, parseErr := utils.ParseGS1Barcode(code)
+	if parseErr != nil {
+		scan.Error = parseErr.Error()
+		return scan, nil
+	}
+	scan.Decoded = decoded
+
+	// Resolve the GS1 keys allocated by the platform
+	for _, key := range []string{decoded.SSCC, decoded.GTIN, decoded.GLN} {
+		if key == "" {
+			continue
+		}
+		identifier, err := findGS1IdentifierByValue(key)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return scan, err
+		}
+		scan.Identifiers = append(scan.Identifiers, identifier)
+
+		if identifier.EntityType == "shipment" {
+			scan.ShipmentID = identifier.EntityID
+		}
+		if identifier.EntityType == "shipment_transfer" {
+			var batchID sql.NullInt64
+			err := db.DB.QueryRow(`
+				SELECT batch_id FROM shipment_transfer WHERE id = $1 AND is_active = true
+			`, identifier.EntityID).Scan(&batchID)
+			if err != nil && err != sql.ErrNoRows {
+				return scan, err
+			}
+			if err == nil {
+				scan.ShipmentID = identifier.EntityID
+				scan.BatchID = int(batchID.Int64)
+			}
+		}
+	}
+
+	// Lot codes printed on our labels carry the batch ID
+	if scan.BatchID == 0 && decoded.Lot != "" {
+		if hatcheryID, batchID, ok := parseLotCode(decoded.Lot); ok {
+			var found bool
+			err := db.DB.QueryRow(`
+				SELECT EXISTS(SELECT 1 FROM batch WHERE id = $1 AND hatchery_id = $2 AND is_active = true)
+			`, batchID, hatcheryID).Scan(&found)
+			if err != nil {
+				return scan, err
+			}
+			if found {
+				scan.BatchID = batchID
+			}
+		}
+	}
+
+	scan.Resolved = scan.BatchID != 0 || scan.ShipmentID != 0 || len(scan.Identifiers) > 0
+	return scan, nil
+}
+
+// parseInternalBatchCode extracts a batch ID from a trace URL or a QR payload generated by the platform
+func parseInternalBatchCode(code string) (int, bool) {
+	code = strings.TrimSpace(code)
+	if idx := strings.Index(code, "/trace/"); idx >= 0 {
+		id, err := strconv.Atoi(strings.Trim(code[idx+len("/trace/"):], "/"))
+		return id, err == nil
+	}
+	// Long digit strings are GS1 element strings rather than batch IDs
+	if len(code) > 10 {
+		if _, err := strconv.ParseUint(code, 10, 64); err == nil {
+			return 0, false
+		}
+	}
+	value, err := utils.ParseQRCode(code)
+	if err != nil {
+		return 0, false
+	}
+	id, err := strconv.Atoi(value)
+	return id, err == nil
+}
+
+// activeBatchExists reports whether an active batch with the given ID exists
+func activeBatchExists(batchID int) (bool, error) {
+	var exists bool
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = $1 AND is_active = true)", batchID).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Types of search suggestions
+const (
+	SuggestionBatch    = "batch"
+	SuggestionCompany  = "company"
+	SuggestionDocument = "document"
+	SuggestionDID      = "did"
+)
+
+// SearchSuggestion is a quick-switch target matching a search
+type SearchSuggestion struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"` // Batch, company or document ID, or the DID itself
+	Label   string `json:"label"`
+	Detail  string `json:"detail,omitempty"`
+	BatchID *int   `json:"batch_id,omitempty"` // Batch of a document
+}
+
+// searchSuggestionQueries select suggestions for the lowercased search in $1, its LIKE-escaped form in $2
+// and the limit in $4; scope holds the company batches and documents are limited to (0 for every company)
+// and the document sensitivity levels the caller may see
+// Matches rank exact, then prefix, then substring; the trigram indexes serve the substring matches
+var searchSuggestionQueries = map[string]string{
+	SuggestionBatch: `
+		(SELECT 'batch' AS type, b.id::text AS id, 'Batch #' || b.id AS label, CONCAT_WS(' · ', b.species, b.status, h.name) AS detail, NULL::int AS batch_id,
+			CASE WHEN b.id::text = $1 THEN 0 WHEN b.id::text LIKE $2 || '%' THEN 1 WHEN LOWER(b.species) LIKE $2 || '%' THEN 2 ELSE 3 END AS rank,
+			COALESCE(LENGTH(b.species), 0) AS length
+		FROM batch b
+		INNER JOIN hatchery h ON b.hatchery_id = h.id
+		WHERE b.is_active = true AND (SELECT company_id FROM scope) IN (0, COALESCE(b.owner_company_id, h.company_id))
+			AND (b.id::text LIKE $2 || '%' OR LOWER(b.species) LIKE '%' || $2 || '%')
+		ORDER BY rank, length, b.id DESC
+		LIMIT $4)`,
+	SuggestionCompany: `
+		(SELECT 'company' AS type, c.id::text AS id, c.name AS label, CONCAT_WS(' · ', c.type, c.location) AS detail, NULL::int AS batch_id,
+			CASE WHEN LOWER(c.name) = $1 THEN 0 WHEN LOWER(c.name) LIKE $2 || '%' THEN 1 ELSE 3 END AS rank,
+			LENGTH(c.name) AS length
+		FROM company c
+		WHERE c.is_active = true AND LOWER(c.name) LIKE '%' || $2 || '%'
+		ORDER BY rank, length, c.id
+		LIMIT $4)`,
+	SuggestionDocument: `
+		(SELECT 'document' AS type, d.id::text AS id, d.file_name AS label, COALESCE(d.doc_type, '') AS detail, d.batch_id,
+			CASE WHEN LOWER(d.file_name) = $1 THEN 0 WHEN LOWER(d.file_name) LIKE $2 || '%' THEN 1 ELSE 3 END AS rank,
+			LENGTH(d.file_name) AS length
+		FROM document d
+		LEFT JOIN batch b ON d.batch_id = b.id
+		LEFT JOIN hatchery h ON b.hatchery_id = h.id
+		WHERE d.is_active = true AND (SELECT company_id FROM scope) IN (0, COALESCE(b.owner_company_id, h.company_id))
+			AND COALESCE(d.sensitivity, 'public') = ANY((SELECT levels FROM scope))
+			AND LOWER(d.file_name) LIKE '%' || $2 || '%'
+		ORDER BY rank, length, d.id DESC
+		LIMIT $4)`,
+	SuggestionDID: `
+		(SELECT 'did' AS type, i.did AS id, i.entity_name AS label, CONCAT_WS(' · ', i.entity_type, i.did) AS detail, NULL::int AS batch_id,
+			CASE WHEN LOWER(i.did) = $1 THEN 0 WHEN LOWER(i.did) LIKE $2 || '%' OR LOWER(i.entity_name) LIKE $2 || '%' THEN 1 ELSE 3 END AS rank,
+			LENGTH(i.entity_name) AS length
+		FROM identities i
+		WHERE i.status = 'active' AND (LOWER(i.did) LIKE '%' || $2 || '%' OR LOWER(i.entity_name) LIKE '%' || $2 || '%')
+		ORDER BY rank, length, i.id
+		LIMIT $4)`,
+}
+
+// escapeLike escapes the LIKE wildcards of a search
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// SearchSuggest suggests batches, companies, documents and DIDs matching a search
+// @Summary Search suggestions
+// @Description Typed suggestions for quick-switchers. Batches match by ID prefix or species, companies and documents by name and DIDs by DID or entity name.
+// @Description Batches and documents are limited to the user's company unless the user is an admin
+// @Tags search
+// @Produce json
+// @Param q query string true "Search text, at least 2 characters (1 for batch IDs)"
+// @Param types query string false "Comma-separated suggestion types (batch, company, document, did); default all"
+// @Param limit query int false "Maximum suggestions (default 10, max 25)"
+// @Success 200 {object} SuccessResponse{data=[]SearchSuggestion}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /search/suggest [get]
+func SearchSuggest(c *fiber.Ctx) error {
+	q := strings.ToLower(strings.TrimSpace(c.Query("q")))
+	_, numericErr := strconv.Atoi(q)
+	if len([]rune(q)) < 2 && !(q != "" && numericErr == nil) {
+		return fiber.NewError(fiber.StatusBadRequest, "Search must be at least 2 characters")
+	}
+	if len(q) > 100 {
+		return fiber.NewError(fiber.StatusBadRequest, "Search must be at most 100 characters")
+	}
+	limit := c.QueryInt("limit", 10)
+	if limit < 1 || limit > 25 {
+		return fiber.NewError(fiber.StatusBadRequest, "Limit must be between 1 and 25")
+	}
+
+	types := []string{SuggestionBatch, SuggestionCompany, SuggestionDocument, SuggestionDID}
+	if raw := c.Query("types"); raw != "" {
+		types = nil
+		for _, t := range strings.Split(raw, ",") {
+			t = strings.TrimSpace(t)
+			if _, ok := searchSuggestionQueries[t]; !ok {
+				return fiber.NewError(fiber.StatusBadRequest, "Unknown suggestion type: "+t)
+			}
+			types = append(types, t)
+		}
+	}
+
+	companyID, _ := c.Locals("companyID").(int)
+	if role, _ := c.Locals("role").(string); role == "admin" {
+		companyID = 0
+	}
+	// Documents are only suggested from the caller's own batches, so the owner's levels apply
+	relation := RelationOwner
+	if companyID == 0 {
+		relation = RelationOther
+	}
+	levels, err := relationDocumentLevels(c, relation)
+	if err != nil {
+		return err
+	}
+
+	branches := make([]string, 0, len(types))
+	for _, t := range types {
+		branches = append(branches, searchSuggestionQueries[t])
+	}
+	rows, err := db.DB.Query(`
+		WITH scope AS (SELECT $3::int AS company_id, $5::text[] AS levels)
+		SELECT s.type, s.id, s.label, s.detail, s.batch_id
+		FROM (`+strings.Join(branches, " UNION ALL ")+`) s
+		ORDER BY s.rank, s.length
+		LIMIT $4
+	`, q, escapeLike(q), companyID, limit, levels)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to search")
+	}
+	defer rows.Close()
+
+	suggestions := []SearchSuggestion{}
+	for rows.Next() {
+		var s SearchSuggestion
+		var batchID *int
+		if err := rows.Scan(&s.Type, &s.ID, &s.Label, &s.Detail, &batchID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse search suggestions")
+		}
+		s.BatchID = batchID
+		suggestions = append(suggestions, s)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Search suggestions retrieved successfully",
+		Data:    suggestions,
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
 	"github.com/LTPPPP/TracePost-larvaeChain/config"
 	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/eventbus"
 	"github.com/LTPPPP/TracePost-larvaeChain/models"
 	"github.com/skip2/go-qrcode"
 )
@@ -85,7 +86,7 @@ func GetAllShipmentTransfers(c *fiber.Ctx) error {
 
 // GetShipmentTransferByID retrieves a specific shipment transfer by ID
 // @Summary Get shipment transfer by ID
-// @Description Retrieve a shipment transfer by its ID
+// @Description Retrieve a shipment transfer by its ID. Commercial terms are only included for the parties to the transfer and their auditors
 // @Tags shipments
 // @Accept json
 // @Produce json
@@ -123,6 +124,7 @@ func GetShipmentTransferByID(c *fiber.Ctx) error {
 	if err != nil {
 		return fiber.NewError(fiber.StatusNotFound, "Transfer not found")
 	}
+	attachTransferCommercialTerms(c, &transfer)
 
 	// Return success response
 	return c.JSON(SuccessResponse{
@@ -215,6 +217,7 @@ func GetTransfersByBatchID(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param request body CreateShipmentTransferRequest true "Transfer details"
+// @Param dry_run query bool false "Only validate and describe what would happen, without writing to the database, IPFS or the chain"
 // @Success 201 {object} SuccessResponse{data=models.ShipmentTransfer}
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -270,6 +273,26 @@ func CreateShipmentTransfer(c *fiber.Ctx) error {
 		status = "pending" // Default status
 	}
 
+	if isDryRun(c) {
+		return dryRunResponse(c, "Dry run: the shipment transfer would be created", DryRunResult{
+			Action: "create_shipment_transfer",
+			Record: models.ShipmentTransfer{
+				BatchID:      req.BatchID,
+				SenderID:     req.SenderID,
+				ReceiverID:   req.ReceiverID,
+				TransferTime: transferTime,
+				Status:       status,
+				IsActive:     true,
+			},
+			Effects: []string{
+				"Insert the shipment transfer",
+				"Record a batch_transfer_initiated event",
+				"Change the batch status to in_transfer",
+			},
+			Warnings: batchDryRunWarnings(req.BatchID),
+		})
+	}
+
 	// Start a transaction
 	tx, err := db.DB.Begin()
 	if err != nil {
@@ -332,6 +355,7 @@ func CreateShipmentTransfer(c *fiber.Ctx) error {
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
 	}
+	publishBatchStatusChanged(req.BatchID, "", "in_transfer", "transfer_initiated")
 
 	// Get the created transfer
 	var transfer models.ShipmentTransfer
@@ -454,6 +478,10 @@ func UpdateShipmentTransfer(c *fiber.Ctx) error {
 		updateQuery += fmt.Sprintf(", status = $%d", paramCounter)
 		updateParams = append(updateParams, req.Status)
 		paramCounter++
+		// Keep when the transfer was first completed, for the on-time delivery of supplier scorecards
+		if req.Status == "completed" {
+			updateQuery += ", completed_at = COALESCE(completed_at, $1)"
+		}
 	}
 
 	if req.ReceiverID != 0 {
@@ -478,9 +506,9 @@ func UpdateShipmentTransfer(c *fiber.Ctx) error {
 	}
 
 	// Create event for status change if provided
+	var batchStatus string
 	if req.Status != "" && req.Status != currentStatus {
 		// Update batch status based on transfer status
-		var batchStatus string
 		switch req.Status {
 		case "completed":
 			batchStatus = "transferred"
@@ -537,6 +565,18 @@ func UpdateShipmentTransfer(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
 	}
 
+	// Tell downstream services about the custody change
+	if batchStatus != "" {
+		publishBatchStatusChanged(batchID, "", batchStatus, "transfer_"+req.Status)
+		if req.Status == "completed" {
+			publishDomainEvent(eventbus.TransferCompleted, 0, batchID, map[string]interface{}{
+				"transfer_id": transferID,
+				"old_status":  currentStatus,
+				"updated_by":  userID,
+			})
+		}
+	}
+
 	// Record on blockchain if status was updated
 	if req.Status != "" && req.Status != currentStatus {
 		cfg := config.GetConfig()
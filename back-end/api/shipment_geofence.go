@@ -0,0 +1,401 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/mailer"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ShipmentGeofence represents an expected corridor or restricted zone of a shipment
+type ShipmentGeofence struct {
+	ID         int    `json:"id"`
+	ShipmentID int    `json:"shipment_id"`
+	Name       string `json:"name"`
+	utils.Geofence
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateShipmentGeofenceRequest represents a request to add a geofence to a shipment
+type CreateShipmentGeofenceRequest struct {
+	Name string `json:"name"`
+	utils.Geofence
+}
+
+// ShipmentGeofenceAlert represents a corridor deviation or restricted zone entry
+type ShipmentGeofenceAlert struct {
+	ID         int        `json:"id"`
+	ShipmentID int        `json:"shipment_id"`
+	GeofenceID int        `json:"geofence_id"`
+	AlertType  string     `json:"alert_type"` // corridor_deviation, restricted_zone_entry
+	Latitude   float64    `json:"latitude"`
+	Longitude  float64    `json:"longitude"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+}
+
+// CreateShipmentGeofence adds an expected corridor or restricted zone to a shipment
+// @Summary Add shipment geofence
+// @Description Add an expected corridor (polyline with buffer) or a restricted zone (polygon or circle) to a shipment. Coordinates are [longitude, latitude] pairs
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param id path string true "Shipment ID"
+// @Param request body CreateShipmentGeofenceRequest true "Geofence details"
+// @Success 201 {object} SuccessResponse{data=ShipmentGeofence}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments/{id}/geofences [post]
+func CreateShipmentGeofence(c *fiber.Ctx) error {
+	shipmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid shipment ID")
+	}
+
+	var req CreateShipmentGeofenceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
+	}
+	if err := req.Geofence.Validate(); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM shipment WHERE id = $1 AND is_active = true)", shipmentID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Shipment not found")
+	}
+
+	coordinates, err := json.Marshal(req.Coordinates)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid coordinates")
+	}
+
+	fence := ShipmentGeofence{ShipmentID: shipmentID, Name: req.Name, Geofence: req.Geofence}
+	err = db.DB.QueryRow(`
+		INSERT INTO shipment_geofence (shipment_id, name, fence_type, coordinates, buffer_meters, radius_meters)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, shipmentID, req.Name, req.Type, coordinates, req.BufferMeters, req.RadiusMeters).Scan(&fence.ID, &fence.CreatedAt)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create geofence: "+err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Geofence created successfully",
+		Data:    fence,
+	})
+}
+
+// ListShipmentGeofences lists the active geofences of a shipment
+// @Summary List shipment geofences
+// @Description List the expected corridors and restricted zones of a shipment
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param id path string true "Shipment ID"
+// @Success 200 {object} SuccessResponse{data=[]ShipmentGeofence}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments/{id}/geofences [get]
+func ListShipmentGeofences(c *fiber.Ctx) error {
+	shipmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid shipment ID")
+	}
+
+	fences, err := loadShipmentGeofences(shipmentID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Geofences retrieved successfully",
+		Data:    fences,
+	})
+}
+
+// DeleteShipmentGeofence deactivates a geofence of a shipment
+// @Summary Delete shipment geofence
+// @Description Deactivate a geofence so it is no longer evaluated
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param id path string true "Shipment ID"
+// @Param fenceId path string true "Geofence ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments/{id}/geofences/{fenceId} [delete]
+func DeleteShipmentGeofence(c *fiber.Ctx) error {
+	shipmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid shipment ID")
+	}
+	fenceID, err := strconv.Atoi(c.Params("fenceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid geofence ID")
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE shipment_geofence SET is_active = false, updated_at = NOW()
+		WHERE id = $1 AND shipment_id = $2 AND is_active = true
+	`, fenceID, shipmentID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Geofence not found")
+	}
+
+	// Close alerts that can no longer be resolved by new pings
+	_, err = db.DB.Exec(`
+		UPDATE shipment_geofence_alert SET ended_at = NOW(), updated_at = NOW()
+		WHERE geofence_id = $1 AND ended_at IS NULL
+	`, fenceID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Geofence deleted successfully",
+	})
+}
+
+// ListShipmentGeofenceAlerts lists the geofence alerts of a shipment
+// @Summary List shipment geofence alerts
+// @Description List corridor deviations and restricted zone entries of a shipment
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param id path string true "Shipment ID"
+// @Success 200 {object} SuccessResponse{data=[]ShipmentGeofenceAlert}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments/{id}/geofence-alerts [get]
+func ListShipmentGeofenceAlerts(c *fiber.Ctx) error {
+	shipmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid shipment ID")
+	}
+
+	alerts, err := loadShipmentGeofenceAlerts(shipmentID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Geofence alerts retrieved successfully",
+		Data:    alerts,
+	})
+}
+
+// loadShipmentGeofences loads the active geofences of a shipment
+func loadShipmentGeofences(shipmentID int) ([]ShipmentGeofence, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, shipment_id, COALESCE(name, ''), fence_type, coordinates, COALESCE(buffer_meters, 0),
+		       COALESCE(radius_meters, 0), created_at
+		FROM shipment_geofence
+		WHERE shipment_id = $1 AND is_active = true
+		ORDER BY id
+	`, shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fences := []ShipmentGeofence{}
+	for rows.Next() {
+		var f ShipmentGeofence
+		var coordinates []byte
+		if err := rows.Scan(&f.ID, &f.ShipmentID, &f.Name, &f.Type, &coordinates, &f.BufferMeters,
+			&f.RadiusMeters, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(coordinates, &f.Coordinates); err != nil {
+			return nil, err
+		}
+		fences = append(fences, f)
+	}
+	return fences, rows.Err()
+}
+
+// loadShipmentGeofenceAlerts loads every geofence alert of a shipment
+func loadShipmentGeofenceAlerts(shipmentID int) ([]ShipmentGeofenceAlert, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, shipment_id, geofence_id, alert_type, COALESCE(latitude, 0), COALESCE(longitude, 0), started_at, ended_at
+		FROM shipment_geofence_alert
+		WHERE shipment_id = $1
+		ORDER BY started_at
+	`, shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []ShipmentGeofenceAlert{}
+	for rows.Next() {
+		var a ShipmentGeofenceAlert
+		var endedAt sql.NullTime
+		if err := rows.Scan(&a.ID, &a.ShipmentID, &a.GeofenceID, &a.AlertType, &a.Latitude, &a.Longitude,
+			&a.StartedAt, &endedAt); err != nil {
+			return nil, err
+		}
+		if endedAt.Valid {
+			a.EndedAt = &endedAt.Time
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// evaluateShipmentGeofences checks new pings against the shipment geofences, opening an alert when a fence
+// is first violated and closing it when the transport is back in compliance
+func evaluateShipmentGeofences(shipmentID int, pings []GPSPing) ([]ShipmentGeofenceAlert, error) {
+	fences, err := loadShipmentGeofences(shipmentID)
+	if err != nil || len(fences) == 0 {
+		return []ShipmentGeofenceAlert{}, err
+	}
+
+	// Alerts still open from earlier pings
+	open := map[int]int{}
+	rows, err := db.DB.Query(`
+		SELECT id, geofence_id FROM shipment_geofence_alert WHERE shipment_id = $1 AND ended_at IS NULL
+	`, shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var alertID, fenceID int
+		if err := rows.Scan(&alertID, &fenceID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		open[fenceID] = alertID
+	}
+	rows.Close()
+
+	sorted := append([]GPSPing(nil), pings...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].RecordedAt.Before(sorted[j].RecordedAt) })
+
+	alerts := []ShipmentGeofenceAlert{}
+	for _, ping := range sorted {
+		for _, fence := range fences {
+			violated := fence.Violated(ping.Latitude, ping.Longitude)
+			alertID, isOpen := open[fence.ID]
+
+			if violated && !isOpen {
+				alert := ShipmentGeofenceAlert{
+					ShipmentID: shipmentID,
+					GeofenceID: fence.ID,
+					AlertType:  "corridor_deviation",
+					Latitude:   ping.Latitude,
+					Longitude:  ping.Longitude,
+					StartedAt:  ping.RecordedAt,
+				}
+				if fence.Type == utils.GeofenceRestrictedZone {
+					alert.AlertType = "restricted_zone_entry"
+				}
+				err := db.DB.QueryRow(`
+					INSERT INTO shipment_geofence_alert (shipment_id, geofence_id, alert_type, latitude, longitude, started_at)
+					VALUES ($1, $2, $3, $4, $5, $6)
+					RETURNING id
+				`, shipmentID, fence.ID, alert.AlertType, alert.Latitude, alert.Longitude, alert.StartedAt).Scan(&alert.ID)
+				if err != nil {
+					return nil, err
+				}
+				open[fence.ID] = alert.ID
+				alerts = append(alerts, alert)
+
+				if err := notifyShipmentGeofenceAlert(shipmentID, fence, alert); err != nil {
+					return nil, err
+				}
+			} else if !violated && isOpen {
+				_, err := db.DB.Exec(`
+					UPDATE shipment_geofence_alert SET ended_at = $1, updated_at = NOW() WHERE id = $2
+				`, ping.RecordedAt, alertID)
+				if err != nil {
+					return nil, err
+				}
+				delete(open, fence.ID)
+			}
+		}
+	}
+	return alerts, nil
+}
+
+// notifyShipmentGeofenceAlert records an alert event on every batch of the shipment and emails the sender and receiver
+func notifyShipmentGeofenceAlert(shipmentID int, fence ShipmentGeofence, alert ShipmentGeofenceAlert) error {
+	shipment, err := loadShipment(shipmentID)
+	if err != nil {
+		return err
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"shipment_id":   shipmentID,
+		"shipment_code": shipment.ShipmentCode,
+		"geofence_id":   fence.ID,
+		"geofence_name": fence.Name,
+		"alert_id":      alert.ID,
+		"alert_type":    alert.AlertType,
+		"latitude":      alert.Latitude,
+		"longitude":     alert.Longitude,
+	})
+	location := fmt.Sprintf("%.6f,%.6f", alert.Latitude, alert.Longitude)
+
+	done := map[int]bool{}
+	for _, item := range shipment.Items {
+		if done[item.BatchID] {
+			continue
+		}
+		done[item.BatchID] = true
+		_, err := db.DB.Exec(`
+			INSERT INTO event (batch_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, item.BatchID, "shipment_geofence_alert", shipment.SenderID, location, alert.StartedAt, metadata, time.Now(), true)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Email delivery must not block or fail GPS ingestion
+	data := map[string]interface{}{
+		"ShipmentCode": shipment.ShipmentCode,
+		"AlertType":    alert.AlertType,
+		"Geofence":     fence.Name,
+		"At":           alert.StartedAt.Format(time.RFC3339),
+		"Location":     location,
+	}
+	for _, accountID := range []int{shipment.SenderID, shipment.ReceiverID} {
+		var email string
+		err := db.DB.QueryRow("SELECT email FROM account WHERE id = $1 AND is_active = true", accountID).Scan(&email)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		go func(to, lang string) {
+			if err := mailer.Send(to, mailer.TemplateGeofenceAlert, lang, data); err != nil {
+				fmt.Printf("Failed to send geofence alert email to %s: %v\n", to, err)
+			}
+		}(email, LoadPreferredLanguage(accountID))
+	}
+	return nil
+}
@@ -0,0 +1,805 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ShipmentItemRequest represents one batch packed in a tank or container
+type ShipmentItemRequest struct {
+	BatchID       int    `json:"batch_id"`
+	Quantity      int    `json:"quantity"`
+	ContainerID   string `json:"container_id"`
+	ContainerType string `json:"container_type"`
+}
+
+// CreateShipmentRequest represents a request to create a shipment with its line items
+type CreateShipmentRequest struct {
+	SenderID      int                   `json:"sender_id"`
+	ReceiverID    int                   `json:"receiver_id"`
+	Carrier       string                `json:"carrier"`
+	VehicleID     string                `json:"vehicle_id"`
+	Origin        string                `json:"origin"`
+	Destination   string                `json:"destination"`
+	DepartureTime time.Time             `json:"departure_time,omitempty"`
+	Notes         string                `json:"notes"`
+	Items         []ShipmentItemRequest `json:"items"`
+}
+
+// ReceiveShipmentItemRequest records what actually arrived for a line item
+type ReceiveShipmentItemRequest struct {
+	ItemID           int    `json:"item_id"`
+	ReceivedQuantity int    `json:"received_quantity"`
+	Condition        string `json:"condition"`
+}
+
+// ReceiveShipmentRequest represents a request to confirm receipt of a shipment
+type ReceiveShipmentRequest struct {
+	ReceivedBy int                          `json:"received_by"`
+	Location   string                       `json:"location"`
+	Items      []ReceiveShipmentItemRequest `json:"items"`
+}
+
+// ShipmentManifestLine is a single line of a shipment manifest
+type ShipmentManifestLine struct {
+	ContainerID      string `json:"container_id"`
+	ContainerType    string `json:"container_type"`
+	BatchID          int    `json:"batch_id"`
+	Species          string `json:"species"`
+	HatcheryName     string `json:"hatchery_name"`
+	Quantity         int    `json:"quantity"`
+	ReceivedQuantity int    `json:"received_quantity"`
+	Condition        string `json:"condition"`
+}
+
+// ShipmentManifest is the printable document describing a shipment's contents
+type ShipmentManifest struct {
+	ShipmentCode   string                 `json:"shipment_code"`
+	SSCC           string                 `json:"sscc,omitempty"`
+	Status         string                 `json:"status"`
+	SenderName     string                 `json:"sender_name"`
+	ReceiverName   string                 `json:"receiver_name"`
+	Carrier        string                 `json:"carrier"`
+	VehicleID      string                 `json:"vehicle_id"`
+	Origin         string                 `json:"origin"`
+	Destination    string                 `json:"destination"`
+	DepartureTime  *time.Time             `json:"departure_time,omitempty"`
+	ArrivalTime    *time.Time             `json:"arrival_time,omitempty"`
+	Lines          []ShipmentManifestLine `json:"lines"`
+	ContainerCount int                    `json:"container_count"`
+	BatchCount     int                    `json:"batch_count"`
+	TotalQuantity  int                    `json:"total_quantity"`
+	GeneratedAt    time.Time              `json:"generated_at"`
+}
+
+// ShipmentDetail is a shipment together with its tracked route
+type ShipmentDetail struct {
+	models.Shipment
+	Route *ShipmentRouteResponse `json:"route,omitempty"`
+}
+
+// CreateShipment creates a shipment carrying one or more batches
+// @Summary Create a shipment
+// @Description Create a shipment with line items (batch, quantity, tank/container). A custody transfer is opened for every batch on board
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param request body CreateShipmentRequest true "Shipment details"
+// @Success 201 {object} SuccessResponse{data=models.Shipment}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments [post]
+func CreateShipment(c *fiber.Ctx) error {
+	var req CreateShipmentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format: "+err.Error())
+	}
+
+	if req.SenderID <= 0 || req.ReceiverID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Sender ID and receiver ID are required")
+	}
+	if len(req.Items) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one shipment item is required")
+	}
+
+	// Validate accounts
+	for _, accountID := range []int{req.SenderID, req.ReceiverID} {
+		var exists bool
+		err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM account WHERE id = $1 AND is_active = true)", accountID).Scan(&exists)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error: "+err.Error())
+		}
+		if !exists {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Account %d not found", accountID))
+		}
+	}
+
+	// Validate items and make sure no batch ships more than it holds
+	packed := map[int]int{}
+	for _, item := range req.Items {
+		if item.BatchID <= 0 || item.Quantity <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "Each item requires a batch ID and a positive quantity")
+		}
+		packed[item.BatchID] += item.Quantity
+	}
+	for batchID, quantity := range packed {
+		var available int
+		err := db.DB.QueryRow("SELECT COALESCE(quantity, 0) FROM batch WHERE id = $1 AND is_active = true", batchID).Scan(&available)
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Batch %d not found", batchID))
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error: "+err.Error())
+		}
+		if quantity > available {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Batch %d only has %d units available", batchID, available))
+		}
+	}
+
+	now := time.Now()
+	var departureTime interface{}
+	if !req.DepartureTime.IsZero() {
+		departureTime = req.DepartureTime
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start database transaction: "+err.Error())
+	}
+
+	// The code is derived from the ID, so insert with a temporary unique value first
+	var shipmentID int
+	err = tx.QueryRow(`
+		INSERT INTO shipment (
+			shipment_code, sender_id, receiver_id, carrier, vehicle_id, origin, destination,
+			status, departure_time, notes, created_at, updated_at, is_active
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, 'draft', $8, $9, $10, $10, true)
+		RETURNING id
+	`, fmt.Sprintf("TMP-%d", now.UnixNano()), req.SenderID, req.ReceiverID, req.Carrier, req.VehicleID,
+		req.Origin, req.Destination, departureTime, req.Notes, now).Scan(&shipmentID)
+	if err != nil {
+		tx.Rollback()
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create shipment: "+err.Error())
+	}
+
+	shipmentCode := fmt.Sprintf("SHP-%s-%06d", now.Format("20060102"), shipmentID)
+	if _, err = tx.Exec("UPDATE shipment SET shipment_code = $1 WHERE id = $2", shipmentCode, shipmentID); err != nil {
+		tx.Rollback()
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to assign shipment code: "+err.Error())
+	}
+
+	eventMetadata, _ := json.Marshal(map[string]interface{}{
+		"shipment_id":   shipmentID,
+		"shipment_code": shipmentCode,
+	})
+
+	// One custody transfer per batch, shared by all tanks carrying that batch
+	transfers := map[int]int{}
+	for _, item := range req.Items {
+		transferID, ok := transfers[item.BatchID]
+		if !ok {
+			err = tx.QueryRow(`
+				INSERT INTO shipment_transfer (batch_id, sender_id, receiver_id, transfer_time, status, created_at, updated_at, is_active)
+				VALUES ($1, $2, $3, $4, 'pending', $4, $4, true)
+				RETURNING id
+			`, item.BatchID, req.SenderID, req.ReceiverID, now).Scan(&transferID)
+			if err != nil {
+				tx.Rollback()
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to create transfer record: "+err.Error())
+			}
+			transfers[item.BatchID] = transferID
+
+			_, err = tx.Exec(`
+				INSERT INTO event (batch_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			`, item.BatchID, "batch_transfer_initiated", req.SenderID, req.Origin, now, eventMetadata, now, true)
+			if err != nil {
+				tx.Rollback()
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to create event record: "+err.Error())
+			}
+
+			_, err = tx.Exec("UPDATE batch SET status = 'in_transfer', updated_at = $1 WHERE id = $2", now, item.BatchID)
+			if err != nil {
+				tx.Rollback()
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to update batch status: "+err.Error())
+			}
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO shipment_item (
+				shipment_id, batch_id, transfer_id, quantity, container_id, container_type,
+				created_at, updated_at, is_active
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $7, true)
+		`, shipmentID, item.BatchID, transferID, item.Quantity, item.ContainerID, item.ContainerType, now)
+		if err != nil {
+			tx.Rollback()
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create shipment item: "+err.Error())
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
+	}
+
+	shipment, err := loadShipment(shipmentID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Shipment created but failed to retrieve details: "+err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Shipment created successfully",
+		Data:    shipment,
+	})
+}
+
+// GetAllShipments retrieves all shipments
+// @Summary Get all shipments
+// @Description Retrieve all shipments, optionally filtered by status
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param status query string false "Shipment status"
+// @Success 200 {object} SuccessResponse{data=[]models.Shipment}
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments [get]
+func GetAllShipments(c *fiber.Ctx) error {
+	query := `
+		SELECT id, shipment_code, COALESCE(sender_id, 0), COALESCE(receiver_id, 0), COALESCE(carrier, ''),
+		       COALESCE(vehicle_id, ''), COALESCE(origin, ''), COALESCE(destination, ''), status,
+		       departure_time, arrival_time, COALESCE(notes, ''), created_at, updated_at, is_active
+		FROM shipment
+		WHERE is_active = true
+	`
+	args := []interface{}{}
+	if status := c.Query("status"); status != "" {
+		query += " AND status = $1"
+		args = append(args, status)
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error: "+err.Error())
+	}
+	defer rows.Close()
+
+	shipments := []models.Shipment{}
+	for rows.Next() {
+		shipment, err := scanShipment(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse shipment data: "+err.Error())
+		}
+		shipments = append(shipments, shipment)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Shipments retrieved successfully",
+		Data:    shipments,
+	})
+}
+
+// GetShipmentByID retrieves a shipment with its line items
+// @Summary Get shipment by ID
+// @Description Retrieve a shipment, the batches packed in each tank or container and its GPS route as GeoJSON
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param id path string true "Shipment ID"
+// @Success 200 {object} SuccessResponse{data=ShipmentDetail}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments/{id} [get]
+func GetShipmentByID(c *fiber.Ctx) error {
+	shipmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid shipment ID")
+	}
+
+	shipment, err := loadShipment(shipmentID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Shipment not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error: "+err.Error())
+	}
+
+	route, err := buildShipmentRoute(shipmentID, shipment.Status)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load shipment route: "+err.Error())
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Shipment retrieved successfully",
+		Data:    ShipmentDetail{Shipment: shipment, Route: &route},
+	})
+}
+
+// DispatchShipment marks a shipment as departed
+// @Summary Dispatch a shipment
+// @Description Mark a draft shipment as in transit and move every batch on board to in_transit
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param id path string true "Shipment ID"
+// @Success 200 {object} SuccessResponse{data=models.Shipment}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments/{id}/dispatch [post]
+func DispatchShipment(c *fiber.Ctx) error {
+	shipmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid shipment ID")
+	}
+
+	shipment, err := loadShipment(shipmentID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Shipment not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error: "+err.Error())
+	}
+	if shipment.Status != "draft" {
+		return fiber.NewError(fiber.StatusBadRequest, "Only draft shipments can be dispatched")
+	}
+
+	now := time.Now()
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start database transaction: "+err.Error())
+	}
+
+	_, err = tx.Exec(`
+		UPDATE shipment SET status = 'in_transit', departure_time = COALESCE(departure_time, $1), updated_at = $1
+		WHERE id = $2
+	`, now, shipmentID)
+	if err != nil {
+		tx.Rollback()
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update shipment: "+err.Error())
+	}
+
+	if err = updateShipmentCustody(tx, shipment, "in_transit", "in_transit", "batch_transfer_status_changed", shipment.Origin, shipment.SenderID, now); err != nil {
+		tx.Rollback()
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
+	}
+	publishShipmentCustody(shipment, "in_transit", "in_transit")
+
+	shipment, err = loadShipment(shipmentID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve updated shipment: "+err.Error())
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Shipment dispatched successfully",
+		Data:    shipment,
+	})
+}
+
+// ReceiveShipment confirms receipt of a shipment and hands custody of its batches to the receiver
+// @Summary Receive a shipment
+// @Description Record received quantities and condition per line item, complete the custody transfers and record the receipt on blockchain
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param id path string true "Shipment ID"
+// @Param request body ReceiveShipmentRequest false "Receipt details"
+// @Success 200 {object} SuccessResponse{data=models.Shipment}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments/{id}/receive [post]
+func ReceiveShipment(c *fiber.Ctx) error {
+	shipmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid shipment ID")
+	}
+
+	var req ReceiveShipmentRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request format: "+err.Error())
+		}
+	}
+
+	shipment, err := loadShipment(shipmentID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Shipment not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error: "+err.Error())
+	}
+	if shipment.Status != "draft" && shipment.Status != "in_transit" {
+		return fiber.NewError(fiber.StatusBadRequest, "Shipment has already been closed")
+	}
+
+	// Items not listed in the request are considered received in full and in good condition
+	receipts := map[int]ReceiveShipmentItemRequest{}
+	for _, r := range req.Items {
+		receipts[r.ItemID] = r
+	}
+	for itemID, r := range receipts {
+		found := false
+		for _, item := range shipment.Items {
+			if item.ID == itemID {
+				found = true
+				if r.ReceivedQuantity < 0 || r.ReceivedQuantity > item.Quantity {
+					return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid received quantity for item %d", itemID))
+				}
+			}
+		}
+		if !found {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Item %d does not belong to this shipment", itemID))
+		}
+	}
+
+	receivedBy := req.ReceivedBy
+	if receivedBy == 0 {
+		receivedBy = shipment.ReceiverID
+	}
+	location := req.Location
+	if location == "" {
+		location = shipment.Destination
+	}
+
+	now := time.Now()
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start database transaction: "+err.Error())
+	}
+
+	discrepancies := []map[string]interface{}{}
+	for i, item := range shipment.Items {
+		received := item.Quantity
+		condition := "good"
+		if r, ok := receipts[item.ID]; ok {
+			received = r.ReceivedQuantity
+			if r.Condition != "" {
+				condition = r.Condition
+			}
+		}
+		if received != item.Quantity || condition != "good" {
+			discrepancies = append(discrepancies, map[string]interface{}{
+				"item_id":           item.ID,
+				"batch_id":          item.BatchID,
+				"container_id":      item.ContainerID,
+				"quantity":          item.Quantity,
+				"received_quantity": received,
+				"condition":         condition,
+			})
+		}
+
+		_, err = tx.Exec(`
+			UPDATE shipment_item SET received_quantity = $1, condition = $2, updated_at = $3 WHERE id = $4
+		`, received, condition, now, item.ID)
+		if err != nil {
+			tx.Rollback()
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update shipment item: "+err.Error())
+		}
+		shipment.Items[i].ReceivedQuantity = received
+		shipment.Items[i].Condition = condition
+	}
+
+	_, err = tx.Exec(`
+		UPDATE shipment SET status = 'received', arrival_time = $1, updated_at = $1 WHERE id = $2
+	`, now, shipmentID)
+	if err != nil {
+		tx.Rollback()
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update shipment: "+err.Error())
+	}
+
+	if err = updateShipmentCustody(tx, shipment, "completed", "transferred", "batch_received", location, receivedBy, now); err != nil {
+		tx.Rollback()
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
+	}
+	publishShipmentCustody(shipment, "completed", "transferred")
+
+	// Record the receipt on blockchain
+	cfg := config.GetConfig()
+	blockchainClient := blockchain.NewBlockchainClient(
+		cfg.BlockchainNodeURL,
+		cfg.BlockchainPrivateKey,
+		cfg.BlockchainAccount,
+		cfg.BlockchainChainID,
+		cfg.BlockchainConsensus,
+	)
+	receipt := map[string]interface{}{
+		"shipment_id":   shipmentID,
+		"shipment_code": shipment.ShipmentCode,
+		"received_by":   receivedBy,
+		"items":         shipment.Items,
+		"discrepancies": discrepancies,
+		"timestamp":     now,
+	}
+	txResult, err := blockchainClient.SubmitTransaction("SHIPMENT_RECEIVED", receipt)
+	if err == nil && txResult != "" {
+		metadataHash, _ := blockchainClient.HashData(receipt)
+		_, err = db.DB.Exec(
+			"INSERT INTO blockchain_record (related_table, related_id, tx_id, metadata_hash, created_at, updated_at, is_active) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			"shipment",
+			shipmentID,
+			txResult,
+			metadataHash,
+			now,
+			now,
+			true,
+		)
+		if err != nil {
+			fmt.Printf("Failed to record blockchain transaction: %v\n", err)
+		}
+	}
+
+	shipment, err = loadShipment(shipmentID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve updated shipment: "+err.Error())
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Shipment received successfully",
+		Data:    shipment,
+	})
+}
+
+// GetShipmentManifest generates the manifest of a shipment
+// @Summary Get shipment manifest
+// @Description Generate the manifest listing every tank/container and the batches it carries, as JSON or CSV
+// @Tags shipments
+// @Accept json
+// @Produce json,text/csv
+// @Param id path string true "Shipment ID"
+// @Param format query string false "Output format (json or csv)" default(json)
+// @Success 200 {object} SuccessResponse{data=ShipmentManifest}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments/{id}/manifest [get]
+func GetShipmentManifest(c *fiber.Ctx) error {
+	shipmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid shipment ID")
+	}
+
+	format := c.Query("format", "json")
+	if format != "json" && format != "csv" {
+		return fiber.NewError(fiber.StatusBadRequest, "Format must be json or csv")
+	}
+
+	manifest, err := buildShipmentManifest(shipmentID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Shipment not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build manifest: "+err.Error())
+	}
+
+	if format == "csv" {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"shipment_code", manifest.ShipmentCode})
+		w.Write([]string{"sscc", manifest.SSCC})
+		w.Write([]string{"sender", manifest.SenderName})
+		w.Write([]string{"receiver", manifest.ReceiverName})
+		w.Write([]string{"carrier", manifest.Carrier})
+		w.Write([]string{"vehicle_id", manifest.VehicleID})
+		w.Write([]string{"origin", manifest.Origin})
+		w.Write([]string{"destination", manifest.Destination})
+		w.Write([]string{})
+		w.Write([]string{"container_id", "container_type", "batch_id", "species", "hatchery", "quantity", "received_quantity", "condition"})
+		for _, line := range manifest.Lines {
+			w.Write([]string{
+				line.ContainerID,
+				line.ContainerType,
+				strconv.Itoa(line.BatchID),
+				line.Species,
+				line.HatcheryName,
+				strconv.Itoa(line.Quantity),
+				strconv.Itoa(line.ReceivedQuantity),
+				line.Condition,
+			})
+		}
+		w.Flush()
+
+		c.Set("Content-Type", "text/csv")
+		c.Set("Content-Disposition", "attachment; filename="+manifest.ShipmentCode+"-manifest.csv")
+		return c.Send(buf.Bytes())
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Shipment manifest generated successfully",
+		Data:    manifest,
+	})
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanShipment scans a shipment header row
+func scanShipment(row rowScanner) (models.Shipment, error) {
+	var s models.Shipment
+	var departure, arrival sql.NullTime
+	err := row.Scan(&s.ID, &s.ShipmentCode, &s.SenderID, &s.ReceiverID, &s.Carrier, &s.VehicleID, &s.Origin,
+		&s.Destination, &s.Status, &departure, &arrival, &s.Notes, &s.CreatedAt, &s.UpdatedAt, &s.IsActive)
+	if departure.Valid {
+		s.DepartureTime = &departure.Time
+	}
+	if arrival.Valid {
+		s.ArrivalTime = &arrival.Time
+	}
+	return s, err
+}
+
+// loadShipment loads a shipment and its line items
+func loadShipment(shipmentID int) (models.Shipment, error) {
+	shipment, err := scanShipment(db.DB.QueryRow(`
+		SELECT id, shipment_code, COALESCE(sender_id, 0), COALESCE(receiver_id, 0), COALESCE(carrier, ''),
+		       COALESCE(vehicle_id, ''), COALESCE(origin, ''), COALESCE(destination, ''), status,
+		       departure_time, arrival_time, COALESCE(notes, ''), created_at, updated_at, is_active
+		FROM shipment
+		WHERE id = $1 AND is_active = true
+	`, shipmentID))
+	if err != nil {
+		return shipment, err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, shipment_id, batch_id, COALESCE(transfer_id, 0), quantity, COALESCE(container_id, ''),
+		       COALESCE(container_type, ''), COALESCE(received_quantity, 0), COALESCE(condition, ''),
+		       created_at, updated_at, is_active
+		FROM shipment_item
+		WHERE shipment_id = $1 AND is_active = true
+		ORDER BY container_id, id
+	`, shipmentID)
+	if err != nil {
+		return shipment, err
+	}
+	defer rows.Close()
+
+	shipment.Items = []models.ShipmentItem{}
+	for rows.Next() {
+		var item models.ShipmentItem
+		if err := rows.Scan(&item.ID, &item.ShipmentID, &item.BatchID, &item.TransferID, &item.Quantity,
+			&item.ContainerID, &item.ContainerType, &item.ReceivedQuantity, &item.Condition,
+			&item.CreatedAt, &item.UpdatedAt, &item.IsActive); err != nil {
+			return shipment, err
+		}
+		shipment.Items = append(shipment.Items, item)
+	}
+	return shipment, rows.Err()
+}
+
+// updateShipmentCustody moves every transfer and batch of a shipment to a new status and logs a batch event
+func updateShipmentCustody(tx *sql.Tx, shipment models.Shipment, transferStatus, batchStatus, eventType, location string, actorID int, now time.Time) error {
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"shipment_id":   shipment.ID,
+		"shipment_code": shipment.ShipmentCode,
+		"new_status":    transferStatus,
+	})
+
+	done := map[int]bool{}
+	for _, item := range shipment.Items {
+		if done[item.BatchID] {
+			continue
+		}
+		done[item.BatchID] = true
+
+		if item.TransferID != 0 {
+			_, err := tx.Exec("UPDATE shipment_transfer SET status = $1, updated_at = $2 WHERE id = $3", transferStatus, now, item.TransferID)
+			if err != nil {
+				return fmt.Errorf("failed to update transfer record: %v", err)
+			}
+		}
+
+		_, err := tx.Exec("UPDATE batch SET status = $1, updated_at = $2 WHERE id = $3", batchStatus, now, item.BatchID)
+		if err != nil {
+			return fmt.Errorf("failed to update batch status: %v", err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO event (batch_id, event_type, actor_id, location, timestamp, metadata, updated_at, is_active)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, item.BatchID, eventType, actorID, location, now, metadata, now, true)
+		if err != nil {
+			return fmt.Errorf("failed to create event record: %v", err)
+		}
+	}
+	return nil
+}
+
+// buildShipmentManifest assembles the manifest document for a shipment
+func buildShipmentManifest(shipmentID int) (ShipmentManifest, error) {
+	var manifest ShipmentManifest
+	shipment, err := loadShipment(shipmentID)
+	if err != nil {
+		return manifest, err
+	}
+
+	manifest = ShipmentManifest{
+		ShipmentCode:  shipment.ShipmentCode,
+		Status:        shipment.Status,
+		Carrier:       shipment.Carrier,
+		VehicleID:     shipment.VehicleID,
+		Origin:        shipment.Origin,
+		Destination:   shipment.Destination,
+		DepartureTime: shipment.DepartureTime,
+		ArrivalTime:   shipment.ArrivalTime,
+		Lines:         []ShipmentManifestLine{},
+		GeneratedAt:   time.Now(),
+	}
+
+	nameQuery := "SELECT COALESCE(NULLIF(full_name, ''), username) FROM account WHERE id = $1"
+	if err := db.DB.QueryRow(nameQuery, shipment.SenderID).Scan(&manifest.SenderName); err != nil && err != sql.ErrNoRows {
+		return manifest, err
+	}
+	if err := db.DB.QueryRow(nameQuery, shipment.ReceiverID).Scan(&manifest.ReceiverName); err != nil && err != sql.ErrNoRows {
+		return manifest, err
+	}
+
+	// SSCC allocated for the whole consignment, if any
+	err = db.DB.QueryRow(`
+		SELECT value FROM gs1_identifier
+		WHERE id_type = 'SSCC' AND entity_type = 'shipment' AND entity_id = $1 AND is_active = true
+		ORDER BY id LIMIT 1
+	`, shipmentID).Scan(&manifest.SSCC)
+	if err != nil && err != sql.ErrNoRows {
+		return manifest, err
+	}
+
+	containers := map[string]bool{}
+	batches := map[int]bool{}
+	for _, item := range shipment.Items {
+		line := ShipmentManifestLine{
+			ContainerID:      item.ContainerID,
+			ContainerType:    item.ContainerType,
+			BatchID:          item.BatchID,
+			Quantity:         item.Quantity,
+			ReceivedQuantity: item.ReceivedQuantity,
+			Condition:        item.Condition,
+		}
+		err := db.DB.QueryRow(`
+			SELECT COALESCE(b.species, ''), COALESCE(h.name, '')
+			FROM batch b
+			LEFT JOIN hatchery h ON b.hatchery_id = h.id
+			WHERE b.id = $1
+		`, item.BatchID).Scan(&line.Species, &line.HatcheryName)
+		if err != nil && err != sql.ErrNoRows {
+			return manifest, err
+		}
+
+		manifest.Lines = append(manifest.Lines, line)
+		manifest.TotalQuantity += item.Quantity
+		containers[item.ContainerID] = true
+		batches[item.BatchID] = true
+	}
+	manifest.ContainerCount = len(containers)
+	manifest.BatchCount = len(batches)
+
+	return manifest, nil
+}
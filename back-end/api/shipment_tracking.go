@@ -0,0 +1,308 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxGPSPingsPerRequest limits how many buffered pings a device can upload at once
+const maxGPSPingsPerRequest = 500
+
+// GPSPing represents a single GPS fix pushed by a transporter
+type GPSPing struct {
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	SpeedKMH   float64   `json:"speed_kmh,omitempty"`
+	Heading    float64   `json:"heading,omitempty"`
+	Accuracy   float64   `json:"accuracy,omitempty"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// RecordShipmentGPSRequest represents a batch of GPS pings for a shipment
+type RecordShipmentGPSRequest struct {
+	DeviceID string    `json:"device_id"`
+	Pings    []GPSPing `json:"pings"`
+}
+
+// RecordShipmentGPSResponse lists the alerts raised by newly ingested pings
+type RecordShipmentGPSResponse struct {
+	StopAlerts     []ShipmentRouteAlert    `json:"stop_alerts"`
+	GeofenceAlerts []ShipmentGeofenceAlert `json:"geofence_alerts"`
+}
+
+// ShipmentRouteAlert represents an unplanned long stop detected on a route
+type ShipmentRouteAlert struct {
+	ID              int       `json:"id"`
+	ShipmentID      int       `json:"shipment_id"`
+	AlertType       string    `json:"alert_type"`
+	Latitude        float64   `json:"latitude"`
+	Longitude       float64   `json:"longitude"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationMinutes float64   `json:"duration_minutes"`
+	Ongoing         bool      `json:"ongoing"`
+}
+
+// ShipmentRouteResponse represents the tracked route of a shipment
+type ShipmentRouteResponse struct {
+	ShipmentID int                     `json:"shipment_id"`
+	Route      map[string]interface{}  `json:"route"`
+	Stops      []utils.RouteStop       `json:"stops"`
+	Alerts     []ShipmentRouteAlert    `json:"alerts"`
+	Geofences  []ShipmentGeofence      `json:"geofences"`
+	Deviations []ShipmentGeofenceAlert `json:"geofence_alerts"`
+}
+
+// RecordShipmentGPS ingests GPS pings pushed by the transporter of a shipment
+// @Summary Record shipment GPS pings
+// @Description Push one or more periodic GPS pings for a shipment in transit. Unplanned long stops and geofence violations are detected and stored as alerts
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param id path string true "Shipment ID"
+// @Param request body RecordShipmentGPSRequest true "GPS pings"
+// @Success 201 {object} SuccessResponse{data=RecordShipmentGPSResponse}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments/{id}/gps [post]
+func RecordShipmentGPS(c *fiber.Ctx) error {
+	shipmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid shipment ID")
+	}
+
+	var req RecordShipmentGPSRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request format")
+	}
+	if len(req.Pings) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one GPS ping is required")
+	}
+	if len(req.Pings) > maxGPSPingsPerRequest {
+		return fiber.NewError(fiber.StatusBadRequest, "Too many GPS pings in one request")
+	}
+
+	now := time.Now()
+	for i, ping := range req.Pings {
+		if ping.Latitude < -90 || ping.Latitude > 90 {
+			return fiber.NewError(fiber.StatusBadRequest, "Latitude must be between -90 and 90")
+		}
+		if ping.Longitude < -180 || ping.Longitude > 180 {
+			return fiber.NewError(fiber.StatusBadRequest, "Longitude must be between -180 and 180")
+		}
+		if ping.RecordedAt.IsZero() {
+			req.Pings[i].RecordedAt = now
+		} else if ping.RecordedAt.After(now.Add(5 * time.Minute)) {
+			return fiber.NewError(fiber.StatusBadRequest, "GPS ping timestamp is in the future")
+		}
+	}
+
+	var status string
+	err = db.DB.QueryRow("SELECT status FROM shipment WHERE id = $1 AND is_active = true", shipmentID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Shipment not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if status != "draft" && status != "in_transit" {
+		return fiber.NewError(fiber.StatusBadRequest, "GPS pings can only be recorded for open shipments")
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start database transaction")
+	}
+	for _, ping := range req.Pings {
+		_, err = tx.Exec(`
+			INSERT INTO shipment_gps_ping (shipment_id, device_id, latitude, longitude, speed_kmh, heading, accuracy, recorded_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, shipmentID, req.DeviceID, ping.Latitude, ping.Longitude, ping.SpeedKMH, ping.Heading, ping.Accuracy, ping.RecordedAt)
+		if err != nil {
+			tx.Rollback()
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to record GPS ping: "+err.Error())
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+
+	// Re-evaluate stops with the new pings
+	points, err := loadShipmentRoutePoints(shipmentID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load shipment route")
+	}
+	stopAlerts, err := recordShipmentStopAlerts(shipmentID, detectShipmentStops(points, false))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record route alerts")
+	}
+	geofenceAlerts, err := evaluateShipmentGeofences(shipmentID, req.Pings)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to evaluate geofences")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: strconv.Itoa(len(req.Pings)) + " GPS pings recorded successfully",
+		Data: RecordShipmentGPSResponse{
+			StopAlerts:     stopAlerts,
+			GeofenceAlerts: geofenceAlerts,
+		},
+	})
+}
+
+// GetShipmentRoute returns the tracked route of a shipment as GeoJSON
+// @Summary Get shipment route
+// @Description Get the GPS route of a shipment as a GeoJSON FeatureCollection with detected stops and unplanned stop alerts
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param id path string true "Shipment ID"
+// @Success 200 {object} SuccessResponse{data=ShipmentRouteResponse}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments/{id}/route [get]
+func GetShipmentRoute(c *fiber.Ctx) error {
+	shipmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid shipment ID")
+	}
+
+	var status string
+	err = db.DB.QueryRow("SELECT status FROM shipment WHERE id = $1 AND is_active = true", shipmentID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Shipment not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	route, err := buildShipmentRoute(shipmentID, status)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load shipment route")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Shipment route retrieved successfully",
+		Data:    route,
+	})
+}
+
+// buildShipmentRoute assembles the GeoJSON route, stops and alerts of a shipment
+func buildShipmentRoute(shipmentID int, status string) (ShipmentRouteResponse, error) {
+	response := ShipmentRouteResponse{ShipmentID: shipmentID}
+
+	points, err := loadShipmentRoutePoints(shipmentID)
+	if err != nil {
+		return response, err
+	}
+	closed := status == "received" || status == "cancelled"
+	response.Stops = detectShipmentStops(points, closed)
+	response.Route = utils.RouteGeoJSON(points, response.Stops, map[string]interface{}{
+		"shipment_id": shipmentID,
+		"status":      status,
+	})
+
+	rows, err := db.DB.Query(`
+		SELECT id, shipment_id, alert_type, COALESCE(latitude, 0), COALESCE(longitude, 0), started_at,
+		       COALESCE(duration_minutes, 0), ongoing
+		FROM shipment_route_alert
+		WHERE shipment_id = $1
+		ORDER BY started_at
+	`, shipmentID)
+	if err != nil {
+		return response, err
+	}
+	defer rows.Close()
+
+	response.Alerts = []ShipmentRouteAlert{}
+	for rows.Next() {
+		var a ShipmentRouteAlert
+		if err := rows.Scan(&a.ID, &a.ShipmentID, &a.AlertType, &a.Latitude, &a.Longitude, &a.StartedAt,
+			&a.DurationMinutes, &a.Ongoing); err != nil {
+			return response, err
+		}
+		if closed {
+			a.Ongoing = false
+		}
+		response.Alerts = append(response.Alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return response, err
+	}
+
+	if response.Geofences, err = loadShipmentGeofences(shipmentID); err != nil {
+		return response, err
+	}
+	response.Deviations, err = loadShipmentGeofenceAlerts(shipmentID)
+	return response, err
+}
+
+// loadShipmentRoutePoints loads the GPS pings of a shipment ordered by time
+func loadShipmentRoutePoints(shipmentID int) ([]utils.RoutePoint, error) {
+	rows, err := db.DB.Query(`
+		SELECT latitude, longitude, COALESCE(speed_kmh, 0), recorded_at
+		FROM shipment_gps_ping
+		WHERE shipment_id = $1
+		ORDER BY recorded_at, id
+	`, shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []utils.RoutePoint{}
+	for rows.Next() {
+		var p utils.RoutePoint
+		if err := rows.Scan(&p.Latitude, &p.Longitude, &p.SpeedKMH, &p.RecordedAt); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// detectShipmentStops applies the configured stop thresholds to a route
+func detectShipmentStops(points []utils.RoutePoint, closed bool) []utils.RouteStop {
+	cfg := config.GetConfig()
+	return utils.DetectStops(points, cfg.GPSStopRadiusMeters, time.Duration(cfg.GPSLongStopMinutes)*time.Minute, closed)
+}
+
+// recordShipmentStopAlerts stores or refreshes an alert for every unplanned stop
+func recordShipmentStopAlerts(shipmentID int, stops []utils.RouteStop) ([]ShipmentRouteAlert, error) {
+	alerts := []ShipmentRouteAlert{}
+	for _, stop := range stops {
+		if stop.Planned {
+			continue
+		}
+		alert := ShipmentRouteAlert{
+			ShipmentID:      shipmentID,
+			AlertType:       "unplanned_long_stop",
+			Latitude:        stop.Latitude,
+			Longitude:       stop.Longitude,
+			StartedAt:       stop.StartedAt,
+			DurationMinutes: stop.DurationMinutes,
+			Ongoing:         stop.Ongoing,
+		}
+		err := db.DB.QueryRow(`
+			INSERT INTO shipment_route_alert (shipment_id, alert_type, latitude, longitude, started_at, duration_minutes, ongoing)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (shipment_id, alert_type, started_at)
+			DO UPDATE SET duration_minutes = EXCLUDED.duration_minutes, ongoing = EXCLUDED.ongoing, updated_at = CURRENT_TIMESTAMP
+			RETURNING id
+		`, shipmentID, alert.AlertType, alert.Latitude, alert.Longitude, alert.StartedAt, alert.DurationMinutes, alert.Ongoing).Scan(&alert.ID)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/signing"
+)
+
+// GetJWKS publishes the keys outbound payloads and access tokens are signed with
+// @Summary Get the platform JSON Web Key Set
+// @Description Public keys that verify RS256 access tokens and the detached JWS sent in the X-TracePost-JWS header of webhook and notification payloads.
+// @Description Select the key by the kid of the token or JWS header. A detached JWS has the form "<header>..<signature>"; put the base64url encoded body between the dots to verify it.
+// @Description Retired keys stay listed for a while after a rotation so payloads signed before it can still be verified
+// @Tags signing
+// @Produce json
+// @Success 200 {object} signing.JWKS
+// @Failure 500 {object} ErrorResponse
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *fiber.Ctx) error {
+	set, err := signing.Default().JWKS()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load signing keys")
+	}
+	c.Set("Cache-Control", "public, max-age=300")
+	return c.JSON(set)
+}
+
+// ListSigningKeys lists the payload signing keys
+// @Summary List signing keys
+// @Description List the active and retired keys outbound payloads are signed with; private keys are never returned
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]signing.Key}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/signing-keys [get]
+func ListSigningKeys(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	keys, err := signing.Default().Keys(false)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve signing keys")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Signing keys retrieved successfully",
+		Data:    keys,
+	})
+}
+
+// RotateSigningKey replaces the active signing key of a purpose
+// @Summary Rotate a signing key
+// @Description Generate a new active key for payloads or access tokens. The previous key stops signing but stays in the JWKS for the retention period,
+// @Description so tokens and payloads it signed keep verifying
+// @Tags admin
+// @Produce json
+// @Param purpose query string false "Key purpose: payload (default) or token"
+// @Success 200 {object} SuccessResponse{data=signing.Key}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/signing-keys/rotate [post]
+func RotateSigningKey(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	purpose := c.Query("purpose", signing.PurposePayload)
+	if _, ok := signing.Algorithms[purpose]; !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "Purpose must be payload or token")
+	}
+	userID, _ := c.Locals("userID").(int)
+	key, err := signing.Default().Rotate(purpose, userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to rotate signing key")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Signing key rotated successfully",
+		Data:    key,
+	})
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/statuspage"
+)
+
+// StatusIncidentRequest represents a request to post or update a status page incident
+type StatusIncidentRequest struct {
+	Title      string    `json:"title"`
+	Message    string    `json:"message"`
+	Status     string    `json:"status"`     // investigating, identified, monitoring or resolved; default investigating
+	Impact     string    `json:"impact"`     // minor, major or critical; default minor
+	Components []string  `json:"components"` // api, database, ipfs, anchoring or interop
+	StartedAt  time.Time `json:"started_at,omitempty"`
+}
+
+// incident converts the request to an incident
+func (r StatusIncidentRequest) incident() statuspage.Incident {
+	return statuspage.Incident{
+		Title:      r.Title,
+		Message:    r.Message,
+		Status:     r.Status,
+		Impact:     r.Impact,
+		Components: r.Components,
+		StartedAt:  r.StartedAt,
+	}
+}
+
+// statusIncidentError maps an incident error to an HTTP error
+func statusIncidentError(err error, message string) error {
+	switch {
+	case errors.Is(err, statuspage.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Incident not found")
+	case errors.Is(err, statuspage.ErrInvalidIncident):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, message)
+}
+
+// GetPlatformStatus returns the state of the platform for the public status page
+// @Summary Get platform status
+// @Description Get the status of the API, database, IPFS pinning, blockchain anchoring and interoperability relayer, with the unresolved incidents and those resolved in the last week.
+// @Description Component checks are cached for a short time; an unresolved incident worsens the status of the components it affects
+// @Tags health
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=statuspage.Status}
+// @Failure 500 {object} ErrorResponse
+// @Router /status [get]
+func GetPlatformStatus(c *fiber.Ctx) error {
+	status, err := statuspage.Default().Status()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve platform status")
+	}
+	c.Set(fiber.HeaderCacheControl, "public, max-age=30")
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Platform status retrieved successfully",
+		Data:    status,
+	})
+}
+
+// ListStatusIncidents lists status page incidents
+// @Summary List status incidents
+// @Description List the status page incidents that started in a period, latest first
+// @Tags admin
+// @Produce json
+// @Param from query string false "Start time (RFC3339), default 90 days before to"
+// @Param to query string false "End time (RFC3339), default now"
+// @Success 200 {object} SuccessResponse{data=[]statuspage.Incident}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/status-incidents [get]
+func ListStatusIncidents(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return err
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -90)
+	}
+
+	incidents, err := statuspage.List(from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve incidents")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Incidents retrieved successfully",
+		Data:    incidents,
+	})
+}
+
+// CreateStatusIncident posts an incident on the status page
+// @Summary Create status incident
+// @Description Post an incident on the public status page for one or more components
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body StatusIncidentRequest true "Incident"
+// @Success 201 {object} SuccessResponse{data=statuspage.Incident}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/status-incidents [post]
+func CreateStatusIncident(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	var req StatusIncidentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	incident, err := statuspage.Create(req.incident(), userID)
+	if err != nil {
+		return statusIncidentError(err, "Failed to create incident")
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Incident created successfully",
+		Data:    incident,
+	})
+}
+
+// UpdateStatusIncident updates an incident of the status page
+// @Summary Update status incident
+// @Description Replace the title, message, status, impact and components of an incident. Setting the status to resolved records when it was resolved
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param incidentId path int true "Incident ID"
+// @Param request body StatusIncidentRequest true "Incident"
+// @Success 200 {object} SuccessResponse{data=statuspage.Incident}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/status-incidents/{incidentId} [put]
+func UpdateStatusIncident(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	incidentID, err := strconv.Atoi(c.Params("incidentId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid incident ID format")
+	}
+	var req StatusIncidentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	incident, err := statuspage.Update(incidentID, req.incident(), userID)
+	if err != nil {
+		return statusIncidentError(err, "Failed to update incident")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Incident updated successfully",
+		Data:    incident,
+	})
+}
+
+// DeleteStatusIncident deletes an incident posted by mistake
+// @Summary Delete status incident
+// @Description Delete an incident posted on the status page by mistake; resolve incidents that happened instead
+// @Tags admin
+// @Produce json
+// @Param incidentId path int true "Incident ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/status-incidents/{incidentId} [delete]
+func DeleteStatusIncident(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	incidentID, err := strconv.Atoi(c.Params("incidentId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid incident ID format")
+	}
+
+	if err := statuspage.Delete(incidentID); err != nil {
+		return statusIncidentError(err, "Failed to delete incident")
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Incident deleted successfully",
+	})
+}
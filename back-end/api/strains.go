@@ -0,0 +1,329 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// Line types of genetic strains
+const (
+	LineTypeSPF          = "spf"     // Specific pathogen free
+	LineTypeSPR          = "spr"     // Specific pathogen resistant
+	LineTypeSPFSPR       = "spf_spr" // Both
+	LineTypeConventional = "conventional"
+)
+
+// StrainRequest represents a request to register or update a strain
+type StrainRequest struct {
+	Code            string   `json:"code"`
+	Name            string   `json:"name"`
+	Species         string   `json:"species"`
+	LineType        string   `json:"line_type"`
+	Supplier        string   `json:"supplier"`
+	SupplierCountry string   `json:"supplier_country"`
+	Pathogens       []string `json:"pathogens"`
+	Description     string   `json:"description"`
+}
+
+// SetBatchStrainRequest represents a request to declare the strain of a batch
+type SetBatchStrainRequest struct {
+	StrainID int `json:"strain_id"`
+}
+
+const strainColumns = `
+	id, code, name, COALESCE(species, ''), COALESCE(line_type, 'conventional'), COALESCE(supplier, ''),
+	COALESCE(supplier_country, ''), COALESCE(pathogens, '{}'), COALESCE(description, ''), created_at, updated_at, is_active
+`
+
+// scanStrain reads a strain selected with strainColumns
+func scanStrain(row rowScanner) (models.Strain, error) {
+	var s models.Strain
+	err := row.Scan(&s.ID, &s.Code, &s.Name, &s.Species, &s.LineType, &s.Supplier,
+		&s.SupplierCountry, pq.Array(&s.Pathogens), &s.Description, &s.CreatedAt, &s.UpdatedAt, &s.IsActive)
+	return s, err
+}
+
+// loadStrain loads an active strain
+func loadStrain(strainID int) (models.Strain, error) {
+	return scanStrain(db.DB.QueryRow(`SELECT `+strainColumns+` FROM strain WHERE id = $1 AND is_active = true`, strainID))
+}
+
+// validateStrainRequest checks the fields of a strain request
+func validateStrainRequest(req *StrainRequest) error {
+	req.Code = strings.TrimSpace(req.Code)
+	if req.Code == "" || req.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Code and name are required")
+	}
+	if req.LineType == "" {
+		req.LineType = LineTypeConventional
+	}
+	switch req.LineType {
+	case LineTypeSPF, LineTypeSPR, LineTypeSPFSPR, LineTypeConventional:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Line type must be spf, spr, spf_spr or conventional")
+	}
+	if req.Pathogens == nil {
+		req.Pathogens = []string{}
+	}
+	return nil
+}
+
+// CreateStrain registers a genetic strain
+// @Summary Create strain
+// @Description Register a genetic line (SPF, SPR or conventional) and its genetic supplier
+// @Tags strains
+// @Accept json
+// @Produce json
+// @Param request body StrainRequest true "Strain details"
+// @Success 201 {object} SuccessResponse{data=models.Strain}
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /strains [post]
+func CreateStrain(c *fiber.Ctx) error {
+	var req StrainRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateStrainRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM strain WHERE code = $1)", req.Code).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A strain with this code already exists")
+	}
+
+	strain, err := scanStrain(db.DB.QueryRow(`
+		INSERT INTO strain (code, name, species, line_type, supplier, supplier_country, pathogens, description, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW(), true)
+		RETURNING `+strainColumns,
+		req.Code, req.Name, req.Species, req.LineType, req.Supplier, req.SupplierCountry, pq.Array(req.Pathogens), req.Description))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create strain")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Strain created successfully",
+		Data:    strain,
+	})
+}
+
+// GetAllStrains lists genetic strains
+// @Summary Get all strains
+// @Description List genetic strains, optionally filtered by line type and supplier
+// @Tags strains
+// @Produce json
+// @Param line_type query string false "Line type (spf, spr, spf_spr, conventional)"
+// @Param supplier query string false "Genetic supplier"
+// @Success 200 {object} SuccessResponse{data=[]models.Strain}
+// @Failure 500 {object} ErrorResponse
+// @Router /strains [get]
+func GetAllStrains(c *fiber.Ctx) error {
+	rows, err := db.DB.Query(`SELECT `+strainColumns+`
+		FROM strain
+		WHERE is_active = true
+			AND ($1::text = '' OR line_type = $1)
+			AND ($2::text = '' OR supplier ILIKE $2)
+		ORDER BY code
+	`, c.Query("line_type"), c.Query("supplier"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	strains := []models.Strain{}
+	for rows.Next() {
+		strain, err := scanStrain(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse strain")
+		}
+		strains = append(strains, strain)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Strains retrieved successfully",
+		Data:    strains,
+	})
+}
+
+// GetStrainByID gets a genetic strain
+// @Summary Get strain by ID
+// @Description Get a genetic strain
+// @Tags strains
+// @Produce json
+// @Param strainId path int true "Strain ID"
+// @Success 200 {object} SuccessResponse{data=models.Strain}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /strains/{strainId} [get]
+func GetStrainByID(c *fiber.Ctx) error {
+	strainID, err := strconv.Atoi(c.Params("strainId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid strain ID format")
+	}
+
+	strain, err := loadStrain(strainID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Strain not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Strain retrieved successfully",
+		Data:    strain,
+	})
+}
+
+// UpdateStrain updates a genetic strain
+// @Summary Update strain
+// @Description Update a genetic strain
+// @Tags strains
+// @Accept json
+// @Produce json
+// @Param strainId path int true "Strain ID"
+// @Param request body StrainRequest true "Strain details"
+// @Success 200 {object} SuccessResponse{data=models.Strain}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /strains/{strainId} [put]
+func UpdateStrain(c *fiber.Ctx) error {
+	strainID, err := strconv.Atoi(c.Params("strainId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid strain ID format")
+	}
+
+	var req StrainRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateStrainRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM strain WHERE code = $1 AND id <> $2)", req.Code, strainID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A strain with this code already exists")
+	}
+
+	strain, err := scanStrain(db.DB.QueryRow(`
+		UPDATE strain
+		SET code = $2, name = $3, species = $4, line_type = $5, supplier = $6, supplier_country = $7,
+			pathogens = $8, description = $9, updated_at = NOW()
+		WHERE id = $1 AND is_active = true
+		RETURNING `+strainColumns,
+		strainID, req.Code, req.Name, req.Species, req.LineType, req.Supplier, req.SupplierCountry, pq.Array(req.Pathogens), req.Description))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Strain not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update strain")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Strain updated successfully",
+		Data:    strain,
+	})
+}
+
+// DeleteStrain soft deletes a genetic strain
+// @Summary Delete strain
+// @Description Soft delete a genetic strain. Batches keep their declared strain
+// @Tags strains
+// @Produce json
+// @Param strainId path int true "Strain ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /strains/{strainId} [delete]
+func DeleteStrain(c *fiber.Ctx) error {
+	strainID, err := strconv.Atoi(c.Params("strainId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid strain ID format")
+	}
+
+	result, err := db.DB.Exec("UPDATE strain SET is_active = false, updated_at = NOW() WHERE id = $1 AND is_active = true", strainID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete strain")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Strain not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Strain deleted successfully",
+	})
+}
+
+// SetBatchStrain declares the genetic strain of a batch
+// @Summary Set batch strain
+// @Description Declare the genetic strain a batch belongs to
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param request body SetBatchStrainRequest true "Strain"
+// @Success 200 {object} SuccessResponse{data=models.Strain}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/strain [put]
+func SetBatchStrain(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	var req SetBatchStrainRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	strain, err := loadStrain(req.StrainID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Strain not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	result, err := db.DB.Exec("UPDATE batch SET strain_id = $2, updated_at = NOW() WHERE id = $1 AND is_active = true", batchID, strain.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to set batch strain")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch strain set successfully",
+		Data:    strain,
+	})
+}
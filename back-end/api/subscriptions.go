@@ -0,0 +1,575 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+)
+
+// Limits and features of a subscription plan that requests are checked against
+const (
+	LimitBatches   = "batches" // Batches created per calendar month
+	LimitStorage   = "storage" // Megabytes of documents stored
+	FeatureInterop = "interop" // Cross-chain sharing and interoperability endpoints
+)
+
+// What happens to requests over a plan limit
+const (
+	OverageBlock = "block" // Reject with 402 Payment Required
+	OverageWarn  = "warn"  // Allow with an X-Subscription-Warning header
+)
+
+// subscriptionWarnRatio is the share of a limit from which requests carry a warning
+const subscriptionWarnRatio = 0.8
+
+// SubscriptionPlan is a plan tier; limits left empty are unlimited
+type SubscriptionPlan struct {
+	ID                 int       `json:"id"`
+	Code               string    `json:"code"`
+	Name               string    `json:"name"`
+	Description        string    `json:"description"`
+	MaxBatchesPerMonth *int      `json:"max_batches_per_month"`
+	MaxStorageMB       *int      `json:"max_storage_mb"`
+	InteropEnabled     bool      `json:"interop_enabled"`
+	OverageAction      string    `json:"overage_action"` // block or warn
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// SubscriptionPlanRequest represents a request to create or update a plan
+type SubscriptionPlanRequest struct {
+	Code               string `json:"code"`
+	Name               string `json:"name"`
+	Description        string `json:"description"`
+	MaxBatchesPerMonth *int   `json:"max_batches_per_month"`
+	MaxStorageMB       *int   `json:"max_storage_mb"`
+	InteropEnabled     bool   `json:"interop_enabled"`
+	OverageAction      string `json:"overage_action"`
+}
+
+// AssignPlanRequest represents a request to move a company to a plan
+type AssignPlanRequest struct {
+	PlanCode string `json:"plan_code"`
+	Notes    string `json:"notes"`
+}
+
+// SubscriptionConsumption is what a company uses against the limits of its plan
+type SubscriptionConsumption struct {
+	BatchesThisMonth int      `json:"batches_this_month"`
+	BatchesPercent   *float64 `json:"batches_percent,omitempty"`
+	StorageMB        float64  `json:"storage_mb"`
+	StoragePercent   *float64 `json:"storage_percent,omitempty"`
+	OverLimits       []string `json:"over_limits"`
+}
+
+// CompanySubscription is the plan of a company with its consumption; Plan is nil for companies
+// without a plan, which are not limited
+type CompanySubscription struct {
+	CompanyID   int                     `json:"company_id"`
+	CompanyName string                  `json:"company_name"`
+	Plan        *SubscriptionPlan       `json:"plan"`
+	StartedAt   *time.Time              `json:"started_at,omitempty"`
+	AssignedBy  int                     `json:"assigned_by,omitempty"`
+	Notes       string                  `json:"notes,omitempty"`
+	Consumption SubscriptionConsumption `json:"consumption"`
+}
+
+const subscriptionPlanColumns = `
+	p.id, p.code, p.name, COALESCE(p.description, ''), p.max_batches_per_month, p.max_storage_mb,
+	COALESCE(p.interop_enabled, false), COALESCE(p.overage_action, 'block'), p.created_at, p.updated_at
+`
+
+// scanSubscriptionPlan reads a plan selected with subscriptionPlanColumns
+func scanSubscriptionPlan(row rowScanner) (SubscriptionPlan, error) {
+	var p SubscriptionPlan
+	var maxBatches, maxStorage sql.NullInt64
+	err := row.Scan(&p.ID, &p.Code, &p.Name, &p.Description, &maxBatches, &maxStorage,
+		&p.InteropEnabled, &p.OverageAction, &p.CreatedAt, &p.UpdatedAt)
+	p.MaxBatchesPerMonth = intPtr(maxBatches)
+	p.MaxStorageMB = intPtr(maxStorage)
+	return p, err
+}
+
+// requireSubscription rejects or warns about requests over a limit of the caller's company plan
+func requireSubscription(limit string) fiber.Handler {
+	return middleware.SubscriptionLimit(limit, checkSubscriptionLimit)
+}
+
+// loadCompanySubscription loads the current plan and consumption of a company
+func loadCompanySubscription(companyID int) (CompanySubscription, error) {
+	sub := CompanySubscription{CompanyID: companyID, Consumption: SubscriptionConsumption{OverLimits: []string{}}}
+	if err := db.DB.QueryRow("SELECT name FROM company WHERE id = $1 AND is_active = true", companyID).Scan(&sub.CompanyName); err != nil {
+		return sub, err
+	}
+
+	var startedAt time.Time
+	plan, err := scanSubscriptionPlan(withExtraColumns{db.DB.QueryRow(`
+		SELECT `+subscriptionPlanColumns+`, s.started_at, COALESCE(s.assigned_by, 0), COALESCE(s.notes, '')
+		FROM company_subscription s
+		JOIN subscription_plan p ON p.id = s.plan_id
+		WHERE s.company_id = $1 AND s.is_active = true
+		ORDER BY s.started_at DESC
+		LIMIT 1
+	`, companyID), []interface{}{&startedAt, &sub.AssignedBy, &sub.Notes}})
+	if err != nil && err != sql.ErrNoRows {
+		return sub, err
+	}
+	if err == nil {
+		sub.Plan = &plan
+		sub.StartedAt = &startedAt
+	}
+
+	var storageBytes int64
+	err = db.DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM batch b JOIN hatchery h ON h.id = b.hatchery_id
+				WHERE h.company_id = $1 AND b.created_at >= date_trunc('month', NOW())),
+			(SELECT COALESCE(SUM(d.file_size), 0) FROM document d
+				JOIN batch b ON b.id = d.batch_id JOIN hatchery h ON h.id = b.hatchery_id
+				WHERE h.company_id = $1 AND d.is_active = true)
+	`, companyID).Scan(&sub.Consumption.BatchesThisMonth, &storageBytes)
+	if err != nil {
+		return sub, err
+	}
+	sub.Consumption.StorageMB = math.Round(float64(storageBytes)/(1024*1024)*100) / 100
+
+	if sub.Plan != nil {
+		consumption := &sub.Consumption
+		if max := sub.Plan.MaxBatchesPerMonth; max != nil {
+			consumption.BatchesPercent = usagePercent(float64(consumption.BatchesThisMonth), *max)
+			if consumption.BatchesThisMonth >= *max {
+				consumption.OverLimits = append(consumption.OverLimits, LimitBatches)
+			}
+		}
+		if max := sub.Plan.MaxStorageMB; max != nil {
+			consumption.StoragePercent = usagePercent(consumption.StorageMB, *max)
+			if consumption.StorageMB >= float64(*max) {
+				consumption.OverLimits = append(consumption.OverLimits, LimitStorage)
+			}
+		}
+	}
+	return sub, nil
+}
+
+// usagePercent is the share of a limit used, as a percentage
+func usagePercent(used float64, limit int) *float64 {
+	if limit <= 0 {
+		percent := 100.0
+		return &percent
+	}
+	percent := math.Round(used/float64(limit)*1000) / 10
+	return &percent
+}
+
+// checkSubscriptionLimit checks a request against the plan of the caller's company
+// Companies without a plan are not limited
+func checkSubscriptionLimit(c *fiber.Ctx, limit string) (middleware.LimitDecision, error) {
+	companyID, _ := c.Locals("companyID").(int)
+	if companyID == 0 {
+		return middleware.LimitDecision{Allowed: true}, nil
+	}
+	sub, err := loadCompanySubscription(companyID)
+	if err == sql.ErrNoRows {
+		return middleware.LimitDecision{Allowed: true}, nil
+	}
+	if err != nil {
+		return middleware.LimitDecision{}, err
+	}
+	if sub.Plan == nil {
+		return middleware.LimitDecision{Allowed: true}, nil
+	}
+	plan := sub.Plan
+
+	var over, near bool
+	var message string
+	switch limit {
+	case LimitBatches:
+		if plan.MaxBatchesPerMonth == nil {
+			break
+		}
+		max := *plan.MaxBatchesPerMonth
+		used := sub.Consumption.BatchesThisMonth + 1
+		over = used > max
+		near = float64(used) >= float64(max)*subscriptionWarnRatio
+		message = fmt.Sprintf("The %s plan allows %d batches per month; this is batch %d this month", plan.Name, max, used)
+	case LimitStorage:
+		if plan.MaxStorageMB == nil {
+			break
+		}
+		max := *plan.MaxStorageMB
+		used := sub.Consumption.StorageMB + float64(c.Request().Header.ContentLength())/(1024*1024)
+		over = used > float64(max)
+		near = used >= float64(max)*subscriptionWarnRatio
+		message = fmt.Sprintf("The %s plan allows %d MB of document storage; %.1f MB would be used", plan.Name, max, used)
+	case FeatureInterop:
+		over = !plan.InteropEnabled
+		message = fmt.Sprintf("Interoperability is not included in the %s plan", plan.Name)
+	}
+
+	switch {
+	case over && plan.OverageAction != OverageWarn:
+		return middleware.LimitDecision{Allowed: false, Message: message}, nil
+	case over:
+		return middleware.LimitDecision{Allowed: true, Message: "Over plan limit: " + message}, nil
+	case near:
+		return middleware.LimitDecision{Allowed: true, Message: "Approaching plan limit: " + message}, nil
+	}
+	return middleware.LimitDecision{Allowed: true}, nil
+}
+
+// validateSubscriptionPlanRequest normalizes a plan request
+func validateSubscriptionPlanRequest(req *SubscriptionPlanRequest) error {
+	req.Code = strings.ToLower(strings.TrimSpace(req.Code))
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Code == "" || req.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Plan code and name are required")
+	}
+	if req.OverageAction == "" {
+		req.OverageAction = OverageBlock
+	}
+	if req.OverageAction != OverageBlock && req.OverageAction != OverageWarn {
+		return fiber.NewError(fiber.StatusBadRequest, "Overage action must be block or warn")
+	}
+	if (req.MaxBatchesPerMonth != nil && *req.MaxBatchesPerMonth < 0) || (req.MaxStorageMB != nil && *req.MaxStorageMB < 0) {
+		return fiber.NewError(fiber.StatusBadRequest, "Plan limits cannot be negative")
+	}
+	return nil
+}
+
+// ListSubscriptionPlans lists the plan tiers
+// @Summary List subscription plans
+// @Description List the plan tiers with their limits and features
+// @Tags subscriptions
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]SubscriptionPlan}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/subscription-plans [get]
+func ListSubscriptionPlans(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT ` + subscriptionPlanColumns + `
+		FROM subscription_plan p
+		WHERE p.is_active = true
+		ORDER BY p.max_batches_per_month NULLS LAST, p.id
+	`)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	plans := []SubscriptionPlan{}
+	for rows.Next() {
+		plan, err := scanSubscriptionPlan(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse subscription plan")
+		}
+		plans = append(plans, plan)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Subscription plans retrieved successfully",
+		Data:    plans,
+	})
+}
+
+// CreateSubscriptionPlan creates a plan tier
+// @Summary Create subscription plan
+// @Description Create a plan tier. Leave a limit empty for unlimited usage
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param request body SubscriptionPlanRequest true "Subscription plan"
+// @Success 201 {object} SuccessResponse{data=SubscriptionPlan}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/subscription-plans [post]
+func CreateSubscriptionPlan(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	var req SubscriptionPlanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateSubscriptionPlanRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM subscription_plan WHERE code = $1)", req.Code).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A subscription plan with this code already exists")
+	}
+
+	plan, err := scanSubscriptionPlan(db.DB.QueryRow(`
+		INSERT INTO subscription_plan AS p (code, name, description, max_batches_per_month, max_storage_mb, interop_enabled, overage_action, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW(), true)
+		RETURNING `+subscriptionPlanColumns,
+		req.Code, req.Name, req.Description, req.MaxBatchesPerMonth, req.MaxStorageMB, req.InteropEnabled, req.OverageAction))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create subscription plan")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Subscription plan created successfully",
+		Data:    plan,
+	})
+}
+
+// UpdateSubscriptionPlan updates a plan tier
+// @Summary Update subscription plan
+// @Description Change the limits and features of a plan tier; companies on the plan are checked against the new limits immediately
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param planId path int true "Plan ID"
+// @Param request body SubscriptionPlanRequest true "Subscription plan"
+// @Success 200 {object} SuccessResponse{data=SubscriptionPlan}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/subscription-plans/{planId} [put]
+func UpdateSubscriptionPlan(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	planID, err := strconv.Atoi(c.Params("planId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid plan ID format")
+	}
+
+	var req SubscriptionPlanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateSubscriptionPlanRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM subscription_plan WHERE code = $1 AND id <> $2)", req.Code, planID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A subscription plan with this code already exists")
+	}
+
+	plan, err := scanSubscriptionPlan(db.DB.QueryRow(`
+		UPDATE subscription_plan AS p
+		SET code = $1, name = $2, description = $3, max_batches_per_month = $4, max_storage_mb = $5,
+			interop_enabled = $6, overage_action = $7, updated_at = NOW()
+		WHERE p.id = $8 AND p.is_active = true
+		RETURNING `+subscriptionPlanColumns,
+		req.Code, req.Name, req.Description, req.MaxBatchesPerMonth, req.MaxStorageMB, req.InteropEnabled, req.OverageAction, planID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Subscription plan not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update subscription plan")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Subscription plan updated successfully",
+		Data:    plan,
+	})
+}
+
+// ListCompanySubscriptions lists the plan and consumption of every company
+// @Summary List company subscriptions
+// @Description List every company with its plan and its consumption against the plan limits
+// @Tags subscriptions
+// @Produce json
+// @Param over_limit query bool false "Only companies over a limit"
+// @Success 200 {object} SuccessResponse{data=[]CompanySubscription}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/subscriptions [get]
+func ListCompanySubscriptions(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	overLimitOnly := c.QueryBool("over_limit", false)
+
+	rows, err := db.DB.Query("SELECT id FROM company WHERE is_active = true ORDER BY name")
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	var companyIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse company")
+		}
+		companyIDs = append(companyIDs, id)
+	}
+	rows.Close()
+
+	subscriptions := []CompanySubscription{}
+	for _, id := range companyIDs {
+		sub, err := loadCompanySubscription(id)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load subscription")
+		}
+		if overLimitOnly && len(sub.Consumption.OverLimits) == 0 {
+			continue
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Company subscriptions retrieved successfully",
+		Data:    subscriptions,
+	})
+}
+
+// AssignCompanyPlan moves a company to a plan
+// @Summary Assign subscription plan
+// @Description Move a company to a plan tier. The previous subscription is ended and kept as history
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param request body AssignPlanRequest true "Plan"
+// @Success 200 {object} SuccessResponse{data=CompanySubscription}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/companies/{companyId}/subscription [put]
+func AssignCompanyPlan(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	var req AssignPlanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.PlanCode = strings.ToLower(strings.TrimSpace(req.PlanCode))
+	if req.PlanCode == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Plan code is required")
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", companyID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+	var planID int
+	err = db.DB.QueryRow("SELECT id FROM subscription_plan WHERE code = $1 AND is_active = true", req.PlanCode).Scan(&planID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Subscription plan not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE company_subscription SET is_active = false, ended_at = NOW()
+		WHERE company_id = $1 AND is_active = true
+	`, companyID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to end current subscription")
+	}
+	userID, _ := c.Locals("userID").(int)
+	if _, err := tx.Exec(`
+		INSERT INTO company_subscription (company_id, plan_id, started_at, assigned_by, notes, created_at, is_active)
+		VALUES ($1, $2, NOW(), NULLIF($3, 0), $4, NOW(), true)
+	`, companyID, planID, userID, req.Notes); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to assign subscription plan")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction")
+	}
+
+	sub, err := loadCompanySubscription(companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load subscription")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Subscription plan assigned successfully",
+		Data:    sub,
+	})
+}
+
+// GetCompanySubscription returns the plan of a company and its consumption
+// @Summary Get company subscription
+// @Description Get the plan of a company and its consumption against the plan limits
+// @Tags subscriptions
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=CompanySubscription}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/subscription [get]
+func GetCompanySubscription(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	sub, err := loadCompanySubscription(companyID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Company subscription retrieved successfully",
+		Data:    sub,
+	})
+}
@@ -0,0 +1,379 @@
+package api
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/completeness"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// defaultScorecardWindows are the windows, in days, a supplier scorecard covers by default
+var defaultScorecardWindows = []int{30, 90, 365}
+
+// defaultTransferGraceHours is how long after its transfer time a transfer may complete and still be on time
+const defaultTransferGraceHours = 24
+
+// maxScorecardWindowDays is the longest window a scorecard can cover
+const maxScorecardWindowDays = 730
+
+// TransferMetrics is the delivery performance of a supplier's transfers
+type TransferMetrics struct {
+	Total         int      `json:"total"`     // Transfers scheduled in the window
+	Completed     int      `json:"completed"` // Of which completed
+	OnTime        int      `json:"on_time"`   // Completed within the grace period after the transfer time
+	Late          int      `json:"late"`      // Completed after the grace period
+	Overdue       int      `json:"overdue"`   // Not completed, past the grace period
+	OnTimeRatePct *float64 `json:"on_time_rate_pct,omitempty"`
+}
+
+// SupplierScorecard is the quality and timeliness of a supplier over one window
+type SupplierScorecard struct {
+	CompanyID   int             `json:"company_id"`
+	CompanyName string          `json:"company_name"`
+	WindowDays  int             `json:"window_days"`
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"`
+	Score       *float64        `json:"score,omitempty"` // 0 to 100, the mean of the metrics with data
+	Transfers   TransferMetrics `json:"transfers"`
+	// Batches started by the supplier's hatcheries in the window; completeness, recalls and disputes are of these
+	Batches                 int       `json:"batches"`
+	DocumentCompletenessPct *float64  `json:"document_completeness_pct,omitempty"` // Share of the required documents present
+	RecalledBatches         int       `json:"recalled_batches"`
+	RecallRatePct           *float64  `json:"recall_rate_pct,omitempty"`
+	DisputedBatches         int       `json:"disputed_batches"` // Batches with an origin claim in dispute
+	DisputeRatePct          *float64  `json:"dispute_rate_pct,omitempty"`
+	LabResults              int       `json:"lab_results"` // Pass or fail results analyzed in the window
+	LabFailures             int       `json:"lab_failures"`
+	LabFailureRatePct       *float64  `json:"lab_failure_rate_pct,omitempty"`
+	GeneratedAt             time.Time `json:"generated_at"`
+}
+
+// SupplierScorecardReport is the scorecard of a supplier over several windows
+type SupplierScorecardReport struct {
+	CompanyID   int                 `json:"company_id"`
+	CompanyName string              `json:"company_name"`
+	GraceHours  int                 `json:"grace_hours"`
+	Windows     []SupplierScorecard `json:"windows"`
+}
+
+// ratePct is part of whole in percent with two decimals, empty without a whole
+func ratePct(part, whole int) *float64 {
+	if whole <= 0 {
+		return nil
+	}
+	pct := math.Round(float64(part)/float64(whole)*10000) / 100
+	return &pct
+}
+
+// parseScorecardWindow reads a window length in days
+func parseScorecardWindow(value string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || days < 1 || days > maxScorecardWindowDays {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "Windows must be between 1 and "+strconv.Itoa(maxScorecardWindowDays)+" days")
+	}
+	return days, nil
+}
+
+// parseGraceHours reads the grace_hours query parameter
+func parseGraceHours(c *fiber.Ctx) (int, error) {
+	grace := c.QueryInt("grace_hours", defaultTransferGraceHours)
+	if grace < 0 || grace > 24*30 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "grace_hours must be between 0 and 720")
+	}
+	return grace, nil
+}
+
+// scoreSuppliers computes the scorecards of companies over the window from from to to. Transfers are
+// attributed to the company of the sending account, batches to the company of the hatchery that started them
+func scoreSuppliers(companyIDs []int, names map[int]string, from, to time.Time, graceHours int) (map[int]*SupplierScorecard, error) {
+	windowDays := int(to.Sub(from).Hours() / 24)
+	now := time.Now()
+	cards := map[int]*SupplierScorecard{}
+	for _, id := range companyIDs {
+		cards[id] = &SupplierScorecard{CompanyID: id, CompanyName: names[id], WindowDays: windowDays, From: from, To: to, GeneratedAt: now}
+	}
+	if len(companyIDs) == 0 {
+		return cards, nil
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT a.company_id, COUNT(*),
+			COUNT(*) FILTER (WHERE st.status = 'completed'),
+			COUNT(*) FILTER (WHERE st.status = 'completed'
+				AND COALESCE(st.completed_at, st.updated_at) <= st.transfer_time + $4 * INTERVAL '1 hour'),
+			COUNT(*) FILTER (WHERE COALESCE(st.status, '') NOT IN ('completed', 'rejected', 'canceled', 'cancelled')
+				AND st.transfer_time + $4 * INTERVAL '1 hour' < NOW())
+		FROM shipment_transfer st
+		JOIN account a ON a.id = st.sender_id
+		WHERE a.company_id = ANY($1) AND st.is_active = true AND st.transfer_time >= $2 AND st.transfer_time < $3
+		GROUP BY 1
+	`, pq.Array(companyIDs), from, to, graceHours)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var companyID int
+		var t TransferMetrics
+		if err := rows.Scan(&companyID, &t.Total, &t.Completed, &t.OnTime, &t.Overdue); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		t.Late = t.Completed - t.OnTime
+		t.OnTimeRatePct = ratePct(t.OnTime, t.Completed+t.Overdue)
+		cards[companyID].Transfers = t
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.DB.Query(`
+		SELECT h.company_id, b.id,
+			EXISTS(SELECT 1 FROM batch_recall r WHERE r.batch_id = b.id),
+			EXISTS(SELECT 1 FROM origin_claim oc WHERE oc.batch_id = b.id AND oc.dispute_id IS NOT NULL)
+		FROM batch b
+		JOIN hatchery h ON h.id = b.hatchery_id
+		WHERE h.company_id = ANY($1) AND b.is_active = true AND b.created_at >= $2 AND b.created_at < $3
+	`, pq.Array(companyIDs), from, to)
+	if err != nil {
+		return nil, err
+	}
+	batchCompany := map[int]int{}
+	batchIDs := []int{}
+	for rows.Next() {
+		var companyID, batchID int
+		var recalled, disputed bool
+		if err := rows.Scan(&companyID, &batchID, &recalled, &disputed); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		card := cards[companyID]
+		card.Batches++
+		if recalled {
+			card.RecalledBatches++
+		}
+		if disputed {
+			card.DisputedBatches++
+		}
+		batchCompany[batchID] = companyID
+		batchIDs = append(batchIDs, batchID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	documents := map[int]float64{}
+	if len(batchIDs) > 0 {
+		scores, err := completeness.ScoreBatches(batchIDs)
+		if err != nil {
+			return nil, err
+		}
+		for batchID, score := range scores {
+			if score != nil {
+				documents[batchCompany[batchID]] += score.Documents
+			}
+		}
+	}
+
+	rows, err = db.DB.Query(`
+		SELECT h.company_id, COUNT(*), COUNT(*) FILTER (WHERE r.overall_result = 'fail')
+		FROM lims_result r
+		JOIN batch b ON b.id = r.batch_id
+		JOIN hatchery h ON h.id = b.hatchery_id
+		WHERE h.company_id = ANY($1) AND r.overall_result IN ('pass', 'fail') AND r.analyzed_at >= $2 AND r.analyzed_at < $3
+		GROUP BY 1
+	`, pq.Array(companyIDs), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var companyID, results, failures int
+		if err := rows.Scan(&companyID, &results, &failures); err != nil {
+			return nil, err
+		}
+		cards[companyID].LabResults = results
+		cards[companyID].LabFailures = failures
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for companyID, card := range cards {
+		if card.Batches > 0 {
+			pct := math.Round(documents[companyID]/float64(card.Batches)*10000) / 100
+			card.DocumentCompletenessPct = &pct
+		}
+		card.RecallRatePct = ratePct(card.RecalledBatches, card.Batches)
+		card.DisputeRatePct = ratePct(card.DisputedBatches, card.Batches)
+		card.LabFailureRatePct = ratePct(card.LabFailures, card.LabResults)
+		card.Score = scorecardScore(card)
+	}
+	return cards, nil
+}
+
+// scorecardScore is the mean of the metrics of a scorecard that have data, rates of bad outcomes inverted
+func scorecardScore(card *SupplierScorecard) *float64 {
+	var sum float64
+	var n int
+	add := func(pct *float64, higherIsBetter bool) {
+		if pct == nil {
+			return
+		}
+		if higherIsBetter {
+			sum += *pct
+		} else {
+			sum += 100 - *pct
+		}
+		n++
+	}
+	add(card.Transfers.OnTimeRatePct, true)
+	add(card.DocumentCompletenessPct, true)
+	add(card.RecallRatePct, false)
+	add(card.DisputeRatePct, false)
+	add(card.LabFailureRatePct, false)
+	if n == 0 {
+		return nil
+	}
+	score := math.Round(sum/float64(n)*100) / 100
+	return &score
+}
+
+// GetSupplierScorecard builds the scorecard of a supplier
+// @Summary Get supplier scorecard
+// @Description Get the on-time delivery of the transfers of a supplier, the document completeness, recall and origin dispute rate of the batches its hatcheries started and its lab failure rate, over one or more windows ending now.
+// @Description A transfer is on time when completed within the grace period after its transfer time; document completeness is scored against the supplier's completeness profile
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param windows query string false "Comma-separated window lengths in days, default 30,90,365"
+// @Param grace_hours query int false "Hours after the transfer time a transfer may complete and still be on time (default 24)"
+// @Success 200 {object} SuccessResponse{data=SupplierScorecardReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/scorecard [get]
+func GetSupplierScorecard(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	windows := defaultScorecardWindows
+	if v := c.Query("windows"); v != "" {
+		windows = []int{}
+		for _, part := range strings.Split(v, ",") {
+			days, err := parseScorecardWindow(part)
+			if err != nil {
+				return err
+			}
+			windows = append(windows, days)
+		}
+	}
+	graceHours, err := parseGraceHours(c)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	err = db.DB.QueryRow("SELECT name FROM company WHERE id = $1 AND is_active = true", companyID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	report := SupplierScorecardReport{CompanyID: companyID, CompanyName: name, GraceHours: graceHours, Windows: []SupplierScorecard{}}
+	to := time.Now()
+	for _, days := range windows {
+		cards, err := scoreSuppliers([]int{companyID}, map[int]string{companyID: name}, to.AddDate(0, 0, -days), to, graceHours)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to build supplier scorecard")
+		}
+		report.Windows = append(report.Windows, *cards[companyID])
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Supplier scorecard generated successfully",
+		Data:    report,
+	})
+}
+
+// ListSupplierScorecards compares the scorecards of all suppliers
+// @Summary Compare supplier scorecards
+// @Description Get the scorecard of every company running a hatchery over one window ending now, best score first; suppliers without any data come last
+// @Tags companies
+// @Produce json
+// @Param days query int false "Window length in days (default 90)"
+// @Param grace_hours query int false "Hours after the transfer time a transfer may complete and still be on time (default 24)"
+// @Success 200 {object} SuccessResponse{data=[]SupplierScorecard}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /suppliers/scorecards [get]
+func ListSupplierScorecards(c *fiber.Ctx) error {
+	days, err := parseScorecardWindow(c.Query("days", "90"))
+	if err != nil {
+		return err
+	}
+	graceHours, err := parseGraceHours(c)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT c.id, c.name FROM company c
+		WHERE c.is_active = true AND EXISTS(SELECT 1 FROM hatchery h WHERE h.company_id = c.id AND h.is_active = true)
+	`)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	companyIDs := []int{}
+	names := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse company")
+		}
+		companyIDs = append(companyIDs, id)
+		names[id] = name
+	}
+	rows.Close()
+
+	to := time.Now()
+	cards, err := scoreSuppliers(companyIDs, names, to.AddDate(0, 0, -days), to, graceHours)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build supplier scorecards")
+	}
+	scorecards := make([]SupplierScorecard, 0, len(cards))
+	for _, card := range cards {
+		scorecards = append(scorecards, *card)
+	}
+	sort.Slice(scorecards, func(i, j int) bool {
+		a, b := scorecards[i], scorecards[j]
+		if (a.Score == nil) != (b.Score == nil) {
+			return a.Score != nil
+		}
+		if a.Score != nil && *a.Score != *b.Score {
+			return *a.Score > *b.Score
+		}
+		return a.CompanyName < b.CompanyName
+	})
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Supplier scorecards generated successfully",
+		Data:    scorecards,
+	})
+}
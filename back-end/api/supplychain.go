@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/LTPPPP/TracePost-larvaeChain/actors"
 	"github.com/LTPPPP/TracePost-larvaeChain/db"
 	"github.com/LTPPPP/TracePost-larvaeChain/models"
 	"github.com/skip2/go-qrcode"
@@ -497,31 +498,26 @@ func GenerateSupplyChainQRCode(c *fiber.Ctx) error {
 			)
 			
 			if err == nil {
-				// Get sender name
-				var senderName string
-				err := db.DB.QueryRow(`SELECT username FROM account WHERE id = $1`, senderID).Scan(&senderName)
-				if err != nil {
-					senderName = "Unknown Sender"
-				}
-
-				// Get receiver name
-				var receiverName string
-				err = db.DB.QueryRow(`SELECT username FROM account WHERE id = $1`, receiverID).Scan(&receiverName)
-				if err != nil {
-					receiverName = "Unknown Receiver"
-				}
-
 				transfers = append(transfers, map[string]interface{}{
 					"id":               transferID,
 					"sender_id":        senderID,
-					"sender_name":      senderName,
 					"receiver_id":      receiverID,
-					"receiver_name":    receiverName,
 					"transfer_time":    transferTime.Format(time.RFC3339),
 					"status":           status,
 				})
 			}
 		}
+
+		// Get sender and receiver names of all transfers at once
+		var accountIDs []int
+		for _, transfer := range transfers {
+			accountIDs = append(accountIDs, transfer["sender_id"].(int), transfer["receiver_id"].(int))
+		}
+		resolvedActors, _ := actors.Default().Accounts(accountIDs)
+		for _, transfer := range transfers {
+			transfer["sender_name"] = actorUsername(resolvedActors, transfer["sender_id"].(int), "Unknown Sender")
+			transfer["receiver_name"] = actorUsername(resolvedActors, transfer["receiver_id"].(int), "Unknown Receiver")
+		}
 		
 		if len(transfers) > 0 {
 			qrData["transfers"] = transfers
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"database/sql"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// EnergyMetrics is the energy use of one or more facilities over a period
+type EnergyMetrics struct {
+	TotalKWh        float64            `json:"total_kwh"`
+	ByCategory      map[string]float64 `json:"by_category"`
+	PLProduced      int64              `json:"pl_produced"`                  // Postlarvae of the batches started in the period
+	KWhPerMillionPL *float64           `json:"kwh_per_million_pl,omitempty"` // Energy intensity, empty without production
+	MissingMonths   []string           `json:"missing_months"`               // Months without any reading
+}
+
+// EnergyMonth is the energy use of a facility in one month
+type EnergyMonth struct {
+	Month           string             `json:"month"`
+	TotalKWh        float64            `json:"total_kwh"`
+	ByCategory      map[string]float64 `json:"by_category"`
+	PLProduced      int64              `json:"pl_produced"`
+	KWhPerMillionPL *float64           `json:"kwh_per_million_pl,omitempty"`
+}
+
+// SustainabilityReport is the sustainability report of a facility
+type SustainabilityReport struct {
+	HatcheryID   int           `json:"hatchery_id"`
+	HatcheryName string        `json:"hatchery_name"`
+	From         string        `json:"from"` // First month, YYYY-MM
+	To           string        `json:"to"`   // Last month, YYYY-MM
+	GeneratedAt  time.Time     `json:"generated_at"`
+	Energy       EnergyMetrics `json:"energy"`
+	Months       []EnergyMonth `json:"months"`
+}
+
+// ESGReport is the ESG report of a company, over all of its facilities
+type ESGReport struct {
+	CompanyID   int                    `json:"company_id"`
+	From        string                 `json:"from"`
+	To          string                 `json:"to"`
+	GeneratedAt time.Time              `json:"generated_at"`
+	Energy      EnergyMetrics          `json:"energy"`
+	Facilities  []SustainabilityReport `json:"facilities"`
+}
+
+// energyIntensity is the energy used per million postlarvae produced
+func energyIntensity(kwh float64, pl int64) *float64 {
+	if pl <= 0 {
+		return nil
+	}
+	intensity := math.Round(kwh/(float64(pl)/1e6)*100) / 100
+	return &intensity
+}
+
+// loadPLProduced sums the postlarvae of the batches started per hatchery and month
+func loadPLProduced(hatcheryIDs []int, from, to time.Time) (map[int]map[string]int64, error) {
+	produced := map[int]map[string]int64{}
+	rows, err := db.DB.Query(`
+		SELECT hatchery_id, TO_CHAR(created_at, 'YYYY-MM'), SUM(COALESCE(quantity, 0))
+		FROM batch
+		WHERE hatchery_id = ANY($1) AND is_active = true AND created_at >= $2 AND created_at < $3
+		GROUP BY 1, 2
+	`, pq.Array(hatcheryIDs), from, to.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hatcheryID int
+		var month string
+		var quantity int64
+		if err := rows.Scan(&hatcheryID, &month, &quantity); err != nil {
+			return nil, err
+		}
+		if produced[hatcheryID] == nil {
+			produced[hatcheryID] = map[string]int64{}
+		}
+		produced[hatcheryID][month] = quantity
+	}
+	return produced, rows.Err()
+}
+
+// buildSustainabilityReports builds the sustainability reports of hatcheries for the months from from to
+// to, both the first day of a month
+func buildSustainabilityReports(hatcheryIDs []int, names map[int]string, from, to time.Time) ([]SustainabilityReport, error) {
+	reports := []SustainabilityReport{}
+	if len(hatcheryIDs) == 0 {
+		return reports, nil
+	}
+	energy, err := loadEnergyTotals(hatcheryIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+	produced, err := loadPLProduced(hatcheryIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, hatcheryID := range hatcheryIDs {
+		report := SustainabilityReport{
+			HatcheryID:   hatcheryID,
+			HatcheryName: names[hatcheryID],
+			From:         from.Format(energyMonthLayout),
+			To:           to.Format(energyMonthLayout),
+			GeneratedAt:  now,
+			Energy:       EnergyMetrics{ByCategory: map[string]float64{}, MissingMonths: []string{}},
+			Months:       []EnergyMonth{},
+		}
+		for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+			key := month.Format(energyMonthLayout)
+			m := EnergyMonth{Month: key, ByCategory: map[string]float64{}, PLProduced: produced[hatcheryID][key]}
+			readings, ok := energy[hatcheryID][key]
+			if !ok {
+				report.Energy.MissingMonths = append(report.Energy.MissingMonths, key)
+			}
+			for category, kwh := range readings {
+				m.ByCategory[category] += kwh
+				m.TotalKWh += kwh
+				report.Energy.ByCategory[category] += kwh
+			}
+			m.KWhPerMillionPL = energyIntensity(m.TotalKWh, m.PLProduced)
+			report.Energy.TotalKWh += m.TotalKWh
+			report.Energy.PLProduced += m.PLProduced
+			report.Months = append(report.Months, m)
+		}
+		report.Energy.KWhPerMillionPL = energyIntensity(report.Energy.TotalKWh, report.Energy.PLProduced)
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// GetSustainabilityReport builds the sustainability report of a facility
+// @Summary Get facility sustainability report
+// @Description Get the energy use of a hatchery per month and equipment category, the postlarvae it produced and its energy intensity in kWh per million PL. Months without any reading are listed so gaps are not mistaken for savings
+// @Tags hatcheries
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param from query string false "First month (YYYY-MM), default 11 months before to"
+// @Param to query string false "Last month (YYYY-MM), default the current month"
+// @Success 200 {object} SuccessResponse{data=SustainabilityReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/reports/sustainability [get]
+func GetSustainabilityReport(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+	from, to, err := parseMonthRange(c)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	err = db.DB.QueryRow("SELECT name FROM hatchery WHERE id = $1 AND is_active = true", hatcheryID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Hatchery not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	reports, err := buildSustainabilityReports([]int{hatcheryID}, map[int]string{hatcheryID: name}, from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build sustainability report")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Sustainability report generated successfully",
+		Data:    reports[0],
+	})
+}
+
+// GetESGReport builds the ESG report of a company
+// @Summary Get company ESG report
+// @Description Get the energy use of every facility of a company and of the company as a whole, with the energy intensity in kWh per million PL produced
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param from query string false "First month (YYYY-MM), default 11 months before to"
+// @Param to query string false "Last month (YYYY-MM), default the current month"
+// @Success 200 {object} SuccessResponse{data=ESGReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/reports/esg [get]
+func GetESGReport(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	from, to, err := parseMonthRange(c)
+	if err != nil {
+		return err
+	}
+	if err := readsForCompany(c, companyID); err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query("SELECT id, name FROM hatchery WHERE company_id = $1 AND is_active = true ORDER BY name, id", companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	hatcheryIDs := []int{}
+	names := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse hatchery")
+		}
+		hatcheryIDs = append(hatcheryIDs, id)
+		names[id] = name
+	}
+	rows.Close()
+
+	facilities, err := buildSustainabilityReports(hatcheryIDs, names, from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build ESG report")
+	}
+
+	report := ESGReport{
+		CompanyID:   companyID,
+		From:        from.Format(energyMonthLayout),
+		To:          to.Format(energyMonthLayout),
+		GeneratedAt: time.Now(),
+		Energy:      EnergyMetrics{ByCategory: map[string]float64{}, MissingMonths: []string{}},
+		Facilities:  facilities,
+	}
+	// A month is missing for the company when no facility reported it
+	missing := map[string]int{}
+	for _, facility := range facilities {
+		report.Energy.TotalKWh += facility.Energy.TotalKWh
+		report.Energy.PLProduced += facility.Energy.PLProduced
+		for category, kwh := range facility.Energy.ByCategory {
+			report.Energy.ByCategory[category] += kwh
+		}
+		for _, month := range facility.Energy.MissingMonths {
+			missing[month]++
+		}
+	}
+	for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+		if key := month.Format(energyMonthLayout); len(facilities) > 0 && missing[key] == len(facilities) {
+			report.Energy.MissingMonths = append(report.Energy.MissingMonths, key)
+		}
+	}
+	report.Energy.KWhPerMillionPL = energyIntensity(report.Energy.TotalKWh, report.Energy.PLProduced)
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "ESG report generated successfully",
+		Data:    report,
+	})
+}
@@ -0,0 +1,738 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// TankRequest represents a request to create or update a tank or pond
+type TankRequest struct {
+	Code         string  `json:"code"`
+	TankType     string  `json:"tank_type"` // tank (default) or pond
+	Capacity     int     `json:"capacity"`
+	VolumeLiters float64 `json:"volume_liters"`
+	Notes        string  `json:"notes"`
+}
+
+// TankAssignmentRequest represents a request to stock a batch in a tank
+type TankAssignmentRequest struct {
+	BatchID    int        `json:"batch_id"`
+	Quantity   int        `json:"quantity"` // defaults to the batch quantity
+	AssignedAt *time.Time `json:"assigned_at"`
+	Notes      string     `json:"notes"`
+}
+
+// ReleaseTankAssignmentRequest represents a request to take a batch out of a tank
+type ReleaseTankAssignmentRequest struct {
+	ReleasedAt *time.Time `json:"released_at"`
+}
+
+// TankOccupancy is a tank with the batches it currently holds
+type TankOccupancy struct {
+	models.Tank
+	Occupied           int                     `json:"occupied"`
+	Available          int                     `json:"available"`
+	UtilizationPercent float64                 `json:"utilization_percent"`
+	Overbooked         bool                    `json:"overbooked"`
+	Assignments        []models.TankAssignment `json:"assignments"`
+}
+
+// HatcheryCapacity is the current occupancy of every tank of a hatchery
+type HatcheryCapacity struct {
+	HatcheryID         int             `json:"hatchery_id"`
+	TotalCapacity      int             `json:"total_capacity"`
+	Occupied           int             `json:"occupied"`
+	Available          int             `json:"available"`
+	UtilizationPercent float64         `json:"utilization_percent"`
+	Warnings           []string        `json:"warnings"`
+	Tanks              []TankOccupancy `json:"tanks"`
+}
+
+// TankAssignmentResult is a new assignment with the resulting occupancy of its tank
+type TankAssignmentResult struct {
+	Assignment models.TankAssignment `json:"assignment"`
+	Occupancy  TankOccupancy         `json:"occupancy"`
+	Warnings   []string              `json:"warnings"`
+}
+
+// TankUtilizationPoint is the occupancy at the end of one day
+type TankUtilizationPoint struct {
+	Date               string  `json:"date"`
+	Occupied           int     `json:"occupied"`
+	Capacity           int     `json:"capacity"`
+	UtilizationPercent float64 `json:"utilization_percent"`
+}
+
+const tankColumns = `
+	id, COALESCE(hatchery_id, 0), code, COALESCE(tank_type, 'tank'), capacity,
+	COALESCE(volume_liters, 0), COALESCE(notes, ''), created_at, updated_at, is_active
+`
+
+// scanTank reads a tank selected with tankColumns
+func scanTank(row rowScanner) (models.Tank, error) {
+	var t models.Tank
+	err := row.Scan(&t.ID, &t.HatcheryID, &t.Code, &t.TankType, &t.Capacity,
+		&t.VolumeLiters, &t.Notes, &t.CreatedAt, &t.UpdatedAt, &t.IsActive)
+	return t, err
+}
+
+// loadTank loads an active tank
+func loadTank(tankID int) (models.Tank, error) {
+	return scanTank(db.DB.QueryRow(`SELECT `+tankColumns+` FROM tank WHERE id = $1 AND is_active = true`, tankID))
+}
+
+// scanTankAssignment reads a tank assignment
+func scanTankAssignment(row rowScanner) (models.TankAssignment, error) {
+	var a models.TankAssignment
+	var releasedAt sql.NullTime
+	err := row.Scan(&a.ID, &a.TankID, &a.BatchID, &a.Quantity, &a.AssignedAt, &releasedAt, &a.Notes, &a.CreatedAt)
+	if releasedAt.Valid {
+		a.ReleasedAt = &releasedAt.Time
+	}
+	return a, err
+}
+
+const tankAssignmentColumns = `id, tank_id, batch_id, quantity, assigned_at, released_at, COALESCE(notes, ''), created_at`
+
+// tankOccupancy returns the current occupancy of a tank
+func tankOccupancy(tank models.Tank) (TankOccupancy, error) {
+	occupancy := TankOccupancy{Tank: tank, Assignments: []models.TankAssignment{}}
+
+	rows, err := db.DB.Query(`SELECT `+tankAssignmentColumns+`
+		FROM tank_assignment
+		WHERE tank_id = $1 AND released_at IS NULL
+		ORDER BY assigned_at
+	`, tank.ID)
+	if err != nil {
+		return occupancy, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanTankAssignment(rows)
+		if err != nil {
+			return occupancy, err
+		}
+		occupancy.Occupied += a.Quantity
+		occupancy.Assignments = append(occupancy.Assignments, a)
+	}
+
+	occupancy.Available = tank.Capacity - occupancy.Occupied
+	if occupancy.Available < 0 {
+		occupancy.Available = 0
+	}
+	occupancy.UtilizationPercent = utilizationPercent(occupancy.Occupied, tank.Capacity)
+	occupancy.Overbooked = occupancy.Occupied > tank.Capacity
+	return occupancy, rows.Err()
+}
+
+// utilizationPercent rounds the share of a capacity in use to one decimal
+func utilizationPercent(occupied, capacity int) float64 {
+	if capacity <= 0 {
+		return 0
+	}
+	return math.Round(float64(occupied)/float64(capacity)*1000) / 10
+}
+
+// overbookingWarning describes an overbooked tank
+func overbookingWarning(o TankOccupancy) string {
+	return fmt.Sprintf("Tank %s is overbooked: %d larvae for a capacity of %d", o.Code, o.Occupied, o.Capacity)
+}
+
+// validateTankRequest checks the fields of a tank request
+func validateTankRequest(req *TankRequest) error {
+	req.Code = strings.TrimSpace(req.Code)
+	if req.Code == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Tank code is required")
+	}
+	if req.TankType == "" {
+		req.TankType = "tank"
+	}
+	if req.TankType != "tank" && req.TankType != "pond" {
+		return fiber.NewError(fiber.StatusBadRequest, "Tank type must be tank or pond")
+	}
+	if req.Capacity <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Capacity must be greater than zero")
+	}
+	if req.VolumeLiters < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Volume must not be negative")
+	}
+	return nil
+}
+
+// CreateTank adds a tank or pond to a hatchery
+// @Summary Create tank
+// @Description Add a tank or pond with its larvae capacity to a hatchery
+// @Tags hatcheries
+// @Accept json
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param request body TankRequest true "Tank details"
+// @Success 201 {object} SuccessResponse{data=models.Tank}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/tanks [post]
+func CreateTank(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+
+	var req TankRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateTankRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM hatchery WHERE id = $1 AND is_active = true)", hatcheryID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Hatchery not found")
+	}
+
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM tank WHERE hatchery_id = $1 AND code = $2)", hatcheryID, req.Code).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A tank with this code already exists in the hatchery")
+	}
+
+	tank, err := scanTank(db.DB.QueryRow(`
+		INSERT INTO tank (hatchery_id, code, tank_type, capacity, volume_liters, notes, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW(), true)
+		RETURNING `+tankColumns,
+		hatcheryID, req.Code, req.TankType, req.Capacity, req.VolumeLiters, req.Notes))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create tank")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Tank created successfully",
+		Data:    tank,
+	})
+}
+
+// GetHatcheryCapacity gets the tanks of a hatchery and their current occupancy
+// @Summary Get hatchery tanks and capacity
+// @Description Get the tanks and ponds of a hatchery with their current occupancy and overbooking warnings
+// @Tags hatcheries
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Success 200 {object} SuccessResponse{data=HatcheryCapacity}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/tanks [get]
+func GetHatcheryCapacity(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+tankColumns+` FROM tank WHERE hatchery_id = $1 AND is_active = true ORDER BY code`, hatcheryID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	tanks := []models.Tank{}
+	for rows.Next() {
+		tank, err := scanTank(rows)
+		if err != nil {
+			rows.Close()
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse tank")
+		}
+		tanks = append(tanks, tank)
+	}
+	rows.Close()
+
+	capacity := HatcheryCapacity{HatcheryID: hatcheryID, Warnings: []string{}, Tanks: []TankOccupancy{}}
+	for _, tank := range tanks {
+		occupancy, err := tankOccupancy(tank)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve tank occupancy")
+		}
+		capacity.TotalCapacity += tank.Capacity
+		capacity.Occupied += occupancy.Occupied
+		capacity.Available += occupancy.Available
+		if occupancy.Overbooked {
+			capacity.Warnings = append(capacity.Warnings, overbookingWarning(occupancy))
+		}
+		capacity.Tanks = append(capacity.Tanks, occupancy)
+	}
+	capacity.UtilizationPercent = utilizationPercent(capacity.Occupied, capacity.TotalCapacity)
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Hatchery capacity retrieved successfully",
+		Data:    capacity,
+	})
+}
+
+// GetTankByID gets a tank with its current occupancy
+// @Summary Get tank
+// @Description Get a tank or pond with the batches it currently holds
+// @Tags tanks
+// @Produce json
+// @Param tankId path int true "Tank ID"
+// @Success 200 {object} SuccessResponse{data=TankOccupancy}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /tanks/{tankId} [get]
+func GetTankByID(c *fiber.Ctx) error {
+	tankID, err := strconv.Atoi(c.Params("tankId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid tank ID format")
+	}
+
+	tank, err := loadTank(tankID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Tank not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	occupancy, err := tankOccupancy(tank)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve tank occupancy")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Tank retrieved successfully",
+		Data:    occupancy,
+	})
+}
+
+// UpdateTank updates a tank or pond
+// @Summary Update tank
+// @Description Update the code, type and capacity of a tank or pond
+// @Tags tanks
+// @Accept json
+// @Produce json
+// @Param tankId path int true "Tank ID"
+// @Param request body TankRequest true "Tank details"
+// @Success 200 {object} SuccessResponse{data=models.Tank}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /tanks/{tankId} [put]
+func UpdateTank(c *fiber.Ctx) error {
+	tankID, err := strconv.Atoi(c.Params("tankId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid tank ID format")
+	}
+
+	var req TankRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateTankRequest(&req); err != nil {
+		return err
+	}
+
+	current, err := loadTank(tankID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Tank not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM tank WHERE hatchery_id = $1 AND code = $2 AND id <> $3)",
+		current.HatcheryID, req.Code, tankID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "A tank with this code already exists in the hatchery")
+	}
+
+	tank, err := scanTank(db.DB.QueryRow(`
+		UPDATE tank
+		SET code = $2, tank_type = $3, capacity = $4, volume_liters = $5, notes = $6, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+tankColumns,
+		tankID, req.Code, req.TankType, req.Capacity, req.VolumeLiters, req.Notes))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update tank")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Tank updated successfully",
+		Data:    tank,
+	})
+}
+
+// DeleteTank soft deletes an empty tank
+// @Summary Delete tank
+// @Description Soft delete a tank or pond. Tanks that still hold batches cannot be deleted
+// @Tags tanks
+// @Produce json
+// @Param tankId path int true "Tank ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /tanks/{tankId} [delete]
+func DeleteTank(c *fiber.Ctx) error {
+	tankID, err := strconv.Atoi(c.Params("tankId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid tank ID format")
+	}
+
+	var occupied bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM tank_assignment WHERE tank_id = $1 AND released_at IS NULL)", tankID).Scan(&occupied)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if occupied {
+		return fiber.NewError(fiber.StatusConflict, "Tank still holds batches, release them first")
+	}
+
+	result, err := db.DB.Exec("UPDATE tank SET is_active = false, updated_at = NOW() WHERE id = $1 AND is_active = true", tankID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete tank")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Tank not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Tank deleted successfully",
+	})
+}
+
+// AssignBatchToTank stocks a batch in a tank
+// @Summary Assign batch to tank
+// @Description Stock a batch (or part of it) in a tank. Assignments that overbook the tank are recorded with a warning
+// @Tags tanks
+// @Accept json
+// @Produce json
+// @Param tankId path int true "Tank ID"
+// @Param request body TankAssignmentRequest true "Assignment details"
+// @Success 201 {object} SuccessResponse{data=TankAssignmentResult}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /tanks/{tankId}/assignments [post]
+func AssignBatchToTank(c *fiber.Ctx) error {
+	tankID, err := strconv.Atoi(c.Params("tankId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid tank ID format")
+	}
+
+	var req TankAssignmentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.BatchID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Batch ID is required")
+	}
+	if req.Quantity < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Quantity must not be negative")
+	}
+
+	tank, err := loadTank(tankID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Tank not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	var batchHatcheryID, batchQuantity int
+	err = db.DB.QueryRow("SELECT COALESCE(hatchery_id, 0), COALESCE(quantity, 0) FROM batch WHERE id = $1 AND is_active = true", req.BatchID).
+		Scan(&batchHatcheryID, &batchQuantity)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if batchHatcheryID != tank.HatcheryID {
+		return fiber.NewError(fiber.StatusBadRequest, "Batch belongs to another hatchery")
+	}
+	if req.Quantity == 0 {
+		req.Quantity = batchQuantity
+	}
+	assignedAt := time.Now()
+	if req.AssignedAt != nil {
+		assignedAt = *req.AssignedAt
+	}
+
+	assignment, err := scanTankAssignment(db.DB.QueryRow(`
+		INSERT INTO tank_assignment (tank_id, batch_id, quantity, assigned_at, notes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING `+tankAssignmentColumns,
+		tankID, req.BatchID, req.Quantity, assignedAt, req.Notes))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to assign batch to tank")
+	}
+
+	occupancy, err := tankOccupancy(tank)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve tank occupancy")
+	}
+
+	result := TankAssignmentResult{Assignment: assignment, Occupancy: occupancy, Warnings: []string{}}
+	if occupancy.Overbooked {
+		result.Warnings = append(result.Warnings, overbookingWarning(occupancy))
+	}
+
+	var stocked int
+	err = db.DB.QueryRow("SELECT COALESCE(SUM(quantity), 0) FROM tank_assignment WHERE batch_id = $1 AND released_at IS NULL", req.BatchID).Scan(&stocked)
+	if err == nil && batchQuantity > 0 && stocked > batchQuantity {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("Batch %d has %d larvae stocked in tanks but a quantity of %d", req.BatchID, stocked, batchQuantity))
+	}
+
+	message := "Batch assigned to tank successfully"
+	if len(result.Warnings) > 0 {
+		message = "Batch assigned to tank with warnings"
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    result,
+	})
+}
+
+// ReleaseTankAssignment takes a batch out of a tank
+// @Summary Release tank assignment
+// @Description Take a batch out of a tank, e.g. when it is harvested, moved or shipped
+// @Tags tanks
+// @Accept json
+// @Produce json
+// @Param tankId path int true "Tank ID"
+// @Param assignmentId path int true "Assignment ID"
+// @Param request body ReleaseTankAssignmentRequest false "Release time (default: now)"
+// @Success 200 {object} SuccessResponse{data=models.TankAssignment}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /tanks/{tankId}/assignments/{assignmentId}/release [post]
+func ReleaseTankAssignment(c *fiber.Ctx) error {
+	tankID, err := strconv.Atoi(c.Params("tankId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid tank ID format")
+	}
+	assignmentID, err := strconv.Atoi(c.Params("assignmentId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid assignment ID format")
+	}
+
+	var req ReleaseTankAssignmentRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	releasedAt := time.Now()
+	if req.ReleasedAt != nil {
+		releasedAt = *req.ReleasedAt
+	}
+
+	assignment, err := scanTankAssignment(db.DB.QueryRow(`
+		UPDATE tank_assignment
+		SET released_at = $3, updated_at = NOW()
+		WHERE id = $1 AND tank_id = $2 AND released_at IS NULL AND assigned_at <= $3
+		RETURNING `+tankAssignmentColumns,
+		assignmentID, tankID, releasedAt))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Current assignment not found, or released before it was assigned")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to release assignment")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch released from tank successfully",
+		Data:    assignment,
+	})
+}
+
+// utilizationSeries returns the occupancy of a set of tanks at the end of every day since a date
+func utilizationSeries(tankIDs []int, capacity int, since time.Time) ([]TankUtilizationPoint, error) {
+	rows, err := db.DB.Query(`
+		SELECT TO_CHAR(d, 'YYYY-MM-DD'), COALESCE(SUM(a.quantity), 0)
+		FROM GENERATE_SERIES(DATE_TRUNC('day', $2::timestamp), DATE_TRUNC('day', NOW()), INTERVAL '1 day') AS d
+		LEFT JOIN tank_assignment a ON a.tank_id = ANY($1)
+			AND a.assigned_at < d + INTERVAL '1 day'
+			AND (a.released_at IS NULL OR a.released_at >= d + INTERVAL '1 day')
+		GROUP BY d
+		ORDER BY d
+	`, pq.Array(tankIDs), since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []TankUtilizationPoint{}
+	for rows.Next() {
+		p := TankUtilizationPoint{Capacity: capacity}
+		if err := rows.Scan(&p.Date, &p.Occupied); err != nil {
+			return nil, err
+		}
+		p.UtilizationPercent = utilizationPercent(p.Occupied, capacity)
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// utilizationDays reads the days query parameter of utilization reports
+func utilizationDays(c *fiber.Ctx) time.Time {
+	days := c.QueryInt("days", 30)
+	if days <= 0 || days > 365 {
+		days = 30
+	}
+	return time.Now().AddDate(0, 0, -days)
+}
+
+// GetTankUtilization gets the historical utilization of a tank
+// @Summary Get tank utilization
+// @Description Get the occupancy of a tank at the end of each day, for capacity planning
+// @Tags tanks
+// @Produce json
+// @Param tankId path int true "Tank ID"
+// @Param days query int false "Number of days (default: 30)"
+// @Success 200 {object} SuccessResponse{data=[]TankUtilizationPoint}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /tanks/{tankId}/utilization [get]
+func GetTankUtilization(c *fiber.Ctx) error {
+	tankID, err := strconv.Atoi(c.Params("tankId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid tank ID format")
+	}
+
+	tank, err := loadTank(tankID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Tank not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	points, err := utilizationSeries([]int{tank.ID}, tank.Capacity, utilizationDays(c))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve tank utilization")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Tank utilization retrieved successfully",
+		Data:    points,
+	})
+}
+
+// GetHatcheryUtilization gets the historical utilization of all tanks of a hatchery
+// @Summary Get hatchery utilization
+// @Description Get the combined occupancy of the active tanks of a hatchery at the end of each day, for capacity planning
+// @Tags hatcheries
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param days query int false "Number of days (default: 30)"
+// @Success 200 {object} SuccessResponse{data=[]TankUtilizationPoint}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/tanks/utilization [get]
+func GetHatcheryUtilization(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+
+	var tankIDs []int64
+	var capacity int
+	err = db.DB.QueryRow(`
+		SELECT COALESCE(ARRAY_AGG(id), '{}'), COALESCE(SUM(capacity), 0)
+		FROM tank
+		WHERE hatchery_id = $1 AND is_active = true
+	`, hatcheryID).Scan(pq.Array(&tankIDs), &capacity)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	ids := make([]int, len(tankIDs))
+	for i, id := range tankIDs {
+		ids[i] = int(id)
+	}
+
+	points, err := utilizationSeries(ids, capacity, utilizationDays(c))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve hatchery utilization")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Hatchery utilization retrieved successfully",
+		Data:    points,
+	})
+}
+
+// GetBatchTanks gets the tank history of a batch
+// @Summary Get batch tanks
+// @Description Get the tanks a batch has been stocked in, latest first
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]models.TankAssignment}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/tanks [get]
+func GetBatchTanks(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+tankAssignmentColumns+`
+		FROM tank_assignment
+		WHERE batch_id = $1
+		ORDER BY assigned_at DESC
+	`, batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	assignments := []models.TankAssignment{}
+	for rows.Next() {
+		a, err := scanTankAssignment(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse tank assignment")
+		}
+		assignments = append(assignments, a)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch tanks retrieved successfully",
+		Data:    assignments,
+	})
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/approvals"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/tenantsnapshot"
+)
+
+// ExportTenantSnapshot exports a snapshot of a company
+// @Summary Export tenant snapshot
+// @Description Export every record of a company as committed at one point in time, with the IPFS CIDs and blockchain anchors they hold, as a gzipped JSON file.
+// @Description Accounts are listed by username and email only; webhook and connector secrets, LIMS tokens and delivery logs are left out. The SHA-256 of the file is in the X-Snapshot-Checksum header.
+// @Description When the tenant_export approval policy is enabled, the export is submitted for approval instead; once approved, the requester downloads it once with approval_request_id
+// @Tags admin
+// @Produce application/gzip
+// @Param companyId path int true "Company ID"
+// @Param approval_request_id query int false "Approved export request to download"
+// @Success 200 {file} file
+// @Success 202 {object} SuccessResponse{data=approvals.Request}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/companies/{companyId}/snapshot [post]
+func ExportTenantSnapshot(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil || companyID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	// With an approval policy, the export is downloaded with the request once approved
+	userID, _ := c.Locals("userID").(int)
+	approvalID := c.QueryInt("approval_request_id", 0)
+	if approvalID > 0 {
+		request, err := approvals.Get(approvalID)
+		if err != nil {
+			return approvalError(err)
+		}
+		if err := checkTenantExportApproval(request, companyID, userID, false); err != nil {
+			return err
+		}
+	} else {
+		if err := companyExists(companyID); err != nil {
+			return err
+		}
+		if request, err := submitForApproval(c, approvals.ActionTenantExport, companyID, "company", companyID,
+			fmt.Sprintf("Export a snapshot of every record of company %d", companyID),
+			tenantExportApproval{CompanyID: companyID}); request != nil || err != nil {
+			return err
+		}
+	}
+
+	snap, err := tenantsnapshot.Export(companyID)
+	if errors.Is(err, tenantsnapshot.ErrCompanyNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to export snapshot")
+	}
+	var buf bytes.Buffer
+	checksum, err := tenantsnapshot.Encode(&buf, snap)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to export snapshot")
+	}
+	if approvalID > 0 {
+		if _, err := approvals.Consume(approvalID, approvals.ActionTenantExport, userID, map[string]string{"checksum": checksum}); err != nil {
+			return approvalError(err)
+		}
+	}
+	if _, err := tenantsnapshot.RecordExport(snap, checksum, userID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record snapshot")
+	}
+
+	c.Set("Content-Type", "application/gzip")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=company-%d-%s.snapshot.json.gz", companyID, snap.TakenAt.UTC().Format("20060102T150405Z")))
+	c.Set("X-Snapshot-Checksum", checksum)
+	return c.Send(buf.Bytes())
+}
+
+// checkTenantExportApproval checks an approval request lets the caller export a company, for download or as a demo mirror
+func checkTenantExportApproval(request *approvals.Request, companyID, userID int, demoMirror bool) error {
+	var payload tenantExportApproval
+	_ = json.Unmarshal(request.Payload, &payload)
+	if request.ActionType != approvals.ActionTenantExport || request.TargetID != companyID || payload.DemoMirror != demoMirror {
+		if demoMirror {
+			return fiber.NewError(fiber.StatusBadRequest, "The approval request is not for mirroring this company")
+		}
+		return fiber.NewError(fiber.StatusBadRequest, "The approval request is not for exporting this company")
+	}
+	if request.Status != approvals.StatusApproved {
+		return fiber.NewError(fiber.StatusConflict, "The export is not approved or was already used")
+	}
+	if request.RequestedBy != userID {
+		return fiber.NewError(fiber.StatusForbidden, "Only the requester can carry out an approved export")
+	}
+	return nil
+}
+
+// companyExists answers 404 unless the company exists
+func companyExists(companyID int) error {
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1)", companyID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+	return nil
+}
+
+// RestoreTenantSnapshot restores a snapshot as a new company
+// @Summary Restore tenant snapshot
+// @Description Restore a snapshot exported by this or another environment as a new company, in a single transaction. Records get new IDs; references to accounts are matched by email,
+// @Description and references to other records outside the snapshot are kept when the record exists here and cleared otherwise. Rows whose unique values are already taken are reported as conflicts.
+// @Description Mode copy gives records new global IDs, for recovery drills; mode migrate keeps them, for moving a customer. With dry_run the restore is reported and rolled back
+// @Tags admin
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Snapshot file"
+// @Param mode formData string false "copy (default) or migrate"
+// @Param dry_run formData bool false "Report without keeping the restore"
+// @Param company_name formData string false "Name of the restored company"
+// @Param checksum formData string false "Expected SHA-256 of the file"
+// @Success 200 {object} SuccessResponse{data=tenantsnapshot.RestoreReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/tenant-snapshots/restore [post]
+func RestoreTenantSnapshot(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "File is required")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Failed to read file")
+	}
+	snap, checksum, err := tenantsnapshot.Decode(file)
+	file.Close()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if expected := strings.ToLower(strings.TrimSpace(c.FormValue("checksum"))); expected != "" && expected != checksum {
+		return fiber.NewError(fiber.StatusBadRequest, "Snapshot checksum does not match")
+	}
+
+	dryRun, _ := strconv.ParseBool(c.FormValue("dry_run", "false"))
+	userID, _ := c.Locals("userID").(int)
+	report, err := tenantsnapshot.Restore(snap, tenantsnapshot.RestoreOptions{
+		Mode:        c.FormValue("mode", tenantsnapshot.ModeCopy),
+		DryRun:      dryRun,
+		CompanyName: strings.TrimSpace(c.FormValue("company_name")),
+		Checksum:    checksum,
+		UserID:      userID,
+	})
+	if errors.Is(err, tenantsnapshot.ErrInvalidMode) || errors.Is(err, tenantsnapshot.ErrInvalidSnapshot) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to restore snapshot: "+err.Error())
+	}
+
+	message := "Snapshot restored successfully"
+	if dryRun {
+		message = "Snapshot restore checked, nothing was kept"
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    report,
+	})
+}
+
+// ListTenantSnapshotRuns lists snapshot exports and restores
+// @Summary List tenant snapshot runs
+// @Description List the latest snapshot exports and restores with their checksums and reports
+// @Tags admin
+// @Produce json
+// @Param company_id query int false "Only runs of this company, as source or target"
+// @Param limit query int false "Maximum number of runs (default 50)"
+// @Success 200 {object} SuccessResponse{data=[]tenantsnapshot.Run}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/tenant-snapshots [get]
+func ListTenantSnapshotRuns(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	runs, err := tenantsnapshot.ListRuns(c.QueryInt("company_id", 0), c.QueryInt("limit", 50))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve snapshot runs")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Snapshot runs retrieved successfully",
+		Data:    runs,
+	})
+}
+
+// DemoMirrorRequest is the request to mirror a company into a sandbox company
+type DemoMirrorRequest struct {
+	CompanyName string `json:"company_name"` // Name of the sandbox company, from the anonymized name when empty
+	DryRun      bool   `json:"dry_run"`
+}
+
+// DemoMirrorResult describes a demo mirror
+type DemoMirrorResult struct {
+	Anonymization *tenantsnapshot.AnonymizeReport `json:"anonymization"`
+	Restore       *tenantsnapshot.RestoreReport   `json:"restore"`
+}
+
+// MirrorDemoCompany restores an anonymized copy of a company as a sandbox company
+// @Summary Mirror company as anonymized demo data
+// @Description Export a company, anonymize it and restore it as a new sandbox company, for screenshots and sales demos with realistic data volumes.
+// @Description Names, free text, emails and contact details are scrambled, codes, hashes, CIDs and transaction IDs replaced by values of the same shape, and GPS positions all moved by one random offset.
+// @Description Row counts, quantities, timestamps and distances are preserved. Records of other accounts are attributed to the calling admin. With dry_run the restore is reported and rolled back.
+// @Description When the tenant_export approval policy is enabled, the mirror is submitted for approval instead; once approved, the requester carries it out once with approval_request_id
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param approval_request_id query int false "Approved mirror request to carry out"
+// @Param request body DemoMirrorRequest false "Mirror options"
+// @Success 200 {object} SuccessResponse{data=DemoMirrorResult}
+// @Success 202 {object} SuccessResponse{data=approvals.Request}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/companies/{companyId}/demo-mirror [post]
+func MirrorDemoCompany(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil || companyID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	var req DemoMirrorRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	// A mirror exports the company like a snapshot does, so it is under the same approval policy.
+	// Dry runs keep nothing and report only counts, so they are not submitted
+	userID, _ := c.Locals("userID").(int)
+	approvalID := c.QueryInt("approval_request_id", 0)
+	if approvalID > 0 {
+		request, err := approvals.Get(approvalID)
+		if err != nil {
+			return approvalError(err)
+		}
+		if err := checkTenantExportApproval(request, companyID, userID, true); err != nil {
+			return err
+		}
+	} else if !req.DryRun {
+		if err := companyExists(companyID); err != nil {
+			return err
+		}
+		if request, err := submitForApproval(c, approvals.ActionTenantExport, companyID, "company", companyID,
+			fmt.Sprintf("Mirror company %d as anonymized demo data", companyID),
+			tenantExportApproval{CompanyID: companyID, DemoMirror: true}); request != nil || err != nil {
+			return err
+		}
+	}
+
+	var email string
+	if err := db.DB.QueryRow("SELECT email FROM account WHERE id = $1", userID).Scan(&email); err != nil && err != sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	snap, err := tenantsnapshot.Export(companyID)
+	if errors.Is(err, tenantsnapshot.ErrCompanyNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to export company")
+	}
+	anonymization, err := tenantsnapshot.Anonymize(snap, tenantsnapshot.AnonymizeOptions{AccountEmail: email})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to anonymize company")
+	}
+
+	name := strings.TrimSpace(req.CompanyName)
+	if name == "" {
+		name = "Sandbox " + snap.CompanyName
+	}
+	report, err := tenantsnapshot.Restore(snap, tenantsnapshot.RestoreOptions{
+		Mode:        tenantsnapshot.ModeCopy,
+		DryRun:      req.DryRun,
+		CompanyName: name,
+		UserID:      userID,
+	})
+	if err != nil {
+		fmt.Printf("Failed to restore demo mirror of company %d: %v\n", companyID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to restore demo mirror")
+	}
+	if approvalID > 0 && !req.DryRun {
+		if _, err := approvals.Consume(approvalID, approvals.ActionTenantExport, userID, map[string]int{"company_id": report.CompanyID}); err != nil {
+			return approvalError(err)
+		}
+	}
+
+	message := "Demo mirror created successfully"
+	if req.DryRun {
+		message = "Demo mirror checked, nothing was kept"
+	}
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    DemoMirrorResult{Anonymization: anonymization, Restore: report},
+	})
+}
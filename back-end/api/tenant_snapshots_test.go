@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/approvals"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCheckTenantExportApproval(t *testing.T) {
+	approved := func(payload tenantExportApproval) *approvals.Request {
+		raw, _ := json.Marshal(payload)
+		return &approvals.Request{
+			ActionType: approvals.ActionTenantExport, TargetType: "company", TargetID: 4,
+			Payload: raw, Status: approvals.StatusApproved, RequestedBy: 2,
+		}
+	}
+	download := approved(tenantExportApproval{CompanyID: 4})
+	mirror := approved(tenantExportApproval{CompanyID: 4, DemoMirror: true})
+	pending := approved(tenantExportApproval{CompanyID: 4, DemoMirror: true})
+	pending.Status = approvals.StatusPending
+
+	tests := []struct {
+		name       string
+		request    *approvals.Request
+		companyID  int
+		userID     int
+		demoMirror bool
+		status     int
+	}{
+		{"approved download", download, 4, 2, false, 0},
+		{"approved mirror", mirror, 4, 2, true, 0},
+		{"download approval used for a mirror", download, 4, 2, true, fiber.StatusBadRequest},
+		{"mirror approval used for a download", mirror, 4, 2, false, fiber.StatusBadRequest},
+		{"other company", mirror, 5, 2, true, fiber.StatusBadRequest},
+		{"not approved yet", pending, 4, 2, true, fiber.StatusConflict},
+		{"not the requester", mirror, 4, 3, true, fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		err := checkTenantExportApproval(tt.request, tt.companyID, tt.userID, tt.demoMirror)
+		if tt.status == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		var fiberErr *fiber.Error
+		if !errors.As(err, &fiberErr) || fiberErr.Code != tt.status {
+			t.Errorf("%s: expected %d, got %v", tt.name, tt.status, err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+	"github.com/LTPPPP/TracePost-larvaeChain/tracesnapshot"
+)
+
+// PublicTrace is the consumer facing trace of a batch as published in snapshots
+type PublicTrace struct {
+	BatchID       int                      `json:"batch_id"`
+	Species       string                   `json:"species"`
+	Status        string                   `json:"status"`
+	Quantity      int                      `json:"quantity"`
+	Origin        string                   `json:"origin"`
+	Company       string                   `json:"company"`
+	CreatedAt     time.Time                `json:"created_at"`
+	Strain        map[string]string        `json:"strain,omitempty"`
+	Events        []PublicTraceEvent       `json:"events"`
+	Certificates  []PublicTraceCertificate `json:"certificates"`
+	Transfers     []PublicTraceTransfer    `json:"transfers"`
+	Claims        []models.BatchClaim      `json:"claims"`
+	Blockchain    []map[string]interface{} `json:"blockchain"`
+	ContentBlocks []ContentBlock           `json:"content_blocks"`
+}
+
+// PublicTraceEvent is a lifecycle event in a public trace
+type PublicTraceEvent struct {
+	EventType   string                   `json:"event_type"`
+	Location    string                   `json:"location,omitempty"`
+	Timestamp   *time.Time               `json:"timestamp,omitempty"`
+	Metadata    json.RawMessage          `json:"metadata,omitempty" swaggertype:"object"`
+	Corrections []models.EventCorrection `json:"corrections,omitempty"` // Earlier versions, newest first
+}
+
+// PublicTraceCertificate is a certificate in a public trace
+type PublicTraceCertificate struct {
+	CertificateType string     `json:"certificate_type"`
+	Issuer          string     `json:"issuer"`
+	Status          string     `json:"status"`
+	IssueDate       *time.Time `json:"issue_date,omitempty"`
+	ExpiryDate      *time.Time `json:"expiry_date,omitempty"`
+}
+
+// PublicTraceTransfer is a custody transfer in a public trace
+type PublicTraceTransfer struct {
+	Status       string     `json:"status"`
+	TransferTime *time.Time `json:"transfer_time,omitempty"`
+}
+
+// traceSnapshotPage is the standalone page published next to the JSON snapshot
+var traceSnapshotPage = template.Must(template.New("trace").Funcs(template.FuncMap{
+	"date": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Batch {{.BatchID}} - {{.Species}}</title>
+<style>body{font-family:sans-serif;max-width:720px;margin:0 auto;padding:16px}table{width:100%;border-collapse:collapse}td,th{text-align:left;padding:4px;border-bottom:1px solid #ddd}</style>
+</head>
+<body>
+<h1>{{.Species}}</h1>
+<p>Batch {{.BatchID}} from {{.Origin}}{{if .Company}} ({{.Company}}){{end}}, status {{.Status}}</p>
+{{if .Strain}}<p>Strain {{index .Strain "code"}} {{index .Strain "line_type"}}</p>{{end}}
+{{if .Claims}}<h2>Claims</h2><ul>{{range .Claims}}<li>{{.Claim}}: {{.Status}}</li>{{end}}</ul>{{end}}
+{{if .Certificates}}<h2>Certificates</h2><table><tr><th>Type</th><th>Issuer</th><th>Status</th><th>Expires</th></tr>
+{{range .Certificates}}<tr><td>{{.CertificateType}}</td><td>{{.Issuer}}</td><td>{{.Status}}</td><td>{{date .ExpiryDate}}</td></tr>{{end}}</table>{{end}}
+{{if .Events}}<h2>History</h2><table><tr><th>Date</th><th>Event</th><th>Location</th></tr>
+{{range .Events}}<tr><td>{{date .Timestamp}}</td><td>{{.EventType}}{{if .Corrections}} (corrected){{end}}</td><td>{{.Location}}</td></tr>{{end}}</table>{{end}}
+{{if .Blockchain}}<h2>Blockchain records</h2><ul>{{range .Blockchain}}<li>{{index . "tx_id"}}</li>{{end}}</ul>{{end}}
+{{range .ContentBlocks}}<section><h2>{{.Title}}</h2><p>{{.Body}}</p></section>{{end}}
+</body>
+</html>
+`))
+
+// RenderPublicTrace builds the full public trace of a batch for snapshots
+func RenderPublicTrace(batchID int, html bool) (tracesnapshot.Rendered, error) {
+	trace := PublicTrace{
+		Events:       []PublicTraceEvent{},
+		Certificates: []PublicTraceCertificate{},
+		Transfers:    []PublicTraceTransfer{},
+	}
+	err := db.DB.QueryRow(`
+		SELECT b.id, COALESCE(b.species, ''), COALESCE(b.status, ''), COALESCE(b.quantity, 0),
+			h.name, COALESCE(c.name, ''), b.created_at
+		FROM batch b
+		JOIN hatchery h ON b.hatchery_id = h.id
+		LEFT JOIN company c ON h.company_id = c.id
+		WHERE b.id = $1
+	`, batchID).Scan(&trace.BatchID, &trace.Species, &trace.Status, &trace.Quantity,
+		&trace.Origin, &trace.Company, &trace.CreatedAt)
+	if err != nil {
+		return tracesnapshot.Rendered{}, err
+	}
+
+	var strainCode, strainLineType, strainSupplier string
+	err = db.DB.QueryRow(`
+		SELECT s.code, COALESCE(s.line_type, ''), COALESCE(s.supplier, '')
+		FROM batch b
+		JOIN strain s ON s.id = b.strain_id
+		WHERE b.id = $1
+	`, batchID).Scan(&strainCode, &strainLineType, &strainSupplier)
+	if err == nil {
+		trace.Strain = map[string]string{"code": strainCode, "line_type": strainLineType, "supplier": strainSupplier}
+	} else if err != sql.ErrNoRows {
+		return tracesnapshot.Rendered{}, err
+	}
+
+	corrections, err := loadEventCorrections(batchID)
+	if err != nil {
+		return tracesnapshot.Rendered{}, err
+	}
+	rows, err := db.DB.Query(`
+		SELECT id, COALESCE(event_type, ''), COALESCE(location, ''), timestamp, metadata
+		FROM event
+		WHERE batch_id = $1 AND is_active = true AND superseded_by_event_id IS NULL
+		ORDER BY timestamp, id
+	`, batchID)
+	if err != nil {
+		return tracesnapshot.Rendered{}, err
+	}
+	for rows.Next() {
+		var e PublicTraceEvent
+		var id int
+		var timestamp sql.NullTime
+		var metadata []byte
+		if err := rows.Scan(&id, &e.EventType, &e.Location, &timestamp, &metadata); err != nil {
+			rows.Close()
+			return tracesnapshot.Rendered{}, err
+		}
+		e.Timestamp = timePtr(timestamp)
+		if len(metadata) > 0 {
+			e.Metadata = metadata
+		}
+		e.Corrections = corrections[id]
+		trace.Events = append(trace.Events, e)
+	}
+	rows.Close()
+
+	rows, err = db.DB.Query(`
+		SELECT certificate_type, issuer, status, issue_date, expiry_date
+		FROM certificates
+		WHERE batch_id = $1 AND is_active = true
+		ORDER BY id
+	`, batchID)
+	if err != nil {
+		return tracesnapshot.Rendered{}, err
+	}
+	for rows.Next() {
+		var cert PublicTraceCertificate
+		var issueDate, expiryDate sql.NullTime
+		if err := rows.Scan(&cert.CertificateType, &cert.Issuer, &cert.Status, &issueDate, &expiryDate); err != nil {
+			rows.Close()
+			return tracesnapshot.Rendered{}, err
+		}
+		cert.IssueDate = timePtr(issueDate)
+		cert.ExpiryDate = timePtr(expiryDate)
+		trace.Certificates = append(trace.Certificates, cert)
+	}
+	rows.Close()
+
+	// Only the custody chain is public, not the accounts involved
+	rows, err = db.DB.Query(`
+		SELECT COALESCE(status, ''), transfer_time
+		FROM shipment_transfer
+		WHERE batch_id = $1 AND is_active = true
+		ORDER BY transfer_time, id
+	`, batchID)
+	if err != nil {
+		return tracesnapshot.Rendered{}, err
+	}
+	for rows.Next() {
+		var t PublicTraceTransfer
+		var transferTime sql.NullTime
+		if err := rows.Scan(&t.Status, &transferTime); err != nil {
+			rows.Close()
+			return tracesnapshot.Rendered{}, err
+		}
+		t.TransferTime = timePtr(transferTime)
+		trace.Transfers = append(trace.Transfers, t)
+	}
+	rows.Close()
+
+	if trace.Claims, err = loadBatchClaims(batchID); err != nil {
+		return tracesnapshot.Rendered{}, err
+	}
+	if trace.Blockchain, err = getBlockchainRecordsForBatch(batchID); err != nil {
+		return tracesnapshot.Rendered{}, err
+	}
+	if trace.ContentBlocks, err = loadTraceContentBlocks(batchID); err != nil {
+		return tracesnapshot.Rendered{}, err
+	}
+
+	rendered := tracesnapshot.Rendered{Trace: trace}
+	if html {
+		var page bytes.Buffer
+		if err := traceSnapshotPage.Execute(&page, trace); err != nil {
+			return tracesnapshot.Rendered{}, err
+		}
+		rendered.HTML = page.Bytes()
+	}
+	return rendered, nil
+}
+
+// ListTraceSnapshots lists the published snapshots of a batch
+// @Summary List trace snapshots
+// @Description List the public trace snapshots of a batch published to IPFS, newest first, with their on-chain anchors
+// @Tags batches
+// @Produce json
+// @Param batchId path string true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]tracesnapshot.Snapshot}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batches/{batchId}/snapshots [get]
+func ListTraceSnapshots(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	snapshots, err := tracesnapshot.List(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve trace snapshots")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Trace snapshots retrieved successfully",
+		Data:    snapshots,
+	})
+}
+
+// PublishTraceSnapshot publishes a snapshot of a batch now
+// @Summary Publish trace snapshot
+// @Description Render the public trace of a batch and publish it to IPFS with an on-chain anchor, without waiting for the batch to settle.
+// @Description A new version is only published when the trace changed since the latest snapshot
+// @Tags batches
+// @Produce json
+// @Param batchId path string true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=tracesnapshot.Snapshot}
+// @Success 201 {object} SuccessResponse{data=tracesnapshot.Snapshot}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batches/{batchId}/snapshots [post]
+func PublishTraceSnapshot(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	snapshot, published, err := tracesnapshot.Default().Publish(batchID, userID)
+	if errors.Is(err, tracesnapshot.ErrBatchNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to publish trace snapshot: "+err.Error())
+	}
+
+	if !published {
+		return c.JSON(SuccessResponse{
+			Success: true,
+			Message: "Trace is unchanged since the latest snapshot",
+			Data:    snapshot,
+		})
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Trace snapshot published successfully",
+		Data:    snapshot,
+	})
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/attestation"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+)
+
+// GetTraceabilityStandard returns the published completeness standard
+// @Summary Get traceability standard
+// @Description Get the published standard a batch must meet to be attested traceability complete: its finished statuses, lifecycle stages,
+// @Description required documents and criteria. The owner's completeness profile can require more documents
+// @Tags batches
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=attestation.Standard}
+// @Router /traceability-standard [get]
+func GetTraceabilityStandard(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Traceability standard retrieved successfully",
+		Data:    attestation.Current,
+	})
+}
+
+// IssueTraceabilityAttestation certifies a finished batch as traceability complete
+// @Summary Issue traceability attestation
+// @Description Evaluate a finished batch against the published standard: every lifecycle stage has an event, the batch and its events are anchored
+// @Description in confirmed transactions and every required document is signed. A batch meeting it gets a platform-signed attestation anchored on-chain;
+// @Description otherwise the failed checks are returned with 422. With dry_run=true the batch is only evaluated
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Param dry_run query bool false "Only evaluate the batch"
+// @Success 200 {object} SuccessResponse{data=DryRunResult}
+// @Success 201 {object} SuccessResponse{data=attestation.Attestation}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} SuccessResponse{data=attestation.Evaluation}
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batches/{batchId}/traceability-attestations [post]
+func IssueTraceabilityAttestation(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	if _, err := batchOwner(c, batchID); err != nil {
+		return err
+	}
+
+	if isDryRun(c) {
+		evaluation, err := attestation.Evaluate(batchID)
+		if errors.Is(err, attestation.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to evaluate batch")
+		}
+		result := DryRunResult{Action: "issue_traceability_attestation", Record: evaluation, Effects: []string{}}
+		if evaluation.Complete {
+			result.Effects = []string{
+				"Sign the attestation record with the platform key",
+				"Insert the traceability attestation",
+				"Submit a " + attestation.TxTypeTraceabilityAttestation + " transaction to the blockchain",
+			}
+		} else {
+			result.Warnings = []string{"The batch does not meet the " + attestation.Current.ID + " standard and would not be attested"}
+		}
+		return dryRunResponse(c, "Dry run: the batch was evaluated", result)
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	issued, evaluation, err := attestation.Default().Issue(batchID, userID)
+	switch {
+	case errors.Is(err, attestation.ErrIncomplete):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(SuccessResponse{
+			Success: false,
+			Message: "Batch does not meet the " + attestation.Current.ID + " standard",
+			Data:    evaluation,
+		})
+	case errors.Is(err, attestation.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	case err != nil:
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to issue traceability attestation")
+	}
+	return sendAttestations(c.Status(fiber.StatusCreated), "Traceability attestation issued successfully", issued)
+}
+
+// ListTraceabilityAttestations lists the attestations of a batch
+// @Summary List traceability attestations
+// @Description List the traceability complete attestations issued for a batch, newest first, with their on-chain anchors
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]attestation.Attestation}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/traceability-attestations [get]
+func ListTraceabilityAttestations(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	attestations, err := attestation.List(batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve traceability attestations")
+	}
+	return sendAttestations(c, "Traceability attestations retrieved successfully", attestations)
+}
+
+// GetTraceabilityAttestation returns an attestation, or its printable certificate
+// @Summary Get traceability attestation
+// @Description Get a traceability complete attestation. The record is signed as a detached JWS verifiable against /.well-known/jwks.json
+// @Description and its SHA-256 is anchored on-chain. With format=pdf the attestation is rendered as a printable certificate whose QR code links back here
+// @Tags batches
+// @Produce json
+// @Produce application/pdf
+// @Param attestationId path int true "Attestation ID"
+// @Param format query string false "json (default) or pdf"
+// @Success 200 {object} SuccessResponse{data=attestation.Attestation}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /traceability-attestations/{attestationId} [get]
+func GetTraceabilityAttestation(c *fiber.Ctx) error {
+	attestationID, err := strconv.Atoi(c.Params("attestationId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid attestation ID format")
+	}
+	format := c.Query("format", "json")
+	if format != "json" && format != "pdf" {
+		return fiber.NewError(fiber.StatusBadRequest, "Format must be json or pdf")
+	}
+
+	issued, err := attestation.Get(attestationID)
+	if errors.Is(err, attestation.ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Attestation not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve traceability attestation")
+	}
+	if format == "json" {
+		return sendAttestations(c, "Traceability attestation retrieved successfully", issued)
+	}
+
+	pdf, err := utils.RenderPDFLabel(attestationCertificate(issued, attestationBaseURL(issued.CompanyID)), utils.LabelLayout{
+		WidthMM:     250,
+		HeightMM:    90,
+		DPI:         203,
+		ShowSpecies: true,
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate PDF certificate")
+	}
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", fmt.Sprintf("inline; filename=traceability-attestation-%d.pdf", issued.ID))
+	return c.Send(pdf)
+}
+
+// sendAttestations sends attestations as they were signed: their records are kept out of response formatting,
+// which would move issued_at to another time zone and break record_hash and the signature
+func sendAttestations(c *fiber.Ctx, message string, data interface{}) error {
+	middleware.SkipFormatting(c)
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// attestationBaseURL is the white-label domain of a company once verified, or the platform URL
+func attestationBaseURL(companyID int) string {
+	if baseURL := companyTraceBaseURL(companyID); baseURL != "" {
+		return baseURL
+	}
+	return config.GetConfig().BaseURL
+}
+
+// attestationCertificate lays out an attestation as a printable certificate
+func attestationCertificate(issued *attestation.Attestation, baseURL string) utils.LabelData {
+	var record attestation.Record
+	_ = json.Unmarshal(issued.Record, &record)
+
+	lotCode := record.BatchGlobalID
+	if lotCode == "" {
+		lotCode = fmt.Sprintf("%06d", issued.BatchID)
+	}
+	data := utils.LabelData{
+		Title:     "Traceability complete - " + issued.Standard,
+		LotCode:   lotCode,
+		Species:   record.Species,
+		QRContent: fmt.Sprintf("%s/api/v1/traceability-attestations/%d", baseURL, issued.ID),
+		ExtraLines: []string{
+			fmt.Sprintf("Attestation #%d issued %s by %s", issued.ID, issued.IssuedAt.UTC().Format(time.RFC3339), attestation.Platform),
+			"Record SHA-256: " + issued.RecordHash,
+		},
+	}
+	if record.CompanyName != "" {
+		data.ExtraLines = append([]string{"Owner: " + record.CompanyName}, data.ExtraLines...)
+	}
+	if issued.AnchorTxID != "" {
+		data.ExtraLines = append(data.ExtraLines, "Anchor tx: "+issued.AnchorTxID)
+	} else {
+		data.ExtraLines = append(data.ExtraLines, "Anchor: pending")
+	}
+	data.ExtraLines = append(data.ExtraLines, "Verify the signature against "+baseURL+"/.well-known/jwks.json")
+	return data
+}
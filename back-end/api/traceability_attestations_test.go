@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/attestation"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTraceabilityAttestationSurvivesResponseFormatting(t *testing.T) {
+	issuedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	raw, err := json.Marshal(attestation.Record{
+		Attestation: "traceability_complete",
+		Standard:    attestation.Current.ID,
+		BatchID:     7,
+		BatchStatus: "completed",
+		Checks:      []attestation.Check{},
+		Documents:   []string{},
+		IssuedAt:    issuedAt,
+		Platform:    attestation.Platform,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(raw)
+	issued := &attestation.Attestation{
+		ID: 1, BatchID: 7, Standard: attestation.Current.ID,
+		Record: raw, RecordHash: hex.EncodeToString(sum[:]),
+		Status: attestation.StatusSigned, IssuedAt: issuedAt,
+	}
+
+	app := fiber.New()
+	app.Use(middleware.ResponseFormatting(nil))
+	app.Get("/traceability-attestations/1", func(c *fiber.Ctx) error {
+		return sendAttestations(c, "Traceability attestation retrieved successfully", issued)
+	})
+
+	req := httptest.NewRequest(fiber.MethodGet, "/traceability-attestations/1", nil)
+	req.Header.Set("X-Timezone", "Asia/Ho_Chi_Minh")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	var out struct {
+		Data struct {
+			Record     json.RawMessage `json:"record"`
+			RecordHash string          `json:"record_hash"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	got := sha256.Sum256(out.Data.Record)
+	if hex.EncodeToString(got[:]) != out.Data.RecordHash {
+		t.Fatalf("record no longer matches record_hash after formatting: %s", out.Data.Record)
+	}
+}
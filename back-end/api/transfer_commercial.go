@@ -0,0 +1,336 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// incotermsRules are the Incoterms 2020 rules accepted on transfers
+var incotermsRules = map[string]bool{
+	"EXW": true, "FCA": true, "CPT": true, "CIP": true, "DAP": true, "DPU": true, "DDP": true,
+	"FAS": true, "FOB": true, "CFR": true, "CIF": true,
+}
+
+// TransferCommercialTermsRequest represents the commercial terms recorded for a transfer; empty fields are cleared
+type TransferCommercialTermsRequest struct {
+	PONumber  string   `json:"po_number"`
+	UnitPrice *float64 `json:"unit_price"`
+	Currency  string   `json:"currency"`  // ISO 4217 code, required with a unit price
+	Incoterms string   `json:"incoterms"` // Incoterms 2020 rule, e.g. FOB
+	Quantity  *int     `json:"quantity"`
+}
+
+// TransferPriceReport summarises the transfers of one species priced in one currency
+type TransferPriceReport struct {
+	Species          string   `json:"species"`
+	Currency         string   `json:"currency"`
+	Transfers        int      `json:"transfers"`
+	TotalQuantity    int64    `json:"total_quantity"`
+	AverageUnitPrice *float64 `json:"average_unit_price,omitempty"` // Weighted by quantity
+	MinUnitPrice     *float64 `json:"min_unit_price,omitempty"`
+	MaxUnitPrice     *float64 `json:"max_unit_price,omitempty"`
+	Unconverted      int      `json:"unconverted,omitempty"` // Normalized reports: priced transfers left out for want of an exchange rate
+}
+
+// transferPriceReportFrom selects the priced transfers a company ($1) sent or received, for the direction in $2
+// (sold, bought or both when empty) between the optional times in $3 and $4
+const transferPriceReportFrom = `
+	FROM transfer_commercial_terms t
+	JOIN shipment_transfer st ON st.id = t.transfer_id AND st.is_active = true
+	JOIN batch b ON b.id = st.batch_id
+	LEFT JOIN account sa ON sa.id = st.sender_id
+	LEFT JOIN account ra ON ra.id = st.receiver_id
+	WHERE (($2::text IN ('', 'sold') AND sa.company_id = $1) OR ($2::text IN ('', 'bought') AND ra.company_id = $1))
+		AND ($3::timestamp IS NULL OR st.transfer_time >= $3) AND ($4::timestamp IS NULL OR st.transfer_time < $4)
+`
+
+// transferParties are the companies on both sides of a transfer
+type transferParties struct {
+	TransferTime      time.Time
+	SenderCompanyID   int
+	ReceiverCompanyID int
+}
+
+// loadTransferParties resolves the companies of the sender and the receiver of a transfer
+func loadTransferParties(transferID int) (transferParties, error) {
+	var p transferParties
+	err := db.DB.QueryRow(`
+		SELECT st.transfer_time, COALESCE(sa.company_id, 0), COALESCE(ra.company_id, 0)
+		FROM shipment_transfer st
+		LEFT JOIN account sa ON sa.id = st.sender_id
+		LEFT JOIN account ra ON ra.id = st.receiver_id
+		WHERE st.id = $1 AND st.is_active = true
+	`, transferID).Scan(&p.TransferTime, &p.SenderCompanyID, &p.ReceiverCompanyID)
+	return p, err
+}
+
+// isCounterparty reports whether the caller belongs to one of the companies of a transfer
+func (p transferParties) isCounterparty(c *fiber.Ctx) bool {
+	companyID, _ := c.Locals("companyID").(int)
+	return companyID != 0 && (companyID == p.SenderCompanyID || companyID == p.ReceiverCompanyID)
+}
+
+// canSeeCommercialTerms reports whether the caller may read the commercial terms of a transfer:
+// admins, the two counterparties, and auditors holding an active grant on a hatchery of either company
+// whose scope covers the transfer
+func canSeeCommercialTerms(c *fiber.Ctx, p transferParties) (bool, error) {
+	role, _ := c.Locals("role").(string)
+	if role == "admin" || p.isCounterparty(c) {
+		return true, nil
+	}
+	if role != middleware.RoleAuditor {
+		return false, nil
+	}
+	userID, _ := c.Locals("userID").(int)
+	var granted bool
+	err := db.DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM audit_access_grant g JOIN hatchery h ON h.id = g.hatchery_id
+			WHERE g.auditor_id = $1 AND g.is_active = true AND g.revoked_at IS NULL AND g.expires_at > NOW()
+				AND h.company_id IN ($2, $3) AND $4 BETWEEN g.scope_start AND g.scope_end
+		)
+	`, userID, p.SenderCompanyID, p.ReceiverCompanyID, p.TransferTime).Scan(&granted)
+	return granted, err
+}
+
+// loadTransferCommercialTerms loads the commercial terms of a transfer, or nil when none were recorded
+func loadTransferCommercialTerms(transferID int) (*models.TransferCommercialTerms, error) {
+	var t models.TransferCommercialTerms
+	var unitPrice sql.NullFloat64
+	var quantity, updatedBy sql.NullInt64
+	err := db.DB.QueryRow(`
+		SELECT transfer_id, COALESCE(po_number, ''), unit_price, COALESCE(currency, ''), COALESCE(incoterms, ''),
+			quantity, updated_by, created_at, updated_at
+		FROM transfer_commercial_terms WHERE transfer_id = $1
+	`, transferID).Scan(&t.TransferID, &t.PONumber, &unitPrice, &t.Currency, &t.Incoterms,
+		&quantity, &updatedBy, &t.CreatedAt, &t.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.UnitPrice = floatPtr(unitPrice)
+	t.Quantity = intPtr(quantity)
+	t.UpdatedBy = intPtr(updatedBy)
+	return &t, nil
+}
+
+// attachTransferCommercialTerms adds the commercial terms to a transfer when the caller may see them
+func attachTransferCommercialTerms(c *fiber.Ctx, transfer *models.ShipmentTransfer) {
+	parties, err := loadTransferParties(transfer.ID)
+	if err != nil {
+		return
+	}
+	if visible, err := canSeeCommercialTerms(c, parties); err != nil || !visible {
+		return
+	}
+	transfer.Commercial, _ = loadTransferCommercialTerms(transfer.ID)
+}
+
+// GetTransferCommercialTerms retrieves the commercial terms of a transfer
+// @Summary Get transfer commercial terms
+// @Description Retrieve the purchase order number, unit price, currency and incoterms of a transfer. Only the sending and receiving companies and their auditors can see them.
+// @Tags shipments
+// @Produce json
+// @Param id path int true "Transfer ID"
+// @Success 200 {object} SuccessResponse{data=models.TransferCommercialTerms}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments/transfers/{id}/commercial [get]
+func GetTransferCommercialTerms(c *fiber.Ctx) error {
+	transferID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid transfer ID format")
+	}
+	parties, err := loadTransferParties(transferID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Transfer not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	visible, err := canSeeCommercialTerms(c, parties)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !visible {
+		return fiber.NewError(fiber.StatusForbidden, "Only the parties to the transfer and their auditors can see its commercial terms")
+	}
+
+	terms, err := loadTransferCommercialTerms(transferID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if terms == nil {
+		return fiber.NewError(fiber.StatusNotFound, "No commercial terms recorded for this transfer")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Commercial terms retrieved successfully",
+		Data:    terms,
+	})
+}
+
+// SetTransferCommercialTerms records the commercial terms of a transfer
+// @Summary Set transfer commercial terms
+// @Description Record or replace the purchase order number, unit price, currency, incoterms and quantity of a transfer. Only the sending and receiving companies can set them.
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param id path int true "Transfer ID"
+// @Param request body TransferCommercialTermsRequest true "Commercial terms"
+// @Success 200 {object} SuccessResponse{data=models.TransferCommercialTerms}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /shipments/transfers/{id}/commercial [put]
+func SetTransferCommercialTerms(c *fiber.Ctx) error {
+	transferID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid transfer ID format")
+	}
+
+	var req TransferCommercialTermsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.PONumber = strings.TrimSpace(req.PONumber)
+	req.Currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+	req.Incoterms = strings.ToUpper(strings.TrimSpace(req.Incoterms))
+	if req.UnitPrice != nil && *req.UnitPrice < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Unit price cannot be negative")
+	}
+	if req.UnitPrice != nil && req.Currency == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Currency is required with a unit price")
+	}
+	if req.Currency != "" && len(req.Currency) != 3 {
+		return fiber.NewError(fiber.StatusBadRequest, "Currency must be a 3-letter ISO 4217 code")
+	}
+	if req.Incoterms != "" && !incotermsRules[req.Incoterms] {
+		return fiber.NewError(fiber.StatusBadRequest, "Incoterms must be an Incoterms 2020 rule, e.g. EXW, FOB, CFR or CIF")
+	}
+	if req.Quantity != nil && *req.Quantity <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Quantity must be positive")
+	}
+
+	parties, err := loadTransferParties(transferID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Transfer not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	role, _ := c.Locals("role").(string)
+	if role != "admin" && !parties.isCounterparty(c) {
+		return fiber.NewError(fiber.StatusForbidden, "Only the parties to the transfer can set its commercial terms")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	_, err = db.DB.Exec(`
+		INSERT INTO transfer_commercial_terms (transfer_id, po_number, unit_price, currency, incoterms, quantity, updated_by, created_at, updated_at)
+		VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, ''), NULLIF($5, ''), $6, NULLIF($7, 0), NOW(), NOW())
+		ON CONFLICT (transfer_id) DO UPDATE SET
+			po_number = EXCLUDED.po_number, unit_price = EXCLUDED.unit_price, currency = EXCLUDED.currency,
+			incoterms = EXCLUDED.incoterms, quantity = EXCLUDED.quantity, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+	`, transferID, req.PONumber, req.UnitPrice, req.Currency, req.Incoterms, req.Quantity, userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save commercial terms")
+	}
+	terms, err := loadTransferCommercialTerms(transferID)
+	if err != nil || terms == nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Commercial terms saved but failed to retrieve details")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Commercial terms saved successfully",
+		Data:    terms,
+	})
+}
+
+// GetTransferPriceReport reports transfer volumes and prices per species
+// @Summary Get transfer price report
+// @Description Report the number of priced transfers, the quantity and the quantity-weighted average, minimum and maximum unit price per species and currency, for the transfers a company sent or received.
+// @Description With normalize, prices are converted to the base currency of the company at the rate of the transfer date and reported per species
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param direction query string false "sold, bought or both when empty"
+// @Param from query string false "Start time (RFC3339)"
+// @Param to query string false "End time (RFC3339)"
+// @Param normalize query bool false "Convert prices to the base currency of the company"
+// @Success 200 {object} SuccessResponse{data=[]TransferPriceReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/reports/transfer-prices [get]
+func GetTransferPriceReport(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	direction := c.Query("direction")
+	switch direction {
+	case "", "sold", "bought":
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Direction must be sold or bought")
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return err
+	}
+	if err := readsForCompany(c, companyID); err != nil {
+		return err
+	}
+
+	if c.QueryBool("normalize") {
+		return normalizedTransferPriceReport(c, companyID, direction, from, to)
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT COALESCE(b.species, ''), COALESCE(t.currency, ''), COUNT(*),
+			COALESCE(SUM(COALESCE(t.quantity, b.quantity, 0)), 0),
+			SUM(t.unit_price * COALESCE(t.quantity, b.quantity, 0))
+				/ NULLIF(SUM(COALESCE(t.quantity, b.quantity, 0)) FILTER (WHERE t.unit_price IS NOT NULL), 0),
+			MIN(t.unit_price), MAX(t.unit_price)
+		`+transferPriceReportFrom+`
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`, companyID, direction, nullTime(from), nullTime(to))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build transfer price report")
+	}
+	defer rows.Close()
+
+	report := []TransferPriceReport{}
+	for rows.Next() {
+		var r TransferPriceReport
+		var average, min, max sql.NullFloat64
+		if err := rows.Scan(&r.Species, &r.Currency, &r.Transfers, &r.TotalQuantity, &average, &min, &max); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse transfer price report")
+		}
+		r.AverageUnitPrice = floatPtr(average)
+		r.MinUnitPrice = floatPtr(min)
+		r.MaxUnitPrice = floatPtr(max)
+		report = append(report, r)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Transfer price report generated successfully",
+		Data:    report,
+	})
+}
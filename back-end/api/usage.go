@@ -0,0 +1,371 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/usage"
+)
+
+// usageGroupings are the dimensions usage reports can be grouped by, mapped to their SQL expression
+var usageGroupings = map[string]string{
+	"day":     "u.usage_date::text",
+	"company": "u.company_id::text",
+	"api_key": "u.api_key",
+	"route":   "u.method || ' ' || u.route",
+}
+
+// UsageTotals sums the calls of a usage report or of one of its groups
+type UsageTotals struct {
+	Calls         int64   `json:"calls"`
+	Errors        int64   `json:"errors"`
+	ErrorRate     float64 `json:"error_rate"` // Share of calls answered with a 4xx or 5xx status
+	AvgResponseMs float64 `json:"avg_response_ms"`
+}
+
+// UsageGroup is the usage of one day, company, API key or route
+type UsageGroup struct {
+	Key   string `json:"key"`
+	Label string `json:"label,omitempty"` // Company name when grouped by company
+	UsageTotals
+}
+
+// UsageReport is the API usage of a period grouped by one dimension
+type UsageReport struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	GroupBy string       `json:"group_by"`
+	Totals  UsageTotals  `json:"totals"`
+	Groups  []UsageGroup `json:"groups"`
+}
+
+// UsageRecord is one row of the daily usage table, as exported for billing
+type UsageRecord struct {
+	Date          string     `json:"date"`
+	CompanyID     int        `json:"company_id"`
+	APIKey        string     `json:"api_key"`
+	Method        string     `json:"method"`
+	Route         string     `json:"route"`
+	Calls         int64      `json:"calls"`
+	Errors        int64      `json:"errors"`
+	AvgResponseMs float64    `json:"avg_response_ms"`
+	LastCalledAt  *time.Time `json:"last_called_at,omitempty"`
+}
+
+// usageFilter selects the usage rows of a report
+type usageFilter struct {
+	from, to  time.Time
+	companyID int
+	apiKey    string
+}
+
+// parseUsageFilter reads the period (from and to dates, default the last 30 days) and the API key filter
+func parseUsageFilter(c *fiber.Ctx) (usageFilter, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	filter := usageFilter{from: today.AddDate(0, 0, -29), to: today, apiKey: c.Query("api_key")}
+	var err error
+	if v := c.Query("from"); v != "" {
+		if filter.from, err = time.Parse("2006-01-02", v); err != nil {
+			return filter, fiber.NewError(fiber.StatusBadRequest, "Invalid from date, use YYYY-MM-DD")
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if filter.to, err = time.Parse("2006-01-02", v); err != nil {
+			return filter, fiber.NewError(fiber.StatusBadRequest, "Invalid to date, use YYYY-MM-DD")
+		}
+	}
+	if filter.to.Before(filter.from) {
+		return filter, fiber.NewError(fiber.StatusBadRequest, "from must not be after to")
+	}
+	return filter, nil
+}
+
+// usageTotals fills in the derived figures of summed usage
+func usageTotals(calls, errors int64, durationMs float64) UsageTotals {
+	totals := UsageTotals{Calls: calls, Errors: errors}
+	if calls > 0 {
+		totals.ErrorRate = float64(errors) / float64(calls)
+		totals.AvgResponseMs = durationMs / float64(calls)
+	}
+	return totals
+}
+
+// buildUsageReport sums the usage matching the filter grouped by one dimension
+func buildUsageReport(filter usageFilter, groupBy string) (UsageReport, error) {
+	report := UsageReport{
+		From:    filter.from.Format("2006-01-02"),
+		To:      filter.to.Format("2006-01-02"),
+		GroupBy: groupBy,
+		Groups:  []UsageGroup{},
+	}
+
+	// Include the calls counted since the last flush
+	if err := usage.Default().Flush(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT `+usageGroupings[groupBy]+` AS group_key,
+			CASE WHEN $5::text = 'company' THEN COALESCE(MAX(co.name), '') ELSE '' END,
+			SUM(u.call_count), SUM(u.error_count), SUM(u.total_duration_ms)
+		FROM api_usage_daily u
+		LEFT JOIN company co ON co.id = u.company_id
+		WHERE u.usage_date BETWEEN $1 AND $2
+			AND ($3::int = 0 OR u.company_id = $3)
+			AND ($4::text = '' OR u.api_key = $4)
+		GROUP BY group_key
+		ORDER BY group_key
+	`, filter.from, filter.to, filter.companyID, filter.apiKey, groupBy)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	var calls, errors int64
+	var durationMs float64
+	for rows.Next() {
+		var g UsageGroup
+		var groupCalls, groupErrors int64
+		var groupDurationMs float64
+		if err := rows.Scan(&g.Key, &g.Label, &groupCalls, &groupErrors, &groupDurationMs); err != nil {
+			return report, err
+		}
+		g.UsageTotals = usageTotals(groupCalls, groupErrors, groupDurationMs)
+		report.Groups = append(report.Groups, g)
+		calls += groupCalls
+		errors += groupErrors
+		durationMs += groupDurationMs
+	}
+	report.Totals = usageTotals(calls, errors, durationMs)
+	return report, nil
+}
+
+// loadUsageRecords lists the daily usage rows matching the filter
+func loadUsageRecords(filter usageFilter) ([]UsageRecord, error) {
+	if err := usage.Default().Flush(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT usage_date, company_id, api_key, method, route, call_count, error_count, total_duration_ms, last_called_at
+		FROM api_usage_daily
+		WHERE usage_date BETWEEN $1 AND $2
+			AND ($3::int = 0 OR company_id = $3)
+			AND ($4::text = '' OR api_key = $4)
+		ORDER BY usage_date, company_id, api_key, route, method
+	`, filter.from, filter.to, filter.companyID, filter.apiKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []UsageRecord{}
+	for rows.Next() {
+		var r UsageRecord
+		var date time.Time
+		var durationMs float64
+		var lastCalled sql.NullTime
+		if err := rows.Scan(&date, &r.CompanyID, &r.APIKey, &r.Method, &r.Route, &r.Calls, &r.Errors, &durationMs, &lastCalled); err != nil {
+			return nil, err
+		}
+		r.Date = date.Format("2006-01-02")
+		r.AvgResponseMs = usageTotals(r.Calls, r.Errors, durationMs).AvgResponseMs
+		r.LastCalledAt = timePtr(lastCalled)
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// sendUsageExport writes usage rows as JSON or as a CSV attachment
+func sendUsageExport(c *fiber.Ctx, filter usageFilter, filename string) error {
+	format := c.Query("format", "json")
+	if format != "json" && format != "csv" {
+		return fiber.NewError(fiber.StatusBadRequest, "Format must be json or csv")
+	}
+
+	records, err := loadUsageRecords(filter)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve API usage")
+	}
+
+	if format == "csv" {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"date", "company_id", "api_key", "method", "route", "calls", "errors", "avg_response_ms", "last_called_at"})
+		for _, r := range records {
+			lastCalled := ""
+			if r.LastCalledAt != nil {
+				lastCalled = r.LastCalledAt.Format(time.RFC3339)
+			}
+			w.Write([]string{r.Date, strconv.Itoa(r.CompanyID), r.APIKey, r.Method, r.Route,
+				strconv.FormatInt(r.Calls, 10), strconv.FormatInt(r.Errors, 10),
+				strconv.FormatFloat(r.AvgResponseMs, 'f', 2, 64), lastCalled})
+		}
+		w.Flush()
+
+		c.Set("Content-Type", "text/csv")
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s-%s.csv", filename, filter.from.Format("2006-01-02"), filter.to.Format("2006-01-02")))
+		return c.Send(buf.Bytes())
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "API usage exported successfully",
+		Data:    records,
+	})
+}
+
+// GetAdminUsage returns API usage across companies
+// @Summary Get API usage
+// @Description Get API calls, errors and response times across companies for a period, grouped by company, API key, route or day. Usage is metered per company, API key, route and day
+// @Tags admin
+// @Produce json
+// @Param from query string false "First day (YYYY-MM-DD, default 30 days ago)"
+// @Param to query string false "Last day (YYYY-MM-DD, default today)"
+// @Param group_by query string false "company, api_key, route or day (default company)"
+// @Param company_id query int false "Only this company"
+// @Param api_key query string false "Only this API key"
+// @Success 200 {object} SuccessResponse{data=UsageReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/usage [get]
+func GetAdminUsage(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	filter, err := parseUsageFilter(c)
+	if err != nil {
+		return err
+	}
+	filter.companyID = c.QueryInt("company_id", 0)
+	groupBy := c.Query("group_by", "company")
+	if _, ok := usageGroupings[groupBy]; !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "group_by must be company, api_key, route or day")
+	}
+
+	report, err := buildUsageReport(filter, groupBy)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve API usage")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "API usage retrieved successfully",
+		Data:    report,
+	})
+}
+
+// ExportAdminUsage exports daily API usage across companies
+// @Summary Export API usage
+// @Description Export the metered calls per day, company, API key and route for billing or fair-use enforcement
+// @Tags admin
+// @Produce json
+// @Produce text/csv
+// @Param from query string false "First day (YYYY-MM-DD, default 30 days ago)"
+// @Param to query string false "Last day (YYYY-MM-DD, default today)"
+// @Param company_id query int false "Only this company"
+// @Param api_key query string false "Only this API key"
+// @Param format query string false "json or csv (default json)"
+// @Success 200 {object} SuccessResponse{data=[]UsageRecord}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/usage/export [get]
+func ExportAdminUsage(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	filter, err := parseUsageFilter(c)
+	if err != nil {
+		return err
+	}
+	filter.companyID = c.QueryInt("company_id", 0)
+	return sendUsageExport(c, filter, "api-usage")
+}
+
+// GetCompanyUsage returns the API usage of a company
+// @Summary Get company API usage
+// @Description Get the API calls, errors and response times of a company for a period, grouped by day, API key or route
+// @Tags companies
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param from query string false "First day (YYYY-MM-DD, default 30 days ago)"
+// @Param to query string false "Last day (YYYY-MM-DD, default today)"
+// @Param group_by query string false "day, api_key or route (default day)"
+// @Param api_key query string false "Only this API key"
+// @Success 200 {object} SuccessResponse{data=UsageReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/usage [get]
+func GetCompanyUsage(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil || companyID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	filter, err := parseUsageFilter(c)
+	if err != nil {
+		return err
+	}
+	filter.companyID = companyID
+	groupBy := c.Query("group_by", "day")
+	if _, ok := usageGroupings[groupBy]; !ok || groupBy == "company" {
+		return fiber.NewError(fiber.StatusBadRequest, "group_by must be day, api_key or route")
+	}
+
+	report, err := buildUsageReport(filter, groupBy)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve API usage")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "API usage retrieved successfully",
+		Data:    report,
+	})
+}
+
+// ExportCompanyUsage exports the daily API usage of a company
+// @Summary Export company API usage
+// @Description Export the metered calls of a company per day, API key and route
+// @Tags companies
+// @Produce json
+// @Produce text/csv
+// @Param companyId path int true "Company ID"
+// @Param from query string false "First day (YYYY-MM-DD, default 30 days ago)"
+// @Param to query string false "Last day (YYYY-MM-DD, default today)"
+// @Param api_key query string false "Only this API key"
+// @Param format query string false "json or csv (default json)"
+// @Success 200 {object} SuccessResponse{data=[]UsageRecord}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /companies/{companyId}/usage/export [get]
+func ExportCompanyUsage(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil || companyID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	filter, err := parseUsageFilter(c)
+	if err != nil {
+		return err
+	}
+	filter.companyID = companyID
+	return sendUsageExport(c, filter, fmt.Sprintf("company-%d-api-usage", companyID))
+}
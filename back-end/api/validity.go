@@ -0,0 +1,246 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/signing"
+)
+
+// Record types whose validity can be checked
+const (
+	ValidityClaim         = "claim"
+	ValidityCertification = "certification"
+	ValidityDocument      = "document" // the anchored signature of a document
+)
+
+// Validity statuses
+const (
+	ValidityValid   = "valid"
+	ValidityInvalid = "invalid" // exists but does not hold, see the reason
+	ValidityExpired = "expired"
+	ValidityRevoked = "revoked"
+	ValidityUnknown = "unknown" // no such record
+)
+
+// validityTTL is how long a validity response can be cached
+const validityTTL = 5 * time.Minute
+
+// ValidityResponse is the current validity of a claim, certification or document signature
+type ValidityResponse struct {
+	Type       string     `json:"type"`
+	ID         int        `json:"id"`
+	Status     string     `json:"status"` // valid, invalid, expired, revoked or unknown
+	Reason     string     `json:"reason,omitempty"`
+	BatchID    int        `json:"batch_id,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ThisUpdate time.Time  `json:"this_update"` // When the status was checked
+	NextUpdate time.Time  `json:"next_update"` // Until when the status can be relied on without checking again
+}
+
+// GetValidity returns the current validity of a claim, certification or document signature
+// @Summary Check validity
+// @Description Return the current validity or revocation status of a claim, a certification or the anchored signature of a document,
+// @Description without the full record. Responses are cacheable until next_update and signed with a detached JWS in X-TracePost-JWS,
+// @Description verifiable with the payload keys of /.well-known/jwks.json
+// @Tags verification
+// @Produce json
+// @Param type path string true "claim, certification or document"
+// @Param id path string true "Record ID"
+// @Success 200 {object} ValidityResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ValidityResponse "Unknown record"
+// @Failure 500 {object} ErrorResponse
+// @Router /validity/{type}/{id} [get]
+func GetValidity(c *fiber.Ctx) error {
+	recordType := strings.ToLower(c.Params("type"))
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid ID format")
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	v := ValidityResponse{Type: recordType, ID: id, ThisUpdate: now, NextUpdate: now.Add(validityTTL)}
+	switch recordType {
+	case ValidityClaim:
+		err = claimValidity(&v)
+	case ValidityCertification:
+		err = certificationValidity(&v, now)
+	case ValidityDocument:
+		err = documentValidity(&v, now)
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Type must be claim, certification or document")
+	}
+	if err == sql.ErrNoRows {
+		v.Status = ValidityUnknown
+		v.Reason = "No such " + recordType
+	} else if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to check validity")
+	}
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to encode validity")
+	}
+	jws, err := signing.Sign(body)
+	if err != nil {
+		return dependencyUnavailable("Validity responses cannot be signed right now", err)
+	}
+	c.Set(signing.HeaderName, jws)
+	c.Set(fiber.HeaderCacheControl, "public, max-age="+strconv.Itoa(int(validityTTL/time.Second)))
+	c.Set(fiber.HeaderExpires, v.NextUpdate.Format(time.RFC1123))
+	c.Set(fiber.HeaderLastModified, v.ThisUpdate.Format(time.RFC1123))
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if v.Status == ValidityUnknown {
+		c.Status(fiber.StatusNotFound)
+	}
+	return c.Send(body)
+}
+
+// claimValidity checks a claim against its certificate and the trust registry
+func claimValidity(v *ValidityResponse) error {
+	var isActive bool
+	var updatedAt time.Time
+	err := db.DB.QueryRow(`SELECT batch_id, is_active, updated_at FROM batch_claim WHERE id = $1`, v.ID).
+		Scan(&v.BatchID, &isActive, &updatedAt)
+	if err != nil {
+		return err
+	}
+	if !isActive {
+		v.Status = ValidityRevoked
+		v.Reason = "The claim was withdrawn"
+		v.RevokedAt = &updatedAt
+		return nil
+	}
+
+	claims, err := queryBatchClaims(batchClaimEvidenceQuery+`WHERE bc.id = $1`, v.ID)
+	if err != nil {
+		return err
+	}
+	if len(claims) == 0 {
+		return sql.ErrNoRows
+	}
+	if claims[0].Status == ClaimStatusVerified {
+		v.Status = ValidityValid
+	} else {
+		v.Status = ValidityInvalid
+		v.Reason = claims[0].Detail
+	}
+	return nil
+}
+
+// certificationValidity checks a certificate's status, expiry and supporting document
+func certificationValidity(v *ValidityResponse, now time.Time) error {
+	var status string
+	var isActive, documentRevoked bool
+	var expiry sql.NullTime
+	var updatedAt time.Time
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(ct.batch_id, 0), ct.status, ct.is_active, ct.expiry_date, ct.updated_at, COALESCE(d.is_active = false, false)
+		FROM certificates ct
+		LEFT JOIN document d ON d.id = ct.document_id
+		WHERE ct.id = $1
+	`, v.ID).Scan(&v.BatchID, &status, &isActive, &expiry, &updatedAt, &documentRevoked)
+	if err != nil {
+		return err
+	}
+	v.ValidUntil = timePtr(expiry)
+	switch {
+	case !isActive || status == "revoked":
+		v.Status = ValidityRevoked
+		v.Reason = "The certificate was revoked"
+		v.RevokedAt = &updatedAt
+	case documentRevoked:
+		v.Status = ValidityRevoked
+		v.Reason = "The certificate document was revoked"
+	case v.ValidUntil != nil && !v.ValidUntil.After(now):
+		v.Status = ValidityExpired
+		v.Reason = "The certificate expired on " + v.ValidUntil.Format("2006-01-02")
+	case status != "valid":
+		v.Status = ValidityInvalid
+		v.Reason = "The certificate is " + status
+	default:
+		v.Status = ValidityValid
+	}
+	if v.Status == ValidityValid && v.ValidUntil != nil && v.ValidUntil.Before(v.NextUpdate) {
+		// Do not let a cached answer outlive the certificate
+		v.NextUpdate = *v.ValidUntil
+	}
+	return nil
+}
+
+// documentValidity checks that a document is still in force and its signature is anchored on chain
+func documentValidity(v *ValidityResponse, now time.Time) error {
+	var batchID sql.NullInt64
+	var isActive bool
+	var expiry sql.NullTime
+	var updatedAt sql.NullTime
+	err := db.DB.QueryRow(`
+		SELECT batch_id, is_active, expiry_date, updated_at FROM document WHERE id = $1
+	`, v.ID).Scan(&batchID, &isActive, &expiry, &updatedAt)
+	if err != nil {
+		return err
+	}
+	v.BatchID = int(batchID.Int64)
+	v.ValidUntil = timePtr(expiry)
+
+	if !isActive {
+		// Revocations are recorded as blockchain records with the reason as their hash
+		var reason string
+		var revokedAt time.Time
+		err := db.DB.QueryRow(`
+			SELECT metadata_hash, created_at FROM blockchain_record
+			WHERE related_table = 'document' AND related_id = $1 AND metadata_hash LIKE 'revocation:%'
+			ORDER BY created_at DESC LIMIT 1
+		`, v.ID).Scan(&reason, &revokedAt)
+		switch {
+		case err == nil:
+			v.Reason = strings.TrimPrefix(reason, "revocation:")
+			v.RevokedAt = &revokedAt
+		case err == sql.ErrNoRows:
+			v.Reason = "The document was revoked"
+			v.RevokedAt = timePtr(updatedAt)
+		default:
+			return err
+		}
+		v.Status = ValidityRevoked
+		return nil
+	}
+	if v.ValidUntil != nil && !v.ValidUntil.After(now) {
+		v.Status = ValidityExpired
+		v.Reason = "The document expired on " + v.ValidUntil.Format("2006-01-02")
+		return nil
+	}
+
+	var anchors, dropped int
+	err = db.DB.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE confirmation_status = $2)
+		FROM blockchain_record
+		WHERE related_table = 'document' AND related_id = $1 AND COALESCE(metadata_hash, '') NOT LIKE 'revocation:%'
+	`, v.ID, blockchain.ConfirmationDropped).Scan(&anchors, &dropped)
+	if err != nil {
+		return err
+	}
+	switch {
+	case anchors == 0:
+		v.Status = ValidityInvalid
+		v.Reason = "The document signature was never anchored on chain"
+	case dropped == anchors:
+		v.Status = ValidityInvalid
+		v.Reason = "The document signature anchor was dropped from the chain"
+	default:
+		v.Status = ValidityValid
+	}
+	if v.Status == ValidityValid && v.ValidUntil != nil && v.ValidUntil.Before(v.NextUpdate) {
+		v.NextUpdate = *v.ValidUntil
+	}
+	return nil
+}
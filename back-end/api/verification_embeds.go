@@ -0,0 +1,749 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// embedTokenPrefix marks verification embed tokens and the version of their format
+const embedTokenPrefix = "emb1"
+
+// Lifetime of embeds
+const (
+	defaultEmbedLifetime = 365 * 24 * time.Hour
+	maxEmbedLifetime     = 2 * 365 * 24 * time.Hour
+)
+
+// maxEmbedOrigins is the number of sites an embed can be shown on
+const maxEmbedOrigins = 10
+
+// embedMilestones are the event types shown on verification widgets, with their labels
+var embedMilestones = map[string]string{
+	"batch_created":            "Batch created",
+	"inspection_completed":     "Inspection completed",
+	"lab_result_received":      "Lab result received",
+	"batch_transfer_initiated": "Shipped",
+	"transfer_initiated":       "Shipped",
+	"batch_received":           "Received",
+	"receipt_confirmed":        "Receipt confirmed",
+	"ownership_transferred":    "Ownership transferred",
+}
+
+// Anchor validity of a verification payload
+const (
+	EmbedAnchorsValid   = "valid"   // every anchor is confirmed on chain
+	EmbedAnchorsPending = "pending" // some anchors are not confirmed yet
+	EmbedAnchorsInvalid = "invalid" // some anchors were dropped from the chain
+	EmbedAnchorsMissing = "missing" // the batch was never anchored
+)
+
+// VerificationEmbed lets a retailer's site show the verification of a batch
+type VerificationEmbed struct {
+	ID             int        `json:"id"`
+	BatchID        int        `json:"batch_id"`
+	CompanyID      *int       `json:"company_id,omitempty"`
+	Name           string     `json:"name"`
+	AllowedOrigins []string   `json:"allowed_origins"` // Sites the widget can be shown on, e.g. https://shop.example.com
+	Status         string     `json:"status"`          // active, expired or revoked
+	Token          string     `json:"token,omitempty"`
+	URL            string     `json:"url,omitempty"` // Verification payload the widget fetches
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CreatedBy      *int       `json:"created_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastViewedAt   *time.Time `json:"last_viewed_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy      *int       `json:"revoked_by,omitempty"`
+}
+
+// VerificationEmbedRequest represents a request to create a verification embed
+type VerificationEmbedRequest struct {
+	Name           string     `json:"name"`
+	AllowedOrigins []string   `json:"allowed_origins"`
+	ExpiresAt      *time.Time `json:"expires_at"` // At most two years ahead, one year by default
+}
+
+// EmbedMilestone is a key step of a batch shown on a widget
+type EmbedMilestone struct {
+	Type     string    `json:"type"`
+	Label    string    `json:"label"`
+	Date     time.Time `json:"date"`
+	Location string    `json:"location,omitempty"`
+}
+
+// EmbedCertificate is a valid certificate of a batch shown on a widget
+type EmbedCertificate struct {
+	Type       string     `json:"type"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+// EmbedAnchors summarizes the blockchain anchors of a batch
+type EmbedAnchors struct {
+	Validity         string     `json:"validity"` // valid, pending, invalid or missing
+	Total            int        `json:"total"`
+	Confirmed        int        `json:"confirmed"`
+	Pending          int        `json:"pending"`
+	Dropped          int        `json:"dropped"`
+	LatestTxID       string     `json:"latest_tx_id,omitempty"`
+	LatestAnchoredAt *time.Time `json:"latest_anchored_at,omitempty"`
+}
+
+// EmbedVerification is the sanitized verification payload shown by widgets
+type EmbedVerification struct {
+	BatchID      int                `json:"batch_id"`
+	Species      string             `json:"species"`
+	Origin       string             `json:"origin"`
+	Producer     string             `json:"producer"`
+	Status       string             `json:"status"`
+	Recalled     bool               `json:"recalled"`
+	Verified     bool               `json:"verified"` // Anchors are valid and the batch is not recalled
+	Milestones   []EmbedMilestone   `json:"milestones"`
+	Certificates []EmbedCertificate `json:"certificates"`
+	Anchors      EmbedAnchors       `json:"anchors"`
+	CheckedAt    time.Time          `json:"checked_at"`
+}
+
+// EmbedStatDay is the traffic of an embed on one day from one origin
+type EmbedStatDay struct {
+	Day      string `json:"day"`
+	Origin   string `json:"origin"`
+	Views    int    `json:"views"`
+	Rejected int    `json:"rejected"` // Requests refused because the origin is not allowed or the embed is no longer active
+}
+
+// EmbedAnalytics is the traffic of an embed over a period
+type EmbedAnalytics struct {
+	EmbedID  int            `json:"embed_id"`
+	Days     int            `json:"days"`
+	Views    int            `json:"views"`
+	Rejected int            `json:"rejected"`
+	ByOrigin map[string]int `json:"by_origin"`
+	Daily    []EmbedStatDay `json:"daily"`
+}
+
+// embedTokenSecret returns the key embed tokens are signed with
+func embedTokenSecret() ([]byte, error) {
+	if secret := config.GetConfig().EmbedTokenSecret; secret != "" {
+		return []byte(secret), nil
+	}
+	secret, err := config.GetJWTSecret()
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("no embed token secret configured")
+	}
+	return []byte(secret), nil
+}
+
+// signEmbedValue signs a value with the embed token secret
+func signEmbedValue(value string) (string, error) {
+	secret, err := embedTokenSecret()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// embedToken creates the signed token of an embed, scoped to its batch until it expires
+func embedToken(embed VerificationEmbed) (string, error) {
+	value := fmt.Sprintf("%s.%d.%d.%d", embedTokenPrefix, embed.ID, embed.BatchID, embed.ExpiresAt.Unix())
+	signature, err := signEmbedValue(value)
+	if err != nil {
+		return "", err
+	}
+	return value + "." + signature, nil
+}
+
+// parseEmbedToken checks the signature and expiry of an embed token and returns its embed and batch
+func parseEmbedToken(token string) (int, int, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return 0, 0, fmt.Errorf("malformed token")
+	}
+	value, signature := token[:i], token[i+1:]
+	expected, err := signEmbedValue(value)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return 0, 0, fmt.Errorf("invalid signature")
+	}
+	parts := strings.Split(value, ".")
+	if len(parts) != 4 || parts[0] != embedTokenPrefix {
+		return 0, 0, fmt.Errorf("malformed token")
+	}
+	embedID, err1 := strconv.Atoi(parts[1])
+	batchID, err2 := strconv.Atoi(parts[2])
+	expires, err3 := strconv.ParseInt(parts[3], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, 0, fmt.Errorf("malformed token")
+	}
+	if time.Now().Unix() >= expires {
+		return 0, 0, fmt.Errorf("token expired")
+	}
+	return embedID, batchID, nil
+}
+
+// normalizeEmbedOrigin reduces an origin to scheme://host[:port]; sites must use HTTPS, except localhost
+func normalizeEmbedOrigin(origin string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(origin))
+	if err != nil || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return "", fmt.Errorf("%q is not an origin such as https://shop.example.com", origin)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+	if scheme != "https" && !(scheme == "http" && (u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1")) {
+		return "", fmt.Errorf("%q must use https", origin)
+	}
+	return scheme + "://" + host, nil
+}
+
+// embedRequestOrigin returns the origin a widget request comes from: its Origin header, or the origin of its Referer
+func embedRequestOrigin(c *fiber.Ctx) string {
+	if origin := c.Get(fiber.HeaderOrigin); origin != "" && origin != "null" {
+		if normalized, err := normalizeEmbedOrigin(origin); err == nil {
+			return normalized
+		}
+		return ""
+	}
+	if referer := c.Get(fiber.HeaderReferer); referer != "" {
+		if u, err := url.Parse(referer); err == nil && u.Host != "" {
+			if normalized, err := normalizeEmbedOrigin(u.Scheme + "://" + u.Host); err == nil {
+				return normalized
+			}
+		}
+	}
+	return ""
+}
+
+const verificationEmbedColumns = `
+	id, batch_id, company_id, name, allowed_origins, expires_at, created_by, created_at, last_viewed_at, revoked_at, revoked_by
+`
+
+// scanVerificationEmbed reads a row selected with verificationEmbedColumns
+func scanVerificationEmbed(row rowScanner) (VerificationEmbed, error) {
+	var e VerificationEmbed
+	var companyID, createdBy, revokedBy sql.NullInt64
+	var lastViewedAt, revokedAt sql.NullTime
+	err := row.Scan(&e.ID, &e.BatchID, &companyID, &e.Name, pq.Array(&e.AllowedOrigins), &e.ExpiresAt, &createdBy,
+		&e.CreatedAt, &lastViewedAt, &revokedAt, &revokedBy)
+	if err != nil {
+		return e, err
+	}
+	e.CompanyID = intPtr(companyID)
+	e.CreatedBy = intPtr(createdBy)
+	e.RevokedBy = intPtr(revokedBy)
+	e.LastViewedAt = timePtr(lastViewedAt)
+	e.RevokedAt = timePtr(revokedAt)
+	switch {
+	case e.RevokedAt != nil:
+		e.Status = "revoked"
+	case !e.ExpiresAt.After(time.Now()):
+		e.Status = "expired"
+	default:
+		e.Status = "active"
+	}
+	return e, nil
+}
+
+// withEmbedToken sets the token and payload URL of an active embed
+func withEmbedToken(embed VerificationEmbed) (VerificationEmbed, error) {
+	if embed.Status != "active" {
+		return embed, nil
+	}
+	token, err := embedToken(embed)
+	if err != nil {
+		return embed, err
+	}
+	embed.Token = token
+	embed.URL = strings.TrimRight(config.GetConfig().BaseURL, "/") + "/api/v1/embed/verify/" + token
+	return embed, nil
+}
+
+// CreateVerificationEmbed creates a verification widget embed for a batch
+// @Summary Create verification embed
+// @Description Create a signed embed token letting the listed sites show the verification of a batch.
+// @Description The token is scoped to the batch and expires after a year by default
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param batchId path string true "Batch ID"
+// @Param request body VerificationEmbedRequest true "Embed"
+// @Success 201 {object} SuccessResponse{data=VerificationEmbed}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batches/{batchId}/embeds [post]
+func CreateVerificationEmbed(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	companyID, err := batchOwner(c, batchID)
+	if err != nil {
+		return err
+	}
+	var req VerificationEmbedRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "name is required")
+	}
+	if len(req.AllowedOrigins) == 0 || len(req.AllowedOrigins) > maxEmbedOrigins {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("allowed_origins must list between 1 and %d sites", maxEmbedOrigins))
+	}
+	origins := []string{}
+	seen := map[string]bool{}
+	for _, origin := range req.AllowedOrigins {
+		normalized, err := normalizeEmbedOrigin(origin)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			origins = append(origins, normalized)
+		}
+	}
+	expiresAt := time.Now().Add(defaultEmbedLifetime)
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) || req.ExpiresAt.After(time.Now().Add(maxEmbedLifetime)) {
+			return fiber.NewError(fiber.StatusBadRequest, "expires_at must be in the future and at most two years ahead")
+		}
+		expiresAt = *req.ExpiresAt
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	embed, err := scanVerificationEmbed(db.DB.QueryRow(`
+		INSERT INTO verification_embed (batch_id, company_id, name, allowed_origins, expires_at, created_by)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, NULLIF($6, 0))
+		RETURNING `+verificationEmbedColumns,
+		batchID, companyID, req.Name, pq.Array(origins), expiresAt.Truncate(time.Second), userID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create verification embed")
+	}
+	if embed, err = withEmbedToken(embed); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to sign verification embed")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Verification embed created successfully",
+		Data:    embed,
+	})
+}
+
+// ListVerificationEmbeds lists the verification embeds of a batch
+// @Summary List verification embeds
+// @Description List the verification widget embeds of a batch with the tokens of the active ones
+// @Tags batches
+// @Produce json
+// @Param batchId path string true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=[]VerificationEmbed}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batches/{batchId}/embeds [get]
+func ListVerificationEmbeds(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	if _, err := batchOwner(c, batchID); err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT `+verificationEmbedColumns+` FROM verification_embed
+		WHERE batch_id = $1
+		ORDER BY created_at DESC, id DESC
+	`, batchID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load verification embeds")
+	}
+	defer rows.Close()
+	embeds := []VerificationEmbed{}
+	for rows.Next() {
+		embed, err := scanVerificationEmbed(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse verification embed")
+		}
+		if embed, err = withEmbedToken(embed); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to sign verification embed")
+		}
+		embeds = append(embeds, embed)
+	}
+	if err := rows.Err(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load verification embeds")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Verification embeds retrieved successfully",
+		Data:    embeds,
+	})
+}
+
+// loadVerificationEmbed loads an embed of the batch in the path, after checking the caller acts for its owner
+func loadVerificationEmbed(c *fiber.Ctx) (VerificationEmbed, error) {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return VerificationEmbed{}, fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+	embedID, err := strconv.Atoi(c.Params("embedId"))
+	if err != nil {
+		return VerificationEmbed{}, fiber.NewError(fiber.StatusBadRequest, "Invalid embed ID format")
+	}
+	if _, err := batchOwner(c, batchID); err != nil {
+		return VerificationEmbed{}, err
+	}
+	embed, err := scanVerificationEmbed(db.DB.QueryRow(`
+		SELECT `+verificationEmbedColumns+` FROM verification_embed WHERE id = $1 AND batch_id = $2
+	`, embedID, batchID))
+	if err == sql.ErrNoRows {
+		return embed, fiber.NewError(fiber.StatusNotFound, "Verification embed not found")
+	}
+	if err != nil {
+		return embed, fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	return embed, nil
+}
+
+// RevokeVerificationEmbed revokes a verification embed
+// @Summary Revoke verification embed
+// @Description Revoke a verification widget embed; sites showing it get an error from then on
+// @Tags batches
+// @Produce json
+// @Param batchId path string true "Batch ID"
+// @Param embedId path string true "Embed ID"
+// @Success 200 {object} SuccessResponse{data=VerificationEmbed}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batches/{batchId}/embeds/{embedId} [delete]
+func RevokeVerificationEmbed(c *fiber.Ctx) error {
+	embed, err := loadVerificationEmbed(c)
+	if err != nil {
+		return err
+	}
+	if embed.RevokedAt != nil {
+		return fiber.NewError(fiber.StatusConflict, "Verification embed is already revoked")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	embed, err = scanVerificationEmbed(db.DB.QueryRow(`
+		UPDATE verification_embed SET revoked_at = NOW(), revoked_by = NULLIF($2, 0)
+		WHERE id = $1
+		RETURNING `+verificationEmbedColumns,
+		embed.ID, userID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to revoke verification embed")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Verification embed revoked successfully",
+		Data:    embed,
+	})
+}
+
+// GetVerificationEmbedAnalytics returns the traffic of a verification embed
+// @Summary Get verification embed analytics
+// @Description Get the daily views of a verification widget embed per site, with the requests refused
+// @Tags batches
+// @Produce json
+// @Param batchId path string true "Batch ID"
+// @Param embedId path string true "Embed ID"
+// @Param days query int false "Number of days, 30 by default, at most 365"
+// @Success 200 {object} SuccessResponse{data=EmbedAnalytics}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /batches/{batchId}/embeds/{embedId}/analytics [get]
+func GetVerificationEmbedAnalytics(c *fiber.Ctx) error {
+	embed, err := loadVerificationEmbed(c)
+	if err != nil {
+		return err
+	}
+	days := c.QueryInt("days", 30)
+	if days < 1 || days > 365 {
+		return fiber.NewError(fiber.StatusBadRequest, "days must be between 1 and 365")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT day, origin, views, rejected FROM verification_embed_stat
+		WHERE embed_id = $1 AND day > CURRENT_DATE - $2::int
+		ORDER BY day, origin
+	`, embed.ID, days)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load embed analytics")
+	}
+	defer rows.Close()
+	analytics := EmbedAnalytics{EmbedID: embed.ID, Days: days, ByOrigin: map[string]int{}, Daily: []EmbedStatDay{}}
+	for rows.Next() {
+		var stat EmbedStatDay
+		var day time.Time
+		if err := rows.Scan(&day, &stat.Origin, &stat.Views, &stat.Rejected); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse embed analytics")
+		}
+		stat.Day = day.Format("2006-01-02")
+		analytics.Views += stat.Views
+		analytics.Rejected += stat.Rejected
+		analytics.ByOrigin[stat.Origin] += stat.Views
+		analytics.Daily = append(analytics.Daily, stat)
+	}
+	if err := rows.Err(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load embed analytics")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Embed analytics retrieved successfully",
+		Data:    analytics,
+	})
+}
+
+// recordEmbedView counts a view, or a refused request, of an embed
+func recordEmbedView(embedID int, origin string, allowed bool) {
+	if origin == "" {
+		origin = "unknown"
+	}
+	views, rejected := 0, 1
+	if allowed {
+		views, rejected = 1, 0
+	}
+	if _, err := db.DB.Exec(`
+		INSERT INTO verification_embed_stat (embed_id, day, origin, views, rejected)
+		VALUES ($1, CURRENT_DATE, $2, $3, $4)
+		ON CONFLICT (embed_id, day, origin) DO UPDATE SET
+			views = verification_embed_stat.views + EXCLUDED.views,
+			rejected = verification_embed_stat.rejected + EXCLUDED.rejected
+	`, embedID, origin, views, rejected); err != nil {
+		fmt.Printf("Warning: failed to record view of embed %d: %v\n", embedID, err)
+	}
+	if allowed {
+		if _, err := db.DB.Exec(`UPDATE verification_embed SET last_viewed_at = NOW() WHERE id = $1`, embedID); err != nil {
+			fmt.Printf("Warning: failed to record view of embed %d: %v\n", embedID, err)
+		}
+	}
+}
+
+// restrictEmbedCORS replaces the permissive CORS headers of the API with the single origin allowed to read the response
+func restrictEmbedCORS(c *fiber.Ctx, origin string) {
+	header := &c.Response().Header
+	header.Del(fiber.HeaderAccessControlAllowOrigin)
+	header.Del(fiber.HeaderAccessControlAllowCredentials)
+	header.Del(fiber.HeaderAccessControlExposeHeaders)
+	c.Vary(fiber.HeaderOrigin)
+	if origin != "" {
+		c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+	}
+}
+
+// GetEmbedVerification returns the verification payload of a widget
+// @Summary Get embedded verification
+// @Description Return the sanitized verification of the batch an embed token is scoped to: status, key milestones, valid certificates
+// @Description and blockchain anchor validity. Only the sites listed on the embed can read the response; requests from other origins are refused
+// @Tags verification
+// @Produce json
+// @Param token path string true "Embed token"
+// @Success 200 {object} SuccessResponse{data=EmbedVerification}
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /embed/verify/{token} [get]
+func GetEmbedVerification(c *fiber.Ctx) error {
+	restrictEmbedCORS(c, "")
+	embedID, batchID, err := parseEmbedToken(c.Params("token"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired embed token")
+	}
+	embed, err := scanVerificationEmbed(db.DB.QueryRow(`
+		SELECT `+verificationEmbedColumns+` FROM verification_embed WHERE id = $1 AND batch_id = $2
+	`, embedID, batchID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Verification embed not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	origin := embedRequestOrigin(c)
+	allowed := false
+	for _, o := range embed.AllowedOrigins {
+		allowed = allowed || o == origin
+	}
+	if embed.Status != "active" || !allowed {
+		recordEmbedView(embed.ID, origin, false)
+		if embed.Status != "active" {
+			return fiber.NewError(fiber.StatusUnauthorized, "Verification embed is "+embed.Status)
+		}
+		return fiber.NewError(fiber.StatusForbidden, "This site is not allowed to show this verification")
+	}
+	restrictEmbedCORS(c, origin)
+
+	verification, err := loadEmbedVerification(batchID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify batch")
+	}
+	recordEmbedView(embed.ID, origin, true)
+
+	c.Set(fiber.HeaderCacheControl, "private, max-age=60")
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch verification retrieved successfully",
+		Data:    verification,
+	})
+}
+
+// loadEmbedVerification builds the sanitized verification of a batch; it returns sql.ErrNoRows when the batch does not exist
+func loadEmbedVerification(batchID int) (EmbedVerification, error) {
+	v := EmbedVerification{
+		BatchID:      batchID,
+		Milestones:   []EmbedMilestone{},
+		Certificates: []EmbedCertificate{},
+		CheckedAt:    time.Now(),
+	}
+	var createdAt time.Time
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(b.species, ''), COALESCE(b.status, ''), COALESCE(h.name, ''), COALESCE(co.name, ''), b.created_at,
+			EXISTS (SELECT 1 FROM batch_recall r WHERE r.batch_id = b.id AND r.lifted_at IS NULL)
+		FROM batch b
+		LEFT JOIN hatchery h ON h.id = b.hatchery_id
+		LEFT JOIN company co ON co.id = `+batchOwnerCompany+`
+		WHERE b.id = $1 AND b.is_active = true
+	`, batchID).Scan(&v.Species, &v.Status, &v.Origin, &v.Producer, &createdAt, &v.Recalled)
+	if err != nil {
+		return v, err
+	}
+
+	// Milestones: the first event of each public type, with no actors or metadata
+	v.Milestones = append(v.Milestones, EmbedMilestone{Type: "batch_created", Label: embedMilestones["batch_created"], Date: createdAt})
+	types := make([]string, 0, len(embedMilestones))
+	for eventType := range embedMilestones {
+		if eventType != "batch_created" {
+			types = append(types, eventType)
+		}
+	}
+	rows, err := db.DB.Query(`
+		SELECT DISTINCT ON (event_type) event_type, timestamp, COALESCE(location, '')
+		FROM event
+		WHERE batch_id = $1 AND is_active = true AND superseded_by_event_id IS NULL AND event_type = ANY($2)
+		ORDER BY event_type, timestamp, id
+	`, batchID, pq.Array(types))
+	if err != nil {
+		return v, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m EmbedMilestone
+		if err := rows.Scan(&m.Type, &m.Date, &m.Location); err != nil {
+			return v, err
+		}
+		m.Label = embedMilestones[m.Type]
+		v.Milestones = append(v.Milestones, m)
+	}
+	if err := rows.Err(); err != nil {
+		return v, err
+	}
+	sort.SliceStable(v.Milestones, func(i, j int) bool { return v.Milestones[i].Date.Before(v.Milestones[j].Date) })
+
+	certRows, err := db.DB.Query(`
+		SELECT certificate_type, expiry_date FROM certificates
+		WHERE batch_id = $1 AND is_active = true AND status = 'valid' AND (expiry_date IS NULL OR expiry_date > NOW())
+		ORDER BY certificate_type
+	`, batchID)
+	if err != nil {
+		return v, err
+	}
+	defer certRows.Close()
+	for certRows.Next() {
+		var cert EmbedCertificate
+		var expiry sql.NullTime
+		if err := certRows.Scan(&cert.Type, &expiry); err != nil {
+			return v, err
+		}
+		cert.ValidUntil = timePtr(expiry)
+		v.Certificates = append(v.Certificates, cert)
+	}
+	if err := certRows.Err(); err != nil {
+		return v, err
+	}
+
+	if v.Anchors, err = loadEmbedAnchors(batchID); err != nil {
+		return v, err
+	}
+	v.Verified = v.Anchors.Validity == EmbedAnchorsValid && !v.Recalled
+	return v, nil
+}
+
+// loadEmbedAnchors summarizes the confirmation of the blockchain anchors of a batch, its events and documents
+func loadEmbedAnchors(batchID int) (EmbedAnchors, error) {
+	var a EmbedAnchors
+	var latestTxID sql.NullString
+	var latestAt sql.NullTime
+	err := db.DB.QueryRow(`
+		WITH anchors AS (
+			SELECT br.tx_id, br.created_at, COALESCE(br.confirmation_status, $2) AS status
+			FROM blockchain_record br
+			WHERE (br.related_table = 'batch' AND br.related_id = $1)
+				OR (br.related_table = 'event' AND br.related_id IN (SELECT id FROM event WHERE batch_id = $1))
+				OR (br.related_table = 'document' AND br.related_id IN (SELECT id FROM document WHERE batch_id = $1))
+		)
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE status IN ($3, $4)),
+			COUNT(*) FILTER (WHERE status = $2),
+			COUNT(*) FILTER (WHERE status = $5),
+			(SELECT tx_id FROM anchors ORDER BY created_at DESC LIMIT 1),
+			MAX(created_at)
+		FROM anchors
+	`, batchID, blockchain.ConfirmationPending, blockchain.ConfirmationConfirmed, blockchain.ConfirmationFinalized,
+		blockchain.ConfirmationDropped).Scan(&a.Total, &a.Confirmed, &a.Pending, &a.Dropped, &latestTxID, &latestAt)
+	if err != nil {
+		return a, err
+	}
+	a.LatestTxID = latestTxID.String
+	a.LatestAnchoredAt = timePtr(latestAt)
+	switch {
+	case a.Total == 0:
+		a.Validity = EmbedAnchorsMissing
+	case a.Dropped > 0:
+		a.Validity = EmbedAnchorsInvalid
+	case a.Confirmed < a.Total:
+		a.Validity = EmbedAnchorsPending
+	default:
+		a.Validity = EmbedAnchorsValid
+	}
+	return a, nil
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/warehouse"
+)
+
+// WarehouseDataset is an exported dataset with its registered schema versions
+type WarehouseDataset struct {
+	warehouse.Dataset
+	SchemaVersions []warehouse.SchemaVersion `json:"schema_versions"`
+}
+
+// RunWarehouseExportRequest requests the export of a day
+type RunWarehouseExportRequest struct {
+	Date    string `json:"date"`    // YYYY-MM-DD, a day before today (UTC)
+	Dataset string `json:"dataset"` // Empty for every dataset
+}
+
+// parseWarehouseDates reads the from and to query parameters
+func parseWarehouseDates(c *fiber.Ctx) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if raw := c.Query("from"); raw != "" {
+		if from, err = time.Parse("2006-01-02", raw); err != nil {
+			return from, to, fiber.NewError(fiber.StatusBadRequest, "Invalid from date, use YYYY-MM-DD")
+		}
+	}
+	if raw := c.Query("to"); raw != "" {
+		if to, err = time.Parse("2006-01-02", raw); err != nil {
+			return from, to, fiber.NewError(fiber.StatusBadRequest, "Invalid to date, use YYYY-MM-DD")
+		}
+	}
+	return from, to, nil
+}
+
+// ListWarehouseDatasets lists the datasets exported to the warehouse
+// @Summary List warehouse datasets
+// @Description List the datasets exported to Parquet with their current columns and registered schema versions.
+// @Description Columns are only appended within a major version; files of a major version are under {prefix}/{dataset}/v{major}/dt={date}/company_id={id}/
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]WarehouseDataset}
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/warehouse/datasets [get]
+func ListWarehouseDatasets(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+
+	datasets := []WarehouseDataset{}
+	for _, dataset := range warehouse.Datasets {
+		versions, err := warehouse.ListSchemas(dataset.Name)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load schema versions")
+		}
+		datasets = append(datasets, WarehouseDataset{Dataset: dataset, SchemaVersions: versions})
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Warehouse datasets retrieved successfully",
+		Data:    datasets,
+	})
+}
+
+// ListWarehouseExportDays lists exported days
+// @Summary List warehouse export days
+// @Description List the days exported per dataset with their status, file and row counts
+// @Tags admin
+// @Produce json
+// @Param dataset query string false "Dataset"
+// @Param from query string false "First day (YYYY-MM-DD)"
+// @Param to query string false "Last day (YYYY-MM-DD)"
+// @Success 200 {object} SuccessResponse{data=[]warehouse.DayExport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/warehouse/days [get]
+func ListWarehouseExportDays(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	from, to, err := parseWarehouseDates(c)
+	if err != nil {
+		return err
+	}
+
+	days, err := warehouse.ListDays(c.Query("dataset"), from, to, 500)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve export days")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Warehouse export days retrieved successfully",
+		Data:    days,
+	})
+}
+
+// GetWarehouseManifest lists the exported Parquet files
+// @Summary Get warehouse export manifest
+// @Description List the Parquet files exported to S3 with their object keys, row counts, sizes, checksums and schema versions.
+// @Description A partition exported again replaces its file; the replaced entries are listed with include_superseded
+// @Tags admin
+// @Produce json
+// @Param dataset query string false "Dataset"
+// @Param from query string false "First day (YYYY-MM-DD)"
+// @Param to query string false "Last day (YYYY-MM-DD)"
+// @Param company_id query int false "Company ID"
+// @Param include_superseded query bool false "Include replaced files"
+// @Success 200 {object} SuccessResponse{data=[]warehouse.ExportFile}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/warehouse/manifest [get]
+func GetWarehouseManifest(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	from, to, err := parseWarehouseDates(c)
+	if err != nil {
+		return err
+	}
+
+	files, err := warehouse.ListFiles(c.Query("dataset"), from, to, c.QueryInt("company_id", 0), c.QueryBool("include_superseded", false))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve export manifest")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Warehouse export manifest retrieved successfully",
+		Data:    files,
+	})
+}
+
+// RunWarehouseExport exports a day again
+// @Summary Run warehouse export
+// @Description Export one day of one or every dataset in the background, replacing earlier files of the day. Use it to backfill days before the first scheduled export
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body RunWarehouseExportRequest true "Day to export"
+// @Success 202 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/warehouse/exports [post]
+func RunWarehouseExport(c *fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	if role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admin users can perform this action")
+	}
+	userID, _ := c.Locals("userID").(int)
+
+	var req RunWarehouseExportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	day, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid date, use YYYY-MM-DD")
+	}
+	if !day.Before(time.Now().UTC().Truncate(24 * time.Hour)) {
+		return fiber.NewError(fiber.StatusBadRequest, "Only days before today can be exported")
+	}
+
+	datasets := []string{}
+	if req.Dataset != "" {
+		if _, err := warehouse.FindDataset(req.Dataset); err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Dataset not found")
+		}
+		datasets = append(datasets, req.Dataset)
+	} else {
+		for _, dataset := range warehouse.Datasets {
+			datasets = append(datasets, dataset.Name)
+		}
+	}
+
+	service := warehouse.Default()
+	if !service.Storage.Configured() {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Warehouse export bucket is not configured")
+	}
+	go func() {
+		for _, dataset := range datasets {
+			if _, err := service.ExportDay(dataset, day, userID); err != nil && !errors.Is(err, warehouse.ErrExportRunning) {
+				fmt.Printf("Warning: warehouse export of %s for %s failed: %v\n", dataset, req.Date, err)
+			}
+		}
+	}()
+
+	return c.Status(fiber.StatusAccepted).JSON(SuccessResponse{
+		Success: true,
+		Message: "Warehouse export started",
+		Data:    fiber.Map{"date": req.Date, "datasets": datasets},
+	})
+}
@@ -0,0 +1,686 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// Water source types and treatment steps
+var (
+	waterSourceTypes = []string{"well", "sea_intake", "municipal", "surface", "other"}
+	waterStepTypes   = []string{"filtration", "chlorination", "dechlorination", "uv", "ozonation", "other"}
+)
+
+// WaterSourceRequest represents a request to create or update a water source
+type WaterSourceRequest struct {
+	Name       string     `json:"name"`
+	SourceType string     `json:"source_type"` // well, sea_intake, municipal, surface or other
+	Location   string     `json:"location"`
+	Notes      string     `json:"notes"`
+	InUseFrom  *time.Time `json:"in_use_from"` // Defaults to now
+	InUseTo    *time.Time `json:"in_use_to"`   // Empty while the source is in use
+}
+
+// WaterTreatmentRequest represents a request to record or update a treatment step of a water source
+type WaterTreatmentRequest struct {
+	StepType  string     `json:"step_type"` // filtration, chlorination, dechlorination, uv, ozonation or other
+	Sequence  int        `json:"sequence"`  // Defaults to 1
+	Details   string     `json:"details"`
+	BatchID   int        `json:"batch_id"`   // Limits the step to one batch of the hatchery
+	StartedAt *time.Time `json:"started_at"` // Defaults to now
+	EndedAt   *time.Time `json:"ended_at"`   // Empty while the step is applied
+}
+
+// BatchWaterProvenance is the water a batch was raised in: the sources of its hatchery in use while the
+// batch was there, with their treatment steps
+type BatchWaterProvenance struct {
+	BatchID     int                  `json:"batch_id"`
+	HatcheryID  int                  `json:"hatchery_id"`
+	PeriodStart time.Time            `json:"period_start"`
+	PeriodEnd   *time.Time           `json:"period_end,omitempty"` // Empty while the batch is at the hatchery
+	Sources     []models.WaterSource `json:"sources"`
+	Warnings    []string             `json:"warnings"`
+}
+
+const waterSourceColumns = `
+	id, COALESCE(hatchery_id, 0), name, source_type, COALESCE(location, ''), COALESCE(notes, ''),
+	in_use_from, in_use_to, COALESCE(created_by, 0), created_at, updated_at, is_active
+`
+
+const waterTreatmentColumns = `
+	id, source_id, batch_id, step_type, sequence, COALESCE(details, ''), started_at, ended_at,
+	COALESCE(created_by, 0), created_at, updated_at, is_active
+`
+
+// scanWaterSource reads a water source selected with waterSourceColumns
+func scanWaterSource(row rowScanner) (models.WaterSource, error) {
+	var s models.WaterSource
+	var inUseTo sql.NullTime
+	err := row.Scan(&s.ID, &s.HatcheryID, &s.Name, &s.SourceType, &s.Location, &s.Notes,
+		&s.InUseFrom, &inUseTo, &s.CreatedBy, &s.CreatedAt, &s.UpdatedAt, &s.IsActive)
+	if inUseTo.Valid {
+		s.InUseTo = &inUseTo.Time
+	}
+	return s, err
+}
+
+// scanWaterTreatment reads a treatment step selected with waterTreatmentColumns
+func scanWaterTreatment(row rowScanner) (models.WaterTreatment, error) {
+	var t models.WaterTreatment
+	var batchID sql.NullInt64
+	var endedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.SourceID, &batchID, &t.StepType, &t.Sequence, &t.Details, &t.StartedAt, &endedAt,
+		&t.CreatedBy, &t.CreatedAt, &t.UpdatedAt, &t.IsActive)
+	t.BatchID = intPtr(batchID)
+	if endedAt.Valid {
+		t.EndedAt = &endedAt.Time
+	}
+	return t, err
+}
+
+// loadWaterSource loads an active water source
+func loadWaterSource(sourceID int) (models.WaterSource, error) {
+	return scanWaterSource(db.DB.QueryRow(`SELECT `+waterSourceColumns+` FROM water_source WHERE id = $1 AND is_active = true`, sourceID))
+}
+
+// loadWaterSources loads the sources of a hatchery in use during a period, with the treatment steps
+// applied during it; with a batch ID, steps limited to other batches are left out
+func loadWaterSources(hatcheryID int, from, to time.Time, batchID int) ([]models.WaterSource, error) {
+	rows, err := db.DB.Query(`SELECT `+waterSourceColumns+`
+		FROM water_source
+		WHERE hatchery_id = $1 AND is_active = true AND in_use_from <= $3 AND (in_use_to IS NULL OR in_use_to >= $2)
+		ORDER BY in_use_from, id
+	`, hatcheryID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sources := []models.WaterSource{}
+	index := map[int]int{}
+	for rows.Next() {
+		source, err := scanWaterSource(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		source.Treatments = []models.WaterTreatment{}
+		index[source.ID] = len(sources)
+		sources = append(sources, source)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(sources) == 0 {
+		return sources, err
+	}
+
+	rows, err = db.DB.Query(`SELECT `+waterTreatmentColumns+`
+		FROM water_treatment
+		WHERE source_id IN (SELECT id FROM water_source WHERE hatchery_id = $1) AND is_active = true
+			AND started_at <= $3 AND (ended_at IS NULL OR ended_at >= $2)
+			AND ($4 = 0 OR batch_id IS NULL OR batch_id = $4)
+		ORDER BY source_id, sequence, started_at, id
+	`, hatcheryID, from, to, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		treatment, err := scanWaterTreatment(rows)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := index[treatment.SourceID]; ok {
+			sources[i].Treatments = append(sources[i].Treatments, treatment)
+		}
+	}
+	return sources, rows.Err()
+}
+
+// loadBatchWaterProvenance loads the water sources and treatments of a batch, from its creation until
+// it first left the hatchery
+func loadBatchWaterProvenance(batchID int) (BatchWaterProvenance, error) {
+	provenance := BatchWaterProvenance{BatchID: batchID, Warnings: []string{}}
+	var leftAt sql.NullTime
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(b.hatchery_id, 0), b.created_at,
+			(SELECT MIN(transfer_time) FROM shipment_transfer WHERE batch_id = b.id AND is_active = true)
+		FROM batch b
+		WHERE b.id = $1 AND b.is_active = true
+	`, batchID).Scan(&provenance.HatcheryID, &provenance.PeriodStart, &leftAt)
+	if err != nil {
+		return provenance, err
+	}
+	end := time.Now()
+	if leftAt.Valid {
+		provenance.PeriodEnd = &leftAt.Time
+		end = leftAt.Time
+	}
+
+	if provenance.Sources, err = loadWaterSources(provenance.HatcheryID, provenance.PeriodStart, end, batchID); err != nil {
+		return provenance, err
+	}
+	if len(provenance.Sources) == 0 {
+		provenance.Warnings = append(provenance.Warnings, "No water source is recorded for the batch period")
+		return provenance, nil
+	}
+	if first := provenance.Sources[0].InUseFrom; first.After(provenance.PeriodStart) {
+		provenance.Warnings = append(provenance.Warnings,
+			fmt.Sprintf("No water source is recorded before %s", first.Format(time.RFC3339)))
+	}
+	for _, source := range provenance.Sources {
+		if len(source.Treatments) == 0 {
+			provenance.Warnings = append(provenance.Warnings,
+				fmt.Sprintf("No treatment step is recorded for water source %q", source.Name))
+		}
+	}
+	return provenance, nil
+}
+
+// validateWaterSourceRequest checks a water source request and fills in its defaults
+func validateWaterSourceRequest(req *WaterSourceRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Water source name is required")
+	}
+	if !containsString(waterSourceTypes, req.SourceType) {
+		return fiber.NewError(fiber.StatusBadRequest, "Source type must be one of "+strings.Join(waterSourceTypes, ", "))
+	}
+	if req.InUseFrom == nil {
+		now := time.Now()
+		req.InUseFrom = &now
+	}
+	if req.InUseTo != nil && req.InUseTo.Before(*req.InUseFrom) {
+		return fiber.NewError(fiber.StatusBadRequest, "The end of use must not be before its start")
+	}
+	return nil
+}
+
+// validateWaterTreatmentRequest checks a treatment step request against its source and fills in its
+// defaults
+func validateWaterTreatmentRequest(req *WaterTreatmentRequest, source models.WaterSource) error {
+	if !containsString(waterStepTypes, req.StepType) {
+		return fiber.NewError(fiber.StatusBadRequest, "Step type must be one of "+strings.Join(waterStepTypes, ", "))
+	}
+	if req.Sequence == 0 {
+		req.Sequence = 1
+	}
+	if req.Sequence < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Sequence must be positive")
+	}
+	if req.StartedAt == nil {
+		now := time.Now()
+		req.StartedAt = &now
+	}
+	if req.EndedAt != nil && req.EndedAt.Before(*req.StartedAt) {
+		return fiber.NewError(fiber.StatusBadRequest, "The end of the step must not be before its start")
+	}
+	if req.BatchID > 0 {
+		var exists bool
+		err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = $1 AND hatchery_id = $2 AND is_active = true)",
+			req.BatchID, source.HatcheryID).Scan(&exists)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+		if !exists {
+			return fiber.NewError(fiber.StatusBadRequest, "Batch not found in the hatchery of the water source")
+		}
+	}
+	return nil
+}
+
+// CreateWaterSource adds a water source to a hatchery
+// @Summary Create water source
+// @Description Record a water source of a hatchery (well, sea intake, municipal supply...) and the period it is in use
+// @Tags hatcheries
+// @Accept json
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param request body WaterSourceRequest true "Water source details"
+// @Success 201 {object} SuccessResponse{data=models.WaterSource}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/water-sources [post]
+func CreateWaterSource(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+
+	var req WaterSourceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := validateWaterSourceRequest(&req); err != nil {
+		return err
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM hatchery WHERE id = $1 AND is_active = true)", hatcheryID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Hatchery not found")
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	source, err := scanWaterSource(db.DB.QueryRow(`
+		INSERT INTO water_source (hatchery_id, name, source_type, location, notes, in_use_from, in_use_to, created_by,
+			created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), NOW(), NOW(), true)
+		RETURNING `+waterSourceColumns,
+		hatcheryID, req.Name, req.SourceType, req.Location, req.Notes, req.InUseFrom, req.InUseTo, userID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create water source")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Water source created successfully",
+		Data:    source,
+	})
+}
+
+// GetHatcheryWaterSources lists the water sources of a hatchery with their treatment steps
+// @Summary List hatchery water sources
+// @Description List the water sources of a hatchery in use during a period, with their treatment steps. Without a period, every source is listed.
+// @Tags hatcheries
+// @Produce json
+// @Param hatcheryId path int true "Hatchery ID"
+// @Param from query string false "Start of the period (RFC 3339)"
+// @Param to query string false "End of the period (RFC 3339)"
+// @Success 200 {object} SuccessResponse{data=[]models.WaterSource}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /hatcheries/{hatcheryId}/water-sources [get]
+func GetHatcheryWaterSources(c *fiber.Ctx) error {
+	hatcheryID, err := strconv.Atoi(c.Params("hatcheryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid hatchery ID format")
+	}
+	from, to := time.Time{}, time.Now().AddDate(100, 0, 0)
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid from time, use RFC 3339")
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid to time, use RFC 3339")
+		}
+	}
+
+	sources, err := loadWaterSources(hatcheryID, from, to, 0)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve water sources")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Water sources retrieved successfully",
+		Data:    sources,
+	})
+}
+
+// GetWaterSource gets a water source with every treatment step recorded for it
+// @Summary Get water source
+// @Description Get a water source with its treatment steps
+// @Tags water
+// @Produce json
+// @Param sourceId path int true "Water source ID"
+// @Success 200 {object} SuccessResponse{data=models.WaterSource}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /water-sources/{sourceId} [get]
+func GetWaterSource(c *fiber.Ctx) error {
+	sourceID, err := strconv.Atoi(c.Params("sourceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid water source ID format")
+	}
+
+	source, err := loadWaterSource(sourceID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Water source not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	rows, err := db.DB.Query(`SELECT `+waterTreatmentColumns+`
+		FROM water_treatment
+		WHERE source_id = $1 AND is_active = true
+		ORDER BY sequence, started_at, id
+	`, sourceID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+	source.Treatments = []models.WaterTreatment{}
+	for rows.Next() {
+		treatment, err := scanWaterTreatment(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse treatment step")
+		}
+		source.Treatments = append(source.Treatments, treatment)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Water source retrieved successfully",
+		Data:    source,
+	})
+}
+
+// UpdateWaterSource updates a water source, e.g. to record when it stopped being used
+// @Summary Update water source
+// @Description Update a water source and the period it is in use
+// @Tags water
+// @Accept json
+// @Produce json
+// @Param sourceId path int true "Water source ID"
+// @Param request body WaterSourceRequest true "Water source details"
+// @Success 200 {object} SuccessResponse{data=models.WaterSource}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /water-sources/{sourceId} [put]
+func UpdateWaterSource(c *fiber.Ctx) error {
+	sourceID, err := strconv.Atoi(c.Params("sourceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid water source ID format")
+	}
+
+	var req WaterSourceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	current, err := loadWaterSource(sourceID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Water source not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if req.InUseFrom == nil {
+		req.InUseFrom = &current.InUseFrom
+	}
+	if err := validateWaterSourceRequest(&req); err != nil {
+		return err
+	}
+
+	source, err := scanWaterSource(db.DB.QueryRow(`
+		UPDATE water_source
+		SET name = $2, source_type = $3, location = $4, notes = $5, in_use_from = $6, in_use_to = $7, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+waterSourceColumns,
+		sourceID, req.Name, req.SourceType, req.Location, req.Notes, req.InUseFrom, req.InUseTo))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update water source")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Water source updated successfully",
+		Data:    source,
+	})
+}
+
+// DeleteWaterSource soft deletes a water source recorded by mistake
+// @Summary Delete water source
+// @Description Soft delete a water source recorded by mistake; to stop using a source, set its end of use instead
+// @Tags water
+// @Produce json
+// @Param sourceId path int true "Water source ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /water-sources/{sourceId} [delete]
+func DeleteWaterSource(c *fiber.Ctx) error {
+	sourceID, err := strconv.Atoi(c.Params("sourceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid water source ID format")
+	}
+
+	result, err := db.DB.Exec("UPDATE water_source SET is_active = false, updated_at = NOW() WHERE id = $1 AND is_active = true", sourceID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete water source")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Water source not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Water source deleted successfully",
+	})
+}
+
+// CreateWaterTreatment records a treatment step of a water source
+// @Summary Record water treatment step
+// @Description Record a treatment step (filtration, chlorination, UV...) applied to the water of a source during a period, for every batch or for one batch
+// @Tags water
+// @Accept json
+// @Produce json
+// @Param sourceId path int true "Water source ID"
+// @Param request body WaterTreatmentRequest true "Treatment step details"
+// @Success 201 {object} SuccessResponse{data=models.WaterTreatment}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /water-sources/{sourceId}/treatments [post]
+func CreateWaterTreatment(c *fiber.Ctx) error {
+	sourceID, err := strconv.Atoi(c.Params("sourceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid water source ID format")
+	}
+
+	var req WaterTreatmentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	source, err := loadWaterSource(sourceID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Water source not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if err := validateWaterTreatmentRequest(&req, source); err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("userID").(int)
+	treatment, err := scanWaterTreatment(db.DB.QueryRow(`
+		INSERT INTO water_treatment (source_id, batch_id, step_type, sequence, details, started_at, ended_at, created_by,
+			created_at, updated_at, is_active)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7, NULLIF($8, 0), NOW(), NOW(), true)
+		RETURNING `+waterTreatmentColumns,
+		sourceID, req.BatchID, req.StepType, req.Sequence, req.Details, req.StartedAt, req.EndedAt, userID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record treatment step")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Treatment step recorded successfully",
+		Data:    treatment,
+	})
+}
+
+// UpdateWaterTreatment updates a treatment step, e.g. to record when it was stopped
+// @Summary Update water treatment step
+// @Description Update a treatment step of a water source
+// @Tags water
+// @Accept json
+// @Produce json
+// @Param sourceId path int true "Water source ID"
+// @Param treatmentId path int true "Treatment step ID"
+// @Param request body WaterTreatmentRequest true "Treatment step details"
+// @Success 200 {object} SuccessResponse{data=models.WaterTreatment}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /water-sources/{sourceId}/treatments/{treatmentId} [put]
+func UpdateWaterTreatment(c *fiber.Ctx) error {
+	sourceID, err := strconv.Atoi(c.Params("sourceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid water source ID format")
+	}
+	treatmentID, err := strconv.Atoi(c.Params("treatmentId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid treatment step ID format")
+	}
+
+	var req WaterTreatmentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	source, err := loadWaterSource(sourceID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Water source not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	current, err := scanWaterTreatment(db.DB.QueryRow(`SELECT `+waterTreatmentColumns+`
+		FROM water_treatment WHERE id = $1 AND source_id = $2 AND is_active = true`, treatmentID, sourceID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Treatment step not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if req.StartedAt == nil {
+		req.StartedAt = &current.StartedAt
+	}
+	if err := validateWaterTreatmentRequest(&req, source); err != nil {
+		return err
+	}
+
+	treatment, err := scanWaterTreatment(db.DB.QueryRow(`
+		UPDATE water_treatment
+		SET batch_id = NULLIF($2, 0), step_type = $3, sequence = $4, details = $5, started_at = $6, ended_at = $7,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+waterTreatmentColumns,
+		treatmentID, req.BatchID, req.StepType, req.Sequence, req.Details, req.StartedAt, req.EndedAt))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update treatment step")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Treatment step updated successfully",
+		Data:    treatment,
+	})
+}
+
+// DeleteWaterTreatment soft deletes a treatment step recorded by mistake
+// @Summary Delete water treatment step
+// @Description Soft delete a treatment step recorded by mistake
+// @Tags water
+// @Produce json
+// @Param sourceId path int true "Water source ID"
+// @Param treatmentId path int true "Treatment step ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /water-sources/{sourceId}/treatments/{treatmentId} [delete]
+func DeleteWaterTreatment(c *fiber.Ctx) error {
+	sourceID, err := strconv.Atoi(c.Params("sourceId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid water source ID format")
+	}
+	treatmentID, err := strconv.Atoi(c.Params("treatmentId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid treatment step ID format")
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE water_treatment SET is_active = false, updated_at = NOW()
+		WHERE id = $1 AND source_id = $2 AND is_active = true
+	`, treatmentID, sourceID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete treatment step")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Treatment step not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Treatment step deleted successfully",
+	})
+}
+
+// GetBatchWater gets the water provenance of a batch
+// @Summary Get batch water provenance
+// @Description Get the water sources of the hatchery in use while the batch was there, with the treatment steps applied, and warnings about gaps in the records
+// @Tags batches
+// @Produce json
+// @Param batchId path int true "Batch ID"
+// @Success 200 {object} SuccessResponse{data=BatchWaterProvenance}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /batches/{batchId}/water [get]
+func GetBatchWater(c *fiber.Ctx) error {
+	batchID, err := strconv.Atoi(c.Params("batchId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid batch ID format")
+	}
+
+	provenance, err := loadBatchWaterProvenance(batchID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve water provenance")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Batch water provenance retrieved successfully",
+		Data:    provenance,
+	})
+}
+
+// GetAuditWorkspaceWater lists the water sources and treatments in the scope of an audit grant
+// @Summary List audit water records
+// @Description List the water sources of the audited hatchery in use during the audit date range, with the treatment steps applied
+// @Tags audit
+// @Produce json
+// @Param grantId path int true "Audit grant ID"
+// @Success 200 {object} SuccessResponse{data=[]models.WaterSource}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit/workspace/{grantId}/water [get]
+func GetAuditWorkspaceWater(c *fiber.Ctx) error {
+	grant, err := resolveAuditWorkspace(c)
+	if err != nil {
+		return err
+	}
+
+	sources, err := loadWaterSources(grant.HatcheryID, grant.ScopeStart, grant.ScopeEnd, 0)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Audit water records retrieved successfully",
+		Data:    sources,
+	})
+}
@@ -0,0 +1,449 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/verification"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+)
+
+// WebhookSubscriptionRequest represents a request to subscribe an endpoint to company events
+type WebhookSubscriptionRequest struct {
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"` // empty subscribes to every event
+	Description string   `json:"description"`
+}
+
+// WebhookSubscription is an endpoint receiving a company's events
+type WebhookSubscription struct {
+	ID          int       `json:"id"`
+	CompanyID   int       `json:"company_id"`
+	URL         string    `json:"url"`
+	EventTypes  []string  `json:"event_types"`
+	Description string    `json:"description,omitempty"`
+	Secret      string    `json:"secret,omitempty"` // only returned when the subscription is created
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Events are only delivered once ownership of the endpoint is verified
+	VerificationStatus string        `json:"verification_status"`
+	VerificationMethod string        `json:"verification_method,omitempty"`
+	VerificationError  string        `json:"verification_error,omitempty"`
+	VerifiedAt         *time.Time    `json:"verified_at,omitempty"`
+	DNSChallenge       *DNSChallenge `json:"dns_challenge,omitempty"` // TXT record proving ownership of the endpoint host, while not verified
+}
+
+// VerifyWebhookRequest selects how ownership of a webhook endpoint is proven
+type VerifyWebhookRequest struct {
+	Method string `json:"method"` // signed_callback (default), dns_txt or company_domain
+}
+
+const webhookSubscriptionColumns = `
+	id, company_id, url, event_types, COALESCE(description, ''), created_at,
+	COALESCE(verification_status, 'pending'), COALESCE(verification_method, ''), COALESCE(verification_error, ''),
+	verified_at, COALESCE(verification_token, '')`
+
+// scanWebhookSubscription reads a subscription selected with webhookSubscriptionColumns
+func scanWebhookSubscription(row rowScanner) (WebhookSubscription, error) {
+	var s WebhookSubscription
+	var verifiedAt sql.NullTime
+	var token string
+	err := row.Scan(&s.ID, &s.CompanyID, &s.URL, pq.Array(&s.EventTypes), &s.Description, &s.CreatedAt,
+		&s.VerificationStatus, &s.VerificationMethod, &s.VerificationError, &verifiedAt, &token)
+	s.VerifiedAt = timePtr(verifiedAt)
+	if s.VerificationStatus != verification.StatusVerified && token != "" {
+		if endpoint, err := url.Parse(s.URL); err == nil {
+			s.DNSChallenge = newDNSChallenge(endpoint.Hostname(), token)
+		}
+	}
+	return s, err
+}
+
+// WebhookDelivery is one queued or attempted webhook request
+type WebhookDelivery struct {
+	ID             int        `json:"id"`
+	SubscriptionID int        `json:"subscription_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseCode   *int       `json:"response_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// CreateWebhookSubscription subscribes an endpoint to a company's events
+// @Summary Create webhook subscription
+// @Description Subscribe an HTTPS endpoint to a company's events. The signing secret is only returned once.
+// @Description Events are only delivered once ownership of the endpoint is verified, see the verify endpoint; endpoints under a verified company domain are verified on creation
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param request body WebhookSubscriptionRequest true "Subscription details"
+// @Success 201 {object} SuccessResponse{data=WebhookSubscription}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/webhooks [post]
+func CreateWebhookSubscription(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	var req WebhookSubscriptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	endpoint, err := url.Parse(req.URL)
+	if err != nil || (endpoint.Scheme != "https" && endpoint.Scheme != "http") || endpoint.Host == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "url must be an absolute http(s) URL")
+	}
+	if req.EventTypes == nil {
+		req.EventTypes = []string{}
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", companyID).Scan(&exists); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Company not found")
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate webhook secret")
+	}
+
+	token, err := verification.GenerateToken()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate verification token")
+	}
+
+	// Endpoints under a domain the company already verified need no further proof
+	status, method := verification.StatusPending, ""
+	if companyDomainCovers(companyID, endpoint.Hostname()) {
+		status, method = verification.StatusVerified, verification.MethodCompanyDomain
+	}
+
+	subscription, err := scanWebhookSubscription(db.DB.QueryRow(`
+		INSERT INTO webhook_subscription (company_id, url, secret, event_types, description, verification_token,
+			verification_status, verification_method, verified_at, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::text, NULLIF($8, ''), CASE WHEN $7::text = 'verified' THEN NOW() END, NOW(), NOW(), true)
+		RETURNING `+webhookSubscriptionColumns,
+		companyID, req.URL, secret, pq.Array(req.EventTypes), req.Description, token, status, method))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create webhook subscription: "+err.Error())
+	}
+	subscription.Secret = secret
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Message: "Webhook subscription created successfully",
+		Data:    subscription,
+	})
+}
+
+// ListWebhookSubscriptions lists the active webhook subscriptions of a company
+// @Summary List webhook subscriptions
+// @Description List the active webhook subscriptions of a company
+// @Tags webhooks
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Success 200 {object} SuccessResponse{data=[]WebhookSubscription}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/webhooks [get]
+func ListWebhookSubscriptions(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT `+webhookSubscriptionColumns+`
+		FROM webhook_subscription
+		WHERE company_id = $1 AND is_active = true
+		ORDER BY id
+	`, companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	subscriptions := []WebhookSubscription{}
+	for rows.Next() {
+		s, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse webhook subscription")
+		}
+		subscriptions = append(subscriptions, s)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Webhook subscriptions retrieved successfully",
+		Data:    subscriptions,
+	})
+}
+
+// DeleteWebhookSubscription deactivates a webhook subscription
+// @Summary Delete webhook subscription
+// @Description Stop sending events to a webhook endpoint
+// @Tags webhooks
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param webhookId path int true "Webhook subscription ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/webhooks/{webhookId} [delete]
+func DeleteWebhookSubscription(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	webhookID, err := strconv.Atoi(c.Params("webhookId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook ID format")
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE webhook_subscription SET is_active = false, updated_at = NOW()
+		WHERE id = $1 AND company_id = $2 AND is_active = true
+	`, webhookID, companyID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Webhook subscription not found")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Webhook subscription deleted successfully",
+	})
+}
+
+// ListWebhookDeliveries lists the recent deliveries of a webhook subscription
+// @Summary List webhook deliveries
+// @Description List the most recent deliveries of a webhook subscription, optionally filtered by status
+// @Tags webhooks
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param webhookId path int true "Webhook subscription ID"
+// @Param status query string false "Delivery status (pending, delivered, failed)"
+// @Success 200 {object} SuccessResponse{data=[]WebhookDelivery}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/webhooks/{webhookId}/deliveries [get]
+func ListWebhookDeliveries(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	webhookID, err := strconv.Atoi(c.Params("webhookId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook ID format")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT d.id, d.subscription_id, d.event_type, d.status, d.attempts, d.response_code,
+			COALESCE(d.last_error, ''), d.next_attempt_at, d.created_at, d.delivered_at
+		FROM webhook_delivery d
+		JOIN webhook_subscription s ON d.subscription_id = s.id
+		WHERE s.id = $1 AND s.company_id = $2 AND ($3::text = '' OR d.status = $3)
+		ORDER BY d.created_at DESC
+		LIMIT 100
+	`, webhookID, companyID, c.Query("status"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var responseCode sql.NullInt64
+		var nextAttemptAt, deliveredAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventType, &d.Status, &d.Attempts, &responseCode,
+			&d.LastError, &nextAttemptAt, &d.CreatedAt, &deliveredAt); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to parse webhook delivery")
+		}
+		if responseCode.Valid {
+			code := int(responseCode.Int64)
+			d.ResponseCode = &code
+		}
+		if nextAttemptAt.Valid && d.Status == webhooks.StatusPending {
+			d.NextAttemptAt = &nextAttemptAt.Time
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Webhook deliveries retrieved successfully",
+		Data:    deliveries,
+	})
+}
+
+// RedeliverWebhook queues a webhook delivery for another attempt
+// @Summary Redeliver webhook
+// @Description Queue a failed or delivered webhook for another immediate attempt
+// @Tags webhooks
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param deliveryId path int true "Webhook delivery ID"
+// @Success 202 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/webhooks/deliveries/{deliveryId}/redeliver [post]
+func RedeliverWebhook(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	deliveryID, err := strconv.Atoi(c.Params("deliveryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid delivery ID format")
+	}
+
+	var exists bool
+	err = db.DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM webhook_delivery d
+			JOIN webhook_subscription s ON d.subscription_id = s.id
+			WHERE d.id = $1 AND s.company_id = $2 AND s.is_active = true
+		)
+	`, deliveryID, companyID).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Webhook delivery not found")
+	}
+
+	if err := webhooks.Redeliver(deliveryID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to queue redelivery: "+err.Error())
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(SuccessResponse{
+		Success: true,
+		Message: "Webhook delivery queued",
+	})
+}
+
+// VerifyWebhookSubscription proves ownership of a webhook endpoint
+// @Summary Verify webhook endpoint
+// @Description Prove ownership of a webhook endpoint so it starts receiving events. signed_callback posts a signed webhook.verification event
+// @Description whose data.challenge the endpoint must echo as {"challenge": "..."}; dns_txt looks up the TXT record given in dns_challenge;
+// @Description company_domain checks that the endpoint host is under a domain the company verified
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param companyId path int true "Company ID"
+// @Param webhookId path int true "Webhook subscription ID"
+// @Param request body VerifyWebhookRequest false "Verification method"
+// @Success 200 {object} SuccessResponse{data=WebhookSubscription}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /companies/{companyId}/webhooks/{webhookId}/verify [post]
+func VerifyWebhookSubscription(c *fiber.Ctx) error {
+	companyID, err := strconv.Atoi(c.Params("companyId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID format")
+	}
+	webhookID, err := strconv.Atoi(c.Params("webhookId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook ID format")
+	}
+	var req VerifyWebhookRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	if req.Method == "" {
+		req.Method = verification.MethodSignedCallback
+	}
+
+	var endpointURL, secret, token string
+	err = db.DB.QueryRow(`
+		SELECT url, secret, COALESCE(verification_token, '') FROM webhook_subscription
+		WHERE id = $1 AND company_id = $2 AND is_active = true
+	`, webhookID, companyID).Scan(&endpointURL, &secret, &token)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Webhook subscription not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+	}
+	endpoint, err := url.Parse(endpointURL)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Stored webhook URL is invalid")
+	}
+	if token == "" {
+		// Subscriptions created before verification existed get their token on first use
+		if token, err = verification.GenerateToken(); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate verification token")
+		}
+		if _, err := db.DB.Exec("UPDATE webhook_subscription SET verification_token = $2 WHERE id = $1", webhookID, token); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
+		}
+	}
+
+	var verifyErr error
+	switch req.Method {
+	case verification.MethodSignedCallback:
+		verifyErr = webhooks.Default().VerifyCallback(endpointURL, secret, token)
+	case verification.MethodDNSTXT:
+		verifyErr = verification.CheckDNS(endpoint.Hostname(), token)
+	case verification.MethodCompanyDomain:
+		if !companyDomainCovers(companyID, endpoint.Hostname()) {
+			verifyErr = fmt.Errorf("%s is not under a verified domain of the company", endpoint.Hostname())
+		}
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Method must be signed_callback, dns_txt or company_domain")
+	}
+
+	status, lastError := verification.StatusVerified, ""
+	if verifyErr != nil {
+		status, lastError = verification.StatusFailed, verifyErr.Error()
+	}
+	subscription, err := scanWebhookSubscription(db.DB.QueryRow(`
+		UPDATE webhook_subscription
+		SET verification_status = $2::text, verification_method = $3, verification_error = NULLIF($4, ''),
+			verified_at = CASE WHEN $2::text = 'verified' THEN NOW() ELSE NULL END, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+webhookSubscriptionColumns,
+		webhookID, status, req.Method, lastError))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save verification status")
+	}
+	if verifyErr != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "Webhook endpoint verification failed: "+lastError)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Webhook endpoint verified successfully",
+		Data:    subscription,
+	})
+}
@@ -0,0 +1,502 @@
+package approvals
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Action types that can need approval
+const (
+	ActionBatchRecall       = "batch_recall"
+	ActionOwnershipTransfer = "ownership_transfer"
+	ActionTenantExport      = "tenant_export"
+)
+
+// Statuses of an approval request
+const (
+	StatusPending   = "pending"   // waiting for approvers
+	StatusApproved  = "approved"  // quorum reached, waiting for the requester to carry out the action
+	StatusExecuted  = "executed"  // the action was carried out
+	StatusFailed    = "failed"    // quorum reached but the action failed; the error is kept
+	StatusRejected  = "rejected"  // an approver rejected it
+	StatusCancelled = "cancelled" // the requester withdrew it
+	StatusExpired   = "expired"   // quorum was not reached in time
+)
+
+// Who may approve the requests of a policy
+const (
+	ApproverAdmin   = "admin"   // platform admins
+	ApproverCompany = "company" // users of the company the request is made for, and admins
+)
+
+// Decisions of an approver
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+)
+
+var (
+	// ErrNotFound is returned for a request that does not exist
+	ErrNotFound = errors.New("approval request not found")
+	// ErrNotPending is returned when deciding on or cancelling a request that is no longer pending
+	ErrNotPending = errors.New("approval request is no longer pending")
+	// ErrNotApproved is returned when carrying out a request that is not approved, or already carried out
+	ErrNotApproved = errors.New("approval request is not approved or was already used")
+	// ErrSelfApproval is returned when the requester decides on their own request
+	ErrSelfApproval = errors.New("the requester cannot decide on their own request")
+	// ErrNotRequester is returned when someone other than the requester cancels or carries out a request
+	ErrNotRequester = errors.New("only the requester can do this")
+	// ErrAlreadyDecided is returned when an approver decides twice
+	ErrAlreadyDecided = errors.New("you already decided on this request")
+	// ErrUnknownAction is returned for an action type without a registered executor
+	ErrUnknownAction = errors.New("unknown action type")
+	// ErrInvalidPolicy is returned for a policy with out of range settings
+	ErrInvalidPolicy = errors.New("invalid approval policy")
+)
+
+// Executor carries out an approved request. It runs once quorum is reached, as the requester would have,
+// and what it returns is kept as the request's result. A nil executor leaves the request approved for the
+// requester to carry out, e.g. a download
+type Executor func(r Request) (interface{}, error)
+
+// action is a registered action type
+type action struct {
+	description string
+	execute     Executor
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]action{}
+)
+
+// Register adds an action type that can need approval; it is called from init functions
+func Register(actionType, description string, execute Executor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[actionType] = action{description: description, execute: execute}
+}
+
+// lookup finds a registered action type
+func lookup(actionType string) (action, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	a, ok := registry[actionType]
+	return a, ok
+}
+
+// Policy says whether and how an action type needs approval
+type Policy struct {
+	ActionType        string    `json:"action_type"`
+	Description       string    `json:"description"`
+	Enabled           bool      `json:"enabled"`
+	RequiredApprovals int       `json:"required_approvals"` // Approvals needed besides the requester
+	ApproverRole      string    `json:"approver_role"`      // admin or company
+	ExpiryHours       int       `json:"expiry_hours"`
+	UpdatedBy         *int      `json:"updated_by,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Decision is an approver's answer to a request
+type Decision struct {
+	AccountID int       `json:"account_id"`
+	Decision  string    `json:"decision"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Request is an action waiting for, or done after, approval
+type Request struct {
+	ID                int             `json:"id"`
+	ActionType        string          `json:"action_type"`
+	CompanyID         int             `json:"company_id,omitempty"`
+	TargetType        string          `json:"target_type,omitempty"`
+	TargetID          int             `json:"target_id,omitempty"`
+	Summary           string          `json:"summary"`
+	Payload           json.RawMessage `json:"payload" swaggertype:"object"` // The request of the action, as made
+	Status            string          `json:"status"`
+	RequiredApprovals int             `json:"required_approvals"`
+	Approvals         int             `json:"approvals"`
+	ApproverRole      string          `json:"approver_role"`
+	RequestedBy       int             `json:"requested_by,omitempty"`
+	Decisions         []Decision      `json:"decisions"`
+	Result            json.RawMessage `json:"result,omitempty" swaggertype:"object"`
+	Error             string          `json:"error,omitempty"`
+	ExpiresAt         time.Time       `json:"expires_at"`
+	DecidedAt         *time.Time      `json:"decided_at,omitempty"`
+	ExecutedAt        *time.Time      `json:"executed_at,omitempty"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+}
+
+// Filter selects approval requests
+type Filter struct {
+	Status     string
+	ActionType string
+	CompanyID  int
+	Limit      int
+}
+
+// PolicyFor returns the policy of an action type; an action needs approval only when its policy is enabled
+func PolicyFor(actionType string) (Policy, error) {
+	p := Policy{ActionType: actionType}
+	if a, ok := lookup(actionType); ok {
+		p.Description = a.description
+	}
+	var updatedBy sql.NullInt64
+	err := db.DB.QueryRow(`
+		SELECT enabled, required_approvals, approver_role, expiry_hours, updated_by, updated_at
+		FROM approval_policy WHERE action_type = $1
+	`, actionType).Scan(&p.Enabled, &p.RequiredApprovals, &p.ApproverRole, &p.ExpiryHours, &updatedBy, &p.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return p, nil
+	}
+	if updatedBy.Valid {
+		id := int(updatedBy.Int64)
+		p.UpdatedBy = &id
+	}
+	return p, err
+}
+
+// ListPolicies returns the policy of every registered action type
+func ListPolicies() ([]Policy, error) {
+	registryMu.RLock()
+	types := make([]string, 0, len(registry))
+	for actionType := range registry {
+		types = append(types, actionType)
+	}
+	registryMu.RUnlock()
+	sort.Strings(types)
+
+	policies := make([]Policy, 0, len(types))
+	for _, actionType := range types {
+		p, err := PolicyFor(actionType)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// SavePolicy creates or updates the policy of a registered action type
+func SavePolicy(p Policy, userID int) (Policy, error) {
+	if _, ok := lookup(p.ActionType); !ok {
+		return p, ErrUnknownAction
+	}
+	if p.RequiredApprovals < 1 || p.RequiredApprovals > 10 {
+		return p, fmt.Errorf("%w: required approvals must be between 1 and 10", ErrInvalidPolicy)
+	}
+	if p.ApproverRole != ApproverAdmin && p.ApproverRole != ApproverCompany {
+		return p, fmt.Errorf("%w: approver role must be admin or company", ErrInvalidPolicy)
+	}
+	if p.ExpiryHours < 1 || p.ExpiryHours > 24*30 {
+		return p, fmt.Errorf("%w: expiry must be between 1 hour and 30 days", ErrInvalidPolicy)
+	}
+	_, err := db.DB.Exec(`
+		INSERT INTO approval_policy (action_type, enabled, required_approvals, approver_role, expiry_hours, updated_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NOW(), NOW())
+		ON CONFLICT (action_type) DO UPDATE SET
+			enabled = EXCLUDED.enabled, required_approvals = EXCLUDED.required_approvals, approver_role = EXCLUDED.approver_role,
+			expiry_hours = EXCLUDED.expiry_hours, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+	`, p.ActionType, p.Enabled, p.RequiredApprovals, p.ApproverRole, p.ExpiryHours, userID)
+	if err != nil {
+		return p, err
+	}
+	return PolicyFor(p.ActionType)
+}
+
+const requestColumns = `
+	id, action_type, COALESCE(company_id, 0), COALESCE(target_type, ''), COALESCE(target_id, 0), summary, payload, status,
+	required_approvals, approver_role, COALESCE(requested_by, 0), result, COALESCE(error, ''), expires_at, decided_at,
+	executed_at, created_at, updated_at
+`
+
+// rowScanner is a row of requestColumns
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRequest reads a request selected with requestColumns
+func scanRequest(row rowScanner) (Request, error) {
+	var r Request
+	var payload, result []byte
+	var decidedAt, executedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.ActionType, &r.CompanyID, &r.TargetType, &r.TargetID, &r.Summary, &payload, &r.Status,
+		&r.RequiredApprovals, &r.ApproverRole, &r.RequestedBy, &result, &r.Error, &r.ExpiresAt, &decidedAt,
+		&executedAt, &r.CreatedAt, &r.UpdatedAt)
+	r.Payload = payload
+	r.Result = result
+	if decidedAt.Valid {
+		r.DecidedAt = &decidedAt.Time
+	}
+	if executedAt.Valid {
+		r.ExecutedAt = &executedAt.Time
+	}
+	r.Decisions = []Decision{}
+	return r, err
+}
+
+// loadDecisions adds the decisions of a request and counts its approvals
+func loadDecisions(r *Request) error {
+	rows, err := db.DB.Query(`
+		SELECT account_id, decision, COALESCE(comment, ''), created_at
+		FROM approval_decision WHERE request_id = $1 ORDER BY created_at, id
+	`, r.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	r.Decisions = []Decision{}
+	r.Approvals = 0
+	for rows.Next() {
+		var d Decision
+		if err := rows.Scan(&d.AccountID, &d.Decision, &d.Comment, &d.CreatedAt); err != nil {
+			return err
+		}
+		if d.Decision == DecisionApprove {
+			r.Approvals++
+		}
+		r.Decisions = append(r.Decisions, d)
+	}
+	return rows.Err()
+}
+
+// expire marks the pending requests past their expiry as expired
+func expire() error {
+	_, err := db.DB.Exec(`
+		UPDATE approval_request SET status = $1, updated_at = NOW()
+		WHERE status = $2 AND expires_at <= NOW()
+	`, StatusExpired, StatusPending)
+	return err
+}
+
+// Submit creates a pending request for an action under its policy. The payload is the request of the action
+// as made, which the executor carries out once approved
+func Submit(policy Policy, companyID int, targetType string, targetID int, summary string, payload interface{}, requestedBy int) (*Request, error) {
+	if _, ok := lookup(policy.ActionType); !ok {
+		return nil, ErrUnknownAction
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	r, err := scanRequest(db.DB.QueryRow(`
+		INSERT INTO approval_request (action_type, company_id, target_type, target_id, summary, payload, status,
+			required_approvals, approver_role, requested_by, expires_at, created_at, updated_at)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), NULLIF($4, 0), $5, $6, $7, $8, $9, NULLIF($10, 0), NOW() + make_interval(hours => $11), NOW(), NOW())
+		RETURNING `+requestColumns,
+		policy.ActionType, companyID, targetType, targetID, summary, raw, StatusPending,
+		policy.RequiredApprovals, policy.ApproverRole, requestedBy, policy.ExpiryHours))
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Get loads a request with its decisions
+func Get(id int) (*Request, error) {
+	if err := expire(); err != nil {
+		return nil, err
+	}
+	r, err := scanRequest(db.DB.QueryRow(`SELECT `+requestColumns+` FROM approval_request WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := loadDecisions(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// List returns requests, newest first
+func List(f Filter) ([]Request, error) {
+	if err := expire(); err != nil {
+		return nil, err
+	}
+	if f.Limit <= 0 || f.Limit > 200 {
+		f.Limit = 50
+	}
+	rows, err := db.DB.Query(`SELECT `+requestColumns+`
+		FROM approval_request
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR action_type = $2) AND ($3 = 0 OR company_id = $3)
+		ORDER BY created_at DESC, id DESC LIMIT $4
+	`, f.Status, f.ActionType, f.CompanyID, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	requests := []Request{}
+	for rows.Next() {
+		r, err := scanRequest(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range requests {
+		if err := loadDecisions(&requests[i]); err != nil {
+			return nil, err
+		}
+	}
+	return requests, nil
+}
+
+// Decide records an approver's decision. A rejection ends the request; the approval that reaches quorum
+// runs the executor of the action, the request ending executed or failed
+func Decide(id, accountID int, decision, comment string) (*Request, error) {
+	if decision != DecisionApprove && decision != DecisionReject {
+		return nil, fmt.Errorf("decision must be %s or %s", DecisionApprove, DecisionReject)
+	}
+	r, err := Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if r.Status != StatusPending {
+		return nil, ErrNotPending
+	}
+	if r.RequestedBy == accountID {
+		return nil, ErrSelfApproval
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the request so concurrent approvals reach quorum once
+	var status string
+	if err := tx.QueryRow(`SELECT status FROM approval_request WHERE id = $1 FOR UPDATE`, id).Scan(&status); err != nil {
+		return nil, err
+	}
+	if status != StatusPending {
+		return nil, ErrNotPending
+	}
+	result, err := tx.Exec(`
+		INSERT INTO approval_decision (request_id, account_id, decision, comment, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NOW())
+		ON CONFLICT (request_id, account_id) DO NOTHING
+	`, id, accountID, decision, comment)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrAlreadyDecided
+	}
+	var approvals int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM approval_decision WHERE request_id = $1 AND decision = $2`, id, DecisionApprove).Scan(&approvals); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case decision == DecisionReject:
+		status = StatusRejected
+	case approvals >= r.RequiredApprovals:
+		status = StatusApproved
+	}
+	if status != StatusPending {
+		if _, err := tx.Exec(`UPDATE approval_request SET status = $1, decided_at = NOW(), updated_at = NOW() WHERE id = $2`, status, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if status == StatusApproved {
+		if a, ok := lookup(r.ActionType); ok && a.execute != nil {
+			r.Status = status
+			output, execErr := a.execute(*r)
+			if err := finish(id, output, execErr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return Get(id)
+}
+
+// finish records the outcome of carrying out an approved request
+func finish(id int, output interface{}, execErr error) error {
+	if execErr != nil {
+		_, err := db.DB.Exec(`
+			UPDATE approval_request SET status = $1, error = $2, executed_at = NOW(), updated_at = NOW() WHERE id = $3
+		`, StatusFailed, execErr.Error(), id)
+		return err
+	}
+	var result []byte
+	if output != nil {
+		var err error
+		if result, err = json.Marshal(output); err != nil {
+			return err
+		}
+	}
+	_, err := db.DB.Exec(`
+		UPDATE approval_request SET status = $1, result = $2, executed_at = NOW(), updated_at = NOW() WHERE id = $3
+	`, StatusExecuted, result, id)
+	return err
+}
+
+// Consume marks an approved request of an action without executor as carried out by its requester.
+// It fails unless the request is approved, of the action type and made by the account, and succeeds once
+func Consume(id int, actionType string, accountID int, output interface{}) (*Request, error) {
+	r, err := Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if r.ActionType != actionType {
+		return nil, ErrNotFound
+	}
+	if r.RequestedBy != accountID {
+		return nil, ErrNotRequester
+	}
+	raw, err := json.Marshal(output)
+	if err != nil {
+		return nil, err
+	}
+	result, err := db.DB.Exec(`
+		UPDATE approval_request SET status = $1, result = $2, executed_at = NOW(), updated_at = NOW() WHERE id = $3 AND status = $4
+	`, StatusExecuted, raw, id, StatusApproved)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrNotApproved
+	}
+	return Get(id)
+}
+
+// Cancel withdraws a pending request; only the requester can
+func Cancel(id, accountID int) (*Request, error) {
+	r, err := Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if r.RequestedBy != accountID {
+		return nil, ErrNotRequester
+	}
+	result, err := db.DB.Exec(`
+		UPDATE approval_request SET status = $1, decided_at = NOW(), updated_at = NOW() WHERE id = $2 AND status = $3
+	`, StatusCancelled, id, StatusPending)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrNotPending
+	}
+	return Get(id)
+}
@@ -0,0 +1,594 @@
+package attestation
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/completeness"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/signing"
+)
+
+// Statuses of an attestation
+const (
+	StatusSigned   = "signed"   // signed by the platform, the on-chain anchor is pending or failed and will be retried
+	StatusAnchored = "anchored" // record hash recorded on-chain
+)
+
+// TxTypeTraceabilityAttestation is the transaction type of an attestation anchor
+const TxTypeTraceabilityAttestation = "TRACEABILITY_ATTESTATION"
+
+// Platform names the issuer in attestation records
+const Platform = "TracePost-larvaeChain"
+
+// Criteria of the standard
+const (
+	CriterionBatchFinished   = "batch_finished"
+	CriterionLifecycleEvents = "lifecycle_events"
+	CriterionAnchorsVerified = "anchors_verified"
+	CriterionDocumentsSigned = "documents_signed"
+)
+
+var (
+	// ErrNotFound is returned for a batch or attestation that does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrIncomplete is returned when a batch does not meet the standard
+	ErrIncomplete = errors.New("batch does not meet the traceability standard")
+)
+
+// Criterion is a requirement of the standard
+type Criterion struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+}
+
+// Standard is the published completeness standard batches are certified against. A batch is only attested
+// when it meets every criterion; the owner's completeness profile can require more documents, never fewer
+type Standard struct {
+	ID                string               `json:"id"`
+	Title             string               `json:"title"`
+	PublishedAt       string               `json:"published_at"`
+	FinishedStatuses  []string             `json:"finished_statuses"`
+	Stages            []completeness.Stage `json:"stages"`
+	RequiredDocuments []string             `json:"required_documents"`
+	Criteria          []Criterion          `json:"criteria"`
+}
+
+// Current is the standard attestations are issued against
+var Current = Standard{
+	ID:                "traceability-complete-v1",
+	Title:             "TracePost traceability complete",
+	PublishedAt:       "2026-10-15",
+	FinishedStatuses:  []string{"completed", "harvested", "sold", "delivered"},
+	Stages:            completeness.DefaultProfile(0).Stages,
+	RequiredDocuments: []string{"health_certificate"},
+	Criteria: []Criterion{
+		{Key: CriterionBatchFinished, Description: "The batch is in one of the finished statuses"},
+		{Key: CriterionLifecycleEvents, Description: "Every lifecycle stage has at least one current event"},
+		{Key: CriterionAnchorsVerified, Description: "The batch and each of its current events are anchored on-chain in a confirmed or finalized transaction"},
+		{Key: CriterionDocumentsSigned, Description: "Each required document is present and signed: an anchored document in a confirmed or finalized transaction, or a valid certificate from an accredited lab"},
+	},
+}
+
+// Check is the outcome of one criterion for a batch
+type Check struct {
+	Criterion string   `json:"criterion"`
+	Passed    bool     `json:"passed"`
+	Detail    string   `json:"detail"`
+	Missing   []string `json:"missing,omitempty"` // Stages, document types or records that fail the criterion
+}
+
+// Evaluation is how a batch measures against the standard
+type Evaluation struct {
+	BatchID     int       `json:"batch_id"`
+	CompanyID   int       `json:"company_id,omitempty"`
+	Standard    string    `json:"standard"`
+	Complete    bool      `json:"complete"`
+	Checks      []Check   `json:"checks"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+}
+
+// Record is what an attestation certifies; it is serialized once, hashed and signed, and kept verbatim
+type Record struct {
+	Attestation   string    `json:"attestation"` // Always traceability_complete
+	Standard      string    `json:"standard"`
+	BatchID       int       `json:"batch_id"`
+	BatchGlobalID string    `json:"batch_global_id,omitempty"`
+	Species       string    `json:"species,omitempty"`
+	BatchStatus   string    `json:"batch_status"`
+	CompanyID     int       `json:"company_id,omitempty"`
+	CompanyName   string    `json:"company_name,omitempty"`
+	Checks        []Check   `json:"checks"`
+	Anchors       int       `json:"anchors"`   // Verified anchors of the batch and its events
+	Documents     []string  `json:"documents"` // Signed document types
+	IssuedAt      time.Time `json:"issued_at"`
+	Platform      string    `json:"platform"`
+}
+
+// Attestation is a platform-signed, anchored statement that a batch met the standard
+type Attestation struct {
+	ID          int             `json:"id"`
+	BatchID     int             `json:"batch_id"`
+	CompanyID   int             `json:"company_id,omitempty"`
+	Standard    string          `json:"standard"`
+	Record      json.RawMessage `json:"record"`      // The exact bytes hashed and signed
+	RecordHash  string          `json:"record_hash"` // Hex SHA-256 of the record
+	Signature   string          `json:"signature"`   // Detached JWS of the record, verifiable against the platform JWKS
+	Status      string          `json:"status"`
+	AnchorTxID  string          `json:"anchor_tx_id,omitempty"`
+	AnchorError string          `json:"anchor_error,omitempty"`
+	AnchoredAt  *time.Time      `json:"anchored_at,omitempty"`
+	RequestedBy int             `json:"requested_by,omitempty"`
+	IssuedAt    time.Time       `json:"issued_at"`
+}
+
+// facts is what a batch has recorded, as evaluated against the standard
+type facts struct {
+	companyID         int
+	globalID          string
+	species           string
+	status            string
+	eventTypes        map[string]bool
+	requiredDocuments []string
+	presentDocuments  map[string]bool // Document types present, signed or not
+	signedDocuments   map[string]bool
+	anchors           int
+	unanchored        []string // Records without a verified anchor, e.g. event 12
+}
+
+// Evaluate measures a batch against the current standard; it returns ErrNotFound for a batch that does not exist
+func Evaluate(batchID int) (*Evaluation, error) {
+	f, err := load(batchID)
+	if err != nil {
+		return nil, err
+	}
+	evaluation := evaluate(Current, batchID, f, time.Now().UTC())
+	return &evaluation, nil
+}
+
+// load collects the facts of a batch
+func load(batchID int) (*facts, error) {
+	f := &facts{eventTypes: map[string]bool{}, presentDocuments: map[string]bool{}, signedDocuments: map[string]bool{}}
+	var companyID sql.NullInt64
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(b.owner_company_id, h.company_id), COALESCE(b.global_id, ''), COALESCE(b.species, ''), LOWER(COALESCE(b.status, ''))
+		FROM batch b
+		LEFT JOIN hatchery h ON h.id = b.hatchery_id
+		WHERE b.id = $1 AND b.is_active = true
+	`, batchID).Scan(&companyID, &f.globalID, &f.species, &f.status)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.companyID = int(companyID.Int64)
+
+	profile, err := completeness.LoadProfile(f.companyID)
+	if err != nil {
+		return nil, err
+	}
+	f.requiredDocuments = requiredDocuments(Current, profile)
+
+	// Event types, corrected events counting once in their latest version
+	rows, err := db.DB.Query(`
+		SELECT DISTINCT LOWER(event_type) FROM event
+		WHERE batch_id = $1 AND is_active = true AND superseded_by_event_id IS NULL AND event_type IS NOT NULL
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	for _, eventType := range scanStrings(rows) {
+		f.eventTypes[eventType] = true
+	}
+
+	// The batch and its current events, each with a verified anchor or not
+	rows, err = db.DB.Query(`
+		SELECT r.kind, r.id, EXISTS(
+			SELECT 1 FROM blockchain_record br
+			WHERE br.related_table = r.kind AND br.related_id = r.id AND br.is_active = true
+				AND COALESCE(br.tx_id, '') <> '' AND br.confirmation_status = ANY($2)
+		)
+		FROM (
+			SELECT 'batch' AS kind, id FROM batch WHERE id = $1
+			UNION ALL
+			SELECT 'event', id FROM event WHERE batch_id = $1 AND is_active = true AND superseded_by_event_id IS NULL
+		) r
+		ORDER BY r.kind, r.id
+	`, batchID, pq.Array(verifiedStatuses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind string
+		var id int
+		var verified bool
+		if err := rows.Scan(&kind, &id, &verified); err != nil {
+			return nil, err
+		}
+		if verified {
+			f.anchors++
+		} else {
+			f.unanchored = append(f.unanchored, fmt.Sprintf("%s %d", kind, id))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Valid documents, signed when anchored, and certificates, signed when issued by an accredited lab
+	docRows, err := db.DB.Query(`
+		SELECT LOWER(d.doc_type), EXISTS(
+			SELECT 1 FROM blockchain_record br
+			WHERE br.related_table = 'document' AND br.related_id = d.id AND br.is_active = true
+				AND COALESCE(br.tx_id, '') <> '' AND br.confirmation_status = ANY($2)
+		)
+		FROM document d
+		WHERE d.batch_id = $1 AND d.is_active = true AND d.doc_type IS NOT NULL AND COALESCE(d.ipfs_hash, '') <> ''
+			AND (d.expiry_date IS NULL OR d.expiry_date > NOW())
+		UNION ALL
+		SELECT LOWER(certificate_type), accredited_lab_id IS NOT NULL
+		FROM certificates
+		WHERE batch_id = $1 AND is_active = true AND status = 'valid' AND (expiry_date IS NULL OR expiry_date > NOW())
+	`, batchID, pq.Array(verifiedStatuses))
+	if err != nil {
+		return nil, err
+	}
+	defer docRows.Close()
+	for docRows.Next() {
+		var docType string
+		var signed bool
+		if err := docRows.Scan(&docType, &signed); err != nil {
+			return nil, err
+		}
+		f.presentDocuments[docType] = true
+		if signed {
+			f.signedDocuments[docType] = true
+		}
+	}
+	return f, docRows.Err()
+}
+
+// verifiedStatuses are the confirmation statuses of an anchor trusted by the standard
+var verifiedStatuses = []string{blockchain.ConfirmationConfirmed, blockchain.ConfirmationFinalized}
+
+// requiredDocuments merges the documents the standard and a completeness profile require
+func requiredDocuments(std Standard, profile completeness.Profile) []string {
+	seen := map[string]bool{}
+	required := []string{}
+	for _, docType := range append(append([]string{}, std.RequiredDocuments...), profile.RequiredDocuments...) {
+		docType = strings.ToLower(strings.TrimSpace(docType))
+		if docType != "" && !seen[docType] {
+			seen[docType] = true
+			required = append(required, docType)
+		}
+	}
+	sort.Strings(required)
+	return required
+}
+
+// evaluate checks the facts of a batch against every criterion of a standard
+func evaluate(std Standard, batchID int, f *facts, at time.Time) Evaluation {
+	e := Evaluation{BatchID: batchID, CompanyID: f.companyID, Standard: std.ID, EvaluatedAt: at}
+
+	finished := Check{Criterion: CriterionBatchFinished, Detail: fmt.Sprintf("Batch status is %q", f.status)}
+	for _, status := range std.FinishedStatuses {
+		finished.Passed = finished.Passed || f.status == status
+	}
+	if !finished.Passed {
+		finished.Detail += ", expected one of " + strings.Join(std.FinishedStatuses, ", ")
+	}
+
+	events := Check{Criterion: CriterionLifecycleEvents}
+	for _, stage := range std.Stages {
+		covered := false
+		for _, eventType := range stage.EventTypes {
+			covered = covered || f.eventTypes[eventType]
+		}
+		if !covered {
+			events.Missing = append(events.Missing, stage.Name)
+		}
+	}
+	events.Passed = len(events.Missing) == 0
+	events.Detail = fmt.Sprintf("%d of %d lifecycle stages have an event", len(std.Stages)-len(events.Missing), len(std.Stages))
+
+	anchors := Check{Criterion: CriterionAnchorsVerified, Missing: f.unanchored}
+	anchors.Passed = len(f.unanchored) == 0 && f.anchors > 0
+	anchors.Detail = fmt.Sprintf("%d of %d records have a verified anchor", f.anchors, f.anchors+len(f.unanchored))
+
+	documents := Check{Criterion: CriterionDocumentsSigned}
+	unsigned := 0
+	for _, docType := range f.requiredDocuments {
+		if f.signedDocuments[docType] {
+			continue
+		}
+		if f.presentDocuments[docType] {
+			unsigned++
+			documents.Missing = append(documents.Missing, docType+" (unsigned)")
+		} else {
+			documents.Missing = append(documents.Missing, docType)
+		}
+	}
+	documents.Passed = len(documents.Missing) == 0
+	documents.Detail = fmt.Sprintf("%d of %d required documents are signed", len(f.requiredDocuments)-len(documents.Missing), len(f.requiredDocuments))
+	if unsigned > 0 {
+		documents.Detail += fmt.Sprintf(", %d present but unsigned", unsigned)
+	}
+
+	e.Checks = []Check{finished, events, anchors, documents}
+	e.Complete = true
+	for _, check := range e.Checks {
+		e.Complete = e.Complete && check.Passed
+	}
+	return e
+}
+
+// Service issues attestations and retries their anchors on a schedule
+type Service struct {
+	Config    *config.Config
+	Interval  time.Duration
+	BatchSize int
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates an attestation service from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		Config:    cfg,
+		Interval:  time.Duration(cfg.TraceabilityAttestationIntervalSeconds) * time.Second,
+		BatchSize: 100,
+	}
+}
+
+// Default returns the process wide attestation service
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Start retries failed anchors in the background; a zero interval disables the schedule
+func (s *Service) Start() {
+	if s.Interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(s.Interval)
+
+			if err := s.RunOnce(); err != nil {
+				fmt.Printf("Warning: traceability attestation run failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// RunOnce retries the anchors of attestations that are signed but not anchored
+func (s *Service) RunOnce() error {
+	if db.DB == nil {
+		return nil
+	}
+	rows, err := db.DB.Query(`
+		SELECT id FROM traceability_attestation WHERE status = $1 ORDER BY issued_at LIMIT $2
+	`, StatusSigned, s.BatchSize)
+	if err != nil {
+		return err
+	}
+	for _, id := range scanIDs(rows) {
+		if _, err := s.Anchor(id); err != nil {
+			fmt.Printf("Warning: failed to anchor traceability attestation %d: %v\n", id, err)
+		}
+	}
+	return nil
+}
+
+// Issue evaluates a batch and, when it meets the standard, signs an attestation and anchors it on-chain.
+// The evaluation is returned with ErrIncomplete when the batch falls short
+func (s *Service) Issue(batchID, userID int) (*Attestation, *Evaluation, error) {
+	f, err := load(batchID)
+	if err != nil {
+		return nil, nil, err
+	}
+	issuedAt := time.Now().UTC()
+	evaluation := evaluate(Current, batchID, f, issuedAt)
+	if !evaluation.Complete {
+		return nil, &evaluation, ErrIncomplete
+	}
+
+	record := Record{
+		Attestation:   "traceability_complete",
+		Standard:      Current.ID,
+		BatchID:       batchID,
+		BatchGlobalID: f.globalID,
+		Species:       f.species,
+		BatchStatus:   f.status,
+		CompanyID:     f.companyID,
+		Checks:        evaluation.Checks,
+		Anchors:       f.anchors,
+		Documents:     f.requiredDocuments,
+		IssuedAt:      issuedAt,
+		Platform:      Platform,
+	}
+	if f.companyID > 0 {
+		if err := db.DB.QueryRow("SELECT COALESCE(name, '') FROM company WHERE id = $1", f.companyID).Scan(&record.CompanyName); err != nil && err != sql.ErrNoRows {
+			return nil, nil, err
+		}
+	}
+
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(raw)
+	recordHash := hex.EncodeToString(sum[:])
+	signature, err := signing.Sign(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign attestation: %w", err)
+	}
+
+	var attestationID int
+	err = db.DB.QueryRow(`
+		INSERT INTO traceability_attestation (batch_id, company_id, standard, record, record_hash, signature, status, requested_by, issued_at)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7, NULLIF($8, 0), $9)
+		RETURNING id
+	`, batchID, f.companyID, Current.ID, string(raw), recordHash, signature, StatusSigned, userID, issuedAt).Scan(&attestationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The record is signed without its anchor; a failed anchor is retried on the next run
+	attestation, err := s.Anchor(attestationID)
+	if err != nil {
+		fmt.Printf("Warning: failed to anchor traceability attestation %d: %v\n", attestationID, err)
+		attestation, err = Get(attestationID)
+	}
+	return attestation, &evaluation, err
+}
+
+// Anchor records the hash of an attestation on-chain
+func (s *Service) Anchor(attestationID int) (*Attestation, error) {
+	attestation, err := Get(attestationID)
+	if err != nil {
+		return nil, err
+	}
+	if attestation.Status == StatusAnchored {
+		return attestation, nil
+	}
+
+	payload := map[string]interface{}{
+		"attestation_id": attestation.ID,
+		"batch_id":       attestation.BatchID,
+		"standard":       attestation.Standard,
+		"record_hash":    attestation.RecordHash,
+		"issued_at":      attestation.IssuedAt.UTC().Format(time.RFC3339),
+	}
+	client := blockchain.NewBlockchainClient(
+		s.Config.BlockchainNodeURL,
+		s.Config.BlockchainPrivateKey,
+		s.Config.BlockchainAccount,
+		s.Config.BlockchainChainID,
+		s.Config.BlockchainConsensus,
+	)
+	txID, err := client.SubmitGenericTransaction(TxTypeTraceabilityAttestation, payload)
+	if err != nil {
+		if _, dbErr := db.DB.Exec("UPDATE traceability_attestation SET anchor_error = $2 WHERE id = $1", attestationID, err.Error()); dbErr != nil {
+			return nil, dbErr
+		}
+		return nil, err
+	}
+
+	_, err = db.DB.Exec(`
+		UPDATE traceability_attestation SET status = $2, anchor_tx_id = $3, anchor_error = NULL, anchored_at = NOW()
+		WHERE id = $1
+	`, attestationID, StatusAnchored, txID)
+	if err != nil {
+		return nil, err
+	}
+	return Get(attestationID)
+}
+
+const attestationColumns = `
+	id, batch_id, COALESCE(company_id, 0), standard, record, record_hash, signature, status, COALESCE(anchor_tx_id, ''),
+	COALESCE(anchor_error, ''), anchored_at, COALESCE(requested_by, 0), issued_at
+`
+
+// scanAttestation reads an attestation selected with attestationColumns
+func scanAttestation(row interface{ Scan(...interface{}) error }) (*Attestation, error) {
+	var a Attestation
+	var record string
+	var anchoredAt sql.NullTime
+	err := row.Scan(&a.ID, &a.BatchID, &a.CompanyID, &a.Standard, &record, &a.RecordHash, &a.Signature, &a.Status,
+		&a.AnchorTxID, &a.AnchorError, &anchoredAt, &a.RequestedBy, &a.IssuedAt)
+	if err != nil {
+		return nil, err
+	}
+	a.Record = []byte(record)
+	if anchoredAt.Valid {
+		a.AnchoredAt = &anchoredAt.Time
+	}
+	return &a, nil
+}
+
+// Get returns an attestation
+func Get(id int) (*Attestation, error) {
+	a, err := scanAttestation(db.DB.QueryRow(`SELECT `+attestationColumns+` FROM traceability_attestation WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return a, err
+}
+
+// Latest returns the newest attestation of a batch
+func Latest(batchID int) (*Attestation, error) {
+	a, err := scanAttestation(db.DB.QueryRow(`SELECT `+attestationColumns+`
+		FROM traceability_attestation WHERE batch_id = $1 ORDER BY issued_at DESC, id DESC LIMIT 1
+	`, batchID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return a, err
+}
+
+// List returns the attestations of a batch, newest first
+func List(batchID int) ([]Attestation, error) {
+	rows, err := db.DB.Query(`SELECT `+attestationColumns+`
+		FROM traceability_attestation WHERE batch_id = $1 ORDER BY issued_at DESC, id DESC
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attestations := []Attestation{}
+	for rows.Next() {
+		a, err := scanAttestation(rows)
+		if err != nil {
+			return nil, err
+		}
+		attestations = append(attestations, *a)
+	}
+	return attestations, rows.Err()
+}
+
+// scanIDs reads a column of IDs and closes the rows
+func scanIDs(rows *sql.Rows) []int {
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// scanStrings reads a column of strings and closes the rows
+func scanStrings(rows *sql.Rows) []string {
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err == nil {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,76 @@
+package attestation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/completeness"
+)
+
+func completeFacts() *facts {
+	return &facts{
+		companyID:         7,
+		status:            "harvested",
+		eventTypes:        map[string]bool{"batch_created": true, "inspection_completed": true, "batch_received": true},
+		requiredDocuments: []string{"health_certificate"},
+		presentDocuments:  map[string]bool{"health_certificate": true},
+		signedDocuments:   map[string]bool{"health_certificate": true},
+		anchors:           4,
+	}
+}
+
+func TestEvaluateComplete(t *testing.T) {
+	e := evaluate(Current, 1, completeFacts(), time.Now())
+	if !e.Complete {
+		t.Fatalf("expected a complete batch, got %+v", e.Checks)
+	}
+	if len(e.Checks) != len(Current.Criteria) {
+		t.Fatalf("expected a check per criterion, got %d", len(e.Checks))
+	}
+}
+
+func TestEvaluateIncomplete(t *testing.T) {
+	f := completeFacts()
+	f.status = "active"
+	delete(f.eventTypes, "inspection_completed")
+	f.unanchored = []string{"event 12"}
+	delete(f.signedDocuments, "health_certificate")
+
+	e := evaluate(Current, 1, f, time.Now())
+	if e.Complete {
+		t.Fatal("expected an incomplete batch")
+	}
+	missing := map[string][]string{}
+	for _, check := range e.Checks {
+		if check.Passed {
+			t.Errorf("expected %s to fail", check.Criterion)
+		}
+		missing[check.Criterion] = check.Missing
+	}
+	if !reflect.DeepEqual(missing[CriterionLifecycleEvents], []string{"quality"}) {
+		t.Errorf("unexpected missing stages %v", missing[CriterionLifecycleEvents])
+	}
+	if !reflect.DeepEqual(missing[CriterionAnchorsVerified], []string{"event 12"}) {
+		t.Errorf("unexpected unanchored records %v", missing[CriterionAnchorsVerified])
+	}
+	if !reflect.DeepEqual(missing[CriterionDocumentsSigned], []string{"health_certificate (unsigned)"}) {
+		t.Errorf("unexpected missing documents %v", missing[CriterionDocumentsSigned])
+	}
+}
+
+func TestEvaluateRequiresAnchors(t *testing.T) {
+	f := completeFacts()
+	f.anchors = 0
+	if evaluate(Current, 1, f, time.Now()).Complete {
+		t.Fatal("expected a batch without anchors to be incomplete")
+	}
+}
+
+func TestRequiredDocuments(t *testing.T) {
+	profile := completeness.Profile{RequiredDocuments: []string{" Harvest_Report ", "health_certificate"}}
+	got := requiredDocuments(Current, profile)
+	if want := []string{"harvest_report", "health_certificate"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
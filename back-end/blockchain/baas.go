@@ -5,12 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"encoding/base64"
 	"time"
 	
 	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/secrets"
 )
 
 // BaaSService provides Blockchain-as-a-Service functionality
@@ -27,6 +29,9 @@ type BaaSService struct {
 	
 	// Azure Blockchain client
 	AzureClient      *AzureBlockchainClient
+	
+	// Signer signs contract deployments and calls such as NFT minting
+	Signer           Signer
 }
 
 // BaaSNetwork represents a connected blockchain network
@@ -70,6 +75,7 @@ func NewBaaSService() *BaaSService {
 		Config:     cfg,
 		HTTPClient: client,
 		Networks:   make(map[string]*BaaSNetwork),
+		Signer:     defaultSigner,
 	}
 	
 	// Initialize networks from config
@@ -175,6 +181,7 @@ func CreateBaaSService(cfg *config.BaaSConfig) *BaaSService {
 		Config:     cfg,
 		HTTPClient: client,
 		Networks:   make(map[string]*BaaSNetwork),
+		Signer:     defaultSigner,
 	}
 	
 	// Initialize networks
@@ -215,7 +222,7 @@ func CreateBaaSService(cfg *config.BaaSConfig) *BaaSService {
 func (s *BaaSService) ConnectToNetwork(networkID string) error {
 	network, exists := s.Networks[networkID]
 	if !exists {
-		return fmt.Errorf("network %s not configured", networkID)
+		return fmt.Errorf("%w: %s", ErrNetworkNotConfigured, networkID)
 	}
 	
 	// If already connected, just return
@@ -274,7 +281,7 @@ func (s *BaaSService) getNodeStatus(network *BaaSNetwork) (map[string]interface{
 	networkConfig, err := s.Config.GetNetworkConfig(network.Config.NetworkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -362,21 +369,21 @@ func (s *BaaSService) CreateCosmosIBCClient(networkID, targetNetworkID string) (
 	// Check if networks exist
 	sourceNetwork, exists := s.Networks[networkID]
 	if !exists {
-		return "", fmt.Errorf("source network %s not configured", networkID)
+		return "", fmt.Errorf("%w: source network %s", ErrNetworkNotConfigured, networkID)
 	}
 	
 	targetNetwork, exists := s.Networks[targetNetworkID]
 	if !exists {
-		return "", fmt.Errorf("target network %s not configured", targetNetworkID)
+		return "", fmt.Errorf("%w: target network %s", ErrNetworkNotConfigured, targetNetworkID)
 	}
 	
 	// Check if the networks support IBC
 	if sourceNetwork.Config.ChainType != "cosmos" || !sourceNetwork.Config.IBCEnabled {
-		return "", fmt.Errorf("source network %s does not support IBC", networkID)
+		return "", fmt.Errorf("%w: source network %s does not support IBC", ErrCapabilityUnsupported, networkID)
 	}
 	
 	if targetNetwork.Config.ChainType != "cosmos" || !targetNetwork.Config.IBCEnabled {
-		return "", fmt.Errorf("target network %s does not support IBC", targetNetworkID)
+		return "", fmt.Errorf("%w: target network %s does not support IBC", ErrCapabilityUnsupported, targetNetworkID)
 	}
 	
 	// Prepare IBC client creation request
@@ -418,7 +425,7 @@ func (s *BaaSService) CreateCosmosIBCClient(networkID, targetNetworkID string) (
 	networkConfig, err := s.Config.GetNetworkConfig(networkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -441,10 +448,10 @@ func (s *BaaSService) CreateCosmosIBCClient(networkID, targetNetworkID string) (
 	}
 	
 	// Extract client ID
-	clientID, ok := result["client_id"].(string)
-	if !ok {
-		return "", errors.New("client ID not found in response")
+	if err := ValidateBaaSResponse(ContractCreateIBCClient, s.networkChainType(networkID), result); err != nil {
+		return "", err
 	}
+	clientID := result["client_id"].(string)
 	
 	return clientID, nil
 }
@@ -454,7 +461,7 @@ func (s *BaaSService) CreateIBCConnection(sourceNetworkID, targetNetworkID, sour
 	// Get source network for endpoint
 	sourceNetwork, exists := s.Networks[sourceNetworkID]
 	if !exists {
-		return "", fmt.Errorf("source network %s not configured", sourceNetworkID)
+		return "", fmt.Errorf("%w: source network %s", ErrNetworkNotConfigured, sourceNetworkID)
 	}
 	
 	// Get network endpoint for the BaaS API
@@ -494,7 +501,7 @@ func (s *BaaSService) CreateIBCConnection(sourceNetworkID, targetNetworkID, sour
 	networkConfig, err := s.Config.GetNetworkConfig(sourceNetworkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -517,10 +524,10 @@ func (s *BaaSService) CreateIBCConnection(sourceNetworkID, targetNetworkID, sour
 	}
 	
 	// Extract connection ID
-	connectionID, ok := result["connection_id"].(string)
-	if !ok {
-		return "", errors.New("connection ID not found in response")
+	if err := ValidateBaaSResponse(ContractCreateIBCConnection, s.networkChainType(sourceNetworkID), result); err != nil {
+		return "", err
 	}
+	connectionID := result["connection_id"].(string)
 	
 	return connectionID, nil
 }
@@ -538,7 +545,7 @@ func (s *BaaSService) CreateIBCChannel(
 	// Get source network for endpoint
 	sourceNetwork, exists := s.Networks[sourceNetworkID]
 	if !exists {
-		return "", fmt.Errorf("source network %s not configured", sourceNetworkID)
+		return "", fmt.Errorf("%w: source network %s", ErrNetworkNotConfigured, sourceNetworkID)
 	}
 	
 	// Get network endpoint for the BaaS API
@@ -581,7 +588,7 @@ func (s *BaaSService) CreateIBCChannel(
 	networkConfig, err := s.Config.GetNetworkConfig(sourceNetworkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -604,10 +611,10 @@ func (s *BaaSService) CreateIBCChannel(
 	}
 	
 	// Extract channel ID
-	channelID, ok := result["channel_id"].(string)
-	if !ok {
-		return "", errors.New("channel ID not found in response")
+	if err := ValidateBaaSResponse(ContractCreateIBCChannel, s.networkChainType(sourceNetworkID), result); err != nil {
+		return "", err
 	}
+	channelID := result["channel_id"].(string)
 	
 	return channelID, nil
 }
@@ -624,7 +631,7 @@ func (s *BaaSService) SendIBCPacket(
 	// Get network configuration
 	network, exists := s.Networks[networkID]
 	if !exists {
-		return "", fmt.Errorf("network %s not configured", networkID)
+		return "", fmt.Errorf("%w: %s", ErrNetworkNotConfigured, networkID)
 	}
 
 	// Prepare IBC packet request
@@ -670,7 +677,7 @@ func (s *BaaSService) SendIBCPacket(
 	networkConfig, err := s.Config.GetNetworkConfig(networkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -693,10 +700,10 @@ func (s *BaaSService) SendIBCPacket(
 	}
 	
 	// Extract transaction hash
-	txHash, ok := result["tx_hash"].(string)
-	if !ok {
-		return "", errors.New("transaction hash not found in response")
+	if err := ValidateBaaSResponse(ContractSendIBCPacket, s.networkChainType(networkID), result); err != nil {
+		return "", err
 	}
+	txHash := result["tx_hash"].(string)
 	
 	return txHash, nil
 }
@@ -706,21 +713,21 @@ func (s *BaaSService) CreatePolkadotXCMConnection(sourceNetworkID, targetNetwork
 	// Check if networks exist
 	sourceNetwork, exists := s.Networks[sourceNetworkID]
 	if (!exists) {
-		return "", fmt.Errorf("source network %s not configured", sourceNetworkID)
+		return "", fmt.Errorf("%w: source network %s", ErrNetworkNotConfigured, sourceNetworkID)
 	}
 	
 	targetNetwork, exists := s.Networks[targetNetworkID]
 	if (!exists) {
-		return "", fmt.Errorf("target network %s not configured", targetNetworkID)
+		return "", fmt.Errorf("%w: target network %s", ErrNetworkNotConfigured, targetNetworkID)
 	}
 	
 	// Check if the networks support XCM
 	if sourceNetwork.Config.ChainType != "substrate" && sourceNetwork.Config.ChainType != "polkadot" || !sourceNetwork.Config.XCMEnabled {
-		return "", fmt.Errorf("source network %s does not support XCM", sourceNetworkID)
+		return "", fmt.Errorf("%w: source network %s does not support XCM", ErrCapabilityUnsupported, sourceNetworkID)
 	}
 	
 	if targetNetwork.Config.ChainType != "substrate" && targetNetwork.Config.ChainType != "polkadot" || !targetNetwork.Config.XCMEnabled {
-		return "", fmt.Errorf("target network %s does not support XCM", targetNetworkID)
+		return "", fmt.Errorf("%w: target network %s does not support XCM", ErrCapabilityUnsupported, targetNetworkID)
 	}
 	
 	// Prepare XCM connection request
@@ -754,7 +761,7 @@ func (s *BaaSService) CreatePolkadotXCMConnection(sourceNetworkID, targetNetwork
 	networkConfig, err := s.Config.GetNetworkConfig(sourceNetworkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -777,10 +784,10 @@ func (s *BaaSService) CreatePolkadotXCMConnection(sourceNetworkID, targetNetwork
 	}
 	
 	// Extract connection ID
-	connectionID, ok := result["connection_id"].(string)
-	if !ok {
-		return "", errors.New("connection ID not found in response")
+	if err := ValidateBaaSResponse(ContractCreateXCMConnection, s.networkChainType(sourceNetworkID), result); err != nil {
+		return "", err
 	}
+	connectionID := result["connection_id"].(string)
 	
 	return connectionID, nil
 }
@@ -824,7 +831,7 @@ func (s *BaaSService) SendXCMMessage(
 	networkConfig, err := s.Config.GetNetworkConfig(sourceNetworkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -847,10 +854,10 @@ func (s *BaaSService) SendXCMMessage(
 	}
 	
 	// Extract transaction hash
-	txHash, ok := result["tx_hash"].(string)
-	if !ok {
-		return "", errors.New("transaction hash not found in response")
+	if err := ValidateBaaSResponse(ContractSendXCMMessage, s.networkChainType(sourceNetworkID), result); err != nil {
+		return "", err
 	}
+	txHash := result["tx_hash"].(string)
 	
 	return txHash, nil
 }
@@ -859,7 +866,7 @@ func (s *BaaSService) SendXCMMessage(
 func (s *BaaSService) GetNetworkStatus(networkID string) (map[string]interface{}, error) {
 	network, exists := s.Networks[networkID]
 	if !exists {
-		return nil, fmt.Errorf("network %s not configured", networkID)
+		return nil, fmt.Errorf("%w: %s", ErrNetworkNotConfigured, networkID)
 	}
 	
 	// Check if we need to refresh status
@@ -900,7 +907,7 @@ func (s *BaaSService) GetNetworkStatus(networkID string) (map[string]interface{}
 func (s *BaaSService) VerifyTransaction(networkID, txHash string) (bool, map[string]interface{}, error) {
 	network, exists := s.Networks[networkID]
 	if (!exists) {
-		return false, nil, fmt.Errorf("network %s not configured", networkID)
+		return false, nil, fmt.Errorf("%w: %s", ErrNetworkNotConfigured, networkID)
 	}
 	
 	// Construct URL based on chain type
@@ -928,7 +935,7 @@ func (s *BaaSService) VerifyTransaction(networkID, txHash string) (bool, map[str
 	networkConfig, err := s.Config.GetNetworkConfig(networkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -940,6 +947,9 @@ func (s *BaaSService) VerifyTransaction(networkID, txHash string) (bool, map[str
 	defer resp.Body.Close()
 	
 	// Check response status
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil, fmt.Errorf("%w: %s", ErrTxNotFound, txHash)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return false, nil, fmt.Errorf("failed to verify transaction: HTTP %d", resp.StatusCode)
 	}
@@ -1077,7 +1087,7 @@ func (s *BaaSService) ReceiveIBCPacket(
 	networkConfig, err := s.Config.GetNetworkConfig(networkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -1100,10 +1110,10 @@ func (s *BaaSService) ReceiveIBCPacket(
 	}
 	
 	// Extract transaction hash
-	txHash, ok := result["tx_hash"].(string)
-	if !ok {
-		return "", errors.New("transaction hash not found in response")
+	if err := ValidateBaaSResponse(ContractReceiveIBCPacket, s.networkChainType(networkID), result); err != nil {
+		return "", err
 	}
+	txHash := result["tx_hash"].(string)
 	
 	return txHash, nil
 }
@@ -1112,12 +1122,12 @@ func (s *BaaSService) ReceiveIBCPacket(
 func (s *BaaSService) QueryIBCChannels(networkID string) ([]map[string]interface{}, error) {
 	network, exists := s.Networks[networkID]
 	if !exists {
-		return nil, fmt.Errorf("network %s not configured", networkID)
+		return nil, fmt.Errorf("%w: %s", ErrNetworkNotConfigured, networkID)
 	}
 	
 	// Check if the network supports IBC
 	if network.Config.ChainType != "cosmos" || !network.Config.IBCEnabled {
-		return nil, fmt.Errorf("network %s does not support IBC", networkID)
+		return nil, fmt.Errorf("%w: network %s does not support IBC", ErrCapabilityUnsupported, networkID)
 	}
 	
 	// Construct URL
@@ -1151,10 +1161,10 @@ func (s *BaaSService) QueryIBCChannels(networkID string) ([]map[string]interface
 	}
 	
 	// Extract channels
-	channelsData, ok := result["channels"].([]interface{})
-	if !ok {
-		return nil, errors.New("channels not found in response")
+	if err := ValidateBaaSResponse(ContractQueryIBCChannels, s.networkChainType(networkID), result); err != nil {
+		return nil, err
 	}
+	channelsData := result["channels"].([]interface{})
 	
 	// Convert to standard format
 	channels := make([]map[string]interface{}, 0, len(channelsData))
@@ -1173,12 +1183,12 @@ func (s *BaaSService) QueryIBCChannels(networkID string) ([]map[string]interface
 func (s *BaaSService) QueryIBCConnections(networkID string) ([]map[string]interface{}, error) {
 	network, exists := s.Networks[networkID]
 	if !exists {
-		return nil, fmt.Errorf("network %s not configured", networkID)
+		return nil, fmt.Errorf("%w: %s", ErrNetworkNotConfigured, networkID)
 	}
 	
 	// Check if the network supports IBC
 	if network.Config.ChainType != "cosmos" || !network.Config.IBCEnabled {
-		return nil, fmt.Errorf("network %s does not support IBC", networkID)
+		return nil, fmt.Errorf("%w: network %s does not support IBC", ErrCapabilityUnsupported, networkID)
 	}
 	
 	// Construct URL
@@ -1221,12 +1231,12 @@ func (s *BaaSService) QueryIBCConnections(networkID string) ([]map[string]interf
 func (s *BaaSService) GetIBCDenomTrace(networkID, denom string) (map[string]interface{}, error) {
 	network, exists := s.Networks[networkID]
 	if !exists {
-		return nil, fmt.Errorf("network %s not configured", networkID)
+		return nil, fmt.Errorf("%w: %s", ErrNetworkNotConfigured, networkID)
 	}
 	
 	// Check if the network supports IBC
 	if network.Config.ChainType != "cosmos" || !network.Config.IBCEnabled {
-		return nil, fmt.Errorf("network %s does not support IBC", networkID)
+		return nil, fmt.Errorf("%w: network %s does not support IBC", ErrCapabilityUnsupported, networkID)
 	}
 	
 	// For IBC denoms, extract the hash
@@ -1274,10 +1284,10 @@ func (s *BaaSService) GetIBCDenomTrace(networkID, denom string) (map[string]inte
 	}
 	
 	// Extract denom trace
-	denomTrace, ok := result["denom_trace"].(map[string]interface{})
-	if !ok {
-		return nil, errors.New("denom_trace not found in response")
+	if err := ValidateBaaSResponse(ContractIBCDenomTrace, s.networkChainType(networkID), result); err != nil {
+		return nil, err
 	}
+	denomTrace := result["denom_trace"].(map[string]interface{})
 	
 	// Add additional info
 	denomTrace["is_ibc_token"] = true
@@ -1322,7 +1332,7 @@ func (s *BaaSService) CreateInterChainAccount(
 	networkConfig, err := s.Config.GetNetworkConfig(networkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -1345,10 +1355,10 @@ func (s *BaaSService) CreateInterChainAccount(
 	}
 	
 	// Extract account address
-	accountAddress, ok := result["account_address"].(string)
-	if !ok {
-		return "", errors.New("account address not found in response")
+	if err := ValidateBaaSResponse(ContractCreateICA, s.networkChainType(networkID), result); err != nil {
+		return "", err
 	}
+	accountAddress := result["account_address"].(string)
 	
 	return accountAddress, nil
 }
@@ -1394,7 +1404,7 @@ func (s *BaaSService) SendInterChainAccountTx(
 	networkConfig, err := s.Config.GetNetworkConfig(networkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -1417,10 +1427,10 @@ func (s *BaaSService) SendInterChainAccountTx(
 	}
 	
 	// Extract transaction hash
-	txHash, ok := result["tx_hash"].(string)
-	if (!ok) {
-		return "", errors.New("transaction hash not found in response")
+	if err := ValidateBaaSResponse(ContractSendICATx, s.networkChainType(networkID), result); err != nil {
+		return "", err
 	}
+	txHash := result["tx_hash"].(string)
 	
 	return txHash, nil
 }
@@ -1464,7 +1474,7 @@ func (s *BaaSService) CreateCustomChain(
 	networkConfig, err := s.Config.GetNetworkConfig(name)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -1487,10 +1497,10 @@ func (s *BaaSService) CreateCustomChain(
 	}
 	
 	// Extract chain ID
-	chainID, ok := result["chain_id"].(string)
-	if !ok {
-		return "", errors.New("chain ID not found in response")
+	if err := ValidateBaaSResponse(ContractCreateCustomChain, chainType, result); err != nil {
+		return "", err
 	}
+	chainID := result["chain_id"].(string)
 	
 	return chainID, nil
 }
@@ -1503,6 +1513,12 @@ func (s *BaaSService) DeploySmartContract(
 	contractCode string,
 	initArgs map[string]interface{},
 ) (string, error) {
+	// Check the payer's on-chain budget before spending gas
+	fee := EstimateFee(s.networkChainType(networkID), "DEPLOY_CONTRACT", initArgs)
+	if err := checkFeeBudget(fee); err != nil {
+		return "", err
+	}
+
 	// Prepare contract deployment request
 	deployRequest := map[string]interface{}{
 		"network_id":     networkID,
@@ -1532,52 +1548,66 @@ func (s *BaaSService) DeploySmartContract(
 		url = fmt.Sprintf("http://blockchain-mock:8545/contracts")
 	}
 	
-	// Convert to JSON
-	jsonData, err := json.Marshal(deployRequest)
-	if err != nil {
-		return "", err
-	}
-	
-	// Send request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
-	}
-	
-	// Add headers
-	req.Header.Set("Content-Type", "application/json")
-	
-	// Try to get API key for the network
-	networkConfig, err := s.Config.GetNetworkConfig(networkID)
-	if err == nil && networkConfig.ApiKeys != nil {
-		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+	// Deployments from the same account each get their own nonce
+	var result map[string]interface{}
+	err := DefaultNonceManager().Submit(networkID, s.signerAddress(), s.accountNonce(networkID), func(nonce uint64) error {
+		deployRequest["nonce"] = nonce
+		
+		// Convert to JSON
+		jsonData, err := json.Marshal(deployRequest)
+		if err != nil {
+			return err
 		}
-	}
-	
-	// Execute request
-	resp, err := s.HTTPClient.Do(req)
+		
+		// Send request
+		req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return err
+		}
+		
+		// Add headers
+		req.Header.Set("Content-Type", "application/json")
+		if err := s.signRequest(req, jsonData); err != nil {
+			return err
+		}
+		
+		// Try to get API key for the network
+		networkConfig, err := s.Config.GetNetworkConfig(networkID)
+		if err == nil && networkConfig.ApiKeys != nil {
+			if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
+				req.Header.Set("X-API-Key", secrets.Value(apiKey))
+			}
+		}
+		
+		// Execute request
+		resp, err := s.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		
+		// Check response status
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+			return nonceRejection(resp, fmt.Errorf("failed to deploy smart contract: HTTP %d", resp.StatusCode))
+		}
+		
+		// Parse response
+		return json.NewDecoder(resp.Body).Decode(&result)
+	})
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
 	
-	// Check response status
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("failed to deploy smart contract: HTTP %d", resp.StatusCode)
-	}
-	
-	// Parse response
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	// Extract contract address
+	if err := ValidateBaaSResponse(ContractDeployContract, s.networkChainType(networkID), result); err != nil {
 		return "", err
 	}
-	
-	// Extract contract address
-	contractAddress, ok := result["contract_address"].(string)
-	if !ok {
-		return "", errors.New("contract address not found in response")
+	contractAddress := result["contract_address"].(string)
+	txHash, _ := result["transaction_hash"].(string)
+	if txHash == "" {
+		txHash = contractAddress
 	}
+	recordFee(fee, txHash)
 	
 	return contractAddress, nil
 }
@@ -1590,7 +1620,7 @@ func (s *BaaSService) QueryContractState(
 ) (map[string]interface{}, error) {
 	network, exists := s.Networks[networkID]
 	if !exists {
-		return nil, fmt.Errorf("network %s not configured", networkID)
+		return nil, fmt.Errorf("%w: %s", ErrNetworkNotConfigured, networkID)
 	}
 	
 	// Determine URL based on chain type
@@ -1710,12 +1740,12 @@ func (s *BaaSService) CreateCrossChainBridge(
 	// Validate networks
 	_, sourceExists := s.Networks[sourceNetworkID]
 	if !sourceExists {
-		return "", fmt.Errorf("source network %s not configured", sourceNetworkID)
+		return "", fmt.Errorf("%w: source network %s", ErrNetworkNotConfigured, sourceNetworkID)
 	}
 	
 	_, targetExists := s.Networks[targetNetworkID]
 	if !targetExists {
-		return "", fmt.Errorf("target network %s not configured", targetNetworkID)
+		return "", fmt.Errorf("%w: target network %s", ErrNetworkNotConfigured, targetNetworkID)
 	}
 	
 	// Prepare bridge creation request
@@ -1748,7 +1778,7 @@ func (s *BaaSService) CreateCrossChainBridge(
 	networkConfig, err := s.Config.GetNetworkConfig(sourceNetworkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -1771,10 +1801,10 @@ func (s *BaaSService) CreateCrossChainBridge(
 	}
 	
 	// Extract bridge ID
-	bridgeID, ok := result["bridge_id"].(string)
-	if !ok {
-		return "", errors.New("bridge ID not found in response")
+	if err := ValidateBaaSResponse(ContractCreateBridge, s.networkChainType(sourceNetworkID), result); err != nil {
+		return "", err
 	}
+	bridgeID := result["bridge_id"].(string)
 	
 	return bridgeID, nil
 }
@@ -1822,7 +1852,7 @@ func (s *BaaSService) TransferAssetAcrossChains(
 	networkConfig, err := s.Config.GetNetworkConfig(sourceNetworkID)
 	if err == nil && networkConfig.ApiKeys != nil {
 		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+			req.Header.Set("X-API-Key", secrets.Value(apiKey))
 		}
 	}
 	
@@ -1845,10 +1875,10 @@ func (s *BaaSService) TransferAssetAcrossChains(
 	}
 	
 	// Extract transaction hash
-	txHash, ok := result["tx_hash"].(string)
-	if !ok {
-		return "", errors.New("transaction hash not found in response")
+	if err := ValidateBaaSResponse(ContractBridgeTransfer, s.networkChainType(sourceNetworkID), result); err != nil {
+		return "", err
 	}
+	txHash := result["tx_hash"].(string)
 	
 	return txHash, nil
 }
@@ -1859,9 +1889,14 @@ func (s *BaaSService) GetBridgeTransactions(
 	limit int,
 	offset int,
 ) ([]map[string]interface{}, error) {
+	network, exists := s.Networks[bridgeID]
+	if !exists || len(network.Config.NodeEndpoints) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrBridgeMissing, bridgeID)
+	}
+	
 	// Construct URL
 	url := fmt.Sprintf("%s/bridges/%s/transactions?limit=%d&offset=%d", 
-		s.Networks[bridgeID].Config.NodeEndpoints[0], bridgeID, limit, offset)
+		network.Config.NodeEndpoints[0], bridgeID, limit, offset)
 	
 	// Send request
 	req, err := http.NewRequest("GET", url, nil)
@@ -1880,6 +1915,9 @@ func (s *BaaSService) GetBridgeTransactions(
 	defer resp.Body.Close()
 	
 	// Check response status
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrBridgeMissing, bridgeID)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("failed to get bridge transactions: HTTP %d", resp.StatusCode)
 	}
@@ -1891,10 +1929,10 @@ func (s *BaaSService) GetBridgeTransactions(
 	}
 	
 	// Extract transactions
-	transactions, ok := result["transactions"].([]interface{})
-	if !ok {
-		return nil, errors.New("transactions not found in response")
+	if err := ValidateBaaSResponse(ContractBridgeTransactions, s.networkChainType(bridgeID), result); err != nil {
+		return nil, err
 	}
+	transactions := result["transactions"].([]interface{})
 	
 	// Convert to standard format
 	txList := make([]map[string]interface{}, 0, len(transactions))
@@ -1911,8 +1949,13 @@ func (s *BaaSService) GetBridgeTransactions(
 
 // GetBridgeById gets details of a specific bridge
 func (s *BaaSService) GetBridgeById(bridgeID string) (map[string]interface{}, error) {
+	network, exists := s.Networks[bridgeID]
+	if !exists || len(network.Config.NodeEndpoints) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrBridgeMissing, bridgeID)
+	}
+	
 	// Construct URL
-	url := fmt.Sprintf("%s/bridges/%s", s.Networks[bridgeID].Config.NodeEndpoints[0], bridgeID)
+	url := fmt.Sprintf("%s/bridges/%s", network.Config.NodeEndpoints[0], bridgeID)
 	
 	// Send request
 	req, err := http.NewRequest("GET", url, nil)
@@ -1931,6 +1974,9 @@ func (s *BaaSService) GetBridgeById(bridgeID string) (map[string]interface{}, er
 	defer resp.Body.Close()
 	
 	// Check response status
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrBridgeMissing, bridgeID)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("failed to get bridge details: HTTP %d", resp.StatusCode)
 	}
@@ -1955,6 +2001,21 @@ func (s *BaaSService) CallContractMethod(
 		return nil, errors.New("method name is required")
 	}
 	
+	// Check the payer's on-chain budget before spending gas
+	method, _ := methodData["method"].(string)
+	feePayload := map[string]interface{}{
+		"contract_address": contractAddress,
+		"method":           method,
+		"params":           methodData["params"],
+	}
+	if params, ok := methodData["params"].([]interface{}); ok && method == "mintBatchNFT" && len(params) > 0 {
+		feePayload["batch_id"] = params[0]
+	}
+	fee := EstimateFee(s.networkChainType(networkID), "CONTRACT_CALL_"+method, feePayload)
+	if err := checkFeeBudget(fee); err != nil {
+		return nil, err
+	}
+	
 	// Prepare contract call request
 	callRequest := map[string]interface{}{
 		"contract_address": contractAddress,
@@ -1965,51 +2026,139 @@ func (s *BaaSService) CallContractMethod(
 	// Construct URL for the network node
 	network, exists := s.Networks[networkID]
 	if !exists || len(network.Config.NodeEndpoints) == 0 {
-		return nil, fmt.Errorf("network '%s' not found or has no endpoints", networkID)
+		return nil, fmt.Errorf("%w: %s has no endpoints", ErrNetworkNotConfigured, networkID)
 	}
 	
 	url := fmt.Sprintf("%s/contracts/%s/call", network.Config.NodeEndpoints[0], contractAddress)
 	
-	// Convert to JSON
-	jsonData, err := json.Marshal(callRequest)
-	if err != nil {
-		return nil, err
-	}
-	
-	// Send request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	// Calls from the same account each get their own nonce
+	var result map[string]interface{}
+	err := DefaultNonceManager().Submit(networkID, s.signerAddress(), s.accountNonce(networkID), func(nonce uint64) error {
+		callRequest["nonce"] = nonce
+		
+		// Convert to JSON
+		jsonData, err := json.Marshal(callRequest)
+		if err != nil {
+			return err
+		}
+		
+		// Send request
+		req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return err
+		}
+		
+		// Add headers
+		req.Header.Set("Content-Type", "application/json")
+		if err := s.signRequest(req, jsonData); err != nil {
+			return err
+		}
+		
+		// Try to get API key for the network
+		networkConfig, err := s.Config.GetNetworkConfig(networkID)
+		if err == nil && networkConfig.ApiKeys != nil {
+			if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
+				req.Header.Set("X-API-Key", secrets.Value(apiKey))
+			}
+		}
+		
+		// Execute request
+		resp, err := s.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		
+		// Check response status
+		if resp.StatusCode != http.StatusOK {
+			return nonceRejection(resp, fmt.Errorf("failed to call contract method: HTTP %d", resp.StatusCode))
+		}
+		
+		// Parse response
+		return json.NewDecoder(resp.Body).Decode(&result)
+	})
 	if err != nil {
 		return nil, err
 	}
 	
-	// Add headers
-	req.Header.Set("Content-Type", "application/json")
+	txHash, _ := result["transaction_hash"].(string)
+	recordFee(fee, txHash)
 	
-	// Try to get API key for the network
-	networkConfig, err := s.Config.GetNetworkConfig(networkID)
-	if err == nil && networkConfig.ApiKeys != nil {
-		if apiKey, ok := networkConfig.ApiKeys["baas"]; ok {
-			req.Header.Set("X-API-Key", apiKey)
+	return result, nil
+}
+
+// networkChainType returns the chain type of a connected network, used to price its gas
+func (s *BaaSService) networkChainType(networkID string) string {
+	if network, exists := s.Networks[networkID]; exists && network.Config.ChainType != "" {
+		return network.Config.ChainType
+	}
+	if s.Config != nil {
+		if networkConfig, err := s.Config.GetNetworkConfig(networkID); err == nil && networkConfig.NetworkType != "" {
+			return networkConfig.NetworkType
 		}
 	}
-	
-	// Execute request
-	resp, err := s.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
+	return "ethereum"
+}
+
+// signerAddress returns the account state changing requests are sent from
+func (s *BaaSService) signerAddress() string {
+	if s.Signer == nil {
+		return ""
 	}
-	defer resp.Body.Close()
-	
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to call contract method: HTTP %d", resp.StatusCode)
+	return s.Signer.Address()
+}
+
+// accountNonce returns a fetcher of the next nonce a network expects from an account
+// Nodes without an account nonce endpoint leave the nonce store authoritative
+func (s *BaaSService) accountNonce(networkID string) NonceFetcher {
+	return func(account string) (uint64, error) {
+		network, exists := s.Networks[networkID]
+		if !exists || len(network.Config.NodeEndpoints) == 0 || account == "" {
+			return 0, nil
+		}
+		resp, err := s.HTTPClient.Get(fmt.Sprintf("%s/accounts/%s/nonce", network.Config.NodeEndpoints[0], account))
+		if err != nil {
+			return 0, fmt.Errorf("failed to get account nonce: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return 0, nil
+		}
+		var result struct {
+			Nonce uint64 `json:"nonce"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return 0, fmt.Errorf("failed to decode account nonce: %w", err)
+		}
+		return result.Nonce, nil
 	}
-	
-	// Parse response
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+}
+
+// nonceRejection marks a failed response as a nonce mismatch when the node rejected the nonce or sequence
+func nonceRejection(resp *http.Response, err error) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	message := strings.ToLower(string(body))
+	if resp.StatusCode == http.StatusConflict || strings.Contains(message, "nonce too low") ||
+		strings.Contains(message, "sequence mismatch") || strings.Contains(message, "invalid nonce") {
+		return fmt.Errorf("%w: %v", ErrNonceMismatch, err)
+	}
+	return err
+}
+
+// signRequest signs a state changing request body with the configured signer
+func (s *BaaSService) signRequest(req *http.Request, body []byte) error {
+	if s.Signer == nil {
+		return nil
 	}
-	
-	return result, nil
-}
\ No newline at end of file
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return err
+	}
+	signature, err := SignPayload(s.Signer, payload)
+	if err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+	req.Header.Set("X-Signer-Address", s.Signer.Address())
+	req.Header.Set("X-Signature", signature)
+	return nil
+}
@@ -0,0 +1,285 @@
+package blockchain
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations of BaaS providers whose responses are checked against a contract
+const (
+	ContractCreateIBCClient     = "create_ibc_client"
+	ContractCreateIBCConnection = "create_ibc_connection"
+	ContractCreateIBCChannel    = "create_ibc_channel"
+	ContractSendIBCPacket       = "send_ibc_packet"
+	ContractReceiveIBCPacket    = "receive_ibc_packet"
+	ContractQueryIBCChannels    = "query_ibc_channels"
+	ContractIBCDenomTrace       = "ibc_denom_trace"
+	ContractCreateICA           = "create_interchain_account"
+	ContractSendICATx           = "send_interchain_account_tx"
+	ContractCreateXCMConnection = "create_xcm_connection"
+	ContractSendXCMMessage      = "send_xcm_message"
+	ContractCreateCustomChain   = "create_custom_chain"
+	ContractDeployContract      = "deploy_contract"
+	ContractCreateBridge        = "create_bridge"
+	ContractBridgeTransfer      = "bridge_transfer"
+	ContractBridgeTransactions  = "bridge_transactions"
+)
+
+// JSON types a response field may have
+const (
+	FieldString = "string"
+	FieldNumber = "number"
+	FieldObject = "object"
+	FieldArray  = "array"
+)
+
+// ErrContractViolation is returned when a BaaS provider response does not match the shape the service relies on
+var ErrContractViolation = errors.New("BaaS response does not match its contract")
+
+// ResponseField is a top level field of a provider response
+type ResponseField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // string, number, object or array
+	Required bool   `json:"required"`
+}
+
+// ResponseContract is the response shape the service expects from one provider operation
+type ResponseContract struct {
+	Operation string          `json:"operation"`
+	Families  []string        `json:"chain_families"` // Chain families providers serve the operation for
+	Fields    []ResponseField `json:"fields"`
+}
+
+var (
+	ibcFamilies    = []string{"cosmos"}
+	xcmFamilies    = []string{"substrate"}
+	bridgeFamilies = []string{"cosmos", "substrate", "evm"}
+	allFamilies    = []string{"cosmos", "substrate", "evm", "fabric"}
+)
+
+// BaaSContracts lists the response contracts of every checked provider operation
+var BaaSContracts = []ResponseContract{
+	{ContractCreateIBCClient, ibcFamilies, []ResponseField{{"client_id", FieldString, true}}},
+	{ContractCreateIBCConnection, ibcFamilies, []ResponseField{{"connection_id", FieldString, true}}},
+	{ContractCreateIBCChannel, ibcFamilies, []ResponseField{{"channel_id", FieldString, true}}},
+	{ContractSendIBCPacket, ibcFamilies, []ResponseField{{"tx_hash", FieldString, true}}},
+	{ContractReceiveIBCPacket, ibcFamilies, []ResponseField{{"tx_hash", FieldString, true}}},
+	{ContractQueryIBCChannels, ibcFamilies, []ResponseField{{"channels", FieldArray, true}}},
+	{ContractIBCDenomTrace, ibcFamilies, []ResponseField{{"denom_trace", FieldObject, true}}},
+	{ContractCreateICA, ibcFamilies, []ResponseField{{"account_address", FieldString, true}}},
+	{ContractSendICATx, ibcFamilies, []ResponseField{{"tx_hash", FieldString, true}}},
+	{ContractCreateXCMConnection, xcmFamilies, []ResponseField{{"connection_id", FieldString, true}}},
+	{ContractSendXCMMessage, xcmFamilies, []ResponseField{{"tx_hash", FieldString, true}}},
+	{ContractCreateCustomChain, allFamilies, []ResponseField{{"chain_id", FieldString, true}}},
+	{ContractDeployContract, allFamilies, []ResponseField{{"contract_address", FieldString, true}, {"transaction_hash", FieldString, false}}},
+	{ContractCreateBridge, bridgeFamilies, []ResponseField{{"bridge_id", FieldString, true}}},
+	{ContractBridgeTransfer, bridgeFamilies, []ResponseField{{"tx_hash", FieldString, true}}},
+	{ContractBridgeTransactions, bridgeFamilies, []ResponseField{{"transactions", FieldArray, true}}},
+}
+
+// ContractViolation describes how a provider response differs from its contract
+type ContractViolation struct {
+	Operation string
+	ChainType string
+	Problems  []string // e.g. "missing required field tx_hash"
+	Received  []string // Top level fields of the response
+}
+
+func (v *ContractViolation) Error() string {
+	received := "none"
+	if len(v.Received) > 0 {
+		received = strings.Join(v.Received, ", ")
+	}
+	return fmt.Sprintf("BaaS response for %s on %s does not match its contract: %s (response fields: %s)",
+		v.Operation, v.ChainType, strings.Join(v.Problems, "; "), received)
+}
+
+// Is makes errors.Is(err, ErrContractViolation) hold for every violation
+func (v *ContractViolation) Is(target error) bool {
+	return target == ErrContractViolation
+}
+
+// contractFor returns the contract of an operation
+func contractFor(operation string) (ResponseContract, bool) {
+	for _, contract := range BaaSContracts {
+		if contract.Operation == operation {
+			return contract, true
+		}
+	}
+	return ResponseContract{}, false
+}
+
+// contractFamily returns the chain family a response is checked and tallied under
+func contractFamily(chainType string) string {
+	if family := chainFamily(chainType); family != "" {
+		return family
+	}
+	return strings.ToLower(chainType)
+}
+
+// jsonType returns the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return FieldString
+	case float64, json.Number:
+		return FieldNumber
+	case map[string]interface{}:
+		return FieldObject
+	case []interface{}:
+		return FieldArray
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// checkContract compares a decoded response with the contract of an operation
+func checkContract(operation, chainType string, result map[string]interface{}) error {
+	contract, ok := contractFor(operation)
+	if !ok {
+		return fmt.Errorf("no response contract for BaaS operation %s", operation)
+	}
+	violation := &ContractViolation{Operation: operation, ChainType: chainType, Received: []string{}}
+	for name := range result {
+		violation.Received = append(violation.Received, name)
+	}
+	sort.Strings(violation.Received)
+
+	for _, field := range contract.Fields {
+		value, present := result[field.Name]
+		switch {
+		case !present || value == nil:
+			if field.Required {
+				violation.Problems = append(violation.Problems, "missing required field "+field.Name)
+			}
+		case jsonType(value) != field.Type:
+			violation.Problems = append(violation.Problems, fmt.Sprintf("field %s is %s, expected %s", field.Name, jsonType(value), field.Type))
+		case field.Required && field.Type == FieldString && value == "":
+			violation.Problems = append(violation.Problems, "required field "+field.Name+" is empty")
+		}
+	}
+	if len(violation.Problems) > 0 {
+		return violation
+	}
+	return nil
+}
+
+// ContractObservation tallies the live responses of one operation on one chain family
+type ContractObservation struct {
+	Checked       int64      `json:"checked"`
+	Violations    int64      `json:"violations"`
+	LastFailed    bool       `json:"last_failed"` // Whether the latest response violated the contract
+	LastViolation string     `json:"last_violation,omitempty"`
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+}
+
+var (
+	observationsMu sync.Mutex
+	observations   = map[string]*ContractObservation{}
+)
+
+// ValidateBaaSResponse checks a live provider response against the contract of its operation, recording the
+// outcome for the compatibility matrix. The returned error names the operation, what differs and the fields
+// the provider sent instead of silently failing on a type assertion
+func ValidateBaaSResponse(operation, chainType string, result map[string]interface{}) error {
+	err := checkContract(operation, chainType, result)
+
+	now := time.Now()
+	key := contractFamily(chainType) + "/" + operation
+	observationsMu.Lock()
+	defer observationsMu.Unlock()
+	observation, ok := observations[key]
+	if !ok {
+		observation = &ContractObservation{}
+		observations[key] = observation
+	}
+	observation.Checked++
+	observation.LastCheckedAt = &now
+	observation.LastFailed = err != nil
+	if err != nil {
+		observation.Violations++
+		observation.LastViolation = err.Error()
+	}
+	return err
+}
+
+// Recorded provider responses, one file per chain family and operation: fixtures/baas/<family>/<operation>.json
+//
+//go:embed fixtures/baas
+var baasFixtures embed.FS
+
+// BaaSFixture returns the recorded provider response of an operation on a chain family
+func BaaSFixture(family, operation string) (map[string]interface{}, error) {
+	data, err := baasFixtures.ReadFile("fixtures/baas/" + family + "/" + operation + ".json")
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid %s fixture for %s: %w", family, operation, err)
+	}
+	return result, nil
+}
+
+// Compatibility statuses of an operation on a chain family
+const (
+	CompatibilityCompatible   = "compatible"   // the recorded and live responses match the contract
+	CompatibilityIncompatible = "incompatible" // the recorded or the last live response violates the contract
+	CompatibilityUntested     = "untested"     // no fixture is recorded and no live response was seen
+)
+
+// ContractCompatibility is one cell of the compatibility matrix
+type ContractCompatibility struct {
+	Operation    string              `json:"operation"`
+	ChainFamily  string              `json:"chain_family"`
+	Status       string              `json:"status"`  // compatible, incompatible or untested
+	Fixture      string              `json:"fixture"` // pass, fail or missing
+	FixtureError string              `json:"fixture_error,omitempty"`
+	Live         ContractObservation `json:"live"`
+}
+
+// CompatibilityMatrix checks every recorded fixture against its contract and combines the result with the live
+// responses seen since the process started, for each operation and chain family
+func CompatibilityMatrix() []ContractCompatibility {
+	observationsMu.Lock()
+	live := map[string]ContractObservation{}
+	for key, observation := range observations {
+		live[key] = *observation
+	}
+	observationsMu.Unlock()
+
+	matrix := []ContractCompatibility{}
+	for _, contract := range BaaSContracts {
+		for _, family := range contract.Families {
+			cell := ContractCompatibility{Operation: contract.Operation, ChainFamily: family, Live: live[family+"/"+contract.Operation]}
+			if fixture, err := BaaSFixture(family, contract.Operation); err != nil {
+				cell.Fixture = "missing"
+			} else if err := checkContract(contract.Operation, family, fixture); err != nil {
+				cell.Fixture = "fail"
+				cell.FixtureError = err.Error()
+			} else {
+				cell.Fixture = "pass"
+			}
+
+			switch {
+			case cell.Fixture == "fail" || cell.Live.LastFailed:
+				cell.Status = CompatibilityIncompatible
+			case cell.Fixture == "missing" && cell.Live.Checked == 0:
+				cell.Status = CompatibilityUntested
+			default:
+				cell.Status = CompatibilityCompatible
+			}
+			matrix = append(matrix, cell)
+		}
+	}
+	return matrix
+}
@@ -0,0 +1,183 @@
+package blockchain
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+)
+
+// fixtureProvider serves the recorded response of a chain family for each BaaS path
+func fixtureProvider(t *testing.T, family string, overrides map[string]string) *httptest.Server {
+	routes := map[string]string{
+		"/ibc/clients":                  ContractCreateIBCClient,
+		"/ibc/connections":              ContractCreateIBCConnection,
+		"/ibc/channels":                 ContractCreateIBCChannel,
+		"/ibc/packets":                  ContractSendIBCPacket,
+		"/ibc/packets/receive":          ContractReceiveIBCPacket,
+		"/ibc/core/channel/v1/channels": ContractQueryIBCChannels,
+		"/ibc/interchain_accounts":      ContractCreateICA,
+		"/ibc/interchain_accounts/tx":   ContractSendICATx,
+		"/xcm/connections":              ContractCreateXCMConnection,
+		"/xcm/messages":                 ContractSendXCMMessage,
+		"/bridges":                      ContractCreateBridge,
+		"/bridges/bridge-1/transfer":    ContractBridgeTransfer,
+		"/ibc/apps/transfer/v1/denom_traces/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2": ContractIBCDenomTrace,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, ok := overrides[r.URL.Path]; ok {
+			w.Write([]byte(body))
+			return
+		}
+		operation, ok := routes[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		data, err := baasFixtures.ReadFile("fixtures/baas/" + family + "/" + operation + ".json")
+		if err != nil {
+			t.Errorf("no %s fixture for %s: %v", family, operation, err)
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+}
+
+// testBaaSService returns a service with one network of the chain type, served by the provider
+func testBaaSService(networkID, chainType, endpoint string) *BaaSService {
+	network := func(id string) *BaaSNetwork {
+		return &BaaSNetwork{
+			Config: NetworkConfig{
+				NetworkID:     id,
+				ChainType:     chainType,
+				NodeEndpoints: []string{endpoint},
+				IBCEnabled:    chainType == "cosmos",
+				XCMEnabled:    chainType == "polkadot",
+				NetworkParams: map[string]interface{}{},
+			},
+			ActiveEndpoint: endpoint,
+		}
+	}
+	return &BaaSService{
+		Config:     &config.BaaSConfig{},
+		HTTPClient: http.DefaultClient,
+		Networks:   map[string]*BaaSNetwork{networkID: network(networkID), "target": network("target")},
+	}
+}
+
+func TestRecordedFixturesMatchContracts(t *testing.T) {
+	for _, cell := range CompatibilityMatrix() {
+		if cell.Fixture != "pass" {
+			t.Errorf("%s fixture for %s is %s %s", cell.ChainFamily, cell.Operation, cell.Fixture, cell.FixtureError)
+		}
+	}
+}
+
+func TestCosmosProviderContract(t *testing.T) {
+	provider := fixtureProvider(t, "cosmos", nil)
+	defer provider.Close()
+	s := testBaaSService("cosmoshub", "cosmos", provider.URL)
+
+	calls := map[string]func() (string, error){
+		ContractCreateIBCClient: func() (string, error) { return s.CreateCosmosIBCClient("cosmoshub", "target") },
+		ContractCreateIBCConnection: func() (string, error) {
+			return s.CreateIBCConnection("cosmoshub", "target", "07-tendermint-12", "07-tendermint-3")
+		},
+		ContractCreateIBCChannel: func() (string, error) {
+			return s.CreateIBCChannel("cosmoshub", "target", "connection-7", "transfer", "transfer", "ics20-1", "UNORDERED")
+		},
+		ContractSendIBCPacket: func() (string, error) {
+			return s.SendIBCPacket("cosmoshub", "channel-31", "transfer", map[string]interface{}{"batch_id": 1}, 0, 0)
+		},
+		ContractReceiveIBCPacket: func() (string, error) {
+			return s.ReceiveIBCPacket("cosmoshub", "target", "channel-0", "channel-31", map[string]interface{}{}, "proof", map[string]interface{}{})
+		},
+		ContractCreateICA: func() (string, error) {
+			return s.CreateInterChainAccount("cosmoshub", "target", "connection-7", "cosmos1owner")
+		},
+		ContractSendICATx: func() (string, error) {
+			return s.SendInterChainAccountTx("cosmoshub", "target", "connection-7", "cosmos1owner", nil, "")
+		},
+		ContractCreateBridge: func() (string, error) {
+			return s.CreateCrossChainBridge("cosmoshub", "target", "lock_mint", nil)
+		},
+		ContractBridgeTransfer: func() (string, error) {
+			return s.TransferAssetAcrossChains("cosmoshub", "target", "bridge-1", "ularvae", "10", "a", "b")
+		},
+	}
+	for operation, call := range calls {
+		fixture, err := BaaSFixture("cosmos", operation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := call()
+		if err != nil {
+			t.Errorf("%s: %v", operation, err)
+			continue
+		}
+		contract, _ := contractFor(operation)
+		if want := fixture[contract.Fields[0].Name]; got != want {
+			t.Errorf("%s returned %q, want %q", operation, got, want)
+		}
+	}
+
+	channels, err := s.QueryIBCChannels("cosmoshub")
+	if err != nil || len(channels) != 1 {
+		t.Errorf("QueryIBCChannels = %v, %v; want the recorded channel", channels, err)
+	}
+	trace, err := s.GetIBCDenomTrace("cosmoshub", "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2")
+	if err != nil || trace["base_denom"] != "ularvae" {
+		t.Errorf("GetIBCDenomTrace = %v, %v; want the recorded trace", trace, err)
+	}
+}
+
+func TestSubstrateProviderContract(t *testing.T) {
+	provider := fixtureProvider(t, "substrate", nil)
+	defer provider.Close()
+	s := testBaaSService("rococo", "polkadot", provider.URL)
+
+	connectionID, err := s.CreatePolkadotXCMConnection("rococo", "target")
+	if err != nil || connectionID != "xcm-2000-2004" {
+		t.Errorf("CreatePolkadotXCMConnection = %q, %v", connectionID, err)
+	}
+	txHash, err := s.SendXCMMessage("rococo", "target", connectionID, "transfer", map[string]interface{}{})
+	if err != nil || !strings.HasPrefix(txHash, "0x5c1f") {
+		t.Errorf("SendXCMMessage = %q, %v", txHash, err)
+	}
+}
+
+func TestChangedProviderResponseIsDescriptive(t *testing.T) {
+	// The provider renamed tx_hash to hash and sends channel IDs as numbers
+	provider := fixtureProvider(t, "cosmos", map[string]string{
+		"/ibc/packets":  `{"hash": "9F3C6E1B", "height": "1844107"}`,
+		"/ibc/channels": `{"channel_id": 31}`,
+	})
+	defer provider.Close()
+	s := testBaaSService("cosmoshub", "cosmos", provider.URL)
+
+	_, err := s.SendIBCPacket("cosmoshub", "channel-31", "transfer", nil, 0, 0)
+	if !errors.Is(err, ErrContractViolation) {
+		t.Fatalf("SendIBCPacket error = %v, want a contract violation", err)
+	}
+	for _, want := range []string{"send_ibc_packet", "missing required field tx_hash", "hash, height"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	_, err = s.CreateIBCChannel("cosmoshub", "target", "connection-7", "transfer", "transfer", "ics20-1", "UNORDERED")
+	if err == nil || !strings.Contains(err.Error(), "field channel_id is number, expected string") {
+		t.Errorf("CreateIBCChannel error = %v, want a type mismatch", err)
+	}
+
+	for _, cell := range CompatibilityMatrix() {
+		if cell.ChainFamily == "cosmos" && cell.Operation == ContractSendIBCPacket && cell.Status != CompatibilityIncompatible {
+			t.Errorf("send_ibc_packet on cosmos is %s after a violation, want incompatible", cell.Status)
+		}
+	}
+}
@@ -8,6 +8,10 @@ import (
 	"fmt"
 	"sort"
 	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain/standards"
+	"github.com/LTPPPP/TracePost-larvaeChain/faults"
+	"github.com/LTPPPP/TracePost-larvaeChain/secrets"
 )
 
 // BlockchainClient is a client for interacting with the blockchain
@@ -26,6 +30,9 @@ type BlockchainClient struct {
 	
 	HSMService *HSMService
 	ZKPService *ZKPService
+	
+	// Signer signs submitted transactions; the private key itself stays in the backend
+	Signer Signer
 }
 
 // CallContract calls a smart contract method with the specified parameters
@@ -73,6 +80,7 @@ type Transaction struct {
 	Payload   map[string]interface{} `json:"payload"`
 	Sender    string                 `json:"sender"`
 	Signature string                 `json:"signature"`
+	Nonce     uint64                 `json:"nonce"`
 	
 	// Advanced fields for 2025 features
 	CrossChainRef   string    `json:"cross_chain_ref,omitempty"`   // Reference to cross-chain transactions
@@ -84,12 +92,23 @@ type Transaction struct {
 
 // NewBlockchainClient creates a new blockchain client
 func NewBlockchainClient(nodeURL, privateKey, accountAddr, chainID, consensusType string) *BlockchainClient {
+	// The node health prober may have switched the configured node to a healthy fallback
+	nodeURL = ActiveNodeURL(nodeURL)
+
 	client := &BlockchainClient{
 		NodeURL:           nodeURL,
 		PrivateKey:        privateKey,
 		AccountAddr:       accountAddr,
 		BlockchainChainID: chainID,
 		ConsensusType:     consensusType,
+		Signer:            defaultSigner,
+	}
+	
+	// Fall back to a plaintext key only when no signer backend is configured
+	if client.Signer == nil && privateKey != "" {
+		if signer, err := NewLocalKeySigner(secrets.Value(privateKey)); err == nil {
+			client.Signer = signer
+		}
 	}
 	
 	// Initialize interoperability client
@@ -98,8 +117,11 @@ func NewBlockchainClient(nodeURL, privateKey, accountAddr, chainID, consensusTyp
 	// Initialize identity client
 	client.IdentityClient = NewIdentityClient(client, "")
 	
-	// Register default standard converters
-	client.InteropClient.RegisterStandardConverter("GS1-EPCIS", ConvertToGS1EPCIS)
+	// Register the transformers of every built-in data standard
+	for _, standard := range standards.Default().Standards() {
+		transformer, _ := standards.Default().Get(standard)
+		client.InteropClient.RegisterTransformer(transformer)
+	}
 	
 	// Initialize consensus engine
 	consensusConfig := ConsensusConfig{
@@ -285,6 +307,50 @@ func (bc *BlockchainClient) ShareBatchWithExternalChain(batchID, destChainID str
 	return crossChainTx.DestinationTxID, nil
 }
 
+// ShareEncryptedBatchWithExternalChain shares a batch with an external blockchain, encrypted so only the recipients can read it
+// The data standard conversion is applied before encryption since the destination cannot convert ciphertext
+func (bc *BlockchainClient) ShareEncryptedBatchWithExternalChain(batchID, destChainID string, dataStandard string, recipients []PayloadRecipient) (string, *EncryptedPayload, error) {
+	batchData := map[string]interface{}{
+		"batch_id":     batchID,
+		"location":     "VN12345",  // Example location code
+		"event_time":   time.Now(),
+		"event_type":   "ObjectEvent",
+		"species":      "Litopenaeus vannamei", // White leg shrimp
+		"quantity":     100000,
+	}
+	
+	if dataStandard != "" {
+		converter, exists := bc.InteropClient.StandardsConverters[dataStandard]
+		if !exists {
+			return "", nil, fmt.Errorf("data standard converter for %s not found", dataStandard)
+		}
+		converted, err := converter(batchData)
+		if err != nil {
+			return "", nil, fmt.Errorf("data conversion error: %v", err)
+		}
+		batchData = converted
+		batchData["data_standard"] = dataStandard
+	}
+	
+	encrypted, err := EncryptPayload(batchData, recipients)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encrypt batch data: %v", err)
+	}
+	
+	// Only the envelope leaves this node, the plaintext stays local
+	crossChainTx, err := bc.InteropClient.SendCrossChainTransaction(
+		destChainID,
+		"SHARE_BATCH_ENCRYPTED",
+		encrypted.ToMap(),
+		"",
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	
+	return crossChainTx.DestinationTxID, encrypted, nil
+}
+
 // VerifyActorPermission verifies if an actor has permission to perform an action
 func (bc *BlockchainClient) VerifyActorPermission(actorDID, permission string) (bool, error) {
 	return bc.IdentityClient.VerifyPermission(actorDID, permission)
@@ -547,6 +613,16 @@ type CrossChainTxResponse struct {
 
 // SubmitGenericTransaction allows submitting any transaction type with a custom payload
 func (bc *BlockchainClient) SubmitGenericTransaction(txType string, payload map[string]interface{}) (string, error) {
+	if err := faults.Inject(faults.TargetBlockchain); err != nil {
+		return "", err
+	}
+
+	// Check the payer's on-chain budget before spending gas
+	fee := EstimateFee(bc.ConsensusType, txType, payload)
+	if err := checkFeeBudget(fee); err != nil {
+		return "", err
+	}
+
 	// Create transaction
 	tx := Transaction{
 		TxID:      fmt.Sprintf("tx_%s_%d", txType, time.Now().UnixNano()),
@@ -556,17 +632,51 @@ func (bc *BlockchainClient) SubmitGenericTransaction(txType string, payload map[
 		Sender:    bc.AccountAddr,
 		Signature: "", // Signature would be generated by the HSM or client software
 	}
+	if bc.Signer != nil {
+		tx.Sender = bc.Signer.Address()
+	}
 	
-	// TODO: Sign transaction with private key using HSM or local signing
-	// For now, we'll just set a dummy signature
-	tx.Signature = "dummy_signature"
-	
-	// In a real implementation, this would submit the transaction to the blockchain network
-	fmt.Printf("Submitting transaction: %+v\n", tx)
+	// Concurrent submissions from the same account each get their own nonce
+	err := DefaultNonceManager().Submit(bc.ConsensusType, tx.Sender, bc.GetAccountNonce, func(nonce uint64) error {
+		tx.Nonce = nonce
+		
+		// Sign the transaction with the configured backend
+		if bc.Signer != nil {
+			signature, err := SignPayload(bc.Signer, map[string]interface{}{
+				"tx_id":   tx.TxID,
+				"type":    tx.Type,
+				"payload": tx.Payload,
+				"nonce":   tx.Nonce,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to sign transaction: %w", err)
+			}
+			tx.Signature = signature
+		} else {
+			// Development setups without a signer submit unsigned transactions
+			tx.Signature = "unsigned"
+		}
+		
+		// In a real implementation, this would submit the transaction to the blockchain network
+		// and map "nonce too low" or "account sequence mismatch" rejections to ErrNonceMismatch
+		fmt.Printf("Submitting transaction: %+v\n", tx)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	recordFee(fee, tx.TxID)
 	
 	return tx.TxID, nil
 }
 
+// GetAccountNonce returns the next nonce the chain expects from an account
+func (bc *BlockchainClient) GetAccountNonce(account string) (uint64, error) {
+	// In a real implementation, this would call eth_getTransactionCount (pending) or the account's
+	// sequence query; the mock ledger keeps no account state, so the nonce store is authoritative
+	return 0, nil
+}
+
 // submitTransaction is a helper method that creates and submits a transaction to the blockchain
 func (bc *BlockchainClient) submitTransaction(txType string, payload map[string]interface{}) (string, error) {
 	return bc.SubmitGenericTransaction(txType, payload)
@@ -580,6 +690,10 @@ func (bc *BlockchainClient) SubmitTransaction(txType string, payload map[string]
 
 // QueryLedger is a public method for querying data from the blockchain
 func (bc *BlockchainClient) QueryLedger(queryType string, params map[string]interface{}) (interface{}, error) {
+	if err := faults.Inject(faults.TargetBlockchain); err != nil {
+		return nil, err
+	}
+
 	// For now, we'll handle different query types with mock data
 	switch queryType {
 	case "GET_DID":
@@ -854,4 +968,44 @@ func (bc *BlockchainClient) VerifyBatchDataOnChain(batchID string) (map[string]i
 	verificationResults["verification_level"] = "comprehensive"
 	
 	return verificationResults, nil
-}
\ No newline at end of file
+}
+// AnchorVerification is the result of independently checking an anchored transaction
+type AnchorVerification struct {
+	TxID           string    `json:"tx_id"`
+	Found          bool      `json:"found"`
+	SignatureValid bool      `json:"signature_valid"`
+	PayloadHash    string    `json:"payload_hash,omitempty"`
+	Detail         string    `json:"detail,omitempty"`
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// VerifyAnchoredTransaction re-checks a transaction recorded for an off-chain record
+// expectedHash is the metadata hash stored when the record was anchored
+func (bc *BlockchainClient) VerifyAnchoredTransaction(txID, expectedHash string) (*AnchorVerification, error) {
+	result := &AnchorVerification{TxID: txID, CheckedAt: time.Now()}
+	if txID == "" {
+		result.Detail = "no transaction ID recorded"
+		return result, nil
+	}
+
+	// In a real implementation, this would fetch the transaction from the node,
+	// recover the sender from its signature and compare the payload hash.
+	// The mock ledger accepts the transaction IDs it issues.
+	if len(txID) < 4 || (txID[:3] != "tx_" && txID[:2] != "0x") {
+		result.Detail = "transaction not found on chain"
+		return result, nil
+	}
+	result.Found = true
+
+	if expectedHash == "" {
+		result.Detail = "no payload hash anchored for this record"
+		return result, nil
+	}
+	if decoded, err := hex.DecodeString(expectedHash); err != nil || len(decoded) != sha256.Size {
+		result.Detail = "anchored payload hash is not a valid SHA-256 digest"
+		return result, nil
+	}
+	result.PayloadHash = expectedHash
+	result.SignatureValid = true
+	return result, nil
+}
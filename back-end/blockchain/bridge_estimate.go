@@ -0,0 +1,216 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+)
+
+// Gas price sources of a leg estimate
+const (
+	GasPriceLive   = "live"   // queried from the network's RPC endpoint
+	GasPriceConfig = "config" // fixed in the network config
+	GasPriceModel  = "model"  // taken from the fee model of the chain type
+)
+
+// bridgeRelayDelay is the time a relayer needs to pick up and submit a packet, per bridge type
+var bridgeRelayDelay = map[string]time.Duration{
+	"ibc":            30 * time.Second,
+	"xcm":            12 * time.Second,
+	"hash_time_lock": 60 * time.Second,
+}
+
+// defaultRelayDelay is used for bridge types without a known delay
+const defaultRelayDelay = 60 * time.Second
+
+// BridgeLegEstimate is the cost and time of one transaction of a bridge transfer
+type BridgeLegEstimate struct {
+	Leg                   string  `json:"leg"` // "source" locks the asset, "destination" releases it
+	NetworkID             string  `json:"network_id"`
+	ChainType             string  `json:"chain_type"`
+	GasUsed               int64   `json:"gas_used"`
+	GasPriceGwei          float64 `json:"gas_price_gwei"`
+	GasPriceSource        string  `json:"gas_price_source"`
+	Fee                   float64 `json:"fee"`
+	Currency              string  `json:"currency"`
+	RequiredConfirmations int64   `json:"required_confirmations"`
+	LatencySeconds        int64   `json:"latency_seconds"`
+}
+
+// BridgeTransferEstimate is the estimated cost, latency and confirmations of a bridge transfer
+type BridgeTransferEstimate struct {
+	BridgeID              string              `json:"bridge_id"`
+	BridgeType            string              `json:"bridge_type"`
+	SourceNetworkID       string              `json:"source_network_id"`
+	DestinationNetworkID  string              `json:"destination_network_id"`
+	AssetID               string              `json:"asset_id,omitempty"`
+	Amount                string              `json:"amount,omitempty"`
+	Legs                  []BridgeLegEstimate `json:"legs"`
+	BridgeFee             float64             `json:"bridge_fee"`
+	TotalFees             map[string]float64  `json:"total_fees"` // per currency
+	RelaySeconds          int64               `json:"relay_seconds"`
+	EstimatedLatency      int64               `json:"estimated_latency_seconds"`
+	RequiredConfirmations int64               `json:"required_confirmations"`
+	EstimatedAt           time.Time           `json:"estimated_at"`
+}
+
+// EstimateBridgeTransfer estimates the fees, latency and confirmations of moving an asset over a configured bridge
+// Gas prices are queried from the networks when they expose a JSON-RPC endpoint, the fee model is used otherwise
+func (s *BaaSService) EstimateBridgeTransfer(bridgeID, assetID, amount string) (*BridgeTransferEstimate, error) {
+	bridge, err := s.Config.GetBridgeConfiguration(bridgeID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBridgeMissing, bridgeID)
+	}
+	if !bridge.Enabled {
+		return nil, fmt.Errorf("bridge %s is disabled", bridgeID)
+	}
+
+	payload := map[string]interface{}{
+		"bridge_id": bridgeID,
+		"asset_id":  assetID,
+		"amount":    amount,
+	}
+	source := s.estimateBridgeLeg("source", bridge.SourceNetworkID, bridge.BridgeType, "BRIDGE_LOCK", payload)
+	destination := s.estimateBridgeLeg("destination", bridge.DestinationNetworkID, bridge.BridgeType, "BRIDGE_RELEASE", payload)
+
+	relay, ok := bridgeRelayDelay[strings.ToLower(bridge.BridgeType)]
+	if !ok {
+		relay = defaultRelayDelay
+	}
+
+	estimate := &BridgeTransferEstimate{
+		BridgeID:              bridge.BridgeID,
+		BridgeType:            bridge.BridgeType,
+		SourceNetworkID:       bridge.SourceNetworkID,
+		DestinationNetworkID:  bridge.DestinationNetworkID,
+		AssetID:               assetID,
+		Amount:                amount,
+		Legs:                  []BridgeLegEstimate{source, destination},
+		TotalFees:             map[string]float64{},
+		RelaySeconds:          int64(relay.Seconds()),
+		RequiredConfirmations: source.RequiredConfirmations + destination.RequiredConfirmations,
+		EstimatedAt:           time.Now(),
+	}
+	estimate.EstimatedLatency = source.LatencySeconds + estimate.RelaySeconds + destination.LatencySeconds
+
+	for _, leg := range estimate.Legs {
+		estimate.TotalFees[leg.Currency] += leg.Fee
+	}
+	// The bridge operator's fee is charged on the source chain
+	if bridge.Fee != "" {
+		if fee, err := strconv.ParseFloat(bridge.Fee, 64); err == nil {
+			estimate.BridgeFee = fee
+			estimate.TotalFees[source.Currency] += fee
+		}
+	}
+
+	return estimate, nil
+}
+
+// estimateBridgeLeg estimates the transaction a bridge transfer submits on one network
+func (s *BaaSService) estimateBridgeLeg(leg, networkID, bridgeType, txType string, payload map[string]interface{}) BridgeLegEstimate {
+	chainType := s.bridgeNetworkChainType(networkID, bridgeType)
+	fee := EstimateFee(chainType, txType, payload)
+
+	gwei, source := s.currentGasPrice(networkID, chainType)
+	if source != GasPriceModel {
+		fee.GasPriceGwei = gwei
+		fee.Fee = float64(fee.GasUsed) * gwei / 1e9
+	}
+
+	rule := GetFinalityRule(chainType)
+	return BridgeLegEstimate{
+		Leg:                   leg,
+		NetworkID:             networkID,
+		ChainType:             chainType,
+		GasUsed:               fee.GasUsed,
+		GasPriceGwei:          fee.GasPriceGwei,
+		GasPriceSource:        source,
+		Fee:                   fee.Fee,
+		Currency:              fee.Currency,
+		RequiredConfirmations: rule.ConfirmationDepth,
+		LatencySeconds:        int64((time.Duration(rule.ConfirmationDepth) * rule.BlockTime).Seconds()),
+	}
+}
+
+// bridgeNetworkChainType returns the chain type of a bridge endpoint
+// Counterparty networks that are not configured here are inferred from the bridge protocol
+func (s *BaaSService) bridgeNetworkChainType(networkID, bridgeType string) string {
+	if _, exists := s.Networks[networkID]; exists {
+		return s.networkChainType(networkID)
+	}
+	if _, err := s.Config.GetNetworkConfig(networkID); err == nil {
+		return s.networkChainType(networkID)
+	}
+	switch strings.ToLower(bridgeType) {
+	case "ibc":
+		return "cosmos"
+	case "xcm":
+		return "polkadot"
+	}
+	return s.networkChainType(networkID)
+}
+
+// currentGasPrice reads the current gas price of a network in gwei
+// A fixed price in the network config wins, EVM chains are asked over eth_gasPrice
+// The source is GasPriceModel when neither is available
+func (s *BaaSService) currentGasPrice(networkID, chainType string) (float64, string) {
+	var networkConfig *config.NetworkConfig
+	if s.Config != nil {
+		networkConfig, _ = s.Config.GetNetworkConfig(networkID)
+	}
+	if networkConfig != nil && networkConfig.GasPrice != "" && networkConfig.GasPrice != "auto" {
+		if gwei, err := strconv.ParseFloat(networkConfig.GasPrice, 64); err == nil {
+			return gwei, GasPriceConfig
+		}
+	}
+
+	switch strings.ToLower(chainType) {
+	case "ethereum", "polygon", "bsc":
+	default:
+		return 0, GasPriceModel
+	}
+
+	endpoint := ""
+	if network, exists := s.Networks[networkID]; exists {
+		endpoint = network.ActiveEndpoint
+	}
+	if !strings.HasPrefix(endpoint, "http") {
+		return 0, GasPriceModel
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":      1,
+		"jsonrpc": "2.0",
+		"method":  "eth_gasPrice",
+		"params":  []interface{}{},
+	})
+	resp, err := s.HTTPClient.Post(endpoint, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return 0, GasPriceModel
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, GasPriceModel
+	}
+
+	var result struct {
+		Result string `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, GasPriceModel
+	}
+	wei, ok := new(big.Int).SetString(strings.TrimPrefix(result.Result, "0x"), 16)
+	if !ok {
+		return 0, GasPriceModel
+	}
+	gwei, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e9)).Float64()
+	return gwei, GasPriceLive
+}
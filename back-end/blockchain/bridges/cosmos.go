@@ -158,7 +158,7 @@ func (b *CosmosBridge) SendIBCPacket(destinationChainID, channelID string, paylo
 	// Check if the channel exists
 	channel, exists := b.IBCChannels[channelID]
 	if !exists {
-		return "", fmt.Errorf("IBC channel %s does not exist", channelID)
+		return "", fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
 	}
 
 	// Create a unique message ID
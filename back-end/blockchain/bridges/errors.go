@@ -0,0 +1,13 @@
+package bridges
+
+import "errors"
+
+// Errors returned by the bridges; they are wrapped with the ID involved, so compare them with errors.Is
+var (
+	// ErrChannelNotFound is returned for an IBC channel the bridge does not know
+	ErrChannelNotFound = errors.New("IBC channel not found")
+	// ErrAssetNotRegistered is returned for an asset not registered on the XCM bridge
+	ErrAssetNotRegistered = errors.New("asset not registered")
+	// ErrNoRoute is returned when no XCM route leads to the destination chain
+	ErrNoRoute = errors.New("no XCM route")
+)
@@ -113,7 +113,7 @@ func (b *PolkadotBridge) SendXCMMessage(destinationChainID, messageType string,
 	routeID := fmt.Sprintf("%s-%s", b.ChainID, destinationChainID)
 	route, exists := b.XCMRoutes[routeID]
 	if (!exists) {
-		return "", fmt.Errorf("no XCM route found from %s to %s", b.ChainID, destinationChainID)
+		return "", fmt.Errorf("%w from %s to %s", ErrNoRoute, b.ChainID, destinationChainID)
 	}
 	
 	// Determine the destination parachain ID if it's a Polkadot ecosystem chain
@@ -170,7 +170,7 @@ func (b *PolkadotBridge) SendXCMMessage(destinationChainID, messageType string,
 		// Get asset details - FIX: Removed unused variable declaration
 		assetDetails, exists := b.RegisteredAssets[assetID]
 		if !exists {
-			return "", fmt.Errorf("asset %s is not registered", assetID)
+			return "", fmt.Errorf("%w: %s", ErrAssetNotRegistered, assetID)
 		}
 		
 		// Build XCM transfer instructions
@@ -672,7 +672,7 @@ func (b *PolkadotBridge) TransferXCMAsset(recipient, assetID string, amount stri
 	// Check if the asset is registered
 	_, exists := b.RegisteredAssets[assetID]
 	if (!exists) {
-		return "", fmt.Errorf("asset %s is not registered", assetID)
+		return "", fmt.Errorf("%w: %s", ErrAssetNotRegistered, assetID)
 	}
 	
 	// Create the payload for an XCM transfer
@@ -1040,7 +1040,7 @@ func (b *PolkadotBridge) SetMultiLocationForAsset(assetID string, multiLocation
 	// Check if the asset is registered
 	asset, exists := b.RegisteredAssets[assetID]
 	if (!exists) {
-		return fmt.Errorf("asset %s is not registered", assetID)
+		return fmt.Errorf("%w: %s", ErrAssetNotRegistered, assetID)
 	}
 	
 	// Update the multilocation
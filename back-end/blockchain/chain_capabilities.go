@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain/bridges"
+)
+
+// Interop operations a chain must support to be used as a destination
+const (
+	OperationIBC           = "ibc"
+	OperationXCM           = "xcm"
+	OperationNFT           = "nft"
+	OperationSmartContract = "smart_contract"
+)
+
+// ErrCapabilityUnsupported is returned when a chain lacks the capability an operation needs
+var ErrCapabilityUnsupported = errors.New("operation not supported by chain")
+
+// ChainCapabilities describes what a connected chain supports
+type ChainCapabilities struct {
+	ChainType              string    `json:"chain_type"`
+	Protocol               string    `json:"protocol"` // "ibc", "xcm" or "bridge"
+	SupportsNFT            bool      `json:"supports_nft"`
+	SupportsIBC            bool      `json:"supports_ibc"`
+	SupportsXCM            bool      `json:"supports_xcm"`
+	SupportsSmartContracts bool      `json:"supports_smart_contracts"`
+	BlockTimeSeconds       float64   `json:"block_time_seconds"`
+	FinalitySeconds        float64   `json:"finality_seconds"`
+	Reachable              bool      `json:"reachable"`
+	LatestBlock            int64     `json:"latest_block,omitempty"`
+	ProbeError             string    `json:"probe_error,omitempty"`
+	ProbedAt               time.Time `json:"probed_at"`
+}
+
+// chainFamily groups chain types by the adapter that talks to them
+func chainFamily(chainType string) string {
+	switch t := strings.ToLower(chainType); {
+	case strings.Contains(t, "cosmos"), strings.Contains(t, "tendermint"):
+		return "cosmos"
+	case strings.Contains(t, "polkadot"), strings.Contains(t, "substrate"), strings.Contains(t, "kusama"):
+		return "substrate"
+	case strings.Contains(t, "fabric"), strings.Contains(t, "hyperledger"):
+		return "fabric"
+	case t == "ethereum", t == "polygon", t == "bsc", t == "evm", t == "pos", t == "poa":
+		return "evm"
+	}
+	return ""
+}
+
+// DefaultCapabilities returns the capabilities a chain type has by design, before probing
+func DefaultCapabilities(chainType string) ChainCapabilities {
+	caps := ChainCapabilities{ChainType: chainType, Protocol: "bridge"}
+	ruleType := strings.ToLower(chainType)
+
+	switch chainFamily(chainType) {
+	case "cosmos":
+		caps.Protocol = "ibc"
+		caps.SupportsIBC = true
+		caps.SupportsNFT = true            // ICS-721
+		caps.SupportsSmartContracts = true // CosmWasm
+		ruleType = "cosmos"
+	case "substrate":
+		caps.Protocol = "xcm"
+		caps.SupportsXCM = true
+		caps.SupportsNFT = true
+		caps.SupportsSmartContracts = true // pallet-contracts
+		ruleType = "polkadot"
+	case "evm":
+		caps.SupportsNFT = true
+		caps.SupportsSmartContracts = true
+	case "fabric":
+		caps.SupportsSmartContracts = true // chaincode
+		ruleType = "fabric"
+	}
+
+	rule := GetFinalityRule(ruleType)
+	caps.BlockTimeSeconds = rule.BlockTime.Seconds()
+	caps.FinalitySeconds = (time.Duration(rule.FinalizationDepth) * rule.BlockTime).Seconds()
+	return caps
+}
+
+// ProbeChain queries a chain through its adapter and returns its capabilities
+// A chain that cannot be reached keeps the capabilities of its type and reports the probe error
+func ProbeChain(chainType, endpoint string) ChainCapabilities {
+	caps := DefaultCapabilities(chainType)
+	caps.ProbedAt = time.Now()
+
+	var height int64
+	var err error
+	switch chainFamily(chainType) {
+	case "cosmos":
+		height, err = bridges.NewCosmosBridge(endpoint, "", "", "").GetLastBlockHeight()
+	case "substrate":
+		var number uint64
+		number, err = bridges.NewPolkadotBridge(endpoint, "", "", "", "").GetLastBlockNumber()
+		height = int64(number)
+	case "evm":
+		height, err = evmBlockNumber(endpoint)
+	default:
+		err = fmt.Errorf("no adapter can probe chain type %s", chainType)
+	}
+
+	if err != nil {
+		caps.ProbeError = err.Error()
+		return caps
+	}
+	caps.Reachable = true
+	caps.LatestBlock = height
+	return caps
+}
+
+// Supports checks that a chain can be used for an interop operation
+func (caps ChainCapabilities) Supports(operation string) error {
+	var supported bool
+	var requirement string
+	switch operation {
+	case OperationIBC:
+		supported, requirement = caps.SupportsIBC, "IBC requires a Cosmos SDK chain"
+	case OperationXCM:
+		supported, requirement = caps.SupportsXCM, "XCM requires a Substrate chain"
+	case OperationNFT:
+		supported, requirement = caps.SupportsNFT, "NFTs require a chain with an NFT standard"
+	case OperationSmartContract:
+		supported, requirement = caps.SupportsSmartContracts, "smart contracts require a chain with a contract runtime"
+	default:
+		return fmt.Errorf("%w: unknown operation %s", ErrCapabilityUnsupported, operation)
+	}
+	if !supported {
+		return fmt.Errorf("%w: %s, got a %s chain", ErrCapabilityUnsupported, requirement, caps.ChainType)
+	}
+	return nil
+}
+
+// evmBlockNumber reads the latest block of an EVM chain over JSON-RPC
+func evmBlockNumber(endpoint string) (int64, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":      1,
+		"jsonrpc": "2.0",
+		"method":  "eth_blockNumber",
+		"params":  []interface{}{},
+	})
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("node returned status: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result string `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	var height int64
+	if _, err := fmt.Sscanf(result.Result, "0x%x", &height); err != nil {
+		return 0, fmt.Errorf("invalid block number: %s", result.Result)
+	}
+	return height, nil
+}
@@ -344,7 +344,7 @@ func (cic *CosmosInteropClient) GetMessageStatus(messageID string) (string, erro
 		}
 	}
 	
-	return "", errors.New("message not found")
+	return "", fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
 }
 
 // ExportBatchToCosmos exports a batch to a Cosmos zone
@@ -502,7 +502,7 @@ func (cc *CosmosInteropClient) SendIBCPacket(msg bridges.IBCMessage) (string, er
 	// Check if the channel exists
 	_, exists := cc.IBCChannels[msg.SourceChannel]
 	if !exists {
-		return "", fmt.Errorf("IBC channel %s not found", msg.SourceChannel)
+		return "", fmt.Errorf("%w: %s", ErrChannelNotFound, msg.SourceChannel)
 	}
 		// Create an IBC message
 	ibcMessage := &IBCMessage{
@@ -0,0 +1,34 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain/bridges"
+)
+
+// Domain errors of the blockchain layer. Functions wrap them with the ID involved, e.g.
+// fmt.Errorf("%w: %s", ErrNetworkNotConfigured, networkID), so callers compare them with errors.Is
+// instead of matching messages
+var (
+	// ErrNetworkNotConfigured is returned for a BaaS network that is not configured or has no endpoint
+	ErrNetworkNotConfigured = errors.New("network not configured")
+	// ErrTxNotFound is returned when a network does not know a transaction
+	ErrTxNotFound = errors.New("transaction not found")
+	// ErrBridgeMissing is returned for a cross-chain bridge that is not configured or not known to the provider
+	ErrBridgeMissing = errors.New("bridge not found")
+	// ErrMessageNotFound is returned for an interop message that is not in the queue
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrDIDNotFound is returned for a DID that is not registered
+	ErrDIDNotFound = errors.New("DID not found")
+	// ErrKeyNotFound is returned for a key the HSM does not hold
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrValidatorNotFound is returned for a validator that is not registered
+	ErrValidatorNotFound = errors.New("validator not found")
+
+	// ErrChannelNotFound is returned for an unknown IBC channel, by this package and the bridges
+	ErrChannelNotFound = bridges.ErrChannelNotFound
+	// ErrAssetNotRegistered is returned for an asset not registered on an XCM bridge
+	ErrAssetNotRegistered = bridges.ErrAssetNotRegistered
+	// ErrNoRoute is returned when no XCM route leads to the destination chain
+	ErrNoRoute = bridges.ErrNoRoute
+)
@@ -0,0 +1,113 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrBudgetExceeded is returned when an on-chain operation would exceed the payer's budget
+var ErrBudgetExceeded = errors.New("on-chain budget exceeded")
+
+// TransactionFee describes the gas and fee consumed by an on-chain operation
+type TransactionFee struct {
+	TxID         string                 `json:"tx_id"`
+	TxType       string                 `json:"tx_type"`
+	ChainType    string                 `json:"chain_type"`
+	GasUsed      int64                  `json:"gas_used"`
+	GasPriceGwei float64                `json:"gas_price_gwei"`
+	Fee          float64                `json:"fee"`
+	Currency     string                 `json:"currency"`
+	Payload      map[string]interface{} `json:"-"`
+	SubmittedAt  time.Time              `json:"submitted_at"`
+}
+
+// FeeAccountant records fees and enforces budgets for on-chain operations
+type FeeAccountant interface {
+	// CheckBudget is called before submission and may reject the operation
+	CheckBudget(fee TransactionFee) error
+	// RecordFee is called after a successful submission
+	RecordFee(fee TransactionFee)
+}
+
+// feeAccountant is the accountant used by all clients, nil when fee accounting is disabled
+var feeAccountant FeeAccountant
+
+// SetFeeAccountant installs the accountant used for every on-chain operation
+func SetFeeAccountant(accountant FeeAccountant) {
+	feeAccountant = accountant
+}
+
+// chainGasPrice holds the gas price in gwei and the native currency per chain type
+var chainGasPrice = map[string]struct {
+	Gwei     float64
+	Currency string
+}{
+	"ethereum":   {30, "ETH"},
+	"polygon":    {50, "MATIC"},
+	"bsc":        {3, "BNB"},
+	"pos":        {5, "TPC"},
+	"poa":        {1, "TPC"},
+	"tendermint": {0.025, "ATOM"},
+	"cosmos":     {0.025, "ATOM"},
+	"polkadot":   {300, "DOT"},
+	"substrate":  {300, "DOT"},
+	"fabric":     {0, "TPC"},
+}
+
+// Gas costs used by the fee model
+const (
+	baseTxGas          = 21000   // intrinsic cost of any transaction
+	calldataGasPerByte = 16      // cost per payload byte
+	storageWriteGas    = 20000   // anchoring writes one storage slot
+	nftMintGas         = 150000  // minting an ERC-721 token
+	contractDeployGas  = 1500000 // deploying a contract
+)
+
+// EstimateFee computes the gas and fee for an operation on a chain type
+func EstimateFee(chainType, txType string, payload map[string]interface{}) TransactionFee {
+	price, ok := chainGasPrice[strings.ToLower(chainType)]
+	if !ok {
+		price = chainGasPrice["poa"]
+	}
+
+	gas := int64(baseTxGas + storageWriteGas)
+	if data, err := json.Marshal(payload); err == nil {
+		gas += int64(len(data)) * calldataGasPerByte
+	}
+	switch upper := strings.ToUpper(txType); {
+	case strings.Contains(upper, "MINT"):
+		gas += nftMintGas
+	case strings.HasPrefix(upper, "DEPLOY"):
+		gas += contractDeployGas
+	}
+
+	return TransactionFee{
+		TxType:       txType,
+		ChainType:    chainType,
+		GasUsed:      gas,
+		GasPriceGwei: price.Gwei,
+		Fee:          float64(gas) * price.Gwei / 1e9,
+		Currency:     price.Currency,
+		Payload:      payload,
+		SubmittedAt:  time.Now(),
+	}
+}
+
+// checkFeeBudget asks the accountant whether an operation may be submitted
+func checkFeeBudget(fee TransactionFee) error {
+	if feeAccountant == nil {
+		return nil
+	}
+	return feeAccountant.CheckBudget(fee)
+}
+
+// recordFee hands the fee of a submitted operation to the accountant
+func recordFee(fee TransactionFee, txID string) {
+	if feeAccountant == nil {
+		return
+	}
+	fee.TxID = txID
+	feeAccountant.RecordFee(fee)
+}
@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Confirmation statuses tracked for anchored records
+const (
+	ConfirmationPending   = "pending"
+	ConfirmationConfirmed = "confirmed"
+	ConfirmationFinalized = "finalized"
+	ConfirmationDropped   = "dropped"
+)
+
+// FinalityRule describes how many blocks a chain needs before a transaction is trusted
+type FinalityRule struct {
+	BlockTime         time.Duration `json:"block_time"`
+	ConfirmationDepth int64         `json:"confirmation_depth"`
+	FinalizationDepth int64         `json:"finalization_depth"`
+	InstantFinality   bool          `json:"instant_finality"`
+}
+
+// finalityRules holds the block depths per chain type
+// BFT style consensus finalizes a block as soon as it is committed
+var finalityRules = map[string]FinalityRule{
+	"ethereum":   {BlockTime: 12 * time.Second, ConfirmationDepth: 12, FinalizationDepth: 64},
+	"polygon":    {BlockTime: 2 * time.Second, ConfirmationDepth: 32, FinalizationDepth: 256},
+	"bsc":        {BlockTime: 3 * time.Second, ConfirmationDepth: 15, FinalizationDepth: 30},
+	"pos":        {BlockTime: 6 * time.Second, ConfirmationDepth: 6, FinalizationDepth: 32},
+	"poa":        {BlockTime: 5 * time.Second, ConfirmationDepth: 3, FinalizationDepth: 12},
+	"tendermint": {BlockTime: 6 * time.Second, ConfirmationDepth: 1, FinalizationDepth: 1, InstantFinality: true},
+	"cosmos":     {BlockTime: 6 * time.Second, ConfirmationDepth: 1, FinalizationDepth: 1, InstantFinality: true},
+	"polkadot":   {BlockTime: 6 * time.Second, ConfirmationDepth: 2, FinalizationDepth: 3},
+	"substrate":  {BlockTime: 6 * time.Second, ConfirmationDepth: 2, FinalizationDepth: 3},
+	"fabric":     {BlockTime: 2 * time.Second, ConfirmationDepth: 1, FinalizationDepth: 1, InstantFinality: true},
+}
+
+// defaultFinalityRule is used for chain types without a known rule
+var defaultFinalityRule = FinalityRule{BlockTime: 5 * time.Second, ConfirmationDepth: 6, FinalizationDepth: 12}
+
+// GetFinalityRule returns the finality rule for a chain type
+func GetFinalityRule(chainType string) FinalityRule {
+	if rule, ok := finalityRules[strings.ToLower(chainType)]; ok {
+		return rule
+	}
+	return defaultFinalityRule
+}
+
+// ConfirmationStatus maps a number of confirmations to a status for the given chain type
+func ConfirmationStatus(chainType string, confirmations int64) string {
+	rule := GetFinalityRule(chainType)
+	switch {
+	case confirmations >= rule.FinalizationDepth:
+		return ConfirmationFinalized
+	case confirmations >= rule.ConfirmationDepth:
+		return ConfirmationConfirmed
+	default:
+		return ConfirmationPending
+	}
+}
+
+// TransactionReceipt describes where a transaction was included on chain
+type TransactionReceipt struct {
+	TxID        string `json:"tx_id"`
+	Found       bool   `json:"found"`
+	BlockNumber int64  `json:"block_number,omitempty"`
+}
+
+// mockGenesis anchors the block heights of the mock ledger
+var mockGenesis = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// mockBlockAt returns the mock block height at a point in time
+func (bc *BlockchainClient) mockBlockAt(t time.Time) int64 {
+	rule := GetFinalityRule(bc.ConsensusType)
+	return int64(t.Sub(mockGenesis) / rule.BlockTime)
+}
+
+// GetLatestBlockNumber returns the current head of the chain
+func (bc *BlockchainClient) GetLatestBlockNumber() (int64, error) {
+	// In a real implementation, this would call eth_blockNumber or the equivalent RPC
+	return bc.mockBlockAt(time.Now()), nil
+}
+
+// GetTransactionReceipt looks up the block a transaction was included in
+// A receipt that is not found means the transaction was never mined or was dropped by a reorg
+func (bc *BlockchainClient) GetTransactionReceipt(txID string) (*TransactionReceipt, error) {
+	receipt := &TransactionReceipt{TxID: txID}
+
+	// In a real implementation, this would call eth_getTransactionReceipt or the equivalent RPC.
+	// The mock ledger issues IDs of the form tx_<TYPE>_<unixnano> and includes them
+	// in the block produced at submission time; older IDs without a timestamp are
+	// treated as buried at the start of the chain.
+	if !strings.HasPrefix(txID, "tx_") && !strings.HasPrefix(txID, "0x") {
+		return receipt, nil
+	}
+	receipt.Found = true
+	receipt.BlockNumber = 1
+
+	sep := strings.LastIndex(txID, "_")
+	if nanos, err := strconv.ParseInt(txID[sep+1:], 10, 64); err == nil && sep > 0 {
+		receipt.BlockNumber = bc.mockBlockAt(time.Unix(0, nanos))
+	}
+	return receipt, nil
+}
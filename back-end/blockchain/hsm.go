@@ -294,7 +294,7 @@ func (h *HSMService) signSoftware(keyID string, data []byte) ([]byte, error) {
 	h.mutex.RUnlock()
 	
 	if !ok {
-		return nil, fmt.Errorf("key not found: %s", keyID)
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
 	}
 	
 	ecdsaKey, ok := privateKey.(*ecdsa.PrivateKey)
@@ -391,7 +391,7 @@ func (h *HSMService) verifySoftware(keyID string, data, signature []byte) (bool,
 	h.mutex.RUnlock()
 	
 	if !ok {
-		return false, fmt.Errorf("key not found: %s", keyID)
+		return false, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
 	}
 	
 	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
@@ -483,7 +483,7 @@ func (h *HSMService) getPublicKeySoftware(keyID string) ([]byte, error) {
 	h.mutex.RUnlock()
 	
 	if !ok {
-		return nil, fmt.Errorf("key not found: %s", keyID)
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
 	}
 	
 	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
@@ -701,7 +701,7 @@ func (h *HSMService) deleteSoftwareKey(keyID string) error {
 	defer h.mutex.Unlock()
 	
 	if _, ok := h.keyCache[keyID]; !ok {
-		return fmt.Errorf("key not found: %s", keyID)
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
 	}
 	
 	delete(h.keyCache, keyID)
@@ -182,7 +182,7 @@ func (ic *IdentityClient) ResolveDIDFromDB(did string) (*DecentralizedID, error)
 	
 	// Check if DID was found
 	if result == nil {
-		return nil, fmt.Errorf("DID not found: %s", did)
+		return nil, fmt.Errorf("%w: %s", ErrDIDNotFound, did)
 	}
 	
 	// Parse the result into DecentralizedID
@@ -257,13 +257,13 @@ func (ic *IdentityClient) CreateVerifiableClaim(
 	// Resolve issuer DID
 	_, err := ic.ResolveDID(issuerDID)
 	if err != nil {
-		return nil, fmt.Errorf("issuer DID not found: %v", err)
+		return nil, fmt.Errorf("issuer DID not found: %w", err)
 	}
 	
 	// Resolve subject DID
 	_, err = ic.ResolveDID(subjectDID)
 	if err != nil {
-		return nil, fmt.Errorf("subject DID not found: %v", err)
+		return nil, fmt.Errorf("subject DID not found: %w", err)
 	}
 	
 	// Create claim
@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Protocols an inbound cross-chain message can arrive through
+const (
+	InboundProtocolIBC    = "ibc"
+	InboundProtocolXCM    = "xcm"
+	InboundProtocolBridge = "bridge"
+)
+
+// InboundMessage is a cross-chain packet addressed to this chain, as delivered by a relayer
+type InboundMessage struct {
+	Protocol           string                 `json:"protocol"`
+	SourceChainID      string                 `json:"source_chain_id"`
+	DestinationChainID string                 `json:"destination_chain_id"`
+	MessageID          string                 `json:"message_id"`
+	MessageType        string                 `json:"message_type"`
+	SourceChannel      string                 `json:"source_channel,omitempty"`
+	DestinationChannel string                 `json:"destination_channel,omitempty"`
+	Sequence           uint64                 `json:"sequence,omitempty"`
+	Payload            map[string]interface{} `json:"payload"`
+	Proof              string                 `json:"proof"`
+	ProofHeight        uint64                 `json:"proof_height,omitempty"`
+	TimeoutTimestamp   int64                  `json:"timeout_timestamp,omitempty"`
+}
+
+// InboundCommitment computes the commitment a relayer proves for an inbound message
+// Like an IBC packet commitment it binds the routing fields and the hash of the payload
+func InboundCommitment(msg *InboundMessage) (string, error) {
+	payload, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode payload: %w", err)
+	}
+	payloadHash := sha256.Sum256(payload)
+
+	hash := sha256.New()
+	for _, field := range []string{msg.Protocol, msg.SourceChainID, msg.SourceChannel, msg.DestinationChannel, msg.MessageID, msg.MessageType} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	sequence := make([]byte, 8)
+	binary.BigEndian.PutUint64(sequence, msg.Sequence)
+	hash.Write(sequence)
+	hash.Write(payloadHash[:])
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// VerifyInboundMessage checks that an inbound message is addressed to this chain and carries a valid proof
+func (ic *InteroperabilityClient) VerifyInboundMessage(msg *InboundMessage) error {
+	switch msg.Protocol {
+	case InboundProtocolIBC:
+		if msg.SourceChannel == "" || msg.DestinationChannel == "" {
+			return errors.New("IBC messages require source and destination channels")
+		}
+	case InboundProtocolXCM, InboundProtocolBridge:
+	default:
+		return fmt.Errorf("unsupported inbound protocol: %s", msg.Protocol)
+	}
+	if msg.SourceChainID == "" || msg.MessageID == "" || msg.MessageType == "" {
+		return errors.New("source_chain_id, message_id and message_type are required")
+	}
+	if msg.DestinationChainID != "" && msg.DestinationChainID != ic.BaseClient.BlockchainChainID {
+		return fmt.Errorf("message is addressed to %s, not this chain", msg.DestinationChainID)
+	}
+	if msg.TimeoutTimestamp > 0 && time.Now().Unix() > msg.TimeoutTimestamp {
+		return errors.New("message timed out before it was received")
+	}
+
+	// In a real implementation the proof is checked against the counterparty's
+	// light client state; the mock chain accepts the packet commitment itself
+	commitment, err := InboundCommitment(msg)
+	if err != nil {
+		return err
+	}
+	if strings.TrimPrefix(msg.Proof, "0x") != commitment {
+		return errors.New("invalid proof for message")
+	}
+	return nil
+}
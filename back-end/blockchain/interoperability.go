@@ -14,6 +14,7 @@ import (
 	"time"
 	
 	"github.com/LTPPPP/TracePost-larvaeChain/blockchain/bridges"
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain/standards"
 )
 
 // InteroperabilityClient provides cross-chain communication capabilities
@@ -225,6 +226,11 @@ func (ic *InteroperabilityClient) RegisterStandardConverter(standardName string,
 	ic.StandardsConverters[standardName] = converter
 }
 
+// RegisterTransformer registers a data standard transformer as a converter under its standard name
+func (ic *InteroperabilityClient) RegisterTransformer(transformer standards.Transformer) {
+	ic.RegisterStandardConverter(transformer.Standard(), transformer.Transform)
+}
+
 // SendCrossChainTransaction sends a transaction to another blockchain
 func (ic *InteroperabilityClient) SendCrossChainTransaction(
 	destChainID string, 
@@ -444,31 +450,8 @@ func (ic *InteroperabilityClient) sendViaSubstrate(destChainID, txType string, p
 }
 
 // ConvertToGS1EPCIS converts TracePost-larvaeChain data to GS1 EPCIS standard
-// This is a basic implementation - a real one would be more comprehensive
 func ConvertToGS1EPCIS(data map[string]interface{}) (map[string]interface{}, error) {
-	epcisEvent := map[string]interface{}{
-		"eventTime": time.Now().Format(time.RFC3339),
-		"eventTimeZoneOffset": "+07:00", // Vietnam timezone
-		"epcList": []string{},
-		"action": "OBSERVE",
-		"bizStep": "urn:epcglobal:cbv:bizstep:commissioning",
-		"disposition": "urn:epcglobal:cbv:disp:active",
-		"readPoint": map[string]interface{}{
-			"id": fmt.Sprintf("urn:epc:id:sgln:%v", data["location"]),
-		},
-	}
-	
-	// Convert batch ID to GS1 SGTIN (Serialized Global Trade Item Number)
-	if batchID, ok := data["batch_id"].(string); ok {
-		sgtin := fmt.Sprintf("urn:epc:id:sgtin:0614141.%s", batchID)
-		epcisEventList := []string{sgtin}
-		epcisEvent["epcList"] = epcisEventList
-	}
-	
-	// Add all original data as extension elements
-	epcisEvent["tracepostExtension"] = data
-	
-	return epcisEvent, nil
+	return standards.Transform(standards.GS1EPCIS, data)
 }
 
 // VerifyCrossChainTransaction verifies a cross-chain transaction on the destination chain
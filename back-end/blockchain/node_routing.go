@@ -0,0 +1,29 @@
+package blockchain
+
+import "sync"
+
+var (
+	nodeRoutesMu sync.RWMutex
+	nodeRoutes   = map[string]string{} // Configured node URL to the node its clients are sent to while it is unhealthy
+)
+
+// RouteNode sends clients created for a configured node to another node; an empty or equal active node routes them back
+func RouteNode(configured, active string) {
+	nodeRoutesMu.Lock()
+	defer nodeRoutesMu.Unlock()
+	if active == "" || active == configured {
+		delete(nodeRoutes, configured)
+		return
+	}
+	nodeRoutes[configured] = active
+}
+
+// ActiveNodeURL returns the node clients created for a node URL are sent to
+func ActiveNodeURL(nodeURL string) string {
+	nodeRoutesMu.RLock()
+	defer nodeRoutesMu.RUnlock()
+	if active, ok := nodeRoutes[nodeURL]; ok {
+		return active
+	}
+	return nodeURL
+}
@@ -0,0 +1,202 @@
+package blockchain
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNonceMismatch is returned by a submission the chain rejected because of its nonce or sequence
+var ErrNonceMismatch = errors.New("nonce or sequence mismatch")
+
+// NonceStore allocates nonces of signing accounts, shared by every process submitting for them
+type NonceStore interface {
+	// Allocate takes the lowest released nonce of an account, or its next one, never below floor
+	Allocate(chain, account string, floor uint64) (uint64, error)
+	// Release gives back a nonce that was not used so the next allocation fills the gap
+	Release(chain, account string, nonce uint64) error
+	// Reset moves the next nonce of an account to the chain's and forgets older gaps
+	Reset(chain, account string, next uint64) error
+}
+
+// NonceFetcher returns the next nonce the chain expects from an account, 0 when the chain cannot tell
+type NonceFetcher func(account string) (uint64, error)
+
+// NonceManager hands out nonces per chain and signing account so concurrent submissions never collide
+type NonceManager struct {
+	store NonceStore
+
+	mu       sync.Mutex
+	accounts map[string]*sync.Mutex
+	synced   map[string]bool // Accounts whose nonce was checked against the chain by this process
+}
+
+var defaultNonceManager = NewNonceManager(newMemoryNonceStore())
+
+// NewNonceManager creates a nonce manager on top of a store
+func NewNonceManager(store NonceStore) *NonceManager {
+	return &NonceManager{
+		store:    store,
+		accounts: map[string]*sync.Mutex{},
+		synced:   map[string]bool{},
+	}
+}
+
+// SetNonceStore installs the store the nonces of every client are allocated from
+func SetNonceStore(store NonceStore) {
+	defaultNonceManager = NewNonceManager(store)
+}
+
+// DefaultNonceManager returns the nonce manager used by all outbound transaction paths
+func DefaultNonceManager() *NonceManager {
+	return defaultNonceManager
+}
+
+// lock serializes allocations of an account within the process
+func (m *NonceManager) lock(key string) func() {
+	m.mu.Lock()
+	accountMu, ok := m.accounts[key]
+	if !ok {
+		accountMu = &sync.Mutex{}
+		m.accounts[key] = accountMu
+	}
+	m.mu.Unlock()
+
+	accountMu.Lock()
+	return accountMu.Unlock
+}
+
+// reserve allocates the next nonce of an account, first syncing with the chain if this process has not yet
+func (m *NonceManager) reserve(chain, account string, fetch NonceFetcher, resync bool) (uint64, error) {
+	key := strings.ToLower(chain) + "|" + strings.ToLower(account)
+	unlock := m.lock(key)
+	defer unlock()
+
+	m.mu.Lock()
+	synced := m.synced[key]
+	m.mu.Unlock()
+
+	var floor uint64
+	if (resync || !synced) && fetch != nil {
+		next, err := fetch(account)
+		if err != nil {
+			return 0, err
+		}
+		if resync && next > 0 {
+			if err := m.store.Reset(chain, account, next); err != nil {
+				return 0, err
+			}
+		}
+		floor = next
+		m.mu.Lock()
+		m.synced[key] = true
+		m.mu.Unlock()
+	}
+	return m.store.Allocate(chain, account, floor)
+}
+
+// Submit runs a submission with a reserved nonce. A nonce the chain rejects as out of sequence is
+// resynced from the chain and the submission retried once; a nonce left unused by a failed submission
+// is released so the account does not stall on the gap.
+func (m *NonceManager) Submit(chain, account string, fetch NonceFetcher, submit func(nonce uint64) error) error {
+	for attempt := 0; ; attempt++ {
+		nonce, err := m.reserve(chain, account, fetch, attempt > 0)
+		if err != nil {
+			return err
+		}
+		err = submit(nonce)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrNonceMismatch) {
+			if releaseErr := m.store.Release(chain, account, nonce); releaseErr != nil {
+				return errors.Join(err, releaseErr)
+			}
+			return err
+		}
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+// memoryNonceStore keeps nonces in process memory, used when no persistent store is installed
+type memoryNonceStore struct {
+	mu       sync.Mutex
+	accounts map[string]*memoryNonces
+}
+
+// memoryNonces is the allocation state of one account
+type memoryNonces struct {
+	next uint64
+	gaps []uint64
+}
+
+func newMemoryNonceStore() *memoryNonceStore {
+	return &memoryNonceStore{accounts: map[string]*memoryNonces{}}
+}
+
+func (s *memoryNonceStore) get(chain, account string) *memoryNonces {
+	key := strings.ToLower(chain) + "|" + strings.ToLower(account)
+	state, ok := s.accounts[key]
+	if !ok {
+		state = &memoryNonces{}
+		s.accounts[key] = state
+	}
+	return state
+}
+
+// Allocate takes the lowest gap at or above floor, or the next nonce
+func (s *memoryNonceStore) Allocate(chain, account string, floor uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.get(chain, account)
+
+	gaps := state.gaps[:0]
+	for _, gap := range state.gaps {
+		if gap >= floor {
+			gaps = append(gaps, gap)
+		}
+	}
+	state.gaps = gaps
+	if len(state.gaps) > 0 {
+		nonce := state.gaps[0]
+		state.gaps = state.gaps[1:]
+		return nonce, nil
+	}
+	if state.next < floor {
+		state.next = floor
+	}
+	nonce := state.next
+	state.next++
+	return nonce, nil
+}
+
+// Release records an unused nonce as a gap
+func (s *memoryNonceStore) Release(chain, account string, nonce uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.get(chain, account)
+	if nonce >= state.next {
+		return nil
+	}
+	for _, gap := range state.gaps {
+		if gap == nonce {
+			return nil
+		}
+	}
+	state.gaps = append(state.gaps, nonce)
+	sort.Slice(state.gaps, func(i, j int) bool { return state.gaps[i] < state.gaps[j] })
+	return nil
+}
+
+// Reset moves the next nonce to the chain's
+func (s *memoryNonceStore) Reset(chain, account string, next uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.get(chain, account)
+	state.next = next
+	state.gaps = nil
+	return nil
+}
@@ -0,0 +1,281 @@
+package blockchain
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Algorithms used for encrypted cross-chain payloads
+const (
+	PayloadContentAlgorithm = "A256GCM"
+	PayloadKeyAlgorithm     = "ECDH-ES+A256GCM"
+)
+
+// PayloadRecipient is a party that can decrypt a shared payload, identified by its DID
+type PayloadRecipient struct {
+	DID       string
+	PublicKey string // Hex encoded uncompressed P-256 point from the DID document
+}
+
+// WrappedKey is the payload data key encrypted to one recipient
+type WrappedKey struct {
+	RecipientDID       string `json:"recipient_did"`
+	Algorithm          string `json:"algorithm"`
+	EphemeralPublicKey string `json:"ephemeral_public_key"`
+	Nonce              string `json:"nonce"`
+	WrappedKey         string `json:"wrapped_key"`
+}
+
+// EncryptedPayload is a payload encrypted with a random data key that is wrapped for each recipient
+type EncryptedPayload struct {
+	Algorithm   string       `json:"algorithm"`
+	Nonce       string       `json:"nonce"`
+	Ciphertext  string       `json:"ciphertext"`
+	PayloadHash string       `json:"payload_hash"` // HMAC-SHA256 of the plaintext under a key derived from the data key, so only recipients can check it
+	Recipients  []WrappedKey `json:"recipients"`
+}
+
+// ToMap returns the envelope in the form sent to another chain
+func (p *EncryptedPayload) ToMap() map[string]interface{} {
+	recipients := make([]map[string]interface{}, 0, len(p.Recipients))
+	for _, r := range p.Recipients {
+		recipients = append(recipients, map[string]interface{}{
+			"recipient_did":        r.RecipientDID,
+			"algorithm":            r.Algorithm,
+			"ephemeral_public_key": r.EphemeralPublicKey,
+			"nonce":                r.Nonce,
+			"wrapped_key":          r.WrappedKey,
+		})
+	}
+	return map[string]interface{}{
+		"encrypted":    true,
+		"algorithm":    p.Algorithm,
+		"nonce":        p.Nonce,
+		"ciphertext":   p.Ciphertext,
+		"payload_hash": p.PayloadHash,
+		"recipients":   recipients,
+	}
+}
+
+// EncryptPayload encrypts a payload so that only the given recipients can read it
+// The data key is wrapped for each recipient with a key agreed from an ephemeral P-256 key and the recipient's DID key
+func EncryptPayload(payload map[string]interface{}, recipients []PayloadRecipient) (*EncryptedPayload, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("at least one recipient is required")
+	}
+
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	nonce, ciphertext, err := sealAESGCM(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	// An unkeyed hash of the plaintext would let anyone confirm a guessed payload, so it is keyed by the data key
+	hash, err := payloadHash(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := &EncryptedPayload{
+		Algorithm:   PayloadContentAlgorithm,
+		Nonce:       base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext:  base64.StdEncoding.EncodeToString(ciphertext),
+		PayloadHash: hex.EncodeToString(hash),
+	}
+	for _, recipient := range recipients {
+		wrapped, err := wrapDataKey(dataKey, recipient)
+		if err != nil {
+			return nil, err
+		}
+		encrypted.Recipients = append(encrypted.Recipients, *wrapped)
+	}
+	return encrypted, nil
+}
+
+// DecryptPayload decrypts a payload with the private key of one of its recipients
+func DecryptPayload(encrypted *EncryptedPayload, recipientDID string, privateKey *ecdh.PrivateKey) (map[string]interface{}, error) {
+	var wrapped *WrappedKey
+	for i := range encrypted.Recipients {
+		if encrypted.Recipients[i].RecipientDID == recipientDID {
+			wrapped = &encrypted.Recipients[i]
+			break
+		}
+	}
+	if wrapped == nil {
+		return nil, fmt.Errorf("payload is not encrypted to %s", recipientDID)
+	}
+
+	ephemeralBytes, err := hex.DecodeString(wrapped.EphemeralPublicKey)
+	if err != nil {
+		return nil, errors.New("invalid ephemeral public key")
+	}
+	ephemeralKey, err := ecdh.P256().NewPublicKey(ephemeralBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral public key: %w", err)
+	}
+	sharedSecret, err := privateKey.ECDH(ephemeralKey)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := deriveKeyEncryptionKey(sharedSecret, ephemeralBytes, recipientDID)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := openAESGCM(kek, wrapped.Nonce, wrapped.WrappedKey)
+	if err != nil {
+		return nil, errors.New("failed to unwrap data key")
+	}
+	plaintext, err := openAESGCM(dataKey, encrypted.Nonce, encrypted.Ciphertext)
+	if err != nil {
+		return nil, errors.New("failed to decrypt payload")
+	}
+	if err := checkPayloadHash(dataKey, plaintext, encrypted.PayloadHash); err != nil {
+		return nil, err
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, fmt.Errorf("invalid decrypted payload: %w", err)
+	}
+	return payload, nil
+}
+
+// payloadHash is the HMAC-SHA256 of the plaintext under a key derived from the data key
+func payloadHash(dataKey, plaintext []byte) ([]byte, error) {
+	hashKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, dataKey, nil, []byte(PayloadContentAlgorithm+"|payload_hash")), hashKey); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, hashKey)
+	mac.Write(plaintext)
+	return mac.Sum(nil), nil
+}
+
+// checkPayloadHash checks the decrypted plaintext against the hash of the envelope.
+// Shares made before the hash was keyed carry the plain SHA-256 of the plaintext, which is still accepted
+func checkPayloadHash(dataKey, plaintext []byte, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	want, err := hex.DecodeString(expected)
+	if err != nil {
+		return errors.New("invalid payload hash")
+	}
+	keyed, err := payloadHash(dataKey, plaintext)
+	if err != nil {
+		return err
+	}
+	legacy := sha256.Sum256(plaintext)
+	if !hmac.Equal(keyed, want) && !hmac.Equal(legacy[:], want) {
+		return errors.New("decrypted payload does not match its hash")
+	}
+	return nil
+}
+
+// wrapDataKey encrypts the data key to a recipient's public key
+func wrapDataKey(dataKey []byte, recipient PayloadRecipient) (*WrappedKey, error) {
+	publicKeyBytes, err := hex.DecodeString(strings.TrimPrefix(recipient.PublicKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key for %s", recipient.DID)
+	}
+	publicKey, err := ecdh.P256().NewPublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("public key for %s is not a P-256 key: %w", recipient.DID, err)
+	}
+
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := ephemeral.ECDH(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralBytes := ephemeral.PublicKey().Bytes()
+	kek, err := deriveKeyEncryptionKey(sharedSecret, ephemeralBytes, recipient.DID)
+	if err != nil {
+		return nil, err
+	}
+	nonce, wrapped, err := sealAESGCM(kek, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WrappedKey{
+		RecipientDID:       recipient.DID,
+		Algorithm:          PayloadKeyAlgorithm,
+		EphemeralPublicKey: hex.EncodeToString(ephemeralBytes),
+		Nonce:              base64.StdEncoding.EncodeToString(nonce),
+		WrappedKey:         base64.StdEncoding.EncodeToString(wrapped),
+	}, nil
+}
+
+// deriveKeyEncryptionKey derives the key that wraps the data key, bound to the ephemeral key and the recipient DID
+func deriveKeyEncryptionKey(sharedSecret, ephemeralPublicKey []byte, recipientDID string) ([]byte, error) {
+	info := append([]byte(PayloadKeyAlgorithm+"|"+recipientDID+"|"), ephemeralPublicKey...)
+	kek := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, nil, info), kek); err != nil {
+		return nil, err
+	}
+	return kek, nil
+}
+
+// sealAESGCM encrypts data with AES-GCM under a fresh random nonce
+func sealAESGCM(key, plaintext []byte) ([]byte, []byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, nil), nil
+}
+
+// openAESGCM decrypts base64 encoded AES-GCM ciphertext
+func openAESGCM(key []byte, nonceB64, ciphertextB64 string) ([]byte, error) {
+	nonce, err := base64.StdEncoding.DecodeString(nonceB64)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid nonce length")
+	}
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
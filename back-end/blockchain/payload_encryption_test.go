@@ -0,0 +1,58 @@
+package blockchain
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+// testRecipient creates a recipient with a fresh P-256 key
+func testRecipient(t *testing.T, did string) (PayloadRecipient, *ecdh.PrivateKey) {
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return PayloadRecipient{DID: did, PublicKey: hex.EncodeToString(private.PublicKey().Bytes())}, private
+}
+
+func TestEncryptPayloadHashIsKeyed(t *testing.T) {
+	recipient, private := testRecipient(t, "did:example:importer")
+	payload := map[string]interface{}{"batch_id": float64(7), "species": "P. vannamei"}
+
+	encrypted, err := EncryptPayload(payload, []PayloadRecipient{recipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The hash of a guessed plaintext must not match the published hash
+	plaintext, _ := json.Marshal(payload)
+	unkeyed := sha256.Sum256(plaintext)
+	if encrypted.PayloadHash == hex.EncodeToString(unkeyed[:]) {
+		t.Fatal("payload hash is the unkeyed SHA-256 of the plaintext")
+	}
+
+	decrypted, err := DecryptPayload(encrypted, recipient.DID, private)
+	if err != nil {
+		t.Fatalf("recipient failed to decrypt: %v", err)
+	}
+	if decrypted["species"] != "P. vannamei" {
+		t.Fatalf("unexpected payload %v", decrypted)
+	}
+}
+
+func TestDecryptPayloadChecksHash(t *testing.T) {
+	recipient, private := testRecipient(t, "did:example:importer")
+	encrypted, err := EncryptPayload(map[string]interface{}{"batch_id": float64(7)}, []PayloadRecipient{recipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := sha256.Sum256([]byte(`{"batch_id":8}`))
+	encrypted.PayloadHash = hex.EncodeToString(other[:])
+	if _, err := DecryptPayload(encrypted, recipient.DID, private); err == nil {
+		t.Fatal("expected a payload whose hash does not match to be refused")
+	}
+}
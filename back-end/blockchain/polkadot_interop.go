@@ -304,7 +304,7 @@ func (pic *PolkadotInteropClient) GetMessageStatus(messageID string) (string, er
 		}
 	}
 	
-	return "", errors.New("message not found")
+	return "", fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
 }
 
 // ExportBatchToPolkadot exports a batch to a Polkadot parachain
@@ -118,7 +118,7 @@ func (vs *PosValidatorSet) UpdateStake(address string, newStake *big.Int) error
 	// Check if validator exists
 	validator, exists := vs.Validators[address]
 	if !exists {
-		return fmt.Errorf("validator with address %s does not exist", address)
+		return fmt.Errorf("%w: %s", ErrValidatorNotFound, address)
 	}
 
 	// Check minimum stake
@@ -149,7 +149,7 @@ func (vs *PosValidatorSet) RemoveValidator(address string) error {
 	// Check if validator exists
 	validator, exists := vs.Validators[address]
 	if !exists {
-		return fmt.Errorf("validator with address %s does not exist", address)
+		return fmt.Errorf("%w: %s", ErrValidatorNotFound, address)
 	}
 
 	// Update total stake
@@ -177,7 +177,7 @@ func (vs *PosValidatorSet) GetValidator(address string) (*Validator, error) {
 
 	validator, exists := vs.Validators[address]
 	if !exists {
-		return nil, fmt.Errorf("validator with address %s does not exist", address)
+		return nil, fmt.Errorf("%w: %s", ErrValidatorNotFound, address)
 	}
 
 	return validator, nil
@@ -238,7 +238,7 @@ func (vs *PosValidatorSet) SlashValidator(address string, reason string) error {
 	// Check if validator exists
 	validator, exists := vs.Validators[address]
 	if !exists {
-		return fmt.Errorf("validator with address %s does not exist", address)
+		return fmt.Errorf("%w: %s", ErrValidatorNotFound, address)
 	}
 
 	// Calculate slash amount
@@ -276,7 +276,7 @@ func (vs *PosValidatorSet) UnjailValidator(address string) error {
 	// Check if validator exists
 	validator, exists := vs.Validators[address]
 	if !exists {
-		return fmt.Errorf("validator with address %s does not exist", address)
+		return fmt.Errorf("%w: %s", ErrValidatorNotFound, address)
 	}
 
 	// Check if validator is jailed
@@ -308,7 +308,7 @@ func (vs *PosValidatorSet) Delegate(delegatorAddress, validatorAddress string, a
 	// Check if validator exists
 	validator, exists := vs.Validators[validatorAddress]
 	if !exists {
-		return fmt.Errorf("validator with address %s does not exist", validatorAddress)
+		return fmt.Errorf("%w: %s", ErrValidatorNotFound, validatorAddress)
 	}
 
 	// Check if validator is active
@@ -343,7 +343,7 @@ func (vs *PosValidatorSet) Undelegate(delegatorAddress, validatorAddress string,
 	// Check if validator exists
 	validator, exists := vs.Validators[validatorAddress]
 	if !exists {
-		return fmt.Errorf("validator with address %s does not exist", validatorAddress)
+		return fmt.Errorf("%w: %s", ErrValidatorNotFound, validatorAddress)
 	}
 
 	// Check if amount is valid
@@ -448,7 +448,7 @@ func (vs *PosValidatorSet) RewardValidators(blockProposer string, blockValidator
 	// Check if proposer exists
 	proposer, exists := vs.Validators[blockProposer]
 	if !exists {
-		return fmt.Errorf("proposer with address %s does not exist", blockProposer)
+		return fmt.Errorf("%w: proposer %s", ErrValidatorNotFound, blockProposer)
 	}
 
 	// Update proposer metrics
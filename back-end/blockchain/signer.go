@@ -0,0 +1,248 @@
+package blockchain
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/sha3"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+)
+
+// Signer backends selectable through BLOCKCHAIN_SIGNER
+const (
+	SignerLocal  = "local"
+	SignerAWSKMS = "aws-kms"
+	SignerGCPKMS = "gcp-kms"
+	SignerPKCS11 = "pkcs11"
+)
+
+// Signer signs transaction digests without exposing the private key to the caller
+type Signer interface {
+	// Sign returns a signature over a 32-byte digest
+	Sign(digest []byte) ([]byte, error)
+	// Address returns the account the signer signs for
+	Address() string
+	// Backend returns the name of the signing backend
+	Backend() string
+}
+
+// defaultSigner is used by clients created without an explicit signer
+var defaultSigner Signer
+
+// SetDefaultSigner installs the signer used by every new blockchain client and BaaS service
+func SetDefaultSigner(signer Signer) {
+	defaultSigner = signer
+}
+
+// DefaultSigner returns the configured signer, or nil if none has been installed
+func DefaultSigner() Signer {
+	return defaultSigner
+}
+
+// ErrSignerNotConfigured is returned when no signing key material is configured at all
+var ErrSignerNotConfigured = errors.New("no blockchain signing key configured")
+
+// ErrSignerBackendUnavailable is returned for signer backends this build cannot sign with yet
+var ErrSignerBackendUnavailable = errors.New("signer backend is not available")
+
+// NewSignerFromConfig creates the signer selected in the configuration
+func NewSignerFromConfig(cfg *config.Config) (Signer, error) {
+	switch strings.ToLower(cfg.BlockchainSigner) {
+	case "", SignerLocal:
+		if cfg.BlockchainKeyFile != "" {
+			return NewKeystoreSigner(cfg.BlockchainKeyFile, cfg.BlockchainKeystorePassphrase)
+		}
+		if cfg.BlockchainPrivateKey != "" {
+			// Plaintext keys are only kept for development setups
+			fmt.Println("Warning: BLOCKCHAIN_PRIVATE_KEY is deprecated, use an encrypted keystore via BLOCKCHAIN_KEY_FILE")
+			return NewLocalKeySigner(cfg.BlockchainPrivateKey)
+		}
+		return nil, fmt.Errorf("%w: local signer requires BLOCKCHAIN_KEY_FILE", ErrSignerNotConfigured)
+	case SignerAWSKMS, SignerGCPKMS, SignerPKCS11:
+		// The HSM service only simulates these backends, so refuse them rather than
+		// attach signatures no key ever produced
+		return nil, fmt.Errorf("%w: %s", ErrSignerBackendUnavailable, cfg.BlockchainSigner)
+	default:
+		return nil, fmt.Errorf("unsupported signer backend: %s", cfg.BlockchainSigner)
+	}
+}
+
+// LocalKeySigner signs with a private key held in process memory
+type LocalKeySigner struct {
+	key     *ecdsa.PrivateKey
+	address string
+}
+
+// NewLocalKeySigner creates a signer from a hex encoded private key
+func NewLocalKeySigner(privateKeyHex string) (*LocalKeySigner, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(privateKeyHex, "0x"))
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("private key must be 32 hex encoded bytes")
+	}
+	return newLocalKeySigner(raw, "")
+}
+
+// newLocalKeySigner derives the signing key from raw private key bytes
+// Keys are used on P-256, the curve the ledger and the HSM backends sign with
+func newLocalKeySigner(raw []byte, address string) (*LocalKeySigner, error) {
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(raw)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("private key is out of range")
+	}
+
+	key := &ecdsa.PrivateKey{D: d}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(raw)
+
+	if address == "" {
+		// Address is the last 20 bytes of the keccak hash of the public key
+		hash := sha3.NewLegacyKeccak256()
+		hash.Write(elliptic.Marshal(curve, key.PublicKey.X, key.PublicKey.Y)[1:])
+		address = hex.EncodeToString(hash.Sum(nil)[12:])
+	}
+	return &LocalKeySigner{key: key, address: "0x" + strings.TrimPrefix(address, "0x")}, nil
+}
+
+// Sign signs a digest with the local key
+func (s *LocalKeySigner) Sign(digest []byte) ([]byte, error) {
+	r, sig, err := ecdsa.Sign(rand.Reader, s.key, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign digest: %w", err)
+	}
+	// Fixed width r || s encoding
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+	return signature, nil
+}
+
+// Address returns the address derived from the local key
+func (s *LocalKeySigner) Address() string {
+	return s.address
+}
+
+// Backend returns the local backend name
+func (s *LocalKeySigner) Backend() string {
+	return SignerLocal
+}
+
+// keystoreFile is an encrypted key file in the Web3 Secret Storage (version 3) format
+type keystoreFile struct {
+	Address string `json:"address"`
+	Version int    `json:"version"`
+	Crypto  struct {
+		Cipher       string `json:"cipher"`
+		CipherText   string `json:"ciphertext"`
+		CipherParams struct {
+			IV string `json:"iv"`
+		} `json:"cipherparams"`
+		KDF       string                 `json:"kdf"`
+		KDFParams map[string]interface{} `json:"kdfparams"`
+		MAC       string                 `json:"mac"`
+	} `json:"crypto"`
+}
+
+// NewKeystoreSigner decrypts a version 3 keystore file and creates a local signer from it
+func NewKeystoreSigner(path, passphrase string) (*LocalKeySigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %w", err)
+	}
+
+	var ks keystoreFile
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("invalid keystore: %w", err)
+	}
+	if ks.Version != 3 || ks.Crypto.Cipher != "aes-128-ctr" {
+		return nil, errors.New("only version 3 keystores with aes-128-ctr are supported")
+	}
+
+	derivedKey, err := deriveKeystoreKey(ks, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(derivedKey) < 32 {
+		return nil, errors.New("keystore dklen must be at least 32")
+	}
+	cipherText, err := hex.DecodeString(ks.Crypto.CipherText)
+	if err != nil {
+		return nil, errors.New("invalid keystore ciphertext")
+	}
+
+	// The MAC proves the passphrase is right before the key is used
+	mac := sha3.NewLegacyKeccak256()
+	mac.Write(derivedKey[16:32])
+	mac.Write(cipherText)
+	expectedMAC, err := hex.DecodeString(ks.Crypto.MAC)
+	if err != nil || !hmac.Equal(mac.Sum(nil), expectedMAC) {
+		return nil, errors.New("could not decrypt keystore: wrong passphrase")
+	}
+
+	iv, err := hex.DecodeString(ks.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, errors.New("invalid keystore IV")
+	}
+	block, err := aes.NewCipher(derivedKey[:16])
+	if err != nil {
+		return nil, err
+	}
+	privateKey := make([]byte, len(cipherText))
+	cipher.NewCTR(block, iv).XORKeyStream(privateKey, cipherText)
+
+	return newLocalKeySigner(privateKey, ks.Address)
+}
+
+// deriveKeystoreKey runs the key derivation function declared in a keystore
+func deriveKeystoreKey(ks keystoreFile, passphrase string) ([]byte, error) {
+	params := ks.Crypto.KDFParams
+	salt, err := hex.DecodeString(fmt.Sprint(params["salt"]))
+	if err != nil {
+		return nil, errors.New("invalid keystore salt")
+	}
+	intParam := func(name string) int {
+		value, _ := params[name].(float64)
+		return int(value)
+	}
+
+	switch ks.Crypto.KDF {
+	case "scrypt":
+		return scrypt.Key([]byte(passphrase), salt, intParam("n"), intParam("r"), intParam("p"), intParam("dklen"))
+	case "pbkdf2":
+		if prf, _ := params["prf"].(string); prf != "hmac-sha256" {
+			return nil, fmt.Errorf("unsupported pbkdf2 prf: %s", prf)
+		}
+		return pbkdf2.Key([]byte(passphrase), salt, intParam("c"), intParam("dklen"), sha256.New), nil
+	default:
+		return nil, fmt.Errorf("unsupported keystore kdf: %s", ks.Crypto.KDF)
+	}
+}
+
+// SignPayload signs the canonical JSON encoding of a payload and returns the hex signature
+func SignPayload(signer Signer, payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode payload: %w", err)
+	}
+	digest := sha256.Sum256(data)
+	signature, err := signer.Sign(digest[:])
+	if err != nil {
+		return "", err
+	}
+	return "0x" + hex.EncodeToString(signature), nil
+}
@@ -0,0 +1,32 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+)
+
+func TestNewSignerFromConfigRefusesSimulatedBackends(t *testing.T) {
+	for _, backend := range []string{SignerAWSKMS, SignerGCPKMS, SignerPKCS11} {
+		signer, err := NewSignerFromConfig(&config.Config{BlockchainSigner: backend, BlockchainKMSKeyID: "key-1"})
+		if !errors.Is(err, ErrSignerBackendUnavailable) {
+			t.Fatalf("%s: expected ErrSignerBackendUnavailable, got %v", backend, err)
+		}
+		if signer != nil {
+			t.Fatalf("%s: expected no signer", backend)
+		}
+	}
+}
+
+func TestNewSignerFromConfigWithoutKeyIsNotConfigured(t *testing.T) {
+	_, err := NewSignerFromConfig(&config.Config{BlockchainSigner: SignerLocal})
+	if !errors.Is(err, ErrSignerNotConfigured) {
+		t.Fatalf("expected ErrSignerNotConfigured, got %v", err)
+	}
+
+	_, err = NewSignerFromConfig(&config.Config{BlockchainSigner: SignerLocal, BlockchainKeyFile: "/nonexistent/keystore.json"})
+	if err == nil || errors.Is(err, ErrSignerNotConfigured) {
+		t.Fatalf("expected a load failure for a configured keystore, got %v", err)
+	}
+}
@@ -228,7 +228,7 @@ func (sc *SSIClient) ResolveDID(did string) (*DIDDocument, error) {
 	
 	// In a real implementation, this would query a blockchain or decentralized registry
 	// For this implementation, if it's not in our local registry, we can't resolve it
-	return nil, fmt.Errorf("DID not found: %s", did)
+	return nil, fmt.Errorf("%w: %s", ErrDIDNotFound, did)
 }
 
 // createDIDDocumentProof creates a proof for a DID document
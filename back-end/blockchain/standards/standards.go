@@ -0,0 +1,243 @@
+// Package standards maps internal batch and event data to the traceability
+// standards spoken by external chains and partners
+package standards
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Names of the built-in data standards
+const (
+	GS1EPCIS      = "GS1-EPCIS"
+	UNCEFACTECert = "UN-CEFACT-ECERT"
+	UNCEFACTFLUX  = "UN-CEFACT-FLUX"
+	CustomJSON    = "CUSTOM-JSON"
+)
+
+// Transformer converts the internal batch model into a document of one data standard
+//
+// The source is a batch map with batch_id, species, quantity, status, location,
+// hatchery, company and an optional events list of maps with event_type,
+// location and timestamp
+type Transformer interface {
+	// Standard returns the name the transformer is registered under
+	Standard() string
+	// Transform maps a batch to the target standard
+	Transform(data map[string]interface{}) (map[string]interface{}, error)
+}
+
+// Registry holds the transformers available for cross-chain sharing
+type Registry struct {
+	mutex        sync.RWMutex
+	transformers map[string]Transformer
+}
+
+// NewRegistry creates a registry with the built-in standards registered
+func NewRegistry() *Registry {
+	registry := &Registry{transformers: make(map[string]Transformer)}
+	registry.Register(EPCISTransformer{})
+	registry.Register(ECertTransformer{})
+	registry.Register(FLUXTransformer{})
+	return registry
+}
+
+var defaultRegistry = NewRegistry()
+
+// Default returns the process wide registry
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register adds or replaces a transformer
+func (r *Registry) Register(transformer Transformer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.transformers[transformer.Standard()] = transformer
+}
+
+// Get returns the transformer registered for a standard
+func (r *Registry) Get(standard string) (Transformer, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	transformer, ok := r.transformers[standard]
+	return transformer, ok
+}
+
+// Standards returns the registered standard names in sorted order
+func (r *Registry) Standards() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	names := make([]string, 0, len(r.transformers))
+	for name := range r.transformers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Transform maps a batch with the transformer registered for a standard
+func (r *Registry) Transform(standard string, data map[string]interface{}) (map[string]interface{}, error) {
+	transformer, ok := r.Get(standard)
+	if !ok {
+		return nil, fmt.Errorf("data standard %s not supported", standard)
+	}
+	if _, ok := data["batch_id"]; !ok {
+		return nil, errors.New("source data has no batch_id")
+	}
+	return transformer.Transform(data)
+}
+
+// Transform maps a batch with the default registry
+func Transform(standard string, data map[string]interface{}) (map[string]interface{}, error) {
+	return defaultRegistry.Transform(standard, data)
+}
+
+// CustomSchema describes a partner specific JSON document
+//
+// Fields maps a dotted output path to a dotted source path. A source path
+// starting with "=" is a literal, and "events[].event_type" collects a field
+// from every element of a list
+type CustomSchema struct {
+	Name     string            `json:"name"`
+	Fields   map[string]string `json:"fields"`
+	Required []string          `json:"required,omitempty"`
+}
+
+// CustomJSONTransformer maps batches to a partner's own JSON schema
+type CustomJSONTransformer struct {
+	Schema CustomSchema
+}
+
+// NewCustomJSONTransformer parses and validates a custom schema definition
+func NewCustomJSONTransformer(definition []byte) (*CustomJSONTransformer, error) {
+	var schema CustomSchema
+	if err := json.Unmarshal(definition, &schema); err != nil {
+		return nil, fmt.Errorf("invalid custom schema: %w", err)
+	}
+	if schema.Name == "" {
+		return nil, errors.New("custom schema requires a name")
+	}
+	if len(schema.Fields) == 0 {
+		return nil, errors.New("custom schema requires at least one field")
+	}
+	for target, source := range schema.Fields {
+		if target == "" || source == "" {
+			return nil, errors.New("custom schema fields must map a non-empty target to a non-empty source")
+		}
+	}
+	return &CustomJSONTransformer{Schema: schema}, nil
+}
+
+// Standard returns the schema name prefixed with the custom JSON standard
+func (t *CustomJSONTransformer) Standard() string {
+	return CustomJSON + ":" + t.Schema.Name
+}
+
+// Transform builds the partner document field by field
+func (t *CustomJSONTransformer) Transform(data map[string]interface{}) (map[string]interface{}, error) {
+	output := make(map[string]interface{})
+
+	targets := make([]string, 0, len(t.Schema.Fields))
+	for target := range t.Schema.Fields {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	for _, target := range targets {
+		source := t.Schema.Fields[target]
+		var value interface{}
+		if strings.HasPrefix(source, "=") {
+			value = strings.TrimPrefix(source, "=")
+		} else {
+			value = lookup(data, source)
+		}
+		if value == nil {
+			continue
+		}
+		if err := setPath(output, target, value); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, required := range t.Schema.Required {
+		if lookup(output, required) == nil {
+			return nil, fmt.Errorf("required field %s is missing from the mapped document", required)
+		}
+	}
+	return output, nil
+}
+
+// lookup reads a dotted path from nested maps, collecting values across lists marked with []
+func lookup(data map[string]interface{}, path string) interface{} {
+	head, rest, nested := strings.Cut(path, ".")
+
+	if strings.HasSuffix(head, "[]") {
+		items := mapList(data[strings.TrimSuffix(head, "[]")])
+		if items == nil {
+			return nil
+		}
+		values := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			if !nested {
+				values = append(values, item)
+			} else if value := lookup(item, rest); value != nil {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+
+	value, ok := data[head]
+	if !ok || !nested {
+		return value
+	}
+	child, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return lookup(child, rest)
+}
+
+// setPath writes a value at a dotted path, creating intermediate objects
+func setPath(output map[string]interface{}, path string, value interface{}) error {
+	parts := strings.Split(path, ".")
+	current := output
+	for _, part := range parts[:len(parts)-1] {
+		next, exists := current[part]
+		if !exists {
+			child := make(map[string]interface{})
+			current[part] = child
+			current = child
+			continue
+		}
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("custom schema path %s conflicts with another field", path)
+		}
+		current = child
+	}
+	current[parts[len(parts)-1]] = value
+	return nil
+}
+
+// mapList returns a list of objects whether it was built in Go or decoded from JSON
+func mapList(value interface{}) []map[string]interface{} {
+	switch list := value.(type) {
+	case []map[string]interface{}:
+		return list
+	case []interface{}:
+		items := make([]map[string]interface{}, 0, len(list))
+		for _, item := range list {
+			if m, ok := item.(map[string]interface{}); ok {
+				items = append(items, m)
+			}
+		}
+		return items
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package standards
+
+import (
+	"fmt"
+	"time"
+)
+
+// EPCISTransformer maps a batch and its events to a GS1 EPCIS 2.0 JSON-LD document
+type EPCISTransformer struct{}
+
+// Standard returns the GS1 EPCIS standard name
+func (EPCISTransformer) Standard() string {
+	return GS1EPCIS
+}
+
+// Transform creates one ObjectEvent per batch event, or a commissioning event when there are none
+func (EPCISTransformer) Transform(data map[string]interface{}) (map[string]interface{}, error) {
+	batchID := fmt.Sprint(data["batch_id"])
+	epc := fmt.Sprintf("urn:epc:id:sgtin:0614141.%s", batchID)
+
+	events := eventList(data)
+	if len(events) == 0 {
+		events = []map[string]interface{}{{
+			"event_type": "commissioning",
+			"location":   data["location"],
+			"timestamp":  data["event_time"],
+		}}
+	}
+
+	epcisEvents := make([]map[string]interface{}, 0, len(events))
+	for _, event := range events {
+		epcisEvents = append(epcisEvents, map[string]interface{}{
+			"type":                "ObjectEvent",
+			"eventTime":           timestamp(event["timestamp"]),
+			"eventTimeZoneOffset": "+07:00", // Vietnam timezone
+			"epcList":             []string{epc},
+			"action":              "OBSERVE",
+			"bizStep":             bizStep(fmt.Sprint(event["event_type"])),
+			"disposition":         "urn:epcglobal:cbv:disp:active",
+			"readPoint": map[string]interface{}{
+				"id": fmt.Sprintf("urn:epc:id:sgln:%v", valueOr(event["location"], data["location"])),
+			},
+		})
+	}
+
+	return map[string]interface{}{
+		"@context":      []string{"https://ref.gs1.org/standards/epcis/2.0.0/epcis-context.jsonld"},
+		"type":          "EPCISDocument",
+		"schemaVersion": "2.0",
+		"creationDate":  time.Now().UTC().Format(time.RFC3339),
+		"epcisBody": map[string]interface{}{
+			"eventList": epcisEvents,
+		},
+		// Keep the original data for receivers that understand TracePost batches
+		"tracepostExtension": data,
+	}, nil
+}
+
+// ECertTransformer maps a batch to a UN/CEFACT eCert (SPS certificate) document
+type ECertTransformer struct{}
+
+// Standard returns the UN/CEFACT eCert standard name
+func (ECertTransformer) Standard() string {
+	return UNCEFACTECert
+}
+
+// Transform builds the consignment and trade line item of a sanitary certificate
+func (ECertTransformer) Transform(data map[string]interface{}) (map[string]interface{}, error) {
+	batchID := fmt.Sprint(data["batch_id"])
+
+	return map[string]interface{}{
+		"SPSCertificate": map[string]interface{}{
+			"SPSExchangedDocument": map[string]interface{}{
+				"ID":            "TP-ECERT-" + batchID,
+				"TypeCode":      "851", // Phytosanitary/sanitary certificate
+				"StatusCode":    "70",  // Original
+				"IssueDateTime": time.Now().UTC().Format(time.RFC3339),
+				"IssuerSPSParty": map[string]interface{}{
+					"Name": valueOr(data["company"], "TracePost-larvaeChain"),
+				},
+			},
+			"SPSConsignment": map[string]interface{}{
+				"ConsignorSPSParty": map[string]interface{}{
+					"Name": valueOr(data["hatchery"], data["company"]),
+				},
+				"ExportSPSCountry": map[string]interface{}{
+					"ID": "VN",
+				},
+				"IncludedSPSConsignmentItem": map[string]interface{}{
+					"IncludedSPSTradeLineItem": map[string]interface{}{
+						"SequenceNumeric": 1,
+						"Description":     "Live shrimp larvae",
+						"ScientificName":  data["species"],
+						"NetWeightMeasure": map[string]interface{}{
+							"unitCode": "H87", // Piece
+							"value":    data["quantity"],
+						},
+						"BatchID": batchID,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// FLUXTransformer maps a batch to a UN/CEFACT FLUX aquaculture production report
+type FLUXTransformer struct{}
+
+// Standard returns the UN/CEFACT FLUX standard name
+func (FLUXTransformer) Standard() string {
+	return UNCEFACTFLUX
+}
+
+// Transform builds a FLUX report with one fishing activity per batch event
+func (FLUXTransformer) Transform(data map[string]interface{}) (map[string]interface{}, error) {
+	batchID := fmt.Sprint(data["batch_id"])
+
+	activities := []map[string]interface{}{}
+	for _, event := range eventList(data) {
+		activities = append(activities, map[string]interface{}{
+			"TypeCode":           event["event_type"],
+			"OccurrenceDateTime": timestamp(event["timestamp"]),
+			"RelatedFLUXLocation": map[string]interface{}{
+				"ID": valueOr(event["location"], data["location"]),
+			},
+		})
+	}
+
+	return map[string]interface{}{
+		"FLUXReportDocument": map[string]interface{}{
+			"ID":               "TP-FLUX-" + batchID,
+			"CreationDateTime": time.Now().UTC().Format(time.RFC3339),
+			"PurposeCode":      "9", // Original report
+			"OwnerFLUXParty": map[string]interface{}{
+				"Name": valueOr(data["company"], "TracePost-larvaeChain"),
+			},
+		},
+		"AquacultureProduction": map[string]interface{}{
+			"BatchID":         batchID,
+			"SpeciesCode":     data["species"],
+			"Quantity":        data["quantity"],
+			"StatusCode":      data["status"],
+			"FarmName":        data["hatchery"],
+			"FishingActivity": activities,
+		},
+	}, nil
+}
+
+// eventList returns the events of a batch map
+func eventList(data map[string]interface{}) []map[string]interface{} {
+	return mapList(data["events"])
+}
+
+// bizStep maps internal event types to CBV business steps
+func bizStep(eventType string) string {
+	switch eventType {
+	case "hatching", "commissioning":
+		return "urn:epcglobal:cbv:bizstep:commissioning"
+	case "feeding", "treatment", "inspection":
+		return "urn:epcglobal:cbv:bizstep:inspecting"
+	case "shipping", "transfer":
+		return "urn:epcglobal:cbv:bizstep:shipping"
+	case "receiving":
+		return "urn:epcglobal:cbv:bizstep:receiving"
+	default:
+		return "urn:epcglobal:cbv:bizstep:other"
+	}
+}
+
+// timestamp formats an event time as RFC 3339, defaulting to now
+func timestamp(value interface{}) string {
+	switch t := value.(type) {
+	case time.Time:
+		return t.UTC().Format(time.RFC3339)
+	case string:
+		if t != "" {
+			return t
+		}
+	}
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// valueOr returns value, or fallback when value is empty
+func valueOr(value, fallback interface{}) interface{} {
+	if value == nil || value == "" {
+		return fallback
+	}
+	return value
+}
@@ -357,7 +357,7 @@ func (t *TracePostDIDMethod) Resolve(did string) (*W3CDIDDocument, error) {
 	
 	// In a real implementation, this would resolve the DID from a blockchain or registry
 	// For this implementation, if it's not in our local store, we can't resolve it
-	return nil, fmt.Errorf("DID not found: %s", did)
+	return nil, fmt.Errorf("%w: %s", ErrDIDNotFound, did)
 }
 
 // Update implements the did:tracepost method Update operation
@@ -365,7 +365,7 @@ func (t *TracePostDIDMethod) Update(did string, document *W3CDIDDocument, privat
 	// Check if DID exists
 	_, err := t.Resolve(did)
 	if err != nil {
-		return fmt.Errorf("DID not found: %s", did)
+		return fmt.Errorf("%w: %s", ErrDIDNotFound, did)
 	}
 	
 	// Verify that the private key corresponds to the verification method
@@ -434,7 +434,7 @@ func (t *TracePostDIDMethod) Deactivate(did string, privateKey *ecdsa.PrivateKey
 	// Check if DID exists
 	document, err := t.Resolve(did)
 	if err != nil {
-		return fmt.Errorf("DID not found: %s", did)
+		return fmt.Errorf("%w: %s", ErrDIDNotFound, did)
 	}
 	
 	// Verify that the private key corresponds to the verification method
@@ -0,0 +1,310 @@
+package botguard
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+)
+
+// Public routes the guard can protect
+const (
+	RouteTrace    = "trace"    // consumer trace pages and QR lookups
+	RouteFeedback = "feedback" // consumer feedback submission
+	RouteScan     = "scan"     // barcode decoding
+)
+
+// Routes lists the routes the guard knows about
+var Routes = []string{RouteTrace, RouteFeedback, RouteScan}
+
+// Decisions of the guard about a request
+const (
+	Allow     = "allow"     // serve the request
+	Challenge = "challenge" // the client must solve a challenge first
+	Block     = "block"     // the client tripped a honeypot
+)
+
+// Errors returned when verifying a solved challenge
+var (
+	ErrInvalidChallenge = errors.New("challenge is invalid or expired")
+	ErrInvalidSolution  = errors.New("solution does not solve the challenge")
+	ErrUnknownRoute     = errors.New("unknown route")
+)
+
+// botSignatures are User-Agent fragments of HTTP libraries and headless browsers
+var botSignatures = []string{
+	"curl", "wget", "python-requests", "python-urllib", "go-http-client", "java/", "okhttp", "libwww", "scrapy",
+	"httpclient", "headlesschrome", "phantomjs", "selenium", "puppeteer", "playwright", "bot", "crawler", "spider",
+}
+
+// client is what the guard remembers of a client address
+type client struct {
+	windowStart  time.Time
+	hits         int
+	blockedUntil time.Time
+	lastSeen     time.Time
+}
+
+// Status is a snapshot of the guard
+type Status struct {
+	Routes            map[string]bool `json:"routes"` // Whether each public route is protected
+	RequestsPerMinute int             `json:"requests_per_minute"`
+	CaptchaProvider   string          `json:"captcha_provider,omitempty"`
+	PoWDifficulty     int             `json:"pow_difficulty"`
+	TrackedClients    int             `json:"tracked_clients"`
+	BlockedClients    int             `json:"blocked_clients"`
+	Challenged        int64           `json:"challenged"`
+	Passed            int64           `json:"passed"` // Challenges solved
+	HoneypotHits      int64           `json:"honeypot_hits"`
+}
+
+// Guard tells anonymous clients of public routes from bots.
+// A client is challenged once it sends more than RequestsPerMinute requests or looks like an HTTP library,
+// and let through for PassTTL after solving a CAPTCHA or, without one, a proof-of-work puzzle.
+// A client filling in the honeypot field is blocked for PassTTL
+type Guard struct {
+	RequestsPerMinute int
+	PoWDifficulty     int
+	PassTTL           time.Duration
+	ChallengeTTL      time.Duration
+	HoneypotField     string
+	Captcha           *CaptchaVerifier
+
+	secret []byte
+
+	mu         sync.Mutex
+	routes     map[string]bool
+	clients    map[string]*client
+	used       map[string]time.Time // solved proof-of-work challenges, until they expire
+	lastSweep  time.Time
+	challenged int64
+	passed     int64
+	honeypot   int64
+}
+
+var (
+	defaultGuard *Guard
+	once         sync.Once
+)
+
+// NewGuard creates a guard from the application config
+func NewGuard(cfg *config.Config) *Guard {
+	g := &Guard{
+		RequestsPerMinute: cfg.BotGuardRequestsPerMinute,
+		PoWDifficulty:     cfg.BotGuardPoWDifficulty,
+		PassTTL:           time.Duration(cfg.BotGuardPassMinutes) * time.Minute,
+		ChallengeTTL:      5 * time.Minute,
+		HoneypotField:     cfg.BotGuardHoneypotField,
+		Captcha:           NewCaptchaVerifier(cfg.BotGuardCaptchaProvider, cfg.BotGuardCaptchaSiteKey, cfg.BotGuardCaptchaSecret),
+		secret:            []byte(cfg.BotGuardSecret),
+		routes:            map[string]bool{},
+		clients:           map[string]*client{},
+		used:              map[string]time.Time{},
+	}
+	if len(g.secret) == 0 {
+		// Passes then only hold on this instance and until it restarts
+		g.secret = make([]byte, 32)
+		if _, err := rand.Read(g.secret); err != nil {
+			panic(fmt.Sprintf("botguard: failed to generate secret: %v", err))
+		}
+	}
+	for _, route := range strings.Split(cfg.BotGuardRoutes, ",") {
+		if route = strings.TrimSpace(route); route != "" {
+			g.routes[route] = true
+		}
+	}
+	return g
+}
+
+// Default returns the process wide guard
+func Default() *Guard {
+	once.Do(func() {
+		defaultGuard = NewGuard(config.GetConfig())
+	})
+	return defaultGuard
+}
+
+// Enabled reports whether a route is protected
+func (g *Guard) Enabled(route string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.routes[route]
+}
+
+// SetEnabled protects a route or stops protecting it
+func (g *Guard) SetEnabled(route string, enabled bool) error {
+	known := false
+	for _, r := range Routes {
+		known = known || r == route
+	}
+	if !known {
+		return ErrUnknownRoute
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.routes[route] = enabled
+	return nil
+}
+
+// ClientKey derives the key a client is known by from its address, so addresses are not kept
+func ClientKey(ip string) string {
+	sum := sha256.Sum256([]byte(ip))
+	return hex.EncodeToString(sum[:12])
+}
+
+// Check decides what to do with an anonymous request of a client.
+// pass is the pass token the client sent, if any
+func (g *Guard) Check(key, userAgent, pass string) string {
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sweep(now)
+
+	cl := g.clients[key]
+	if cl == nil {
+		cl = &client{windowStart: now}
+		g.clients[key] = cl
+	}
+	cl.lastSeen = now
+	if now.Before(cl.blockedUntil) {
+		return Block
+	}
+	if pass != "" && g.validPass(key, pass, now) {
+		return Allow
+	}
+
+	if now.Sub(cl.windowStart) > time.Minute {
+		cl.windowStart, cl.hits = now, 0
+	}
+	cl.hits++
+	if cl.hits > g.RequestsPerMinute || looksAutomated(userAgent) {
+		g.challenged++
+		return Challenge
+	}
+	return Allow
+}
+
+// TripHoneypot blocks a client that filled in the honeypot field
+func (g *Guard) TripHoneypot(key string) {
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	cl := g.clients[key]
+	if cl == nil {
+		cl = &client{windowStart: now}
+		g.clients[key] = cl
+	}
+	cl.lastSeen = now
+	cl.blockedUntil = now.Add(g.PassTTL)
+	g.honeypot++
+}
+
+// looksAutomated reports whether a User-Agent is missing or belongs to an HTTP library or headless browser
+func looksAutomated(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return true
+	}
+	for _, signature := range botSignatures {
+		if strings.Contains(ua, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// sweep forgets clients not seen for a while and expired challenges, at most once a minute
+func (g *Guard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < time.Minute {
+		return
+	}
+	g.lastSweep = now
+	for key, cl := range g.clients {
+		if now.Sub(cl.lastSeen) > 2*time.Minute && now.After(cl.blockedUntil) {
+			delete(g.clients, key)
+		}
+	}
+	for challenge, expires := range g.used {
+		if now.After(expires) {
+			delete(g.used, challenge)
+		}
+	}
+}
+
+// sign signs a value with the guard secret
+func (g *Guard) sign(value string) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signed appends the signature of a value to it
+func (g *Guard) signed(value string) string {
+	return value + "." + g.sign(value)
+}
+
+// verifySigned checks the signature of a signed value and returns the value
+func (g *Guard) verifySigned(token string) (string, bool) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return "", false
+	}
+	value, signature := token[:i], token[i+1:]
+	return value, hmac.Equal([]byte(signature), []byte(g.sign(value)))
+}
+
+// issuePass returns a pass letting a client through until it expires
+func (g *Guard) issuePass(key string, now time.Time) (string, time.Time) {
+	expires := now.Add(g.PassTTL)
+	return g.signed("pass." + key + "." + strconv.FormatInt(expires.Unix(), 10)), expires
+}
+
+// validPass checks a pass was issued to the client and has not expired
+func (g *Guard) validPass(key, pass string, now time.Time) bool {
+	value, ok := g.verifySigned(pass)
+	if !ok {
+		return false
+	}
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 || parts[0] != "pass" || parts[1] != key {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	return err == nil && now.Unix() < expires
+}
+
+// Status returns a snapshot of the guard
+func (g *Guard) Status() Status {
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := Status{
+		Routes:            map[string]bool{},
+		RequestsPerMinute: g.RequestsPerMinute,
+		PoWDifficulty:     g.PoWDifficulty,
+		TrackedClients:    len(g.clients),
+		Challenged:        g.challenged,
+		Passed:            g.passed,
+		HoneypotHits:      g.honeypot,
+	}
+	for _, route := range Routes {
+		s.Routes[route] = g.routes[route]
+	}
+	if g.Captcha != nil {
+		s.CaptchaProvider = g.Captcha.Provider
+	}
+	for _, cl := range g.clients {
+		if now.Before(cl.blockedUntil) {
+			s.BlockedClients++
+		}
+	}
+	return s
+}
@@ -0,0 +1,191 @@
+package botguard
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CAPTCHA providers; all three verify a response token the same way
+const (
+	CaptchaHCaptcha  = "hcaptcha"
+	CaptchaReCaptcha = "recaptcha"
+	CaptchaTurnstile = "turnstile"
+)
+
+// captchaVerifyURLs are the siteverify endpoints of the providers
+var captchaVerifyURLs = map[string]string{
+	CaptchaHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	CaptchaReCaptcha: "https://www.google.com/recaptcha/api/siteverify",
+	CaptchaTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// ChallengeSpec is a challenge for a client to solve.
+// The proof-of-work puzzle is always included, so a client that cannot show the CAPTCHA can fall back to it:
+// find a solution such that SHA-256(challenge + solution) starts with difficulty zero bits
+type ChallengeSpec struct {
+	Challenge       string    `json:"challenge"`
+	Difficulty      int       `json:"difficulty"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	CaptchaProvider string    `json:"captcha_provider,omitempty"`
+	CaptchaSiteKey  string    `json:"captcha_site_key,omitempty"`
+}
+
+// Header renders the challenge for the X-Bot-Challenge response header
+func (s ChallengeSpec) Header() string {
+	header := fmt.Sprintf("pow challenge=%s difficulty=%d", s.Challenge, s.Difficulty)
+	if s.CaptchaProvider != "" {
+		header += fmt.Sprintf(", captcha provider=%s site_key=%s", s.CaptchaProvider, s.CaptchaSiteKey)
+	}
+	return header
+}
+
+// Solution is a solved challenge: a CAPTCHA response token, or the solution of the proof-of-work puzzle
+type Solution struct {
+	Challenge    string `json:"challenge"`
+	Solution     string `json:"solution"`
+	CaptchaToken string `json:"captcha_token"`
+}
+
+// Pass lets a client through the guard until it expires; it is sent back in the X-Bot-Pass header
+type Pass struct {
+	Pass      string    `json:"pass"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Method    string    `json:"method"` // captcha or pow
+}
+
+// Issue creates a challenge for a client
+func (g *Guard) Issue(key string) ChallengeSpec {
+	nonce := make([]byte, 12)
+	rand.Read(nonce)
+	expires := time.Now().Add(g.ChallengeTTL)
+	spec := ChallengeSpec{
+		Challenge:  g.signed(hex.EncodeToString(nonce) + "." + key + "." + strconv.FormatInt(expires.Unix(), 10)),
+		Difficulty: g.PoWDifficulty,
+		ExpiresAt:  expires,
+	}
+	if g.Captcha != nil {
+		spec.CaptchaProvider, spec.CaptchaSiteKey = g.Captcha.Provider, g.Captcha.SiteKey
+	}
+	return spec
+}
+
+// Solve checks a solved challenge and returns a pass for the client.
+// A CAPTCHA token is checked with the provider; a proof-of-work solution is checked locally and only accepted once
+func (g *Guard) Solve(key, remoteIP string, s Solution) (Pass, error) {
+	now := time.Now()
+	method := "pow"
+	if s.CaptchaToken != "" && g.Captcha != nil {
+		if err := g.Captcha.Verify(s.CaptchaToken, remoteIP); err != nil {
+			return Pass{}, err
+		}
+		method = "captcha"
+	} else if err := g.checkProofOfWork(key, s, now); err != nil {
+		return Pass{}, err
+	}
+
+	g.mu.Lock()
+	g.passed++
+	if cl := g.clients[key]; cl != nil {
+		cl.hits = 0
+	}
+	g.mu.Unlock()
+
+	pass, expires := g.issuePass(key, now)
+	return Pass{Pass: pass, ExpiresAt: expires, Method: method}, nil
+}
+
+// checkProofOfWork checks a proof-of-work solution against a challenge issued to the client
+func (g *Guard) checkProofOfWork(key string, s Solution, now time.Time) error {
+	value, ok := g.verifySigned(s.Challenge)
+	if !ok {
+		return ErrInvalidChallenge
+	}
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 || parts[1] != key {
+		return ErrInvalidChallenge
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || now.Unix() >= expires {
+		return ErrInvalidChallenge
+	}
+	if leadingZeroBits(sha256.Sum256([]byte(s.Challenge+s.Solution))) < g.PoWDifficulty {
+		return ErrInvalidSolution
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, solved := g.used[s.Challenge]; solved {
+		return ErrInvalidChallenge
+	}
+	g.used[s.Challenge] = time.Unix(expires, 0)
+	return nil
+}
+
+// leadingZeroBits counts the zero bits a hash starts with
+func leadingZeroBits(sum [32]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// CaptchaVerifier checks CAPTCHA response tokens with the provider
+type CaptchaVerifier struct {
+	Provider   string
+	SiteKey    string
+	Secret     string
+	VerifyURL  string
+	HTTPClient *http.Client
+}
+
+// NewCaptchaVerifier creates a verifier, or returns nil for an unknown provider or a missing secret
+func NewCaptchaVerifier(provider, siteKey, secret string) *CaptchaVerifier {
+	verifyURL, ok := captchaVerifyURLs[provider]
+	if !ok || secret == "" {
+		return nil
+	}
+	return &CaptchaVerifier{
+		Provider:   provider,
+		SiteKey:    siteKey,
+		Secret:     secret,
+		VerifyURL:  verifyURL,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Verify checks a response token with the provider
+func (v *CaptchaVerifier) Verify(token, remoteIP string) error {
+	resp, err := v.HTTPClient.PostForm(v.VerifyURL, url.Values{
+		"secret":   {v.Secret},
+		"response": {token},
+		"remoteip": {remoteIP},
+	})
+	if err != nil {
+		return fmt.Errorf("captcha provider unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid captcha provider response: %w", err)
+	}
+	if !result.Success {
+		return ErrInvalidSolution
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package bundle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Format is the format identifier of bundles this package builds and verifies
+const Format = "tracepost-batch-bundle/v1"
+
+// HashAlgorithm is the hash of leaves and Merkle tree nodes
+const HashAlgorithm = "sha256-rfc6962"
+
+// Record types
+const (
+	RecordBatch    = "batch"
+	RecordEvent    = "event"
+	RecordTransfer = "transfer"
+	RecordDocument = "document"
+	RecordWater    = "water_source"
+	RecordAnchor   = "anchor"
+)
+
+// Manifest summarizes a bundle; it is what the platform signs
+type Manifest struct {
+	Format        string    `json:"format"`
+	Issuer        string    `json:"issuer"`
+	BatchID       int       `json:"batch_id"`
+	ExportedAt    time.Time `json:"exported_at"`
+	RecordCount   int       `json:"record_count"`
+	MerkleRoot    string    `json:"merkle_root"`
+	HashAlgorithm string    `json:"hash_algorithm"`
+}
+
+// ProofStep is a sibling hash on the path from a leaf to the Merkle root; exactly one side is set
+type ProofStep struct {
+	Left  string `json:"left,omitempty"`
+	Right string `json:"right,omitempty"`
+}
+
+// Record is a piece of batch history with its inclusion proof
+type Record struct {
+	Type     string          `json:"type"`
+	ID       string          `json:"id"`
+	Data     json.RawMessage `json:"data"`
+	LeafHash string          `json:"leaf_hash"`
+	Proof    []ProofStep     `json:"proof"`
+}
+
+// JWK is a public key as published in the platform's JWKS
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg"`
+}
+
+// JWKS is a set of public keys
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Bundle is a signed, self-contained history of a batch
+type Bundle struct {
+	Manifest  Manifest `json:"manifest"`
+	Records   []Record `json:"records"`
+	Signature string   `json:"signature"`
+	Keys      JWKS     `json:"keys"`
+}
+
+// Signer creates the detached compact JWS of a payload
+type Signer func(payload []byte) (string, error)
+
+// NewRecord builds a record of any JSON serializable data
+func NewRecord(recordType, id string, data interface{}) (Record, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to serialize %s %s: %w", recordType, id, err)
+	}
+	return Record{Type: recordType, ID: id, Data: raw}, nil
+}
+
+// Build hashes the records, computes the Merkle root and inclusion proofs and signs the manifest
+func Build(issuer string, batchID int, exportedAt time.Time, records []Record, sign Signer, keys JWKS) (*Bundle, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("a bundle needs at least one record")
+	}
+	leaves := make([][]byte, len(records))
+	for i := range records {
+		leaf, err := LeafHash(records[i])
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = leaf
+		records[i].LeafHash = hex.EncodeToString(leaf)
+	}
+	for i := range records {
+		records[i].Proof = auditPath(i, leaves)
+	}
+
+	b := &Bundle{
+		Manifest: Manifest{
+			Format:        Format,
+			Issuer:        issuer,
+			BatchID:       batchID,
+			ExportedAt:    exportedAt.UTC().Truncate(time.Second),
+			RecordCount:   len(records),
+			MerkleRoot:    hex.EncodeToString(merkleTreeHash(leaves)),
+			HashAlgorithm: HashAlgorithm,
+		},
+		Records: records,
+		Keys:    keys,
+	}
+	payload, err := ManifestPayload(b.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	if b.Signature, err = sign(payload); err != nil {
+		return nil, fmt.Errorf("failed to sign bundle manifest: %w", err)
+	}
+	return b, nil
+}
+
+// ManifestPayload is the canonical JSON of a manifest, the payload of the bundle signature
+func ManifestPayload(m Manifest) ([]byte, error) {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return Canonicalize(raw)
+}
+
+// Canonicalize rewrites JSON with sorted object keys, no insignificant whitespace and numbers as written
+func Canonicalize(raw []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// LeafHash is the Merkle leaf of a record: SHA-256 of 0x00 and the canonical JSON of its type, ID and data
+func LeafHash(r Record) ([]byte, error) {
+	raw, err := json.Marshal(struct {
+		Data json.RawMessage `json:"data"`
+		ID   string          `json:"id"`
+		Type string          `json:"type"`
+	}{r.Data, r.ID, r.Type})
+	if err != nil {
+		return nil, err
+	}
+	canonical, err := Canonicalize(raw)
+	if err != nil {
+		return nil, fmt.Errorf("record %s %s is not valid JSON: %w", r.Type, r.ID, err)
+	}
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(canonical)
+	return h.Sum(nil), nil
+}
+
+// nodeHash combines two Merkle tree nodes
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// splitPoint is the largest power of two smaller than n
+func splitPoint(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+// merkleTreeHash is the RFC 6962 Merkle tree hash of leaf hashes
+func merkleTreeHash(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return nodeHash(merkleTreeHash(leaves[:k]), merkleTreeHash(leaves[k:]))
+}
+
+// auditPath is the RFC 6962 inclusion proof of leaf m, ordered from the leaf up
+func auditPath(m int, leaves [][]byte) []ProofStep {
+	if len(leaves) <= 1 {
+		return []ProofStep{}
+	}
+	k := splitPoint(len(leaves))
+	if m < k {
+		return append(auditPath(m, leaves[:k]), ProofStep{Right: hex.EncodeToString(merkleTreeHash(leaves[k:]))})
+	}
+	return append(auditPath(m-k, leaves[k:]), ProofStep{Left: hex.EncodeToString(merkleTreeHash(leaves[:k]))})
+}
+
+// RootFromProof folds an inclusion proof over a leaf hash
+func RootFromProof(leaf []byte, proof []ProofStep) ([]byte, error) {
+	node := leaf
+	for i, step := range proof {
+		switch {
+		case step.Left != "" && step.Right == "":
+			sibling, err := decodeHash(step.Left)
+			if err != nil {
+				return nil, fmt.Errorf("proof step %d: %w", i, err)
+			}
+			node = nodeHash(sibling, node)
+		case step.Right != "" && step.Left == "":
+			sibling, err := decodeHash(step.Right)
+			if err != nil {
+				return nil, fmt.Errorf("proof step %d: %w", i, err)
+			}
+			node = nodeHash(node, sibling)
+		default:
+			return nil, fmt.Errorf("proof step %d must have exactly one of left and right", i)
+		}
+	}
+	return node, nil
+}
+
+// decodeHash decodes a hex SHA-256 digest
+func decodeHash(value string) ([]byte, error) {
+	decoded, err := hex.DecodeString(value)
+	if err != nil || len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("%q is not a hex SHA-256 digest", value)
+	}
+	return decoded, nil
+}
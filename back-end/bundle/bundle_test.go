@@ -0,0 +1,157 @@
+package bundle
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// testSigner signs like the platform's payload keys: ES256 detached compact JWS
+func testSigner(t *testing.T) (Signer, JWKS) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := make([]byte, 64)
+	private.X.FillBytes(point[:32])
+	private.Y.FillBytes(point[32:])
+	keys := JWKS{Keys: []JWK{{
+		Kty: "EC", Crv: "P-256", Kid: "test-key", Use: "sig", Alg: "ES256",
+		X: base64.RawURLEncoding.EncodeToString(point[:32]),
+		Y: base64.RawURLEncoding.EncodeToString(point[32:]),
+	}}}
+	sign := func(payload []byte) (string, error) {
+		protected := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","kid":"test-key","typ":"JOSE"}`))
+		digest := sha256.Sum256([]byte(protected + "." + base64.RawURLEncoding.EncodeToString(payload)))
+		r, s, err := ecdsa.Sign(rand.Reader, private, digest[:])
+		if err != nil {
+			return "", err
+		}
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return protected + ".." + base64.RawURLEncoding.EncodeToString(signature), nil
+	}
+	return sign, keys
+}
+
+// testBundle builds a bundle of n records, the last one anchoring the batch
+func testBundle(t *testing.T, n int) (*Bundle, JWKS) {
+	sign, keys := testSigner(t)
+	records := []Record{}
+	batch, _ := NewRecord(RecordBatch, "7", map[string]interface{}{"id": 7, "species": "P. vannamei", "quantity": 100000})
+	records = append(records, batch)
+	for i := 1; i < n-1; i++ {
+		event, _ := NewRecord(RecordEvent, strings.Repeat("1", i), map[string]interface{}{"event_type": "feeding", "note": "<ok> & done"})
+		records = append(records, event)
+	}
+	anchor, _ := NewRecord(RecordAnchor, "99", Anchor{
+		RelatedTable: "batch", RelatedID: 7, TxID: "0xabc",
+		MetadataHash: hex.EncodeToString(make([]byte, 32)),
+	})
+	records = append(records, anchor)
+
+	b, err := Build("https://trace.example", 7, testNow, records, sign, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, keys
+}
+
+func TestBuildAndVerifyRoundTrip(t *testing.T) {
+	for _, n := range []int{2, 3, 5, 8, 13} {
+		b, keys := testBundle(t, n)
+
+		raw, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := Decode(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report := Verify(decoded, &keys)
+		if !report.Valid {
+			t.Fatalf("%d records: expected a valid bundle, got %v", n, report.Errors)
+		}
+		if report.KeyID != "test-key" || report.Records != n || report.Anchors != 1 {
+			t.Fatalf("%d records: unexpected report %+v", n, report)
+		}
+		if len(report.Warnings) != 0 {
+			t.Fatalf("%d records: unexpected warnings %v", n, report.Warnings)
+		}
+
+		embedded := Verify(decoded, nil)
+		if !embedded.Valid || len(embedded.Warnings) != 1 {
+			t.Fatalf("%d records: expected a valid bundle with a key warning, got %+v", n, embedded)
+		}
+	}
+}
+
+func TestVerifySingleRecord(t *testing.T) {
+	b, _ := testBundle(t, 6)
+	root, _ := hex.DecodeString(b.Manifest.MerkleRoot)
+	for _, record := range b.Records {
+		if err := VerifyRecord(record, root); err != nil {
+			t.Fatalf("record %s %s: %v", record.Type, record.ID, err)
+		}
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(b *Bundle, keys *JWKS)
+	}{
+		{"record data", func(b *Bundle, _ *JWKS) {
+			b.Records[0].Data = json.RawMessage(`{"id":7,"species":"P. vannamei","quantity":200000}`)
+		}},
+		{"dropped record", func(b *Bundle, _ *JWKS) {
+			b.Records = b.Records[1:]
+		}},
+		{"reordered records", func(b *Bundle, _ *JWKS) {
+			b.Records[1], b.Records[2] = b.Records[2], b.Records[1]
+		}},
+		{"manifest root", func(b *Bundle, _ *JWKS) {
+			b.Manifest.MerkleRoot = strings.Repeat("0", 64)
+		}},
+		{"manifest batch", func(b *Bundle, _ *JWKS) {
+			b.Manifest.BatchID = 8
+		}},
+		{"foreign key", func(_ *Bundle, keys *JWKS) {
+			keys.Keys[0].Kid = "other-key"
+		}},
+		{"dangling anchor", func(b *Bundle, _ *JWKS) {
+			b.Records = b.Records[1:]
+			b.Manifest.RecordCount--
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, keys := testBundle(t, 5)
+			tt.tamper(b, &keys)
+			if report := Verify(b, &keys); report.Valid {
+				t.Fatal("expected tampering to be detected")
+			}
+		})
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	canonical, err := Canonicalize([]byte(`{ "b": 1.50, "a": {"d": "<x>", "c": [3, 1]} }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":{"c":[3,1],"d":"<x>"},"b":1.50}`; string(canonical) != want {
+		t.Fatalf("expected %s, got %s", want, canonical)
+	}
+}
@@ -0,0 +1,45 @@
+// Package bundle defines the signed batch history bundle exported by GET /api/v1/batches/{id}/bundle
+// and verifies bundles completely offline. It only depends on the standard library, so third parties
+// can import it, or the verify-bundle command built from it, without the rest of the platform.
+//
+// # Verification spec, format tracepost-batch-bundle/v1
+//
+// A bundle is a JSON document:
+//
+//	{
+//	  "manifest":  {"format", "issuer", "batch_id", "exported_at", "record_count", "merkle_root", "hash_algorithm"},
+//	  "records":   [{"type", "id", "data", "leaf_hash", "proof"}, ...],
+//	  "signature": "<detached compact JWS of the manifest>",
+//	  "keys":      {"keys": [<JWK>, ...]}
+//	}
+//
+// Records are the batch itself (type "batch"), its events ("event"), custody transfers ("transfer"),
+// documents ("document", with the IPFS content hash of the file), the water sources of the hatchery in
+// use while the batch was there ("water_source", with their treatment steps) and the blockchain anchors
+// of those records ("anchor", with the transaction ID, block number and anchored payload hash).
+//
+// Canonical JSON. Objects are serialized with their keys sorted by byte value, without insignificant
+// whitespace, with numbers as written in the bundle and without escaping <, > and &. Canonicalize
+// implements it.
+//
+// Leaf hashes. The leaf of a record is SHA-256 of the byte 0x00 followed by the canonical JSON of
+// {"data": <data>, "id": <id>, "type": <type>}. leaf_hash is its lowercase hex encoding.
+//
+// Merkle tree. merkle_root is the RFC 6962 Merkle tree hash of the leaves in record order: an inner
+// node is SHA-256 of the byte 0x01 followed by its left and right child hashes, and a list of n > 1
+// leaves is split after the largest power of two smaller than n.
+//
+// Inclusion proofs. The proof of a record lists the sibling hashes from its leaf up to the root, each
+// as {"left": <hex>} or {"right": <hex>}. Folding a proof over the leaf hash, combining with a left
+// sibling as H(0x01 || sibling || node) and a right sibling as H(0x01 || node || sibling), must give
+// merkle_root. A single record with its proof and the signed manifest is thus verifiable on its own.
+//
+// Signature. signature is a detached compact JWS ("<protected header>..<signature>") over the
+// canonical JSON of the manifest, signed with ES256 or RS256. The key named by the kid of the protected
+// header is included in keys for convenience; verifiers should check it against the platform's
+// published key set at /.well-known/jwks.json, or pass that set to Verify.
+//
+// Anchors. Every anchor refers to a record of the bundle by related_table and related_id, and its
+// metadata_hash, when present, is a hex SHA-256 digest. Checking an anchor's transaction on chain is
+// the only step that needs a network and is left to the verifier.
+package bundle
@@ -0,0 +1,246 @@
+package bundle
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// AnchoredTables maps the related_table of an anchor to the type of the record it anchors
+var AnchoredTables = map[string]string{
+	"batch":             RecordBatch,
+	"event":             RecordEvent,
+	"shipment_transfer": RecordTransfer,
+	"document":          RecordDocument,
+}
+
+// Anchor is the data of an anchor record
+type Anchor struct {
+	RelatedTable       string `json:"related_table"`
+	RelatedID          int    `json:"related_id"`
+	TxID               string `json:"tx_id"`
+	MetadataHash       string `json:"metadata_hash"`
+	NetworkID          string `json:"network_id,omitempty"`
+	ChainType          string `json:"chain_type,omitempty"`
+	BlockNumber        int64  `json:"block_number,omitempty"`
+	ConfirmationStatus string `json:"confirmation_status,omitempty"`
+}
+
+// Report is the outcome of verifying a bundle
+type Report struct {
+	Valid      bool     `json:"valid"`
+	BatchID    int      `json:"batch_id"`
+	MerkleRoot string   `json:"merkle_root"`
+	KeyID      string   `json:"key_id"`
+	Records    int      `json:"records"`
+	Anchors    int      `json:"anchors"`
+	Errors     []string `json:"errors"`
+	Warnings   []string `json:"warnings"`
+}
+
+func (r *Report) fail(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// Decode parses a bundle and checks its format
+func Decode(raw []byte) (*Bundle, error) {
+	var b Bundle
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return nil, fmt.Errorf("not a batch bundle: %w", err)
+	}
+	if b.Manifest.Format != Format {
+		return nil, fmt.Errorf("unsupported bundle format %q", b.Manifest.Format)
+	}
+	return &b, nil
+}
+
+// Verify checks every record against the signed manifest. keys is the platform's published key set;
+// when it is nil the keys embedded in the bundle are used and the report warns to cross-check them
+func Verify(b *Bundle, keys *JWKS) Report {
+	report := Report{
+		BatchID:    b.Manifest.BatchID,
+		MerkleRoot: b.Manifest.MerkleRoot,
+		Records:    len(b.Records),
+		Errors:     []string{},
+		Warnings:   []string{},
+	}
+
+	if b.Manifest.Format != Format {
+		report.fail("unsupported bundle format %q", b.Manifest.Format)
+	}
+	if b.Manifest.HashAlgorithm != HashAlgorithm {
+		report.fail("unsupported hash algorithm %q", b.Manifest.HashAlgorithm)
+	}
+	if b.Manifest.RecordCount != len(b.Records) {
+		report.fail("manifest lists %d records but the bundle has %d", b.Manifest.RecordCount, len(b.Records))
+	}
+
+	// Signature over the manifest
+	set := b.Keys
+	if keys != nil {
+		set = *keys
+	} else {
+		report.Warnings = append(report.Warnings,
+			"signature checked against the keys embedded in the bundle; compare them with the issuer's /.well-known/jwks.json")
+	}
+	payload, err := ManifestPayload(b.Manifest)
+	if err != nil {
+		report.fail("manifest cannot be serialized: %v", err)
+	} else if kid, err := verifyJWS(b.Signature, payload, set); err != nil {
+		report.fail("signature: %v", err)
+	} else {
+		report.KeyID = kid
+	}
+
+	// Records, their proofs and the root of all leaves
+	root, err := decodeHash(b.Manifest.MerkleRoot)
+	if err != nil {
+		report.fail("merkle_root: %v", err)
+	}
+	leaves := make([][]byte, 0, len(b.Records))
+	present := map[string]bool{}
+	for _, record := range b.Records {
+		if err := VerifyRecord(record, root); err != nil {
+			report.fail("%v", err)
+		}
+		if leaf, err := LeafHash(record); err == nil {
+			leaves = append(leaves, leaf)
+		}
+		present[record.Type+":"+record.ID] = true
+	}
+	if root != nil && len(leaves) == len(b.Records) && len(leaves) > 0 && !bytes.Equal(merkleTreeHash(leaves), root) {
+		report.fail("records do not add up to the signed merkle_root")
+	}
+
+	// Anchors must point at records of the bundle
+	for _, record := range b.Records {
+		if record.Type != RecordAnchor {
+			continue
+		}
+		report.Anchors++
+		var anchor Anchor
+		if err := json.Unmarshal(record.Data, &anchor); err != nil {
+			report.fail("anchor %s: %v", record.ID, err)
+			continue
+		}
+		if anchor.TxID == "" {
+			report.fail("anchor %s has no transaction ID", record.ID)
+		}
+		if anchor.MetadataHash != "" {
+			if _, err := decodeHash(strings.TrimPrefix(anchor.MetadataHash, "0x")); err != nil {
+				report.fail("anchor %s metadata_hash: %v", record.ID, err)
+			}
+		}
+		recordType, ok := AnchoredTables[anchor.RelatedTable]
+		if !ok || !present[fmt.Sprintf("%s:%d", recordType, anchor.RelatedID)] {
+			report.fail("anchor %s refers to %s %d, which is not in the bundle", record.ID, anchor.RelatedTable, anchor.RelatedID)
+		}
+	}
+
+	report.Valid = len(report.Errors) == 0
+	return report
+}
+
+// VerifyRecord checks the leaf hash of a record and that its proof leads to root
+func VerifyRecord(record Record, root []byte) error {
+	leaf, err := LeafHash(record)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(leaf) != strings.ToLower(record.LeafHash) {
+		return fmt.Errorf("%s %s: data does not match its leaf_hash", record.Type, record.ID)
+	}
+	computed, err := RootFromProof(leaf, record.Proof)
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", record.Type, record.ID, err)
+	}
+	if root != nil && !bytes.Equal(computed, root) {
+		return fmt.Errorf("%s %s: inclusion proof does not lead to merkle_root", record.Type, record.ID)
+	}
+	return nil
+}
+
+// verifyJWS checks a detached compact JWS of a payload and returns the kid that signed it
+func verifyJWS(jws string, payload []byte, set JWKS) (string, error) {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return "", errors.New("not a detached compact JWS")
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("invalid JWS header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return "", fmt.Errorf("invalid JWS header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("invalid JWS signature")
+	}
+
+	for _, jwk := range set.Keys {
+		if jwk.Kid != header.Kid {
+			continue
+		}
+		if jwk.Alg != header.Alg {
+			return "", fmt.Errorf("key %q is not a %s key", jwk.Kid, header.Alg)
+		}
+		public, err := jwk.PublicKey()
+		if err != nil {
+			return "", err
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload)))
+		valid := false
+		switch public := public.(type) {
+		case *ecdsa.PublicKey:
+			valid = len(signature) == 64 &&
+				ecdsa.Verify(public, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:]))
+		case *rsa.PublicKey:
+			valid = rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+		}
+		if !valid {
+			return "", errors.New("JWS signature does not match the manifest")
+		}
+		return header.Kid, nil
+	}
+	return "", fmt.Errorf("no key %q in the key set", header.Kid)
+}
+
+// PublicKey decodes the EC or RSA public key of a JWK
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case j.Kty == "EC" && j.Crv == "P-256":
+		x, errX := base64.RawURLEncoding.DecodeString(j.X)
+		y, errY := base64.RawURLEncoding.DecodeString(j.Y)
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("invalid coordinates in key %s", j.Kid)
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !public.Curve.IsOnCurve(public.X, public.Y) {
+			return nil, fmt.Errorf("key %s is not on the P-256 curve", j.Kid)
+		}
+		return public, nil
+	case j.Kty == "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(j.N)
+		e, errE := base64.RawURLEncoding.DecodeString(j.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid modulus or exponent in key %s", j.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s/%s", j.Kty, j.Crv)
+}
@@ -0,0 +1,182 @@
+package chains
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// ErrChainNotFound is returned when a chain is not in the registry
+var ErrChainNotFound = errors.New("chain not found in registry")
+
+// Chain is a registered chain and its probed capabilities
+type Chain struct {
+	ChainID  string `json:"chain_id"`
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint"`
+	blockchain.ChainCapabilities
+}
+
+const chainColumns = `
+	chain_id, COALESCE(name, ''), chain_type, endpoint, COALESCE(protocol, ''),
+	supports_nft, supports_ibc, supports_xcm, supports_smart_contracts,
+	COALESCE(block_time_seconds, 0), COALESCE(finality_seconds, 0),
+	reachable, COALESCE(latest_block, 0), COALESCE(probe_error, ''), COALESCE(probed_at, created_at)
+`
+
+// Register probes a chain and stores it in the registry, replacing an earlier registration
+func Register(chainID, name, chainType, endpoint string) (*Chain, error) {
+	chain := &Chain{
+		ChainID:           chainID,
+		Name:              name,
+		Endpoint:          endpoint,
+		ChainCapabilities: blockchain.ProbeChain(chainType, endpoint),
+	}
+	if err := save(chain); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// Probe queries a registered chain again and updates its capabilities
+func Probe(chainID string) (*Chain, error) {
+	chain, err := Get(chainID)
+	if err != nil {
+		return nil, err
+	}
+	chain.ChainCapabilities = blockchain.ProbeChain(chain.ChainType, chain.Endpoint)
+	if err := save(chain); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// Get returns a registered chain
+func Get(chainID string) (*Chain, error) {
+	row := db.DB.QueryRow(`SELECT `+chainColumns+` FROM chain_registry WHERE chain_id = $1 AND is_active = true`, chainID)
+	chain, err := scan(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrChainNotFound, chainID)
+	}
+	return chain, err
+}
+
+// List returns every registered chain
+func List() ([]Chain, error) {
+	rows, err := db.DB.Query(`SELECT ` + chainColumns + ` FROM chain_registry WHERE is_active = true ORDER BY chain_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chains := []Chain{}
+	for rows.Next() {
+		chain, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, *chain)
+	}
+	return chains, nil
+}
+
+// Require checks that a destination chain supports an interop operation
+// Chains that were never registered are left to the adapters, which report their own errors
+func Require(chainID, operation string) error {
+	if db.DB == nil {
+		return nil
+	}
+	chain, err := Get(chainID)
+	if errors.Is(err, ErrChainNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := chain.Supports(operation); err != nil {
+		return fmt.Errorf("chain %s: %w", chainID, err)
+	}
+	return nil
+}
+
+// save upserts a chain and its capabilities
+func save(chain *Chain) error {
+	_, err := db.DB.Exec(`
+		INSERT INTO chain_registry (
+			chain_id, name, chain_type, endpoint, protocol,
+			supports_nft, supports_ibc, supports_xcm, supports_smart_contracts,
+			block_time_seconds, finality_seconds, reachable, latest_block, probe_error, probed_at,
+			created_at, updated_at, is_active
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''), $15, NOW(), NOW(), true)
+		ON CONFLICT (chain_id) DO UPDATE SET
+			name = EXCLUDED.name,
+			chain_type = EXCLUDED.chain_type,
+			endpoint = EXCLUDED.endpoint,
+			protocol = EXCLUDED.protocol,
+			supports_nft = EXCLUDED.supports_nft,
+			supports_ibc = EXCLUDED.supports_ibc,
+			supports_xcm = EXCLUDED.supports_xcm,
+			supports_smart_contracts = EXCLUDED.supports_smart_contracts,
+			block_time_seconds = EXCLUDED.block_time_seconds,
+			finality_seconds = EXCLUDED.finality_seconds,
+			reachable = EXCLUDED.reachable,
+			latest_block = EXCLUDED.latest_block,
+			probe_error = EXCLUDED.probe_error,
+			probed_at = EXCLUDED.probed_at,
+			updated_at = NOW(),
+			is_active = true
+	`, chain.ChainID, chain.Name, chain.ChainType, chain.Endpoint, chain.Protocol,
+		chain.SupportsNFT, chain.SupportsIBC, chain.SupportsXCM, chain.SupportsSmartContracts,
+		chain.BlockTimeSeconds, chain.FinalitySeconds, chain.Reachable, chain.LatestBlock, chain.ProbeError, chain.ProbedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save chain %s: %w", chain.ChainID, err)
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scan reads a chain selected with chainColumns
+func scan(row scanner) (*Chain, error) {
+	var chain Chain
+	err := row.Scan(
+		&chain.ChainID, &chain.Name, &chain.ChainType, &chain.Endpoint, &chain.Protocol,
+		&chain.SupportsNFT, &chain.SupportsIBC, &chain.SupportsXCM, &chain.SupportsSmartContracts,
+		&chain.BlockTimeSeconds, &chain.FinalitySeconds,
+		&chain.Reachable, &chain.LatestBlock, &chain.ProbeError, &chain.ProbedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &chain, nil
+}
+
+// Connect adds a registered chain to an interop client so transactions can be routed to it
+// Chains that were never registered are left as they are
+func Connect(ic *blockchain.InteroperabilityClient, chainID string) error {
+	if _, connected := ic.ConnectedChains[chainID]; connected || db.DB == nil {
+		return nil
+	}
+	chain, err := Get(chainID)
+	if errors.Is(err, ErrChainNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case chain.SupportsIBC && !ic.IBCEnabled:
+		ic.EnableIBCProtocol(map[string]interface{}{})
+	case chain.SupportsXCM && !ic.SubstrateEnabled:
+		ic.EnableSubstrateProtocol(map[string]interface{}{})
+	}
+	_, err = ic.RegisterChain(chain.ChainID, chain.ChainType, chain.Endpoint)
+	return err
+}
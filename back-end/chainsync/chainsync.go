@@ -0,0 +1,406 @@
+package chainsync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/chains"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Sync statuses of a shared batch
+const (
+	StatusInSync  = "in_sync" // the destination has every change
+	StatusPending = "pending" // changes are waiting or the last push failed and will be retried
+	StatusFailed  = "failed"  // retries were exhausted, only a manual sync resumes it
+)
+
+// TxTypeSyncBatchState is the cross-chain transaction type of an incremental update
+const TxTypeSyncBatchState = "SYNC_BATCH_STATE"
+
+// ErrShareNotFound is returned for an unknown batch share
+var ErrShareNotFound = errors.New("batch share not found")
+
+// Result is the outcome of syncing one shared batch
+type Result struct {
+	ShareID     int    `json:"share_id"`
+	BatchID     int    `json:"batch_id"`
+	DestChainID string `json:"dest_chain_id"`
+	SyncStatus  string `json:"sync_status"`
+	Changes     int    `json:"changes"`
+	TxID        string `json:"tx_id,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Service pushes incremental updates of shared batches to their destination chains
+type Service struct {
+	Config      *config.Config
+	Interval    time.Duration
+	MaxFailures int
+	BatchSize   int
+
+	inFlight sync.Map
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates a sync service from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		Config:      cfg,
+		Interval:    time.Duration(cfg.CrossChainSyncIntervalSeconds) * time.Second,
+		MaxFailures: cfg.CrossChainSyncMaxFailures,
+		BatchSize:   100,
+	}
+}
+
+// Default returns the process wide sync service
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Track records that a batch was shared with a chain
+// The current state of the batch is the baseline, later changes are pushed as updates
+func Track(batchID int, destChainID, dataStandard, destTxID string, encrypted bool) error {
+	if db.DB == nil {
+		return nil
+	}
+	_, err := db.DB.Exec(`
+		INSERT INTO batch_share (
+			batch_id, dest_chain_id, data_standard, dest_tx_id, encrypted, sync_status,
+			synced_status, synced_event_id, synced_certificate_id, last_synced_at, created_at, updated_at, is_active
+		)
+		SELECT b.id, $2::text, $3::text, $4::text, $5::boolean, $6::text, b.status,
+			COALESCE((SELECT MAX(id) FROM event WHERE batch_id = b.id), 0),
+			COALESCE((SELECT MAX(id) FROM certificates WHERE batch_id = b.id), 0),
+			NOW(), NOW(), NOW(), true
+		FROM batch b
+		WHERE b.id = $1
+		ON CONFLICT (batch_id, dest_chain_id) DO UPDATE SET
+			data_standard = EXCLUDED.data_standard,
+			dest_tx_id = EXCLUDED.dest_tx_id,
+			encrypted = EXCLUDED.encrypted,
+			sync_status = EXCLUDED.sync_status,
+			synced_status = EXCLUDED.synced_status,
+			synced_event_id = EXCLUDED.synced_event_id,
+			synced_certificate_id = EXCLUDED.synced_certificate_id,
+			failure_count = 0,
+			last_error = NULL,
+			last_synced_at = NOW(),
+			updated_at = NOW(),
+			is_active = true
+	`, batchID, destChainID, dataStandard, destTxID, encrypted, StatusInSync)
+	if err != nil {
+		return fmt.Errorf("failed to track batch share: %w", err)
+	}
+	return nil
+}
+
+// NotifyBatch pushes the changes of a batch to every chain it was shared with
+// It is called after a batch changes and returns immediately
+func NotifyBatch(batchID int) {
+	if db.DB == nil {
+		return
+	}
+	go func() {
+		rows, err := db.DB.Query(`
+			SELECT id FROM batch_share
+			WHERE batch_id = $1 AND is_active = true AND sync_status <> $2
+		`, batchID, StatusFailed)
+		if err != nil {
+			fmt.Printf("Warning: failed to load shares of batch %d: %v\n", batchID, err)
+			return
+		}
+		ids := scanIDs(rows)
+
+		service := Default()
+		for _, id := range ids {
+			service.SyncShare(id)
+		}
+	}()
+}
+
+// Start pushes pending changes on a schedule in the background
+func (s *Service) Start() {
+	go func() {
+		for {
+			time.Sleep(s.Interval)
+
+			if err := s.RunOnce(); err != nil {
+				fmt.Printf("Warning: cross-chain sync run failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// RunOnce syncs every shared batch that has changes the destination has not received
+func (s *Service) RunOnce() error {
+	if db.DB == nil {
+		return nil
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT s.id
+		FROM batch_share s
+		JOIN batch b ON b.id = s.batch_id
+		WHERE s.is_active = true AND s.sync_status <> $1
+			AND (
+				s.sync_status = $2
+				OR b.status IS DISTINCT FROM s.synced_status
+				OR EXISTS (SELECT 1 FROM event e WHERE e.batch_id = s.batch_id AND e.id > s.synced_event_id AND e.is_active = true)
+				OR EXISTS (SELECT 1 FROM certificates c WHERE c.batch_id = s.batch_id AND c.id > s.synced_certificate_id AND c.is_active = true)
+			)
+		ORDER BY s.updated_at
+		LIMIT $3
+	`, StatusFailed, StatusPending, s.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range scanIDs(rows) {
+		s.SyncShare(id)
+	}
+	return nil
+}
+
+// share is the sync state of a shared batch
+type share struct {
+	ID                  int
+	BatchID             int
+	DestChainID         string
+	DataStandard        string
+	SyncedStatus        string
+	SyncedEventID       int
+	SyncedCertificateID int
+	SyncCount           int
+	FailureCount        int
+}
+
+// SyncShare pushes the changes of one shared batch since its last sync
+func (s *Service) SyncShare(shareID int) (*Result, error) {
+	// Scheduled and event driven syncs of the same share must not push the same update twice
+	if _, busy := s.inFlight.LoadOrStore(shareID, true); busy {
+		return &Result{ShareID: shareID, SyncStatus: StatusPending}, nil
+	}
+	defer s.inFlight.Delete(shareID)
+
+	var sh share
+	err := db.DB.QueryRow(`
+		SELECT id, batch_id, dest_chain_id, COALESCE(data_standard, ''), COALESCE(synced_status, ''),
+			synced_event_id, synced_certificate_id, sync_count, failure_count
+		FROM batch_share
+		WHERE id = $1 AND is_active = true
+	`, shareID).Scan(&sh.ID, &sh.BatchID, &sh.DestChainID, &sh.DataStandard, &sh.SyncedStatus,
+		&sh.SyncedEventID, &sh.SyncedCertificateID, &sh.SyncCount, &sh.FailureCount)
+	if err == sql.ErrNoRows {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{ShareID: sh.ID, BatchID: sh.BatchID, DestChainID: sh.DestChainID}
+
+	update, lastEventID, lastCertificateID, changes, err := collectChanges(sh)
+	if err != nil {
+		return nil, err
+	}
+	result.Changes = changes
+
+	if changes == 0 {
+		result.SyncStatus = StatusInSync
+		_, err = db.DB.Exec(`UPDATE batch_share SET sync_status = $2, failure_count = 0, last_error = NULL, updated_at = NOW() WHERE id = $1`, sh.ID, StatusInSync)
+		return result, err
+	}
+
+	txID, err := s.push(sh.DestChainID, update)
+	if err != nil {
+		result.Error = err.Error()
+		result.SyncStatus = StatusPending
+		if sh.FailureCount+1 >= s.MaxFailures {
+			result.SyncStatus = StatusFailed
+		}
+		_, dbErr := db.DB.Exec(`
+			UPDATE batch_share
+			SET sync_status = $2, failure_count = failure_count + 1, last_error = $3, updated_at = NOW()
+			WHERE id = $1
+		`, sh.ID, result.SyncStatus, result.Error)
+		return result, dbErr
+	}
+
+	result.TxID = txID
+	result.SyncStatus = StatusInSync
+	_, err = db.DB.Exec(`
+		UPDATE batch_share
+		SET sync_status = $2, synced_status = $3, synced_event_id = $4, synced_certificate_id = $5,
+			sync_count = sync_count + 1, failure_count = 0, last_error = NULL, last_sync_tx_id = $6,
+			last_synced_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, sh.ID, StatusInSync, update["status"], lastEventID, lastCertificateID, txID)
+	return result, err
+}
+
+// Retry clears the failure state of a share and syncs it immediately
+func (s *Service) Retry(shareID int) (*Result, error) {
+	res, err := db.DB.Exec(`
+		UPDATE batch_share SET sync_status = $2, failure_count = 0, updated_at = NOW()
+		WHERE id = $1 AND is_active = true
+	`, shareID, StatusPending)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrShareNotFound
+	}
+	return s.SyncShare(shareID)
+}
+
+// collectChanges builds the incremental update of a share
+// It returns the update, the newest event and certificate IDs it covers and the number of changes
+func collectChanges(sh share) (map[string]interface{}, int, int, int, error) {
+	var status string
+	if err := db.DB.QueryRow("SELECT COALESCE(status, '') FROM batch WHERE id = $1", sh.BatchID).Scan(&status); err != nil {
+		return nil, 0, 0, 0, err
+	}
+
+	update := map[string]interface{}{
+		"batch_id":      sh.BatchID,
+		"sequence":      sh.SyncCount + 1,
+		"status":        status,
+		"data_standard": sh.DataStandard,
+		"synced_at":     time.Now().UTC().Format(time.RFC3339),
+	}
+	changes := 0
+	if status != sh.SyncedStatus {
+		update["previous_status"] = sh.SyncedStatus
+		update["status_changed"] = true
+		changes++
+	}
+
+	lastEventID := sh.SyncedEventID
+	rows, err := db.DB.Query(`
+		SELECT id, COALESCE(event_type, ''), COALESCE(location, ''), timestamp, COALESCE(metadata, '{}'::jsonb)
+		FROM event
+		WHERE batch_id = $1 AND id > $2 AND is_active = true
+		ORDER BY id
+	`, sh.BatchID, sh.SyncedEventID)
+	if err != nil {
+		return nil, 0, 0, 0, err
+	}
+	events := []map[string]interface{}{}
+	for rows.Next() {
+		var id int
+		var eventType, location string
+		var timestamp sql.NullTime
+		var metadata []byte
+		if err := rows.Scan(&id, &eventType, &location, &timestamp, &metadata); err != nil {
+			rows.Close()
+			return nil, 0, 0, 0, err
+		}
+		event := map[string]interface{}{
+			"id":         id,
+			"event_type": eventType,
+			"location":   location,
+		}
+		if timestamp.Valid {
+			event["timestamp"] = timestamp.Time.UTC().Format(time.RFC3339)
+		}
+		var meta map[string]interface{}
+		if json.Unmarshal(metadata, &meta) == nil {
+			event["metadata"] = meta
+		}
+		events = append(events, event)
+		lastEventID = id
+	}
+	rows.Close()
+
+	lastCertificateID := sh.SyncedCertificateID
+	rows, err = db.DB.Query(`
+		SELECT id, certificate_type, issuer, issue_date, expiry_date, status
+		FROM certificates
+		WHERE batch_id = $1 AND id > $2 AND is_active = true
+		ORDER BY id
+	`, sh.BatchID, sh.SyncedCertificateID)
+	if err != nil {
+		return nil, 0, 0, 0, err
+	}
+	certificates := []map[string]interface{}{}
+	for rows.Next() {
+		var id int
+		var certificateType, issuer, certStatus string
+		var issueDate, expiryDate sql.NullTime
+		if err := rows.Scan(&id, &certificateType, &issuer, &issueDate, &expiryDate, &certStatus); err != nil {
+			rows.Close()
+			return nil, 0, 0, 0, err
+		}
+		certificate := map[string]interface{}{
+			"id":               id,
+			"certificate_type": certificateType,
+			"issuer":           issuer,
+			"status":           certStatus,
+		}
+		if issueDate.Valid {
+			certificate["issue_date"] = issueDate.Time.UTC().Format(time.RFC3339)
+		}
+		if expiryDate.Valid {
+			certificate["expiry_date"] = expiryDate.Time.UTC().Format(time.RFC3339)
+		}
+		certificates = append(certificates, certificate)
+		lastCertificateID = id
+	}
+	rows.Close()
+
+	if len(events) > 0 {
+		update["events"] = events
+	}
+	if len(certificates) > 0 {
+		update["certificates"] = certificates
+	}
+	changes += len(events) + len(certificates)
+	return update, lastEventID, lastCertificateID, changes, nil
+}
+
+// push sends an update to the destination chain
+// Each push uses its own client since syncs of different shares run concurrently
+func (s *Service) push(destChainID string, update map[string]interface{}) (string, error) {
+	client := blockchain.NewBlockchainClient(
+		s.Config.BlockchainNodeURL,
+		s.Config.BlockchainPrivateKey,
+		s.Config.BlockchainAccount,
+		s.Config.BlockchainChainID,
+		s.Config.BlockchainConsensus,
+	)
+	if err := chains.Connect(client.InteropClient, destChainID); err != nil {
+		return "", fmt.Errorf("failed to connect to %s: %w", destChainID, err)
+	}
+	tx, err := client.InteropClient.SendCrossChainTransaction(destChainID, TxTypeSyncBatchState, update, "")
+	if err != nil {
+		return "", err
+	}
+	return tx.DestinationTxID, nil
+}
+
+// scanIDs reads a column of IDs and closes the rows
+func scanIDs(rows *sql.Rows) []int {
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
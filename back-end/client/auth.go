@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// LoginRequest is the body of POST /auth/login
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RefreshTokenRequest is the body of POST /auth/refresh
+type RefreshTokenRequest struct {
+	AccessToken string `json:"access_token"`
+}
+
+// TokenResponse is the access token issued by login and refresh
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	UserID      int    `json:"user_id"`
+	Role        string `json:"role"`
+}
+
+// Login exchanges credentials for an access token. The credentials are kept in memory so the client
+// can log in again when the token is revoked
+func (c *Client) Login(ctx context.Context, username, password string) (*TokenResponse, error) {
+	token, err := c.login(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.username, c.password = username, password
+	c.mu.Unlock()
+	return token, nil
+}
+
+func (c *Client) login(ctx context.Context, username, password string) (*TokenResponse, error) {
+	raw, err := c.do(ctx, http.MethodPost, "/auth/login", nil, LoginRequest{Username: username, Password: password}, false)
+	if err != nil {
+		return nil, err
+	}
+	var token TokenResponse
+	if err := decodeData(raw, &token); err != nil {
+		return nil, err
+	}
+	c.setToken(token)
+	return &token, nil
+}
+
+// relogin logs in again with the credentials of the last Login
+func (c *Client) relogin(ctx context.Context) error {
+	c.mu.Lock()
+	username, password := c.username, c.password
+	c.mu.Unlock()
+	_, err := c.login(ctx, username, password)
+	return err
+}
+
+// Refresh replaces the access token with a new one
+func (c *Client) Refresh(ctx context.Context) (*TokenResponse, error) {
+	raw, err := c.do(ctx, http.MethodPost, "/auth/refresh", nil, RefreshTokenRequest{AccessToken: c.Token()}, false)
+	if err != nil {
+		return nil, err
+	}
+	var token TokenResponse
+	if err := decodeData(raw, &token); err != nil {
+		return nil, err
+	}
+	c.setToken(token)
+	return &token, nil
+}
+
+// Logout revokes the access token and forgets the stored credentials
+func (c *Client) Logout(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodPost, "/auth/logout", nil, nil, true)
+	c.mu.Lock()
+	c.token, c.expiresAt, c.username, c.password = "", time.Time{}, "", ""
+	c.mu.Unlock()
+	return err
+}
+
+// SetToken authenticates the client with an access token obtained elsewhere
+func (c *Client) SetToken(token string, expiresAt time.Time) {
+	c.mu.Lock()
+	c.token, c.expiresAt = token, expiresAt
+	c.mu.Unlock()
+}
+
+// Token is the current access token
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *Client) setToken(token TokenResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token.AccessToken
+	c.expiresAt = time.Time{}
+	if token.ExpiresIn > 0 {
+		c.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+}
+
+func (c *Client) hasCredentials() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.username != ""
+}
+
+// refreshIfExpiring refreshes the access token shortly before it expires
+func (c *Client) refreshIfExpiring(ctx context.Context) error {
+	c.mu.Lock()
+	expiring := c.token != "" && !c.expiresAt.IsZero() && time.Until(c.expiresAt) < c.refreshAhead
+	c.mu.Unlock()
+	if !expiring {
+		return nil
+	}
+	if _, err := c.Refresh(ctx); err != nil {
+		if c.hasCredentials() {
+			return c.relogin(ctx)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/bundle"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// CreateBatchRequest is the body of POST /batches
+type CreateBatchRequest struct {
+	HatcheryID int    `json:"hatchery_id"`
+	Species    string `json:"species"`
+	Quantity   int    `json:"quantity"`
+	StrainID   int    `json:"strain_id,omitempty"`
+}
+
+// UpdateBatchStatusRequest is the body of PUT /batches/{id}/status
+type UpdateBatchStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// CreateEventRequest is the body of POST /events
+type CreateEventRequest struct {
+	BatchID   int                    `json:"batch_id"`
+	EventType string                 `json:"event_type"`
+	Location  string                 `json:"location"`
+	ActorID   int                    `json:"actor_id,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// BatchFilter narrows the batch list; zero fields are not filtered on
+type BatchFilter struct {
+	ViewID     int    // Saved batch view to start from
+	Status     string // Comma separated statuses
+	Species    string
+	HatcheryID int
+	CompanyID  int
+}
+
+// EventFilter narrows the event list
+type EventFilter struct {
+	BatchID   int
+	EventType string
+}
+
+// EnvironmentFilter narrows the environment data list
+type EnvironmentFilter struct {
+	BatchID int
+}
+
+func (f BatchFilter) query() url.Values {
+	query := url.Values{}
+	if f.ViewID > 0 {
+		query.Set("view", strconv.Itoa(f.ViewID))
+	}
+	if f.Status != "" {
+		query.Set("status", f.Status)
+	}
+	if f.Species != "" {
+		query.Set("species", f.Species)
+	}
+	if f.HatcheryID > 0 {
+		query.Set("hatchery_id", strconv.Itoa(f.HatcheryID))
+	}
+	if f.CompanyID > 0 {
+		query.Set("company_id", strconv.Itoa(f.CompanyID))
+	}
+	return query
+}
+
+func pageQuery(limit, offset int) url.Values {
+	return url.Values{"limit": {strconv.Itoa(limit)}, "offset": {strconv.Itoa(offset)}}
+}
+
+// ListBatches lists the active batches
+func (c *Client) ListBatches(ctx context.Context, filter BatchFilter) ([]models.Batch, error) {
+	batches := []models.Batch{}
+	err := c.Do(ctx, http.MethodGet, "/batches", filter.query(), nil, &batches)
+	return batches, err
+}
+
+// GetBatch gets a batch by ID
+func (c *Client) GetBatch(ctx context.Context, batchID int) (*models.Batch, error) {
+	var batch models.Batch
+	if err := c.Do(ctx, http.MethodGet, fmt.Sprintf("/batches/%d", batchID), nil, nil, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// CreateBatch creates a batch
+func (c *Client) CreateBatch(ctx context.Context, req CreateBatchRequest) (*models.Batch, error) {
+	var batch models.Batch
+	if err := c.Do(ctx, http.MethodPost, "/batches", nil, req, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// UpdateBatchStatus changes the status of a batch
+func (c *Client) UpdateBatchStatus(ctx context.Context, batchID int, status string) error {
+	return c.Do(ctx, http.MethodPut, fmt.Sprintf("/batches/%d/status", batchID), nil, UpdateBatchStatusRequest{Status: status}, nil)
+}
+
+// GetBatchEvents lists the events of a batch with the accounts that recorded them
+func (c *Client) GetBatchEvents(ctx context.Context, batchID int) ([]models.EventWithActor, error) {
+	events := []models.EventWithActor{}
+	err := c.Do(ctx, http.MethodGet, fmt.Sprintf("/batches/%d/events", batchID), nil, nil, &events)
+	return events, err
+}
+
+// GetBatchDocuments lists the documents of a batch the caller may see
+func (c *Client) GetBatchDocuments(ctx context.Context, batchID int) ([]models.Document, error) {
+	documents := []models.Document{}
+	err := c.Do(ctx, http.MethodGet, fmt.Sprintf("/batches/%d/documents", batchID), nil, nil, &documents)
+	return documents, err
+}
+
+// GetBatchTransfers lists the custody transfers of a batch
+func (c *Client) GetBatchTransfers(ctx context.Context, batchID int) ([]models.ShipmentTransfer, error) {
+	transfers := []models.ShipmentTransfer{}
+	err := c.Do(ctx, http.MethodGet, fmt.Sprintf("/shipments/transfers/batch/%d", batchID), nil, nil, &transfers)
+	return transfers, err
+}
+
+// GetBatchBundle exports the signed history bundle of a batch; check it with bundle.Verify
+func (c *Client) GetBatchBundle(ctx context.Context, batchID int) (*bundle.Bundle, error) {
+	var b bundle.Bundle
+	if err := c.Do(ctx, http.MethodGet, fmt.Sprintf("/batches/%d/bundle", batchID), nil, nil, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// JWKS gets the published keys the platform signs bundles and webhooks with
+func (c *Client) JWKS(ctx context.Context) (*bundle.JWKS, error) {
+	var keys bundle.JWKS
+	if err := c.Do(ctx, http.MethodGet, "/.well-known/jwks.json", nil, nil, &keys); err != nil {
+		return nil, err
+	}
+	return &keys, nil
+}
+
+// CreateEvent records an event of a batch
+func (c *Client) CreateEvent(ctx context.Context, req CreateEventRequest) (*models.Event, error) {
+	var event models.Event
+	if err := c.Do(ctx, http.MethodPost, "/events", nil, req, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// GetEvent gets an event by ID
+func (c *Client) GetEvent(ctx context.Context, eventID int) (*models.Event, error) {
+	var event models.Event
+	if err := c.Do(ctx, http.MethodGet, fmt.Sprintf("/events/%d", eventID), nil, nil, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Events iterates over the events matching a filter, newest first
+func (c *Client) Events(filter EventFilter) *Pager[models.Event] {
+	return NewPager(func(ctx context.Context, limit, offset int) ([]models.Event, error) {
+		query := pageQuery(limit, offset)
+		if filter.BatchID > 0 {
+			query.Set("batch_id", strconv.Itoa(filter.BatchID))
+		}
+		if filter.EventType != "" {
+			query.Set("event_type", filter.EventType)
+		}
+		events := []models.Event{}
+		err := c.Do(ctx, http.MethodGet, "/events", query, nil, &events)
+		return events, err
+	})
+}
+
+// EnvironmentData iterates over the environment readings matching a filter
+func (c *Client) EnvironmentData(filter EnvironmentFilter) *Pager[models.EnvironmentData] {
+	return NewPager(func(ctx context.Context, limit, offset int) ([]models.EnvironmentData, error) {
+		query := pageQuery(limit, offset)
+		if filter.BatchID > 0 {
+			query.Set("batch_id", strconv.Itoa(filter.BatchID))
+		}
+		readings := []models.EnvironmentData{}
+		err := c.Do(ctx, http.MethodGet, "/environment", query, nil, &readings)
+		return readings, err
+	})
+}
@@ -0,0 +1,265 @@
+// Package client is a Go client of the TracePost REST API. It handles authentication, retries of
+// throttled or unavailable requests and pagination, and decodes responses into the same models the
+// server serializes.
+//
+//	c := client.New("https://api.tracepost.example")
+//	if _, err := c.Login(ctx, "hatchery-operator", password); err != nil {
+//		return err
+//	}
+//	batch, err := c.GetBatch(ctx, 42)
+//
+//	events := c.Events(client.EventFilter{BatchID: 42})
+//	for events.Next(ctx) {
+//		fmt.Println(events.Item().EventType)
+//	}
+//	if err := events.Err(); err != nil {
+//		return err
+//	}
+//
+// Endpoints without a typed method can be called with Do.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIPrefix is the path prefix of the versioned API
+const APIPrefix = "/api/v1"
+
+// Client calls the TracePost API; it is safe for concurrent use
+type Client struct {
+	BaseURL    string        // Server URL without the /api/v1 prefix
+	HTTPClient *http.Client  // Defaults to a client with a 30 second timeout
+	UserAgent  string        // Sent with every request
+	MaxRetries int           // Retries of throttled, unavailable or failed requests
+	RetryWait  time.Duration // Wait before the first retry, doubled on each one unless the server sends Retry-After
+	MaxWait    time.Duration // Upper bound of a single wait
+
+	mu           sync.Mutex
+	token        string
+	expiresAt    time.Time
+	username     string
+	password     string
+	refreshAhead time.Duration // Tokens expiring sooner are refreshed before the next request
+}
+
+// New creates a client of the API served at baseURL
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		UserAgent:    "tracepost-go-client/1",
+		MaxRetries:   3,
+		RetryWait:    500 * time.Millisecond,
+		MaxWait:      30 * time.Second,
+		refreshAhead: time.Minute,
+	}
+}
+
+// Error is an API error, decoded from the problem document the server returns
+type Error struct {
+	Type       string        `json:"type"`
+	Title      string        `json:"title"`
+	Status     int           `json:"status"`
+	Detail     string        `json:"detail,omitempty"`
+	Instance   string        `json:"instance,omitempty"`
+	Code       string        `json:"code"`
+	RequestID  string        `json:"request_id,omitempty"`
+	Message    string        `json:"message"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *Error) Error() string {
+	detail := e.Detail
+	if detail == "" {
+		detail = e.Message
+	}
+	if detail == "" {
+		detail = e.Title
+	}
+	if e.RequestID != "" {
+		return fmt.Sprintf("tracepost: %d %s (request %s)", e.Status, detail, e.RequestID)
+	}
+	return fmt.Sprintf("tracepost: %d %s", e.Status, detail)
+}
+
+// IsNotFound reports whether err is an API error with status 404
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+// envelope is the success response of the API; Data is decoded into the caller's value
+type envelope struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Do calls an API endpoint. path is relative to /api/v1 unless it starts with "/.well-known"; body is
+// sent as JSON and the data of the response, or the whole response when it has no envelope, is
+// decoded into out
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	raw, err := c.do(ctx, method, path, query, body, true)
+	if err != nil || out == nil {
+		return err
+	}
+	return decodeData(raw, out)
+}
+
+// do sends a request with retries and returns the raw body of a successful response
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}, authenticated bool) ([]byte, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("tracepost: failed to encode request: %w", err)
+		}
+	}
+	if authenticated {
+		if err := c.refreshIfExpiring(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	target := c.BaseURL + APIPrefix + path
+	if strings.HasPrefix(path, "/.well-known") {
+		target = c.BaseURL + path
+	}
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	reloggedIn := false
+	for attempt := 0; ; attempt++ {
+		raw, err := c.send(ctx, method, target, payload, authenticated)
+		if err == nil {
+			return raw, nil
+		}
+
+		var apiErr *Error
+		isAPIError := errors.As(err, &apiErr)
+		if isAPIError && apiErr.Status == http.StatusUnauthorized && authenticated && !reloggedIn && c.hasCredentials() {
+			// The token expired or was revoked; log in again once with the stored credentials
+			reloggedIn = true
+			if loginErr := c.relogin(ctx); loginErr != nil {
+				return nil, loginErr
+			}
+			attempt--
+			continue
+		}
+		if attempt >= c.MaxRetries || !retryable(method, err) {
+			return nil, err
+		}
+
+		wait := c.RetryWait << attempt
+		if isAPIError && apiErr.RetryAfter > 0 {
+			wait = apiErr.RetryAfter
+		}
+		if c.MaxWait > 0 && wait > c.MaxWait {
+			wait = c.MaxWait
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send performs a single request
+func (c *Client) send(ctx context.Context, method, target string, payload []byte, authenticated bool) ([]byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	if authenticated {
+		if token := c.Token(); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return raw, nil
+	}
+
+	apiErr := &Error{Status: resp.StatusCode}
+	if json.Unmarshal(raw, apiErr) != nil || apiErr.Status == 0 {
+		apiErr.Status = resp.StatusCode
+		apiErr.Title = http.StatusText(resp.StatusCode)
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return nil, apiErr
+}
+
+// retryable reports whether a failed request may be sent again. Throttled and shed requests were not
+// processed, so they are retried for every method; other failures only for idempotent methods
+func retryable(method string, err error) bool {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Status {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return true
+		case http.StatusBadGateway, http.StatusGatewayTimeout:
+			return method != http.MethodPost && method != http.MethodPatch
+		}
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// Transport errors
+	return method != http.MethodPost && method != http.MethodPatch
+}
+
+// decodeData decodes the data of an enveloped response, or the whole response without an envelope
+func decodeData(raw []byte, out interface{}) error {
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err == nil && env.Data != nil && (env.Success || env.Message != "") {
+		raw = env.Data
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("tracepost: failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestRetriesThrottledRequests(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{"status": 429, "code": "RATE_LIMITED", "title": "Too Many Requests"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "ok", "data": map[string]interface{}{"id": 7, "species": "P. monodon"}})
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	c.RetryWait = time.Millisecond
+	batch, err := c.GetBatch(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.ID != 7 || batch.Species != "P. monodon" || calls != 3 {
+		t.Fatalf("unexpected batch %+v after %d calls", batch, calls)
+	}
+}
+
+func TestProblemErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", "req-1")
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"status": 404, "code": "NOT_FOUND", "detail": "Batch not found"})
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).GetBatch(context.Background(), 1)
+	if !IsNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+	if apiErr := err.(*Error); apiErr.Code != "NOT_FOUND" || apiErr.RequestID != "req-1" {
+		t.Fatalf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestLogsInAgainOnUnauthorized(t *testing.T) {
+	var logins int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == APIPrefix+"/auth/login":
+			n := atomic.AddInt32(&logins, 1)
+			writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "ok",
+				"data": TokenResponse{AccessToken: fmt.Sprintf("token-%d", n), ExpiresIn: 3600}})
+		case r.Header.Get("Authorization") != "Bearer token-2":
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"status": 401, "code": "UNAUTHORIZED"})
+		default:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "ok", "data": map[string]interface{}{"id": 3}})
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	if _, err := c.Login(context.Background(), "operator", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	event, err := c.GetEvent(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != 3 || logins != 2 || c.Token() != "token-2" {
+		t.Fatalf("unexpected event %+v after %d logins", event, logins)
+	}
+}
+
+func TestEventsPager(t *testing.T) {
+	const total = 250
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if r.URL.Query().Get("batch_id") != "9" {
+			t.Errorf("batch filter not sent: %s", r.URL.RawQuery)
+		}
+		events := []map[string]interface{}{}
+		for i := offset; i < total && i < offset+limit; i++ {
+			events = append(events, map[string]interface{}{"id": i + 1, "batch_id": 9, "metadata": map[string]interface{}{"n": i}})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "ok", "data": events})
+	}))
+	defer server.Close()
+
+	events, err := New(server.URL).Events(EventFilter{BatchID: 9}).All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != total || events[0].ID != 1 || events[total-1].ID != total {
+		t.Fatalf("expected %d events in order, got %d", total, len(events))
+	}
+	if string(events[1].Metadata) != `{"n":1}` {
+		t.Fatalf("unexpected metadata %s", events[1].Metadata)
+	}
+}
@@ -0,0 +1,76 @@
+package client
+
+import "context"
+
+// MaxPageSize is the largest page the list endpoints return
+const MaxPageSize = 100
+
+// PageFunc fetches one page of a list endpoint
+type PageFunc[T any] func(ctx context.Context, limit, offset int) ([]T, error)
+
+// Pager iterates over every item of a limit/offset paginated list, fetching pages as it goes
+type Pager[T any] struct {
+	PageSize int // Items requested per page, at most MaxPageSize
+
+	fetch  PageFunc[T]
+	page   []T
+	index  int
+	offset int
+	done   bool
+	item   T
+	err    error
+}
+
+// NewPager creates a pager over a list endpoint
+func NewPager[T any](fetch PageFunc[T]) *Pager[T] {
+	return &Pager[T]{PageSize: MaxPageSize, fetch: fetch}
+}
+
+// Next advances to the next item, fetching the next page when needed; it returns false at the end of
+// the list or on an error, which Err returns
+func (p *Pager[T]) Next(ctx context.Context) bool {
+	if p.err != nil {
+		return false
+	}
+	if p.index >= len(p.page) {
+		if p.done {
+			return false
+		}
+		size := p.PageSize
+		if size <= 0 || size > MaxPageSize {
+			size = MaxPageSize
+		}
+		page, err := p.fetch(ctx, size, p.offset)
+		if err != nil {
+			p.err = err
+			return false
+		}
+		// A short page is the last one
+		p.page, p.index, p.offset, p.done = page, 0, p.offset+len(page), len(page) < size
+		if len(page) == 0 {
+			return false
+		}
+	}
+	p.item = p.page[p.index]
+	p.index++
+	return true
+}
+
+// Item is the current item
+func (p *Pager[T]) Item() T {
+	return p.item
+}
+
+// Err is the error that stopped the iteration
+func (p *Pager[T]) Err() error {
+	return p.err
+}
+
+// All collects the remaining items
+func (p *Pager[T]) All(ctx context.Context) ([]T, error) {
+	items := []T{}
+	for p.Next(ctx) {
+		items = append(items, p.Item())
+	}
+	return items, p.Err()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/tenantsnapshot"
+)
+
+func main() {
+	exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+	exportCompany := exportCmd.Int("company", 0, "ID of the company to export")
+	exportOut := exportCmd.String("out", "", "Snapshot file to write (default company-<id>.snapshot.json.gz)")
+
+	inspectCmd := flag.NewFlagSet("inspect", flag.ExitOnError)
+	inspectIn := inspectCmd.String("in", "", "Snapshot file to read")
+
+	restoreCmd := flag.NewFlagSet("restore", flag.ExitOnError)
+	restoreIn := restoreCmd.String("in", "", "Snapshot file to restore")
+	restoreMode := restoreCmd.String("mode", tenantsnapshot.ModeCopy, "copy (new global IDs) or migrate (keep global IDs)")
+	restoreName := restoreCmd.String("name", "", "Name of the restored company")
+	restoreDryRun := restoreCmd.Bool("dry-run", false, "Report the restore and roll it back")
+
+	if len(os.Args) < 2 {
+		fmt.Println("Expected 'export', 'inspect' or 'restore' subcommands")
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "export":
+		exportCmd.Parse(os.Args[2:])
+		if *exportCompany <= 0 {
+			fmt.Println("Company ID is required")
+			exportCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		path := *exportOut
+		if path == "" {
+			path = fmt.Sprintf("company-%d.snapshot.json.gz", *exportCompany)
+		}
+		exportSnapshot(*exportCompany, path)
+
+	case "inspect":
+		inspectCmd.Parse(os.Args[2:])
+		if *inspectIn == "" {
+			fmt.Println("Snapshot file is required")
+			inspectCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		snap, checksum := readSnapshot(*inspectIn)
+		fmt.Println("Checksum:", checksum)
+		printJSON(snap.Summary())
+
+	case "restore":
+		restoreCmd.Parse(os.Args[2:])
+		if *restoreIn == "" {
+			fmt.Println("Snapshot file is required")
+			restoreCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		restoreSnapshot(*restoreIn, tenantsnapshot.RestoreOptions{
+			Mode:        *restoreMode,
+			DryRun:      *restoreDryRun,
+			CompanyName: *restoreName,
+		})
+
+	default:
+		fmt.Println("Expected 'export', 'inspect' or 'restore' subcommands")
+		os.Exit(1)
+	}
+}
+
+func connect() {
+	if err := db.InitDB(); err != nil {
+		fmt.Println("Error connecting to the database:", err)
+		os.Exit(1)
+	}
+}
+
+func exportSnapshot(companyID int, path string) {
+	connect()
+	defer db.Close()
+
+	snap, err := tenantsnapshot.Export(companyID)
+	if err != nil {
+		fmt.Println("Error exporting snapshot:", err)
+		os.Exit(1)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		fmt.Println("Error creating snapshot file:", err)
+		os.Exit(1)
+	}
+	checksum, err := tenantsnapshot.Encode(file, snap)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Println("Error writing snapshot file:", err)
+		os.Exit(1)
+	}
+	if _, err := tenantsnapshot.RecordExport(snap, checksum, 0); err != nil {
+		fmt.Println("Warning: failed to record the export:", err)
+	}
+
+	fmt.Println("Snapshot of company", companyID, "taken at", snap.TakenAt.UTC().Format("2006-01-02 15:04:05 MST"))
+	fmt.Println("Saved to:", path)
+	fmt.Println("Checksum:", checksum)
+	fmt.Println("IMPORTANT: The snapshot holds the company's data. Keep this file secure.")
+}
+
+func readSnapshot(path string) (*tenantsnapshot.Snapshot, string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Println("Error opening snapshot file:", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+	snap, checksum, err := tenantsnapshot.Decode(file)
+	if err != nil {
+		fmt.Println("Error reading snapshot file:", err)
+		os.Exit(1)
+	}
+	return snap, checksum
+}
+
+func restoreSnapshot(path string, opts tenantsnapshot.RestoreOptions) {
+	snap, checksum := readSnapshot(path)
+	opts.Checksum = checksum
+	connect()
+	defer db.Close()
+
+	report, err := tenantsnapshot.Restore(snap, opts)
+	if err != nil {
+		fmt.Println("Error restoring snapshot:", err)
+		os.Exit(1)
+	}
+	printJSON(report)
+	if opts.DryRun {
+		fmt.Println("Dry run: nothing was kept")
+	} else {
+		fmt.Println("Restored as company", report.CompanyID)
+	}
+}
+
+func printJSON(v interface{}) {
+	out, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(out))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/bundle"
+	"github.com/LTPPPP/TracePost-larvaeChain/client"
+)
+
+func main() {
+	in := flag.String("in", "", "Bundle file exported from GET /api/v1/batches/{id}/bundle")
+	jwksPath := flag.String("jwks", "", "Published key set of the issuer (/.well-known/jwks.json); defaults to the keys in the bundle")
+	server := flag.String("url", "", "Fetch the bundle and the published key set from this server instead of reading -in")
+	batchID := flag.Int("batch", 0, "Batch to fetch from -url")
+	token := flag.String("token", os.Getenv("TRACEPOST_TOKEN"), "Access token for -url, to see restricted documents")
+	flag.Parse()
+
+	if *in == "" && (*server == "" || *batchID <= 0) {
+		fmt.Println("Bundle file, or server URL and batch ID, are required")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	var b *bundle.Bundle
+	var keys *bundle.JWKS
+	if *server != "" {
+		b, keys = fetchBundle(*server, *token, *batchID)
+	} else {
+		raw, err := os.ReadFile(*in)
+		if err != nil {
+			fmt.Println("Failed to read bundle:", err)
+			os.Exit(1)
+		}
+		if b, err = bundle.Decode(raw); err != nil {
+			fmt.Println("Failed to decode bundle:", err)
+			os.Exit(1)
+		}
+	}
+
+	if *jwksPath != "" {
+		rawKeys, err := os.ReadFile(*jwksPath)
+		if err != nil {
+			fmt.Println("Failed to read key set:", err)
+			os.Exit(1)
+		}
+		keys = &bundle.JWKS{}
+		if err := json.Unmarshal(rawKeys, keys); err != nil {
+			fmt.Println("Failed to decode key set:", err)
+			os.Exit(1)
+		}
+	}
+
+	report := bundle.Verify(b, keys)
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if !report.Valid {
+		os.Exit(1)
+	}
+}
+
+// fetchBundle downloads the bundle of a batch and the key set the server publishes
+func fetchBundle(server, token string, batchID int) (*bundle.Bundle, *bundle.JWKS) {
+	ctx := context.Background()
+	c := client.New(server)
+	if token != "" {
+		c.SetToken(token, time.Time{})
+	}
+	b, err := c.GetBatchBundle(ctx, batchID)
+	if err != nil {
+		fmt.Println("Failed to fetch bundle:", err)
+		os.Exit(1)
+	}
+	keys, err := c.JWKS(ctx)
+	if err != nil {
+		fmt.Println("Failed to fetch key set:", err)
+		os.Exit(1)
+	}
+	return b, keys
+}
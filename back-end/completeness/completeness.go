@@ -0,0 +1,344 @@
+package completeness
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// Weights of the parts of the score, out of 100
+const (
+	weightDocuments   = 40
+	weightEnvironment = 30
+	weightEvents      = 30
+)
+
+// Stage is a step of a batch's life, covered when the batch has an event of one of its types
+type Stage struct {
+	Name       string   `json:"name"`
+	EventTypes []string `json:"event_types"`
+}
+
+// Profile is what a company expects of the data of its batches
+type Profile struct {
+	CompanyID            int      `json:"company_id"`
+	RequiredDocuments    []string `json:"required_documents"`     // Document or certificate types, e.g. health_certificate
+	ReadingIntervalHours int      `json:"reading_interval_hours"` // Expected time between environment readings
+	Stages               []Stage  `json:"stages"`
+	NudgeThreshold       int      `json:"nudge_threshold"` // Score below which responsible users are nudged before export
+	IsDefault            bool     `json:"is_default"`      // The company has no profile of its own
+}
+
+// DefaultProfile is used for companies without a profile of their own
+func DefaultProfile(companyID int) Profile {
+	return Profile{
+		CompanyID:            companyID,
+		RequiredDocuments:    []string{"health_certificate"},
+		ReadingIntervalHours: 24,
+		Stages: []Stage{
+			{Name: "hatchery", EventTypes: []string{"batch_created"}},
+			{Name: "quality", EventTypes: []string{"inspection_completed", "lab_result_received", "sample_collected"}},
+			{Name: "shipping", EventTypes: []string{"batch_transfer_initiated", "transfer_initiated", "ownership_transferred", "batch_received", "receipt_confirmed"}},
+		},
+		NudgeThreshold: 80,
+		IsDefault:      true,
+	}
+}
+
+// Normalize trims and lowercases the types of a profile and drops empty ones
+func (p *Profile) Normalize() {
+	p.RequiredDocuments = normalizeTypes(p.RequiredDocuments)
+	stages := []Stage{}
+	for _, stage := range p.Stages {
+		stage.Name = strings.TrimSpace(stage.Name)
+		stage.EventTypes = normalizeTypes(stage.EventTypes)
+		if stage.Name != "" && len(stage.EventTypes) > 0 {
+			stages = append(stages, stage)
+		}
+	}
+	p.Stages = stages
+}
+
+// normalizeTypes trims, lowercases and deduplicates type names
+func normalizeTypes(types []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !seen[t] {
+			seen[t] = true
+			normalized = append(normalized, t)
+		}
+	}
+	return normalized
+}
+
+// LoadProfiles loads the profiles of companies, with the default profile for those without one
+func LoadProfiles(companyIDs []int) (map[int]Profile, error) {
+	profiles := map[int]Profile{}
+	for _, id := range companyIDs {
+		profiles[id] = DefaultProfile(id)
+	}
+	if len(companyIDs) == 0 {
+		return profiles, nil
+	}
+	rows, err := db.DB.Query(`
+		SELECT company_id, required_documents, reading_interval_hours, stages, nudge_threshold
+		FROM completeness_profile WHERE company_id = ANY($1)
+	`, pq.Array(companyIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p Profile
+		var stages []byte
+		if err := rows.Scan(&p.CompanyID, pq.Array(&p.RequiredDocuments), &p.ReadingIntervalHours, &stages, &p.NudgeThreshold); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(stages, &p.Stages); err != nil {
+			return nil, err
+		}
+		profiles[p.CompanyID] = p
+	}
+	return profiles, rows.Err()
+}
+
+// LoadProfile loads the profile of a company, or the default profile when it has none
+func LoadProfile(companyID int) (Profile, error) {
+	profiles, err := LoadProfiles([]int{companyID})
+	if err != nil {
+		return Profile{}, err
+	}
+	return profiles[companyID], nil
+}
+
+// SaveProfile creates or replaces the profile of a company
+func SaveProfile(p Profile, userID int) (Profile, error) {
+	p.Normalize()
+	stages, err := json.Marshal(p.Stages)
+	if err != nil {
+		return Profile{}, err
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO completeness_profile (company_id, required_documents, reading_interval_hours, stages, nudge_threshold, updated_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0))
+		ON CONFLICT (company_id) DO UPDATE SET
+			required_documents = EXCLUDED.required_documents, reading_interval_hours = EXCLUDED.reading_interval_hours,
+			stages = EXCLUDED.stages, nudge_threshold = EXCLUDED.nudge_threshold, updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+	`, p.CompanyID, pq.Array(p.RequiredDocuments), p.ReadingIntervalHours, string(stages), p.NudgeThreshold, userID)
+	if err != nil {
+		return Profile{}, err
+	}
+	p.IsDefault = false
+	return p, nil
+}
+
+// ResetProfile deletes the profile of a company, which falls back to the default profile
+func ResetProfile(companyID int) error {
+	_, err := db.DB.Exec(`DELETE FROM completeness_profile WHERE company_id = $1`, companyID)
+	return err
+}
+
+// batchFacts is what a batch has recorded, as scored against a profile
+type batchFacts struct {
+	companyID         int
+	documents         map[string]bool
+	eventTypes        map[string]bool
+	readingIntervals  int
+	expectedIntervals int
+}
+
+// ScoreBatches scores batches against the profiles of their owners; batches that do not exist are left out
+func ScoreBatches(batchIDs []int) (map[int]*models.BatchCompleteness, error) {
+	scores := map[int]*models.BatchCompleteness{}
+	if len(batchIDs) == 0 {
+		return scores, nil
+	}
+
+	facts := map[int]*batchFacts{}
+	rows, err := db.DB.Query(`
+		SELECT b.id, COALESCE(b.owner_company_id, h.company_id, 0) FROM batch b
+		LEFT JOIN hatchery h ON h.id = b.hatchery_id
+		WHERE b.id = ANY($1)
+	`, pq.Array(batchIDs))
+	if err != nil {
+		return nil, err
+	}
+	companies := map[int]bool{}
+	for rows.Next() {
+		var batchID, companyID int
+		if err := rows.Scan(&batchID, &companyID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		facts[batchID] = &batchFacts{companyID: companyID, documents: map[string]bool{}, eventTypes: map[string]bool{}}
+		companies[companyID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	companyIDs := make([]int, 0, len(companies))
+	for id := range companies {
+		companyIDs = append(companyIDs, id)
+	}
+	profiles, err := LoadProfiles(companyIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Valid documents and certificates
+	if err := collect(`
+		SELECT batch_id, LOWER(doc_type) FROM document
+		WHERE batch_id = ANY($1) AND is_active = true AND doc_type IS NOT NULL AND (expiry_date IS NULL OR expiry_date > NOW())
+		UNION
+		SELECT batch_id, LOWER(certificate_type) FROM certificates
+		WHERE batch_id = ANY($1) AND is_active = true AND status = 'valid' AND (expiry_date IS NULL OR expiry_date > NOW())
+	`, batchIDs, func(f *batchFacts, value string) { f.documents[value] = true }, facts); err != nil {
+		return nil, err
+	}
+	// Event types, corrected events counting once in their latest version
+	if err := collect(`
+		SELECT DISTINCT batch_id, LOWER(event_type) FROM event
+		WHERE batch_id = ANY($1) AND is_active = true AND superseded_by_event_id IS NULL AND event_type IS NOT NULL
+	`, batchIDs, func(f *batchFacts, value string) { f.eventTypes[value] = true }, facts); err != nil {
+		return nil, err
+	}
+
+	// Reading intervals between creation and the first shipment, or now
+	ids := make([]int, 0, len(facts))
+	hours := make([]int, 0, len(facts))
+	for batchID, f := range facts {
+		interval := profiles[f.companyID].ReadingIntervalHours
+		if interval <= 0 {
+			interval = DefaultProfile(0).ReadingIntervalHours
+		}
+		ids = append(ids, batchID)
+		hours = append(hours, interval)
+	}
+	rows, err = db.DB.Query(`
+		WITH w AS (
+			SELECT b.id AS batch_id, p.hours, b.created_at AS starts_at,
+				COALESCE((SELECT MIN(st.transfer_time) FROM shipment_transfer st WHERE st.batch_id = b.id AND st.is_active = true), NOW()) AS ends_at
+			FROM unnest($1::int[], $2::int[]) AS p(batch_id, hours)
+			JOIN batch b ON b.id = p.batch_id
+		)
+		SELECT w.batch_id,
+			GREATEST(1, CEIL(EXTRACT(EPOCH FROM w.ends_at - w.starts_at) / (w.hours * 3600)))::int,
+			(SELECT COUNT(DISTINCT FLOOR(EXTRACT(EPOCH FROM e.timestamp - w.starts_at) / (w.hours * 3600)))
+			 FROM environment_data e
+			 WHERE e.batch_id = w.batch_id AND e.is_active = true AND e.timestamp >= w.starts_at AND e.timestamp < w.ends_at)::int
+		FROM w
+	`, pq.Array(ids), pq.Array(hours))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var batchID, expected, covered int
+		if err := rows.Scan(&batchID, &expected, &covered); err != nil {
+			return nil, err
+		}
+		if f := facts[batchID]; f != nil {
+			f.expectedIntervals = expected
+			f.readingIntervals = covered
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for batchID, f := range facts {
+		scores[batchID] = score(profiles[f.companyID], f)
+	}
+	return scores, nil
+}
+
+// collect reads (batch_id, value) rows into the facts of each batch
+func collect(query string, batchIDs []int, add func(f *batchFacts, value string), facts map[int]*batchFacts) error {
+	rows, err := db.DB.Query(query, pq.Array(batchIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var batchID int
+		var value string
+		if err := rows.Scan(&batchID, &value); err != nil {
+			return err
+		}
+		if f := facts[batchID]; f != nil {
+			add(f, value)
+		}
+	}
+	return rows.Err()
+}
+
+// score rates the facts of a batch against a profile
+func score(p Profile, f *batchFacts) *models.BatchCompleteness {
+	s := &models.BatchCompleteness{
+		Documents:         1,
+		Events:            1,
+		ReadingIntervals:  f.readingIntervals,
+		ExpectedIntervals: f.expectedIntervals,
+		Threshold:         p.NudgeThreshold,
+	}
+	for _, docType := range p.RequiredDocuments {
+		if !f.documents[docType] {
+			s.MissingDocuments = append(s.MissingDocuments, docType)
+		}
+	}
+	if len(p.RequiredDocuments) > 0 {
+		s.Documents = float64(len(p.RequiredDocuments)-len(s.MissingDocuments)) / float64(len(p.RequiredDocuments))
+	}
+	for _, stage := range p.Stages {
+		covered := false
+		for _, eventType := range stage.EventTypes {
+			covered = covered || f.eventTypes[eventType]
+		}
+		if !covered {
+			s.MissingStages = append(s.MissingStages, stage.Name)
+		}
+	}
+	if len(p.Stages) > 0 {
+		s.Events = float64(len(p.Stages)-len(s.MissingStages)) / float64(len(p.Stages))
+	}
+	if f.expectedIntervals > 0 {
+		s.Environment = math.Min(1, float64(f.readingIntervals)/float64(f.expectedIntervals))
+	}
+	sort.Strings(s.MissingDocuments)
+
+	s.Score = round(s.Documents*weightDocuments + s.Environment*weightEnvironment + s.Events*weightEvents)
+	s.Documents = round(s.Documents)
+	s.Environment = round(s.Environment)
+	s.Events = round(s.Events)
+	s.BelowThreshold = s.Score < float64(p.NudgeThreshold)
+	return s
+}
+
+// round rounds to two decimals
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// ScoreBatch scores one batch; it returns sql.ErrNoRows when the batch does not exist
+func ScoreBatch(batchID int) (*models.BatchCompleteness, error) {
+	scores, err := ScoreBatches([]int{batchID})
+	if err != nil {
+		return nil, err
+	}
+	s, ok := scores[batchID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return s, nil
+}
@@ -0,0 +1,219 @@
+package completeness
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/mailer"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// Nudge statuses
+const (
+	NudgeSent   = "sent"
+	NudgeFailed = "failed"
+)
+
+// nudgeBatchSize is the number of pending shipments checked per run
+const nudgeBatchSize = 500
+
+// Sender delivers an email
+type Sender func(to, subject, body string) error
+
+// Nudge is a reminder sent to a user responsible for an incomplete batch about to be exported
+type Nudge struct {
+	ID         int       `json:"id"`
+	BatchID    int       `json:"batch_id"`
+	ShipmentID *int      `json:"shipment_id,omitempty"`
+	AccountID  int       `json:"account_id"`
+	Score      float64   `json:"score"`
+	Threshold  int       `json:"threshold"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Service nudges the senders of pending shipments whose batches score below their owner's threshold
+type Service struct {
+	Interval    time.Duration
+	RepeatAfter time.Duration // A batch is not nudged to the same user again within this time
+	BaseURL     string
+	Send        Sender
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates a nudge service from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		Interval:    time.Duration(cfg.CompletenessIntervalSeconds) * time.Second,
+		RepeatAfter: time.Duration(cfg.CompletenessNudgeRepeatHours) * time.Hour,
+		BaseURL:     cfg.BaseURL,
+		Send: func(to, subject, body string) error {
+			return mailer.Default().SendText(to, mailer.TemplateCompletenessNudge, "", subject, body)
+		},
+	}
+}
+
+// Default returns the process wide nudge service
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Start sends due nudges in the background
+func (s *Service) Start() {
+	if s.Interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(s.Interval)
+
+			if sent, err := s.RunOnce(); err != nil {
+				fmt.Printf("Warning: completeness nudge run failed: %v\n", err)
+			} else if sent > 0 {
+				fmt.Printf("Completeness: nudged %d users about incomplete batches\n", sent)
+			}
+		}
+	}()
+}
+
+// pendingShipment is a batch waiting to be shipped and the user sending it
+type pendingShipment struct {
+	shipmentID int
+	batchID    int
+	accountID  int
+	email      string
+	name       string
+}
+
+// RunOnce nudges the senders of pending shipments of incomplete batches, returning the number of nudges sent
+func (s *Service) RunOnce() (int, error) {
+	if db.DB == nil {
+		return 0, nil
+	}
+	rows, err := db.DB.Query(`
+		SELECT st.id, st.batch_id, a.id, a.email, COALESCE(NULLIF(a.full_name, ''), a.username)
+		FROM shipment_transfer st
+		JOIN batch b ON b.id = st.batch_id AND b.is_active = true
+		JOIN account a ON a.id = st.sender_id AND a.is_active = true
+		WHERE st.status = 'pending' AND st.is_active = true AND COALESCE(a.email, '') <> ''
+			AND NOT EXISTS (
+				SELECT 1 FROM completeness_nudge n
+				WHERE n.batch_id = st.batch_id AND n.account_id = a.id AND n.status = $1 AND n.created_at > $2
+			)
+		ORDER BY st.id
+		LIMIT $3
+	`, NudgeSent, time.Now().Add(-s.RepeatAfter), nudgeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var pending []pendingShipment
+	var batchIDs []int
+	for rows.Next() {
+		var p pendingShipment
+		if err := rows.Scan(&p.shipmentID, &p.batchID, &p.accountID, &p.email, &p.name); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, p)
+		batchIDs = append(batchIDs, p.batchID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	scores, err := ScoreBatches(batchIDs)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	nudged := map[[2]int]bool{} // A batch shipped twice by the same user is nudged once
+	for _, p := range pending {
+		score := scores[p.batchID]
+		key := [2]int{p.batchID, p.accountID}
+		if score == nil || !score.BelowThreshold || nudged[key] {
+			continue
+		}
+		nudged[key] = true
+		if s.nudge(p, score) {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// nudge emails a user about an incomplete batch and records the nudge
+func (s *Service) nudge(p pendingShipment, score *models.BatchCompleteness) bool {
+	subject := fmt.Sprintf("Batch %d is %.0f%% complete and about to be shipped", p.batchID, score.Score)
+	status, errorText := NudgeSent, ""
+	if err := s.Send(p.email, subject, s.body(p, score)); err != nil {
+		status, errorText = NudgeFailed, err.Error()
+	}
+	missing, _ := json.Marshal(map[string]interface{}{
+		"documents": score.MissingDocuments,
+		"stages":    score.MissingStages,
+	})
+	if _, err := db.DB.Exec(`
+		INSERT INTO completeness_nudge (batch_id, shipment_id, account_id, score, threshold, missing, status, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
+	`, p.batchID, p.shipmentID, p.accountID, score.Score, score.Threshold, string(missing), status, errorText); err != nil {
+		fmt.Printf("Warning: failed to record completeness nudge for batch %d: %v\n", p.batchID, err)
+	}
+	return status == NudgeSent
+}
+
+// body renders the email of a nudge
+func (s *Service) body(p pendingShipment, score *models.BatchCompleteness) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hello %s,\n\n", p.name)
+	fmt.Fprintf(&b, "Batch %d has a pending shipment (%d) but its traceability data is %.0f%% complete, below the %d%% expected.\n\n",
+		p.batchID, p.shipmentID, score.Score, score.Threshold)
+	if len(score.MissingDocuments) > 0 {
+		fmt.Fprintf(&b, "Missing documents: %s\n", strings.Join(score.MissingDocuments, ", "))
+	}
+	if len(score.MissingStages) > 0 {
+		fmt.Fprintf(&b, "Stages without events: %s\n", strings.Join(score.MissingStages, ", "))
+	}
+	if score.ReadingIntervals < score.ExpectedIntervals {
+		fmt.Fprintf(&b, "Environment readings: %d of %d expected intervals covered\n", score.ReadingIntervals, score.ExpectedIntervals)
+	}
+	fmt.Fprintf(&b, "\nPlease complete the batch before it is exported: %s/api/v1/batches/%d/completeness\n",
+		strings.TrimRight(s.BaseURL, "/"), p.batchID)
+	return b.String()
+}
+
+// ListNudges loads the latest nudges sent about a batch
+func ListNudges(batchID int) ([]Nudge, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, batch_id, shipment_id, account_id, score, threshold, status, COALESCE(error, ''), created_at
+		FROM completeness_nudge WHERE batch_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT 50
+	`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	nudges := []Nudge{}
+	for rows.Next() {
+		var n Nudge
+		if err := rows.Scan(&n.ID, &n.BatchID, &n.ShipmentID, &n.AccountID, &n.Score, &n.Threshold, &n.Status, &n.Error, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		nudges = append(nudges, n)
+	}
+	return nudges, rows.Err()
+}
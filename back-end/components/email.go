@@ -2,21 +2,33 @@ package components
 
 import (
 	"fmt"
+	"mime"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
 	"os"
+	"strings"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/secrets"
 )
 
-func SendEmail(to, subject, body string) error {
+// emailSettings reads the SMTP server and account emails are sent from
+func emailSettings() (string, smtp.Auth, string, error) {
 	host := os.Getenv("EMAIL_HOST")
 	port := os.Getenv("EMAIL_PORT")
 	email := os.Getenv("EMAIL")
-	password := os.Getenv("EMAIL_PASSWORD")
+	password := secrets.Getenv("EMAIL_PASSWORD", "")
 	if host == "" || port == "" || email == "" || password == "" {
-		return fmt.Errorf("email configuration is missing")
+		return "", nil, "", fmt.Errorf("email configuration is missing")
 	}
+	return fmt.Sprintf("%s:%s", host, port), smtp.PlainAuth("", email, password, host), email, nil
+}
 
-	addr := fmt.Sprintf("%s:%s", host, port)
-	auth := smtp.PlainAuth("", email, password, host)
+func SendEmail(to, subject, body string) error {
+	addr, auth, email, err := emailSettings()
+	if err != nil {
+		return err
+	}
 
 	headers := make(map[string]string)
 	headers["From"] = email
@@ -33,3 +45,36 @@ func SendEmail(to, subject, body string) error {
 
 	return smtp.SendMail(addr, auth, email, []string{to}, []byte(msg))
 }
+
+// SendHTMLEmail sends an email with an HTML body and its plain text fallback
+func SendHTMLEmail(to, subject, html, text string) error {
+	addr, auth, email, err := emailSettings()
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=\"utf-8\"", text}, // Clients show the last part they can render
+		{"text/html; charset=\"utf-8\"", html},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write([]byte(part.content)); err != nil {
+			return err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/alternative; boundary=%q\r\n\r\n%s",
+		email, to, mime.QEncoding.Encode("utf-8", subject), parts.Boundary(), body.String())
+	return smtp.SendMail(addr, auth, email, []string{to}, []byte(msg))
+}
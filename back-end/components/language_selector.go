@@ -20,6 +20,9 @@ type Language struct {
 	Percentage  int    `json:"percentage"`
 }
 
+// LanguageCookieName is the cookie the language selector remembers the chosen language in
+const LanguageCookieName = "lang_preference"
+
 // LanguageSelectorConfig holds configuration for the language selector component
 
 type LanguageSelectorConfig struct {
@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/secrets"
 )
 
 // BaaSConfig represents the configuration for Blockchain-as-a-Service
@@ -617,7 +619,8 @@ func (c *BaaSConfig) GetAPIKey(networkID, service string) (string, error) {
 			if !ok {
 				return "", fmt.Errorf("API key for service %s not found for network %s", service, networkID)
 			}
-			return apiKey, nil
+			// Keys may be stored as references to the secret store
+			return secrets.Resolve(apiKey)
 		}
 	}
 	
@@ -5,6 +5,8 @@ import (
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/secrets"
 )
 
 // Config represents the application configuration
@@ -14,6 +16,11 @@ type Config struct {
 	ServerHost    string
 	BaseURL       string
 
+	// Request body policies: small JSON bodies for API mutations, large multipart bodies for uploads
+	JSONBodyLimitKB   int
+	UploadBodyLimitMB int
+	StrictContentType bool
+
 	DBHost               string
 	DBPort               string
 	DBUser               string
@@ -33,6 +40,17 @@ type Config struct {
 	BlockchainPrivateKey  string
 	BlockchainNetworkID   string
 
+	// Transaction signing backend: local, aws-kms, gcp-kms or pkcs11
+	BlockchainSigner             string
+	BlockchainKeystorePassphrase string
+	BlockchainKMSKeyID           string
+	BlockchainKMSRegion          string
+	BlockchainKMSProject         string
+	BlockchainPKCS11Module       string
+	BlockchainPKCS11Slot         int
+	BlockchainPKCS11Pin          string
+	BlockchainPKCS11KeyLabel     string
+
 	InteropEnabled        bool
 	InteropRelayEndpoint  string
 	InteropAllowedChains  []string
@@ -48,9 +66,10 @@ type Config struct {
 	IPFSNodeURL   string
 	IPFSGatewayURL string
 	IPFSAPIKey    string
-	JWTSecret     string
-	JWTExpiration int
-	JWTIssuer     string
+	JWTSecret      string
+	JWTExpiration  int
+	JWTIssuer      string
+	JWTAcceptHS256 bool
 	RateLimitRequests int
 	RateLimitDuration int
 
@@ -61,6 +80,147 @@ type Config struct {
 	EnableMetrics bool
 	MetricsPort   string
 
+	GPSStopRadiusMeters float64
+	GPSLongStopMinutes  int
+
+	IndexerIntervalSeconds   int
+	IndexerReorgGraceSeconds int
+	IndexerMaxResubmits      int
+
+	WebhookMaxAttempts          int
+	WebhookTimeoutSeconds       int
+	WebhookRetryIntervalSeconds int
+	WebhookRequireVerification  bool
+
+	CrossChainSyncIntervalSeconds int
+	CrossChainSyncMaxFailures     int
+
+	UsageFlushIntervalSeconds int
+
+	FeatureFlagCacheSeconds int
+
+	ActorCacheSize    int // Accounts and DIDs kept by the actor resolver
+	ActorCacheSeconds int
+
+	DataMigrationIntervalSeconds int
+	DataMigrationBatchSize       int
+
+	LoadShedMode            string
+	LoadShedMaxInFlight     int
+	LoadShedLatencyMs       int
+	LoadShedCooldownSeconds int
+	LoadShedCacheSeconds    int
+
+	BlockchainFallbackNodeURLs     []string
+	NodeProbeIntervalSeconds       int
+	NodeProbeTimeoutMs             int
+	NodeProbeMaxLatencyMs          int
+	NodeProbeMinPeers              int
+	NodeProbeFailuresBeforeSwitch  int
+	NodeProbeHistoryDays           int
+	OperatorCompanyID              int // Company whose notification connectors receive platform alerts, 0 for none
+
+	TraceSnapshotIntervalSeconds int
+	TraceSnapshotSettleHours     int
+	TraceSnapshotStatuses        []string
+	TraceSnapshotHTML            bool
+
+	DocumentAccessChainIntervalSeconds int
+	DocumentAccessChainSettleSeconds   int
+
+	DocumentRetentionIntervalSeconds int
+
+	SLAMonitorIntervalSeconds int
+	SLAMonitorLookbackDays    int
+
+	OAuthAccessTokenTTLSeconds int
+
+	TraceabilityAttestationIntervalSeconds int
+
+	EventImportMaxRows  int
+	EventImportSyncRows int
+
+	WarehouseExportEnabled         bool
+	WarehouseExportIntervalSeconds int
+	WarehouseExportMaxDaysPerRun   int
+	WarehouseS3Bucket              string
+	WarehouseS3Region              string
+	WarehouseS3Endpoint            string
+	WarehouseS3Prefix              string
+	WarehouseS3PathStyle           bool
+	WarehouseS3AccessKey           string
+	WarehouseS3SecretKey           string
+	WarehouseS3SessionToken        string
+
+	EventBusBackend              string
+	EventBusURL                  string
+	EventBusPrefix               string
+	EventBusMaxAttempts          int
+	EventBusRetryIntervalSeconds int
+
+	NotificationTimeoutSeconds   int
+	NotificationRateLimitPerHour int
+
+	DigestIntervalSeconds       int
+	DigestSendHour              int
+	DigestWeeklyDay             string
+	DigestCertificateWindowDays int
+
+	EmailDefaultLanguage string
+	MJMLAPIURL           string // MJML render API templates authored in MJML are compiled with when saved
+	MJMLAppID            string
+	MJMLSecretKey        string
+
+	SigningKeyRotationDays  int
+	SigningKeyRetentionDays int
+	SigningKeyEncryptionKey string
+
+	CurrencyRateProvider    string
+	CurrencyRateProviderURL string
+	CurrencyRateAPIKey      string
+	CurrencyStaticRates     string
+	CurrencyDefaultBase     string
+
+	TranslationAPIURL string
+	TranslationAPIKey string
+
+	ModerationBlockedTerms string
+	ModerationTermAction   string
+	ModerationRedactPII    bool
+	ModerationMaxLinks     int
+	ModerationAPIURL       string
+	ModerationAPIKey       string
+
+	BotGuardRoutes            string
+	BotGuardRequestsPerMinute int
+	BotGuardCaptchaProvider   string
+	BotGuardCaptchaSiteKey    string
+	BotGuardCaptchaSecret     string
+	BotGuardPoWDifficulty     int
+	BotGuardPassMinutes       int
+	BotGuardHoneypotField     string
+	BotGuardSecret            string
+
+	Region                           string
+	RegionEndpoints                  string
+	RegionReplicationToken           string
+	RegionReplicationIntervalSeconds int
+
+	StorageRegionIPFSNodes    string
+	StorageRegionIPFSGateways string
+	StorageRegionS3Buckets    string
+	StorageS3Endpoint         string
+	StorageS3PathStyle        bool
+
+	FaultInjectionEnabled bool
+
+	SupplierPortalURL string
+
+	CompletenessIntervalSeconds  int
+	CompletenessNudgeRepeatHours int
+
+	EmbedTokenSecret string
+
 	Environment string
 }
 
@@ -72,10 +232,14 @@ func Load() *Config {
 		ServerHost:    getEnv("SERVER_HOST", "0.0.0.0"),
 		BaseURL:       getEnv("BASE_URL", "http://localhost:8080"),
 
+		JSONBodyLimitKB:   getEnvAsInt("SERVER_JSON_BODY_LIMIT_KB", 1024),
+		UploadBodyLimitMB: getEnvAsInt("SERVER_BODY_LIMIT", 10),
+		StrictContentType: getEnvAsBool("SERVER_STRICT_CONTENT_TYPE", true),
+
 		DBHost:               getEnv("DB_HOST", "localhost"),
 		DBPort:               getEnv("DB_PORT", "5432"),
 		DBUser:               getEnv("DB_USER", "postgres"),
-		DBPassword:           getEnv("DB_PASSWORD", "postgres"),
+		DBPassword:           secrets.Getenv("DB_PASSWORD", "postgres"),
 		DBName:               getEnv("DB_NAME", "tracepost"),
 		DBSSLMode:            getEnv("DB_SSLMODE", "disable"),
 		DBMaxConnections:     getEnvAsInt("DB_MAX_CONNECTIONS", 20),
@@ -87,9 +251,19 @@ func Load() *Config {
 		BlockchainKeyFile:     getEnv("BLOCKCHAIN_KEY_FILE", ""),
 		BlockchainConsensus:   getEnv("BLOCKCHAIN_CONSENSUS", "poa"),
 		BlockchainContractAddr: getEnv("BLOCKCHAIN_CONTRACT_ADDRESS", ""),
-		BlockchainPrivateKey:   getEnv("BLOCKCHAIN_PRIVATE_KEY", ""),
+		BlockchainPrivateKey:   secrets.Getenv("BLOCKCHAIN_PRIVATE_KEY", ""),
 		BlockchainNetworkID:    getEnv("BLOCKCHAIN_NETWORK_ID", "tracepost-network"),
 
+		BlockchainSigner:             getEnv("BLOCKCHAIN_SIGNER", "local"),
+		BlockchainKeystorePassphrase: secrets.Getenv("BLOCKCHAIN_KEYSTORE_PASSPHRASE", ""),
+		BlockchainKMSKeyID:           getEnv("BLOCKCHAIN_KMS_KEY_ID", ""),
+		BlockchainKMSRegion:          getEnv("BLOCKCHAIN_KMS_REGION", ""),
+		BlockchainKMSProject:         getEnv("BLOCKCHAIN_KMS_PROJECT", ""),
+		BlockchainPKCS11Module:       getEnv("BLOCKCHAIN_PKCS11_MODULE", ""),
+		BlockchainPKCS11Slot:         getEnvAsInt("BLOCKCHAIN_PKCS11_SLOT", 0),
+		BlockchainPKCS11Pin:          secrets.Getenv("BLOCKCHAIN_PKCS11_PIN", ""),
+		BlockchainPKCS11KeyLabel:     getEnv("BLOCKCHAIN_PKCS11_KEY_LABEL", ""),
+
 		InteropEnabled:        getEnvAsBool("INTEROP_ENABLED", false),
 		InteropRelayEndpoint:  getEnv("INTEROP_RELAY_ENDPOINT", ""),
 		InteropAllowedChains:  getEnvAsStringSlice("INTEROP_ALLOWED_CHAINS", []string{}),
@@ -104,11 +278,12 @@ func Load() *Config {
 
 		IPFSNodeURL:    getEnv("IPFS_NODE_URL", "http://localhost:5001"),
 		IPFSGatewayURL: getEnv("IPFS_GATEWAY_URL", "http://localhost:8080"),
-		IPFSAPIKey:     getEnv("IPFS_API_KEY", ""),
+		IPFSAPIKey:     secrets.Getenv("IPFS_API_KEY", ""),
 
-		JWTSecret:     getEnv("JWT_SECRET", "your-secret-key"),
-		JWTExpiration: getEnvAsInt("JWT_EXPIRATION", 24),
-		JWTIssuer:     getEnv("JWT_ISSUER", "tracepost-larvae-api"),
+		JWTSecret:      secrets.Getenv("JWT_SECRET", "your-secret-key"),
+		JWTExpiration:  getEnvAsInt("JWT_EXPIRATION", 24),
+		JWTIssuer:      getEnv("JWT_ISSUER", "tracepost-larvae-api"),
+		JWTAcceptHS256: getEnvAsBool("JWT_ACCEPT_HS256", true),
 
 		LogLevel:  getEnv("LOG_LEVEL", "info"),
 		LogFormat: getEnv("LOG_FORMAT", "json"),
@@ -120,6 +295,147 @@ func Load() *Config {
 		EnableMetrics: getEnvAsBool("ENABLE_METRICS", true),
 		MetricsPort:   getEnv("METRICS_PORT", "9090"),
 
+		GPSStopRadiusMeters: float64(getEnvAsInt("GPS_STOP_RADIUS_METERS", 200)),
+		GPSLongStopMinutes:  getEnvAsInt("GPS_LONG_STOP_MINUTES", 45),
+
+		IndexerIntervalSeconds:   getEnvAsInt("INDEXER_INTERVAL_SECONDS", 30),
+		IndexerReorgGraceSeconds: getEnvAsInt("INDEXER_REORG_GRACE_SECONDS", 120),
+		IndexerMaxResubmits:      getEnvAsInt("INDEXER_MAX_RESUBMITS", 3),
+
+		WebhookMaxAttempts:          getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 6),
+		WebhookTimeoutSeconds:       getEnvAsInt("WEBHOOK_TIMEOUT_SECONDS", 10),
+		WebhookRetryIntervalSeconds: getEnvAsInt("WEBHOOK_RETRY_INTERVAL_SECONDS", 30),
+		WebhookRequireVerification:  getEnvAsBool("WEBHOOK_REQUIRE_VERIFICATION", true),
+
+		CrossChainSyncIntervalSeconds: getEnvAsInt("CROSS_CHAIN_SYNC_INTERVAL_SECONDS", 300),
+		CrossChainSyncMaxFailures:     getEnvAsInt("CROSS_CHAIN_SYNC_MAX_FAILURES", 10),
+
+		UsageFlushIntervalSeconds: getEnvAsInt("USAGE_FLUSH_INTERVAL_SECONDS", 60),
+
+		FeatureFlagCacheSeconds: getEnvAsInt("FEATURE_FLAG_CACHE_SECONDS", 30),
+
+		ActorCacheSize:    getEnvAsInt("ACTOR_CACHE_SIZE", 5000),
+		ActorCacheSeconds: getEnvAsInt("ACTOR_CACHE_SECONDS", 300),
+
+		DataMigrationIntervalSeconds: getEnvAsInt("DATA_MIGRATION_INTERVAL_SECONDS", 10),
+		DataMigrationBatchSize:       getEnvAsInt("DATA_MIGRATION_BATCH_SIZE", 500),
+
+		LoadShedMode:            getEnv("LOAD_SHED_MODE", "auto"),
+		LoadShedMaxInFlight:     getEnvAsInt("LOAD_SHED_MAX_IN_FLIGHT", 200),
+		LoadShedLatencyMs:       getEnvAsInt("LOAD_SHED_LATENCY_MS", 1500),
+		LoadShedCooldownSeconds: getEnvAsInt("LOAD_SHED_COOLDOWN_SECONDS", 60),
+		LoadShedCacheSeconds:    getEnvAsInt("LOAD_SHED_CACHE_SECONDS", 300),
+
+		BlockchainFallbackNodeURLs:    getEnvAsStringSlice("BLOCKCHAIN_FALLBACK_NODE_URLS", []string{}),
+		NodeProbeIntervalSeconds:      getEnvAsInt("NODE_PROBE_INTERVAL_SECONDS", 30),
+		NodeProbeTimeoutMs:            getEnvAsInt("NODE_PROBE_TIMEOUT_MS", 5000),
+		NodeProbeMaxLatencyMs:         getEnvAsInt("NODE_PROBE_MAX_LATENCY_MS", 2000),
+		NodeProbeMinPeers:             getEnvAsInt("NODE_PROBE_MIN_PEERS", 1),
+		NodeProbeFailuresBeforeSwitch: getEnvAsInt("NODE_PROBE_FAILURES_BEFORE_SWITCH", 2),
+		NodeProbeHistoryDays:          getEnvAsInt("NODE_PROBE_HISTORY_DAYS", 7),
+		OperatorCompanyID:             getEnvAsInt("OPERATOR_COMPANY_ID", 0),
+
+		TraceSnapshotIntervalSeconds: getEnvAsInt("TRACE_SNAPSHOT_INTERVAL_SECONDS", 300),
+		TraceSnapshotSettleHours:     getEnvAsInt("TRACE_SNAPSHOT_SETTLE_HOURS", 24),
+		TraceSnapshotStatuses:        getEnvAsStringSlice("TRACE_SNAPSHOT_STATUSES", []string{"completed", "harvested", "sold", "delivered"}),
+		TraceSnapshotHTML:            getEnvAsBool("TRACE_SNAPSHOT_HTML", false),
+
+		DocumentAccessChainIntervalSeconds: getEnvAsInt("DOCUMENT_ACCESS_CHAIN_INTERVAL_SECONDS", 3600),
+		DocumentAccessChainSettleSeconds:   getEnvAsInt("DOCUMENT_ACCESS_CHAIN_SETTLE_SECONDS", 60),
+
+		DocumentRetentionIntervalSeconds: getEnvAsInt("DOCUMENT_RETENTION_INTERVAL_SECONDS", 3600),
+
+		SLAMonitorIntervalSeconds: getEnvAsInt("SLA_MONITOR_INTERVAL_SECONDS", 900),
+		SLAMonitorLookbackDays:    getEnvAsInt("SLA_MONITOR_LOOKBACK_DAYS", 30),
+
+		OAuthAccessTokenTTLSeconds: getEnvAsInt("OAUTH_ACCESS_TOKEN_TTL_SECONDS", 900),
+
+		TraceabilityAttestationIntervalSeconds: getEnvAsInt("TRACEABILITY_ATTESTATION_INTERVAL_SECONDS", 600),
+
+		EventImportMaxRows:  getEnvAsInt("EVENT_IMPORT_MAX_ROWS", 10000),
+		EventImportSyncRows: getEnvAsInt("EVENT_IMPORT_SYNC_ROWS", 500),
+
+		WarehouseExportEnabled:         getEnvAsBool("WAREHOUSE_EXPORT_ENABLED", false),
+		WarehouseExportIntervalSeconds: getEnvAsInt("WAREHOUSE_EXPORT_INTERVAL_SECONDS", 3600),
+		WarehouseExportMaxDaysPerRun:   getEnvAsInt("WAREHOUSE_EXPORT_MAX_DAYS_PER_RUN", 7),
+		WarehouseS3Bucket:              getEnv("WAREHOUSE_S3_BUCKET", ""),
+		WarehouseS3Region:              getEnv("WAREHOUSE_S3_REGION", "us-east-1"),
+		WarehouseS3Endpoint:            getEnv("WAREHOUSE_S3_ENDPOINT", ""),
+		WarehouseS3Prefix:              getEnv("WAREHOUSE_S3_PREFIX", "warehouse"),
+		WarehouseS3PathStyle:           getEnvAsBool("WAREHOUSE_S3_PATH_STYLE", false),
+		WarehouseS3AccessKey:           getEnv("AWS_ACCESS_KEY_ID", ""),
+		WarehouseS3SecretKey:           secrets.Getenv("AWS_SECRET_ACCESS_KEY", ""),
+		WarehouseS3SessionToken:        secrets.Getenv("AWS_SESSION_TOKEN", ""),
+
+		EventBusBackend:              getEnv("EVENT_BUS_BACKEND", ""),
+		EventBusURL:                  secrets.Getenv("EVENT_BUS_URL", ""),
+		EventBusPrefix:               getEnv("EVENT_BUS_PREFIX", "tracepost"),
+		EventBusMaxAttempts:          getEnvAsInt("EVENT_BUS_MAX_ATTEMPTS", 20),
+		EventBusRetryIntervalSeconds: getEnvAsInt("EVENT_BUS_RETRY_INTERVAL_SECONDS", 15),
+
+		NotificationTimeoutSeconds:   getEnvAsInt("NOTIFICATION_TIMEOUT_SECONDS", 10),
+		NotificationRateLimitPerHour: getEnvAsInt("NOTIFICATION_RATE_LIMIT_PER_HOUR", 30),
+
+		DigestIntervalSeconds:       getEnvAsInt("DIGEST_INTERVAL_SECONDS", 900),
+		DigestSendHour:              getEnvAsInt("DIGEST_SEND_HOUR", 7),
+		DigestWeeklyDay:             getEnv("DIGEST_WEEKLY_DAY", "monday"),
+		DigestCertificateWindowDays: getEnvAsInt("DIGEST_CERTIFICATE_WINDOW_DAYS", 30),
+
+		EmailDefaultLanguage: getEnv("EMAIL_DEFAULT_LANGUAGE", "en"),
+		MJMLAPIURL:           getEnv("MJML_API_URL", "https://api.mjml.io/v1/render"),
+		MJMLAppID:            getEnv("MJML_APP_ID", ""),
+		MJMLSecretKey:        secrets.Getenv("MJML_SECRET_KEY", ""),
+
+		SigningKeyRotationDays:  getEnvAsInt("SIGNING_KEY_ROTATION_DAYS", 90),
+		SigningKeyRetentionDays: getEnvAsInt("SIGNING_KEY_RETENTION_DAYS", 14),
+		SigningKeyEncryptionKey: secrets.Getenv("SIGNING_KEY_ENCRYPTION_KEY", ""),
+
+		CurrencyRateProvider:    getEnv("CURRENCY_RATE_PROVIDER", "manual"),
+		CurrencyRateProviderURL: getEnv("CURRENCY_RATE_PROVIDER_URL", ""),
+		CurrencyRateAPIKey:      secrets.Getenv("CURRENCY_RATE_API_KEY", ""),
+		CurrencyStaticRates:     getEnv("CURRENCY_STATIC_RATES", ""),
+		CurrencyDefaultBase:     getEnv("CURRENCY_DEFAULT_BASE", "VND"),
+
+		TranslationAPIURL: getEnv("TRANSLATION_API_URL", ""),
+		TranslationAPIKey: secrets.Getenv("TRANSLATION_API_KEY", ""),
+
+		ModerationBlockedTerms: getEnv("MODERATION_BLOCKED_TERMS", ""),
+		ModerationTermAction:   getEnv("MODERATION_TERM_ACTION", "mask"),
+		ModerationRedactPII:    getEnvAsBool("MODERATION_REDACT_PII", true),
+		ModerationMaxLinks:     getEnvAsInt("MODERATION_MAX_LINKS", 0),
+		ModerationAPIURL:       getEnv("MODERATION_API_URL", ""),
+		ModerationAPIKey:       secrets.Getenv("MODERATION_API_KEY", ""),
+
+		BotGuardRoutes:            getEnv("BOT_GUARD_ROUTES", ""),
+		BotGuardRequestsPerMinute: getEnvAsInt("BOT_GUARD_REQUESTS_PER_MINUTE", 30),
+		BotGuardCaptchaProvider:   getEnv("BOT_GUARD_CAPTCHA_PROVIDER", ""),
+		BotGuardCaptchaSiteKey:    getEnv("BOT_GUARD_CAPTCHA_SITE_KEY", ""),
+		BotGuardCaptchaSecret:     secrets.Getenv("BOT_GUARD_CAPTCHA_SECRET", ""),
+		BotGuardPoWDifficulty:     getEnvAsInt("BOT_GUARD_POW_DIFFICULTY", 18),
+		BotGuardPassMinutes:       getEnvAsInt("BOT_GUARD_PASS_MINUTES", 30),
+		BotGuardHoneypotField:     getEnv("BOT_GUARD_HONEYPOT_FIELD", "website"),
+		BotGuardSecret:            secrets.Getenv("BOT_GUARD_SECRET", ""),
+
+		Region:                           getEnv("REGION", "vn1"),
+		RegionEndpoints:                  getEnv("REGION_ENDPOINTS", ""),
+		RegionReplicationToken:           secrets.Getenv("REGION_REPLICATION_TOKEN", ""),
+		RegionReplicationIntervalSeconds: getEnvAsInt("REGION_REPLICATION_INTERVAL_SECONDS", 60),
+
+		StorageRegionIPFSNodes:    getEnv("STORAGE_REGION_IPFS_NODES", ""),
+		StorageRegionIPFSGateways: getEnv("STORAGE_REGION_IPFS_GATEWAYS", ""),
+		StorageRegionS3Buckets:    getEnv("STORAGE_REGION_S3_BUCKETS", ""),
+		StorageS3Endpoint:         getEnv("STORAGE_S3_ENDPOINT", ""),
+		StorageS3PathStyle:        getEnvAsBool("STORAGE_S3_PATH_STYLE", false),
+
+		FaultInjectionEnabled: getEnvAsBool("FAULT_INJECTION_ENABLED", false),
+
+		SupplierPortalURL: getEnv("SUPPLIER_PORTAL_URL", ""),
+
+		CompletenessIntervalSeconds:  getEnvAsInt("COMPLETENESS_INTERVAL_SECONDS", 3600),
+		CompletenessNudgeRepeatHours: getEnvAsInt("COMPLETENESS_NUDGE_REPEAT_HOURS", 24),
+
+		EmbedTokenSecret: secrets.Getenv("EMBED_TOKEN_SECRET", ""),
+
 		Environment: getEnv("ENVIRONMENT", "development"),
 	}
 }
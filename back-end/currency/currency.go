@@ -0,0 +1,175 @@
+package currency
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Exchange-rate providers
+const (
+	ProviderManual            = "manual"            // rates are only recorded through the API
+	ProviderStatic            = "static"            // fixed rates from the config
+	ProviderFrankfurter       = "frankfurter"       // European Central Bank reference rates
+	ProviderOpenExchangeRates = "openexchangerates" // Open Exchange Rates, needs an app ID
+)
+
+// ErrRateUnavailable is returned when no rate is stored and the provider cannot supply one
+var ErrRateUnavailable = errors.New("exchange rate unavailable")
+
+// Provider supplies the exchange rates of a day
+type Provider interface {
+	Name() string
+	// Rates returns the amount of each currency worth one unit of the base currency on a day
+	Rates(base string, day time.Time) (map[string]float64, error)
+}
+
+// Rate is the amount of the quote currency worth one unit of the base currency on a day
+type Rate struct {
+	Base   string    `json:"base"`
+	Quote  string    `json:"quote"`
+	Date   time.Time `json:"date"`
+	Rate   float64   `json:"rate"`
+	Source string    `json:"source"`
+}
+
+// Service converts amounts at the rate of a given day.
+// Rates are stored per day the first time they are needed, so a report converts a transaction
+// at the same rate every time it is run, whatever the provider says later
+type Service struct {
+	Provider     Provider
+	BaseCurrency string // default base currency of companies that did not choose one
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates a service from the application config
+func NewService(cfg *config.Config) *Service {
+	s := &Service{BaseCurrency: Normalize(cfg.CurrencyDefaultBase)}
+	switch cfg.CurrencyRateProvider {
+	case ProviderStatic:
+		s.Provider = NewStaticProvider(cfg.CurrencyStaticRates)
+	case ProviderFrankfurter:
+		s.Provider = NewFrankfurterProvider(cfg.CurrencyRateProviderURL)
+	case ProviderOpenExchangeRates:
+		s.Provider = NewOpenExchangeRatesProvider(cfg.CurrencyRateProviderURL, cfg.CurrencyRateAPIKey)
+	}
+	return s
+}
+
+// Default returns the process wide service
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Normalize upper-cases a currency code
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Valid reports whether a code looks like an ISO 4217 currency code
+func Valid(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Day truncates a time to its UTC day, the granularity rates are stored at
+func Day(t time.Time) time.Time {
+	return time.Date(t.UTC().Year(), t.UTC().Month(), t.UTC().Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ProviderName returns the name of the configured provider
+func (s *Service) ProviderName() string {
+	if s.Provider == nil {
+		return ProviderManual
+	}
+	return s.Provider.Name()
+}
+
+// Rate returns the rate between two currencies on a day, from storage or else from the provider
+func (s *Service) Rate(base, quote string, date time.Time) (Rate, error) {
+	base, quote, day := Normalize(base), Normalize(quote), Day(date)
+	if base == quote {
+		return Rate{Base: base, Quote: quote, Date: day, Rate: 1, Source: "identity"}, nil
+	}
+
+	rate, err := storedRate(base, quote, day)
+	if err == nil {
+		return rate, nil
+	}
+	if err != sql.ErrNoRows {
+		return rate, err
+	}
+	if s.Provider == nil {
+		return rate, fmt.Errorf("%w: no %s/%s rate recorded for %s", ErrRateUnavailable, base, quote, day.Format("2006-01-02"))
+	}
+
+	rates, err := s.Provider.Rates(base, day)
+	if err != nil {
+		return rate, fmt.Errorf("%w: %s: %v", ErrRateUnavailable, s.Provider.Name(), err)
+	}
+	for q, r := range rates {
+		if q == base || r <= 0 {
+			continue
+		}
+		if err := s.Record(Rate{Base: base, Quote: q, Date: day, Rate: r, Source: s.Provider.Name()}); err != nil {
+			fmt.Printf("Warning: Failed to store %s/%s exchange rate: %v\n", base, q, err)
+		}
+	}
+	r, ok := rates[quote]
+	if !ok || r <= 0 {
+		return rate, fmt.Errorf("%w: %s does not quote %s/%s", ErrRateUnavailable, s.Provider.Name(), base, quote)
+	}
+	return Rate{Base: base, Quote: quote, Date: day, Rate: r, Source: s.Provider.Name()}, nil
+}
+
+// Convert converts an amount between two currencies at the rate of a day
+func (s *Service) Convert(amount float64, from, to string, date time.Time) (float64, Rate, error) {
+	rate, err := s.Rate(from, to, date)
+	if err != nil {
+		return 0, rate, err
+	}
+	return amount * rate.Rate, rate, nil
+}
+
+// Record stores a rate, replacing the rate of the same pair and day
+func (s *Service) Record(rate Rate) error {
+	_, err := db.DB.Exec(`
+		INSERT INTO exchange_rate (base_currency, quote_currency, rate_date, rate, source, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (base_currency, quote_currency, rate_date) DO UPDATE SET rate = EXCLUDED.rate, source = EXCLUDED.source, created_at = NOW()
+	`, Normalize(rate.Base), Normalize(rate.Quote), Day(rate.Date), rate.Rate, rate.Source)
+	return err
+}
+
+// storedRate looks a rate up in storage, inverting the rate of the reverse pair if needed
+func storedRate(base, quote string, day time.Time) (Rate, error) {
+	rate := Rate{Base: base, Quote: quote, Date: day}
+	err := db.DB.QueryRow(`
+		SELECT rate, source FROM (
+			SELECT rate, source, 0 AS preference FROM exchange_rate WHERE base_currency = $1 AND quote_currency = $2 AND rate_date = $3
+			UNION ALL
+			SELECT 1 / rate, source, 1 FROM exchange_rate WHERE base_currency = $2 AND quote_currency = $1 AND rate_date = $3 AND rate > 0
+		) r ORDER BY preference LIMIT 1
+	`, base, quote, day).Scan(&rate.Rate, &rate.Source)
+	return rate, err
+}
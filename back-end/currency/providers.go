@@ -0,0 +1,140 @@
+package currency
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// crossRates derives the rates of a base currency from rates quoted against another reference currency
+func crossRates(reference map[string]float64, base string) (map[string]float64, error) {
+	baseRate, ok := reference[base]
+	if !ok || baseRate <= 0 {
+		return nil, fmt.Errorf("no rate for %s", base)
+	}
+	rates := make(map[string]float64, len(reference))
+	for code, r := range reference {
+		rates[code] = r / baseRate
+	}
+	return rates, nil
+}
+
+// StaticProvider serves fixed rates, e.g. for development or a currency the other providers do not quote
+type StaticProvider struct {
+	Reference map[string]float64 // amount of each currency worth one unit of a common reference currency
+}
+
+// NewStaticProvider parses rates written as CODE=rate pairs separated by commas, e.g. USD=1,VND=25400,EUR=0.92
+func NewStaticProvider(spec string) *StaticProvider {
+	p := &StaticProvider{Reference: map[string]float64{}}
+	for _, pair := range strings.Split(spec, ",") {
+		code, value, found := strings.Cut(pair, "=")
+		if !found {
+			continue
+		}
+		r, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || r <= 0 {
+			continue
+		}
+		p.Reference[Normalize(code)] = r
+	}
+	return p
+}
+
+// Name returns the provider name
+func (p *StaticProvider) Name() string {
+	return ProviderStatic
+}
+
+// Rates returns the fixed rates whatever the day
+func (p *StaticProvider) Rates(base string, day time.Time) (map[string]float64, error) {
+	return crossRates(p.Reference, base)
+}
+
+// FrankfurterProvider reads the reference rates of the European Central Bank from a Frankfurter API
+type FrankfurterProvider struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// NewFrankfurterProvider creates a provider for a Frankfurter API, by default the public one
+func NewFrankfurterProvider(apiURL string) *FrankfurterProvider {
+	if apiURL == "" {
+		apiURL = "https://api.frankfurter.app"
+	}
+	return &FrankfurterProvider{URL: strings.TrimSuffix(apiURL, "/"), HTTPClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Name returns the provider name
+func (p *FrankfurterProvider) Name() string {
+	return ProviderFrankfurter
+}
+
+// Rates returns the rates published for a day, or for the last working day before it
+func (p *FrankfurterProvider) Rates(base string, day time.Time) (map[string]float64, error) {
+	var body struct {
+		Base  string             `json:"base"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := getJSON(p.HTTPClient, p.URL+"/"+day.Format("2006-01-02")+"?from="+url.QueryEscape(base), &body); err != nil {
+		return nil, err
+	}
+	return body.Rates, nil
+}
+
+// OpenExchangeRatesProvider reads historical rates from Open Exchange Rates.
+// Rates are requested against USD, which every plan supports, and crossed to the base currency
+type OpenExchangeRatesProvider struct {
+	URL        string
+	AppID      string
+	HTTPClient *http.Client
+}
+
+// NewOpenExchangeRatesProvider creates a provider for Open Exchange Rates
+func NewOpenExchangeRatesProvider(apiURL, appID string) *OpenExchangeRatesProvider {
+	if apiURL == "" {
+		apiURL = "https://openexchangerates.org/api"
+	}
+	return &OpenExchangeRatesProvider{URL: strings.TrimSuffix(apiURL, "/"), AppID: appID, HTTPClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Name returns the provider name
+func (p *OpenExchangeRatesProvider) Name() string {
+	return ProviderOpenExchangeRates
+}
+
+// Rates returns the end of day rates of a day
+func (p *OpenExchangeRatesProvider) Rates(base string, day time.Time) (map[string]float64, error) {
+	if p.AppID == "" {
+		return nil, fmt.Errorf("app ID is not configured")
+	}
+	var body struct {
+		Base  string             `json:"base"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := getJSON(p.HTTPClient, p.URL+"/historical/"+day.Format("2006-01-02")+".json?app_id="+url.QueryEscape(p.AppID), &body); err != nil {
+		return nil, err
+	}
+	if body.Rates == nil {
+		return nil, fmt.Errorf("rate provider returned no rates")
+	}
+	body.Rates[body.Base] = 1
+	return crossRates(body.Rates, base)
+}
+
+// getJSON fetches and decodes a JSON document
+func getJSON(client *http.Client, endpoint string, out interface{}) error {
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rate provider returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,99 @@
+package datamigration
+
+import (
+	"fmt"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// BatchQuantityLedger moves batch quantities from the batch.quantity column to a ledger of
+// quantity changes, so later changes (mortality, splits, sales) can be recorded as entries
+const BatchQuantityLedger = "batch_quantity_ledger"
+
+func init() {
+	Register(Migration{
+		Name:        BatchQuantityLedger,
+		Description: "Move batch quantities to the batch_quantity_ledger table",
+		SourceTable: "batch",
+		Apply:       applyBatchQuantityLedger,
+		Verify:      verifyBatchQuantityLedger,
+	})
+}
+
+// applyBatchQuantityLedger brings the ledger balance of a batch to its quantity column:
+// a batch without entries gets an opening entry, a batch whose balance drifted a reconciliation entry
+func applyBatchQuantityLedger(q Querier, batchID int) error {
+	var quantity, balance, entries int
+	err := q.QueryRow(`
+		SELECT COALESCE(b.quantity, 0),
+			COALESCE((SELECT SUM(quantity_delta) FROM batch_quantity_ledger WHERE batch_id = b.id), 0),
+			(SELECT COUNT(*) FROM batch_quantity_ledger WHERE batch_id = b.id)
+		FROM batch b
+		WHERE b.id = $1
+	`, batchID).Scan(&quantity, &balance, &entries)
+	if err != nil {
+		return fmt.Errorf("failed to read batch quantity: %w", err)
+	}
+
+	entryType := "opening"
+	if entries > 0 {
+		if quantity == balance {
+			return nil
+		}
+		entryType = "reconciliation"
+	}
+	_, err = q.Exec(`
+		INSERT INTO batch_quantity_ledger (batch_id, entry_type, quantity_delta, source, recorded_at)
+		VALUES ($1, $2, $3, 'migration', NOW())
+	`, batchID, entryType, quantity-balance)
+	if err != nil {
+		return fmt.Errorf("failed to write ledger entry: %w", err)
+	}
+	return nil
+}
+
+// verifyBatchQuantityLedger compares the quantity column of every batch with its ledger balance
+func verifyBatchQuantityLedger() (Verification, error) {
+	var v Verification
+	err := db.DB.QueryRow(`
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE l.balance IS NULL OR l.balance <> COALESCE(b.quantity, 0))
+		FROM batch b
+		LEFT JOIN (
+			SELECT batch_id, SUM(quantity_delta) AS balance FROM batch_quantity_ledger GROUP BY batch_id
+		) l ON l.batch_id = b.id
+	`).Scan(&v.CheckedRows, &v.MismatchCount)
+	if err != nil {
+		return v, err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT b.id, COALESCE(b.quantity, 0), l.balance
+		FROM batch b
+		LEFT JOIN (
+			SELECT batch_id, SUM(quantity_delta) AS balance FROM batch_quantity_ledger GROUP BY batch_id
+		) l ON l.batch_id = b.id
+		WHERE l.balance IS NULL OR l.balance <> COALESCE(b.quantity, 0)
+		ORDER BY b.id
+		LIMIT 20
+	`)
+	if err != nil {
+		return v, err
+	}
+	defer rows.Close()
+
+	v.Samples = []Mismatch{}
+	for rows.Next() {
+		var id, quantity int
+		var balance *int
+		if err := rows.Scan(&id, &quantity, &balance); err != nil {
+			return v, err
+		}
+		detail := fmt.Sprintf("quantity %d has no ledger entries", quantity)
+		if balance != nil {
+			detail = fmt.Sprintf("quantity %d, ledger balance %d", quantity, *balance)
+		}
+		v.Samples = append(v.Samples, Mismatch{ID: id, Detail: detail})
+	}
+	return v, nil
+}
@@ -0,0 +1,544 @@
+package datamigration
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Statuses of a data migration, in rollout order
+const (
+	StatusPending     = "pending"     // registered, nothing is written to the new schema
+	StatusBackfilling = "backfilling" // new writes go to both schemas and historical rows are copied
+	StatusPaused      = "paused"      // the backfill is stopped, new writes still go to both schemas
+	StatusBackfilled  = "backfilled"  // every historical row was copied, verification can run
+	StatusVerified    = "verified"    // the last verification found the schemas in parity
+	StatusCutOver     = "cut_over"    // readers use the new schema
+	StatusFailed      = "failed"      // the backfill stopped on an error, resume retries it
+)
+
+// Schemas readers can be pointed at
+const (
+	ReadFromOld = "old"
+	ReadFromNew = "new"
+)
+
+var (
+	// ErrUnknownMigration is returned for a migration that is not registered
+	ErrUnknownMigration = errors.New("data migration is not registered")
+	// ErrInvalidTransition is returned when a migration cannot move to the requested status
+	ErrInvalidTransition = errors.New("data migration cannot move to this status")
+	// ErrNotInParity is returned when cutover finds rows that differ between the schemas
+	ErrNotInParity = errors.New("schemas are not in parity")
+)
+
+// Querier is what migrations write through: the database itself or the transaction of a handler
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Mismatch is a source row whose copy in the new schema differs
+type Mismatch struct {
+	ID     int    `json:"id"`
+	Detail string `json:"detail"`
+}
+
+// Verification is the outcome of comparing the old and new schema
+type Verification struct {
+	CheckedRows   int        `json:"checked_rows"`
+	MismatchCount int        `json:"mismatch_count"`
+	Samples       []Mismatch `json:"samples"` // Up to 20 mismatching rows
+	Passed        bool       `json:"passed"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Migration moves the rows of a source table to a new schema
+// Apply is used both for dual writes and for the backfill, so it must be idempotent:
+// applying a row twice, or after the row changed, leaves the new schema matching the source row
+type Migration struct {
+	Name        string
+	Description string
+	SourceTable string // Rows are backfilled in id order
+	Apply       func(q Querier, id int) error
+	Verify      func() (Verification, error)
+}
+
+// State is the rollout state of a registered migration
+type State struct {
+	Name            string        `json:"name"`
+	Description     string        `json:"description"`
+	SourceTable     string        `json:"source_table"`
+	Status          string        `json:"status"`
+	DualWrite       bool          `json:"dual_write"`
+	ReadFrom        string        `json:"read_from"`
+	LastID          int           `json:"last_id"`
+	TotalRows       int           `json:"total_rows"`
+	ProcessedRows   int           `json:"processed_rows"`
+	Progress        float64       `json:"progress"` // Percentage of the backfill done
+	DualWriteErrors int           `json:"dual_write_errors"`
+	LastError       string        `json:"last_error,omitempty"`
+	StartedAt       *time.Time    `json:"started_at,omitempty"`
+	BackfilledAt    *time.Time    `json:"backfilled_at,omitempty"`
+	CutOverAt       *time.Time    `json:"cutover_at,omitempty"`
+	LastVerified    *Verification `json:"last_verification,omitempty"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Migration{}
+)
+
+// Register adds a migration to the registry; it is called from init functions
+func Register(m Migration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[m.Name] = m
+}
+
+// lookup finds a registered migration
+func lookup(name string) (Migration, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	m, ok := registry[name]
+	if !ok {
+		return m, ErrUnknownMigration
+	}
+	return m, nil
+}
+
+// Names lists the registered migrations
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ensureRow creates the state row of a registered migration
+func ensureRow(name string) error {
+	_, err := db.DB.Exec(`
+		INSERT INTO data_migration (name, status, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW())
+		ON CONFLICT (name) DO NOTHING
+	`, name, StatusPending)
+	return err
+}
+
+// GetState loads the rollout state of a migration
+func GetState(name string) (State, error) {
+	m, err := lookup(name)
+	if err != nil {
+		return State{}, err
+	}
+	if err := ensureRow(name); err != nil {
+		return State{}, err
+	}
+
+	s := State{Name: m.Name, Description: m.Description, SourceTable: m.SourceTable}
+	var lastError sql.NullString
+	var startedAt, backfilledAt, cutOverAt sql.NullTime
+	err = db.DB.QueryRow(`
+		SELECT status, COALESCE(dual_write, false), COALESCE(read_from, 'old'), COALESCE(last_id, 0),
+			COALESCE(total_rows, 0), COALESCE(processed_rows, 0), COALESCE(dual_write_errors, 0), last_error,
+			started_at, backfilled_at, cutover_at
+		FROM data_migration
+		WHERE name = $1
+	`, name).Scan(&s.Status, &s.DualWrite, &s.ReadFrom, &s.LastID, &s.TotalRows, &s.ProcessedRows,
+		&s.DualWriteErrors, &lastError, &startedAt, &backfilledAt, &cutOverAt)
+	if err != nil {
+		return s, err
+	}
+	s.LastError = lastError.String
+	s.StartedAt = nullTimePtr(startedAt)
+	s.BackfilledAt = nullTimePtr(backfilledAt)
+	s.CutOverAt = nullTimePtr(cutOverAt)
+	switch {
+	case s.TotalRows > 0:
+		s.Progress = float64(int(float64(s.ProcessedRows)/float64(s.TotalRows)*1000)) / 10
+		if s.Progress > 100 {
+			s.Progress = 100
+		}
+	case s.BackfilledAt != nil:
+		s.Progress = 100
+	}
+
+	verifications, err := ListVerifications(name, 1)
+	if err != nil {
+		return s, err
+	}
+	if len(verifications) > 0 {
+		s.LastVerified = &verifications[0]
+	}
+	return s, nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// Start turns on dual writes and starts the backfill of a pending migration
+// Starting a backfilled or verified migration again copies every row anew, e.g. after dual write errors
+func Start(name string) (State, error) {
+	m, err := lookup(name)
+	if err != nil {
+		return State{}, err
+	}
+	if err := ensureRow(name); err != nil {
+		return State{}, err
+	}
+
+	var total int
+	if err := db.DB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", m.SourceTable)).Scan(&total); err != nil {
+		return State{}, err
+	}
+	result, err := db.DB.Exec(`
+		UPDATE data_migration
+		SET status = $2, dual_write = true, read_from = $3, last_id = 0, total_rows = $4, processed_rows = 0,
+			dual_write_errors = 0, last_error = NULL, started_at = NOW(), backfilled_at = NULL, cutover_at = NULL, updated_at = NOW()
+		WHERE name = $1 AND status = ANY($5)
+	`, name, StatusBackfilling, ReadFromOld, total, pq.Array([]string{StatusPending, StatusBackfilled, StatusVerified, StatusFailed}))
+	if err != nil {
+		return State{}, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return State{}, ErrInvalidTransition
+	}
+	return GetState(name)
+}
+
+// transition moves a migration between statuses
+func transition(name string, from []string, to string) (State, error) {
+	if _, err := lookup(name); err != nil {
+		return State{}, err
+	}
+	result, err := db.DB.Exec(`
+		UPDATE data_migration SET status = $2, last_error = NULL, updated_at = NOW()
+		WHERE name = $1 AND status = ANY($3)
+	`, name, to, pq.Array(from))
+	if err != nil {
+		return State{}, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return State{}, ErrInvalidTransition
+	}
+	return GetState(name)
+}
+
+// Pause stops the backfill of a migration; dual writes continue
+func Pause(name string) (State, error) {
+	return transition(name, []string{StatusBackfilling}, StatusPaused)
+}
+
+// Resume continues a paused or failed backfill from the last copied row
+func Resume(name string) (State, error) {
+	return transition(name, []string{StatusPaused, StatusFailed}, StatusBackfilling)
+}
+
+// RunVerification compares the schemas and records the outcome
+// A backfilled migration that passes becomes verified; one that fails stays backfilled
+func RunVerification(name string, verifiedBy int) (Verification, error) {
+	m, err := lookup(name)
+	if err != nil {
+		return Verification{}, err
+	}
+	state, err := GetState(name)
+	if err != nil {
+		return Verification{}, err
+	}
+	if state.Status != StatusBackfilled && state.Status != StatusVerified && state.Status != StatusCutOver {
+		return Verification{}, ErrInvalidTransition
+	}
+
+	v, err := m.Verify()
+	if err != nil {
+		return v, err
+	}
+	if v.Samples == nil {
+		v.Samples = []Mismatch{}
+	}
+	v.Passed = v.MismatchCount == 0
+	samples, _ := json.Marshal(v.Samples)
+	err = db.DB.QueryRow(`
+		INSERT INTO data_migration_verification (migration_id, checked_rows, mismatch_count, samples, passed, verified_by, created_at)
+		SELECT id, $2, $3, $4, $5, NULLIF($6, 0), NOW() FROM data_migration WHERE name = $1
+		RETURNING created_at
+	`, name, v.CheckedRows, v.MismatchCount, string(samples), v.Passed, verifiedBy).Scan(&v.CreatedAt)
+	if err != nil {
+		return v, err
+	}
+
+	next := StatusBackfilled
+	if v.Passed {
+		next = StatusVerified
+	}
+	if state.Status != StatusCutOver {
+		if _, err := db.DB.Exec("UPDATE data_migration SET status = $2, updated_at = NOW() WHERE name = $1", name, next); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+// ListVerifications lists the latest verifications of a migration, newest first
+func ListVerifications(name string, limit int) ([]Verification, error) {
+	rows, err := db.DB.Query(`
+		SELECT v.checked_rows, v.mismatch_count, COALESCE(v.samples, '[]'), v.passed, v.created_at
+		FROM data_migration_verification v
+		JOIN data_migration m ON m.id = v.migration_id
+		WHERE m.name = $1
+		ORDER BY v.created_at DESC, v.id DESC
+		LIMIT $2
+	`, name, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	verifications := []Verification{}
+	for rows.Next() {
+		var v Verification
+		var samples []byte
+		if err := rows.Scan(&v.CheckedRows, &v.MismatchCount, &samples, &v.Passed, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(samples, &v.Samples); err != nil {
+			v.Samples = []Mismatch{}
+		}
+		verifications = append(verifications, v)
+	}
+	return verifications, nil
+}
+
+// CutOver points readers at the new schema after a fresh verification confirms parity
+// Dual writes continue, so the cutover can be rolled back without losing writes
+func CutOver(name string, verifiedBy int) (State, error) {
+	state, err := GetState(name)
+	if err != nil {
+		return state, err
+	}
+	if state.Status != StatusVerified {
+		return state, ErrInvalidTransition
+	}
+	v, err := RunVerification(name, verifiedBy)
+	if err != nil {
+		return state, err
+	}
+	if !v.Passed {
+		return state, ErrNotInParity
+	}
+
+	if _, err := db.DB.Exec(`
+		UPDATE data_migration SET status = $2, read_from = $3, cutover_at = NOW(), updated_at = NOW()
+		WHERE name = $1 AND status = $4
+	`, name, StatusCutOver, ReadFromNew, StatusVerified); err != nil {
+		return state, err
+	}
+	return GetState(name)
+}
+
+// Rollback points readers back at the old schema after a cutover
+func Rollback(name string) (State, error) {
+	if _, err := lookup(name); err != nil {
+		return State{}, err
+	}
+	result, err := db.DB.Exec(`
+		UPDATE data_migration SET status = $2, read_from = $3, cutover_at = NULL, updated_at = NOW()
+		WHERE name = $1 AND status = $4
+	`, name, StatusVerified, ReadFromOld, StatusCutOver)
+	if err != nil {
+		return State{}, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return State{}, ErrInvalidTransition
+	}
+	return GetState(name)
+}
+
+// ReadsFromNew reports whether readers of a migration should use the new schema
+func ReadsFromNew(name string) bool {
+	if db.DB == nil {
+		return false
+	}
+	var readFrom string
+	if err := db.DB.QueryRow("SELECT COALESCE(read_from, 'old') FROM data_migration WHERE name = $1", name).Scan(&readFrom); err != nil {
+		return false
+	}
+	return readFrom == ReadFromNew
+}
+
+// DualWrite copies a source row that a handler just wrote to the new schema, within the
+// handler's transaction, while the migration has dual writes on. The old schema stays the
+// source of truth: a failed copy is rolled back on its own and counted, the handler's write goes ahead
+// and verification reports the row until the backfill is rerun
+func DualWrite(q Querier, name string, id int) {
+	if db.DB == nil {
+		return
+	}
+	m, err := lookup(name)
+	if err != nil {
+		return
+	}
+	var enabled bool
+	if err := q.QueryRow("SELECT COALESCE(dual_write, false) FROM data_migration WHERE name = $1", name).Scan(&enabled); err != nil || !enabled {
+		return
+	}
+
+	if _, err := q.Exec("SAVEPOINT dual_write"); err != nil {
+		fmt.Printf("Warning: dual write of %s row %d skipped: %v\n", name, id, err)
+		return
+	}
+	if err := m.Apply(q, id); err != nil {
+		fmt.Printf("Warning: dual write of %s row %d failed: %v\n", name, id, err)
+		q.Exec("ROLLBACK TO SAVEPOINT dual_write")
+		q.Exec(`
+			UPDATE data_migration SET dual_write_errors = dual_write_errors + 1, last_error = $2, updated_at = NOW()
+			WHERE name = $1
+		`, name, fmt.Sprintf("dual write of row %d: %v", id, err))
+	}
+	q.Exec("RELEASE SAVEPOINT dual_write")
+}
+
+// Service copies historical rows of migrations that are backfilling
+type Service struct {
+	Interval  time.Duration
+	BatchSize int
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates a backfill service from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		Interval:  time.Duration(cfg.DataMigrationIntervalSeconds) * time.Second,
+		BatchSize: cfg.DataMigrationBatchSize,
+	}
+}
+
+// Default returns the process wide backfill service
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Start runs the backfill periodically
+func (s *Service) Start() {
+	go func() {
+		for {
+			time.Sleep(s.Interval)
+
+			if err := s.RunOnce(); err != nil {
+				fmt.Printf("Warning: data migration backfill failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// RunOnce copies the next batch of rows of every backfilling migration
+func (s *Service) RunOnce() error {
+	if db.DB == nil {
+		return nil
+	}
+	for _, name := range Names() {
+		if err := ensureRow(name); err != nil {
+			return err
+		}
+		if err := s.backfill(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfill copies the rows after the last copied one, one transaction per batch
+// A failing row stops the migration with its error; the batch is retried on resume
+func (s *Service) backfill(name string) error {
+	m, err := lookup(name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the state row so several instances do not copy the same batch
+	var status string
+	var lastID int
+	err = tx.QueryRow("SELECT status, COALESCE(last_id, 0) FROM data_migration WHERE name = $1 FOR UPDATE SKIP LOCKED", name).Scan(&status, &lastID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if status != StatusBackfilling {
+		return nil
+	}
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT id FROM %s WHERE id > $1 ORDER BY id LIMIT $2", m.SourceTable), lastID, s.BatchSize)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		if _, err := tx.Exec(`
+			UPDATE data_migration SET status = $2, backfilled_at = NOW(), updated_at = NOW() WHERE name = $1
+		`, name, StatusBackfilled); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	for _, id := range ids {
+		if err := m.Apply(tx, id); err != nil {
+			tx.Rollback()
+			_, dbErr := db.DB.Exec(`
+				UPDATE data_migration SET status = $2, last_error = $3, updated_at = NOW() WHERE name = $1
+			`, name, StatusFailed, fmt.Sprintf("backfill of row %d: %v", id, err))
+			if dbErr != nil {
+				return dbErr
+			}
+			return fmt.Errorf("backfill of %s row %d: %w", name, id, err)
+		}
+	}
+	if _, err := tx.Exec(`
+		UPDATE data_migration SET last_id = $2, processed_rows = processed_rows + $3, updated_at = NOW() WHERE name = $1
+	`, name, ids[len(ids)-1], len(ids)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/secrets"
+)
+
+// secretConnector opens Postgres connections with a password held in the secret store
+// The password is resolved for every new connection, so pooled connections pick up rotated credentials
+type secretConnector struct {
+	baseConnStr string
+	passwordRef string
+}
+
+// Connect resolves the current password and opens a new connection
+func (c *secretConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	password, err := secrets.Resolve(c.passwordRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve database password: %w", err)
+	}
+
+	connector, err := pq.NewConnector(fmt.Sprintf("%s password='%s'", c.baseConnStr, escapeConnValue(password)))
+	if err != nil {
+		return nil, err
+	}
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		// The cached password may have been rotated away, read it again next time
+		secrets.Default().Invalidate(c.passwordRef)
+	}
+	return conn, err
+}
+
+// Driver returns the underlying Postgres driver
+func (c *secretConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// escapeConnValue escapes a value for a single quoted key/value connection string
+func escapeConnValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
+
+// watchPasswordRotation drops idle connections when the database password is rotated
+// Busy connections finish their work and are replaced as they expire
+func watchPasswordRotation(passwordRef string, maxIdleConn int) {
+	secrets.Default().Watch(passwordRef, func(ref, newValue string) {
+		if DB == nil {
+			return
+		}
+		fmt.Println("Database password rotated, recycling idle connections")
+		DB.SetMaxIdleConns(0)
+		DB.SetMaxIdleConns(maxIdleConn)
+	})
+}
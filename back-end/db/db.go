@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
 	"context"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/faults"
+	"github.com/LTPPPP/TracePost-larvaeChain/secrets"
 )
 
 var (
@@ -42,15 +46,24 @@ func InitDB() error {
 	maxIdleConn := getEnvAsInt("DB_MAX_IDLE_CONNECTIONS", 5)
 	connLifetime := getEnvAsInt("DB_CONNECTION_LIFETIME", 300)
 
-	// Create connection string with additional parameters for performance
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s application_name=tracepost-larvae-api connect_timeout=10",
-		host, port, user, password, dbname, sslmode)
-
 	// Open connection
 	var err error
-	DB, err = sql.Open("postgres", connStr)
-	if err != nil {
-		return fmt.Errorf("failed to open database connection: %w", err)
+	if secrets.IsReference(password) {
+		// Resolve the password per connection so rotated credentials are picked up
+		connStr := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=%s application_name=tracepost-larvae-api connect_timeout=10",
+			host, port, user, dbname, sslmode)
+		DB = sql.OpenDB(faults.Connector(&secretConnector{baseConnStr: connStr, passwordRef: password}))
+		watchPasswordRotation(password, maxIdleConn)
+	} else {
+		// Create connection string with additional parameters for performance
+		connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s application_name=tracepost-larvae-api connect_timeout=10",
+			host, port, user, password, dbname, sslmode)
+
+		connector, err := pq.NewConnector(connStr)
+		if err != nil {
+			return fmt.Errorf("failed to open database connection: %w", err)
+		}
+		DB = sql.OpenDB(faults.Connector(connector))
 	}
 
 	// Set connection pool settings
@@ -71,6 +84,9 @@ func InitDB() error {
 		return fmt.Errorf("failed to create tables: %w", err)
 	}
 
+	// Serve lag-tolerant reads from the replica of this region when there is one
+	openReadReplica()
+
 	// Initialize Redis
 	redisHost := getEnv("REDIS_HOST", "localhost")
 	redisPort := getEnv("REDIS_PORT", "6379")
@@ -180,6 +196,7 @@ func createTables() error {
 				salinity FLOAT,
 				density FLOAT,
 				age INTEGER,
+				custom_parameters JSONB DEFAULT '{}',
 				timestamp TIMESTAMP,
 				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 				is_active BOOLEAN DEFAULT TRUE
@@ -226,6 +243,14 @@ func createTables() error {
 				tx_id TEXT,
 				metadata_hash TEXT,
 				network_id VARCHAR(100),
+				chain_type VARCHAR(50),
+				block_number BIGINT,
+				confirmations BIGINT DEFAULT 0,
+				confirmation_status VARCHAR(20) DEFAULT 'pending',
+				confirmed_at TIMESTAMP,
+				finalized_at TIMESTAMP,
+				resubmit_count INTEGER DEFAULT 0,
+				last_checked_at TIMESTAMP,
 				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 				is_active BOOLEAN DEFAULT TRUE
@@ -372,45 +397,2322 @@ func createTables() error {
 				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 			);
 		`,
-	}
-
-	// Table creation order to satisfy foreign key constraints
-	tableOrder := []string{
-		"company",
-		"account",
-		"api_logs",
-		"hatchery",
-		"batch",
-		"event",
-		"environment_data",
-		"document",
-		"certificates",
-		"blockchain_record",
-		"blockchain_nodes",
-		"shipment_transfer",
-		"transaction_nft",
-		"transaction_nft_history",
-		"company_compliance",
-		"analytics_data",
-		"identities",
-		"verifiable_claims",
-		"credential_logs",
-		"batch_nft",
-	}
-
-	for _, tableName := range tableOrder {
-		query := tableQueries[tableName]
-		if _, err := DB.Exec(query); err != nil {
-			return fmt.Errorf("failed to create table %s: %w", tableName, err)
-		}
-		fmt.Printf("Table %s created\n", tableName)
-	}
-
-	// Create triggers after all tables have been created
-	if err := createTriggers(); err != nil {
-		return fmt.Errorf("failed to create triggers: %w", err)
-	}
-
+		"label_template": `
+			CREATE TABLE IF NOT EXISTS label_template (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER REFERENCES company(id),
+				name VARCHAR(255) NOT NULL,
+				title VARCHAR(255),
+				width_mm FLOAT NOT NULL DEFAULT 100,
+				height_mm FLOAT NOT NULL DEFAULT 60,
+				dpi INTEGER NOT NULL DEFAULT 203,
+				show_species BOOLEAN DEFAULT TRUE,
+				show_hatchery BOOLEAN DEFAULT TRUE,
+				show_quantity BOOLEAN DEFAULT TRUE,
+				show_dates BOOLEAN DEFAULT TRUE,
+				lot_prefix VARCHAR(50) DEFAULT 'LOT',
+				is_default BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"gs1_prefix": `
+			CREATE TABLE IF NOT EXISTS gs1_prefix (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER REFERENCES company(id),
+				prefix VARCHAR(12) UNIQUE NOT NULL,
+				description TEXT,
+				next_gtin_ref BIGINT DEFAULT 1,
+				next_gln_ref BIGINT DEFAULT 1,
+				next_sscc_ref BIGINT DEFAULT 1,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"gs1_identifier": `
+			CREATE TABLE IF NOT EXISTS gs1_identifier (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER REFERENCES company(id),
+				prefix_id INTEGER REFERENCES gs1_prefix(id),
+				id_type VARCHAR(10) NOT NULL,
+				value VARCHAR(18) UNIQUE NOT NULL,
+				epc_uri TEXT,
+				entity_type VARCHAR(50),
+				entity_id INTEGER,
+				entity_ref VARCHAR(255),
+				description TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"shipment": `
+			CREATE TABLE IF NOT EXISTS shipment (
+				id SERIAL PRIMARY KEY,
+				shipment_code VARCHAR(50) UNIQUE NOT NULL,
+				sender_id INTEGER REFERENCES account(id),
+				receiver_id INTEGER REFERENCES account(id),
+				carrier VARCHAR(255),
+				vehicle_id VARCHAR(100),
+				origin TEXT,
+				destination TEXT,
+				status VARCHAR(50) DEFAULT 'draft',
+				departure_time TIMESTAMP,
+				arrival_time TIMESTAMP,
+				notes TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"shipment_item": `
+			CREATE TABLE IF NOT EXISTS shipment_item (
+				id SERIAL PRIMARY KEY,
+				shipment_id INTEGER REFERENCES shipment(id),
+				batch_id INTEGER REFERENCES batch(id),
+				transfer_id INTEGER REFERENCES shipment_transfer(id),
+				quantity INTEGER NOT NULL,
+				container_id VARCHAR(100),
+				container_type VARCHAR(50),
+				received_quantity INTEGER DEFAULT 0,
+				condition VARCHAR(50),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"shipment_gps_ping": `
+			CREATE TABLE IF NOT EXISTS shipment_gps_ping (
+				id SERIAL PRIMARY KEY,
+				shipment_id INTEGER REFERENCES shipment(id),
+				device_id VARCHAR(100),
+				latitude DOUBLE PRECISION NOT NULL,
+				longitude DOUBLE PRECISION NOT NULL,
+				speed_kmh DOUBLE PRECISION,
+				heading DOUBLE PRECISION,
+				accuracy DOUBLE PRECISION,
+				recorded_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"shipment_route_alert": `
+			CREATE TABLE IF NOT EXISTS shipment_route_alert (
+				id SERIAL PRIMARY KEY,
+				shipment_id INTEGER REFERENCES shipment(id),
+				alert_type VARCHAR(50) NOT NULL,
+				latitude DOUBLE PRECISION,
+				longitude DOUBLE PRECISION,
+				started_at TIMESTAMP NOT NULL,
+				duration_minutes DOUBLE PRECISION,
+				ongoing BOOLEAN DEFAULT TRUE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (shipment_id, alert_type, started_at)
+			);
+		`,
+		"shipment_geofence": `
+			CREATE TABLE IF NOT EXISTS shipment_geofence (
+				id SERIAL PRIMARY KEY,
+				shipment_id INTEGER REFERENCES shipment(id),
+				name VARCHAR(255),
+				fence_type VARCHAR(50) NOT NULL,
+				coordinates JSONB NOT NULL,
+				buffer_meters DOUBLE PRECISION DEFAULT 0,
+				radius_meters DOUBLE PRECISION DEFAULT 0,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"shipment_geofence_alert": `
+			CREATE TABLE IF NOT EXISTS shipment_geofence_alert (
+				id SERIAL PRIMARY KEY,
+				shipment_id INTEGER REFERENCES shipment(id),
+				geofence_id INTEGER REFERENCES shipment_geofence(id),
+				alert_type VARCHAR(50) NOT NULL,
+				latitude DOUBLE PRECISION,
+				longitude DOUBLE PRECISION,
+				started_at TIMESTAMP NOT NULL,
+				ended_at TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"blockchain_record_resubmission": `
+			CREATE TABLE IF NOT EXISTS blockchain_record_resubmission (
+				id SERIAL PRIMARY KEY,
+				record_id INTEGER REFERENCES blockchain_record(id),
+				previous_tx_id TEXT,
+				new_tx_id TEXT,
+				reason VARCHAR(100),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"blockchain_fee": `
+			CREATE TABLE IF NOT EXISTS blockchain_fee (
+				id SERIAL PRIMARY KEY,
+				tx_id TEXT,
+				tx_type VARCHAR(100),
+				company_id INTEGER REFERENCES company(id),
+				chain_type VARCHAR(50),
+				gas_used BIGINT,
+				gas_price_gwei NUMERIC(20,9),
+				fee NUMERIC(30,18),
+				currency VARCHAR(20),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"chain_budget": `
+			CREATE TABLE IF NOT EXISTS chain_budget (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER UNIQUE REFERENCES company(id),
+				monthly_limit NUMERIC(30,18) NOT NULL,
+				currency VARCHAR(20) NOT NULL,
+				alert_threshold_percent INTEGER DEFAULT 80,
+				enforce BOOLEAN DEFAULT TRUE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"chain_budget_alert": `
+			CREATE TABLE IF NOT EXISTS chain_budget_alert (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER REFERENCES company(id),
+				period VARCHAR(7) NOT NULL,
+				alert_type VARCHAR(50) NOT NULL,
+				spent NUMERIC(30,18),
+				monthly_limit NUMERIC(30,18),
+				currency VARCHAR(20),
+				message TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(company_id, period, alert_type)
+			);
+		`,
+		"shared_payload": `
+			CREATE TABLE IF NOT EXISTS shared_payload (
+				id SERIAL PRIMARY KEY,
+				batch_id VARCHAR(255) NOT NULL,
+				dest_chain_id VARCHAR(255) NOT NULL,
+				dest_tx_id VARCHAR(255),
+				algorithm VARCHAR(50) NOT NULL,
+				nonce TEXT NOT NULL,
+				ciphertext TEXT NOT NULL,
+				payload_hash VARCHAR(64) NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"shared_payload_key": `
+			CREATE TABLE IF NOT EXISTS shared_payload_key (
+				id SERIAL PRIMARY KEY,
+				payload_id INTEGER NOT NULL REFERENCES shared_payload(id) ON DELETE CASCADE,
+				recipient_did VARCHAR(255) NOT NULL,
+				algorithm VARCHAR(50) NOT NULL,
+				ephemeral_public_key TEXT NOT NULL,
+				nonce TEXT NOT NULL,
+				wrapped_key TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (payload_id, recipient_did)
+			);
+		`,
+		"interop_data_mapping": `
+			CREATE TABLE IF NOT EXISTS interop_data_mapping (
+				id SERIAL PRIMARY KEY,
+				target_type VARCHAR(20) NOT NULL,
+				target_id VARCHAR(255) NOT NULL,
+				data_standard VARCHAR(100) NOT NULL,
+				custom_schema JSONB,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE,
+				UNIQUE (target_type, target_id)
+			);
+		`,
+		"webhook_subscription": `
+			CREATE TABLE IF NOT EXISTS webhook_subscription (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER REFERENCES company(id),
+				url TEXT NOT NULL,
+				secret VARCHAR(128) NOT NULL,
+				event_types TEXT[] NOT NULL DEFAULT '{}',
+				description TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"webhook_delivery": `
+			CREATE TABLE IF NOT EXISTS webhook_delivery (
+				id SERIAL PRIMARY KEY,
+				subscription_id INTEGER NOT NULL REFERENCES webhook_subscription(id) ON DELETE CASCADE,
+				event_type VARCHAR(100) NOT NULL,
+				payload JSONB NOT NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				attempts INTEGER DEFAULT 0,
+				response_code INTEGER,
+				last_error TEXT,
+				next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				delivered_at TIMESTAMP
+			);
+		`,
+		"inbound_message": `
+			CREATE TABLE IF NOT EXISTS inbound_message (
+				id SERIAL PRIMARY KEY,
+				protocol VARCHAR(20) NOT NULL,
+				source_chain_id VARCHAR(255) NOT NULL,
+				message_id VARCHAR(255) NOT NULL,
+				message_type VARCHAR(100) NOT NULL,
+				payload JSONB,
+				proof TEXT,
+				status VARCHAR(20) NOT NULL,
+				error TEXT,
+				batch_id INTEGER REFERENCES batch(id),
+				event_id INTEGER REFERENCES event(id),
+				received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				processed_at TIMESTAMP,
+				UNIQUE (source_chain_id, message_id)
+			);
+		`,
+		"chain_registry": `
+			CREATE TABLE IF NOT EXISTS chain_registry (
+				id SERIAL PRIMARY KEY,
+				chain_id VARCHAR(255) NOT NULL UNIQUE,
+				name VARCHAR(255),
+				chain_type VARCHAR(50) NOT NULL,
+				endpoint TEXT NOT NULL,
+				protocol VARCHAR(20),
+				supports_nft BOOLEAN DEFAULT false,
+				supports_ibc BOOLEAN DEFAULT false,
+				supports_xcm BOOLEAN DEFAULT false,
+				supports_smart_contracts BOOLEAN DEFAULT false,
+				block_time_seconds FLOAT,
+				finality_seconds FLOAT,
+				reachable BOOLEAN DEFAULT false,
+				latest_block BIGINT,
+				probe_error TEXT,
+				probed_at TIMESTAMP,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT true
+			);
+		`,
+		"batch_share": `
+			CREATE TABLE IF NOT EXISTS batch_share (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER REFERENCES batch(id),
+				dest_chain_id VARCHAR(255) NOT NULL,
+				data_standard VARCHAR(100),
+				dest_tx_id TEXT,
+				encrypted BOOLEAN DEFAULT false,
+				sync_status VARCHAR(20) NOT NULL DEFAULT 'in_sync',
+				synced_status VARCHAR(50),
+				synced_event_id INTEGER DEFAULT 0,
+				synced_certificate_id INTEGER DEFAULT 0,
+				sync_count INTEGER DEFAULT 0,
+				failure_count INTEGER DEFAULT 0,
+				last_error TEXT,
+				last_sync_tx_id TEXT,
+				last_synced_at TIMESTAMP,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT true,
+				UNIQUE (batch_id, dest_chain_id)
+			);
+		`,
+		"environment_parameter": `
+			CREATE TABLE IF NOT EXISTS environment_parameter (
+				id SERIAL PRIMARY KEY,
+				code VARCHAR(50) UNIQUE NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				unit VARCHAR(50),
+				data_type VARCHAR(20) DEFAULT 'number',
+				min_value FLOAT,
+				max_value FLOAT,
+				alert_min FLOAT,
+				alert_max FLOAT,
+				description TEXT,
+				is_builtin BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"environment_alert": `
+			CREATE TABLE IF NOT EXISTS environment_alert (
+				id SERIAL PRIMARY KEY,
+				environment_data_id INTEGER REFERENCES environment_data(id),
+				batch_id INTEGER REFERENCES batch(id),
+				parameter_code VARCHAR(50) NOT NULL,
+				value FLOAT NOT NULL,
+				alert_min FLOAT,
+				alert_max FLOAT,
+				direction VARCHAR(10) NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"device": `
+			CREATE TABLE IF NOT EXISTS device (
+				id SERIAL PRIMARY KEY,
+				serial_number VARCHAR(100) UNIQUE NOT NULL,
+				device_type VARCHAR(50) NOT NULL,
+				manufacturer VARCHAR(255),
+				model VARCHAR(255),
+				hatchery_id INTEGER REFERENCES hatchery(id),
+				calibration_interval_days INTEGER DEFAULT 0,
+				last_calibrated_at TIMESTAMP,
+				calibration_due_at TIMESTAMP,
+				notes TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"device_calibration": `
+			CREATE TABLE IF NOT EXISTS device_calibration (
+				id SERIAL PRIMARY KEY,
+				device_id INTEGER REFERENCES device(id),
+				calibrated_at TIMESTAMP NOT NULL,
+				calibrated_by VARCHAR(255),
+				due_at TIMESTAMP,
+				document_id INTEGER REFERENCES document(id),
+				notes TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"tank": `
+			CREATE TABLE IF NOT EXISTS tank (
+				id SERIAL PRIMARY KEY,
+				hatchery_id INTEGER REFERENCES hatchery(id),
+				code VARCHAR(50) NOT NULL,
+				tank_type VARCHAR(20) DEFAULT 'tank',
+				capacity INTEGER NOT NULL,
+				volume_liters FLOAT,
+				notes TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE,
+				UNIQUE (hatchery_id, code)
+			);
+		`,
+		"tank_assignment": `
+			CREATE TABLE IF NOT EXISTS tank_assignment (
+				id SERIAL PRIMARY KEY,
+				tank_id INTEGER REFERENCES tank(id),
+				batch_id INTEGER REFERENCES batch(id),
+				quantity INTEGER NOT NULL,
+				assigned_at TIMESTAMP NOT NULL,
+				released_at TIMESTAMP,
+				notes TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"broodstock": `
+			CREATE TABLE IF NOT EXISTS broodstock (
+				id SERIAL PRIMARY KEY,
+				hatchery_id INTEGER REFERENCES hatchery(id),
+				tag_code VARCHAR(100) NOT NULL,
+				species VARCHAR(100),
+				sex VARCHAR(20) DEFAULT 'unknown',
+				origin_country VARCHAR(100),
+				supplier VARCHAR(255),
+				genetic_line VARCHAR(255),
+				generation INTEGER,
+				spf_status VARCHAR(100),
+				import_permit_number VARCHAR(100),
+				import_permit_expiry TIMESTAMP,
+				quarantine_status VARCHAR(50) DEFAULT 'pending',
+				quarantine_started_at TIMESTAMP,
+				quarantine_released_at TIMESTAMP,
+				acquired_at TIMESTAMP,
+				notes TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE,
+				UNIQUE (hatchery_id, tag_code)
+			);
+		`,
+		"batch_broodstock": `
+			CREATE TABLE IF NOT EXISTS batch_broodstock (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER REFERENCES batch(id),
+				broodstock_id INTEGER REFERENCES broodstock(id),
+				role VARCHAR(20) DEFAULT 'parent',
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (batch_id, broodstock_id)
+			);
+		`,
+		"broodstock_event": `
+			CREATE TABLE IF NOT EXISTS broodstock_event (
+				id SERIAL PRIMARY KEY,
+				broodstock_id INTEGER REFERENCES broodstock(id),
+				event_type VARCHAR(100),
+				actor_id INTEGER REFERENCES account(id),
+				location TEXT,
+				timestamp TIMESTAMP,
+				metadata JSONB,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"strain": `
+			CREATE TABLE IF NOT EXISTS strain (
+				id SERIAL PRIMARY KEY,
+				code VARCHAR(100) UNIQUE NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				species VARCHAR(100),
+				line_type VARCHAR(50) DEFAULT 'conventional',
+				supplier VARCHAR(255),
+				supplier_country VARCHAR(100),
+				pathogens TEXT[] DEFAULT '{}',
+				description TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"accredited_lab": `
+			CREATE TABLE IF NOT EXISTS accredited_lab (
+				id SERIAL PRIMARY KEY,
+				name VARCHAR(255) NOT NULL,
+				did VARCHAR(255),
+				accreditation_body VARCHAR(255) NOT NULL,
+				accreditation_number VARCHAR(100) UNIQUE NOT NULL,
+				scopes TEXT[] DEFAULT '{}',
+				valid_until TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"batch_claim": `
+			CREATE TABLE IF NOT EXISTS batch_claim (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER REFERENCES batch(id),
+				claim VARCHAR(50) NOT NULL,
+				certificate_id INTEGER REFERENCES certificates(id),
+				declared_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE,
+				UNIQUE (batch_id, claim)
+			);
+		`,
+		"content_block": `
+			CREATE TABLE IF NOT EXISTS content_block (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER REFERENCES company(id),
+				species VARCHAR(100) DEFAULT '',
+				block_type VARCHAR(50) NOT NULL,
+				title VARCHAR(255),
+				body TEXT,
+				image_url TEXT,
+				link_url TEXT,
+				data JSONB DEFAULT '{}',
+				position INTEGER DEFAULT 0,
+				is_published BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"inspection_form": `
+			CREATE TABLE IF NOT EXISTS inspection_form (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER REFERENCES company(id),
+				name VARCHAR(255) NOT NULL,
+				description TEXT,
+				target_type VARCHAR(20) DEFAULT 'batch',
+				fields JSONB NOT NULL DEFAULT '[]',
+				pass_score FLOAT DEFAULT 0,
+				standards TEXT[] DEFAULT '{}',
+				version INTEGER DEFAULT 1,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"inspection_submission": `
+			CREATE TABLE IF NOT EXISTS inspection_submission (
+				id SERIAL PRIMARY KEY,
+				form_id INTEGER REFERENCES inspection_form(id),
+				form_version INTEGER DEFAULT 1,
+				batch_id INTEGER REFERENCES batch(id),
+				hatchery_id INTEGER REFERENCES hatchery(id),
+				inspector_id INTEGER REFERENCES account(id),
+				answers JSONB NOT NULL DEFAULT '{}',
+				location TEXT,
+				notes TEXT,
+				status VARCHAR(20) DEFAULT 'draft',
+				score FLOAT DEFAULT 0,
+				max_score FLOAT DEFAULT 0,
+				score_percent FLOAT DEFAULT 0,
+				passed BOOLEAN DEFAULT FALSE,
+				submitted_at TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"inspection_photo": `
+			CREATE TABLE IF NOT EXISTS inspection_photo (
+				id SERIAL PRIMARY KEY,
+				submission_id INTEGER REFERENCES inspection_submission(id),
+				field_key VARCHAR(100) NOT NULL,
+				ipfs_hash VARCHAR(255),
+				ipfs_uri TEXT,
+				file_name VARCHAR(255),
+				file_size BIGINT,
+				uploaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"audit_access_grant": `
+			CREATE TABLE IF NOT EXISTS audit_access_grant (
+				id SERIAL PRIMARY KEY,
+				auditor_id INTEGER REFERENCES account(id),
+				hatchery_id INTEGER REFERENCES hatchery(id),
+				scope_start TIMESTAMP NOT NULL,
+				scope_end TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				purpose TEXT,
+				granted_by INTEGER REFERENCES account(id),
+				revoked_at TIMESTAMP,
+				revoked_by INTEGER REFERENCES account(id),
+				last_accessed_at TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"legal_hold": `
+			CREATE TABLE IF NOT EXISTS legal_hold (
+				id SERIAL PRIMARY KEY,
+				target_type VARCHAR(20) NOT NULL,
+				target_id INTEGER NOT NULL,
+				case_reference VARCHAR(100),
+				reason TEXT NOT NULL,
+				placed_by INTEGER REFERENCES account(id),
+				placed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				released_at TIMESTAMP,
+				released_by INTEGER REFERENCES account(id),
+				release_note TEXT,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"legal_hold_access_log": `
+			CREATE TABLE IF NOT EXISTS legal_hold_access_log (
+				id SERIAL PRIMARY KEY,
+				hold_id INTEGER REFERENCES legal_hold(id),
+				target_type VARCHAR(20) NOT NULL,
+				target_id INTEGER NOT NULL,
+				account_id INTEGER,
+				method VARCHAR(10) NOT NULL,
+				path TEXT NOT NULL,
+				ip_address VARCHAR(64),
+				blocked BOOLEAN DEFAULT FALSE,
+				accessed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"lims_token": `
+			CREATE TABLE IF NOT EXISTS lims_token (
+				id SERIAL PRIMARY KEY,
+				lab_id INTEGER REFERENCES accredited_lab(id),
+				name VARCHAR(255),
+				token_prefix VARCHAR(20) NOT NULL,
+				token_hash VARCHAR(64) UNIQUE NOT NULL,
+				expires_at TIMESTAMP,
+				last_used_at TIMESTAMP,
+				revoked_at TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"lims_result": `
+			CREATE TABLE IF NOT EXISTS lims_result (
+				id SERIAL PRIMARY KEY,
+				lab_id INTEGER REFERENCES accredited_lab(id),
+				token_id INTEGER REFERENCES lims_token(id),
+				batch_id INTEGER REFERENCES batch(id),
+				external_id VARCHAR(100) NOT NULL,
+				sample_reference VARCHAR(100),
+				test_type VARCHAR(50) NOT NULL,
+				sampled_at TIMESTAMP,
+				analyzed_at TIMESTAMP NOT NULL,
+				overall_result VARCHAR(20) NOT NULL,
+				analytes JSONB NOT NULL DEFAULT '[]',
+				analyst VARCHAR(255),
+				notes TEXT,
+				document_id INTEGER REFERENCES document(id),
+				received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(lab_id, external_id)
+			);
+		`,
+		"sample": `
+			CREATE TABLE IF NOT EXISTS sample (
+				id SERIAL PRIMARY KEY,
+				sample_code VARCHAR(50) UNIQUE NOT NULL,
+				batch_id INTEGER REFERENCES batch(id),
+				sample_type VARCHAR(50) NOT NULL,
+				quantity FLOAT,
+				unit VARCHAR(20),
+				collected_by INTEGER REFERENCES account(id),
+				collected_at TIMESTAMP NOT NULL,
+				collection_location VARCHAR(255),
+				lab_id INTEGER REFERENCES accredited_lab(id),
+				status VARCHAR(20) DEFAULT 'collected',
+				custodian_type VARCHAR(20) DEFAULT 'hatchery',
+				custodian_name VARCHAR(255),
+				notes TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"sample_custody": `
+			CREATE TABLE IF NOT EXISTS sample_custody (
+				id SERIAL PRIMARY KEY,
+				sample_id INTEGER REFERENCES sample(id),
+				from_type VARCHAR(20) NOT NULL,
+				from_name VARCHAR(255),
+				to_type VARCHAR(20) NOT NULL,
+				to_name VARCHAR(255) NOT NULL,
+				handed_over_by INTEGER REFERENCES account(id),
+				transferred_at TIMESTAMP NOT NULL,
+				location VARCHAR(255),
+				seal_number VARCHAR(100),
+				seal_intact BOOLEAN DEFAULT TRUE,
+				temperature FLOAT,
+				notes TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"derived_product": `
+			CREATE TABLE IF NOT EXISTS derived_product (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER REFERENCES company(id),
+				product_name VARCHAR(255) NOT NULL,
+				product_type VARCHAR(50) NOT NULL,
+				lot_number VARCHAR(100),
+				quantity FLOAT,
+				unit VARCHAR(20),
+				production_date TIMESTAMP NOT NULL,
+				expiry_date TIMESTAMP NOT NULL,
+				storage_conditions TEXT,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"derived_product_source": `
+			CREATE TABLE IF NOT EXISTS derived_product_source (
+				id SERIAL PRIMARY KEY,
+				product_id INTEGER REFERENCES derived_product(id),
+				batch_id INTEGER REFERENCES batch(id),
+				quantity_used FLOAT,
+				UNIQUE(product_id, batch_id)
+			);
+		`,
+		"batch_recall": `
+			CREATE TABLE IF NOT EXISTS batch_recall (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER REFERENCES batch(id),
+				reason TEXT NOT NULL,
+				severity VARCHAR(20) NOT NULL,
+				initiated_by INTEGER REFERENCES account(id),
+				initiated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				lifted_at TIMESTAMP,
+				lifted_by INTEGER REFERENCES account(id),
+				lift_reason TEXT
+			);
+		`,
+		"processing_run": `
+			CREATE TABLE IF NOT EXISTS processing_run (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER REFERENCES company(id),
+				process_type VARCHAR(50) NOT NULL,
+				processed_at TIMESTAMP NOT NULL,
+				location VARCHAR(255),
+				input_kg FLOAT NOT NULL,
+				output_kg FLOAT NOT NULL,
+				yield_percent FLOAT NOT NULL,
+				tolerance_percent FLOAT NOT NULL,
+				flags TEXT[] DEFAULT '{}',
+				notes TEXT,
+				recorded_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"processing_input": `
+			CREATE TABLE IF NOT EXISTS processing_input (
+				id SERIAL PRIMARY KEY,
+				run_id INTEGER REFERENCES processing_run(id),
+				batch_id INTEGER REFERENCES batch(id),
+				quantity_kg FLOAT NOT NULL
+			);
+		`,
+		"processing_output": `
+			CREATE TABLE IF NOT EXISTS processing_output (
+				id SERIAL PRIMARY KEY,
+				run_id INTEGER REFERENCES processing_run(id),
+				product_id INTEGER REFERENCES derived_product(id),
+				quantity_kg FLOAT NOT NULL
+			);
+		`,
+		"origin_dispute": `
+			CREATE TABLE IF NOT EXISTS origin_dispute (
+				id SERIAL PRIMARY KEY,
+				identifier_scheme VARCHAR(30) NOT NULL,
+				lot_identifier VARCHAR(255) NOT NULL,
+				status VARCHAR(20) DEFAULT 'open',
+				opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				winning_claim_id INTEGER,
+				resolution TEXT,
+				resolved_by INTEGER REFERENCES account(id),
+				resolved_at TIMESTAMP,
+				tx_id VARCHAR(255)
+			);
+		`,
+		"origin_claim": `
+			CREATE TABLE IF NOT EXISTS origin_claim (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER REFERENCES company(id),
+				batch_id INTEGER REFERENCES batch(id),
+				identifier_scheme VARCHAR(30) NOT NULL,
+				lot_identifier VARCHAR(255) NOT NULL,
+				evidence TEXT,
+				status VARCHAR(20) DEFAULT 'active',
+				dispute_id INTEGER REFERENCES origin_dispute(id),
+				claimed_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"origin_dispute_evidence": `
+			CREATE TABLE IF NOT EXISTS origin_dispute_evidence (
+				id SERIAL PRIMARY KEY,
+				dispute_id INTEGER REFERENCES origin_dispute(id),
+				claim_id INTEGER REFERENCES origin_claim(id),
+				statement TEXT NOT NULL,
+				document_ids INTEGER[] DEFAULT '{}',
+				submitted_by INTEGER REFERENCES account(id),
+				submitted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"user_preference": `
+			CREATE TABLE IF NOT EXISTS user_preference (
+				account_id INTEGER PRIMARY KEY REFERENCES account(id),
+				language VARCHAR(10),
+				locale VARCHAR(20),
+				unit_system VARCHAR(20),
+				timezone VARCHAR(64),
+				localized_display BOOLEAN DEFAULT FALSE,
+				notification_channels JSONB NOT NULL DEFAULT '{}',
+				default_hatchery_id INTEGER REFERENCES hatchery(id),
+				table_layouts JSONB NOT NULL DEFAULT '{}',
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"permission_group": `
+			CREATE TABLE IF NOT EXISTS permission_group (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER REFERENCES company(id),
+				name VARCHAR(100) NOT NULL,
+				description TEXT,
+				permissions TEXT[] NOT NULL DEFAULT '{}',
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"permission_group_scope": `
+			CREATE TABLE IF NOT EXISTS permission_group_scope (
+				id SERIAL PRIMARY KEY,
+				group_id INTEGER REFERENCES permission_group(id),
+				hatchery_id INTEGER REFERENCES hatchery(id),
+				tank_id INTEGER REFERENCES tank(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				CHECK (hatchery_id IS NOT NULL OR tank_id IS NOT NULL)
+			);
+		`,
+		"permission_group_member": `
+			CREATE TABLE IF NOT EXISTS permission_group_member (
+				id SERIAL PRIMARY KEY,
+				group_id INTEGER REFERENCES permission_group(id),
+				account_id INTEGER REFERENCES account(id),
+				added_by INTEGER REFERENCES account(id),
+				added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (group_id, account_id)
+			);
+		`,
+		"api_usage_daily": `
+			CREATE TABLE IF NOT EXISTS api_usage_daily (
+				id SERIAL PRIMARY KEY,
+				usage_date DATE NOT NULL,
+				company_id INTEGER NOT NULL DEFAULT 0,
+				api_key VARCHAR(100) NOT NULL DEFAULT '',
+				method VARCHAR(10) NOT NULL,
+				route VARCHAR(255) NOT NULL,
+				call_count BIGINT NOT NULL DEFAULT 0,
+				error_count BIGINT NOT NULL DEFAULT 0,
+				total_duration_ms DOUBLE PRECISION NOT NULL DEFAULT 0,
+				last_called_at TIMESTAMP,
+				UNIQUE (usage_date, company_id, api_key, method, route)
+			);
+		`,
+		"subscription_plan": `
+			CREATE TABLE IF NOT EXISTS subscription_plan (
+				id SERIAL PRIMARY KEY,
+				code VARCHAR(50) UNIQUE NOT NULL,
+				name VARCHAR(100) NOT NULL,
+				description TEXT,
+				max_batches_per_month INTEGER,
+				max_storage_mb INTEGER,
+				interop_enabled BOOLEAN DEFAULT FALSE,
+				overage_action VARCHAR(10) DEFAULT 'block',
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"company_subscription": `
+			CREATE TABLE IF NOT EXISTS company_subscription (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER REFERENCES company(id),
+				plan_id INTEGER REFERENCES subscription_plan(id),
+				started_at TIMESTAMP NOT NULL,
+				ended_at TIMESTAMP,
+				assigned_by INTEGER REFERENCES account(id),
+				notes TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"feature_flag": `
+			CREATE TABLE IF NOT EXISTS feature_flag (
+				id SERIAL PRIMARY KEY,
+				key VARCHAR(100) UNIQUE NOT NULL,
+				description TEXT,
+				enabled BOOLEAN DEFAULT FALSE,
+				rollout_percent INTEGER DEFAULT 100 CHECK (rollout_percent BETWEEN 0 AND 100),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"feature_flag_company": `
+			CREATE TABLE IF NOT EXISTS feature_flag_company (
+				id SERIAL PRIMARY KEY,
+				flag_id INTEGER REFERENCES feature_flag(id),
+				company_id INTEGER REFERENCES company(id),
+				enabled BOOLEAN NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (flag_id, company_id)
+			);
+		`,
+		"data_migration": `
+			CREATE TABLE IF NOT EXISTS data_migration (
+				id SERIAL PRIMARY KEY,
+				name VARCHAR(100) UNIQUE NOT NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				dual_write BOOLEAN DEFAULT FALSE,
+				read_from VARCHAR(3) DEFAULT 'old',
+				last_id INTEGER DEFAULT 0,
+				total_rows INTEGER DEFAULT 0,
+				processed_rows INTEGER DEFAULT 0,
+				dual_write_errors INTEGER DEFAULT 0,
+				last_error TEXT,
+				started_at TIMESTAMP,
+				backfilled_at TIMESTAMP,
+				cutover_at TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"data_migration_verification": `
+			CREATE TABLE IF NOT EXISTS data_migration_verification (
+				id SERIAL PRIMARY KEY,
+				migration_id INTEGER REFERENCES data_migration(id),
+				checked_rows INTEGER NOT NULL,
+				mismatch_count INTEGER NOT NULL,
+				samples JSONB DEFAULT '[]',
+				passed BOOLEAN NOT NULL,
+				verified_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"batch_quantity_ledger": `
+			CREATE TABLE IF NOT EXISTS batch_quantity_ledger (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER REFERENCES batch(id),
+				entry_type VARCHAR(30) NOT NULL,
+				quantity_delta INTEGER NOT NULL,
+				source VARCHAR(50),
+				recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"trace_snapshot": `
+			CREATE TABLE IF NOT EXISTS trace_snapshot (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER NOT NULL REFERENCES batch(id),
+				version INTEGER NOT NULL,
+				content_hash VARCHAR(64) NOT NULL,
+				json_cid VARCHAR(255) NOT NULL,
+				json_uri TEXT NOT NULL,
+				html_cid VARCHAR(255),
+				html_uri TEXT,
+				status VARCHAR(20) NOT NULL DEFAULT 'published',
+				anchor_tx_id VARCHAR(255),
+				anchor_error TEXT,
+				anchored_at TIMESTAMP,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				checked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(batch_id, version)
+			);
+		`,
+		"event_type_schema": `
+			CREATE TABLE IF NOT EXISTS event_type_schema (
+				id SERIAL PRIMARY KEY,
+				event_type VARCHAR(100) UNIQUE NOT NULL,
+				description TEXT,
+				schema JSONB NOT NULL,
+				version INTEGER NOT NULL DEFAULT 1,
+				updated_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"event_import_job": `
+			CREATE TABLE IF NOT EXISTS event_import_job (
+				id SERIAL PRIMARY KEY,
+				file_name VARCHAR(255),
+				file_format VARCHAR(10) NOT NULL,
+				status VARCHAR(20) NOT NULL,
+				dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+				skip_invalid BOOLEAN NOT NULL DEFAULT FALSE,
+				column_mapping JSONB,
+				total_rows INTEGER NOT NULL DEFAULT 0,
+				valid_rows INTEGER NOT NULL DEFAULT 0,
+				imported_rows INTEGER NOT NULL DEFAULT 0,
+				error_count INTEGER NOT NULL DEFAULT 0,
+				errors JSONB DEFAULT '[]',
+				failure_reason TEXT,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				started_at TIMESTAMP,
+				finished_at TIMESTAMP
+			);
+		`,
+		"batch_view": `
+			CREATE TABLE IF NOT EXISTS batch_view (
+				id SERIAL PRIMARY KEY,
+				name VARCHAR(100) NOT NULL,
+				company_id INTEGER REFERENCES company(id),
+				owner_id INTEGER REFERENCES account(id),
+				filters JSONB NOT NULL DEFAULT '{}',
+				is_shared BOOLEAN NOT NULL DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"batch_view_default": `
+			CREATE TABLE IF NOT EXISTS batch_view_default (
+				user_id INTEGER PRIMARY KEY REFERENCES account(id),
+				view_id INTEGER NOT NULL REFERENCES batch_view(id),
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"warehouse_schema": `
+			CREATE TABLE IF NOT EXISTS warehouse_schema (
+				id SERIAL PRIMARY KEY,
+				dataset VARCHAR(50) NOT NULL,
+				version INTEGER NOT NULL,
+				major_version INTEGER NOT NULL,
+				columns JSONB NOT NULL,
+				fingerprint VARCHAR(64) NOT NULL,
+				breaking BOOLEAN NOT NULL DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (dataset, version)
+			);
+		`,
+		"warehouse_export_day": `
+			CREATE TABLE IF NOT EXISTS warehouse_export_day (
+				id SERIAL PRIMARY KEY,
+				dataset VARCHAR(50) NOT NULL,
+				partition_date DATE NOT NULL,
+				schema_version INTEGER NOT NULL,
+				status VARCHAR(20) NOT NULL,
+				file_count INTEGER NOT NULL DEFAULT 0,
+				row_count BIGINT NOT NULL DEFAULT 0,
+				error TEXT,
+				requested_by INTEGER REFERENCES account(id),
+				started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				finished_at TIMESTAMP,
+				UNIQUE (dataset, partition_date)
+			);
+		`,
+		"warehouse_export": `
+			CREATE TABLE IF NOT EXISTS warehouse_export (
+				id SERIAL PRIMARY KEY,
+				dataset VARCHAR(50) NOT NULL,
+				partition_date DATE NOT NULL,
+				company_id INTEGER REFERENCES company(id),
+				schema_version INTEGER NOT NULL,
+				object_key TEXT NOT NULL,
+				row_count BIGINT NOT NULL DEFAULT 0,
+				byte_size BIGINT NOT NULL DEFAULT 0,
+				sha256 VARCHAR(64) NOT NULL,
+				etag VARCHAR(255),
+				status VARCHAR(20) NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"event_bus_outbox": `
+			CREATE TABLE IF NOT EXISTS event_bus_outbox (
+				id SERIAL PRIMARY KEY,
+				event_id VARCHAR(36) UNIQUE NOT NULL,
+				event_type VARCHAR(50) NOT NULL,
+				subject VARCHAR(255) NOT NULL,
+				message_key VARCHAR(100),
+				payload JSONB NOT NULL,
+				status VARCHAR(20) NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				last_error TEXT,
+				next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				published_at TIMESTAMP
+			);
+		`,
+		"notification_connector": `
+			CREATE TABLE IF NOT EXISTS notification_connector (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER NOT NULL REFERENCES company(id),
+				provider VARCHAR(20) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				webhook_url TEXT NOT NULL,
+				channel VARCHAR(255),
+				alert_types TEXT[] NOT NULL DEFAULT '{}',
+				template TEXT,
+				rate_limit_per_hour INTEGER,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"notification_message": `
+			CREATE TABLE IF NOT EXISTS notification_message (
+				id SERIAL PRIMARY KEY,
+				connector_id INTEGER NOT NULL REFERENCES notification_connector(id) ON DELETE CASCADE,
+				alert_type VARCHAR(100) NOT NULL,
+				text TEXT NOT NULL,
+				status VARCHAR(20) NOT NULL,
+				response_code INTEGER,
+				last_error TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				sent_at TIMESTAMP
+			);
+		`,
+		"digest_delivery": `
+			CREATE TABLE IF NOT EXISTS digest_delivery (
+				id SERIAL PRIMARY KEY,
+				account_id INTEGER NOT NULL REFERENCES account(id),
+				company_id INTEGER REFERENCES company(id),
+				frequency VARCHAR(10) NOT NULL,
+				period_start DATE NOT NULL,
+				period_end DATE NOT NULL,
+				status VARCHAR(20) NOT NULL,
+				attempts INTEGER DEFAULT 1,
+				last_error TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				sent_at TIMESTAMP,
+				UNIQUE (account_id, frequency, period_start)
+			);
+		`,
+		"company_domain": `
+			CREATE TABLE IF NOT EXISTS company_domain (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER NOT NULL REFERENCES company(id),
+				domain VARCHAR(253) NOT NULL,
+				trace_domain BOOLEAN DEFAULT FALSE,
+				verification_token VARCHAR(64) NOT NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				last_error TEXT,
+				last_checked_at TIMESTAMP,
+				verified_at TIMESTAMP,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"signing_key": `
+			CREATE TABLE IF NOT EXISTS signing_key (
+				id SERIAL PRIMARY KEY,
+				kid VARCHAR(64) NOT NULL UNIQUE,
+				algorithm VARCHAR(16) NOT NULL,
+				public_key TEXT NOT NULL,
+				private_key TEXT NOT NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'active',
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				retired_at TIMESTAMP,
+				expires_at TIMESTAMP
+			);
+		`,
+		"batch_ownership_transfer": `
+			CREATE TABLE IF NOT EXISTS batch_ownership_transfer (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER NOT NULL REFERENCES batch(id),
+				seller_company_id INTEGER NOT NULL REFERENCES company(id),
+				buyer_company_id INTEGER NOT NULL REFERENCES company(id),
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				price NUMERIC(18, 2),
+				currency VARCHAR(3),
+				terms TEXT,
+				initiated_by INTEGER REFERENCES account(id),
+				responded_by INTEGER REFERENCES account(id),
+				response_note TEXT,
+				tx_id VARCHAR(255),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				responded_at TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"transfer_commercial_terms": `
+			CREATE TABLE IF NOT EXISTS transfer_commercial_terms (
+				id SERIAL PRIMARY KEY,
+				transfer_id INTEGER NOT NULL UNIQUE REFERENCES shipment_transfer(id),
+				po_number VARCHAR(100),
+				unit_price NUMERIC(18, 4),
+				currency VARCHAR(3),
+				incoterms VARCHAR(3),
+				quantity INTEGER,
+				updated_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"exchange_rate": `
+			CREATE TABLE IF NOT EXISTS exchange_rate (
+				id SERIAL PRIMARY KEY,
+				base_currency VARCHAR(3) NOT NULL,
+				quote_currency VARCHAR(3) NOT NULL,
+				rate_date DATE NOT NULL,
+				rate NUMERIC(24, 10) NOT NULL,
+				source VARCHAR(50) NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (base_currency, quote_currency, rate_date)
+			);
+		`,
+		"document_translation": `
+			CREATE TABLE IF NOT EXISTS document_translation (
+				id SERIAL PRIMARY KEY,
+				document_id INTEGER NOT NULL REFERENCES document(id),
+				source_language VARCHAR(20),
+				target_language VARCHAR(20) NOT NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'requested',
+				certified BOOLEAN NOT NULL DEFAULT FALSE,
+				assignee_type VARCHAR(20),
+				translator_id INTEGER REFERENCES account(id),
+				external_job_id VARCHAR(255),
+				callback_token_hash VARCHAR(64),
+				translated_document_id INTEGER REFERENCES document(id),
+				due_date TIMESTAMP,
+				notes TEXT,
+				error TEXT,
+				requested_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				assigned_at TIMESTAMP,
+				completed_at TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"consumer_feedback": `
+			CREATE TABLE IF NOT EXISTS consumer_feedback (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER NOT NULL REFERENCES batch(id),
+				company_id INTEGER REFERENCES company(id),
+				rating INTEGER,
+				comment TEXT,
+				language VARCHAR(20),
+				status VARCHAR(20) NOT NULL DEFAULT 'pending_review',
+				moderation_findings JSONB NOT NULL DEFAULT '[]',
+				client_hash VARCHAR(64),
+				reviewed_by INTEGER REFERENCES account(id),
+				review_note TEXT,
+				reviewed_at TIMESTAMP,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"reference_entry": `
+			CREATE TABLE IF NOT EXISTS reference_entry (
+				kind VARCHAR(50) NOT NULL,
+				key VARCHAR(255) NOT NULL,
+				value JSONB NOT NULL DEFAULT '{}',
+				deleted BOOLEAN NOT NULL DEFAULT FALSE,
+				hlc BIGINT NOT NULL,
+				origin_region VARCHAR(16) NOT NULL,
+				seq BIGSERIAL,
+				updated_by INTEGER REFERENCES account(id),
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (kind, key)
+			);
+		`,
+		"reference_sync_peer": `
+			CREATE TABLE IF NOT EXISTS reference_sync_peer (
+				region VARCHAR(16) PRIMARY KEY,
+				last_seq BIGINT NOT NULL DEFAULT 0,
+				last_synced_at TIMESTAMP,
+				last_error TEXT,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"tenant_snapshot_run": `
+			CREATE TABLE IF NOT EXISTS tenant_snapshot_run (
+				id SERIAL PRIMARY KEY,
+				operation VARCHAR(20) NOT NULL,
+				company_id INTEGER REFERENCES company(id),
+				source_company_id INTEGER NOT NULL,
+				source_region VARCHAR(16) NOT NULL,
+				mode VARCHAR(20),
+				dry_run BOOLEAN NOT NULL DEFAULT false,
+				taken_at TIMESTAMP NOT NULL,
+				checksum VARCHAR(64) NOT NULL,
+				row_count INTEGER NOT NULL DEFAULT 0,
+				report JSONB,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"batch_access_token": `
+			CREATE TABLE IF NOT EXISTS batch_access_token (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER NOT NULL REFERENCES batch(id),
+				company_id INTEGER REFERENCES company(id),
+				supplier_name VARCHAR(255) NOT NULL,
+				supplier_email VARCHAR(255),
+				scopes TEXT[] NOT NULL,
+				token_prefix VARCHAR(20) NOT NULL,
+				token_hash VARCHAR(64) UNIQUE NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				max_uses INTEGER,
+				use_count INTEGER NOT NULL DEFAULT 0,
+				last_used_at TIMESTAMP,
+				revoked_at TIMESTAMP,
+				revoked_by INTEGER REFERENCES account(id),
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"batch_access_token_audit": `
+			CREATE TABLE IF NOT EXISTS batch_access_token_audit (
+				id SERIAL PRIMARY KEY,
+				token_id INTEGER NOT NULL REFERENCES batch_access_token(id),
+				batch_id INTEGER NOT NULL REFERENCES batch(id),
+				operation VARCHAR(50) NOT NULL,
+				outcome VARCHAR(20) NOT NULL,
+				account_id INTEGER REFERENCES account(id),
+				detail TEXT,
+				document_id INTEGER REFERENCES document(id),
+				event_id INTEGER REFERENCES event(id),
+				ip_address VARCHAR(64),
+				user_agent TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"document_request": `
+			CREATE TABLE IF NOT EXISTS document_request (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER NOT NULL REFERENCES batch(id),
+				company_id INTEGER REFERENCES company(id),
+				doc_type VARCHAR(100) NOT NULL,
+				message TEXT,
+				recipient_name VARCHAR(255) NOT NULL,
+				recipient_email VARCHAR(255) NOT NULL,
+				due_at TIMESTAMP NOT NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				token_id INTEGER REFERENCES batch_access_token(id),
+				document_id INTEGER REFERENCES document(id),
+				email_sent_at TIMESTAMP,
+				email_error TEXT,
+				requested_by INTEGER REFERENCES account(id),
+				fulfilled_at TIMESTAMP,
+				cancelled_at TIMESTAMP,
+				cancelled_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"runbook_run": `
+			CREATE TABLE IF NOT EXISTS runbook_run (
+				id SERIAL PRIMARY KEY,
+				operation VARCHAR(50) NOT NULL,
+				target VARCHAR(255) NOT NULL,
+				params JSONB NOT NULL DEFAULT '{}',
+				reason TEXT NOT NULL,
+				dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+				status VARCHAR(20) NOT NULL,
+				result JSONB,
+				error TEXT,
+				requested_by INTEGER REFERENCES account(id),
+				started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				finished_at TIMESTAMP
+			);
+		`,
+		"completeness_profile": `
+			CREATE TABLE IF NOT EXISTS completeness_profile (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER NOT NULL UNIQUE REFERENCES company(id),
+				required_documents TEXT[] NOT NULL DEFAULT '{}',
+				reading_interval_hours INTEGER NOT NULL DEFAULT 24,
+				stages JSONB NOT NULL DEFAULT '[]',
+				nudge_threshold INTEGER NOT NULL DEFAULT 80,
+				updated_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"completeness_nudge": `
+			CREATE TABLE IF NOT EXISTS completeness_nudge (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER NOT NULL REFERENCES batch(id),
+				shipment_id INTEGER REFERENCES shipment_transfer(id),
+				account_id INTEGER NOT NULL REFERENCES account(id),
+				score FLOAT NOT NULL,
+				threshold INTEGER NOT NULL,
+				missing JSONB,
+				status VARCHAR(20) NOT NULL,
+				error TEXT,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"verification_embed": `
+			CREATE TABLE IF NOT EXISTS verification_embed (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER NOT NULL REFERENCES batch(id),
+				company_id INTEGER REFERENCES company(id),
+				name VARCHAR(255) NOT NULL,
+				allowed_origins TEXT[] NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				last_viewed_at TIMESTAMP,
+				revoked_at TIMESTAMP,
+				revoked_by INTEGER REFERENCES account(id)
+			);
+		`,
+		"verification_embed_stat": `
+			CREATE TABLE IF NOT EXISTS verification_embed_stat (
+				id SERIAL PRIMARY KEY,
+				embed_id INTEGER NOT NULL REFERENCES verification_embed(id),
+				day DATE NOT NULL,
+				origin VARCHAR(255) NOT NULL,
+				views INTEGER NOT NULL DEFAULT 0,
+				rejected INTEGER NOT NULL DEFAULT 0,
+				UNIQUE (embed_id, day, origin)
+			);
+		`,
+		"nft_monitor_state": `
+			CREATE TABLE IF NOT EXISTS nft_monitor_state (
+				name VARCHAR(50) PRIMARY KEY,
+				last_updated_at TIMESTAMP,
+				last_nft_id INTEGER NOT NULL DEFAULT 0,
+				last_block BIGINT NOT NULL DEFAULT 0,
+				checked_at TIMESTAMP,
+				paused BOOLEAN NOT NULL DEFAULT false,
+				check_interval_seconds INTEGER,
+				updated_by INTEGER REFERENCES account(id),
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"account_nonce": `
+			CREATE TABLE IF NOT EXISTS account_nonce (
+				id SERIAL PRIMARY KEY,
+				chain VARCHAR(100) NOT NULL,
+				account VARCHAR(255) NOT NULL,
+				next_nonce BIGINT NOT NULL DEFAULT 0,
+				gaps BIGINT[] NOT NULL DEFAULT '{}',
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(chain, account)
+			);
+		`,
+		"document_access_policy": `
+			CREATE TABLE IF NOT EXISTS document_access_policy (
+				id SERIAL PRIMARY KEY,
+				sensitivity VARCHAR(20) NOT NULL,
+				roles TEXT[] NOT NULL DEFAULT '{}',
+				relationships TEXT[] NOT NULL DEFAULT '{}',
+				description TEXT,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"blockchain_node_probe": `
+			CREATE TABLE IF NOT EXISTS blockchain_node_probe (
+				id SERIAL PRIMARY KEY,
+				node_url TEXT NOT NULL,
+				status VARCHAR(20) NOT NULL,
+				latency_ms INTEGER,
+				block_height BIGINT,
+				catching_up BOOLEAN,
+				peer_count INTEGER,
+				error TEXT,
+				probed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"blockchain_node_event": `
+			CREATE TABLE IF NOT EXISTS blockchain_node_event (
+				id SERIAL PRIMARY KEY,
+				event_type VARCHAR(30) NOT NULL,
+				from_node TEXT,
+				to_node TEXT,
+				message TEXT,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"email_template": `
+			CREATE TABLE IF NOT EXISTS email_template (
+				id SERIAL PRIMARY KEY,
+				name VARCHAR(100) NOT NULL,
+				version INTEGER NOT NULL,
+				format VARCHAR(10) NOT NULL DEFAULT 'html',
+				subject TEXT NOT NULL DEFAULT '',
+				source TEXT NOT NULL DEFAULT '',
+				html TEXT NOT NULL DEFAULT '',
+				text TEXT NOT NULL DEFAULT '',
+				notes TEXT,
+				is_active BOOLEAN NOT NULL DEFAULT false,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				activated_at TIMESTAMP,
+				UNIQUE (name, version)
+			);
+		`,
+		"company_qr_branding": `
+			CREATE TABLE IF NOT EXISTS company_qr_branding (
+				company_id INTEGER PRIMARY KEY REFERENCES company(id),
+				error_correction VARCHAR(1) NOT NULL DEFAULT 'M',
+				foreground VARCHAR(7) NOT NULL DEFAULT '#000000',
+				background VARCHAR(7) NOT NULL DEFAULT '#FFFFFF',
+				logo BYTEA,
+				logo_content_type VARCHAR(50),
+				logo_scale NUMERIC(4, 2) NOT NULL DEFAULT 0.2,
+				updated_by INTEGER REFERENCES account(id),
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"environment_profile": `
+			CREATE TABLE IF NOT EXISTS environment_profile (
+				id SERIAL PRIMARY KEY,
+				species VARCHAR(100) NOT NULL,
+				stage VARCHAR(50) NOT NULL,
+				min_age INTEGER,
+				max_age INTEGER,
+				ranges JSONB NOT NULL DEFAULT '{}',
+				description TEXT,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"water_source": `
+			CREATE TABLE IF NOT EXISTS water_source (
+				id SERIAL PRIMARY KEY,
+				hatchery_id INTEGER REFERENCES hatchery(id),
+				name VARCHAR(255) NOT NULL,
+				source_type VARCHAR(50) NOT NULL,
+				location TEXT,
+				notes TEXT,
+				in_use_from TIMESTAMP NOT NULL,
+				in_use_to TIMESTAMP,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"water_treatment": `
+			CREATE TABLE IF NOT EXISTS water_treatment (
+				id SERIAL PRIMARY KEY,
+				source_id INTEGER REFERENCES water_source(id),
+				batch_id INTEGER REFERENCES batch(id),
+				step_type VARCHAR(50) NOT NULL,
+				sequence INTEGER NOT NULL DEFAULT 1,
+				details TEXT,
+				started_at TIMESTAMP NOT NULL,
+				ended_at TIMESTAMP,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				is_active BOOLEAN DEFAULT TRUE
+			);
+		`,
+		"energy_reading": `
+			CREATE TABLE IF NOT EXISTS energy_reading (
+				id SERIAL PRIMARY KEY,
+				hatchery_id INTEGER REFERENCES hatchery(id),
+				month DATE NOT NULL,
+				category VARCHAR(50) NOT NULL,
+				kwh NUMERIC(14,2) NOT NULL,
+				source VARCHAR(20) NOT NULL DEFAULT 'manual',
+				notes TEXT,
+				recorded_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"approval_policy": `
+			CREATE TABLE IF NOT EXISTS approval_policy (
+				id SERIAL PRIMARY KEY,
+				action_type VARCHAR(50) UNIQUE NOT NULL,
+				enabled BOOLEAN NOT NULL DEFAULT TRUE,
+				required_approvals INTEGER NOT NULL DEFAULT 1,
+				approver_role VARCHAR(20) NOT NULL DEFAULT 'admin',
+				expiry_hours INTEGER NOT NULL DEFAULT 72,
+				updated_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"approval_request": `
+			CREATE TABLE IF NOT EXISTS approval_request (
+				id SERIAL PRIMARY KEY,
+				action_type VARCHAR(50) NOT NULL,
+				company_id INTEGER REFERENCES company(id),
+				target_type VARCHAR(50),
+				target_id INTEGER,
+				summary TEXT NOT NULL,
+				payload JSONB NOT NULL DEFAULT '{}',
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				required_approvals INTEGER NOT NULL,
+				approver_role VARCHAR(20) NOT NULL,
+				requested_by INTEGER REFERENCES account(id),
+				result JSONB,
+				error TEXT,
+				expires_at TIMESTAMP NOT NULL,
+				decided_at TIMESTAMP,
+				executed_at TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"approval_decision": `
+			CREATE TABLE IF NOT EXISTS approval_decision (
+				id SERIAL PRIMARY KEY,
+				request_id INTEGER NOT NULL REFERENCES approval_request(id),
+				account_id INTEGER NOT NULL REFERENCES account(id),
+				decision VARCHAR(10) NOT NULL,
+				comment TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (request_id, account_id)
+			);
+		`,
+		"document_access_log": `
+			CREATE TABLE IF NOT EXISTS document_access_log (
+				id SERIAL PRIMARY KEY,
+				document_id INTEGER NOT NULL,
+				batch_id INTEGER,
+				account_id INTEGER,
+				role VARCHAR(50),
+				method VARCHAR(10) NOT NULL,
+				path TEXT NOT NULL,
+				ip_address VARCHAR(64),
+				allowed BOOLEAN NOT NULL,
+				accessed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"document_access_chain": `
+			CREATE TABLE IF NOT EXISTS document_access_chain (
+				id SERIAL PRIMARY KEY,
+				first_log_id INTEGER NOT NULL,
+				last_log_id INTEGER NOT NULL,
+				entry_count INTEGER NOT NULL,
+				period_start TIMESTAMP NOT NULL,
+				period_end TIMESTAMP NOT NULL,
+				prev_head VARCHAR(64) NOT NULL,
+				head_hash VARCHAR(64) NOT NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'sealed',
+				anchor_tx_id TEXT,
+				anchor_error TEXT,
+				anchored_at TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"production_plan": `
+			CREATE TABLE IF NOT EXISTS production_plan (
+				id SERIAL PRIMARY KEY,
+				hatchery_id INTEGER REFERENCES hatchery(id),
+				month DATE NOT NULL,
+				species VARCHAR(255) NOT NULL,
+				planned_batches INTEGER NOT NULL DEFAULT 0,
+				planned_quantity BIGINT NOT NULL DEFAULT 0,
+				notes TEXT,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"status_incident": `
+			CREATE TABLE IF NOT EXISTS status_incident (
+				id SERIAL PRIMARY KEY,
+				title VARCHAR(255) NOT NULL,
+				message TEXT,
+				status VARCHAR(20) NOT NULL DEFAULT 'investigating',
+				impact VARCHAR(20) NOT NULL DEFAULT 'minor',
+				components TEXT[] NOT NULL DEFAULT '{}',
+				started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				resolved_at TIMESTAMP,
+				created_by INTEGER REFERENCES account(id),
+				updated_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"company_residency_policy": `
+			CREATE TABLE IF NOT EXISTS company_residency_policy (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER NOT NULL UNIQUE REFERENCES company(id),
+				region VARCHAR(16) NOT NULL,
+				notes TEXT,
+				updated_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"organization": `
+			CREATE TABLE IF NOT EXISTS organization (
+				id SERIAL PRIMARY KEY,
+				parent_id INTEGER REFERENCES organization(id),
+				name VARCHAR(255) NOT NULL,
+				description TEXT,
+				head_company_id INTEGER REFERENCES company(id),
+				inheritance VARCHAR(20) NOT NULL DEFAULT 'none',
+				created_by INTEGER REFERENCES account(id),
+				updated_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"document_retention_policy": `
+			CREATE TABLE IF NOT EXISTS document_retention_policy (
+				id SERIAL PRIMARY KEY,
+				name VARCHAR(255) NOT NULL,
+				doc_type VARCHAR(100) NOT NULL UNIQUE,
+				retain_days INTEGER NOT NULL,
+				is_active BOOLEAN NOT NULL DEFAULT true,
+				created_by INTEGER REFERENCES account(id),
+				updated_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"document_destruction": `
+			CREATE TABLE IF NOT EXISTS document_destruction (
+				id SERIAL PRIMARY KEY,
+				document_id INTEGER NOT NULL REFERENCES document(id),
+				policy_id INTEGER REFERENCES document_retention_policy(id),
+				doc_type VARCHAR(100),
+				batch_id INTEGER,
+				company_id INTEGER,
+				record TEXT NOT NULL,
+				record_hash VARCHAR(64) NOT NULL,
+				signature TEXT NOT NULL,
+				status VARCHAR(20) NOT NULL,
+				anchor_tx_id VARCHAR(255),
+				anchor_error TEXT,
+				anchored_at TIMESTAMP,
+				destroyed_by INTEGER REFERENCES account(id),
+				destroyed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"partner_sla": `
+			CREATE TABLE IF NOT EXISTS partner_sla (
+				id SERIAL PRIMARY KEY,
+				supplier_company_id INTEGER NOT NULL REFERENCES company(id),
+				buyer_company_id INTEGER NOT NULL REFERENCES company(id),
+				name VARCHAR(255) NOT NULL,
+				metric VARCHAR(50) NOT NULL,
+				target_hours INTEGER NOT NULL,
+				doc_type VARCHAR(100),
+				is_active BOOLEAN NOT NULL DEFAULT true,
+				created_by INTEGER REFERENCES account(id),
+				updated_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"partner_sla_breach": `
+			CREATE TABLE IF NOT EXISTS partner_sla_breach (
+				id SERIAL PRIMARY KEY,
+				sla_id INTEGER NOT NULL REFERENCES partner_sla(id),
+				transfer_id INTEGER NOT NULL REFERENCES shipment_transfer(id),
+				due_at TIMESTAMP NOT NULL,
+				fulfilled_at TIMESTAMP,
+				detected_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (sla_id, transfer_id)
+			);
+		`,
+		"oauth_client": `
+			CREATE TABLE IF NOT EXISTS oauth_client (
+				id SERIAL PRIMARY KEY,
+				company_id INTEGER NOT NULL REFERENCES company(id),
+				client_id VARCHAR(64) UNIQUE NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				secret_prefix VARCHAR(20) NOT NULL,
+				secret_hash VARCHAR(64) NOT NULL,
+				scopes TEXT[] NOT NULL DEFAULT '{}',
+				last_token_at TIMESTAMP,
+				last_used_at TIMESTAMP,
+				revoked_at TIMESTAMP,
+				created_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"announcement": `
+			CREATE TABLE IF NOT EXISTS announcement (
+				id SERIAL PRIMARY KEY,
+				title VARCHAR(255) NOT NULL,
+				message TEXT,
+				severity VARCHAR(20) NOT NULL DEFAULT 'info',
+				audience VARCHAR(20) NOT NULL DEFAULT 'all',
+				starts_at TIMESTAMP NOT NULL,
+				ends_at TIMESTAMP NOT NULL,
+				maintenance_starts_at TIMESTAMP,
+				maintenance_ends_at TIMESTAMP,
+				created_by INTEGER REFERENCES account(id),
+				updated_by INTEGER REFERENCES account(id),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		"traceability_attestation": `
+			CREATE TABLE IF NOT EXISTS traceability_attestation (
+				id SERIAL PRIMARY KEY,
+				batch_id INTEGER NOT NULL REFERENCES batch(id),
+				company_id INTEGER REFERENCES company(id),
+				standard VARCHAR(100) NOT NULL,
+				record TEXT NOT NULL,
+				record_hash VARCHAR(64) NOT NULL,
+				signature TEXT NOT NULL,
+				status VARCHAR(20) NOT NULL,
+				anchor_tx_id VARCHAR(255),
+				anchor_error TEXT,
+				anchored_at TIMESTAMP,
+				requested_by INTEGER REFERENCES account(id),
+				issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+	}
+
+	// Table creation order to satisfy foreign key constraints
+	tableOrder := []string{
+		"company",
+		"account",
+		"api_logs",
+		"hatchery",
+		"batch",
+		"event",
+		"environment_data",
+		"document",
+		"certificates",
+		"blockchain_record",
+		"blockchain_nodes",
+		"shipment_transfer",
+		"transaction_nft",
+		"transaction_nft_history",
+		"company_compliance",
+		"analytics_data",
+		"identities",
+		"verifiable_claims",
+		"credential_logs",
+		"batch_nft",
+		"label_template",
+		"gs1_prefix",
+		"gs1_identifier",
+		"shipment",
+		"shipment_item",
+		"shipment_gps_ping",
+		"shipment_route_alert",
+		"shipment_geofence",
+		"shipment_geofence_alert",
+		"blockchain_record_resubmission",
+		"blockchain_fee",
+		"chain_budget",
+		"chain_budget_alert",
+		"shared_payload",
+		"shared_payload_key",
+		"interop_data_mapping",
+		"webhook_subscription",
+		"webhook_delivery",
+		"inbound_message",
+		"chain_registry",
+		"batch_share",
+		"environment_parameter",
+		"environment_alert",
+		"device",
+		"device_calibration",
+		"tank",
+		"tank_assignment",
+		"broodstock",
+		"batch_broodstock",
+		"broodstock_event",
+		"strain",
+		"accredited_lab",
+		"batch_claim",
+		"content_block",
+		"inspection_form",
+		"inspection_submission",
+		"inspection_photo",
+		"audit_access_grant",
+		"legal_hold",
+		"legal_hold_access_log",
+		"lims_token",
+		"lims_result",
+		"sample",
+		"sample_custody",
+		"derived_product",
+		"derived_product_source",
+		"batch_recall",
+		"processing_run",
+		"processing_input",
+		"processing_output",
+		"origin_dispute",
+		"origin_claim",
+		"origin_dispute_evidence",
+		"user_preference",
+		"permission_group",
+		"permission_group_scope",
+		"permission_group_member",
+		"api_usage_daily",
+		"subscription_plan",
+		"company_subscription",
+		"feature_flag",
+		"feature_flag_company",
+		"data_migration",
+		"data_migration_verification",
+		"batch_quantity_ledger",
+		"trace_snapshot",
+		"event_type_schema",
+		"event_import_job",
+		"batch_view",
+		"batch_view_default",
+		"warehouse_schema",
+		"warehouse_export_day",
+		"warehouse_export",
+		"event_bus_outbox",
+		"notification_connector",
+		"notification_message",
+		"digest_delivery",
+		"company_domain",
+		"signing_key",
+		"batch_ownership_transfer",
+		"transfer_commercial_terms",
+		"exchange_rate",
+		"document_translation",
+		"consumer_feedback",
+		"reference_entry",
+		"reference_sync_peer",
+		"tenant_snapshot_run",
+		"batch_access_token",
+		"batch_access_token_audit",
+		"document_request",
+		"runbook_run",
+		"completeness_profile",
+		"completeness_nudge",
+		"verification_embed",
+		"verification_embed_stat",
+		"nft_monitor_state",
+		"account_nonce",
+		"document_access_policy",
+		"blockchain_node_probe",
+		"blockchain_node_event",
+		"email_template",
+		"company_qr_branding",
+		"environment_profile",
+		"water_source",
+		"water_treatment",
+		"energy_reading",
+		"approval_policy",
+		"approval_request",
+		"approval_decision",
+		"document_access_log",
+		"document_access_chain",
+		"production_plan",
+		"status_incident",
+		"company_residency_policy",
+		"organization",
+		"document_retention_policy",
+		"document_destruction",
+		"partner_sla",
+		"partner_sla_breach",
+		"oauth_client",
+		"announcement",
+		"traceability_attestation",
+	}
+
+	for _, tableName := range tableOrder {
+		query := tableQueries[tableName]
+		if _, err := DB.Exec(query); err != nil {
+			return fmt.Errorf("failed to create table %s: %w", tableName, err)
+		}
+		fmt.Printf("Table %s created\n", tableName)
+	}
+
+	// Functions generating the region-aware IDs the migrations use as defaults
+	if err := createRegionFunctions(); err != nil {
+		return fmt.Errorf("failed to create region functions: %w", err)
+	}
+
+	// Bring tables created by earlier versions up to date
+	if err := migrateTables(); err != nil {
+		return fmt.Errorf("failed to migrate tables: %w", err)
+	}
+
+	// Seed the environment parameter catalog
+	if err := seedEnvironmentParameters(); err != nil {
+		return fmt.Errorf("failed to seed environment parameters: %w", err)
+	}
+
+	// Seed the reference profiles of common species and stages
+	if err := seedEnvironmentProfiles(); err != nil {
+		return fmt.Errorf("failed to seed environment profiles: %w", err)
+	}
+
+	// Seed the standard subscription plans
+	if err := seedSubscriptionPlans(); err != nil {
+		return fmt.Errorf("failed to seed subscription plans: %w", err)
+	}
+
+	// Seed the feature flags of gated capabilities
+	if err := seedFeatureFlags(); err != nil {
+		return fmt.Errorf("failed to seed feature flags: %w", err)
+	}
+
+	// Seed the approval policies of sensitive actions
+	if err := seedApprovalPolicies(); err != nil {
+		return fmt.Errorf("failed to seed approval policies: %w", err)
+	}
+
+	// Seed the metadata schemas of built-in event types
+	if err := seedEventTypeSchemas(); err != nil {
+		return fmt.Errorf("failed to seed event type schemas: %w", err)
+	}
+
+	// Trigram indexes behind search suggestions; suggestions still work without them, only slower
+	if err := createSearchIndexes(); err != nil {
+		fmt.Printf("Warning: Failed to create search indexes: %v\n", err)
+	}
+
+	// Create triggers after all tables have been created
+	if err := createTriggers(); err != nil {
+		return fmt.Errorf("failed to create triggers: %w", err)
+	}
+
+	return nil
+}
+
+// migrateTables adds columns introduced after a table was first created
+func migrateTables() error {
+	migrations := []string{
+		`ALTER TABLE blockchain_record ADD COLUMN IF NOT EXISTS chain_type VARCHAR(50)`,
+		`ALTER TABLE blockchain_record ADD COLUMN IF NOT EXISTS block_number BIGINT`,
+		`ALTER TABLE blockchain_record ADD COLUMN IF NOT EXISTS confirmations BIGINT DEFAULT 0`,
+		`ALTER TABLE blockchain_record ADD COLUMN IF NOT EXISTS confirmation_status VARCHAR(20) DEFAULT 'pending'`,
+		`ALTER TABLE blockchain_record ADD COLUMN IF NOT EXISTS confirmed_at TIMESTAMP`,
+		`ALTER TABLE blockchain_record ADD COLUMN IF NOT EXISTS finalized_at TIMESTAMP`,
+		`ALTER TABLE blockchain_record ADD COLUMN IF NOT EXISTS resubmit_count INTEGER DEFAULT 0`,
+		`ALTER TABLE blockchain_record ADD COLUMN IF NOT EXISTS last_checked_at TIMESTAMP`,
+		`ALTER TABLE environment_data ADD COLUMN IF NOT EXISTS custom_parameters JSONB DEFAULT '{}'`,
+		`ALTER TABLE environment_data ADD COLUMN IF NOT EXISTS device_id INTEGER REFERENCES device(id)`,
+		`ALTER TABLE environment_data ADD COLUMN IF NOT EXISTS low_confidence BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE environment_data ADD COLUMN IF NOT EXISTS quality_score FLOAT`,
+		`ALTER TABLE environment_data ADD COLUMN IF NOT EXISTS quality_flags TEXT[] DEFAULT '{}'`,
+		`ALTER TABLE environment_data ADD COLUMN IF NOT EXISTS suppressed BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE document ADD COLUMN IF NOT EXISTS device_id INTEGER REFERENCES device(id)`,
+		`ALTER TABLE document ADD COLUMN IF NOT EXISTS broodstock_id INTEGER REFERENCES broodstock(id)`,
+		`ALTER TABLE batch ADD COLUMN IF NOT EXISTS strain_id INTEGER REFERENCES strain(id)`,
+		`ALTER TABLE certificates ADD COLUMN IF NOT EXISTS accredited_lab_id INTEGER REFERENCES accredited_lab(id)`,
+		`ALTER TABLE lims_result ADD COLUMN IF NOT EXISTS sample_id INTEGER REFERENCES sample(id)`,
+		`ALTER TABLE event ADD COLUMN IF NOT EXISTS supersedes_event_id INTEGER REFERENCES event(id)`,
+		`ALTER TABLE event ADD COLUMN IF NOT EXISTS superseded_by_event_id INTEGER REFERENCES event(id)`,
+		`ALTER TABLE event ADD COLUMN IF NOT EXISTS correction_reason TEXT`,
+		`ALTER TABLE event ADD COLUMN IF NOT EXISTS corrected_at TIMESTAMP`,
+		`ALTER TABLE user_preference ADD COLUMN IF NOT EXISTS digest_frequency VARCHAR(10)`,
+		`ALTER TABLE webhook_subscription ADD COLUMN IF NOT EXISTS verification_status VARCHAR(20) DEFAULT 'pending'`,
+		`ALTER TABLE webhook_subscription ADD COLUMN IF NOT EXISTS verification_method VARCHAR(20)`,
+		`ALTER TABLE webhook_subscription ADD COLUMN IF NOT EXISTS verification_token VARCHAR(64)`,
+		`ALTER TABLE webhook_subscription ADD COLUMN IF NOT EXISTS verification_error TEXT`,
+		`ALTER TABLE webhook_subscription ADD COLUMN IF NOT EXISTS verified_at TIMESTAMP`,
+		`ALTER TABLE signing_key ADD COLUMN IF NOT EXISTS purpose VARCHAR(20) NOT NULL DEFAULT 'payload'`,
+		`ALTER TABLE batch ADD COLUMN IF NOT EXISTS owner_company_id INTEGER REFERENCES company(id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_batch_ownership_transfer_pending ON batch_ownership_transfer (batch_id) WHERE status = 'pending'`,
+		`ALTER TABLE company ADD COLUMN IF NOT EXISTS base_currency VARCHAR(3)`,
+		`ALTER TABLE document ADD COLUMN IF NOT EXISTS language VARCHAR(20)`,
+		`ALTER TABLE document ADD COLUMN IF NOT EXISTS translation_of INTEGER REFERENCES document(id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_document_translation_open ON document_translation (document_id, target_language) WHERE status NOT IN ('cancelled', 'failed')`,
+		`CREATE INDEX IF NOT EXISTS idx_consumer_feedback_company ON consumer_feedback (company_id, status, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_consumer_feedback_client ON consumer_feedback (batch_id, client_hash, created_at)`,
+		`ALTER TABLE company ADD COLUMN IF NOT EXISTS global_id VARCHAR(48) DEFAULT region_ulid()`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_company_global_id ON company (global_id)`,
+		`ALTER TABLE hatchery ADD COLUMN IF NOT EXISTS global_id VARCHAR(48) DEFAULT region_ulid()`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_hatchery_global_id ON hatchery (global_id)`,
+		`ALTER TABLE batch ADD COLUMN IF NOT EXISTS global_id VARCHAR(48) DEFAULT region_ulid()`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_batch_global_id ON batch (global_id)`,
+		`ALTER TABLE event ADD COLUMN IF NOT EXISTS global_id VARCHAR(48) DEFAULT region_ulid()`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_event_global_id ON event (global_id)`,
+		`ALTER TABLE document ADD COLUMN IF NOT EXISTS global_id VARCHAR(48) DEFAULT region_ulid()`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_document_global_id ON document (global_id)`,
+		`ALTER TABLE shipment_transfer ADD COLUMN IF NOT EXISTS global_id VARCHAR(48) DEFAULT region_ulid()`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_shipment_transfer_global_id ON shipment_transfer (global_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_reference_entry_seq ON reference_entry (seq)`,
+		`CREATE INDEX IF NOT EXISTS idx_tenant_snapshot_run_created ON tenant_snapshot_run (created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_batch_access_token_batch ON batch_access_token (batch_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_batch_access_token_audit_token ON batch_access_token_audit (token_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_request_batch ON document_request (batch_id, status)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_request_token ON document_request (token_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_runbook_run_started ON runbook_run (started_at)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_runbook_run_running ON runbook_run (operation, target) WHERE status = 'running'`,
+		`CREATE INDEX IF NOT EXISTS idx_completeness_nudge_batch ON completeness_nudge (batch_id, account_id, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_verification_embed_batch ON verification_embed (batch_id, created_at DESC)`,
+		documentSensitivityMigration(),
+		`CREATE INDEX IF NOT EXISTS idx_blockchain_node_probe_node ON blockchain_node_probe (node_url, probed_at DESC)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_environment_profile_stage ON environment_profile (LOWER(species), LOWER(stage)) WHERE is_active = true`,
+		`ALTER TABLE environment_alert ADD COLUMN IF NOT EXISTS profile_id INTEGER REFERENCES environment_profile(id)`,
+		`CREATE INDEX IF NOT EXISTS idx_water_source_hatchery ON water_source (hatchery_id, in_use_from)`,
+		`CREATE INDEX IF NOT EXISTS idx_water_treatment_source ON water_treatment (source_id, started_at)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_energy_reading_month ON energy_reading (hatchery_id, month, category)`,
+		`CREATE INDEX IF NOT EXISTS idx_approval_request_status ON approval_request (status, action_type, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_approval_request_target ON approval_request (action_type, target_type, target_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_access_log_document ON document_access_log (document_id, accessed_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_access_log_accessed ON document_access_log (accessed_at)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_document_access_chain_last ON document_access_chain (last_log_id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_production_plan_month ON production_plan (hatchery_id, month, LOWER(species))`,
+		`ALTER TABLE shipment_transfer ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP`,
+		`UPDATE shipment_transfer SET completed_at = updated_at WHERE status = 'completed' AND completed_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_status_incident_started ON status_incident (started_at)`,
+		`ALTER TABLE document ADD COLUMN IF NOT EXISTS storage_region VARCHAR(16)`,
+		`ALTER TABLE document ADD COLUMN IF NOT EXISTS storage_backend VARCHAR(20)`,
+		`ALTER TABLE document ADD COLUMN IF NOT EXISTS region_locked BOOLEAN NOT NULL DEFAULT false`,
+		`ALTER TABLE company ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organization(id)`,
+		`CREATE INDEX IF NOT EXISTS idx_company_organization ON company(organization_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_organization_parent ON organization(parent_id)`,
+		`ALTER TABLE document ADD COLUMN IF NOT EXISTS purged_at TIMESTAMP`,
+		`CREATE INDEX IF NOT EXISTS idx_document_destruction_destroyed ON document_destruction(destroyed_at)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_document_destruction_document ON document_destruction(document_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_partner_sla_supplier ON partner_sla(supplier_company_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_partner_sla_buyer ON partner_sla(buyer_company_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_oauth_client_company ON oauth_client(company_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_announcement_window ON announcement(starts_at, ends_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_traceability_attestation_batch ON traceability_attestation(batch_id, issued_at)`,
+	}
+
+	for _, query := range migrations {
+		if _, err := DB.Exec(query); err != nil {
+			return fmt.Errorf("failed to run migration %q: %w", query, err)
+		}
+	}
+
+	return nil
+}
+
+// CommercialDocumentTypes are the doc_type fragments of documents holding commercial terms,
+// which are classified confidential unless the uploader says otherwise
+var CommercialDocumentTypes = []string{"invoice", "contract", "price", "commercial", "payment"}
+
+// documentSensitivityMigration adds the sensitivity column and classifies the existing commercial documents
+// the same way new uploads are. The backfill only runs together with the column, so later reclassifications survive restarts
+func documentSensitivityMigration() string {
+	return `DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'document' AND column_name = 'sensitivity') THEN
+				ALTER TABLE document ADD COLUMN sensitivity VARCHAR(20) NOT NULL DEFAULT 'public';
+				UPDATE document SET sensitivity = 'confidential' WHERE doc_type ~* '` + strings.Join(CommercialDocumentTypes, "|") + `';
+			END IF;
+		END $$`
+}
+
+// createSearchIndexes adds the trigram indexes used by search suggestions
+// The pg_trgm extension needs a role allowed to create extensions
+func createSearchIndexes() error {
+	queries := []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`CREATE INDEX IF NOT EXISTS idx_company_name_trgm ON company USING gin (LOWER(name) gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_file_name_trgm ON document USING gin (LOWER(file_name) gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_identities_did_trgm ON identities USING gin (LOWER(did) gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_identities_entity_name_trgm ON identities USING gin (LOWER(entity_name) gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_batch_species_trgm ON batch USING gin (LOWER(species) gin_trgm_ops)`,
+	}
+
+	for _, query := range queries {
+		if _, err := DB.Exec(query); err != nil {
+			return fmt.Errorf("failed to run %q: %w", query, err)
+		}
+	}
+
+	return nil
+}
+
+// seedEnvironmentParameters adds the standard water quality parameters to the catalog
+// Parameters already in the catalog keep the ranges set by operators
+func seedEnvironmentParameters() error {
+	_, err := DB.Exec(`
+		INSERT INTO environment_parameter (code, name, unit, data_type, min_value, max_value, alert_min, alert_max, description, is_builtin)
+		VALUES
+			('temperature', 'Temperature', '°C', 'number', -5, 50, 26, 32, 'Water temperature', true),
+			('ph', 'pH', '', 'number', 0, 14, 7.5, 8.5, 'Water pH', true),
+			('salinity', 'Salinity', 'ppt', 'number', 0, 60, 15, 35, 'Water salinity', true),
+			('density', 'Density', 'larvae/L', 'number', 0, NULL, NULL, NULL, 'Stocking density', true),
+			('age', 'Age', 'days', 'integer', 0, 365, NULL, NULL, 'Larvae age', true),
+			('dissolved_oxygen', 'Dissolved oxygen', 'mg/L', 'number', 0, 20, 5, NULL, 'Dissolved oxygen concentration', false),
+			('ammonia', 'Ammonia', 'mg/L', 'number', 0, 10, NULL, 0.1, 'Total ammonia nitrogen', false),
+			('nitrite', 'Nitrite', 'mg/L', 'number', 0, 10, NULL, 0.5, 'Nitrite nitrogen', false),
+			('alkalinity', 'Alkalinity', 'mg/L CaCO3', 'number', 0, 500, 80, 200, 'Total alkalinity', false)
+		ON CONFLICT (code) DO NOTHING
+	`)
+	return err
+}
+
+// seedEnvironmentProfiles adds reference profiles of whiteleg shrimp post-larvae
+// Profiles are only seeded into an empty table, so operators can change or remove them
+func seedEnvironmentProfiles() error {
+	_, err := DB.Exec(`
+		INSERT INTO environment_profile (species, stage, min_age, max_age, ranges, description)
+		SELECT species, stage, min_age, max_age, ranges::jsonb, description
+		FROM (VALUES
+			('P. vannamei', 'PL5', 1, 8,
+				'{"temperature": {"min": 28, "max": 31}, "ph": {"min": 7.8, "max": 8.3}, "salinity": {"min": 25, "max": 32}, "dissolved_oxygen": {"min": 5}}',
+				'Early post-larvae, before salinity acclimation'),
+			('P. vannamei', 'PL12', 9, 20,
+				'{"temperature": {"min": 27, "max": 31}, "ph": {"min": 7.8, "max": 8.4}, "salinity": {"min": 15, "max": 30}, "dissolved_oxygen": {"min": 5}}',
+				'Post-larvae ready for transfer to grow-out ponds')
+		) AS seed (species, stage, min_age, max_age, ranges, description)
+		WHERE NOT EXISTS (SELECT 1 FROM environment_profile)
+	`)
+	return err
+}
+
+// seedSubscriptionPlans adds the standard plan tiers; limits left NULL are unlimited
+// Plans already in the catalog keep the limits set by operators
+func seedSubscriptionPlans() error {
+	_, err := DB.Exec(`
+		INSERT INTO subscription_plan (code, name, description, max_batches_per_month, max_storage_mb, interop_enabled, overage_action)
+		VALUES
+			('free', 'Free', 'Single hatchery trial', 10, 500, false, 'block'),
+			('standard', 'Standard', 'Hatcheries selling to domestic buyers', 200, 20480, false, 'block'),
+			('professional', 'Professional', 'Exporters sharing batches with partner chains', 1000, 102400, true, 'warn'),
+			('enterprise', 'Enterprise', 'Unlimited usage under contract', NULL, NULL, true, 'warn')
+		ON CONFLICT (code) DO NOTHING
+	`)
+	return err
+}
+
+// seedFeatureFlags adds the flags of gated capabilities; capabilities that already shipped start enabled
+// Flags already in the catalog keep the rollout set by operators
+func seedFeatureFlags() error {
+	_, err := DB.Exec(`
+		INSERT INTO feature_flag (key, description, enabled, rollout_percent)
+		VALUES
+			('nft_tokenization', 'Tokenize batches and transactions as NFTs', true, 100),
+			('interop_sharing', 'Share batches with external chains', true, 100),
+			('qr_compact_link', 'Encode blockchain QR codes as a short verification link instead of JSON', false, 0)
+		ON CONFLICT (key) DO NOTHING
+	`)
+	return err
+}
+
+// seedApprovalPolicies makes the sensitive actions need a second person's approval
+// Policies already in the catalog keep the settings of operators
+func seedApprovalPolicies() error {
+	_, err := DB.Exec(`
+		INSERT INTO approval_policy (action_type, enabled, required_approvals, approver_role, expiry_hours)
+		VALUES
+			('batch_recall', true, 1, 'admin', 24),
+			('ownership_transfer', true, 1, 'company', 72),
+			('tenant_export', true, 1, 'admin', 72)
+		ON CONFLICT (action_type) DO NOTHING
+	`)
+	return err
+}
+
+// logisticsEventSchema is the metadata schema shared by the movement event types
+const logisticsEventSchema = `{
+	"type": "object",
+	"required": ["to_location"],
+	"properties": {
+		"from_location": {"type": "string", "description": "Where the batch left from; defaults to the event location"},
+		"to_location": {"type": "string", "minLength": 1, "description": "Where the batch is going"},
+		"transporter_name": {"type": "string"},
+		"departure_time": {"type": "string", "format": "date-time"},
+		"arrival_time": {"type": "string", "format": "date-time"},
+		"status": {"type": "string", "description": "Transfer status; defaults to completed"}
+	}
+}`
+
+// seedEventTypeSchemas adds the metadata schemas of the event types the API interprets
+// Schemas already in the registry keep the changes made by operators
+func seedEventTypeSchemas() error {
+	schemas := []struct {
+		eventType   string
+		description string
+		schema      string
+	}{
+		{"transfer", "Batch moved between facilities", logisticsEventSchema},
+		{"transport", "Batch in transport", logisticsEventSchema},
+		{"shipping", "Batch shipped to a customer", logisticsEventSchema},
+		{"receiving", "Batch received at a facility", `{
+	"type": "object",
+	"required": ["from_location"],
+	"properties": {
+		"from_location": {"type": "string", "minLength": 1, "description": "Where the batch came from"},
+		"to_location": {"type": "string", "description": "Where the batch was received; defaults to the event location"},
+		"transporter_name": {"type": "string"},
+		"arrival_time": {"type": "string", "format": "date-time"},
+		"status": {"type": "string", "description": "Transfer status; defaults to completed"}
+	}
+}`},
+		{"status_change", "Batch status changed", `{
+	"type": "object",
+	"required": ["new_status"],
+	"properties": {
+		"new_status": {"type": "string", "minLength": 1, "description": "Status the batch is moved to"},
+		"reason": {"type": "string"}
+	}
+}`},
+		{"stage_change", "Larvae reached a new larval stage", `{
+	"type": "object",
+	"required": ["stage"],
+	"properties": {
+		"stage": {"type": "string", "pattern": "(?i)^\\s*(nauplius|nauplii|zoea|mysis|postlarvae?|pl|n|z|m)[\\s_-]*\\d*\\s*$", "description": "Larval stage, e.g. N3, Z2, M1 or PL12"},
+		"notes": {"type": "string"}
+	}
+}`},
+	}
+
+	for _, s := range schemas {
+		_, err := DB.Exec(`
+			INSERT INTO event_type_schema (event_type, description, schema)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (event_type) DO NOTHING
+		`, s.eventType, s.description, s.schema)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDocumentSensitivityMigrationBackfillsCommercialDocuments(t *testing.T) {
+	migration := documentSensitivityMigration()
+
+	// The backfill must only run in the same step that adds the column
+	addColumn := strings.Index(migration, "ADD COLUMN sensitivity")
+	backfill := strings.Index(migration, "UPDATE document SET sensitivity = 'confidential'")
+	if !strings.Contains(migration, "IF NOT EXISTS") || addColumn < 0 || backfill < addColumn {
+		t.Fatalf("backfill is not gated on adding the column:\n%s", migration)
+	}
+
+	// Postgres ~* matches case-insensitively anywhere in the value, like the upload classification
+	match := regexp.MustCompile(`doc_type ~\* '([^']+)'`).FindStringSubmatch(migration)
+	if match == nil {
+		t.Fatalf("no doc_type pattern in migration:\n%s", migration)
+	}
+	pattern := regexp.MustCompile("(?i)" + match[1])
+
+	cases := map[string]bool{
+		"Invoice":            true,
+		"sales_contract":     true,
+		"PRICE_LIST":         true,
+		"commercial_terms":   true,
+		"payment_receipt":    true,
+		"health_certificate": false,
+		"lab_report":         false,
+		"":                   false,
+	}
+	for docType, confidential := range cases {
+		if got := pattern.MatchString(docType); got != confidential {
+			t.Errorf("%q: expected confidential=%v, got %v", docType, confidential, got)
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package db
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -97,12 +100,63 @@ func LogNFTOperation(level NFTLogLevel, nftID int, tokenID, operation, message s
 	return logger.Log(entry)
 }
 
+// NFT monitor states
+const (
+	NFTMonitorRunning = "running"
+	NFTMonitorPaused  = "paused"
+	NFTMonitorStopped = "stopped" // StartMonitoring was not called
+)
+
+// nftMonitorPageSize is the number of NFTs checked before the checkpoint is saved
+const nftMonitorPageSize = 500
+
+// NFTMonitorCheckpoint is how far the monitor got; integrity checks resume after it
+type NFTMonitorCheckpoint struct {
+	LastUpdatedAt *time.Time `json:"last_updated_at,omitempty"` // updated_at of the last NFT checked
+	LastNFTID     int        `json:"last_nft_id"`
+	LastBlock     int64      `json:"last_block"` // Chain head when the last pass completed
+	CheckedAt     *time.Time `json:"checked_at,omitempty"`
+}
+
+// NFTMonitorStatus is the state of the monitor and how far it is behind
+type NFTMonitorStatus struct {
+	State                string               `json:"state"`
+	CheckIntervalSeconds int                  `json:"check_interval_seconds"`
+	Checkpoint           NFTMonitorCheckpoint `json:"checkpoint"`
+	HeadBlock            int64                `json:"head_block,omitempty"`
+	LagBlocks            int64                `json:"lag_blocks"`
+	PendingNFTs          int                  `json:"pending_nfts"` // NFTs changed since the checkpoint
+	LastRunAt            *time.Time           `json:"last_run_at,omitempty"`
+	LastRunDuration      string               `json:"last_run_duration,omitempty"`
+	LastError            string               `json:"last_error,omitempty"`
+	UpdatedBy            *int                 `json:"updated_by,omitempty"`
+	UpdatedAt            *time.Time           `json:"updated_at,omitempty"`
+}
+
 // NFTMonitor represents the monitoring system for NFT operations
 type NFTMonitor struct {
 	AlertThreshold int
 	CheckInterval  time.Duration
+	// LatestBlock returns the chain head recorded with each checkpoint, nil without a chain
+	LatestBlock func() (int64, error)
+
+	mu          sync.Mutex
+	started     bool
+	paused      bool
+	wake        chan struct{}
+	checkpoint  NFTMonitorCheckpoint
+	lastRunAt   *time.Time
+	lastRunTook time.Duration
+	lastError   string
+	updatedBy   *int
+	updatedAt   *time.Time
 }
 
+var (
+	defaultNFTMonitor *NFTMonitor
+	nftMonitorOnce    sync.Once
+)
+
 // NewNFTMonitor creates a new NFT monitor
 func NewNFTMonitor() *NFTMonitor {
 	threshold := getEnvAsInt("ALERT_THRESHOLD", 5)
@@ -111,61 +165,291 @@ func NewNFTMonitor() *NFTMonitor {
 	return &NFTMonitor{
 		AlertThreshold: threshold,
 		CheckInterval:  interval,
+		wake:           make(chan struct{}, 1),
 	}
 }
 
-// StartMonitoring begins monitoring NFT operations
+// DefaultNFTMonitor returns the process wide NFT monitor
+func DefaultNFTMonitor() *NFTMonitor {
+	nftMonitorOnce.Do(func() {
+		defaultNFTMonitor = NewNFTMonitor()
+	})
+	return defaultNFTMonitor
+}
+
+// StartMonitoring begins monitoring NFT operations from the saved checkpoint
 func (m *NFTMonitor) StartMonitoring() {
+	if err := m.loadState(); err != nil {
+		LogNFTOperation(ERROR, 0, "", "monitor_checkpoint", "Failed to load monitor checkpoint, checking all NFTs", err, nil)
+	}
+	m.mu.Lock()
+	m.started = true
+	m.mu.Unlock()
+
 	go func() {
 		for {
-			// Check for data integrity issues
-			if err := m.checkDataIntegrity(); err != nil {
-				LogNFTOperation(ERROR, 0, "", "monitor_integrity", "Failed to check data integrity", err, nil)
-			}
+			m.mu.Lock()
+			paused, interval := m.paused, m.CheckInterval
+			m.mu.Unlock()
 
-			// Check for duplicate NFTs
-			if err := m.checkDuplicates(); err != nil {
-				LogNFTOperation(ERROR, 0, "", "monitor_duplicates", "Failed to check for duplicates", err, nil)
+			if !paused {
+				m.runOnce()
 			}
 
-			// Sleep for the check interval
-			time.Sleep(m.CheckInterval)
+			// Sleep for the check interval, or until an admin resumes the monitor or changes the interval
+			select {
+			case <-time.After(interval):
+			case <-m.wake:
+			}
 		}
 	}()
 }
 
-// checkDataIntegrity verifies the data integrity of NFTs
-func (m *NFTMonitor) checkDataIntegrity() error {
-	// Get active NFTs
-	rows, err := DB.Query(`
-		SELECT id, token_id FROM transaction_nft 
-		WHERE is_active = true
-	`)
+// runOnce runs a monitoring pass and records its outcome
+func (m *NFTMonitor) runOnce() {
+	started := time.Now()
+	var errs []string
+
+	var head int64
+	if m.LatestBlock != nil {
+		var err error
+		if head, err = m.LatestBlock(); err != nil {
+			LogNFTOperation(WARNING, 0, "", "monitor_head", "Failed to get the chain head", err, nil)
+		}
+	}
+
+	// Check for data integrity issues
+	if err := m.checkDataIntegrity(); err != nil {
+		LogNFTOperation(ERROR, 0, "", "monitor_integrity", "Failed to check data integrity", err, nil)
+		errs = append(errs, err.Error())
+	}
+
+	// Check for duplicate NFTs
+	if err := m.checkDuplicates(); err != nil {
+		LogNFTOperation(ERROR, 0, "", "monitor_duplicates", "Failed to check for duplicates", err, nil)
+		errs = append(errs, err.Error())
+	}
+
+	m.mu.Lock()
+	if len(errs) == 0 {
+		checkedAt := time.Now()
+		m.checkpoint.CheckedAt = &checkedAt
+		if head > 0 {
+			m.checkpoint.LastBlock = head
+		}
+	}
+	m.lastRunAt = &started
+	m.lastRunTook = time.Since(started)
+	m.lastError = strings.Join(errs, "; ")
+	m.mu.Unlock()
+
+	if len(errs) == 0 {
+		if err := m.saveState(); err != nil {
+			LogNFTOperation(ERROR, 0, "", "monitor_checkpoint", "Failed to save monitor checkpoint", err, nil)
+		}
+	}
+}
+
+// loadState restores the checkpoint, pause and interval saved by a previous process
+func (m *NFTMonitor) loadState() error {
+	if DB == nil {
+		return nil
+	}
+	var cp NFTMonitorCheckpoint
+	var lastUpdatedAt, checkedAt, updatedAt sql.NullTime
+	var paused bool
+	var intervalSeconds sql.NullInt64
+	var updatedBy sql.NullInt64
+	err := DB.QueryRow(`
+		SELECT last_updated_at, last_nft_id, last_block, checked_at, paused, check_interval_seconds, updated_by, updated_at
+		FROM nft_monitor_state WHERE name = 'nft'
+	`).Scan(&lastUpdatedAt, &cp.LastNFTID, &cp.LastBlock, &checkedAt, &paused, &intervalSeconds, &updatedBy, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to query NFTs: %w", err)
+		return err
+	}
+	if lastUpdatedAt.Valid {
+		cp.LastUpdatedAt = &lastUpdatedAt.Time
+	}
+	if checkedAt.Valid {
+		cp.CheckedAt = &checkedAt.Time
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpoint = cp
+	m.paused = paused
+	if intervalSeconds.Valid && intervalSeconds.Int64 > 0 {
+		m.CheckInterval = time.Duration(intervalSeconds.Int64) * time.Second
+	}
+	if updatedBy.Valid {
+		id := int(updatedBy.Int64)
+		m.updatedBy = &id
 	}
-	defer rows.Close()
+	if updatedAt.Valid {
+		m.updatedAt = &updatedAt.Time
+	}
+	return nil
+}
+
+// saveState persists the checkpoint, pause and interval so a restart resumes where the monitor stopped
+func (m *NFTMonitor) saveState() error {
+	if DB == nil {
+		return nil
+	}
+	m.mu.Lock()
+	cp, paused, interval, updatedBy := m.checkpoint, m.paused, m.CheckInterval, m.updatedBy
+	m.mu.Unlock()
+
+	_, err := DB.Exec(`
+		INSERT INTO nft_monitor_state (name, last_updated_at, last_nft_id, last_block, checked_at, paused, check_interval_seconds, updated_by, updated_at)
+		VALUES ('nft', $1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (name) DO UPDATE SET
+			last_updated_at = EXCLUDED.last_updated_at, last_nft_id = EXCLUDED.last_nft_id, last_block = EXCLUDED.last_block,
+			checked_at = EXCLUDED.checked_at, paused = EXCLUDED.paused, check_interval_seconds = EXCLUDED.check_interval_seconds,
+			updated_by = EXCLUDED.updated_by, updated_at = NOW()
+	`, cp.LastUpdatedAt, cp.LastNFTID, cp.LastBlock, cp.CheckedAt, paused, int(interval/time.Second), updatedBy)
+	return err
+}
+
+// Pause stops monitoring passes until Resume; the pause survives restarts
+func (m *NFTMonitor) Pause(userID int) error {
+	return m.update(userID, func() { m.paused = true })
+}
+
+// Resume continues monitoring from the checkpoint, starting a pass right away
+func (m *NFTMonitor) Resume(userID int) error {
+	return m.update(userID, func() { m.paused = false })
+}
+
+// SetCheckInterval changes the time between monitoring passes, taking effect immediately
+func (m *NFTMonitor) SetCheckInterval(interval time.Duration, userID int) error {
+	return m.update(userID, func() { m.CheckInterval = interval })
+}
+
+// update applies an admin change, persists it and wakes the monitor
+func (m *NFTMonitor) update(userID int, change func()) error {
+	m.mu.Lock()
+	change()
+	now := time.Now()
+	m.updatedAt = &now
+	m.updatedBy = nil
+	if userID > 0 {
+		m.updatedBy = &userID
+	}
+	m.mu.Unlock()
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return m.saveState()
+}
+
+// Status reports the state of the monitor, the chain head and how far the checkpoint is behind
+func (m *NFTMonitor) Status() (NFTMonitorStatus, error) {
+	m.mu.Lock()
+	status := NFTMonitorStatus{
+		State:                NFTMonitorRunning,
+		CheckIntervalSeconds: int(m.CheckInterval / time.Second),
+		Checkpoint:           m.checkpoint,
+		LastRunAt:            m.lastRunAt,
+		LastError:            m.lastError,
+		UpdatedBy:            m.updatedBy,
+		UpdatedAt:            m.updatedAt,
+	}
+	if m.lastRunTook > 0 {
+		status.LastRunDuration = m.lastRunTook.Round(time.Millisecond).String()
+	}
+	if m.paused {
+		status.State = NFTMonitorPaused
+	} else if !m.started {
+		status.State = NFTMonitorStopped
+	}
+	m.mu.Unlock()
 
-	for rows.Next() {
-		var id int
-		var tokenID string
-		if err := rows.Scan(&id, &tokenID); err != nil {
-			return fmt.Errorf("error scanning NFT row: %w", err)
+	if m.LatestBlock != nil {
+		if head, err := m.LatestBlock(); err == nil {
+			status.HeadBlock = head
+			if status.Checkpoint.LastBlock > 0 && head > status.Checkpoint.LastBlock {
+				status.LagBlocks = head - status.Checkpoint.LastBlock
+			}
 		}
+	}
+	if DB == nil {
+		return status, nil
+	}
+	err := DB.QueryRow(`
+		SELECT COUNT(*) FROM transaction_nft
+		WHERE is_active = true AND ($1::timestamp IS NULL OR (updated_at, id) > ($1, $2))
+	`, status.Checkpoint.LastUpdatedAt, status.Checkpoint.LastNFTID).Scan(&status.PendingNFTs)
+	return status, err
+}
+
+// checkDataIntegrity verifies the data integrity of NFTs changed since the checkpoint
+func (m *NFTMonitor) checkDataIntegrity() error {
+	for {
+		m.mu.Lock()
+		cp := m.checkpoint
+		m.mu.Unlock()
 
-		// Verify data integrity
-		valid, message, err := VerifyNFTDataIntegrity(id)
+		// Get active NFTs after the checkpoint
+		rows, err := DB.Query(`
+			SELECT id, token_id, updated_at FROM transaction_nft
+			WHERE is_active = true AND ($1::timestamp IS NULL OR (updated_at, id) > ($1, $2))
+			ORDER BY updated_at, id
+			LIMIT $3
+		`, cp.LastUpdatedAt, cp.LastNFTID, nftMonitorPageSize)
 		if err != nil {
-			LogNFTOperation(ERROR, id, tokenID, "integrity_check", "Error verifying data integrity", err, nil)
-			continue
+			return fmt.Errorf("failed to query NFTs: %w", err)
 		}
 
-		if !valid {
-			LogNFTOperation(WARNING, id, tokenID, "integrity_check", message, nil, nil)
+		type nftRow struct {
+			id        int
+			tokenID   string
+			updatedAt time.Time
+		}
+		var page []nftRow
+		for rows.Next() {
+			var r nftRow
+			if err := rows.Scan(&r.id, &r.tokenID, &r.updatedAt); err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning NFT row: %w", err)
+			}
+			page = append(page, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error reading NFT rows: %w", err)
 		}
-	}
 
-	return nil
+		for _, r := range page {
+			// Verify data integrity
+			valid, message, err := VerifyNFTDataIntegrity(r.id)
+			if err != nil {
+				LogNFTOperation(ERROR, r.id, r.tokenID, "integrity_check", "Error verifying data integrity", err, nil)
+			} else if !valid {
+				LogNFTOperation(WARNING, r.id, r.tokenID, "integrity_check", message, nil, nil)
+			}
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		last := page[len(page)-1]
+		m.mu.Lock()
+		m.checkpoint.LastUpdatedAt = &last.updatedAt
+		m.checkpoint.LastNFTID = last.id
+		m.mu.Unlock()
+		if err := m.saveState(); err != nil {
+			return fmt.Errorf("failed to save monitor checkpoint: %w", err)
+		}
+		if len(page) < nftMonitorPageSize {
+			return nil
+		}
+	}
 }
 
 // checkDuplicates checks for duplicate NFTs
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/faults"
+	"github.com/LTPPPP/TracePost-larvaeChain/region"
+	"github.com/LTPPPP/TracePost-larvaeChain/secrets"
+)
+
+// ReadDB is the read replica of this region, nil when reads go to the primary
+var ReadDB *sql.DB
+
+// NotHomeRegionError is returned when a write belongs to a record whose home is another region
+type NotHomeRegionError struct {
+	Home     string
+	Endpoint string // API base URL of the home region, when known
+}
+
+// Error describes where the write should go
+func (e *NotHomeRegionError) Error() string {
+	return fmt.Sprintf("record belongs to region %s", e.Home)
+}
+
+// Reader returns the connection for reads that tolerate replication lag: the local replica when there is one
+func Reader() *sql.DB {
+	if ReadDB != nil {
+		return ReadDB
+	}
+	return DB
+}
+
+// ForWrite returns the connection for a write to a record of a home region.
+// Records are only written in their home region; other regions get a NotHomeRegionError naming it
+func ForWrite(home string) (*sql.DB, error) {
+	regions := region.Default()
+	if home != "" && home != regions.Current {
+		return nil, &NotHomeRegionError{Home: home, Endpoint: regions.Endpoints[home]}
+	}
+	return DB, nil
+}
+
+// openReadReplica connects to the read replica named by DB_READ_HOST.
+// A replica that cannot be reached is skipped, so reads fall back to the primary
+func openReadReplica() {
+	host := getEnv("DB_READ_HOST", "")
+	if host == "" {
+		return
+	}
+	port := getEnv("DB_READ_PORT", "5432")
+	user := getEnv("DB_USER", "postgres")
+	password := getEnv("DB_PASSWORD", "postgres")
+	dbname := getEnv("DB_NAME", "tracepost")
+	sslmode := getEnv("DB_SSLMODE", "disable")
+	connStr := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=%s application_name=tracepost-larvae-api-read connect_timeout=10",
+		host, port, user, dbname, sslmode)
+
+	var replica *sql.DB
+	if secrets.IsReference(password) {
+		replica = sql.OpenDB(faults.Connector(&secretConnector{baseConnStr: connStr, passwordRef: password}))
+	} else {
+		connector, err := pq.NewConnector(connStr + " password='" + escapeConnValue(password) + "'")
+		if err != nil {
+			fmt.Printf("Warning: failed to open read replica: %v\n", err)
+			return
+		}
+		replica = sql.OpenDB(faults.Connector(connector))
+	}
+	replica.SetMaxOpenConns(getEnvAsInt("DB_MAX_CONNECTIONS", 20))
+	replica.SetMaxIdleConns(getEnvAsInt("DB_MAX_IDLE_CONNECTIONS", 5))
+	replica.SetConnMaxLifetime(time.Duration(getEnvAsInt("DB_CONNECTION_LIFETIME", 300)) * time.Second)
+	if err := replica.Ping(); err != nil {
+		fmt.Printf("Warning: read replica %s:%s unavailable, reading from the primary: %v\n", host, port, err)
+		replica.Close()
+		return
+	}
+	ReadDB = replica
+	fmt.Printf("Successfully connected to read replica at %s:%s\n", host, port)
+}
+
+// createRegionFunctions creates region_ulid(), the default of the global_id column of records,
+// which returns a ULID prefixed with the region of this database, e.g. vn1_01J9Z3M7XK8Q4W2YB5N6TDRF0C
+func createRegionFunctions() error {
+	code := region.Default().Current
+	if !region.Valid(code) {
+		return fmt.Errorf("invalid region code %q", code)
+	}
+	queries := []string{
+		// The region code is checked above, so it can be written into the function
+		`CREATE OR REPLACE FUNCTION tracepost_region() RETURNS TEXT AS $$ SELECT '` + code + `'::text $$ LANGUAGE sql IMMUTABLE`,
+		`CREATE OR REPLACE FUNCTION region_ulid() RETURNS TEXT AS $$
+		DECLARE
+			alphabet CONSTANT TEXT := '0123456789ABCDEFGHJKMNPQRSTVWXYZ';
+			millis BIGINT := FLOOR(EXTRACT(EPOCH FROM clock_timestamp()) * 1000);
+			ulid TEXT := '';
+		BEGIN
+			FOR i IN 1..10 LOOP
+				ulid := substr(alphabet, (millis % 32)::int + 1, 1) || ulid;
+				millis := millis / 32;
+			END LOOP;
+			FOR i IN 1..16 LOOP
+				ulid := ulid || substr(alphabet, FLOOR(random() * 32)::int + 1, 1);
+			END LOOP;
+			RETURN tracepost_region() || '_' || ulid;
+		END;
+		$$ LANGUAGE plpgsql VOLATILE`,
+	}
+	for _, query := range queries {
+		if _, err := DB.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
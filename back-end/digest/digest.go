@@ -0,0 +1,446 @@
+package digest
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/mailer"
+)
+
+// Digest frequencies a user can opt in to
+const (
+	FrequencyDaily  = "daily"
+	FrequencyWeekly = "weekly"
+)
+
+// Delivery statuses
+const (
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped" // nothing happened in the period
+)
+
+// listLimit is the number of items listed per section, the rest are counted
+const listLimit = 10
+
+// maxAttempts is the number of times a failed digest is retried within its period
+const maxAttempts = 3
+
+// IsFrequency reports whether a frequency is one users can opt in to
+func IsFrequency(frequency string) bool {
+	return frequency == FrequencyDaily || frequency == FrequencyWeekly
+}
+
+// Translator formats a localized message, e.g. the Translate method of the i18n middleware
+type Translator func(messageID, lang string, data map[string]interface{}) string
+
+// Sender delivers an email in the recipient's language
+type Sender func(to, lang, subject, body string) error
+
+// BatchItem is a batch created in the period
+type BatchItem struct {
+	ID       int    `json:"id"`
+	Species  string `json:"species"`
+	Quantity int    `json:"quantity"`
+	Hatchery string `json:"hatchery"`
+}
+
+// StatusChange is a batch status change recorded in the period
+type StatusChange struct {
+	BatchID   int       `json:"batch_id"`
+	OldStatus string    `json:"old_status,omitempty"`
+	NewStatus string    `json:"new_status"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// CertificateItem is a certificate expiring soon
+type CertificateItem struct {
+	ID              int       `json:"id"`
+	BatchID         *int      `json:"batch_id,omitempty"`
+	CertificateType string    `json:"certificate_type"`
+	ExpiryDate      time.Time `json:"expiry_date"`
+}
+
+// AlertItem is an alert raised in the period or still open
+type AlertItem struct {
+	Kind      string    `json:"kind"` // environment, geofence or route
+	Detail    string    `json:"detail"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Summary is the activity of a company over a digest period
+type Summary struct {
+	CompanyID            int               `json:"company_id"`
+	CompanyName          string            `json:"company_name"`
+	Frequency            string            `json:"frequency"`
+	PeriodStart          time.Time         `json:"period_start"`
+	PeriodEnd            time.Time         `json:"period_end"`
+	NewBatchCount        int               `json:"new_batch_count"`
+	NewBatches           []BatchItem       `json:"new_batches"`
+	StatusChangeCount    int               `json:"status_change_count"`
+	StatusChanges        []StatusChange    `json:"status_changes"`
+	CertificateWindow    int               `json:"certificate_window_days"`
+	ExpiringCertificates []CertificateItem `json:"expiring_certificates"`
+	OpenAlertCount       int               `json:"open_alert_count"`
+	OpenAlerts           []AlertItem       `json:"open_alerts"`
+}
+
+// Empty reports whether nothing happened in the period
+func (s Summary) Empty() bool {
+	return s.NewBatchCount == 0 && s.StatusChangeCount == 0 && len(s.ExpiringCertificates) == 0 && s.OpenAlertCount == 0
+}
+
+// Service sends daily and weekly digests to users who opted in
+type Service struct {
+	Interval              time.Duration
+	SendHour              int          // Hour of day, UTC, from which digests of the period just ended are sent
+	WeeklyDay             time.Weekday // Day weekly periods end on
+	CertificateWindowDays int
+	Translate             Translator
+	Send                  Sender
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates a digest service from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		Interval:              time.Duration(cfg.DigestIntervalSeconds) * time.Second,
+		SendHour:              cfg.DigestSendHour,
+		WeeklyDay:             parseWeekday(cfg.DigestWeeklyDay),
+		CertificateWindowDays: cfg.DigestCertificateWindowDays,
+		Send: func(to, lang, subject, body string) error {
+			return mailer.Default().SendText(to, mailer.TemplateDigest, lang, subject, body)
+		},
+	}
+}
+
+// Default returns the process wide digest service
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// parseWeekday reads an English weekday name, defaulting to Monday
+func parseWeekday(name string) time.Weekday {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), name) {
+			return day
+		}
+	}
+	return time.Monday
+}
+
+// Period returns the last complete period of a frequency before now, in UTC days
+func (s *Service) Period(frequency string, now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if frequency == FrequencyWeekly {
+		end = end.AddDate(0, 0, -((int(end.Weekday()) - int(s.WeeklyDay) + 7) % 7))
+		return end.AddDate(0, 0, -7), end
+	}
+	return end.AddDate(0, 0, -1), end
+}
+
+// Start sends due digests in the background
+func (s *Service) Start() {
+	go func() {
+		for {
+			time.Sleep(s.Interval)
+
+			if err := s.RunOnce(time.Now()); err != nil {
+				fmt.Printf("Warning: digest run failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// recipient is a user due a digest
+type recipient struct {
+	accountID int
+	email     string
+	name      string
+	companyID int
+	language  string
+}
+
+// RunOnce sends the digests of the periods that ended before now to every user who has not received them
+// Digests of periods without activity are not sent
+func (s *Service) RunOnce(now time.Time) error {
+	if db.DB == nil || now.UTC().Hour() < s.SendHour {
+		return nil
+	}
+
+	for _, frequency := range []string{FrequencyDaily, FrequencyWeekly} {
+		start, end := s.Period(frequency, now)
+		rows, err := db.DB.Query(`
+			SELECT a.id, a.email, COALESCE(NULLIF(a.full_name, ''), a.username), a.company_id, COALESCE(p.language, 'en')
+			FROM account a
+			JOIN user_preference p ON p.account_id = a.id
+			WHERE p.digest_frequency = $1 AND a.is_active = true AND a.company_id IS NOT NULL
+				AND NOT EXISTS (
+					SELECT 1 FROM digest_delivery d
+					WHERE d.account_id = a.id AND d.frequency = $1 AND d.period_start = $2::date
+						AND (d.status <> $3 OR d.attempts >= $4)
+				)
+			ORDER BY a.company_id, a.id
+		`, frequency, start.Format("2006-01-02"), StatusFailed, maxAttempts)
+		if err != nil {
+			return err
+		}
+		var recipients []recipient
+		for rows.Next() {
+			var r recipient
+			if err := rows.Scan(&r.accountID, &r.email, &r.name, &r.companyID, &r.language); err == nil {
+				recipients = append(recipients, r)
+			}
+		}
+		rows.Close()
+
+		summaries := map[int]Summary{}
+		for _, r := range recipients {
+			summary, ok := summaries[r.companyID]
+			if !ok {
+				if summary, err = s.Summarize(r.companyID, frequency, start, end); err != nil {
+					fmt.Printf("Warning: failed to summarize company %d for %s digest: %v\n", r.companyID, frequency, err)
+					continue
+				}
+				summaries[r.companyID] = summary
+			}
+
+			status, lastError := StatusSkipped, ""
+			if !summary.Empty() {
+				subject, body := s.Render(summary, r.name, r.language)
+				status = StatusSent
+				if err := s.Send(r.email, r.language, subject, body); err != nil {
+					status, lastError = StatusFailed, err.Error()
+				}
+			}
+			_, err := db.DB.Exec(`
+				INSERT INTO digest_delivery (account_id, company_id, frequency, period_start, period_end, status, attempts, last_error, created_at, sent_at)
+				VALUES ($1, $2, $3, $4::date, $5::date, $6::text, 1, NULLIF($7, ''), NOW(), CASE WHEN $6::text = 'sent' THEN NOW() END)
+				ON CONFLICT (account_id, frequency, period_start) DO UPDATE SET
+					status = EXCLUDED.status, attempts = digest_delivery.attempts + 1,
+					last_error = EXCLUDED.last_error, sent_at = EXCLUDED.sent_at
+			`, r.accountID, r.companyID, frequency, start.Format("2006-01-02"), end.Format("2006-01-02"), status, lastError)
+			if err != nil {
+				fmt.Printf("Warning: failed to record digest delivery for account %d: %v\n", r.accountID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Summarize collects the activity of a company between start and end
+func (s *Service) Summarize(companyID int, frequency string, start, end time.Time) (Summary, error) {
+	summary := Summary{
+		CompanyID:            companyID,
+		Frequency:            frequency,
+		PeriodStart:          start,
+		PeriodEnd:            end,
+		CertificateWindow:    s.CertificateWindowDays,
+		NewBatches:           []BatchItem{},
+		StatusChanges:        []StatusChange{},
+		ExpiringCertificates: []CertificateItem{},
+		OpenAlerts:           []AlertItem{},
+	}
+	if err := db.DB.QueryRow("SELECT name FROM company WHERE id = $1", companyID).Scan(&summary.CompanyName); err != nil {
+		return summary, err
+	}
+
+	err := db.DB.QueryRow(`
+		SELECT COUNT(*) FROM batch b JOIN hatchery h ON b.hatchery_id = h.id
+		WHERE h.company_id = $1 AND b.is_active = true AND b.created_at >= $2 AND b.created_at < $3
+	`, companyID, start, end).Scan(&summary.NewBatchCount)
+	if err != nil {
+		return summary, err
+	}
+	rows, err := db.DB.Query(`
+		SELECT b.id, b.species, b.quantity, h.name
+		FROM batch b JOIN hatchery h ON b.hatchery_id = h.id
+		WHERE h.company_id = $1 AND b.is_active = true AND b.created_at >= $2 AND b.created_at < $3
+		ORDER BY b.created_at, b.id
+		LIMIT $4
+	`, companyID, start, end, listLimit)
+	if err != nil {
+		return summary, err
+	}
+	for rows.Next() {
+		var item BatchItem
+		if err := rows.Scan(&item.ID, &item.Species, &item.Quantity, &item.Hatchery); err == nil {
+			summary.NewBatches = append(summary.NewBatches, item)
+		}
+	}
+	rows.Close()
+
+	// Status changes are recorded as status_changed events by the batch API and status_change events by clients
+	statusEvents := `
+		FROM event e JOIN batch b ON e.batch_id = b.id JOIN hatchery h ON b.hatchery_id = h.id
+		WHERE h.company_id = $1 AND e.is_active = true AND e.event_type IN ('status_change', 'status_changed')
+			AND e.timestamp >= $2 AND e.timestamp < $3`
+	if err := db.DB.QueryRow(`SELECT COUNT(*) `+statusEvents, companyID, start, end).Scan(&summary.StatusChangeCount); err != nil {
+		return summary, err
+	}
+	rows, err = db.DB.Query(`
+		SELECT e.batch_id, COALESCE(e.metadata->>'old_status', ''), COALESCE(e.metadata->>'new_status', ''), e.timestamp
+		`+statusEvents+`
+		ORDER BY e.timestamp, e.id
+		LIMIT $4
+	`, companyID, start, end, listLimit)
+	if err != nil {
+		return summary, err
+	}
+	for rows.Next() {
+		var item StatusChange
+		if err := rows.Scan(&item.BatchID, &item.OldStatus, &item.NewStatus, &item.ChangedAt); err == nil {
+			summary.StatusChanges = append(summary.StatusChanges, item)
+		}
+	}
+	rows.Close()
+
+	rows, err = db.DB.Query(`
+		SELECT c.id, c.batch_id, c.certificate_type, c.expiry_date
+		FROM certificates c
+		LEFT JOIN batch b ON c.batch_id = b.id
+		LEFT JOIN hatchery h ON b.hatchery_id = h.id
+		WHERE (c.company_id = $1 OR h.company_id = $1) AND c.is_active = true AND c.status <> 'revoked'
+			AND c.expiry_date >= $2 AND c.expiry_date < $2 + ($3 * INTERVAL '1 day')
+		ORDER BY c.expiry_date, c.id
+	`, companyID, end, s.CertificateWindowDays)
+	if err != nil {
+		return summary, err
+	}
+	for rows.Next() {
+		var item CertificateItem
+		var batchID sql.NullInt64
+		if err := rows.Scan(&item.ID, &batchID, &item.CertificateType, &item.ExpiryDate); err == nil {
+			if batchID.Valid {
+				id := int(batchID.Int64)
+				item.BatchID = &id
+			}
+			summary.ExpiringCertificates = append(summary.ExpiringCertificates, item)
+		}
+	}
+	rows.Close()
+
+	// Environment alerts raised in the period, and shipment alerts that are still open
+	alerts := `
+		SELECT 'environment', ea.parameter_code || ' ' || ea.direction || ' (' || ea.value || ') on batch #' || ea.batch_id, ea.created_at
+		FROM environment_alert ea JOIN batch b ON ea.batch_id = b.id JOIN hatchery h ON b.hatchery_id = h.id
+		WHERE h.company_id = $1 AND ea.created_at >= $2 AND ea.created_at < $3
+		UNION ALL
+		SELECT 'geofence', ga.alert_type || ' on shipment ' || s.shipment_code, ga.started_at
+		FROM shipment_geofence_alert ga JOIN shipment s ON ga.shipment_id = s.id
+		WHERE ga.ended_at IS NULL AND ga.started_at < $3
+			AND EXISTS (SELECT 1 FROM account a WHERE a.id IN (s.sender_id, s.receiver_id) AND a.company_id = $1)
+		UNION ALL
+		SELECT 'route', ra.alert_type || ' on shipment ' || s.shipment_code, ra.started_at
+		FROM shipment_route_alert ra JOIN shipment s ON ra.shipment_id = s.id
+		WHERE ra.ongoing = true AND ra.started_at < $3
+			AND EXISTS (SELECT 1 FROM account a WHERE a.id IN (s.sender_id, s.receiver_id) AND a.company_id = $1)`
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM (`+alerts+`) alerts`, companyID, start, end).Scan(&summary.OpenAlertCount); err != nil {
+		return summary, err
+	}
+	rows, err = db.DB.Query(`SELECT * FROM (`+alerts+`) alerts ORDER BY 3 DESC LIMIT $4`, companyID, start, end, listLimit)
+	if err != nil {
+		return summary, err
+	}
+	for rows.Next() {
+		var item AlertItem
+		if err := rows.Scan(&item.Kind, &item.Detail, &item.StartedAt); err == nil {
+			summary.OpenAlerts = append(summary.OpenAlerts, item)
+		}
+	}
+	rows.Close()
+
+	return summary, nil
+}
+
+// translate formats a message in a language, returning the message ID without a translator
+func (s *Service) translate(messageID, lang string, data map[string]interface{}) string {
+	if s.Translate == nil {
+		return messageID
+	}
+	return s.Translate(messageID, lang, data)
+}
+
+// Render formats the subject and plain text body of a digest in a user's language
+func (s *Service) Render(summary Summary, name, lang string) (string, string) {
+	from := summary.PeriodStart.Format("2006-01-02")
+	to := summary.PeriodEnd.AddDate(0, 0, -1).Format("2006-01-02")
+	subject := s.translate("digest_subject_"+summary.Frequency, lang, map[string]interface{}{
+		"Company": summary.CompanyName, "Date": from, "From": from, "To": to,
+	})
+
+	var body strings.Builder
+	line := func(text string) {
+		body.WriteString(text)
+		body.WriteString("\n")
+	}
+	more := func(listed, total int) {
+		if total > listed {
+			line("  " + s.translate("digest_more", lang, map[string]interface{}{"Count": total - listed}))
+		}
+	}
+
+	line(s.translate("digest_greeting", lang, map[string]interface{}{"Name": name}))
+	line("")
+	line(s.translate("digest_intro", lang, map[string]interface{}{"Company": summary.CompanyName, "From": from, "To": to}))
+
+	line("")
+	line(s.translate("digest_new_batches", lang, map[string]interface{}{"Count": summary.NewBatchCount}))
+	for _, batch := range summary.NewBatches {
+		line(fmt.Sprintf("  - #%d %s, %d (%s)", batch.ID, batch.Species, batch.Quantity, batch.Hatchery))
+	}
+	more(len(summary.NewBatches), summary.NewBatchCount)
+
+	line("")
+	line(s.translate("digest_status_changes", lang, map[string]interface{}{"Count": summary.StatusChangeCount}))
+	for _, change := range summary.StatusChanges {
+		if change.OldStatus != "" {
+			line(fmt.Sprintf("  - #%d %s -> %s", change.BatchID, change.OldStatus, change.NewStatus))
+		} else {
+			line(fmt.Sprintf("  - #%d -> %s", change.BatchID, change.NewStatus))
+		}
+	}
+	more(len(summary.StatusChanges), summary.StatusChangeCount)
+
+	line("")
+	line(s.translate("digest_certificate_expiries", lang, map[string]interface{}{
+		"Count": len(summary.ExpiringCertificates), "Days": summary.CertificateWindow,
+	}))
+	for i, certificate := range summary.ExpiringCertificates {
+		if i == listLimit {
+			more(listLimit, len(summary.ExpiringCertificates))
+			break
+		}
+		target := ""
+		if certificate.BatchID != nil {
+			target = fmt.Sprintf(" #%d", *certificate.BatchID)
+		}
+		line(fmt.Sprintf("  - %s%s: %s", certificate.CertificateType, target, certificate.ExpiryDate.Format("2006-01-02")))
+	}
+
+	line("")
+	line(s.translate("digest_open_alerts", lang, map[string]interface{}{"Count": summary.OpenAlertCount}))
+	for _, alert := range summary.OpenAlerts {
+		line(fmt.Sprintf("  - [%s] %s, %s", alert.Kind, alert.Detail, alert.StartedAt.UTC().Format("2006-01-02 15:04")))
+	}
+	more(len(summary.OpenAlerts), summary.OpenAlertCount)
+
+	line("")
+	line(s.translate("digest_footer", lang, map[string]interface{}{
+		"Frequency": s.translate("digest_frequency_"+summary.Frequency, lang, nil),
+	}))
+	return subject, body.String()
+}
@@ -0,0 +1,304 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Message brokers the bus can publish to
+const (
+	BackendNATS  = "nats"
+	BackendKafka = "kafka"
+)
+
+// Domain events published on the bus
+const (
+	BatchCreated         = "BatchCreated"
+	StatusChanged        = "StatusChanged"
+	DocumentUploaded     = "DocumentUploaded"
+	TransferCompleted    = "TransferCompleted"
+	OwnershipTransferred = "OwnershipTransferred"
+)
+
+// subjects are the topic or subject names of the domain events, below the configured prefix
+var subjects = map[string]string{
+	BatchCreated:         "batch.created",
+	StatusChanged:        "batch.status_changed",
+	DocumentUploaded:     "document.uploaded",
+	TransferCompleted:    "transfer.completed",
+	OwnershipTransferred: "batch.ownership_transferred",
+}
+
+// Outbox statuses
+const (
+	StatusPending   = "pending"
+	StatusPublished = "published"
+	StatusFailed    = "failed"
+)
+
+// Event is the envelope of a published domain event
+type Event struct {
+	ID         string                 `json:"id"` // Unique per event, for consumers to drop redeliveries
+	Type       string                 `json:"type"`
+	Source     string                 `json:"source"`
+	CompanyID  int                    `json:"company_id,omitempty"`
+	BatchID    int                    `json:"batch_id,omitempty"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// Publisher sends messages to a broker
+type Publisher interface {
+	Publish(subject, key string, payload []byte) error
+	Close() error
+	Backend() string
+}
+
+// Bus records domain events in an outbox and publishes them in order to the configured broker
+// Without a broker the bus is disabled and events are not recorded
+type Bus struct {
+	Publisher     Publisher
+	Prefix        string
+	MaxAttempts   int
+	RetryInterval time.Duration
+	BatchSize     int
+
+	wake chan struct{}
+}
+
+var (
+	defaultBus *Bus
+	once       sync.Once
+)
+
+// NewBus creates a bus from the application config
+func NewBus(cfg *config.Config) *Bus {
+	bus := &Bus{
+		Prefix:        strings.Trim(cfg.EventBusPrefix, "."),
+		MaxAttempts:   cfg.EventBusMaxAttempts,
+		RetryInterval: time.Duration(cfg.EventBusRetryIntervalSeconds) * time.Second,
+		BatchSize:     100,
+		wake:          make(chan struct{}, 1),
+	}
+	switch cfg.EventBusBackend {
+	case BackendNATS:
+		bus.Publisher = NewNATSPublisher(cfg.EventBusURL)
+	case BackendKafka:
+		bus.Publisher = NewKafkaRESTPublisher(cfg.EventBusURL)
+	}
+	return bus
+}
+
+// Default returns the process wide bus
+func Default() *Bus {
+	once.Do(func() {
+		defaultBus = NewBus(config.GetConfig())
+	})
+	return defaultBus
+}
+
+// Enabled reports whether a broker is configured
+func (b *Bus) Enabled() bool {
+	return b.Publisher != nil
+}
+
+// Subject returns the topic or subject an event type is published to
+func (b *Bus) Subject(eventType string) string {
+	subject := subjects[eventType]
+	if b.Prefix == "" {
+		return subject
+	}
+	return b.Prefix + "." + subject
+}
+
+// Publish records a domain event with the default bus
+func Publish(eventType string, companyID, batchID int, data map[string]interface{}) error {
+	return Default().Publish(eventType, companyID, batchID, data)
+}
+
+// Publish records a domain event in the outbox and wakes the publisher
+// It is called after the change is committed. A batch event without a company gets the company of the batch.
+// Events of a batch share a message key so brokers keep them in order
+func (b *Bus) Publish(eventType string, companyID, batchID int, data map[string]interface{}) error {
+	if db.DB == nil || !b.Enabled() {
+		return nil
+	}
+	if _, ok := subjects[eventType]; !ok {
+		return fmt.Errorf("unknown domain event %q", eventType)
+	}
+	if companyID == 0 && batchID != 0 {
+		db.DB.QueryRow(`
+			SELECT h.company_id FROM batch b INNER JOIN hatchery h ON b.hatchery_id = h.id WHERE b.id = $1
+		`, batchID).Scan(&companyID)
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	event := Event{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		Source:     "tracepost-larvaechain",
+		CompanyID:  companyID,
+		BatchID:    batchID,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode domain event: %w", err)
+	}
+	key := ""
+	if batchID != 0 {
+		key = strconv.Itoa(batchID)
+	}
+
+	_, err = db.DB.Exec(`
+		INSERT INTO event_bus_outbox (event_id, event_type, subject, message_key, payload, status, attempts, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5::jsonb, $6, 0, NOW(), NOW())
+	`, event.ID, eventType, b.Subject(eventType), key, string(payload), StatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to queue domain event: %w", err)
+	}
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start publishes queued events in the background
+func (b *Bus) Start() {
+	if !b.Enabled() {
+		return
+	}
+	go func() {
+		for {
+			if err := b.RunOnce(); err != nil {
+				fmt.Printf("Warning: event bus publish run failed: %v\n", err)
+			}
+
+			select {
+			case <-b.wake:
+			case <-time.After(b.RetryInterval):
+			}
+		}
+	}()
+}
+
+// RunOnce publishes due events in the order they were recorded
+// It stops at the first failure so later events of the same batch are not published ahead of it
+func (b *Bus) RunOnce() error {
+	if db.DB == nil || !b.Enabled() {
+		return nil
+	}
+
+	for {
+		rows, err := db.DB.Query(`
+			SELECT id, subject, COALESCE(message_key, ''), payload, attempts
+			FROM event_bus_outbox
+			WHERE status = $1 AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $2
+		`, StatusPending, b.BatchSize)
+		if err != nil {
+			return err
+		}
+		type message struct {
+			id       int
+			subject  string
+			key      string
+			payload  []byte
+			attempts int
+		}
+		var messages []message
+		for rows.Next() {
+			var m message
+			if err := rows.Scan(&m.id, &m.subject, &m.key, &m.payload, &m.attempts); err == nil {
+				messages = append(messages, m)
+			}
+		}
+		rows.Close()
+		if len(messages) == 0 {
+			return nil
+		}
+
+		for _, m := range messages {
+			if err := b.Publisher.Publish(m.subject, m.key, m.payload); err != nil {
+				status := StatusPending
+				if m.attempts+1 >= b.MaxAttempts {
+					status = StatusFailed
+				}
+				db.DB.Exec(`
+					UPDATE event_bus_outbox
+					SET status = $2, attempts = attempts + 1, last_error = $3,
+						next_attempt_at = NOW() + ($4 * POWER(2, LEAST(attempts, 10))) * INTERVAL '1 second'
+					WHERE id = $1
+				`, m.id, status, err.Error(), int(b.RetryInterval.Seconds()))
+				return fmt.Errorf("failed to publish to %s: %w", m.subject, err)
+			}
+			db.DB.Exec(`
+				UPDATE event_bus_outbox
+				SET status = $2, attempts = attempts + 1, last_error = NULL, published_at = NOW()
+				WHERE id = $1
+			`, m.id, StatusPublished)
+		}
+	}
+}
+
+// Stats counts outbox events by status
+type Stats struct {
+	Backend     string     `json:"backend"`
+	Enabled     bool       `json:"enabled"`
+	Pending     int        `json:"pending"`
+	Failed      int        `json:"failed"`
+	Published   int        `json:"published"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastPublish *time.Time `json:"last_published_at,omitempty"`
+}
+
+// GetStats reports the state of the outbox
+func (b *Bus) GetStats() (Stats, error) {
+	stats := Stats{Enabled: b.Enabled()}
+	if b.Enabled() {
+		stats.Backend = b.Publisher.Backend()
+	}
+	var lastPublish *time.Time
+	err := db.DB.QueryRow(`
+		SELECT
+			COUNT(*) FILTER (WHERE status = $1),
+			COUNT(*) FILTER (WHERE status = $2),
+			COUNT(*) FILTER (WHERE status = $3),
+			COALESCE((SELECT last_error FROM event_bus_outbox WHERE last_error IS NOT NULL ORDER BY id DESC LIMIT 1), ''),
+			MAX(published_at)
+		FROM event_bus_outbox
+	`, StatusPending, StatusFailed, StatusPublished).Scan(&stats.Pending, &stats.Failed, &stats.Published, &stats.LastError, &lastPublish)
+	stats.LastPublish = lastPublish
+	return stats, err
+}
+
+// RetryFailed queues failed events for another round of attempts and returns how many were queued
+func (b *Bus) RetryFailed() (int, error) {
+	result, err := db.DB.Exec(`
+		UPDATE event_bus_outbox SET status = $1, attempts = 0, next_attempt_at = NOW() WHERE status = $2
+	`, StatusPending, StatusFailed)
+	if err != nil {
+		return 0, err
+	}
+	count, _ := result.RowsAffected()
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return int(count), nil
+}
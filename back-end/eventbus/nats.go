@@ -0,0 +1,154 @@
+package eventbus
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSPublisher publishes messages to a NATS server with the core text protocol
+// Each publish is followed by a PING so that a message is only reported sent once the server processed it
+type NATSPublisher struct {
+	URL     string // nats://[user:pass@|token@]host:4222, or tls:// for TLS
+	Name    string
+	Timeout time.Duration
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewNATSPublisher creates a NATS publisher; it connects on the first publish
+func NewNATSPublisher(serverURL string) *NATSPublisher {
+	return &NATSPublisher{URL: serverURL, Name: "tracepost-larvaechain", Timeout: 10 * time.Second}
+}
+
+// Backend returns the backend name
+func (p *NATSPublisher) Backend() string {
+	return BackendNATS
+}
+
+// Publish sends a message to a subject; the key is not used by NATS
+func (p *NATSPublisher) Publish(subject, key string, payload []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+	p.conn.SetDeadline(time.Now().Add(p.Timeout))
+	if _, err := fmt.Fprintf(p.conn, "PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload); err != nil {
+		p.closeLocked()
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+	if err := p.awaitPong(); err != nil {
+		p.closeLocked()
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection
+func (p *NATSPublisher) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.closeLocked()
+}
+
+func (p *NATSPublisher) closeLocked() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	p.reader = nil
+	return err
+}
+
+// connect opens a connection, reads the server INFO and authenticates
+func (p *NATSPublisher) connect() error {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return fmt.Errorf("invalid NATS URL: %w", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	dialer := &net.Dialer{Timeout: p.Timeout}
+	var conn net.Conn
+	if u.Scheme == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(p.Timeout))
+	p.conn = conn
+	p.reader = bufio.NewReader(conn)
+
+	line, err := p.reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		p.closeLocked()
+		return fmt.Errorf("NATS server did not send INFO")
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     p.Name,
+		"lang":     "go",
+		"version":  "1.0",
+		"protocol": 1,
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			options["user"] = u.User.Username()
+			options["pass"] = password
+		} else {
+			options["auth_token"] = u.User.Username()
+		}
+	}
+	connect, _ := json.Marshal(options)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		p.closeLocked()
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	if err := p.awaitPong(); err != nil {
+		p.closeLocked()
+		return err
+	}
+	return nil
+}
+
+// awaitPong reads until the server answers a PING, answering the server's own PINGs
+func (p *NATSPublisher) awaitPong() error {
+	for {
+		line, err := p.reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read from NATS: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return fmt.Errorf("failed to answer NATS ping: %w", err)
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
@@ -0,0 +1,6 @@
+//go:build faults
+
+package faults
+
+// BuildEnabled reports whether the binary was built with the faults tag, which enables fault injection
+const BuildEnabled = true
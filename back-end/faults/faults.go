@@ -0,0 +1,305 @@
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+)
+
+// Targets faults are injected into
+const (
+	TargetDB         = "db"
+	TargetIPFS       = "ipfs"
+	TargetBlockchain = "blockchain"
+)
+
+// Targets lists the targets faults are injected into
+var Targets = []string{TargetDB, TargetIPFS, TargetBlockchain}
+
+// maxLatency bounds the latency a rule adds
+const maxLatency = time.Minute
+
+// ErrInjected is wrapped by every injected error
+var ErrInjected = errors.New("injected fault")
+
+// Fault is an error injected by a rule
+type Fault struct {
+	Target  string
+	RuleID  string
+	Message string
+}
+
+// Error describes the fault
+func (f *Fault) Error() string {
+	return fmt.Sprintf("%s: %s", f.Target, f.Message)
+}
+
+// Unwrap makes injected errors match ErrInjected
+func (f *Fault) Unwrap() error {
+	return ErrInjected
+}
+
+// Rule slows down or fails the calls to a target, of every request or of requests to one route
+type Rule struct {
+	ID        string    `json:"id"`
+	Target    string    `json:"target"`               // db, ipfs or blockchain
+	Route     string    `json:"route,omitempty"`      // e.g. "POST /api/v1/batches" or "/api/v1/batches/:batchId*"; empty for every call, background work included
+	LatencyMs int       `json:"latency_ms,omitempty"` // Latency added to each call
+	ErrorRate float64   `json:"error_rate,omitempty"` // Share of calls failed, from 0 to 1
+	Message   string    `json:"message,omitempty"`    // Error of failed calls
+	Times     int       `json:"times,omitempty"`      // Number of calls the rule applies to, 0 for every call
+	Applied   int       `json:"applied"`              // Calls slowed down or failed so far
+	Failed    int       `json:"failed"`               // Calls failed so far
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// exhausted reports whether the rule applied to all the calls it was meant to
+func (r *Rule) exhausted() bool {
+	return r.Times > 0 && r.Applied >= r.Times
+}
+
+// Injector holds the fault rules and applies them to calls
+type Injector struct {
+	enabled bool
+
+	mu     sync.Mutex
+	rules  []*Rule
+	active map[string]int // Requests in flight to the route of each route rule, by rule ID
+	nextID int
+	rand   *rand.Rand
+}
+
+var (
+	defaultInjector *Injector
+	once            sync.Once
+)
+
+// New creates an injector; a disabled one never injects anything
+func New(enabled bool) *Injector {
+	return &Injector{
+		enabled: enabled,
+		active:  map[string]int{},
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Default returns the process wide injector, enabled by the faults build tag or by FAULT_INJECTION_ENABLED
+// outside production
+func Default() *Injector {
+	once.Do(func() {
+		cfg := config.GetConfig()
+		enabled := BuildEnabled
+		if cfg.FaultInjectionEnabled {
+			if cfg.Environment == "production" {
+				fmt.Println("Warning: FAULT_INJECTION_ENABLED is ignored in production")
+			} else {
+				enabled = true
+			}
+		}
+		if enabled {
+			fmt.Println("Warning: fault injection is enabled, DB, IPFS and blockchain calls may be slowed down or failed on purpose")
+		}
+		defaultInjector = New(enabled)
+	})
+	return defaultInjector
+}
+
+// Enabled reports whether fault injection is enabled in this process
+func Enabled() bool {
+	return Default().Enabled()
+}
+
+// Inject applies the rules of a target to a call of the process wide injector
+func Inject(target string) error {
+	return Default().Inject(target)
+}
+
+// Enabled reports whether the injector injects faults
+func (i *Injector) Enabled() bool {
+	return i.enabled
+}
+
+// ValidTarget reports whether faults can be injected into a target
+func ValidTarget(target string) bool {
+	for _, t := range Targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds a rule and returns it with its ID
+func (i *Injector) Add(rule Rule) (Rule, error) {
+	if !i.enabled {
+		return Rule{}, errors.New("fault injection is disabled")
+	}
+	rule.Route = strings.TrimSpace(rule.Route)
+	switch {
+	case !ValidTarget(rule.Target):
+		return Rule{}, fmt.Errorf("target must be one of %s", strings.Join(Targets, ", "))
+	case rule.ErrorRate < 0 || rule.ErrorRate > 1:
+		return Rule{}, errors.New("error rate must be between 0 and 1")
+	case rule.LatencyMs < 0 || time.Duration(rule.LatencyMs)*time.Millisecond > maxLatency:
+		return Rule{}, fmt.Errorf("latency must be between 0 and %d ms", maxLatency.Milliseconds())
+	case rule.LatencyMs == 0 && rule.ErrorRate == 0:
+		return Rule{}, errors.New("a rule needs a latency or an error rate")
+	case rule.Times < 0:
+		return Rule{}, errors.New("times cannot be negative")
+	case rule.Route != "" && !validRoute(rule.Route):
+		return Rule{}, errors.New(`route must be a path, optionally preceded by a method, e.g. "POST /api/v1/batches"`)
+	}
+	if rule.Message == "" {
+		rule.Message = "injected fault"
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.nextID++
+	rule.ID = fmt.Sprintf("fault-%d", i.nextID)
+	rule.Applied, rule.Failed = 0, 0
+	rule.CreatedAt = time.Now()
+	stored := rule
+	i.rules = append(i.rules, &stored)
+	return stored, nil
+}
+
+// Remove removes a rule, reporting whether it existed
+func (i *Injector) Remove(id string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for n, r := range i.rules {
+		if r.ID == id {
+			i.rules = append(i.rules[:n], i.rules[n+1:]...)
+			delete(i.active, id)
+			return true
+		}
+	}
+	return false
+}
+
+// Reset removes every rule
+func (i *Injector) Reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.rules = nil
+	i.active = map[string]int{}
+}
+
+// Rules returns the rules with their counters
+func (i *Injector) Rules() []Rule {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	rules := make([]Rule, 0, len(i.rules))
+	for _, r := range i.rules {
+		rules = append(rules, *r)
+	}
+	return rules
+}
+
+// Activate arms the route rules matching a request while it is served, returning their IDs for Deactivate.
+// Calls carry no request context, so an armed rule applies to every call made meanwhile
+func (i *Injector) Activate(method, path string) []string {
+	if !i.enabled {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var ids []string
+	for _, r := range i.rules {
+		if r.Route != "" && matchRoute(r.Route, method, path) {
+			i.active[r.ID]++
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// Deactivate disarms the rules armed for a request
+func (i *Injector) Deactivate(ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, id := range ids {
+		if i.active[id] > 1 {
+			i.active[id]--
+		} else {
+			delete(i.active, id)
+		}
+	}
+}
+
+// Inject applies the rules of a target to a call: it waits for the largest latency of the applying rules
+// and returns the error of the first one failing the call
+func (i *Injector) Inject(target string) error {
+	if !i.enabled {
+		return nil
+	}
+
+	var delay time.Duration
+	var fault error
+	i.mu.Lock()
+	for _, r := range i.rules {
+		if r.Target != target || r.exhausted() || (r.Route != "" && i.active[r.ID] == 0) {
+			continue
+		}
+		r.Applied++
+		if latency := time.Duration(r.LatencyMs) * time.Millisecond; latency > delay {
+			delay = latency
+		}
+		if fault == nil && r.ErrorRate > 0 && i.rand.Float64() < r.ErrorRate {
+			r.Failed++
+			fault = &Fault{Target: target, RuleID: r.ID, Message: r.Message}
+		}
+	}
+	i.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return fault
+}
+
+// validRoute checks the format of a route pattern
+func validRoute(pattern string) bool {
+	_, path := splitRoute(pattern)
+	return strings.HasPrefix(path, "/") && !strings.ContainsAny(path, " \t")
+}
+
+// splitRoute splits a route pattern into its method, empty for any, and path
+func splitRoute(pattern string) (string, string) {
+	if method, path, found := strings.Cut(pattern, " "); found {
+		return strings.ToUpper(method), strings.TrimSpace(path)
+	}
+	return "", pattern
+}
+
+// matchRoute matches a request against a route pattern. ":name" segments match any segment
+// and a trailing "*" matches the rest of the path
+func matchRoute(pattern, method, path string) bool {
+	patternMethod, patternPath := splitRoute(pattern)
+	if patternMethod != "" && patternMethod != strings.ToUpper(method) {
+		return false
+	}
+	prefix := strings.HasSuffix(patternPath, "*")
+	patternPath = strings.TrimSuffix(patternPath, "*")
+
+	want := strings.Split(strings.Trim(patternPath, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(got) < len(want) || (!prefix && len(got) != len(want)) {
+		return false
+	}
+	for n, segment := range want {
+		if segment != got[n] && !(strings.HasPrefix(segment, ":") && got[n] != "") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package faults
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+)
+
+// Transport injects the faults of a target into the requests of an HTTP client.
+// It returns the base transport, http.DefaultTransport when nil, when fault injection is disabled
+func Transport(base http.RoundTripper, target string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !Enabled() {
+		return base
+	}
+	return &transport{base: base, target: target, injector: Default()}
+}
+
+// transport is an HTTP transport injecting faults
+type transport struct {
+	base     http.RoundTripper
+	target   string
+	injector *Injector
+}
+
+// RoundTrip injects the faults of the target, then sends the request
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.injector.Inject(t.target); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Connector injects the faults of the db target into the queries, statements and transactions of database
+// connections. It returns the connector itself when fault injection is disabled
+func Connector(c driver.Connector) driver.Connector {
+	if !Enabled() {
+		return c
+	}
+	return &connector{Connector: c, injector: Default()}
+}
+
+// connector opens connections injecting faults
+type connector struct {
+	driver.Connector
+	injector *Injector
+}
+
+// Connect opens a connection of the wrapped connector
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &faultConn{Conn: conn, injector: c.injector}, nil
+}
+
+// faultConn is a database connection injecting faults before each query, statement and transaction
+type faultConn struct {
+	driver.Conn
+	injector *Injector
+}
+
+func (c *faultConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *faultConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := c.injector.Inject(TargetDB); err != nil {
+		return nil, err
+	}
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *faultConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.injector.Inject(TargetDB); err != nil {
+		return nil, err
+	}
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c *faultConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.injector.Inject(TargetDB); err != nil {
+		return nil, err
+	}
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c *faultConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *faultConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.injector.Inject(TargetDB); err != nil {
+		return nil, err
+	}
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+// Ping checks the connection without injecting faults, so health checks see the real database
+func (c *faultConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession lets the driver reset or discard a pooled connection
+func (c *faultConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid lets the driver discard a broken connection
+func (c *faultConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+package features
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Flags of gated capabilities
+const (
+	NFTTokenization = "nft_tokenization"
+	InteropSharing  = "interop_sharing"
+	QRCompactLink   = "qr_compact_link"
+)
+
+// Flag is a capability that can be rolled out gradually
+// A company override always wins; otherwise an enabled flag is on for RolloutPercent percent of companies
+type Flag struct {
+	Key            string       `json:"key"`
+	Description    string       `json:"description"`
+	Enabled        bool         `json:"enabled"`
+	RolloutPercent int          `json:"rollout_percent"`
+	Companies      map[int]bool `json:"companies"` // Per company overrides
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// IsEnabledFor evaluates the flag for a company
+func (f Flag) IsEnabledFor(companyID int) bool {
+	if enabled, ok := f.Companies[companyID]; ok {
+		return enabled
+	}
+	if !f.Enabled {
+		return false
+	}
+	return InRollout(f.Key, companyID, f.RolloutPercent)
+}
+
+// InRollout reports whether a company falls within the first percent of a flag's rollout
+// Companies are placed by a hash of the flag and company, so raising the percentage only adds companies
+func InRollout(key string, companyID, percent int) bool {
+	if percent >= 100 {
+		return true
+	}
+	if percent <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", key, companyID)
+	return int(h.Sum32()%100) < percent
+}
+
+// Service evaluates feature flags from an in-memory copy of the flag tables that is reloaded
+// when it is older than TTL or was invalidated
+type Service struct {
+	TTL time.Duration
+
+	mu       sync.RWMutex
+	flags    map[string]Flag
+	loadedAt time.Time
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates a feature flag service from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{TTL: time.Duration(cfg.FeatureFlagCacheSeconds) * time.Second}
+}
+
+// Default returns the process wide feature flag service
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Enabled reports whether a flag is on for a company; unknown flags are off
+func (s *Service) Enabled(key string, companyID int) bool {
+	flag, ok := s.Flags()[key]
+	return ok && flag.IsEnabledFor(companyID)
+}
+
+// Evaluate returns every flag evaluated for a company
+func (s *Service) Evaluate(companyID int) map[string]bool {
+	result := map[string]bool{}
+	for key, flag := range s.Flags() {
+		result[key] = flag.IsEnabledFor(companyID)
+	}
+	return result
+}
+
+// Flags returns the cached flags, reloading them when the cache is stale
+// When reloading fails the stale flags are kept
+func (s *Service) Flags() map[string]Flag {
+	s.mu.RLock()
+	flags, fresh := s.flags, s.flags != nil && time.Since(s.loadedAt) < s.TTL
+	s.mu.RUnlock()
+	if fresh {
+		return flags
+	}
+
+	loaded, err := load()
+	if err != nil {
+		fmt.Printf("Warning: failed to load feature flags: %v\n", err)
+		if flags == nil {
+			return map[string]Flag{}
+		}
+		return flags
+	}
+	s.mu.Lock()
+	s.flags, s.loadedAt = loaded, time.Now()
+	s.mu.Unlock()
+	return loaded
+}
+
+// Invalidate makes the next evaluation reload the flags; it is called after flags change
+func (s *Service) Invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// load reads the active flags and their company overrides
+func load() (map[string]Flag, error) {
+	if db.DB == nil {
+		return nil, fmt.Errorf("database is not initialized")
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT key, COALESCE(description, ''), COALESCE(enabled, false), COALESCE(rollout_percent, 100), updated_at
+		FROM feature_flag
+		WHERE is_active = true
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := map[string]Flag{}
+	for rows.Next() {
+		f := Flag{Companies: map[int]bool{}}
+		if err := rows.Scan(&f.Key, &f.Description, &f.Enabled, &f.RolloutPercent, &f.UpdatedAt); err != nil {
+			return nil, err
+		}
+		flags[f.Key] = f
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	overrides, err := db.DB.Query(`
+		SELECT f.key, o.company_id, o.enabled
+		FROM feature_flag_company o
+		JOIN feature_flag f ON f.id = o.flag_id
+		WHERE f.is_active = true
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer overrides.Close()
+	for overrides.Next() {
+		var key string
+		var companyID int
+		var enabled bool
+		if err := overrides.Scan(&key, &companyID, &enabled); err != nil {
+			return nil, err
+		}
+		if f, ok := flags[key]; ok {
+			f.Companies[companyID] = enabled
+		}
+	}
+	return flags, overrides.Err()
+}
@@ -0,0 +1,204 @@
+package fees
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Budget alert types
+const (
+	AlertThresholdReached = "threshold_reached"
+	AlertBudgetExceeded   = "budget_exceeded"
+)
+
+// Budget is a company's monthly on-chain spending limit
+type Budget struct {
+	CompanyID             int     `json:"company_id"`
+	MonthlyLimit          float64 `json:"monthly_limit"`
+	Currency              string  `json:"currency"`
+	AlertThresholdPercent int     `json:"alert_threshold_percent"`
+	Enforce               bool    `json:"enforce"`
+}
+
+// Accountant stores the fee of every on-chain operation and enforces company budgets
+type Accountant struct{}
+
+var once sync.Once
+
+// InitFeeAccounting installs the accountant for all blockchain clients
+func InitFeeAccounting() {
+	once.Do(func() {
+		blockchain.SetFeeAccountant(&Accountant{})
+	})
+}
+
+// Period returns the budget period (YYYY-MM) a point in time belongs to
+func Period(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+// periodStart returns the first instant of the month a point in time belongs to
+func periodStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// CheckBudget rejects an operation that would take an enforcing company over its monthly limit
+func (a *Accountant) CheckBudget(fee blockchain.TransactionFee) error {
+	if db.DB == nil {
+		return nil
+	}
+
+	companyID, ok := ResolveCompany(fee.Payload)
+	if !ok {
+		return nil
+	}
+	budget, err := LoadBudget(companyID)
+	if err != nil || budget == nil || budget.Currency != fee.Currency || !budget.Enforce {
+		return nil
+	}
+
+	spent, err := MonthlySpend(companyID, budget.Currency, fee.SubmittedAt)
+	if err != nil {
+		return nil
+	}
+	if spent+fee.Fee > budget.MonthlyLimit {
+		raiseAlert(*budget, AlertBudgetExceeded, spent, fee.SubmittedAt)
+		return fmt.Errorf("%w: company %d has spent %.8f of %.8f %s this month",
+			blockchain.ErrBudgetExceeded, companyID, spent, budget.MonthlyLimit, budget.Currency)
+	}
+	return nil
+}
+
+// RecordFee stores the fee of a submitted operation and raises budget alerts
+func (a *Accountant) RecordFee(fee blockchain.TransactionFee) {
+	if db.DB == nil {
+		return
+	}
+
+	var companyID sql.NullInt64
+	if id, ok := ResolveCompany(fee.Payload); ok {
+		companyID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+
+	_, err := db.DB.Exec(`
+		INSERT INTO blockchain_fee (tx_id, tx_type, company_id, chain_type, gas_used, gas_price_gwei, fee, currency, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, fee.TxID, fee.TxType, companyID, fee.ChainType, fee.GasUsed, fee.GasPriceGwei, fee.Fee, fee.Currency, fee.SubmittedAt)
+	if err != nil {
+		fmt.Printf("Warning: failed to record fee for transaction %s: %v\n", fee.TxID, err)
+		return
+	}
+	if !companyID.Valid {
+		return
+	}
+
+	budget, err := LoadBudget(int(companyID.Int64))
+	if err != nil || budget == nil || budget.Currency != fee.Currency {
+		return
+	}
+	spent, err := MonthlySpend(budget.CompanyID, budget.Currency, fee.SubmittedAt)
+	if err != nil {
+		return
+	}
+	if spent >= budget.MonthlyLimit {
+		raiseAlert(*budget, AlertBudgetExceeded, spent, fee.SubmittedAt)
+	} else if spent >= budget.MonthlyLimit*float64(budget.AlertThresholdPercent)/100 {
+		raiseAlert(*budget, AlertThresholdReached, spent, fee.SubmittedAt)
+	}
+}
+
+// LoadBudget returns the active budget of a company, or nil if it has none
+func LoadBudget(companyID int) (*Budget, error) {
+	budget := Budget{CompanyID: companyID}
+	err := db.DB.QueryRow(`
+		SELECT monthly_limit, currency, COALESCE(alert_threshold_percent, 80), COALESCE(enforce, true)
+		FROM chain_budget
+		WHERE company_id = $1 AND is_active = true
+	`, companyID).Scan(&budget.MonthlyLimit, &budget.Currency, &budget.AlertThresholdPercent, &budget.Enforce)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// MonthlySpend sums the fees a company paid in a currency during the month of at
+func MonthlySpend(companyID int, currency string, at time.Time) (float64, error) {
+	start := periodStart(at)
+	var spent float64
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(SUM(fee), 0)
+		FROM blockchain_fee
+		WHERE company_id = $1 AND currency = $2 AND created_at >= $3 AND created_at < $4
+	`, companyID, currency, start, start.AddDate(0, 1, 0)).Scan(&spent)
+	return spent, err
+}
+
+// raiseAlert records a budget alert once per company, period and type
+func raiseAlert(budget Budget, alertType string, spent float64, at time.Time) {
+	message := fmt.Sprintf("Company %d has spent %.8f of its %.8f %s monthly on-chain budget",
+		budget.CompanyID, spent, budget.MonthlyLimit, budget.Currency)
+
+	result, err := db.DB.Exec(`
+		INSERT INTO chain_budget_alert (company_id, period, alert_type, spent, monthly_limit, currency, message, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (company_id, period, alert_type) DO NOTHING
+	`, budget.CompanyID, Period(at), alertType, spent, budget.MonthlyLimit, budget.Currency, message, at)
+	if err != nil {
+		fmt.Printf("Warning: failed to record budget alert for company %d: %v\n", budget.CompanyID, err)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		fmt.Printf("Budget alert (%s): %s\n", alertType, message)
+	}
+}
+
+// ResolveCompany finds the company paying for an operation from its payload
+// It looks for a company, then a hatchery, then a batch reference
+func ResolveCompany(payload map[string]interface{}) (int, bool) {
+	if id, ok := payloadInt(payload, "company_id"); ok {
+		return id, true
+	}
+
+	var companyID int
+	if id, ok := payloadInt(payload, "hatchery_id"); ok {
+		if err := db.DB.QueryRow(`SELECT company_id FROM hatchery WHERE id = $1 AND company_id IS NOT NULL`, id).Scan(&companyID); err == nil {
+			return companyID, true
+		}
+	}
+	if id, ok := payloadInt(payload, "batch_id"); ok {
+		if err := db.DB.QueryRow(`
+			SELECT h.company_id
+			FROM batch b
+			JOIN hatchery h ON b.hatchery_id = h.id
+			WHERE b.id = $1 AND h.company_id IS NOT NULL
+		`, id).Scan(&companyID); err == nil {
+			return companyID, true
+		}
+	}
+	return 0, false
+}
+
+// payloadInt reads an integer ID from a payload value of any numeric or string type
+func payloadInt(payload map[string]interface{}, key string) (int, bool) {
+	switch v := payload[key].(type) {
+	case int:
+		return v, v > 0
+	case int64:
+		return int(v), v > 0
+	case float64:
+		return int(v), v > 0
+	case string:
+		id, err := strconv.Atoi(v)
+		return id, err == nil && id > 0
+	}
+	return 0, false
+}
@@ -0,0 +1,288 @@
+package inbound
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+)
+
+// Inbound message types with a built-in mapping to internal events
+const (
+	MessageBatchReceipt = "BATCH_RECEIPT"       // external chain confirms receipt of a shared batch
+	MessageBatchStatus  = "BATCH_STATUS_UPDATE" // external chain reports a status change of a shared batch
+)
+
+// Inbound message statuses
+const (
+	StatusReceived  = "received"
+	StatusProcessed = "processed"
+	StatusUnmapped  = "unmapped"
+	StatusFailed    = "failed"
+)
+
+// Webhook events raised for inbound messages
+const (
+	WebhookMessageReceived   = "interop.message.received"
+	WebhookBatchReceived     = "interop.batch.received"
+	WebhookBatchStatusUpdate = "interop.batch.status_updated"
+)
+
+// ErrInvalidMessage is returned for messages that fail validation or proof verification
+var ErrInvalidMessage = errors.New("invalid inbound message")
+
+// MappedEvent is the internal batch event an inbound message translates to
+type MappedEvent struct {
+	BatchID      int
+	EventType    string
+	Location     string
+	Metadata     map[string]interface{}
+	WebhookEvent string
+}
+
+// Mapper translates an inbound message payload into an internal event
+type Mapper func(msg *blockchain.InboundMessage) (*MappedEvent, error)
+
+var (
+	mappersMutex sync.RWMutex
+	mappers      = map[string]Mapper{
+		MessageBatchReceipt: mapBatchReceipt,
+		MessageBatchStatus:  mapBatchStatus,
+	}
+)
+
+// RegisterMapper adds or replaces the mapper of a message type
+func RegisterMapper(messageType string, mapper Mapper) {
+	mappersMutex.Lock()
+	defer mappersMutex.Unlock()
+	mappers[messageType] = mapper
+}
+
+// Result is the outcome of processing an inbound message
+type Result struct {
+	ID        int    `json:"id"`
+	Status    string `json:"status"`
+	BatchID   int    `json:"batch_id,omitempty"`
+	EventID   int    `json:"event_id,omitempty"`
+	Duplicate bool   `json:"duplicate"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Process verifies an inbound message, stores it, records the mapped batch event and notifies webhooks
+// Messages are idempotent on source chain and message ID, a redelivered message returns the stored result
+func Process(client *blockchain.BlockchainClient, msg *blockchain.InboundMessage) (*Result, error) {
+	if err := client.InteropClient.VerifyInboundMessage(msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	payload, _ := json.Marshal(msg.Payload)
+	result := &Result{Status: StatusReceived}
+	err := db.DB.QueryRow(`
+		INSERT INTO inbound_message (protocol, source_chain_id, message_id, message_type, payload, proof, status, received_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (source_chain_id, message_id) DO NOTHING
+		RETURNING id
+	`, msg.Protocol, msg.SourceChainID, msg.MessageID, msg.MessageType, string(payload), msg.Proof, StatusReceived).Scan(&result.ID)
+	if err == sql.ErrNoRows {
+		return storedResult(msg.SourceChainID, msg.MessageID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store inbound message: %w", err)
+	}
+
+	mappersMutex.RLock()
+	mapper, ok := mappers[msg.MessageType]
+	mappersMutex.RUnlock()
+
+	if !ok {
+		result.Status = StatusUnmapped
+		db.DB.Exec(`UPDATE inbound_message SET status = $2, processed_at = NOW() WHERE id = $1`, result.ID, result.Status)
+		if batchID, ok := payloadInt(msg.Payload, "batch_id"); ok {
+			notify(batchID, WebhookMessageReceived, msg, result)
+		}
+		return result, nil
+	}
+
+	event, err := mapper(msg)
+	if err == nil {
+		result.EventID, err = recordEvent(result.ID, event)
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		db.DB.Exec(`UPDATE inbound_message SET status = $2, error = $3, processed_at = NOW() WHERE id = $1`, result.ID, result.Status, result.Error)
+		return result, nil
+	}
+
+	result.Status = StatusProcessed
+	result.BatchID = event.BatchID
+	notify(event.BatchID, event.WebhookEvent, msg, result)
+	return result, nil
+}
+
+// recordEvent stores the mapped batch event and links it to the inbound message
+func recordEvent(messageID int, event *MappedEvent) (int, error) {
+	metadata, _ := json.Marshal(event.Metadata)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var eventID int
+	err = tx.QueryRow(`
+		INSERT INTO event (batch_id, event_type, location, timestamp, metadata, updated_at, is_active)
+		VALUES ($1, $2, $3, NOW(), $4, NOW(), true)
+		RETURNING id
+	`, event.BatchID, event.EventType, event.Location, string(metadata)).Scan(&eventID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record event: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE inbound_message
+		SET status = $2, batch_id = $3, event_id = $4, processed_at = NOW()
+		WHERE id = $1
+	`, messageID, StatusProcessed, event.BatchID, eventID)
+	if err != nil {
+		return 0, err
+	}
+	return eventID, tx.Commit()
+}
+
+// storedResult returns the result of a message that was already received
+func storedResult(sourceChainID, messageID string) (*Result, error) {
+	result := &Result{Duplicate: true}
+	var batchID, eventID sql.NullInt64
+	var errorText sql.NullString
+	err := db.DB.QueryRow(`
+		SELECT id, status, batch_id, event_id, error
+		FROM inbound_message
+		WHERE source_chain_id = $1 AND message_id = $2
+	`, sourceChainID, messageID).Scan(&result.ID, &result.Status, &batchID, &eventID, &errorText)
+	if err != nil {
+		return nil, err
+	}
+	result.BatchID = int(batchID.Int64)
+	result.EventID = int(eventID.Int64)
+	result.Error = errorText.String
+	return result, nil
+}
+
+// notify raises a webhook for the company owning a batch
+func notify(batchID int, eventType string, msg *blockchain.InboundMessage, result *Result) {
+	var companyID int
+	err := db.DB.QueryRow(`
+		SELECT h.company_id
+		FROM batch b
+		JOIN hatchery h ON b.hatchery_id = h.id
+		WHERE b.id = $1 AND h.company_id IS NOT NULL
+	`, batchID).Scan(&companyID)
+	if err != nil {
+		return
+	}
+
+	data := map[string]interface{}{
+		"inbound_message_id": result.ID,
+		"protocol":           msg.Protocol,
+		"source_chain_id":    msg.SourceChainID,
+		"message_id":         msg.MessageID,
+		"message_type":       msg.MessageType,
+		"batch_id":           batchID,
+		"payload":            msg.Payload,
+	}
+	if result.EventID != 0 {
+		data["event_id"] = result.EventID
+	}
+	if err := webhooks.Dispatch(companyID, eventType, data); err != nil {
+		fmt.Printf("Warning: failed to dispatch %s webhook: %v\n", eventType, err)
+	}
+}
+
+// mapBatchReceipt maps an external chain's receipt confirmation of a shared batch
+func mapBatchReceipt(msg *blockchain.InboundMessage) (*MappedEvent, error) {
+	batchID, err := existingBatch(msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]interface{}{
+		"source_chain_id": msg.SourceChainID,
+		"message_id":      msg.MessageID,
+		"received_at":     time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, key := range []string{"shared_tx_id", "dest_tx_id", "receiver", "payload_hash"} {
+		if value, ok := msg.Payload[key]; ok {
+			metadata[key] = value
+		}
+	}
+
+	return &MappedEvent{
+		BatchID:      batchID,
+		EventType:    "cross_chain_receipt",
+		Location:     msg.SourceChainID,
+		Metadata:     metadata,
+		WebhookEvent: WebhookBatchReceived,
+	}, nil
+}
+
+// mapBatchStatus maps a status change an external chain reports for a shared batch
+func mapBatchStatus(msg *blockchain.InboundMessage) (*MappedEvent, error) {
+	batchID, err := existingBatch(msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	status, _ := msg.Payload["status"].(string)
+	if status == "" {
+		return nil, errors.New("payload has no status")
+	}
+
+	return &MappedEvent{
+		BatchID:   batchID,
+		EventType: "cross_chain_status_update",
+		Location:  msg.SourceChainID,
+		Metadata: map[string]interface{}{
+			"source_chain_id": msg.SourceChainID,
+			"message_id":      msg.MessageID,
+			"status":          status,
+			"reason":          msg.Payload["reason"],
+		},
+		WebhookEvent: WebhookBatchStatusUpdate,
+	}, nil
+}
+
+// existingBatch reads the batch ID of a payload and checks the batch exists
+func existingBatch(payload map[string]interface{}) (int, error) {
+	batchID, ok := payloadInt(payload, "batch_id")
+	if !ok {
+		return 0, errors.New("payload has no valid batch_id")
+	}
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = $1 AND is_active = true)", batchID).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("batch %d not found", batchID)
+	}
+	return batchID, nil
+}
+
+// payloadInt reads an integer ID from a payload value of any numeric or string type
+func payloadInt(payload map[string]interface{}, key string) (int, bool) {
+	switch v := payload[key].(type) {
+	case float64:
+		return int(v), v > 0
+	case string:
+		id, err := strconv.Atoi(v)
+		return id, err == nil && id > 0
+	}
+	return 0, false
+}
@@ -0,0 +1,213 @@
+package indexer
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// ConfirmationIndexer follows anchored records until their transactions are final
+type ConfirmationIndexer struct {
+	Client        *blockchain.BlockchainClient
+	ChainType     string
+	CheckInterval time.Duration
+	ReorgGrace    time.Duration
+	MaxResubmits  int
+	BatchSize     int
+}
+
+// NewConfirmationIndexer creates a confirmation indexer from the application config
+func NewConfirmationIndexer(cfg *config.Config) *ConfirmationIndexer {
+	client := blockchain.NewBlockchainClient(
+		cfg.BlockchainNodeURL,
+		cfg.BlockchainPrivateKey,
+		cfg.BlockchainAccount,
+		cfg.BlockchainChainID,
+		cfg.BlockchainConsensus,
+	)
+
+	return &ConfirmationIndexer{
+		Client:        client,
+		ChainType:     cfg.BlockchainConsensus,
+		CheckInterval: time.Duration(cfg.IndexerIntervalSeconds) * time.Second,
+		ReorgGrace:    time.Duration(cfg.IndexerReorgGraceSeconds) * time.Second,
+		MaxResubmits:  cfg.IndexerMaxResubmits,
+		BatchSize:     500,
+	}
+}
+
+// Start begins polling the chain for confirmations in the background
+func (ix *ConfirmationIndexer) Start() {
+	go func() {
+		for {
+			if err := ix.RunOnce(); err != nil {
+				fmt.Printf("Warning: confirmation indexer run failed: %v\n", err)
+			}
+
+			time.Sleep(ix.CheckInterval)
+		}
+	}()
+}
+
+// pendingRecord is a blockchain record that has not reached finality yet
+type pendingRecord struct {
+	ID            int
+	RelatedTable  string
+	RelatedID     int
+	TxID          string
+	MetadataHash  string
+	ChainType     string
+	BlockNumber   sql.NullInt64
+	ResubmitCount int
+	SubmittedAt   time.Time
+}
+
+// RunOnce updates the confirmation status of every record that is not final yet
+func (ix *ConfirmationIndexer) RunOnce() error {
+	if db.DB == nil {
+		return nil
+	}
+
+	latest, err := ix.Client.GetLatestBlockNumber()
+	if err != nil {
+		return fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	// A record is considered submitted when it was created or last re-anchored
+	rows, err := db.DB.Query(`
+		SELECT br.id, COALESCE(br.related_table, ''), COALESCE(br.related_id, 0), COALESCE(br.tx_id, ''),
+		       COALESCE(br.metadata_hash, ''), COALESCE(br.chain_type, $1), br.block_number,
+		       COALESCE(br.resubmit_count, 0),
+		       COALESCE((SELECT MAX(rs.created_at) FROM blockchain_record_resubmission rs WHERE rs.record_id = br.id), br.created_at)
+		FROM blockchain_record br
+		WHERE br.is_active = true
+		  AND COALESCE(br.confirmation_status, 'pending') NOT IN ('finalized', 'dropped')
+		ORDER BY br.id ASC
+		LIMIT $2
+	`, ix.ChainType, ix.BatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to query unfinalized records: %w", err)
+	}
+
+	var records []pendingRecord
+	for rows.Next() {
+		var r pendingRecord
+		if err := rows.Scan(&r.ID, &r.RelatedTable, &r.RelatedID, &r.TxID, &r.MetadataHash, &r.ChainType,
+			&r.BlockNumber, &r.ResubmitCount, &r.SubmittedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan blockchain record: %w", err)
+		}
+		records = append(records, r)
+	}
+	rows.Close()
+
+	for _, record := range records {
+		if err := ix.checkRecord(record, latest); err != nil {
+			fmt.Printf("Warning: failed to check blockchain record %d: %v\n", record.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// checkRecord refreshes a single record against the chain head
+func (ix *ConfirmationIndexer) checkRecord(record pendingRecord, latest int64) error {
+	receipt, err := ix.Client.GetTransactionReceipt(record.TxID)
+	if err != nil {
+		return fmt.Errorf("failed to get receipt: %w", err)
+	}
+
+	now := time.Now()
+	if !receipt.Found {
+		// Give the transaction time to be mined before treating it as dropped
+		if now.Sub(record.SubmittedAt) < ix.ReorgGrace {
+			_, err := db.DB.Exec(`
+				UPDATE blockchain_record
+				SET chain_type = $1, block_number = NULL, confirmations = 0, confirmation_status = $2,
+				    confirmed_at = NULL, last_checked_at = $3
+				WHERE id = $4
+			`, record.ChainType, blockchain.ConfirmationPending, now, record.ID)
+			return err
+		}
+		return ix.resubmitRecord(record, now)
+	}
+
+	confirmations := latest - receipt.BlockNumber + 1
+	if confirmations < 0 {
+		confirmations = 0
+	}
+	status := blockchain.ConfirmationStatus(record.ChainType, confirmations)
+
+	// A changed inclusion block means the transaction was reorganized into another block,
+	// so confirmations restart from the new block
+	if record.BlockNumber.Valid && record.BlockNumber.Int64 != receipt.BlockNumber {
+		fmt.Printf("Warning: blockchain record %d moved from block %d to %d\n",
+			record.ID, record.BlockNumber.Int64, receipt.BlockNumber)
+	}
+
+	_, err = db.DB.Exec(`
+		UPDATE blockchain_record
+		SET chain_type = $1,
+		    block_number = $2,
+		    confirmations = $3,
+		    confirmation_status = $4,
+		    confirmed_at = CASE WHEN $5 THEN COALESCE(confirmed_at, $7) ELSE NULL END,
+		    finalized_at = CASE WHEN $6 THEN COALESCE(finalized_at, $7) ELSE NULL END,
+		    last_checked_at = $7
+		WHERE id = $8
+	`, record.ChainType, receipt.BlockNumber, confirmations, status,
+		status != blockchain.ConfirmationPending, status == blockchain.ConfirmationFinalized, now, record.ID)
+	return err
+}
+
+// resubmitRecord anchors a record again after its transaction was dropped by a reorg
+func (ix *ConfirmationIndexer) resubmitRecord(record pendingRecord, now time.Time) error {
+	if record.ResubmitCount >= ix.MaxResubmits {
+		_, err := db.DB.Exec(`
+			UPDATE blockchain_record
+			SET confirmation_status = $1, last_checked_at = $2
+			WHERE id = $3
+		`, blockchain.ConfirmationDropped, now, record.ID)
+		return err
+	}
+
+	newTxID, err := ix.Client.SubmitTransaction("RECORD_REANCHOR", map[string]interface{}{
+		"related_table":  record.RelatedTable,
+		"related_id":     record.RelatedID,
+		"metadata_hash":  record.MetadataHash,
+		"previous_tx_id": record.TxID,
+		"resubmitted_at": now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to resubmit transaction: %w", err)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO blockchain_record_resubmission (record_id, previous_tx_id, new_tx_id, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, record.ID, record.TxID, newTxID, "dropped_by_reorg", now); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE blockchain_record
+		SET tx_id = $1, block_number = NULL, confirmations = 0, confirmation_status = $2,
+		    confirmed_at = NULL, finalized_at = NULL, resubmit_count = COALESCE(resubmit_count, 0) + 1,
+		    last_checked_at = $3, updated_at = $3
+		WHERE id = $4
+	`, newTxID, blockchain.ConfirmationPending, now, record.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,160 @@
+package interop
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Tables of the entities anchored on chain, as stored in blockchain_record.related_table
+const (
+	AnchorBatch       = "batch"
+	AnchorEvent       = "event"
+	AnchorDocument    = "document"
+	AnchorEnvironment = "environment"
+)
+
+// AnchorRecord is a transaction recorded for an anchored entity, with the node's copy of it when the node has one
+type AnchorRecord struct {
+	TxID         string                  `json:"tx_id"`
+	MetadataHash string                  `json:"metadata_hash"`
+	Timestamp    string                  `json:"timestamp"`
+	BlockchainTx *blockchain.Transaction `json:"blockchain_tx,omitempty"`
+}
+
+// Anchored is an entity anchored on chain and the transactions recorded for it
+type Anchored struct {
+	ID       int
+	BatchID  int
+	IPFSHash string // documents only
+	Records  []AnchorRecord
+}
+
+// Ledger reads anchored entities and their blockchain records from the database
+type Ledger interface {
+	// Entity returns the batch of an entity and, for documents, its IPFS hash; ok is false when it does not exist
+	Entity(table string, id int) (batchID int, ipfsHash string, ok bool, err error)
+	// Records returns the blockchain records of an entity, oldest first
+	Records(table string, id int) ([]AnchorRecord, error)
+}
+
+// dbLedger is the Ledger of the application database
+type dbLedger struct{}
+
+func (dbLedger) Entity(table string, id int) (int, string, bool, error) {
+	var query string
+	switch table {
+	case AnchorBatch:
+		query = "SELECT id, '' FROM batch WHERE id = $1"
+	case AnchorEvent:
+		query = "SELECT batch_id, '' FROM event WHERE id = $1"
+	case AnchorDocument:
+		query = "SELECT COALESCE(batch_id, 0), COALESCE(ipfs_hash, '') FROM document WHERE id = $1"
+	case AnchorEnvironment:
+		query = "SELECT batch_id, '' FROM environment WHERE id = $1"
+	default:
+		return 0, "", false, fmt.Errorf("unknown anchored table %s", table)
+	}
+
+	var batchID int
+	var ipfsHash string
+	err := db.DB.QueryRow(query, id).Scan(&batchID, &ipfsHash)
+	if err == sql.ErrNoRows {
+		return 0, "", false, nil
+	}
+	if err != nil {
+		return 0, "", false, err
+	}
+	return batchID, ipfsHash, true, nil
+}
+
+func (dbLedger) Records(table string, id int) ([]AnchorRecord, error) {
+	rows, err := db.DB.Query(`
+		SELECT tx_id, metadata_hash, created_at
+		FROM blockchain_record
+		WHERE related_table = $1 AND related_id = $2
+		ORDER BY created_at ASC
+	`, table, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []AnchorRecord
+	for rows.Next() {
+		var record AnchorRecord
+		if err := rows.Scan(&record.TxID, &record.MetadataHash, &record.Timestamp); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// nodeTransactions returns the transactions the node holds for an anchored entity
+func nodeTransactions(client *blockchain.BlockchainClient, table string, id int) ([]blockchain.Transaction, error) {
+	switch table {
+	case AnchorBatch:
+		return client.GetBatchTransactions(strconv.Itoa(id))
+	case AnchorEvent:
+		return client.GetEventTransactions(strconv.Itoa(id))
+	case AnchorDocument:
+		return client.GetDocumentTransactions(strconv.Itoa(id))
+	case AnchorEnvironment:
+		return client.GetEnvironmentDataTransactions(strconv.Itoa(id))
+	}
+	return nil, fmt.Errorf("unknown anchored table %s", table)
+}
+
+// anchored loads an entity and its blockchain records, matched with the transactions of the node
+func (s *Service) anchored(table string, id int, notFoundMessage string) (*Anchored, error) {
+	batchID, ipfsHash, ok, err := s.Ledger.Entity(table, id)
+	if err != nil {
+		return nil, internal("Database error", err)
+	}
+	if !ok {
+		return nil, notFound(notFoundMessage)
+	}
+
+	txs, err := s.Transactions(table, id)
+	if err != nil {
+		return nil, upstream("Failed to retrieve "+table+" data from blockchain", err)
+	}
+
+	records, err := s.Ledger.Records(table, id)
+	if err != nil {
+		return nil, internal("Database error", err)
+	}
+	for i := range records {
+		for j := range txs {
+			if txs[j].TxID == records[i].TxID {
+				records[i].BlockchainTx = &txs[j]
+				break
+			}
+		}
+	}
+	return &Anchored{ID: id, BatchID: batchID, IPFSHash: ipfsHash, Records: records}, nil
+}
+
+// BatchRecords returns the blockchain records of a batch
+func (s *Service) BatchRecords(batchID int) (*Anchored, error) {
+	return s.anchored(AnchorBatch, batchID, "Batch not found")
+}
+
+// EventRecords returns the blockchain records of an event
+func (s *Service) EventRecords(eventID int) (*Anchored, error) {
+	return s.anchored(AnchorEvent, eventID, "Event not found")
+}
+
+// DocumentRecords returns the blockchain records of a document; callers check the document may be seen first
+func (s *Service) DocumentRecords(documentID int) (*Anchored, error) {
+	return s.anchored(AnchorDocument, documentID, "Document not found")
+}
+
+// EnvironmentRecords returns the blockchain records of an environment reading
+func (s *Service) EnvironmentRecords(envID int) (*Anchored, error) {
+	return s.anchored(AnchorEnvironment, envID, "Environment data not found")
+}
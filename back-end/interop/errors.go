@@ -0,0 +1,61 @@
+package interop
+
+import "errors"
+
+// Kinds of service errors; the API maps each kind to one HTTP status
+const (
+	KindDisabled = "disabled"  // interoperability or the protocol is switched off
+	KindInvalid  = "invalid"   // the request is incomplete or not possible on the chain
+	KindNotFound = "not_found" // the chain, bridge or network does not exist
+	KindUpstream = "upstream"  // the node, relay or BaaS network failed
+	KindInternal = "internal"  // the database of the service failed
+)
+
+// Error is returned by every Service method that fails
+type Error struct {
+	Kind    string
+	Message string
+	Err     error
+}
+
+// Error returns the message followed by the cause, if any
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of a service error, or KindUpstream for any other error
+func KindOf(err error) string {
+	var serviceErr *Error
+	if errors.As(err, &serviceErr) {
+		return serviceErr.Kind
+	}
+	return KindUpstream
+}
+
+func disabled(message string) error {
+	return &Error{Kind: KindDisabled, Message: message}
+}
+
+func invalid(message string) error {
+	return &Error{Kind: KindInvalid, Message: message}
+}
+
+func notFound(message string) error {
+	return &Error{Kind: KindNotFound, Message: message}
+}
+
+func upstream(message string, err error) error {
+	return &Error{Kind: KindUpstream, Message: message, Err: err}
+}
+
+func internal(message string, err error) error {
+	return &Error{Kind: KindInternal, Message: message, Err: err}
+}
@@ -0,0 +1,57 @@
+package interop
+
+import (
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain/bridges"
+)
+
+// nodeClient adapts the interoperability client of the node to Node
+type nodeClient struct {
+	*blockchain.InteroperabilityClient
+}
+
+// AddIBCChannel adds a channel to the Cosmos bridge of a chain, reporting false when there is no bridge
+func (n nodeClient) AddIBCChannel(chainID, channelID, portID, counterpartyChannelID, counterpartyPortID, connectionID string) bool {
+	bridge, exists := n.CosmosBridges[chainID]
+	if !exists {
+		return false
+	}
+	bridge.AddIBCChannel(channelID, portID, counterpartyChannelID, counterpartyPortID, connectionID)
+	return true
+}
+
+// IBCChannel returns an open IBC channel
+func (n nodeClient) IBCChannel(channelID string) (blockchain.IBCChannelInfo, bool) {
+	channel, found := n.IBCChannels[channelID]
+	return channel, found
+}
+
+// XCMAssets returns the assets registered on the Polkadot bridge of a chain
+func (n nodeClient) XCMAssets(chainID string) (map[string]bridges.XCMAssetDetails, bool) {
+	bridge, exists := n.PolkadotBridges[chainID]
+	if !exists {
+		return nil, false
+	}
+	return bridge.RegisteredAssets, true
+}
+
+// TraceXCMAsset traces an asset over the Polkadot bridge of a chain, reporting false when there is no bridge
+func (n nodeClient) TraceXCMAsset(chainID, assetID string) (map[string]interface{}, bool, error) {
+	bridge, exists := n.PolkadotBridges[chainID]
+	if !exists {
+		return nil, false, nil
+	}
+	details, err := bridge.TraceXCMAsset(assetID)
+	return details, true, err
+}
+
+// CachedVerification returns a cached verification result
+func (n nodeClient) CachedVerification(key string) (blockchain.InteropVerificationResult, bool) {
+	result, found := n.VerificationCache[key]
+	return result, found
+}
+
+// CacheVerification stores a verification result
+func (n nodeClient) CacheVerification(key string, result blockchain.InteropVerificationResult) {
+	n.VerificationCache[key] = result
+}
@@ -0,0 +1,747 @@
+package interop
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain/bridges"
+	"github.com/LTPPPP/TracePost-larvaeChain/chains"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+)
+
+// defaultPacketTimeout is used for IBC packets sent without a timeout
+const defaultPacketTimeout = 30 * time.Minute
+
+// verificationCacheTTL is how long a cross-chain verification result is reused
+const verificationCacheTTL = 5 * time.Minute
+
+// Node is the interoperability client of the local node
+type Node interface {
+	RegisterChain(chainID, chainType, endpoint string) (string, error)
+	CreatePolkadotBridge(chainID, relayEndpoint, relayChainID, parachainID, apiKey string) error
+	CreateCosmosBridge(chainID, nodeEndpoint, apiKey, accountAddress string) error
+	AddIBCChannel(chainID, channelID, portID, counterpartyChannelID, counterpartyPortID, connectionID string) bool
+	IBCChannel(channelID string) (blockchain.IBCChannelInfo, bool)
+	XCMAssets(chainID string) (map[string]bridges.XCMAssetDetails, bool)
+	TraceXCMAsset(chainID, assetID string) (map[string]interface{}, bool, error)
+	SendXCMMessage(msg bridges.XCMMessage) (string, error)
+	SendIBCPacket(msg bridges.IBCMessage) (string, error)
+	VerifyTransaction(txID, protocol, sourceChainID, destChainID string) (bool, error)
+	GetTransactionStatus(txID, protocol, sourceChainID string) (string, error)
+	GetSupportedProtocols() []string
+	VerifyIBCTransaction(txID, sourceChainID, destChainID string) (bool, string, error)
+	VerifyXCMTransaction(txID, sourceChainID, destChainID string) (bool, string, error)
+	VerifyBridgeTransaction(txID, sourceChainID, destChainID string) (bool, string, error)
+	CachedVerification(key string) (blockchain.InteropVerificationResult, bool)
+	CacheVerification(key string, result blockchain.InteropVerificationResult)
+}
+
+// BaaS is the blockchain-as-a-service layer managing external networks, bridges and contracts
+type BaaS interface {
+	GetAvailableNetworks() []map[string]interface{}
+	GetNetworkStatus(networkID string) (map[string]interface{}, error)
+	GetBridgeTransactions(bridgeID string, limit, offset int) ([]map[string]interface{}, error)
+	CreateCrossChainBridge(sourceNetworkID, targetNetworkID, bridgeType string, bridgeConfig map[string]interface{}) (string, error)
+	TransferAssetAcrossChains(sourceNetworkID, targetNetworkID, bridgeID, assetID, amount, sender, recipient string) (string, error)
+	QueryIBCChannels(networkID string) ([]map[string]interface{}, error)
+	GetIBCDenomTrace(networkID, denom string) (map[string]interface{}, error)
+	GetBridgeById(bridgeID string) (map[string]interface{}, error)
+	EstimateBridgeTransfer(bridgeID, assetID, amount string) (*blockchain.BridgeTransferEstimate, error)
+	DeploySmartContract(networkID, contractType, contractName, contractCode string, initArgs map[string]interface{}) (string, error)
+	QueryContractState(networkID, contractAddress string, queryData map[string]interface{}) (map[string]interface{}, error)
+	CreateInterChainAccount(networkID, targetNetworkID, connectionID, owner string) (string, error)
+	SendInterChainAccountTx(networkID, targetNetworkID, connectionID, owner string, msgs []map[string]interface{}, memo string) (string, error)
+}
+
+var _ BaaS = (*blockchain.BaaSService)(nil)
+
+// Service runs interoperability operations: it checks they are enabled, validates their input,
+// talks to the node or the BaaS layer and reports failures as typed errors
+type Service struct {
+	Enabled          bool
+	IBCEnabled       bool
+	SubstrateEnabled bool
+
+	// NewClient builds the blockchain client of the local node; a new client is used for every operation
+	NewClient func() *blockchain.BlockchainClient
+	// NewNode builds the interoperability client of the local node
+	NewNode func() Node
+	// NewBaaS builds the BaaS layer; nil means it could not be initialized
+	NewBaaS func() BaaS
+	// RequireCapability checks a registered chain supports an operation
+	RequireCapability func(chainID, operation string) error
+	// RecordChain stores a chain and its probed capabilities in the registry
+	RecordChain func(chainID, name, chainType, endpoint string) (*chains.Chain, error)
+	// Ledger reads anchored entities and their blockchain records
+	Ledger Ledger
+	// Transactions returns the transactions the node holds for an anchored entity
+	Transactions func(table string, id int) ([]blockchain.Transaction, error)
+	Now          func() time.Time
+}
+
+// NewService creates a service from the application config
+func NewService(cfg *config.Config) *Service {
+	s := &Service{
+		Enabled:          cfg.InteropEnabled,
+		IBCEnabled:       cfg.IBCEnabled,
+		SubstrateEnabled: cfg.SubstrateEnabled,
+		NewClient: func() *blockchain.BlockchainClient {
+			return blockchain.NewBlockchainClient(
+				cfg.BlockchainNodeURL,
+				"", // Private key is not needed for now
+				cfg.BlockchainAccount,
+				cfg.BlockchainChainID,
+				cfg.BlockchainConsensus,
+			)
+		},
+		NewBaaS: func() BaaS {
+			if baas := blockchain.NewBaaSService(); baas != nil {
+				return baas
+			}
+			return nil
+		},
+		RequireCapability: chains.Require,
+		RecordChain:       chains.Register,
+		Ledger:            dbLedger{},
+		Now:               time.Now,
+	}
+	s.NewNode = func() Node {
+		return nodeClient{s.NewClient().InteropClient}
+	}
+	s.Transactions = func(table string, id int) ([]blockchain.Transaction, error) {
+		return nodeTransactions(s.NewClient(), table, id)
+	}
+	return s
+}
+
+// CheckEnabled fails when interoperability is switched off
+func (s *Service) CheckEnabled() error {
+	if !s.Enabled {
+		return disabled("Interoperability is not enabled")
+	}
+	return nil
+}
+
+// requireCapability fails when a registered chain lacks the capability of an operation
+func (s *Service) requireCapability(chainID, operation string) error {
+	if s.RequireCapability == nil {
+		return nil
+	}
+	err := s.RequireCapability(chainID, operation)
+	if errors.Is(err, blockchain.ErrCapabilityUnsupported) {
+		return invalid(err.Error())
+	}
+	if err != nil {
+		return upstream("Failed to check chain capabilities", err)
+	}
+	return nil
+}
+
+// baas builds the BaaS layer
+func (s *Service) baas() (BaaS, error) {
+	baas := s.NewBaaS()
+	if baas == nil {
+		return nil, upstream("Failed to initialize BaaS service", nil)
+	}
+	return baas, nil
+}
+
+// baasError classifies an error of the BaaS layer by the domain error it wraps
+func baasError(err error, notFoundErr error, notFoundMessage, action string) error {
+	if errors.Is(err, notFoundErr) {
+		return notFound(notFoundMessage)
+	}
+	if errors.Is(err, blockchain.ErrCapabilityUnsupported) {
+		return invalid("Chain does not support IBC")
+	}
+	return upstream("Failed to "+action, err)
+}
+
+// RegisterChain registers an external chain with the node and records its probed capabilities
+func (s *Service) RegisterChain(chainID, name, chainType, endpoint string) (string, *chains.Chain, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return "", nil, err
+	}
+	if chainID == "" || chainType == "" || endpoint == "" {
+		return "", nil, invalid("Missing required fields")
+	}
+
+	connectionID, err := s.NewNode().RegisterChain(chainID, chainType, endpoint)
+	if err != nil {
+		return "", nil, upstream("Failed to register chain", err)
+	}
+	chain, err := s.RecordChain(chainID, name, chainType, endpoint)
+	if err != nil {
+		return "", nil, upstream("Failed to record chain in registry", err)
+	}
+	return connectionID, chain, nil
+}
+
+// CreatePolkadotBridge connects a parachain through its relay chain
+func (s *Service) CreatePolkadotBridge(chainID, relayEndpoint, relayChainID, parachainID, apiKey string) error {
+	if err := s.CheckEnabled(); err != nil {
+		return err
+	}
+	if chainID == "" || relayEndpoint == "" || relayChainID == "" || parachainID == "" {
+		return invalid("Missing required fields")
+	}
+	if err := s.requireCapability(chainID, blockchain.OperationXCM); err != nil {
+		return err
+	}
+	if err := s.NewNode().CreatePolkadotBridge(chainID, relayEndpoint, relayChainID, parachainID, apiKey); err != nil {
+		return upstream("Failed to create Polkadot bridge", err)
+	}
+	return nil
+}
+
+// CreateCosmosBridge connects a Cosmos chain through its node
+func (s *Service) CreateCosmosBridge(chainID, nodeEndpoint, apiKey, accountAddress string) error {
+	if err := s.CheckEnabled(); err != nil {
+		return err
+	}
+	if chainID == "" || nodeEndpoint == "" || accountAddress == "" {
+		return invalid("Missing required fields")
+	}
+	if err := s.requireCapability(chainID, blockchain.OperationIBC); err != nil {
+		return err
+	}
+	if err := s.NewNode().CreateCosmosBridge(chainID, nodeEndpoint, apiKey, accountAddress); err != nil {
+		return upstream("Failed to create Cosmos bridge", err)
+	}
+	return nil
+}
+
+// AddIBCChannel adds a channel to the Cosmos bridge of a chain
+func (s *Service) AddIBCChannel(chainID, channelID, portID, counterpartyChannelID, counterpartyPortID, connectionID string) error {
+	if err := s.CheckEnabled(); err != nil {
+		return err
+	}
+	if chainID == "" || channelID == "" || portID == "" ||
+		counterpartyChannelID == "" || counterpartyPortID == "" || connectionID == "" {
+		return invalid("Missing required fields")
+	}
+	if !s.NewNode().AddIBCChannel(chainID, channelID, portID, counterpartyChannelID, counterpartyPortID, connectionID) {
+		return invalid("No Cosmos bridge found for the specified chain ID")
+	}
+	return nil
+}
+
+// SendXCMMessage sends a cross-consensus message to a Polkadot-based chain and returns its ID
+func (s *Service) SendXCMMessage(sourceChainID, destChainID, messageType string, payload map[string]interface{}) (string, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return "", err
+	}
+	if !s.SubstrateEnabled {
+		return "", disabled("Substrate protocol is not enabled")
+	}
+	if sourceChainID == "" || destChainID == "" || messageType == "" || payload == nil {
+		return "", invalid("Missing required fields")
+	}
+	if err := s.requireCapability(destChainID, blockchain.OperationXCM); err != nil {
+		return "", err
+	}
+
+	now := s.Now()
+	messageID, err := s.NewNode().SendXCMMessage(bridges.XCMMessage{
+		MessageID:          fmt.Sprintf("xcm-%s", now.Format("20060102150405")),
+		SourceChainID:      sourceChainID,
+		DestinationChainID: destChainID,
+		MessageType:        messageType,
+		Payload:            payload,
+		Timestamp:          now.Unix(),
+		Status:             "pending",
+		Version:            "v2",
+	})
+	if err != nil {
+		return "", upstream("Failed to send XCM message", err)
+	}
+	return messageID, nil
+}
+
+// SendIBCPacket sends a packet over an IBC channel and returns its ID; the timeout defaults to 30 minutes
+func (s *Service) SendIBCPacket(sourceChainID, destChainID, channelID string, payload map[string]interface{}, timeoutMinutes int) (string, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return "", err
+	}
+	if !s.IBCEnabled {
+		return "", disabled("IBC protocol is not enabled")
+	}
+	if sourceChainID == "" || destChainID == "" || channelID == "" || payload == nil {
+		return "", invalid("Missing required fields")
+	}
+	if err := s.requireCapability(destChainID, blockchain.OperationIBC); err != nil {
+		return "", err
+	}
+
+	timeout := defaultPacketTimeout
+	if timeoutMinutes > 0 {
+		timeout = time.Duration(timeoutMinutes) * time.Minute
+	}
+	node := s.NewNode()
+	channel, found := node.IBCChannel(channelID)
+	if !found {
+		return "", invalid("Channel not found")
+	}
+
+	now := s.Now()
+	packetID, err := node.SendIBCPacket(bridges.IBCMessage{
+		MessageID:          fmt.Sprintf("ibc-%s", now.Format("20060102150405")),
+		SourceChainID:      sourceChainID,
+		DestinationChainID: destChainID,
+		SourceChannel:      channelID,
+		DestinationChannel: channel.CounterpartyChannelID,
+		SourcePort:         channel.PortID,
+		DestinationPort:    channel.CounterpartyPortID,
+		Payload:            payload,
+		Timestamp:          now.Unix(),
+		Status:             "pending",
+		TimeoutTimestamp:   now.Add(timeout).Unix(),
+	})
+	if err != nil {
+		return "", upstream("Failed to send IBC packet", err)
+	}
+	return packetID, nil
+}
+
+// VerifyTransaction checks a cross-chain transaction arrived on the destination chain
+func (s *Service) VerifyTransaction(txID, protocol, sourceChainID, destChainID string) (bool, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return false, err
+	}
+	if txID == "" || protocol == "" || sourceChainID == "" || destChainID == "" {
+		return false, invalid("Missing required fields")
+	}
+	verified, err := s.NewNode().VerifyTransaction(txID, protocol, sourceChainID, destChainID)
+	if err != nil {
+		return false, upstream("Failed to verify transaction", err)
+	}
+	return verified, nil
+}
+
+// TransactionStatus returns the status of a cross-chain transaction
+func (s *Service) TransactionStatus(txID, protocol, sourceChainID string) (string, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return "", err
+	}
+	if txID == "" || protocol == "" || sourceChainID == "" {
+		return "", invalid("Missing required parameters")
+	}
+	status, err := s.NewNode().GetTransactionStatus(txID, protocol, sourceChainID)
+	if err != nil {
+		return "", upstream("Failed to get transaction status", err)
+	}
+	return status, nil
+}
+
+// SupportedProtocols lists the cross-chain protocols of the node
+func (s *Service) SupportedProtocols() ([]string, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return nil, err
+	}
+	return s.NewNode().GetSupportedProtocols(), nil
+}
+
+// ConnectedChains lists the networks available through the BaaS layer
+func (s *Service) ConnectedChains() ([]map[string]interface{}, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return nil, err
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return nil, err
+	}
+	return baas.GetAvailableNetworks(), nil
+}
+
+// ChainStatus returns the status of a network of the BaaS layer
+func (s *Service) ChainStatus(chainID string) (map[string]interface{}, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return nil, err
+	}
+	if chainID == "" {
+		return nil, invalid("Chain ID is required")
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return nil, err
+	}
+	status, err := baas.GetNetworkStatus(chainID)
+	if err != nil {
+		if errors.Is(err, blockchain.ErrNetworkNotConfigured) {
+			return nil, notFound("Chain not found")
+		}
+		return nil, upstream("Failed to get chain status", err)
+	}
+	return status, nil
+}
+
+// CrossChainTransactions lists the transactions of the bridge between two chains, whichever direction it was created in
+// It returns the ID of the bridge the transactions were found on
+func (s *Service) CrossChainTransactions(sourceChainID, destChainID string, limit, offset int) (string, []map[string]interface{}, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return "", nil, err
+	}
+	if sourceChainID == "" || destChainID == "" {
+		return "", nil, invalid("Source and destination chain IDs are required")
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return "", nil, err
+	}
+
+	bridgeID := fmt.Sprintf("bridge_%s_%s", sourceChainID, destChainID)
+	transactions, err := baas.GetBridgeTransactions(bridgeID, limit, offset)
+	if errors.Is(err, blockchain.ErrBridgeMissing) {
+		bridgeID = fmt.Sprintf("bridge_%s_%s", destChainID, sourceChainID)
+		transactions, err = baas.GetBridgeTransactions(bridgeID, limit, offset)
+	}
+	if err != nil {
+		return "", nil, upstream("Failed to get cross-chain transactions", err)
+	}
+	return bridgeID, transactions, nil
+}
+
+// CreateBridge creates a bridge between two networks of the BaaS layer and returns its ID
+func (s *Service) CreateBridge(sourceNetworkID, targetNetworkID, bridgeType string, bridgeConfig map[string]interface{}) (string, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return "", err
+	}
+	switch {
+	case sourceNetworkID == "":
+		return "", invalid("source_network_id is required")
+	case targetNetworkID == "":
+		return "", invalid("target_network_id is required")
+	case bridgeType == "":
+		return "", invalid("bridge_type is required")
+	}
+	if bridgeConfig == nil {
+		bridgeConfig = make(map[string]interface{})
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return "", err
+	}
+	bridgeID, err := baas.CreateCrossChainBridge(sourceNetworkID, targetNetworkID, bridgeType, bridgeConfig)
+	if err != nil {
+		return "", upstream("Failed to create cross-chain bridge", err)
+	}
+	return bridgeID, nil
+}
+
+// AssetTransfer is a transfer of an asset across a bridge
+type AssetTransfer struct {
+	SourceNetworkID string
+	TargetNetworkID string
+	BridgeID        string
+	AssetID         string
+	Amount          string
+	Sender          string
+	Recipient       string
+}
+
+// TransferAsset starts a transfer across a bridge and returns its transaction hash
+func (s *Service) TransferAsset(transfer AssetTransfer) (string, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return "", err
+	}
+	for _, field := range []struct{ name, value string }{
+		{"source_network_id", transfer.SourceNetworkID},
+		{"target_network_id", transfer.TargetNetworkID},
+		{"bridge_id", transfer.BridgeID},
+		{"asset_id", transfer.AssetID},
+		{"amount", transfer.Amount},
+		{"sender", transfer.Sender},
+		{"recipient", transfer.Recipient},
+	} {
+		if field.value == "" {
+			return "", invalid(field.name + " is required")
+		}
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return "", err
+	}
+	txHash, err := baas.TransferAssetAcrossChains(transfer.SourceNetworkID, transfer.TargetNetworkID, transfer.BridgeID,
+		transfer.AssetID, transfer.Amount, transfer.Sender, transfer.Recipient)
+	if err != nil {
+		return "", upstream("Failed to transfer asset", err)
+	}
+	return txHash, nil
+}
+
+// IBCChannels lists the IBC channels of a Cosmos network
+func (s *Service) IBCChannels(chainID string) ([]map[string]interface{}, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return nil, err
+	}
+	if chainID == "" {
+		return nil, invalid("Chain ID is required")
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return nil, err
+	}
+	channels, err := baas.QueryIBCChannels(chainID)
+	if err != nil {
+		return nil, baasError(err, blockchain.ErrNetworkNotConfigured, "Chain not found", "query IBC channels")
+	}
+	return channels, nil
+}
+
+// XCMAssets lists the assets registered on the Polkadot bridge of a chain
+func (s *Service) XCMAssets(chainID string) (map[string]bridges.XCMAssetDetails, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return nil, err
+	}
+	if chainID == "" {
+		return nil, invalid("Chain ID is required")
+	}
+	assets, found := s.NewNode().XCMAssets(chainID)
+	if !found {
+		return nil, notFound("No Polkadot bridge found for the specified chain ID")
+	}
+	return assets, nil
+}
+
+// TraceIBCDenom traces an IBC token back to its origin
+func (s *Service) TraceIBCDenom(chainID, denom string) (map[string]interface{}, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return nil, err
+	}
+	if chainID == "" || denom == "" {
+		return nil, invalid("Chain ID and denom are required")
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return nil, err
+	}
+	trace, err := baas.GetIBCDenomTrace(chainID, denom)
+	if err != nil {
+		return nil, baasError(err, blockchain.ErrNetworkNotConfigured, "Chain not found", "trace IBC denom")
+	}
+	return trace, nil
+}
+
+// TraceXCMAsset traces an XCM asset back to its origin
+func (s *Service) TraceXCMAsset(chainID, assetID string) (map[string]interface{}, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return nil, err
+	}
+	if chainID == "" || assetID == "" {
+		return nil, invalid("Chain ID and asset ID are required")
+	}
+	details, found, err := s.NewNode().TraceXCMAsset(chainID, assetID)
+	if !found {
+		return nil, notFound("No Polkadot bridge found for the specified chain ID")
+	}
+	if err != nil {
+		return nil, upstream("Failed to trace XCM asset", err)
+	}
+	return details, nil
+}
+
+// Bridge returns the details of a bridge of the BaaS layer
+func (s *Service) Bridge(bridgeID string) (map[string]interface{}, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return nil, err
+	}
+	if bridgeID == "" {
+		return nil, invalid("Bridge ID is required")
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return nil, err
+	}
+	bridge, err := baas.GetBridgeById(bridgeID)
+	if err != nil {
+		return nil, baasError(err, blockchain.ErrBridgeMissing, "Bridge not found", "get bridge details")
+	}
+	return bridge, nil
+}
+
+// EstimateBridgeTransfer estimates the fees and latency of a transfer across a bridge
+// Estimation failures other than an unknown bridge come from the input, so they are reported as invalid
+func (s *Service) EstimateBridgeTransfer(bridgeID, assetID, amount string) (*blockchain.BridgeTransferEstimate, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return nil, err
+	}
+	if bridgeID == "" {
+		return nil, invalid("Bridge ID is required")
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return nil, err
+	}
+	estimate, err := baas.EstimateBridgeTransfer(bridgeID, assetID, amount)
+	if err != nil {
+		if errors.Is(err, blockchain.ErrBridgeMissing) {
+			return nil, notFound("Bridge not found")
+		}
+		return nil, &Error{Kind: KindInvalid, Message: "Failed to estimate bridge transfer", Err: err}
+	}
+	return estimate, nil
+}
+
+// DeployContract deploys a smart contract to a network of the BaaS layer and returns its address
+func (s *Service) DeployContract(networkID, contractType, contractName, contractCode string, initArgs map[string]interface{}) (string, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return "", err
+	}
+	switch {
+	case networkID == "":
+		return "", invalid("network_id is required")
+	case contractType == "":
+		return "", invalid("contract_type is required")
+	case contractName == "":
+		return "", invalid("contract_name is required")
+	case contractCode == "":
+		return "", invalid("contract_code is required")
+	}
+	if initArgs == nil {
+		initArgs = make(map[string]interface{})
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return "", err
+	}
+	address, err := baas.DeploySmartContract(networkID, contractType, contractName, contractCode, initArgs)
+	if err != nil {
+		return "", upstream("Failed to deploy smart contract", err)
+	}
+	return address, nil
+}
+
+// QueryContract queries the state of a smart contract
+func (s *Service) QueryContract(networkID, contractAddress string, query map[string]interface{}) (map[string]interface{}, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return nil, err
+	}
+	if networkID == "" || contractAddress == "" {
+		return nil, invalid("Network ID and contract address are required")
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return nil, err
+	}
+	state, err := baas.QueryContractState(networkID, contractAddress, query)
+	if err != nil {
+		return nil, baasError(err, blockchain.ErrNetworkNotConfigured, "Network not found", "query contract state")
+	}
+	return state, nil
+}
+
+// CreateInterChainAccount opens an interchain account on a target chain and returns its address
+func (s *Service) CreateInterChainAccount(sourceChainID, targetChainID, connectionID, owner string) (string, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return "", err
+	}
+	if sourceChainID == "" || targetChainID == "" || connectionID == "" || owner == "" {
+		return "", invalid("Missing required fields")
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return "", err
+	}
+	address, err := baas.CreateInterChainAccount(sourceChainID, targetChainID, connectionID, owner)
+	if err != nil {
+		return "", upstream("Failed to create interchain account", err)
+	}
+	return address, nil
+}
+
+// InterChainAccountTx is a transaction sent from an interchain account
+type InterChainAccountTx struct {
+	SourceChainID string
+	TargetChainID string
+	ConnectionID  string
+	Owner         string
+	Messages      []map[string]interface{}
+	Memo          string
+}
+
+// SendInterChainAccountTx sends a transaction from an interchain account and returns its hash
+func (s *Service) SendInterChainAccountTx(tx InterChainAccountTx) (string, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return "", err
+	}
+	if tx.SourceChainID == "" || tx.TargetChainID == "" || tx.ConnectionID == "" ||
+		tx.Owner == "" || len(tx.Messages) == 0 {
+		return "", invalid("Missing required fields")
+	}
+	baas, err := s.baas()
+	if err != nil {
+		return "", err
+	}
+	txHash, err := baas.SendInterChainAccountTx(tx.SourceChainID, tx.TargetChainID, tx.ConnectionID, tx.Owner, tx.Messages, tx.Memo)
+	if err != nil {
+		return "", upstream("Failed to send interchain account transaction", err)
+	}
+	return txHash, nil
+}
+
+// Verification is the result of verifying a cross-chain transaction with a proof
+type Verification struct {
+	Verified  bool
+	ProofData string
+	CachedAt  *time.Time // set when the result came from the cache
+}
+
+// ProtocolFor picks the verification protocol of a transaction; "auto" or an unknown protocol
+// is detected from the chain IDs: Cosmos chains use IBC, Polkadot chains XCM and anything else the bridge
+func ProtocolFor(protocol, sourceChainID, destChainID string) string {
+	switch strings.ToLower(protocol) {
+	case "ibc", "xcm", "bridge":
+		return strings.ToLower(protocol)
+	}
+	source, dest := strings.ToLower(sourceChainID), strings.ToLower(destChainID)
+	switch {
+	case strings.Contains(source, "cosmos") || strings.Contains(dest, "cosmos"):
+		return "ibc"
+	case strings.Contains(source, "dot") || strings.Contains(dest, "dot"):
+		return "xcm"
+	}
+	return "bridge"
+}
+
+// VerifyWithProof verifies a cross-chain transaction with the proof of its protocol,
+// reusing a result of the last five minutes
+func (s *Service) VerifyWithProof(txID, sourceChainID, destChainID, protocol string) (*Verification, error) {
+	if err := s.CheckEnabled(); err != nil {
+		return nil, err
+	}
+	if txID == "" || sourceChainID == "" || destChainID == "" {
+		return nil, invalid("Missing required query parameters")
+	}
+
+	node := s.NewNode()
+	cacheKey := fmt.Sprintf("%s-%s-%s", txID, sourceChainID, destChainID)
+	if cached, found := node.CachedVerification(cacheKey); found && s.Now().Sub(cached.Timestamp) < verificationCacheTTL {
+		cachedAt := cached.Timestamp
+		return &Verification{Verified: cached.Verified, ProofData: cached.ProofData, CachedAt: &cachedAt}, nil
+	}
+
+	var verified bool
+	var proofData string
+	var err error
+	switch ProtocolFor(protocol, sourceChainID, destChainID) {
+	case "ibc":
+		verified, proofData, err = node.VerifyIBCTransaction(txID, sourceChainID, destChainID)
+	case "xcm":
+		verified, proofData, err = node.VerifyXCMTransaction(txID, sourceChainID, destChainID)
+	default:
+		verified, proofData, err = node.VerifyBridgeTransaction(txID, sourceChainID, destChainID)
+	}
+	if err != nil {
+		return nil, upstream("Transaction verification failed", err)
+	}
+
+	node.CacheVerification(cacheKey, blockchain.InteropVerificationResult{
+		Verified:  verified,
+		Timestamp: s.Now(),
+		ProofData: proofData,
+	})
+	return &Verification{Verified: verified, ProofData: proofData}, nil
+}
@@ -0,0 +1,634 @@
+package interop
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain/bridges"
+	"github.com/LTPPPP/TracePost-larvaeChain/chains"
+)
+
+var testNow = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeNode records the calls made to the node and returns canned results
+type fakeNode struct {
+	cosmosBridges   map[string]bool
+	polkadotAssets  map[string]map[string]bridges.XCMAssetDetails
+	channels        map[string]blockchain.IBCChannelInfo
+	cache           map[string]blockchain.InteropVerificationResult
+	err             error
+	verified        bool
+	verifiedWith    string
+	sentIBC         *bridges.IBCMessage
+	sentXCM         *bridges.XCMMessage
+	registeredChain string
+}
+
+func newFakeNode() *fakeNode {
+	return &fakeNode{
+		cosmosBridges:  map[string]bool{},
+		polkadotAssets: map[string]map[string]bridges.XCMAssetDetails{},
+		channels:       map[string]blockchain.IBCChannelInfo{},
+		cache:          map[string]blockchain.InteropVerificationResult{},
+	}
+}
+
+func (n *fakeNode) RegisterChain(chainID, chainType, endpoint string) (string, error) {
+	n.registeredChain = chainID
+	return "conn-" + chainID, n.err
+}
+
+func (n *fakeNode) CreatePolkadotBridge(chainID, relayEndpoint, relayChainID, parachainID, apiKey string) error {
+	return n.err
+}
+
+func (n *fakeNode) CreateCosmosBridge(chainID, nodeEndpoint, apiKey, accountAddress string) error {
+	return n.err
+}
+
+func (n *fakeNode) AddIBCChannel(chainID, channelID, portID, counterpartyChannelID, counterpartyPortID, connectionID string) bool {
+	return n.cosmosBridges[chainID]
+}
+
+func (n *fakeNode) IBCChannel(channelID string) (blockchain.IBCChannelInfo, bool) {
+	channel, found := n.channels[channelID]
+	return channel, found
+}
+
+func (n *fakeNode) XCMAssets(chainID string) (map[string]bridges.XCMAssetDetails, bool) {
+	assets, found := n.polkadotAssets[chainID]
+	return assets, found
+}
+
+func (n *fakeNode) TraceXCMAsset(chainID, assetID string) (map[string]interface{}, bool, error) {
+	if _, found := n.polkadotAssets[chainID]; !found {
+		return nil, false, nil
+	}
+	return map[string]interface{}{"asset_id": assetID}, true, n.err
+}
+
+func (n *fakeNode) SendXCMMessage(msg bridges.XCMMessage) (string, error) {
+	n.sentXCM = &msg
+	return msg.MessageID, n.err
+}
+
+func (n *fakeNode) SendIBCPacket(msg bridges.IBCMessage) (string, error) {
+	n.sentIBC = &msg
+	return msg.MessageID, n.err
+}
+
+func (n *fakeNode) VerifyTransaction(txID, protocol, sourceChainID, destChainID string) (bool, error) {
+	return n.verified, n.err
+}
+
+func (n *fakeNode) GetTransactionStatus(txID, protocol, sourceChainID string) (string, error) {
+	return "confirmed", n.err
+}
+
+func (n *fakeNode) GetSupportedProtocols() []string {
+	return []string{"ibc", "xcm"}
+}
+
+func (n *fakeNode) VerifyIBCTransaction(txID, sourceChainID, destChainID string) (bool, string, error) {
+	n.verifiedWith = "ibc"
+	return n.verified, "ibc-proof", n.err
+}
+
+func (n *fakeNode) VerifyXCMTransaction(txID, sourceChainID, destChainID string) (bool, string, error) {
+	n.verifiedWith = "xcm"
+	return n.verified, "xcm-proof", n.err
+}
+
+func (n *fakeNode) VerifyBridgeTransaction(txID, sourceChainID, destChainID string) (bool, string, error) {
+	n.verifiedWith = "bridge"
+	return n.verified, "bridge-proof", n.err
+}
+
+func (n *fakeNode) CachedVerification(key string) (blockchain.InteropVerificationResult, bool) {
+	result, found := n.cache[key]
+	return result, found
+}
+
+func (n *fakeNode) CacheVerification(key string, result blockchain.InteropVerificationResult) {
+	n.cache[key] = result
+}
+
+// fakeBaaS serves bridges by ID and fails with err for every other call
+type fakeBaaS struct {
+	bridges map[string][]map[string]interface{}
+	err     error
+}
+
+func (b *fakeBaaS) GetAvailableNetworks() []map[string]interface{} {
+	return []map[string]interface{}{{"id": "cosmos-hub"}}
+}
+
+func (b *fakeBaaS) GetNetworkStatus(networkID string) (map[string]interface{}, error) {
+	return map[string]interface{}{"id": networkID}, b.err
+}
+
+func (b *fakeBaaS) GetBridgeTransactions(bridgeID string, limit, offset int) ([]map[string]interface{}, error) {
+	transactions, found := b.bridges[bridgeID]
+	if !found {
+		return nil, fmt.Errorf("%w: %s", blockchain.ErrBridgeMissing, bridgeID)
+	}
+	return transactions, nil
+}
+
+func (b *fakeBaaS) CreateCrossChainBridge(sourceNetworkID, targetNetworkID, bridgeType string, bridgeConfig map[string]interface{}) (string, error) {
+	return "bridge_" + sourceNetworkID + "_" + targetNetworkID, b.err
+}
+
+func (b *fakeBaaS) TransferAssetAcrossChains(sourceNetworkID, targetNetworkID, bridgeID, assetID, amount, sender, recipient string) (string, error) {
+	return "0xabc", b.err
+}
+
+func (b *fakeBaaS) QueryIBCChannels(networkID string) ([]map[string]interface{}, error) {
+	return nil, b.err
+}
+
+func (b *fakeBaaS) GetIBCDenomTrace(networkID, denom string) (map[string]interface{}, error) {
+	return nil, b.err
+}
+
+func (b *fakeBaaS) GetBridgeById(bridgeID string) (map[string]interface{}, error) {
+	return map[string]interface{}{"id": bridgeID}, b.err
+}
+
+func (b *fakeBaaS) EstimateBridgeTransfer(bridgeID, assetID, amount string) (*blockchain.BridgeTransferEstimate, error) {
+	return &blockchain.BridgeTransferEstimate{}, b.err
+}
+
+func (b *fakeBaaS) DeploySmartContract(networkID, contractType, contractName, contractCode string, initArgs map[string]interface{}) (string, error) {
+	return "0xcontract", b.err
+}
+
+func (b *fakeBaaS) QueryContractState(networkID, contractAddress string, queryData map[string]interface{}) (map[string]interface{}, error) {
+	return nil, b.err
+}
+
+func (b *fakeBaaS) CreateInterChainAccount(networkID, targetNetworkID, connectionID, owner string) (string, error) {
+	return "cosmos1account", b.err
+}
+
+func (b *fakeBaaS) SendInterChainAccountTx(networkID, targetNetworkID, connectionID, owner string, msgs []map[string]interface{}, memo string) (string, error) {
+	return "0xtx", b.err
+}
+
+func newTestService(node *fakeNode, baas *fakeBaaS) *Service {
+	return &Service{
+		Enabled:          true,
+		IBCEnabled:       true,
+		SubstrateEnabled: true,
+		NewNode:          func() Node { return node },
+		NewBaaS: func() BaaS {
+			if baas == nil {
+				return nil
+			}
+			return baas
+		},
+		RecordChain: func(chainID, name, chainType, endpoint string) (*chains.Chain, error) {
+			return &chains.Chain{ChainID: chainID}, nil
+		},
+		Now: func() time.Time { return testNow },
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"disabled", disabled("off"), KindDisabled},
+		{"invalid", invalid("bad"), KindInvalid},
+		{"not found", notFound("missing"), KindNotFound},
+		{"upstream", upstream("failed", errors.New("boom")), KindUpstream},
+		{"internal", internal("Database error", errors.New("boom")), KindInternal},
+		{"wrapped", fmt.Errorf("context: %w", notFound("missing")), KindNotFound},
+		{"plain error", errors.New("boom"), KindUpstream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.want {
+				t.Errorf("KindOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	if got := upstream("Failed to register chain", errors.New("timeout")).Error(); got != "Failed to register chain: timeout" {
+		t.Errorf("Error() = %q", got)
+	}
+	if got := invalid("Missing required fields").Error(); got != "Missing required fields" {
+		t.Errorf("Error() = %q", got)
+	}
+}
+
+func TestServiceDisabled(t *testing.T) {
+	svc := newTestService(newFakeNode(), &fakeBaaS{})
+	svc.Enabled = false
+
+	calls := map[string]func() error{
+		"RegisterChain": func() error {
+			_, _, err := svc.RegisterChain("cosmos-hub", "", "cosmos", "http://node")
+			return err
+		},
+		"SupportedProtocols": func() error { _, err := svc.SupportedProtocols(); return err },
+		"ConnectedChains":    func() error { _, err := svc.ConnectedChains(); return err },
+		"Bridge":             func() error { _, err := svc.Bridge("bridge_a_b"); return err },
+		"VerifyWithProof": func() error {
+			_, err := svc.VerifyWithProof("tx", "a", "b", "auto")
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			err := call()
+			if KindOf(err) != KindDisabled || err.Error() != "Interoperability is not enabled" {
+				t.Errorf("got %v, want interoperability disabled", err)
+			}
+		})
+	}
+}
+
+func TestServiceValidation(t *testing.T) {
+	svc := newTestService(newFakeNode(), &fakeBaaS{})
+
+	tests := []struct {
+		name    string
+		call    func() error
+		message string
+	}{
+		{"register chain", func() error {
+			_, _, err := svc.RegisterChain("cosmos-hub", "", "", "http://node")
+			return err
+		}, "Missing required fields"},
+		{"cosmos bridge", func() error {
+			return svc.CreateCosmosBridge("cosmos-hub", "", "", "cosmos1")
+		}, "Missing required fields"},
+		{"transaction status", func() error {
+			_, err := svc.TransactionStatus("tx", "", "a")
+			return err
+		}, "Missing required parameters"},
+		{"chain status", func() error {
+			_, err := svc.ChainStatus("")
+			return err
+		}, "Chain ID is required"},
+		{"bridge target", func() error {
+			_, err := svc.CreateBridge("a", "", "lock-mint", nil)
+			return err
+		}, "target_network_id is required"},
+		{"transfer sender", func() error {
+			_, err := svc.TransferAsset(AssetTransfer{
+				SourceNetworkID: "a", TargetNetworkID: "b", BridgeID: "bridge_a_b",
+				AssetID: "shrimp", Amount: "10", Recipient: "0x2",
+			})
+			return err
+		}, "sender is required"},
+		{"contract code", func() error {
+			_, err := svc.DeployContract("a", "evm", "Batch", "", nil)
+			return err
+		}, "contract_code is required"},
+		{"interchain tx without messages", func() error {
+			_, err := svc.SendInterChainAccountTx(InterChainAccountTx{
+				SourceChainID: "a", TargetChainID: "b", ConnectionID: "connection-0", Owner: "owner",
+			})
+			return err
+		}, "Missing required fields"},
+		{"verify with proof", func() error {
+			_, err := svc.VerifyWithProof("tx", "", "b", "auto")
+			return err
+		}, "Missing required query parameters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if KindOf(err) != KindInvalid || err.Error() != tt.message {
+				t.Errorf("got %v, want invalid %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestServiceProtocolSwitches(t *testing.T) {
+	payload := map[string]interface{}{"batch_id": "42"}
+
+	svc := newTestService(newFakeNode(), nil)
+	svc.SubstrateEnabled = false
+	_, err := svc.SendXCMMessage("a", "polkadot", "transfer", payload)
+	if KindOf(err) != KindDisabled || err.Error() != "Substrate protocol is not enabled" {
+		t.Errorf("SendXCMMessage() error = %v", err)
+	}
+
+	svc = newTestService(newFakeNode(), nil)
+	svc.IBCEnabled = false
+	_, err = svc.SendIBCPacket("a", "cosmos-hub", "channel-0", payload, 0)
+	if KindOf(err) != KindDisabled || err.Error() != "IBC protocol is not enabled" {
+		t.Errorf("SendIBCPacket() error = %v", err)
+	}
+}
+
+func TestServiceRequireCapability(t *testing.T) {
+	tests := []struct {
+		name     string
+		checkErr error
+		kind     string
+	}{
+		{"supported", nil, ""},
+		{"unsupported", fmt.Errorf("%w: chain does not support ibc", blockchain.ErrCapabilityUnsupported), KindInvalid},
+		{"registry failure", errors.New("connection refused"), KindUpstream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(newFakeNode(), nil)
+			svc.RequireCapability = func(chainID, operation string) error { return tt.checkErr }
+
+			err := svc.CreateCosmosBridge("cosmos-hub", "http://node", "", "cosmos1")
+			if tt.kind == "" {
+				if err != nil {
+					t.Fatalf("CreateCosmosBridge() error = %v", err)
+				}
+				return
+			}
+			if KindOf(err) != tt.kind {
+				t.Errorf("CreateCosmosBridge() error = %v, want kind %q", err, tt.kind)
+			}
+		})
+	}
+}
+
+func TestServiceSendIBCPacket(t *testing.T) {
+	node := newFakeNode()
+	node.channels["channel-0"] = blockchain.IBCChannelInfo{
+		PortID:                "transfer",
+		CounterpartyChannelID: "channel-7",
+		CounterpartyPortID:    "transfer",
+	}
+	svc := newTestService(node, nil)
+	payload := map[string]interface{}{"batch_id": "42"}
+
+	tests := []struct {
+		name    string
+		channel string
+		timeout int
+		expires time.Time
+		kind    string
+	}{
+		{"default timeout", "channel-0", 0, testNow.Add(30 * time.Minute), ""},
+		{"custom timeout", "channel-0", 5, testNow.Add(5 * time.Minute), ""},
+		{"unknown channel", "channel-9", 0, time.Time{}, KindInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node.sentIBC = nil
+			packetID, err := svc.SendIBCPacket("trace-1", "cosmos-hub", tt.channel, payload, tt.timeout)
+			if tt.kind != "" {
+				if KindOf(err) != tt.kind || node.sentIBC != nil {
+					t.Fatalf("SendIBCPacket() error = %v, want kind %q and nothing sent", err, tt.kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SendIBCPacket() error = %v", err)
+			}
+			if packetID != "ibc-20250301120000" {
+				t.Errorf("packet ID = %q", packetID)
+			}
+			if node.sentIBC.DestinationChannel != "channel-7" || node.sentIBC.TimeoutTimestamp != tt.expires.Unix() {
+				t.Errorf("sent packet = %+v", node.sentIBC)
+			}
+		})
+	}
+}
+
+func TestServiceBaaSErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		call    func(*Service) error
+		kind    string
+		message string
+	}{
+		{"chain not configured", fmt.Errorf("%w: osmosis", blockchain.ErrNetworkNotConfigured), func(s *Service) error {
+			_, err := s.IBCChannels("osmosis")
+			return err
+		}, KindNotFound, "Chain not found"},
+		{"chain without IBC", fmt.Errorf("%w: network eth does not support IBC", blockchain.ErrCapabilityUnsupported), func(s *Service) error {
+			_, err := s.TraceIBCDenom("eth", "uatom")
+			return err
+		}, KindInvalid, "Chain does not support IBC"},
+		{"chain status not configured", fmt.Errorf("%w: osmosis", blockchain.ErrNetworkNotConfigured), func(s *Service) error {
+			_, err := s.ChainStatus("osmosis")
+			return err
+		}, KindNotFound, "Chain not found"},
+		{"bridge not found", fmt.Errorf("%w: bridge_x", blockchain.ErrBridgeMissing), func(s *Service) error {
+			_, err := s.Bridge("bridge_x")
+			return err
+		}, KindNotFound, "Bridge not found"},
+		{"estimate rejected", errors.New("amount must be positive"), func(s *Service) error {
+			_, err := s.EstimateBridgeTransfer("bridge_a_b", "shrimp", "-1")
+			return err
+		}, KindInvalid, "Failed to estimate bridge transfer: amount must be positive"},
+		{"network not configured", fmt.Errorf("%w: osmosis", blockchain.ErrNetworkNotConfigured), func(s *Service) error {
+			_, err := s.QueryContract("osmosis", "0xcontract", nil)
+			return err
+		}, KindNotFound, "Network not found"},
+		{"deploy failure", errors.New("out of gas"), func(s *Service) error {
+			_, err := s.DeployContract("a", "evm", "Batch", "code", nil)
+			return err
+		}, KindUpstream, "Failed to deploy smart contract: out of gas"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(newTestService(newFakeNode(), &fakeBaaS{err: tt.err}))
+			if KindOf(err) != tt.kind || err.Error() != tt.message {
+				t.Errorf("got %v (%s), want %s %q", err, KindOf(err), tt.kind, tt.message)
+			}
+		})
+	}
+}
+
+func TestServiceBaaSUnavailable(t *testing.T) {
+	svc := newTestService(newFakeNode(), nil)
+	_, err := svc.ConnectedChains()
+	if KindOf(err) != KindUpstream || err.Error() != "Failed to initialize BaaS service" {
+		t.Errorf("ConnectedChains() error = %v", err)
+	}
+}
+
+func TestServiceCrossChainTransactions(t *testing.T) {
+	tests := []struct {
+		name       string
+		bridges    map[string][]map[string]interface{}
+		wantBridge string
+		kind       string
+	}{
+		{"forward bridge", map[string][]map[string]interface{}{"bridge_a_b": {{"id": 1}}}, "bridge_a_b", ""},
+		{"reverse bridge", map[string][]map[string]interface{}{"bridge_b_a": {{"id": 1}}}, "bridge_b_a", ""},
+		{"no bridge", nil, "", KindUpstream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(newFakeNode(), &fakeBaaS{bridges: tt.bridges})
+			bridgeID, transactions, err := svc.CrossChainTransactions("a", "b", 10, 0)
+			if tt.kind != "" {
+				if KindOf(err) != tt.kind {
+					t.Fatalf("CrossChainTransactions() error = %v, want kind %q", err, tt.kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CrossChainTransactions() error = %v", err)
+			}
+			if bridgeID != tt.wantBridge || len(transactions) != 1 {
+				t.Errorf("got bridge %q with %d transactions", bridgeID, len(transactions))
+			}
+		})
+	}
+}
+
+func TestServicePolkadotBridgeLookups(t *testing.T) {
+	node := newFakeNode()
+	node.polkadotAssets["moonbeam"] = map[string]bridges.XCMAssetDetails{}
+	svc := newTestService(node, nil)
+
+	if _, err := svc.XCMAssets("moonbeam"); err != nil {
+		t.Errorf("XCMAssets() error = %v", err)
+	}
+	if _, err := svc.XCMAssets("acala"); KindOf(err) != KindNotFound {
+		t.Errorf("XCMAssets() error = %v, want not found", err)
+	}
+	if _, err := svc.TraceXCMAsset("acala", "shrimp"); KindOf(err) != KindNotFound {
+		t.Errorf("TraceXCMAsset() error = %v, want not found", err)
+	}
+	if err := svc.AddIBCChannel("cosmos-hub", "channel-0", "transfer", "channel-7", "transfer", "connection-0"); KindOf(err) != KindInvalid {
+		t.Errorf("AddIBCChannel() error = %v, want invalid without a Cosmos bridge", err)
+	}
+}
+
+func TestProtocolFor(t *testing.T) {
+	tests := []struct {
+		protocol, source, dest string
+		want                   string
+	}{
+		{"IBC", "a", "b", "ibc"},
+		{"xcm", "cosmos-hub", "b", "xcm"},
+		{"auto", "cosmoshub-4", "tracepost", "ibc"},
+		{"auto", "tracepost", "polkadot", "xcm"},
+		{"", "tracepost", "ethereum", "bridge"},
+		{"unknown", "tracepost", "Cosmos-Hub", "ibc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol+"/"+tt.source+"/"+tt.dest, func(t *testing.T) {
+			if got := ProtocolFor(tt.protocol, tt.source, tt.dest); got != tt.want {
+				t.Errorf("ProtocolFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceVerifyWithProofCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		cachedAge  time.Duration
+		wantCached bool
+	}{
+		{"fresh cache entry", time.Minute, true},
+		{"stale cache entry", 10 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newFakeNode()
+			node.verified = true
+			node.cache["tx-1-tracepost-polkadot"] = blockchain.InteropVerificationResult{
+				Verified:  false,
+				Timestamp: testNow.Add(-tt.cachedAge),
+				ProofData: "old-proof",
+			}
+			svc := newTestService(node, nil)
+
+			result, err := svc.VerifyWithProof("tx-1", "tracepost", "polkadot", "auto")
+			if err != nil {
+				t.Fatalf("VerifyWithProof() error = %v", err)
+			}
+			if (result.CachedAt != nil) != tt.wantCached {
+				t.Fatalf("cached = %v, want %v", result.CachedAt != nil, tt.wantCached)
+			}
+			if tt.wantCached {
+				if result.ProofData != "old-proof" || node.verifiedWith != "" {
+					t.Errorf("cached result = %+v, verified with %q", result, node.verifiedWith)
+				}
+				return
+			}
+			if !result.Verified || result.ProofData != "xcm-proof" || node.verifiedWith != "xcm" {
+				t.Errorf("result = %+v, verified with %q", result, node.verifiedWith)
+			}
+			if cached := node.cache["tx-1-tracepost-polkadot"]; !cached.Timestamp.Equal(testNow) {
+				t.Errorf("cache not refreshed: %+v", cached)
+			}
+		})
+	}
+}
+
+// fakeLedger serves anchored entities and their blockchain records from memory
+type fakeLedger struct {
+	batches map[string]int // "table/id" to the batch of the entity
+	records []AnchorRecord
+	err     error
+}
+
+func (l *fakeLedger) Entity(table string, id int) (int, string, bool, error) {
+	if l.err != nil {
+		return 0, "", false, l.err
+	}
+	batchID, ok := l.batches[fmt.Sprintf("%s/%d", table, id)]
+	return batchID, "", ok, nil
+}
+
+func (l *fakeLedger) Records(table string, id int) ([]AnchorRecord, error) {
+	return l.records, nil
+}
+
+func TestAnchoredRecords(t *testing.T) {
+	ledger := &fakeLedger{
+		batches: map[string]int{"event/7": 3},
+		records: []AnchorRecord{{TxID: "tx-1"}, {TxID: "tx-2"}},
+	}
+	svc := newTestService(newFakeNode(), nil)
+	svc.Ledger = ledger
+	var nodeErr error
+	svc.Transactions = func(table string, id int) ([]blockchain.Transaction, error) {
+		return []blockchain.Transaction{{TxID: "tx-2", Type: table}}, nodeErr
+	}
+
+	anchored, err := svc.EventRecords(7)
+	if err != nil {
+		t.Fatalf("EventRecords() error = %v", err)
+	}
+	if anchored.BatchID != 3 || len(anchored.Records) != 2 {
+		t.Fatalf("EventRecords() = %+v", anchored)
+	}
+	if anchored.Records[0].BlockchainTx != nil || anchored.Records[1].BlockchainTx == nil || anchored.Records[1].BlockchainTx.Type != AnchorEvent {
+		t.Errorf("records not matched with node transactions: %+v", anchored.Records)
+	}
+
+	if _, err := svc.BatchRecords(1); KindOf(err) != KindNotFound || err.Error() != "Batch not found" {
+		t.Errorf("BatchRecords() of a missing batch error = %v", err)
+	}
+
+	nodeErr = fmt.Errorf("%w from a to b", blockchain.ErrNoRoute)
+	_, err = svc.EventRecords(7)
+	if KindOf(err) != KindUpstream || !errors.Is(err, blockchain.ErrNoRoute) {
+		t.Errorf("EventRecords() node error = %v, want upstream wrapping the cause", err)
+	}
+
+	ledger.err = errors.New("connection reset")
+	if _, err := svc.EnvironmentRecords(1); KindOf(err) != KindInternal {
+		t.Errorf("EnvironmentRecords() database error kind = %q", KindOf(err))
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -14,6 +15,8 @@ import (
 	"time"
 
 	shell "github.com/ipfs/go-ipfs-api"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/faults"
 )
 
 // IPFSClient represents a client for interacting with IPFS
@@ -53,7 +56,8 @@ type IPFSMetadata struct {
 
 // NewIPFSClient creates a new IPFS client with optimized settings
 func NewIPFSClient(apiURL string) *IPFSClient {
-	shell := shell.NewShell(apiURL)
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment, DisableKeepAlives: true}
+	shell := shell.NewShellWithClient(apiURL, &http.Client{Transport: faults.Transport(transport, faults.TargetIPFS)})
 	shell.SetTimeout(30 * time.Second) // Set timeout to avoid hanging connections
 
 	return &IPFSClient{
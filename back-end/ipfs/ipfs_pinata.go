@@ -1,6 +1,7 @@
 package ipfs
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -98,6 +99,25 @@ func (s *IPFSPinataService) UploadFile(file multipart.File, filename string, met
 	return result, nil
 }
 
+// memoryFile serves generated content through the multipart.File interface
+type memoryFile struct {
+	*bytes.Reader
+}
+
+// Close implements multipart.File; there is nothing to release
+func (memoryFile) Close() error {
+	return nil
+}
+
+// UploadBytes uploads generated content, such as a rendered report, to IPFS and optionally pins it to Pinata
+func (s *IPFSPinataService) UploadBytes(content []byte, filename string, metadata map[string]string, pinToPinata bool) (*IPFSPinataResult, error) {
+	result, err := s.UploadFile(memoryFile{bytes.NewReader(content)}, filename, metadata, pinToPinata)
+	if result != nil {
+		result.Size = int64(len(content))
+	}
+	return result, err
+}
+
 // UploadJSON uploads JSON to IPFS and optionally pins it to Pinata
 func (s *IPFSPinataService) UploadJSON(data interface{}, name string, metadata map[string]string, pinToPinata bool) (*IPFSPinataResult, error) {
 	// Get a client from the pool
@@ -12,6 +12,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/faults"
+	"github.com/LTPPPP/TracePost-larvaeChain/secrets"
 )
 
 // PinataService represents a client for interacting with Pinata Cloud
@@ -82,9 +85,9 @@ type PinataRegion struct {
 // NewPinataService creates a new Pinata service
 func NewPinataService() *PinataService {
 	// Get Pinata JWT token from environment
-	jwt := os.Getenv("PINATA_JWT")
-	apiKey := os.Getenv("PINATA_API_KEY")
-	apiSecret := os.Getenv("PINATA_API_SECRET")
+	jwt := secrets.Getenv("PINATA_JWT", "")
+	apiKey := secrets.Getenv("PINATA_API_KEY", "")
+	apiSecret := secrets.Getenv("PINATA_API_SECRET", "")
 	
 	// Get Pinata Gateway URL
 	gatewayURL := os.Getenv("PINATA_GATEWAY_URL")
@@ -200,7 +203,7 @@ func (p *PinataService) PinFile(file multipart.File, filename string, metadata m
 	
 	// Execute the request with the context
 	req = req.WithContext(ctx)
-	client := &http.Client{}
+	client := &http.Client{Transport: faults.Transport(nil, faults.TargetIPFS)}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute request: %v", err)
@@ -281,7 +284,7 @@ func (p *PinataService) PinJSON(data interface{}, name string, metadata map[stri
 	
 	// Execute the request with the context
 	req = req.WithContext(ctx)
-	client := &http.Client{}
+	client := &http.Client{Transport: faults.Transport(nil, faults.TargetIPFS)}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute request: %v", err)
@@ -364,7 +367,7 @@ func (p *PinataService) PinByCID(cid string, name string, metadata map[string]st
 	
 	// Execute the request with the context
 	req = req.WithContext(ctx)
-	client := &http.Client{}
+	client := &http.Client{Transport: faults.Transport(nil, faults.TargetIPFS)}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute request: %v", err)
@@ -418,7 +421,7 @@ func (p *PinataService) UnpinByCID(cid string) error {
 	}
 	
 	// Execute the request
-	client := &http.Client{}
+	client := &http.Client{Transport: faults.Transport(nil, faults.TargetIPFS)}
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to execute request: %v", err)
@@ -464,7 +467,7 @@ func (p *PinataService) GetPinnedCIDs(metadata map[string]string) (*PinataPinned
 	}
 	
 	// Execute the request
-	client := &http.Client{}
+	client := &http.Client{Transport: faults.Transport(nil, faults.TargetIPFS)}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute request: %v", err)
@@ -535,7 +538,7 @@ func (p *PinataService) verifyPinGatewayAccess(cid string) error {
 		}
 		
 		// Execute the request
-		client := &http.Client{Timeout: 10 * time.Second}
+		client := &http.Client{Timeout: 10 * time.Second, Transport: faults.Transport(nil, faults.TargetIPFS)}
 		resp, err := client.Do(req)
 		if err != nil {
 			continue // Retry on error
@@ -571,7 +574,7 @@ func (p *PinataService) TestPinataConnection() error {
 		}
 		
 		// Execute the request with a timeout
-		client := &http.Client{Timeout: 10 * time.Second}
+		client := &http.Client{Timeout: 10 * time.Second, Transport: faults.Transport(nil, faults.TargetIPFS)}
 		resp, err := client.Do(req)
 		if err != nil {
 			return fmt.Errorf("failed to connect to Pinata Cloud: %v", err)
@@ -0,0 +1,239 @@
+package loadshed
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+)
+
+// Modes of the controller
+const (
+	ModeAuto = "auto" // degrade from the latency and queue depth signals
+	ModeOn   = "on"   // always degraded
+	ModeOff  = "off"  // never degraded
+)
+
+// latencyWeight is the weight of a new sample in the latency moving average
+const latencyWeight = 0.2
+
+// maxCachedResponses bounds the response cache; the oldest entry is evicted when it is full
+const maxCachedResponses = 5000
+
+// ErrInvalidMode is returned for a mode other than auto, on or off
+var ErrInvalidMode = errors.New("mode must be auto, on or off")
+
+// CachedResponse is a successful response kept to be served while degraded
+type CachedResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+	StoredAt    time.Time
+}
+
+// Status is a snapshot of the controller
+type Status struct {
+	Mode               string     `json:"mode"`
+	Degraded           bool       `json:"degraded"`
+	DegradedSince      *time.Time `json:"degraded_since,omitempty"`
+	InFlight           int        `json:"in_flight"`
+	LatencyMs          float64    `json:"latency_ms"` // Moving average
+	MaxInFlight        int        `json:"max_in_flight"`
+	LatencyThresholdMs int        `json:"latency_threshold_ms"`
+	CooldownSeconds    int        `json:"cooldown_seconds"`
+	CachedResponses    int        `json:"cached_responses"`
+	CacheHits          int64      `json:"cache_hits"`
+	LiteResponses      int64      `json:"lite_responses"`
+}
+
+// Controller decides when public endpoints are degraded
+// In auto mode it degrades once more than MaxInFlight requests are being served or the moving
+// average latency exceeds LatencyThreshold, and recovers after Cooldown without either signal
+type Controller struct {
+	MaxInFlight      int
+	LatencyThreshold time.Duration
+	Cooldown         time.Duration
+	CacheTTL         time.Duration
+
+	mu            sync.Mutex
+	mode          string
+	inFlight      int
+	latency       float64 // milliseconds
+	degraded      bool
+	degradedSince time.Time
+	lastOverload  time.Time
+	cache         map[string]CachedResponse
+	cacheHits     int64
+	liteResponses int64
+}
+
+var (
+	defaultController *Controller
+	once              sync.Once
+)
+
+// NewController creates a controller from the application config
+func NewController(cfg *config.Config) *Controller {
+	ctrl := &Controller{
+		MaxInFlight:      cfg.LoadShedMaxInFlight,
+		LatencyThreshold: time.Duration(cfg.LoadShedLatencyMs) * time.Millisecond,
+		Cooldown:         time.Duration(cfg.LoadShedCooldownSeconds) * time.Second,
+		CacheTTL:         time.Duration(cfg.LoadShedCacheSeconds) * time.Second,
+		mode:             ModeAuto,
+		cache:            make(map[string]CachedResponse),
+	}
+	if err := ctrl.SetMode(cfg.LoadShedMode); err != nil {
+		ctrl.mode = ModeAuto
+	}
+	return ctrl
+}
+
+// Default returns the process wide controller
+func Default() *Controller {
+	once.Do(func() {
+		defaultController = NewController(config.GetConfig())
+	})
+	return defaultController
+}
+
+// Begin records a request entering the server and returns the function that records it leaving
+func (ctrl *Controller) Begin() func() {
+	started := time.Now()
+	ctrl.mu.Lock()
+	ctrl.inFlight++
+	ctrl.evaluate(started)
+	ctrl.mu.Unlock()
+
+	return func() {
+		elapsed := float64(time.Since(started)) / float64(time.Millisecond)
+		ctrl.mu.Lock()
+		defer ctrl.mu.Unlock()
+		ctrl.inFlight--
+		if ctrl.latency == 0 {
+			ctrl.latency = elapsed
+		} else {
+			ctrl.latency = latencyWeight*elapsed + (1-latencyWeight)*ctrl.latency
+		}
+		ctrl.evaluate(time.Now())
+	}
+}
+
+// evaluate updates the degraded state from the signals; the caller holds the lock
+func (ctrl *Controller) evaluate(now time.Time) {
+	overloaded := (ctrl.MaxInFlight > 0 && ctrl.inFlight > ctrl.MaxInFlight) ||
+		(ctrl.LatencyThreshold > 0 && ctrl.latency > float64(ctrl.LatencyThreshold)/float64(time.Millisecond))
+	if overloaded {
+		ctrl.lastOverload = now
+		if !ctrl.degraded {
+			ctrl.degraded = true
+			ctrl.degradedSince = now
+		}
+		return
+	}
+	if ctrl.degraded && now.Sub(ctrl.lastOverload) >= ctrl.Cooldown {
+		ctrl.degraded = false
+	}
+}
+
+// Degraded reports whether expensive work should be skipped
+func (ctrl *Controller) Degraded() bool {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	switch ctrl.mode {
+	case ModeOn:
+		return true
+	case ModeOff:
+		return false
+	}
+	ctrl.evaluate(time.Now())
+	return ctrl.degraded
+}
+
+// SetMode sets auto, on or off
+func (ctrl *Controller) SetMode(mode string) error {
+	if mode != ModeAuto && mode != ModeOn && mode != ModeOff {
+		return ErrInvalidMode
+	}
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	ctrl.mode = mode
+	return nil
+}
+
+// Lookup returns a cached response that is younger than CacheTTL
+func (ctrl *Controller) Lookup(key string) (CachedResponse, bool) {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	resp, ok := ctrl.cache[key]
+	if !ok || time.Since(resp.StoredAt) > ctrl.CacheTTL {
+		return CachedResponse{}, false
+	}
+	ctrl.cacheHits++
+	return resp, true
+}
+
+// Store keeps a response to be served while degraded
+func (ctrl *Controller) Store(key string, status int, contentType string, body []byte) {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	if _, ok := ctrl.cache[key]; !ok && len(ctrl.cache) >= maxCachedResponses {
+		ctrl.evictOldest()
+	}
+	ctrl.cache[key] = CachedResponse{
+		Status:      status,
+		ContentType: contentType,
+		Body:        append([]byte(nil), body...),
+		StoredAt:    time.Now(),
+	}
+}
+
+// evictOldest removes the oldest cached response; the caller holds the lock
+func (ctrl *Controller) evictOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for key, resp := range ctrl.cache {
+		if oldestKey == "" || resp.StoredAt.Before(oldest) {
+			oldestKey, oldest = key, resp.StoredAt
+		}
+	}
+	delete(ctrl.cache, oldestKey)
+}
+
+// CountLite records a response that was built without its expensive parts
+func (ctrl *Controller) CountLite() {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	ctrl.liteResponses++
+}
+
+// Status returns a snapshot of the controller
+func (ctrl *Controller) Status() Status {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	ctrl.evaluate(time.Now())
+	degraded := ctrl.degraded
+	switch ctrl.mode {
+	case ModeOn:
+		degraded = true
+	case ModeOff:
+		degraded = false
+	}
+	status := Status{
+		Mode:               ctrl.mode,
+		Degraded:           degraded,
+		InFlight:           ctrl.inFlight,
+		LatencyMs:          ctrl.latency,
+		MaxInFlight:        ctrl.MaxInFlight,
+		LatencyThresholdMs: int(ctrl.LatencyThreshold / time.Millisecond),
+		CooldownSeconds:    int(ctrl.Cooldown / time.Second),
+		CachedResponses:    len(ctrl.cache),
+		CacheHits:          ctrl.cacheHits,
+		LiteResponses:      ctrl.liteResponses,
+	}
+	if ctrl.degraded && ctrl.mode == ModeAuto {
+		since := ctrl.degradedSince
+		status.DegradedSince = &since
+	}
+	return status
+}
@@ -0,0 +1,138 @@
+package mailer
+
+// Templates emails are rendered from; the layout and partials are shared by all of them
+const (
+	TemplateLayout            = "layout"
+	TemplateNotification      = "notification"
+	TemplateDigest            = "digest"
+	TemplateCompletenessNudge = "completeness_nudge"
+	TemplatePasswordReset     = "password_reset"
+	TemplateDocumentRequest   = "document_request"
+	TemplateGeofenceAlert     = "geofence_alert"
+)
+
+// PartialPrefix starts the names of partials, e.g. partial_button is used as {{template "button" .}}
+const PartialPrefix = "partial_"
+
+// builtIn is a template shipped with the code, used until an admin activates a version of their own
+type builtIn struct {
+	Description string
+	Subject     string
+	HTML        string
+	Text        string
+	Sample      map[string]interface{} // Data previews are rendered with
+}
+
+// textWrapperHTML renders the paragraphs of a plain text message
+const textWrapperHTML = `{{range .Paragraphs}}<p style="margin:0 0 16px;">{{range $i, $line := .}}{{if $i}}<br>{{end}}{{$line}}{{end}}</p>{{end}}`
+
+var builtIns = map[string]builtIn{
+	TemplateLayout: {
+		Description: "Page every HTML email is placed in; renders the content template with {{template \"content\" .}}",
+		HTML: `<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Subject}}</title>
+</head>
+<body style="margin:0;padding:0;background:#f4f6f8;font-family:Helvetica,Arial,sans-serif;color:#1f2933;">
+<table role="presentation" width="100%" cellpadding="0" cellspacing="0" style="background:#f4f6f8;padding:24px 0;">
+<tr><td align="center">
+<table role="presentation" width="600" cellpadding="0" cellspacing="0" style="max-width:600px;background:#ffffff;border-radius:6px;">
+<tr><td style="padding:24px 32px 0;">{{template "header" .}}</td></tr>
+<tr><td style="padding:16px 32px;font-size:15px;line-height:1.6;">{{template "content" .}}</td></tr>
+<tr><td style="padding:0 32px 24px;">{{template "footer" .}}</td></tr>
+</table>
+</td></tr>
+</table>
+</body>
+</html>`,
+	},
+	PartialPrefix + "header": {
+		Description: "Brand header at the top of every email",
+		HTML:        `<div style="font-size:20px;font-weight:bold;color:#0b6e99;">TracePost</div>`,
+		Text:        `TracePost`,
+	},
+	PartialPrefix + "footer": {
+		Description: "Footer at the bottom of every email",
+		HTML:        `<p style="margin:0;padding-top:12px;border-top:1px solid #e4e7eb;font-size:12px;color:#7b8794;">{{t "email_footer"}}</p>`,
+		Text:        `--` + "\n" + `{{t "email_footer"}}`,
+	},
+	PartialPrefix + "button": {
+		Description: "Call to action link, used with (dict \"URL\" ... \"Label\" ...)",
+		HTML:        `<p style="margin:24px 0;"><a href="{{.URL}}" style="display:inline-block;padding:12px 20px;background:#0b6e99;color:#ffffff;text-decoration:none;border-radius:4px;font-weight:bold;">{{.Label}}</a></p>`,
+		Text:        `{{.Label}}: {{.URL}}`,
+	},
+	TemplateNotification: {
+		Description: "Plain text notifications placed in the layout",
+		Subject:     `{{.Subject}}`,
+		HTML:        textWrapperHTML,
+		Text:        `{{.Body}}` + "\n\n" + `{{template "footer" .}}`,
+		Sample: map[string]interface{}{
+			"Subject": "Batch 42 is 60% complete and about to be shipped",
+			"Body":    "Hello Lan,\n\nBatch 42 has a pending shipment (7) but its traceability data is 60% complete, below the 80% expected.\n\nMissing documents: health_certificate",
+		},
+	},
+	TemplateDigest: {
+		Description: "Daily and weekly activity digests; the body is localized by the digest service",
+		Subject:     `{{.Subject}}`,
+		HTML:        textWrapperHTML,
+		Text:        `{{.Body}}`,
+		Sample: map[string]interface{}{
+			"Subject": "Daily digest for Minh Phu Hatchery, 2026-10-14",
+			"Body":    "Hello Lan,\n\nActivity of Minh Phu Hatchery from 2026-10-14 to 2026-10-14\n\nNew batches: 1\n  - #42 Penaeus vannamei, 500000 (Ca Mau)",
+		},
+	},
+	TemplateCompletenessNudge: {
+		Description: "Nudge about a batch whose data is incomplete before shipping",
+		Subject:     `{{.Subject}}`,
+		HTML:        textWrapperHTML,
+		Text:        `{{.Body}}` + "\n\n" + `{{template "footer" .}}`,
+		Sample: map[string]interface{}{
+			"Subject": "Batch 42 is 60% complete and about to be shipped",
+			"Body":    "Hello Lan,\n\nBatch 42 has a pending shipment (7) but its traceability data is 60% complete, below the 80% expected.",
+		},
+	},
+	TemplatePasswordReset: {
+		Description: "One time code to reset a password",
+		Subject:     `{{t "email_password_reset_subject"}}`,
+		HTML: `<p>{{t "email_password_reset_intro"}}</p>` +
+			`<p style="font-size:28px;font-weight:bold;letter-spacing:6px;margin:16px 0;">{{.Code}}</p>` +
+			`<p>{{t "email_password_reset_expiry" "Minutes" .Minutes}}</p>` +
+			`<p style="color:#7b8794;">{{t "email_password_reset_ignore"}}</p>`,
+		Text: `{{t "email_password_reset_intro"}}` + "\n\n" + `{{.Code}}` + "\n\n" +
+			`{{t "email_password_reset_expiry" "Minutes" .Minutes}}` + "\n" + `{{t "email_password_reset_ignore"}}` + "\n\n" + `{{template "footer" .}}`,
+		Sample: map[string]interface{}{"Code": "482913", "Minutes": 10},
+	},
+	TemplateDocumentRequest: {
+		Description: "Request for a counterparty to upload a document of a batch",
+		Subject:     `{{t "email_document_request_subject" "DocType" .DocType "BatchID" .BatchID}}`,
+		HTML: `<p>{{t "email_greeting" "Name" .Name}}</p>` +
+			`<p>{{t "email_document_request_intro" "Company" .Company "DocType" .DocType "BatchID" .BatchID "DueDate" .DueDate}}</p>` +
+			`{{if .Message}}<blockquote style="margin:16px 0;padding-left:12px;border-left:3px solid #e4e7eb;color:#52606d;">{{.Message}}</blockquote>{{end}}` +
+			`{{template "button" (dict "URL" .Link "Label" (t "email_document_request_button"))}}` +
+			`<p style="color:#7b8794;">{{t "email_document_request_expiry" "ExpiresAt" .ExpiresAt}}</p>`,
+		Text: `{{t "email_greeting" "Name" .Name}}` + "\n\n" +
+			`{{t "email_document_request_intro" "Company" .Company "DocType" .DocType "BatchID" .BatchID "DueDate" .DueDate}}` + "\n" +
+			`{{if .Message}}` + "\n" + `{{.Message}}` + "\n" + `{{end}}` + "\n" +
+			`{{template "button" (dict "URL" .Link "Label" (t "email_document_request_button"))}}` + "\n\n" +
+			`{{t "email_document_request_expiry" "ExpiresAt" .ExpiresAt}}` + "\n\n" + `{{template "footer" .}}`,
+		Sample: map[string]interface{}{
+			"Name": "Lan", "Company": "Minh Phu Hatchery", "DocType": "health certificate", "BatchID": 42,
+			"DueDate": "2026-10-20", "Message": "Please include the PCR results.",
+			"Link": "https://tracepost.example/supplier/upload?token=sample", "ExpiresAt": "2026-10-21 12:00 UTC",
+		},
+	},
+	TemplateGeofenceAlert: {
+		Description: "Alert raised when a shipment enters or leaves a geofence",
+		Subject:     `{{t "email_geofence_subject" "ShipmentCode" .ShipmentCode}}`,
+		HTML:        `<p>{{t "email_geofence_body" "ShipmentCode" .ShipmentCode "AlertType" .AlertType "Geofence" .Geofence "At" .At "Location" .Location}}</p>`,
+		Text: `{{t "email_geofence_body" "ShipmentCode" .ShipmentCode "AlertType" .AlertType "Geofence" .Geofence "At" .At "Location" .Location}}` +
+			"\n\n" + `{{template "footer" .}}`,
+		Sample: map[string]interface{}{
+			"ShipmentCode": "SHP-2026-0042", "AlertType": "exit", "Geofence": "Ca Mau farm zone",
+			"At": "2026-10-15T08:30:00Z", "Location": "9.1769,105.1524",
+		},
+	},
+}
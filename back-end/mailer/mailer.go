@@ -0,0 +1,523 @@
+package mailer
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	htmltemplate "html/template"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/components"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Formats templates are authored in
+const (
+	FormatHTML = "html"
+	FormatMJML = "mjml" // Compiled to HTML when saved; MJML templates are complete documents and skip the layout
+)
+
+// ErrTemplateNotFound is returned for a template or version that does not exist
+var ErrTemplateNotFound = errors.New("email template not found")
+
+// Translator formats a localized message, e.g. the Translate method of the i18n middleware
+type Translator func(messageID, lang string, data map[string]interface{}) string
+
+// Sender delivers an email with an HTML body and its plain text fallback
+type Sender func(to, subject, html, text string) error
+
+// Template is a version of an email template; version 0 is the built-in one
+type Template struct {
+	ID          int        `json:"id,omitempty"`
+	Name        string     `json:"name"`
+	Version     int        `json:"version"`
+	Format      string     `json:"format"`
+	Subject     string     `json:"subject"`
+	Source      string     `json:"source,omitempty"` // The MJML the HTML was compiled from
+	HTML        string     `json:"html"`
+	Text        string     `json:"text"` // Plain text fallback; derived from the HTML when empty
+	Notes       string     `json:"notes,omitempty"`
+	IsActive    bool       `json:"is_active"`
+	BuiltIn     bool       `json:"built_in"`
+	Description string     `json:"description,omitempty"`
+	CreatedBy   int        `json:"created_by,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+}
+
+// Message is a rendered email
+type Message struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// Mailer renders emails from templates and sends them
+type Mailer struct {
+	Translate       Translator
+	DefaultLanguage string
+	BaseURL         string
+	MJMLURL         string
+	MJMLAppID       string
+	MJMLSecretKey   string
+	HTTPClient      *http.Client
+	Send            Sender
+}
+
+var (
+	defaultMailer *Mailer
+	once          sync.Once
+)
+
+// NewMailer creates a mailer from the application config
+func NewMailer(cfg *config.Config) *Mailer {
+	return &Mailer{
+		DefaultLanguage: cfg.EmailDefaultLanguage,
+		BaseURL:         cfg.BaseURL,
+		MJMLURL:         cfg.MJMLAPIURL,
+		MJMLAppID:       cfg.MJMLAppID,
+		MJMLSecretKey:   cfg.MJMLSecretKey,
+		HTTPClient:      &http.Client{Timeout: 15 * time.Second},
+		Send:            components.SendHTMLEmail,
+	}
+}
+
+// Default returns the process wide mailer
+func Default() *Mailer {
+	once.Do(func() {
+		defaultMailer = NewMailer(config.GetConfig())
+	})
+	return defaultMailer
+}
+
+// Send renders a template in a language and emails it with the default mailer
+func Send(to, name, lang string, data map[string]interface{}) error {
+	return Default().SendTemplate(to, name, lang, data)
+}
+
+// SendText emails a plain text message placed in the layout, with the default mailer
+func SendText(to, subject, body string) error {
+	return Default().SendText(to, TemplateNotification, "", subject, body)
+}
+
+// SendTemplate renders a template in a language and emails it
+func (m *Mailer) SendTemplate(to, name, lang string, data map[string]interface{}) error {
+	msg, err := m.Render(name, lang, data)
+	if err != nil {
+		return err
+	}
+	return m.Send(to, msg.Subject, msg.HTML, msg.Text)
+}
+
+// SendText emails a plain text message with a template that places it in the layout, such as the notification template
+func (m *Mailer) SendText(to, name, lang, subject, body string) error {
+	return m.SendTemplate(to, name, lang, TextData(subject, body))
+}
+
+// TextData is the data of templates wrapping a plain text message
+func TextData(subject, body string) map[string]interface{} {
+	paragraphs := [][]string{}
+	for _, paragraph := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		if paragraph = strings.Trim(paragraph, "\n"); paragraph != "" {
+			paragraphs = append(paragraphs, strings.Split(paragraph, "\n"))
+		}
+	}
+	return map[string]interface{}{"Subject": subject, "Body": body, "Paragraphs": paragraphs}
+}
+
+// IsKnown reports whether a template name is one the code renders
+func IsKnown(name string) bool {
+	_, ok := builtIns[name]
+	return ok
+}
+
+// Names lists the templates, the layout and partials first
+func Names() []string {
+	names := make([]string, 0, len(builtIns))
+	for name := range builtIns {
+		names = append(names, name)
+	}
+	rank := func(name string) int {
+		switch {
+		case name == TemplateLayout:
+			return 0
+		case strings.HasPrefix(name, PartialPrefix):
+			return 1
+		}
+		return 2
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if rank(names[i]) != rank(names[j]) {
+			return rank(names[i]) < rank(names[j])
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// SampleData is the data previews of a template are rendered with
+func SampleData(name string) map[string]interface{} {
+	data := map[string]interface{}{}
+	for key, value := range builtIns[name].Sample {
+		data[key] = value
+	}
+	return data
+}
+
+// builtInTemplate returns the version of a template shipped with the code
+func builtInTemplate(name string) Template {
+	b := builtIns[name]
+	return Template{
+		Name:        name,
+		Format:      FormatHTML,
+		Subject:     b.Subject,
+		HTML:        b.HTML,
+		Text:        b.Text,
+		BuiltIn:     true,
+		Description: b.Description,
+	}
+}
+
+const templateColumns = `id, name, version, format, subject, source, html, text, COALESCE(notes, ''), is_active,
+	COALESCE(created_by, 0), created_at, activated_at`
+
+func scanTemplate(row interface{ Scan(...interface{}) error }) (Template, error) {
+	var t Template
+	var createdAt time.Time
+	var activatedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.Name, &t.Version, &t.Format, &t.Subject, &t.Source, &t.HTML, &t.Text, &t.Notes, &t.IsActive,
+		&t.CreatedBy, &createdAt, &activatedAt)
+	if err != nil {
+		return t, err
+	}
+	t.CreatedAt = &createdAt
+	if activatedAt.Valid {
+		t.ActivatedAt = &activatedAt.Time
+	}
+	t.Description = builtIns[t.Name].Description
+	return t, nil
+}
+
+// Active returns the version of a template emails are rendered from, the built-in one when none was activated
+func Active(name string) (Template, error) {
+	if !IsKnown(name) {
+		return Template{}, ErrTemplateNotFound
+	}
+	if db.DB != nil {
+		t, err := scanTemplate(db.DB.QueryRow(`SELECT `+templateColumns+` FROM email_template WHERE name = $1 AND is_active = true`, name))
+		if err == nil {
+			return t, nil
+		}
+		if err != sql.ErrNoRows {
+			return Template{}, err
+		}
+	}
+	t := builtInTemplate(name)
+	t.IsActive = true
+	return t, nil
+}
+
+// Version returns a saved version of a template, 0 being the built-in one
+func Version(name string, version int) (Template, error) {
+	if !IsKnown(name) {
+		return Template{}, ErrTemplateNotFound
+	}
+	if version == 0 {
+		t := builtInTemplate(name)
+		var saved bool
+		db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM email_template WHERE name = $1 AND is_active = true)", name).Scan(&saved)
+		t.IsActive = !saved
+		return t, nil
+	}
+	t, err := scanTemplate(db.DB.QueryRow(`SELECT `+templateColumns+` FROM email_template WHERE name = $1 AND version = $2`, name, version))
+	if err == sql.ErrNoRows {
+		return Template{}, ErrTemplateNotFound
+	}
+	return t, err
+}
+
+// Versions lists the saved versions of a template, newest first, followed by the built-in one
+func Versions(name string) ([]Template, error) {
+	if !IsKnown(name) {
+		return nil, ErrTemplateNotFound
+	}
+	rows, err := db.DB.Query(`SELECT `+templateColumns+` FROM email_template WHERE name = $1 ORDER BY version DESC`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []Template{}
+	anyActive := false
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		anyActive = anyActive || t.IsActive
+		versions = append(versions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	builtIn := builtInTemplate(name)
+	builtIn.IsActive = !anyActive
+	return append(versions, builtIn), nil
+}
+
+// SaveVersion validates a new version of a template, compiling MJML, and stores it as the next version
+func (m *Mailer) SaveVersion(t Template, activate bool) (Template, error) {
+	if !IsKnown(t.Name) {
+		return Template{}, ErrTemplateNotFound
+	}
+	if t.Format == "" {
+		t.Format = FormatHTML
+	}
+	switch t.Format {
+	case FormatHTML:
+		t.Source = ""
+	case FormatMJML:
+		if t.Name == TemplateLayout || strings.HasPrefix(t.Name, PartialPrefix) {
+			return Template{}, fmt.Errorf("the layout and partials must be HTML")
+		}
+		compiled, err := m.compileMJML(t.Source)
+		if err != nil {
+			return Template{}, err
+		}
+		t.HTML = compiled
+	default:
+		return Template{}, fmt.Errorf("format must be html or mjml")
+	}
+	if _, err := m.render(t, m.DefaultLanguage, SampleData(t.Name)); err != nil {
+		return Template{}, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Template{}, err
+	}
+	defer tx.Rollback()
+	// Versions of a template are numbered one after another; the lock keeps concurrent saves from sharing one
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('email_template:' || $1))", t.Name); err != nil {
+		return Template{}, err
+	}
+	saved, err := scanTemplate(tx.QueryRow(`
+		INSERT INTO email_template (name, version, format, subject, source, html, text, notes, created_by)
+		VALUES ($1, (SELECT COALESCE(MAX(version), 0) + 1 FROM email_template WHERE name = $1), $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, 0))
+		RETURNING `+templateColumns,
+		t.Name, t.Format, t.Subject, t.Source, t.HTML, t.Text, t.Notes, t.CreatedBy))
+	if err != nil {
+		return Template{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Template{}, err
+	}
+	if activate {
+		return Activate(saved.Name, saved.Version)
+	}
+	return saved, nil
+}
+
+// Activate makes a version the one emails are rendered from; version 0 goes back to the built-in template
+func Activate(name string, version int) (Template, error) {
+	if !IsKnown(name) {
+		return Template{}, ErrTemplateNotFound
+	}
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Template{}, err
+	}
+	defer tx.Rollback()
+
+	if version != 0 {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM email_template WHERE name = $1 AND version = $2)", name, version).Scan(&exists); err != nil {
+			return Template{}, err
+		}
+		if !exists {
+			return Template{}, ErrTemplateNotFound
+		}
+	}
+	if _, err := tx.Exec(`
+		UPDATE email_template
+		SET is_active = (version = $2), activated_at = CASE WHEN version = $2 THEN NOW() ELSE activated_at END
+		WHERE name = $1
+	`, name, version); err != nil {
+		return Template{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Template{}, err
+	}
+	return Version(name, version)
+}
+
+// Render renders the active version of a template in a language
+func (m *Mailer) Render(name, lang string, data map[string]interface{}) (Message, error) {
+	t, err := Active(name)
+	if err != nil {
+		return Message{}, err
+	}
+	return m.render(t, lang, data)
+}
+
+// Preview renders any version of a template, or an unsaved draft, with the active layout and partials
+func (m *Mailer) Preview(t Template, lang string, data map[string]interface{}) (Message, error) {
+	if t.Format == FormatMJML && t.Source != "" {
+		compiled, err := m.compileMJML(t.Source)
+		if err != nil {
+			return Message{}, err
+		}
+		t.HTML = compiled
+	}
+	return m.render(t, lang, data)
+}
+
+// render renders a template version; the layout and partials are always their active versions
+func (m *Mailer) render(t Template, lang string, data map[string]interface{}) (Message, error) {
+	if lang == "" {
+		lang = m.DefaultLanguage
+	}
+	values := map[string]interface{}{}
+	for key, value := range data {
+		values[key] = value
+	}
+	values["Lang"] = lang
+	values["BaseURL"] = strings.TrimRight(m.BaseURL, "/")
+	values["Year"] = time.Now().Year()
+
+	funcs := map[string]interface{}{
+		"t": func(messageID string, pairs ...interface{}) string {
+			args := map[string]interface{}{}
+			for i := 0; i+1 < len(pairs); i += 2 {
+				args[fmt.Sprint(pairs[i])] = pairs[i+1]
+			}
+			if m.Translate == nil {
+				return messageID
+			}
+			return m.Translate(messageID, lang, args)
+		},
+		"dict": func(pairs ...interface{}) map[string]interface{} {
+			dict := map[string]interface{}{}
+			for i := 0; i+1 < len(pairs); i += 2 {
+				dict[fmt.Sprint(pairs[i])] = pairs[i+1]
+			}
+			return dict
+		},
+	}
+
+	partials := map[string]Template{}
+	for _, name := range Names() {
+		if strings.HasPrefix(name, PartialPrefix) {
+			partial := t
+			if name != t.Name {
+				var err error
+				if partial, err = Active(name); err != nil {
+					return Message{}, err
+				}
+			}
+			partials[strings.TrimPrefix(name, PartialPrefix)] = partial
+		}
+	}
+
+	var msg Message
+	subject, err := texttemplate.New("subject").Funcs(funcs).Parse(t.Subject)
+	if err != nil {
+		return Message{}, fmt.Errorf("subject: %w", err)
+	}
+	var out bytes.Buffer
+	if err := subject.Execute(&out, values); err != nil {
+		return Message{}, fmt.Errorf("subject: %w", err)
+	}
+	msg.Subject = strings.TrimSpace(out.String())
+	values["Subject"] = msg.Subject
+
+	// HTML: the content inside the layout, or an MJML document on its own
+	layout := t
+	if t.Name != TemplateLayout {
+		if layout, err = Active(TemplateLayout); err != nil {
+			return Message{}, err
+		}
+	}
+	root := htmltemplate.New("root").Funcs(funcs)
+	if t.Format == FormatMJML {
+		_, err = root.Parse(t.HTML)
+	} else {
+		_, err = root.Parse(layout.HTML)
+		if err == nil && t.Name != TemplateLayout {
+			_, err = root.New("content").Parse(t.HTML)
+		}
+		if err == nil && t.Name == TemplateLayout {
+			_, err = root.New("content").Parse(textWrapperHTML)
+		}
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("html: %w", err)
+	}
+	for name, partial := range partials {
+		if _, err := root.New(name).Parse(partial.HTML); err != nil {
+			return Message{}, fmt.Errorf("html partial %s: %w", name, err)
+		}
+	}
+	out.Reset()
+	if err := root.ExecuteTemplate(&out, "root", values); err != nil {
+		return Message{}, fmt.Errorf("html: %w", err)
+	}
+	msg.HTML = out.String()
+
+	// Plain text: the fallback template, or the HTML turned into text
+	if strings.TrimSpace(t.Text) == "" {
+		msg.Text = HTMLToText(msg.HTML)
+		return msg, nil
+	}
+	text := texttemplate.New("root").Funcs(funcs)
+	if _, err := text.Parse(t.Text); err != nil {
+		return Message{}, fmt.Errorf("text: %w", err)
+	}
+	for name, partial := range partials {
+		if _, err := text.New(name).Parse(partial.Text); err != nil {
+			return Message{}, fmt.Errorf("text partial %s: %w", name, err)
+		}
+	}
+	out.Reset()
+	if err := text.ExecuteTemplate(&out, "root", values); err != nil {
+		return Message{}, fmt.Errorf("text: %w", err)
+	}
+	msg.Text = strings.TrimSpace(out.String()) + "\n"
+	return msg, nil
+}
+
+var (
+	htmlHidden     = regexp.MustCompile(`(?is)<(head|style|script)[^>]*>.*?</(head|style|script)>`)
+	htmlLink       = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+	htmlLineBreak  = regexp.MustCompile(`(?i)<br\s*/?>`)
+	htmlBlockEnd   = regexp.MustCompile(`(?i)</(p|div|tr|h[1-6]|li|blockquote|table)>`)
+	htmlTag        = regexp.MustCompile(`(?s)<[^>]+>`)
+	textBlankLines = regexp.MustCompile(`\n{3,}`)
+	textSpaces     = regexp.MustCompile(`[ \t]+`)
+)
+
+// HTMLToText derives a plain text fallback from an HTML email
+func HTMLToText(body string) string {
+	body = htmlHidden.ReplaceAllString(body, "")
+	body = htmlLink.ReplaceAllString(body, "$2 ($1)")
+	body = htmlLineBreak.ReplaceAllString(body, "\n")
+	body = htmlBlockEnd.ReplaceAllString(body, "\n\n")
+	body = htmlTag.ReplaceAllString(body, "")
+	body = html.UnescapeString(body)
+
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(textSpaces.ReplaceAllString(line, " "))
+	}
+	body = textBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(body) + "\n"
+}
@@ -0,0 +1,68 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// compileMJML renders MJML to HTML with the MJML API, or a self-hosted server speaking the same protocol
+// Template actions such as {{.Name}} pass through MJML as text and are executed after compilation
+func (m *Mailer) compileMJML(source string) (string, error) {
+	if strings.TrimSpace(source) == "" {
+		return "", fmt.Errorf("mjml source is required")
+	}
+	if m.MJMLURL == "" {
+		return "", fmt.Errorf("MJML rendering is not configured")
+	}
+
+	body, err := json.Marshal(map[string]string{"mjml": source})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", m.MJMLURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.MJMLAppID != "" {
+		req.SetBasicAuth(m.MJMLAppID, m.MJMLSecretKey)
+	}
+
+	resp, err := m.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("mjml render failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		HTML    string `json:"html"`
+		Message string `json:"message"`
+		Errors  []struct {
+			Line      int    `json:"line"`
+			Message   string `json:"message"`
+			TagName   string `json:"tagName"`
+			Formatted string `json:"formattedMessage"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("mjml render returned HTTP %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mjml render returned HTTP %d: %s", resp.StatusCode, result.Message)
+	}
+	if len(result.Errors) > 0 {
+		messages := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			if e.Formatted != "" {
+				messages = append(messages, e.Formatted)
+			} else {
+				messages = append(messages, fmt.Sprintf("line %d: %s", e.Line, e.Message))
+			}
+		}
+		return "", fmt.Errorf("invalid mjml: %s", strings.Join(messages, "; "))
+	}
+	return result.HTML, nil
+}
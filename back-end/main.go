@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -12,12 +13,35 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/swagger"
 	"github.com/joho/godotenv"
+	"github.com/LTPPPP/TracePost-larvaeChain/accesslog"
+	"github.com/LTPPPP/TracePost-larvaeChain/announcements"
+	"github.com/LTPPPP/TracePost-larvaeChain/attestation"
 	"github.com/LTPPPP/TracePost-larvaeChain/api"
 	"github.com/LTPPPP/TracePost-larvaeChain/analytics"
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/chainsync"
+	"github.com/LTPPPP/TracePost-larvaeChain/completeness"
 	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/datamigration"
 	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/digest"
+	"github.com/LTPPPP/TracePost-larvaeChain/eventbus"
+	"github.com/LTPPPP/TracePost-larvaeChain/fees"
+	"github.com/LTPPPP/TracePost-larvaeChain/indexer"
+	"github.com/LTPPPP/TracePost-larvaeChain/mailer"
+	"github.com/LTPPPP/TracePost-larvaeChain/nodehealth"
+	"github.com/LTPPPP/TracePost-larvaeChain/nonces"
+	"github.com/LTPPPP/TracePost-larvaeChain/refdata"
+	"github.com/LTPPPP/TracePost-larvaeChain/retention"
+	"github.com/LTPPPP/TracePost-larvaeChain/signing"
+	"github.com/LTPPPP/TracePost-larvaeChain/sla"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+	"github.com/LTPPPP/TracePost-larvaeChain/tracesnapshot"
+	"github.com/LTPPPP/TracePost-larvaeChain/usage"
+	"github.com/LTPPPP/TracePost-larvaeChain/warehouse"
 	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
 	"github.com/LTPPPP/TracePost-larvaeChain/components"
 )
@@ -63,7 +87,7 @@ func main() {
 	langSelectorConfig := components.LanguageSelectorConfig{
 		DefaultLanguage: "en",
 		Persist:         true,
-		CookieName:      "lang_preference",
+		CookieName:      components.LanguageCookieName,
 		CookieMaxAge:    30 * 24 * 60 * 60, // 30 days
 	}
 	langSelector := components.NewLanguageSelector(i18n, langSelectorConfig)
@@ -76,13 +100,99 @@ func main() {
 		}
 	}
 	
-	// Initialize NFT monitoring system
-	nftMonitor := db.NewNFTMonitor()
+	// Configure the transaction signing backend
+	if signer, err := blockchain.NewSignerFromConfig(cfg); errors.Is(err, blockchain.ErrSignerNotConfigured) {
+		log.Printf("Warning: %v", err)
+		log.Println("Blockchain transactions will be submitted unsigned")
+	} else if err != nil {
+		log.Fatalf("Failed to initialize %s signer: %v", cfg.BlockchainSigner, err)
+	} else {
+		blockchain.SetDefaultSigner(signer)
+		log.Printf("Blockchain transactions are signed by %s (%s)", signer.Address(), signer.Backend())
+	}
+	
+	// Probe the blockchain nodes and switch clients to a healthy fallback when the configured node degrades
+	nodehealth.Default().Start()
+	
+	// Initialize NFT monitoring system; checkpoints record the chain head so admins can see its lag
+	nftMonitor := db.DefaultNFTMonitor()
+	nftMonitor.LatestBlock = blockchain.NewBlockchainClient(
+		cfg.BlockchainNodeURL,
+		cfg.BlockchainPrivateKey,
+		cfg.BlockchainAccount,
+		cfg.BlockchainChainID,
+		cfg.BlockchainConsensus,
+	).GetLatestBlockNumber
 	nftMonitor.StartMonitoring()
 	
 	// Initialize analytics service
 	analytics.InitAnalytics()
 
+	// Record gas and fees of on-chain operations against company budgets
+	fees.InitFeeAccounting()
+
+	// Allocate nonces of signing accounts from the database so concurrent submissions never collide
+	nonces.InitNonceStore()
+
+	// Track confirmation depth of anchored records
+	confirmationIndexer := indexer.NewConfirmationIndexer(cfg)
+	confirmationIndexer.Start()
+
+	// Retry webhook deliveries that failed or were interrupted
+	webhooks.Default().Start()
+
+	// Push updates of shared batches to their destination chains
+	chainsync.Default().Start()
+
+	// Write metered API usage to the daily usage table
+	usage.Default().Start()
+
+	// Backfill data migrations that are rolling out
+	datamigration.Default().Start()
+
+	// Export finished days to Parquet for the warehouse
+	warehouse.Default().Start()
+
+	// Publish domain events to Kafka or NATS when a broker is configured
+	eventbus.Default().Start()
+
+	// Email daily and weekly activity digests in each user's language
+	digests := digest.Default()
+	if i18n != nil {
+		digests.Translate = i18n.Translate
+		// Email templates are localized with the same message catalog
+		mailer.Default().Translate = i18n.Translate
+	}
+	digests.Start()
+
+	// Nudge users shipping batches whose data is less complete than their company expects
+	completeness.Default().Start()
+
+	// Pull the species catalog and rule sets written in other regions
+	refdata.Default().Start()
+
+	// Create and rotate the keys access tokens and outbound payloads are signed with
+	signing.Default().Start()
+
+	// Seal the document access log into a hash chain and anchor its head on-chain
+	accesslog.Default().Start()
+
+	// Publish IPFS snapshots of the public trace of finished batches
+	snapshots := tracesnapshot.Default()
+	snapshots.Render = api.RenderPublicTrace
+	snapshots.Start()
+
+	// Destroy documents past their retention period, logging signed and anchored destruction records
+	documentRetention := retention.Default()
+	documentRetention.Held = api.DocumentUnderLegalHold
+	documentRetention.Start()
+
+	// Measure partner SLAs against transfer events and documents, notifying both partners of each breach
+	sla.Default().Start()
+
+	// Retry the on-chain anchors of traceability attestations that failed when issued
+	attestation.Default().Start()
+
 	// Create a new Fiber app with optimized configuration
 	app := fiber.New(fiber.Config{
 		AppName:               "TracePost-larvaeChain",
@@ -90,7 +200,7 @@ func main() {
 		ReadTimeout:           time.Duration(cfg.ServerTimeout) * time.Second,
 		WriteTimeout:          time.Duration(cfg.ServerTimeout) * time.Second,
 		IdleTimeout:           time.Duration(getEnvAsInt("SERVER_IDLE_TIMEOUT", 60)) * time.Second,
-		BodyLimit:             getEnvAsInt("SERVER_BODY_LIMIT", 10) * 1024 * 1024, // Default 10MB
+		BodyLimit:             serverBodyLimit(cfg), // Per-route limits are enforced by the API body policies
 		Concurrency:           getEnvAsInt("SERVER_CONCURRENCY", 256 * 1024),      // Default 256K
 		DisableStartupMessage: getEnvAsBool("DISABLE_STARTUP_MESSAGE", false),
 		EnablePrintRoutes:     getEnvAsBool("ENABLE_PRINT_ROUTES", false),
@@ -104,6 +214,8 @@ func main() {
 
 	// Use global middlewares
 	app.Use(recover.New())
+	// Tag every request with a correlation ID, reusing the X-Request-ID sent by the client or proxy
+	app.Use(requestid.New())
 	app.Use(middleware.LoggerMiddleware())
 	
 	// Security middleware
@@ -135,16 +247,25 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "*",
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-DID, X-DID-Proof",
-		ExposeHeaders:    "Content-Length, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-DID, X-DID-Proof, X-Locale, X-Unit-System, X-Timezone, X-Localized-Display, X-Request-ID, X-Bot-Pass",
+		ExposeHeaders:    "Content-Length, Authorization, Content-Language, X-Unit-System, X-Timezone, X-Subscription-Warning, X-Degraded, X-Cache, X-Request-ID, X-Bot-Challenge, X-Maintenance, X-Maintenance-Ends, X-Maintenance-Announcement",
 		AllowCredentials: true,
 	}))
 	
 	// Internationalization middleware
 	if i18n != nil {
-		app.Use(middleware.I18nMiddleware(i18n))
+		app.Use(middleware.I18nMiddleware(i18n, api.LoadPreferredLanguage))
 	}
 
+	// Locale, unit and time zone formatting of JSON responses
+	app.Use(middleware.ResponseFormatting(api.LoadDisplayPreferences))
+
+	// Flag responses sent during an announced maintenance window
+	app.Use(middleware.MaintenanceNotice(announcements.Default()))
+
+	// Count API calls per company, API key and route for usage reports
+	app.Use(middleware.UsageMetering(usage.Default(), "/api/", api.ErrorStatus))
+
 	// Setup Swagger
 	app.Get("/swagger/*", swagger.New(swagger.Config{
 		URL:         "/swagger/doc.json",
@@ -164,6 +285,15 @@ func main() {
 	log.Fatal(app.Listen(":" + cfg.ServerPort))
 }
 
+// serverBodyLimit is the largest body the server reads, which must fit the largest per-route limit
+func serverBodyLimit(cfg *config.Config) int {
+	limit := cfg.UploadBodyLimitMB * 1024 * 1024
+	if jsonLimit := cfg.JSONBodyLimitKB * 1024; jsonLimit > limit {
+		limit = jsonLimit
+	}
+	return limit
+}
+
 // Helper functions for environment variables
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyPolicy limits the size and the content types of request bodies
+type BodyPolicy struct {
+	Limit        int      // largest accepted body in bytes
+	ContentTypes []string // accepted media types; empty accepts any
+}
+
+// bodyRoute applies a policy to the requests matching a method and a route pattern
+type bodyRoute struct {
+	method   string
+	segments []string
+	policy   BodyPolicy
+}
+
+// BodyPolicies picks the body policy of a request from its route, falling back to a default.
+// Routes are matched by path because the policy must run before the group middleware of the route
+type BodyPolicies struct {
+	Default BodyPolicy
+	// Strict rejects bodies with a content type the policy does not accept; otherwise only the size is checked
+	Strict bool
+	routes []bodyRoute
+}
+
+// Route applies a policy to a route; the pattern uses the route syntax of Fiber, e.g. /api/v1/broodstock/:id/documents
+func (p *BodyPolicies) Route(method, pattern string, policy BodyPolicy) *BodyPolicies {
+	p.routes = append(p.routes, bodyRoute{
+		method:   method,
+		segments: strings.Split(strings.Trim(pattern, "/"), "/"),
+		policy:   policy,
+	})
+	return p
+}
+
+// policyFor returns the policy of a request
+func (p *BodyPolicies) policyFor(method, path string) BodyPolicy {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, route := range p.routes {
+		if route.method == method && matchSegments(route.segments, segments) {
+			return route.policy
+		}
+	}
+	return p.Default
+}
+
+// matchSegments matches a path against a route pattern, where :name segments match any value
+func matchSegments(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i, segment := range pattern {
+		if strings.HasPrefix(segment, ":") {
+			if path[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Handler rejects request bodies larger than the limit of their route with 413
+// and bodies of a content type the route does not accept with 415
+func (p *BodyPolicies) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		default:
+			return c.Next()
+		}
+
+		size := len(c.Body())
+		if declared := c.Request().Header.ContentLength(); declared > size {
+			size = declared
+		}
+		if size == 0 {
+			return c.Next()
+		}
+
+		policy := p.policyFor(c.Method(), c.Path())
+		if policy.Limit > 0 && size > policy.Limit {
+			return fiber.NewError(fiber.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Request body of %s exceeds the %s limit of this endpoint", formatBytes(size), formatBytes(policy.Limit)))
+		}
+
+		if p.Strict && len(policy.ContentTypes) > 0 {
+			mediaType := strings.ToLower(strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0]))
+			accepted := false
+			for _, contentType := range policy.ContentTypes {
+				if mediaType == contentType {
+					accepted = true
+					break
+				}
+			}
+			if !accepted {
+				if mediaType == "" {
+					mediaType = "missing"
+				}
+				return fiber.NewError(fiber.StatusUnsupportedMediaType,
+					fmt.Sprintf("Content-Type %s is not supported by this endpoint; use %s", mediaType, strings.Join(policy.ContentTypes, " or ")))
+			}
+		}
+		return c.Next()
+	}
+}
+
+// formatBytes formats a size in the largest whole unit
+func formatBytes(size int) string {
+	switch {
+	case size >= 1024*1024 && size%(1024*1024) == 0:
+		return fmt.Sprintf("%d MB", size/(1024*1024))
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%d KB", size/1024)
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/botguard"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// BotPassHeader carries the pass a client got by solving a challenge
+const BotPassHeader = "X-Bot-Pass"
+
+// BotChallengeHeader carries the challenge a client must solve before it is served
+const BotChallengeHeader = "X-Bot-Challenge"
+
+// BotProtection challenges bots on a public route while the guard protects it.
+// Clients sending a valid access token are authenticated API clients and are never challenged
+func BotProtection(guard *botguard.Guard, route string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !guard.Enabled(route) || c.Method() == fiber.MethodOptions || hasValidAccessToken(c) {
+			return c.Next()
+		}
+
+		key := botguard.ClientKey(c.IP())
+		if filledHoneypot(c, guard.HoneypotField) {
+			guard.TripHoneypot(key)
+			// Answer as if the request succeeded, so the bot has no reason to try something else
+			return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"success": true, "message": "Request received"})
+		}
+
+		switch guard.Check(key, c.Get(fiber.HeaderUserAgent), c.Get(BotPassHeader)) {
+		case botguard.Block:
+			return fiber.NewError(fiber.StatusForbidden, "Request blocked")
+		case botguard.Challenge:
+			c.Set(BotChallengeHeader, guard.Issue(key).Header())
+			return fiber.NewError(fiber.StatusForbidden, "Challenge required: solve the challenge in the "+BotChallengeHeader+
+				" header through POST /api/v1/challenge/verify and send the pass in the "+BotPassHeader+" header")
+		}
+		return c.Next()
+	}
+}
+
+// hasValidAccessToken reports whether the request carries a valid, unrevoked access token
+func hasValidAccessToken(c *fiber.Ctx) bool {
+	authHeader := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return false
+	}
+	claims := &models.JWTClaims{}
+	token, err := jwt.ParseWithClaims(strings.TrimPrefix(authHeader, "Bearer "), claims, TokenKeyFunc)
+	return err == nil && token.Valid && IsUserSession(claims) && !IsTokenRevoked(claims.ID)
+}
+
+// filledHoneypot reports whether a JSON or form body fills in the honeypot field, which real forms hide from people
+func filledHoneypot(c *fiber.Ctx, field string) bool {
+	if field == "" || len(c.Body()) == 0 {
+		return false
+	}
+	if strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		var body map[string]interface{}
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return false
+		}
+		value, ok := body[field]
+		return ok && value != nil && value != ""
+	}
+	return c.FormValue(field) != ""
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// RoleClient is the role of requests made with a client_credentials access token
+const RoleClient = "client"
+
+// ClientChecker reports whether an API client may still use its tokens, recording that it did
+type ClientChecker func(clientID string) (bool, error)
+
+// ClientCredentials authenticates machine integrations by an access token from the client_credentials grant.
+// User session tokens are refused, and tokens of a revoked client stop working before they expire.
+// The client's company is set as the caller's company and its calls are metered under its client ID
+func ClientCredentials(active ClientChecker) fiber.Handler {
+	issuer := config.GetConfig().JWTIssuer
+
+	return func(c *fiber.Ctx) error {
+		tokenString := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+		if tokenString == "" || tokenString == c.Get("Authorization") {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="integrations"`)
+			return fiber.NewError(fiber.StatusUnauthorized, "A client_credentials access token is required as 'Bearer your-token'")
+		}
+
+		claims := &models.ClientClaims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, TokenKeyFunc)
+		if err != nil || !token.Valid || claims.ClientID == "" || claims.TokenUse != models.TokenUseClient || (issuer != "" && claims.Issuer != issuer) {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="integrations", error="invalid_token"`)
+			return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired client access token")
+		}
+
+		ok, err := active(claims.ClientID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check the API client")
+		}
+		if !ok {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="integrations", error="invalid_token"`)
+			return fiber.NewError(fiber.StatusUnauthorized, "The API client has been revoked")
+		}
+
+		c.Locals("role", RoleClient)
+		c.Locals("companyID", claims.CompanyID)
+		c.Locals("clientID", claims.ClientID)
+		c.Locals("scopes", strings.Fields(claims.Scope))
+		c.Locals("apiKey", "oauth_client:"+claims.ClientID)
+		return c.Next()
+	}
+}
+
+// RequireScope refuses client requests whose token does not carry a scope. Requests naming a company in the
+// companyId route parameter must name the client's own company
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scopes, _ := c.Locals("scopes").([]string)
+		granted := false
+		for _, s := range scopes {
+			if s == scope {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="integrations", error="insufficient_scope", scope="`+scope+`"`)
+			return fiber.NewError(fiber.StatusForbidden, "The access token does not carry the '"+scope+"' scope")
+		}
+
+		if param := c.Params("companyId"); param != "" {
+			companyID, _ := c.Locals("companyID").(int)
+			if param != strconv.Itoa(companyID) {
+				return fiber.NewError(fiber.StatusForbidden, "API clients can only reach their own company")
+			}
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/faults"
+)
+
+// FaultInjection arms the fault rules of the route of each request while the request is served
+func FaultInjection(injector *faults.Injector) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ids := injector.Activate(c.Method(), c.Path())
+		defer injector.Deactivate(ids)
+		return c.Next()
+	}
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/features"
+)
+
+// RequireFeature rejects requests from companies the feature flag is not rolled out to
+func RequireFeature(key string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		companyID, _ := c.Locals("companyID").(int)
+		if !features.Default().Enabled(key, companyID) {
+			return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("The %s feature is not enabled for your company", key))
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/signing"
+	"github.com/LTPPPP/TracePost-larvaeChain/utils"
+)
+
+// DisplayPreferences are a user's defaults for how responses are formatted
+type DisplayPreferences struct {
+	Locale     string `json:"locale"`
+	UnitSystem string `json:"unit_system"`
+	Timezone   string `json:"timezone"`
+	Localized  bool   `json:"localized"`
+}
+
+// PreferencesLoader looks up the display preferences of a user; ok is false when the user has none
+type PreferencesLoader func(userID int) (prefs DisplayPreferences, ok bool)
+
+// ResponseFormatting formats JSON responses for the client after the handlers have run, so handlers
+// always work in stored units (metric, server time) and never format values themselves.
+//
+// Request headers take precedence over the user's saved preferences:
+//   - Accept-Language or X-Locale: locale of number and date display strings
+//   - X-Unit-System: metric or imperial
+//   - X-Timezone: IANA time zone timestamps are rendered in
+//   - X-Localized-Display: true adds "<field>_display" strings to timestamps and measurements
+//
+// Handlers returning signed or hashed data (bundles, attestations, certificates) must call SkipFormatting,
+// since rewriting timestamps or units in those bytes breaks their signature and hashes
+func ResponseFormatting(loadPreferences PreferencesLoader) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+			return nil
+		}
+		// Signed responses are left as they are, rewriting them would break their signature
+		if len(c.Response().Header.Peek(signing.HeaderName)) > 0 || formattingSkipped(c) {
+			return nil
+		}
+
+		var prefs DisplayPreferences
+		if userID, ok := c.Locals("userID").(int); ok && loadPreferences != nil {
+			prefs, _ = loadPreferences(userID)
+		}
+		opts := resolveFormatOptions(c, prefs)
+		if opts.IsDefault() {
+			return nil
+		}
+
+		body, err := utils.FormatJSON(c.Response().Body(), opts)
+		if err != nil {
+			// Leave responses that are not a single JSON document untouched
+			return nil
+		}
+		c.Response().SetBodyRaw(body)
+		c.Set("X-Unit-System", opts.UnitSystem)
+		if opts.Location != nil {
+			c.Set("X-Timezone", opts.Location.String())
+		}
+		if opts.Localized {
+			c.Set(fiber.HeaderContentLanguage, opts.Locale)
+		}
+		return nil
+	}
+}
+
+// skipFormattingKey is the local marking a response ResponseFormatting must leave as it is
+const skipFormattingKey = "skipFormatting"
+
+// SkipFormatting keeps ResponseFormatting from rewriting the response of the request
+func SkipFormatting(c *fiber.Ctx) {
+	c.Locals(skipFormattingKey, true)
+}
+
+// formattingSkipped reports whether the handler opted the response out of formatting
+func formattingSkipped(c *fiber.Ctx) bool {
+	skip, _ := c.Locals(skipFormattingKey).(bool)
+	return skip
+}
+
+// resolveFormatOptions combines the request headers with the user's saved preferences
+func resolveFormatOptions(c *fiber.Ctx, prefs DisplayPreferences) utils.FormatOptions {
+	opts := utils.FormatOptions{Locale: "en", UnitSystem: utils.UnitSystemMetric, Localized: prefs.Localized}
+
+	if prefs.Locale != "" {
+		opts.Locale = prefs.Locale
+	}
+	if locale := c.Get("X-Locale"); locale != "" {
+		opts.Locale = locale
+	} else if locale := firstAcceptedLocale(c.Get(fiber.HeaderAcceptLanguage)); locale != "" {
+		opts.Locale = locale
+	}
+
+	unitSystem := prefs.UnitSystem
+	if header := strings.ToLower(c.Get("X-Unit-System")); header != "" {
+		unitSystem = header
+	}
+	if unitSystem == utils.UnitSystemImperial {
+		opts.UnitSystem = utils.UnitSystemImperial
+	}
+
+	timezone := prefs.Timezone
+	if header := c.Get("X-Timezone"); header != "" {
+		timezone = header
+	}
+	if timezone != "" {
+		if location, err := time.LoadLocation(timezone); err == nil {
+			opts.Location = location
+		}
+	}
+
+	if header := c.Get("X-Localized-Display"); header != "" {
+		opts.Localized = header == "true" || header == "1"
+	}
+	return opts
+}
+
+// firstAcceptedLocale returns the first Accept-Language entry that has a display style
+func firstAcceptedLocale(acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag := strings.TrimSpace(strings.Split(part, ";")[0])
+		if tag != "" && tag != "*" && utils.SupportedLocale(tag) {
+			return tag
+		}
+	}
+	return ""
+}
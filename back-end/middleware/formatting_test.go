@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestResponseFormattingSkip(t *testing.T) {
+	const body = `{"evaluated_at":"2026-10-15T10:00:00Z","weight_kg":5}`
+
+	app := fiber.New()
+	app.Use(ResponseFormatting(nil))
+	app.Get("/formatted", func(c *fiber.Ctx) error {
+		return c.Type("json").SendString(body)
+	})
+	app.Get("/signed", func(c *fiber.Ctx) error {
+		SkipFormatting(c)
+		return c.Type("json").SendString(body)
+	})
+
+	get := func(path string) string {
+		req := httptest.NewRequest(fiber.MethodGet, path, nil)
+		req.Header.Set("X-Unit-System", "imperial")
+		req.Header.Set("X-Timezone", "Asia/Ho_Chi_Minh")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		out, _ := io.ReadAll(resp.Body)
+		return string(out)
+	}
+
+	if got := get("/formatted"); got == body {
+		t.Fatalf("expected the response to be formatted, got %s", got)
+	}
+	if got := get("/signed"); got != body {
+		t.Fatalf("expected the skipped response unchanged, got %s", got)
+	}
+}
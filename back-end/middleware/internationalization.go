@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -28,6 +27,18 @@ const (
 	LangRU = "ru" // Russian
 )
 
+// IsSupportedLanguage reports whether a language code is one of the languages above
+func IsSupportedLanguage(code string) bool {
+	switch code {
+	case LangEN, LangVI, LangZH, LangJA, LangKO, LangFR, LangDE, LangES, LangIT, LangRU:
+		return true
+	}
+	return false
+}
+
+// LanguageLoader returns the language a user saved in their preferences, or "" when they have none
+type LanguageLoader func(userID int) string
+
 type I18n struct {
 	bundle       *i18n.Bundle
 	localizers   map[string]*i18n.Localizer
@@ -82,19 +93,8 @@ func (i *I18n) loadLanguageFiles(localesDir string) error {
 			return fmt.Errorf("failed to read language file %s: %w", filePath, err)
 		}
 
-		tmpFile, err := os.CreateTemp("", "i18n-*.json")
-		if err != nil {
-			return fmt.Errorf("failed to create temporary file: %w", err)
-		}
-		defer os.Remove(tmpFile.Name())
-
-		if _, err := tmpFile.Write(data); err != nil {
-			return fmt.Errorf("failed to write to temporary file: %w", err)
-		}
-		if err := tmpFile.Close(); err != nil {
-			return fmt.Errorf("failed to close temporary file: %w", err)
-		}
-		if _, err := i.bundle.LoadMessageFile(tmpFile.Name()); err != nil {
+		// The language of the messages is taken from the file name, e.g. vi.json
+		if _, err := i.bundle.ParseMessageFileBytes(data, filePath); err != nil {
 			return fmt.Errorf("failed to load message file %s: %w", filePath, err)
 		}
 		_, err = language.Parse(langCode)
@@ -166,7 +166,7 @@ func (i *I18n) GetDefaultLocale() string {
 	return i.defaultLang
 }
 
-func I18nMiddleware(i18n *I18n) fiber.Handler {
+func I18nMiddleware(i18n *I18n, languageOf LanguageLoader) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		acceptLanguage := c.Get("Accept-Language")
 
@@ -174,7 +174,14 @@ func I18nMiddleware(i18n *I18n) fiber.Handler {
 
 		c.Locals("lang", lang)
 
+		// The user is only known once the route's auth middleware has run, so a saved
+		// language preference is looked up when a message is translated
 		c.Locals("translate", func(messageID string, templateData map[string]interface{}) string {
+			if userID, ok := c.Locals("userID").(int); ok && languageOf != nil {
+				if preferred := languageOf(userID); preferred != "" {
+					return i18n.Translate(messageID, preferred, templateData)
+				}
+			}
 			return i18n.Translate(messageID, lang, templateData)
 		})
 
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/loadshed"
+)
+
+// DegradedLocal is set to true while public endpoints are shedding load
+const DegradedLocal = "degraded"
+
+// LoadShedding feeds the load shedding controller with the latency and queue depth of public
+// endpoints. Successful GET responses are cached; while degraded a cached response is served
+// without running the handler, and handlers that still run see IsDegraded and skip expensive work.
+func LoadShedding(ctrl *loadshed.Controller) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		degraded := ctrl.Degraded()
+		key := c.OriginalURL()
+		isGet := c.Method() == fiber.MethodGet
+
+		if degraded && isGet {
+			if cached, ok := ctrl.Lookup(key); ok {
+				c.Set("X-Degraded", "true")
+				c.Set("X-Cache", "HIT")
+				c.Set(fiber.HeaderContentType, cached.ContentType)
+				return c.Status(cached.Status).Send(cached.Body)
+			}
+		}
+
+		done := ctrl.Begin()
+		c.Locals(DegradedLocal, degraded)
+		err := c.Next()
+		done()
+
+		if degraded {
+			c.Set("X-Degraded", "true")
+			if isGet {
+				c.Set("X-Cache", "MISS")
+			}
+			if err == nil && c.Response().StatusCode() == fiber.StatusOK {
+				ctrl.CountLite()
+			}
+			return err
+		}
+		// Lite responses are never cached, so the cache only holds full responses
+		if err == nil && isGet && c.Response().StatusCode() == fiber.StatusOK {
+			ctrl.Store(key, fiber.StatusOK, string(c.Response().Header.ContentType()), c.Response().Body())
+		}
+		return err
+	}
+}
+
+// IsDegraded reports whether the handler should build a lite response
+func IsDegraded(c *fiber.Ctx) bool {
+	degraded, _ := c.Locals(DegradedLocal).(bool)
+	return degraded
+}
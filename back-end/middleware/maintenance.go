@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/announcements"
+)
+
+// MaintenanceNotice flags every response sent during an announced maintenance window with X-Maintenance,
+// the end of the window in X-Maintenance-Ends and the announcement in X-Maintenance-Announcement.
+// Requests are still served; clients decide whether to back off
+func MaintenanceNotice(service *announcements.Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		maintenance, err := service.Maintenance()
+		if err == nil && maintenance != nil {
+			c.Set("X-Maintenance", "true")
+			c.Set("X-Maintenance-Ends", maintenance.MaintenanceEndsAt.UTC().Format(time.RFC3339))
+			c.Set("X-Maintenance-Announcement", strconv.Itoa(maintenance.ID))
+		}
+		return c.Next()
+	}
+}
@@ -2,7 +2,7 @@ package middleware
 
 import (
 	"fmt"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 	"sync"
@@ -11,8 +11,12 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/LTPPPP/TracePost-larvaeChain/config"
 	"github.com/LTPPPP/TracePost-larvaeChain/models"
+	"github.com/LTPPPP/TracePost-larvaeChain/signing"
 )
 
+// RoleAuditor is the role of third-party auditors, who only ever get read access
+const RoleAuditor = "auditor"
+
 var (
 	tokenBlacklist = make(map[string]time.Time)
 	blacklistMutex sync.RWMutex
@@ -52,23 +56,35 @@ func IsTokenRevoked(tokenID string) bool {
 	return found
 }
 
+// TokenKeyFunc resolves the key that verifies an access token: the published RS256 key of its kid,
+// or the shared secret for HS256 tokens issued before the move to asymmetric keys while those are still accepted
+func TokenKeyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA:
+		if token.Method.Alg() != signing.AlgorithmRS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, fmt.Errorf("token has no kid")
+		}
+		return signing.Default().PublicKey(signing.PurposeToken, kid)
+	case *jwt.SigningMethodHMAC:
+		if !config.GetConfig().JWTAcceptHS256 {
+			return nil, fmt.Errorf("HS256 tokens are no longer accepted")
+		}
+		secretKey, err := config.GetJWTSecret()
+		if err != nil {
+			return nil, err
+		}
+		return []byte(secretKey), nil
+	}
+	return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+}
+
 func JWTMiddleware() fiber.Handler {
 	cfg := config.GetConfig()
 	issuer := cfg.JWTIssuer
-	secretKey, err := config.GetJWTSecret()
-	if err != nil {
-		fmt.Printf("Error loading JWT secret: %v, using fallback\n", err)
-		
-		envSecret := os.Getenv("JWT_SECRET")
-		if envSecret != "" && !strings.HasPrefix(envSecret, "file:") {
-			secretKey = envSecret
-		} else {
-			secretKey = fmt.Sprintf("TEMP_KEY_%d", time.Now().UnixNano())
-			fmt.Printf("WARNING: Using temporary JWT key. Authentication will be reset on server restart.\n")
-		}
-	}
-	
-	secretKeyBytes := []byte(secretKey)
 
 	return func(c *fiber.Ctx) error {
 		if c.Method() == "OPTIONS" {
@@ -86,13 +102,7 @@ func JWTMiddleware() fiber.Handler {
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-				token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			
-			return secretKeyBytes, nil
-		})
+				token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, TokenKeyFunc)
 		
 		if err != nil {
 			if ve, ok := err.(*jwt.ValidationError); ok {
@@ -126,16 +136,35 @@ func JWTMiddleware() fiber.Handler {
 			return fiber.NewError(fiber.StatusUnauthorized, "Token has been revoked")
 		}
 		
+		if !IsUserSession(claims) {
+			return fiber.NewError(fiber.StatusUnauthorized, "API client tokens can only be used on the integration API")
+		}
+		
 		c.Locals("userID", claims.UserID)
 		c.Locals("username", claims.Username)
 		c.Locals("role", claims.Role)
 		c.Locals("companyID", claims.CompanyID)
 		c.Locals("user", claims)
 		
+		// Auditors are read-only on every route, whatever the route itself allows
+		if claims.Role == RoleAuditor && !IsReadOnlyMethod(c.Method()) {
+			return fiber.NewError(fiber.StatusForbidden, "Auditor accounts have read-only access")
+		}
+		
 		return c.Next()
 	}
 }
 
+// IsUserSession reports whether token claims belong to a user session rather than an API client token
+func IsUserSession(claims *models.JWTClaims) bool {
+	return claims.TokenUse == "" && claims.UserID != 0
+}
+
+// IsReadOnlyMethod reports whether requests with the HTTP method never change data
+func IsReadOnlyMethod(method string) bool {
+	return method == fiber.MethodGet || method == fiber.MethodHead || method == fiber.MethodOptions
+}
+
 func RoleMiddleware(requiredRoles ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		username, okUsername := c.Locals("username").(string)
@@ -175,6 +204,35 @@ func RoleMiddleware(requiredRoles ...string) fiber.Handler {
 	}
 }
 
+// PermissionChecker decides whether a user holds a permission on one resource, e.g. "batch:edit" on batch 42
+type PermissionChecker func(userID int, role, permission string, resourceID int) (bool, error)
+
+// PermissionMiddleware narrows role based access for write requests to the resources a user's
+// permission groups cover. The resource ID is read from the named route parameter; reads pass through.
+func PermissionMiddleware(permission, param string, check PermissionChecker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if IsReadOnlyMethod(c.Method()) {
+			return c.Next()
+		}
+		resourceID, err := strconv.Atoi(c.Params(param))
+		if err != nil {
+			// Leave reporting the malformed ID to the handler
+			return c.Next()
+		}
+
+		userID, _ := c.Locals("userID").(int)
+		role, _ := c.Locals("role").(string)
+		allowed, err := check(userID, role, permission, resourceID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check permissions")
+		}
+		if !allowed {
+			return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("Your permission groups do not grant '%s' on this resource", permission))
+		}
+		return c.Next()
+	}
+}
+
 func LoggerMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		start := time.Now()
@@ -202,6 +260,9 @@ func LoggerMiddleware() fiber.Handler {
 		if userId, ok := c.Locals("userId").(int); ok {
 			logEntry["user_id"] = userId
 		}
+		if requestID, ok := c.Locals("requestid").(string); ok {
+			logEntry["request_id"] = requestID
+		}
 		
 		return err
 	}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// LimitDecision is the outcome of checking a request against the caller's subscription plan
+type LimitDecision struct {
+	Allowed bool
+	Message string // Why the request was rejected, or the warning when it is allowed over or near a limit
+}
+
+// LimitChecker checks a request against one limit or feature of the caller's subscription plan
+type LimitChecker func(c *fiber.Ctx, limit string) (LimitDecision, error)
+
+// SubscriptionLimit enforces a limit of the caller's subscription plan before the handler runs.
+// Requests over a blocking limit are rejected with 402 Payment Required; requests over a limit
+// the plan only warns about, or close to a limit, pass with an X-Subscription-Warning header.
+func SubscriptionLimit(limit string, check LimitChecker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		decision, err := check(c, limit)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check subscription limits")
+		}
+		if !decision.Allowed {
+			return fiber.NewError(fiber.StatusPaymentRequired, decision.Message)
+		}
+		if decision.Message != "" {
+			c.Set("X-Subscription-Warning", decision.Message)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/usage"
+)
+
+// UsageRecorder counts metered API calls
+type UsageRecorder interface {
+	Record(call usage.Call)
+}
+
+// ErrorStatus returns the status the application's error handler responds to an error with
+type ErrorStatus func(err error) int
+
+// UsageMetering records every API call with the caller's company and API key for usage reports.
+// Handlers that authenticate with an API key set the "apiKey" local to a label identifying it.
+// errorStatus classifies handler errors like the error handler does; without it only *fiber.Error keeps its status.
+func UsageMetering(meter UsageRecorder, prefix string, errorStatus ErrorStatus) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !strings.HasPrefix(c.Path(), prefix) {
+			return c.Next()
+		}
+		start := time.Now()
+		err := c.Next()
+
+		// Errors are turned into responses by the error handler after this returns
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			switch {
+			case errorStatus != nil:
+				status = errorStatus(err)
+			case errors.As(err, &fiberErr):
+				status = fiberErr.Code
+			}
+		}
+
+		companyID, _ := c.Locals("companyID").(int)
+		apiKey, _ := c.Locals("apiKey").(string)
+		meter.Record(usage.Call{
+			CompanyID: companyID,
+			APIKey:    apiKey,
+			Method:    c.Method(),
+			Route:     c.Route().Path,
+			Status:    status,
+			Duration:  time.Since(start),
+			At:        start,
+		})
+		return err
+	}
+}
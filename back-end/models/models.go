@@ -19,6 +19,19 @@ type JWTClaims struct {
 	Username  string `json:"username"`
 	Role      string `json:"role"`
 	CompanyID int    `json:"company_id"`
+	TokenUse  string `json:"token_use,omitempty"` // Empty for user sessions
+	jwt.RegisteredClaims
+}
+
+// TokenUseClient marks access tokens issued to API clients, which share the signing key of user sessions
+const TokenUseClient = "client_credentials"
+
+// ClientClaims represents the claims of an access token issued to an API client with the client_credentials grant
+type ClientClaims struct {
+	ClientID  string `json:"client_id"`
+	CompanyID int    `json:"company_id"`
+	Scope     string `json:"scope"`     // Space separated scopes granted to the token
+	TokenUse  string `json:"token_use"` // Always TokenUseClient
 	jwt.RegisteredClaims
 }
 
@@ -80,10 +93,14 @@ type Batch struct {
 	Species    string    `json:"species"`
 	Quantity   int       `json:"quantity"`
 	Status     string    `json:"status"`
+	StrainID   *int      `json:"strain_id,omitempty"` // Declared genetic strain, refers to Strain.ID
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 	IsActive   bool      `json:"is_active"`
 
+	// How complete the traceability data of the batch is, set on batch lists
+	Completeness *BatchCompleteness `json:"completeness,omitempty" gorm:"-"`
+
 	// Relationships
 	Events          []Event           `json:"events,omitempty" gorm:"foreignKey:BatchID" swaggertype:"array,object"`
 	Documents       []Document        `json:"documents,omitempty" gorm:"foreignKey:BatchID" swaggertype:"array,object"`
@@ -91,6 +108,20 @@ type Batch struct {
 	BlockchainRecords []BlockchainRecord `json:"blockchain_records,omitempty" gorm:"polymorphic:Related;polymorphicValue:batch" swaggertype:"array,object"`
 }
 
+// BatchCompleteness scores the traceability data of a batch against the completeness profile of its owner
+type BatchCompleteness struct {
+	Score             float64  `json:"score"`       // 0 to 100
+	Documents         float64  `json:"documents"`   // Share of the required documents present, 0 to 1
+	Environment       float64  `json:"environment"` // Share of the expected reading intervals with a reading, 0 to 1
+	Events            float64  `json:"events"`      // Share of the stages with an event, 0 to 1
+	MissingDocuments  []string `json:"missing_documents,omitempty"`
+	MissingStages     []string `json:"missing_stages,omitempty"`
+	ReadingIntervals  int      `json:"reading_intervals"`  // Intervals with at least one reading
+	ExpectedIntervals int      `json:"expected_intervals"` // Intervals from creation until the batch first shipped, or now
+	Threshold         int      `json:"threshold"`          // Score below which responsible users are nudged
+	BelowThreshold    bool     `json:"below_threshold"`
+}
+
 // Event represents a traceability event for a batch
 type Event struct {
 	ID        int       `json:"id" gorm:"primaryKey"`
@@ -104,10 +135,29 @@ type Event struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	IsActive  bool      `json:"is_active"`
 
+	// Corrections: a correction is a new event superseding the original, which stays visible
+	SupersedesEventID   *int              `json:"supersedes_event_id,omitempty"`    // Set on a correction
+	SupersededByEventID *int              `json:"superseded_by_event_id,omitempty"` // Set on a corrected event
+	Corrected           bool              `json:"corrected,omitempty"`
+	CorrectionReason    string            `json:"correction_reason,omitempty"`
+	CorrectedAt         *time.Time        `json:"corrected_at,omitempty"`
+	Corrections         []EventCorrection `json:"corrections,omitempty"` // Earlier versions, newest first
+
 	// Related blockchain records
 	BlockchainRecords []BlockchainRecord `json:"blockchain_records,omitempty" gorm:"polymorphic:Related;polymorphicValue:event" swaggertype:"array,object"`
 }
 
+// EventCorrection is an earlier version of a corrected event
+type EventCorrection struct {
+	EventID            int       `json:"event_id"`
+	Location           string    `json:"location"`
+	Metadata           JSONB     `json:"metadata"`
+	CorrectedByEventID int       `json:"corrected_by_event_id"`
+	CorrectionReason   string    `json:"correction_reason"`
+	CorrectedBy        int       `json:"corrected_by"`
+	CorrectedAt        time.Time `json:"corrected_at"`
+}
+
 // Document represents a document or certificate associated with a batch
 type Document struct {
 	ID         int       `json:"id" gorm:"primaryKey"`
@@ -118,6 +168,12 @@ type Document struct {
 	FileName   string    `json:"file_name"`
 	FileSize   int64     `json:"file_size"`
 	UploadedBy int       `json:"uploaded_by"` // Refers to User.ID
+	Language      string `json:"language,omitempty"`       // Language of a translated version
+	TranslationOf *int   `json:"translation_of,omitempty"` // Original document of a translated version
+	Sensitivity   string `json:"sensitivity,omitempty"`    // public, internal, confidential or restricted
+	StorageRegion  string `json:"storage_region,omitempty"`  // Region the file is stored in
+	StorageBackend string `json:"storage_backend,omitempty"` // ipfs, regional_ipfs or s3
+	RegionLocked   bool   `json:"region_locked,omitempty"`   // Stored under a residency policy, only served in its region
 	Uploader   User      `json:"uploader,omitempty" gorm:"foreignKey:UploadedBy" swaggertype:"object"`
 	UploadedAt time.Time `json:"uploaded_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
@@ -141,10 +197,242 @@ type EnvironmentData struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 	IsActive    bool      `json:"is_active"`
 
+	// Custom parameters from the environment parameter catalog, keyed by parameter code
+	Parameters map[string]float64 `json:"parameters,omitempty" gorm:"-"`
+
+	// Device that took the reading; readings of devices overdue for calibration have low confidence
+	DeviceID      *int `json:"device_id,omitempty"` // Refers to Device.ID
+	LowConfidence bool `json:"low_confidence"`
+
+	// Data quality of sensor readings; suppressed readings are left out of charts, alerts and compliance checks
+	QualityScore *float64 `json:"quality_score,omitempty"`
+	QualityFlags []string `json:"quality_flags,omitempty" gorm:"-"`
+	Suppressed   bool     `json:"suppressed"`
+
+	// Where each value falls in the optimal range of its parameter ("within", "below" or "above"), taken from
+	// the reference profile of the batch species at the reading's age or from the parameter catalog
+	RangeStatus        map[string]string `json:"range_status,omitempty" gorm:"-"`
+	ReferenceProfileID *int              `json:"reference_profile_id,omitempty" gorm:"-"`
+	ReferenceProfile   string            `json:"reference_profile,omitempty" gorm:"-"` // Stage of the profile, e.g. PL5
+
 	// Related blockchain records
 	BlockchainRecords []BlockchainRecord `json:"blockchain_records,omitempty" gorm:"polymorphic:Related;polymorphicValue:environment" swaggertype:"array,object"`
 }
 
+// Tank represents a tank or pond of a hatchery
+type Tank struct {
+	ID           int       `json:"id"`
+	HatcheryID   int       `json:"hatchery_id"` // Refers to Hatchery.ID
+	Code         string    `json:"code"`
+	TankType     string    `json:"tank_type"` // tank, pond
+	Capacity     int       `json:"capacity"`  // Larvae the tank can hold
+	VolumeLiters float64   `json:"volume_liters"`
+	Notes        string    `json:"notes"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	IsActive     bool      `json:"is_active"`
+}
+
+// TankAssignment represents a batch stocked in a tank; an assignment without release time is current
+type TankAssignment struct {
+	ID         int        `json:"id"`
+	TankID     int        `json:"tank_id"`
+	BatchID    int        `json:"batch_id"`
+	Quantity   int        `json:"quantity"`
+	AssignedAt time.Time  `json:"assigned_at"`
+	ReleasedAt *time.Time `json:"released_at,omitempty"`
+	Notes      string     `json:"notes"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// WaterSource represents where a hatchery takes its water from during a period; a source without end
+// time is in use
+type WaterSource struct {
+	ID         int              `json:"id"`
+	HatcheryID int              `json:"hatchery_id"` // Refers to Hatchery.ID
+	Name       string           `json:"name"`
+	SourceType string           `json:"source_type"` // well, sea_intake, municipal, surface, other
+	Location   string           `json:"location"`
+	Notes      string           `json:"notes"`
+	InUseFrom  time.Time        `json:"in_use_from"`
+	InUseTo    *time.Time       `json:"in_use_to,omitempty"`
+	CreatedBy  int              `json:"created_by"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+	IsActive   bool             `json:"is_active"`
+	Treatments []WaterTreatment `json:"treatments,omitempty"`
+}
+
+// WaterTreatment represents a treatment step applied to the water of a source during a period, for
+// every batch or, with a batch ID, for one batch only
+type WaterTreatment struct {
+	ID        int        `json:"id"`
+	SourceID  int        `json:"source_id"` // Refers to WaterSource.ID
+	BatchID   *int       `json:"batch_id,omitempty"`
+	StepType  string     `json:"step_type"` // filtration, chlorination, dechlorination, uv, ozonation, other
+	Sequence  int        `json:"sequence"`  // Order of the step in the treatment chain
+	Details   string     `json:"details"`   // e.g. filter size or dose
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	CreatedBy int        `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	IsActive  bool       `json:"is_active"`
+}
+
+// EnergyReading represents the energy a facility used in one month for one equipment category
+type EnergyReading struct {
+	ID         int       `json:"id"`
+	HatcheryID int       `json:"hatchery_id"` // Refers to Hatchery.ID
+	Month      string    `json:"month"`       // YYYY-MM
+	Category   string    `json:"category"`    // aeration, pumps, chillers, heating, lighting, other
+	KWh        float64   `json:"kwh"`
+	Source     string    `json:"source"` // manual or import
+	Notes      string    `json:"notes"`
+	RecordedBy int       `json:"recorded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ProductionPlan represents the batches a hatchery plans to start of a species in one month
+type ProductionPlan struct {
+	ID              int       `json:"id"`
+	HatcheryID      int       `json:"hatchery_id"` // Refers to Hatchery.ID
+	Month           string    `json:"month"`       // YYYY-MM
+	Species         string    `json:"species"`
+	PlannedBatches  int       `json:"planned_batches"`
+	PlannedQuantity int64     `json:"planned_quantity"`
+	Notes           string    `json:"notes"`
+	CreatedBy       int       `json:"created_by"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Device represents a sensor or meter of a facility that takes environment readings
+type Device struct {
+	ID                      int                 `json:"id"`
+	SerialNumber            string              `json:"serial_number"`
+	DeviceType              string              `json:"device_type"` // e.g. temperature_probe, ph_meter, do_meter
+	Manufacturer            string              `json:"manufacturer"`
+	Model                   string              `json:"model"`
+	HatcheryID              int                 `json:"hatchery_id"` // Refers to Hatchery.ID
+	CalibrationIntervalDays int                 `json:"calibration_interval_days"`
+	LastCalibratedAt        *time.Time          `json:"last_calibrated_at,omitempty"`
+	CalibrationDueAt        *time.Time          `json:"calibration_due_at,omitempty"`
+	CalibrationOverdue      bool                `json:"calibration_overdue"`
+	Notes                   string              `json:"notes"`
+	CreatedAt               time.Time           `json:"created_at"`
+	UpdatedAt               time.Time           `json:"updated_at"`
+	IsActive                bool                `json:"is_active"`
+	Calibrations            []DeviceCalibration `json:"calibrations,omitempty"`
+}
+
+// DeviceCalibration represents one calibration of a device and its certificate
+type DeviceCalibration struct {
+	ID           int        `json:"id"`
+	DeviceID     int        `json:"device_id"`
+	CalibratedAt time.Time  `json:"calibrated_at"`
+	CalibratedBy string     `json:"calibrated_by"`
+	DueAt        *time.Time `json:"due_at,omitempty"`
+	DocumentID   *int       `json:"document_id,omitempty"` // Calibration certificate, refers to Document.ID
+	Notes        string     `json:"notes"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Broodstock represents a parent shrimp of a hatchery; its batches trace back to it
+type Broodstock struct {
+	ID                   int        `json:"id"`
+	HatcheryID           int        `json:"hatchery_id"` // Refers to Hatchery.ID
+	TagCode              string     `json:"tag_code"`
+	Species              string     `json:"species"`
+	Sex                  string     `json:"sex"` // male, female, unknown
+	OriginCountry        string     `json:"origin_country"`
+	Supplier             string     `json:"supplier"`
+	GeneticLine          string     `json:"genetic_line"`
+	Generation           int        `json:"generation"`
+	SPFStatus            string     `json:"spf_status"` // Specific pathogen free status
+	ImportPermitNumber   string     `json:"import_permit_number"`
+	ImportPermitExpiry   *time.Time `json:"import_permit_expiry,omitempty"`
+	QuarantineStatus     string     `json:"quarantine_status"` // pending, in_quarantine, released, rejected
+	QuarantineStartedAt  *time.Time `json:"quarantine_started_at,omitempty"`
+	QuarantineReleasedAt *time.Time `json:"quarantine_released_at,omitempty"`
+	AcquiredAt           *time.Time `json:"acquired_at,omitempty"`
+	Notes                string     `json:"notes"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	IsActive             bool       `json:"is_active"`
+}
+
+// BroodstockEvent represents an event in the life of a broodstock animal
+type BroodstockEvent struct {
+	ID           int       `json:"id"`
+	BroodstockID int       `json:"broodstock_id"`
+	EventType    string    `json:"event_type"`
+	ActorID      int       `json:"actor_id"` // Refers to User.ID
+	Location     string    `json:"location"`
+	Timestamp    time.Time `json:"timestamp"`
+	Metadata     JSONB     `json:"metadata"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	IsActive     bool      `json:"is_active"`
+}
+
+// Strain represents a genetic line of shrimp from a genetic supplier
+type Strain struct {
+	ID              int       `json:"id"`
+	Code            string    `json:"code"`
+	Name            string    `json:"name"`
+	Species         string    `json:"species"`
+	LineType        string    `json:"line_type"` // spf, spr, spf_spr, conventional
+	Supplier        string    `json:"supplier"`
+	SupplierCountry string    `json:"supplier_country"`
+	Pathogens       []string  `json:"pathogens"` // Pathogens the line is free of or resistant to
+	Description     string    `json:"description"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	IsActive        bool      `json:"is_active"`
+}
+
+// AccreditedLab represents a laboratory in the trust registry and the claims it is accredited to certify
+type AccreditedLab struct {
+	ID                  int        `json:"id"`
+	Name                string     `json:"name"`
+	DID                 string     `json:"did"`
+	AccreditationBody   string     `json:"accreditation_body"`
+	AccreditationNumber string     `json:"accreditation_number"`
+	Scopes              []string   `json:"scopes"` // Claim codes, e.g. SPF, SPR
+	ValidUntil          *time.Time `json:"valid_until,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	IsActive            bool       `json:"is_active"`
+}
+
+// Certificate represents a certificate issued for a batch (certificates in DB)
+type Certificate struct {
+	ID              int        `json:"id"`
+	BatchID         int        `json:"batch_id"`
+	CertificateType string     `json:"certificate_type"`
+	Issuer          string     `json:"issuer"`
+	AccreditedLabID *int       `json:"accredited_lab_id,omitempty"`
+	DocumentID      *int       `json:"document_id,omitempty"`
+	IssueDate       time.Time  `json:"issue_date"`
+	ExpiryDate      *time.Time `json:"expiry_date,omitempty"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"created_at"`
+	IsActive        bool       `json:"is_active"`
+}
+
+// BatchClaim represents a label claim of a batch, e.g. SPF, with its supporting certificate
+type BatchClaim struct {
+	ID            int       `json:"id"`
+	BatchID       int       `json:"batch_id"`
+	Claim         string    `json:"claim"`
+	CertificateID *int      `json:"certificate_id,omitempty"`
+	DeclaredBy    int       `json:"declared_by,omitempty"`
+	Status        string    `json:"status"` // verified, unverified, self_declared
+	Detail        string    `json:"detail,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
 // BlockchainRecord represents a blockchain transaction record
 type BlockchainRecord struct {
 	ID           int       `json:"id" gorm:"primaryKey"`
@@ -227,6 +515,7 @@ type EventWithActor struct {
 	ActorName  string `json:"actor_name"`
 	ActorRole  string `json:"actor_role"`
 	ActorEmail string `json:"actor_email"`
+	ActorDID   string `json:"actor_did,omitempty"`
 }
 
 // LogisticsEvent represents a logistics event in the supply chain
@@ -260,6 +549,58 @@ type ShipmentTransfer struct {
 	Sender     *User     `json:"sender,omitempty" gorm:"foreignKey:SenderID"`
 	Receiver   *User     `json:"receiver,omitempty" gorm:"foreignKey:ReceiverID"`
 	Batch      *Batch    `json:"batch,omitempty" gorm:"foreignKey:BatchID"`
+
+	// Commercial terms, only included for the two counterparties and their auditors
+	Commercial *TransferCommercialTerms `json:"commercial,omitempty" gorm:"-"`
+}
+
+// TransferCommercialTerms holds the purchase order and price agreed for a transfer
+type TransferCommercialTerms struct {
+	TransferID int       `json:"transfer_id"`
+	PONumber   string    `json:"po_number,omitempty"`
+	UnitPrice  *float64  `json:"unit_price,omitempty"`
+	Currency   string    `json:"currency,omitempty"`  // ISO 4217 code
+	Incoterms  string    `json:"incoterms,omitempty"` // Incoterms 2020 rule, e.g. FOB or CIF
+	Quantity   *int      `json:"quantity,omitempty"`  // Units sold; the batch quantity when not given
+	UpdatedBy  *int      `json:"updated_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Shipment represents one physical consignment (truck, boat, flight) carrying one or more batches
+type Shipment struct {
+	ID            int            `json:"id"`
+	ShipmentCode  string         `json:"shipment_code"`
+	SenderID      int            `json:"sender_id"`
+	ReceiverID    int            `json:"receiver_id"`
+	Carrier       string         `json:"carrier"`
+	VehicleID     string         `json:"vehicle_id"`
+	Origin        string         `json:"origin"`
+	Destination   string         `json:"destination"`
+	Status        string         `json:"status"` // draft, in_transit, received, cancelled
+	DepartureTime *time.Time     `json:"departure_time,omitempty"`
+	ArrivalTime   *time.Time     `json:"arrival_time,omitempty"`
+	Notes         string         `json:"notes"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	IsActive      bool           `json:"is_active"`
+	Items         []ShipmentItem `json:"items,omitempty"`
+}
+
+// ShipmentItem represents a batch packed in a tank or container of a shipment
+type ShipmentItem struct {
+	ID               int       `json:"id"`
+	ShipmentID       int       `json:"shipment_id"`
+	BatchID          int       `json:"batch_id"`
+	TransferID       int       `json:"transfer_id"` // Custody transfer created for this line
+	Quantity         int       `json:"quantity"`
+	ContainerID      string    `json:"container_id"`
+	ContainerType    string    `json:"container_type"` // tank, bag, box, container
+	ReceivedQuantity int       `json:"received_quantity"`
+	Condition        string    `json:"condition"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	IsActive         bool      `json:"is_active"`
 }
 
 // SaveDocumentToIPFS uploads a document to IPFS and returns the CID and URI
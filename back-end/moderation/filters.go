@@ -0,0 +1,219 @@
+package moderation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TermFilter finds blocked words and phrases, ignoring case.
+// Terms only match whole words, so a blocked term inside a longer word is left alone
+type TermFilter struct {
+	Action  string
+	pattern *regexp.Regexp
+}
+
+// NewTermFilter creates a filter for terms; an unknown action masks the terms
+func NewTermFilter(terms []string, action string) *TermFilter {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	// \b only knows ASCII letters, which would split Vietnamese words at their accented letters
+	pattern := regexp.MustCompile(`(?i)(^|[^\p{L}\p{N}])(` + strings.Join(quoted, "|") + `)($|[^\p{L}\p{N}])`)
+	switch action {
+	case ActionReview, ActionReject:
+	default:
+		action = ActionMask
+	}
+	return &TermFilter{Action: action, pattern: pattern}
+}
+
+// Name returns the filter name
+func (f *TermFilter) Name() string {
+	return "blocked_term"
+}
+
+// Apply masks the blocked terms of a text, or raises the verdict according to the action
+func (f *TermFilter) Apply(r *Result) {
+	found, offset := 0, 0
+	// A match consumes the character after the term, so the search resumes at the end of the term
+	// for the next one to see it as its leading separator
+	for offset < len(r.Text) {
+		loc := f.pattern.FindStringSubmatchIndex(r.Text[offset:])
+		if loc == nil {
+			break
+		}
+		found++
+		start, end := offset+loc[4], offset+loc[5]
+		mask := strings.Repeat("*", len([]rune(r.Text[start:end])))
+		r.Text = r.Text[:start] + mask + r.Text[end:]
+		offset = start + len(mask)
+	}
+	if found == 0 {
+		return
+	}
+	detail := fmt.Sprintf("%d blocked term(s)", found)
+	switch f.Action {
+	case ActionReject:
+		r.flag(VerdictRejected, f.Name(), detail)
+	case ActionReview:
+		r.flag(VerdictReview, f.Name(), detail)
+	default:
+		r.flag(VerdictApproved, f.Name(), detail+" masked")
+	}
+}
+
+// piiRule redacts one kind of personal data
+type piiRule struct {
+	kind        string
+	pattern     *regexp.Regexp
+	placeholder string
+	valid       func(match string) bool
+}
+
+// piiRules are applied in order; card numbers go before phone numbers, which would match them too
+var piiRules = []piiRule{
+	{"email", regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[email removed]", nil},
+	{"card_number", regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), "[card number removed]", luhnValid},
+	{"national_id", regexp.MustCompile(`\b\d{12}\b|\b\d{9}\b`), "[ID number removed]", nil},
+	{"phone", regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?\(?\d{2,4}\)?[ .-]?\d{3,4}[ .-]?\d{3,4}\b`), "[phone removed]", nil},
+}
+
+// PIIFilter redacts e-mail addresses, card numbers, national ID numbers and phone numbers.
+// Redacted text is approved; the findings only say what kind of data was removed
+type PIIFilter struct{}
+
+// Name returns the filter name
+func (f *PIIFilter) Name() string {
+	return "pii"
+}
+
+// Apply redacts the personal data of a text
+func (f *PIIFilter) Apply(r *Result) {
+	for _, rule := range piiRules {
+		found := 0
+		r.Text = rule.pattern.ReplaceAllStringFunc(r.Text, func(match string) string {
+			if rule.valid != nil && !rule.valid(match) {
+				return match
+			}
+			found++
+			return rule.placeholder
+		})
+		if found > 0 {
+			r.flag(VerdictApproved, f.Name(), fmt.Sprintf("%d %s redacted", found, rule.kind))
+		}
+	}
+}
+
+// luhnValid reports whether the digits of a number pass the Luhn check of payment card numbers
+func luhnValid(number string) bool {
+	sum, double := 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		ch := number[i]
+		if ch < '0' || ch > '9' {
+			continue
+		}
+		d := int(ch - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// linkPattern matches web addresses, with or without a scheme
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://\S+|\bwww\.\S+|\b[a-z0-9-]+\.(?:com|net|org|info|biz|xyz|top|vn|io|ru|cn)\b(?:/\S*)?`)
+
+// LinkFilter sends text with more links than allowed to review, the usual sign of spam
+type LinkFilter struct {
+	Max int
+}
+
+// Name returns the filter name
+func (f *LinkFilter) Name() string {
+	return "links"
+}
+
+// Apply counts the links of a text
+func (f *LinkFilter) Apply(r *Result) {
+	if links := len(linkPattern.FindAllString(r.Text, -1)); links > f.Max {
+		r.flag(VerdictReview, f.Name(), fmt.Sprintf("%d link(s), at most %d allowed", links, f.Max))
+	}
+}
+
+// ExternalFilter asks a moderation service exposing POST {url}/moderate about a text.
+// The service answers with whether the text is flagged, whether it must be blocked and the categories it falls in
+type ExternalFilter struct {
+	URL        string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// NewExternalFilter creates a filter for a moderation service
+func NewExternalFilter(apiURL, apiKey string) *ExternalFilter {
+	return &ExternalFilter{URL: strings.TrimSuffix(apiURL, "/"), APIKey: apiKey, HTTPClient: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Name returns the filter name
+func (f *ExternalFilter) Name() string {
+	return "external"
+}
+
+// Apply sends a text to the moderation service.
+// When the service cannot be reached the text goes to review rather than being shown unchecked
+func (f *ExternalFilter) Apply(r *Result) {
+	verdict, err := f.moderate(r.Text)
+	if err != nil {
+		r.flag(VerdictReview, f.Name(), "moderation service unavailable")
+		return
+	}
+	if verdict.Block {
+		r.flag(VerdictRejected, f.Name(), strings.Join(verdict.Categories, ", "))
+	} else if verdict.Flagged {
+		r.flag(VerdictReview, f.Name(), strings.Join(verdict.Categories, ", "))
+	}
+}
+
+// externalVerdict is the answer of the moderation service
+type externalVerdict struct {
+	Flagged    bool     `json:"flagged"`
+	Block      bool     `json:"block"`
+	Categories []string `json:"categories"`
+}
+
+// moderate calls the moderation service
+func (f *ExternalFilter) moderate(text string) (externalVerdict, error) {
+	var verdict externalVerdict
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return verdict, err
+	}
+	req, err := http.NewRequest(http.MethodPost, f.URL+"/moderate", bytes.NewReader(body))
+	if err != nil {
+		return verdict, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+f.APIKey)
+	}
+
+	resp, err := f.HTTPClient.Do(req)
+	if err != nil {
+		return verdict, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return verdict, fmt.Errorf("moderation service returned status %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&verdict)
+	return verdict, err
+}
@@ -0,0 +1,122 @@
+package moderation
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+)
+
+// Verdicts of the pipeline, from the most to the least permissive
+const (
+	VerdictApproved = "approved" // the text can be shown
+	VerdictReview   = "review"   // a moderator decides
+	VerdictRejected = "rejected" // the text is not stored
+)
+
+// What to do with text containing a blocked term
+const (
+	ActionMask   = "mask"   // replace the term with asterisks and approve
+	ActionReview = "review" // send the text to the review queue
+	ActionReject = "reject" // reject the text
+)
+
+// Finding is something a filter found in a text.
+// Findings never repeat the personal data they are about, so they can be shown to moderators
+type Finding struct {
+	Filter string `json:"filter"`
+	Detail string `json:"detail"`
+}
+
+// Result is the outcome of moderating a text
+type Result struct {
+	Text     string    `json:"text"` // The text with terms masked and personal data redacted
+	Verdict  string    `json:"verdict"`
+	Findings []Finding `json:"findings"`
+}
+
+// flag records a finding and raises the verdict to at least the given one
+func (r *Result) flag(verdict, filter, detail string) {
+	r.Findings = append(r.Findings, Finding{Filter: filter, Detail: detail})
+	if severity(verdict) > severity(r.Verdict) {
+		r.Verdict = verdict
+	}
+}
+
+// severity orders the verdicts
+func severity(verdict string) int {
+	switch verdict {
+	case VerdictRejected:
+		return 2
+	case VerdictReview:
+		return 1
+	}
+	return 0
+}
+
+// Filter inspects a text, rewriting it or raising the verdict
+type Filter interface {
+	Name() string
+	Apply(r *Result)
+}
+
+// Pipeline runs filters in order over a text
+type Pipeline struct {
+	Filters []Filter
+}
+
+var (
+	defaultPipeline *Pipeline
+	once            sync.Once
+)
+
+// NewPipeline creates a pipeline from the application config.
+// Personal data is redacted before the text leaves the platform for the external moderation API
+func NewPipeline(cfg *config.Config) *Pipeline {
+	p := &Pipeline{}
+	if terms := splitTerms(cfg.ModerationBlockedTerms); len(terms) > 0 {
+		p.Filters = append(p.Filters, NewTermFilter(terms, cfg.ModerationTermAction))
+	}
+	if cfg.ModerationRedactPII {
+		p.Filters = append(p.Filters, &PIIFilter{})
+	}
+	p.Filters = append(p.Filters, &LinkFilter{Max: cfg.ModerationMaxLinks})
+	if cfg.ModerationAPIURL != "" {
+		p.Filters = append(p.Filters, NewExternalFilter(cfg.ModerationAPIURL, cfg.ModerationAPIKey))
+	}
+	return p
+}
+
+// Default returns the process wide pipeline
+func Default() *Pipeline {
+	once.Do(func() {
+		defaultPipeline = NewPipeline(config.GetConfig())
+	})
+	return defaultPipeline
+}
+
+// Check moderates a text
+func (p *Pipeline) Check(text string) Result {
+	r := Result{Text: strings.TrimSpace(text), Verdict: VerdictApproved, Findings: []Finding{}}
+	if r.Text == "" {
+		return r
+	}
+	for _, f := range p.Filters {
+		f.Apply(&r)
+		if r.Verdict == VerdictRejected {
+			break
+		}
+	}
+	return r
+}
+
+// splitTerms splits a comma separated list of terms
+func splitTerms(spec string) []string {
+	terms := []string{}
+	for _, term := range strings.Split(spec, ",") {
+		if term = strings.TrimSpace(term); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
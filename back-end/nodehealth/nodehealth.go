@@ -0,0 +1,421 @@
+package nodehealth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/notify"
+)
+
+// Health of a node after a probe
+const (
+	StatusHealthy  = "healthy"
+	StatusDegraded = "degraded" // Reachable but slow, still syncing or short of peers
+	StatusDown     = "down"     // Unreachable or answering with errors
+)
+
+// Events recorded when the prober acts
+const (
+	EventSwitched    = "switched"     // Clients were sent to another node
+	EventAllDegraded = "all_degraded" // No node was healthy and operators were alerted
+	EventRecovered   = "recovered"    // A node became healthy again after all were degraded
+)
+
+// Probe is the result of checking one node
+type Probe struct {
+	NodeURL     string    `json:"node_url"`
+	Status      string    `json:"status"`
+	LatencyMs   int64     `json:"latency_ms"`
+	BlockHeight int64     `json:"block_height"`
+	CatchingUp  bool      `json:"catching_up"`
+	PeerCount   int       `json:"peer_count"`
+	Error       string    `json:"error,omitempty"`
+	ProbedAt    time.Time `json:"probed_at"`
+}
+
+// NodeState is what the prober knows of a configured node
+type NodeState struct {
+	NodeURL             string `json:"node_url"`
+	Primary             bool   `json:"primary"`
+	Active              bool   `json:"active"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastProbe           *Probe `json:"last_probe,omitempty"`
+}
+
+// Status describes the nodes and which one clients are sent to
+type Status struct {
+	PrimaryNode      string      `json:"primary_node"`
+	ActiveNode       string      `json:"active_node"`
+	AllDegraded      bool        `json:"all_degraded"`
+	LastSwitchAt     *time.Time  `json:"last_switch_at,omitempty"`
+	LastSwitchReason string      `json:"last_switch_reason,omitempty"`
+	Nodes            []NodeState `json:"nodes"`
+}
+
+// Event is a switch or alert raised by the prober
+type Event struct {
+	ID        int       `json:"id"`
+	EventType string    `json:"event_type"`
+	FromNode  string    `json:"from_node,omitempty"`
+	ToNode    string    `json:"to_node,omitempty"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Service probes the configured blockchain nodes and sends clients to a healthy one
+type Service struct {
+	Config               *config.Config
+	Interval             time.Duration
+	Client               *http.Client
+	MaxLatency           time.Duration
+	MinPeers             int
+	FailuresBeforeSwitch int
+	HistoryDays          int
+
+	mu               sync.Mutex
+	primary          string
+	nodes            []string // The primary first, then the fallbacks in order of preference
+	active           string
+	failures         map[string]int
+	last             map[string]Probe
+	allDegraded      bool
+	lastSwitchAt     *time.Time
+	lastSwitchReason string
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates a prober from the application config
+func NewService(cfg *config.Config) *Service {
+	nodes := []string{cfg.BlockchainNodeURL}
+	for _, node := range cfg.BlockchainFallbackNodeURLs {
+		node = strings.TrimRight(strings.TrimSpace(node), "/")
+		if node != "" && node != cfg.BlockchainNodeURL {
+			nodes = append(nodes, node)
+		}
+	}
+	return &Service{
+		Config:               cfg,
+		Interval:             time.Duration(cfg.NodeProbeIntervalSeconds) * time.Second,
+		Client:               &http.Client{Timeout: time.Duration(cfg.NodeProbeTimeoutMs) * time.Millisecond},
+		MaxLatency:           time.Duration(cfg.NodeProbeMaxLatencyMs) * time.Millisecond,
+		MinPeers:             cfg.NodeProbeMinPeers,
+		FailuresBeforeSwitch: cfg.NodeProbeFailuresBeforeSwitch,
+		HistoryDays:          cfg.NodeProbeHistoryDays,
+		primary:              cfg.BlockchainNodeURL,
+		nodes:                nodes,
+		active:               cfg.BlockchainNodeURL,
+		failures:             map[string]int{},
+		last:                 map[string]Probe{},
+	}
+}
+
+// Default returns the process wide prober
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Start probes the nodes in the background, right away and then every interval
+func (s *Service) Start() {
+	go func() {
+		for {
+			if err := s.RunOnce(); err != nil {
+				fmt.Printf("Warning: blockchain node probe failed: %v\n", err)
+			}
+			time.Sleep(s.Interval)
+		}
+	}()
+}
+
+// RunOnce probes every node, records the results and switches clients when the active node is unhealthy
+func (s *Service) RunOnce() error {
+	probes := make([]Probe, len(s.nodes))
+	var wg sync.WaitGroup
+	for i, node := range s.nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			probes[i] = s.probe(node)
+		}(i, node)
+	}
+	wg.Wait()
+
+	if err := s.record(probes); err != nil {
+		return err
+	}
+	s.evaluate(probes)
+	return nil
+}
+
+// probe checks the latency, sync status and peers of a node through its Tendermint RPC
+func (s *Service) probe(node string) Probe {
+	p := Probe{NodeURL: node, ProbedAt: time.Now()}
+
+	var status struct {
+		SyncInfo struct {
+			LatestBlockHeight string `json:"latest_block_height"`
+			CatchingUp        bool   `json:"catching_up"`
+		} `json:"sync_info"`
+	}
+	started := time.Now()
+	if err := s.get(node+"/status", &status); err != nil {
+		p.Status = StatusDown
+		p.Error = err.Error()
+		return p
+	}
+	p.LatencyMs = time.Since(started).Milliseconds()
+	p.BlockHeight, _ = strconv.ParseInt(status.SyncInfo.LatestBlockHeight, 10, 64)
+	p.CatchingUp = status.SyncInfo.CatchingUp
+
+	var netInfo struct {
+		NPeers string `json:"n_peers"`
+	}
+	if err := s.get(node+"/net_info", &netInfo); err != nil {
+		p.Status = StatusDegraded
+		p.Error = "peer count unavailable: " + err.Error()
+		return p
+	}
+	p.PeerCount, _ = strconv.Atoi(netInfo.NPeers)
+
+	switch {
+	case p.CatchingUp:
+		p.Status = StatusDegraded
+		p.Error = "node is catching up"
+	case s.MaxLatency > 0 && time.Duration(p.LatencyMs)*time.Millisecond > s.MaxLatency:
+		p.Status = StatusDegraded
+		p.Error = fmt.Sprintf("latency %dms over %dms", p.LatencyMs, s.MaxLatency.Milliseconds())
+	case p.PeerCount < s.MinPeers:
+		p.Status = StatusDegraded
+		p.Error = fmt.Sprintf("%d peers, at least %d expected", p.PeerCount, s.MinPeers)
+	default:
+		p.Status = StatusHealthy
+	}
+	return p
+}
+
+// get reads a JSON-RPC endpoint of a node, unwrapping the result envelope when there is one
+func (s *Service) get(url string, out interface{}) error {
+	resp, err := s.Client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("node returned status: %d", resp.StatusCode)
+	}
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil {
+		if len(envelope.Error) > 0 && string(envelope.Error) != "null" {
+			return fmt.Errorf("node returned error: %s", envelope.Error)
+		}
+		if len(envelope.Result) > 0 {
+			body = envelope.Result
+		}
+	}
+	return json.Unmarshal(body, out)
+}
+
+// record stores the probes and drops history older than the retention
+func (s *Service) record(probes []Probe) error {
+	if db.DB == nil {
+		return nil
+	}
+	for _, p := range probes {
+		if _, err := db.DB.Exec(`
+			INSERT INTO blockchain_node_probe (node_url, status, latency_ms, block_height, catching_up, peer_count, error, probed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8)
+		`, p.NodeURL, p.Status, p.LatencyMs, p.BlockHeight, p.CatchingUp, p.PeerCount, p.Error, p.ProbedAt); err != nil {
+			return fmt.Errorf("failed to record probe of %s: %w", p.NodeURL, err)
+		}
+	}
+	if s.HistoryDays > 0 {
+		db.DB.Exec("DELETE FROM blockchain_node_probe WHERE probed_at < NOW() - make_interval(days => $1)", s.HistoryDays)
+	}
+	return nil
+}
+
+// evaluate switches clients away from an unhealthy active node, back to the primary once it recovers,
+// and alerts operators when no node is healthy
+func (s *Service) evaluate(probes []Probe) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	healthy := []string{}
+	for _, p := range probes {
+		s.last[p.NodeURL] = p
+		if p.Status == StatusHealthy {
+			s.failures[p.NodeURL] = 0
+			healthy = append(healthy, p.NodeURL)
+		} else {
+			s.failures[p.NodeURL]++
+		}
+	}
+
+	if len(healthy) == 0 {
+		if !s.allDegraded {
+			s.allDegraded = true
+			s.raiseAllDegraded(probes)
+		}
+		return
+	}
+	if s.allDegraded {
+		s.allDegraded = false
+		s.recordEvent(EventRecovered, "", healthy[0], fmt.Sprintf("%s is healthy again", healthy[0]))
+	}
+
+	// Prefer the primary whenever it is healthy, otherwise the first healthy fallback
+	target := healthy[0]
+	switch {
+	case target == s.active:
+		return
+	case target == s.primary:
+		s.switchTo(target, "primary node is healthy again")
+	case s.failures[s.active] >= s.FailuresBeforeSwitch:
+		last := s.last[s.active]
+		s.switchTo(target, fmt.Sprintf("%s is %s: %s", s.active, last.Status, last.Error))
+	}
+}
+
+// switchTo sends every client created for the primary node to another node
+func (s *Service) switchTo(node, reason string) {
+	from := s.active
+	s.active = node
+	now := time.Now()
+	s.lastSwitchAt = &now
+	s.lastSwitchReason = reason
+	blockchain.RouteNode(s.primary, node)
+	fmt.Printf("Blockchain clients switched from %s to %s: %s\n", from, node, reason)
+	s.recordEvent(EventSwitched, from, node, reason)
+}
+
+// raiseAllDegraded records and sends the alert that no node is healthy
+func (s *Service) raiseAllDegraded(probes []Probe) {
+	message := fmt.Sprintf("All %d blockchain nodes are degraded, transactions still go to %s", len(probes), s.active)
+	fmt.Printf("Alert: %s\n", message)
+	s.recordEvent(EventAllDegraded, s.active, "", message)
+
+	nodes := make([]map[string]interface{}, 0, len(probes))
+	for _, p := range probes {
+		nodes = append(nodes, map[string]interface{}{"node_url": p.NodeURL, "status": p.Status, "error": p.Error})
+	}
+	if err := notify.Notify(s.Config.OperatorCompanyID, notify.AlertNodesDegraded, map[string]interface{}{
+		"active_node": s.active,
+		"nodes":       nodes,
+	}); err != nil {
+		fmt.Printf("Warning: failed to notify operators of degraded blockchain nodes: %v\n", err)
+	}
+}
+
+// recordEvent stores a switch or alert
+func (s *Service) recordEvent(eventType, from, to, message string) {
+	if db.DB == nil {
+		return
+	}
+	if _, err := db.DB.Exec(`
+		INSERT INTO blockchain_node_event (event_type, from_node, to_node, message)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4)
+	`, eventType, from, to, message); err != nil {
+		fmt.Printf("Warning: failed to record blockchain node %s event: %v\n", eventType, err)
+	}
+}
+
+// Status reports the state of every node as of the last probe
+func (s *Service) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := Status{
+		PrimaryNode:      s.primary,
+		ActiveNode:       s.active,
+		AllDegraded:      s.allDegraded,
+		LastSwitchAt:     s.lastSwitchAt,
+		LastSwitchReason: s.lastSwitchReason,
+		Nodes:            make([]NodeState, 0, len(s.nodes)),
+	}
+	for _, node := range s.nodes {
+		state := NodeState{
+			NodeURL:             node,
+			Primary:             node == s.primary,
+			Active:              node == s.active,
+			ConsecutiveFailures: s.failures[node],
+		}
+		if p, ok := s.last[node]; ok {
+			state.LastProbe = &p
+		}
+		status.Nodes = append(status.Nodes, state)
+	}
+	return status
+}
+
+// History returns the latest probes, of one node or of all
+func History(node string, limit int) ([]Probe, error) {
+	rows, err := db.DB.Query(`
+		SELECT node_url, status, COALESCE(latency_ms, 0), COALESCE(block_height, 0), COALESCE(catching_up, false),
+			COALESCE(peer_count, 0), COALESCE(error, ''), probed_at
+		FROM blockchain_node_probe
+		WHERE $1 = '' OR node_url = $1
+		ORDER BY probed_at DESC
+		LIMIT $2
+	`, node, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	probes := []Probe{}
+	for rows.Next() {
+		var p Probe
+		if err := rows.Scan(&p.NodeURL, &p.Status, &p.LatencyMs, &p.BlockHeight, &p.CatchingUp,
+			&p.PeerCount, &p.Error, &p.ProbedAt); err != nil {
+			return nil, err
+		}
+		probes = append(probes, p)
+	}
+	return probes, rows.Err()
+}
+
+// Events returns the latest switches and alerts
+func Events(limit int) ([]Event, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, event_type, COALESCE(from_node, ''), COALESCE(to_node, ''), COALESCE(message, ''), created_at
+		FROM blockchain_node_event
+		ORDER BY created_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.EventType, &e.FromNode, &e.ToNode, &e.Message, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,125 @@
+package nonces
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Store allocates nonces from the account_nonce table; rows are locked so instances never share a nonce
+type Store struct{}
+
+var once sync.Once
+
+// InitNonceStore installs the persistent nonce store for all outbound transaction paths
+func InitNonceStore() {
+	once.Do(func() {
+		if db.DB == nil {
+			return
+		}
+		blockchain.SetNonceStore(&Store{})
+	})
+}
+
+// key normalizes the chain and account a nonce row is stored under
+func key(chain, account string) (string, string) {
+	return strings.ToLower(chain), strings.ToLower(account)
+}
+
+// withAccount runs a change to the nonce row of an account inside a transaction holding its lock
+func withAccount(chain, account string, change func(next uint64, gaps []uint64) (uint64, []uint64)) error {
+	chain, account = key(chain, account)
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO account_nonce (chain, account) VALUES ($1, $2)
+		ON CONFLICT (chain, account) DO NOTHING
+	`, chain, account); err != nil {
+		return err
+	}
+	var next int64
+	var stored pq.Int64Array
+	if err := tx.QueryRow(`
+		SELECT next_nonce, gaps FROM account_nonce WHERE chain = $1 AND account = $2 FOR UPDATE
+	`, chain, account).Scan(&next, &stored); err != nil {
+		return err
+	}
+	gaps := make([]uint64, len(stored))
+	for i, gap := range stored {
+		gaps[i] = uint64(gap)
+	}
+
+	newNext, newGaps := change(uint64(next), gaps)
+	saved := make(pq.Int64Array, len(newGaps))
+	for i, gap := range newGaps {
+		saved[i] = int64(gap)
+	}
+	if _, err := tx.Exec(`
+		UPDATE account_nonce SET next_nonce = $3, gaps = $4, updated_at = NOW() WHERE chain = $1 AND account = $2
+	`, chain, account, int64(newNext), saved); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Allocate takes the lowest released nonce at or above floor, or the next nonce of the account
+func (s *Store) Allocate(chain, account string, floor uint64) (uint64, error) {
+	var nonce uint64
+	err := withAccount(chain, account, func(next uint64, gaps []uint64) (uint64, []uint64) {
+		// Gaps below the chain's nonce were filled by someone else
+		kept := gaps[:0]
+		for _, gap := range gaps {
+			if gap >= floor {
+				kept = append(kept, gap)
+			}
+		}
+		if len(kept) > 0 {
+			nonce = kept[0]
+			return next, kept[1:]
+		}
+		if next < floor {
+			next = floor
+		}
+		nonce = next
+		return next + 1, kept
+	})
+	if err != nil {
+		return 0, err
+	}
+	return nonce, nil
+}
+
+// Release records a nonce that was allocated but never used
+func (s *Store) Release(chain, account string, nonce uint64) error {
+	return withAccount(chain, account, func(next uint64, gaps []uint64) (uint64, []uint64) {
+		if nonce >= next {
+			return next, gaps
+		}
+		for _, gap := range gaps {
+			if gap == nonce {
+				return next, gaps
+			}
+		}
+		gaps = append(gaps, nonce)
+		sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+		return next, gaps
+	})
+}
+
+// Reset moves the next nonce of an account to the one the chain expects
+func (s *Store) Reset(chain, account string, next uint64) error {
+	return withAccount(chain, account, func(uint64, []uint64) (uint64, []uint64) {
+		return next, nil
+	})
+}
+
+var _ blockchain.NonceStore = (*Store)(nil)
@@ -0,0 +1,313 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/signing"
+)
+
+// Chat providers a connector can post to
+const (
+	ProviderSlack = "slack"
+	ProviderTeams = "teams"
+)
+
+// Operational alerts connectors can subscribe to
+const (
+	AlertEnvironment     = "environment_alert"
+	AlertAnchoringFailed = "anchoring_failed"
+	AlertDisputeOpened   = "dispute_opened"
+	AlertNodesDegraded   = "blockchain_nodes_degraded"
+	AlertSLABreached     = "sla_breached"
+)
+
+// Message statuses
+const (
+	StatusPending     = "pending"
+	StatusSent        = "sent"
+	StatusFailed      = "failed"
+	StatusRateLimited = "rate_limited"
+)
+
+// Titles are the headings of alert messages
+var Titles = map[string]string{
+	AlertEnvironment:     "Environment alert",
+	AlertAnchoringFailed: "Blockchain anchoring failed",
+	AlertDisputeOpened:   "Origin dispute opened",
+	AlertNodesDegraded:   "Blockchain nodes degraded",
+	AlertSLABreached:     "Partner SLA breached",
+}
+
+// DefaultTemplates render alerts for connectors without a template of their own
+// Templates use text/template syntax over the alert data, e.g. {{.batch_id}}
+var DefaultTemplates = map[string]string{
+	AlertEnvironment: `Environment alert on batch {{.batch_id}}` +
+		`{{range .alerts}}` + "\n" + `- {{.parameter_code}} is {{.direction}} at {{.value}}{{end}}`,
+	AlertAnchoringFailed: `Failed to anchor {{.record_type}} {{.record_id}}` +
+		`{{if .batch_id}} of batch {{.batch_id}}{{end}} on the blockchain: {{.error}}`,
+	AlertDisputeOpened: `Origin dispute {{.dispute_id}} opened for lot {{.lot_identifier}} ({{.identifier_scheme}})` +
+		`{{if .claim_ids}} between claims {{.claim_ids}}{{end}}`,
+	AlertNodesDegraded: `All blockchain nodes are degraded, transactions still go to {{.active_node}}` +
+		`{{range .nodes}}` + "\n" + `- {{.node_url}} is {{.status}}{{if .error}}: {{.error}}{{end}}{{end}}`,
+	AlertSLABreached: `SLA "{{.sla_name}}" ({{.metric}} within {{.target_hours}}h) was breached on transfer {{.transfer_id}}` +
+		`, the {{.responsible}} was due by {{.due_at}}{{if .fulfilled_at}} and met it at {{.fulfilled_at}}{{end}}`,
+}
+
+// webhookDomains are the domains incoming webhooks of each provider are served from
+// Connectors are refused for any other host, since their endpoints are not otherwise verified
+var webhookDomains = map[string][]string{
+	ProviderSlack: {"hooks.slack.com"},
+	ProviderTeams: {"webhook.office.com", "logic.azure.com"},
+}
+
+// IsProviderHost reports whether a host serves incoming webhooks of a provider
+func IsProviderHost(provider, host string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range webhookDomains[provider] {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Connector posts alerts of a company to a Slack or Teams incoming webhook
+type Connector struct {
+	ID               int
+	CompanyID        int
+	Provider         string
+	WebhookURL       string
+	Channel          string
+	Template         string
+	RateLimitPerHour int
+}
+
+// Notifier renders alerts and posts them to the connectors subscribed to them
+type Notifier struct {
+	Client           *http.Client
+	RateLimitPerHour int
+}
+
+var (
+	defaultNotifier *Notifier
+	once            sync.Once
+)
+
+// NewNotifier creates a notifier from the application config
+func NewNotifier(cfg *config.Config) *Notifier {
+	return &Notifier{
+		Client:           &http.Client{Timeout: time.Duration(cfg.NotificationTimeoutSeconds) * time.Second},
+		RateLimitPerHour: cfg.NotificationRateLimitPerHour,
+	}
+}
+
+// Default returns the process wide notifier
+func Default() *Notifier {
+	once.Do(func() {
+		defaultNotifier = NewNotifier(config.GetConfig())
+	})
+	return defaultNotifier
+}
+
+// Notify sends an alert to the connectors of a company with the default notifier
+func Notify(companyID int, alertType string, data map[string]interface{}) error {
+	return Default().Notify(companyID, alertType, data)
+}
+
+// IsAlertType reports whether connectors can subscribe to an alert type
+func IsAlertType(alertType string) bool {
+	_, ok := Titles[alertType]
+	return ok
+}
+
+// ValidateTemplate checks that a message template parses
+func ValidateTemplate(text string) error {
+	_, err := template.New("message").Parse(text)
+	return err
+}
+
+// Render formats an alert with a template, or with the default template of the alert type when it is empty
+// The data is passed through JSON first, so templates use the JSON field names of nested values
+func Render(text, alertType string, data map[string]interface{}) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		text = DefaultTemplates[alertType]
+	}
+	tmpl, err := template.New("message").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var values map[string]interface{}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return "", err
+	}
+	values["alert_type"] = alertType
+	values["title"] = Titles[alertType]
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, values); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Notify renders an alert for every active connector of a company subscribed to it and posts it in the background
+// A connector without alert types receives every alert. Messages over a connector's hourly limit are recorded but not sent
+func (n *Notifier) Notify(companyID int, alertType string, data map[string]interface{}) error {
+	if db.DB == nil || companyID == 0 {
+		return nil
+	}
+	if !IsAlertType(alertType) {
+		return fmt.Errorf("unknown alert type %q", alertType)
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, company_id, provider, webhook_url, COALESCE(channel, ''), COALESCE(template, ''), COALESCE(rate_limit_per_hour, 0)
+		FROM notification_connector
+		WHERE company_id = $1 AND is_active = true
+			AND (cardinality(alert_types) = 0 OR $2::text = ANY(alert_types))
+		ORDER BY id
+	`, companyID, alertType)
+	if err != nil {
+		return fmt.Errorf("failed to load notification connectors: %w", err)
+	}
+	var connectors []Connector
+	for rows.Next() {
+		var connector Connector
+		if err := rows.Scan(&connector.ID, &connector.CompanyID, &connector.Provider, &connector.WebhookURL,
+			&connector.Channel, &connector.Template, &connector.RateLimitPerHour); err == nil {
+			connectors = append(connectors, connector)
+		}
+	}
+	rows.Close()
+
+	for _, connector := range connectors {
+		text, err := Render(connector.Template, alertType, data)
+		if err != nil {
+			fmt.Printf("Warning: failed to render %s message for connector %d: %v\n", alertType, connector.ID, err)
+			continue
+		}
+		messageID, status, err := n.record(connector, alertType, text)
+		if err != nil {
+			fmt.Printf("Warning: failed to record %s message for connector %d: %v\n", alertType, connector.ID, err)
+			continue
+		}
+		if status == StatusPending {
+			go n.deliver(messageID, connector, alertType, text)
+		}
+	}
+	return nil
+}
+
+// record stores a message, marking it rate limited when the connector already sent its hourly allowance
+func (n *Notifier) record(connector Connector, alertType, text string) (int, string, error) {
+	limit := connector.RateLimitPerHour
+	if limit <= 0 {
+		limit = n.RateLimitPerHour
+	}
+
+	var id int
+	var status string
+	err := db.DB.QueryRow(`
+		INSERT INTO notification_message (connector_id, alert_type, text, status, created_at)
+		SELECT $1, $2, $3,
+			CASE WHEN $4::int > 0 AND (
+				SELECT COUNT(*) FROM notification_message
+				WHERE connector_id = $1 AND status <> $6::text AND created_at > NOW() - INTERVAL '1 hour'
+			) >= $4::int THEN $6::text ELSE $5::text END,
+			NOW()
+		RETURNING id, status
+	`, connector.ID, alertType, text, limit, StatusPending, StatusRateLimited).Scan(&id, &status)
+	return id, status, err
+}
+
+// deliver posts a recorded message and stores the outcome
+func (n *Notifier) deliver(messageID int, connector Connector, alertType, text string) {
+	statusCode, err := n.Send(connector, alertType, text)
+	if err == nil {
+		db.DB.Exec(`
+			UPDATE notification_message SET status = $2, response_code = $3, sent_at = NOW() WHERE id = $1
+		`, messageID, StatusSent, statusCode)
+		return
+	}
+	db.DB.Exec(`
+		UPDATE notification_message SET status = $2, response_code = NULLIF($3, 0), last_error = $4 WHERE id = $1
+	`, messageID, StatusFailed, statusCode, err.Error())
+}
+
+// Send posts a message to a connector's incoming webhook and reports the response status
+func (n *Notifier) Send(connector Connector, alertType, text string) (int, error) {
+	body, err := Payload(connector, alertType, text)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest("POST", connector.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TracePost-Notifications/1.0")
+	jws, err := signing.Sign(body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sign payload: %w", err)
+	}
+	req.Header.Set(signing.HeaderName, jws)
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("%s returned HTTP %d", connector.Provider, resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Payload builds the webhook body of a message for the connector's provider
+func Payload(connector Connector, alertType, text string) ([]byte, error) {
+	title := Titles[alertType]
+	if title == "" {
+		title = "TracePost notification"
+	}
+
+	switch connector.Provider {
+	case ProviderSlack:
+		message := map[string]interface{}{
+			"text": "*" + title + "*\n" + text,
+		}
+		if connector.Channel != "" {
+			message["channel"] = connector.Channel
+		}
+		return json.Marshal(message)
+	case ProviderTeams:
+		return json.Marshal(map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    title,
+			"title":      title,
+			"themeColor": "D9534F",
+			// Teams renders markdown, which needs two spaces to break a line
+			"text": strings.ReplaceAll(text, "\n", "  \n"),
+		})
+	}
+	return nil, fmt.Errorf("unsupported provider %q", connector.Provider)
+}
+
+// AlertTypes returns the alert types connectors can subscribe to
+func AlertTypes() []string {
+	return []string{AlertEnvironment, AlertAnchoringFailed, AlertDisputeOpened, AlertNodesDegraded, AlertSLABreached}
+}
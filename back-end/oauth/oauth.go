@@ -0,0 +1,326 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+	"github.com/LTPPPP/TracePost-larvaeChain/signing"
+)
+
+// GrantClientCredentials is the only grant type the token endpoint supports
+const GrantClientCredentials = "client_credentials"
+
+// Scopes of the integration API a client can be granted
+const (
+	ScopeReportsRead    = "reports:read"
+	ScopeUsageRead      = "usage:read"
+	ScopeWebhooksManage = "webhooks:manage"
+)
+
+// Scopes describes every scope a client can be granted
+var Scopes = map[string]string{
+	ScopeReportsRead:    "Read the transfer price, ESG, production variance and partner SLA reports of the company",
+	ScopeUsageRead:      "Read the API usage of the company",
+	ScopeWebhooksManage: "List, create and delete the webhook subscriptions of the company and read their deliveries",
+}
+
+var (
+	// ErrNotFound is returned for a client that does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidClient is returned when a client cannot be authenticated, or is revoked
+	ErrInvalidClient = errors.New("invalid client")
+	// ErrInvalidScope is returned for unknown scopes, or scopes the client was not granted
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrInvalidRequest is returned for a client with missing fields
+	ErrInvalidRequest = errors.New("invalid request")
+)
+
+// Client is a confidential client a company registered for a machine integration
+type Client struct {
+	ID           int        `json:"id"`
+	CompanyID    int        `json:"company_id"`
+	ClientID     string     `json:"client_id"`
+	Name         string     `json:"name"`
+	SecretPrefix string     `json:"secret_prefix"`           // First characters of the secret, to tell secrets apart
+	Secret       string     `json:"client_secret,omitempty"` // Only returned when the secret is generated
+	Scopes       []string   `json:"scopes"`
+	LastTokenAt  *time.Time `json:"last_token_at,omitempty"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Token is an access token issued to a client
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// NormalizeScopes checks scopes and returns them sorted without duplicates
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || seen[scope] {
+			continue
+		}
+		if _, ok := Scopes[scope]; !ok {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidScope, scope)
+		}
+		seen[scope] = true
+		normalized = append(normalized, scope)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// hashSecret hashes a client secret for storage; only the hash is kept
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+const clientColumns = `id, company_id, client_id, name, secret_prefix, scopes, last_token_at, last_used_at, revoked_at, created_at`
+
+// scanClient reads a client selected with clientColumns
+func scanClient(row interface{ Scan(...interface{}) error }) (*Client, error) {
+	var c Client
+	var lastTokenAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&c.ID, &c.CompanyID, &c.ClientID, &c.Name, &c.SecretPrefix, pq.Array(&c.Scopes),
+		&lastTokenAt, &lastUsedAt, &revokedAt, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if c.Scopes == nil {
+		c.Scopes = []string{}
+	}
+	if lastTokenAt.Valid {
+		c.LastTokenAt = &lastTokenAt.Time
+	}
+	if lastUsedAt.Valid {
+		c.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		c.RevokedAt = &revokedAt.Time
+	}
+	return &c, nil
+}
+
+// Create registers a client for a company and returns it with its secret, which is not stored
+func Create(companyID int, name string, scopes []string, userID int) (*Client, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidRequest)
+	}
+	scopes, err := NormalizeScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	id, err := randomHex(12)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	secret = "tps_" + secret
+
+	client, err := scanClient(db.DB.QueryRow(`
+		INSERT INTO oauth_client (company_id, client_id, name, secret_prefix, secret_hash, scopes, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NOW(), NOW())
+		RETURNING `+clientColumns,
+		companyID, "tpc_"+id, name, secret[:12], hashSecret(secret), pq.Array(scopes), userID))
+	if err != nil {
+		return nil, err
+	}
+	client.Secret = secret
+	return client, nil
+}
+
+// List returns the clients of a company, revoked ones included
+func List(companyID int) ([]Client, error) {
+	rows, err := db.DB.Query(`SELECT `+clientColumns+` FROM oauth_client WHERE company_id = $1 ORDER BY id`, companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	clients := []Client{}
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, rows.Err()
+}
+
+// Revoke disables a client; the tokens already issued to it stop working at once
+func Revoke(companyID, id int) error {
+	result, err := db.DB.Exec(`
+		UPDATE oauth_client SET revoked_at = COALESCE(revoked_at, NOW()), updated_at = NOW() WHERE id = $1 AND company_id = $2
+	`, id, companyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RotateSecret replaces the secret of an active client and returns the client with the new secret.
+// Tokens issued with the old secret keep working until they expire
+func RotateSecret(companyID, id int) (*Client, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	secret = "tps_" + secret
+
+	client, err := scanClient(db.DB.QueryRow(`
+		UPDATE oauth_client SET secret_prefix = $3, secret_hash = $4, updated_at = NOW()
+		WHERE id = $1 AND company_id = $2 AND revoked_at IS NULL
+		RETURNING `+clientColumns,
+		id, companyID, secret[:12], hashSecret(secret)))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	client.Secret = secret
+	return client, nil
+}
+
+// Authenticate checks the credentials of a client and returns it when it is active
+func Authenticate(clientID, secret string) (*Client, error) {
+	var id int
+	var hash string
+	err := db.DB.QueryRow(`SELECT id, secret_hash FROM oauth_client WHERE client_id = $1`, clientID).Scan(&id, &hash)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashSecret(secret))) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	client, err := scanClient(db.DB.QueryRow(`SELECT `+clientColumns+` FROM oauth_client WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+	if client.RevokedAt != nil {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// Issue signs a short-lived access token for a client. The requested scopes must be granted to the client;
+// without any, the token carries every scope of the client
+func Issue(client *Client, requested []string) (*Token, error) {
+	scopes := client.Scopes
+	if len(requested) > 0 {
+		normalized, err := NormalizeScopes(requested)
+		if err != nil {
+			return nil, err
+		}
+		granted := map[string]bool{}
+		for _, scope := range client.Scopes {
+			granted[scope] = true
+		}
+		for _, scope := range normalized {
+			if !granted[scope] {
+				return nil, fmt.Errorf("%w: scope %q is not granted to the client", ErrInvalidScope, scope)
+			}
+		}
+		scopes = normalized
+	}
+
+	cfg := config.GetConfig()
+	key, err := signing.Default().Current(signing.PurposeToken)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	ttl := time.Duration(cfg.OAuthAccessTokenTTLSeconds) * time.Second
+	tokenID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	claims := newClientClaims(client, scopes, cfg.JWTIssuer, tokenID, now, ttl)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.KID
+	signed, err := token.SignedString(key.Signer())
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.DB.Exec(`UPDATE oauth_client SET last_token_at = NOW() WHERE id = $1`, client.ID); err != nil {
+		return nil, err
+	}
+	return &Token{AccessToken: signed, TokenType: "Bearer", ExpiresIn: int(ttl.Seconds()), Scope: claims.Scope}, nil
+}
+
+// newClientClaims builds the claims of a client access token. The token_use claim keeps it from being
+// accepted as a user session, since both are signed with the token key
+func newClientClaims(client *Client, scopes []string, issuer, tokenID string, now time.Time, ttl time.Duration) models.ClientClaims {
+	return models.ClientClaims{
+		ClientID:  client.ClientID,
+		CompanyID: client.CompanyID,
+		Scope:     strings.Join(scopes, " "),
+		TokenUse:  models.TokenUseClient,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    issuer,
+			Subject:   client.ClientID,
+			ID:        tokenID,
+		},
+	}
+}
+
+// Active reports whether a client may still use its tokens, and records that it did
+func Active(clientID string) (bool, error) {
+	result, err := db.DB.Exec(`
+		UPDATE oauth_client SET last_used_at = NOW() WHERE client_id = $1 AND revoked_at IS NULL
+	`, clientID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,72 @@
+package oauth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/middleware"
+	"github.com/LTPPPP/TracePost-larvaeChain/models"
+)
+
+// signTestToken signs claims with the HS256 secret the middlewares accept in tests
+func signTestToken(t *testing.T, claims jwt.Claims) string {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestClientTokenIsRefusedAsUserSession(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("JWT_ACCEPT_HS256", "true")
+	t.Setenv("JWT_ISSUER", "tracepost-test")
+
+	now := time.Now()
+	client := &Client{ClientID: "tp_client", CompanyID: 4, Scopes: []string{ScopeReportsRead}}
+	clientToken := signTestToken(t, newClientClaims(client, client.Scopes, "tracepost-test", "client-token", now, time.Hour))
+	userToken := signTestToken(t, models.JWTClaims{
+		UserID:    9,
+		Role:      "manager",
+		CompanyID: 4,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			Issuer:    "tracepost-test",
+			ID:        "user-token",
+		},
+	})
+
+	app := fiber.New()
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }
+	app.Get("/user", middleware.JWTMiddleware(), ok)
+	app.Get("/integration", middleware.ClientCredentials(func(string) (bool, error) { return true, nil }), ok)
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"client token on user route", "/user", clientToken, fiber.StatusUnauthorized},
+		{"user token on user route", "/user", userToken, fiber.StatusNoContent},
+		{"client token on integration route", "/integration", clientToken, fiber.StatusNoContent},
+		{"user token on integration route", "/integration", userToken, fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, tt.path, nil)
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer "+tt.token)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package orgs
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Permission inheritance of an organization: what its head company may do for the companies below it
+const (
+	InheritNone   = "none"   // the head company acts only for itself
+	InheritRead   = "read"   // the head company reads the reports of the companies below the organization
+	InheritManage = "manage" // the head company acts for the companies below the organization
+)
+
+// inheritanceRank orders inheritance options from weakest to strongest
+var inheritanceRank = map[string]int{InheritNone: 0, InheritRead: 1, InheritManage: 2}
+
+var (
+	// ErrNotFound is returned for an organization that does not exist
+	ErrNotFound = errors.New("organization not found")
+	// ErrCompanyNotFound is returned for a company that does not exist or is not in the organization
+	ErrCompanyNotFound = errors.New("company not found")
+	// ErrInvalid is returned for an organization with missing or unknown fields, or a parent that would make a cycle
+	ErrInvalid = errors.New("invalid organization")
+	// ErrNotEmpty is returned when deleting an organization that still has child organizations or companies
+	ErrNotEmpty = errors.New("organization still has child organizations or companies")
+)
+
+// Organization groups companies, and other organizations, under a parent group
+type Organization struct {
+	ID            int       `json:"id"`
+	ParentID      int       `json:"parent_id,omitempty"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description,omitempty"`
+	HeadCompanyID int       `json:"head_company_id,omitempty"` // Company the inheritance is granted to
+	Inheritance   string    `json:"inheritance"`               // none, read or manage
+	CompanyIDs    []int     `json:"company_ids"`               // Companies directly in the organization
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Node is an organization with the organizations below it
+type Node struct {
+	Organization
+	Children []*Node `json:"children"`
+}
+
+// Validate normalizes an organization and checks its fields
+func (o *Organization) Validate() error {
+	o.Name = strings.TrimSpace(o.Name)
+	o.Description = strings.TrimSpace(o.Description)
+	if o.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if o.Inheritance == "" {
+		o.Inheritance = InheritNone
+	}
+	if _, ok := inheritanceRank[o.Inheritance]; !ok {
+		return fmt.Errorf("%w: inheritance must be none, read or manage", ErrInvalid)
+	}
+	if o.Inheritance != InheritNone && o.HeadCompanyID == 0 {
+		return fmt.Errorf("%w: inheritance needs a head company", ErrInvalid)
+	}
+	return nil
+}
+
+const organizationColumns = `
+	o.id, COALESCE(o.parent_id, 0), o.name, COALESCE(o.description, ''), COALESCE(o.head_company_id, 0), o.inheritance,
+	ARRAY(SELECT c.id FROM company c WHERE c.organization_id = o.id AND c.is_active = true ORDER BY c.id), o.created_at, o.updated_at
+`
+
+// scanOrganization reads an organization selected with organizationColumns
+func scanOrganization(row interface{ Scan(...interface{}) error }) (Organization, error) {
+	var o Organization
+	var companyIDs pq.Int64Array
+	err := row.Scan(&o.ID, &o.ParentID, &o.Name, &o.Description, &o.HeadCompanyID, &o.Inheritance,
+		&companyIDs, &o.CreatedAt, &o.UpdatedAt)
+	o.CompanyIDs = make([]int, len(companyIDs))
+	for i, id := range companyIDs {
+		o.CompanyIDs[i] = int(id)
+	}
+	return o, err
+}
+
+// List returns every organization, by name
+func List() ([]Organization, error) {
+	rows, err := db.DB.Query(`SELECT ` + organizationColumns + ` FROM organization o ORDER BY o.name, o.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	organizations := []Organization{}
+	for rows.Next() {
+		o, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		organizations = append(organizations, o)
+	}
+	return organizations, rows.Err()
+}
+
+// Get returns an organization
+func Get(id int) (*Organization, error) {
+	o, err := scanOrganization(db.DB.QueryRow(`SELECT `+organizationColumns+` FROM organization o WHERE o.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// checkReferences checks the parent and head company of an organization; id is 0 for a new organization
+func checkReferences(id int, o Organization) error {
+	if o.ParentID != 0 {
+		var exists bool
+		if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM organization WHERE id = $1)", o.ParentID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: parent organization %d does not exist", ErrInvalid, o.ParentID)
+		}
+		if id != 0 {
+			subtree, err := Subtree(id)
+			if err != nil {
+				return err
+			}
+			for _, orgID := range subtree {
+				if orgID == o.ParentID {
+					return fmt.Errorf("%w: an organization cannot be placed below itself", ErrInvalid)
+				}
+			}
+		}
+	}
+	if o.HeadCompanyID != 0 {
+		var exists bool
+		if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM company WHERE id = $1 AND is_active = true)", o.HeadCompanyID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: head company %d does not exist", ErrInvalid, o.HeadCompanyID)
+		}
+	}
+	return nil
+}
+
+// Create records an organization
+func Create(o Organization, userID int) (*Organization, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkReferences(0, o); err != nil {
+		return nil, err
+	}
+	var id int
+	err := db.DB.QueryRow(`
+		INSERT INTO organization (parent_id, name, description, head_company_id, inheritance, created_by, updated_by, created_at, updated_at)
+		VALUES (NULLIF($1, 0), $2, NULLIF($3, ''), NULLIF($4, 0), $5, NULLIF($6, 0), NULLIF($6, 0), NOW(), NOW())
+		RETURNING id
+	`, o.ParentID, o.Name, o.Description, o.HeadCompanyID, o.Inheritance, userID).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return Get(id)
+}
+
+// Update replaces the fields of an organization; moving it below one of its own descendants is refused
+func Update(id int, o Organization, userID int) (*Organization, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := Get(id); err != nil {
+		return nil, err
+	}
+	if err := checkReferences(id, o); err != nil {
+		return nil, err
+	}
+	_, err := db.DB.Exec(`
+		UPDATE organization
+		SET parent_id = NULLIF($2, 0), name = $3, description = NULLIF($4, ''), head_company_id = NULLIF($5, 0),
+			inheritance = $6, updated_by = NULLIF($7, 0), updated_at = NOW()
+		WHERE id = $1
+	`, id, o.ParentID, o.Name, o.Description, o.HeadCompanyID, o.Inheritance, userID)
+	if err != nil {
+		return nil, err
+	}
+	return Get(id)
+}
+
+// Delete removes an organization without child organizations or companies
+func Delete(id int) error {
+	var children, companies int
+	err := db.DB.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM organization WHERE parent_id = $1), (SELECT COUNT(*) FROM company WHERE organization_id = $1)
+	`, id).Scan(&children, &companies)
+	if err != nil {
+		return err
+	}
+	if children > 0 || companies > 0 {
+		return ErrNotEmpty
+	}
+	result, err := db.DB.Exec("DELETE FROM organization WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AssignCompany places a company in an organization, moving it out of the one it was in
+func AssignCompany(orgID, companyID int) error {
+	if _, err := Get(orgID); err != nil {
+		return err
+	}
+	result, err := db.DB.Exec("UPDATE company SET organization_id = $1, updated_at = NOW() WHERE id = $2 AND is_active = true", orgID, companyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrCompanyNotFound
+	}
+	return nil
+}
+
+// RemoveCompany takes a company out of an organization
+func RemoveCompany(orgID, companyID int) error {
+	result, err := db.DB.Exec("UPDATE company SET organization_id = NULL, updated_at = NOW() WHERE id = $1 AND organization_id = $2", companyID, orgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrCompanyNotFound
+	}
+	return nil
+}
+
+// Subtree returns an organization and every organization below it
+func Subtree(orgID int) ([]int, error) {
+	rows, err := db.DB.Query(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM organization WHERE id = $1
+			UNION
+			SELECT o.id FROM organization o JOIN subtree s ON o.parent_id = s.id
+		)
+		SELECT id FROM subtree ORDER BY id
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Subsidiaries returns the active companies in an organization or any organization below it, with the
+// organization each is directly in
+func Subsidiaries(orgID int) (map[int]int, error) {
+	subtree, err := Subtree(orgID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.DB.Query(`
+		SELECT id, organization_id FROM company WHERE organization_id = ANY($1) AND is_active = true
+	`, pq.Array(subtree))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	companies := map[int]int{}
+	for rows.Next() {
+		var companyID, companyOrgID int
+		if err := rows.Scan(&companyID, &companyOrgID); err != nil {
+			return nil, err
+		}
+		companies[companyID] = companyOrgID
+	}
+	return companies, rows.Err()
+}
+
+// strongestInheritance returns the strongest inheritance granted to a company by the organizations an anchor
+// query selects and every organization above them
+func strongestInheritance(anchor string, callerCompanyID int, args ...interface{}) (string, error) {
+	if callerCompanyID == 0 {
+		return InheritNone, nil
+	}
+	args = append(args, callerCompanyID)
+	rows, err := db.DB.Query(`
+		WITH RECURSIVE ancestors AS (
+			`+anchor+`
+			UNION
+			SELECT p.id, p.parent_id, p.head_company_id, p.inheritance
+			FROM organization p JOIN ancestors a ON p.id = a.parent_id
+		)
+		SELECT inheritance FROM ancestors WHERE head_company_id = $`+fmt.Sprint(len(args)), args...)
+	if err != nil {
+		return InheritNone, err
+	}
+	defer rows.Close()
+	access := InheritNone
+	for rows.Next() {
+		var inheritance string
+		if err := rows.Scan(&inheritance); err != nil {
+			return InheritNone, err
+		}
+		if inheritanceRank[inheritance] > inheritanceRank[access] {
+			access = inheritance
+		}
+	}
+	return access, rows.Err()
+}
+
+// Access returns what a company may do for another through the organizations above the other company:
+// the strongest inheritance of those organizations headed by the caller
+func Access(callerCompanyID, companyID int) (string, error) {
+	return strongestInheritance(`
+		SELECT o.id, o.parent_id, o.head_company_id, o.inheritance
+		FROM organization o JOIN company c ON c.organization_id = o.id WHERE c.id = $1
+	`, callerCompanyID, companyID)
+}
+
+// OrganizationAccess returns what a company may do for the companies below an organization
+func OrganizationAccess(callerCompanyID, orgID int) (string, error) {
+	return strongestInheritance(`
+		SELECT o.id, o.parent_id, o.head_company_id, o.inheritance FROM organization o WHERE o.id = $1
+	`, callerCompanyID, orgID)
+}
+
+// Allows reports whether an access grants at least the wanted inheritance
+func Allows(access, wanted string) bool {
+	return inheritanceRank[access] >= inheritanceRank[wanted]
+}
+
+// Tree returns the organizations as trees below their roots, by name
+func Tree() ([]*Node, error) {
+	organizations, err := List()
+	if err != nil {
+		return nil, err
+	}
+	nodes := map[int]*Node{}
+	for _, o := range organizations {
+		nodes[o.ID] = &Node{Organization: o, Children: []*Node{}}
+	}
+	roots := []*Node{}
+	for _, o := range organizations {
+		node := nodes[o.ID]
+		if parent, ok := nodes[o.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	return roots, nil
+}
@@ -0,0 +1,155 @@
+package quality
+
+import (
+	"math"
+	"sort"
+)
+
+// Flags raised on the parameters of a reading
+const (
+	FlagOutOfRange   = "out_of_range"
+	FlagSpike        = "spike"
+	FlagStuck        = "stuck"
+	FlagUncalibrated = "uncalibrated"
+)
+
+const (
+	// StuckWindow is the number of identical previous readings after which a sensor counts as stuck
+	StuckWindow = 5
+	// SpikeWindow is the number of previous readings used as the baseline for spike detection
+	SpikeWindow = 10
+	// SpikeDeviations is how many standard deviations from the baseline make a spike
+	SpikeDeviations = 4.0
+	// SpikeMinChange is the smallest relative change from the baseline that counts as a spike
+	SpikeMinChange = 0.1
+	// SuppressBelow is the score under which a reading is left out of analytics and alerts
+	SuppressBelow = 0.5
+)
+
+// penalties is the share of the score each flag takes away
+var penalties = map[string]float64{
+	FlagOutOfRange:   0.6,
+	FlagSpike:        0.4,
+	FlagStuck:        0.3,
+	FlagUncalibrated: 0.2,
+}
+
+// Range is the physical range of a parameter; nil bounds are open
+type Range struct {
+	Min *float64
+	Max *float64
+}
+
+// Assessment is the quality of one reading
+type Assessment struct {
+	Score      float64  `json:"score"`
+	Flags      []string `json:"flags"` // "<parameter>:<flag>", or the flag alone when it applies to the device
+	Suppressed bool     `json:"suppressed"`
+}
+
+// Assess scores a sensor reading
+// history holds the previous readings of the same sensor, latest first
+func Assess(values map[string]float64, history []map[string]float64, ranges map[string]Range, calibrated bool) Assessment {
+	codes := make([]string, 0, len(values))
+	for code := range values {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	a := Assessment{Score: 1, Flags: []string{}}
+	raise := func(code, flag string) {
+		if code == "" {
+			a.Flags = append(a.Flags, flag)
+		} else {
+			a.Flags = append(a.Flags, code+":"+flag)
+		}
+		a.Score *= 1 - penalties[flag]
+		if flag == FlagOutOfRange {
+			a.Suppressed = true
+		}
+	}
+
+	for _, code := range codes {
+		value := values[code]
+		previous := series(history, code)
+
+		if r, ok := ranges[code]; ok && ((r.Min != nil && value < *r.Min) || (r.Max != nil && value > *r.Max)) {
+			raise(code, FlagOutOfRange)
+			continue
+		}
+		if value == 0 {
+			continue
+		}
+		if isStuck(value, previous) {
+			raise(code, FlagStuck)
+		} else if isSpike(value, previous) {
+			raise(code, FlagSpike)
+		}
+	}
+	if !calibrated {
+		raise("", FlagUncalibrated)
+	}
+
+	a.Score = math.Round(a.Score*100) / 100
+	if a.Score < SuppressBelow {
+		a.Suppressed = true
+	}
+	return a
+}
+
+// series returns the previous values of a parameter, latest first
+// Zeros are left out: they are what clients send for parameters the sensor does not measure
+func series(history []map[string]float64, code string) []float64 {
+	values := []float64{}
+	for _, reading := range history {
+		if v, ok := reading[code]; ok && v != 0 {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// isStuck reports whether a sensor repeated the same value for the whole stuck window
+func isStuck(value float64, previous []float64) bool {
+	if len(previous) < StuckWindow {
+		return false
+	}
+	for _, v := range previous[:StuckWindow] {
+		if v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// isSpike reports whether a value jumps away from the recent baseline of the sensor
+func isSpike(value float64, previous []float64) bool {
+	if len(previous) > SpikeWindow {
+		previous = previous[:SpikeWindow]
+	}
+	if len(previous) < 3 {
+		return false
+	}
+
+	var mean float64
+	for _, v := range previous {
+		mean += v
+	}
+	mean /= float64(len(previous))
+
+	var variance float64
+	for _, v := range previous {
+		variance += (v - mean) * (v - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(previous)))
+
+	change := math.Abs(value - mean)
+	if change <= SpikeMinChange*math.Abs(mean) {
+		return false
+	}
+	if stddev == 0 {
+		// A steady baseline leaves no spread to compare with, so the relative change decides
+		return true
+	}
+	return change > SpikeDeviations*stddev
+}
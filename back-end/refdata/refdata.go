@@ -0,0 +1,339 @@
+package refdata
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/region"
+)
+
+// Kinds of reference data shared by every region
+const (
+	KindSpecies = "species"  // species catalog
+	KindRuleSet = "rule_set" // compliance and alert rule sets
+)
+
+// Kinds lists the kinds of reference data
+var Kinds = []string{KindSpecies, KindRuleSet}
+
+// TokenHeader carries the replication token regions present to each other
+const TokenHeader = "X-Replication-Token"
+
+// ErrUnknownKind is returned for a kind of reference data that is not replicated
+var ErrUnknownKind = errors.New("unknown reference data kind")
+
+// Entry is a reference data entry. Every region may write any entry; replicas keep the write with
+// the highest hybrid logical timestamp, and of the origin region on equal timestamps, so all regions
+// settle on the same value whatever order they receive writes in. Deletes are kept as tombstones
+type Entry struct {
+	Kind         string          `json:"kind"`
+	Key          string          `json:"key"`
+	Value        json.RawMessage `json:"value" swaggertype:"object"`
+	Deleted      bool            `json:"deleted,omitempty"`
+	HLC          int64           `json:"hlc"`
+	OriginRegion string          `json:"origin_region"`
+	Seq          int64           `json:"seq"` // Order the entry last changed in this region, the cursor of replicas pulling from it
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// PeerStatus is the replication state of a region this region pulls from
+type PeerStatus struct {
+	Region       string     `json:"region"`
+	Endpoint     string     `json:"endpoint"`
+	LastSeq      int64      `json:"last_seq"`
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// Store reads and writes reference data and pulls the changes of other regions
+type Store struct {
+	Regions    *region.Regions
+	Token      string
+	Interval   time.Duration
+	BatchSize  int
+	HTTPClient *http.Client
+
+	clock     region.Clock
+	clockOnce sync.Once
+}
+
+var (
+	defaultStore *Store
+	once         sync.Once
+)
+
+// NewStore creates a store from the application config
+func NewStore(cfg *config.Config) *Store {
+	return &Store{
+		Regions:    region.Default(),
+		Token:      cfg.RegionReplicationToken,
+		Interval:   time.Duration(cfg.RegionReplicationIntervalSeconds) * time.Second,
+		BatchSize:  500,
+		HTTPClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Default returns the process wide store
+func Default() *Store {
+	once.Do(func() {
+		defaultStore = NewStore(config.GetConfig())
+	})
+	return defaultStore
+}
+
+// ValidKind reports whether a kind of reference data is replicated
+func ValidKind(kind string) bool {
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+const entryColumns = `kind, key, value, deleted, hlc, origin_region, seq, updated_at`
+
+// scanEntry reads an entry selected with entryColumns
+func scanEntry(row interface{ Scan(...interface{}) error }) (Entry, error) {
+	var e Entry
+	var value []byte
+	err := row.Scan(&e.Kind, &e.Key, &value, &e.Deleted, &e.HLC, &e.OriginRegion, &e.Seq, &e.UpdatedAt)
+	e.Value = value
+	return e, err
+}
+
+// queryEntries runs an entry query and collects the results
+func queryEntries(conn *sql.DB, query string, args ...interface{}) ([]Entry, error) {
+	rows, err := conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// now returns a timestamp for a local write, first moving the clock past every stored write
+func (s *Store) now() int64 {
+	s.clockOnce.Do(func() {
+		var latest sql.NullInt64
+		if err := db.DB.QueryRow(`SELECT MAX(hlc) FROM reference_entry`).Scan(&latest); err == nil {
+			s.clock.Observe(latest.Int64)
+		}
+	})
+	return s.clock.Now()
+}
+
+// List returns the live entries of a kind, from the local replica
+func (s *Store) List(kind string) ([]Entry, error) {
+	return queryEntries(db.Reader(), `SELECT `+entryColumns+` FROM reference_entry WHERE kind = $1 AND deleted = false ORDER BY key`, kind)
+}
+
+// Get returns an entry, including a deleted one
+func (s *Store) Get(kind, key string) (Entry, error) {
+	return scanEntry(db.Reader().QueryRow(`SELECT `+entryColumns+` FROM reference_entry WHERE kind = $1 AND key = $2`, kind, key))
+}
+
+// Put writes an entry in this region
+func (s *Store) Put(kind, key string, value json.RawMessage, userID int) (Entry, error) {
+	return s.write(kind, key, value, false, userID)
+}
+
+// Delete deletes an entry in this region, leaving a tombstone for other regions to replicate
+func (s *Store) Delete(kind, key string, userID int) (Entry, error) {
+	return s.write(kind, key, json.RawMessage("{}"), true, userID)
+}
+
+// write records a local write; it always wins, its timestamp being past every stored one
+func (s *Store) write(kind, key string, value json.RawMessage, deleted bool, userID int) (Entry, error) {
+	if !ValidKind(kind) {
+		return Entry{}, ErrUnknownKind
+	}
+	e := Entry{Kind: kind, Key: key, Value: value, Deleted: deleted, HLC: s.now(), OriginRegion: s.Regions.Current}
+	if _, err := s.merge(e, userID); err != nil {
+		return Entry{}, err
+	}
+	return scanEntry(db.DB.QueryRow(`SELECT `+entryColumns+` FROM reference_entry WHERE kind = $1 AND key = $2`, kind, key))
+}
+
+// merge stores an entry unless the stored one is a later write, reporting whether it was stored
+func (s *Store) merge(e Entry, userID int) (bool, error) {
+	result, err := db.DB.Exec(`
+		INSERT INTO reference_entry (kind, key, value, deleted, hlc, origin_region, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NOW())
+		ON CONFLICT (kind, key) DO UPDATE SET
+			value = EXCLUDED.value,
+			deleted = EXCLUDED.deleted,
+			hlc = EXCLUDED.hlc,
+			origin_region = EXCLUDED.origin_region,
+			seq = nextval('reference_entry_seq_seq'),
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+		WHERE (EXCLUDED.hlc, EXCLUDED.origin_region) > (reference_entry.hlc, reference_entry.origin_region)
+	`, e.Kind, e.Key, []byte(e.Value), e.Deleted, e.HLC, e.OriginRegion, userID)
+	if err != nil {
+		return false, err
+	}
+	stored, _ := result.RowsAffected()
+	return stored > 0, nil
+}
+
+// Changes returns the entries changed in this region after a cursor, tombstones included, in change order.
+// Changes of the last seconds are held back: a transaction may still commit a lower seq, which a replica
+// that already moved its cursor past would never pull
+func (s *Store) Changes(since int64, limit int) ([]Entry, error) {
+	if limit <= 0 || limit > s.BatchSize {
+		limit = s.BatchSize
+	}
+	return queryEntries(db.DB, `
+		SELECT `+entryColumns+` FROM reference_entry
+		WHERE seq > $1 AND updated_at < NOW() - INTERVAL '5 seconds'
+		ORDER BY seq LIMIT $2
+	`, since, limit)
+}
+
+// Start pulls the changes of every other region periodically
+func (s *Store) Start() {
+	if len(s.Regions.Peers()) == 0 {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(s.Interval)
+
+			for _, peer := range s.Regions.Peers() {
+				if err := s.Pull(peer); err != nil {
+					fmt.Printf("Warning: reference data replication from %s failed: %v\n", peer, err)
+				}
+			}
+		}
+	}()
+}
+
+// Pull merges the changes of a region since the last pull
+func (s *Store) Pull(peer string) error {
+	if db.DB == nil {
+		return nil
+	}
+	endpoint := s.Regions.Endpoints[peer]
+	if endpoint == "" {
+		return fmt.Errorf("no endpoint for region %s", peer)
+	}
+	var cursor int64
+	err := db.DB.QueryRow(`SELECT last_seq FROM reference_sync_peer WHERE region = $1`, peer).Scan(&cursor)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	for {
+		entries, err := s.fetch(endpoint, cursor)
+		if err != nil {
+			s.recordPull(peer, cursor, err)
+			return err
+		}
+		for _, e := range entries {
+			if !ValidKind(e.Kind) {
+				continue
+			}
+			s.clock.Observe(e.HLC)
+			if _, err := s.merge(e, 0); err != nil {
+				s.recordPull(peer, cursor, err)
+				return err
+			}
+			cursor = e.Seq
+		}
+		s.recordPull(peer, cursor, nil)
+		if len(entries) < s.BatchSize {
+			return nil
+		}
+	}
+}
+
+// fetch gets the changes of a region after a cursor
+func (s *Store) fetch(endpoint string, since int64) ([]Entry, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint+"/api/v1/regions/replication/changes?since="+url.QueryEscape(strconv.FormatInt(since, 10))+
+		"&limit="+strconv.Itoa(s.BatchSize), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(TokenHeader, s.Token)
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("region returned status %d", resp.StatusCode)
+	}
+	var body struct {
+		Data []Entry `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid replication response: %w", err)
+	}
+	return body.Data, nil
+}
+
+// recordPull saves the cursor and outcome of a pull
+func (s *Store) recordPull(peer string, cursor int64, pullErr error) {
+	lastError := ""
+	if pullErr != nil {
+		lastError = pullErr.Error()
+	}
+	_, err := db.DB.Exec(`
+		INSERT INTO reference_sync_peer (region, last_seq, last_synced_at, last_error, updated_at)
+		VALUES ($1, $2, CASE WHEN $3::text = '' THEN NOW() END, NULLIF($3::text, ''), NOW())
+		ON CONFLICT (region) DO UPDATE SET
+			last_seq = EXCLUDED.last_seq,
+			last_synced_at = COALESCE(EXCLUDED.last_synced_at, reference_sync_peer.last_synced_at),
+			last_error = EXCLUDED.last_error,
+			updated_at = NOW()
+	`, peer, cursor, lastError)
+	if err != nil {
+		fmt.Printf("Warning: failed to record replication from %s: %v\n", peer, err)
+	}
+}
+
+// Peers returns the replication state of every other region
+func (s *Store) Peers() ([]PeerStatus, error) {
+	peers := []PeerStatus{}
+	for _, code := range s.Regions.Peers() {
+		p := PeerStatus{Region: code, Endpoint: s.Regions.Endpoints[code]}
+		var syncedAt sql.NullTime
+		var lastError sql.NullString
+		err := db.DB.QueryRow(`SELECT last_seq, last_synced_at, last_error FROM reference_sync_peer WHERE region = $1`, code).
+			Scan(&p.LastSeq, &syncedAt, &lastError)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if syncedAt.Valid {
+			p.LastSyncedAt = &syncedAt.Time
+		}
+		p.LastError = lastError.String
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+// NormalizeKey trims a reference data key
+func NormalizeKey(key string) string {
+	return strings.TrimSpace(key)
+}
@@ -0,0 +1,44 @@
+package region
+
+import (
+	"sync"
+	"time"
+)
+
+// logicalBits is the number of low bits of a timestamp holding the logical counter
+const logicalBits = 16
+
+// Clock is a hybrid logical clock. Timestamps are milliseconds shifted left by 16 bits plus a counter,
+// so they follow wall time but never go backwards and always pass every timestamp observed from other regions.
+// Ordering replicated writes by timestamp then by region makes every region settle on the same last write
+type Clock struct {
+	mu   sync.Mutex
+	last int64
+}
+
+// Now returns a timestamp greater than every timestamp returned or observed before
+func (c *Clock) Now() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	physical := time.Now().UnixMilli() << logicalBits
+	if physical > c.last {
+		c.last = physical
+	} else {
+		c.last++
+	}
+	return c.last
+}
+
+// Observe moves the clock past a timestamp received from another region
+func (c *Clock) Observe(remote int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if remote > c.last {
+		c.last = remote
+	}
+}
+
+// WallTime returns the wall time of a timestamp
+func WallTime(hlc int64) time.Time {
+	return time.UnixMilli(hlc >> logicalBits)
+}
@@ -0,0 +1,98 @@
+package region
+
+import (
+	"crypto/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// crockford is the Crockford base32 alphabet ULIDs are written in
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidLength is the length of a ULID: 10 characters of millisecond timestamp and 16 of randomness
+const ulidLength = 26
+
+var (
+	ulidMu     sync.Mutex
+	lastMillis int64
+	lastRandom [10]byte
+)
+
+// NewID returns a region-aware ID of the current region, e.g. vn1_01J9Z3M7XK8Q4W2YB5N6TDRF0C.
+// The same format is generated by the region_ulid() database default
+func NewID() string {
+	return Default().Current + "_" + NewULID(time.Now())
+}
+
+// NewULID returns a ULID for a time. ULIDs of the same millisecond increase monotonically
+func NewULID(t time.Time) string {
+	ulidMu.Lock()
+	defer ulidMu.Unlock()
+
+	millis := t.UnixMilli()
+	if millis == lastMillis {
+		// Increment the randomness so IDs of the same millisecond still sort in creation order
+		for i := len(lastRandom) - 1; i >= 0; i-- {
+			lastRandom[i]++
+			if lastRandom[i] != 0 {
+				break
+			}
+		}
+	} else {
+		lastMillis = millis
+		rand.Read(lastRandom[:])
+	}
+
+	var out [ulidLength]byte
+	for i := 9; i >= 0; i-- {
+		out[i] = crockford[millis&31]
+		millis >>= 5
+	}
+	// 80 random bits as 16 characters of 5 bits
+	var bits uint64
+	var held uint
+	pos := 10
+	for _, b := range lastRandom {
+		bits = bits<<8 | uint64(b)
+		held += 8
+		for held >= 5 {
+			held -= 5
+			out[pos] = crockford[(bits>>held)&31]
+			pos++
+		}
+	}
+	return string(out[:])
+}
+
+// Parse splits a region-aware ID into its region and ULID
+func Parse(id string) (string, string, error) {
+	code, ulid, found := strings.Cut(id, "_")
+	if !found || !Valid(code) || len(ulid) != ulidLength {
+		return "", "", ErrInvalidID
+	}
+	ulid = strings.ToUpper(ulid)
+	for i := 0; i < len(ulid); i++ {
+		if !strings.ContainsRune(crockford, rune(ulid[i])) {
+			return "", "", ErrInvalidID
+		}
+	}
+	if ulid[0] > '7' {
+		// The timestamp would overflow 48 bits
+		return "", "", ErrInvalidID
+	}
+	return code, ulid, nil
+}
+
+// CreatedAt returns the time encoded in a region-aware ID
+func CreatedAt(id string) (time.Time, error) {
+	_, ulid, err := Parse(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var millis int64
+	for i := 0; i < 10; i++ {
+		millis = millis<<5 | int64(strings.IndexByte(crockford, ulid[i]))
+	}
+	return time.UnixMilli(millis), nil
+}
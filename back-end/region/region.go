@@ -0,0 +1,98 @@
+package region
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+)
+
+// codePattern matches region codes such as vn1 or eu-west
+var codePattern = regexp.MustCompile(`^[a-z0-9-]{1,16}$`)
+
+// ErrInvalidID is returned for an ID that is not a region-aware ID
+var ErrInvalidID = errors.New("invalid region-aware ID")
+
+// Regions describes the region this instance serves and the API endpoints of every region
+type Regions struct {
+	Current   string
+	Endpoints map[string]string // API base URL of each region, including this one
+}
+
+// Hint tells a client where to send a request about a record
+type Hint struct {
+	Region   string `json:"region"`      // Region serving this request
+	Home     string `json:"home_region"` // Region the record was created in, which takes its writes
+	Local    bool   `json:"local"`       // The record is written in this region
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+var (
+	defaultRegions *Regions
+	once           sync.Once
+)
+
+// New creates the region description from the application config.
+// Endpoints are written as region=url pairs separated by commas
+func New(cfg *config.Config) *Regions {
+	r := &Regions{Current: Normalize(cfg.Region), Endpoints: map[string]string{}}
+	if !Valid(r.Current) {
+		r.Current = "default"
+	}
+	for _, pair := range strings.Split(cfg.RegionEndpoints, ",") {
+		code, endpoint, found := strings.Cut(pair, "=")
+		if code = Normalize(code); found && Valid(code) {
+			r.Endpoints[code] = strings.TrimSuffix(strings.TrimSpace(endpoint), "/")
+		}
+	}
+	return r
+}
+
+// Default returns the process wide region description
+func Default() *Regions {
+	once.Do(func() {
+		defaultRegions = New(config.GetConfig())
+	})
+	return defaultRegions
+}
+
+// Normalize lower-cases a region code
+func Normalize(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// Valid reports whether a region code may prefix IDs
+func Valid(code string) bool {
+	return codePattern.MatchString(code)
+}
+
+// Peers returns the other regions, in code order
+func (r *Regions) Peers() []string {
+	peers := []string{}
+	for code := range r.Endpoints {
+		if code != r.Current {
+			peers = append(peers, code)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// Route returns where requests about a record should go: reads are served by the local region,
+// writes by the record's home region
+func (r *Regions) Route(id string, write bool) (Hint, error) {
+	home, _, err := Parse(id)
+	if err != nil {
+		return Hint{}, err
+	}
+	hint := Hint{Region: r.Current, Home: home, Local: home == r.Current}
+	if write && !hint.Local {
+		hint.Endpoint = r.Endpoints[home]
+	} else {
+		hint.Endpoint = r.Endpoints[r.Current]
+	}
+	return hint, nil
+}
@@ -0,0 +1,249 @@
+package residency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/ipfs"
+	"github.com/LTPPPP/TracePost-larvaeChain/region"
+	"github.com/LTPPPP/TracePost-larvaeChain/warehouse"
+)
+
+// Storage backends a document can be stored in
+const (
+	BackendIPFS         = "ipfs"          // the platform IPFS node, pinned on Pinata
+	BackendRegionalIPFS = "regional_ipfs" // an IPFS node of the residency region
+	BackendS3           = "s3"            // an S3 bucket of the residency region
+)
+
+var (
+	// ErrNoBackend is returned when no storage backend is configured for a residency region
+	ErrNoBackend = errors.New("no storage backend is configured for the residency region")
+	// ErrInvalidRegion is returned for a policy naming an unknown region
+	ErrInvalidRegion = errors.New("invalid residency region")
+)
+
+// Policy requires the documents of a company to be stored and served in one region
+type Policy struct {
+	CompanyID int       `json:"company_id"`
+	Region    string    `json:"region"`
+	Notes     string    `json:"notes,omitempty"`
+	UpdatedBy int       `json:"updated_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Backend is where documents of a region are stored
+type Backend struct {
+	Region      string `json:"region"`
+	IPFSNodeURL string `json:"-"`
+	GatewayURL  string `json:"gateway_url,omitempty"`
+	S3Bucket    string `json:"s3_bucket,omitempty"`
+	S3Region    string `json:"s3_region,omitempty"`
+	Kind        string `json:"kind"` // regional_ipfs or s3
+}
+
+// Stored is a file written to a regional backend
+type Stored struct {
+	Region  string
+	Backend string
+	Ref     string // CID for IPFS, object key for S3
+	URI     string // Gateway URL for IPFS, s3:// URL for S3
+	Size    int64
+}
+
+// Router resolves residency policies to the storage backends of this deployment
+type Router struct {
+	Config   *config.Config
+	Backends map[string]Backend
+}
+
+var (
+	defaultRouter *Router
+	once          sync.Once
+)
+
+// parsePairs reads region=value pairs separated by commas
+func parsePairs(value string) map[string]string {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		code, v, found := strings.Cut(pair, "=")
+		if code = region.Normalize(code); found && region.Valid(code) && strings.TrimSpace(v) != "" {
+			pairs[code] = strings.TrimSpace(v)
+		}
+	}
+	return pairs
+}
+
+// NewRouter reads the regional backends from the application config. A region's IPFS node is preferred
+// over its S3 bucket
+func NewRouter(cfg *config.Config) *Router {
+	r := &Router{Config: cfg, Backends: map[string]Backend{}}
+	gateways := parsePairs(cfg.StorageRegionIPFSGateways)
+	for code, bucket := range parsePairs(cfg.StorageRegionS3Buckets) {
+		name, awsRegion, _ := strings.Cut(bucket, "@")
+		if awsRegion == "" {
+			awsRegion = "us-east-1"
+		}
+		r.Backends[code] = Backend{Region: code, S3Bucket: name, S3Region: awsRegion, Kind: BackendS3}
+	}
+	for code, node := range parsePairs(cfg.StorageRegionIPFSNodes) {
+		r.Backends[code] = Backend{Region: code, IPFSNodeURL: strings.TrimSuffix(node, "/"), GatewayURL: gateways[code], Kind: BackendRegionalIPFS}
+	}
+	return r
+}
+
+// Default returns the process wide router
+func Default() *Router {
+	once.Do(func() {
+		defaultRouter = NewRouter(config.GetConfig())
+	})
+	return defaultRouter
+}
+
+// Regions lists the regions a policy may name: those with a backend or an API endpoint
+func (r *Router) Regions() []string {
+	seen := map[string]bool{}
+	regions := []string{}
+	for code := range r.Backends {
+		seen[code] = true
+		regions = append(regions, code)
+	}
+	for code := range region.Default().Endpoints {
+		if !seen[code] {
+			regions = append(regions, code)
+		}
+	}
+	return regions
+}
+
+// Store writes a file to the backend of a region
+func (r *Router) Store(regionCode string, content []byte, filename string) (*Stored, error) {
+	backend, ok := r.Backends[regionCode]
+	if !ok {
+		return nil, ErrNoBackend
+	}
+	stored := &Stored{Region: regionCode, Backend: backend.Kind, Size: int64(len(content))}
+
+	if backend.Kind == BackendRegionalIPFS {
+		cid, err := ipfs.NewIPFSClient(backend.IPFSNodeURL).Shell.Add(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload to the %s IPFS node: %w", regionCode, err)
+		}
+		stored.Ref = cid
+		if backend.GatewayURL != "" {
+			stored.URI = strings.TrimSuffix(backend.GatewayURL, "/") + "/ipfs/" + cid
+		}
+		return stored, nil
+	}
+
+	sum := sha256.Sum256(content)
+	key := "documents/" + hex.EncodeToString(sum[:]) + "/" + path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	client := &warehouse.S3Client{
+		Bucket:       backend.S3Bucket,
+		Region:       backend.S3Region,
+		Endpoint:     r.Config.StorageS3Endpoint,
+		PathStyle:    r.Config.StorageS3PathStyle,
+		AccessKey:    r.Config.WarehouseS3AccessKey,
+		SecretKey:    r.Config.WarehouseS3SecretKey,
+		SessionToken: r.Config.WarehouseS3SessionToken,
+		HTTPClient:   &http.Client{Timeout: 5 * time.Minute},
+	}
+	if !client.Configured() {
+		return nil, ErrNoBackend
+	}
+	if _, err := client.PutObject(key, content, http.DetectContentType(content)); err != nil {
+		return nil, fmt.Errorf("failed to upload to the %s bucket: %w", regionCode, err)
+	}
+	stored.Ref = key
+	stored.URI = "s3://" + backend.S3Bucket + "/" + key
+	return stored, nil
+}
+
+const policyColumns = `company_id, region, COALESCE(notes, ''), COALESCE(updated_by, 0), created_at, updated_at`
+
+// scanPolicy reads a policy selected with policyColumns
+func scanPolicy(row interface{ Scan(...interface{}) error }) (Policy, error) {
+	var p Policy
+	err := row.Scan(&p.CompanyID, &p.Region, &p.Notes, &p.UpdatedBy, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// PolicyFor returns the residency policy of a company, nil when its documents may be stored anywhere
+func PolicyFor(companyID int) (*Policy, error) {
+	if companyID == 0 {
+		return nil, nil
+	}
+	p, err := scanPolicy(db.DB.QueryRow(`SELECT `+policyColumns+` FROM company_residency_policy WHERE company_id = $1`, companyID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListPolicies returns every residency policy
+func ListPolicies() ([]Policy, error) {
+	rows, err := db.DB.Query(`SELECT ` + policyColumns + ` FROM company_residency_policy ORDER BY company_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	policies := []Policy{}
+	for rows.Next() {
+		p, err := scanPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// SavePolicy creates or replaces the residency policy of a company. Documents stored before keep their region
+func (r *Router) SavePolicy(p Policy, userID int) (*Policy, error) {
+	p.Region = region.Normalize(p.Region)
+	known := false
+	for _, code := range r.Regions() {
+		if code == p.Region {
+			known = true
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: %q has no storage backend or API endpoint", ErrInvalidRegion, p.Region)
+	}
+	saved, err := scanPolicy(db.DB.QueryRow(`
+		INSERT INTO company_residency_policy (company_id, region, notes, updated_by, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, 0), NOW(), NOW())
+		ON CONFLICT (company_id) DO UPDATE
+		SET region = EXCLUDED.region, notes = EXCLUDED.notes, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+		RETURNING `+policyColumns,
+		p.CompanyID, p.Region, strings.TrimSpace(p.Notes), userID))
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// DeletePolicy lifts the residency policy of a company; documents stored under it stay locked to their region
+func DeletePolicy(companyID int) (bool, error) {
+	result, err := db.DB.Exec("DELETE FROM company_residency_policy WHERE company_id = $1", companyID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
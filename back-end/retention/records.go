@@ -0,0 +1,169 @@
+package retention
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// maxRetainDays bounds the retention period of a policy to a century
+const maxRetainDays = 36500
+
+// Validate normalizes a policy and checks its fields
+func (p *Policy) Validate() error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.DocType = strings.TrimSpace(p.DocType)
+	if p.DocType == "" {
+		return fmt.Errorf("%w: doc_type is required", ErrInvalidPolicy)
+	}
+	if p.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPolicy)
+	}
+	if p.RetainDays < 1 || p.RetainDays > maxRetainDays {
+		return fmt.Errorf("%w: retain_days must be between 1 and %d", ErrInvalidPolicy, maxRetainDays)
+	}
+	return nil
+}
+
+const policyColumns = `id, name, doc_type, retain_days, is_active, created_at, updated_at`
+
+// scanPolicy reads a policy selected with policyColumns
+func scanPolicy(row interface{ Scan(...interface{}) error }) (Policy, error) {
+	var p Policy
+	err := row.Scan(&p.ID, &p.Name, &p.DocType, &p.RetainDays, &p.Active, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// ListPolicies returns every retention policy, by document type
+func ListPolicies() ([]Policy, error) {
+	rows, err := db.DB.Query(`SELECT ` + policyColumns + ` FROM document_retention_policy ORDER BY doc_type`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	policies := []Policy{}
+	for rows.Next() {
+		p, err := scanPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// SavePolicy creates or replaces the retention policy of a document type. Documents are only destroyed while
+// their policy is active
+func SavePolicy(p Policy, userID int) (*Policy, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	saved, err := scanPolicy(db.DB.QueryRow(`
+		INSERT INTO document_retention_policy (name, doc_type, retain_days, is_active, created_by, updated_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), NULLIF($5, 0), NOW(), NOW())
+		ON CONFLICT (doc_type) DO UPDATE
+		SET name = EXCLUDED.name, retain_days = EXCLUDED.retain_days, is_active = EXCLUDED.is_active,
+			updated_by = EXCLUDED.updated_by, updated_at = NOW()
+		RETURNING `+policyColumns,
+		p.Name, p.DocType, p.RetainDays, p.Active, userID))
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// DeactivatePolicy stops a policy from destroying documents; it is kept for the destruction records naming it
+func DeactivatePolicy(id, userID int) error {
+	result, err := db.DB.Exec(`
+		UPDATE document_retention_policy SET is_active = false, updated_by = NULLIF($2, 0), updated_at = NOW() WHERE id = $1
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const destructionColumns = `
+	id, document_id, COALESCE(policy_id, 0), COALESCE(doc_type, ''), COALESCE(batch_id, 0), COALESCE(company_id, 0),
+	record, record_hash, signature, status, COALESCE(anchor_tx_id, ''), COALESCE(anchor_error, ''), anchored_at,
+	COALESCE(destroyed_by, 0), destroyed_at
+`
+
+// scanDestruction reads a destruction record selected with destructionColumns
+func scanDestruction(row interface{ Scan(...interface{}) error }) (*Destruction, error) {
+	var d Destruction
+	var record string
+	var anchoredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.DocumentID, &d.PolicyID, &d.DocType, &d.BatchID, &d.CompanyID, &record, &d.RecordHash,
+		&d.Signature, &d.Status, &d.AnchorTxID, &d.AnchorError, &anchoredAt, &d.DestroyedBy, &d.DestroyedAt)
+	if err != nil {
+		return nil, err
+	}
+	d.Record = []byte(record)
+	if anchoredAt.Valid {
+		d.AnchoredAt = &anchoredAt.Time
+	}
+	return &d, nil
+}
+
+// Get returns a destruction record
+func Get(id int) (*Destruction, error) {
+	d, err := scanDestruction(db.DB.QueryRow(`SELECT `+destructionColumns+` FROM document_destruction WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return d, err
+}
+
+// Filter narrows the destruction log; zero values match everything
+type Filter struct {
+	From       time.Time
+	To         time.Time
+	PolicyID   int
+	DocumentID int
+	CompanyID  int
+	DocType    string
+	Limit      int
+}
+
+// List returns the destruction records matching a filter, latest first
+func List(f Filter) ([]Destruction, error) {
+	if f.Limit <= 0 || f.Limit > 1000 {
+		f.Limit = 100
+	}
+	rows, err := db.DB.Query(`SELECT `+destructionColumns+`
+		FROM document_destruction
+		WHERE ($1::timestamp IS NULL OR destroyed_at >= $1) AND ($2::timestamp IS NULL OR destroyed_at <= $2)
+			AND ($3 = 0 OR policy_id = $3) AND ($4 = 0 OR document_id = $4) AND ($5 = 0 OR company_id = $5)
+			AND ($6 = '' OR doc_type = $6)
+		ORDER BY destroyed_at DESC, id DESC
+		LIMIT $7
+	`, nullTime(f.From), nullTime(f.To), f.PolicyID, f.DocumentID, f.CompanyID, f.DocType, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	destructions := []Destruction{}
+	for rows.Next() {
+		d, err := scanDestruction(rows)
+		if err != nil {
+			return nil, err
+		}
+		destructions = append(destructions, *d)
+	}
+	return destructions, rows.Err()
+}
+
+// nullTime is nil for the zero time
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
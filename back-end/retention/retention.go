@@ -0,0 +1,441 @@
+package retention
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/ipfs"
+	"github.com/LTPPPP/TracePost-larvaeChain/residency"
+	"github.com/LTPPPP/TracePost-larvaeChain/signing"
+)
+
+// Statuses of a destruction record
+const (
+	StatusSigned   = "signed"   // signed by the platform, the on-chain anchor is pending or failed and will be retried
+	StatusAnchored = "anchored" // record hash recorded on-chain
+)
+
+// TxTypeDocumentDestruction is the transaction type of a destruction record anchor
+const TxTypeDocumentDestruction = "DOCUMENT_DESTRUCTION"
+
+// Platform names the issuer in destruction records
+const Platform = "TracePost-larvaeChain"
+
+var (
+	// ErrNotFound is returned for a policy, document or destruction record that does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidPolicy is returned for a policy with missing or out of range fields
+	ErrInvalidPolicy = errors.New("invalid retention policy")
+	// ErrHeld is returned when destroying a document under legal hold
+	ErrHeld = errors.New("document is under legal hold")
+	// ErrNotDue is returned when destroying a document its policy still retains
+	ErrNotDue = errors.New("document is still within its retention period")
+)
+
+// Policy destroys the documents of a type once they are older than its retention period
+type Policy struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"` // e.g. the regulation requiring it
+	DocType    string    `json:"doc_type"`
+	RetainDays int       `json:"retain_days"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Record is what a destruction record certifies; it is serialized once, hashed and signed, and kept verbatim
+type Record struct {
+	DocumentID       int       `json:"document_id"`
+	DocumentGlobalID string    `json:"document_global_id,omitempty"`
+	DocType          string    `json:"doc_type"`
+	FileName         string    `json:"file_name"`
+	FileSize         int64     `json:"file_size"`
+	ContentRef       string    `json:"content_ref,omitempty"` // IPFS CID or object key of the destroyed file
+	StorageBackend   string    `json:"storage_backend"`
+	StorageRegion    string    `json:"storage_region,omitempty"`
+	StorageReleased  bool      `json:"storage_released"` // False when the backend keeps the file until its own expiry, e.g. S3
+	BatchID          int       `json:"batch_id,omitempty"`
+	CompanyID        int       `json:"company_id,omitempty"`
+	UploadedAt       time.Time `json:"uploaded_at"`
+	PolicyID         int       `json:"policy_id"`
+	PolicyName       string    `json:"policy_name"`
+	RetainDays       int       `json:"retain_days"`
+	DestroyedAt      time.Time `json:"destroyed_at"`
+	Platform         string    `json:"platform"`
+}
+
+// Destruction is the signed, anchored log entry of a destroyed document
+type Destruction struct {
+	ID          int             `json:"id"`
+	DocumentID  int             `json:"document_id"`
+	PolicyID    int             `json:"policy_id"`
+	DocType     string          `json:"doc_type"`
+	BatchID     int             `json:"batch_id,omitempty"`
+	CompanyID   int             `json:"company_id,omitempty"`
+	Record      json.RawMessage `json:"record"`      // The exact bytes hashed and signed
+	RecordHash  string          `json:"record_hash"` // Hex SHA-256 of the record
+	Signature   string          `json:"signature"`   // Detached JWS of the record, verifiable against the platform JWKS
+	Status      string          `json:"status"`
+	AnchorTxID  string          `json:"anchor_tx_id,omitempty"`
+	AnchorError string          `json:"anchor_error,omitempty"`
+	AnchoredAt  *time.Time      `json:"anchored_at,omitempty"`
+	DestroyedBy int             `json:"destroyed_by,omitempty"` // Empty for scheduled runs
+	DestroyedAt time.Time       `json:"destroyed_at"`
+}
+
+// Due is a document its retention policy no longer retains
+type Due struct {
+	DocumentID int       `json:"document_id"`
+	DocType    string    `json:"doc_type"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	PolicyID   int       `json:"policy_id"`
+	PolicyName string    `json:"policy_name"`
+	Held       bool      `json:"held"` // Under legal hold, kept until the hold is released
+}
+
+// RunResult is the outcome of one retention run
+type RunResult struct {
+	Destroyed []Destruction  `json:"destroyed"`
+	Held      []int          `json:"held"`             // Documents due but under legal hold
+	Failed    map[int]string `json:"failed,omitempty"` // Documents that could not be destroyed, retried on the next run
+}
+
+// Service destroys documents past their retention period on a schedule, logging each destruction
+type Service struct {
+	Config    *config.Config
+	Interval  time.Duration
+	BatchSize int
+	// Held reports whether a document is frozen by a legal hold on it, its batch or its company
+	Held func(documentID int) (bool, error)
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates a retention service from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		Config:    cfg,
+		Interval:  time.Duration(cfg.DocumentRetentionIntervalSeconds) * time.Second,
+		BatchSize: 100,
+	}
+}
+
+// Default returns the process wide retention service
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Start destroys due documents in the background; a zero interval disables the schedule
+func (s *Service) Start() {
+	if s.Interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(s.Interval)
+
+			if _, err := s.RunOnce(); err != nil {
+				fmt.Printf("Warning: document retention run failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// held reports whether a document is under legal hold; without a hold check nothing is destroyed
+func (s *Service) held(documentID int) (bool, error) {
+	if s.Held == nil {
+		return true, errors.New("no legal hold check is configured")
+	}
+	return s.Held(documentID)
+}
+
+// DueDocuments lists up to limit documents past the retention period of their policy, oldest first
+func (s *Service) DueDocuments(limit int) ([]Due, error) {
+	rows, err := db.DB.Query(`
+		SELECT d.id, d.doc_type, d.uploaded_at, p.id, p.name
+		FROM document d
+		JOIN document_retention_policy p ON p.doc_type = d.doc_type AND p.is_active = true
+		WHERE d.purged_at IS NULL AND d.uploaded_at < NOW() - p.retain_days * INTERVAL '1 day'
+		ORDER BY d.uploaded_at, d.id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	due := []Due{}
+	for rows.Next() {
+		var d Due
+		if err := rows.Scan(&d.DocumentID, &d.DocType, &d.UploadedAt, &d.PolicyID, &d.PolicyName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range due {
+		held, err := s.held(due[i].DocumentID)
+		if err != nil {
+			return nil, err
+		}
+		due[i].Held = held
+	}
+	return due, nil
+}
+
+// RunOnce destroys the due documents not under legal hold and retries anchors that failed
+func (s *Service) RunOnce() (*RunResult, error) {
+	result := &RunResult{Destroyed: []Destruction{}, Held: []int{}, Failed: map[int]string{}}
+	if db.DB == nil {
+		return result, nil
+	}
+
+	// Held documents stay due, so look past them for the ones that can go
+	due, err := s.DueDocuments(s.BatchSize * 10)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range due {
+		if d.Held {
+			result.Held = append(result.Held, d.DocumentID)
+			continue
+		}
+		if len(result.Destroyed)+len(result.Failed) >= s.BatchSize {
+			break
+		}
+		destruction, err := s.Destroy(d.DocumentID, 0)
+		if err != nil {
+			result.Failed[d.DocumentID] = err.Error()
+			fmt.Printf("Warning: failed to destroy document %d: %v\n", d.DocumentID, err)
+			continue
+		}
+		result.Destroyed = append(result.Destroyed, *destruction)
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id FROM document_destruction WHERE status = $1 ORDER BY destroyed_at LIMIT $2
+	`, StatusSigned, s.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range scanIDs(rows) {
+		if _, err := s.Anchor(id); err != nil {
+			fmt.Printf("Warning: failed to anchor document destruction %d: %v\n", id, err)
+		}
+	}
+	return result, nil
+}
+
+// Destroy releases the stored file of a document past its retention period, marks the document purged and
+// logs a signed destruction record, then anchors the record on-chain. userID is 0 for scheduled runs
+func (s *Service) Destroy(documentID, userID int) (*Destruction, error) {
+	held, err := s.held(documentID)
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		return nil, ErrHeld
+	}
+
+	var record Record
+	var contentRef, backend, storageRegion sql.NullString
+	var batchID, companyID, fileSize sql.NullInt64
+	var uploadedAt sql.NullTime
+	var due bool
+	err = db.DB.QueryRow(`
+		SELECT d.id, COALESCE(d.global_id, ''), d.doc_type, COALESCE(d.file_name, ''), d.file_size, d.ipfs_hash,
+			d.storage_backend, d.storage_region, d.batch_id, COALESCE(b.owner_company_id, h.company_id), d.uploaded_at,
+			p.id, p.name, p.retain_days, d.uploaded_at < NOW() - p.retain_days * INTERVAL '1 day'
+		FROM document d
+		JOIN document_retention_policy p ON p.doc_type = d.doc_type AND p.is_active = true
+		LEFT JOIN batch b ON b.id = d.batch_id
+		LEFT JOIN hatchery h ON h.id = b.hatchery_id
+		WHERE d.id = $1 AND d.purged_at IS NULL
+	`, documentID).Scan(&record.DocumentID, &record.DocumentGlobalID, &record.DocType, &record.FileName, &fileSize,
+		&contentRef, &backend, &storageRegion, &batchID, &companyID, &uploadedAt,
+		&record.PolicyID, &record.PolicyName, &record.RetainDays, &due)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !due {
+		return nil, ErrNotDue
+	}
+	record.FileSize = fileSize.Int64
+	record.ContentRef = contentRef.String
+	record.StorageBackend = backend.String
+	if record.StorageBackend == "" {
+		record.StorageBackend = residency.BackendIPFS
+	}
+	record.StorageRegion = storageRegion.String
+	record.BatchID = int(batchID.Int64)
+	record.CompanyID = int(companyID.Int64)
+	record.UploadedAt = uploadedAt.Time.UTC()
+	record.Platform = Platform
+
+	// The file goes first: a failed release leaves the document in place to be retried
+	if record.StorageReleased, err = s.release(record); err != nil {
+		return nil, fmt.Errorf("failed to release stored file: %w", err)
+	}
+	record.DestroyedAt = time.Now().UTC()
+
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	recordHash := hex.EncodeToString(sum[:])
+	signature, err := signing.Sign(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign destruction record: %w", err)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var destructionID int
+	err = tx.QueryRow(`
+		INSERT INTO document_destruction (document_id, policy_id, doc_type, batch_id, company_id, record, record_hash, signature, status, destroyed_by, destroyed_at)
+		VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, 0), $6, $7, $8, $9, NULLIF($10, 0), $11)
+		RETURNING id
+	`, documentID, record.PolicyID, record.DocType, record.BatchID, record.CompanyID, string(raw), recordHash, signature,
+		StatusSigned, userID, record.DestroyedAt).Scan(&destructionID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		UPDATE document SET is_active = false, ipfs_hash = NULL, ipfs_uri = NULL, purged_at = $2, updated_at = NOW()
+		WHERE id = $1
+	`, documentID, record.DestroyedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// The record is signed without its anchor; a failed anchor is retried on the next run
+	if anchored, err := s.Anchor(destructionID); err != nil {
+		fmt.Printf("Warning: failed to anchor document destruction %d: %v\n", destructionID, err)
+	} else {
+		return anchored, nil
+	}
+	return Get(destructionID)
+}
+
+// release unpins the stored file of a document. It reports false for backends files cannot be removed from
+// here, which expire them by their own lifecycle rules
+func (s *Service) release(record Record) (bool, error) {
+	if record.ContentRef == "" {
+		return true, nil
+	}
+	switch record.StorageBackend {
+	case residency.BackendIPFS:
+		if err := unpin(s.Config.IPFSNodeURL, record.ContentRef); err != nil {
+			return false, err
+		}
+		pinata := ipfs.NewPinataService()
+		if pinata.JWT != "" || pinata.APIKey != "" {
+			if err := pinata.UnpinByCID(record.ContentRef); err != nil && !strings.Contains(err.Error(), "404") {
+				return false, err
+			}
+		}
+		return true, nil
+	case residency.BackendRegionalIPFS:
+		backend, ok := residency.Default().Backends[record.StorageRegion]
+		if !ok || backend.IPFSNodeURL == "" {
+			return false, nil
+		}
+		if err := unpin(backend.IPFSNodeURL, record.ContentRef); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// unpin removes the pin of a CID from an IPFS node; a CID that is not pinned is already released
+func unpin(nodeURL, cid string) error {
+	err := ipfs.NewIPFSClient(nodeURL).Shell.Unpin(cid)
+	if err != nil && strings.Contains(err.Error(), "not pinned") {
+		return nil
+	}
+	return err
+}
+
+// Anchor records the hash of a destruction record on-chain
+func (s *Service) Anchor(destructionID int) (*Destruction, error) {
+	destruction, err := Get(destructionID)
+	if err != nil {
+		return nil, err
+	}
+	if destruction.Status == StatusAnchored {
+		return destruction, nil
+	}
+
+	payload := map[string]interface{}{
+		"destruction_id": destruction.ID,
+		"document_id":    destruction.DocumentID,
+		"policy_id":      destruction.PolicyID,
+		"record_hash":    destruction.RecordHash,
+		"destroyed_at":   destruction.DestroyedAt.UTC().Format(time.RFC3339),
+	}
+	client := blockchain.NewBlockchainClient(
+		s.Config.BlockchainNodeURL,
+		s.Config.BlockchainPrivateKey,
+		s.Config.BlockchainAccount,
+		s.Config.BlockchainChainID,
+		s.Config.BlockchainConsensus,
+	)
+	txID, err := client.SubmitGenericTransaction(TxTypeDocumentDestruction, payload)
+	if err != nil {
+		if _, dbErr := db.DB.Exec("UPDATE document_destruction SET anchor_error = $2 WHERE id = $1", destructionID, err.Error()); dbErr != nil {
+			return nil, dbErr
+		}
+		return nil, err
+	}
+
+	_, err = db.DB.Exec(`
+		UPDATE document_destruction SET status = $2, anchor_tx_id = $3, anchor_error = NULL, anchored_at = NOW()
+		WHERE id = $1
+	`, destructionID, StatusAnchored, txID)
+	if err != nil {
+		return nil, err
+	}
+	return Get(destructionID)
+}
+
+// scanIDs reads a column of IDs and closes the rows
+func scanIDs(rows *sql.Rows) []int {
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
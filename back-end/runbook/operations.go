@@ -0,0 +1,466 @@
+package runbook
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/chainsync"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/ipfs"
+	"github.com/LTPPPP/TracePost-larvaeChain/tracesnapshot"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+)
+
+// Bounds keeping a run short enough to finish within a request
+const (
+	maxCIDs         = 200
+	maxReplayWindow = 7 * 24 * time.Hour
+	maxReplays      = 1000
+)
+
+// TxTypeBatchReanchor is the transaction type of a batch anchored again
+const TxTypeBatchReanchor = "BATCH_REANCHOR"
+
+// cidPattern matches CIDv0 and base32/base58 CIDv1 strings
+var cidPattern = regexp.MustCompile(`^[A-Za-z0-9]{46,100}$`)
+
+// newBlockchainClient creates a client from the application config
+func newBlockchainClient() *blockchain.BlockchainClient {
+	cfg := config.GetConfig()
+	return blockchain.NewBlockchainClient(
+		cfg.BlockchainNodeURL,
+		cfg.BlockchainPrivateKey,
+		cfg.BlockchainAccount,
+		cfg.BlockchainChainID,
+		cfg.BlockchainConsensus,
+	)
+}
+
+// batchTarget checks that the batch of an operation exists
+func batchTarget(p *Params) (string, error) {
+	if p.BatchID <= 0 {
+		return "", invalid("batch_id is required")
+	}
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = $1 AND is_active = true)", p.BatchID).Scan(&exists); err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("%w: batch %d", ErrNotFound, p.BatchID)
+	}
+	return fmt.Sprintf("batch:%d", p.BatchID), nil
+}
+
+// repinTarget checks the CIDs to pin, or the batch whose CIDs are pinned
+func repinTarget(p *Params) (string, error) {
+	if len(p.CIDs) == 0 {
+		return batchTarget(p)
+	}
+	if p.BatchID != 0 {
+		return "", invalid("give either cids or batch_id")
+	}
+	if len(p.CIDs) > maxCIDs {
+		return "", invalid("at most %d CIDs can be pinned in one run", maxCIDs)
+	}
+	seen := map[string]bool{}
+	cids := make([]string, 0, len(p.CIDs))
+	for _, cid := range p.CIDs {
+		cid = strings.TrimSpace(cid)
+		if !cidPattern.MatchString(cid) {
+			return "", invalid("%q is not a CID", cid)
+		}
+		if !seen[cid] {
+			seen[cid] = true
+			cids = append(cids, cid)
+		}
+	}
+	p.CIDs = cids
+	sum := sha256.Sum256([]byte(strings.Join(cids, ",")))
+	return "cids:" + hex.EncodeToString(sum[:8]), nil
+}
+
+// batchCIDs lists the CIDs of a batch's documents and trace snapshots
+func batchCIDs(batchID int) ([]string, error) {
+	rows, err := db.DB.Query(`
+		SELECT DISTINCT cid FROM (
+			SELECT ipfs_hash AS cid FROM document WHERE batch_id = $1 AND is_active = true
+			UNION SELECT json_cid FROM trace_snapshot WHERE batch_id = $1
+			UNION SELECT html_cid FROM trace_snapshot WHERE batch_id = $1
+		) cids
+		WHERE cid IS NOT NULL AND cid <> ''
+		ORDER BY cid
+		LIMIT $2
+	`, batchID, maxCIDs+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cids []string
+	for rows.Next() {
+		var cid string
+		if err := rows.Scan(&cid); err != nil {
+			return nil, err
+		}
+		cids = append(cids, cid)
+	}
+	if len(cids) > maxCIDs {
+		return nil, invalid("batch %d has more than %d CIDs, pin them in sets with cids", batchID, maxCIDs)
+	}
+	return cids, rows.Err()
+}
+
+// repinCIDs pins CIDs to Pinata again
+func repinCIDs(p Params, dryRun bool, userID int) (*Result, error) {
+	cids := p.CIDs
+	if len(cids) == 0 {
+		var err error
+		if cids, err = batchCIDs(p.BatchID); err != nil {
+			return nil, err
+		}
+	}
+	result := &Result{Steps: []Step{}}
+	service := ipfs.NewIPFSPinataService()
+	for _, cid := range cids {
+		if dryRun {
+			result.add(cid, "pin", StepPlanned, "")
+			continue
+		}
+		metadata := map[string]string{
+			"app":       "TracePost-larvaeChain",
+			"runbook":   OpRepinCIDs,
+			"timestamp": time.Now().Format(time.RFC3339),
+		}
+		if p.BatchID != 0 {
+			metadata["batch_id"] = strconv.Itoa(p.BatchID)
+		}
+		if _, err := service.PinExistingCIDToPinata(cid, cid, metadata); err != nil {
+			result.add(cid, "pin", StepFailed, err.Error())
+			continue
+		}
+		result.add(cid, "pin", StepOK, "")
+	}
+	return result, nil
+}
+
+// batchState is the state of a batch anchored again
+func batchState(batchID int) (map[string]interface{}, error) {
+	var hatcheryID sql.NullInt64
+	var species, status sql.NullString
+	var quantity sql.NullInt64
+	var updatedAt sql.NullTime
+	err := db.DB.QueryRow(`
+		SELECT hatchery_id, species, quantity, status, updated_at FROM batch WHERE id = $1
+	`, batchID).Scan(&hatcheryID, &species, &quantity, &status, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	var events, documents int
+	var lastEventID, lastDocumentID int
+	err = db.DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM event WHERE batch_id = $1 AND is_active = true),
+			(SELECT COALESCE(MAX(id), 0) FROM event WHERE batch_id = $1 AND is_active = true),
+			(SELECT COUNT(*) FROM document WHERE batch_id = $1 AND is_active = true),
+			(SELECT COALESCE(MAX(id), 0) FROM document WHERE batch_id = $1 AND is_active = true)
+	`, batchID).Scan(&events, &lastEventID, &documents, &lastDocumentID)
+	if err != nil {
+		return nil, err
+	}
+	state := map[string]interface{}{
+		"batch_id":         batchID,
+		"hatchery_id":      hatcheryID.Int64,
+		"species":          species.String,
+		"quantity":         quantity.Int64,
+		"status":           status.String,
+		"events":           events,
+		"last_event_id":    lastEventID,
+		"documents":        documents,
+		"last_document_id": lastDocumentID,
+	}
+	if updatedAt.Valid {
+		state["updated_at"] = updatedAt.Time.UTC().Format(time.RFC3339)
+	}
+	return state, nil
+}
+
+// reanchorBatch anchors the current state of a batch on-chain again
+func reanchorBatch(p Params, dryRun bool, userID int) (*Result, error) {
+	state, err := batchState(p.BatchID)
+	if err != nil {
+		return nil, err
+	}
+	client := newBlockchainClient()
+	hash, err := client.HashData(state)
+	if err != nil {
+		return nil, err
+	}
+	target := fmt.Sprintf("batch:%d", p.BatchID)
+	result := &Result{Steps: []Step{}}
+	if dryRun {
+		result.add(target, "anchor", StepPlanned, "state hash "+hash)
+		return result, nil
+	}
+
+	payload := map[string]interface{}{
+		"state":      state,
+		"state_hash": hash,
+		"reason":     "runbook",
+		"timestamp":  time.Now().UTC().Format(time.RFC3339),
+	}
+	txID, err := client.SubmitGenericTransaction(TxTypeBatchReanchor, payload)
+	if err != nil {
+		result.add(target, "anchor", StepFailed, err.Error())
+		return result, nil
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO blockchain_record (related_table, related_id, tx_id, metadata_hash, created_at, updated_at, is_active)
+		VALUES ($1, $2, $3, $4, NOW(), NOW(), true)
+	`, "batch", p.BatchID, txID, hash)
+	if err != nil {
+		result.add(target, "anchor", StepFailed, fmt.Sprintf("anchored as %s but failed to record it: %v", txID, err))
+		return result, nil
+	}
+	result.add(target, "anchor", StepOK, "tx "+txID)
+	return result, nil
+}
+
+// rebuildTrace renders the public trace of a batch again
+func rebuildTrace(p Params, dryRun bool, userID int) (*Result, error) {
+	service := tracesnapshot.Default()
+	if service.Render == nil {
+		return nil, tracesnapshot.ErrNoRenderer
+	}
+	target := fmt.Sprintf("batch:%d", p.BatchID)
+	result := &Result{Steps: []Step{}}
+
+	latest, err := tracesnapshot.Latest(p.BatchID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if dryRun {
+		rendered, err := service.Render(p.BatchID, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render trace: %w", err)
+		}
+		traceJSON, err := json.Marshal(rendered.Trace)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(traceJSON)
+		if latest == nil || latest.ContentHash != hex.EncodeToString(sum[:]) {
+			result.add(target, "publish", StepPlanned, "the trace changed, a new snapshot would be published")
+		} else {
+			result.add(target, "pin", StepPlanned, fmt.Sprintf("the trace is unchanged, snapshot v%d would be pinned again", latest.Version))
+			if latest.Status != tracesnapshot.StatusAnchored {
+				result.add(target, "anchor", StepPlanned, fmt.Sprintf("snapshot v%d would be anchored", latest.Version))
+			}
+		}
+		return result, nil
+	}
+
+	snapshot, published, err := service.Publish(p.BatchID, userID)
+	if err != nil {
+		result.add(target, "publish", StepFailed, err.Error())
+		return result, nil
+	}
+	if published {
+		result.add(target, "publish", StepOK, fmt.Sprintf("snapshot v%d, %s", snapshot.Version, snapshot.JSONCID))
+		if snapshot.Status != tracesnapshot.StatusAnchored {
+			result.add(target, "anchor", StepFailed, snapshot.AnchorError)
+		}
+		return result, nil
+	}
+
+	result.add(target, "publish", StepSkipped, fmt.Sprintf("the trace is unchanged since snapshot v%d", snapshot.Version))
+	pinService := ipfs.NewIPFSPinataService()
+	for _, cid := range []string{snapshot.JSONCID, snapshot.HTMLCID} {
+		if cid == "" {
+			continue
+		}
+		if _, err := pinService.PinExistingCIDToPinata(cid, fmt.Sprintf("trace-batch-%d-v%d", p.BatchID, snapshot.Version), map[string]string{
+			"batch_id":      strconv.Itoa(p.BatchID),
+			"document_type": "trace_snapshot",
+			"runbook":       OpRebuildTrace,
+		}); err != nil {
+			result.add(cid, "pin", StepFailed, err.Error())
+		} else {
+			result.add(cid, "pin", StepOK, "")
+		}
+	}
+	if snapshot.Status != tracesnapshot.StatusAnchored {
+		if anchored, err := service.Anchor(snapshot.ID); err != nil {
+			result.add(target, "anchor", StepFailed, err.Error())
+		} else {
+			result.add(target, "anchor", StepOK, "tx "+anchored.AnchorTxID)
+		}
+	}
+	return result, nil
+}
+
+// replayTarget checks the window and filters of a webhook replay
+func replayTarget(p *Params) (string, error) {
+	if p.From == nil || p.To == nil {
+		return "", invalid("from and to are required")
+	}
+	if !p.To.After(*p.From) {
+		return "", invalid("to must be after from")
+	}
+	if p.To.Sub(*p.From) > maxReplayWindow {
+		return "", invalid("the window can be at most %d days", int(maxReplayWindow.Hours()/24))
+	}
+	if len(p.Statuses) == 0 {
+		p.Statuses = []string{webhooks.StatusFailed}
+	}
+	for _, status := range p.Statuses {
+		if status != webhooks.StatusFailed && status != webhooks.StatusDelivered && status != webhooks.StatusPending {
+			return "", invalid("statuses must be failed, delivered or pending")
+		}
+	}
+	target := "webhooks"
+	if p.CompanyID != 0 {
+		target = fmt.Sprintf("webhooks:company:%d", p.CompanyID)
+	}
+	return target, nil
+}
+
+// replayWebhooks delivers again the webhooks of a time window
+func replayWebhooks(p Params, dryRun bool, userID int) (*Result, error) {
+	rows, err := db.DB.Query(`
+		SELECT d.id, d.event_type, d.status, s.company_id
+		FROM webhook_delivery d
+		JOIN webhook_subscription s ON s.id = d.subscription_id
+		WHERE d.created_at >= $1 AND d.created_at < $2 AND d.status = ANY($3) AND s.is_active = true
+			AND ($4 = 0 OR s.company_id = $4) AND ($5 = '' OR d.event_type = $5)
+		ORDER BY d.created_at, d.id
+		LIMIT $6
+	`, *p.From, *p.To, pq.Array(p.Statuses), p.CompanyID, p.EventType, maxReplays+1)
+	if err != nil {
+		return nil, err
+	}
+	type delivery struct {
+		id        int
+		eventType string
+		status    string
+		companyID int
+	}
+	var deliveries []delivery
+	for rows.Next() {
+		var d delivery
+		if err := rows.Scan(&d.id, &d.eventType, &d.status, &d.companyID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(deliveries) > maxReplays {
+		return nil, invalid("more than %d deliveries match, narrow the window or the filters", maxReplays)
+	}
+
+	result := &Result{Steps: []Step{}}
+	for _, d := range deliveries {
+		target := fmt.Sprintf("delivery:%d", d.id)
+		detail := fmt.Sprintf("%s for company %d, was %s", d.eventType, d.companyID, d.status)
+		if dryRun {
+			result.add(target, "redeliver", StepPlanned, detail)
+			continue
+		}
+		if err := webhooks.Redeliver(d.id); err != nil {
+			result.add(target, "redeliver", StepFailed, err.Error())
+			continue
+		}
+		result.add(target, "redeliver", StepOK, detail)
+	}
+	return result, nil
+}
+
+// resyncTarget resolves the batch share to sync
+func resyncTarget(p *Params) (string, error) {
+	var err error
+	switch {
+	case p.ShareID > 0:
+		var exists bool
+		err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch_share WHERE id = $1 AND is_active = true)", p.ShareID).Scan(&exists)
+		if err == nil && !exists {
+			err = sql.ErrNoRows
+		}
+	case p.BatchID > 0 && p.DestChainID != "":
+		err = db.DB.QueryRow(`
+			SELECT id FROM batch_share WHERE batch_id = $1 AND dest_chain_id = $2 AND is_active = true
+		`, p.BatchID, p.DestChainID).Scan(&p.ShareID)
+	default:
+		return "", invalid("share_id, or batch_id and dest_chain_id, are required")
+	}
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: batch share", ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("share:%d", p.ShareID), nil
+}
+
+// resyncShare syncs a shared batch to its external chain now
+func resyncShare(p Params, dryRun bool, userID int) (*Result, error) {
+	target := fmt.Sprintf("share:%d", p.ShareID)
+	result := &Result{Steps: []Step{}}
+	if dryRun {
+		var status string
+		var failures int
+		err := db.DB.QueryRow("SELECT sync_status, COALESCE(failure_count, 0) FROM batch_share WHERE id = $1", p.ShareID).Scan(&status, &failures)
+		if err != nil {
+			return nil, err
+		}
+		action := "sync the changes since the last sync"
+		if p.Full {
+			action = "push the whole batch again"
+		}
+		result.add(target, "sync", StepPlanned, fmt.Sprintf("%s; the share is %s after %d failures", action, status, failures))
+		return result, nil
+	}
+
+	if p.Full {
+		// Moving the cursors back makes the next sync push every event and certificate again
+		if _, err := db.DB.Exec(`
+			UPDATE batch_share SET synced_event_id = 0, synced_certificate_id = 0, synced_status = NULL, updated_at = NOW()
+			WHERE id = $1
+		`, p.ShareID); err != nil {
+			return nil, err
+		}
+	}
+	res, err := chainsync.Default().Retry(p.ShareID)
+	if err != nil {
+		result.add(target, "sync", StepFailed, err.Error())
+		return result, nil
+	}
+	if res.Error != "" {
+		result.add(target, "sync", StepFailed, res.Error)
+		return result, nil
+	}
+	if res.DestChainID == "" {
+		// The scheduled sync of the share is in flight and pushes the same changes
+		result.add(target, "sync", StepSkipped, "a sync of the share is already in progress")
+		return result, nil
+	}
+	if res.Changes == 0 {
+		result.add(target, "sync", StepOK, "already in sync with "+res.DestChainID)
+		return result, nil
+	}
+	result.add(target, "sync", StepOK, fmt.Sprintf("%d changes to %s, tx %s", res.Changes, res.DestChainID, res.TxID))
+	return result, nil
+}
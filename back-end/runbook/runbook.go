@@ -0,0 +1,330 @@
+package runbook
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Operations the runbook can run
+const (
+	OpRepinCIDs      = "repin-cids"
+	OpReanchorBatch  = "reanchor-batch"
+	OpRebuildTrace   = "rebuild-trace"
+	OpReplayWebhooks = "replay-webhooks"
+	OpResyncShare    = "resync-share"
+)
+
+// Statuses of a run
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusPartial   = "partial" // some steps failed
+	StatusFailed    = "failed"
+	StatusAbandoned = "abandoned" // the process stopped while running
+)
+
+// Statuses of a step
+const (
+	StepOK      = "ok"
+	StepFailed  = "failed"
+	StepSkipped = "skipped"
+	StepPlanned = "planned" // what a dry run would do
+)
+
+// staleAfter is how long a run can stay running before it is taken as abandoned
+const staleAfter = time.Hour
+
+var (
+	// ErrUnknownOperation is returned for an operation the runbook does not have
+	ErrUnknownOperation = errors.New("unknown runbook operation")
+	// ErrInvalidParams is wrapped by errors about the parameters of an operation
+	ErrInvalidParams = errors.New("invalid runbook parameters")
+	// ErrAlreadyRunning is returned when the same operation is running on the same target
+	ErrAlreadyRunning = errors.New("the operation is already running on this target")
+	// ErrNotFound is returned for a target that does not exist
+	ErrNotFound = errors.New("runbook target not found")
+	// ErrReasonRequired is returned when a run has no reason
+	ErrReasonRequired = errors.New("a reason is required")
+)
+
+// Params are the parameters of an operation; each operation uses some of them
+type Params struct {
+	CIDs        []string   `json:"cids,omitempty"`          // repin-cids: CIDs to pin again
+	BatchID     int        `json:"batch_id,omitempty"`      // repin-cids: every CID of the batch; reanchor-batch, rebuild-trace: the batch
+	ShareID     int        `json:"share_id,omitempty"`      // resync-share: the batch share
+	DestChainID string     `json:"dest_chain_id,omitempty"` // resync-share: the chain the batch is shared with, with batch_id instead of share_id
+	Full        bool       `json:"full,omitempty"`          // resync-share: push the whole batch again instead of the changes since the last sync
+	From        *time.Time `json:"from,omitempty"`          // replay-webhooks: start of the window, by delivery creation
+	To          *time.Time `json:"to,omitempty"`            // replay-webhooks: end of the window
+	CompanyID   int        `json:"company_id,omitempty"`    // replay-webhooks: only deliveries of this company
+	EventType   string     `json:"event_type,omitempty"`    // replay-webhooks: only deliveries of this event
+	Statuses    []string   `json:"statuses,omitempty"`      // replay-webhooks: delivery statuses replayed, failed by default
+}
+
+// Request asks for an operation to be run
+type Request struct {
+	Operation string
+	Params    Params
+	Reason    string // Why the operation is run, kept with the run
+	DryRun    bool   // Report what the operation would do without doing it
+	UserID    int
+}
+
+// Step is one action of a run
+type Step struct {
+	Target string `json:"target"`
+	Action string `json:"action"`
+	Status string `json:"status"` // ok, failed, skipped or planned
+	Detail string `json:"detail,omitempty"`
+}
+
+// Result is the outcome of a run
+type Result struct {
+	Steps     []Step `json:"steps"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Skipped   int    `json:"skipped"`
+}
+
+// add records a step and counts its outcome
+func (r *Result) add(target, action, status, detail string) {
+	r.Steps = append(r.Steps, Step{Target: target, Action: action, Status: status, Detail: detail})
+	switch status {
+	case StepOK:
+		r.Succeeded++
+	case StepFailed:
+		r.Failed++
+	case StepSkipped:
+		r.Skipped++
+	}
+}
+
+// Run is an audited run of an operation
+type Run struct {
+	ID          int             `json:"id"`
+	Operation   string          `json:"operation"`
+	Target      string          `json:"target"`
+	Params      json.RawMessage `json:"params" swaggertype:"object"`
+	Reason      string          `json:"reason"`
+	DryRun      bool            `json:"dry_run"`
+	Status      string          `json:"status"`
+	Result      *Result         `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	RequestedBy *int            `json:"requested_by,omitempty"`
+	StartedAt   time.Time       `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Operation is a recovery action the runbook runs safely: validated, bounded, exclusive per target and audited
+type Operation struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Params      string `json:"params"` // Parameters the operation takes
+
+	// target validates the parameters and names what the operation acts on
+	target func(p *Params) (string, error)
+	// run performs the operation, or only plans it on a dry run
+	run func(p Params, dryRun bool, userID int) (*Result, error)
+}
+
+// Operations lists the operations of the runbook
+func Operations() []Operation {
+	return []Operation{
+		{
+			Name:        OpRepinCIDs,
+			Description: "Pin a set of CIDs to Pinata again, given explicitly or every CID of a batch's documents and trace snapshots",
+			Params:      "cids (at most 200) or batch_id",
+			target:      repinTarget,
+			run:         repinCIDs,
+		},
+		{
+			Name:        OpReanchorBatch,
+			Description: "Anchor the current state of a batch on-chain again and record the new anchor",
+			Params:      "batch_id",
+			target:      batchTarget,
+			run:         reanchorBatch,
+		},
+		{
+			Name:        OpRebuildTrace,
+			Description: "Render the public trace of a batch again; publish a new snapshot when it changed, otherwise pin and anchor the latest one again",
+			Params:      "batch_id",
+			target:      batchTarget,
+			run:         rebuildTrace,
+		},
+		{
+			Name:        OpReplayWebhooks,
+			Description: "Deliver again the webhooks created in a time window of at most 7 days, at most 1000 deliveries",
+			Params:      "from, to, company_id, event_type, statuses (failed by default)",
+			target:      replayTarget,
+			run:         replayWebhooks,
+		},
+		{
+			Name:        OpResyncShare,
+			Description: "Sync a shared batch to its external chain now, clearing its failure state; with full the whole batch is pushed again",
+			Params:      "share_id, or batch_id and dest_chain_id; full",
+			target:      resyncTarget,
+			run:         resyncShare,
+		},
+	}
+}
+
+// lookup finds an operation by name
+func lookup(name string) (Operation, bool) {
+	for _, op := range Operations() {
+		if op.Name == name {
+			return op, true
+		}
+	}
+	return Operation{}, false
+}
+
+// Execute runs an operation and records the run. Only one run of an operation on a target can be in progress;
+// dry runs are recorded too but are not exclusive
+func Execute(req Request) (*Run, error) {
+	op, ok := lookup(req.Operation)
+	if !ok {
+		return nil, ErrUnknownOperation
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return nil, ErrReasonRequired
+	}
+	target, err := op.target(&req.Params)
+	if err != nil {
+		return nil, err
+	}
+	params, err := json.Marshal(req.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	status := StatusRunning
+	if req.DryRun {
+		// Dry runs change nothing, so they do not hold the target
+		status = StatusSucceeded
+	} else if _, err := db.DB.Exec(`
+		UPDATE runbook_run SET status = $1, error = 'abandoned while running', finished_at = NOW()
+		WHERE status = $2 AND started_at < $3
+	`, StatusAbandoned, StatusRunning, time.Now().Add(-staleAfter)); err != nil {
+		return nil, err
+	}
+
+	var runID int
+	err = db.DB.QueryRow(`
+		INSERT INTO runbook_run (operation, target, params, reason, dry_run, status, requested_by, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NOW())
+		RETURNING id
+	`, op.Name, target, string(params), req.Reason, req.DryRun, status, req.UserID).Scan(&runID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, ErrAlreadyRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Runbook: %s on %s started by account %d (dry run: %t): %s\n", op.Name, target, req.UserID, req.DryRun, req.Reason)
+
+	result, runErr := op.run(req.Params, req.DryRun, req.UserID)
+	status = StatusSucceeded
+	errorText := ""
+	switch {
+	case runErr != nil:
+		status = StatusFailed
+		errorText = runErr.Error()
+	case result != nil && result.Failed > 0 && result.Succeeded == 0:
+		status = StatusFailed
+	case result != nil && result.Failed > 0:
+		status = StatusPartial
+	}
+	var resultJSON interface{}
+	if result != nil {
+		encoded, _ := json.Marshal(result)
+		resultJSON = string(encoded)
+	}
+	if _, err := db.DB.Exec(`
+		UPDATE runbook_run SET status = $2, result = $3, error = NULLIF($4, ''), finished_at = NOW()
+		WHERE id = $1
+	`, runID, status, resultJSON, errorText); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Runbook: %s on %s finished: %s\n", op.Name, target, status)
+	return Get(runID)
+}
+
+const runColumns = `
+	id, operation, target, params, reason, dry_run, status, result, COALESCE(error, ''), requested_by, started_at, finished_at
+`
+
+// scanRun reads a run selected with runColumns
+func scanRun(row interface{ Scan(...interface{}) error }) (*Run, error) {
+	var r Run
+	var params []byte
+	var result []byte
+	var requestedBy sql.NullInt64
+	var finishedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.Operation, &r.Target, &params, &r.Reason, &r.DryRun, &r.Status, &result, &r.Error,
+		&requestedBy, &r.StartedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+	r.Params = params
+	if len(result) > 0 {
+		r.Result = &Result{}
+		if err := json.Unmarshal(result, r.Result); err != nil {
+			return nil, err
+		}
+	}
+	if requestedBy.Valid {
+		id := int(requestedBy.Int64)
+		r.RequestedBy = &id
+	}
+	if finishedAt.Valid {
+		r.FinishedAt = &finishedAt.Time
+	}
+	return &r, nil
+}
+
+// Get loads a run; it returns sql.ErrNoRows when there is none
+func Get(runID int) (*Run, error) {
+	return scanRun(db.DB.QueryRow(`SELECT `+runColumns+` FROM runbook_run WHERE id = $1`, runID))
+}
+
+// List loads the latest runs, of one operation when it is not empty
+func List(operation string, limit int) ([]Run, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := db.DB.Query(`
+		SELECT `+runColumns+` FROM runbook_run
+		WHERE ($1 = '' OR operation = $1)
+		ORDER BY started_at DESC, id DESC
+		LIMIT $2
+	`, operation, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []Run{}
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// invalid wraps ErrInvalidParams with a description of the problem
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidParams, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,253 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultPrefix marks a configuration value as a reference to a secret in Vault
+// The format is vault:<path>#<key>, for example vault:tracepost/database#password
+const VaultPrefix = "vault:"
+
+// SecretData is one version of the key/value pairs stored at a secret path
+type SecretData struct {
+	Values        map[string]string
+	Version       int
+	LeaseDuration time.Duration
+}
+
+// Provider fetches secrets from a secret store
+type Provider interface {
+	Fetch(path string) (*SecretData, error)
+}
+
+// RotationFunc is called when a watched secret changes
+type RotationFunc func(ref, newValue string)
+
+// cacheEntry is a fetched secret path with its expiry
+type cacheEntry struct {
+	data      *SecretData
+	expiresAt time.Time
+}
+
+// Manager resolves secret references lazily and caches them until they expire
+type Manager struct {
+	provider Provider
+	ttl      time.Duration
+
+	mutex    sync.RWMutex
+	cache    map[string]*cacheEntry
+	watchers map[string][]RotationFunc
+	current  map[string]string
+}
+
+// NewManager creates a manager that caches fetched secrets for ttl
+func NewManager(provider Provider, ttl time.Duration) *Manager {
+	return &Manager{
+		provider: provider,
+		ttl:      ttl,
+		cache:    make(map[string]*cacheEntry),
+		watchers: make(map[string][]RotationFunc),
+		current:  make(map[string]string),
+	}
+}
+
+var (
+	defaultManager *Manager
+	once           sync.Once
+)
+
+// Default returns the process wide manager, configured from VAULT_* environment variables
+func Default() *Manager {
+	once.Do(func() {
+		ttl := time.Duration(getEnvAsInt("SECRETS_CACHE_TTL", 300)) * time.Second
+		var provider Provider
+		if os.Getenv("VAULT_ADDR") != "" {
+			provider = NewVaultProviderFromEnv()
+		}
+		defaultManager = NewManager(provider, ttl)
+
+		if interval := getEnvAsInt("SECRETS_ROTATION_CHECK_INTERVAL", 60); provider != nil && interval > 0 {
+			defaultManager.StartRotationWatcher(time.Duration(interval) * time.Second)
+		}
+	})
+	return defaultManager
+}
+
+// IsReference reports whether a value points to a secret store instead of holding the secret
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, VaultPrefix)
+}
+
+// parseReference splits vault:<path>#<key> into its path and key
+func parseReference(ref string) (string, string, error) {
+	spec := strings.TrimPrefix(ref, VaultPrefix)
+	path, key, found := strings.Cut(spec, "#")
+	if !found || path == "" || key == "" {
+		return "", "", fmt.Errorf("invalid secret reference %q, expected vault:<path>#<key>", ref)
+	}
+	return path, key, nil
+}
+
+// Resolve returns the secret a value refers to, or the value itself when it is not a reference
+func (m *Manager) Resolve(value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+	if m.provider == nil {
+		return "", errors.New("secret reference used but VAULT_ADDR is not configured")
+	}
+
+	path, key, err := parseReference(value)
+	if err != nil {
+		return "", err
+	}
+	data, err := m.fetch(path, false)
+	if err != nil {
+		return "", err
+	}
+	secret, ok := data.Values[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in secret %s", key, path)
+	}
+	return secret, nil
+}
+
+// fetch returns a secret path from the cache, reading it from the provider once it expires
+func (m *Manager) fetch(path string, force bool) (*SecretData, error) {
+	m.mutex.RLock()
+	entry, ok := m.cache[path]
+	m.mutex.RUnlock()
+	if ok && !force && time.Now().Before(entry.expiresAt) {
+		return entry.data, nil
+	}
+
+	data, err := m.provider.Fetch(path)
+	if err != nil {
+		// Keep serving the last known value if the store is briefly unreachable
+		if ok {
+			fmt.Printf("Warning: failed to refresh secret %s, using cached version: %v\n", path, err)
+			return entry.data, nil
+		}
+		return nil, fmt.Errorf("failed to fetch secret %s: %w", path, err)
+	}
+
+	ttl := m.ttl
+	if data.LeaseDuration > 0 && data.LeaseDuration < ttl {
+		ttl = data.LeaseDuration
+	}
+	m.mutex.Lock()
+	m.cache[path] = &cacheEntry{data: data, expiresAt: time.Now().Add(ttl)}
+	m.mutex.Unlock()
+	return data, nil
+}
+
+// Invalidate drops a cached secret so the next lookup reads it again, e.g. after an authentication failure
+func (m *Manager) Invalidate(ref string) {
+	path, _, err := parseReference(ref)
+	if err != nil {
+		return
+	}
+	m.mutex.Lock()
+	delete(m.cache, path)
+	m.mutex.Unlock()
+}
+
+// Watch registers a callback that runs when the secret behind a reference is rotated
+func (m *Manager) Watch(ref string, fn RotationFunc) {
+	if !IsReference(ref) {
+		return
+	}
+	value, _ := m.Resolve(ref)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.watchers[ref] = append(m.watchers[ref], fn)
+	if _, ok := m.current[ref]; !ok {
+		m.current[ref] = value
+	}
+}
+
+// StartRotationWatcher periodically re-reads watched secrets and notifies watchers of changes
+func (m *Manager) StartRotationWatcher(interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			m.checkRotations()
+		}
+	}()
+}
+
+// checkRotations refreshes every watched secret and runs callbacks for the ones that changed
+func (m *Manager) checkRotations() {
+	m.mutex.RLock()
+	refs := make([]string, 0, len(m.watchers))
+	for ref := range m.watchers {
+		refs = append(refs, ref)
+	}
+	m.mutex.RUnlock()
+
+	for _, ref := range refs {
+		path, key, err := parseReference(ref)
+		if err != nil {
+			continue
+		}
+		data, err := m.fetch(path, true)
+		if err != nil {
+			fmt.Printf("Warning: failed to check rotation of %s: %v\n", ref, err)
+			continue
+		}
+		value := data.Values[key]
+
+		m.mutex.Lock()
+		changed := m.current[ref] != value
+		m.current[ref] = value
+		callbacks := append([]RotationFunc(nil), m.watchers[ref]...)
+		m.mutex.Unlock()
+
+		if changed {
+			fmt.Printf("Secret %s was rotated to version %d\n", path, data.Version)
+			for _, fn := range callbacks {
+				fn(ref, value)
+			}
+		}
+	}
+}
+
+// Resolve resolves a value with the default manager
+func Resolve(value string) (string, error) {
+	return Default().Resolve(value)
+}
+
+// Value resolves a value with the default manager, logging and returning an empty string on failure
+func Value(value string) string {
+	resolved, err := Resolve(value)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return ""
+	}
+	return resolved
+}
+
+// Getenv reads an environment variable and resolves it if it references a secret
+func Getenv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return Value(value)
+}
+
+// getEnvAsInt gets an environment variable as an integer or returns a default value
+func getEnvAsInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
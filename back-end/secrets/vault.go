@@ -0,0 +1,181 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultProvider reads secrets from a HashiCorp Vault KV secrets engine
+type VaultProvider struct {
+	Address    string
+	Mount      string
+	KVVersion  int
+	Namespace  string
+	RoleID     string
+	SecretID   string
+	HTTPClient *http.Client
+
+	mutex       sync.Mutex
+	token       string
+	tokenExpiry time.Time // zero for tokens that do not expire
+}
+
+// NewVaultProviderFromEnv creates a Vault provider from VAULT_* environment variables
+// Authentication uses VAULT_TOKEN, or AppRole when VAULT_ROLE_ID and VAULT_SECRET_ID are set
+func NewVaultProviderFromEnv() *VaultProvider {
+	kvVersion := getEnvAsInt("VAULT_KV_VERSION", 2)
+	mount := os.Getenv("VAULT_KV_MOUNT")
+	if mount == "" {
+		mount = "secret"
+	}
+
+	return &VaultProvider{
+		Address:    strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/"),
+		Mount:      strings.Trim(mount, "/"),
+		KVVersion:  kvVersion,
+		Namespace:  os.Getenv("VAULT_NAMESPACE"),
+		RoleID:     os.Getenv("VAULT_ROLE_ID"),
+		SecretID:   os.Getenv("VAULT_SECRET_ID"),
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		token:      os.Getenv("VAULT_TOKEN"),
+	}
+}
+
+// Fetch reads the key/value pairs stored at a path
+func (v *VaultProvider) Fetch(path string) (*SecretData, error) {
+	data, status, err := v.read(path)
+	if status == http.StatusForbidden && v.RoleID != "" {
+		// The token was revoked or expired early, log in again once
+		v.mutex.Lock()
+		v.token = ""
+		v.mutex.Unlock()
+		data, _, err = v.read(path)
+	}
+	return data, err
+}
+
+// read performs a single authenticated read of a secret path
+func (v *VaultProvider) read(path string) (*SecretData, int, error) {
+	token, err := v.authToken()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/%s", v.Address, v.Mount, strings.TrimPrefix(path, "/"))
+	if v.KVVersion == 2 {
+		url = fmt.Sprintf("%s/v1/%s/data/%s", v.Address, v.Mount, strings.TrimPrefix(path, "/"))
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	v.setHeaders(req, token)
+
+	resp, err := v.HTTPClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("vault returned HTTP %d for %s", resp.StatusCode, path)
+	}
+
+	var body struct {
+		LeaseDuration int                    `json:"lease_duration"`
+		Data          map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("invalid vault response: %w", err)
+	}
+
+	values := body.Data
+	version := 0
+	if v.KVVersion == 2 {
+		// KV v2 nests the values and exposes the version in the metadata
+		values, _ = body.Data["data"].(map[string]interface{})
+		if metadata, ok := body.Data["metadata"].(map[string]interface{}); ok {
+			if n, ok := metadata["version"].(float64); ok {
+				version = int(n)
+			}
+		}
+	}
+
+	result := &SecretData{
+		Values:        make(map[string]string, len(values)),
+		Version:       version,
+		LeaseDuration: time.Duration(body.LeaseDuration) * time.Second,
+	}
+	for key, value := range values {
+		result.Values[key] = fmt.Sprint(value)
+	}
+	return result, resp.StatusCode, nil
+}
+
+// authToken returns a valid client token, logging in with AppRole when needed
+func (v *VaultProvider) authToken() (string, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	valid := v.token != "" && (v.tokenExpiry.IsZero() || time.Now().Before(v.tokenExpiry))
+	if valid {
+		return v.token, nil
+	}
+	if v.RoleID == "" || v.SecretID == "" {
+		if v.token != "" {
+			return v.token, nil
+		}
+		return "", errors.New("no vault token configured, set VAULT_TOKEN or VAULT_ROLE_ID and VAULT_SECRET_ID")
+	}
+
+	payload, _ := json.Marshal(map[string]string{"role_id": v.RoleID, "secret_id": v.SecretID})
+	req, err := http.NewRequest("POST", v.Address+"/v1/auth/approle/login", bytes.NewBuffer(payload))
+	if err != nil {
+		return "", err
+	}
+	v.setHeaders(req, "")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := v.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault login failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault login failed: HTTP %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Auth.ClientToken == "" {
+		return "", errors.New("vault login returned no client token")
+	}
+
+	v.token = body.Auth.ClientToken
+	v.tokenExpiry = time.Time{}
+	if body.Auth.LeaseDuration > 0 {
+		// Renew a little before the lease runs out
+		v.tokenExpiry = time.Now().Add(time.Duration(body.Auth.LeaseDuration) * time.Second * 9 / 10)
+	}
+	return v.token, nil
+}
+
+// setHeaders adds the token and namespace headers to a Vault request
+func (v *VaultProvider) setHeaders(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+}
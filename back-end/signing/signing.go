@@ -0,0 +1,646 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// HeaderName is the request header carrying the detached JWS of an outbound payload
+const HeaderName = "X-TracePost-JWS"
+
+// Signature algorithms keys are generated for
+const (
+	AlgorithmES256 = "ES256" // ECDSA over P-256 with SHA-256
+	AlgorithmRS256 = "RS256" // RSASSA-PKCS1-v1_5 with SHA-256
+)
+
+// Key purposes; each purpose has its own active key and rotation
+const (
+	PurposePayload = "payload" // detached JWS of outbound webhook and notification payloads
+	PurposeToken   = "token"   // access tokens issued at login
+)
+
+// Algorithms are the algorithms keys of each purpose are generated for
+// Tokens use RS256 since it is the one every JWT library verifies
+var Algorithms = map[string]string{
+	PurposePayload: AlgorithmES256,
+	PurposeToken:   AlgorithmRS256,
+}
+
+// Key statuses
+const (
+	StatusActive  = "active"  // signs new payloads or tokens
+	StatusRetired = "retired" // no longer signs, published in the JWKS until it expires
+)
+
+// sealedPrefix marks a private key encrypted with the configured key encryption key
+const sealedPrefix = "sealed:v1:"
+
+// keyCacheTTL is how long the active key is reused before checking for a rotation by another instance
+const keyCacheTTL = time.Minute
+
+// minReloadInterval limits how often an unknown kid reloads the published keys
+const minReloadInterval = 10 * time.Second
+
+// Key is a signing key pair
+type Key struct {
+	ID        int        `json:"id"`
+	KID       string     `json:"kid"`
+	Purpose   string     `json:"purpose"`
+	Algorithm string     `json:"algorithm"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	public  crypto.PublicKey
+	private crypto.Signer
+}
+
+// JWK is the public part of a key as published in the JWKS
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+// JWKS is the JSON Web Key Set receivers verify signatures with
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Service signs outbound payloads and access tokens with the active key of each purpose and rotates keys on a schedule
+type Service struct {
+	RotationInterval time.Duration // age at which the active key is replaced; zero disables automatic rotation
+	Retention        time.Duration // how long a retired key stays in the JWKS
+	CheckInterval    time.Duration
+	EncryptionKey    string // seals private keys at rest when set
+
+	mutex       sync.Mutex
+	current     map[string]*Key
+	loadedAt    map[string]time.Time
+	published   map[string]*Key
+	publishedAt time.Time
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates a signing service from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		RotationInterval: time.Duration(cfg.SigningKeyRotationDays) * 24 * time.Hour,
+		Retention:        time.Duration(cfg.SigningKeyRetentionDays) * 24 * time.Hour,
+		CheckInterval:    time.Hour,
+		EncryptionKey:    cfg.SigningKeyEncryptionKey,
+		current:          make(map[string]*Key),
+		loadedAt:         make(map[string]time.Time),
+	}
+}
+
+// Default returns the process wide signing service
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Sign creates the detached JWS of a payload with the default service
+func Sign(payload []byte) (string, error) {
+	return Default().Sign(payload)
+}
+
+// Start makes sure a key of every purpose exists and rotates them in the background when they get too old
+func (s *Service) Start() {
+	go func() {
+		for {
+			if err := s.RunOnce(); err != nil {
+				fmt.Printf("Warning: signing key rotation failed: %v\n", err)
+			}
+			time.Sleep(s.CheckInterval)
+		}
+	}()
+}
+
+// RunOnce creates the first key of each purpose or replaces an active key older than the rotation interval,
+// and drops the private part of retired keys that are no longer published
+func (s *Service) RunOnce() error {
+	if db.DB == nil {
+		return nil
+	}
+	for _, purpose := range []string{PurposePayload, PurposeToken} {
+		if _, err := s.rotate(purpose, 0, true); err != nil {
+			return fmt.Errorf("failed to rotate %s key: %w", purpose, err)
+		}
+	}
+	_, err := db.DB.Exec(`
+		UPDATE signing_key SET private_key = ''
+		WHERE status = $1 AND expires_at < NOW() AND private_key <> ''
+	`, StatusRetired)
+	return err
+}
+
+// Rotate generates a new active key of a purpose and retires the current one, which stays published for the retention period
+func (s *Service) Rotate(purpose string, createdBy int) (*Key, error) {
+	return s.rotate(purpose, createdBy, false)
+}
+
+// rotate replaces the active key of a purpose, or when onlyIfDue only when there is none or it is past the rotation interval
+// The table is locked so instances starting together do not both create a key
+func (s *Service) rotate(purpose string, createdBy int, onlyIfDue bool) (*Key, error) {
+	algorithm, ok := Algorithms[purpose]
+	if !ok {
+		return nil, fmt.Errorf("unknown key purpose %q", purpose)
+	}
+	if db.DB == nil {
+		return nil, errors.New("database is not initialized")
+	}
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("LOCK TABLE signing_key IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return nil, fmt.Errorf("failed to lock signing keys: %w", err)
+	}
+
+	if onlyIfDue {
+		active, err := s.scanKey(tx.QueryRow(`SELECT `+keyColumns+` FROM signing_key WHERE purpose = $1 AND status = $2 ORDER BY created_at DESC LIMIT 1`, purpose, StatusActive))
+		if err == nil && (s.RotationInterval <= 0 || time.Since(active.CreatedAt) < s.RotationInterval) {
+			return nil, nil
+		}
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	key, privatePEM, publicPEM, err := generateKey(purpose, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	storedPrivate, err := s.seal(privatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE signing_key SET status = $1, retired_at = NOW(), expires_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE purpose = $3 AND status = $4
+	`, StatusRetired, int64(s.Retention/time.Second), purpose, StatusActive); err != nil {
+		return nil, fmt.Errorf("failed to retire signing key: %w", err)
+	}
+	err = tx.QueryRow(`
+		INSERT INTO signing_key (kid, purpose, algorithm, public_key, private_key, status, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NOW())
+		RETURNING id, created_at
+	`, key.KID, purpose, key.Algorithm, publicPEM, storedPrivate, StatusActive, createdBy).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store signing key: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.current[purpose] = key
+	s.loadedAt[purpose] = time.Now()
+	s.publishedAt = time.Time{}
+	s.mutex.Unlock()
+	return key, nil
+}
+
+// Current returns the active key of a purpose, creating the first one when none exists yet
+func (s *Service) Current(purpose string) (*Key, error) {
+	s.mutex.Lock()
+	if key := s.current[purpose]; key != nil && time.Since(s.loadedAt[purpose]) < keyCacheTTL {
+		s.mutex.Unlock()
+		return key, nil
+	}
+	s.mutex.Unlock()
+
+	if db.DB == nil {
+		return nil, errors.New("database is not initialized")
+	}
+	key, err := s.scanKey(db.DB.QueryRow(`SELECT `+keyColumns+` FROM signing_key WHERE purpose = $1 AND status = $2 ORDER BY created_at DESC LIMIT 1`, purpose, StatusActive))
+	if err == sql.ErrNoRows {
+		created, err := s.rotate(purpose, 0, true)
+		if err != nil {
+			return nil, err
+		}
+		if created != nil {
+			return created, nil
+		}
+		return s.Current(purpose)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+	if key.private == nil {
+		return nil, fmt.Errorf("signing key %s has no private key", key.KID)
+	}
+
+	s.mutex.Lock()
+	s.current[purpose] = key
+	s.loadedAt[purpose] = time.Now()
+	s.mutex.Unlock()
+	return key, nil
+}
+
+// PublicKey returns the published key of a purpose with a kid, for verifying what it signed
+// Unknown kids reload the published keys, so keys rotated by another instance are picked up
+func (s *Service) PublicKey(purpose, kid string) (crypto.PublicKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := s.published[kid]
+	stale := time.Since(s.publishedAt) >= keyCacheTTL
+	if stale || (key == nil && time.Since(s.publishedAt) >= minReloadInterval) {
+		keys, err := s.Keys(true)
+		if err != nil {
+			return nil, err
+		}
+		s.published = make(map[string]*Key, len(keys))
+		for i := range keys {
+			s.published[keys[i].KID] = &keys[i]
+		}
+		s.publishedAt = time.Now()
+		key = s.published[kid]
+	}
+	if key == nil || key.Purpose != purpose {
+		return nil, fmt.Errorf("unknown %s key %q", purpose, kid)
+	}
+	return key.public, nil
+}
+
+// Sign creates a detached compact JWS of a payload with the active key
+// The result has the form "<protected header>..<signature>"; receivers put the base64url encoded body back
+// between the two dots and verify it against the key of the kid in the JWKS
+func (s *Service) Sign(payload []byte) (string, error) {
+	key, err := s.Current(PurposePayload)
+	if err != nil {
+		return "", err
+	}
+	return key.SignDetached(payload, time.Now())
+}
+
+// SignDetached creates a detached compact JWS of a payload
+func (k *Key) SignDetached(payload []byte, issuedAt time.Time) (string, error) {
+	if k.private == nil {
+		return "", fmt.Errorf("signing key %s has no private key", k.KID)
+	}
+	header, err := json.Marshal(map[string]interface{}{
+		"alg": k.Algorithm,
+		"kid": k.KID,
+		"typ": "JOSE",
+		"iat": issuedAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	digest := sha256.Sum256([]byte(protected + "." + base64.RawURLEncoding.EncodeToString(payload)))
+
+	var signature []byte
+	switch private := k.private.(type) {
+	case *ecdsa.PrivateKey:
+		r, sigS, err := ecdsa.Sign(rand.Reader, private, digest[:])
+		if err != nil {
+			return "", err
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		sigS.FillBytes(signature[32:])
+	case *rsa.PrivateKey:
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:]); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported key type %T", k.private)
+	}
+	return protected + ".." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Signer returns the private key of a key, or nil once it was dropped
+func (k *Key) Signer() crypto.Signer {
+	return k.private
+}
+
+// Verify checks a detached JWS of a payload against a key set
+func Verify(jws string, payload []byte, set JWKS) error {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return errors.New("not a detached compact JWS")
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("invalid JWS header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return fmt.Errorf("invalid JWS header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("invalid JWS signature")
+	}
+
+	for _, jwk := range set.Keys {
+		if jwk.Kid != header.Kid {
+			continue
+		}
+		if jwk.Alg != header.Alg {
+			return fmt.Errorf("key %q is not a %s key", jwk.Kid, header.Alg)
+		}
+		public, err := jwk.PublicKey()
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload)))
+		valid := false
+		switch public := public.(type) {
+		case *ecdsa.PublicKey:
+			valid = len(signature) == 64 &&
+				ecdsa.Verify(public, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:]))
+		case *rsa.PublicKey:
+			valid = rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+		}
+		if !valid {
+			return errors.New("JWS signature does not match the payload")
+		}
+		return nil
+	}
+	return fmt.Errorf("no key %q in the key set", header.Kid)
+}
+
+// JWKS returns the active keys and the retired keys that have not expired yet
+func (s *Service) JWKS() (JWKS, error) {
+	set := JWKS{Keys: []JWK{}}
+	keys, err := s.Keys(true)
+	if err != nil {
+		return set, err
+	}
+	for _, key := range keys {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	return set, nil
+}
+
+// Keys lists signing keys, newest first, optionally only those still published
+func (s *Service) Keys(publishedOnly bool) ([]Key, error) {
+	if db.DB == nil {
+		return nil, errors.New("database is not initialized")
+	}
+	query := `SELECT ` + keyColumns + ` FROM signing_key`
+	if publishedOnly {
+		query += ` WHERE status = 'active' OR (status = 'retired' AND (expires_at IS NULL OR expires_at > NOW()))`
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := db.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []Key{}
+	for rows.Next() {
+		key, err := s.scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// JWK returns the public part of a key
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.KID, Use: "sig", Alg: k.Algorithm}
+	switch public := k.public.(type) {
+	case *ecdsa.PublicKey:
+		point := make([]byte, 64)
+		public.X.FillBytes(point[:32])
+		public.Y.FillBytes(point[32:])
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = base64.RawURLEncoding.EncodeToString(point[:32])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(point[32:])
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	}
+	return jwk
+}
+
+// PublicKey decodes the EC or RSA public key of a JWK
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case j.Kty == "EC" && j.Crv == "P-256":
+		x, errX := base64.RawURLEncoding.DecodeString(j.X)
+		y, errY := base64.RawURLEncoding.DecodeString(j.Y)
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("invalid coordinates in key %s", j.Kid)
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !public.Curve.IsOnCurve(public.X, public.Y) {
+			return nil, fmt.Errorf("key %s is not on the P-256 curve", j.Kid)
+		}
+		return public, nil
+	case j.Kty == "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(j.N)
+		e, errE := base64.RawURLEncoding.DecodeString(j.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid modulus or exponent in key %s", j.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s/%s", j.Kty, j.Crv)
+}
+
+// Thumbprint computes the RFC 7638 thumbprint of a public key, used as its kid
+func Thumbprint(public crypto.PublicKey) string {
+	jwk := (&Key{public: public}).JWK()
+	var canonical string
+	if jwk.Kty == "RSA" {
+		canonical = `{"e":"` + jwk.E + `","kty":"RSA","n":"` + jwk.N + `"}`
+	} else {
+		canonical = `{"crv":"` + jwk.Crv + `","kty":"EC","x":"` + jwk.X + `","y":"` + jwk.Y + `"}`
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// generateKey creates a key pair for an algorithm with its PEM encodings
+func generateKey(purpose, algorithm string) (*Key, string, string, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		err = fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, "", "", err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, "", "", err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, "", "", err
+	}
+	key := &Key{
+		KID:       Thumbprint(private.Public()),
+		Purpose:   purpose,
+		Algorithm: algorithm,
+		Status:    StatusActive,
+		public:    private.Public(),
+		private:   private,
+	}
+	privatePEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	return key, privatePEM, publicPEM, nil
+}
+
+const keyColumns = `id, kid, purpose, algorithm, status, created_at, retired_at, expires_at, public_key, private_key`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanKey reads a key selected with keyColumns; the private key is left empty once it was dropped
+func (s *Service) scanKey(row rowScanner) (*Key, error) {
+	var key Key
+	var retiredAt, expiresAt sql.NullTime
+	var publicPEM, storedPrivate string
+	if err := row.Scan(&key.ID, &key.KID, &key.Purpose, &key.Algorithm, &key.Status, &key.CreatedAt, &retiredAt, &expiresAt, &publicPEM, &storedPrivate); err != nil {
+		return nil, err
+	}
+	if retiredAt.Valid {
+		key.RetiredAt = &retiredAt.Time
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+
+	block, _ := pem.Decode([]byte(publicPEM))
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key of signing key %s", key.KID)
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key of signing key %s: %w", key.KID, err)
+	}
+	key.public = public
+
+	if storedPrivate != "" && key.Status == StatusActive {
+		privatePEM, err := s.open(storedPrivate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt signing key %s: %w", key.KID, err)
+		}
+		block, _ := pem.Decode([]byte(privatePEM))
+		if block == nil {
+			return nil, fmt.Errorf("invalid private key of signing key %s", key.KID)
+		}
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key of signing key %s: %w", key.KID, err)
+		}
+		var ok bool
+		if key.private, ok = private.(crypto.Signer); !ok {
+			return nil, fmt.Errorf("signing key %s cannot sign", key.KID)
+		}
+	}
+	return &key, nil
+}
+
+// seal encrypts a private key with AES-256-GCM when a key encryption key is configured
+func (s *Service) seal(privatePEM string) (string, error) {
+	if s.EncryptionKey == "" {
+		return privatePEM, nil
+	}
+	gcm, err := s.cipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(privatePEM), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a private key stored by seal
+func (s *Service) open(stored string) (string, error) {
+	if !strings.HasPrefix(stored, sealedPrefix) {
+		return stored, nil
+	}
+	if s.EncryptionKey == "" {
+		return "", errors.New("key is sealed but no key encryption key is configured")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedPrefix))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := s.cipher()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("sealed key is truncated")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// cipher derives the AES-256-GCM cipher of the key encryption key
+func (s *Service) cipher() (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte(s.EncryptionKey))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
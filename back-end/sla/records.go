@@ -0,0 +1,278 @@
+package sla
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// maxTargetHours bounds the target of an SLA to a year
+const maxTargetHours = 8760
+
+// Validate normalizes a definition and checks its fields
+func (d *Definition) Validate() error {
+	d.Name = strings.TrimSpace(d.Name)
+	d.Metric = strings.TrimSpace(d.Metric)
+	d.DocType = strings.TrimSpace(d.DocType)
+	if d.SupplierCompanyID == 0 || d.BuyerCompanyID == 0 {
+		return fmt.Errorf("%w: supplier_company_id and buyer_company_id are required", ErrInvalid)
+	}
+	if d.SupplierCompanyID == d.BuyerCompanyID {
+		return fmt.Errorf("%w: the supplier and the buyer must be different companies", ErrInvalid)
+	}
+	if d.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	responsible, ok := metrics[d.Metric]
+	if !ok {
+		return fmt.Errorf("%w: metric must be one of %s", ErrInvalid, strings.Join(Metrics(), ", "))
+	}
+	d.Responsible = responsible
+	if d.Metric == MetricDocumentUploaded && d.DocType == "" {
+		return fmt.Errorf("%w: doc_type is required for %s", ErrInvalid, MetricDocumentUploaded)
+	}
+	if d.Metric != MetricDocumentUploaded {
+		d.DocType = ""
+	}
+	if d.TargetHours < 1 || d.TargetHours > maxTargetHours {
+		return fmt.Errorf("%w: target_hours must be between 1 and %d", ErrInvalid, maxTargetHours)
+	}
+	return nil
+}
+
+const definitionColumns = `id, supplier_company_id, buyer_company_id, name, metric, target_hours, COALESCE(doc_type, ''),
+	is_active, created_at, updated_at`
+
+// scanDefinition reads a definition selected with definitionColumns
+func scanDefinition(row interface{ Scan(...interface{}) error }) (Definition, error) {
+	var d Definition
+	err := row.Scan(&d.ID, &d.SupplierCompanyID, &d.BuyerCompanyID, &d.Name, &d.Metric, &d.TargetHours, &d.DocType,
+		&d.Active, &d.CreatedAt, &d.UpdatedAt)
+	d.Responsible = metrics[d.Metric]
+	return d, err
+}
+
+// List returns the SLAs a company is party to, or every SLA for company 0
+func List(companyID int, activeOnly bool) ([]Definition, error) {
+	rows, err := db.DB.Query(`SELECT `+definitionColumns+`
+		FROM partner_sla
+		WHERE ($1 = 0 OR supplier_company_id = $1 OR buyer_company_id = $1) AND (NOT $2 OR is_active = true)
+		ORDER BY id
+	`, companyID, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	definitions := []Definition{}
+	for rows.Next() {
+		d, err := scanDefinition(rows)
+		if err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, d)
+	}
+	return definitions, rows.Err()
+}
+
+// Between returns the SLAs of a partnership, in either direction
+func Between(companyID, partnerID int) ([]Definition, error) {
+	definitions, err := List(companyID, false)
+	if err != nil {
+		return nil, err
+	}
+	between := []Definition{}
+	for _, d := range definitions {
+		if d.SupplierCompanyID == partnerID || d.BuyerCompanyID == partnerID {
+			between = append(between, d)
+		}
+	}
+	return between, nil
+}
+
+// Get returns an SLA
+func Get(id int) (*Definition, error) {
+	d, err := scanDefinition(db.DB.QueryRow(`SELECT `+definitionColumns+` FROM partner_sla WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// checkCompanies rejects SLAs naming companies that do not exist
+func checkCompanies(d Definition) error {
+	var count int
+	if err := db.DB.QueryRow(`
+		SELECT COUNT(*) FROM company WHERE id IN ($1, $2)
+	`, d.SupplierCompanyID, d.BuyerCompanyID).Scan(&count); err != nil {
+		return err
+	}
+	if count != 2 {
+		return fmt.Errorf("%w: company not found", ErrInvalid)
+	}
+	return nil
+}
+
+// Create stores a new SLA
+func Create(d Definition, userID int) (*Definition, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkCompanies(d); err != nil {
+		return nil, err
+	}
+	created, err := scanDefinition(db.DB.QueryRow(`
+		INSERT INTO partner_sla (supplier_company_id, buyer_company_id, name, metric, target_hours, doc_type, is_active,
+			created_by, updated_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, NULLIF($8, 0), NULLIF($8, 0), NOW(), NOW())
+		RETURNING `+definitionColumns,
+		d.SupplierCompanyID, d.BuyerCompanyID, d.Name, d.Metric, d.TargetHours, d.DocType, d.Active, userID))
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Update replaces the terms of an SLA; the partners it binds cannot change
+func Update(d Definition, userID int) (*Definition, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	updated, err := scanDefinition(db.DB.QueryRow(`
+		UPDATE partner_sla
+		SET name = $2, metric = $3, target_hours = $4, doc_type = NULLIF($5, ''), is_active = $6,
+			updated_by = NULLIF($7, 0), updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+definitionColumns,
+		d.ID, d.Name, d.Metric, d.TargetHours, d.DocType, d.Active, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// Deactivate stops measuring an SLA; it is kept for the breaches recorded against it
+func Deactivate(id, userID int) error {
+	result, err := db.DB.Exec(`
+		UPDATE partner_sla SET is_active = false, updated_by = NULLIF($2, 0), updated_at = NOW() WHERE id = $1
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// fulfilment is the SQL selecting when each metric was met for a transfer st between supplier s and buyer r
+var fulfilment = map[string]string{
+	MetricTransferAcknowledged: `(
+		SELECT MIN(e.timestamp) FROM event e JOIN account a ON a.id = e.actor_id
+		WHERE e.batch_id = st.batch_id AND e.event_type = 'batch_transfer_status_changed'
+			AND e.timestamp >= st.created_at AND a.company_id = r.company_id
+	)`,
+	MetricTransferCompleted: `st.completed_at`,
+	MetricDocumentUploaded: `(
+		SELECT MIN(d.uploaded_at) FROM document d
+		WHERE d.batch_id = st.batch_id AND LOWER(d.doc_type) = LOWER($5) AND d.uploaded_at >= st.created_at
+	)`,
+}
+
+// Measure evaluates an SLA on the transfers from its supplier to its buyer created between from and to, as of now
+func Measure(d Definition, from, to, now time.Time) ([]Measurement, error) {
+	fulfilled, ok := fulfilment[d.Metric]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown metric %q", ErrInvalid, d.Metric)
+	}
+	args := []interface{}{d.SupplierCompanyID, d.BuyerCompanyID, from, to}
+	if d.Metric == MetricDocumentUploaded {
+		args = append(args, d.DocType)
+	}
+	rows, err := db.DB.Query(`
+		SELECT st.id, st.batch_id, st.created_at, `+fulfilled+`
+		FROM shipment_transfer st
+		JOIN account s ON s.id = st.sender_id
+		JOIN account r ON r.id = st.receiver_id
+		WHERE s.company_id = $1 AND r.company_id = $2 AND st.is_active = true
+			AND st.created_at >= $3 AND st.created_at < $4
+		ORDER BY st.created_at, st.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	target := time.Duration(d.TargetHours) * time.Hour
+	measurements := []Measurement{}
+	for rows.Next() {
+		var m Measurement
+		var fulfilledAt sql.NullTime
+		if err := rows.Scan(&m.TransferID, &m.BatchID, &m.StartedAt, &fulfilledAt); err != nil {
+			return nil, err
+		}
+		m.DueAt = m.StartedAt.Add(target)
+		if fulfilledAt.Valid {
+			m.FulfilledAt = &fulfilledAt.Time
+		}
+		classify(&m, now)
+		measurements = append(measurements, m)
+	}
+	return measurements, rows.Err()
+}
+
+// Compliance summarizes an SLA over a period
+type Compliance struct {
+	SLA           Definition    `json:"sla"`
+	Transfers     int           `json:"transfers"`
+	Met           int           `json:"met"`
+	Breached      int           `json:"breached"`
+	Pending       int           `json:"pending"`
+	CompliancePct *float64      `json:"compliance_pct,omitempty"` // Met out of decided transfers, empty when none is decided
+	AvgHours      *float64      `json:"avg_hours,omitempty"`      // Mean time to fulfilment
+	MaxHours      *float64      `json:"max_hours,omitempty"`
+	Breaches      []Measurement `json:"breaches"`
+}
+
+// Summarize counts the measurements of an SLA
+func Summarize(d Definition, measurements []Measurement) Compliance {
+	c := Compliance{SLA: d, Transfers: len(measurements), Breaches: []Measurement{}}
+	var total float64
+	var timed int
+	for _, m := range measurements {
+		switch m.Status {
+		case StatusMet:
+			c.Met++
+		case StatusBreached:
+			c.Breached++
+			c.Breaches = append(c.Breaches, m)
+		default:
+			c.Pending++
+		}
+		if m.ElapsedHours != nil {
+			total += *m.ElapsedHours
+			timed++
+			if c.MaxHours == nil || *m.ElapsedHours > *c.MaxHours {
+				hours := *m.ElapsedHours
+				c.MaxHours = &hours
+			}
+		}
+	}
+	if decided := c.Met + c.Breached; decided > 0 {
+		pct := float64(c.Met) / float64(decided) * 100
+		c.CompliancePct = &pct
+	}
+	if timed > 0 {
+		avg := total / float64(timed)
+		c.AvgHours = &avg
+	}
+	return c
+}
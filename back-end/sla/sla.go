@@ -0,0 +1,246 @@
+package sla
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/notify"
+	"github.com/LTPPPP/TracePost-larvaeChain/webhooks"
+)
+
+// Metrics an SLA can measure on the transfers from the supplier to the buyer
+const (
+	// MetricTransferAcknowledged is met when a buyer account first changes the status of the transfer
+	MetricTransferAcknowledged = "transfer_acknowledged"
+	// MetricTransferCompleted is met when the transfer is completed
+	MetricTransferCompleted = "transfer_completed"
+	// MetricDocumentUploaded is met when a document of the SLA's type is uploaded for the transferred batch
+	MetricDocumentUploaded = "document_uploaded"
+)
+
+// Sides of a partnership an SLA binds
+const (
+	PartySupplier = "supplier"
+	PartyBuyer    = "buyer"
+)
+
+// Measurement statuses
+const (
+	StatusMet      = "met"
+	StatusBreached = "breached"
+	StatusPending  = "pending"
+)
+
+// WebhookEventBreached is the webhook event dispatched to both partners of a breached SLA
+const WebhookEventBreached = "sla_breached"
+
+var (
+	// ErrNotFound is returned for an SLA that does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid is returned for an SLA with missing or out of range fields
+	ErrInvalid = errors.New("invalid SLA")
+)
+
+// metrics maps each metric to the party responsible for meeting it
+var metrics = map[string]string{
+	MetricTransferAcknowledged: PartyBuyer,
+	MetricTransferCompleted:    PartySupplier,
+	MetricDocumentUploaded:     PartySupplier,
+}
+
+// Metrics lists the metrics an SLA can measure
+func Metrics() []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Definition is a service level two trading partners agreed on, measured on every transfer from the supplier to
+// the buyer from the time the transfer is created
+type Definition struct {
+	ID                int       `json:"id"`
+	SupplierCompanyID int       `json:"supplier_company_id"`
+	BuyerCompanyID    int       `json:"buyer_company_id"`
+	Name              string    `json:"name"`
+	Metric            string    `json:"metric"`
+	TargetHours       int       `json:"target_hours"`
+	DocType           string    `json:"doc_type,omitempty"` // Document type of document_uploaded SLAs, e.g. health_certificate
+	Responsible       string    `json:"responsible"`        // supplier or buyer, the party the metric binds
+	Active            bool      `json:"active"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// ResponsibleCompanyID is the company that must meet the SLA
+func (d Definition) ResponsibleCompanyID() int {
+	if d.Responsible == PartyBuyer {
+		return d.BuyerCompanyID
+	}
+	return d.SupplierCompanyID
+}
+
+// Measurement is an SLA measured on one transfer
+type Measurement struct {
+	TransferID   int        `json:"transfer_id"`
+	BatchID      int        `json:"batch_id"`
+	StartedAt    time.Time  `json:"started_at"`
+	DueAt        time.Time  `json:"due_at"`
+	FulfilledAt  *time.Time `json:"fulfilled_at,omitempty"`
+	ElapsedHours *float64   `json:"elapsed_hours,omitempty"` // Hours from start to fulfilment
+	Status       string     `json:"status"`
+}
+
+// Service measures the active SLAs on a schedule, recording each breach once and notifying both partners
+type Service struct {
+	Config   *config.Config
+	Interval time.Duration
+	// Lookback bounds the transfers measured by a run to those created within it
+	Lookback time.Duration
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates an SLA monitor from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		Config:   cfg,
+		Interval: time.Duration(cfg.SLAMonitorIntervalSeconds) * time.Second,
+		Lookback: time.Duration(cfg.SLAMonitorLookbackDays) * 24 * time.Hour,
+	}
+}
+
+// Default returns the process wide SLA monitor
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Start measures the SLAs in the background, right away and then every interval
+func (s *Service) Start() {
+	go func() {
+		for {
+			if _, err := s.RunOnce(); err != nil {
+				fmt.Printf("Warning: SLA monitor run failed: %v\n", err)
+			}
+			time.Sleep(s.Interval)
+		}
+	}()
+}
+
+// Breach is a transfer on which an SLA was missed
+type Breach struct {
+	ID          int        `json:"id"`
+	SLAID       int        `json:"sla_id"`
+	TransferID  int        `json:"transfer_id"`
+	DueAt       time.Time  `json:"due_at"`
+	FulfilledAt *time.Time `json:"fulfilled_at,omitempty"` // Empty while the SLA is still unmet
+	DetectedAt  time.Time  `json:"detected_at"`
+}
+
+// RunOnce measures every active SLA on the recent transfers and returns the breaches found for the first time
+func (s *Service) RunOnce() ([]Breach, error) {
+	definitions, err := List(0, true)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	breaches := []Breach{}
+	for _, d := range definitions {
+		measurements, err := Measure(d, now.Add(-s.Lookback), now, now)
+		if err != nil {
+			fmt.Printf("Warning: failed to measure SLA %d: %v\n", d.ID, err)
+			continue
+		}
+		for _, m := range measurements {
+			if m.Status != StatusBreached {
+				continue
+			}
+			breach, err := record(d, m)
+			if err != nil {
+				fmt.Printf("Warning: failed to record breach of SLA %d on transfer %d: %v\n", d.ID, m.TransferID, err)
+				continue
+			}
+			if breach != nil {
+				s.notify(d, *breach)
+				breaches = append(breaches, *breach)
+			}
+		}
+	}
+	return breaches, nil
+}
+
+// record stores a breach, returning nil when it was already recorded
+func record(d Definition, m Measurement) (*Breach, error) {
+	var b Breach
+	err := db.DB.QueryRow(`
+		INSERT INTO partner_sla_breach (sla_id, transfer_id, due_at, fulfilled_at, detected_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (sla_id, transfer_id) DO NOTHING
+		RETURNING id, detected_at
+	`, d.ID, m.TransferID, m.DueAt, m.FulfilledAt).Scan(&b.ID, &b.DetectedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	b.SLAID, b.TransferID, b.DueAt, b.FulfilledAt = d.ID, m.TransferID, m.DueAt, m.FulfilledAt
+	return &b, nil
+}
+
+// notify alerts both partners of a breach through their notification connectors and webhooks
+func (s *Service) notify(d Definition, b Breach) {
+	data := map[string]interface{}{
+		"sla_id":                 d.ID,
+		"sla_name":               d.Name,
+		"metric":                 d.Metric,
+		"target_hours":           d.TargetHours,
+		"transfer_id":            b.TransferID,
+		"due_at":                 b.DueAt,
+		"fulfilled_at":           b.FulfilledAt,
+		"supplier_company_id":    d.SupplierCompanyID,
+		"buyer_company_id":       d.BuyerCompanyID,
+		"responsible":            d.Responsible,
+		"responsible_company_id": d.ResponsibleCompanyID(),
+	}
+	for _, companyID := range []int{d.SupplierCompanyID, d.BuyerCompanyID} {
+		if err := notify.Notify(companyID, notify.AlertSLABreached, data); err != nil {
+			fmt.Printf("Warning: failed to notify company %d of SLA breach %d: %v\n", companyID, b.ID, err)
+		}
+		if err := webhooks.Dispatch(companyID, WebhookEventBreached, data); err != nil {
+			fmt.Printf("Warning: failed to dispatch SLA breach %d to company %d: %v\n", b.ID, companyID, err)
+		}
+	}
+}
+
+// classify decides the status of a measurement at a point in time
+func classify(m *Measurement, now time.Time) {
+	switch {
+	case m.FulfilledAt != nil:
+		hours := m.FulfilledAt.Sub(m.StartedAt).Hours()
+		m.ElapsedHours = &hours
+		if m.FulfilledAt.After(m.DueAt) {
+			m.Status = StatusBreached
+		} else {
+			m.Status = StatusMet
+		}
+	case now.After(m.DueAt):
+		m.Status = StatusBreached
+	default:
+		m.Status = StatusPending
+	}
+}
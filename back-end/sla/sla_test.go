@@ -0,0 +1,81 @@
+package sla
+
+import (
+	"testing"
+	"time"
+)
+
+func measurement(start time.Time, target time.Duration, fulfilled *time.Time, now time.Time) Measurement {
+	m := Measurement{StartedAt: start, DueAt: start.Add(target), FulfilledAt: fulfilled}
+	classify(&m, now)
+	return m
+}
+
+func TestClassify(t *testing.T) {
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	early := start.Add(10 * time.Hour)
+	late := start.Add(30 * time.Hour)
+
+	if m := measurement(start, 24*time.Hour, &early, late); m.Status != StatusMet || *m.ElapsedHours != 10 {
+		t.Errorf("fulfilled in time = %s after %v, want met after 10", m.Status, *m.ElapsedHours)
+	}
+	if m := measurement(start, 24*time.Hour, &late, late); m.Status != StatusBreached {
+		t.Errorf("fulfilled late = %s, want breached", m.Status)
+	}
+	if m := measurement(start, 24*time.Hour, nil, early); m.Status != StatusPending {
+		t.Errorf("unfulfilled before the deadline = %s, want pending", m.Status)
+	}
+	if m := measurement(start, 24*time.Hour, nil, late); m.Status != StatusBreached || m.ElapsedHours != nil {
+		t.Errorf("unfulfilled after the deadline = %s, want breached without elapsed hours", m.Status)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	now := start.Add(48 * time.Hour)
+	at := func(hours int) *time.Time {
+		t := start.Add(time.Duration(hours) * time.Hour)
+		return &t
+	}
+	c := Summarize(Definition{ID: 1}, []Measurement{
+		measurement(start, 24*time.Hour, at(4), now),
+		measurement(start, 24*time.Hour, at(20), now),
+		measurement(start, 24*time.Hour, at(36), now),
+		measurement(start, 24*time.Hour, nil, now),
+		measurement(now.Add(-time.Hour), 24*time.Hour, nil, now),
+	})
+
+	if c.Transfers != 5 || c.Met != 2 || c.Breached != 2 || c.Pending != 1 || len(c.Breaches) != 2 {
+		t.Fatalf("counts = %+v", c)
+	}
+	if *c.CompliancePct != 50 {
+		t.Errorf("compliance = %v, want 50", *c.CompliancePct)
+	}
+	if *c.AvgHours != 20 || *c.MaxHours != 36 {
+		t.Errorf("avg, max = %v, %v, want 20, 36", *c.AvgHours, *c.MaxHours)
+	}
+	if empty := Summarize(Definition{}, nil); empty.CompliancePct != nil || empty.AvgHours != nil {
+		t.Error("an SLA without decided transfers should have no compliance or timing")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	d := Definition{SupplierCompanyID: 1, BuyerCompanyID: 2, Name: " Acknowledge ", Metric: MetricTransferAcknowledged, TargetHours: 24, DocType: "ignored"}
+	if err := d.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Responsible != PartyBuyer || d.Name != "Acknowledge" || d.DocType != "" {
+		t.Errorf("normalized = %+v", d)
+	}
+
+	for _, bad := range []Definition{
+		{SupplierCompanyID: 1, BuyerCompanyID: 1, Name: "x", Metric: MetricTransferCompleted, TargetHours: 24},
+		{SupplierCompanyID: 1, BuyerCompanyID: 2, Name: "x", Metric: "shipped", TargetHours: 24},
+		{SupplierCompanyID: 1, BuyerCompanyID: 2, Name: "x", Metric: MetricDocumentUploaded, TargetHours: 48},
+		{SupplierCompanyID: 1, BuyerCompanyID: 2, Name: "x", Metric: MetricTransferCompleted, TargetHours: 0},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package stages
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Phase is a larval phase of penaeid shrimp
+type Phase string
+
+// Larval phases, in the order a batch goes through them
+const (
+	Nauplius  Phase = "nauplius"
+	Zoea      Phase = "zoea"
+	Mysis     Phase = "mysis"
+	Postlarva Phase = "postlarva"
+)
+
+// PhaseInfo is what a phase looks like in the hatchery
+type PhaseInfo struct {
+	Phase     Phase   `json:"phase"`
+	Code      string  `json:"code"`
+	Substages int     `json:"substages"` // Number of substages, 0 for postlarvae which are counted in days
+	MinDays   float64 `json:"min_days"`  // Shortest plausible time in the phase
+	MaxDays   float64 `json:"max_days"`  // Longest typical time in the phase; longer stays are flagged, not rejected
+}
+
+// Phases lists the phases in order with their typical durations for P. vannamei and P. monodon
+// hatcheries; a postlarva gains one PL day per day
+var Phases = []PhaseInfo{
+	{Phase: Nauplius, Code: "N", Substages: 6, MinDays: 1, MaxDays: 3},
+	{Phase: Zoea, Code: "Z", Substages: 3, MinDays: 3, MaxDays: 7},
+	{Phase: Mysis, Code: "M", Substages: 3, MinDays: 2, MaxDays: 5},
+	{Phase: Postlarva, Code: "PL"},
+}
+
+// Tolerance absorbs the delay between a molt and the event recording it
+const Tolerance = 12 * time.Hour
+
+// plSlack is how many days a PL count may run behind the calendar before it is flagged
+const plSlack = 2
+
+// Stage is a phase with an optional substage, e.g. Z2 or PL12; substage 0 means the phase is known
+// but not the substage
+type Stage struct {
+	Phase    Phase
+	Substage int
+}
+
+var stagePattern = regexp.MustCompile(`^(nauplius|nauplii|zoea|mysis|postlarvae?|pl|n|z|m)[\s\-_]*(\d*)$`)
+
+// Parse reads a stage such as "N3", "zoea 2", "Mysis", "PL-12" or "postlarva 5"
+func Parse(s string) (Stage, error) {
+	m := stagePattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return Stage{}, fmt.Errorf("unknown larval stage %q", s)
+	}
+	var stage Stage
+	switch m[1] {
+	case "nauplius", "nauplii", "n":
+		stage.Phase = Nauplius
+	case "zoea", "z":
+		stage.Phase = Zoea
+	case "mysis", "m":
+		stage.Phase = Mysis
+	default:
+		stage.Phase = Postlarva
+	}
+	if m[2] != "" {
+		stage.Substage, _ = strconv.Atoi(m[2])
+		info := stage.Info()
+		if stage.Substage < 1 || info.Substages > 0 && stage.Substage > info.Substages {
+			return Stage{}, fmt.Errorf("%s has no substage %d", info.Phase, stage.Substage)
+		}
+	}
+	return stage, nil
+}
+
+// Info is the phase description of a stage
+func (s Stage) Info() PhaseInfo {
+	return Phases[s.index()]
+}
+
+func (s Stage) index() int {
+	for i, info := range Phases {
+		if info.Phase == s.Phase {
+			return i
+		}
+	}
+	return 0
+}
+
+// String is the short notation of a stage, e.g. N3, Z, PL12
+func (s Stage) String() string {
+	if s.Substage == 0 {
+		return s.Info().Code
+	}
+	return s.Info().Code + strconv.Itoa(s.Substage)
+}
+
+// Compare orders stages by development; a stage without a substage sorts before the substages of its
+// phase
+func (s Stage) Compare(o Stage) int {
+	if si, oi := s.index(), o.index(); si != oi {
+		return si - oi
+	}
+	return s.Substage - o.Substage
+}
+
+// earliestDay is the fewest days after hatching a batch can reach a stage
+func (s Stage) earliestDay() float64 {
+	day := 0.0
+	for _, info := range Phases[:s.index()] {
+		day += info.MinDays
+	}
+	info := s.Info()
+	switch {
+	case s.Substage == 0:
+	case info.Substages > 0:
+		day += info.MinDays * float64(s.Substage-1) / float64(info.Substages)
+	default:
+		day += float64(s.Substage - 1)
+	}
+	return day
+}
+
+// MinDuration is the shortest plausible time for a batch to develop from one stage to another
+func MinDuration(from, to Stage) time.Duration {
+	d := to.earliestDay() - from.earliestDay()
+	if d <= 0 {
+		return 0
+	}
+	return days(d)
+}
+
+// Observation is a stage a batch was recorded at
+type Observation struct {
+	EventID    int
+	Stage      Stage
+	RecordedAt time.Time
+}
+
+// ProgressionError is an implausible change of stage
+type ProgressionError struct {
+	From    Stage
+	To      Stage
+	Elapsed time.Duration
+	Min     time.Duration
+}
+
+func (e *ProgressionError) Error() string {
+	if e.To.Compare(e.From) < 0 {
+		return fmt.Sprintf("stage %s cannot follow %s: larvae do not go back to an earlier stage", e.To, e.From)
+	}
+	return fmt.Sprintf("stage %s %s after %s is too fast: it takes at least %s", e.To, formatDuration(e.Elapsed), e.From, formatDuration(e.Min))
+}
+
+// Check validates a stage recorded at a time against the latest earlier observation
+func Check(prev Observation, next Stage, at time.Time) error {
+	// A stage without substage repeats the phase it names, e.g. "zoea" after Z2
+	if next.Phase == prev.Stage.Phase && (next.Substage == 0 || prev.Stage.Substage == 0) {
+		return nil
+	}
+	if next.Compare(prev.Stage) < 0 {
+		return &ProgressionError{From: prev.Stage, To: next}
+	}
+	elapsed := at.Sub(prev.RecordedAt)
+	if min := MinDuration(prev.Stage, next); elapsed+Tolerance < min {
+		return &ProgressionError{From: prev.Stage, To: next, Elapsed: elapsed, Min: min}
+	}
+	return nil
+}
+
+func formatDuration(d time.Duration) string {
+	if d < 48*time.Hour {
+		return fmt.Sprintf("%.0f hours", d.Hours())
+	}
+	return fmt.Sprintf("%.1f days", d.Hours()/24)
+}
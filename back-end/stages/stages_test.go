@@ -0,0 +1,77 @@
+package stages
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, s string) Stage {
+	t.Helper()
+	stage, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stage
+}
+
+func TestParse(t *testing.T) {
+	for input, want := range map[string]string{"N3": "N3", "zoea 2": "Z2", "Mysis": "M", "PL-12": "PL12", "postlarva 5": "PL5"} {
+		if got := mustParse(t, input).String(); got != want {
+			t.Errorf("Parse(%q) = %s, want %s", input, got, want)
+		}
+	}
+	for _, input := range []string{"Z4", "N0", "juvenile", ""} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) should fail", input)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	prev := Observation{Stage: mustParse(t, "Z1"), RecordedAt: start}
+
+	if err := Check(prev, mustParse(t, "N6"), start.Add(24*time.Hour)); err == nil {
+		t.Error("going back to nauplius should fail")
+	}
+	if err := Check(prev, mustParse(t, "M1"), start.Add(24*time.Hour)); err == nil {
+		t.Error("zoea to mysis in a day should fail")
+	}
+	if err := Check(prev, mustParse(t, "M1"), start.Add(4*24*time.Hour)); err != nil {
+		t.Errorf("zoea to mysis in four days should pass: %v", err)
+	}
+	if err := Check(prev, mustParse(t, "zoea"), start.Add(time.Hour)); err != nil {
+		t.Errorf("repeating the phase should pass: %v", err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	timeline := Build([]Observation{
+		{EventID: 1, Stage: mustParse(t, "N1"), RecordedAt: start},
+		{EventID: 2, Stage: mustParse(t, "Z1"), RecordedAt: start.Add(2 * day)},
+		{EventID: 3, Stage: mustParse(t, "M1"), RecordedAt: start.Add(12 * day)},
+		{EventID: 4, Stage: mustParse(t, "Z3"), RecordedAt: start.Add(13 * day)},
+		{EventID: 5, Stage: mustParse(t, "PL1"), RecordedAt: start.Add(15 * day)},
+	}, start.Add(16*day))
+
+	if timeline.Current != "PL1" || len(timeline.Entries) != 4 {
+		t.Fatalf("unexpected timeline %+v", timeline)
+	}
+	if timeline.Entries[1].DurationHours != 240 {
+		t.Errorf("zoea lasted %.0f hours, want 240", timeline.Entries[1].DurationHours)
+	}
+	if len(timeline.Warnings) != 2 || !strings.HasPrefix(timeline.Warnings[0], "Event 4") || !strings.HasPrefix(timeline.Warnings[1], "zoea lasted") {
+		t.Errorf("unexpected warnings %q", timeline.Warnings)
+	}
+	if timeline.Next == nil || timeline.Next.Stage != "PL2" || !timeline.Next.Earliest.Equal(start.Add(16*day)) {
+		t.Errorf("unexpected forecast %+v", timeline.Next)
+	}
+
+	target := ForecastStage(timeline, mustParse(t, "PL12"))
+	if target == nil || !target.Earliest.Equal(start.Add(26*day)) || !target.Latest.Equal(start.Add(28*day)) {
+		t.Errorf("unexpected PL12 forecast %+v", target)
+	}
+}
@@ -0,0 +1,173 @@
+package stages
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Entry is a stage on the timeline of a batch, from its first observation to the next stage
+type Entry struct {
+	Stage         string     `json:"stage"`
+	Phase         Phase      `json:"phase"`
+	EventID       int        `json:"event_id"`
+	StartedAt     time.Time  `json:"started_at"`
+	EndedAt       *time.Time `json:"ended_at,omitempty"`
+	DurationHours float64    `json:"duration_hours"`
+}
+
+// Forecast is when a batch is expected to reach a stage
+type Forecast struct {
+	Stage    string    `json:"stage"`
+	Earliest time.Time `json:"earliest"`
+	Latest   time.Time `json:"latest"`
+}
+
+// Timeline is the stage history of a batch
+type Timeline struct {
+	Current  string    `json:"current,omitempty"`
+	Entries  []Entry   `json:"entries"`
+	Next     *Forecast `json:"next,omitempty"`
+	Warnings []string  `json:"warnings"`
+}
+
+// Build turns the stage observations of a batch into a timeline as of now, flagging phases that lasted
+// longer than is typical and changes of stage that are implausible
+func Build(observations []Observation, now time.Time) Timeline {
+	sorted := append([]Observation(nil), observations...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].RecordedAt.Before(sorted[j].RecordedAt) })
+
+	timeline := Timeline{Entries: []Entry{}, Warnings: []string{}}
+	var last *Observation
+	for i := range sorted {
+		obs := sorted[i]
+		if last != nil {
+			if err := Check(*last, obs.Stage, obs.RecordedAt); err != nil {
+				timeline.Warnings = append(timeline.Warnings, fmt.Sprintf("Event %d: %s", obs.EventID, err))
+				if obs.Stage.Compare(last.Stage) < 0 {
+					continue
+				}
+			}
+			if obs.Stage.Compare(last.Stage) <= 0 || obs.Stage.Phase == last.Stage.Phase && obs.Stage.Substage == 0 {
+				continue
+			}
+		}
+		timeline.Entries = append(timeline.Entries, Entry{
+			Stage:     obs.Stage.String(),
+			Phase:     obs.Stage.Phase,
+			EventID:   obs.EventID,
+			StartedAt: obs.RecordedAt,
+		})
+		last = &sorted[i]
+	}
+
+	for i := range timeline.Entries {
+		end := now
+		if i+1 < len(timeline.Entries) {
+			end = timeline.Entries[i+1].StartedAt
+			timeline.Entries[i].EndedAt = &end
+		}
+		timeline.Entries[i].DurationHours = end.Sub(timeline.Entries[i].StartedAt).Hours()
+	}
+	timeline.Warnings = append(timeline.Warnings, longStays(timeline.Entries, now)...)
+
+	if last != nil {
+		timeline.Current = last.Stage.String()
+		timeline.Next = forecastNext(last.Stage, timeline.Entries)
+	}
+	return timeline
+}
+
+// phaseStart is when the batch entered the phase of its latest stage
+func phaseStart(entries []Entry) time.Time {
+	start := entries[len(entries)-1]
+	for i := len(entries) - 1; i >= 0 && entries[i].Phase == start.Phase; i-- {
+		start = entries[i]
+	}
+	return start.StartedAt
+}
+
+// longStays flags phases the batch stayed in longer than is typical, and PL counts that run behind the
+// calendar
+func longStays(entries []Entry, now time.Time) []string {
+	warnings := []string{}
+	for i := 0; i < len(entries); {
+		j := i
+		for j+1 < len(entries) && entries[j+1].Phase == entries[i].Phase {
+			j++
+		}
+		start, end := entries[i].StartedAt, now
+		if j+1 < len(entries) {
+			end = entries[j+1].StartedAt
+		}
+		stayed := end.Sub(start).Hours() / 24
+		info := Stage{Phase: entries[i].Phase}.Info()
+		if info.MaxDays > 0 && stayed > info.MaxDays {
+			warnings = append(warnings, fmt.Sprintf("%s lasted %.1f days, longer than the typical %.0f-%.0f days", info.Phase, stayed, info.MinDays, info.MaxDays))
+		}
+		if info.Phase == Postlarva && j > i {
+			first, _ := Parse(entries[i].Stage)
+			latest, _ := Parse(entries[j].Stage)
+			elapsed := entries[j].StartedAt.Sub(start).Hours() / 24
+			if first.Substage > 0 && float64(latest.Substage-first.Substage)+plSlack < elapsed {
+				warnings = append(warnings, fmt.Sprintf("%s was recorded %.1f days after %s; the PL count may be behind", entries[j].Stage, elapsed, entries[i].Stage))
+			}
+		}
+		i = j + 1
+	}
+	return warnings
+}
+
+// forecastNext estimates when a batch at a stage reaches the next phase or, for postlarvae, the next
+// PL day
+func forecastNext(current Stage, entries []Entry) *Forecast {
+	info := current.Info()
+	if info.Phase == Postlarva {
+		if current.Substage == 0 {
+			return nil
+		}
+		next := Stage{Phase: Postlarva, Substage: current.Substage + 1}
+		at := entries[len(entries)-1].StartedAt.Add(days(1))
+		return &Forecast{Stage: next.String(), Earliest: at, Latest: at.Add(days(plSlack))}
+	}
+	since := phaseStart(entries)
+	next := Stage{Phase: Phases[current.index()+1].Phase}
+	if next.Phase == Postlarva {
+		next.Substage = 1
+	}
+	return &Forecast{
+		Stage:    next.String(),
+		Earliest: since.Add(days(info.MinDays)),
+		Latest:   since.Add(days(info.MaxDays)),
+	}
+}
+
+// ForecastStage estimates when a batch with a timeline reaches a later stage, e.g. the PL stage it is
+// sold at; it returns nil when the batch has no stage yet or is already past the target
+func ForecastStage(timeline Timeline, target Stage) *Forecast {
+	if len(timeline.Entries) == 0 {
+		return nil
+	}
+	last := timeline.Entries[len(timeline.Entries)-1]
+	current, err := Parse(last.Stage)
+	if err != nil || target.Compare(current) < 0 {
+		return nil
+	}
+	earliest := last.StartedAt.Add(MinDuration(current, target))
+	latest := last.StartedAt
+	for _, info := range Phases[current.index():target.index()] {
+		latest = latest.Add(days(info.MaxDays))
+	}
+	if target.Phase == Postlarva && target.Substage > 0 {
+		from := 1
+		if current.Phase == Postlarva && current.Substage > 0 {
+			from = current.Substage
+		}
+		latest = latest.Add(days(float64(target.Substage-from) + plSlack))
+	}
+	return &Forecast{Stage: target.String(), Earliest: earliest, Latest: latest}
+}
+
+func days(n float64) time.Duration {
+	return time.Duration(n * float64(24*time.Hour))
+}
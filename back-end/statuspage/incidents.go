@@ -0,0 +1,211 @@
+package statuspage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Incident statuses; an incident is resolved once its status is resolved
+const (
+	IncidentInvestigating = "investigating"
+	IncidentIdentified    = "identified"
+	IncidentMonitoring    = "monitoring"
+	IncidentResolved      = "resolved"
+)
+
+// Incident impacts
+const (
+	ImpactMinor    = "minor"    // the affected components are degraded
+	ImpactMajor    = "major"    // the affected components are degraded for most users
+	ImpactCritical = "critical" // the affected components are down
+)
+
+// impactStatus is the component status an unresolved incident of an impact implies
+var impactStatus = map[string]string{
+	ImpactMinor:    StatusDegraded,
+	ImpactMajor:    StatusDegraded,
+	ImpactCritical: StatusOutage,
+}
+
+var (
+	// ErrNotFound is returned for an incident that does not exist
+	ErrNotFound = errors.New("incident not found")
+	// ErrInvalidIncident is returned for an incident with missing or unknown fields
+	ErrInvalidIncident = errors.New("invalid incident")
+)
+
+// Incident is an annotation of the status page, written by admins
+type Incident struct {
+	ID         int        `json:"id"`
+	Title      string     `json:"title"`
+	Message    string     `json:"message"`
+	Status     string     `json:"status"`     // investigating, identified, monitoring or resolved
+	Impact     string     `json:"impact"`     // minor, major or critical
+	Components []string   `json:"components"` // Affected component IDs
+	StartedAt  time.Time  `json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Validate normalizes an incident and checks its fields
+func (i *Incident) Validate() error {
+	i.Title = strings.TrimSpace(i.Title)
+	i.Message = strings.TrimSpace(i.Message)
+	if i.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidIncident)
+	}
+	if i.Status == "" {
+		i.Status = IncidentInvestigating
+	}
+	switch i.Status {
+	case IncidentInvestigating, IncidentIdentified, IncidentMonitoring, IncidentResolved:
+	default:
+		return fmt.Errorf("%w: status must be investigating, identified, monitoring or resolved", ErrInvalidIncident)
+	}
+	if i.Impact == "" {
+		i.Impact = ImpactMinor
+	}
+	if _, ok := impactStatus[i.Impact]; !ok {
+		return fmt.Errorf("%w: impact must be minor, major or critical", ErrInvalidIncident)
+	}
+	if len(i.Components) == 0 {
+		return fmt.Errorf("%w: at least one component is required", ErrInvalidIncident)
+	}
+	for _, component := range i.Components {
+		if !containsComponent(Components, component) {
+			return fmt.Errorf("%w: unknown component %s, use one of %s", ErrInvalidIncident, component, strings.Join(Components, ", "))
+		}
+	}
+	return nil
+}
+
+const incidentColumns = `
+	id, title, COALESCE(message, ''), status, impact, components, started_at, resolved_at, created_at, updated_at
+`
+
+// scanIncident reads an incident selected with incidentColumns
+func scanIncident(row interface{ Scan(...interface{}) error }) (Incident, error) {
+	var i Incident
+	err := row.Scan(&i.ID, &i.Title, &i.Message, &i.Status, &i.Impact, pq.Array(&i.Components),
+		&i.StartedAt, &i.ResolvedAt, &i.CreatedAt, &i.UpdatedAt)
+	return i, err
+}
+
+// queryIncidents runs a query selecting incidentColumns
+func queryIncidents(query string, args ...interface{}) ([]Incident, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	incidents := []Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, incident)
+	}
+	return incidents, rows.Err()
+}
+
+// Recent returns the unresolved incidents and those resolved in the last days, latest first
+func Recent(days int) ([]Incident, error) {
+	return queryIncidents(`SELECT `+incidentColumns+`
+		FROM status_incident
+		WHERE resolved_at IS NULL OR resolved_at >= $1
+		ORDER BY started_at DESC, id DESC
+	`, time.Now().AddDate(0, 0, -days))
+}
+
+// List returns incidents that started in a period, latest first
+func List(from, to time.Time) ([]Incident, error) {
+	return queryIncidents(`SELECT `+incidentColumns+`
+		FROM status_incident
+		WHERE started_at BETWEEN $1 AND $2
+		ORDER BY started_at DESC, id DESC
+	`, from, to)
+}
+
+// Get returns an incident
+func Get(id int) (*Incident, error) {
+	incident, err := scanIncident(db.DB.QueryRow(`SELECT `+incidentColumns+` FROM status_incident WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &incident, nil
+}
+
+// Create records an incident; it starts now unless a start time is given
+func Create(i Incident, userID int) (*Incident, error) {
+	if err := i.Validate(); err != nil {
+		return nil, err
+	}
+	if i.StartedAt.IsZero() {
+		i.StartedAt = time.Now()
+	}
+	created, err := scanIncident(db.DB.QueryRow(`
+		INSERT INTO status_incident (title, message, status, impact, components, started_at, resolved_at, created_by, updated_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CASE WHEN $3 = 'resolved' THEN NOW() END, NULLIF($7, 0), NULLIF($7, 0), NOW(), NOW())
+		RETURNING `+incidentColumns,
+		i.Title, i.Message, i.Status, i.Impact, pq.Array(i.Components), i.StartedAt, userID))
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Update replaces the fields of an incident. Setting the status to resolved stamps the resolution time,
+// reopening it clears it
+func Update(id int, i Incident, userID int) (*Incident, error) {
+	if err := i.Validate(); err != nil {
+		return nil, err
+	}
+	updated, err := scanIncident(db.DB.QueryRow(`
+		UPDATE status_incident
+		SET title = $2, message = $3, status = $4, impact = $5, components = $6,
+			started_at = COALESCE($7, started_at),
+			resolved_at = CASE WHEN $4 <> 'resolved' THEN NULL ELSE COALESCE(resolved_at, NOW()) END,
+			updated_by = NULLIF($8, 0), updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+incidentColumns,
+		id, i.Title, i.Message, i.Status, i.Impact, pq.Array(i.Components), nullTime(i.StartedAt), userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// Delete removes an incident posted by mistake
+func Delete(id int) error {
+	result, err := db.DB.Exec("DELETE FROM status_incident WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// nullTime is nil for the zero time
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,258 @@
+package statuspage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/nodehealth"
+)
+
+// Platform components shown on the status page
+const (
+	ComponentAPI       = "api"
+	ComponentDatabase  = "database"
+	ComponentIPFS      = "ipfs"
+	ComponentAnchoring = "anchoring"
+	ComponentInterop   = "interop"
+)
+
+// Components lists the platform components in the order they are shown
+var Components = []string{ComponentAPI, ComponentDatabase, ComponentIPFS, ComponentAnchoring, ComponentInterop}
+
+var componentNames = map[string]string{
+	ComponentAPI:       "API",
+	ComponentDatabase:  "Database",
+	ComponentIPFS:      "IPFS pinning",
+	ComponentAnchoring: "Blockchain anchoring",
+	ComponentInterop:   "Interoperability relayer",
+}
+
+// Statuses of a component, from best to worst
+const (
+	StatusOperational = "operational"
+	StatusDegraded    = "degraded"
+	StatusOutage      = "outage"
+)
+
+var statusRank = map[string]int{StatusOperational: 0, StatusDegraded: 1, StatusOutage: 2}
+
+// worse returns the worse of two statuses
+func worse(a, b string) string {
+	if statusRank[b] > statusRank[a] {
+		return b
+	}
+	return a
+}
+
+// Component is the state of one platform component
+type Component struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`            // operational, degraded or outage
+	Message     string    `json:"message,omitempty"` // Why the component is not operational
+	IncidentIDs []int     `json:"incident_ids"`      // Unresolved incidents affecting the component
+	CheckedAt   time.Time `json:"checked_at"`
+}
+
+// Status is the state of the platform with the incidents of the last days
+type Status struct {
+	Status     string      `json:"status"` // The worst status of any component
+	Components []Component `json:"components"`
+	Incidents  []Incident  `json:"incidents"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// Service checks the platform components, caching the result so the public page cannot load the backends
+type Service struct {
+	Config *config.Config
+	Client *http.Client
+	// CacheTTL is how long component checks are reused
+	CacheTTL time.Duration
+	// IncidentDays is how long resolved incidents stay on the page
+	IncidentDays int
+	// StuckAnchorAfter is how long a blockchain record may stay pending before anchoring is degraded
+	StuckAnchorAfter time.Duration
+
+	mu        sync.Mutex
+	checked   []Component
+	checkedAt time.Time
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates a status checker from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		Config:           cfg,
+		Client:           &http.Client{Timeout: 5 * time.Second},
+		CacheTTL:         30 * time.Second,
+		IncidentDays:     7,
+		StuckAnchorAfter: time.Hour,
+	}
+}
+
+// Default returns the process wide status checker
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Status returns the state of every component, worsened by the unresolved incidents affecting it, and the
+// incidents of the last IncidentDays
+func (s *Service) Status() (*Status, error) {
+	components := s.components()
+	incidents, err := Recent(s.IncidentDays)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Status: StatusOperational, Components: components, Incidents: incidents, UpdatedAt: time.Now()}
+	for i := range status.Components {
+		component := &status.Components[i]
+		component.IncidentIDs = []int{}
+		for _, incident := range incidents {
+			if incident.ResolvedAt == nil && containsComponent(incident.Components, component.ID) {
+				component.IncidentIDs = append(component.IncidentIDs, incident.ID)
+				component.Status = worse(component.Status, impactStatus[incident.Impact])
+			}
+		}
+		status.Status = worse(status.Status, component.Status)
+	}
+	return status, nil
+}
+
+// components returns the cached component checks, checking again once they are older than CacheTTL
+func (s *Service) components() []Component {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checked == nil || time.Since(s.checkedAt) > s.CacheTTL {
+		s.checked = s.check()
+		s.checkedAt = time.Now()
+	}
+	components := make([]Component, len(s.checked))
+	copy(components, s.checked)
+	return components
+}
+
+// check runs every component check concurrently
+func (s *Service) check() []Component {
+	checks := map[string]func() (string, string){
+		ComponentAPI:       func() (string, string) { return StatusOperational, "" },
+		ComponentDatabase:  s.checkDatabase,
+		ComponentIPFS:      s.checkIPFS,
+		ComponentAnchoring: s.checkAnchoring,
+		ComponentInterop:   s.checkInterop,
+	}
+	components := make([]Component, len(Components))
+	var wg sync.WaitGroup
+	for i, id := range Components {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			status, message := checks[id]()
+			components[i] = Component{ID: id, Name: componentNames[id], Status: status, Message: message, CheckedAt: time.Now()}
+		}(i, id)
+	}
+	wg.Wait()
+	return components
+}
+
+// checkDatabase pings the database
+func (s *Service) checkDatabase() (string, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if db.DB == nil || db.DB.PingContext(ctx) != nil {
+		return StatusOutage, "The database is not reachable"
+	}
+	return StatusOperational, ""
+}
+
+// checkIPFS asks the IPFS node for its version
+func (s *Service) checkIPFS() (string, string) {
+	url := strings.TrimRight(s.Config.IPFSNodeURL, "/") + "/api/v0/version"
+	resp, err := s.Client.Post(url, "application/json", nil)
+	if err != nil {
+		return StatusOutage, "The IPFS node is not reachable"
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return StatusDegraded, fmt.Sprintf("The IPFS node answered with status %d", resp.StatusCode)
+	}
+	return StatusOperational, ""
+}
+
+// checkAnchoring combines the blockchain node prober with records stuck waiting for confirmation
+func (s *Service) checkAnchoring() (string, string) {
+	nodes := nodehealth.Default().Status()
+	if nodes.AllDegraded {
+		return StatusOutage, "Every blockchain node is degraded"
+	}
+	status, messages := StatusOperational, []string{}
+	if nodes.ActiveNode != nodes.PrimaryNode {
+		status = StatusDegraded
+		messages = append(messages, "Transactions are sent to a fallback blockchain node")
+	}
+
+	var stuck int
+	err := db.DB.QueryRow(`
+		SELECT COUNT(*) FROM blockchain_record
+		WHERE is_active = true AND confirmation_status = 'pending' AND created_at < $1
+	`, time.Now().Add(-s.StuckAnchorAfter)).Scan(&stuck)
+	if err != nil {
+		return StatusDegraded, "Pending anchors could not be checked"
+	}
+	if stuck > 0 {
+		status = StatusDegraded
+		messages = append(messages, fmt.Sprintf("%d anchors have been waiting for confirmation for over %s", stuck, s.StuckAnchorAfter))
+	}
+	return status, strings.Join(messages, "; ")
+}
+
+// checkInterop looks for batch shares whose sync to another chain failed and unreachable registered chains
+func (s *Service) checkInterop() (string, string) {
+	var failed, retrying, unreachable int
+	err := db.DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM batch_share WHERE is_active = true AND sync_status = 'failed'),
+			(SELECT COUNT(*) FROM batch_share WHERE is_active = true AND sync_status = 'pending' AND failure_count > 0),
+			(SELECT COUNT(*) FROM chain_registry WHERE is_active = true AND probed_at IS NOT NULL AND reachable = false)
+	`).Scan(&failed, &retrying, &unreachable)
+	if err != nil {
+		return StatusDegraded, "Relayer state could not be checked"
+	}
+	messages := []string{}
+	if failed > 0 {
+		messages = append(messages, fmt.Sprintf("%d cross-chain syncs failed", failed))
+	}
+	if retrying > 0 {
+		messages = append(messages, fmt.Sprintf("%d cross-chain syncs are being retried", retrying))
+	}
+	if unreachable > 0 {
+		messages = append(messages, fmt.Sprintf("%d registered chains are unreachable", unreachable))
+	}
+	if len(messages) == 0 {
+		return StatusOperational, ""
+	}
+	return StatusDegraded, strings.Join(messages, "; ")
+}
+
+// containsComponent reports whether a list of component IDs holds id
+func containsComponent(components []string, id string) bool {
+	for _, c := range components {
+		if c == id {
+			return true
+		}
+	}
+	return false
+}
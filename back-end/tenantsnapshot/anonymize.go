@@ -0,0 +1,336 @@
+package tenantsnapshot
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// AnonymizeOptions controls how a snapshot is anonymized
+type AnonymizeOptions struct {
+	Key          []byte // Key the pseudonyms and the GPS shift derive from; a random one when empty, so runs cannot be linked
+	AccountEmail string // Email every referenced account becomes, so the rows restore owned by that account; unmatched when empty
+}
+
+// AnonymizeReport counts what anonymizing a snapshot changed. The GPS shift is left out, as it would undo it
+type AnonymizeReport struct {
+	Replaced      map[string]int `json:"replaced"`       // Values replaced, by table.column
+	ShiftedPoints int            `json:"shifted_points"` // Latitudes moved, each with its longitude
+	Accounts      int            `json:"accounts"`
+}
+
+// valueKind is how a value is anonymized
+type valueKind int
+
+const (
+	kindKeep  valueKind = iota
+	kindWords           // Names and free text: every word is replaced by a word of the same case
+	kindEmail           // Emails become addresses of example.com
+	kindCode            // Codes, hashes and identifiers keep their length and character classes
+	kindLatitude
+	kindLongitude
+)
+
+// keptNameTables are tables whose names are reference data rather than the customer's
+var keptNameTables = map[string]bool{
+	"environment_parameter": true,
+	"chain_registry":        true,
+	"subscription_plan":     true,
+	"data_migration":        true,
+	"nft_monitor_state":     true,
+}
+
+// pseudoWords are the words names and text are rewritten with
+var pseudoWords = []string{
+	"amber", "bay", "birch", "blue", "brook", "cedar", "cliff", "coral", "cove", "crest", "delta", "dune",
+	"east", "fern", "field", "glen", "harbor", "haven", "heron", "hill", "isle", "jade", "lagoon", "lake",
+	"lotus", "maple", "marsh", "meadow", "mist", "north", "oak", "ocean", "pearl", "pine", "point", "reef",
+	"ridge", "river", "rock", "sage", "sand", "shore", "silver", "south", "spring", "star", "stone", "summit",
+	"tide", "valley", "vista", "wave", "west", "willow", "wind", "harvest", "tern", "kelp", "salt", "moss",
+	"gull", "pond", "creek", "bloom",
+}
+
+// anonymizer rewrites the values of a snapshot
+type anonymizer struct {
+	key      []byte
+	unique   map[string]map[string]bool // Single column unique text columns, by table
+	latShift float64
+	lngShift float64
+	report   *AnonymizeReport
+}
+
+// Anonymize rewrites a snapshot so it can be restored as demo data: names, free text, emails and contact
+// details are scrambled, codes, hashes, CIDs and transaction IDs replaced by values of the same shape, and
+// every GPS position moved by the same offset. The same value always becomes the same pseudonym, so the
+// structure, row counts, quantities, timestamps and distances of the data are preserved
+func Anonymize(snap *Snapshot, opts AnonymizeOptions) (*AnonymizeReport, error) {
+	key := opts.Key
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	unique, err := loadUniqueTextColumns(db.DB)
+	if err != nil {
+		return nil, err
+	}
+	a := &anonymizer{key: key, unique: unique, report: &AnonymizeReport{Replaced: map[string]int{}}}
+	a.latShift = a.shift("latitude")
+	a.lngShift = a.shift("longitude")
+
+	for i, data := range snap.Tables {
+		for j, raw := range data.Rows {
+			row, err := decodeRow(raw)
+			if err != nil {
+				return nil, err
+			}
+			for column, value := range row {
+				row[column] = a.value(data.Table, column, value)
+			}
+			if snap.Tables[i].Rows[j], err = json.Marshal(row); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	snap.CompanyName = a.words(snap.CompanyName)
+	for i := range snap.Accounts {
+		account := &snap.Accounts[i]
+		account.Username = "demo-" + a.hash("username", account.Username)[:10]
+		if opts.AccountEmail != "" {
+			account.Email = opts.AccountEmail
+		} else {
+			account.Email = a.email(account.Email)
+		}
+		a.report.Accounts++
+	}
+	for i := range snap.CIDs {
+		snap.CIDs[i].CID = a.code(snap.CIDs[i].CID)
+	}
+	for i := range snap.Anchors {
+		snap.Anchors[i].TxID = a.code(snap.Anchors[i].TxID)
+		snap.Anchors[i].MetadataHash = a.code(snap.Anchors[i].MetadataHash)
+	}
+	return a.report, nil
+}
+
+// loadUniqueTextColumns reads the text columns with a unique index of their own. Their values are replaced
+// like codes, so a mirror restored next to the original does not conflict with it
+func loadUniqueTextColumns(q querier) (map[string]map[string]bool, error) {
+	rows, err := q.Query(`
+		SELECT cl.relname, a.attname
+		FROM pg_index i
+		JOIN pg_class cl ON cl.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+		WHERE i.indisunique AND NOT i.indisprimary AND i.indnatts = 1
+		AND n.nspname = current_schema() AND a.atttypid IN ('text'::regtype, 'varchar'::regtype)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	unique := map[string]map[string]bool{}
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return nil, err
+		}
+		if unique[table] == nil {
+			unique[table] = map[string]bool{}
+		}
+		unique[table][column] = true
+	}
+	return unique, rows.Err()
+}
+
+// kind tells how a column, or a key of a JSON value when table is empty, is anonymized
+func (a *anonymizer) kind(table, column string) valueKind {
+	column = strings.ToLower(column)
+	switch {
+	case column == "latitude" || column == "lat":
+		return kindLatitude
+	case column == "longitude" || column == "lng" || column == "lon":
+		return kindLongitude
+	case a.unique[table][column]:
+		return kindCode
+	case column == "email" || strings.HasSuffix(column, "_email"):
+		return kindEmail
+	case column == "file_name" || strings.Contains(column, "phone") || strings.HasSuffix(column, "address") ||
+		strings.HasSuffix(column, "tx_id") || strings.HasSuffix(column, "hash") || strings.HasSuffix(column, "cid") ||
+		column == "username" || column == "did":
+		return kindCode
+	case column == "name" && keptNameTables[table], column == "metric_name":
+		return kindKeep
+	case column == "name" || strings.HasSuffix(column, "_name") || column == "notes" || column == "description" ||
+		column == "contact_info" || strings.HasSuffix(column, "location") || column == "owner" || column == "operator":
+		return kindWords
+	}
+	return kindKeep
+}
+
+// value anonymizes a value of a column; objects and arrays are walked with their keys as columns
+func (a *anonymizer) value(table, column string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			v[key] = a.value("", key, inner)
+		}
+		return v
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = a.value(table, column, inner)
+		}
+		return v
+	case nil:
+		return nil
+	}
+
+	kind := a.kind(table, column)
+	if kind == kindLatitude || kind == kindLongitude {
+		number, ok := value.(json.Number)
+		if !ok {
+			return value
+		}
+		f, err := number.Float64()
+		if err != nil {
+			return value
+		}
+		if kind == kindLatitude {
+			a.report.ShiftedPoints++
+			return round6(math.Max(-90, math.Min(90, f+a.latShift)))
+		}
+		return round6(math.Mod(f+a.lngShift+540, 360) - 180)
+	}
+
+	s, ok := value.(string)
+	if !ok || s == "" || kind == kindKeep {
+		return value
+	}
+	name := column
+	if table != "" {
+		name = table + "." + column
+	}
+	a.report.Replaced[name]++
+	switch kind {
+	case kindEmail:
+		return a.email(s)
+	case kindCode:
+		return a.code(s)
+	}
+	return a.words(s)
+}
+
+// hash is the keyed hash of a value, in hex
+func (a *anonymizer) hash(purpose, value string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(purpose + "\x00" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// stream returns n pseudorandom bytes derived from a value
+func (a *anonymizer) stream(value string, n int) []byte {
+	out := make([]byte, 0, n+sha256.Size)
+	for block := 0; len(out) < n; block++ {
+		mac := hmac.New(sha256.New, a.key)
+		binary.Write(mac, binary.BigEndian, uint32(block))
+		mac.Write([]byte(value))
+		out = mac.Sum(out)
+	}
+	return out[:n]
+}
+
+// shift returns the offset of a coordinate, between 0.3 and 1 degree either way
+func (a *anonymizer) shift(axis string) float64 {
+	b := a.stream("shift:"+axis, 8)
+	offset := 0.3 + 0.7*float64(binary.BigEndian.Uint32(b[:4]))/math.MaxUint32
+	if b[4]&1 == 1 {
+		offset = -offset
+	}
+	return offset
+}
+
+// words replaces every word of a text by a pseudonym; words with digits are replaced like codes
+func (a *anonymizer) words(text string) string {
+	var out strings.Builder
+	var word []rune
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := string(word)
+		word = word[:0]
+		if strings.IndexFunc(w, unicode.IsDigit) >= 0 {
+			out.WriteString(a.code(w))
+			return
+		}
+		b := a.stream("word:"+strings.ToLower(w), 1)
+		pseudo := pseudoWords[int(b[0])%len(pseudoWords)]
+		if unicode.IsUpper([]rune(w)[0]) {
+			pseudo = strings.ToUpper(pseudo[:1]) + pseudo[1:]
+		}
+		out.WriteString(pseudo)
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		out.WriteRune(r)
+	}
+	flush()
+	return out.String()
+}
+
+// email replaces an email by an address of example.com
+func (a *anonymizer) email(email string) string {
+	return "demo-" + a.hash("email", strings.ToLower(email))[:10] + "@example.com"
+}
+
+// code replaces the letters and digits of a code by others of the same class, keeping hex digits hex.
+// A 0x prefix and the namespace of a DID or URN, up to the last colon, are kept
+func (a *anonymizer) code(code string) string {
+	if code == "" {
+		return code
+	}
+	prefix := ""
+	if i := strings.LastIndex(code, ":"); i >= 0 {
+		prefix, code = code[:i+1], code[i+1:]
+	} else if strings.HasPrefix(code, "0x") {
+		prefix, code = "0x", code[2:]
+	}
+	runes := []rune(code)
+	b := a.stream("code:"+prefix+code, len(runes))
+	for i, r := range runes {
+		switch {
+		case r >= '0' && r <= '9':
+			runes[i] = '0' + rune(b[i]%10)
+		case r >= 'a' && r <= 'f':
+			runes[i] = 'a' + rune(b[i]%6)
+		case r >= 'A' && r <= 'F':
+			runes[i] = 'A' + rune(b[i]%6)
+		case r >= 'a' && r <= 'z':
+			runes[i] = 'a' + rune(b[i]%26)
+		case r >= 'A' && r <= 'Z':
+			runes[i] = 'A' + rune(b[i]%26)
+		case unicode.IsLetter(r):
+			runes[i] = 'x'
+		}
+	}
+	return prefix + string(runes)
+}
+
+// round6 rounds a coordinate to six decimals
+func round6(f float64) float64 {
+	return math.Round(f*1e6) / 1e6
+}
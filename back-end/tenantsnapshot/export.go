@@ -0,0 +1,288 @@
+package tenantsnapshot
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/region"
+)
+
+// ErrCompanyNotFound is returned when exporting a company that does not exist
+var ErrCompanyNotFound = errors.New("company not found")
+
+// Export takes a snapshot of a company. Every read happens in a single repeatable read transaction,
+// so the snapshot is the company's data as committed when the transaction started, however long it takes
+func Export(companyID int) (*Snapshot, error) {
+	tx, err := db.DB.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	snap := &Snapshot{Format: Format, Version: Version, CompanyID: companyID, SourceRegion: region.Default().Current}
+	err = tx.QueryRow(`SELECT name, NOW() FROM company WHERE id = $1`, companyID).Scan(&snap.CompanyName, &snap.TakenAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrCompanyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := loadSchema(tx)
+	if err != nil {
+		return nil, err
+	}
+	owned := map[string]map[int64]bool{"company": {int64(companyID): true}}
+	if err := collectOwned(tx, s, owned); err != nil {
+		return nil, err
+	}
+	// Anchors of the company's records, then the rows that hang off the anchors
+	if err := collectAnchors(tx, owned); err != nil {
+		return nil, err
+	}
+	if err := collectOwned(tx, s, owned); err != nil {
+		return nil, err
+	}
+
+	tables := map[string]bool{}
+	for table := range owned {
+		tables[table] = true
+	}
+	order, _ := restoreOrder(s, tables)
+	accounts := map[int64]bool{}
+	for _, table := range order {
+		data, err := exportTable(tx, s, table, owned[table], snap, accounts)
+		if err != nil {
+			return nil, err
+		}
+		snap.Tables = append(snap.Tables, data)
+	}
+	if snap.Accounts, err = exportAccounts(tx, accounts); err != nil {
+		return nil, err
+	}
+
+	for table := range excludedTables {
+		if s.Columns[table] != nil {
+			snap.Excluded = append(snap.Excluded, table)
+		}
+	}
+	sort.Strings(snap.Excluded)
+	return snap, nil
+}
+
+// collectOwned adds the rows that reference rows of the company, until no table gains any.
+// References of a table to itself are not followed, nor references to the excluded tables
+func collectOwned(q querier, s *schema, owned map[string]map[int64]bool) error {
+	tables := make([]string, 0, len(s.Keys))
+	for table := range s.Keys {
+		if !excludedTables[table] && s.Columns[table] != nil {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+
+	queried := map[string]int{} // Number of parent rows each reference was last followed with
+	for changed := true; changed; {
+		changed = false
+		for _, table := range tables {
+			for _, fk := range s.Keys[table] {
+				parents := owned[fk.Parent]
+				key := table + "." + fk.Column
+				if fk.Parent == table || len(parents) == 0 || queried[key] == len(parents) {
+					continue
+				}
+				queried[key] = len(parents)
+
+				ids, err := queryIDs(q, `SELECT id FROM `+quote(table)+` WHERE `+quote(fk.Column)+` = ANY($1)`, idList(parents))
+				if err != nil {
+					return err
+				}
+				for _, id := range ids {
+					if owned[table] == nil {
+						owned[table] = map[int64]bool{}
+					}
+					if !owned[table][id] {
+						owned[table][id] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// collectAnchors adds the blockchain records of the company's rows
+func collectAnchors(q querier, owned map[string]map[int64]bool) error {
+	rows, err := q.Query(`SELECT DISTINCT related_table FROM blockchain_record WHERE related_table IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	var related []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		related = append(related, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, name := range related {
+		ids := owned[anchoredTable(name)]
+		if len(ids) == 0 {
+			continue
+		}
+		records, err := queryIDs(q, `SELECT id FROM blockchain_record WHERE related_table = $1 AND related_id = ANY($2)`, name, idList(ids))
+		if err != nil {
+			return err
+		}
+		for _, id := range records {
+			if owned["blockchain_record"] == nil {
+				owned["blockchain_record"] = map[int64]bool{}
+			}
+			owned["blockchain_record"][id] = true
+		}
+	}
+	return nil
+}
+
+// exportTable reads the owned rows of a table, noting the CIDs, anchors and accounts they hold
+func exportTable(q querier, s *schema, table string, ids map[int64]bool, snap *Snapshot, accounts map[int64]bool) (TableData, error) {
+	data := TableData{Table: table, Rows: []json.RawMessage{}}
+	rows, err := q.Query(`SELECT row_to_json(t) FROM `+quote(table)+` t WHERE id = ANY($1) ORDER BY id`, idList(ids))
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return data, err
+		}
+		row, err := decodeRow(raw)
+		if err != nil {
+			return data, err
+		}
+		id, _ := toID(row["id"])
+		for column, value := range row {
+			text, _ := value.(string)
+			if text != "" && (column == "ipfs_hash" || column == "cid" || strings.HasSuffix(column, "_cid")) {
+				snap.CIDs = append(snap.CIDs, CIDRef{Table: table, RecordID: id, Column: column, CID: text})
+			}
+		}
+		if table == "blockchain_record" {
+			snap.Anchors = append(snap.Anchors, anchorOf(row))
+		}
+		for _, fk := range s.Keys[table] {
+			if fk.Parent == "account" {
+				if accountID, ok := toID(row[fk.Column]); ok {
+					accounts[accountID] = true
+				}
+			}
+		}
+		data.Rows = append(data.Rows, json.RawMessage(raw))
+	}
+	return data, rows.Err()
+}
+
+// anchorOf describes the anchor a blockchain record row holds
+func anchorOf(row map[string]interface{}) Anchor {
+	text := func(column string) string {
+		value, _ := row[column].(string)
+		return value
+	}
+	related, _ := toID(row["related_id"])
+	block, _ := toID(row["block_number"])
+	return Anchor{
+		Table:              anchoredTable(text("related_table")),
+		RecordID:           related,
+		TxID:               text("tx_id"),
+		MetadataHash:       text("metadata_hash"),
+		NetworkID:          text("network_id"),
+		BlockNumber:        block,
+		ConfirmationStatus: text("confirmation_status"),
+	}
+}
+
+// exportAccounts lists the referenced accounts, without their credentials
+func exportAccounts(q querier, ids map[int64]bool) ([]AccountRef, error) {
+	accounts := []AccountRef{}
+	if len(ids) == 0 {
+		return accounts, nil
+	}
+	rows, err := q.Query(`SELECT id, username, email, COALESCE(company_id, 0) FROM account WHERE id = ANY($1) ORDER BY id`, idList(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a AccountRef
+		if err := rows.Scan(&a.ID, &a.Username, &a.Email, &a.CompanyID); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// queryIDs runs a query selecting ids
+func queryIDs(q querier, query string, args ...interface{}) ([]int64, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// idList turns a set of ids into a query parameter
+func idList(ids map[int64]bool) interface{} {
+	list := make([]int64, 0, len(ids))
+	for id := range ids {
+		list = append(list, id)
+	}
+	return pq.Array(list)
+}
+
+// decodeRow decodes a row exported by row_to_json, keeping numbers exact
+func decodeRow(raw []byte) (map[string]interface{}, error) {
+	var row map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// toID reads an id from a decoded row value
+func toID(value interface{}) (int64, bool) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	id, err := number.Int64()
+	return id, err == nil
+}
@@ -0,0 +1,362 @@
+package tenantsnapshot
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// ErrInvalidMode is returned for a restore mode other than copy and migrate
+var ErrInvalidMode = errors.New("restore mode must be copy or migrate")
+
+// RestoreOptions controls a restore
+type RestoreOptions struct {
+	Mode        string // copy or migrate
+	DryRun      bool   // Restore, report and roll back
+	CompanyName string // Name of the restored company, the snapshot's when empty
+	Checksum    string // SHA-256 of the snapshot file, recorded with the run
+	UserID      int
+}
+
+// RestoreReport describes a restore
+type RestoreReport struct {
+	SourceCompanyID   int            `json:"source_company_id"`
+	CompanyID         int            `json:"company_id"` // ID of the restored company; not kept on a dry run
+	Mode              string         `json:"mode"`
+	DryRun            bool           `json:"dry_run"`
+	TakenAt           time.Time      `json:"taken_at"`
+	Tables            []TableResult  `json:"tables"`
+	ClearedReferences map[string]int `json:"cleared_references"` // References set to NULL as their row is not in this environment, by table.column
+	MatchedAccounts   int            `json:"matched_accounts"`
+	UnmatchedAccounts []string       `json:"unmatched_accounts"` // Emails of referenced accounts that do not exist in this environment
+	CIDs              int            `json:"cids"`
+	Anchors           int            `json:"anchors"`
+	Warnings          []string       `json:"warnings"`
+}
+
+// TableResult counts the rows of a table restored
+type TableResult struct {
+	Table     string `json:"table"`
+	Rows      int    `json:"rows"`
+	Restored  int    `json:"restored"`
+	Skipped   int    `json:"skipped"`   // Rows with a required reference to a row that is not in this environment
+	Conflicts int    `json:"conflicts"` // Rows a unique value of which is already taken in this environment
+}
+
+// deferredReference is a reference set once every row is restored
+type deferredReference struct {
+	table  string
+	id     int64
+	column string
+	parent string
+	old    int64
+}
+
+// restorer restores the rows of a snapshot in a transaction
+type restorer struct {
+	tx       *sql.Tx
+	schema   *schema
+	tables   map[string]bool
+	ids      map[string]map[int64]int64 // New id by snapshot id, by table
+	exists   map[string]bool            // Whether rows outside the snapshot exist here, by table:id
+	report   *RestoreReport
+	deferred []deferredReference
+}
+
+// Restore restores a snapshot into this environment as a new company. Rows get new ids and their references
+// are remapped; references to rows outside the snapshot keep their id when the row exists here, accounts are
+// matched by email, and others are cleared, or the row skipped when the reference is required.
+// The restore is a single transaction: it is applied completely or not at all
+func Restore(snap *Snapshot, opts RestoreOptions) (*RestoreReport, error) {
+	if opts.Mode == "" {
+		opts.Mode = ModeCopy
+	}
+	if opts.Mode != ModeCopy && opts.Mode != ModeMigrate {
+		return nil, ErrInvalidMode
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	target, err := loadSchema(tx)
+	if err != nil {
+		return nil, err
+	}
+	r := &restorer{
+		tx:     tx,
+		schema: target,
+		tables: map[string]bool{},
+		ids:    map[string]map[int64]int64{"account": {}},
+		exists: map[string]bool{},
+		report: &RestoreReport{
+			SourceCompanyID:   snap.CompanyID,
+			Mode:              opts.Mode,
+			DryRun:            opts.DryRun,
+			TakenAt:           snap.TakenAt,
+			ClearedReferences: map[string]int{},
+			UnmatchedAccounts: []string{},
+			CIDs:              len(snap.CIDs),
+			Anchors:           len(snap.Anchors),
+			Warnings:          []string{},
+		},
+	}
+
+	rows := map[string][]json.RawMessage{}
+	for _, data := range snap.Tables {
+		switch {
+		case excludedTables[data.Table]:
+			r.warn("table %s is not restored", data.Table)
+		case target.Columns[data.Table] == nil:
+			r.warn("table %s does not exist in this environment, %d rows not restored", data.Table, len(data.Rows))
+		default:
+			r.tables[data.Table] = true
+			rows[data.Table] = append(rows[data.Table], data.Rows...)
+		}
+	}
+	if !r.tables["company"] {
+		return nil, fmt.Errorf("%w: no company row", ErrInvalidSnapshot)
+	}
+	if err := r.matchAccounts(snap.Accounts); err != nil {
+		return nil, err
+	}
+
+	order, deferred := restoreOrder(target, r.tables)
+	for _, table := range order {
+		result := TableResult{Table: table, Rows: len(rows[table])}
+		dropped := map[string]bool{}
+		for _, raw := range rows[table] {
+			row, err := decodeRow(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid %s row: %v", ErrInvalidSnapshot, table, err)
+			}
+			oldID, ok := toID(row["id"])
+			if !ok {
+				return nil, fmt.Errorf("%w: %s row without id", ErrInvalidSnapshot, table)
+			}
+			delete(row, "id")
+			if opts.Mode == ModeCopy {
+				delete(row, "global_id")
+			}
+			if table == "company" && oldID == int64(snap.CompanyID) && opts.CompanyName != "" {
+				row["name"] = opts.CompanyName
+			}
+
+			if !r.remap(table, oldID, row, deferred[table]) {
+				result.Skipped++
+				continue
+			}
+			for column := range row {
+				if !target.Columns[table][column] {
+					delete(row, column)
+					dropped[column] = true
+				}
+			}
+
+			newID, conflict, err := r.insert(table, row)
+			if err != nil {
+				return nil, fmt.Errorf("failed to restore %s row %d: %w", table, oldID, err)
+			}
+			if conflict {
+				result.Conflicts++
+				continue
+			}
+			if r.ids[table] == nil {
+				r.ids[table] = map[int64]int64{}
+			}
+			r.ids[table][oldID] = newID
+			result.Restored++
+		}
+		for column := range dropped {
+			r.warn("column %s.%s does not exist in this environment and was not restored", table, column)
+		}
+		r.report.Tables = append(r.report.Tables, result)
+	}
+
+	if err := r.setDeferred(); err != nil {
+		return nil, err
+	}
+	newCompanyID, ok := r.ids["company"][int64(snap.CompanyID)]
+	if !ok {
+		return nil, fmt.Errorf("%w: company %d not in snapshot", ErrInvalidSnapshot, snap.CompanyID)
+	}
+	r.report.CompanyID = int(newCompanyID)
+
+	if !opts.DryRun {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+
+	report, _ := json.Marshal(r.report)
+	restored := 0
+	for _, t := range r.report.Tables {
+		restored += t.Restored
+	}
+	run := &Run{
+		Operation:       "restore",
+		CompanyID:       r.report.CompanyID,
+		SourceCompanyID: snap.CompanyID,
+		SourceRegion:    snap.SourceRegion,
+		Mode:            opts.Mode,
+		DryRun:          opts.DryRun,
+		TakenAt:         snap.TakenAt,
+		Checksum:        opts.Checksum,
+		Rows:            restored,
+		Report:          report,
+		CreatedBy:       opts.UserID,
+	}
+	if opts.DryRun {
+		run.CompanyID = 0
+	}
+	if err := recordRun(run); err != nil {
+		fmt.Printf("Warning: failed to record tenant snapshot restore: %v\n", err)
+	}
+	return r.report, nil
+}
+
+// matchAccounts maps the referenced accounts to the accounts of this environment with the same email
+func (r *restorer) matchAccounts(accounts []AccountRef) error {
+	for _, a := range accounts {
+		var id int64
+		err := r.tx.QueryRow(`SELECT id FROM account WHERE LOWER(email) = LOWER($1)`, a.Email).Scan(&id)
+		if err == sql.ErrNoRows {
+			r.report.UnmatchedAccounts = append(r.report.UnmatchedAccounts, a.Email)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		r.ids["account"][int64(a.ID)] = id
+		r.report.MatchedAccounts++
+	}
+	return nil
+}
+
+// remap rewrites the references of a row to the ids of this environment.
+// It reports false when a required reference cannot be resolved and the row must be skipped
+func (r *restorer) remap(table string, oldID int64, row map[string]interface{}, deferred map[string]bool) bool {
+	for _, fk := range r.schema.Keys[table] {
+		old, ok := toID(row[fk.Column])
+		if !ok {
+			continue
+		}
+		if deferred[fk.Column] {
+			if fk.NotNull {
+				return false
+			}
+			row[fk.Column] = nil
+			r.deferred = append(r.deferred, deferredReference{table: table, id: oldID, column: fk.Column, parent: fk.Parent, old: old})
+			continue
+		}
+		id, found := r.resolve(fk.Parent, old)
+		switch {
+		case found:
+			row[fk.Column] = id
+		case fk.NotNull:
+			return false
+		default:
+			row[fk.Column] = nil
+			r.report.ClearedReferences[table+"."+fk.Column]++
+		}
+	}
+
+	if table == "blockchain_record" {
+		related, _ := row["related_table"].(string)
+		old, ok := toID(row["related_id"])
+		if !ok {
+			return false
+		}
+		id, found := r.ids[anchoredTable(related)][old]
+		if !found {
+			return false
+		}
+		row["related_id"] = id
+	}
+	return true
+}
+
+// resolve returns the id in this environment of a row a snapshot row references
+func (r *restorer) resolve(table string, old int64) (int64, bool) {
+	if r.tables[table] || table == "account" {
+		id, ok := r.ids[table][old]
+		return id, ok
+	}
+	key := fmt.Sprintf("%s:%d", table, old)
+	exists, checked := r.exists[key]
+	if !checked {
+		if err := r.tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM `+quote(table)+` WHERE id = $1)`, old).Scan(&exists); err != nil {
+			exists = false
+		}
+		r.exists[key] = exists
+	}
+	return old, exists
+}
+
+// insert inserts a row, reporting a conflict instead of failing when a unique value is already taken
+func (r *restorer) insert(table string, row map[string]interface{}) (int64, bool, error) {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, quote(column))
+	}
+	sort.Strings(columns)
+	list := strings.Join(columns, ", ")
+	raw, err := json.Marshal(row)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if _, err := r.tx.Exec(`SAVEPOINT restore_row`); err != nil {
+		return 0, false, err
+	}
+	var id int64
+	err = r.tx.QueryRow(`INSERT INTO `+quote(table)+` (`+list+`) SELECT `+list+` FROM json_populate_record(NULL::`+quote(table)+`, $1::json) RETURNING id`,
+		string(raw)).Scan(&id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		if _, err := r.tx.Exec(`ROLLBACK TO SAVEPOINT restore_row`); err != nil {
+			return 0, false, err
+		}
+		r.warn("%s row not restored: %s", table, pqErr.Detail)
+		return 0, true, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	_, err = r.tx.Exec(`RELEASE SAVEPOINT restore_row`)
+	return id, false, err
+}
+
+// setDeferred sets the references left out when their rows were inserted
+func (r *restorer) setDeferred() error {
+	for _, d := range r.deferred {
+		id, restored := r.ids[d.table][d.id]
+		if !restored {
+			continue
+		}
+		parent, found := r.resolve(d.parent, d.old)
+		if !found {
+			r.report.ClearedReferences[d.table+"."+d.column]++
+			continue
+		}
+		if _, err := r.tx.Exec(`UPDATE `+quote(d.table)+` SET `+quote(d.column)+` = $1 WHERE id = $2`, parent, id); err != nil {
+			return fmt.Errorf("failed to restore %s.%s of row %d: %w", d.table, d.column, d.id, err)
+		}
+	}
+	return nil
+}
+
+// warn adds a warning to the report
+func (r *restorer) warn(format string, args ...interface{}) {
+	r.report.Warnings = append(r.report.Warnings, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,199 @@
+package tenantsnapshot
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// querier runs queries on the database or within a transaction
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// foreignKey is a single column reference from a table to the id of another
+type foreignKey struct {
+	Table   string
+	Column  string
+	Parent  string
+	NotNull bool
+}
+
+// schema is the part of the database layout snapshots are taken and restored with
+type schema struct {
+	Columns map[string]map[string]bool // Columns of the tables with an id column, by table
+	Keys    map[string][]foreignKey    // References to an id column, by referencing table
+}
+
+// excludedTables are never part of a snapshot. Accounts hold credentials and are only matched by email on
+// restore; the others hold secrets, per user settings, or logs and queues of the source environment
+var excludedTables = map[string]bool{
+	"account":                  true,
+	"user_preference":          true,
+	"batch_view_default":       true,
+	"webhook_subscription":     true,
+	"webhook_delivery":         true,
+	"notification_connector":   true,
+	"notification_message":     true,
+	"lims_token":               true,
+	"batch_access_token":       true,
+	"batch_access_token_audit": true,
+	"digest_delivery":          true,
+	"warehouse_export":         true,
+	"tenant_snapshot_run":      true,
+}
+
+// loadSchema reads the tables and foreign keys of the current schema
+func loadSchema(q querier) (*schema, error) {
+	s := &schema{Columns: map[string]map[string]bool{}, Keys: map[string][]foreignKey{}}
+
+	rows, err := q.Query(`
+		SELECT c.table_name, c.column_name
+		FROM information_schema.columns c
+		WHERE c.table_schema = current_schema()
+		AND EXISTS (
+			SELECT 1 FROM information_schema.columns i
+			WHERE i.table_schema = c.table_schema AND i.table_name = c.table_name AND i.column_name = 'id'
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if s.Columns[table] == nil {
+			s.Columns[table] = map[string]bool{}
+		}
+		s.Columns[table][column] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(`
+		SELECT cl.relname, a.attname, rf.relname, a.attnotnull
+		FROM pg_constraint co
+		JOIN pg_class cl ON cl.oid = co.conrelid
+		JOIN pg_class rf ON rf.oid = co.confrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		JOIN pg_attribute a ON a.attrelid = co.conrelid AND a.attnum = co.conkey[1]
+		JOIN pg_attribute ra ON ra.attrelid = co.confrelid AND ra.attnum = co.confkey[1]
+		WHERE co.contype = 'f' AND array_length(co.conkey, 1) = 1
+		AND n.nspname = current_schema() AND ra.attname = 'id'
+		ORDER BY cl.relname, a.attname
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fk foreignKey
+		if err := rows.Scan(&fk.Table, &fk.Column, &fk.Parent, &fk.NotNull); err != nil {
+			return nil, err
+		}
+		s.Keys[fk.Table] = append(s.Keys[fk.Table], fk)
+	}
+	return s, rows.Err()
+}
+
+// quote quotes an identifier
+func quote(name string) string {
+	return pq.QuoteIdentifier(name)
+}
+
+// anchorTables maps the related_table values of blockchain records that are not table names to the table they anchor
+var anchorTables = map[string]string{
+	"batch_extended":        "batch",
+	"batch_status_extended": "batch",
+	"environment":           "environment_data",
+}
+
+// anchoredTable returns the table a blockchain record anchors a row of
+func anchoredTable(relatedTable string) string {
+	if table, ok := anchorTables[relatedTable]; ok {
+		return table
+	}
+	return relatedTable
+}
+
+// restoreOrder orders tables so that every table comes after the tables it references. Blockchain records come
+// after the records they anchor. References that cannot be ordered, to the table itself or along a cycle, are
+// returned as deferred columns by table: they are set once every row is restored
+func restoreOrder(s *schema, tables map[string]bool) ([]string, map[string]map[string]bool) {
+	deps := map[string]map[string]string{} // Parent table by column, by table
+	for table := range tables {
+		deps[table] = map[string]string{}
+		for _, fk := range s.Keys[table] {
+			if tables[fk.Parent] {
+				deps[table][fk.Column] = fk.Parent
+			}
+		}
+	}
+	if tables["blockchain_record"] {
+		for table := range tables {
+			if table != "blockchain_record" && !referencesTable(s, table, "blockchain_record") {
+				deps["blockchain_record"]["@"+table] = table
+			}
+		}
+	}
+
+	names := make([]string, 0, len(tables))
+	for table := range tables {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+
+	placed := map[string]bool{}
+	deferred := map[string]map[string]bool{}
+	order := make([]string, 0, len(names))
+	for len(order) < len(names) {
+		next, fewest := "", -1
+		for _, table := range names {
+			if placed[table] {
+				continue
+			}
+			pending := 0
+			for _, parent := range deps[table] {
+				if parent != table && !placed[parent] {
+					pending++
+				}
+			}
+			if fewest == -1 || pending < fewest {
+				next, fewest = table, pending
+			}
+			if pending == 0 {
+				break
+			}
+		}
+		for column, parent := range deps[next] {
+			if (parent == next || !placed[parent]) && !strings.HasPrefix(column, "@") {
+				if deferred[next] == nil {
+					deferred[next] = map[string]bool{}
+				}
+				deferred[next][column] = true
+			}
+		}
+		placed[next] = true
+		order = append(order, next)
+	}
+	return order, deferred
+}
+
+// referencesTable reports whether a table has a reference to another
+func referencesTable(s *schema, table, parent string) bool {
+	for _, fk := range s.Keys[table] {
+		if fk.Parent == parent {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+package tenantsnapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Format identifies snapshot files
+const Format = "tracepost-tenant-snapshot"
+
+// Version is the version of the snapshot file layout
+const Version = 1
+
+// Restore modes
+const (
+	ModeCopy    = "copy"    // Restore as a new copy of the company: records get new global IDs. For recovery drills
+	ModeMigrate = "migrate" // Restore the company itself into another environment: records keep their global IDs
+)
+
+// ErrInvalidSnapshot is returned for a file that is not a snapshot this version can restore
+var ErrInvalidSnapshot = errors.New("invalid tenant snapshot")
+
+// Snapshot is the data of a company at a point in time. Rows are the company's records as JSON objects,
+// tables in the order they restore in; rows of other companies it references are left out and resolved on restore
+type Snapshot struct {
+	Format       string       `json:"format"`
+	Version      int          `json:"version"`
+	CompanyID    int          `json:"company_id"`
+	CompanyName  string       `json:"company_name"`
+	SourceRegion string       `json:"source_region"`
+	TakenAt      time.Time    `json:"taken_at"` // Every row is as committed at this time
+	Tables       []TableData  `json:"tables"`
+	Accounts     []AccountRef `json:"accounts"` // Accounts the rows reference, matched by email on restore
+	CIDs         []CIDRef     `json:"cids"`
+	Anchors      []Anchor     `json:"anchors"`
+	Excluded     []string     `json:"excluded_tables"`
+}
+
+// TableData holds the rows of a table
+type TableData struct {
+	Table string            `json:"table"`
+	Rows  []json.RawMessage `json:"rows"`
+}
+
+// AccountRef identifies an account referenced by the rows, without its credentials
+type AccountRef struct {
+	ID        int    `json:"id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	CompanyID int    `json:"company_id,omitempty"`
+}
+
+// CIDRef is an IPFS content identifier stored in a row. Content lives on IPFS and is not copied;
+// it must stay pinned, or be pinned by the target environment, for the restored records to resolve
+type CIDRef struct {
+	Table    string `json:"table"`
+	RecordID int64  `json:"record_id"`
+	Column   string `json:"column"`
+	CID      string `json:"cid"`
+}
+
+// Anchor is a blockchain transaction a record is anchored by
+type Anchor struct {
+	Table              string `json:"table"`
+	RecordID           int64  `json:"record_id"`
+	TxID               string `json:"tx_id"`
+	MetadataHash       string `json:"metadata_hash,omitempty"`
+	NetworkID          string `json:"network_id,omitempty"`
+	BlockNumber        int64  `json:"block_number,omitempty"`
+	ConfirmationStatus string `json:"confirmation_status,omitempty"`
+}
+
+// Summary describes a snapshot without its rows
+type Summary struct {
+	CompanyID    int            `json:"company_id"`
+	CompanyName  string         `json:"company_name"`
+	SourceRegion string         `json:"source_region"`
+	TakenAt      time.Time      `json:"taken_at"`
+	Rows         map[string]int `json:"rows"` // Row count by table
+	Accounts     int            `json:"accounts"`
+	CIDs         int            `json:"cids"`
+	Anchors      int            `json:"anchors"`
+}
+
+// Summary counts the contents of a snapshot
+func (s *Snapshot) Summary() Summary {
+	summary := Summary{
+		CompanyID:    s.CompanyID,
+		CompanyName:  s.CompanyName,
+		SourceRegion: s.SourceRegion,
+		TakenAt:      s.TakenAt,
+		Rows:         map[string]int{},
+		Accounts:     len(s.Accounts),
+		CIDs:         len(s.CIDs),
+		Anchors:      len(s.Anchors),
+	}
+	for _, t := range s.Tables {
+		summary.Rows[t.Table] = len(t.Rows)
+	}
+	return summary
+}
+
+// Encode writes a snapshot as gzipped JSON and returns the SHA-256 of the written bytes
+func Encode(w io.Writer, s *Snapshot) (string, error) {
+	hash := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(w, hash))
+	if err := json.NewEncoder(gz).Encode(s); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Decode reads a snapshot written by Encode, plain JSON being accepted as well
+func Decode(r io.Reader) (*Snapshot, string, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(raw)
+	checksum := hex.EncodeToString(sum[:])
+
+	var body io.Reader
+	if len(raw) > 2 && raw[0] == 0x1f && raw[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		defer gz.Close()
+		body = gz
+	} else {
+		body = bytes.NewReader(raw)
+	}
+
+	var s Snapshot
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&s); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if s.Format != Format {
+		return nil, "", fmt.Errorf("%w: unknown format %q", ErrInvalidSnapshot, s.Format)
+	}
+	if s.Version != Version {
+		return nil, "", fmt.Errorf("%w: version %d is not supported", ErrInvalidSnapshot, s.Version)
+	}
+	return &s, checksum, nil
+}
+
+// Run is an export or restore of a snapshot
+type Run struct {
+	ID              int             `json:"id"`
+	Operation       string          `json:"operation"`         // export or restore
+	CompanyID       int             `json:"company_id"`        // Company exported, or the company a snapshot restored into
+	SourceCompanyID int             `json:"source_company_id"` // Company of the snapshot
+	SourceRegion    string          `json:"source_region"`
+	Mode            string          `json:"mode,omitempty"`
+	DryRun          bool            `json:"dry_run"`
+	TakenAt         time.Time       `json:"taken_at"`
+	Checksum        string          `json:"checksum"`
+	Rows            int             `json:"rows"`
+	Report          json.RawMessage `json:"report,omitempty" swaggertype:"object"`
+	CreatedBy       int             `json:"created_by,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+// RecordExport records the export of a snapshot written with a checksum
+func RecordExport(snap *Snapshot, checksum string, userID int) (*Run, error) {
+	rows := 0
+	for _, t := range snap.Tables {
+		rows += len(t.Rows)
+	}
+	report, _ := json.Marshal(snap.Summary())
+	run := &Run{
+		Operation:       "export",
+		CompanyID:       snap.CompanyID,
+		SourceCompanyID: snap.CompanyID,
+		SourceRegion:    snap.SourceRegion,
+		TakenAt:         snap.TakenAt,
+		Checksum:        checksum,
+		Rows:            rows,
+		Report:          report,
+		CreatedBy:       userID,
+	}
+	return run, recordRun(run)
+}
+
+// recordRun saves an export or restore
+func recordRun(run *Run) error {
+	return db.DB.QueryRow(`
+		INSERT INTO tenant_snapshot_run (operation, company_id, source_company_id, source_region, mode, dry_run, taken_at, checksum, row_count, report, created_by)
+		VALUES ($1, NULLIF($2, 0), $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, NULLIF($11, 0))
+		RETURNING id, created_at
+	`, run.Operation, run.CompanyID, run.SourceCompanyID, run.SourceRegion, run.Mode, run.DryRun, run.TakenAt,
+		run.Checksum, run.Rows, []byte(run.Report), run.CreatedBy).Scan(&run.ID, &run.CreatedAt)
+}
+
+// ListRuns returns the latest exports and restores, of a company when companyID is set
+func ListRuns(companyID, limit int) ([]Run, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := db.DB.Query(`
+		SELECT id, operation, COALESCE(company_id, 0), source_company_id, source_region, COALESCE(mode, ''), dry_run,
+			taken_at, checksum, row_count, report, COALESCE(created_by, 0), created_at
+		FROM tenant_snapshot_run
+		WHERE $1 = 0 OR company_id = $1 OR source_company_id = $1
+		ORDER BY created_at DESC LIMIT $2
+	`, companyID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []Run{}
+	for rows.Next() {
+		var run Run
+		var report []byte
+		if err := rows.Scan(&run.ID, &run.Operation, &run.CompanyID, &run.SourceCompanyID, &run.SourceRegion, &run.Mode,
+			&run.DryRun, &run.TakenAt, &run.Checksum, &run.Rows, &report, &run.CreatedBy, &run.CreatedAt); err != nil {
+			return nil, err
+		}
+		run.Report = report
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
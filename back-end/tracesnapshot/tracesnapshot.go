@@ -0,0 +1,399 @@
+package tracesnapshot
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/blockchain"
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/ipfs"
+)
+
+// Statuses of a snapshot
+const (
+	StatusPublished = "published" // on IPFS, the on-chain anchor is pending or failed and will be retried
+	StatusAnchored  = "anchored"  // on IPFS with its CID recorded on-chain
+)
+
+// TxTypeTraceSnapshot is the transaction type of a snapshot anchor
+const TxTypeTraceSnapshot = "TRACE_SNAPSHOT"
+
+var (
+	// ErrNoRenderer is returned when no trace renderer was configured
+	ErrNoRenderer = errors.New("trace snapshot renderer is not configured")
+	// ErrBatchNotFound is returned for a batch that does not exist or is inactive
+	ErrBatchNotFound = errors.New("batch not found")
+)
+
+// Rendered is the public trace of a batch
+type Rendered struct {
+	Trace interface{} // Serialized as the JSON snapshot
+	HTML  []byte      // Optional standalone page
+}
+
+// Renderer builds the public trace of a batch, with an HTML page when html is true
+type Renderer func(batchID int, html bool) (Rendered, error)
+
+// Snapshot is a pre-rendered public trace published to IPFS
+type Snapshot struct {
+	ID          int        `json:"id"`
+	BatchID     int        `json:"batch_id"`
+	Version     int        `json:"version"`
+	ContentHash string     `json:"content_hash"`
+	JSONCID     string     `json:"json_cid"`
+	JSONURI     string     `json:"json_uri"`
+	HTMLCID     string     `json:"html_cid,omitempty"`
+	HTMLURI     string     `json:"html_uri,omitempty"`
+	Status      string     `json:"status"`
+	AnchorTxID  string     `json:"anchor_tx_id,omitempty"`
+	AnchorError string     `json:"anchor_error,omitempty"`
+	AnchoredAt  *time.Time `json:"anchored_at,omitempty"`
+	CreatedBy   *int       `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CheckedAt   time.Time  `json:"checked_at"`
+}
+
+// Service publishes snapshots of finished batches once they stopped changing
+// A batch is finished when its status is one of Statuses and settled when it was not updated for Settle;
+// it is rendered again after later updates, and a new version is only published when the trace changed
+type Service struct {
+	Config    *config.Config
+	Interval  time.Duration
+	Settle    time.Duration
+	Statuses  []string
+	HTML      bool
+	BatchSize int
+	Render    Renderer
+
+	inFlight sync.Map
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates a snapshot service from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		Config:    cfg,
+		Interval:  time.Duration(cfg.TraceSnapshotIntervalSeconds) * time.Second,
+		Settle:    time.Duration(cfg.TraceSnapshotSettleHours) * time.Hour,
+		Statuses:  cfg.TraceSnapshotStatuses,
+		HTML:      cfg.TraceSnapshotHTML,
+		BatchSize: 20,
+	}
+}
+
+// Default returns the process wide snapshot service
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Start publishes snapshots on a schedule in the background
+func (s *Service) Start() {
+	go func() {
+		for {
+			time.Sleep(s.Interval)
+
+			if err := s.RunOnce(); err != nil {
+				fmt.Printf("Warning: trace snapshot run failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// RunOnce publishes snapshots of settled batches that changed since their last snapshot
+// and retries anchors that failed
+func (s *Service) RunOnce() error {
+	if db.DB == nil || s.Render == nil {
+		return nil
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT b.id
+		FROM batch b
+		WHERE b.is_active = true AND b.status = ANY($1)
+			AND b.updated_at < NOW() - ($2 * INTERVAL '1 second')
+			AND NOT EXISTS (
+				SELECT 1 FROM trace_snapshot s
+				WHERE s.batch_id = b.id AND COALESCE(s.checked_at, s.created_at) >= b.updated_at
+			)
+		ORDER BY b.updated_at
+		LIMIT $3
+	`, pq.Array(s.Statuses), int(s.Settle/time.Second), s.BatchSize)
+	if err != nil {
+		return err
+	}
+	for _, batchID := range scanIDs(rows) {
+		if _, _, err := s.Publish(batchID, 0); err != nil {
+			fmt.Printf("Warning: failed to publish trace snapshot of batch %d: %v\n", batchID, err)
+		}
+	}
+
+	rows, err = db.DB.Query(`
+		SELECT id FROM trace_snapshot
+		WHERE status = $1
+		ORDER BY created_at
+		LIMIT $2
+	`, StatusPublished, s.BatchSize)
+	if err != nil {
+		return err
+	}
+	for _, id := range scanIDs(rows) {
+		if _, err := s.Anchor(id); err != nil {
+			fmt.Printf("Warning: failed to anchor trace snapshot %d: %v\n", id, err)
+		}
+	}
+	return nil
+}
+
+// Publish renders the public trace of a batch and publishes it to IPFS when it differs from the
+// latest snapshot. It returns the new or unchanged latest snapshot and whether a version was published
+func (s *Service) Publish(batchID, userID int) (*Snapshot, bool, error) {
+	if s.Render == nil {
+		return nil, false, ErrNoRenderer
+	}
+	// Scheduled and manual publishing of the same batch must not publish the same version twice
+	key := strconv.Itoa(batchID)
+	if _, busy := s.inFlight.LoadOrStore(key, true); busy {
+		latest, err := Latest(batchID)
+		return latest, false, err
+	}
+	defer s.inFlight.Delete(key)
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = $1 AND is_active = true)", batchID).Scan(&exists); err != nil {
+		return nil, false, err
+	}
+	if !exists {
+		return nil, false, ErrBatchNotFound
+	}
+
+	rendered, err := s.Render(batchID, s.HTML)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to render trace: %w", err)
+	}
+	traceJSON, err := json.Marshal(rendered.Trace)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode trace: %w", err)
+	}
+	sum := sha256.Sum256(traceJSON)
+	contentHash := hex.EncodeToString(sum[:])
+
+	latest, err := Latest(batchID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+	if latest != nil && latest.ContentHash == contentHash {
+		_, err = db.DB.Exec("UPDATE trace_snapshot SET checked_at = NOW() WHERE id = $1", latest.ID)
+		return latest, false, err
+	}
+
+	version := 1
+	if latest != nil {
+		version = latest.Version + 1
+	}
+	metadata := map[string]string{
+		"batch_id":      key,
+		"version":       strconv.Itoa(version),
+		"document_type": "trace_snapshot",
+		"app":           "TracePost-larvaeChain",
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}
+	document := map[string]interface{}{
+		"snapshot": map[string]interface{}{
+			"batch_id":     batchID,
+			"version":      version,
+			"content_hash": contentHash,
+			"generated_at": time.Now().UTC().Format(time.RFC3339),
+		},
+		"trace": json.RawMessage(traceJSON),
+	}
+
+	service := ipfs.NewIPFSPinataService()
+	name := fmt.Sprintf("trace-batch-%d-v%d", batchID, version)
+	upload, err := service.UploadJSON(document, name+".json", metadata, true)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to upload trace: %w", err)
+	}
+	if upload.CID == "" {
+		return nil, false, errors.New("IPFS returned no CID for the trace")
+	}
+	snapshot := &Snapshot{
+		BatchID:     batchID,
+		Version:     version,
+		ContentHash: contentHash,
+		JSONCID:     upload.CID,
+		JSONURI:     uploadURI(upload),
+		Status:      StatusPublished,
+	}
+
+	if len(rendered.HTML) > 0 {
+		page, err := service.UploadBytes(rendered.HTML, name+".html", metadata, true)
+		if err != nil {
+			fmt.Printf("Warning: failed to upload trace page of batch %d: %v\n", batchID, err)
+		} else {
+			snapshot.HTMLCID = page.CID
+			snapshot.HTMLURI = uploadURI(page)
+		}
+	}
+
+	err = db.DB.QueryRow(`
+		INSERT INTO trace_snapshot (batch_id, version, content_hash, json_cid, json_uri, html_cid, html_uri, status, created_by, created_at, checked_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8, NULLIF($9, 0), NOW(), NOW())
+		RETURNING id, created_at, checked_at
+	`, batchID, version, contentHash, snapshot.JSONCID, snapshot.JSONURI, snapshot.HTMLCID, snapshot.HTMLURI,
+		StatusPublished, userID).Scan(&snapshot.ID, &snapshot.CreatedAt, &snapshot.CheckedAt)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to record snapshot: %w", err)
+	}
+	if userID != 0 {
+		snapshot.CreatedBy = &userID
+	}
+
+	// The snapshot is usable from IPFS without its anchor; a failed anchor is retried on the next run
+	if anchored, err := s.Anchor(snapshot.ID); err != nil {
+		fmt.Printf("Warning: failed to anchor trace snapshot %d: %v\n", snapshot.ID, err)
+	} else {
+		snapshot = anchored
+	}
+	return snapshot, true, nil
+}
+
+// Anchor records the CID and content hash of a snapshot on-chain
+func (s *Service) Anchor(snapshotID int) (*Snapshot, error) {
+	snapshot, err := Get(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Status == StatusAnchored {
+		return snapshot, nil
+	}
+
+	payload := map[string]interface{}{
+		"batch_id":     snapshot.BatchID,
+		"version":      snapshot.Version,
+		"content_hash": snapshot.ContentHash,
+		"json_cid":     snapshot.JSONCID,
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}
+	if snapshot.HTMLCID != "" {
+		payload["html_cid"] = snapshot.HTMLCID
+	}
+
+	client := blockchain.NewBlockchainClient(
+		s.Config.BlockchainNodeURL,
+		s.Config.BlockchainPrivateKey,
+		s.Config.BlockchainAccount,
+		s.Config.BlockchainChainID,
+		s.Config.BlockchainConsensus,
+	)
+	txID, err := client.SubmitGenericTransaction(TxTypeTraceSnapshot, payload)
+	if err != nil {
+		if _, dbErr := db.DB.Exec("UPDATE trace_snapshot SET anchor_error = $2 WHERE id = $1", snapshotID, err.Error()); dbErr != nil {
+			return nil, dbErr
+		}
+		return nil, err
+	}
+
+	_, err = db.DB.Exec(`
+		UPDATE trace_snapshot SET status = $2, anchor_tx_id = $3, anchor_error = NULL, anchored_at = NOW()
+		WHERE id = $1
+	`, snapshotID, StatusAnchored, txID)
+	if err != nil {
+		return nil, err
+	}
+	return Get(snapshotID)
+}
+
+const snapshotColumns = `
+	id, batch_id, version, content_hash, json_cid, json_uri, COALESCE(html_cid, ''), COALESCE(html_uri, ''),
+	status, COALESCE(anchor_tx_id, ''), COALESCE(anchor_error, ''), anchored_at, created_by, created_at,
+	COALESCE(checked_at, created_at)
+`
+
+// Get loads a snapshot
+func Get(snapshotID int) (*Snapshot, error) {
+	return scanSnapshot(db.DB.QueryRow("SELECT "+snapshotColumns+" FROM trace_snapshot WHERE id = $1", snapshotID))
+}
+
+// Latest loads the newest snapshot of a batch; it returns sql.ErrNoRows when there is none
+func Latest(batchID int) (*Snapshot, error) {
+	return scanSnapshot(db.DB.QueryRow(
+		"SELECT "+snapshotColumns+" FROM trace_snapshot WHERE batch_id = $1 ORDER BY version DESC LIMIT 1", batchID))
+}
+
+// List loads every snapshot of a batch, newest first
+func List(batchID int) ([]Snapshot, error) {
+	rows, err := db.DB.Query(
+		"SELECT "+snapshotColumns+" FROM trace_snapshot WHERE batch_id = $1 ORDER BY version DESC", batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []Snapshot{}
+	for rows.Next() {
+		snapshot, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// scanSnapshot reads a row selected with snapshotColumns
+func scanSnapshot(row interface{ Scan(...interface{}) error }) (*Snapshot, error) {
+	var s Snapshot
+	var anchoredAt sql.NullTime
+	var createdBy sql.NullInt64
+	err := row.Scan(&s.ID, &s.BatchID, &s.Version, &s.ContentHash, &s.JSONCID, &s.JSONURI, &s.HTMLCID, &s.HTMLURI,
+		&s.Status, &s.AnchorTxID, &s.AnchorError, &anchoredAt, &createdBy, &s.CreatedAt, &s.CheckedAt)
+	if err != nil {
+		return nil, err
+	}
+	if anchoredAt.Valid {
+		s.AnchoredAt = &anchoredAt.Time
+	}
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		s.CreatedBy = &id
+	}
+	return &s, nil
+}
+
+// uploadURI prefers the Pinata gateway, which stays reachable without our IPFS node
+func uploadURI(upload *ipfs.IPFSPinataResult) string {
+	if upload.PinataSuccess && upload.PinataUri != "" {
+		return upload.PinataUri
+	}
+	return upload.IPFSUri
+}
+
+// scanIDs reads a column of IDs and closes the rows
+func scanIDs(rows *sql.Rows) []int {
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
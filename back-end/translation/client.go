@@ -0,0 +1,80 @@
+package translation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+)
+
+// Job is a document sent to an external translation service
+type Job struct {
+	Reference      string     `json:"reference"` // ID of the translation request
+	DocumentURI    string     `json:"document_uri"`
+	FileName       string     `json:"file_name"`
+	DocType        string     `json:"doc_type"`
+	SourceLanguage string     `json:"source_language,omitempty"`
+	TargetLanguage string     `json:"target_language"`
+	Certified      bool       `json:"certified"`
+	DueDate        *time.Time `json:"due_date,omitempty"`
+	Notes          string     `json:"notes,omitempty"`
+	// The service uploads the translated file to this URL as the multipart field "file"
+	CallbackURL string `json:"callback_url"`
+}
+
+// Client submits jobs to a translation service exposing POST {url}/jobs, which answers with the job ID
+type Client struct {
+	URL        string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a client from the application config
+func NewClient(cfg *config.Config) *Client {
+	return &Client{
+		URL:        strings.TrimSuffix(cfg.TranslationAPIURL, "/"),
+		APIKey:     cfg.TranslationAPIKey,
+		HTTPClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Enabled reports whether a translation service is configured
+func (c *Client) Enabled() bool {
+	return c.URL != ""
+}
+
+// Submit sends a job and returns the ID the service gave it
+func (c *Client) Submit(job Job) (string, error) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.URL+"/jobs", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("translation service returned status %d", resp.StatusCode)
+	}
+	var accepted struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&accepted); err != nil {
+		return "", fmt.Errorf("invalid translation service response: %w", err)
+	}
+	return accepted.ID, nil
+}
@@ -0,0 +1,161 @@
+package usage
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Call is one metered API request
+type Call struct {
+	CompanyID int    // 0 when the caller is not attributed to a company
+	APIKey    string // Key the caller authenticated with, empty for user sessions
+	Method    string
+	Route     string // Route pattern, e.g. /api/v1/batches/:batchId, so IDs do not split the counts
+	Status    int
+	Duration  time.Duration
+	At        time.Time
+}
+
+// key identifies one row of the daily usage table
+type key struct {
+	day       string
+	companyID int
+	apiKey    string
+	method    string
+	route     string
+}
+
+// counter accumulates calls of one key between flushes
+type counter struct {
+	calls      int64
+	errors     int64
+	durationMs float64
+	lastCalled time.Time
+}
+
+// Meter counts API calls in memory and adds them to the daily usage table on every flush,
+// so metering does not cost a database write per request
+type Meter struct {
+	Interval time.Duration
+
+	mu       sync.Mutex
+	counters map[key]*counter
+}
+
+var (
+	defaultMeter *Meter
+	once         sync.Once
+)
+
+// NewMeter creates a usage meter from the application config
+func NewMeter(cfg *config.Config) *Meter {
+	return &Meter{
+		Interval: time.Duration(cfg.UsageFlushIntervalSeconds) * time.Second,
+		counters: make(map[key]*counter),
+	}
+}
+
+// Default returns the process wide usage meter
+func Default() *Meter {
+	once.Do(func() {
+		defaultMeter = NewMeter(config.GetConfig())
+	})
+	return defaultMeter
+}
+
+// Record counts a call; responses with a 4xx or 5xx status also count as errors
+func (m *Meter) Record(call Call) {
+	if call.At.IsZero() {
+		call.At = time.Now()
+	}
+	k := key{
+		day:       call.At.UTC().Format("2006-01-02"),
+		companyID: call.CompanyID,
+		apiKey:    call.APIKey,
+		method:    call.Method,
+		route:     call.Route,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.counters[k]
+	if !ok {
+		c = &counter{}
+		m.counters[k] = c
+	}
+	c.calls++
+	if call.Status >= 400 {
+		c.errors++
+	}
+	c.durationMs += float64(call.Duration) / float64(time.Millisecond)
+	if call.At.After(c.lastCalled) {
+		c.lastCalled = call.At
+	}
+}
+
+// Start flushes the counted calls periodically
+func (m *Meter) Start() {
+	go func() {
+		for {
+			time.Sleep(m.Interval)
+
+			if err := m.Flush(); err != nil {
+				fmt.Printf("Warning: API usage flush failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// Flush adds the calls counted since the last flush to the daily usage table
+// Counts that could not be written are kept for the next flush
+func (m *Meter) Flush() error {
+	if db.DB == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	pending := m.counters
+	m.counters = make(map[key]*counter)
+	m.mu.Unlock()
+
+	var firstErr error
+	for k, c := range pending {
+		_, err := db.DB.Exec(`
+			INSERT INTO api_usage_daily (usage_date, company_id, api_key, method, route, call_count, error_count, total_duration_ms, last_called_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (usage_date, company_id, api_key, method, route) DO UPDATE SET
+				call_count = api_usage_daily.call_count + EXCLUDED.call_count,
+				error_count = api_usage_daily.error_count + EXCLUDED.error_count,
+				total_duration_ms = api_usage_daily.total_duration_ms + EXCLUDED.total_duration_ms,
+				last_called_at = GREATEST(api_usage_daily.last_called_at, EXCLUDED.last_called_at)
+		`, k.day, k.companyID, k.apiKey, k.method, k.route, c.calls, c.errors, c.durationMs, c.lastCalled)
+		if err != nil {
+			m.restore(k, c)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to write API usage: %w", err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// restore puts counts that failed to flush back into the meter
+func (m *Meter) restore(k key, c *counter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.counters[k]
+	if !ok {
+		m.counters[k] = c
+		return
+	}
+	current.calls += c.calls
+	current.errors += c.errors
+	current.durationMs += c.durationMs
+	if c.lastCalled.After(current.lastCalled) {
+		current.lastCalled = c.lastCalled
+	}
+}
@@ -0,0 +1,335 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GS1 group separator (FNC1 in variable length fields)
+const gs1GroupSeparator = "\x1d"
+
+// Symbology names reported by ParseGS1Barcode
+const (
+	SymbologyGS1128      = "GS1-128"
+	SymbologyDataMatrix  = "GS1 DataMatrix"
+	SymbologyGS1QR       = "GS1 QR Code"
+	SymbologyDataBar     = "GS1 DataBar"
+	SymbologyDigitalLink = "GS1 Digital Link"
+	SymbologyUnknown     = "unknown"
+)
+
+// gs1AI describes the format of a GS1 application identifier
+type gs1AI struct {
+	Name   string
+	Length int // fixed data length, 0 for variable length
+	Max    int // maximum data length for variable length fields
+}
+
+// gs1AITable lists the application identifiers understood by the scanner
+var gs1AITable = map[string]gs1AI{
+	"00":  {Name: "SSCC", Length: 18},
+	"01":  {Name: "GTIN", Length: 14},
+	"02":  {Name: "CONTENT", Length: 14},
+	"10":  {Name: "BATCH/LOT", Max: 20},
+	"11":  {Name: "PROD DATE", Length: 6},
+	"12":  {Name: "DUE DATE", Length: 6},
+	"13":  {Name: "PACK DATE", Length: 6},
+	"15":  {Name: "BEST BEFORE", Length: 6},
+	"16":  {Name: "SELL BY", Length: 6},
+	"17":  {Name: "USE BY", Length: 6},
+	"20":  {Name: "VARIANT", Length: 2},
+	"21":  {Name: "SERIAL", Max: 20},
+	"22":  {Name: "CPV", Max: 20},
+	"30":  {Name: "VAR. COUNT", Max: 8},
+	"37":  {Name: "COUNT", Max: 8},
+	"240": {Name: "ADDITIONAL ID", Max: 30},
+	"241": {Name: "CUST. PART NO.", Max: 30},
+	"250": {Name: "SECONDARY SERIAL", Max: 30},
+	"400": {Name: "ORDER NUMBER", Max: 30},
+	"410": {Name: "SHIP TO LOC", Length: 13},
+	"411": {Name: "BILL TO", Length: 13},
+	"412": {Name: "PURCHASE FROM", Length: 13},
+	"413": {Name: "SHIP FOR LOC", Length: 13},
+	"414": {Name: "LOC No.", Length: 13},
+	"415": {Name: "PAY TO", Length: 13},
+	"422": {Name: "ORIGIN", Length: 3},
+}
+
+// lookupGS1AI finds the application identifier at the start of s
+func lookupGS1AI(s string) (string, gs1AI, bool) {
+	// Measures (31nn-36nn) share a fixed 6 digit format with a 4 digit AI
+	if len(s) >= 4 && s[0] == '3' && s[1] >= '1' && s[1] <= '6' && isDigits(s[:4]) {
+		return s[:4], gs1AI{Name: "MEASURE", Length: 6}, true
+	}
+	for _, n := range []int{2, 3, 4} {
+		if len(s) < n {
+			break
+		}
+		if ai, ok := gs1AITable[s[:n]]; ok {
+			return s[:n], ai, true
+		}
+	}
+	return "", gs1AI{}, false
+}
+
+// GS1ScanResult holds the decoded content of a scanned GS1 barcode
+type GS1ScanResult struct {
+	Symbology      string            `json:"symbology"`
+	Elements       map[string]string `json:"elements"`
+	GTIN           string            `json:"gtin,omitempty"`
+	SSCC           string            `json:"sscc,omitempty"`
+	GLN            string            `json:"gln,omitempty"`
+	Lot            string            `json:"lot,omitempty"`
+	Serial         string            `json:"serial,omitempty"`
+	ProductionDate string            `json:"production_date,omitempty"`
+	BestBefore     string            `json:"best_before,omitempty"`
+	ExpiryDate     string            `json:"expiry_date,omitempty"`
+	Count          int               `json:"count,omitempty"`
+}
+
+// ParseGS1Barcode decodes a scanned GS1-128, DataMatrix, QR or Digital Link string
+// Human readable form "(01)...(10)..." and raw form with GS separators are both accepted
+func ParseGS1Barcode(raw string) (*GS1ScanResult, error) {
+	data := strings.TrimSpace(raw)
+	if data == "" {
+		return nil, errors.New("empty barcode")
+	}
+
+	result := &GS1ScanResult{Symbology: SymbologyUnknown, Elements: map[string]string{}}
+
+	// Scanners may prefix the data with an AIM symbology identifier
+	switch {
+	case strings.HasPrefix(data, "]C1"):
+		result.Symbology = SymbologyGS1128
+		data = data[3:]
+	case strings.HasPrefix(data, "]d2"):
+		result.Symbology = SymbologyDataMatrix
+		data = data[3:]
+	case strings.HasPrefix(data, "]Q3"):
+		result.Symbology = SymbologyGS1QR
+		data = data[3:]
+	case strings.HasPrefix(data, "]e0"):
+		result.Symbology = SymbologyDataBar
+		data = data[3:]
+	}
+
+	// Some keyboard wedge scanners emit the separator as text
+	data = strings.NewReplacer("<GS>", gs1GroupSeparator, "{GS}", gs1GroupSeparator).Replace(data)
+
+	var err error
+	switch {
+	case strings.HasPrefix(data, "http://") || strings.HasPrefix(data, "https://"):
+		result.Symbology = SymbologyDigitalLink
+		err = parseGS1DigitalLink(data, result.Elements)
+	case strings.HasPrefix(data, "("):
+		err = parseGS1Bracketed(data, result.Elements)
+	default:
+		err = parseGS1Raw(data, result.Elements)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := result.interpret(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parseGS1Bracketed parses the human readable "(AI)value" form
+func parseGS1Bracketed(data string, elements map[string]string) error {
+	for len(data) > 0 {
+		if data[0] != '(' {
+			return errors.New("malformed GS1 element string")
+		}
+		end := strings.IndexByte(data, ')')
+		if end < 0 {
+			return errors.New("malformed GS1 element string")
+		}
+		ai := data[1:end]
+		data = data[end+1:]
+		next := strings.IndexByte(data, '(')
+		value := data
+		if next >= 0 {
+			value = data[:next]
+			data = data[next:]
+		} else {
+			data = ""
+		}
+		if err := addGS1Element(elements, ai, strings.TrimSuffix(value, gs1GroupSeparator)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseGS1Raw parses concatenated element strings as encoded in the barcode
+func parseGS1Raw(data string, elements map[string]string) error {
+	data = strings.TrimPrefix(data, gs1GroupSeparator)
+	for len(data) > 0 {
+		ai, def, ok := lookupGS1AI(data)
+		if !ok {
+			return fmt.Errorf("unknown GS1 application identifier at %q", data)
+		}
+		data = data[len(ai):]
+
+		var value string
+		if def.Length > 0 {
+			if len(data) < def.Length {
+				return fmt.Errorf("AI (%s) is too short", ai)
+			}
+			value = data[:def.Length]
+			data = data[def.Length:]
+		} else {
+			end := strings.Index(data, gs1GroupSeparator)
+			if end < 0 {
+				end = len(data)
+			}
+			value = data[:end]
+			data = data[end:]
+		}
+		data = strings.TrimPrefix(data, gs1GroupSeparator)
+
+		if err := addGS1Element(elements, ai, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseGS1DigitalLink extracts AIs from the path and query of a GS1 Digital Link URI
+func parseGS1DigitalLink(data string, elements map[string]string) error {
+	u, err := url.Parse(data)
+	if err != nil {
+		return errors.New("invalid GS1 Digital Link")
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	// Resolvers may add their own path before the primary key
+	start := -1
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i] == "01" || segments[i] == "00" || segments[i] == "414" {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return errors.New("GS1 Digital Link has no primary key")
+	}
+	for i := start; i+1 < len(segments); i += 2 {
+		value, err := url.PathUnescape(segments[i+1])
+		if err != nil {
+			return errors.New("invalid GS1 Digital Link")
+		}
+		if err := addGS1Element(elements, segments[i], value); err != nil {
+			return err
+		}
+	}
+	for key, values := range u.Query() {
+		if _, _, ok := lookupGS1AI(key); ok && isDigits(key) && len(values) > 0 {
+			if err := addGS1Element(elements, key, values[0]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addGS1Element validates a single AI value against its format
+func addGS1Element(elements map[string]string, ai, value string) error {
+	found, def, ok := lookupGS1AI(ai)
+	if !ok || found != ai {
+		return fmt.Errorf("unknown GS1 application identifier (%s)", ai)
+	}
+	if def.Length > 0 && len(value) != def.Length {
+		return fmt.Errorf("AI (%s) must be %d characters", ai, def.Length)
+	}
+	if def.Max > 0 && (len(value) == 0 || len(value) > def.Max) {
+		return fmt.Errorf("AI (%s) must be 1 to %d characters", ai, def.Max)
+	}
+	elements[ai] = value
+	return nil
+}
+
+// interpret fills the typed fields from the raw elements
+func (r *GS1ScanResult) interpret() error {
+	if len(r.Elements) == 0 {
+		return errors.New("no GS1 data found")
+	}
+
+	for ai, length := range map[string]int{"00": 18, "01": 14, "02": 14, "414": 13} {
+		if value, ok := r.Elements[ai]; ok {
+			if err := ValidateGS1Key(value, length); err != nil {
+				return fmt.Errorf("AI (%s): %v", ai, err)
+			}
+		}
+	}
+
+	r.SSCC = r.Elements["00"]
+	r.GTIN = r.Elements["01"]
+	if r.GTIN == "" {
+		r.GTIN = r.Elements["02"]
+	}
+	r.GLN = r.Elements["414"]
+	r.Lot = r.Elements["10"]
+	r.Serial = r.Elements["21"]
+
+	var err error
+	if r.ProductionDate, err = parseGS1Date(r.Elements["11"]); err != nil {
+		return fmt.Errorf("AI (11): %v", err)
+	}
+	if r.BestBefore, err = parseGS1Date(r.Elements["15"]); err != nil {
+		return fmt.Errorf("AI (15): %v", err)
+	}
+	if r.ExpiryDate, err = parseGS1Date(r.Elements["17"]); err != nil {
+		return fmt.Errorf("AI (17): %v", err)
+	}
+	if count, ok := r.Elements["37"]; ok {
+		if r.Count, err = strconv.Atoi(count); err != nil {
+			return errors.New("AI (37): count must be numeric")
+		}
+	}
+	return nil
+}
+
+// parseGS1Date converts a YYMMDD date to YYYY-MM-DD; day 00 means the last day of the month
+func parseGS1Date(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if len(value) != 6 || !isDigits(value) {
+		return "", errors.New("date must be in YYMMDD format")
+	}
+	year, _ := strconv.Atoi(value[0:2])
+	month, _ := strconv.Atoi(value[2:4])
+	day, _ := strconv.Atoi(value[4:6])
+	if month < 1 || month > 12 {
+		return "", errors.New("invalid month")
+	}
+	year += 2000
+	if day == 0 {
+		return time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Format("2006-01-02"), nil
+	}
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Day() != day {
+		return "", errors.New("invalid day")
+	}
+	return t.Format("2006-01-02"), nil
+}
+
+// isDigits reports whether s consists only of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
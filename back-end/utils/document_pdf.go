@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// PDFSection is a block of text lines under an optional heading
+type PDFSection struct {
+	Heading string
+	Lines   []string
+}
+
+// A4 page geometry in points
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+	pdfMargin     = 50.0
+	pdfFontSize   = 10.0
+	pdfLineHeight = 14.0
+	pdfWrapWidth  = 90 // Characters per line of 10pt Helvetica within the margins
+)
+
+// pdfLine is a line of text waiting to be laid out on a page
+type pdfLine struct {
+	text     string
+	fontSize float64
+	bold     bool
+}
+
+// wrapPDFText splits a line into chunks of at most width characters, breaking on spaces where possible
+func wrapPDFText(s string, width int) []string {
+	if len(s) <= width {
+		return []string{s}
+	}
+	var lines []string
+	for len(s) > width {
+		cut := strings.LastIndex(s[:width], " ")
+		if cut <= 0 {
+			cut = width
+		}
+		lines = append(lines, strings.TrimRight(s[:cut], " "))
+		s = strings.TrimLeft(s[cut:], " ")
+	}
+	if s != "" {
+		lines = append(lines, s)
+	}
+	return lines
+}
+
+// RenderTextPDF renders a title and sections of text as an A4 PDF document, adding pages as needed
+func RenderTextPDF(title string, sections []PDFSection) []byte {
+	lines := []pdfLine{{text: title, fontSize: 16, bold: true}, {}}
+	for _, section := range sections {
+		if section.Heading != "" {
+			lines = append(lines, pdfLine{text: section.Heading, fontSize: 12, bold: true})
+		}
+		for _, line := range section.Lines {
+			for _, chunk := range wrapPDFText(line, pdfWrapWidth) {
+				lines = append(lines, pdfLine{text: chunk, fontSize: pdfFontSize})
+			}
+		}
+		lines = append(lines, pdfLine{})
+	}
+
+	// Lay the lines out top to bottom, starting a new page when the bottom margin is reached
+	var pages []*bytes.Buffer
+	var page *bytes.Buffer
+	y := 0.0
+	for _, line := range lines {
+		height := pdfLineHeight
+		if line.fontSize > pdfFontSize {
+			height = line.fontSize + 6
+		}
+		if page == nil || y-height < pdfMargin {
+			if page != nil {
+				page.WriteString("ET\n")
+			}
+			page = &bytes.Buffer{}
+			pages = append(pages, page)
+			page.WriteString("BT\n")
+			y = pdfPageHeight - pdfMargin
+		}
+		y -= height
+		if line.text == "" {
+			continue
+		}
+		font := "F1"
+		if line.bold {
+			font = "F2"
+		}
+		page.WriteString(fmt.Sprintf("/%s %.1f Tf\n1 0 0 1 %.2f %.2f Tm\n(%s) Tj\n", font, line.fontSize, pdfMargin, y, escapePDFText(line.text)))
+	}
+	page.WriteString("ET\n")
+
+	// Objects: catalog, page tree, regular and bold fonts, then a page and content stream per page
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	}
+	for i, content := range pages {
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 6+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+
+	return assemblePDF(objects)
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unit systems responses can be rendered in; values are stored metric
+const (
+	UnitSystemMetric   = "metric"
+	UnitSystemImperial = "imperial"
+)
+
+// FormatOptions controls how a JSON response is rendered for the client
+type FormatOptions struct {
+	Locale     string         // e.g. en-US, vi, de-DE
+	UnitSystem string         // metric or imperial
+	Location   *time.Location // Time zone timestamps are rendered in; nil keeps them as stored
+	Localized  bool           // Add human readable "<field>_display" strings next to timestamps and measurements
+}
+
+// IsDefault reports whether the options leave a response unchanged
+func (o FormatOptions) IsDefault() bool {
+	return o.UnitSystem != UnitSystemImperial && o.Location == nil && !o.Localized
+}
+
+// unitConversion converts a metric field to its imperial counterpart
+type unitConversion struct {
+	metricSuffix   string
+	imperialSuffix string
+	unit           string // Unit shown in display strings
+	convert        func(float64) float64
+}
+
+// unitConversions are keyed by the field name suffix that names the metric unit
+var unitConversions = []unitConversion{
+	{"_kg", "_lb", "lb", func(v float64) float64 { return v * 2.20462262 }},
+	{"_kmh", "_mph", "mph", func(v float64) float64 { return v * 0.621371192 }},
+	{"_km", "_mi", "mi", func(v float64) float64 { return v * 0.621371192 }},
+	{"_meters", "_feet", "ft", func(v float64) float64 { return v * 3.2808399 }},
+}
+
+// metricUnits are the units shown in display strings when no conversion applies
+var metricUnits = map[string]string{"_kg": "kg", "_kmh": "km/h", "_km": "km", "_meters": "m"}
+
+// isTemperatureField reports whether a field holds a temperature, which is stored in degrees Celsius
+func isTemperatureField(key string) bool {
+	return key == "temperature" || strings.HasSuffix(key, "_temperature")
+}
+
+// localeStyle holds the separators and date layout of a locale
+type localeStyle struct {
+	decimal    string
+	group      string
+	dateLayout string
+}
+
+// localeStyles are keyed by language, with region specific entries where they differ
+var localeStyles = map[string]localeStyle{
+	"en":    {".", ",", "Jan 2, 2006 15:04"},
+	"en-us": {".", ",", "01/02/2006 3:04 PM"},
+	"en-gb": {".", ",", "02/01/2006 15:04"},
+	"vi":    {",", ".", "02/01/2006 15:04"},
+	"de":    {",", ".", "02.01.2006 15:04"},
+	"fr":    {",", " ", "02/01/2006 15:04"},
+	"es":    {",", ".", "02/01/2006 15:04"},
+	"it":    {",", ".", "02/01/2006 15:04"},
+	"ru":    {",", " ", "02.01.2006 15:04"},
+	"zh":    {".", ",", "2006/01/02 15:04"},
+	"ja":    {".", ",", "2006/01/02 15:04"},
+	"ko":    {".", ",", "2006. 01. 02. 15:04"},
+}
+
+// styleFor picks the style of a locale, falling back from region to language to English
+func styleFor(locale string) localeStyle {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if style, ok := localeStyles[locale]; ok {
+		return style
+	}
+	if i := strings.Index(locale, "-"); i > 0 {
+		if style, ok := localeStyles[locale[:i]]; ok {
+			return style
+		}
+	}
+	return localeStyles["en"]
+}
+
+// SupportedLocale reports whether a locale has its own number and date style
+func SupportedLocale(locale string) bool {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if i := strings.Index(locale, "-"); i > 0 {
+		locale = locale[:i]
+	}
+	_, ok := localeStyles[locale]
+	return ok
+}
+
+// FormatNumber renders a number with the locale's grouping and decimal separators
+func FormatNumber(value float64, decimals int, locale string) string {
+	style := styleFor(locale)
+	s := strconv.FormatFloat(math.Abs(value), 'f', decimals, 64)
+	intPart, fracPart := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+
+	var grouped strings.Builder
+	for i, digit := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			grouped.WriteString(style.group)
+		}
+		grouped.WriteRune(digit)
+	}
+	out := grouped.String()
+	if fracPart != "" {
+		out += style.decimal + fracPart
+	}
+	if value < 0 && strings.Trim(s, "0.") != "" {
+		out = "-" + out
+	}
+	return out
+}
+
+// FormatDate renders a timestamp with the locale's date layout
+func FormatDate(t time.Time, locale string) string {
+	return t.Format(styleFor(locale).dateLayout)
+}
+
+// roundTo rounds a converted value so conversions do not produce long fractions
+func roundTo(value float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(value*p) / p
+}
+
+// FormatJSON applies the options to a JSON document: measurements are converted to the unit system,
+// timestamps are moved to the time zone and display strings are added when localized output is requested
+func FormatJSON(body []byte, opts FormatOptions) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber() // Keep IDs and other integers exactly as they were
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(formatValue(doc, opts))
+}
+
+// formatValue walks a decoded JSON value and formats the objects within it
+func formatValue(value interface{}, opts FormatOptions) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return formatObject(v, opts)
+	case []interface{}:
+		for i := range v {
+			v[i] = formatValue(v[i], opts)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// formatObject formats the fields of one JSON object
+func formatObject(obj map[string]interface{}, opts FormatOptions) map[string]interface{} {
+	out := make(map[string]interface{}, len(obj))
+	for key, value := range obj {
+		switch v := value.(type) {
+		case json.Number:
+			number, err := v.Float64()
+			if err != nil {
+				out[key] = v
+				continue
+			}
+			formatMeasurement(out, key, v, number, opts)
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				out[key] = v
+				continue
+			}
+			if opts.Location != nil {
+				t = t.In(opts.Location)
+				out[key] = t.Format(time.RFC3339Nano)
+			} else {
+				out[key] = v
+			}
+			if opts.Localized {
+				out[key+"_display"] = FormatDate(t, opts.Locale)
+			}
+		default:
+			out[key] = formatValue(v, opts)
+		}
+	}
+	return out
+}
+
+// formatMeasurement writes a numeric field, converting it when its name identifies a metric measurement
+func formatMeasurement(out map[string]interface{}, key string, raw json.Number, number float64, opts FormatOptions) {
+	imperial := opts.UnitSystem == UnitSystemImperial
+
+	if isTemperatureField(key) {
+		unit := "°C"
+		if imperial {
+			number = roundTo(number*9/5+32, 2)
+			unit = "°F"
+			out[key] = number
+		} else {
+			out[key] = raw
+		}
+		if opts.Localized {
+			out[key+"_display"] = FormatNumber(number, 1, opts.Locale) + " " + unit
+		}
+		return
+	}
+
+	for _, conversion := range unitConversions {
+		if !strings.HasSuffix(key, conversion.metricSuffix) {
+			continue
+		}
+		name, unit := key, metricUnits[conversion.metricSuffix]
+		if imperial {
+			name = strings.TrimSuffix(key, conversion.metricSuffix) + conversion.imperialSuffix
+			number = roundTo(conversion.convert(number), 3)
+			unit = conversion.unit
+			out[name] = number
+		} else {
+			out[name] = raw
+		}
+		if opts.Localized {
+			out[name+"_display"] = FormatNumber(number, 2, opts.Locale) + " " + unit
+		}
+		return
+	}
+
+	out[key] = raw
+}
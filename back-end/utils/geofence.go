@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"errors"
+	"math"
+)
+
+// Geofence types supported for shipments
+const (
+	GeofenceCorridor       = "corridor"        // expected route with a buffer on each side
+	GeofenceRestrictedZone = "restricted_zone" // area the transport must not enter
+)
+
+// Geofence describes an expected corridor or a restricted zone
+// Coordinates are GeoJSON style [longitude, latitude] pairs
+type Geofence struct {
+	Type         string      `json:"fence_type"`
+	Coordinates  [][]float64 `json:"coordinates"`
+	BufferMeters float64     `json:"buffer_meters,omitempty"` // corridor half-width
+	RadiusMeters float64     `json:"radius_meters,omitempty"` // circular zone around the first coordinate
+}
+
+// Validate checks that a geofence has a usable geometry
+func (g Geofence) Validate() error {
+	for _, c := range g.Coordinates {
+		if len(c) != 2 || c[0] < -180 || c[0] > 180 || c[1] < -90 || c[1] > 90 {
+			return errors.New("coordinates must be [longitude, latitude] pairs")
+		}
+	}
+	switch g.Type {
+	case GeofenceCorridor:
+		if len(g.Coordinates) < 2 {
+			return errors.New("a corridor needs at least two coordinates")
+		}
+		if g.BufferMeters <= 0 {
+			return errors.New("a corridor needs a positive buffer_meters")
+		}
+	case GeofenceRestrictedZone:
+		if g.RadiusMeters > 0 {
+			if len(g.Coordinates) != 1 {
+				return errors.New("a circular zone needs exactly one center coordinate")
+			}
+		} else if len(g.Coordinates) < 3 {
+			return errors.New("a polygon zone needs at least three coordinates")
+		}
+	default:
+		return errors.New("fence_type must be corridor or restricted_zone")
+	}
+	return nil
+}
+
+// Violated reports whether a position breaks the geofence: outside a corridor or inside a restricted zone
+func (g Geofence) Violated(lat, lng float64) bool {
+	switch g.Type {
+	case GeofenceCorridor:
+		return DistanceToPolylineMeters(lat, lng, g.Coordinates) > g.BufferMeters
+	case GeofenceRestrictedZone:
+		if g.RadiusMeters > 0 {
+			center := g.Coordinates[0]
+			return HaversineKM(lat, lng, center[1], center[0])*1000 <= g.RadiusMeters
+		}
+		return PointInPolygon(lat, lng, g.Coordinates)
+	}
+	return false
+}
+
+// PointInPolygon reports whether a position lies inside a polygon using ray casting
+func PointInPolygon(lat, lng float64, polygon [][]float64) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		xi, yi := polygon[i][0], polygon[i][1]
+		xj, yj := polygon[j][0], polygon[j][1]
+		if (yi > lat) != (yj > lat) && lng < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// DistanceToPolylineMeters returns the shortest distance from a position to a polyline
+// Segments are projected onto a local flat plane, which is accurate for corridor sized distances
+func DistanceToPolylineMeters(lat, lng float64, line [][]float64) float64 {
+	const metersPerDegree = earthRadiusKM * 1000 * math.Pi / 180
+	cosLat := math.Cos(lat * math.Pi / 180)
+	project := func(c []float64) (float64, float64) {
+		return (c[0] - lng) * metersPerDegree * cosLat, (c[1] - lat) * metersPerDegree
+	}
+
+	best := math.Inf(1)
+	for i := 1; i < len(line); i++ {
+		ax, ay := project(line[i-1])
+		bx, by := project(line[i])
+		dx, dy := bx-ax, by-ay
+
+		// Closest point on segment AB to the origin (the position itself)
+		t := 0.0
+		if lengthSq := dx*dx + dy*dy; lengthSq > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lengthSq))
+		}
+		px, py := ax+t*dx, ay+t*dy
+		if d := math.Hypot(px, py); d < best {
+			best = d
+		}
+	}
+	return best
+}
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GS1 identifier types managed by the platform
+const (
+	GS1TypeGTIN = "GTIN"
+	GS1TypeGLN  = "GLN"
+	GS1TypeSSCC = "SSCC"
+)
+
+// GS1CheckDigit computes the GS1 mod-10 check digit for a string of digits
+func GS1CheckDigit(digits string) (int, error) {
+	sum := 0
+	// Weights alternate 3,1,3,... starting from the rightmost digit
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if d < '0' || d > '9' {
+			return 0, fmt.Errorf("invalid digit %q in GS1 key", d)
+		}
+		weight := 1
+		if (len(digits)-1-i)%2 == 0 {
+			weight = 3
+		}
+		sum += int(d-'0') * weight
+	}
+	return (10 - sum%10) % 10, nil
+}
+
+// ValidateGS1Key checks the length and check digit of a complete GS1 key
+func ValidateGS1Key(key string, length int) error {
+	if len(key) != length {
+		return fmt.Errorf("GS1 key must be %d digits", length)
+	}
+	check, err := GS1CheckDigit(key[:length-1])
+	if err != nil {
+		return err
+	}
+	if int(key[length-1]-'0') != check {
+		return errors.New("invalid GS1 check digit")
+	}
+	return nil
+}
+
+// ValidateGS1CompanyPrefix checks that a company prefix has a valid shape
+func ValidateGS1CompanyPrefix(prefix string) error {
+	if len(prefix) < 6 || len(prefix) > 12 {
+		return errors.New("GS1 company prefix must be between 6 and 12 digits")
+	}
+	if _, err := strconv.ParseUint(prefix, 10, 64); err != nil {
+		return errors.New("GS1 company prefix must contain only digits")
+	}
+	return nil
+}
+
+// GS1Capacity returns how many references of a type can be allocated under a prefix
+func GS1Capacity(idType, prefix string) int64 {
+	refDigits := gs1ReferenceDigits(idType, prefix)
+	if refDigits <= 0 {
+		return 0
+	}
+	capacity := int64(1)
+	for i := 0; i < refDigits; i++ {
+		capacity *= 10
+	}
+	return capacity
+}
+
+// gs1ReferenceDigits returns the number of digits left for the reference part of a key
+func gs1ReferenceDigits(idType, prefix string) int {
+	switch idType {
+	case GS1TypeGTIN:
+		// GTIN-13 body: prefix + item reference = 12 digits
+		return 12 - len(prefix)
+	case GS1TypeGLN:
+		// GLN body: prefix + location reference = 12 digits
+		return 12 - len(prefix)
+	case GS1TypeSSCC:
+		// SSCC body: extension digit + prefix + serial reference = 17 digits
+		return 16 - len(prefix)
+	}
+	return 0
+}
+
+// BuildGS1Key builds a complete GS1 key of the given type from a prefix and reference number
+func BuildGS1Key(idType, prefix string, reference int64, extension int) (string, error) {
+	if err := ValidateGS1CompanyPrefix(prefix); err != nil {
+		return "", err
+	}
+	refDigits := gs1ReferenceDigits(idType, prefix)
+	if refDigits <= 0 {
+		return "", fmt.Errorf("unsupported GS1 identifier type %s", idType)
+	}
+	if reference < 0 || reference >= GS1Capacity(idType, prefix) {
+		return "", fmt.Errorf("%s reference %d exceeds the capacity of prefix %s", idType, reference, prefix)
+	}
+	ref := fmt.Sprintf("%0*d", refDigits, reference)
+
+	var body string
+	switch idType {
+	case GS1TypeGTIN:
+		// Indicator digit 0 keeps the GTIN-14 equivalent to a GTIN-13
+		body = "0" + prefix + ref
+	case GS1TypeGLN:
+		body = prefix + ref
+	case GS1TypeSSCC:
+		if extension < 0 || extension > 9 {
+			return "", errors.New("SSCC extension digit must be between 0 and 9")
+		}
+		body = strconv.Itoa(extension) + prefix + ref
+	}
+
+	check, err := GS1CheckDigit(body)
+	if err != nil {
+		return "", err
+	}
+	return body + strconv.Itoa(check), nil
+}
+
+// GS1EPCURI converts a GS1 key into its EPC pure identity URI
+// The optional serial is used for SGTIN (or LGTIN when lot is true)
+func GS1EPCURI(idType, key, prefix, serial string, lot bool) (string, error) {
+	if len(key) != GS1KeyLength(idType) {
+		return "", fmt.Errorf("invalid %s length", idType)
+	}
+	offset := gs1PrefixOffset(idType)
+	if len(key) < offset+len(prefix) || key[offset:offset+len(prefix)] != prefix {
+		return "", errors.New("GS1 key does not belong to the given company prefix")
+	}
+	switch idType {
+	case GS1TypeGTIN:
+		// indicator digit moves in front of the item reference
+		itemRef := key[0:1] + key[1+len(prefix):13]
+		if lot {
+			return fmt.Sprintf("urn:epc:class:lgtin:%s.%s.%s", prefix, itemRef, serial), nil
+		}
+		return fmt.Sprintf("urn:epc:id:sgtin:%s.%s.%s", prefix, itemRef, serial), nil
+	case GS1TypeGLN:
+		locationRef := key[len(prefix):12]
+		return fmt.Sprintf("urn:epc:id:sgln:%s.%s.0", prefix, locationRef), nil
+	case GS1TypeSSCC:
+		serialRef := key[0:1] + key[1+len(prefix):17]
+		return fmt.Sprintf("urn:epc:id:sscc:%s.%s", prefix, serialRef), nil
+	}
+	return "", fmt.Errorf("unsupported GS1 identifier type %s", idType)
+}
+
+// GS1KeyLength returns the number of digits of a complete key of the given type
+func GS1KeyLength(idType string) int {
+	switch idType {
+	case GS1TypeGTIN:
+		return 14
+	case GS1TypeGLN:
+		return 13
+	case GS1TypeSSCC:
+		return 18
+	}
+	return 0
+}
+
+// gs1PrefixOffset returns where the company prefix starts inside a key of the given type
+func gs1PrefixOffset(idType string) int {
+	if idType == GS1TypeGLN {
+		return 0
+	}
+	return 1
+}
+
+// GS1ElementString builds a human readable GS1-128 element string for a lot
+func GS1ElementString(gtin, lot string) string {
+	if lot == "" {
+		return "(01)" + gtin
+	}
+	return "(01)" + gtin + "(10)" + lot
+}
+
+// GS1DigitalLink builds a GS1 Digital Link URI for a GTIN and optional lot
+func GS1DigitalLink(resolver, gtin, lot string) string {
+	if resolver == "" {
+		resolver = "https://id.gs1.org"
+	}
+	link := strings.TrimSuffix(resolver, "/") + "/01/" + gtin
+	if lot != "" {
+		link += "/10/" + lot
+	}
+	return link
+}
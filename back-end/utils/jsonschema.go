@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JSONSchema is the subset of JSON Schema (draft-07) used to describe JSON documents such as event metadata
+// Unsupported keywords are rejected when parsing, so a schema never silently accepts what it seems to forbid
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"` // object, array, string, number, integer or boolean
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Format               string                 `json:"format,omitempty"` // date-time or date
+	Pattern              string                 `json:"pattern,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+	Examples             []interface{}          `json:"examples,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// ParseJSONSchema parses and checks a schema
+func ParseJSONSchema(raw []byte) (*JSONSchema, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	var schema JSONSchema
+	if err := decoder.Decode(&schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if err := schema.compile("schema"); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// compile checks the keywords of a schema and its subschemas
+func (s *JSONSchema) compile(path string) error {
+	switch s.Type {
+	case "", "object", "array", "string", "number", "integer", "boolean":
+	default:
+		return fmt.Errorf("%s: unsupported type %q", path, s.Type)
+	}
+	switch s.Format {
+	case "", "date-time", "date":
+	default:
+		return fmt.Errorf("%s: unsupported format %q", path, s.Format)
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %v", path, err)
+		}
+		s.pattern = pattern
+	}
+	for name, property := range s.Properties {
+		if property == nil {
+			return fmt.Errorf("%s.%s: schema is empty", path, name)
+		}
+		if err := property.compile(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile(path + "[]")
+	}
+	return nil
+}
+
+// Validate checks a decoded JSON value against the schema and lists every violation
+// Each violation starts with the path of the offending value, rooted at path
+func (s *JSONSchema) Validate(value interface{}, path string) []string {
+	var problems []string
+
+	if len(s.Enum) > 0 && !enumContains(s.Enum, value) {
+		values := make([]string, len(s.Enum))
+		for i, v := range s.Enum {
+			values[i] = fmt.Sprint(v)
+		}
+		problems = append(problems, fmt.Sprintf("%s must be one of %s", path, strings.Join(values, ", ")))
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return append(problems, path+" must be an object")
+		}
+		for _, name := range s.Required {
+			if v, ok := object[name]; !ok || v == nil {
+				problems = append(problems, path+"."+name+" is required")
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, known := s.Properties[name]
+			if !known {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					problems = append(problems, path+"."+name+" is not allowed")
+				}
+				continue
+			}
+			if object[name] != nil {
+				problems = append(problems, property.Validate(object[name], path+"."+name)...)
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return append(problems, path+" must be an array")
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				problems = append(problems, s.Items.Validate(item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return append(problems, path+" must be a string")
+		}
+		length := len([]rune(str))
+		if s.MinLength != nil && length < *s.MinLength {
+			problems = append(problems, fmt.Sprintf("%s must be at least %d characters", path, *s.MinLength))
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			problems = append(problems, fmt.Sprintf("%s must be at most %d characters", path, *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			problems = append(problems, path+" does not match the expected pattern")
+		}
+		switch s.Format {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				problems = append(problems, path+" must be an RFC 3339 date-time")
+			}
+		case "date":
+			if _, err := time.Parse("2006-01-02", str); err != nil {
+				problems = append(problems, path+" must be a date (YYYY-MM-DD)")
+			}
+		}
+	case "number", "integer":
+		number, ok := value.(float64)
+		if !ok {
+			return append(problems, path+" must be a number")
+		}
+		if s.Type == "integer" && number != math.Trunc(number) {
+			problems = append(problems, path+" must be an integer")
+		}
+		if s.Minimum != nil && number < *s.Minimum {
+			problems = append(problems, fmt.Sprintf("%s must be at least %v", path, *s.Minimum))
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			problems = append(problems, fmt.Sprintf("%s must be at most %v", path, *s.Maximum))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, path+" must be a boolean")
+		}
+	}
+	return problems
+}
+
+// enumContains compares decoded JSON values
+func enumContains(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// LabelData holds the printable content of a batch label
+type LabelData struct {
+	Title        string
+	LotCode      string
+	Species      string
+	HatcheryName string
+	Quantity     int
+	ProducedAt   string
+	PrintedAt    string
+	QRContent    string
+	ExtraLines   []string
+}
+
+// LabelLayout describes the physical label stock and which fields are printed
+type LabelLayout struct {
+	WidthMM      float64
+	HeightMM     float64
+	DPI          int
+	ShowSpecies  bool
+	ShowHatchery bool
+	ShowQuantity bool
+	ShowDates    bool
+}
+
+// DefaultLabelLayout returns a 100x60mm layout for 203 dpi Zebra printers
+func DefaultLabelLayout() LabelLayout {
+	return LabelLayout{
+		WidthMM:      100,
+		HeightMM:     60,
+		DPI:          203,
+		ShowSpecies:  true,
+		ShowHatchery: true,
+		ShowQuantity: true,
+		ShowDates:    true,
+	}
+}
+
+// labelLines returns the text lines printed next to the QR code
+func labelLines(data LabelData, layout LabelLayout) []string {
+	lines := []string{}
+	if data.Title != "" {
+		lines = append(lines, data.Title)
+	}
+	lines = append(lines, "LOT: "+data.LotCode)
+	if layout.ShowSpecies && data.Species != "" {
+		lines = append(lines, "Species: "+data.Species)
+	}
+	if layout.ShowHatchery && data.HatcheryName != "" {
+		lines = append(lines, "Hatchery: "+data.HatcheryName)
+	}
+	if layout.ShowQuantity && data.Quantity > 0 {
+		lines = append(lines, fmt.Sprintf("Qty: %d", data.Quantity))
+	}
+	if layout.ShowDates {
+		if data.ProducedAt != "" {
+			lines = append(lines, "Produced: "+data.ProducedAt)
+		}
+		if data.PrintedAt != "" {
+			lines = append(lines, "Printed: "+data.PrintedAt)
+		}
+	}
+	lines = append(lines, data.ExtraLines...)
+	return lines
+}
+
+// sanitizeZPL removes characters that have special meaning in ZPL field data
+func sanitizeZPL(s string) string {
+	replacer := strings.NewReplacer("^", " ", "~", " ")
+	return replacer.Replace(s)
+}
+
+// RenderZPLLabel renders a label as Zebra ZPL II commands
+func RenderZPLLabel(data LabelData, layout LabelLayout) []byte {
+	dotsPerMM := float64(layout.DPI) / 25.4
+	width := int(layout.WidthMM * dotsPerMM)
+	height := int(layout.HeightMM * dotsPerMM)
+
+	// QR code occupies the left part of the label, text flows on the right
+	qrMagnification := 4
+	if layout.DPI >= 300 {
+		qrMagnification = 6
+	}
+	textX := height - 20
+	if textX > width/2 {
+		textX = width / 2
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("^XA\n")
+	buf.WriteString("^CI28\n")
+	buf.WriteString(fmt.Sprintf("^PW%d\n", width))
+	buf.WriteString(fmt.Sprintf("^LL%d\n", height))
+	buf.WriteString(fmt.Sprintf("^FO20,20^BQN,2,%d^FDQA,%s^FS\n", qrMagnification, sanitizeZPL(data.QRContent)))
+
+	y := 30
+	for i, line := range labelLines(data, layout) {
+		fontHeight := 24
+		if i == 0 {
+			fontHeight = 32
+		}
+		buf.WriteString(fmt.Sprintf("^FO%d,%d^A0N,%d,%d^FD%s^FS\n", textX, y, fontHeight, fontHeight, sanitizeZPL(line)))
+		y += fontHeight + 10
+	}
+
+	// Lot code as Code 128 barcode along the bottom edge
+	buf.WriteString(fmt.Sprintf("^FO20,%d^BY2^BCN,50,Y,N,N^FD%s^FS\n", height-90, sanitizeZPL(data.LotCode)))
+	buf.WriteString("^XZ\n")
+	return buf.Bytes()
+}
+
+// escapePDFText escapes characters that are not allowed in PDF literal strings
+func escapePDFText(s string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "(", "\\(", ")", "\\)")
+	return replacer.Replace(s)
+}
+
+// RenderPDFLabel renders a label as a single page PDF document sized to the label stock
+func RenderPDFLabel(data LabelData, layout LabelLayout) ([]byte, error) {
+	const pointsPerMM = 72.0 / 25.4
+	pageWidth := layout.WidthMM * pointsPerMM
+	pageHeight := layout.HeightMM * pointsPerMM
+	margin := 3 * pointsPerMM
+
+	qr, err := qrcode.New(data.QRContent, qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR content: %w", err)
+	}
+	qr.DisableBorder = true
+	bitmap := qr.Bitmap()
+
+	// Draw the QR code as filled squares so no image encoding is needed
+	qrSize := pageHeight - 2*margin
+	moduleSize := qrSize / float64(len(bitmap))
+	var content bytes.Buffer
+	content.WriteString("0 0 0 rg\n")
+	for row := range bitmap {
+		for col := range bitmap[row] {
+			if !bitmap[row][col] {
+				continue
+			}
+			x := margin + float64(col)*moduleSize
+			y := pageHeight - margin - float64(row+1)*moduleSize
+			content.WriteString(fmt.Sprintf("%.2f %.2f %.2f %.2f re\n", x, y, moduleSize, moduleSize))
+		}
+	}
+	content.WriteString("f\n")
+
+	// Text block to the right of the QR code
+	textX := margin*2 + qrSize
+	y := pageHeight - margin - 10
+	content.WriteString("BT\n")
+	for i, line := range labelLines(data, layout) {
+		fontSize := 7.0
+		if i == 0 {
+			fontSize = 9.0
+		}
+		content.WriteString(fmt.Sprintf("/F1 %.1f Tf\n1 0 0 1 %.2f %.2f Tm\n(%s) Tj\n", fontSize, textX, y, escapePDFText(line)))
+		y -= fontSize + 3
+	}
+	content.WriteString("ET\n")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>", pageWidth, pageHeight),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	}
+
+	return assemblePDF(objects), nil
+}
+
+// assemblePDF writes numbered PDF objects with their cross-reference table
+// The first object must be the document catalog
+func assemblePDF(objects []string) []byte {
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = pdf.Len()
+		pdf.WriteString(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", i+1, obj))
+	}
+
+	xrefOffset := pdf.Len()
+	pdf.WriteString(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(objects)+1))
+	for _, offset := range offsets {
+		pdf.WriteString(fmt.Sprintf("%010d 00000 n \n", offset))
+	}
+	pdf.WriteString(fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset))
+
+	return pdf.Bytes()
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+// QRSheetItem is one QR code on a label sheet with the lines printed under it
+type QRSheetItem struct {
+	Content string
+	Caption []string
+	Style   QRStyle
+}
+
+// QRSheetLayout describes the sheet stock QR labels are printed on
+type QRSheetLayout struct {
+	PageWidthMM  float64
+	PageHeightMM float64
+	MarginMM     float64
+	Columns      int
+	Rows         int
+}
+
+// DefaultQRSheetLayout returns an A4 sheet of 3 by 8 labels
+func DefaultQRSheetLayout() QRSheetLayout {
+	return QRSheetLayout{
+		PageWidthMM:  210,
+		PageHeightMM: 297,
+		MarginMM:     10,
+		Columns:      3,
+		Rows:         8,
+	}
+}
+
+// pdfColor formats a color for the rg operator
+func pdfColor(c color.RGBA) string {
+	return fmt.Sprintf("%.3f %.3f %.3f", float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+}
+
+// pdfLogo embeds a logo as a Flate compressed RGB image, flattened onto the background it is drawn on
+func pdfLogo(logo image.Image, side int, background color.RGBA) string {
+	fitted := fitImage(logo, side)
+	bounds := fitted.Bounds()
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, fitted, bounds.Min, draw.Over)
+
+	var raw bytes.Buffer
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			p := flat.RGBAAt(x, y)
+			raw.Write([]byte{p.R, p.G, p.B})
+		}
+	}
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(raw.Bytes())
+	w.Close()
+	return fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream",
+		bounds.Dx(), bounds.Dy(), compressed.Len(), compressed.String())
+}
+
+// RenderQRSheetPDF renders QR codes in a grid on as many pages as they need, each with its caption
+func RenderQRSheetPDF(items []QRSheetItem, layout QRSheetLayout) ([]byte, error) {
+	if layout.Columns < 1 || layout.Rows < 1 {
+		return nil, fmt.Errorf("a sheet needs at least one column and one row")
+	}
+	const pointsPerMM = 72.0 / 25.4
+	pageWidth := layout.PageWidthMM * pointsPerMM
+	pageHeight := layout.PageHeightMM * pointsPerMM
+	margin := layout.MarginMM * pointsPerMM
+	cellWidth := (pageWidth - 2*margin) / float64(layout.Columns)
+	cellHeight := (pageHeight - 2*margin) / float64(layout.Rows)
+	const fontSize, lineHeight, padding = 6.0, 7.5, 4.0
+
+	// Catalog, page tree and font come first; logos and pages follow
+	objects := []string{"", "", "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>"}
+	perPage := layout.Columns * layout.Rows
+	var kids []string
+	for start := 0; start < len(items); start += perPage {
+		end := start + perPage
+		if end > len(items) {
+			end = len(items)
+		}
+
+		var content bytes.Buffer
+		images := map[string]int{}
+		for i, item := range items[start:end] {
+			col, row := i%layout.Columns, i/layout.Columns
+			cellX := margin + float64(col)*cellWidth
+			cellTop := pageHeight - margin - float64(row)*cellHeight
+
+			qr, err := newStyledQR(item.Content, item.Style)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode QR content %q: %w", item.Content, err)
+			}
+			bitmap := qr.Bitmap()
+			qrSize := cellHeight - 2*padding - float64(len(item.Caption))*lineHeight
+			if qrSize > cellWidth-2*padding {
+				qrSize = cellWidth - 2*padding
+			}
+			if qrSize <= 0 {
+				return nil, fmt.Errorf("labels are too small for their QR codes")
+			}
+			qrX := cellX + (cellWidth-qrSize)/2
+			qrY := cellTop - padding - qrSize
+			moduleSize := qrSize / float64(len(bitmap))
+
+			// Draw the QR code as filled squares over its background
+			fmt.Fprintf(&content, "%s rg\n%.2f %.2f %.2f %.2f re\nf\n", pdfColor(item.Style.Background), qrX, qrY, qrSize, qrSize)
+			fmt.Fprintf(&content, "%s rg\n", pdfColor(item.Style.Foreground))
+			for r := range bitmap {
+				for c := range bitmap[r] {
+					if bitmap[r][c] {
+						fmt.Fprintf(&content, "%.2f %.2f %.2f %.2f re\n", qrX+float64(c)*moduleSize, qrY+qrSize-float64(r+1)*moduleSize, moduleSize, moduleSize)
+					}
+				}
+			}
+			content.WriteString("f\n")
+
+			if item.Style.Logo != nil {
+				side := qrSize * item.Style.LogoScale
+				pad := side / 10
+				cx, cy := qrX+qrSize/2, qrY+qrSize/2
+				fmt.Fprintf(&content, "%s rg\n%.2f %.2f %.2f %.2f re\nf\n", pdfColor(item.Style.Background), cx-side/2-pad, cy-side/2-pad, side+2*pad, side+2*pad)
+				// Items sharing a logo and background share the image object
+				key := fmt.Sprintf("%p/%s", item.Style.Logo, HexColor(item.Style.Background))
+				if _, ok := images[key]; !ok {
+					objects = append(objects, pdfLogo(item.Style.Logo, 256, item.Style.Background))
+					images[key] = len(objects)
+				}
+				fmt.Fprintf(&content, "q\n%.2f 0 0 %.2f %.2f %.2f cm\n/Im%d Do\nQ\n", side, side, cx-side/2, cy-side/2, images[key])
+			}
+
+			content.WriteString("0 0 0 rg\nBT\n")
+			y := qrY - lineHeight
+			for _, line := range item.Caption {
+				fmt.Fprintf(&content, "/F1 %.1f Tf\n1 0 0 1 %.2f %.2f Tm\n(%s) Tj\n", fontSize, cellX+padding, y, escapePDFText(line))
+				y -= lineHeight
+			}
+			content.WriteString("ET\n")
+		}
+
+		var xobjects []string
+		for _, id := range images {
+			xobjects = append(xobjects, fmt.Sprintf("/Im%d %d 0 R", id, id))
+		}
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+		contentID := len(objects)
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R >> /XObject << %s >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, strings.Join(xobjects, " "), contentID))
+		kids = append(kids, fmt.Sprintf("%d 0 R", len(objects)))
+	}
+	if len(kids) == 0 {
+		return nil, fmt.Errorf("a sheet needs at least one QR code")
+	}
+
+	objects[0] = "<< /Type /Catalog /Pages 2 0 R >>"
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+	return assemblePDF(objects), nil
+}
@@ -0,0 +1,289 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg" // Logos may be uploaded as JPEG
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// MinQRContrast is the lowest WCAG contrast ratio between the colors of a QR code that scanners read reliably
+const MinQRContrast = 4.5
+
+// MaxQRLogoSize is the largest width or height of an uploaded logo in pixels
+const MaxQRLogoSize = 2048
+
+// QRStyle describes how a QR code is drawn
+type QRStyle struct {
+	Level      qrcode.RecoveryLevel
+	Foreground color.RGBA
+	Background color.RGBA
+	Logo       image.Image // Overlaid at the center, requires High or Highest error correction
+	LogoScale  float64     // Width of the logo as a share of the QR code
+}
+
+// DefaultQRStyle returns black on white with medium error correction and no logo
+func DefaultQRStyle() QRStyle {
+	return QRStyle{
+		Level:      qrcode.Medium,
+		Foreground: color.RGBA{0, 0, 0, 255},
+		Background: color.RGBA{255, 255, 255, 255},
+		LogoScale:  0.2,
+	}
+}
+
+// ParseRecoveryLevel parses an error correction level: L, M, Q or H, or low, medium, high or highest
+func ParseRecoveryLevel(value string) (qrcode.RecoveryLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "l", "low":
+		return qrcode.Low, nil
+	case "m", "medium":
+		return qrcode.Medium, nil
+	case "q", "high":
+		return qrcode.High, nil
+	case "h", "highest":
+		return qrcode.Highest, nil
+	}
+	return qrcode.Medium, fmt.Errorf("error correction must be L, M, Q or H")
+}
+
+// RecoveryLevelName returns the letter of an error correction level
+func RecoveryLevelName(level qrcode.RecoveryLevel) string {
+	switch level {
+	case qrcode.Low:
+		return "L"
+	case qrcode.High:
+		return "Q"
+	case qrcode.Highest:
+		return "H"
+	}
+	return "M"
+}
+
+// ParseHexColor parses an opaque #RRGGBB or #RGB color
+func ParseHexColor(value string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(value), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("color %q must be #RRGGBB", value)
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("color %q must be #RRGGBB", value)
+	}
+	return color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 255}, nil
+}
+
+// HexColor formats a color as #RRGGBB
+func HexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// relativeLuminance is the WCAG relative luminance of a color
+func relativeLuminance(c color.RGBA) float64 {
+	channel := func(v uint8) float64 {
+		s := float64(v) / 255
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c.R) + 0.7152*channel(c.G) + 0.0722*channel(c.B)
+}
+
+// ContrastRatio is the WCAG contrast ratio of two colors, from 1 to 21
+func ContrastRatio(a, b color.RGBA) float64 {
+	la, lb := relativeLuminance(a), relativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// Validate checks the colors are readable and the logo leaves enough of the code to scan
+func (s QRStyle) Validate() error {
+	// Many scanners only read dark modules on a light background
+	if relativeLuminance(s.Foreground) >= relativeLuminance(s.Background) {
+		return fmt.Errorf("the foreground color must be darker than the background")
+	}
+	if ratio := ContrastRatio(s.Foreground, s.Background); ratio < MinQRContrast {
+		return fmt.Errorf("contrast between foreground and background is %.1f:1, at least %.1f:1 is required", ratio, MinQRContrast)
+	}
+	if s.Logo != nil {
+		maxScale := s.maxLogoScale()
+		if maxScale == 0 {
+			return fmt.Errorf("a logo requires error correction Q or H")
+		}
+		if s.LogoScale <= 0 || s.LogoScale > maxScale {
+			return fmt.Errorf("logo scale must be between 0 and %.2f at error correction %s", maxScale, RecoveryLevelName(s.Level))
+		}
+	}
+	return nil
+}
+
+// maxLogoScale is the widest logo the error correction level recovers from
+func (s QRStyle) maxLogoScale() float64 {
+	switch s.Level {
+	case qrcode.High:
+		return 0.25
+	case qrcode.Highest:
+		return 0.3
+	}
+	return 0
+}
+
+// DecodeLogo decodes an uploaded PNG or JPEG logo
+func DecodeLogo(data []byte) (image.Image, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("logo must be a PNG or JPEG image")
+	}
+	if config.Width > MaxQRLogoSize || config.Height > MaxQRLogoSize {
+		return nil, "", fmt.Errorf("logo must be at most %dx%d pixels", MaxQRLogoSize, MaxQRLogoSize)
+	}
+	logo, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("logo must be a PNG or JPEG image")
+	}
+	return logo, "image/" + format, nil
+}
+
+// newStyledQR encodes content with the style's error correction and colors
+func newStyledQR(content string, style QRStyle) (*qrcode.QRCode, error) {
+	qr, err := qrcode.New(content, style.Level)
+	if err != nil {
+		return nil, err
+	}
+	qr.ForegroundColor = style.Foreground
+	qr.BackgroundColor = style.Background
+	return qr, nil
+}
+
+// QRImage draws a QR code of the given size with the logo overlaid
+func QRImage(content string, size int, style QRStyle) (image.Image, error) {
+	qr, err := newStyledQR(content, style)
+	if err != nil {
+		return nil, err
+	}
+	code := qr.Image(size)
+	if style.Logo == nil {
+		return code, nil
+	}
+
+	img := image.NewRGBA(code.Bounds())
+	draw.Draw(img, img.Bounds(), code, image.Point{}, draw.Src)
+	bounds := img.Bounds()
+	side := int(float64(bounds.Dx()) * style.LogoScale)
+	logo := fitImage(style.Logo, side)
+	// A plate in the background color keeps the logo's edges from blending into modules
+	pad := side / 10
+	center := image.Point{bounds.Dx() / 2, bounds.Dy() / 2}
+	plate := image.Rect(center.X-side/2-pad, center.Y-side/2-pad, center.X+side/2+pad, center.Y+side/2+pad)
+	draw.Draw(img, plate, image.NewUniform(style.Background), image.Point{}, draw.Src)
+	at := center.Sub(image.Point{logo.Bounds().Dx() / 2, logo.Bounds().Dy() / 2})
+	draw.Draw(img, logo.Bounds().Add(at), logo, image.Point{}, draw.Over)
+	return img, nil
+}
+
+// RenderQRPNG renders a styled QR code as a PNG image
+func RenderQRPNG(content string, size int, style QRStyle) ([]byte, error) {
+	img, err := QRImage(content, size, style)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderQRSVG renders a styled QR code as an SVG document, the modules as one path
+func RenderQRSVG(content string, size int, style QRStyle) ([]byte, error) {
+	qr, err := newStyledQR(content, style)
+	if err != nil {
+		return nil, err
+	}
+	bitmap := qr.Bitmap()
+	modules := len(bitmap)
+
+	var path strings.Builder
+	for row := range bitmap {
+		for col := 0; col < modules; col++ {
+			if !bitmap[row][col] {
+				continue
+			}
+			// Runs of dark modules in a row are drawn as one rectangle
+			run := 1
+			for col+run < modules && bitmap[row][col+run] {
+				run++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", col, row, run, run)
+			col += run - 1
+		}
+	}
+
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, modules, modules)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="%s"/>`, modules, modules, HexColor(style.Background))
+	fmt.Fprintf(&svg, `<path fill="%s" d="%s"/>`, HexColor(style.Foreground), path.String())
+	if style.Logo != nil {
+		side := float64(modules) * style.LogoScale
+		pad := side / 10
+		origin := (float64(modules) - side) / 2
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, fitImage(style.Logo, int(math.Max(float64(size)*style.LogoScale, 1)))); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&svg, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="%s"/>`, origin-pad, origin-pad, side+2*pad, side+2*pad, HexColor(style.Background))
+		fmt.Fprintf(&svg, `<image x="%.2f" y="%.2f" width="%.2f" height="%.2f" preserveAspectRatio="xMidYMid meet" href="data:image/png;base64,%s"/>`,
+			origin, origin, side, side, base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+	svg.WriteString("</svg>")
+	return svg.Bytes(), nil
+}
+
+// fitImage scales an image to fit a square of the given side, averaging the source pixels each target pixel covers
+func fitImage(src image.Image, side int) image.Image {
+	bounds := src.Bounds()
+	if side < 1 {
+		side = 1
+	}
+	scale := math.Min(float64(side)/float64(bounds.Dx()), float64(side)/float64(bounds.Dy()))
+	width := int(math.Max(1, math.Round(float64(bounds.Dx())*scale)))
+	height := int(math.Max(1, math.Round(float64(bounds.Dy())*scale)))
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + int(float64(y)/scale)
+		y1 := int(math.Max(float64(y0+1), float64(bounds.Min.Y)+float64(y+1)/scale))
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + int(float64(x)/scale)
+			x1 := int(math.Max(float64(x0+1), float64(bounds.Min.X)+float64(x+1)/scale))
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1 && sy < bounds.Max.Y; sy++ {
+				for sx := x0; sx < x1 && sx < bounds.Max.X; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+pr, g+pg, b+pb, a+pa, n+1
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"math"
+	"time"
+)
+
+// earthRadiusKM is the mean Earth radius used for great-circle distances
+const earthRadiusKM = 6371.0
+
+// RoutePoint is a single GPS fix of a transport route
+type RoutePoint struct {
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	SpeedKMH   float64   `json:"speed_kmh,omitempty"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// RouteStop is a period during which a transport stayed within a small radius
+type RouteStop struct {
+	Latitude        float64   `json:"latitude"`
+	Longitude       float64   `json:"longitude"`
+	StartedAt       time.Time `json:"started_at"`
+	EndedAt         time.Time `json:"ended_at"`
+	DurationMinutes float64   `json:"duration_minutes"`
+	Ongoing         bool      `json:"ongoing"`
+	Planned         bool      `json:"planned"`
+}
+
+// HaversineKM returns the great-circle distance between two coordinates in kilometers
+func HaversineKM(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return earthRadiusKM * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// RouteDistanceKM returns the total length of a route in kilometers
+func RouteDistanceKM(points []RoutePoint) float64 {
+	total := 0.0
+	for i := 1; i < len(points); i++ {
+		total += HaversineKM(points[i-1].Latitude, points[i-1].Longitude, points[i].Latitude, points[i].Longitude)
+	}
+	return total
+}
+
+// DetectStops finds periods of at least minDuration during which consecutive points stay within radiusMeters
+// of the first point of the period. Points must be ordered by time. Stops at the very start or end of the
+// route are marked as planned (loading and unloading).
+func DetectStops(points []RoutePoint, radiusMeters float64, minDuration time.Duration, routeClosed bool) []RouteStop {
+	stops := []RouteStop{}
+	if len(points) < 2 {
+		return stops
+	}
+
+	radiusKM := radiusMeters / 1000
+	start := 0
+	for i := 1; i <= len(points); i++ {
+		// Extend the cluster while points stay close to its anchor
+		if i < len(points) && HaversineKM(points[start].Latitude, points[start].Longitude, points[i].Latitude, points[i].Longitude) <= radiusKM {
+			continue
+		}
+
+		last := i - 1
+		duration := points[last].RecordedAt.Sub(points[start].RecordedAt)
+		if last > start && duration >= minDuration {
+			ongoing := i == len(points) && !routeClosed
+			stops = append(stops, RouteStop{
+				Latitude:        points[start].Latitude,
+				Longitude:       points[start].Longitude,
+				StartedAt:       points[start].RecordedAt,
+				EndedAt:         points[last].RecordedAt,
+				DurationMinutes: math.Round(duration.Minutes()*10) / 10,
+				Ongoing:         ongoing,
+				Planned:         start == 0 || (i == len(points) && routeClosed),
+			})
+		}
+		start = i
+	}
+	return stops
+}
+
+// RouteGeoJSON renders a route as a GeoJSON FeatureCollection with the path as a LineString
+// and every stop as a Point feature
+func RouteGeoJSON(points []RoutePoint, stops []RouteStop, properties map[string]interface{}) map[string]interface{} {
+	// GeoJSON positions are [longitude, latitude]
+	coordinates := make([][]float64, 0, len(points))
+	for _, p := range points {
+		coordinates = append(coordinates, []float64{p.Longitude, p.Latitude})
+	}
+
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+	properties["point_count"] = len(points)
+	properties["distance_km"] = math.Round(RouteDistanceKM(points)*100) / 100
+	if len(points) > 0 {
+		properties["started_at"] = points[0].RecordedAt
+		properties["last_seen_at"] = points[len(points)-1].RecordedAt
+	}
+
+	features := []map[string]interface{}{
+		{
+			"type": "Feature",
+			"geometry": map[string]interface{}{
+				"type":        "LineString",
+				"coordinates": coordinates,
+			},
+			"properties": properties,
+		},
+	}
+	for _, stop := range stops {
+		features = append(features, map[string]interface{}{
+			"type": "Feature",
+			"geometry": map[string]interface{}{
+				"type":        "Point",
+				"coordinates": []float64{stop.Longitude, stop.Latitude},
+			},
+			"properties": map[string]interface{}{
+				"kind":             "stop",
+				"started_at":       stop.StartedAt,
+				"ended_at":         stop.EndedAt,
+				"duration_minutes": stop.DurationMinutes,
+				"ongoing":          stop.Ongoing,
+				"planned":          stop.Planned,
+			},
+		})
+	}
+
+	return map[string]interface{}{
+		"type":     "FeatureCollection",
+		"features": features,
+	}
+}
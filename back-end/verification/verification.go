@@ -0,0 +1,88 @@
+package verification
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Verification statuses of a domain or endpoint
+const (
+	StatusPending  = "pending"
+	StatusVerified = "verified"
+	StatusFailed   = "failed"
+)
+
+// Ways ownership of a destination can be proven
+const (
+	MethodDNSTXT         = "dns_txt"         // TXT record under the domain
+	MethodSignedCallback = "signed_callback" // endpoint echoes a challenge sent in a signed request
+	MethodCompanyDomain  = "company_domain"  // host is under a domain the company already verified
+)
+
+// RecordPrefix is the label the TXT challenge is published under
+const RecordPrefix = "_tracepost-challenge"
+
+// LookupTXT resolves TXT records; replaced in tests
+var LookupTXT = net.LookupTXT
+
+// GenerateToken creates a random challenge token
+func GenerateToken() (string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// NormalizeDomain lower-cases a domain and strips a trailing dot, rejecting anything that is not a host name
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" || len(domain) > 253 || !strings.Contains(domain, ".") || net.ParseIP(domain) != nil {
+		return "", fmt.Errorf("invalid domain %q", domain)
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return "", fmt.Errorf("invalid domain %q", domain)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return "", fmt.Errorf("invalid domain %q", domain)
+			}
+		}
+	}
+	return domain, nil
+}
+
+// RecordName is the name of the TXT record proving ownership of a domain
+func RecordName(domain string) string {
+	return RecordPrefix + "." + domain
+}
+
+// RecordValue is the content of the TXT record for a token
+func RecordValue(token string) string {
+	return "tracepost-verification=" + token
+}
+
+// CheckDNS looks for the TXT record of a token under a domain
+func CheckDNS(domain, token string) error {
+	records, err := LookupTXT(RecordName(domain))
+	if err != nil {
+		return fmt.Errorf("failed to resolve TXT records of %s: %w", RecordName(domain), err)
+	}
+	expected := RecordValue(token)
+	for _, record := range records {
+		if strings.TrimSpace(record) == expected {
+			return nil
+		}
+	}
+	return fmt.Errorf("no TXT record %q found at %s", expected, RecordName(domain))
+}
+
+// CoveredBy reports whether a host is a domain or one of its subdomains
+func CoveredBy(host, domain string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
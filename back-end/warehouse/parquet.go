@@ -0,0 +1,465 @@
+package warehouse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ColumnType is the type of an exported column
+type ColumnType string
+
+// Column types of exported files
+const (
+	TypeString    ColumnType = "string"    // BYTE_ARRAY annotated UTF8
+	TypeInt64     ColumnType = "int64"     // INT64
+	TypeFloat64   ColumnType = "float64"   // DOUBLE
+	TypeBool      ColumnType = "bool"      // BOOLEAN
+	TypeTimestamp ColumnType = "timestamp" // INT64 annotated TIMESTAMP_MILLIS, UTC
+	TypeDate      ColumnType = "date"      // INT32 annotated DATE
+)
+
+// Column is a column of an exported dataset
+// Every column is optional so that files written before a column was added read it as null
+type Column struct {
+	Name string     `json:"name"`
+	Type ColumnType `json:"type"`
+}
+
+// Parquet physical types, repetitions, converted types and encodings used by the writer
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetDate            = 6
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetDataPage = 0
+	parquetGzip     = 2
+)
+
+// physicalType maps a column type to its Parquet physical and converted type; converted is -1 when none
+func (t ColumnType) physicalType() (physical, converted int32, err error) {
+	switch t {
+	case TypeString:
+		return parquetByteArray, parquetUTF8, nil
+	case TypeInt64:
+		return parquetInt64, -1, nil
+	case TypeFloat64:
+		return parquetDouble, -1, nil
+	case TypeBool:
+		return parquetBoolean, -1, nil
+	case TypeTimestamp:
+		return parquetInt64, parquetTimestampMillis, nil
+	case TypeDate:
+		return parquetInt32, parquetDate, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported column type %q", t)
+}
+
+// WriteParquet writes rows as a Parquet file with a single row group
+// Row values are nil or the string, integer, float, bool, time or []byte values returned by the database driver.
+// Pages are gzip compressed and PLAIN encoded; metadata is stored as key/value pairs in the footer
+func WriteParquet(w io.Writer, columns []Column, rows [][]interface{}, metadata map[string]string) error {
+	out := &countingWriter{w: w}
+	if _, err := out.Write([]byte("PAR1")); err != nil {
+		return err
+	}
+
+	chunks := make([]parquetChunk, len(columns))
+	for i, column := range columns {
+		physical, _, err := column.Type.physicalType()
+		if err != nil {
+			return err
+		}
+		values := make([]interface{}, len(rows))
+		for r, row := range rows {
+			if i >= len(row) {
+				return fmt.Errorf("row %d has %d values, want %d", r, len(row), len(columns))
+			}
+			values[r], err = coerceValue(column.Type, row[i])
+			if err != nil {
+				return fmt.Errorf("row %d column %s: %w", r, column.Name, err)
+			}
+		}
+
+		page, err := encodePage(column.Type, values)
+		if err != nil {
+			return err
+		}
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(page)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+
+		header := &thriftWriter{}
+		header.structBegin()
+		header.i32Field(1, parquetDataPage)
+		header.i32Field(2, int32(len(page)))
+		header.i32Field(3, int32(compressed.Len()))
+		header.structField(5)
+		header.i32Field(1, int32(len(values)))
+		header.i32Field(2, parquetPlain)
+		header.i32Field(3, parquetRLE)
+		header.i32Field(4, parquetRLE)
+		header.structEnd()
+		header.structEnd()
+
+		chunks[i] = parquetChunk{
+			physical:         physical,
+			name:             column.Name,
+			offset:           out.n,
+			numValues:        int64(len(values)),
+			uncompressedSize: int64(header.buf.Len() + len(page)),
+			compressedSize:   int64(header.buf.Len() + compressed.Len()),
+		}
+		if _, err := out.Write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if _, err := out.Write(compressed.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	footer, err := encodeFileMetaData(columns, chunks, int64(len(rows)), metadata)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(footer); err != nil {
+		return err
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	if _, err := out.Write(length[:]); err != nil {
+		return err
+	}
+	_, err = out.Write([]byte("PAR1"))
+	return err
+}
+
+// parquetChunk is the position and size of a written column chunk
+type parquetChunk struct {
+	physical         int32
+	name             string
+	offset           int64
+	numValues        int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+// encodeFileMetaData encodes the file footer
+func encodeFileMetaData(columns []Column, chunks []parquetChunk, numRows int64, metadata map[string]string) ([]byte, error) {
+	t := &thriftWriter{}
+	t.structBegin()
+	t.i32Field(1, 1)
+
+	// Flat schema: the root followed by one optional leaf per column
+	t.listField(2, thriftStruct, len(columns)+1)
+	t.structBegin()
+	t.binaryField(4, "schema")
+	t.i32Field(5, int32(len(columns)))
+	t.structEnd()
+	for _, column := range columns {
+		physical, converted, err := column.Type.physicalType()
+		if err != nil {
+			return nil, err
+		}
+		t.structBegin()
+		t.i32Field(1, physical)
+		t.i32Field(3, parquetOptional)
+		t.binaryField(4, column.Name)
+		if converted >= 0 {
+			t.i32Field(6, converted)
+		}
+		t.structEnd()
+	}
+
+	t.i64Field(3, numRows)
+
+	var totalSize int64
+	for _, chunk := range chunks {
+		totalSize += chunk.uncompressedSize
+	}
+	t.listField(4, thriftStruct, 1)
+	t.structBegin()
+	t.listField(1, thriftStruct, len(chunks))
+	for _, chunk := range chunks {
+		t.structBegin()
+		t.i64Field(2, chunk.offset)
+		t.structField(3)
+		t.i32Field(1, chunk.physical)
+		t.listField(2, thriftI32, 2)
+		t.writeVarint(zigzag(parquetPlain))
+		t.writeVarint(zigzag(parquetRLE))
+		t.listField(3, thriftBinary, 1)
+		t.writeBinary(chunk.name)
+		t.i32Field(4, parquetGzip)
+		t.i64Field(5, chunk.numValues)
+		t.i64Field(6, chunk.uncompressedSize)
+		t.i64Field(7, chunk.compressedSize)
+		t.i64Field(9, chunk.offset)
+		t.structEnd()
+		t.structEnd()
+	}
+	t.i64Field(2, totalSize)
+	t.i64Field(3, numRows)
+	t.structEnd()
+
+	if len(metadata) > 0 {
+		keys := make([]string, 0, len(metadata))
+		for key := range metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		t.listField(5, thriftStruct, len(keys))
+		for _, key := range keys {
+			t.structBegin()
+			t.binaryField(1, key)
+			t.binaryField(2, metadata[key])
+			t.structEnd()
+		}
+	}
+
+	t.binaryField(6, "TracePost-larvaeChain warehouse export")
+	t.structEnd()
+	return t.buf.Bytes(), nil
+}
+
+// encodePage encodes the definition levels and non-null values of a column as a v1 data page body
+func encodePage(columnType ColumnType, values []interface{}) ([]byte, error) {
+	var page bytes.Buffer
+
+	// Definition levels: 1 for a value, 0 for null, RLE encoded with bit width 1 behind a length prefix
+	var levels bytes.Buffer
+	for i := 0; i < len(values); {
+		defined := values[i] != nil
+		run := 1
+		for i+run < len(values) && (values[i+run] != nil) == defined {
+			run++
+		}
+		levels.Write(uvarint(uint64(run) << 1))
+		if defined {
+			levels.WriteByte(1)
+		} else {
+			levels.WriteByte(0)
+		}
+		i += run
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(levels.Len()))
+	page.Write(length[:])
+	page.Write(levels.Bytes())
+
+	var bits byte
+	var bitCount uint
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		switch columnType {
+		case TypeString:
+			s := value.(string)
+			binary.LittleEndian.PutUint32(length[:], uint32(len(s)))
+			page.Write(length[:])
+			page.WriteString(s)
+		case TypeInt64, TypeTimestamp:
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], uint64(value.(int64)))
+			page.Write(b[:])
+		case TypeDate:
+			binary.LittleEndian.PutUint32(length[:], uint32(value.(int32)))
+			page.Write(length[:])
+		case TypeFloat64:
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(value.(float64)))
+			page.Write(b[:])
+		case TypeBool:
+			if value.(bool) {
+				bits |= 1 << bitCount
+			}
+			bitCount++
+			if bitCount == 8 {
+				page.WriteByte(bits)
+				bits, bitCount = 0, 0
+			}
+		}
+	}
+	if bitCount > 0 {
+		page.WriteByte(bits)
+	}
+	return page.Bytes(), nil
+}
+
+// coerceValue converts a database value to the Go type the page encoder writes for the column type
+func coerceValue(columnType ColumnType, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+
+	switch columnType {
+	case TypeString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case time.Time:
+			return v.UTC().Format(time.RFC3339), nil
+		default:
+			return fmt.Sprint(v), nil
+		}
+	case TypeInt64:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case int:
+			return int64(v), nil
+		case float64:
+			return int64(v), nil
+		case string:
+			return strconv.ParseInt(v, 10, 64)
+		}
+	case TypeFloat64:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+	case TypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	case TypeTimestamp:
+		if v, ok := value.(time.Time); ok {
+			return v.UnixMilli(), nil
+		}
+	case TypeDate:
+		if v, ok := value.(time.Time); ok {
+			day := time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC)
+			return int32(day.Unix() / 86400), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot write %T as %s", value, columnType)
+}
+
+// Thrift compact protocol types used in the Parquet footer and page headers
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes the subset of the Thrift compact protocol the Parquet metadata needs
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // last field ID of each open struct
+}
+
+func (t *thriftWriter) structBegin() {
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) fieldHeader(id int16, fieldType byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		t.buf.WriteByte(fieldType)
+		t.writeVarint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32Field(id int16, value int32) {
+	t.fieldHeader(id, thriftI32)
+	t.writeVarint(zigzag(int64(value)))
+}
+
+func (t *thriftWriter) i64Field(id int16, value int64) {
+	t.fieldHeader(id, thriftI64)
+	t.writeVarint(zigzag(value))
+}
+
+func (t *thriftWriter) binaryField(id int16, value string) {
+	t.fieldHeader(id, thriftBinary)
+	t.writeBinary(value)
+}
+
+// structField opens a nested struct field; close it with structEnd
+func (t *thriftWriter) structField(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.structBegin()
+}
+
+// listField starts a list field; the caller writes its elements
+func (t *thriftWriter) listField(id int16, elementType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elementType)
+	} else {
+		t.buf.WriteByte(0xf0 | elementType)
+		t.writeVarint(uint64(size))
+	}
+}
+
+func (t *thriftWriter) writeBinary(value string) {
+	t.writeVarint(uint64(len(value)))
+	t.buf.WriteString(value)
+}
+
+func (t *thriftWriter) writeVarint(value uint64) {
+	t.buf.Write(uvarint(value))
+}
+
+func zigzag(value int64) uint64 {
+	return uint64((value << 1) ^ (value >> 63))
+}
+
+func uvarint(value uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], value)
+	return b[:n]
+}
+
+// countingWriter tracks the offset of written column chunks
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
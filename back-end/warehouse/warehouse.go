@@ -0,0 +1,676 @@
+package warehouse
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+)
+
+// Statuses of an exported day and of its files
+const (
+	StatusRunning    = "running"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+	StatusSuperseded = "superseded" // a later export of the same partition replaced the file
+)
+
+var (
+	// ErrUnknownDataset is returned for a dataset that is not exported
+	ErrUnknownDataset = errors.New("unknown dataset")
+	// ErrExportRunning is returned when the day is already being exported
+	ErrExportRunning = errors.New("export of the day is already running")
+	// ErrNotConfigured is returned when no bucket or credentials are set
+	ErrNotConfigured = errors.New("warehouse export bucket is not configured")
+)
+
+// Dataset is a table exported to the warehouse
+// The query selects the company of each row followed by the values of Columns for rows of the day from $1 to $2.
+// Columns may only be appended to keep files readable with the latest schema; removing or retyping a column
+// starts a new major version written under its own path
+type Dataset struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Columns     []Column `json:"columns"`
+	query       string
+}
+
+// Datasets are the exported tables
+// Rows are partitioned by the day they were created or last changed, so a row changed on several days appears
+// in several partitions; readers keep the copy with the latest updated_at
+var Datasets = []Dataset{
+	{
+		Name:        "batches",
+		Description: "Batches created or changed on the day",
+		Columns: []Column{
+			{"batch_id", TypeInt64},
+			{"hatchery_id", TypeInt64},
+			{"species", TypeString},
+			{"quantity", TypeInt64},
+			{"status", TypeString},
+			{"strain_id", TypeInt64},
+			{"created_at", TypeTimestamp},
+			{"updated_at", TypeTimestamp},
+			{"is_active", TypeBool},
+		},
+		query: `
+			SELECT h.company_id, b.id, b.hatchery_id, b.species, b.quantity, b.status, b.strain_id,
+				b.created_at, b.updated_at, b.is_active
+			FROM batch b
+			INNER JOIN hatchery h ON b.hatchery_id = h.id
+			WHERE b.updated_at >= $1 AND b.updated_at < $2
+			ORDER BY h.company_id, b.id
+		`,
+	},
+	{
+		Name:        "events",
+		Description: "Traceability events recorded or changed on the day",
+		Columns: []Column{
+			{"event_id", TypeInt64},
+			{"batch_id", TypeInt64},
+			{"event_type", TypeString},
+			{"actor_id", TypeInt64},
+			{"location", TypeString},
+			{"timestamp", TypeTimestamp},
+			{"metadata", TypeString},
+			{"supersedes_event_id", TypeInt64},
+			{"superseded_by_event_id", TypeInt64},
+			{"updated_at", TypeTimestamp},
+			{"is_active", TypeBool},
+		},
+		query: `
+			SELECT h.company_id, e.id, e.batch_id, e.event_type, e.actor_id, e.location, e.timestamp,
+				e.metadata::text, e.supersedes_event_id, e.superseded_by_event_id, e.updated_at, e.is_active
+			FROM event e
+			INNER JOIN batch b ON e.batch_id = b.id
+			INNER JOIN hatchery h ON b.hatchery_id = h.id
+			WHERE e.updated_at >= $1 AND e.updated_at < $2
+			ORDER BY h.company_id, e.id
+		`,
+	},
+	{
+		Name:        "transfers",
+		Description: "Batch transfers recorded or changed on the day",
+		Columns: []Column{
+			{"transfer_id", TypeInt64},
+			{"batch_id", TypeInt64},
+			{"sender_id", TypeInt64},
+			{"receiver_id", TypeInt64},
+			{"transfer_time", TypeTimestamp},
+			{"status", TypeString},
+			{"created_at", TypeTimestamp},
+			{"updated_at", TypeTimestamp},
+			{"is_active", TypeBool},
+		},
+		query: `
+			SELECT h.company_id, t.id, t.batch_id, t.sender_id, t.receiver_id, t.transfer_time, t.status,
+				t.created_at, t.updated_at, t.is_active
+			FROM shipment_transfer t
+			INNER JOIN batch b ON t.batch_id = b.id
+			INNER JOIN hatchery h ON b.hatchery_id = h.id
+			WHERE t.updated_at >= $1 AND t.updated_at < $2
+			ORDER BY h.company_id, t.id
+		`,
+	},
+	{
+		Name:        "environment_daily",
+		Description: "Daily aggregates of each batch's environment readings, excluding suppressed readings",
+		Columns: []Column{
+			{"day", TypeDate},
+			{"batch_id", TypeInt64},
+			{"readings", TypeInt64},
+			{"temperature_avg", TypeFloat64},
+			{"temperature_min", TypeFloat64},
+			{"temperature_max", TypeFloat64},
+			{"ph_avg", TypeFloat64},
+			{"ph_min", TypeFloat64},
+			{"ph_max", TypeFloat64},
+			{"salinity_avg", TypeFloat64},
+			{"salinity_min", TypeFloat64},
+			{"salinity_max", TypeFloat64},
+			{"density_avg", TypeFloat64},
+			{"age_max", TypeInt64},
+		},
+		query: `
+			SELECT h.company_id, $1::date, e.batch_id, COUNT(*),
+				AVG(e.temperature), MIN(e.temperature), MAX(e.temperature),
+				AVG(e.ph), MIN(e.ph), MAX(e.ph),
+				AVG(e.salinity), MIN(e.salinity), MAX(e.salinity),
+				AVG(e.density), MAX(e.age)
+			FROM environment_data e
+			INNER JOIN batch b ON e.batch_id = b.id
+			INNER JOIN hatchery h ON b.hatchery_id = h.id
+			WHERE e.timestamp >= $1 AND e.timestamp < $2 AND e.is_active = true AND COALESCE(e.suppressed, false) = false
+			GROUP BY h.company_id, e.batch_id
+			ORDER BY h.company_id, e.batch_id
+		`,
+	},
+}
+
+// FindDataset returns an exported dataset by name
+func FindDataset(name string) (*Dataset, error) {
+	for i := range Datasets {
+		if Datasets[i].Name == name {
+			return &Datasets[i], nil
+		}
+	}
+	return nil, ErrUnknownDataset
+}
+
+// SchemaVersion is a registered version of a dataset's columns
+type SchemaVersion struct {
+	Dataset      string    `json:"dataset"`
+	Version      int       `json:"version"`
+	MajorVersion int       `json:"major_version"` // Files of a major version share a path and can be read together
+	Columns      []Column  `json:"columns"`
+	Breaking     bool      `json:"breaking"` // Columns were removed or retyped, starting a new major version
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// DayExport is the export of one dataset for one day
+type DayExport struct {
+	Dataset       string     `json:"dataset"`
+	PartitionDate string     `json:"partition_date"`
+	SchemaVersion int        `json:"schema_version"`
+	Status        string     `json:"status"`
+	FileCount     int        `json:"file_count"`
+	RowCount      int64      `json:"row_count"`
+	Error         string     `json:"error,omitempty"`
+	RequestedBy   *int       `json:"requested_by,omitempty"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// ExportFile is a Parquet file in the export manifest
+type ExportFile struct {
+	ID            int       `json:"id"`
+	Dataset       string    `json:"dataset"`
+	PartitionDate string    `json:"partition_date"`
+	CompanyID     int       `json:"company_id"`
+	SchemaVersion int       `json:"schema_version"`
+	ObjectKey     string    `json:"object_key"`
+	RowCount      int64     `json:"row_count"`
+	ByteSize      int64     `json:"byte_size"`
+	SHA256        string    `json:"sha256"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Service writes daily Parquet exports of the datasets to S3
+type Service struct {
+	Enabled       bool
+	Interval      time.Duration
+	MaxDaysPerRun int
+	Prefix        string
+	Storage       *S3Client
+}
+
+var (
+	defaultService *Service
+	once           sync.Once
+)
+
+// NewService creates an export service from the application config
+func NewService(cfg *config.Config) *Service {
+	return &Service{
+		Enabled:       cfg.WarehouseExportEnabled,
+		Interval:      time.Duration(cfg.WarehouseExportIntervalSeconds) * time.Second,
+		MaxDaysPerRun: cfg.WarehouseExportMaxDaysPerRun,
+		Prefix:        strings.Trim(cfg.WarehouseS3Prefix, "/"),
+		Storage: &S3Client{
+			Bucket:       cfg.WarehouseS3Bucket,
+			Region:       cfg.WarehouseS3Region,
+			Endpoint:     cfg.WarehouseS3Endpoint,
+			PathStyle:    cfg.WarehouseS3PathStyle,
+			AccessKey:    cfg.WarehouseS3AccessKey,
+			SecretKey:    cfg.WarehouseS3SecretKey,
+			SessionToken: cfg.WarehouseS3SessionToken,
+			HTTPClient:   &http.Client{Timeout: 5 * time.Minute},
+		},
+	}
+}
+
+// Default returns the process wide export service
+func Default() *Service {
+	once.Do(func() {
+		defaultService = NewService(config.GetConfig())
+	})
+	return defaultService
+}
+
+// Start exports finished days in the background
+func (s *Service) Start() {
+	if !s.Enabled {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(s.Interval)
+
+			if err := s.RunOnce(); err != nil {
+				fmt.Printf("Warning: warehouse export run failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// RunOnce exports the days each dataset is missing, up to yesterday (UTC)
+// A dataset that was never exported starts at yesterday; older days are exported on request
+func (s *Service) RunOnce() error {
+	if db.DB == nil || !s.Storage.Configured() {
+		return nil
+	}
+
+	yesterday := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	var failures []string
+	for _, dataset := range Datasets {
+		var last sql.NullTime
+		err := db.DB.QueryRow(`
+			SELECT MAX(partition_date) FROM warehouse_export_day WHERE dataset = $1 AND status = $2
+		`, dataset.Name, StatusCompleted).Scan(&last)
+		if err != nil {
+			return fmt.Errorf("failed to load last export of %s: %w", dataset.Name, err)
+		}
+
+		day := yesterday
+		if last.Valid {
+			day = last.Time.UTC().AddDate(0, 0, 1)
+		}
+		for n := 0; !day.After(yesterday) && n < s.MaxDaysPerRun; n++ {
+			if _, err := s.ExportDay(dataset.Name, day, 0); err != nil {
+				if !errors.Is(err, ErrExportRunning) {
+					failures = append(failures, fmt.Sprintf("%s %s: %v", dataset.Name, day.Format("2006-01-02"), err))
+				}
+				break
+			}
+			day = day.AddDate(0, 0, 1)
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// ExportDay writes the partitions of one dataset for one day, replacing an earlier export of the day
+func (s *Service) ExportDay(datasetName string, day time.Time, userID int) (*DayExport, error) {
+	dataset, err := FindDataset(datasetName)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Storage.Configured() {
+		return nil, ErrNotConfigured
+	}
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	date := day.Format("2006-01-02")
+
+	schema, err := RegisterSchema(dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claim the day; a run that is still in progress keeps it
+	result, err := db.DB.Exec(`
+		INSERT INTO warehouse_export_day (dataset, partition_date, schema_version, status, requested_by, started_at)
+		VALUES ($1, $2::date, $3, $4, NULLIF($5, 0), NOW())
+		ON CONFLICT (dataset, partition_date) DO UPDATE SET
+			schema_version = EXCLUDED.schema_version, status = EXCLUDED.status, requested_by = EXCLUDED.requested_by,
+			file_count = 0, row_count = 0, error = NULL, started_at = NOW(), finished_at = NULL
+		WHERE warehouse_export_day.status <> $4 OR warehouse_export_day.started_at < NOW() - INTERVAL '1 hour'
+	`, dataset.Name, date, schema.Version, StatusRunning, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start export: %w", err)
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 0 {
+		return nil, ErrExportRunning
+	}
+
+	files, rowCount, err := s.writeDay(dataset, schema, day)
+	if err != nil {
+		db.DB.Exec(`
+			UPDATE warehouse_export_day SET status = $3, error = $4, finished_at = NOW()
+			WHERE dataset = $1 AND partition_date = $2::date
+		`, dataset.Name, date, StatusFailed, err.Error())
+		return nil, err
+	}
+	_, err = db.DB.Exec(`
+		UPDATE warehouse_export_day SET status = $3, file_count = $4, row_count = $5, finished_at = NOW()
+		WHERE dataset = $1 AND partition_date = $2::date
+	`, dataset.Name, date, StatusCompleted, len(files), rowCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete export: %w", err)
+	}
+
+	return GetDay(dataset.Name, day)
+}
+
+// writeDay uploads one Parquet file per company and the day's manifest
+func (s *Service) writeDay(dataset *Dataset, schema *SchemaVersion, day time.Time) ([]ExportFile, int64, error) {
+	date := day.Format("2006-01-02")
+	rows, err := db.DB.Query(dataset.query, date, day.AddDate(0, 0, 1).Format("2006-01-02"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query %s: %w", dataset.Name, err)
+	}
+	byCompany := map[int][][]interface{}{}
+	var companies []int
+	for rows.Next() {
+		values := make([]interface{}, len(dataset.Columns)+1)
+		pointers := make([]interface{}, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			rows.Close()
+			return nil, 0, fmt.Errorf("failed to read %s: %w", dataset.Name, err)
+		}
+		companyID, _ := values[0].(int64)
+		if _, seen := byCompany[int(companyID)]; !seen {
+			companies = append(companies, int(companyID))
+		}
+		byCompany[int(companyID)] = append(byCompany[int(companyID)], values[1:])
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s: %w", dataset.Name, err)
+	}
+
+	columnsJSON, _ := json.Marshal(schema.Columns)
+	dir := fmt.Sprintf("%s/v%d/dt=%s", dataset.Name, schema.MajorVersion, date)
+	if s.Prefix != "" {
+		dir = s.Prefix + "/" + dir
+	}
+
+	var files []ExportFile
+	var rowCount int64
+	for _, companyID := range companies {
+		var buf bytes.Buffer
+		err := WriteParquet(&buf, dataset.Columns, byCompany[companyID], map[string]string{
+			"tracepost.dataset":        dataset.Name,
+			"tracepost.schema_version": fmt.Sprint(schema.Version),
+			"tracepost.partition_date": date,
+			"tracepost.company_id":     fmt.Sprint(companyID),
+			"tracepost.columns":        string(columnsJSON),
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to write %s for company %d: %w", dataset.Name, companyID, err)
+		}
+
+		// The key of a partition is stable so an export of the day again replaces the file
+		key := fmt.Sprintf("%s/company_id=%d/part-0.parquet", dir, companyID)
+		etag, err := s.Storage.PutObject(key, buf.Bytes(), "application/vnd.apache.parquet")
+		if err != nil {
+			return nil, 0, err
+		}
+
+		file := ExportFile{
+			Dataset:       dataset.Name,
+			PartitionDate: date,
+			CompanyID:     companyID,
+			SchemaVersion: schema.Version,
+			ObjectKey:     key,
+			RowCount:      int64(len(byCompany[companyID])),
+			ByteSize:      int64(buf.Len()),
+			SHA256:        sha256Hex(buf.Bytes()),
+			Status:        StatusCompleted,
+		}
+		if err := recordFile(&file, etag); err != nil {
+			return nil, 0, err
+		}
+		files = append(files, file)
+		rowCount += file.RowCount
+	}
+
+	manifest, _ := json.MarshalIndent(map[string]interface{}{
+		"dataset":        dataset.Name,
+		"partition_date": date,
+		"schema_version": schema.Version,
+		"major_version":  schema.MajorVersion,
+		"columns":        schema.Columns,
+		"files":          files,
+		"row_count":      rowCount,
+		"exported_at":    time.Now().UTC(),
+	}, "", "  ")
+	if _, err := s.Storage.PutObject(dir+"/_manifest.json", manifest, "application/json"); err != nil {
+		return nil, 0, err
+	}
+	return files, rowCount, nil
+}
+
+// recordFile adds an uploaded file to the manifest, superseding earlier files of the partition
+func recordFile(file *ExportFile, etag string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE warehouse_export SET status = $4
+		WHERE dataset = $1 AND partition_date = $2::date AND company_id = $3 AND status = $5
+	`, file.Dataset, file.PartitionDate, file.CompanyID, StatusSuperseded, StatusCompleted)
+	if err != nil {
+		return fmt.Errorf("failed to update manifest: %w", err)
+	}
+	err = tx.QueryRow(`
+		INSERT INTO warehouse_export (dataset, partition_date, company_id, schema_version, object_key,
+			row_count, byte_size, sha256, etag, status, created_at)
+		VALUES ($1, $2::date, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, NOW())
+		RETURNING id, created_at
+	`, file.Dataset, file.PartitionDate, file.CompanyID, file.SchemaVersion, file.ObjectKey,
+		file.RowCount, file.ByteSize, file.SHA256, etag, file.Status).Scan(&file.ID, &file.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update manifest: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RegisterSchema returns the registered version of a dataset's current columns, registering a new version
+// when the columns changed. Appended columns keep the major version; removed or retyped columns start a new one
+func RegisterSchema(dataset *Dataset) (*SchemaVersion, error) {
+	columnsJSON, _ := json.Marshal(dataset.Columns)
+	sum := sha256.Sum256(columnsJSON)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	for attempt := 0; attempt < 3; attempt++ {
+		latest, latestFingerprint, err := latestSchema(dataset.Name)
+		if err != nil {
+			return nil, err
+		}
+		if latest != nil && latestFingerprint == fingerprint {
+			return latest, nil
+		}
+
+		next := SchemaVersion{Dataset: dataset.Name, Version: 1, MajorVersion: 1, Columns: dataset.Columns}
+		if latest != nil {
+			next.Version = latest.Version + 1
+			next.MajorVersion = latest.MajorVersion
+			if !appendOnly(latest.Columns, dataset.Columns) {
+				next.MajorVersion++
+				next.Breaking = true
+			}
+		}
+		result, err := db.DB.Exec(`
+			INSERT INTO warehouse_schema (dataset, version, major_version, columns, fingerprint, breaking, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NOW())
+			ON CONFLICT (dataset, version) DO NOTHING
+		`, next.Dataset, next.Version, next.MajorVersion, string(columnsJSON), fingerprint, next.Breaking)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register schema of %s: %w", dataset.Name, err)
+		}
+		if inserted, _ := result.RowsAffected(); inserted == 1 {
+			next.CreatedAt = time.Now().UTC()
+			return &next, nil
+		}
+		// Another instance registered the version first; compare against it
+	}
+	return nil, fmt.Errorf("failed to register schema of %s: concurrent changes", dataset.Name)
+}
+
+// appendOnly reports whether the new columns keep every old column with its type
+func appendOnly(old, current []Column) bool {
+	types := map[string]ColumnType{}
+	for _, column := range current {
+		types[column.Name] = column.Type
+	}
+	for _, column := range old {
+		if t, ok := types[column.Name]; !ok || t != column.Type {
+			return false
+		}
+	}
+	return true
+}
+
+// latestSchema loads the latest registered schema version of a dataset, nil when none is registered
+func latestSchema(dataset string) (*SchemaVersion, string, error) {
+	var fingerprint string
+	schema, err := scanSchema(db.DB.QueryRow(`
+		SELECT dataset, version, major_version, columns, breaking, created_at, fingerprint
+		FROM warehouse_schema
+		WHERE dataset = $1
+		ORDER BY version DESC
+		LIMIT 1
+	`, dataset), &fingerprint)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load schema of %s: %w", dataset, err)
+	}
+	return &schema, fingerprint, nil
+}
+
+// ListSchemas lists the registered schema versions of a dataset, newest first
+func ListSchemas(dataset string) ([]SchemaVersion, error) {
+	rows, err := db.DB.Query(`
+		SELECT dataset, version, major_version, columns, breaking, created_at, fingerprint
+		FROM warehouse_schema
+		WHERE dataset = $1
+		ORDER BY version DESC
+	`, dataset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []SchemaVersion{}
+	for rows.Next() {
+		var fingerprint string
+		schema, err := scanSchema(rows, &fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, schema)
+	}
+	return versions, rows.Err()
+}
+
+func scanSchema(row interface{ Scan(...interface{}) error }, fingerprint *string) (SchemaVersion, error) {
+	var schema SchemaVersion
+	var columns []byte
+	err := row.Scan(&schema.Dataset, &schema.Version, &schema.MajorVersion, &columns, &schema.Breaking, &schema.CreatedAt, fingerprint)
+	if err != nil {
+		return schema, err
+	}
+	if err := json.Unmarshal(columns, &schema.Columns); err != nil {
+		return schema, err
+	}
+	return schema, nil
+}
+
+// GetDay loads the export of a dataset for a day
+func GetDay(dataset string, day time.Time) (*DayExport, error) {
+	exports, err := ListDays(dataset, day, day, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(exports) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &exports[0], nil
+}
+
+// ListDays lists exported days of a dataset between two dates, newest first; zero dates are open ends
+func ListDays(dataset string, from, to time.Time, limit int) ([]DayExport, error) {
+	rows, err := db.DB.Query(`
+		SELECT dataset, partition_date, schema_version, status, file_count, row_count, COALESCE(error, ''),
+			requested_by, started_at, finished_at
+		FROM warehouse_export_day
+		WHERE ($1::text = '' OR dataset = $1) AND ($2::date IS NULL OR partition_date >= $2) AND ($3::date IS NULL OR partition_date <= $3)
+		ORDER BY partition_date DESC, dataset
+		LIMIT $4
+	`, dataset, nullDate(from), nullDate(to), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []DayExport{}
+	for rows.Next() {
+		var day DayExport
+		var partitionDate time.Time
+		var requestedBy sql.NullInt64
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&day.Dataset, &partitionDate, &day.SchemaVersion, &day.Status, &day.FileCount, &day.RowCount,
+			&day.Error, &requestedBy, &day.StartedAt, &finishedAt); err != nil {
+			return nil, err
+		}
+		day.PartitionDate = partitionDate.Format("2006-01-02")
+		if requestedBy.Valid {
+			id := int(requestedBy.Int64)
+			day.RequestedBy = &id
+		}
+		if finishedAt.Valid {
+			day.FinishedAt = &finishedAt.Time
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// ListFiles lists the files of the export manifest; superseded files are included on request
+func ListFiles(dataset string, from, to time.Time, companyID int, includeSuperseded bool) ([]ExportFile, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, dataset, partition_date, COALESCE(company_id, 0), schema_version, object_key,
+			row_count, byte_size, sha256, status, created_at
+		FROM warehouse_export
+		WHERE ($1::text = '' OR dataset = $1) AND ($2::date IS NULL OR partition_date >= $2) AND ($3::date IS NULL OR partition_date <= $3)
+			AND ($4::int = 0 OR company_id = $4) AND ($5::boolean OR status = $6)
+		ORDER BY partition_date DESC, dataset, company_id, id DESC
+		LIMIT 5000
+	`, dataset, nullDate(from), nullDate(to), companyID, includeSuperseded, StatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []ExportFile{}
+	for rows.Next() {
+		var file ExportFile
+		var partitionDate time.Time
+		if err := rows.Scan(&file.ID, &file.Dataset, &partitionDate, &file.CompanyID, &file.SchemaVersion, &file.ObjectKey,
+			&file.RowCount, &file.ByteSize, &file.SHA256, &file.Status, &file.CreatedAt); err != nil {
+			return nil, err
+		}
+		file.PartitionDate = partitionDate.Format("2006-01-02")
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+func nullDate(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,332 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LTPPPP/TracePost-larvaeChain/config"
+	"github.com/LTPPPP/TracePost-larvaeChain/db"
+	"github.com/LTPPPP/TracePost-larvaeChain/signing"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Headers sent with every webhook request
+const (
+	HeaderEvent     = "X-TracePost-Event"
+	HeaderDelivery  = "X-TracePost-Delivery"
+	HeaderTimestamp = "X-TracePost-Timestamp"
+	HeaderSignature = "X-TracePost-Signature"
+)
+
+// Envelope is the body posted to subscribers
+type Envelope struct {
+	Event     string                 `json:"event"`
+	CompanyID int                    `json:"company_id"`
+	CreatedAt time.Time              `json:"created_at"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// EventVerification is the event of the challenge sent to verify an endpoint
+const EventVerification = "webhook.verification"
+
+// Dispatcher queues webhook deliveries and posts them with retries
+type Dispatcher struct {
+	Client              *http.Client
+	MaxAttempts         int
+	RetryInterval       time.Duration
+	BatchSize           int
+	RequireVerification bool // Only deliver to subscriptions whose endpoint ownership was verified
+}
+
+var (
+	defaultDispatcher *Dispatcher
+	once              sync.Once
+)
+
+// NewDispatcher creates a dispatcher from the application config
+func NewDispatcher(cfg *config.Config) *Dispatcher {
+	return &Dispatcher{
+		Client:              &http.Client{Timeout: time.Duration(cfg.WebhookTimeoutSeconds) * time.Second},
+		MaxAttempts:         cfg.WebhookMaxAttempts,
+		RetryInterval:       time.Duration(cfg.WebhookRetryIntervalSeconds) * time.Second,
+		BatchSize:           100,
+		RequireVerification: cfg.WebhookRequireVerification,
+	}
+}
+
+// Default returns the process wide dispatcher
+func Default() *Dispatcher {
+	once.Do(func() {
+		defaultDispatcher = NewDispatcher(config.GetConfig())
+	})
+	return defaultDispatcher
+}
+
+// Dispatch queues an event for every matching subscription of a company with the default dispatcher
+func Dispatch(companyID int, eventType string, data map[string]interface{}) error {
+	return Default().Dispatch(companyID, eventType, data)
+}
+
+// Dispatch queues an event for every active subscription of a company that listens to it
+// A subscription without event types receives every event. Unverified endpoints get nothing when verification is required
+func (d *Dispatcher) Dispatch(companyID int, eventType string, data map[string]interface{}) error {
+	if db.DB == nil || companyID == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(Envelope{
+		Event:     eventType,
+		CompanyID: companyID,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	rows, err := db.DB.Query(`
+		INSERT INTO webhook_delivery (subscription_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+		SELECT id, $2::text, $3::jsonb, $4::text, 0, NOW(), NOW()
+		FROM webhook_subscription
+		WHERE company_id = $1 AND is_active = true
+			AND (cardinality(event_types) = 0 OR $2::text = ANY(event_types))
+			AND (NOT $5::bool OR verification_status = 'verified')
+		RETURNING id
+	`, companyID, eventType, string(payload), StatusPending, d.RequireVerification)
+	if err != nil {
+		return fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	for _, id := range ids {
+		go d.Deliver(id)
+	}
+	return nil
+}
+
+// Start retries pending deliveries in the background
+func (d *Dispatcher) Start() {
+	go func() {
+		for {
+			time.Sleep(d.RetryInterval)
+
+			if err := d.RunOnce(); err != nil {
+				fmt.Printf("Warning: webhook retry run failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// RunOnce attempts every pending delivery that is due
+func (d *Dispatcher) RunOnce() error {
+	if db.DB == nil {
+		return nil
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT wd.id FROM webhook_delivery wd
+		JOIN webhook_subscription ws ON wd.subscription_id = ws.id
+		WHERE wd.status = $1 AND wd.next_attempt_at <= NOW()
+			AND (NOT $3::bool OR ws.verification_status = 'verified')
+		ORDER BY wd.next_attempt_at
+		LIMIT $2
+	`, StatusPending, d.BatchSize, d.RequireVerification)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		d.Deliver(id)
+	}
+	return nil
+}
+
+// Deliver makes one attempt to post a pending delivery
+func (d *Dispatcher) Deliver(deliveryID int) {
+	// Claiming the delivery pushes its next attempt out, so concurrent workers skip it
+	// Deliveries of endpoints that are no longer verified stay queued until they are verified again
+	var attempts int
+	var eventType, payload, url, secret string
+	err := db.DB.QueryRow(`
+		UPDATE webhook_delivery wd
+		SET attempts = wd.attempts + 1,
+			next_attempt_at = NOW() + ($3 * POWER(2, wd.attempts)) * INTERVAL '1 second'
+		FROM webhook_subscription ws
+		WHERE wd.id = $1 AND wd.subscription_id = ws.id AND wd.status = $2 AND wd.next_attempt_at <= NOW()
+			AND (NOT $4::bool OR ws.verification_status = 'verified')
+		RETURNING wd.attempts, wd.event_type, wd.payload, ws.url, ws.secret
+	`, deliveryID, StatusPending, int(d.RetryInterval.Seconds()), d.RequireVerification).Scan(&attempts, &eventType, &payload, &url, &secret)
+	if err != nil {
+		return
+	}
+
+	statusCode, err := d.post(url, secret, deliveryID, eventType, []byte(payload))
+	if err == nil {
+		db.DB.Exec(`
+			UPDATE webhook_delivery
+			SET status = $2, response_code = $3, last_error = NULL, delivered_at = NOW()
+			WHERE id = $1
+		`, deliveryID, StatusDelivered, statusCode)
+		return
+	}
+
+	status := StatusPending
+	if attempts >= d.MaxAttempts {
+		status = StatusFailed
+	}
+	db.DB.Exec(`
+		UPDATE webhook_delivery
+		SET status = $2, response_code = NULLIF($3, 0), last_error = $4
+		WHERE id = $1
+	`, deliveryID, status, statusCode, err.Error())
+}
+
+// post sends a signed webhook request and reports the response status
+func (d *Dispatcher) post(url, secret string, deliveryID int, eventType string, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TracePost-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(deliveryID))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+	if err := signJWS(req, body); err != nil {
+		return 0, err
+	}
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("subscriber returned HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// VerifyCallback sends a signed challenge to an endpoint, which proves ownership by echoing it
+// The endpoint must answer with a 2xx status and the JSON body {"challenge": "<challenge>"}
+func (d *Dispatcher) VerifyCallback(url, secret, challenge string) error {
+	body, err := json.Marshal(Envelope{
+		Event:     EventVerification,
+		CreatedAt: time.Now().UTC(),
+		Data:      map[string]interface{}{"challenge": challenge},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TracePost-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, EventVerification)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+	if err := signJWS(req, body); err != nil {
+		return err
+	}
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned HTTP %d", resp.StatusCode)
+	}
+	var answer struct {
+		Challenge string `json:"challenge"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&answer); err != nil {
+		return fmt.Errorf("endpoint did not answer with a JSON challenge: %w", err)
+	}
+	if !hmac.Equal([]byte(answer.Challenge), []byte(challenge)) {
+		return fmt.Errorf("endpoint answered with the wrong challenge")
+	}
+	return nil
+}
+
+// signJWS adds the detached JWS of a body, which receivers verify against the published JWKS
+func signJWS(req *http.Request, body []byte) error {
+	jws, err := signing.Sign(body)
+	if err != nil {
+		return fmt.Errorf("failed to sign payload: %w", err)
+	}
+	req.Header.Set(signing.HeaderName, jws)
+	return nil
+}
+
+// Redeliver queues a delivery again for an immediate attempt
+func Redeliver(deliveryID int) error {
+	result, err := db.DB.Exec(`
+		UPDATE webhook_delivery
+		SET status = $2, attempts = 0, next_attempt_at = NOW(), delivered_at = NULL
+		WHERE id = $1
+	`, deliveryID, StatusPending)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("webhook delivery %d not found", deliveryID)
+	}
+	go Default().Deliver(deliveryID)
+	return nil
+}
+
+// Sign computes the signature header of a webhook body
+// Receivers recompute HMAC-SHA256 over "<timestamp>.<body>" with their subscription secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateSecret creates a random signing secret for a new subscription
+func GenerateSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(raw), nil
+}